@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+)
+
+// BackendMismatchError is returned by CatchUp when the log's latest root can't have
+// grown from the trusted one: the log has gone back to a smaller tree, e.g. after being
+// restored from an old backup, or has forked.
+type BackendMismatchError struct {
+	Trusted, Latest trillian.SignedLogRoot
+	// Regressed is set if the latest tree is smaller than the trusted one. Otherwise the
+	// two trees are inconsistent, and Err says why.
+	Regressed bool
+	Err       error
+}
+
+func (e *BackendMismatchError) Error() string {
+	if e.Regressed {
+		return fmt.Sprintf("client: log has regressed from trusted tree size %d to %d", e.Trusted.TreeSize, e.Latest.TreeSize)
+	}
+	return fmt.Sprintf("client: log has forked, root for tree size %d is not consistent with trusted size %d: %v", e.Latest.TreeSize, e.Trusted.TreeSize, e.Err)
+}
+
+// CatchUp is UpdateRoot for a client starting afresh with a root it trusted before, e.g.
+// the last one a personality saw before it was restarted. It fetches the latest root from
+// the log and checks that it's consistent with trusted, returning a *BackendMismatchError
+// if it isn't. Both roots are then in the window. A nil or empty trusted root is just
+// UpdateRoot. The window must be empty.
+func (c *LogClient) CatchUp(ctx context.Context, trusted *trillian.SignedLogRoot) (*trillian.SignedLogRoot, error) {
+	if c.window.Latest() != nil {
+		return nil, fmt.Errorf("client: CatchUp needs a client with no verified roots")
+	}
+	if trusted == nil || trusted.TreeSize == 0 {
+		return c.UpdateRoot(ctx)
+	}
+	root, err := c.getLatestRoot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var proof [][]byte
+	switch {
+	case root.TreeSize < trusted.TreeSize:
+		return nil, &BackendMismatchError{Trusted: *trusted, Latest: *root, Regressed: true}
+	case root.TreeSize == trusted.TreeSize:
+		if !bytes.Equal(root.RootHash, trusted.RootHash) {
+			return nil, &BackendMismatchError{Trusted: *trusted, Latest: *root, Err: fmt.Errorf("root hash %x != %x", root.RootHash, trusted.RootHash)}
+		}
+	default:
+		if proof, err = c.getConsistencyProof(ctx, trusted.TreeSize, root.TreeSize); err != nil {
+			return nil, err
+		}
+		if err := c.hasher.VerifyConsistency(trusted.TreeSize, root.TreeSize, trusted.RootHash, root.RootHash, proof); err != nil {
+			return nil, &BackendMismatchError{Trusted: *trusted, Latest: *root, Err: err}
+		}
+	}
+
+	if err := c.window.Add(*trusted, nil); err != nil {
+		return nil, err
+	}
+	if err := c.window.Add(*root, proof); err != nil {
+		return nil, err
+	}
+	return c.window.Latest(), nil
+}
+
+// ReadRootFile reads a root saved by WriteRootFile, for passing to CatchUp. It returns nil
+// if the file doesn't exist.
+func ReadRootFile(path string) (*trillian.SignedLogRoot, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var root trillian.SignedLogRoot
+	if err := proto.UnmarshalText(string(data), &root); err != nil {
+		return nil, fmt.Errorf("client: failed to parse root in %s: %v", path, err)
+	}
+	return &root, nil
+}
+
+// WriteRootFile saves root to a file as a text format protobuf, replacing the file in one
+// step so that a crash can't leave it half written.
+func WriteRootFile(path string, root trillian.SignedLogRoot) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(proto.MarshalTextString(&root)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/mockclient"
+	"golang.org/x/net/context"
+)
+
+func TestCatchUp(t *testing.T) {
+	_, mt := newTestTree(t, 20)
+	_, forked := newTestTree(t, 10)
+	forkedRoot := rootAt(forked, 10)
+	forkedRoot.RootHash = append([]byte(nil), forkedRoot.RootHash...)
+	forkedRoot.RootHash[0] ^= 1
+
+	var tests = []struct {
+		descr         string
+		trusted       *trillian.SignedLogRoot
+		latest        trillian.SignedLogRoot
+		proofFrom     int64 // tree size of the consistency proof served, if any
+		wantRegressed bool
+		wantForked    bool
+	}{
+		{descr: "no-trusted", latest: rootAt(mt, 8)},
+		{descr: "grown", trusted: rootPtr(rootAt(mt, 8)), latest: rootAt(mt, 13), proofFrom: 8},
+		{descr: "same", trusted: rootPtr(rootAt(mt, 13)), latest: rootAt(mt, 13)},
+		{descr: "regressed", trusted: rootPtr(rootAt(mt, 13)), latest: rootAt(mt, 8), wantRegressed: true},
+		{descr: "forked-same-size", trusted: &forkedRoot, latest: rootAt(mt, 10), wantForked: true},
+		{descr: "forked", trusted: &forkedRoot, latest: rootAt(mt, 20), proofFrom: 10, wantForked: true},
+	}
+
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+		mc := mockclient.NewMockTrillianLogClient(ctrl)
+		client := NewLogClient(logID, mc, DefaultWindowSize)
+		expectRoot(mc, test.latest)
+		if test.proofFrom > 0 {
+			mc.EXPECT().GetConsistencyProof(gomock.Any(), &trillian.GetConsistencyProofRequest{LogId: logID, FirstTreeSize: test.proofFrom, SecondTreeSize: test.latest.TreeSize}).Return(
+				&trillian.GetConsistencyProofResponse{Status: okStatus, Proof: toProof(0, mt.SnapshotConsistency(int(test.proofFrom), int(test.latest.TreeSize)))}, nil)
+		}
+
+		root, err := client.CatchUp(context.Background(), test.trusted)
+		if test.wantRegressed || test.wantForked {
+			mismatch, ok := err.(*BackendMismatchError)
+			if !ok {
+				t.Errorf("%s: CatchUp()=_,%v, want *BackendMismatchError", test.descr, err)
+			} else if got, want := mismatch.Regressed, test.wantRegressed; got != want {
+				t.Errorf("%s: CatchUp() error %v, Regressed=%v, want %v", test.descr, err, got, want)
+			}
+			if got := client.Window().Latest(); got != nil {
+				t.Errorf("%s: Latest()=%v, want nil", test.descr, got)
+			}
+		} else if err != nil {
+			t.Errorf("%s: CatchUp()=_,%v, want no error", test.descr, err)
+		} else if got, want := root.TreeSize, test.latest.TreeSize; got != want {
+			t.Errorf("%s: CatchUp().TreeSize=%d, want %d", test.descr, got, want)
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestCatchUpNeedsEmptyWindow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	_, mt := newTestTree(t, 8)
+	mc := mockclient.NewMockTrillianLogClient(ctrl)
+	client := NewLogClient(logID, mc, DefaultWindowSize)
+
+	expectRoot(mc, rootAt(mt, 8))
+	if _, err := client.UpdateRoot(context.Background()); err != nil {
+		t.Fatalf("UpdateRoot()=%v, want nil", err)
+	}
+	if _, err := client.CatchUp(context.Background(), rootPtr(rootAt(mt, 8))); err == nil {
+		t.Errorf("CatchUp(verified roots)=_,nil, want error")
+	}
+}
+
+func TestRootFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catch_up_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "root")
+
+	if root, err := ReadRootFile(path); root != nil || err != nil {
+		t.Errorf("ReadRootFile(missing)=%v,%v, want nil,nil", root, err)
+	}
+	_, mt := newTestTree(t, 5)
+	want := rootAt(mt, 5)
+	want.TimestampNanos = 12345
+	if err := WriteRootFile(path, want); err != nil {
+		t.Fatalf("WriteRootFile()=%v, want nil", err)
+	}
+	got, err := ReadRootFile(path)
+	if err != nil {
+		t.Fatalf("ReadRootFile()=_,%v, want no error", err)
+	}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("ReadRootFile()=%v, want %v", got, want)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("not a root"), 0644); err != nil {
+		t.Fatalf("Failed to write root file: %v", err)
+	}
+	if _, err := ReadRootFile(path); err == nil {
+		t.Errorf("ReadRootFile(garbage)=_,nil, want error")
+	}
+}
+
+func rootPtr(root trillian.SignedLogRoot) *trillian.SignedLogRoot {
+	return &root
+}
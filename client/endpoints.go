@@ -0,0 +1,355 @@
+package client
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultEndpointRetryAfter is how long an EndpointSet avoids an unavailable endpoint.
+	DefaultEndpointRetryAfter = 30 * time.Second
+	// latencyWeight is the weight of each new sample in an endpoint's latency average.
+	latencyWeight = 0.3
+)
+
+// Endpoint is one of the log servers that serve a log, e.g. the one in a particular
+// region.
+type Endpoint struct {
+	// Name identifies the endpoint in stats, e.g. its region or address.
+	Name   string
+	Client trillian.TrillianLogClient
+	// Priority says how strongly the endpoint is preferred, lower first. Deployments that
+	// serve a log from several regions give the local region's endpoints the lowest
+	// priority. Endpoints with the same priority are ordered by their latency.
+	Priority int
+}
+
+type endpoint struct {
+	Endpoint
+
+	mu        sync.Mutex
+	downUntil time.Time
+	latency   time.Duration // moving average, zero until measured
+
+	requests  *expvar.Int
+	failures  *expvar.Int
+	latencyMs *expvar.Int
+}
+
+// EndpointSet is a trillian.TrillianLogClient that sends each RPC to the most preferred
+// healthy endpoint, by priority and then latency. An RPC that fails because its endpoint
+// is unavailable is tried on the next endpoint in order, and the failed endpoint isn't
+// preferred again until its retry period has passed or a probe finds it healthy.
+// Endpoints that are down are only used when no healthy one is left.
+//
+// An EndpointSet is passed to NewLogClient in place of a single connection, and can be
+// combined with the client's retry and hedging options.
+type EndpointSet struct {
+	endpoints  []*endpoint
+	retryAfter time.Duration
+	now        func() time.Time
+
+	vars      *expvar.Map
+	failovers *expvar.Int
+}
+
+// NewEndpointSet creates an EndpointSet over endpoints. An endpoint whose RPCs fail as
+// unavailable is avoided for retryAfter, or DefaultEndpointRetryAfter if it's zero.
+func NewEndpointSet(endpoints []Endpoint, retryAfter time.Duration) (*EndpointSet, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("no endpoints")
+	}
+	if retryAfter <= 0 {
+		retryAfter = DefaultEndpointRetryAfter
+	}
+	s := &EndpointSet{retryAfter: retryAfter, now: time.Now, vars: new(expvar.Map).Init(), failovers: new(expvar.Int)}
+	s.vars.Set("failovers", s.failovers)
+	for _, e := range endpoints {
+		if e.Client == nil {
+			return nil, fmt.Errorf("endpoint %s has no client", e.Name)
+		}
+		ep := &endpoint{Endpoint: e, requests: new(expvar.Int), failures: new(expvar.Int), latencyMs: new(expvar.Int)}
+		stats := new(expvar.Map).Init()
+		stats.Set("requests", ep.requests)
+		stats.Set("failures", ep.failures)
+		stats.Set("latency-ms", ep.latencyMs)
+		s.vars.Set(e.Name, stats)
+		s.endpoints = append(s.endpoints, ep)
+	}
+	return s, nil
+}
+
+// Vars returns the stats of the set: the number of RPCs that failed over to another
+// endpoint, and for each endpoint the number of RPCs and unavailable failures and its
+// average latency. They can be published with expvar.Publish.
+func (s *EndpointSet) Vars() *expvar.Map {
+	return s.vars
+}
+
+// Order returns the names of the endpoints in the order RPCs try them.
+func (s *EndpointSet) Order() []string {
+	var names []string
+	for _, e := range s.order() {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+// Probe checks every endpoint with a GetLatestSignedLogRoot request for the log, which
+// updates their latencies and marks those that fail as down and those that succeed as
+// healthy again. It waits for all the probes to complete or ctx to be done.
+func (s *EndpointSet) Probe(ctx context.Context, logID int64) {
+	var wg sync.WaitGroup
+	for _, e := range s.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			start := s.now()
+			_, err := e.Client.GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: logID})
+			if err != nil {
+				if ctx.Err() == nil {
+					e.markDown(s.now().Add(s.retryAfter))
+				}
+				return
+			}
+			e.observe(s.now().Sub(start))
+			e.markDown(time.Time{})
+		}(e)
+	}
+	wg.Wait()
+}
+
+// RunProbes probes the endpoints every interval until ctx is done.
+func (s *EndpointSet) RunProbes(ctx context.Context, logID int64, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.Probe(ctx, logID)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *endpoint) healthy(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !now.Before(e.downUntil)
+}
+
+func (e *endpoint) markDown(until time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.downUntil = until
+}
+
+// observe adds a latency sample to the endpoint's moving average.
+func (e *endpoint) observe(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.latency == 0 {
+		e.latency = d
+	} else {
+		e.latency = time.Duration(latencyWeight*float64(d) + (1-latencyWeight)*float64(e.latency))
+	}
+	e.latencyMs.Set(int64(e.latency / time.Millisecond))
+}
+
+func (e *endpoint) averageLatency() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.latency
+}
+
+// byPreference sorts endpoints so that healthy ones come first, each group ordered by
+// priority and then latency.
+type byPreference []rankedEndpoint
+
+type rankedEndpoint struct {
+	e       *endpoint
+	healthy bool
+	latency time.Duration
+}
+
+func (b byPreference) Len() int      { return len(b) }
+func (b byPreference) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byPreference) Less(i, j int) bool {
+	if b[i].healthy != b[j].healthy {
+		return b[i].healthy
+	}
+	if b[i].e.Priority != b[j].e.Priority {
+		return b[i].e.Priority < b[j].e.Priority
+	}
+	return b[i].latency < b[j].latency
+}
+
+// order returns the endpoints in the order an RPC should try them.
+func (s *EndpointSet) order() []*endpoint {
+	now := s.now()
+	ranked := make(byPreference, 0, len(s.endpoints))
+	for _, e := range s.endpoints {
+		ranked = append(ranked, rankedEndpoint{e: e, healthy: e.healthy(now), latency: e.averageLatency()})
+	}
+	sort.Stable(ranked)
+	ordered := make([]*endpoint, 0, len(ranked))
+	for _, r := range ranked {
+		ordered = append(ordered, r.e)
+	}
+	return ordered
+}
+
+// call makes an RPC with rpc, trying each endpoint in turn until one doesn't fail as
+// unavailable or the context is done.
+func (s *EndpointSet) call(ctx context.Context, rpc func(trillian.TrillianLogClient) error) error {
+	var err error
+	for i, e := range s.order() {
+		if i > 0 {
+			s.failovers.Add(1)
+		}
+		e.requests.Add(1)
+		start := s.now()
+		err = rpc(e.Client)
+		if status.Code(err) != codes.Unavailable {
+			e.observe(s.now().Sub(start))
+			return err
+		}
+		e.failures.Add(1)
+		e.markDown(s.now().Add(s.retryAfter))
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// QueueLeaves implements trillian.TrillianLogClient.
+func (s *EndpointSet) QueueLeaves(ctx context.Context, in *trillian.QueueLeavesRequest, opts ...grpc.CallOption) (*trillian.QueueLeavesResponse, error) {
+	var rsp *trillian.QueueLeavesResponse
+	err := s.call(ctx, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.QueueLeaves(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetInclusionProof implements trillian.TrillianLogClient.
+func (s *EndpointSet) GetInclusionProof(ctx context.Context, in *trillian.GetInclusionProofRequest, opts ...grpc.CallOption) (*trillian.GetInclusionProofResponse, error) {
+	var rsp *trillian.GetInclusionProofResponse
+	err := s.call(ctx, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetInclusionProof(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetInclusionProofByHash implements trillian.TrillianLogClient.
+func (s *EndpointSet) GetInclusionProofByHash(ctx context.Context, in *trillian.GetInclusionProofByHashRequest, opts ...grpc.CallOption) (*trillian.GetInclusionProofByHashResponse, error) {
+	var rsp *trillian.GetInclusionProofByHashResponse
+	err := s.call(ctx, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetInclusionProofByHash(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetConsistencyProof implements trillian.TrillianLogClient.
+func (s *EndpointSet) GetConsistencyProof(ctx context.Context, in *trillian.GetConsistencyProofRequest, opts ...grpc.CallOption) (*trillian.GetConsistencyProofResponse, error) {
+	var rsp *trillian.GetConsistencyProofResponse
+	err := s.call(ctx, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetConsistencyProof(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetLatestSignedLogRoot implements trillian.TrillianLogClient.
+func (s *EndpointSet) GetLatestSignedLogRoot(ctx context.Context, in *trillian.GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*trillian.GetLatestSignedLogRootResponse, error) {
+	var rsp *trillian.GetLatestSignedLogRootResponse
+	err := s.call(ctx, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetLatestSignedLogRoot(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetTreeHeadByTimestamp implements trillian.TrillianLogClient.
+func (s *EndpointSet) GetTreeHeadByTimestamp(ctx context.Context, in *trillian.GetTreeHeadByTimestampRequest, opts ...grpc.CallOption) (*trillian.GetTreeHeadByTimestampResponse, error) {
+	var rsp *trillian.GetTreeHeadByTimestampResponse
+	err := s.call(ctx, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetTreeHeadByTimestamp(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetTreeHeadBySize implements trillian.TrillianLogClient.
+func (s *EndpointSet) GetTreeHeadBySize(ctx context.Context, in *trillian.GetTreeHeadBySizeRequest, opts ...grpc.CallOption) (*trillian.GetTreeHeadBySizeResponse, error) {
+	var rsp *trillian.GetTreeHeadBySizeResponse
+	err := s.call(ctx, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetTreeHeadBySize(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetSequencedLeafCount implements trillian.TrillianLogClient.
+func (s *EndpointSet) GetSequencedLeafCount(ctx context.Context, in *trillian.GetSequencedLeafCountRequest, opts ...grpc.CallOption) (*trillian.GetSequencedLeafCountResponse, error) {
+	var rsp *trillian.GetSequencedLeafCountResponse
+	err := s.call(ctx, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetSequencedLeafCount(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetLeavesByIndex implements trillian.TrillianLogClient.
+func (s *EndpointSet) GetLeavesByIndex(ctx context.Context, in *trillian.GetLeavesByIndexRequest, opts ...grpc.CallOption) (*trillian.GetLeavesByIndexResponse, error) {
+	var rsp *trillian.GetLeavesByIndexResponse
+	err := s.call(ctx, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetLeavesByIndex(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetLeavesByHash implements trillian.TrillianLogClient.
+func (s *EndpointSet) GetLeavesByHash(ctx context.Context, in *trillian.GetLeavesByHashRequest, opts ...grpc.CallOption) (*trillian.GetLeavesByHashResponse, error) {
+	var rsp *trillian.GetLeavesByHashResponse
+	err := s.call(ctx, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetLeavesByHash(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetLeavesByLeafValueHash implements trillian.TrillianLogClient.
+func (s *EndpointSet) GetLeavesByLeafValueHash(ctx context.Context, in *trillian.GetLeavesByHashRequest, opts ...grpc.CallOption) (*trillian.GetLeavesByHashResponse, error) {
+	var rsp *trillian.GetLeavesByHashResponse
+	err := s.call(ctx, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetLeavesByLeafValueHash(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetEntryAndProof implements trillian.TrillianLogClient.
+func (s *EndpointSet) GetEntryAndProof(ctx context.Context, in *trillian.GetEntryAndProofRequest, opts ...grpc.CallOption) (*trillian.GetEntryAndProofResponse, error) {
+	var rsp *trillian.GetEntryAndProofResponse
+	err := s.call(ctx, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetEntryAndProof(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
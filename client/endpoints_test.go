@@ -0,0 +1,170 @@
+package client
+
+import (
+	"expvar"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/mockclient"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ trillian.TrillianLogClient = &EndpointSet{}
+
+// fakeClock is a settable time for EndpointSet tests.
+type fakeClock struct {
+	t time.Time
+}
+
+func (f *fakeClock) now() time.Time {
+	return f.t
+}
+
+func newTestEndpointSet(t *testing.T, ctrl *gomock.Controller, endpoints []Endpoint) (*EndpointSet, map[string]*mockclient.MockTrillianLogClient, *fakeClock) {
+	clients := make(map[string]*mockclient.MockTrillianLogClient)
+	for i := range endpoints {
+		mc := mockclient.NewMockTrillianLogClient(ctrl)
+		clients[endpoints[i].Name] = mc
+		endpoints[i].Client = mc
+	}
+	s, err := NewEndpointSet(endpoints, time.Minute)
+	if err != nil {
+		t.Fatalf("NewEndpointSet()=_,%v", err)
+	}
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	s.now = clock.now
+	return s, clients, clock
+}
+
+func TestNewEndpointSetErrors(t *testing.T) {
+	if _, err := NewEndpointSet(nil, 0); err == nil {
+		t.Errorf("NewEndpointSet(nil)=_,nil, want error")
+	}
+	if _, err := NewEndpointSet([]Endpoint{{Name: "local"}}, 0); err == nil {
+		t.Errorf("NewEndpointSet(no client)=_,nil, want error")
+	}
+}
+
+func TestEndpointSetFailover(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, clients, clock := newTestEndpointSet(t, ctrl, []Endpoint{
+		{Name: "remote", Priority: 1},
+		{Name: "local", Priority: 0},
+		{Name: "far", Priority: 2},
+	})
+	req := &trillian.GetSequencedLeafCountRequest{LogId: logID}
+	rsp := &trillian.GetSequencedLeafCountResponse{Status: okStatus, LeafCount: 3}
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	if got, want := s.Order(), []string{"local", "remote", "far"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Order()=%v, want %v", got, want)
+	}
+
+	// The local endpoint is unavailable, so the RPC fails over to the remote one.
+	gomock.InOrder(
+		clients["local"].EXPECT().GetSequencedLeafCount(gomock.Any(), req).Return(nil, unavailable),
+		clients["remote"].EXPECT().GetSequencedLeafCount(gomock.Any(), req).Return(rsp, nil),
+	)
+	if got, err := s.GetSequencedLeafCount(context.Background(), req); err != nil || got != rsp {
+		t.Fatalf("GetSequencedLeafCount()=%v,%v, want %v,nil", got, err, rsp)
+	}
+	if got, want := s.Order(), []string{"remote", "far", "local"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Order() after failover=%v, want %v", got, want)
+	}
+
+	// Other errors are returned without failing over.
+	invalid := status.Error(codes.InvalidArgument, "bad")
+	clients["remote"].EXPECT().GetSequencedLeafCount(gomock.Any(), req).Return(nil, invalid)
+	if _, err := s.GetSequencedLeafCount(context.Background(), req); err != invalid {
+		t.Errorf("GetSequencedLeafCount()=_,%v, want %v", err, invalid)
+	}
+
+	// The local endpoint is preferred again once its retry period has passed.
+	clock.t = clock.t.Add(2 * time.Minute)
+	if got, want := s.Order(), []string{"local", "remote", "far"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Order() after retry period=%v, want %v", got, want)
+	}
+
+	if got, want := s.Vars().Get("failovers").String(), "1"; got != want {
+		t.Errorf("failovers=%s, want %s", got, want)
+	}
+	if got, want := s.Vars().String(), `"failures": 1`; !strings.Contains(got, want) {
+		t.Errorf("Vars()=%s, want to find %s", got, want)
+	}
+}
+
+func TestEndpointSetAllDown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, clients, _ := newTestEndpointSet(t, ctrl, []Endpoint{{Name: "a"}, {Name: "b"}})
+	req := &trillian.QueueLeavesRequest{LogId: logID}
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	clients["a"].EXPECT().QueueLeaves(gomock.Any(), req).Return(nil, unavailable)
+	clients["b"].EXPECT().QueueLeaves(gomock.Any(), req).Return(nil, unavailable)
+	if _, err := s.QueueLeaves(context.Background(), req); status.Code(err) != codes.Unavailable {
+		t.Errorf("QueueLeaves()=_,%v, want unavailable", err)
+	}
+
+	// Endpoints that are down are still tried when there's nothing better.
+	rsp := &trillian.QueueLeavesResponse{Status: okStatus}
+	clients["a"].EXPECT().QueueLeaves(gomock.Any(), req).Return(rsp, nil)
+	if got, err := s.QueueLeaves(context.Background(), req); err != nil || got != rsp {
+		t.Errorf("QueueLeaves()=%v,%v, want %v,nil", got, err, rsp)
+	}
+}
+
+func TestEndpointSetLatency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, _, _ := newTestEndpointSet(t, ctrl, []Endpoint{{Name: "slow"}, {Name: "fast"}, {Name: "remote", Priority: 1}})
+	s.endpoints[0].observe(50 * time.Millisecond)
+	s.endpoints[1].observe(10 * time.Millisecond)
+	s.endpoints[2].observe(time.Millisecond)
+
+	// Latency only orders endpoints of the same priority.
+	if got, want := s.Order(), []string{"fast", "slow", "remote"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Order()=%v, want %v", got, want)
+	}
+
+	// The average moves towards new samples.
+	for i := 0; i < 10; i++ {
+		s.endpoints[1].observe(100 * time.Millisecond)
+	}
+	if got, want := s.Order(), []string{"slow", "fast", "remote"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Order() after slowdown=%v, want %v", got, want)
+	}
+	if got, want := s.Vars().Get("slow").(*expvar.Map).Get("latency-ms").String(), "50"; got != want {
+		t.Errorf("latency-ms=%s, want %s", got, want)
+	}
+}
+
+func TestEndpointSetProbe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	s, clients, _ := newTestEndpointSet(t, ctrl, []Endpoint{{Name: "broken"}, {Name: "ok"}})
+	req := &trillian.GetLatestSignedLogRootRequest{LogId: logID}
+	rsp := &trillian.GetLatestSignedLogRootResponse{Status: okStatus}
+
+	clients["broken"].EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Return(nil, status.Error(codes.NotFound, "no such log"))
+	clients["ok"].EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Return(rsp, nil)
+	s.Probe(context.Background(), logID)
+	if got, want := s.Order(), []string{"ok", "broken"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Order() after failed probe=%v, want %v", got, want)
+	}
+
+	// A successful probe brings the endpoint back before its retry period is over.
+	clients["broken"].EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Return(rsp, nil)
+	clients["ok"].EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Return(rsp, nil)
+	s.Probe(context.Background(), logID)
+	if got, want := s.Order(), []string{"broken", "ok"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Order() after successful probe=%v, want %v", got, want)
+	}
+}
@@ -0,0 +1,231 @@
+// Package client contains a Trillian log client that verifies the roots and proofs
+// it receives from the log server.
+//
+// This is one of Trillian's stable API packages (see docs/APIStability.md), and it
+// doesn't expose the merkle or storage packages it depends on.
+package client
+
+import (
+	"fmt"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/verifier"
+	"golang.org/x/net/context"
+)
+
+// DefaultWindowSize is the number of verified roots a LogClient keeps by default.
+const DefaultWindowSize = 8
+
+// LogClient represents a client for a given Trillian log instance. It keeps a
+// window of recently verified roots so that inclusion proofs fetched against any
+// of them can be checked.
+type LogClient struct {
+	LogID  int64
+	client trillian.TrillianLogClient
+	hasher *verifier.LogVerifier
+	window *RootWindow
+	opts   options
+}
+
+// NewLogClient returns a new LogClient for the log with the given ID that keeps up
+// to windowSize verified roots. Its behaviour can be tuned with opts.
+func NewLogClient(logID int64, client trillian.TrillianLogClient, windowSize int, opts ...Option) *LogClient {
+	// TODO(Martin2112): The tree hasher should come from the log's configuration.
+	hasher := verifier.NewLogVerifier()
+	c := &LogClient{
+		LogID:  logID,
+		client: client,
+		hasher: hasher,
+		window: NewRootWindow(hasher, windowSize),
+		opts:   defaultOptions(),
+	}
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+	return c
+}
+
+// WithOptions returns a copy of the client with opts applied on top of its current
+// options. The copy shares the client's connection and window of verified roots, so it
+// can be used to change behaviour for particular calls.
+func (c *LogClient) WithOptions(opts ...Option) *LogClient {
+	clone := *c
+	for _, opt := range opts {
+		opt(&clone.opts)
+	}
+	return &clone
+}
+
+// Window returns the window of roots verified by this client.
+func (c *LogClient) Window() *RootWindow {
+	return c.window
+}
+
+// UpdateRoot fetches the latest signed root from the log and, if it is newer than
+// the latest verified root, verifies it is consistent before adding it to the window.
+// A root for a smaller tree than the latest verified one is rejected, as is one that
+// isn't signed by the log's key if the client was given it with WithPublicKey.
+func (c *LogClient) UpdateRoot(ctx context.Context) (*trillian.SignedLogRoot, error) {
+	root, err := c.getLatestRoot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var proof [][]byte
+	if latest := c.window.Latest(); latest != nil {
+		if root.TreeSize < latest.TreeSize {
+			return nil, fmt.Errorf("client: log returned root for tree size %d, smaller than verified size %d", root.TreeSize, latest.TreeSize)
+		}
+		if latest.TreeSize > 0 && root.TreeSize > latest.TreeSize {
+			if proof, err = c.getConsistencyProof(ctx, latest.TreeSize, root.TreeSize); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := c.window.Add(*root, proof); err != nil {
+		return nil, err
+	}
+	return c.window.Latest(), nil
+}
+
+// getLatestRoot fetches the latest signed root from the log, and checks its signature if
+// the client has the log's key. It doesn't check the root against those already verified.
+func (c *LogClient) getLatestRoot(ctx context.Context) (*trillian.SignedLogRoot, error) {
+	r, err := c.call(ctx, true, func(ctx context.Context) (interface{}, error) {
+		return c.client.GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: c.LogID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	rsp := r.(*trillian.GetLatestSignedLogRootResponse)
+	if !statusOK(rsp.GetStatus()) {
+		return nil, fmt.Errorf("GetLatestSignedLogRoot failed, status=%v", rsp.GetStatus())
+	}
+	root := rsp.GetSignedLogRoot()
+	if root == nil {
+		return nil, fmt.Errorf("GetLatestSignedLogRoot returned no root")
+	}
+	if c.opts.pubKey != nil {
+		if err := verifier.VerifyLogRootSignature(c.opts.pubKey, *root); err != nil {
+			return nil, fmt.Errorf("client: root for tree size %d: %v", root.TreeSize, err)
+		}
+	}
+	return root, nil
+}
+
+// getConsistencyProof fetches the proof that the tree of size second extends the one of
+// size first.
+func (c *LogClient) getConsistencyProof(ctx context.Context, first, second int64) ([][]byte, error) {
+	req := &trillian.GetConsistencyProofRequest{
+		LogId:          c.LogID,
+		FirstTreeSize:  first,
+		SecondTreeSize: second,
+	}
+	r, err := c.call(ctx, true, func(ctx context.Context) (interface{}, error) {
+		return c.client.GetConsistencyProof(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	rsp := r.(*trillian.GetConsistencyProofResponse)
+	if !statusOK(rsp.GetStatus()) {
+		return nil, fmt.Errorf("GetConsistencyProof failed, status=%v", rsp.GetStatus())
+	}
+	return proofHashes(rsp.GetProof()), nil
+}
+
+// VerifyInclusion checks that data has been integrated into the log, accepting a
+// proof against any of the verified roots in the window. The newest roots are
+// tried first.
+func (c *LogClient) VerifyInclusion(ctx context.Context, data []byte) error {
+	return c.VerifyInclusionByHash(ctx, c.hasher.HashLeaf(data))
+}
+
+// VerifyInclusionByHash checks that the leaf with the given Merkle leaf hash has
+// been integrated into the log, accepting a proof against any of the verified
+// roots in the window. The newest roots are tried first.
+func (c *LogClient) VerifyInclusionByHash(ctx context.Context, leafHash []byte) error {
+	roots := c.window.Roots()
+	if len(roots) == 0 {
+		return fmt.Errorf("no verified roots, call UpdateRoot first")
+	}
+
+	var lastErr error
+	for i := len(roots) - 1; i >= 0; i-- {
+		root := roots[i]
+		if root.TreeSize == 0 {
+			continue
+		}
+		req := &trillian.GetInclusionProofByHashRequest{
+			LogId:           c.LogID,
+			LeafHash:        leafHash,
+			TreeSize:        root.TreeSize,
+			OrderBySequence: true,
+		}
+		r, err := c.call(ctx, true, func(ctx context.Context) (interface{}, error) {
+			return c.client.GetInclusionProofByHash(ctx, req)
+		})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		rsp := r.(*trillian.GetInclusionProofByHashResponse)
+		if !statusOK(rsp.GetStatus()) {
+			lastErr = fmt.Errorf("GetInclusionProofByHash failed, status=%v", rsp.GetStatus())
+			continue
+		}
+		for _, proof := range rsp.GetProof() {
+			if err := c.window.VerifyInclusion(leafHash, proof.LeafIndex, root.TreeSize, proofHashes(proof)); err != nil {
+				lastErr = err
+				continue
+			}
+			return nil
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no inclusion proof returned for tree size %d", root.TreeSize)
+		}
+	}
+	return fmt.Errorf("leaf hash %x not verified against any root in window: %v", leafHash, lastErr)
+}
+
+// QueueLeaves queues leaves with the given data for inclusion in the log. The leaves are
+// sent in batches of at most the client's maximum batch size, in order; if a batch fails
+// the error says how many leaves were queued before it.
+func (c *LogClient) QueueLeaves(ctx context.Context, data [][]byte) error {
+	for start := 0; start < len(data); start += c.opts.maxBatch {
+		end := start + c.opts.maxBatch
+		if end > len(data) {
+			end = len(data)
+		}
+		req := &trillian.QueueLeavesRequest{LogId: c.LogID}
+		for _, d := range data[start:end] {
+			req.Leaves = append(req.Leaves, &trillian.LogLeaf{LeafValue: d})
+		}
+		r, err := c.call(ctx, false, func(ctx context.Context) (interface{}, error) {
+			return c.client.QueueLeaves(ctx, req)
+		})
+		if err == nil && !statusOK(r.(*trillian.QueueLeavesResponse).GetStatus()) {
+			err = fmt.Errorf("QueueLeaves failed, status=%v", r.(*trillian.QueueLeavesResponse).GetStatus())
+		}
+		if err != nil {
+			return fmt.Errorf("queued %d of %d leaves: %v", start, len(data), err)
+		}
+	}
+	return nil
+}
+
+func statusOK(status *trillian.TrillianApiStatus) bool {
+	return status != nil && status.StatusCode == trillian.TrillianApiStatusCode_OK
+}
+
+func proofHashes(proof *trillian.Proof) [][]byte {
+	if proof == nil {
+		return nil
+	}
+	hashes := make([][]byte, 0, len(proof.ProofNode))
+	for _, node := range proof.ProofNode {
+		hashes = append(hashes, node.NodeHash)
+	}
+	return hashes
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/mockclient"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/net/context"
+)
+
+const logID = int64(6962)
+
+var okStatus = &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK}
+
+func toProof(leafIndex int64, path []merkle.TreeEntryDescriptor) *trillian.Proof {
+	proof := &trillian.Proof{LeafIndex: leafIndex}
+	for _, p := range path {
+		proof.ProofNode = append(proof.ProofNode, &trillian.Node{NodeHash: p.Value.Hash()})
+	}
+	return proof
+}
+
+func expectRoot(c *mockclient.MockTrillianLogClient, root trillian.SignedLogRoot) {
+	c.EXPECT().GetLatestSignedLogRoot(gomock.Any(), &trillian.GetLatestSignedLogRootRequest{LogId: logID}).Return(
+		&trillian.GetLatestSignedLogRootResponse{Status: okStatus, SignedLogRoot: &root}, nil)
+}
+
+func TestUpdateRoot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	_, mt := newTestTree(t, 20)
+	mc := mockclient.NewMockTrillianLogClient(ctrl)
+	client := NewLogClient(logID, mc, DefaultWindowSize)
+
+	expectRoot(mc, rootAt(mt, 8))
+	if _, err := client.UpdateRoot(context.Background()); err != nil {
+		t.Fatalf("UpdateRoot()=%v, want nil", err)
+	}
+
+	expectRoot(mc, rootAt(mt, 13))
+	mc.EXPECT().GetConsistencyProof(gomock.Any(), &trillian.GetConsistencyProofRequest{LogId: logID, FirstTreeSize: 8, SecondTreeSize: 13}).Return(
+		&trillian.GetConsistencyProofResponse{Status: okStatus, Proof: toProof(0, mt.SnapshotConsistency(8, 13))}, nil)
+	root, err := client.UpdateRoot(context.Background())
+	if err != nil {
+		t.Fatalf("UpdateRoot()=%v, want nil", err)
+	}
+	if got, want := root.TreeSize, int64(13); got != want {
+		t.Errorf("UpdateRoot().TreeSize=%d, want %d", got, want)
+	}
+
+	// A root that isn't consistent with the verified one must be rejected.
+	expectRoot(mc, rootAt(mt, 20))
+	mc.EXPECT().GetConsistencyProof(gomock.Any(), &trillian.GetConsistencyProofRequest{LogId: logID, FirstTreeSize: 13, SecondTreeSize: 20}).Return(
+		&trillian.GetConsistencyProofResponse{Status: okStatus, Proof: toProof(0, mt.SnapshotConsistency(12, 20))}, nil)
+	if _, err := client.UpdateRoot(context.Background()); err == nil {
+		t.Errorf("UpdateRoot(bad proof)=nil, want error")
+	}
+	if got, want := client.Window().Latest().TreeSize, int64(13); got != want {
+		t.Errorf("Latest().TreeSize=%d, want %d", got, want)
+	}
+}
+
+func TestUpdateRootErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mc := mockclient.NewMockTrillianLogClient(ctrl)
+	client := NewLogClient(logID, mc, DefaultWindowSize)
+
+	mc.EXPECT().GetLatestSignedLogRoot(gomock.Any(), gomock.Any()).Return(nil, errors.New("RPC failed"))
+	if _, err := client.UpdateRoot(context.Background()); err == nil {
+		t.Errorf("UpdateRoot(RPC error)=nil, want error")
+	}
+
+	mc.EXPECT().GetLatestSignedLogRoot(gomock.Any(), gomock.Any()).Return(
+		&trillian.GetLatestSignedLogRootResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_ERROR}}, nil)
+	if _, err := client.UpdateRoot(context.Background()); err == nil {
+		t.Errorf("UpdateRoot(error status)=nil, want error")
+	}
+}
+
+func TestUpdateRootShrinks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	_, mt := newTestTree(t, 20)
+	mc := mockclient.NewMockTrillianLogClient(ctrl)
+	client := NewLogClient(logID, mc, DefaultWindowSize)
+
+	expectRoot(mc, rootAt(mt, 13))
+	if _, err := client.UpdateRoot(context.Background()); err != nil {
+		t.Fatalf("UpdateRoot()=%v, want nil", err)
+	}
+
+	// The smaller root is rejected without asking for a proof.
+	expectRoot(mc, rootAt(mt, 8))
+	if _, err := client.UpdateRoot(context.Background()); err == nil {
+		t.Errorf("UpdateRoot(smaller tree)=nil, want error")
+	}
+	if got, want := client.Window().Latest().TreeSize, int64(13); got != want {
+		t.Errorf("Latest().TreeSize=%d, want %d", got, want)
+	}
+}
+
+func TestUpdateRootSignature(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	_, mt := newTestTree(t, 20)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey()=_,_,%v", err)
+	}
+	signer := crypto.NewSigner(crypto.NewSHA256(), trillian.SignatureAlgorithm_ED25519, priv)
+	signedRootAt := func(size int) trillian.SignedLogRoot {
+		root := rootAt(mt, size)
+		sig, err := signer.SignLogRoot(root)
+		if err != nil {
+			t.Fatalf("SignLogRoot()=_,%v", err)
+		}
+		root.Signature = &sig
+		return root
+	}
+	mc := mockclient.NewMockTrillianLogClient(ctrl)
+	client := NewLogClient(logID, mc, DefaultWindowSize, WithPublicKey(pub))
+
+	expectRoot(mc, rootAt(mt, 8))
+	if _, err := client.UpdateRoot(context.Background()); err == nil {
+		t.Errorf("UpdateRoot(unsigned)=nil, want error")
+	}
+	if latest := client.Window().Latest(); latest != nil {
+		t.Errorf("Latest()=%v, want nil", latest)
+	}
+
+	root := signedRootAt(8)
+	root.TimestampNanos++
+	expectRoot(mc, root)
+	if _, err := client.UpdateRoot(context.Background()); err == nil {
+		t.Errorf("UpdateRoot(bad signature)=nil, want error")
+	}
+
+	expectRoot(mc, signedRootAt(8))
+	if _, err := client.UpdateRoot(context.Background()); err != nil {
+		t.Fatalf("UpdateRoot(signed)=%v, want nil", err)
+	}
+	if got, want := client.Window().Latest().TreeSize, int64(8); got != want {
+		t.Errorf("Latest().TreeSize=%d, want %d", got, want)
+	}
+}
+
+func TestVerifyInclusionAcrossWindow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	_, mt := newTestTree(t, 20)
+	mc := mockclient.NewMockTrillianLogClient(ctrl)
+	client := NewLogClient(logID, mc, DefaultWindowSize)
+
+	if err := client.VerifyInclusion(context.Background(), []byte("leaf 3")); err == nil {
+		t.Errorf("VerifyInclusion(no roots)=nil, want error")
+	}
+
+	expectRoot(mc, rootAt(mt, 10))
+	if _, err := client.UpdateRoot(context.Background()); err != nil {
+		t.Fatalf("UpdateRoot()=%v, want nil", err)
+	}
+	expectRoot(mc, rootAt(mt, 20))
+	mc.EXPECT().GetConsistencyProof(gomock.Any(), gomock.Any()).Return(
+		&trillian.GetConsistencyProofResponse{Status: okStatus, Proof: toProof(0, mt.SnapshotConsistency(10, 20))}, nil)
+	if _, err := client.UpdateRoot(context.Background()); err != nil {
+		t.Fatalf("UpdateRoot()=%v, want nil", err)
+	}
+
+	// The proof against the newest root is bad but the one against the older root
+	// in the window is fine, so the leaf should still verify.
+	leafHash := client.hasher.HashLeaf([]byte("leaf 3"))
+	mc.EXPECT().GetInclusionProofByHash(gomock.Any(), &trillian.GetInclusionProofByHashRequest{LogId: logID, LeafHash: leafHash, TreeSize: 20, OrderBySequence: true}).Return(
+		&trillian.GetInclusionProofByHashResponse{Status: okStatus, Proof: []*trillian.Proof{toProof(3, mt.PathToRootAtSnapshot(4, 10))}}, nil)
+	mc.EXPECT().GetInclusionProofByHash(gomock.Any(), &trillian.GetInclusionProofByHashRequest{LogId: logID, LeafHash: leafHash, TreeSize: 10, OrderBySequence: true}).Return(
+		&trillian.GetInclusionProofByHashResponse{Status: okStatus, Proof: []*trillian.Proof{toProof(3, mt.PathToRootAtSnapshot(4, 10))}}, nil)
+	if err := client.VerifyInclusion(context.Background(), []byte("leaf 3")); err != nil {
+		t.Errorf("VerifyInclusion()=%v, want nil", err)
+	}
+
+	mc.EXPECT().GetInclusionProofByHash(gomock.Any(), gomock.Any()).Times(2).Return(
+		&trillian.GetInclusionProofByHashResponse{Status: okStatus}, nil)
+	if err := client.VerifyInclusion(context.Background(), []byte("not there")); err == nil {
+		t.Errorf("VerifyInclusion(missing)=nil, want error")
+	}
+}
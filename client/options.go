@@ -0,0 +1,195 @@
+package client
+
+import (
+	gocrypto "crypto"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultMaxBatch is the most leaves sent in a single QueueLeaves request by default.
+	DefaultMaxBatch = 1000
+	// QuotaTokenMetadataKey is the gRPC metadata key a client's quota token is sent under.
+	QuotaTokenMetadataKey = "x-quota-token"
+)
+
+// DefaultRetryPolicy is the RetryPolicy a LogClient uses unless told otherwise.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+}
+
+// RetryPolicy says how RPCs that fail with a transient error are retried. A LogClient
+// only retries errors with the Unavailable or ResourceExhausted codes, and never once the
+// call's context is done.
+type RetryPolicy struct {
+	// MaxAttempts is the most times an RPC is tried, including the first. Values below
+	// 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is how long to wait before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between retries.
+	MaxBackoff time.Duration
+	// Multiplier is applied to the wait after each retry. Values below 1 are treated as 1.
+	Multiplier float64
+}
+
+// Backoff returns how long to wait before the given retry, counting from 1.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry && p.Multiplier > 1 && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d = time.Duration(float64(d) * p.Multiplier)
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return d
+}
+
+// options holds the behaviour of a LogClient that can be changed with Options.
+type options struct {
+	retry      RetryPolicy
+	hedgeDelay time.Duration
+	maxBatch   int
+	quotaToken string
+	pubKey     gocrypto.PublicKey
+}
+
+func defaultOptions() options {
+	return options{
+		retry:    DefaultRetryPolicy,
+		maxBatch: DefaultMaxBatch,
+	}
+}
+
+// Option changes the behaviour of a LogClient. Options are passed to NewLogClient, or to
+// LogClient.WithOptions to tune a client for a particular call site.
+type Option func(*options)
+
+// WithRetry sets the policy for retrying RPCs that fail with transient errors. Note that
+// retrying QueueLeaves can queue a leaf twice if the failed attempt reached the server.
+func WithRetry(p RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = p
+	}
+}
+
+// WithHedging makes the client send a second copy of a read RPC if the first hasn't
+// completed after delay, and use whichever response arrives first. This trades extra
+// load on the log server for lower tail latency. Zero, the default, disables hedging.
+func WithHedging(delay time.Duration) Option {
+	return func(o *options) {
+		o.hedgeDelay = delay
+	}
+}
+
+// WithMaxBatch sets the most leaves sent in a single QueueLeaves request; larger sets
+// of leaves are split into several requests. Values below 1 mean DefaultMaxBatch.
+func WithMaxBatch(n int) Option {
+	return func(o *options) {
+		if n < 1 {
+			n = DefaultMaxBatch
+		}
+		o.maxBatch = n
+	}
+}
+
+// WithQuotaToken makes the client send token with every RPC, under the
+// QuotaTokenMetadataKey metadata key, so servers or proxies that enforce quotas can
+// charge requests to it. An empty token sends nothing.
+func WithQuotaToken(token string) Option {
+	return func(o *options) {
+		o.quotaToken = token
+	}
+}
+
+// WithPublicKey makes the client check that each root it fetches is signed by the log's
+// key pub, which must be an ECDSA, RSA or Ed25519 public key, before it trusts it. Without
+// a key roots are only checked for consistency with those verified before.
+func WithPublicKey(pub gocrypto.PublicKey) Option {
+	return func(o *options) {
+		o.pubKey = pub
+	}
+}
+
+// retryable returns true if err is one of the transient errors RetryPolicy applies to.
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// rpcFunc makes a single RPC.
+type rpcFunc func(ctx context.Context) (interface{}, error)
+
+// call makes an RPC, retrying it according to the client's RetryPolicy. If hedge is set
+// and hedging is enabled each attempt may be sent twice, so only RPCs that are safe to
+// repeat should be hedged.
+func (c *LogClient) call(ctx context.Context, hedge bool, rpc rpcFunc) (interface{}, error) {
+	if len(c.opts.quotaToken) > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, QuotaTokenMetadataKey, c.opts.quotaToken)
+	}
+	for attempt := 1; ; attempt++ {
+		var rsp interface{}
+		var err error
+		if hedge && c.opts.hedgeDelay > 0 {
+			rsp, err = c.hedged(ctx, rpc)
+		} else {
+			rsp, err = rpc(ctx)
+		}
+		if err == nil || attempt >= c.opts.retry.MaxAttempts || !retryable(err) {
+			return rsp, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.opts.retry.Backoff(attempt)):
+		}
+	}
+}
+
+// hedged makes an RPC, sending it again if it hasn't completed after the hedging delay.
+// The first successful response is returned, or the first error if both fail.
+func (c *LogClient) hedged(ctx context.Context, rpc rpcFunc) (interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		rsp interface{}
+		err error
+	}
+	// Buffered so whichever RPC finishes last doesn't block.
+	results := make(chan result, 2)
+	send := func() {
+		rsp, err := rpc(ctx)
+		results <- result{rsp, err}
+	}
+
+	go send()
+	timer := time.NewTimer(c.opts.hedgeDelay)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		return r.rsp, r.err
+	case <-timer.C:
+		go send()
+	}
+
+	first := <-results
+	if first.err == nil {
+		return first.rsp, nil
+	}
+	if second := <-results; second.err == nil {
+		return second.rsp, nil
+	}
+	return first.rsp, first.err
+}
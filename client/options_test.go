@@ -0,0 +1,213 @@
+package client
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/mockclient"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, Multiplier: 2}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	var tests = []struct {
+		p     RetryPolicy
+		retry int
+		want  time.Duration
+	}{
+		{p: DefaultRetryPolicy, retry: 1, want: 100 * time.Millisecond},
+		{p: DefaultRetryPolicy, retry: 2, want: 200 * time.Millisecond},
+		{p: DefaultRetryPolicy, retry: 4, want: 800 * time.Millisecond},
+		{p: DefaultRetryPolicy, retry: 10, want: 5 * time.Second},
+		{p: RetryPolicy{InitialBackoff: time.Second}, retry: 5, want: time.Second},
+		{p: RetryPolicy{InitialBackoff: time.Second, Multiplier: 0.5}, retry: 5, want: time.Second},
+		{p: RetryPolicy{InitialBackoff: time.Second, Multiplier: 3}, retry: 3, want: 9 * time.Second},
+	}
+
+	for _, test := range tests {
+		if got := test.p.Backoff(test.retry); got != test.want {
+			t.Errorf("%+v.Backoff(%d)=%v, want %v", test.p, test.retry, got, test.want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	_, mt := newTestTree(t, 10)
+	unavailable := status.Error(codes.Unavailable, "try again")
+	rootRsp := &trillian.GetLatestSignedLogRootResponse{Status: okStatus, SignedLogRoot: &trillian.SignedLogRoot{}}
+	*rootRsp.SignedLogRoot = rootAt(mt, 10)
+
+	var tests = []struct {
+		descr     string
+		policy    RetryPolicy
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{descr: "no-errors", policy: fastRetry, wantCalls: 1},
+		{descr: "transient", policy: fastRetry, errs: []error{unavailable, status.Error(codes.ResourceExhausted, "slow down")}, wantCalls: 3},
+		{descr: "too-many", policy: fastRetry, errs: []error{unavailable, unavailable, unavailable}, wantCalls: 3, wantErr: true},
+		{descr: "not-transient", policy: fastRetry, errs: []error{status.Error(codes.InvalidArgument, "bad")}, wantCalls: 1, wantErr: true},
+		{descr: "no-retries", policy: RetryPolicy{}, errs: []error{unavailable}, wantCalls: 1, wantErr: true},
+	}
+
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+		mc := mockclient.NewMockTrillianLogClient(ctrl)
+		client := NewLogClient(logID, mc, DefaultWindowSize, WithRetry(test.policy))
+
+		var calls []*gomock.Call
+		for i := 0; i < test.wantCalls; i++ {
+			if i < len(test.errs) {
+				calls = append(calls, mc.EXPECT().GetLatestSignedLogRoot(gomock.Any(), gomock.Any()).Return(nil, test.errs[i]))
+			} else {
+				calls = append(calls, mc.EXPECT().GetLatestSignedLogRoot(gomock.Any(), gomock.Any()).Return(rootRsp, nil))
+			}
+		}
+		gomock.InOrder(calls...)
+
+		_, err := client.UpdateRoot(context.Background())
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: UpdateRoot()=%v, want error: %v", test.descr, err, test.wantErr)
+		}
+		ctrl.Finish()
+	}
+}
+
+// slowRootClient answers GetLatestSignedLogRoot, stalling the first request until it's
+// cancelled. It records the quota tokens sent with each request.
+type slowRootClient struct {
+	trillian.TrillianLogClient
+	root trillian.SignedLogRoot
+
+	mu     sync.Mutex
+	calls  int
+	tokens []string
+}
+
+func (c *slowRootClient) GetLatestSignedLogRoot(ctx context.Context, req *trillian.GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*trillian.GetLatestSignedLogRootResponse, error) {
+	c.mu.Lock()
+	c.calls++
+	first := c.calls == 1
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		c.tokens = append(c.tokens, md[QuotaTokenMetadataKey]...)
+	}
+	c.mu.Unlock()
+
+	if first {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	root := c.root
+	return &trillian.GetLatestSignedLogRootResponse{Status: okStatus, SignedLogRoot: &root}, nil
+}
+
+func TestHedging(t *testing.T) {
+	_, mt := newTestTree(t, 10)
+	sc := &slowRootClient{root: rootAt(mt, 10)}
+	client := NewLogClient(logID, sc, DefaultWindowSize, WithHedging(5*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	root, err := client.UpdateRoot(ctx)
+	if err != nil {
+		t.Fatalf("UpdateRoot()=%v, want nil", err)
+	}
+	if got, want := root.TreeSize, int64(10); got != want {
+		t.Errorf("UpdateRoot().TreeSize=%d, want %d", got, want)
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if got, want := sc.calls, 2; got != want {
+		t.Errorf("GetLatestSignedLogRoot calls=%d, want %d", got, want)
+	}
+}
+
+func TestQuotaToken(t *testing.T) {
+	_, mt := newTestTree(t, 10)
+	sc := &slowRootClient{root: rootAt(mt, 10)}
+	client := NewLogClient(logID, sc, DefaultWindowSize, WithHedging(time.Millisecond), WithQuotaToken("token"))
+
+	if _, err := client.UpdateRoot(context.Background()); err != nil {
+		t.Fatalf("UpdateRoot()=%v, want nil", err)
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if got, want := strings.Join(sc.tokens, ","), "token,token"; got != want {
+		t.Errorf("quota tokens sent=%q, want %q", got, want)
+	}
+}
+
+func TestQueueLeavesBatches(t *testing.T) {
+	data := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")}
+	batch := func(leaves ...string) *trillian.QueueLeavesRequest {
+		req := &trillian.QueueLeavesRequest{LogId: logID}
+		for _, l := range leaves {
+			req.Leaves = append(req.Leaves, &trillian.LogLeaf{LeafValue: []byte(l)})
+		}
+		return req
+	}
+	okRsp := &trillian.QueueLeavesResponse{Status: okStatus}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mc := mockclient.NewMockTrillianLogClient(ctrl)
+	client := NewLogClient(logID, mc, DefaultWindowSize, WithMaxBatch(2), WithRetry(fastRetry))
+
+	gomock.InOrder(
+		mc.EXPECT().QueueLeaves(gomock.Any(), batch("a", "b")).Return(okRsp, nil),
+		mc.EXPECT().QueueLeaves(gomock.Any(), batch("c", "d")).Return(okRsp, nil),
+		mc.EXPECT().QueueLeaves(gomock.Any(), batch("e")).Return(okRsp, nil),
+	)
+	if err := client.QueueLeaves(context.Background(), data); err != nil {
+		t.Errorf("QueueLeaves()=%v, want nil", err)
+	}
+
+	// A batch that fails after retrying stops the rest being sent.
+	gomock.InOrder(
+		mc.EXPECT().QueueLeaves(gomock.Any(), batch("a", "b")).Return(okRsp, nil),
+		mc.EXPECT().QueueLeaves(gomock.Any(), batch("c", "d")).Times(3).Return(nil, status.Error(codes.Unavailable, "down")),
+	)
+	err := client.QueueLeaves(context.Background(), data)
+	if err == nil || !strings.Contains(err.Error(), "queued 2 of 5") {
+		t.Errorf("QueueLeaves(failing)=%v, want error saying 2 leaves were queued", err)
+	}
+
+	mc.EXPECT().QueueLeaves(gomock.Any(), batch("a", "b")).Return(
+		&trillian.QueueLeavesResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_ERROR}}, nil)
+	if err := client.QueueLeaves(context.Background(), data); err == nil {
+		t.Errorf("QueueLeaves(error status)=nil, want error")
+	}
+}
+
+func TestWithOptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := NewLogClient(logID, mockclient.NewMockTrillianLogClient(ctrl), DefaultWindowSize, WithMaxBatch(10))
+
+	tuned := client.WithOptions(WithMaxBatch(0), WithHedging(time.Second))
+	if got, want := tuned.opts.maxBatch, DefaultMaxBatch; got != want {
+		t.Errorf("WithOptions().maxBatch=%d, want %d", got, want)
+	}
+	if got, want := tuned.opts.hedgeDelay, time.Second; got != want {
+		t.Errorf("WithOptions().hedgeDelay=%v, want %v", got, want)
+	}
+	if got, want := client.opts.maxBatch, 10; got != want {
+		t.Errorf("original maxBatch=%d, want %d", got, want)
+	}
+	if got, want := client.opts.hedgeDelay, time.Duration(0); got != want {
+		t.Errorf("original hedgeDelay=%v, want %v", got, want)
+	}
+	if tuned.Window() != client.Window() {
+		t.Error("WithOptions() client doesn't share the window of verified roots")
+	}
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/verifier"
+)
+
+// ErrRootNotInWindow is returned when a proof refers to a tree size that does not
+// match any of the roots currently held in a RootWindow.
+var ErrRootNotInWindow = errors.New("client: no verified root in window for tree size")
+
+// RootWindow holds a bounded, sliding window of recently verified log roots in
+// ascending tree size order. Each root added to the window must be shown to be
+// consistent with the newest root already in it, so every root in the window is
+// consistent with every other. Proofs generated against any of them can then be
+// verified, which smooths over races where the log publishes a new root between a
+// client fetching the latest root and fetching a proof.
+type RootWindow struct {
+	verifier *verifier.LogVerifier
+	maxRoots int
+
+	mu    sync.RWMutex
+	roots []trillian.SignedLogRoot
+}
+
+// NewRootWindow creates an empty RootWindow that holds at most maxRoots roots.
+func NewRootWindow(v *verifier.LogVerifier, maxRoots int) *RootWindow {
+	if maxRoots < 1 {
+		maxRoots = 1
+	}
+	return &RootWindow{verifier: v, maxRoots: maxRoots}
+}
+
+// Latest returns the newest root in the window, or nil if the window is empty.
+func (w *RootWindow) Latest() *trillian.SignedLogRoot {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if len(w.roots) == 0 {
+		return nil
+	}
+	root := w.roots[len(w.roots)-1]
+	return &root
+}
+
+// Roots returns a copy of the roots in the window, oldest first.
+func (w *RootWindow) Roots() []trillian.SignedLogRoot {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return append([]trillian.SignedLogRoot(nil), w.roots...)
+}
+
+// RootAtSize returns the root in the window for the given tree size, or
+// ErrRootNotInWindow if there isn't one.
+func (w *RootWindow) RootAtSize(treeSize int64) (trillian.SignedLogRoot, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	for _, root := range w.roots {
+		if root.TreeSize == treeSize {
+			return root, nil
+		}
+	}
+	return trillian.SignedLogRoot{}, ErrRootNotInWindow
+}
+
+// Add verifies root against the newest root in the window using the supplied
+// consistency proof and, if it checks out, appends it, evicting the oldest root
+// if the window is full. The first root added to an empty window is trusted as is.
+// Adding a root with the same size and hash as the newest root is a no-op.
+func (w *RootWindow) Add(root trillian.SignedLogRoot, proof [][]byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.roots) > 0 {
+		latest := w.roots[len(w.roots)-1]
+		if root.TreeSize < latest.TreeSize {
+			return fmt.Errorf("client: root for tree size %d is older than latest verified size %d", root.TreeSize, latest.TreeSize)
+		}
+		if root.TreeSize == latest.TreeSize {
+			if !bytes.Equal(root.RootHash, latest.RootHash) {
+				return fmt.Errorf("client: root hash for tree size %d differs from verified root: %x != %x", root.TreeSize, root.RootHash, latest.RootHash)
+			}
+			return nil
+		}
+		if err := w.verifier.VerifyConsistency(latest.TreeSize, root.TreeSize, latest.RootHash, root.RootHash, proof); err != nil {
+			return fmt.Errorf("client: root for tree size %d is not consistent with size %d: %v", root.TreeSize, latest.TreeSize, err)
+		}
+	}
+
+	w.roots = append(w.roots, root)
+	if len(w.roots) > w.maxRoots {
+		w.roots = append([]trillian.SignedLogRoot(nil), w.roots[len(w.roots)-w.maxRoots:]...)
+	}
+	return nil
+}
+
+// VerifyInclusion checks an inclusion proof for the leaf with the given Merkle leaf
+// hash against the root in the window that has size treeSize. Returns
+// ErrRootNotInWindow if there is no such root.
+func (w *RootWindow) VerifyInclusion(leafHash []byte, leafIndex, treeSize int64, proof [][]byte) error {
+	root, err := w.RootAtSize(treeSize)
+	if err != nil {
+		return err
+	}
+	return w.verifier.VerifyInclusion(leafHash, leafIndex, treeSize, proof, root.RootHash)
+}
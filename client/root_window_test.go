@@ -0,0 +1,131 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/verifier"
+)
+
+func newTestTree(t *testing.T, leaves int) (merkle.TreeHasher, *merkle.InMemoryMerkleTree) {
+	hasher := merkle.NewRFC6962TreeHasher(crypto.NewSHA256())
+	mt := merkle.NewInMemoryMerkleTree(hasher)
+	for i := 0; i < leaves; i++ {
+		mt.AddLeaf([]byte(fmt.Sprintf("leaf %d", i)))
+	}
+	return hasher, mt
+}
+
+func rootAt(mt *merkle.InMemoryMerkleTree, size int) trillian.SignedLogRoot {
+	return trillian.SignedLogRoot{TreeSize: int64(size), RootHash: mt.RootAtSnapshot(size).Hash()}
+}
+
+func toHashes(path []merkle.TreeEntryDescriptor) [][]byte {
+	hashes := make([][]byte, 0, len(path))
+	for _, p := range path {
+		hashes = append(hashes, p.Value.Hash())
+	}
+	return hashes
+}
+
+func TestRootWindowAdd(t *testing.T) {
+	_, mt := newTestTree(t, 20)
+	w := NewRootWindow(verifier.NewLogVerifier(), 3)
+
+	if got := w.Latest(); got != nil {
+		t.Fatalf("Latest()=%v, want nil", got)
+	}
+	if err := w.Add(rootAt(mt, 4), nil); err != nil {
+		t.Fatalf("Add(4)=%v, want nil", err)
+	}
+	for _, size := range []int{7, 11, 15} {
+		prev := w.Latest().TreeSize
+		proof := toHashes(mt.SnapshotConsistency(int(prev), size))
+		if err := w.Add(rootAt(mt, size), proof); err != nil {
+			t.Fatalf("Add(%d)=%v, want nil", size, err)
+		}
+	}
+
+	var sizes []int64
+	for _, root := range w.Roots() {
+		sizes = append(sizes, root.TreeSize)
+	}
+	if got, want := fmt.Sprint(sizes), "[7 11 15]"; got != want {
+		t.Errorf("Roots() sizes=%v, want %v", got, want)
+	}
+	if _, err := w.RootAtSize(4); err != ErrRootNotInWindow {
+		t.Errorf("RootAtSize(4)=%v, want %v", err, ErrRootNotInWindow)
+	}
+
+	// Re-adding the latest root is a no-op.
+	if err := w.Add(rootAt(mt, 15), nil); err != nil {
+		t.Errorf("Add(15) again=%v, want nil", err)
+	}
+	if got, want := len(w.Roots()), 3; got != want {
+		t.Errorf("len(Roots())=%d, want %d", got, want)
+	}
+}
+
+func TestRootWindowAddRejects(t *testing.T) {
+	hasher, mt := newTestTree(t, 20)
+	w := NewRootWindow(verifier.NewLogVerifier(), 3)
+	if err := w.Add(rootAt(mt, 10), nil); err != nil {
+		t.Fatalf("Add(10)=%v, want nil", err)
+	}
+
+	forked := rootAt(mt, 10)
+	forked.RootHash = hasher.HashLeaf([]byte("fork"))
+	badRoot := rootAt(mt, 16)
+	badRoot.RootHash = hasher.HashLeaf([]byte("fork"))
+
+	var tests = []struct {
+		desc  string
+		root  trillian.SignedLogRoot
+		proof [][]byte
+	}{
+		{"older", rootAt(mt, 8), nil},
+		{"same size, different hash", forked, nil},
+		{"no proof", rootAt(mt, 16), nil},
+		{"wrong proof", rootAt(mt, 16), toHashes(mt.SnapshotConsistency(9, 16))},
+		{"wrong root", badRoot, toHashes(mt.SnapshotConsistency(10, 16))},
+	}
+	for _, test := range tests {
+		if err := w.Add(test.root, test.proof); err == nil {
+			t.Errorf("Add(%s)=nil, want error", test.desc)
+		}
+	}
+	if got, want := w.Latest().TreeSize, int64(10); got != want {
+		t.Errorf("Latest().TreeSize=%d, want %d", got, want)
+	}
+}
+
+func TestRootWindowVerifyInclusion(t *testing.T) {
+	hasher, mt := newTestTree(t, 20)
+	w := NewRootWindow(verifier.NewLogVerifier(), 3)
+	if err := w.Add(rootAt(mt, 12), nil); err != nil {
+		t.Fatalf("Add(12)=%v, want nil", err)
+	}
+	if err := w.Add(rootAt(mt, 20), toHashes(mt.SnapshotConsistency(12, 20))); err != nil {
+		t.Fatalf("Add(20)=%v, want nil", err)
+	}
+
+	leafHash := hasher.HashLeaf([]byte("leaf 5"))
+	for _, size := range []int{12, 20} {
+		// The in memory tree numbers leaves from 1.
+		proof := toHashes(mt.PathToRootAtSnapshot(6, size))
+		if err := w.VerifyInclusion(leafHash, 5, int64(size), proof); err != nil {
+			t.Errorf("VerifyInclusion(5, %d)=%v, want nil", size, err)
+		}
+		if err := w.VerifyInclusion(leafHash, 4, int64(size), proof); err == nil {
+			t.Errorf("VerifyInclusion(4, %d)=nil, want error", size)
+		}
+	}
+
+	proof := toHashes(mt.PathToRootAtSnapshot(6, 16))
+	if err := w.VerifyInclusion(leafHash, 5, 16, proof); err != ErrRootNotInWindow {
+		t.Errorf("VerifyInclusion(5, 16)=%v, want %v", err, ErrRootNotInWindow)
+	}
+}
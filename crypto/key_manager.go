@@ -12,9 +12,11 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/google/trillian"
+	"golang.org/x/crypto/ed25519"
 )
 
-// KeyManager loads and holds our private and public keys. Should support ECDSA and RSA keys.
+// KeyManager loads and holds our private and public keys. Should support ECDSA, RSA and
+// Ed25519 keys.
 // The crypto.Signer API allows for obtaining a public key from a private key but there are
 // cases where we have the public key only, such as mirroring another log, so we treat them
 // separately. KeyManager is an interface as we expect multiple implementations supporting
@@ -51,7 +53,25 @@ func NewPEMKeyManager() *PEMKeyManager {
 
 // NewPEMKeyManager creates a PEMKeyManager using a private key that has already been loaded
 func (k PEMKeyManager) NewPEMKeyManager(key crypto.PrivateKey) *PEMKeyManager {
-	return &PEMKeyManager{serverPrivateKey: key}
+	km := &PEMKeyManager{serverPrivateKey: key}
+	if signer, ok := key.(crypto.Signer); ok {
+		km.signatureAlgorithm, _ = SignatureAlgorithmForKey(signer.Public())
+	}
+	return km
+}
+
+// SignatureAlgorithmForKey returns the signature algorithm used with a public key: ECDSA
+// for ECDSA keys, RSA, i.e. PKCS#1 v1.5 signatures, for RSA keys, or ED25519.
+func SignatureAlgorithmForKey(key crypto.PublicKey) (trillian.SignatureAlgorithm, error) {
+	switch key.(type) {
+	case *ecdsa.PublicKey:
+		return trillian.SignatureAlgorithm_ECDSA, nil
+	case *rsa.PublicKey:
+		return trillian.SignatureAlgorithm_RSA, nil
+	case ed25519.PublicKey:
+		return trillian.SignatureAlgorithm_ED25519, nil
+	}
+	return trillian.SignatureAlgorithm_ANONYMOUS, fmt.Errorf("unsupported key type: %T", key)
 }
 
 // SignatureAlgorithm identifies the signature algorithm used by this key manager.
@@ -112,7 +132,7 @@ func (k PEMKeyManager) Signer() (crypto.Signer, error) {
 	// Good old interface{}, this wouldn't be necessary in a proper type system. If it's
 	// even the right thing to do but I couldn't find any useful docs so meh
 	switch k.serverPrivateKey.(type) {
-	case *ecdsa.PrivateKey, *rsa.PrivateKey:
+	case *ecdsa.PrivateKey, *rsa.PrivateKey, ed25519.PrivateKey:
 		return k.serverPrivateKey.(crypto.Signer), nil
 	}
 
@@ -152,6 +172,8 @@ func parsePrivateKey(key []byte) (crypto.PrivateKey, trillian.SignatureAlgorithm
 			return key, trillian.SignatureAlgorithm_ECDSA, nil
 		case *rsa.PrivateKey:
 			return key, trillian.SignatureAlgorithm_RSA, nil
+		case ed25519.PrivateKey:
+			return key, trillian.SignatureAlgorithm_ED25519, nil
 		default:
 			return nil, trillian.SignatureAlgorithm_ANONYMOUS, fmt.Errorf("unknown private key type: %T", key)
 		}
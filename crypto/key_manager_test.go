@@ -2,6 +2,9 @@ package crypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/pem"
@@ -10,7 +13,9 @@ import (
 	"math/rand"
 	"testing"
 
+	"github.com/google/trillian"
 	"github.com/google/trillian/testonly"
+	"golang.org/x/crypto/ed25519"
 )
 
 type ecdsaSig struct {
@@ -91,3 +96,46 @@ func TestLoadDemoECDSAPublicKey(t *testing.T) {
 		t.Fatalf("Expected to have loaded an ECDSA key but got: %v", key)
 	}
 }
+
+func TestSignatureAlgorithmForKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate ECDSA key: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(cryptorand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	edKey, _, err := ed25519.GenerateKey(cryptorand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+
+	var tests = []struct {
+		descr   string
+		key     interface{}
+		want    trillian.SignatureAlgorithm
+		wantErr bool
+	}{
+		{descr: "ecdsa", key: ecKey.Public(), want: trillian.SignatureAlgorithm_ECDSA},
+		{descr: "rsa", key: rsaKey.Public(), want: trillian.SignatureAlgorithm_RSA},
+		{descr: "ed25519", key: edKey, want: trillian.SignatureAlgorithm_ED25519},
+		{descr: "private", key: rsaKey, wantErr: true},
+		{descr: "nil", key: nil, wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := SignatureAlgorithmForKey(test.key)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: SignatureAlgorithmForKey()=_,%v, want error: %v", test.descr, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: SignatureAlgorithmForKey()=%v, want %v", test.descr, got, test.want)
+		}
+	}
+
+	if got, want := new(PEMKeyManager).NewPEMKeyManager(rsaKey).SignatureAlgorithm(), trillian.SignatureAlgorithm_RSA; got != want {
+		t.Errorf("NewPEMKeyManager(rsa).SignatureAlgorithm()=%v, want %v", got, want)
+	}
+}
@@ -13,7 +13,7 @@ import (
 )
 
 // Constants used as map keys when building input for ObjectHash. They must not be changed
-// as this will change the output of hashRoot()
+// as this will change the output of HashLogRoot()
 const (
 	mapKeyRootHash       string = "RootHash"
 	mapKeyTimestampNanos string = "TimestampNanos"
@@ -29,14 +29,26 @@ type Signer struct {
 }
 
 // NewSigner creates a new Signer wrapping up a hasher and a signer. For the moment
-// we only support SHA256 hashing and either ECDSA or RSA signing but this is not enforced
-// here.
+// we only support SHA256 hashing and either ECDSA or RSA signing, or Ed25519 signing
+// without the hasher, but this is not enforced here.
 func NewSigner(hasher Hasher, signatureAlgorithm trillian.SignatureAlgorithm, signer crypto.Signer) *Signer {
 	return &Signer{hasher, signer, signatureAlgorithm}
 }
 
-// Sign obtains a signature after first hashing the input data.
+// Sign obtains a signature after first hashing the input data, unless the signature
+// algorithm is Ed25519, which signs the data itself.
 func (s Signer) Sign(data []byte) (trillian.DigitallySigned, error) {
+	if s.sigAlgorithm == trillian.SignatureAlgorithm_ED25519 {
+		sig, err := s.signer.Sign(rand.Reader, data, crypto.Hash(0))
+		if err != nil {
+			return trillian.DigitallySigned{}, err
+		}
+		return trillian.DigitallySigned{
+			SignatureAlgorithm: s.sigAlgorithm,
+			HashAlgorithm:      trillian.HashAlgorithm_INTRINSIC,
+			Signature:          sig}, nil
+	}
+
 	digest := s.hasher.Digest(data)
 
 	if len(digest) != s.hasher.Size() {
@@ -56,7 +68,9 @@ func (s Signer) Sign(data []byte) (trillian.DigitallySigned, error) {
 		Signature:          sig}, nil
 }
 
-func (s Signer) hashRoot(root trillian.SignedLogRoot) []byte {
+// HashLogRoot returns the ObjectHash of the fields of root that are covered by its
+// signature. A signature over a root is made by signing this hash.
+func HashLogRoot(root trillian.SignedLogRoot) []byte {
 	rootMap := make(map[string]interface{})
 
 	// Pull out the fields we want to hash. Caution: use string format for int64 values as they
@@ -74,7 +88,7 @@ func (s Signer) hashRoot(root trillian.SignedLogRoot) []byte {
 // SignLogRoot updates a log root to include a signature from the crypto signer this object
 // was created with. Signatures use objecthash on a fixed JSON format of the root.
 func (s Signer) SignLogRoot(root trillian.SignedLogRoot) (trillian.DigitallySigned, error) {
-	objectHash := s.hashRoot(root)
+	objectHash := HashLogRoot(root)
 	signature, err := s.Sign(objectHash[:])
 
 	if err != nil {
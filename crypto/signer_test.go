@@ -10,6 +10,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/google/trillian"
 	"github.com/google/trillian/testonly"
+	"golang.org/x/crypto/ed25519"
 )
 
 const message string = "testing"
@@ -62,6 +63,38 @@ func TestSigner(t *testing.T) {
 	}
 }
 
+func TestSignerEd25519(t *testing.T) {
+	km := NewPEMKeyManager()
+	if err := km.LoadPrivateKey(testonly.DemoEd25519PrivateKey, testonly.DemoPrivateKeyPass); err != nil {
+		t.Fatalf("Failed to load private key: %v", err)
+	}
+	if err := km.LoadPublicKey(testonly.DemoEd25519PublicKey); err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	signer, err := km.Signer()
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	sig, err := NewSigner(NewSHA256(), km.SignatureAlgorithm(), signer).Sign([]byte(message))
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if got, want := sig.HashAlgorithm, trillian.HashAlgorithm_INTRINSIC; got != want {
+		t.Errorf("Hash alg incorrect, got %v expected %v", got, want)
+	}
+	if got, want := sig.SignatureAlgorithm, trillian.SignatureAlgorithm_ED25519; got != want {
+		t.Errorf("Sig alg incorrect, got %v expected %v", got, want)
+	}
+	pub, err := km.GetPublicKey()
+	if err != nil {
+		t.Fatalf("Failed to get public key: %v", err)
+	}
+	if !ed25519.Verify(pub.(ed25519.PublicKey), []byte(message), sig.Signature) {
+		t.Errorf("Signature did not verify")
+	}
+}
+
 func TestSignerFails(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -0,0 +1,249 @@
+package ct
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// AccessLogRecord is the structured record logged for each CT request.
+type AccessLogRecord struct {
+	Time          time.Time `json:"time"`
+	RequestID     string    `json:"request_id"`
+	TraceID       string    `json:"trace_id"`
+	LogID         int64     `json:"log_id"`
+	LogPrefix     string    `json:"log_prefix"`
+	Endpoint      string    `json:"endpoint"`
+	Method        string    `json:"method"`
+	ClientIP      string    `json:"client_ip"`
+	SigningKeyID  string    `json:"signing_key_id,omitempty"`
+	APIKey        string    `json:"api_key,omitempty"`
+	ClientCert    string    `json:"client_cert,omitempty"`
+	Status        int       `json:"status"`
+	LatencyMicros int64     `json:"latency_us"`
+	BytesWritten  int64     `json:"bytes"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// AccessLogSink receives the access log records for CT requests. Implementations must
+// be safe for concurrent use.
+type AccessLogSink interface {
+	LogRequest(rec *AccessLogRecord)
+}
+
+// glogAccessLog is the default sink, it logs requests with glog: successful ones are only
+// visible at verbosity 2 and above, failed ones as warnings.
+type glogAccessLog struct{}
+
+func (glogAccessLog) LogRequest(rec *AccessLogRecord) {
+	if len(rec.Error) > 0 {
+		glog.Warningf("%s[%s]: %s handler error: status=%d client=%s: %s", rec.LogPrefix, rec.RequestID, rec.Endpoint, rec.Status, rec.ClientIP, rec.Error)
+		return
+	}
+	glog.V(2).Infof("%s[%s]: %s <= status=%d client=%s bytes=%d latency=%dus", rec.LogPrefix, rec.RequestID, rec.Endpoint, rec.Status, rec.ClientIP, rec.BytesWritten, rec.LatencyMicros)
+}
+
+// JSONAccessLog is an AccessLogSink that writes each record to an io.Writer as a line
+// of JSON.
+type JSONAccessLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONAccessLog creates a JSONAccessLog that writes records to w, e.g. os.Stderr or
+// a RotatingFile.
+func NewJSONAccessLog(w io.Writer) *JSONAccessLog {
+	return &JSONAccessLog{enc: json.NewEncoder(w)}
+}
+
+// LogRequest writes a single record.
+func (j *JSONAccessLog) LogRequest(rec *AccessLogRecord) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.enc.Encode(rec); err != nil {
+		glog.Warningf("Failed to write access log record: %v", err)
+	}
+}
+
+var errFileClosed = errors.New("file already closed")
+
+// RotatingFile is an io.WriteCloser that appends to a file, renaming it once it reaches a
+// maximum size. Up to maxBackups old files are kept, named path.1 (the most recent) to
+// path.<maxBackups>.
+type RotatingFile struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewRotatingFile opens the file at path for appending, creating it if necessary.
+func NewRotatingFile(path string, maxBytes int64, maxBackups int) (*RotatingFile, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("invalid max file size: %d", maxBytes)
+	}
+	r := &RotatingFile{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = info.Size()
+	return nil
+}
+
+// Write appends p to the file, rotating it first if p would take it over the maximum size.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return 0, errFileClosed
+	}
+	if r.size > 0 && r.size+int64(len(p)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return 0, fmt.Errorf("failed to rotate %s: %v", r.path, err)
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+
+	if r.maxBackups <= 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.open()
+	}
+
+	// Shift the existing backups along, the oldest is overwritten.
+	for i := r.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(r.backupPath(i), r.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.backupPath(1)); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *RotatingFile) backupPath(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+// RemoveBackupsOlderThan removes the rotated files last written before cutoff, so that
+// records are kept for a limited time as well as in limited space. It returns the
+// number of files removed.
+func (r *RotatingFile) RemoveBackupsOlderThan(cutoff time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removed := 0
+	for i := 1; i <= r.maxBackups; i++ {
+		info, err := os.Stat(r.backupPath(i))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return removed, err
+		}
+		if info.ModTime().Before(cutoff) {
+			if err := os.Remove(r.backupPath(i)); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Close closes the current file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// responseRecorder wraps an http.ResponseWriter to record the status and the number of
+// body bytes written for the access log.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write records that the response has started, unless b is empty. Empty writes aren't
+// passed on, so they don't commit the headers and a handler that wrote nothing can still
+// fail the request.
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush sends any buffered response data to the client.
+func (r *responseRecorder) Flush() {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	flushResponse(r.ResponseWriter)
+}
+
+// clientIP returns the IP address of the client that made a request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,301 @@
+package ct
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+// recordingAccessLog keeps the records it's given so tests can check them.
+type recordingAccessLog struct {
+	mu   sync.Mutex
+	recs []AccessLogRecord
+}
+
+func (r *recordingAccessLog) LogRequest(rec *AccessLogRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recs = append(r.recs, *rec)
+}
+
+func TestAccessLogRecords(t *testing.T) {
+	var tests = []struct {
+		descr      string
+		method     string
+		status     int
+		body       string
+		err        error
+		wantStatus int
+		wantBytes  bool
+		wantError  bool
+	}{
+		{descr: "ok", method: http.MethodGet, status: http.StatusOK, body: "{}", wantStatus: http.StatusOK, wantBytes: true},
+		{descr: "handler-error", method: http.MethodGet, status: http.StatusBadRequest, err: errors.New("bad param"), wantStatus: http.StatusBadRequest, wantBytes: true, wantError: true},
+		{descr: "wrong-method", method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed, wantBytes: true, wantError: true},
+		{descr: "misbehaving", method: http.MethodGet, status: http.StatusAccepted, wantStatus: http.StatusInternalServerError, wantBytes: true, wantError: true},
+	}
+
+	for _, test := range tests {
+		info := setupTest(t, nil)
+		sink := &recordingAccessLog{}
+		info.c.accessLog = sink
+		info.c.compressResponses = false
+
+		handler := appHandler{context: info.c, name: "GetSTH", method: http.MethodGet,
+			handler: func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+				if test.err == nil {
+					w.Write([]byte(test.body))
+				}
+				return test.status, test.err
+			}}
+
+		req, err := http.NewRequest(test.method, "http://example.com/ct/v1/get-sth", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.RemoteAddr = "192.0.2.1:4321"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if got, want := len(sink.recs), 1; got != want {
+			t.Errorf("ServeHTTP(%s) logged %d records, want %d", test.descr, got, want)
+			continue
+		}
+		rec := sink.recs[0]
+		if got := rec.Status; got != test.wantStatus {
+			t.Errorf("ServeHTTP(%s).Status=%d, want %d", test.descr, got, test.wantStatus)
+		}
+		if got := rec.BytesWritten > 0; got != test.wantBytes {
+			t.Errorf("ServeHTTP(%s).BytesWritten=%d, want non-zero: %v", test.descr, rec.BytesWritten, test.wantBytes)
+		}
+		if got := len(rec.Error) > 0; got != test.wantError {
+			t.Errorf("ServeHTTP(%s).Error=%q, want error: %v", test.descr, rec.Error, test.wantError)
+		}
+		if rec.LogID != 0x42 || rec.Endpoint != "GetSTH" || rec.Method != test.method || rec.ClientIP != "192.0.2.1" || !rec.Time.Equal(fakeTime) {
+			t.Errorf("ServeHTTP(%s) logged %+v, want request details", test.descr, rec)
+		}
+		info.mockCtrl.Finish()
+	}
+}
+
+func TestJSONAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONAccessLog(&buf)
+	sink.LogRequest(&AccessLogRecord{LogID: 1, Endpoint: "GetSTH", Status: 200})
+	sink.LogRequest(&AccessLogRecord{LogID: 1, Endpoint: "AddChain", Status: 400, Error: "bad chain"})
+
+	dec := json.NewDecoder(&buf)
+	for _, want := range []string{"GetSTH", "AddChain"} {
+		var rec AccessLogRecord
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("Decode()=%v", err)
+		}
+		if got := rec.Endpoint; got != want {
+			t.Errorf("Decode().Endpoint=%s, want %s", got, want)
+		}
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "access_log")
+	if err != nil {
+		t.Fatalf("TempDir()=%v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	f, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("NewRotatingFile()=%v", err)
+	}
+	for _, line := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write(%q)=%v", line, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close()=%v", err)
+	}
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("Write() after Close()=nil, want error")
+	}
+
+	// Each write would take the file over the limit, so each line ends up in its own file
+	// and the oldest is dropped.
+	for suffix, want := range map[string]string{"": "dddddd\n", ".1": "cccccc\n", ".2": "bbbbbb\n"} {
+		got, err := ioutil.ReadFile(path + suffix)
+		if err != nil {
+			t.Errorf("ReadFile(%s)=%v", suffix, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("ReadFile(%s)=%q, want %q", suffix, got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Stat(.3)=%v, want not exist", err)
+	}
+}
+
+func TestRotatingFileRemoveBackupsOlderThan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "access_log")
+	if err != nil {
+		t.Fatalf("TempDir()=%v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "proofs.log")
+
+	f, err := NewRotatingFile(path, 10, 3)
+	if err != nil {
+		t.Fatalf("NewRotatingFile()=%v", err)
+	}
+	defer f.Close()
+	for _, line := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write(%q)=%v", line, err)
+		}
+	}
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	for _, suffix := range []string{".2", ".3"} {
+		if err := os.Chtimes(path+suffix, old, old); err != nil {
+			t.Fatalf("Chtimes(%s)=%v", suffix, err)
+		}
+	}
+
+	removed, err := f.RemoveBackupsOlderThan(now.Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatalf("RemoveBackupsOlderThan()=%v", err)
+	}
+	if got, want := removed, 2; got != want {
+		t.Errorf("RemoveBackupsOlderThan()=%d, want %d", got, want)
+	}
+	for suffix, wantExist := range map[string]bool{"": true, ".1": true, ".2": false, ".3": false} {
+		_, err := os.Stat(path + suffix)
+		if got := err == nil; got != wantExist {
+			t.Errorf("Stat(%s)=%v, want exists: %v", suffix, err, wantExist)
+		}
+	}
+
+	// The current file is never removed, and rotation carries on as before.
+	if _, err := f.Write([]byte("eeeeee\n")); err != nil {
+		t.Fatalf("Write()=%v", err)
+	}
+	if got, err := ioutil.ReadFile(path + ".2"); err != nil || string(got) != "cccccc\n" {
+		t.Errorf("ReadFile(.2)=%q,%v, want %q", got, err, "cccccc\n")
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var tests = []struct {
+		header   string
+		wantSame bool
+	}{
+		{header: "", wantSame: false},
+		{header: "client-req-1", wantSame: true},
+		{header: "not a valid id", wantSame: false},
+	}
+
+	for _, test := range tests {
+		info := setupTest(t, nil)
+		sink := &recordingAccessLog{}
+		info.c.accessLog = sink
+
+		var ctxID string
+		handler := appHandler{context: info.c, name: "GetSTH", method: http.MethodGet,
+			handler: func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+				ctxID, _ = util.RequestIDFromContext(ctx)
+				return http.StatusBadRequest, errors.New("bad param")
+			}}
+
+		req, err := http.NewRequest(http.MethodGet, "http://example.com/ct/v1/get-sth", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if len(test.header) > 0 {
+			req.Header.Set(util.RequestIDHeader, test.header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		got := w.Header().Get(util.RequestIDHeader)
+		if !util.ValidRequestID(got) {
+			t.Errorf("ServeHTTP(%q) returned request ID %q; want valid ID", test.header, got)
+		}
+		if (got == test.header) != test.wantSame {
+			t.Errorf("ServeHTTP(%q) returned request ID %q; want client's ID: %v", test.header, got, test.wantSame)
+		}
+		if ctxID != got {
+			t.Errorf("ServeHTTP(%q) handler context request ID %q; want %q", test.header, ctxID, got)
+		}
+		if !strings.Contains(w.Body.String(), got) {
+			t.Errorf("ServeHTTP(%q) error body %q; want to find request ID %q", test.header, w.Body.String(), got)
+		}
+		if len(sink.recs) != 1 || sink.recs[0].RequestID != got {
+			t.Errorf("ServeHTTP(%q) logged %+v; want request ID %q", test.header, sink.recs, got)
+		}
+		info.mockCtrl.Finish()
+	}
+}
+
+func TestTraceParent(t *testing.T) {
+	clientSpan := util.SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	var tests = []struct {
+		header   string
+		wantSame bool
+	}{
+		{header: "", wantSame: false},
+		{header: clientSpan.TraceParent(), wantSame: true},
+		{header: "00-not-a-trace-01", wantSame: false},
+	}
+
+	for _, test := range tests {
+		info := setupTest(t, nil)
+		sink := &recordingAccessLog{}
+		info.c.accessLog = sink
+
+		var span *util.Span
+		handler := appHandler{context: info.c, name: "GetSTH", method: http.MethodGet,
+			handler: func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+				span, _ = util.SpanFromContext(ctx)
+				return http.StatusOK, nil
+			}}
+
+		req, err := http.NewRequest(http.MethodGet, "http://example.com/ct/v1/get-sth", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if len(test.header) > 0 {
+			req.Header.Set(util.TraceParentHeader, test.header)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if span == nil {
+			t.Errorf("ServeHTTP(%q) handler context has no span", test.header)
+			info.mockCtrl.Finish()
+			continue
+		}
+		if got := span.TraceID == clientSpan.TraceID; got != test.wantSame {
+			t.Errorf("ServeHTTP(%q) span trace ID %q; want client's trace: %v", test.header, span.TraceID, test.wantSame)
+		}
+		if span.SpanID == clientSpan.SpanID {
+			t.Errorf("ServeHTTP(%q) span ID %q; want new span", test.header, span.SpanID)
+		}
+		if len(sink.recs) != 1 || sink.recs[0].TraceID != span.TraceID {
+			t.Errorf("ServeHTTP(%q) logged %+v; want trace ID %q", test.header, sink.recs, span.TraceID)
+		}
+		info.mockCtrl.Finish()
+	}
+}
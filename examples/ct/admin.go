@@ -0,0 +1,271 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/certificate-transparency/go/x509"
+	"golang.org/x/net/context"
+)
+
+// Paths of the admin API, relative to the log's prefix. They're served on the admin
+// port rather than with the public API, and only accept signed requests.
+const (
+	AdminGetRootsPath   = "/admin/v1/get-roots"
+	AdminAddRootPath    = "/admin/v1/add-root"
+	AdminRemoveRootPath = "/admin/v1/remove-root"
+	AdminGetStatePath   = "/admin/v1/get-state"
+	AdminSetStatePath   = "/admin/v1/set-state"
+	AdminGetDumpPath    = "/admin/v1/get-dump"
+	AdminSetDumpPath    = "/admin/v1/set-dump"
+)
+
+// AdminEntrypoints is a list of the admin API entrypoint names as exposed in statistics.
+var AdminEntrypoints = []string{"AdminGetRoots", "AdminAddRoot", "AdminRemoveRoot", "AdminGetState", "AdminSetState", "AdminGetDump", "AdminSetDump"}
+
+// AdminRoot describes one of a log's accepted roots.
+type AdminRoot struct {
+	// Fingerprint is the hex encoded SHA-256 hash of the certificate.
+	Fingerprint string `json:"fingerprint"`
+	Subject     string `json:"subject"`
+	NotAfter    string `json:"not_after"`
+	// Certificate is the DER encoded certificate.
+	Certificate []byte `json:"certificate"`
+	// Editable is true if the root is held in the log's roots file, so can be removed
+	// with the admin API. Roots from the log's roots directory or sources can't be.
+	Editable bool `json:"editable"`
+}
+
+// AdminGetRootsResponse is the response to an admin get-roots request.
+type AdminGetRootsResponse struct {
+	Roots []AdminRoot `json:"roots"`
+}
+
+// AdminAddRootRequest asks for a root to be accepted by the log.
+type AdminAddRootRequest struct {
+	// PEM holds the PEM encoded root certificate.
+	PEM string `json:"pem"`
+}
+
+// AdminAddRootResponse is the response to an admin add-root request.
+type AdminAddRootResponse struct {
+	// Fingerprint is the hex encoded SHA-256 hash of the root certificate.
+	Fingerprint string `json:"fingerprint"`
+	// Added is false if the root was already in the log's roots file.
+	Added bool `json:"added"`
+}
+
+// AdminRemoveRootRequest asks for a root to no longer be accepted by the log.
+type AdminRemoveRootRequest struct {
+	// Fingerprint is the hex encoded SHA-256 hash of the root certificate.
+	Fingerprint string `json:"fingerprint"`
+}
+
+// errLastRoot is returned when removing a root would leave the roots file empty, which
+// would stop the log starting.
+var errLastRoot = errors.New("can't remove the last root in the log's roots file")
+
+// rootsEditor makes changes requested through the admin API to the roots a log accepts.
+// Changes are made to the log's roots file, so they last over restarts, and then the
+// log's roots are rebuilt from all their sources.
+type rootsEditor struct {
+	pemFile string
+	// reload rebuilds the log's roots once pemFile has changed
+	reload func() error
+
+	// mu serializes changes to pemFile
+	mu sync.Mutex
+}
+
+// rootsReloader returns a function rebuilding roots after pemFile has been changed. A log
+// with a rootsFetcher also has roots from other places, so the fetcher rebuilds them.
+func rootsReloader(pemFile string, roots *TrustedRoots, fetcher *rootsFetcher) func() error {
+	if fetcher != nil {
+		return func() error {
+			return fetcher.reloadLocal(roots)
+		}
+	}
+	return func() error {
+		pool := NewPEMCertPool()
+		if err := pool.AppendCertsFromPEMFile(pemFile); err != nil {
+			return err
+		}
+		roots.Update(pool)
+		return nil
+	}
+}
+
+// fileRoots returns the roots currently held in the roots file.
+func (e *rootsEditor) fileRoots() (*PEMCertPool, error) {
+	pool := NewPEMCertPool()
+	data, err := ioutil.ReadFile(e.pemFile)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := parsePEMRoots(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
+
+// add makes the log accept cert, which the caller must have checked with checkRoot. It
+// returns false if the root was already in the roots file.
+func (e *rootsEditor) add(cert *x509.Certificate) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	pool, err := e.fileRoots()
+	if err != nil {
+		return false, err
+	}
+	before := pool.Fingerprint()
+	pool.AddCert(cert)
+	if pool.Fingerprint() == before {
+		return false, nil
+	}
+	return true, e.save(pool)
+}
+
+// remove stops the log accepting the root with the given SHA-256 fingerprint. It returns
+// false if the root isn't in the roots file.
+func (e *rootsEditor) remove(fingerprint [sha256.Size]byte) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	pool, err := e.fileRoots()
+	if err != nil {
+		return false, err
+	}
+	remaining := NewPEMCertPool()
+	for _, cert := range pool.RawCertificates() {
+		if sha256.Sum256(cert.Raw) != fingerprint {
+			remaining.AddCert(cert)
+		}
+	}
+	if len(remaining.RawCertificates()) == len(pool.RawCertificates()) {
+		return false, nil
+	}
+	if len(remaining.RawCertificates()) == 0 {
+		return false, errLastRoot
+	}
+	return true, e.save(remaining)
+}
+
+// save replaces the roots file with pool and rebuilds the log's roots.
+func (e *rootsEditor) save(pool *PEMCertPool) error {
+	if err := writeRootsCache(e.pemFile, pool); err != nil {
+		return fmt.Errorf("failed to write roots file: %v", err)
+	}
+	if err := e.reload(); err != nil {
+		return fmt.Errorf("roots file updated but failed to reload roots: %v", err)
+	}
+	return nil
+}
+
+// RegisterAdminHandlers registers the admin API handlers for the log on mux. They only
+// accept requests signed with one of the log's request signing keys.
+func (c LogContext) RegisterAdminHandlers(mux *http.ServeMux, prefix string) {
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	prefix = strings.TrimRight(prefix, "/")
+
+	mux.Handle(prefix+AdminGetRootsPath, appHandler{context: c, handler: adminGetRoots, name: "AdminGetRoots", method: http.MethodGet, privileged: true})
+	mux.Handle(prefix+AdminAddRootPath, appHandler{context: c, handler: adminAddRoot, name: "AdminAddRoot", method: http.MethodPost, privileged: true})
+	mux.Handle(prefix+AdminRemoveRootPath, appHandler{context: c, handler: adminRemoveRoot, name: "AdminRemoveRoot", method: http.MethodPost, privileged: true})
+	mux.Handle(prefix+AdminGetStatePath, appHandler{context: c, handler: adminGetState, name: "AdminGetState", method: http.MethodGet, privileged: true})
+	mux.Handle(prefix+AdminSetStatePath, appHandler{context: c, handler: adminSetState, name: "AdminSetState", method: http.MethodPost, privileged: true})
+	mux.Handle(prefix+AdminGetDumpPath, appHandler{context: c, handler: adminGetDump, name: "AdminGetDump", method: http.MethodGet, privileged: true})
+	mux.Handle(prefix+AdminSetDumpPath, appHandler{context: c, handler: adminSetDump, name: "AdminSetDump", method: http.MethodPost, privileged: true})
+}
+
+func adminGetRoots(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	editable := make(map[[sha256.Size]byte]bool)
+	if c.rootsEditor != nil {
+		if pool, err := c.rootsEditor.fileRoots(); err == nil {
+			for _, cert := range pool.RawCertificates() {
+				editable[sha256.Sum256(cert.Raw)] = true
+			}
+		} else {
+			glog.Warningf("%s: failed to read roots file: %v", c.logPrefix, err)
+		}
+	}
+
+	rsp := AdminGetRootsResponse{Roots: []AdminRoot{}}
+	for _, cert := range c.trustedRoots.Pool().RawCertificates() {
+		fingerprint := sha256.Sum256(cert.Raw)
+		rsp.Roots = append(rsp.Roots, AdminRoot{
+			Fingerprint: hex.EncodeToString(fingerprint[:]),
+			Subject:     cert.Subject.CommonName,
+			NotAfter:    cert.NotAfter.UTC().Format(time.RFC3339),
+			Certificate: cert.Raw,
+			Editable:    editable[fingerprint],
+		})
+	}
+	return writeJSON(w, rsp)
+}
+
+func adminAddRoot(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	if c.rootsEditor == nil {
+		return http.StatusNotImplemented, errors.New("log has no roots file to edit")
+	}
+	var req AdminAddRootRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to parse request: %v", err)
+	}
+	certs, err := parsePEMRoots([]byte(req.PEM))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if len(certs) != 1 {
+		return http.StatusBadRequest, fmt.Errorf("request has %d certificates, want 1", len(certs))
+	}
+	if err := checkRoot(certs[0]); err != nil {
+		return http.StatusBadRequest, err
+	}
+	added, err := c.rootsEditor.add(certs[0])
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	fingerprint := sha256.Sum256(certs[0].Raw)
+	if added {
+		glog.Infof("%s: admin added root %x for %v", c.logPrefix, fingerprint, certs[0].Subject)
+	}
+	return writeJSON(w, AdminAddRootResponse{Fingerprint: hex.EncodeToString(fingerprint[:]), Added: added})
+}
+
+func adminRemoveRoot(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	if c.rootsEditor == nil {
+		return http.StatusNotImplemented, errors.New("log has no roots file to edit")
+	}
+	var req AdminRemoveRootRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to parse request: %v", err)
+	}
+	hash, err := parseSHA256Hex(strings.ToLower(req.Fingerprint))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	removed, err := c.rootsEditor.remove(hash)
+	if err == errLastRoot {
+		return http.StatusConflict, err
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !removed {
+		return http.StatusNotFound, fmt.Errorf("root %x is not in the log's roots file", hash)
+	}
+	glog.Infof("%s: admin removed root %x", c.logPrefix, hash)
+	return writeJSON(w, struct{}{})
+}
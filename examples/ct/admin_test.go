@@ -0,0 +1,184 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/examples/ct/testonly"
+)
+
+// writeRootsFile writes certPEM to a roots file in a new temporary directory.
+func writeRootsFile(t *testing.T, certPEM string) (string, func()) {
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	pemFile := filepath.Join(dir, "roots.pem")
+	if err := ioutil.WriteFile(pemFile, []byte(certPEM), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Failed to write roots file: %v", err)
+	}
+	return pemFile, func() { os.RemoveAll(dir) }
+}
+
+func TestRootsEditor(t *testing.T) {
+	pemFile, cleanup := writeRootsFile(t, testonly.CACertPEM)
+	defer cleanup()
+	pool := NewPEMCertPool()
+	if err := pool.AppendCertsFromPEMFile(pemFile); err != nil {
+		t.Fatalf("Failed to load roots: %v", err)
+	}
+	roots := NewTrustedRoots(pool)
+	e := &rootsEditor{pemFile: pemFile, reload: rootsReloader(pemFile, roots, nil)}
+
+	caCert := pemToCert(t, testonly.CACertPEM)
+	fakeCACert := pemToCert(t, testonly.FakeCACertPEM)
+	checkRoots := func(op string, want int) {
+		if got := len(roots.Pool().RawCertificates()); got != want {
+			t.Errorf("after %s: log has %d roots, want %d", op, got, want)
+		}
+		saved := NewPEMCertPool()
+		if err := saved.AppendCertsFromPEMFile(pemFile); err != nil {
+			t.Fatalf("after %s: failed to load roots file: %v", op, err)
+		}
+		if got := len(saved.RawCertificates()); got != want {
+			t.Errorf("after %s: roots file has %d roots, want %d", op, got, want)
+		}
+	}
+
+	if added, err := e.add(fakeCACert); err != nil || !added {
+		t.Fatalf("add()=%v,%v, want true,nil", added, err)
+	}
+	checkRoots("add", 2)
+	if added, err := e.add(fakeCACert); err != nil || added {
+		t.Errorf("add(again)=%v,%v, want false,nil", added, err)
+	}
+	checkRoots("add again", 2)
+
+	if removed, err := e.remove(sha256.Sum256(caCert.Raw)); err != nil || !removed {
+		t.Fatalf("remove()=%v,%v, want true,nil", removed, err)
+	}
+	checkRoots("remove", 1)
+	if !bytes.Equal(roots.Pool().RawCertificates()[0].Raw, fakeCACert.Raw) {
+		t.Errorf("after remove: log accepts the wrong root")
+	}
+	if removed, err := e.remove(sha256.Sum256(caCert.Raw)); err != nil || removed {
+		t.Errorf("remove(again)=%v,%v, want false,nil", removed, err)
+	}
+	if _, err := e.remove(sha256.Sum256(fakeCACert.Raw)); err != errLastRoot {
+		t.Errorf("remove(last root)=%v, want %v", err, errLastRoot)
+	}
+	checkRoots("remove last", 1)
+}
+
+func TestAdminHandlers(t *testing.T) {
+	info := setupTest(t, []string{testonly.CACertPEM})
+	defer info.mockCtrl.Finish()
+	pemFile, cleanup := writeRootsFile(t, testonly.CACertPEM)
+	defer cleanup()
+
+	mux := http.NewServeMux()
+	// Without request signing keys nothing is allowed.
+	info.c.RegisterAdminHandlers(mux, "/log")
+	req, err := http.NewRequest("GET", "http://example.com/log"+AdminGetRootsPath, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if err := SignRequestHMAC(req, "hmac", testHMACSecret, fakeTime); err != nil {
+		t.Fatalf("SignRequestHMAC()=%v, want no error", err)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusUnauthorized; got != want {
+		t.Errorf("AdminGetRoots(no keys)=%d, want %d", got, want)
+	}
+
+	v, err := newRequestVerifier([]RequestSigningKey{{ID: "hmac", Algorithm: SigningAlgorithmHMACSHA256, Key: base64.StdEncoding.EncodeToString(testHMACSecret)}}, time.Minute, fakeTimeSource)
+	if err != nil {
+		t.Fatalf("newRequestVerifier()=_,%v, want no error", err)
+	}
+	info.c.requestVerifier = v
+	info.c.rootsEditor = &rootsEditor{pemFile: pemFile, reload: rootsReloader(pemFile, info.c.trustedRoots, nil)}
+	mux = http.NewServeMux()
+	info.c.RegisterAdminHandlers(mux, "/log")
+
+	call := func(method, path string, body interface{}, sign bool) *httptest.ResponseRecorder {
+		var req *http.Request
+		var err error
+		if body != nil {
+			var data []byte
+			if data, err = json.Marshal(body); err != nil {
+				t.Fatalf("Failed to marshal request: %v", err)
+			}
+			req, err = http.NewRequest(method, "http://example.com/log"+path, bytes.NewReader(data))
+		} else {
+			req, err = http.NewRequest(method, "http://example.com/log"+path, nil)
+		}
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if sign {
+			if err := SignRequestHMAC(req, "hmac", testHMACSecret, fakeTime); err != nil {
+				t.Fatalf("SignRequestHMAC()=%v, want no error", err)
+			}
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	fakeCAHash := sha256.Sum256(pemToCert(t, testonly.FakeCACertPEM).Raw)
+	fakeCAFingerprint := hex.EncodeToString(fakeCAHash[:])
+	var tests = []struct {
+		descr      string
+		method     string
+		path       string
+		body       interface{}
+		unsigned   bool
+		wantStatus int
+		wantRoots  int
+	}{
+		{descr: "unsigned", method: "POST", path: AdminAddRootPath, body: AdminAddRootRequest{PEM: testonly.FakeCACertPEM}, unsigned: true, wantStatus: http.StatusUnauthorized, wantRoots: 1},
+		{descr: "add", method: "POST", path: AdminAddRootPath, body: AdminAddRootRequest{PEM: testonly.FakeCACertPEM}, wantStatus: http.StatusOK, wantRoots: 2},
+		{descr: "add-not-root", method: "POST", path: AdminAddRootPath, body: AdminAddRootRequest{PEM: testonly.FakeIntermediateCertPEM}, wantStatus: http.StatusBadRequest, wantRoots: 2},
+		{descr: "add-not-pem", method: "POST", path: AdminAddRootPath, body: AdminAddRootRequest{PEM: "not a cert"}, wantStatus: http.StatusBadRequest, wantRoots: 2},
+		{descr: "add-wrong-method", method: "GET", path: AdminAddRootPath, wantStatus: http.StatusMethodNotAllowed, wantRoots: 2},
+		{descr: "remove", method: "POST", path: AdminRemoveRootPath, body: AdminRemoveRootRequest{Fingerprint: fakeCAFingerprint}, wantStatus: http.StatusOK, wantRoots: 1},
+		{descr: "remove-unknown", method: "POST", path: AdminRemoveRootPath, body: AdminRemoveRootRequest{Fingerprint: fakeCAFingerprint}, wantStatus: http.StatusNotFound, wantRoots: 1},
+		{descr: "remove-bad-fingerprint", method: "POST", path: AdminRemoveRootPath, body: AdminRemoveRootRequest{Fingerprint: "abcd"}, wantStatus: http.StatusBadRequest, wantRoots: 1},
+	}
+
+	for _, test := range tests {
+		w := call(test.method, test.path, test.body, !test.unsigned)
+		if got, want := w.Code, test.wantStatus; got != want {
+			t.Errorf("%s: status=%d (body:%v), want %d", test.descr, got, w.Body, want)
+		}
+
+		w = call("GET", AdminGetRootsPath, nil, true)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("%s: AdminGetRoots()=%d (body:%v), want %d", test.descr, got, w.Body, want)
+		}
+		var rsp AdminGetRootsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+			t.Fatalf("%s: failed to unmarshal get-roots response: %v", test.descr, err)
+		}
+		if got, want := len(rsp.Roots), test.wantRoots; got != want {
+			t.Errorf("%s: AdminGetRoots() returned %d roots, want %d", test.descr, got, want)
+		}
+		for _, root := range rsp.Roots {
+			if !root.Editable {
+				t.Errorf("%s: AdminGetRoots() returned root %s as not editable", test.descr, root.Fingerprint)
+			}
+		}
+	}
+}
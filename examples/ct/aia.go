@@ -0,0 +1,289 @@
+package ct
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+const (
+	// Default time allowed for fetching a single issuer certificate
+	defaultAIAFetchTimeout = 5 * time.Second
+	// How long fetched certificates are cached for
+	aiaCacheTTL = time.Hour
+	// How long failed fetches are remembered, so a broken URL isn't retried on every submission
+	aiaNegativeCacheTTL = 5 * time.Minute
+	// Max number of URLs cached; the cache is emptied when it gets this big
+	aiaMaxCacheEntries = 1000
+	// Max number of issuers fetched to complete a single chain
+	aiaMaxFetchesPerChain = 4
+	// Max size of a fetched issuer certificate
+	aiaMaxCertSize = 64 * 1024
+)
+
+type aiaCacheEntry struct {
+	cert    *x509.Certificate
+	err     error
+	expires time.Time
+}
+
+// aiaFetcher completes chains that are missing intermediates, using the caIssuers URLs
+// in the certificates' Authority Information Access extension. Many submitters send only
+// the leaf, or the leaf and some of the intermediates, and would otherwise be rejected.
+// Fetched certificates, and failures, are cached so that popular issuers are only
+// fetched occasionally.
+type aiaFetcher struct {
+	logPrefix  string
+	client     *http.Client
+	timeout    time.Duration
+	timeSource util.TimeSource
+
+	mu    sync.Mutex
+	cache map[string]aiaCacheEntry
+
+	exp struct {
+		vars      *expvar.Map
+		fetches   *expvar.Int
+		failures  *expvar.Int
+		cacheHits *expvar.Int
+		completed *expvar.Int
+	}
+}
+
+// newAIAFetcher creates an aiaFetcher. If client is nil, the fetcher uses a client that
+// only connects to public addresses, see newAIAClient.
+func newAIAFetcher(logPrefix string, client *http.Client, timeout time.Duration, timeSource util.TimeSource) *aiaFetcher {
+	if client == nil {
+		client = newAIAClient(isPublicIP)
+	}
+	if timeout <= 0 {
+		timeout = defaultAIAFetchTimeout
+	}
+	f := &aiaFetcher{
+		logPrefix:  logPrefix,
+		client:     client,
+		timeout:    timeout,
+		timeSource: timeSource,
+		cache:      make(map[string]aiaCacheEntry),
+	}
+	f.exp.vars = new(expvar.Map).Init()
+	f.exp.fetches = new(expvar.Int)
+	f.exp.vars.Set("fetches", f.exp.fetches)
+	f.exp.failures = new(expvar.Int)
+	f.exp.vars.Set("fetch-failures", f.exp.failures)
+	f.exp.cacheHits = new(expvar.Int)
+	f.exp.vars.Set("cache-hits", f.exp.cacheHits)
+	f.exp.completed = new(expvar.Int)
+	f.exp.vars.Set("chains-completed", f.exp.completed)
+	return f
+}
+
+// nonPublicNets are the address ranges, on top of loopback, link-local, multicast and
+// unspecified addresses, that caIssuers URLs aren't allowed to point at.
+var nonPublicNets = mustParseCIDRs(
+	"0.0.0.0/8",      // "this" network
+	"10.0.0.0/8",     // RFC 1918
+	"100.64.0.0/10",  // carrier-grade NAT
+	"172.16.0.0/12",  // RFC 1918
+	"192.168.0.0/16", // RFC 1918
+	"fc00::/7",       // unique local
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// isPublicIP reports whether ip is a globally routable unicast address.
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// newAIAClient returns an HTTP client that only connects to addresses that allowed
+// accepts. caIssuers URLs come from submitted certificates, so without this anyone could make
+// the log fetch from its own network, e.g. a cloud metadata service at 169.254.169.254.
+// The check is made on the resolved addresses when connecting, so it also covers
+// redirects and host names that resolve to internal addresses. Proxies from the
+// environment aren't used, as they would connect on the log's behalf.
+func newAIAClient(allowed func(net.IP) bool) *http.Client {
+	dialer := &net.Dialer{Timeout: defaultAIAFetchTimeout}
+	dial := func(network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			if !allowed(ip) {
+				return nil, fmt.Errorf("%s resolves to non-public address %s", host, ip)
+			}
+		}
+		// Dial the address that was checked, rather than resolving the name again.
+		return dialer.Dial(network, net.JoinHostPort(ips[0].String(), port))
+	}
+	return &http.Client{Transport: &http.Transport{Dial: dial, TLSHandshakeTimeout: defaultAIAFetchTimeout}}
+}
+
+// Vars returns the statistics exported by this aiaFetcher.
+func (f *aiaFetcher) Vars() *expvar.Map {
+	return f.exp.vars
+}
+
+// completeChain extends a chain that doesn't verify by fetching the issuer of its last
+// certificate, until the chain verifies against roots or there's nothing more to fetch.
+// The returned path is ValidateChain's: the submitted certificates followed by the fetched
+// ones, without the trusted root, and it won't be longer than maxLength.
+func (f *aiaFetcher) completeChain(ctx context.Context, rawChain [][]byte, roots PEMCertPool, maxLength int) ([]*x509.Certificate, error) {
+	chain := append([][]byte(nil), rawChain...)
+	for i := 0; i < aiaMaxFetchesPerChain && len(chain) < maxLength; i++ {
+		last, err := x509.ParseCertificate(chain[len(chain)-1])
+		if err != nil {
+			if _, ok := err.(x509.NonFatalErrors); !ok {
+				return nil, err
+			}
+		}
+		issuer, err := f.fetchIssuer(ctx, last)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range chain {
+			if bytes.Equal(c, issuer.Raw) {
+				return nil, errors.New("caIssuers URLs form a loop")
+			}
+		}
+		chain = append(chain, issuer.Raw)
+
+		if path, err := ValidateChain(chain, roots); err == nil {
+			f.exp.completed.Add(1)
+			return path, nil
+		}
+	}
+	return nil, fmt.Errorf("no path to a root after fetching issuers, giving up with %d certificates", len(chain))
+}
+
+// fetchIssuer returns the first certificate that can be fetched from cert's caIssuers URLs.
+func (f *aiaFetcher) fetchIssuer(ctx context.Context, cert *x509.Certificate) (*x509.Certificate, error) {
+	if len(cert.IssuingCertificateURL) == 0 {
+		return nil, errors.New("no caIssuers URL to fetch missing issuer from")
+	}
+	var lastErr error
+	for _, u := range cert.IssuingCertificateURL {
+		issuer, err := f.fetch(ctx, u)
+		if err == nil {
+			return issuer, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// fetch returns the certificate at u, from the cache if possible.
+func (f *aiaFetcher) fetch(ctx context.Context, u string) (*x509.Certificate, error) {
+	now := f.timeSource.Now()
+	f.mu.Lock()
+	entry, ok := f.cache[u]
+	f.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		f.exp.cacheHits.Add(1)
+		return entry.cert, entry.err
+	}
+
+	f.exp.fetches.Add(1)
+	cert, err := f.download(ctx, u)
+	if err != nil {
+		f.exp.failures.Add(1)
+		glog.V(1).Infof("%s: failed to fetch issuer from %s: %v", f.logPrefix, u, err)
+		err = fmt.Errorf("failed to fetch issuer from %s: %v", u, err)
+		if ctx.Err() != nil {
+			// The request was cancelled or ran out of time, which says nothing about the URL.
+			return nil, err
+		}
+	}
+	entry = aiaCacheEntry{cert: cert, err: err, expires: now.Add(aiaCacheTTL)}
+	if err != nil {
+		entry.expires = now.Add(aiaNegativeCacheTTL)
+	}
+
+	f.mu.Lock()
+	if len(f.cache) >= aiaMaxCacheEntries {
+		f.cache = make(map[string]aiaCacheEntry)
+	}
+	f.cache[u] = entry
+	f.mu.Unlock()
+	return entry.cert, entry.err
+}
+
+// download fetches a certificate over HTTP. caIssuers URLs usually point at a DER
+// certificate, but some serve PEM so both are accepted.
+func (f *aiaFetcher) download(ctx context.Context, u string) (*x509.Certificate, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme: %s", parsed.Scheme)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+	rsp, err := ctxhttp.Get(ctx, f.client, u)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got HTTP status %s", rsp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(rsp.Body, aiaMaxCertSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > aiaMaxCertSize {
+		return nil, fmt.Errorf("certificate larger than %d bytes", aiaMaxCertSize)
+	}
+
+	if block, _ := pem.Decode(data); block != nil && block.Type == pemCertificateBlockType {
+		data = block.Bytes
+	}
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		if _, ok := err.(x509.NonFatalErrors); !ok {
+			return nil, err
+		}
+	}
+	return cert, nil
+}
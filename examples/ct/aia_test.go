@@ -0,0 +1,184 @@
+package ct
+
+import (
+	"crypto/ecdsa"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/trillian/examples/ct/testonly"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+// createTestCert creates a certificate for name signed by parent, or self-signed if parent
+// is nil. The certificate's caIssuers URL is set to aiaURL if it's not empty.
+func createTestCert(t *testing.T, name string, isCA bool, aiaURL string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	spec := testonly.CertSpec{CommonName: name}
+	if len(aiaURL) > 0 {
+		spec.IssuingCertificateURL = []string{aiaURL}
+	}
+	b := testonly.NewChainBuilder(t)
+	var cert *testonly.Cert
+	switch {
+	case parent == nil && isCA:
+		cert = b.Root(spec)
+	case parent == nil:
+		cert = b.Leaf(nil, spec)
+	case isCA:
+		cert = b.Intermediate(&testonly.Cert{Certificate: parent, Key: parentKey}, spec)
+	default:
+		cert = b.Leaf(&testonly.Cert{Certificate: parent, Key: parentKey}, spec)
+	}
+	return cert.Certificate, cert.Key.(*ecdsa.PrivateKey)
+}
+
+func TestAIAFetcherCompleteChain(t *testing.T) {
+	var mu sync.Mutex
+	docs := make(map[string][]byte)
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests[r.URL.Path]++
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(doc)
+	}))
+	defer server.Close()
+
+	root, rootKey := createTestCert(t, "root", true, "", nil, nil)
+	intermediate, intermediateKey := createTestCert(t, "intermediate", true, server.URL+"/root.der", root, rootKey)
+	leaf, _ := createTestCert(t, "leaf", false, server.URL+"/intermediate.der", intermediate, intermediateKey)
+	orphan, _ := createTestCert(t, "orphan", false, server.URL+"/missing.der", intermediate, intermediateKey)
+	noAIA, _ := createTestCert(t, "no-aia", false, "", intermediate, intermediateKey)
+	docs["/intermediate.der"] = intermediate.Raw
+	docs["/root.der"] = root.Raw
+
+	roots := NewPEMCertPool()
+	roots.AddCert(root)
+	// The test server is on loopback, which the default client refuses to connect to.
+	f := newAIAFetcher("test", newAIAClient(func(net.IP) bool { return true }), time.Second, util.SystemTimeSource{})
+
+	var tests = []struct {
+		chain   [][]byte
+		wantLen int
+	}{
+		{chain: [][]byte{leaf.Raw}, wantLen: 2},
+		{chain: [][]byte{leaf.Raw}, wantLen: 2},
+		{chain: [][]byte{orphan.Raw}},
+		{chain: [][]byte{orphan.Raw}},
+		{chain: [][]byte{noAIA.Raw}},
+	}
+
+	for i, test := range tests {
+		path, err := f.completeChain(context.Background(), test.chain, *roots, DefaultMaxChainLength)
+		if test.wantLen == 0 {
+			if err == nil {
+				t.Errorf("%d: completeChain()=%d certs, want error", i, len(path))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: completeChain()=_,%v, want no error", i, err)
+			continue
+		}
+		if got := len(path); got != test.wantLen {
+			t.Errorf("%d: completeChain()=%d certs, want %d", i, got, test.wantLen)
+		}
+	}
+
+	// Successes and failures are both cached, so each URL is only fetched once.
+	mu.Lock()
+	defer mu.Unlock()
+	for _, u := range []string{"/intermediate.der", "/missing.der"} {
+		if got, want := requests[u], 1; got != want {
+			t.Errorf("%s fetched %d times, want %d", u, got, want)
+		}
+	}
+	if got, want := f.exp.cacheHits.String(), "2"; got != want {
+		t.Errorf("cache-hits=%s, want %s", got, want)
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	var tests = []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "8.8.8.8", want: true},
+		{ip: "2001:4860:4860::8888", want: true},
+		{ip: "127.0.0.1"},
+		{ip: "::1"},
+		{ip: "169.254.169.254"},
+		{ip: "fe80::1"},
+		{ip: "10.1.2.3"},
+		{ip: "172.16.0.1"},
+		{ip: "192.168.1.1"},
+		{ip: "100.64.0.1"},
+		{ip: "fd00::1"},
+		{ip: "0.0.0.0"},
+		{ip: "::"},
+		{ip: "224.0.0.1"},
+		{ip: "::ffff:127.0.0.1"},
+		{ip: "::ffff:10.0.0.1"},
+	}
+	for _, test := range tests {
+		if got := isPublicIP(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("isPublicIP(%s)=%v, want %v", test.ip, got, test.want)
+		}
+	}
+}
+
+func TestAIAFetcherRejectsNonPublicAddresses(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to get test server port: %v", err)
+	}
+
+	f := newAIAFetcher("test", nil, time.Second, util.SystemTimeSource{})
+	for _, u := range []string{
+		server.URL + "/issuer.der",
+		"http://localhost:" + port + "/issuer.der",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.1/issuer.der",
+		"http://[::1]:" + port + "/issuer.der",
+	} {
+		if cert, err := f.download(context.Background(), u); err == nil {
+			t.Errorf("download(%s)=%v, want error", u, cert)
+		}
+	}
+	mu.Lock()
+	if requests != 0 {
+		t.Errorf("test server got %d requests, want none", requests)
+	}
+	mu.Unlock()
+
+	// Redirects are checked too: allow the test server on loopback, but not where it
+	// redirects to.
+	f = newAIAFetcher("test", newAIAClient(func(ip net.IP) bool { return ip.IsLoopback() || isPublicIP(ip) }), time.Second, util.SystemTimeSource{})
+	if cert, err := f.download(context.Background(), server.URL+"/issuer.der"); err == nil {
+		t.Errorf("download(redirect)=%v, want error", cert)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := requests, 1; got != want {
+		t.Errorf("test server got %d requests, want %d", got, want)
+	}
+}
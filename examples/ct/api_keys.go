@@ -0,0 +1,199 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+// APIKeyHeader is the HTTP header submitters send their API key in.
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyEntrypoints are the submission endpoints that API keys and their quotas apply to.
+var apiKeyEntrypoints = map[string]bool{"AddChain": true, "AddPreChain": true, "V2SubmitEntry": true}
+
+// APIKeyConfig describes a submitter's API key and its quota.
+type APIKeyConfig struct {
+	// Name identifies the key's holder, e.g. a CA, in the log's statistics and access log.
+	Name string
+	// KeyHash is the hex encoded SHA-256 hash of the key, so the config doesn't need to
+	// hold the keys themselves.
+	KeyHash string
+	// ClientCertName, if set, charges submissions from the client with this identity,
+	// authenticated by a TLS client certificate (see LogConfig.ClientCAFile), to the
+	// key's quota when they don't send a key. Either it or KeyHash must be set.
+	ClientCertName string
+	// SubmissionsPerSecond limits the rate of submissions made with the key, which can
+	// make SubmissionBurst (default one second's worth, and at least one) at once after
+	// being idle. Zero means no limit.
+	SubmissionsPerSecond float64
+	SubmissionBurst      int
+}
+
+// apiKey is a submitter's key, with the token bucket for its quota.
+type apiKey struct {
+	name    string
+	limiter *rateLimiter // nil if unlimited
+	// retryAfter is how long it takes to earn another submission.
+	retryAfter time.Duration
+
+	submissions *expvar.Int
+	rateLimited *expvar.Int
+}
+
+// apiKeys checks the API keys sent with submissions to a log, and applies their quotas.
+type apiKeys struct {
+	keys      map[string]*apiKey // hex SHA-256 hash => key
+	certNames map[string]*apiKey // client certificate identity => key
+	required  bool
+
+	exp struct {
+		vars      *expvar.Map
+		keys      *expvar.Map // name => expvar.Map of the key's stats (as "keys")
+		unknown   *expvar.Int // as "unknown-keys"
+		missing   *expvar.Int // as "missing-keys"
+		anonymous *expvar.Int // as "anonymous-submissions"
+	}
+}
+
+// newAPIKeys sets up the keys in cfgs. If required is set, submissions without a key are
+// rejected; otherwise they're accepted without a quota.
+func newAPIKeys(cfgs []APIKeyConfig, required bool, timeSource util.TimeSource) (*apiKeys, error) {
+	if len(cfgs) == 0 {
+		return nil, errors.New("no API keys")
+	}
+	a := &apiKeys{keys: make(map[string]*apiKey), certNames: make(map[string]*apiKey), required: required}
+	a.exp.vars = new(expvar.Map).Init()
+	a.exp.keys = new(expvar.Map).Init()
+	a.exp.vars.Set("keys", a.exp.keys)
+	a.exp.unknown = new(expvar.Int)
+	a.exp.vars.Set("unknown-keys", a.exp.unknown)
+	a.exp.missing = new(expvar.Int)
+	a.exp.vars.Set("missing-keys", a.exp.missing)
+	a.exp.anonymous = new(expvar.Int)
+	a.exp.vars.Set("anonymous-submissions", a.exp.anonymous)
+
+	names := make(map[string]bool)
+	for _, cfg := range cfgs {
+		if len(cfg.Name) == 0 {
+			return nil, errors.New("API key has no Name")
+		}
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("API key name %s used twice", cfg.Name)
+		}
+		names[cfg.Name] = true
+		if len(cfg.KeyHash) == 0 && len(cfg.ClientCertName) == 0 {
+			return nil, fmt.Errorf("API key %s: needs KeyHash or ClientCertName", cfg.Name)
+		}
+		var keyHash string
+		if len(cfg.KeyHash) > 0 {
+			hash, err := hex.DecodeString(cfg.KeyHash)
+			if err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("API key %s: KeyHash must be a hex SHA-256 hash", cfg.Name)
+			}
+			keyHash = hex.EncodeToString(hash)
+			if _, ok := a.keys[keyHash]; ok {
+				return nil, fmt.Errorf("API key %s: KeyHash used twice", cfg.Name)
+			}
+		}
+		if _, ok := a.certNames[cfg.ClientCertName]; ok && len(cfg.ClientCertName) > 0 {
+			return nil, fmt.Errorf("API key %s: ClientCertName used twice", cfg.Name)
+		}
+		if cfg.SubmissionsPerSecond < 0 || cfg.SubmissionBurst < 0 {
+			return nil, fmt.Errorf("API key %s: quota must not be negative", cfg.Name)
+		}
+		if cfg.SubmissionBurst > 0 && cfg.SubmissionsPerSecond == 0 {
+			return nil, fmt.Errorf("API key %s: SubmissionBurst needs SubmissionsPerSecond", cfg.Name)
+		}
+
+		k := &apiKey{name: cfg.Name, submissions: new(expvar.Int), rateLimited: new(expvar.Int)}
+		if cfg.SubmissionsPerSecond > 0 {
+			burst := float64(cfg.SubmissionBurst)
+			if burst == 0 {
+				burst = cfg.SubmissionsPerSecond
+			}
+			if burst < 1 {
+				burst = 1
+			}
+			k.limiter = newRateLimiter(cfg.SubmissionsPerSecond, burst, timeSource)
+			k.retryAfter = time.Duration(float64(time.Second) / cfg.SubmissionsPerSecond)
+		}
+		stats := new(expvar.Map).Init()
+		stats.Set("submissions", k.submissions)
+		stats.Set("rate-limited", k.rateLimited)
+		a.exp.keys.Set(cfg.Name, stats)
+		if len(keyHash) > 0 {
+			a.keys[keyHash] = k
+		}
+		if len(cfg.ClientCertName) > 0 {
+			a.certNames[cfg.ClientCertName] = k
+		}
+	}
+	return a, nil
+}
+
+// Vars returns the statistics exported by this apiKeys: the submissions made and rate
+// limited for each key, and the number of submissions with unknown or missing keys.
+func (a *apiKeys) Vars() *expvar.Map {
+	return a.exp.vars
+}
+
+// lookup returns the key sent with r, or the one for the client's certificate identity
+// clientCert if it didn't send one. It returns nil if neither has a key and that's
+// allowed.
+func (a *apiKeys) lookup(r *http.Request, clientCert string) (*apiKey, int, error) {
+	key := strings.TrimSpace(r.Header.Get(APIKeyHeader))
+	if len(key) == 0 {
+		if k, ok := a.certNames[clientCert]; ok && len(clientCert) > 0 {
+			return k, http.StatusOK, nil
+		}
+		if a.required {
+			a.exp.missing.Add(1)
+			return nil, http.StatusUnauthorized, fmt.Errorf("submissions need an API key in the %s header", APIKeyHeader)
+		}
+		a.exp.anonymous.Add(1)
+		return nil, http.StatusOK, nil
+	}
+	hash := sha256.Sum256([]byte(key))
+	k, ok := a.keys[hex.EncodeToString(hash[:])]
+	if !ok {
+		a.exp.unknown.Add(1)
+		return nil, http.StatusUnauthorized, errors.New("unknown API key")
+	}
+	return k, http.StatusOK, nil
+}
+
+// apiKeyMiddleware identifies submitters by their API key, or their client certificate
+// if the log has a key for it, and rejects submissions that are over their key's quota.
+// It comes after clientCertMiddleware in the chain.
+func apiKeyMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		if c.apiKeys == nil || !apiKeyEntrypoints[ep.Name] {
+			return next(ctx, c, w, r)
+		}
+		k, status, err := c.apiKeys.lookup(r, requestStateFrom(ctx).rec.ClientCert)
+		if err != nil {
+			return status, err
+		}
+		if k == nil {
+			return next(ctx, c, w, r)
+		}
+		requestStateFrom(ctx).rec.APIKey = k.name
+		if k.limiter != nil && !k.limiter.allow("") {
+			k.rateLimited.Add(1)
+			w.Header().Set(retryAfterHeader, strconv.FormatInt(int64((k.retryAfter+time.Second-1)/time.Second), 10))
+			return http.StatusTooManyRequests, fmt.Errorf("API key %s is over its submission quota, try again later", k.name)
+		}
+		k.submissions.Add(1)
+		return next(ctx, c, w, r)
+	}
+}
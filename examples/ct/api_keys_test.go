@@ -0,0 +1,127 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+func apiKeyHash(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestNewAPIKeysErrors(t *testing.T) {
+	var tests = []struct {
+		descr  string
+		cfgs   []APIKeyConfig
+		errStr string
+	}{
+		{descr: "none", errStr: "no API keys"},
+		{descr: "no-name", cfgs: []APIKeyConfig{{KeyHash: apiKeyHash("a")}}, errStr: "no Name"},
+		{descr: "no-key", cfgs: []APIKeyConfig{{Name: "ca"}}, errStr: "needs KeyHash or ClientCertName"},
+		{descr: "dup-cert-name", cfgs: []APIKeyConfig{{Name: "ca1", ClientCertName: "ca"}, {Name: "ca2", ClientCertName: "ca"}}, errStr: "used twice"},
+		{descr: "bad-hash", cfgs: []APIKeyConfig{{Name: "ca", KeyHash: "abcd"}}, errStr: "SHA-256"},
+		{descr: "dup-name", cfgs: []APIKeyConfig{{Name: "ca", KeyHash: apiKeyHash("a")}, {Name: "ca", KeyHash: apiKeyHash("b")}}, errStr: "used twice"},
+		{descr: "dup-hash", cfgs: []APIKeyConfig{{Name: "ca1", KeyHash: apiKeyHash("a")}, {Name: "ca2", KeyHash: strings.ToUpper(apiKeyHash("a"))}}, errStr: "used twice"},
+		{descr: "negative", cfgs: []APIKeyConfig{{Name: "ca", KeyHash: apiKeyHash("a"), SubmissionsPerSecond: -1}}, errStr: "negative"},
+		{descr: "burst-no-rate", cfgs: []APIKeyConfig{{Name: "ca", KeyHash: apiKeyHash("a"), SubmissionBurst: 5}}, errStr: "needs SubmissionsPerSecond"},
+	}
+
+	for _, test := range tests {
+		if _, err := newAPIKeys(test.cfgs, false, fakeTimeSource); err == nil || !strings.Contains(err.Error(), test.errStr) {
+			t.Errorf("%s: newAPIKeys()=_,%v, want error containing %q", test.descr, err, test.errStr)
+		}
+	}
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	timeSource := &util.FakeTimeSource{FakeTime: fakeTime}
+	cfgs := []APIKeyConfig{
+		{Name: "big-ca", KeyHash: apiKeyHash("big-secret")},
+		{Name: "small-ca", KeyHash: apiKeyHash("small-secret"), SubmissionsPerSecond: 0.5, SubmissionBurst: 2},
+	}
+
+	var tests = []struct {
+		descr     string
+		required  bool
+		name      string // endpoint
+		key       string
+		advance   time.Duration
+		want      int
+		wantKey   string // in the access log
+		wantRetry string
+	}{
+		{descr: "unlimited", name: "AddChain", key: "big-secret", want: http.StatusOK, wantKey: "big-ca"},
+		{descr: "anonymous", name: "AddChain", want: http.StatusOK},
+		{descr: "unknown", name: "AddChain", key: "guess", want: http.StatusUnauthorized},
+		{descr: "quota-1", name: "AddPreChain", key: "small-secret", want: http.StatusOK, wantKey: "small-ca"},
+		{descr: "quota-2", name: "AddChain", key: " small-secret ", want: http.StatusOK, wantKey: "small-ca"},
+		{descr: "over-quota", name: "AddChain", key: "small-secret", want: http.StatusTooManyRequests, wantKey: "small-ca", wantRetry: "2"},
+		{descr: "not-submission", name: "GetSTH", key: "small-secret", want: http.StatusOK},
+		{descr: "refilled", name: "AddChain", key: "small-secret", advance: 2 * time.Second, want: http.StatusOK, wantKey: "small-ca"},
+		{descr: "required", required: true, name: "AddChain", want: http.StatusUnauthorized},
+		{descr: "required-not-submission", required: true, name: "GetSTH", want: http.StatusOK},
+	}
+
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	keys, err := newAPIKeys(cfgs, false, timeSource)
+	if err != nil {
+		t.Fatalf("newAPIKeys()=_,%v, want no error", err)
+	}
+	info.c.apiKeys = keys
+	sink := &recordingAccessLog{}
+	info.c.accessLog = sink
+
+	for _, test := range tests {
+		timeSource.FakeTime = timeSource.FakeTime.Add(test.advance)
+		keys.required = test.required
+		sink.recs = nil
+		handler := appHandler{context: info.c, name: test.name, method: http.MethodPost,
+			handler: func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+				return http.StatusOK, nil
+			}}
+		req, err := http.NewRequest(http.MethodPost, "http://example.com/ct/v1/add-chain", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if len(test.key) > 0 {
+			req.Header.Set(APIKeyHeader, test.key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if got := w.Code; got != test.want {
+			t.Errorf("%s: ServeHTTP()=%d (body:%v), want %d", test.descr, got, w.Body, test.want)
+		}
+		if got := w.Header().Get(retryAfterHeader); got != test.wantRetry {
+			t.Errorf("%s: Retry-After=%q, want %q", test.descr, got, test.wantRetry)
+		}
+		if len(sink.recs) != 1 || sink.recs[0].APIKey != test.wantKey {
+			t.Errorf("%s: logged %+v, want API key %q", test.descr, sink.recs, test.wantKey)
+		}
+	}
+
+	for _, want := range []struct {
+		name, value string
+	}{
+		{"unknown-keys", "1"},
+		{"missing-keys", "1"},
+		{"anonymous-submissions", "1"},
+	} {
+		if got := keys.Vars().Get(want.name).String(); got != want.value {
+			t.Errorf("%s=%s, want %s", want.name, got, want.value)
+		}
+	}
+	if got, want := keys.Vars().Get("keys").String(), `"small-ca": {"rate-limited": 1, "submissions": 3}`; !strings.Contains(got, want) {
+		t.Errorf("keys=%s, want to find %s", got, want)
+	}
+}
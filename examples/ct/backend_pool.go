@@ -0,0 +1,329 @@
+package ct
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Backend is one of the log RPC servers that a BackendPool sends requests to.
+type Backend struct {
+	// Name identifies the backend in logs and stats, e.g. its address.
+	Name   string
+	Client trillian.TrillianLogClient
+	// ConnErr reports a problem with the connection to the backend, if there is one.
+	// Can be nil.
+	ConnErr func() error
+}
+
+type poolBackend struct {
+	Backend
+
+	mu sync.Mutex
+	// downUntil is when a backend whose RPCs failed as unavailable is next tried.
+	downUntil time.Time
+
+	requests *expvar.Int
+	failures *expvar.Int
+}
+
+// BackendPool is a TrillianLogClient that spreads requests over several backends. Read
+// RPCs are load balanced over the healthy backends, while QueueLeaves goes to the first
+// healthy one so that submissions aren't spread needlessly. An RPC that fails because its
+// backend is unavailable is retried on the next one, and that backend is skipped for a
+// while. Backends that are down are only used when no healthy one is left.
+type BackendPool struct {
+	routedLogClient
+
+	backends   []*poolBackend
+	timeSource util.TimeSource
+	retryAfter time.Duration
+	next       uint32
+
+	vars      *expvar.Map
+	failovers *expvar.Int
+}
+
+// NewBackendPool creates a BackendPool over backends. A backend whose RPCs fail as
+// unavailable isn't used again until retryAfter has passed.
+func NewBackendPool(backends []Backend, timeSource util.TimeSource, retryAfter time.Duration) (*BackendPool, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("no backends")
+	}
+	p := &BackendPool{timeSource: timeSource, retryAfter: retryAfter, vars: new(expvar.Map).Init(), failovers: new(expvar.Int)}
+	p.routedLogClient = routedLogClient{route: p.call}
+	p.vars.Set("failovers", p.failovers)
+	for _, b := range backends {
+		pb := &poolBackend{Backend: b, requests: new(expvar.Int), failures: new(expvar.Int)}
+		stats := new(expvar.Map).Init()
+		stats.Set("requests", pb.requests)
+		stats.Set("failures", pb.failures)
+		p.vars.Set(b.Name, stats)
+		p.backends = append(p.backends, pb)
+	}
+	return p, nil
+}
+
+// Vars returns the stats of the pool: the number of RPCs retried on another backend, and
+// the number of requests and unavailable failures of each backend.
+func (p *BackendPool) Vars() *expvar.Map {
+	return p.vars
+}
+
+// Err returns an error if none of the backends is healthy, for use as a HealthChecker's
+// connection check.
+func (p *BackendPool) Err() error {
+	now := p.timeSource.Now()
+	var errs []string
+	for _, b := range p.backends {
+		err := b.healthErr(now)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", b.Name, err))
+	}
+	return fmt.Errorf("no healthy backend: %s", strings.Join(errs, "; "))
+}
+
+func (b *poolBackend) healthErr(now time.Time) error {
+	if b.ConnErr != nil {
+		if err := b.ConnErr(); err != nil {
+			return err
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.Before(b.downUntil) {
+		return fmt.Errorf("unavailable until %v", b.downUntil)
+	}
+	return nil
+}
+
+func (b *poolBackend) markDown(until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.downUntil = until
+}
+
+// order returns the backends in the order an RPC should try them: the healthy ones
+// first, starting from the next in turn for reads and from the first for writes.
+func (p *BackendPool) order(read bool) []*poolBackend {
+	start := 0
+	if read {
+		start = int(atomic.AddUint32(&p.next, 1) % uint32(len(p.backends)))
+	}
+	now := p.timeSource.Now()
+	healthy := make([]*poolBackend, 0, len(p.backends))
+	var down []*poolBackend
+	for i := range p.backends {
+		b := p.backends[(start+i)%len(p.backends)]
+		if b.healthErr(now) == nil {
+			healthy = append(healthy, b)
+		} else {
+			down = append(down, b)
+		}
+	}
+	return append(healthy, down...)
+}
+
+// call makes an RPC with rpc, trying each backend in turn until one doesn't fail as
+// unavailable or the context is done.
+func (p *BackendPool) call(ctx context.Context, method string, read bool, rpc func(trillian.TrillianLogClient) error) error {
+	var err error
+	for i, b := range p.order(read) {
+		if i > 0 {
+			p.failovers.Add(1)
+		}
+		b.requests.Add(1)
+		if err = rpc(b.Client); status.Code(err) != codes.Unavailable || ctx.Err() != nil {
+			return err
+		}
+		b.failures.Add(1)
+		b.markDown(p.timeSource.Now().Add(p.retryAfter))
+		glog.Warningf("%s: backend %s unavailable, failing over: %v", method, b.Name, err)
+	}
+	return err
+}
+
+// routeFunc makes an RPC by calling rpc with the client of one or more backends. read is
+// false for RPCs that change the log.
+type routeFunc func(ctx context.Context, method string, read bool, rpc func(trillian.TrillianLogClient) error) error
+
+// routedLogClient implements TrillianLogClient by passing each RPC to route, which picks
+// the clients it's made with.
+type routedLogClient struct {
+	route routeFunc
+}
+
+// QueueLeaves implements TrillianLogClient.
+func (r routedLogClient) QueueLeaves(ctx context.Context, in *trillian.QueueLeavesRequest, opts ...grpc.CallOption) (*trillian.QueueLeavesResponse, error) {
+	var rsp *trillian.QueueLeavesResponse
+	err := r.route(ctx, "QueueLeaves", false, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.QueueLeaves(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetInclusionProof implements TrillianLogClient.
+func (r routedLogClient) GetInclusionProof(ctx context.Context, in *trillian.GetInclusionProofRequest, opts ...grpc.CallOption) (*trillian.GetInclusionProofResponse, error) {
+	var rsp *trillian.GetInclusionProofResponse
+	err := r.route(ctx, "GetInclusionProof", true, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetInclusionProof(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetInclusionProofByHash implements TrillianLogClient.
+func (r routedLogClient) GetInclusionProofByHash(ctx context.Context, in *trillian.GetInclusionProofByHashRequest, opts ...grpc.CallOption) (*trillian.GetInclusionProofByHashResponse, error) {
+	var rsp *trillian.GetInclusionProofByHashResponse
+	err := r.route(ctx, "GetInclusionProofByHash", true, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetInclusionProofByHash(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetConsistencyProof implements TrillianLogClient.
+func (r routedLogClient) GetConsistencyProof(ctx context.Context, in *trillian.GetConsistencyProofRequest, opts ...grpc.CallOption) (*trillian.GetConsistencyProofResponse, error) {
+	var rsp *trillian.GetConsistencyProofResponse
+	err := r.route(ctx, "GetConsistencyProof", true, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetConsistencyProof(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetLatestSignedLogRoot implements TrillianLogClient.
+func (r routedLogClient) GetLatestSignedLogRoot(ctx context.Context, in *trillian.GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*trillian.GetLatestSignedLogRootResponse, error) {
+	var rsp *trillian.GetLatestSignedLogRootResponse
+	err := r.route(ctx, "GetLatestSignedLogRoot", true, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetLatestSignedLogRoot(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetTreeHeadByTimestamp implements TrillianLogClient.
+func (r routedLogClient) GetTreeHeadByTimestamp(ctx context.Context, in *trillian.GetTreeHeadByTimestampRequest, opts ...grpc.CallOption) (*trillian.GetTreeHeadByTimestampResponse, error) {
+	var rsp *trillian.GetTreeHeadByTimestampResponse
+	err := r.route(ctx, "GetTreeHeadByTimestamp", true, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetTreeHeadByTimestamp(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetTreeHeadBySize implements TrillianLogClient.
+func (r routedLogClient) GetTreeHeadBySize(ctx context.Context, in *trillian.GetTreeHeadBySizeRequest, opts ...grpc.CallOption) (*trillian.GetTreeHeadBySizeResponse, error) {
+	var rsp *trillian.GetTreeHeadBySizeResponse
+	err := r.route(ctx, "GetTreeHeadBySize", true, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetTreeHeadBySize(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetSequencedLeafCount implements TrillianLogClient.
+func (r routedLogClient) GetSequencedLeafCount(ctx context.Context, in *trillian.GetSequencedLeafCountRequest, opts ...grpc.CallOption) (*trillian.GetSequencedLeafCountResponse, error) {
+	var rsp *trillian.GetSequencedLeafCountResponse
+	err := r.route(ctx, "GetSequencedLeafCount", true, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetSequencedLeafCount(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetLeavesByIndex implements TrillianLogClient.
+func (r routedLogClient) GetLeavesByIndex(ctx context.Context, in *trillian.GetLeavesByIndexRequest, opts ...grpc.CallOption) (*trillian.GetLeavesByIndexResponse, error) {
+	var rsp *trillian.GetLeavesByIndexResponse
+	err := r.route(ctx, "GetLeavesByIndex", true, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetLeavesByIndex(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetLeavesByHash implements TrillianLogClient.
+func (r routedLogClient) GetLeavesByHash(ctx context.Context, in *trillian.GetLeavesByHashRequest, opts ...grpc.CallOption) (*trillian.GetLeavesByHashResponse, error) {
+	var rsp *trillian.GetLeavesByHashResponse
+	err := r.route(ctx, "GetLeavesByHash", true, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetLeavesByHash(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetLeavesByLeafValueHash implements TrillianLogClient.
+func (r routedLogClient) GetLeavesByLeafValueHash(ctx context.Context, in *trillian.GetLeavesByHashRequest, opts ...grpc.CallOption) (*trillian.GetLeavesByHashResponse, error) {
+	var rsp *trillian.GetLeavesByHashResponse
+	err := r.route(ctx, "GetLeavesByLeafValueHash", true, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetLeavesByLeafValueHash(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// GetEntryAndProof implements TrillianLogClient.
+func (r routedLogClient) GetEntryAndProof(ctx context.Context, in *trillian.GetEntryAndProofRequest, opts ...grpc.CallOption) (*trillian.GetEntryAndProofResponse, error) {
+	var rsp *trillian.GetEntryAndProofResponse
+	err := r.route(ctx, "GetEntryAndProof", true, func(c trillian.TrillianLogClient) (err error) {
+		rsp, err = c.GetEntryAndProof(ctx, in, opts...)
+		return err
+	})
+	return rsp, err
+}
+
+// SRVLookupFunc resolves a DNS SRV name, as net.LookupSRV does when service and proto
+// are empty.
+type SRVLookupFunc func(service, proto, name string) (string, []*net.SRV, error)
+
+// ResolveBackendAddrs turns a comma separated list of backends into their addresses.
+// Each entry is either a host:port address, or a DNS SRV name such as
+// _trillian._tcp.example.com (recognized by its leading underscore), which is resolved
+// with lookupSRV to the host:port of each of its targets, in priority order.
+func ResolveBackendAddrs(s string, lookupSRV SRVLookupFunc) ([]string, error) {
+	var addrs []string
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case len(entry) == 0:
+			continue
+		case strings.HasPrefix(entry, "_"):
+			_, srvs, err := lookupSRV("", "", entry)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s: %v", entry, err)
+			}
+			if len(srvs) == 0 {
+				return nil, fmt.Errorf("no SRV records for %s", entry)
+			}
+			for _, srv := range srvs {
+				addrs = append(addrs, net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))))
+			}
+		default:
+			if _, _, err := net.SplitHostPort(entry); err != nil {
+				return nil, fmt.Errorf("invalid backend address %q: %v", entry, err)
+			}
+			addrs = append(addrs, entry)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no backends given")
+	}
+	return addrs, nil
+}
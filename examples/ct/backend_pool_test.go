@@ -0,0 +1,195 @@
+package ct
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/mockclient"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errUnavailable = status.Error(codes.Unavailable, "connection refused")
+
+func newTestPool(t *testing.T, ctrl *gomock.Controller, timeSource util.TimeSource, n int) (*BackendPool, []*mockclient.MockTrillianLogClient) {
+	var backends []Backend
+	var clients []*mockclient.MockTrillianLogClient
+	for i := 0; i < n; i++ {
+		client := mockclient.NewMockTrillianLogClient(ctrl)
+		clients = append(clients, client)
+		backends = append(backends, Backend{Name: string('a' + rune(i)), Client: client})
+	}
+	p, err := NewBackendPool(backends, timeSource, time.Minute)
+	if err != nil {
+		t.Fatalf("NewBackendPool()=_,%v, want no error", err)
+	}
+	return p, clients
+}
+
+func TestBackendPoolLoadBalancesReads(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p, clients := newTestPool(t, ctrl, fakeTimeSource, 3)
+
+	req := &trillian.GetLatestSignedLogRootRequest{LogId: 1}
+	rsp := &trillian.GetLatestSignedLogRootResponse{}
+	for _, client := range clients {
+		client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Times(2).Return(rsp, nil)
+	}
+	for i := 0; i < 6; i++ {
+		if got, err := p.GetLatestSignedLogRoot(context.Background(), req); err != nil || got != rsp {
+			t.Errorf("GetLatestSignedLogRoot()=%v,%v, want %v,nil", got, err, rsp)
+		}
+	}
+}
+
+func TestBackendPoolWritesToFirst(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p, clients := newTestPool(t, ctrl, fakeTimeSource, 2)
+
+	req := &trillian.QueueLeavesRequest{LogId: 1}
+	clients[0].EXPECT().QueueLeaves(gomock.Any(), req).Times(3).Return(&trillian.QueueLeavesResponse{}, nil)
+	for i := 0; i < 3; i++ {
+		if _, err := p.QueueLeaves(context.Background(), req); err != nil {
+			t.Errorf("QueueLeaves()=_,%v, want no error", err)
+		}
+	}
+}
+
+func TestBackendPoolFailover(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	timeSource := &util.FakeTimeSource{FakeTime: fakeTime}
+	p, clients := newTestPool(t, ctrl, timeSource, 2)
+	req := &trillian.QueueLeavesRequest{LogId: 1}
+	rsp := &trillian.QueueLeavesResponse{}
+
+	// The first backend is unavailable, so the RPC goes to the second.
+	gomock.InOrder(
+		clients[0].EXPECT().QueueLeaves(gomock.Any(), req).Return(nil, errUnavailable),
+		clients[1].EXPECT().QueueLeaves(gomock.Any(), req).Return(rsp, nil),
+	)
+	if got, err := p.QueueLeaves(context.Background(), req); err != nil || got != rsp {
+		t.Fatalf("QueueLeaves()=%v,%v, want %v,nil", got, err, rsp)
+	}
+	if got, want := p.Vars().Get("failovers").String(), "1"; got != want {
+		t.Errorf("failovers=%s, want %s", got, want)
+	}
+
+	// The first backend is skipped while it's down.
+	clients[1].EXPECT().QueueLeaves(gomock.Any(), req).Return(rsp, nil)
+	if _, err := p.QueueLeaves(context.Background(), req); err != nil {
+		t.Fatalf("QueueLeaves()=_,%v, want no error", err)
+	}
+
+	// Other errors are returned without trying another backend.
+	otherErr := status.Error(codes.InvalidArgument, "bad request")
+	clients[1].EXPECT().QueueLeaves(gomock.Any(), req).Return(nil, otherErr)
+	if _, err := p.QueueLeaves(context.Background(), req); err != otherErr {
+		t.Errorf("QueueLeaves()=_,%v, want %v", err, otherErr)
+	}
+
+	// Once it's been down for long enough the first backend is used again.
+	timeSource.FakeTime = timeSource.FakeTime.Add(time.Minute)
+	clients[0].EXPECT().QueueLeaves(gomock.Any(), req).Return(rsp, nil)
+	if _, err := p.QueueLeaves(context.Background(), req); err != nil {
+		t.Errorf("QueueLeaves()=_,%v, want no error", err)
+	}
+}
+
+func TestBackendPoolAllDown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	timeSource := &util.FakeTimeSource{FakeTime: fakeTime}
+	p, clients := newTestPool(t, ctrl, timeSource, 2)
+	req := &trillian.GetLeavesByIndexRequest{LogId: 1}
+
+	for _, client := range clients {
+		client.EXPECT().GetLeavesByIndex(gomock.Any(), req).Return(nil, errUnavailable)
+	}
+	if _, err := p.GetLeavesByIndex(context.Background(), req); status.Code(err) != codes.Unavailable {
+		t.Fatalf("GetLeavesByIndex()=_,%v, want Unavailable", err)
+	}
+	if err := p.Err(); err == nil {
+		t.Errorf("Err()=nil, want error with every backend down")
+	}
+
+	// Backends that are down are still tried when there's nothing better.
+	rsp := &trillian.GetLeavesByIndexResponse{}
+	gomock.InOrder(
+		clients[0].EXPECT().GetLeavesByIndex(gomock.Any(), req).Return(nil, errUnavailable),
+		clients[1].EXPECT().GetLeavesByIndex(gomock.Any(), req).Return(rsp, nil),
+	)
+	if got, err := p.GetLeavesByIndex(context.Background(), req); err != nil || got != rsp {
+		t.Errorf("GetLeavesByIndex()=%v,%v, want %v,nil", got, err, rsp)
+	}
+}
+
+func TestBackendPoolConnErr(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	up := mockclient.NewMockTrillianLogClient(ctrl)
+	down := mockclient.NewMockTrillianLogClient(ctrl)
+	p, err := NewBackendPool([]Backend{
+		{Name: "down", Client: down, ConnErr: func() error { return errors.New("transient failure") }},
+		{Name: "up", Client: up},
+	}, fakeTimeSource, time.Minute)
+	if err != nil {
+		t.Fatalf("NewBackendPool()=_,%v, want no error", err)
+	}
+
+	req := &trillian.QueueLeavesRequest{LogId: 1}
+	up.EXPECT().QueueLeaves(gomock.Any(), req).Return(&trillian.QueueLeavesResponse{}, nil)
+	if _, err := p.QueueLeaves(context.Background(), req); err != nil {
+		t.Errorf("QueueLeaves()=_,%v, want no error", err)
+	}
+	if err := p.Err(); err != nil {
+		t.Errorf("Err()=%v, want nil with one backend up", err)
+	}
+}
+
+func TestResolveBackendAddrs(t *testing.T) {
+	lookupSRV := func(service, proto, name string) (string, []*net.SRV, error) {
+		switch name {
+		case "_trillian._tcp.example.com":
+			return "", []*net.SRV{{Target: "log1.example.com.", Port: 8090}, {Target: "log2.example.com.", Port: 8091}}, nil
+		case "_empty._tcp.example.com":
+			return "", nil, nil
+		}
+		return "", nil, errors.New("no such host")
+	}
+
+	var tests = []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "localhost:8090", want: []string{"localhost:8090"}},
+		{in: "log1:8090, log2:8090", want: []string{"log1:8090", "log2:8090"}},
+		{in: "_trillian._tcp.example.com", want: []string{"log1.example.com:8090", "log2.example.com:8091"}},
+		{in: "log0:1,_trillian._tcp.example.com", want: []string{"log0:1", "log1.example.com:8090", "log2.example.com:8091"}},
+		{in: "_missing._tcp.example.com", wantErr: true},
+		{in: "_empty._tcp.example.com", wantErr: true},
+		{in: "localhost", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ResolveBackendAddrs(test.in, lookupSRV)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ResolveBackendAddrs(%q)=_,%v, want error: %v", test.in, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ResolveBackendAddrs(%q)=%v, want %v", test.in, got, test.want)
+		}
+	}
+}
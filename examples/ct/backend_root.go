@@ -0,0 +1,136 @@
+package ct
+
+import (
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/client"
+	"golang.org/x/net/context"
+)
+
+// How often the backend's root is checked and saved if the config doesn't say
+const defaultBackendRootInterval = time.Minute
+
+// backendRootTracker keeps the latest root of a log's backend that it has verified in a
+// file, so that when the log is restarted it can check the backend hasn't regressed, e.g.
+// by being restored from an old backup, or forked, and so refuse to serve tree heads
+// that contradict those it served before.
+type backendRootTracker struct {
+	prefix   string
+	path     string
+	client   *client.LogClient
+	deadline time.Duration
+	done     chan struct{}
+	// saved is the tree size of the root in the file, or -1 before it's first written.
+	saved int64
+
+	exp struct {
+		vars       *expvar.Map
+		treeSize   *expvar.Int
+		failures   *expvar.Int
+		mismatches *expvar.Int
+	}
+}
+
+// newBackendRootTracker checks that the latest root of the log c's backend is consistent
+// with the one saved at path, if there is one, and saves it there. If the backend has
+// regressed or forked it returns an error, unless allowMismatch is set, when it only
+// logs the mismatch and replaces the saved root.
+func newBackendRootTracker(ctx context.Context, c LogContext, path string, allowMismatch bool) (*backendRootTracker, error) {
+	t := &backendRootTracker{
+		prefix:   c.logPrefix,
+		path:     path,
+		client:   client.NewLogClient(c.logID, c.rpcClient, 1),
+		deadline: c.rpcDeadline,
+		done:     make(chan struct{}),
+		saved:    -1,
+	}
+	t.exp.vars = new(expvar.Map).Init()
+	t.exp.treeSize = new(expvar.Int)
+	t.exp.vars.Set("tree-size", t.exp.treeSize)
+	t.exp.failures = new(expvar.Int)
+	t.exp.vars.Set("check-failures", t.exp.failures)
+	t.exp.mismatches = new(expvar.Int)
+	t.exp.vars.Set("mismatches", t.exp.mismatches)
+
+	trusted, err := client.ReadRootFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backend root: %v", err)
+	}
+	root, err := t.client.CatchUp(ctx, trusted)
+	if mismatch, ok := err.(*client.BackendMismatchError); ok {
+		if !allowMismatch {
+			return nil, fmt.Errorf("backend doesn't match the root saved in %s: %v", path, mismatch)
+		}
+		glog.Warningf("%s: serving anyway, but backend doesn't match the root saved in %s: %v", t.prefix, path, mismatch)
+		t.exp.mismatches.Add(1)
+		t.client = client.NewLogClient(c.logID, c.rpcClient, 1)
+		root, err = t.client.UpdateRoot(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check backend root: %v", err)
+	}
+	if err := t.save(*root); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Start starts a goroutine that checks the backend's latest root every interval, and
+// saves it if it's consistent with the last one, until Stop is called.
+func (t *backendRootTracker) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-t.done:
+				return
+			case <-ticker.C:
+				if err := t.update(); err != nil {
+					t.exp.failures.Add(1)
+					glog.Warningf("%s: failed to check backend root: %v", t.prefix, err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops checking the backend's root.
+func (t *backendRootTracker) Stop() {
+	close(t.done)
+}
+
+// Vars returns the statistics exported by this backendRootTracker.
+func (t *backendRootTracker) Vars() *expvar.Map {
+	return t.exp.vars
+}
+
+// update fetches and verifies the latest root, and saves it. A root that isn't consistent
+// with the last one isn't saved, so the log won't restart until someone looks into it.
+func (t *backendRootTracker) update() error {
+	ctx, cancel := context.WithTimeout(context.Background(), t.deadline)
+	defer cancel()
+	root, err := t.client.UpdateRoot(ctx)
+	if err != nil {
+		return err
+	}
+	return t.save(*root)
+}
+
+// save writes root to the file, unless it's already there.
+func (t *backendRootTracker) save(root trillian.SignedLogRoot) error {
+	if root.TreeSize == t.saved {
+		return nil
+	}
+	if err := client.WriteRootFile(t.path, root); err != nil {
+		return fmt.Errorf("failed to save backend root: %v", err)
+	}
+	t.saved = root.TreeSize
+	t.exp.treeSize.Set(root.TreeSize)
+	return nil
+}
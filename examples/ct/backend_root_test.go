@@ -0,0 +1,145 @@
+package ct
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/client"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// fakeBackendTree serves the roots and consistency proofs of a tree of size leaves, whose
+// values are made from prefix.
+type fakeBackendTree struct {
+	trillian.TrillianLogClient
+	tree *merkle.InMemoryMerkleTree
+	size int64
+}
+
+func newFakeBackendTree(prefix string, leaves int) *fakeBackendTree {
+	f := &fakeBackendTree{tree: merkle.NewInMemoryMerkleTree(merkle.NewRFC6962TreeHasher(crypto.NewSHA256()))}
+	for i := 0; i < leaves; i++ {
+		f.tree.AddLeaf([]byte(fmt.Sprintf("%s %d", prefix, i)))
+	}
+	return f
+}
+
+func (f *fakeBackendTree) GetLatestSignedLogRoot(ctx context.Context, req *trillian.GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*trillian.GetLatestSignedLogRootResponse, error) {
+	return makeGetRootResponseForTest(12345000000, f.size, f.tree.RootAtSnapshot(int(f.size)).Hash()), nil
+}
+
+func (f *fakeBackendTree) GetConsistencyProof(ctx context.Context, req *trillian.GetConsistencyProofRequest, opts ...grpc.CallOption) (*trillian.GetConsistencyProofResponse, error) {
+	proof := &trillian.Proof{}
+	for _, node := range f.tree.SnapshotConsistency(int(req.FirstTreeSize), int(req.SecondTreeSize)) {
+		proof.ProofNode = append(proof.ProofNode, &trillian.Node{NodeHash: node.Value.Hash()})
+	}
+	return &trillian.GetConsistencyProofResponse{Status: okStatus, Proof: proof}, nil
+}
+
+func TestBackendRootTracker(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	dir, err := ioutil.TempDir("", "backend_root_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "root")
+	backend := newFakeBackendTree("leaf", 20)
+	forked := newFakeBackendTree("fork", 20)
+
+	var tests = []struct {
+		descr         string
+		backend       *fakeBackendTree
+		size          int64 // of the backend's tree at startup
+		allowMismatch bool
+		update        int64 // size the backend grows to after startup, if any
+		errStr        string
+		wantSaved     int64
+	}{
+		{descr: "no-saved-root", backend: backend, size: 5, update: 9, wantSaved: 9},
+		{descr: "restart", backend: backend, size: 12, wantSaved: 12},
+		{descr: "unchanged", backend: backend, size: 12, update: 12, wantSaved: 12},
+		{descr: "regressed", backend: backend, size: 7, errStr: "regressed", wantSaved: 12},
+		{descr: "forked", backend: forked, size: 15, errStr: "forked", wantSaved: 12},
+		{descr: "forked-same-size", backend: forked, size: 12, errStr: "forked", wantSaved: 12},
+		{descr: "allowed", backend: forked, size: 10, allowMismatch: true, wantSaved: 10},
+		{descr: "after-allowed", backend: forked, size: 11, wantSaved: 11},
+	}
+
+	for _, test := range tests {
+		test.backend.size = test.size
+		info.c.rpcClient = test.backend
+		tracker, err := newBackendRootTracker(context.Background(), info.c, path, test.allowMismatch)
+		if len(test.errStr) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.errStr) {
+				t.Errorf("%s: newBackendRootTracker()=_,%v, want error containing %q", test.descr, err, test.errStr)
+			}
+		} else if err != nil {
+			t.Errorf("%s: newBackendRootTracker()=_,%v, want no error", test.descr, err)
+		} else {
+			if test.allowMismatch {
+				if got, want := tracker.Vars().Get("mismatches").String(), "1"; got != want {
+					t.Errorf("%s: mismatches=%s, want %s", test.descr, got, want)
+				}
+			}
+			if test.update > 0 {
+				test.backend.size = test.update
+				if err := tracker.update(); err != nil {
+					t.Errorf("%s: update()=%v, want no error", test.descr, err)
+				}
+			}
+		}
+
+		root, err := client.ReadRootFile(path)
+		if err != nil {
+			t.Fatalf("%s: ReadRootFile()=_,%v, want no error", test.descr, err)
+		}
+		if got, want := root.TreeSize, test.wantSaved; got != want {
+			t.Errorf("%s: saved tree size %d, want %d", test.descr, got, want)
+		}
+	}
+}
+
+func TestBackendRootTrackerForkWhileRunning(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	dir, err := ioutil.TempDir("", "backend_root_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "root")
+	backend := newFakeBackendTree("leaf", 20)
+	backend.size = 8
+	info.c.rpcClient = backend
+	tracker, err := newBackendRootTracker(context.Background(), info.c, path, false)
+	if err != nil {
+		t.Fatalf("newBackendRootTracker()=_,%v, want no error", err)
+	}
+
+	// A forked root isn't saved, so the log won't start on that backend again.
+	backend.tree = newFakeBackendTree("fork", 20).tree
+	backend.size = 16
+	if err := tracker.update(); err == nil {
+		t.Errorf("update(forked)=nil, want error")
+	}
+	root, err := client.ReadRootFile(path)
+	if err != nil {
+		t.Fatalf("ReadRootFile()=_,%v, want no error", err)
+	}
+	if got, want := root.TreeSize, int64(8); got != want {
+		t.Errorf("saved tree size %d, want %d", got, want)
+	}
+	if _, err := newBackendRootTracker(context.Background(), info.c, path, false); err == nil {
+		t.Errorf("newBackendRootTracker(forked)=_,nil, want error")
+	}
+}
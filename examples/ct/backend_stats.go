@@ -0,0 +1,81 @@
+package ct
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/monitoring"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/status"
+)
+
+// backendStatsClient is a TrillianLogClient that counts the RPCs a single log makes, so
+// that when several logs share a backend connection the load each one puts on it can be
+// told apart. The stats of the shared clients, e.g. RetryingLogClient and
+// CircuitBreaker, cover all the logs.
+type backendStatsClient struct {
+	routedLogClient
+
+	client     trillian.TrillianLogClient
+	timeSource util.TimeSource
+
+	mu  sync.Mutex
+	exp struct {
+		vars    *expvar.Map
+		rpcs    *expvar.Map // method => expvar.Int  (as "rpcs")
+		errors  *expvar.Map // method => expvar.Map[grpc code => expvar.Int]  (as "errors")
+		latency *expvar.Map // method => monitoring.Histogram  (as "latency-ms")
+	}
+}
+
+// newBackendStatsClient wraps client so that its RPCs are counted.
+func newBackendStatsClient(client trillian.TrillianLogClient, timeSource util.TimeSource) *backendStatsClient {
+	s := &backendStatsClient{client: client, timeSource: timeSource}
+	s.routedLogClient = routedLogClient{route: s.call}
+	s.exp.vars = new(expvar.Map).Init()
+	s.exp.rpcs = new(expvar.Map).Init()
+	s.exp.vars.Set("rpcs", s.exp.rpcs)
+	s.exp.errors = new(expvar.Map).Init()
+	s.exp.vars.Set("errors", s.exp.errors)
+	s.exp.latency = new(expvar.Map).Init()
+	s.exp.vars.Set("latency-ms", s.exp.latency)
+	return s
+}
+
+// Vars returns the stats of the client: for each RPC method the number of calls, the
+// number that failed by gRPC code, and a histogram of their latencies.
+func (s *backendStatsClient) Vars() *expvar.Map {
+	return s.exp.vars
+}
+
+func (s *backendStatsClient) call(ctx context.Context, method string, read bool, rpc func(trillian.TrillianLogClient) error) error {
+	start := s.timeSource.Now()
+	err := rpc(s.client)
+	latency := s.timeSource.Now().Sub(start)
+
+	s.exp.rpcs.Add(method, 1)
+	latencyVar, errorsVar := s.method(method)
+	latencyVar.Observe(int64(latency / time.Millisecond))
+	if err != nil {
+		errorsVar.Add(status.Code(err).String(), 1)
+	}
+	return err
+}
+
+// method returns the latency histogram and error counts of an RPC method, creating them
+// the first time it's called.
+func (s *backendStatsClient) method(name string) (*monitoring.Histogram, *expvar.Map) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h, ok := s.exp.latency.Get(name).(*monitoring.Histogram); ok {
+		return h, s.exp.errors.Get(name).(*expvar.Map)
+	}
+	h := monitoring.NewHistogram(monitoring.DefaultLatencyBucketsMillis)
+	s.exp.latency.Set(name, h)
+	errs := new(expvar.Map).Init()
+	s.exp.errors.Set(name, errs)
+	return h, errs
+}
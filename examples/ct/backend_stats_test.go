@@ -0,0 +1,59 @@
+package ct
+
+import (
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/mockclient"
+	"github.com/google/trillian/monitoring"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+func TestBackendStatsClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mockclient.NewMockTrillianLogClient(ctrl)
+	ts := &util.IncrementingFakeTimeSource{BaseTime: fakeTime, Increments: []time.Duration{0, 30 * time.Millisecond, 0, 3 * time.Millisecond, 0, time.Millisecond}}
+	s := newBackendStatsClient(client, ts)
+
+	req := &trillian.GetLatestSignedLogRootRequest{LogId: 1}
+	rsp := &trillian.GetLatestSignedLogRootResponse{}
+	client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Return(rsp, nil)
+	client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Return(nil, errUnavailable)
+	client.EXPECT().QueueLeaves(gomock.Any(), gomock.Any()).Return(nil, errBadRequest)
+	if got, err := s.GetLatestSignedLogRoot(context.Background(), req); err != nil || got != rsp {
+		t.Errorf("GetLatestSignedLogRoot()=%v,%v, want %v,nil", got, err, rsp)
+	}
+	if _, err := s.GetLatestSignedLogRoot(context.Background(), req); err != errUnavailable {
+		t.Errorf("GetLatestSignedLogRoot()=_,%v, want %v", err, errUnavailable)
+	}
+	if _, err := s.QueueLeaves(context.Background(), &trillian.QueueLeavesRequest{}); err != errBadRequest {
+		t.Errorf("QueueLeaves()=_,%v, want %v", err, errBadRequest)
+	}
+
+	var tests = []struct {
+		method      string
+		wantRPCs    string
+		wantErrors  string
+		wantLatency int64
+	}{
+		{method: "GetLatestSignedLogRoot", wantRPCs: "2", wantErrors: `{"Unavailable": 1}`, wantLatency: 33},
+		{method: "QueueLeaves", wantRPCs: "1", wantErrors: `{"InvalidArgument": 1}`, wantLatency: 1},
+	}
+	vars := s.Vars()
+	for _, test := range tests {
+		if got := vars.Get("rpcs").(*expvar.Map).Get(test.method).String(); got != test.wantRPCs {
+			t.Errorf("rpcs[%s]=%s, want %s", test.method, got, test.wantRPCs)
+		}
+		if got := vars.Get("errors").(*expvar.Map).Get(test.method).String(); got != test.wantErrors {
+			t.Errorf("errors[%s]=%s, want %s", test.method, got, test.wantErrors)
+		}
+		if got := vars.Get("latency-ms").(*expvar.Map).Get(test.method).(*monitoring.Histogram).Sum(); got != test.wantLatency {
+			t.Errorf("latency-ms[%s].sum=%d, want %d", test.method, got, test.wantLatency)
+		}
+	}
+}
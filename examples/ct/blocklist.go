@@ -0,0 +1,228 @@
+package ct
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+const (
+	// How often a log's blocklist file is checked for changes if the config doesn't say
+	defaultBlocklistReloadInterval = time.Minute
+	// Code for submissions rejected because a certificate in the chain is blocklisted
+	rejectBlocklisted = "blocklisted"
+)
+
+// issuerSerial identifies a certificate by the SHA-256 hash of its DER encoded issuer
+// name and its serial number, in hex.
+type issuerSerial struct {
+	issuer [sha256.Size]byte
+	serial string
+}
+
+// blocklistEntries is the parsed contents of a blocklist file.
+type blocklistEntries struct {
+	spkis   map[[sha256.Size]byte]bool
+	serials map[issuerSerial]bool
+}
+
+// parseBlocklist parses a blocklist file. Each line is blank, a comment starting with
+// '#', or one of:
+//
+//	spki <hex SHA-256 of the DER encoded SubjectPublicKeyInfo>
+//	serial <hex SHA-256 of the DER encoded issuer name> <hex serial number>
+func parseBlocklist(data []byte) (*blocklistEntries, error) {
+	entries := &blocklistEntries{
+		spkis:   make(map[[sha256.Size]byte]bool),
+		serials: make(map[issuerSerial]bool),
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		switch {
+		case fields[0] == "spki" && len(fields) == 2:
+			hash, err := parseSHA256Hex(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			entries.spkis[hash] = true
+		case fields[0] == "serial" && len(fields) == 3:
+			hash, err := parseSHA256Hex(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			serial, ok := new(big.Int).SetString(fields[2], 16)
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid serial number %q", lineNum, fields[2])
+			}
+			entries.serials[issuerSerial{issuer: hash, serial: serial.Text(16)}] = true
+		default:
+			return nil, fmt.Errorf("line %d: can't parse %q", lineNum, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func parseSHA256Hex(s string) ([sha256.Size]byte, error) {
+	var hash [sha256.Size]byte
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return hash, fmt.Errorf("invalid SHA-256 hash %q", s)
+	}
+	copy(hash[:], b)
+	return hash, nil
+}
+
+// check returns a PolicyError if any certificate in chain is blocklisted.
+func (e *blocklistEntries) check(chain []*x509.Certificate) error {
+	for i, cert := range chain {
+		if e.spkis[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+			return PolicyError{Code: rejectBlocklisted, Reason: fmt.Sprintf("certificate %d has a blocklisted public key", i)}
+		}
+		if cert.SerialNumber == nil {
+			continue
+		}
+		if e.serials[issuerSerial{issuer: sha256.Sum256(cert.RawIssuer), serial: cert.SerialNumber.Text(16)}] {
+			return PolicyError{Code: rejectBlocklisted, Reason: fmt.Sprintf("certificate %d with serial number %x is blocklisted", i, cert.SerialNumber)}
+		}
+	}
+	return nil
+}
+
+func (e *blocklistEntries) size() int {
+	return len(e.spkis) + len(e.serials)
+}
+
+// blocklist holds the certificates a log refuses to accept, loaded from a file that's
+// reloaded whenever it changes. If a reload fails the log carries on with the entries it
+// already has.
+type blocklist struct {
+	logPrefix string
+	path      string
+	done      chan struct{}
+
+	mu      sync.RWMutex
+	entries *blocklistEntries
+	modTime time.Time
+	size    int64
+
+	exp struct {
+		vars     *expvar.Map
+		reloads  *expvar.Int
+		failures *expvar.Int
+		entries  *expvar.Int
+	}
+}
+
+// newBlocklist creates a blocklist from the file at path, which must be loadable.
+func newBlocklist(logPrefix, path string) (*blocklist, error) {
+	b := &blocklist{
+		logPrefix: logPrefix,
+		path:      path,
+		done:      make(chan struct{}),
+	}
+	b.exp.vars = new(expvar.Map).Init()
+	b.exp.reloads = new(expvar.Int)
+	b.exp.vars.Set("reloads", b.exp.reloads)
+	b.exp.failures = new(expvar.Int)
+	b.exp.vars.Set("reload-failures", b.exp.failures)
+	b.exp.entries = new(expvar.Int)
+	b.exp.vars.Set("entries", b.exp.entries)
+
+	if err := b.reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// reload reads the blocklist file again if it has changed since it was last loaded.
+func (b *blocklist) reload() error {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		b.exp.failures.Add(1)
+		return err
+	}
+	b.mu.RLock()
+	unchanged := b.entries != nil && info.ModTime().Equal(b.modTime) && info.Size() == b.size
+	b.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(b.path)
+	if err != nil {
+		b.exp.failures.Add(1)
+		return err
+	}
+	entries, err := parseBlocklist(data)
+	if err != nil {
+		b.exp.failures.Add(1)
+		return fmt.Errorf("failed to parse blocklist %s: %v", b.path, err)
+	}
+
+	b.mu.Lock()
+	b.entries = entries
+	b.modTime = info.ModTime()
+	b.size = info.Size()
+	b.mu.Unlock()
+	b.exp.reloads.Add(1)
+	b.exp.entries.Set(int64(entries.size()))
+	glog.Infof("%s: loaded %d blocklist entries from %s", b.logPrefix, entries.size(), b.path)
+	return nil
+}
+
+// check returns a PolicyError if any certificate in chain is blocklisted.
+func (b *blocklist) check(chain []*x509.Certificate) error {
+	b.mu.RLock()
+	entries := b.entries
+	b.mu.RUnlock()
+	return entries.check(chain)
+}
+
+// Start starts a goroutine that reloads the blocklist every interval until Stop is called.
+func (b *blocklist) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-b.done:
+				return
+			case <-ticker.C:
+				if err := b.reload(); err != nil {
+					glog.Warningf("%s: failed to reload blocklist, keeping the current one: %v", b.logPrefix, err)
+				}
+			}
+		}
+	}()
+}
+
+// Vars returns the statistics exported by this blocklist.
+func (b *blocklist) Vars() *expvar.Map {
+	return b.exp.vars
+}
+
+// Stop stops reloading the blocklist.
+func (b *blocklist) Stop() {
+	close(b.done)
+}
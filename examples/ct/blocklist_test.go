@@ -0,0 +1,186 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/trillian/examples/ct/testonly"
+)
+
+const zeroHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+func TestParseBlocklist(t *testing.T) {
+	var tests = []struct {
+		data        string
+		wantSPKIs   int
+		wantSerials int
+		wantErr     bool
+	}{
+		{data: ""},
+		{data: "# nothing blocked yet\n\n"},
+		{data: "spki " + zeroHash + "\n", wantSPKIs: 1},
+		{data: "spki " + zeroHash + "\nserial " + zeroHash + " 01\nserial " + zeroHash + " 1\n  serial " + zeroHash + " 0aBc  \n", wantSPKIs: 1, wantSerials: 2},
+		{data: "spki 0000\n", wantErr: true},
+		{data: "spki " + zeroHash + " extra\n", wantErr: true},
+		{data: "serial " + zeroHash + "\n", wantErr: true},
+		{data: "serial " + zeroHash + " 0xyz\n", wantErr: true},
+		{data: "issuer " + zeroHash + "\n", wantErr: true},
+	}
+
+	for _, test := range tests {
+		entries, err := parseBlocklist([]byte(test.data))
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseBlocklist(%q)=%+v, want error", test.data, entries)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseBlocklist(%q)=_,%v, want no error", test.data, err)
+			continue
+		}
+		if got, want := len(entries.spkis), test.wantSPKIs; got != want {
+			t.Errorf("parseBlocklist(%q)=%d SPKIs, want %d", test.data, got, want)
+		}
+		if got, want := len(entries.serials), test.wantSerials; got != want {
+			t.Errorf("parseBlocklist(%q)=%d serials, want %d", test.data, got, want)
+		}
+	}
+}
+
+func spkiEntry(cert *x509.Certificate) string {
+	return fmt.Sprintf("spki %x\n", sha256.Sum256(cert.RawSubjectPublicKeyInfo))
+}
+
+func serialEntry(cert *x509.Certificate) string {
+	return fmt.Sprintf("serial %x %x\n", sha256.Sum256(cert.RawIssuer), cert.SerialNumber)
+}
+
+func TestBlocklistCheck(t *testing.T) {
+	root, rootKey := createTestCert(t, "root", true, "", nil, nil)
+	intermediate, intermediateKey := createTestCert(t, "intermediate", true, "", root, rootKey)
+	leaf, _ := createTestCert(t, "leaf", false, "", intermediate, intermediateKey)
+	otherRoot, _ := createTestCert(t, "other", true, "", nil, nil)
+	chain := []*x509.Certificate{leaf, intermediate, root}
+
+	var tests = []struct {
+		data        string
+		wantBlocked bool
+	}{
+		{data: ""},
+		{data: spkiEntry(otherRoot) + serialEntry(otherRoot)},
+		{data: spkiEntry(leaf), wantBlocked: true},
+		{data: spkiEntry(intermediate), wantBlocked: true},
+		{data: spkiEntry(root), wantBlocked: true},
+		{data: serialEntry(leaf), wantBlocked: true},
+		{data: serialEntry(intermediate), wantBlocked: true},
+		// The same serial number from a different issuer isn't blocked.
+		{data: fmt.Sprintf("serial %x 1\n", sha256.Sum256(otherRoot.RawSubject))},
+		{data: fmt.Sprintf("serial %x 2\n", sha256.Sum256(leaf.RawIssuer))},
+	}
+
+	for _, test := range tests {
+		entries, err := parseBlocklist([]byte(test.data))
+		if err != nil {
+			t.Fatalf("parseBlocklist(%q)=_,%v, want no error", test.data, err)
+		}
+		err = entries.check(chain)
+		if !test.wantBlocked {
+			if err != nil {
+				t.Errorf("check(%q)=%v, want no error", test.data, err)
+			}
+			continue
+		}
+		perr, ok := err.(PolicyError)
+		if !ok {
+			t.Errorf("check(%q)=%v, want PolicyError", test.data, err)
+			continue
+		}
+		if got, want := perr.Code, rejectBlocklisted; got != want {
+			t.Errorf("check(%q)=%q, want code %q", test.data, got, want)
+		}
+	}
+}
+
+func TestBlocklistReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blocklist")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "blocklist")
+
+	if _, err := newBlocklist("test", path); err == nil {
+		t.Error("newBlocklist(missing file)=nil, want error")
+	}
+
+	leaf, _ := createTestCert(t, "leaf", false, "", nil, nil)
+	chain := []*x509.Certificate{leaf}
+	if err := ioutil.WriteFile(path, []byte("# empty\n"), 0644); err != nil {
+		t.Fatalf("Failed to write blocklist: %v", err)
+	}
+	b, err := newBlocklist("test", path)
+	if err != nil {
+		t.Fatalf("newBlocklist()=_,%v, want no error", err)
+	}
+	if err := b.check(chain); err != nil {
+		t.Errorf("check()=%v, want no error", err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(spkiEntry(leaf)), 0644); err != nil {
+		t.Fatalf("Failed to write blocklist: %v", err)
+	}
+	if err := b.reload(); err != nil {
+		t.Fatalf("reload()=%v, want no error", err)
+	}
+	if err := b.check(chain); err == nil {
+		t.Error("check()=nil after reload, want error")
+	}
+	if got, want := b.exp.entries.String(), "1"; got != want {
+		t.Errorf("entries=%s, want %s", got, want)
+	}
+
+	// A broken file leaves the current entries in place.
+	if err := ioutil.WriteFile(path, []byte("garbage\n"), 0644); err != nil {
+		t.Fatalf("Failed to write blocklist: %v", err)
+	}
+	if err := b.reload(); err == nil {
+		t.Error("reload(garbage)=nil, want error")
+	}
+	if err := b.check(chain); err == nil {
+		t.Error("check()=nil after failed reload, want error")
+	}
+	if got, want := b.exp.failures.String(), "1"; got != want {
+		t.Errorf("reload-failures=%s, want %s", got, want)
+	}
+}
+
+func TestAddChainBlocklist(t *testing.T) {
+	pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+	entries, err := parseBlocklist([]byte(spkiEntry(pool.RawCertificates()[1])))
+	if err != nil {
+		t.Fatalf("parseBlocklist()=_,%v, want no error", err)
+	}
+
+	info := setupTest(t, []string{testonly.FakeCACertPEM})
+	defer info.mockCtrl.Finish()
+	info.c.blocklist = &blocklist{entries: entries}
+
+	recorder := makeAddChainRequest(t, info.c, createJSONChain(t, *pool))
+	if got, want := recorder.Code, http.StatusBadRequest; got != want {
+		t.Errorf("addChain()=%d (body:%v); want %d", got, recorder.Body, want)
+	}
+	if got, want := recorder.Body.String(), rejectBlocklisted; !strings.Contains(got, want) {
+		t.Errorf("addChain() body=%q, want it to contain %q", got, want)
+	}
+	if got, want := info.c.exp.policyRejections.Get(rejectBlocklisted).String(), "1"; got != want {
+		t.Errorf("policy-rejections[%s]=%s, want %s", rejectBlocklisted, got, want)
+	}
+}
@@ -0,0 +1,247 @@
+package ct
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultBreakerConfig is the BreakerConfig used unless configured otherwise.
+var DefaultBreakerConfig = BreakerConfig{
+	ErrorRate:   0.5,
+	MinRequests: 20,
+	Window:      10 * time.Second,
+	OpenFor:     5 * time.Second,
+}
+
+// BreakerConfig says when a CircuitBreaker trips and for how long.
+type BreakerConfig struct {
+	// ErrorRate is the fraction of an RPC method's requests in a window that must be
+	// exceeded by failures for the breaker to trip for that method. Values of 1 or more
+	// never trip it.
+	ErrorRate float64
+	// MinRequests is the number of requests needed in a window before the error rate is
+	// checked, so that a few failures while traffic is light don't trip the breaker.
+	MinRequests int
+	// Window is the period over which error rates are measured.
+	Window time.Duration
+	// OpenFor is how long requests fail fast after the breaker trips, before one is let
+	// through to probe whether the backend has recovered.
+	OpenFor time.Duration
+}
+
+// Breaker states, as exported in the stats of each method.
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// errCircuitOpen is returned for requests rejected by an open CircuitBreaker.
+var errCircuitOpen = status.Error(codes.Unavailable, "backend circuit breaker open")
+
+type methodBreaker struct {
+	mu    sync.Mutex
+	state int
+	// windowStart, requests and failures measure the error rate while closed.
+	windowStart time.Time
+	requests    int
+	failures    int
+	// openUntil is when an open breaker lets a probe through.
+	openUntil time.Time
+
+	stateVar *expvar.Int
+	trips    *expvar.Int
+	rejected *expvar.Int
+}
+
+// CircuitBreaker is a TrillianLogClient that stops sending requests for an RPC method to
+// the backend when too many of them fail, so a struggling backend isn't overwhelmed by
+// retries. Requests fail fast while the breaker for their method is open. Once OpenFor
+// has passed a single request is let through as a probe: the breaker closes if it
+// succeeds, and opens again if it fails.
+//
+// Only errors that suggest the backend is in trouble count as failures, not those caused
+// by bad requests or clients going away.
+type CircuitBreaker struct {
+	routedLogClient
+
+	client     trillian.TrillianLogClient
+	config     BreakerConfig
+	timeSource util.TimeSource
+
+	mu       sync.Mutex
+	methods  map[string]*methodBreaker
+	vars     *expvar.Map
+	rejected *expvar.Int
+}
+
+// NewCircuitBreaker wraps client in a CircuitBreaker configured by config.
+func NewCircuitBreaker(client trillian.TrillianLogClient, config BreakerConfig, timeSource util.TimeSource) *CircuitBreaker {
+	b := &CircuitBreaker{
+		client:     client,
+		config:     config,
+		timeSource: timeSource,
+		methods:    make(map[string]*methodBreaker),
+		vars:       new(expvar.Map).Init(),
+		rejected:   new(expvar.Int),
+	}
+	b.routedLogClient = routedLogClient{route: b.call}
+	b.vars.Set("rejected", b.rejected)
+	return b
+}
+
+// Vars returns the stats of the breaker: for each RPC method its state (0 closed, 1 open,
+// 2 probing), the number of times it tripped and the number of requests rejected, and the
+// total number of requests rejected.
+func (b *CircuitBreaker) Vars() *expvar.Map {
+	return b.vars
+}
+
+// breakerFailure returns true if err suggests the backend is struggling.
+func breakerFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
+
+func (b *CircuitBreaker) method(name string) *methodBreaker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m, ok := b.methods[name]
+	if !ok {
+		m = &methodBreaker{stateVar: new(expvar.Int), trips: new(expvar.Int), rejected: new(expvar.Int)}
+		stats := new(expvar.Map).Init()
+		stats.Set("state", m.stateVar)
+		stats.Set("trips", m.trips)
+		stats.Set("rejected", m.rejected)
+		b.vars.Set(name, stats)
+		b.methods[name] = m
+	}
+	return m
+}
+
+// allow returns whether a request may be sent, whether it's a probe, and if it may not be
+// sent how long until the next probe.
+func (b *CircuitBreaker) allow(m *methodBreaker, now time.Time) (bool, bool, time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch m.state {
+	case breakerOpen:
+		if now.Before(m.openUntil) {
+			return false, false, m.openUntil.Sub(now)
+		}
+		m.setState(breakerHalfOpen)
+		return true, true, 0
+	case breakerHalfOpen:
+		// Wait for the outcome of the probe, which should be quick.
+		return false, false, b.config.OpenFor
+	}
+	return true, false, 0
+}
+
+// record updates the breaker with the outcome of a request.
+func (b *CircuitBreaker) record(name string, m *methodBreaker, probe, failed bool, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if probe {
+		if failed {
+			glog.Warningf("%s: backend still failing, circuit breaker stays open for %v", name, b.config.OpenFor)
+			m.open(now.Add(b.config.OpenFor))
+		} else {
+			glog.Infof("%s: backend recovered, circuit breaker closed", name)
+			m.setState(breakerClosed)
+			m.windowStart, m.requests, m.failures = now, 0, 0
+		}
+		return
+	}
+	if m.state != breakerClosed {
+		// The request was sent before the breaker tripped.
+		return
+	}
+
+	if now.Sub(m.windowStart) >= b.config.Window {
+		m.windowStart, m.requests, m.failures = now, 0, 0
+	}
+	m.requests++
+	if failed {
+		m.failures++
+	}
+	if m.requests >= b.config.MinRequests && float64(m.failures) > b.config.ErrorRate*float64(m.requests) {
+		glog.Warningf("%s: %d of %d backend requests failed, circuit breaker open for %v", name, m.failures, m.requests, b.config.OpenFor)
+		m.trips.Add(1)
+		m.open(now.Add(b.config.OpenFor))
+	}
+}
+
+func (m *methodBreaker) open(until time.Time) {
+	m.setState(breakerOpen)
+	m.openUntil = until
+}
+
+func (m *methodBreaker) setState(state int) {
+	m.state = state
+	m.stateVar.Set(int64(state))
+}
+
+func (b *CircuitBreaker) call(ctx context.Context, method string, read bool, rpc func(trillian.TrillianLogClient) error) error {
+	m := b.method(method)
+	ok, probe, retryAfter := b.allow(m, b.timeSource.Now())
+	if !ok {
+		m.rejected.Add(1)
+		b.rejected.Add(1)
+		noteRetryAfter(ctx, retryAfter)
+		return errCircuitOpen
+	}
+
+	err := rpc(b.client)
+	if ctx.Err() == context.Canceled {
+		// The client went away, which says nothing about the backend. An abandoned probe
+		// is replaced by the next request.
+		if probe {
+			m.mu.Lock()
+			m.open(b.timeSource.Now())
+			m.mu.Unlock()
+		}
+		return err
+	}
+	b.record(method, m, probe, breakerFailure(err), b.timeSource.Now())
+	return err
+}
+
+// retryAfterNotice collects how long clients should wait before retrying a request whose
+// backend RPCs were rejected by a CircuitBreaker, in nanoseconds.
+type retryAfterNotice struct {
+	d int64
+}
+
+type retryAfterNoticeKey struct{}
+
+// withRetryAfterNotice returns a context for a request's backend RPCs, and the notice that
+// rejected RPCs made in that context fill in.
+func withRetryAfterNotice(ctx context.Context) (context.Context, *retryAfterNotice) {
+	n := &retryAfterNotice{}
+	return context.WithValue(ctx, retryAfterNoticeKey{}, n), n
+}
+
+// noteRetryAfter records d in the notice of ctx, if it has one.
+func noteRetryAfter(ctx context.Context, d time.Duration) {
+	if n, ok := ctx.Value(retryAfterNoticeKey{}).(*retryAfterNotice); ok {
+		atomic.StoreInt64(&n.d, int64(d))
+	}
+}
+
+// retryAfter returns the time noted, or zero if no RPC was rejected.
+func (n *retryAfterNotice) retryAfter() time.Duration {
+	return time.Duration(atomic.LoadInt64(&n.d))
+}
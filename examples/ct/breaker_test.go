@@ -0,0 +1,181 @@
+package ct
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/mockclient"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+var testBreakerConfig = BreakerConfig{ErrorRate: 0.5, MinRequests: 4, Window: time.Minute, OpenFor: 5 * time.Second}
+
+func breakerStat(b *CircuitBreaker, method, name string) string {
+	stats, ok := b.Vars().Get(method).(*expvar.Map)
+	if !ok {
+		return ""
+	}
+	return stats.Get(name).String()
+}
+
+func TestCircuitBreakerTrips(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mockclient.NewMockTrillianLogClient(ctrl)
+	timeSource := &util.FakeTimeSource{FakeTime: fakeTime}
+	b := NewCircuitBreaker(client, testBreakerConfig, timeSource)
+
+	req := &trillian.GetLatestSignedLogRootRequest{LogId: 1}
+	rsp := &trillian.GetLatestSignedLogRootResponse{}
+	gomock.InOrder(
+		client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Times(2).Return(rsp, nil),
+		client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Times(2).Return(nil, errUnavailable),
+		client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Return(nil, errBadRequest),
+		client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Times(2).Return(nil, errUnavailable),
+	)
+	// Half the requests failing isn't enough to trip the breaker, and bad requests aren't
+	// failures of the backend.
+	for i := 0; i < 5; i++ {
+		b.GetLatestSignedLogRoot(context.Background(), req)
+	}
+	if got, want := breakerStat(b, "GetLatestSignedLogRoot", "state"), "0"; got != want {
+		t.Fatalf("state=%s after 2 of 5 requests failed, want %s", got, want)
+	}
+	b.GetLatestSignedLogRoot(context.Background(), req)
+	b.GetLatestSignedLogRoot(context.Background(), req)
+	if got, want := breakerStat(b, "GetLatestSignedLogRoot", "state"), "1"; got != want {
+		t.Fatalf("state=%s after 4 of 7 requests failed, want %s", got, want)
+	}
+
+	// Requests now fail without reaching the backend, but only for the tripped method.
+	if _, err := b.GetLatestSignedLogRoot(context.Background(), req); err != errCircuitOpen {
+		t.Errorf("GetLatestSignedLogRoot()=_,%v, want %v", err, errCircuitOpen)
+	}
+	leavesReq := &trillian.GetLeavesByIndexRequest{LogId: 1}
+	client.EXPECT().GetLeavesByIndex(gomock.Any(), leavesReq).Return(&trillian.GetLeavesByIndexResponse{}, nil)
+	if _, err := b.GetLeavesByIndex(context.Background(), leavesReq); err != nil {
+		t.Errorf("GetLeavesByIndex()=_,%v, want no error", err)
+	}
+
+	for _, test := range []struct{ method, name, want string }{
+		{method: "GetLatestSignedLogRoot", name: "trips", want: "1"},
+		{method: "GetLatestSignedLogRoot", name: "rejected", want: "1"},
+		{method: "GetLeavesByIndex", name: "state", want: "0"},
+	} {
+		if got := breakerStat(b, test.method, test.name); got != test.want {
+			t.Errorf("%s %s=%s, want %s", test.method, test.name, got, test.want)
+		}
+	}
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mockclient.NewMockTrillianLogClient(ctrl)
+	timeSource := &util.FakeTimeSource{FakeTime: fakeTime}
+	b := NewCircuitBreaker(client, testBreakerConfig, timeSource)
+
+	req := &trillian.GetLatestSignedLogRootRequest{LogId: 1}
+	client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Times(6).Return(nil, errUnavailable)
+	for i := 0; i < 3; i++ {
+		b.GetLatestSignedLogRoot(context.Background(), req)
+	}
+	// Failures from an earlier window are forgotten, so MinRequests must be seen again.
+	timeSource.FakeTime = timeSource.FakeTime.Add(testBreakerConfig.Window)
+	for i := 0; i < 3; i++ {
+		b.GetLatestSignedLogRoot(context.Background(), req)
+	}
+	if got, want := breakerStat(b, "GetLatestSignedLogRoot", "state"), "0"; got != want {
+		t.Errorf("state=%s, want %s", got, want)
+	}
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mockclient.NewMockTrillianLogClient(ctrl)
+	timeSource := &util.FakeTimeSource{FakeTime: fakeTime}
+	b := NewCircuitBreaker(client, testBreakerConfig, timeSource)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := &trillian.GetLatestSignedLogRootRequest{LogId: 1}
+	rsp := &trillian.GetLatestSignedLogRootResponse{}
+	client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Times(4).Return(nil, errUnavailable)
+	for i := 0; i < 4; i++ {
+		b.GetLatestSignedLogRoot(context.Background(), req)
+	}
+
+	var tests = []struct {
+		descr     string
+		ctx       context.Context
+		advance   time.Duration
+		rpcRsp    *trillian.GetLatestSignedLogRootResponse
+		rpcErr    error
+		noRPC     bool
+		wantErr   error
+		wantState string
+	}{
+		{descr: "open", advance: time.Second, noRPC: true, wantErr: errCircuitOpen, wantState: "1"},
+		{descr: "failed-probe", advance: 4 * time.Second, rpcErr: errUnavailable, wantErr: errUnavailable, wantState: "1"},
+		{descr: "reopened", advance: 4 * time.Second, noRPC: true, wantErr: errCircuitOpen, wantState: "1"},
+		{descr: "abandoned-probe", ctx: cancelled, advance: time.Second, rpcErr: errUnavailable, wantErr: errUnavailable, wantState: "1"},
+		{descr: "probe", rpcRsp: rsp, wantState: "0"},
+		{descr: "closed", rpcRsp: rsp, wantState: "0"},
+	}
+
+	for _, test := range tests {
+		ctx := test.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		timeSource.FakeTime = timeSource.FakeTime.Add(test.advance)
+		if !test.noRPC {
+			client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Return(test.rpcRsp, test.rpcErr)
+		}
+		if _, err := b.GetLatestSignedLogRoot(ctx, req); err != test.wantErr {
+			t.Errorf("%s: GetLatestSignedLogRoot()=_,%v, want %v", test.descr, err, test.wantErr)
+		}
+		if got := breakerStat(b, "GetLatestSignedLogRoot", "state"); got != test.wantState {
+			t.Errorf("%s: state=%s, want %s", test.descr, got, test.wantState)
+		}
+	}
+}
+
+func TestCircuitBreakerRetryAfter(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	config := BreakerConfig{MinRequests: 1, Window: time.Minute, OpenFor: 2500 * time.Millisecond}
+	info.c.rpcClient = NewCircuitBreaker(info.client, config, fakeTimeSource)
+	handler := appHandler{context: info.c, handler: getSTH, name: "GetSTH", method: http.MethodGet}
+
+	info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), &trillian.GetLatestSignedLogRootRequest{LogId: 0x42}).Return(nil, errUnavailable)
+	var tests = []struct {
+		want           int
+		wantRetryAfter string
+	}{
+		{want: http.StatusInternalServerError},
+		{want: http.StatusServiceUnavailable, wantRetryAfter: "3"},
+	}
+
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", "http://example.com/ct/v1/get-sth", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got := w.Code; got != test.want {
+			t.Errorf("GetSTH(%d).Code=%d, want %d", i, got, test.want)
+		}
+		if got := w.Header().Get(retryAfterHeader); got != test.wantRetryAfter {
+			t.Errorf("GetSTH(%d) Retry-After=%q, want %q", i, got, test.wantRetryAfter)
+		}
+	}
+}
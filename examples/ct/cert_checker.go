@@ -2,6 +2,7 @@ package ct
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 
@@ -12,9 +13,30 @@ import (
 // OID of the non-critical extension used to mark pre-certificates, defined in RFC 6962
 var ctPoisonExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
 
+// OID of the extended key usage that marks a Precertificate Signing Certificate, which a
+// CA can use to sign precertificates in place of its own key, defined in RFC 6962
+var ctPrecertSigningEKUOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 4}
+
+// OID of the X.509 extended key usage extension
+var extKeyUsageOID = asn1.ObjectIdentifier{2, 5, 29, 37}
+
 // Byte representation of ASN.1 NULL.
 var asn1NullBytes = []byte{0x05, 0x00}
 
+// DefaultMaxChainLength is the default limit on the number of certificates in a submitted
+// chain. Real chains rarely have more than four or five, and path building gets expensive
+// with many intermediates.
+const DefaultMaxChainLength = 10
+
+// checkChainLength returns an error if a chain has more than maxLength certificates. It's
+// used to reject pathological submissions before doing any parsing or path building.
+func checkChainLength(rawChain [][]byte, maxLength int) error {
+	if len(rawChain) > maxLength {
+		return fmt.Errorf("chain has %d certificates, more than the maximum of %d", len(rawChain), maxLength)
+	}
+	return nil
+}
+
 // IsPrecertificate tests if a certificate is a pre-certificate as defined in CT.
 // An error is returned if the CT extension is present but is not ASN.1 NULL as defined
 // by the spec.
@@ -32,6 +54,69 @@ func IsPrecertificate(cert *x509.Certificate) (bool, error) {
 	return false, nil
 }
 
+// IsPrecertSigningCert tests if a certificate is a Precertificate Signing Certificate, i.e.
+// has the CT extended key usage. The extension is parsed here rather than relying on the
+// x509 package knowing the usage.
+func IsPrecertSigningCert(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if !extKeyUsageOID.Equal(ext.Id) {
+			continue
+		}
+		var usages []asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(ext.Value, &usages); err != nil {
+			return false
+		}
+		for _, usage := range usages {
+			if ctPrecertSigningEKUOID.Equal(usage) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// finalIssuer returns the CA that issued the first certificate of a verified chain, or for
+// a precertificate the CA that will issue the final certificate. That's the second
+// certificate, unless it's a Precertificate Signing Certificate, when it's the CA that
+// certified it: the third certificate, or the one of roots that signed it if the chain
+// ends with it. RFC 6962 requires a Precertificate Signing Certificate to be certified
+// directly by the CA, and only to sign precertificates. It returns nil for a chain of
+// one certificate.
+func finalIssuer(chain []*x509.Certificate, roots *PEMCertPool) (*x509.Certificate, error) {
+	if len(chain) < 2 {
+		return nil, nil
+	}
+	if !IsPrecertSigningCert(chain[1]) {
+		return chain[1], nil
+	}
+	isPrecert, err := IsPrecertificate(chain[0])
+	if err != nil {
+		return nil, fmt.Errorf("precert test failed: %v", err)
+	}
+	if !isPrecert {
+		return nil, errors.New("precertificate signing certificate can only issue precertificates")
+	}
+
+	var ca *x509.Certificate
+	if len(chain) > 2 {
+		ca = chain[2]
+	} else {
+		for _, root := range roots.RawCertificates() {
+			if chain[1].CheckSignatureFrom(root) == nil {
+				ca = root
+				break
+			}
+		}
+		if ca == nil {
+			return nil, errors.New("no trusted root issued the precertificate signing certificate")
+		}
+	}
+	if IsPrecertSigningCert(ca) {
+		return nil, errors.New("precertificate signing certificate must be certified directly by a CA")
+	}
+	return ca, nil
+}
+
 // ValidateChain takes the certificate chain as it was parsed from a JSON request. Ensures all
 // elements in the chain decode as X.509 certificates. Ensures that there is a valid path from the
 // end entity certificate in the chain to a trusted root cert, possibly using the intermediates
@@ -41,8 +126,17 @@ func ValidateChain(rawChain [][]byte, trustedRoots PEMCertPool) ([]*x509.Certifi
 	// First make sure the certs parse as X.509
 	chain := make([]*x509.Certificate, 0, len(rawChain))
 	intermediatePool := NewPEMCertPool()
+	seen := make(map[[sha256.Size]byte]bool)
 
 	for i, certBytes := range rawChain {
+		// A certificate can't appear twice in a valid path, and repeats can make path
+		// building loop, so reject them up front
+		fingerprint := sha256.Sum256(certBytes)
+		if seen[fingerprint] {
+			return nil, fmt.Errorf("certificate %d appears more than once in the chain", i)
+		}
+		seen[fingerprint] = true
+
 		cert, err := x509.ParseCertificate(certBytes)
 		if err != nil {
 			_, ok := err.(x509.NonFatalErrors)
@@ -2,11 +2,14 @@ package ct
 
 import (
 	"encoding/pem"
+	"strings"
 	"testing"
 
+	ct "github.com/google/certificate-transparency/go"
 	"github.com/google/certificate-transparency/go/x509"
 	"github.com/google/certificate-transparency/go/x509/pkix"
 	"github.com/google/trillian/examples/ct/testonly"
+	"golang.org/x/net/context"
 )
 
 func TestIsPrecertificate(t *testing.T) {
@@ -161,6 +164,41 @@ func TestCertCheckerValidChainAccepted(t *testing.T) {
 
 // Builds a chain of DER-encoded certs.
 // Note: ordering is important
+func TestCertCheckerRepeatedCertRejected(t *testing.T) {
+	// A chain that loops back on itself must be rejected before path building
+	chainPem := []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM}
+	jsonChain := pemsToDERChain(t, chainPem)
+	trustedRoots := NewPEMCertPool()
+
+	if !trustedRoots.AppendCertsFromPEM([]byte(testonly.FakeCACertPEM)) {
+		t.Fatal("failed to load fake root")
+	}
+
+	if _, err := ValidateChain(jsonChain, *trustedRoots); err == nil {
+		t.Fatal("verification accepted a chain with a repeated cert")
+	}
+}
+
+func TestCheckChainLength(t *testing.T) {
+	var tests = []struct {
+		length, max int
+		wantErr     bool
+	}{
+		{length: 1, max: 1},
+		{length: 3, max: DefaultMaxChainLength},
+		{length: DefaultMaxChainLength, max: DefaultMaxChainLength},
+		{length: DefaultMaxChainLength + 1, max: DefaultMaxChainLength, wantErr: true},
+		{length: 2, max: 1, wantErr: true},
+	}
+
+	for _, test := range tests {
+		chain := make([][]byte, test.length)
+		if err := checkChainLength(chain, test.max); (err != nil) != test.wantErr {
+			t.Errorf("checkChainLength(%d certs, %d)=%v, want error: %v", test.length, test.max, err, test.wantErr)
+		}
+	}
+}
+
 func pemsToDERChain(t *testing.T, pemCerts []string) [][]byte {
 	chain := make([][]byte, 0, len(pemCerts))
 	for _, pemCert := range pemCerts {
@@ -191,3 +229,123 @@ func pemToCert(t *testing.T, pemData string) *x509.Certificate {
 
 	return cert
 }
+
+// precertSigningChain is a chain of test certificates from root to a precertificate
+// signed by psc, a Precertificate Signing Certificate of ca, and the final certificate ca
+// issues for it.
+type precertSigningChain struct {
+	root, ca, psc, precert, final *x509.Certificate
+	// certByPSC is a certificate wrongly issued by psc.
+	certByPSC *x509.Certificate
+	// precertByPSC2 is a precertificate signed by a Precertificate Signing Certificate
+	// certified by psc rather than a CA.
+	precertByPSC2, psc2 *x509.Certificate
+}
+
+func createPrecertSigningChain(t *testing.T) precertSigningChain {
+	b := testonly.NewChainBuilder(t)
+	root := b.Root(testonly.CertSpec{CommonName: "Root"})
+	ca := b.Intermediate(root, testonly.CertSpec{CommonName: "CA"})
+	psc := b.PrecertSigningCert(ca, testonly.CertSpec{CommonName: "CA Precertificate Signing"})
+	psc2 := b.PrecertSigningCert(psc, testonly.CertSpec{CommonName: "Nested Precertificate Signing"})
+	precert := b.Precert(psc, testonly.CertSpec{CommonName: "leaf.example.com"})
+
+	return precertSigningChain{
+		root:          root.Certificate,
+		ca:            ca.Certificate,
+		psc:           psc.Certificate,
+		psc2:          psc2.Certificate,
+		precert:       precert.Certificate,
+		final:         b.Leaf(ca, precert.Spec).Certificate,
+		certByPSC:     b.Leaf(psc, precert.Spec).Certificate,
+		precertByPSC2: b.Precert(psc2, precert.Spec).Certificate,
+	}
+}
+
+func TestIsPrecertSigningCert(t *testing.T) {
+	chain := createPrecertSigningChain(t)
+	for _, test := range []struct {
+		descr string
+		cert  *x509.Certificate
+		want  bool
+	}{
+		{descr: "ca", cert: chain.ca},
+		{descr: "psc", cert: chain.psc, want: true},
+		{descr: "precert", cert: chain.precert},
+	} {
+		if got := IsPrecertSigningCert(test.cert); got != test.want {
+			t.Errorf("IsPrecertSigningCert(%s)=%v, want %v", test.descr, got, test.want)
+		}
+	}
+}
+
+func TestFinalIssuer(t *testing.T) {
+	chain := createPrecertSigningChain(t)
+	roots := NewPEMCertPool()
+	roots.AddCert(chain.root)
+	caRoots := NewPEMCertPool()
+	caRoots.AddCert(chain.root)
+	caRoots.AddCert(chain.ca)
+
+	var tests = []struct {
+		descr  string
+		chain  []*x509.Certificate
+		roots  *PEMCertPool
+		want   *x509.Certificate
+		errStr string
+	}{
+		{descr: "root", chain: []*x509.Certificate{chain.root}, roots: roots},
+		{descr: "cert", chain: []*x509.Certificate{chain.final, chain.ca}, roots: roots, want: chain.ca},
+		{descr: "psc", chain: []*x509.Certificate{chain.precert, chain.psc, chain.ca}, roots: roots, want: chain.ca},
+		{descr: "psc-ca-is-root", chain: []*x509.Certificate{chain.precert, chain.psc}, roots: caRoots, want: chain.ca},
+		{descr: "psc-no-ca", chain: []*x509.Certificate{chain.precert, chain.psc}, roots: roots, errStr: "no trusted root"},
+		{descr: "cert-by-psc", chain: []*x509.Certificate{chain.certByPSC, chain.psc, chain.ca}, roots: roots, errStr: "only issue precertificates"},
+		{descr: "nested-psc", chain: []*x509.Certificate{chain.precertByPSC2, chain.psc2, chain.psc, chain.ca}, roots: roots, errStr: "directly by a CA"},
+	}
+
+	for _, test := range tests {
+		got, err := finalIssuer(test.chain, test.roots)
+		if len(test.errStr) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.errStr) {
+				t.Errorf("%s: finalIssuer()=_,%v, want error containing %q", test.descr, err, test.errStr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: finalIssuer()=_,%v, want no error", test.descr, err)
+		} else if got != test.want {
+			t.Errorf("%s: finalIssuer()=%v, want %v", test.descr, got, test.want)
+		}
+	}
+}
+
+func TestVerifyAddChainPrecertSigningCert(t *testing.T) {
+	chain := createPrecertSigningChain(t)
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	roots := NewPEMCertPool()
+	roots.AddCert(chain.root)
+	info.c.trustedRoots = NewTrustedRoots(roots)
+
+	var tests = []struct {
+		descr     string
+		chain     []*x509.Certificate
+		isPrecert bool
+		wantErr   bool
+	}{
+		{descr: "precert", chain: []*x509.Certificate{chain.precert, chain.psc, chain.ca}, isPrecert: true},
+		{descr: "cert-by-psc", chain: []*x509.Certificate{chain.certByPSC, chain.psc, chain.ca}, wantErr: true},
+		{descr: "nested-psc", chain: []*x509.Certificate{chain.precertByPSC2, chain.psc2, chain.psc, chain.ca}, isPrecert: true, wantErr: true},
+	}
+
+	for _, test := range tests {
+		var req ct.AddChainRequest
+		for _, cert := range test.chain {
+			req.Chain = append(req.Chain, cert.Raw)
+		}
+		_, err := verifyAddChain(context.Background(), info.c, req, nil, test.isPrecert)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: verifyAddChain()=_,%v, want error: %v", test.descr, err, test.wantErr)
+		}
+	}
+}
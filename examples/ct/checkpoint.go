@@ -0,0 +1,200 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/trillian"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/net/context"
+)
+
+// A checkpoint is a tree head in the signed note format used by witnesses and other
+// generic transparency log verifiers. The note text is the log's origin, the tree size
+// in decimal and the base64 root hash, each on its own line, and it's followed by a
+// blank line and a signature line for each key that signed it:
+//
+//	example.com/ct/log
+//	4027
+//	cfHGhYlWeHf3UoYUzQo4k6H4qDcrUOYW2xhqZL+1Nuk=
+//
+//	— example.com/ct/log Az3grsIXaNnyhyXs6ZalSMqDM/AHhH3UG2rR3ZoxNUSTRJw0...
+//
+// The log signs its checkpoints with an Ed25519 key, whose verifier key is logged at
+// startup and exported in the log's statistics.
+
+const (
+	// CheckpointPath is the path of a log's latest checkpoint, relative to its prefix.
+	CheckpointPath = "/checkpoint"
+	// Content type of checkpoints
+	contentTypeNote = "text/plain; charset=utf-8"
+	// Signature algorithm byte that identifies Ed25519 note keys
+	noteAlgEd25519 = 1
+)
+
+// noteSigner signs notes with an Ed25519 key. Its name is the log's origin, which is
+// the first line of its checkpoints.
+type noteSigner struct {
+	name    string
+	keyHash []byte
+	key     ed25519.PrivateKey
+}
+
+// newNoteSigner creates a noteSigner for key, named name.
+func newNoteSigner(name string, key ed25519.PrivateKey) (*noteSigner, error) {
+	if !isValidNoteName(name) {
+		return nil, fmt.Errorf("invalid note signer name %q", name)
+	}
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("bad Ed25519 private key size %d", len(key))
+	}
+	return &noteSigner{name: name, keyHash: noteKeyHash(name, noteAlgEd25519, key.Public().(ed25519.PublicKey)), key: key}, nil
+}
+
+// loadNoteSigner reads an unencrypted PKCS#8 PEM encoded Ed25519 private key from
+// filename, and creates a noteSigner for it named name.
+func loadNoteSigner(name, filename string) (*noteSigner, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint key file: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block in checkpoint key file")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint key: %v", err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("checkpoint key is a %T, want an Ed25519 key", key)
+	}
+	return newNoteSigner(name, edKey)
+}
+
+// isValidNoteName returns true if name can be used as a key name in a note: a non-empty
+// UTF-8 string without spaces or plus signs.
+func isValidNoteName(name string) bool {
+	return len(name) > 0 && utf8.ValidString(name) && strings.IndexFunc(name, unicode.IsSpace) < 0 && !strings.Contains(name, "+")
+}
+
+// noteKeyHash returns the ID of a note key using signature algorithm alg, which prefixes
+// its signatures.
+func noteKeyHash(name string, alg byte, key ed25519.PublicKey) []byte {
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte{'\n', alg})
+	h.Write(key)
+	return h.Sum(nil)[:4]
+}
+
+// VerifierKey returns the string verifiers use to check the signer's notes:
+// <name>+<hex key hash>+<base64 algorithm and public key>.
+func (s *noteSigner) VerifierKey() string {
+	key := append([]byte{noteAlgEd25519}, s.key.Public().(ed25519.PublicKey)...)
+	return fmt.Sprintf("%s+%s+%s", s.name, hex.EncodeToString(s.keyHash), base64.StdEncoding.EncodeToString(key))
+}
+
+// sign returns the signed note for text, which must be a series of complete lines.
+func (s *noteSigner) sign(text string) ([]byte, error) {
+	if !strings.HasSuffix(text, "\n") || strings.Contains(text, "\n\n") {
+		return nil, errors.New("note text must be non-empty lines, each ending in a newline")
+	}
+	sig := append(append([]byte(nil), s.keyHash...), ed25519.Sign(s.key, []byte(text))...)
+	return []byte(fmt.Sprintf("%s\n— %s %s\n", text, s.name, base64.StdEncoding.EncodeToString(sig))), nil
+}
+
+// checkpointText returns the note text of a checkpoint for a tree.
+func checkpointText(origin string, treeSize int64, rootHash []byte) string {
+	return fmt.Sprintf("%s\n%d\n%s\n", origin, treeSize, base64.StdEncoding.EncodeToString(rootHash))
+}
+
+// signCheckpoint returns the log's signed checkpoint for a tree head from the backend.
+func signCheckpoint(c LogContext, slr trillian.SignedLogRoot) ([]byte, error) {
+	if c.checkpointSigner == nil {
+		return nil, errors.New("log has no checkpoint key")
+	}
+	if err := c.checkRootHash(slr.RootHash); err != nil {
+		return nil, err
+	}
+	note, err := c.checkpointSigner.sign(checkpointText(c.checkpointSigner.name, slr.TreeSize, slr.RootHash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign checkpoint: %v", err)
+	}
+	return note, nil
+}
+
+// parseCheckpoint returns the tree size and root hash in a checkpoint for origin, whose
+// root hashes are hashSize bytes long. It doesn't check the signatures.
+func parseCheckpoint(origin string, hashSize int, note []byte) (int64, []byte, error) {
+	end := bytes.Index(note, []byte("\n\n"))
+	if end < 0 {
+		return 0, nil, errors.New("checkpoint has no signatures")
+	}
+	lines := strings.Split(string(note[:end]), "\n")
+	if len(lines) < 3 {
+		return 0, nil, fmt.Errorf("checkpoint has %d lines, want at least 3", len(lines))
+	}
+	if lines[0] != origin {
+		return 0, nil, fmt.Errorf("checkpoint is for %q, want %q", lines[0], origin)
+	}
+	treeSize, err := strconv.ParseInt(lines[1], 10, 64)
+	if err != nil || treeSize < 0 || strconv.FormatInt(treeSize, 10) != lines[1] {
+		return 0, nil, fmt.Errorf("malformed checkpoint tree size %q", lines[1])
+	}
+	rootHash, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil || len(rootHash) != hashSize {
+		return 0, nil, fmt.Errorf("malformed checkpoint root hash %q", lines[2])
+	}
+	return treeSize, rootHash, nil
+}
+
+// getCheckpoint returns the log's latest checkpoint. If the log writes tiles this is
+// the checkpoint for the tiles, which can be older than the latest tree head.
+func getCheckpoint(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	if c.checkpointSigner == nil {
+		return http.StatusNotFound, errors.New("log has no checkpoint key")
+	}
+	if c.tiles != nil {
+		return serveTileFile(c, w, checkpointPath, contentTypeNote, mutableCacheControl)
+	}
+
+	// A shut down log only ever serves its final tree head.
+	var slr *trillian.SignedLogRoot
+	if c.final != nil {
+		slr = &trillian.SignedLogRoot{TreeSize: int64(c.final.STH.TreeSize), RootHash: c.final.STH.SHA256RootHash}
+	} else {
+		var err error
+		if slr, err = getLatestLogRoot(ctx, c, "GetCheckpoint"); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	etag := fmt.Sprintf("\"%d-%x\"", slr.TreeSize, slr.RootHash)
+	if checkNotModified(w, r, etag) {
+		return http.StatusNotModified, nil
+	}
+	note, err := signCheckpoint(c, *slr)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set(contentTypeHeader, contentTypeNote)
+	w.Header().Set(cacheControlHeader, mutableCacheControl)
+	if _, err := w.Write(note); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to write response data: %v", err)
+	}
+	return http.StatusOK, nil
+}
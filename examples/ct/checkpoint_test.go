@@ -0,0 +1,304 @@
+package ct
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/trillian"
+	"golang.org/x/crypto/ed25519"
+)
+
+const testCheckpointOrigin = "example.com/ct/test"
+
+// testNoteKey returns the private key of the example signer in the documentation of
+// golang.org/x/mod/sumdb/note, whose signatures are known.
+func testNoteKey(t *testing.T) ed25519.PrivateKey {
+	// PRIVATE+KEY+PeterNeumann+c74f20a3+AYEKFALVFGyNhPJEMzD1QIDr+Y7hfZx09iUvxdXHKDFz
+	seed, err := base64.StdEncoding.DecodeString("AYEKFALVFGyNhPJEMzD1QIDr+Y7hfZx09iUvxdXHKDFz")
+	if err != nil {
+		t.Fatalf("failed to decode test key: %v", err)
+	}
+	return ed25519.NewKeyFromSeed(seed[1:])
+}
+
+// testNoteSigner returns a signer for checkpoints of testCheckpointOrigin.
+func testNoteSigner(t *testing.T) *noteSigner {
+	s, err := newNoteSigner(testCheckpointOrigin, testNoteKey(t))
+	if err != nil {
+		t.Fatalf("newNoteSigner()=_,%v, want no error", err)
+	}
+	return s
+}
+
+func TestNoteSigner(t *testing.T) {
+	s, err := newNoteSigner("PeterNeumann", testNoteKey(t))
+	if err != nil {
+		t.Fatalf("newNoteSigner()=_,%v, want no error", err)
+	}
+	if got, want := s.VerifierKey(), "PeterNeumann+c74f20a3+ARpc2QcUPDhMQegwxbzhKqiBfsVkmqq/LDE4izWy10TW"; got != want {
+		t.Errorf("VerifierKey()=%q, want %q", got, want)
+	}
+
+	text := "If you think cryptography is the answer to your problem,\n" +
+		"then you don't know what your problem is.\n"
+	got, err := s.sign(text)
+	if err != nil {
+		t.Fatalf("sign()=_,%v, want no error", err)
+	}
+	want := text + "\n— PeterNeumann x08go/ZJkuBS9UG/SffcvIAQxVBtiFupLLr8pAcElZInNIuGUgYN1FFYC2pZSNXgKvqfqdngotpRZb6KE6RyyBwJnAM=\n"
+	if string(got) != want {
+		t.Errorf("sign()=%q, want %q", got, want)
+	}
+
+	for _, text := range []string{"", "no newline", "blank\n\nline\n"} {
+		if _, err := s.sign(text); err == nil {
+			t.Errorf("sign(%q)=_,nil, want error", text)
+		}
+	}
+}
+
+func TestNewNoteSigner(t *testing.T) {
+	key := testNoteKey(t)
+	var tests = []struct {
+		name    string
+		key     ed25519.PrivateKey
+		wantErr bool
+	}{
+		{name: "example.com/log", key: key},
+		{name: "", key: key, wantErr: true},
+		{name: "example.com log", key: key, wantErr: true},
+		{name: "example.com+log", key: key, wantErr: true},
+		{name: "example.com/log\n", key: key, wantErr: true},
+		{name: "bad\xffutf8", key: key, wantErr: true},
+		{name: "example.com/log", key: key[:32], wantErr: true},
+	}
+	for _, test := range tests {
+		_, err := newNoteSigner(test.name, test.key)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("newNoteSigner(%q)=_,%v, want error: %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestLoadNoteSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	var tests = []struct {
+		name    string
+		key     interface{}
+		wantErr bool
+	}{
+		{name: "ed25519", key: testNoteKey(t)},
+		{name: "ecdsa", key: ecKey, wantErr: true},
+		{name: "not-pem", wantErr: true},
+		{name: "missing", wantErr: true},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(dir, test.name)
+		switch test.name {
+		case "missing":
+		case "not-pem":
+			ioutil.WriteFile(filename, []byte("not a key"), 0600)
+		default:
+			der, err := x509.MarshalPKCS8PrivateKey(test.key)
+			if err != nil {
+				t.Fatalf("failed to marshal %s key: %v", test.name, err)
+			}
+			ioutil.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+		}
+		s, err := loadNoteSigner(testCheckpointOrigin, filename)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("loadNoteSigner(%s)=_,%v, want error: %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && s.VerifierKey() != testNoteSigner(t).VerifierKey() {
+			t.Errorf("loadNoteSigner(%s).VerifierKey()=%q, want %q", test.name, s.VerifierKey(), testNoteSigner(t).VerifierKey())
+		}
+	}
+}
+
+func TestParseCheckpoint(t *testing.T) {
+	root := []byte("abcdabcdabcdabcdabcdabcdabcdabcd")
+	rootB64 := base64.StdEncoding.EncodeToString(root)
+	var tests = []struct {
+		note     string
+		wantSize int64
+		wantErr  bool
+	}{
+		{note: testCheckpointOrigin + "\n25\n" + rootB64 + "\n\n— sig\n", wantSize: 25},
+		{note: testCheckpointOrigin + "\n0\n" + rootB64 + "\nextension\n\n— sig\n", wantSize: 0},
+		{note: testCheckpointOrigin + "\n25\n" + rootB64 + "\n", wantErr: true},
+		{note: "example.com/other\n25\n" + rootB64 + "\n\n— sig\n", wantErr: true},
+		{note: testCheckpointOrigin + "\n25\n\n— sig\n", wantErr: true},
+		{note: testCheckpointOrigin + "\n-1\n" + rootB64 + "\n\n— sig\n", wantErr: true},
+		{note: testCheckpointOrigin + "\n025\n" + rootB64 + "\n\n— sig\n", wantErr: true},
+		{note: testCheckpointOrigin + "\n25\nYWJjZA==\n\n— sig\n", wantErr: true},
+	}
+	for _, test := range tests {
+		size, gotRoot, err := parseCheckpoint(testCheckpointOrigin, sha256.Size, []byte(test.note))
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("parseCheckpoint(%q)=_,_,%v, want error: %v", test.note, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if size != test.wantSize || string(gotRoot) != string(root) {
+			t.Errorf("parseCheckpoint(%q)=%d,%x, want %d,%x", test.note, size, gotRoot, test.wantSize, root)
+		}
+	}
+}
+
+func TestGetCheckpoint(t *testing.T) {
+	root := []byte("abcdabcdabcdabcdabcdabcdabcdabcd")
+	var tests = []struct {
+		descr   string
+		signer  bool
+		final   *FinalTreeHead
+		rpcRsp  *trillian.GetLatestSignedLogRootResponse
+		rpcErr  error
+		want    int
+		errStr  string
+		wantTxt string
+	}{
+		{
+			descr:  "no-key",
+			want:   http.StatusNotFound,
+			errStr: "no checkpoint key",
+		},
+		{
+			descr:  "backend-failure",
+			signer: true,
+			rpcErr: errors.New("backendfailure"),
+			want:   http.StatusInternalServerError,
+			errStr: "request failed",
+		},
+		{
+			descr:  "bad-hash",
+			signer: true,
+			rpcRsp: makeGetRootResponseForTest(12345, 25, []byte("thisisnot32byteslong")),
+			want:   http.StatusInternalServerError,
+			errStr: "bad hash size",
+		},
+		{
+			descr:   "ok",
+			signer:  true,
+			rpcRsp:  makeGetRootResponseForTest(12345000000, 25, root),
+			want:    http.StatusOK,
+			wantTxt: checkpointText(testCheckpointOrigin, 25, root),
+		},
+		{
+			descr:   "final",
+			signer:  true,
+			final:   &FinalTreeHead{STH: ct.GetSTHResponse{TreeSize: 30, SHA256RootHash: root}},
+			want:    http.StatusOK,
+			wantTxt: checkpointText(testCheckpointOrigin, 30, root),
+		},
+	}
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	signer := testNoteSigner(t)
+
+	for _, test := range tests {
+		info.c.checkpointSigner = nil
+		if test.signer {
+			info.c.checkpointSigner = signer
+		}
+		info.c.final = test.final
+		if test.signer && test.final == nil {
+			info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), &trillian.GetLatestSignedLogRootRequest{LogId: 0x42}).Return(test.rpcRsp, test.rpcErr)
+		}
+		handler := appHandler{context: info.c, handler: getCheckpoint, name: "GetCheckpoint", method: http.MethodGet}
+		req, err := http.NewRequest("GET", "http://example.com/test/checkpoint", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if got := w.Code; got != test.want {
+			t.Errorf("GetCheckpoint(%s).Code=%d, want %d", test.descr, got, test.want)
+		}
+		if test.want != http.StatusOK {
+			if !strings.Contains(w.Body.String(), test.errStr) {
+				t.Errorf("GetCheckpoint(%s)=%q, want error with %q", test.descr, w.Body.String(), test.errStr)
+			}
+			continue
+		}
+		if got, want := w.Header().Get(contentTypeHeader), contentTypeNote; got != want {
+			t.Errorf("GetCheckpoint(%s) Content-Type=%q, want %q", test.descr, got, want)
+		}
+		text := w.Body.String()
+		sigStart := strings.Index(text, "\n\n")
+		if sigStart < 0 || text[:sigStart+1] != test.wantTxt {
+			t.Errorf("GetCheckpoint(%s)=%q, want text %q", test.descr, text, test.wantTxt)
+			continue
+		}
+		fields := strings.Fields(text[sigStart+2:])
+		if len(fields) != 3 || fields[0] != "—" || fields[1] != testCheckpointOrigin {
+			t.Errorf("GetCheckpoint(%s) has bad signature line %q", test.descr, text[sigStart+2:])
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil || len(sig) != 4+ed25519.SignatureSize || string(sig[:4]) != string(signer.keyHash) {
+			t.Errorf("GetCheckpoint(%s) has bad signature %q: %v", test.descr, fields[2], err)
+			continue
+		}
+		if !ed25519.Verify(signer.key.Public().(ed25519.PublicKey), []byte(test.wantTxt), sig[4:]) {
+			t.Errorf("GetCheckpoint(%s) signature doesn't verify", test.descr)
+		}
+	}
+}
+
+func TestGetCheckpointFromTiles(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	info.c.checkpointSigner = testNoteSigner(t)
+
+	// Logs with tiles serve the tiles' checkpoint, which isn't there until it's written.
+	store := newMemTileStore()
+	info.c.tiles = &tileWriter{store: store, height: defaultTileHeight}
+	handler := appHandler{context: info.c, handler: getCheckpoint, name: "GetCheckpoint", method: http.MethodGet}
+	for _, want := range []int{http.StatusNotFound, http.StatusOK} {
+		req, err := http.NewRequest("GET", "http://example.com/test/checkpoint", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got := w.Code; got != want {
+			t.Fatalf("GetCheckpoint().Code=%d, want %d", got, want)
+		}
+		if want == http.StatusOK {
+			if got, want := w.Body.String(), "tiled checkpoint"; got != want {
+				t.Errorf("GetCheckpoint()=%q, want %q", got, want)
+			}
+			if got, want := w.Header().Get(cacheControlHeader), mutableCacheControl; got != want {
+				t.Errorf("GetCheckpoint() Cache-Control=%q, want %q", got, want)
+			}
+		}
+		store.Put(checkpointPath, []byte("tiled checkpoint"))
+	}
+}
@@ -0,0 +1,102 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+// clientCertVerifier checks the TLS client certificates of requests to a private log's
+// POST endpoints against the log's client CAs.
+type clientCertVerifier struct {
+	roots      *x509.CertPool
+	timeSource util.TimeSource
+	exp        struct {
+		vars     *expvar.Map
+		verified *expvar.Int
+		missing  *expvar.Int
+		rejected *expvar.Int
+	}
+}
+
+// newClientCertVerifier creates a clientCertVerifier that accepts client certificates
+// issued by the CAs in the PEM file caFile.
+func newClientCertVerifier(caFile string, timeSource util.TimeSource) (*clientCertVerifier, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CAs: %v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	v := &clientCertVerifier{roots: roots, timeSource: timeSource}
+	v.exp.vars = new(expvar.Map).Init()
+	v.exp.verified = new(expvar.Int)
+	v.exp.vars.Set("verified", v.exp.verified)
+	v.exp.missing = new(expvar.Int)
+	v.exp.vars.Set("missing", v.exp.missing)
+	v.exp.rejected = new(expvar.Int)
+	v.exp.vars.Set("rejected", v.exp.rejected)
+	return v, nil
+}
+
+// Vars returns the number of requests whose client certificates were verified, missing
+// or rejected.
+func (v *clientCertVerifier) Vars() *expvar.Map {
+	return v.exp.vars
+}
+
+// verify checks the client certificate r was made with, and returns the client's identity:
+// the certificate's common name, or its SHA-256 fingerprint if it doesn't have one.
+func (v *clientCertVerifier) verify(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		v.exp.missing.Add(1)
+		return "", errors.New("a TLS client certificate is required")
+	}
+	certs := r.TLS.PeerCertificates
+	opts := x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   v.timeSource.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		v.exp.rejected.Add(1)
+		return "", fmt.Errorf("client certificate not trusted: %v", err)
+	}
+	v.exp.verified.Add(1)
+	if name := certs[0].Subject.CommonName; len(name) > 0 {
+		return name, nil
+	}
+	fingerprint := sha256.Sum256(certs[0].Raw)
+	return hex.EncodeToString(fingerprint[:]), nil
+}
+
+// clientCertMiddleware makes the POST endpoints of logs with client CAs require a
+// verified TLS client certificate, and records the client's identity in the access log,
+// where it can also be charged for an API key's quota.
+func clientCertMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		if c.clientCerts == nil || ep.Method != http.MethodPost || ep.Privileged {
+			return next(ctx, c, w, r)
+		}
+		identity, err := c.clientCerts.verify(r)
+		if err != nil {
+			return http.StatusUnauthorized, err
+		}
+		requestStateFrom(ctx).rec.ClientCert = identity
+		return next(ctx, c, w, r)
+	}
+}
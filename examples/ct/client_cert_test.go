@@ -0,0 +1,140 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestClientCertMiddleware(t *testing.T) {
+	// TLS client certificates use the standard library's x509 package rather than the
+	// CT one that createTestCert uses.
+	ctRoot, rootKey := createTestCert(t, "Client Root", true, "", nil, nil)
+	ctIntermediate, intermediateKey := createTestCert(t, "Client Intermediate", true, "", ctRoot, rootKey)
+	ctClient, _ := createTestCert(t, "ca.example.com", false, "", ctIntermediate, intermediateKey)
+	ctAnonymous, _ := createTestCert(t, "", false, "", ctRoot, rootKey)
+	ctOtherRoot, otherKey := createTestCert(t, "Other Root", true, "", nil, nil)
+	ctStranger, _ := createTestCert(t, "stranger", false, "", ctOtherRoot, otherKey)
+	root := parseStdCert(t, ctRoot.Raw)
+	intermediate := parseStdCert(t, ctIntermediate.Raw)
+	client := parseStdCert(t, ctClient.Raw)
+	anonymous := parseStdCert(t, ctAnonymous.Raw)
+	stranger := parseStdCert(t, ctStranger.Raw)
+
+	dir, err := ioutil.TempDir("", "client_cert_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "client_ca.pem")
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), 0600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	if _, err := newClientCertVerifier(filepath.Join(dir, "missing.pem"), fakeTimeSource); err == nil {
+		t.Errorf("newClientCertVerifier(missing)=_,nil, want error")
+	}
+	v, err := newClientCertVerifier(caFile, fakeTimeSource)
+	if err != nil {
+		t.Fatalf("newClientCertVerifier()=_,%v, want no error", err)
+	}
+	keys, err := newAPIKeys([]APIKeyConfig{{Name: "example-ca", ClientCertName: "ca.example.com", SubmissionsPerSecond: 1, SubmissionBurst: 1}}, true, fakeTimeSource)
+	if err != nil {
+		t.Fatalf("newAPIKeys()=_,%v, want no error", err)
+	}
+
+	var tests = []struct {
+		descr        string
+		name         string // endpoint
+		method       string
+		privileged   bool
+		certs        []*x509.Certificate // nil for plain HTTP
+		want         int
+		wantIdentity string
+		wantKey      string
+	}{
+		{descr: "plain-http", name: "AddChain", method: http.MethodPost, want: http.StatusUnauthorized},
+		{descr: "no-cert", name: "AddChain", method: http.MethodPost, certs: []*x509.Certificate{}, want: http.StatusUnauthorized},
+		{descr: "untrusted", name: "AddChain", method: http.MethodPost, certs: []*x509.Certificate{stranger}, want: http.StatusUnauthorized},
+		{descr: "no-intermediate", name: "AddChain", method: http.MethodPost, certs: []*x509.Certificate{client}, want: http.StatusUnauthorized},
+		{descr: "verified", name: "AddChain", method: http.MethodPost, certs: []*x509.Certificate{client, intermediate}, want: http.StatusOK, wantIdentity: "ca.example.com", wantKey: "example-ca"},
+		{descr: "over-quota", name: "AddPreChain", method: http.MethodPost, certs: []*x509.Certificate{client, intermediate}, want: http.StatusTooManyRequests, wantIdentity: "ca.example.com", wantKey: "example-ca"},
+		// Verified clients without a key are rejected as the keys are required.
+		{descr: "no-key", name: "AddChain", method: http.MethodPost, certs: []*x509.Certificate{anonymous}, want: http.StatusUnauthorized, wantIdentity: fingerprintHex(anonymous)},
+		{descr: "get", name: "GetSTH", method: http.MethodGet, want: http.StatusOK},
+		{descr: "privileged", name: "AdminAddRoot", method: http.MethodPost, privileged: true, want: http.StatusUnauthorized},
+	}
+
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	info.c.clientCerts = v
+	info.c.apiKeys = keys
+	sink := &recordingAccessLog{}
+	info.c.accessLog = sink
+
+	for _, test := range tests {
+		sink.recs = nil
+		handler := appHandler{context: info.c, name: test.name, method: test.method, privileged: test.privileged,
+			handler: func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+				return http.StatusOK, nil
+			}}
+		req, err := http.NewRequest(test.method, "https://example.com/ct/v1/add-chain", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if test.certs != nil {
+			req.TLS = &tls.ConnectionState{PeerCertificates: test.certs}
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if got := w.Code; got != test.want {
+			t.Errorf("%s: ServeHTTP()=%d (body:%v), want %d", test.descr, got, w.Body, test.want)
+		}
+		if test.privileged {
+			// The request isn't signed, which is why it fails.
+			if body := w.Body.String(); !strings.Contains(body, "signature") {
+				t.Errorf("%s: ServeHTTP() body %q, want signature error", test.descr, body)
+			}
+			continue
+		}
+		if len(sink.recs) != 1 || sink.recs[0].ClientCert != test.wantIdentity || sink.recs[0].APIKey != test.wantKey {
+			t.Errorf("%s: logged %+v, want client %q and API key %q", test.descr, sink.recs, test.wantIdentity, test.wantKey)
+		}
+	}
+
+	for _, want := range []struct {
+		name, value string
+	}{
+		{"verified", "3"},
+		{"missing", "2"},
+		{"rejected", "2"},
+	} {
+		if got := v.Vars().Get(want.name).String(); got != want.value {
+			t.Errorf("%s=%s, want %s", want.name, got, want.value)
+		}
+	}
+}
+
+func fingerprintHex(cert *x509.Certificate) string {
+	fingerprint := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(fingerprint[:])
+}
+
+func parseStdCert(t *testing.T, der []byte) *x509.Certificate {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return cert
+}
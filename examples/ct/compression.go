@@ -0,0 +1,126 @@
+package ct
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HTTP request header listing the content codings the client accepts
+	acceptEncodingHeader = "Accept-Encoding"
+	// HTTP response header naming the content coding applied to the body
+	contentEncodingHeader = "Content-Encoding"
+	// HTTP response header telling caches which request headers affect the response
+	varyHeader = "Vary"
+	// Content codings we support, in order of preference
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// negotiateEncoding picks the response content coding to use based on the value of an
+// Accept-Encoding request header. It returns an empty string if the response should not
+// be compressed.
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if len(coding) == 0 {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		accepted[coding] = q > 0
+	}
+
+	for _, coding := range []string{encodingGzip, encodingDeflate} {
+		if ok, present := accepted[coding]; ok || (!present && accepted["*"]) {
+			return coding
+		}
+	}
+	return ""
+}
+
+// compressingResponseWriter is an http.ResponseWriter that transparently compresses
+// the response body. Close must be called once the handler has finished writing.
+type compressingResponseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	w           compressor
+	wroteHeader bool
+}
+
+// newCompressingResponseWriter wraps w so that the response body is compressed using
+// the given content coding, which must be one returned by negotiateEncoding.
+func newCompressingResponseWriter(w http.ResponseWriter, encoding string) *compressingResponseWriter {
+	return &compressingResponseWriter{ResponseWriter: w, encoding: encoding}
+}
+
+// WriteHeader sets the content coding headers, unless the status code means the
+// response has no body, before writing the status code.
+func (c *compressingResponseWriter) WriteHeader(code int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	if code != http.StatusNotModified && code != http.StatusNoContent {
+		h := c.Header()
+		h.Set(contentEncodingHeader, c.encoding)
+		h.Del("Content-Length")
+		switch c.encoding {
+		case encodingGzip:
+			c.w = gzip.NewWriter(c.ResponseWriter)
+		case encodingDeflate:
+			// The HTTP deflate coding is the zlib format, see RFC 7230 section 4.2.2.
+			c.w = zlib.NewWriter(c.ResponseWriter)
+		}
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+// Write compresses b into the underlying response.
+func (c *compressingResponseWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.w == nil {
+		return c.ResponseWriter.Write(b)
+	}
+	return c.w.Write(b)
+}
+
+// compressor is the interface of the gzip and zlib writers.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// Flush sends the data compressed so far to the client, for streamed responses.
+func (c *compressingResponseWriter) Flush() {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.w != nil {
+		c.w.Flush()
+	}
+	flushResponse(c.ResponseWriter)
+}
+
+// Close flushes any buffered compressed data to the underlying response.
+func (c *compressingResponseWriter) Close() error {
+	if c.w == nil {
+		return nil
+	}
+	return c.w.Close()
+}
@@ -0,0 +1,122 @@
+package ct
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/trillian/examples/ct/testonly"
+	"golang.org/x/net/context"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	var tests = []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", encodingGzip},
+		{"GZIP", encodingGzip},
+		{"deflate", encodingDeflate},
+		{"deflate, gzip", encodingGzip},
+		{"gzip;q=0, deflate", encodingDeflate},
+		{"gzip;q=0.0, deflate;q=0", ""},
+		{"br, gzip;q=0.5", encodingGzip},
+		{"*", encodingGzip},
+		{"*, gzip;q=0", encodingDeflate},
+		{"compress, br", ""},
+	}
+	for _, test := range tests {
+		if got := negotiateEncoding(test.acceptEncoding); got != test.want {
+			t.Errorf("negotiateEncoding(%q)=%q; want %q", test.acceptEncoding, got, test.want)
+		}
+	}
+}
+
+func TestCompressedResponses(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"leaf_input":"AAAAAAAAAAAAAAAAAAAA","extra_data":"AAAAAAAAAAAAAAAAAAAA"},`), 100)
+	writeBody := func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		w.Header().Set(contentTypeHeader, contentTypeJSON)
+		w.Write(body)
+		return http.StatusOK, nil
+	}
+	notModified := func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		w.WriteHeader(http.StatusNotModified)
+		return http.StatusNotModified, nil
+	}
+
+	var tests = []struct {
+		descr          string
+		disabled       bool
+		acceptEncoding string
+		handler        func(context.Context, LogContext, http.ResponseWriter, *http.Request) (int, error)
+		wantStatus     int
+		wantEncoding   string
+	}{
+		{descr: "none", handler: writeBody, wantStatus: http.StatusOK},
+		{descr: "gzip", acceptEncoding: "gzip", handler: writeBody, wantStatus: http.StatusOK, wantEncoding: encodingGzip},
+		{descr: "deflate", acceptEncoding: "deflate", handler: writeBody, wantStatus: http.StatusOK, wantEncoding: encodingDeflate},
+		{descr: "disabled", disabled: true, acceptEncoding: "gzip", handler: writeBody, wantStatus: http.StatusOK},
+		{descr: "not-modified", acceptEncoding: "gzip", handler: notModified, wantStatus: http.StatusNotModified},
+	}
+
+	info := setupTest(t, []string{testonly.FakeCACertPEM})
+	defer info.mockCtrl.Finish()
+
+	for _, test := range tests {
+		c := info.c
+		c.compressResponses = !test.disabled
+		handler := appHandler{context: c, handler: test.handler, name: "GetEntries", method: http.MethodGet}
+		req, err := http.NewRequest("GET", "http://example.com/ct/v1/get-entries", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if test.acceptEncoding != "" {
+			req.Header.Set(acceptEncodingHeader, test.acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if got := w.Code; got != test.wantStatus {
+			t.Errorf("ServeHTTP(%s).Code=%d; want %d", test.descr, got, test.wantStatus)
+			continue
+		}
+		if got := w.Header().Get(contentEncodingHeader); got != test.wantEncoding {
+			t.Errorf("ServeHTTP(%s) Content-Encoding=%q; want %q", test.descr, got, test.wantEncoding)
+		}
+		if test.wantStatus != http.StatusOK {
+			if w.Body.Len() != 0 {
+				t.Errorf("ServeHTTP(%s)=%q; want empty body", test.descr, w.Body.Bytes())
+			}
+			continue
+		}
+
+		var r io.Reader = w.Body
+		switch test.wantEncoding {
+		case encodingGzip:
+			if r, err = gzip.NewReader(w.Body); err != nil {
+				t.Errorf("ServeHTTP(%s): gzip.NewReader()=%v", test.descr, err)
+				continue
+			}
+		case encodingDeflate:
+			if r, err = zlib.NewReader(w.Body); err != nil {
+				t.Errorf("ServeHTTP(%s): zlib.NewReader()=%v", test.descr, err)
+				continue
+			}
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("ServeHTTP(%s): failed to read body: %v", test.descr, err)
+			continue
+		}
+		if !bytes.Equal(got, body) {
+			t.Errorf("ServeHTTP(%s)=%q; want %q", test.descr, got, body)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package ct
+
+import (
+	"expvar"
+	"fmt"
+)
+
+// concurrencyRetryAfter is the Retry-After, in seconds, sent with requests rejected
+// because their endpoint is at its concurrency limit.
+const concurrencyRetryAfter = "1"
+
+// concurrencyLimiter bounds the number of requests to each of a log's endpoints that are
+// handled at once, so that a burst of expensive requests to one endpoint, e.g.
+// get-entries, can't tie up the backend connections that the others, e.g. add-chain,
+// need. Requests beyond an endpoint's limit fail straight away, rather than queueing
+// behind the ones in progress.
+type concurrencyLimiter struct {
+	// slots holds a semaphore for each limited endpoint, with one element for each
+	// request in progress.
+	slots map[string]chan struct{}
+	exp   struct {
+		vars     *expvar.Map
+		inFlight *expvar.Map // entrypoint => expvar.Int
+		rejected *expvar.Map // entrypoint => expvar.Int
+	}
+}
+
+// newConcurrencyLimiter creates a concurrencyLimiter for limits, which maps entrypoint
+// names to the most requests to them handled at once.
+func newConcurrencyLimiter(limits map[string]int) (*concurrencyLimiter, error) {
+	valid := make(map[string]bool)
+	for _, ep := range append(append(Entrypoints, V2Entrypoints...), GossipEntrypoints...) {
+		valid[ep] = true
+	}
+	l := &concurrencyLimiter{slots: make(map[string]chan struct{})}
+	l.exp.vars = new(expvar.Map).Init()
+	l.exp.inFlight = new(expvar.Map).Init()
+	l.exp.vars.Set("in-flight", l.exp.inFlight)
+	l.exp.rejected = new(expvar.Map).Init()
+	l.exp.vars.Set("rejected", l.exp.rejected)
+	for name, limit := range limits {
+		if !valid[name] {
+			return nil, fmt.Errorf("unknown entrypoint in MaxConcurrentRequests: %s", name)
+		}
+		if limit <= 0 {
+			return nil, fmt.Errorf("MaxConcurrentRequests for %s must be positive, got %d", name, limit)
+		}
+		l.slots[name] = make(chan struct{}, limit)
+		l.exp.inFlight.Set(name, new(expvar.Int))
+		l.exp.rejected.Set(name, new(expvar.Int))
+	}
+	return l, nil
+}
+
+// Vars returns the statistics exported by this concurrencyLimiter.
+func (l *concurrencyLimiter) Vars() *expvar.Map {
+	return l.exp.vars
+}
+
+// acquire takes a slot for a request to the named endpoint. It returns false if the
+// endpoint is already handling as many requests as it may, otherwise the caller must call
+// release once the request is done. Endpoints without a limit always have a slot.
+func (l *concurrencyLimiter) acquire(name string) bool {
+	slots, ok := l.slots[name]
+	if !ok {
+		return true
+	}
+	select {
+	case slots <- struct{}{}:
+		l.exp.inFlight.Add(name, 1)
+		return true
+	default:
+		l.exp.rejected.Add(name, 1)
+		return false
+	}
+}
+
+// release gives back a slot taken by acquire.
+func (l *concurrencyLimiter) release(name string) {
+	if slots, ok := l.slots[name]; ok {
+		<-slots
+		l.exp.inFlight.Add(name, -1)
+	}
+}
@@ -0,0 +1,124 @@
+package ct
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestNewConcurrencyLimiter(t *testing.T) {
+	var tests = []struct {
+		limits  map[string]int
+		wantErr bool
+	}{
+		{limits: map[string]int{"GetEntries": 10, "V2GetEntries": 5, "STHPollination": 1}},
+		{limits: map[string]int{"GetEverything": 10}, wantErr: true},
+		{limits: map[string]int{"GetEntries": 0}, wantErr: true},
+		{limits: map[string]int{"AddChain": -1}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		_, err := newConcurrencyLimiter(test.limits)
+		if got, want := err != nil, test.wantErr; got != want {
+			t.Errorf("newConcurrencyLimiter(%v)=_,%v, want error: %v", test.limits, err, want)
+		}
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	l, err := newConcurrencyLimiter(map[string]int{"GetEntries": 2})
+	if err != nil {
+		t.Fatalf("newConcurrencyLimiter()=_,%v", err)
+	}
+
+	var steps = []struct {
+		release string
+		acquire string
+		want    bool
+	}{
+		{acquire: "GetEntries", want: true},
+		{acquire: "GetEntries", want: true},
+		{acquire: "GetEntries", want: false},
+		// Other endpoints aren't limited.
+		{acquire: "AddChain", want: true},
+		{release: "GetEntries", acquire: "GetEntries", want: true},
+		{acquire: "GetEntries", want: false},
+	}
+	for i, step := range steps {
+		if len(step.release) > 0 {
+			l.release(step.release)
+		}
+		if got := l.acquire(step.acquire); got != step.want {
+			t.Errorf("%d: acquire(%s)=%v, want %v", i, step.acquire, got, step.want)
+		}
+	}
+	if got, want := l.exp.inFlight.Get("GetEntries").String(), "2"; got != want {
+		t.Errorf("in-flight[GetEntries]=%s, want %s", got, want)
+	}
+	if got, want := l.exp.rejected.Get("GetEntries").String(), "2"; got != want {
+		t.Errorf("rejected[GetEntries]=%s, want %s", got, want)
+	}
+}
+
+func TestConcurrencyMiddleware(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	var err error
+	if info.c.concurrency, err = newConcurrencyLimiter(map[string]int{"GetEntries": 1}); err != nil {
+		t.Fatalf("newConcurrencyLimiter()=_,%v", err)
+	}
+
+	// The first get-entries request is held until the others have been made.
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	blocking := func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		close(started)
+		<-finish
+		return http.StatusOK, nil
+	}
+	serve := func(name string, handler EndpointHandler) *httptest.ResponseRecorder {
+		h := appHandler{context: info.c, handler: handler, name: name, method: http.MethodGet}
+		req, err := http.NewRequest("GET", "http://example.com/ct/v1/endpoint", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	done := make(chan int)
+	go func() {
+		done <- serve("GetEntries", blocking).Code
+	}()
+	<-started
+
+	var tests = []struct {
+		name      string
+		want      int
+		wantRetry string
+	}{
+		{name: "GetEntries", want: http.StatusServiceUnavailable, wantRetry: concurrencyRetryAfter},
+		{name: "GetSTH", want: http.StatusOK},
+	}
+	for _, test := range tests {
+		w := serve(test.name, okHandler)
+		if got, want := w.Code, test.want; got != want {
+			t.Errorf("%s: status=%d, want %d", test.name, got, want)
+		}
+		if got, want := w.Header().Get(retryAfterHeader), test.wantRetry; got != want {
+			t.Errorf("%s: Retry-After=%q, want %q", test.name, got, want)
+		}
+	}
+
+	close(finish)
+	if got, want := <-done, http.StatusOK; got != want {
+		t.Errorf("first GetEntries: status=%d, want %d", got, want)
+	}
+	// The slot is free again.
+	if got, want := serve("GetEntries", okHandler).Code, http.StatusOK; got != want {
+		t.Errorf("GetEntries after release: status=%d, want %d", got, want)
+	}
+}
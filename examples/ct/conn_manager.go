@@ -0,0 +1,228 @@
+package ct
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+)
+
+// ChannelConn is the connection underlying a channel to a backend, as implemented by
+// *grpc.ClientConn.
+type ChannelConn interface {
+	GetState() connectivity.State
+	Close() error
+}
+
+// BackendChannel is a connection to a backend and the client that makes RPCs over it.
+type BackendChannel struct {
+	Conn   ChannelConn
+	Client trillian.TrillianLogClient
+}
+
+// ChannelDialFunc opens a new channel to the backend at addr. It shouldn't wait for the
+// connection to be established.
+type ChannelDialFunc func(addr string) (BackendChannel, error)
+
+type managedChannel struct {
+	BackendChannel
+	// brokenSince is when the channel was first seen to be failing, zero if it isn't.
+	brokenSince time.Time
+}
+
+// ConnManager keeps a number of channels open to a single backend and spreads RPCs over
+// them. Channels that fail for longer than a grace period, or are shut down, are
+// replaced with newly dialed ones in the background, rather than waiting for gRPC's
+// reconnection backoff, so that a backend that restarts is used again quickly.
+type ConnManager struct {
+	routedLogClient
+
+	addr        string
+	dial        ChannelDialFunc
+	timeSource  util.TimeSource
+	redialAfter time.Duration
+	next        uint32
+
+	mu       sync.RWMutex
+	channels []*managedChannel
+
+	vars          *expvar.Map
+	readyChannels *expvar.Int
+	redials       *expvar.Int
+	redialErrors  *expvar.Int
+}
+
+// NewConnManager dials n channels to the backend at addr. A channel that has been failing
+// for redialAfter is replaced with a new one by Check.
+func NewConnManager(addr string, n int, dial ChannelDialFunc, timeSource util.TimeSource, redialAfter time.Duration) (*ConnManager, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("need at least one channel, got %d", n)
+	}
+	m := &ConnManager{
+		addr:          addr,
+		dial:          dial,
+		timeSource:    timeSource,
+		redialAfter:   redialAfter,
+		vars:          new(expvar.Map).Init(),
+		readyChannels: new(expvar.Int),
+		redials:       new(expvar.Int),
+		redialErrors:  new(expvar.Int),
+	}
+	m.routedLogClient = routedLogClient{route: m.call}
+	m.vars.Set("ready-channels", m.readyChannels)
+	m.vars.Set("redials", m.redials)
+	m.vars.Set("redial-errors", m.redialErrors)
+
+	for i := 0; i < n; i++ {
+		c, err := dial(addr)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		m.channels = append(m.channels, &managedChannel{BackendChannel: c})
+	}
+	return m, nil
+}
+
+// Addr returns the address of the backend.
+func (m *ConnManager) Addr() string {
+	return m.addr
+}
+
+// Vars returns the stats of the channels: how many are ready, how many have been
+// redialed and how many redials failed.
+func (m *ConnManager) Vars() *expvar.Map {
+	return m.vars
+}
+
+// Close closes all the channels.
+func (m *ConnManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.channels {
+		c.Conn.Close()
+	}
+}
+
+func isBroken(state connectivity.State) bool {
+	return state == connectivity.TransientFailure || state == connectivity.Shutdown
+}
+
+// Ready returns true if at least one channel is connected.
+func (m *ConnManager) Ready() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, c := range m.channels {
+		if c.Conn.GetState() == connectivity.Ready {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns an error if every channel is failing, for use as a Backend's ConnErr. An
+// idle channel is fine, it will connect on the next RPC.
+func (m *ConnManager) Err() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, c := range m.channels {
+		if !isBroken(c.Conn.GetState()) {
+			return nil
+		}
+	}
+	return errors.New("all channels are failing")
+}
+
+// order returns the clients of the channels in the order an RPC should try them: the
+// channels that aren't failing first, starting from the next in turn.
+func (m *ConnManager) order() []trillian.TrillianLogClient {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	start := int(atomic.AddUint32(&m.next, 1) % uint32(len(m.channels)))
+	ok := make([]trillian.TrillianLogClient, 0, len(m.channels))
+	var broken []trillian.TrillianLogClient
+	for i := range m.channels {
+		c := m.channels[(start+i)%len(m.channels)]
+		if isBroken(c.Conn.GetState()) {
+			broken = append(broken, c.Client)
+		} else {
+			ok = append(ok, c.Client)
+		}
+	}
+	return append(ok, broken...)
+}
+
+// call makes an RPC over the next channel, trying the others if it fails as unavailable.
+func (m *ConnManager) call(ctx context.Context, method string, read bool, rpc func(trillian.TrillianLogClient) error) error {
+	var err error
+	for _, client := range m.order() {
+		if err = rpc(client); status.Code(err) != codes.Unavailable || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// Check updates the stats of the channels, and replaces those that are shut down or
+// have been failing for longer than the redial period with new ones.
+func (m *ConnManager) Check() {
+	now := m.timeSource.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ready := 0
+	for i, c := range m.channels {
+		state := c.Conn.GetState()
+		if state == connectivity.Ready {
+			ready++
+		}
+		if !isBroken(state) {
+			c.brokenSince = time.Time{}
+			continue
+		}
+		if c.brokenSince.IsZero() {
+			c.brokenSince = now
+		}
+		if state != connectivity.Shutdown && now.Sub(c.brokenSince) < m.redialAfter {
+			continue
+		}
+
+		glog.Warningf("%s: channel %d has been %v since %v, redialing", m.addr, i, state, c.brokenSince)
+		m.redials.Add(1)
+		fresh, err := m.dial(m.addr)
+		if err != nil {
+			glog.Warningf("%s: failed to redial channel %d: %v", m.addr, i, err)
+			m.redialErrors.Add(1)
+			continue
+		}
+		c.Conn.Close()
+		m.channels[i] = &managedChannel{BackendChannel: fresh}
+	}
+	m.readyChannels.Set(int64(ready))
+}
+
+// Run checks the channels every interval until ctx is done.
+func (m *ConnManager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check()
+		}
+	}
+}
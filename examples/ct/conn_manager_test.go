@@ -0,0 +1,185 @@
+package ct
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/mockclient"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/connectivity"
+)
+
+type fakeChannelConn struct {
+	state  connectivity.State
+	closed bool
+}
+
+func (c *fakeChannelConn) GetState() connectivity.State {
+	return c.state
+}
+
+func (c *fakeChannelConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+// fakeDialer hands out channels with mock clients, recording what it dialed.
+type fakeDialer struct {
+	ctrl    *gomock.Controller
+	conns   []*fakeChannelConn
+	clients []*mockclient.MockTrillianLogClient
+	err     error
+}
+
+func (d *fakeDialer) dial(addr string) (BackendChannel, error) {
+	if d.err != nil {
+		return BackendChannel{}, d.err
+	}
+	conn := &fakeChannelConn{state: connectivity.Ready}
+	client := mockclient.NewMockTrillianLogClient(d.ctrl)
+	d.conns = append(d.conns, conn)
+	d.clients = append(d.clients, client)
+	return BackendChannel{Conn: conn, Client: client}, nil
+}
+
+func TestConnManagerRotates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	d := &fakeDialer{ctrl: ctrl}
+	m, err := NewConnManager("backend:8090", 3, d.dial, fakeTimeSource, time.Second)
+	if err != nil {
+		t.Fatalf("NewConnManager()=_,%v, want no error", err)
+	}
+
+	req := &trillian.GetSequencedLeafCountRequest{LogId: 1}
+	rsp := &trillian.GetSequencedLeafCountResponse{}
+	d.clients[0].EXPECT().GetSequencedLeafCount(gomock.Any(), req).Times(2).Return(rsp, nil)
+	d.clients[1].EXPECT().GetSequencedLeafCount(gomock.Any(), req).Times(2).Return(rsp, nil)
+	// A failing channel is only used when there's nothing better.
+	d.conns[2].state = connectivity.TransientFailure
+
+	for i := 0; i < 4; i++ {
+		if got, err := m.GetSequencedLeafCount(context.Background(), req); err != nil || got != rsp {
+			t.Errorf("GetSequencedLeafCount()=%v,%v, want %v,nil", got, err, rsp)
+		}
+	}
+}
+
+func TestConnManagerRetriesUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	d := &fakeDialer{ctrl: ctrl}
+	m, err := NewConnManager("backend:8090", 2, d.dial, fakeTimeSource, time.Second)
+	if err != nil {
+		t.Fatalf("NewConnManager()=_,%v, want no error", err)
+	}
+
+	// The first RPC starts on the second channel.
+	req := &trillian.QueueLeavesRequest{LogId: 1}
+	rsp := &trillian.QueueLeavesResponse{}
+	gomock.InOrder(
+		d.clients[1].EXPECT().QueueLeaves(gomock.Any(), req).Return(nil, errUnavailable),
+		d.clients[0].EXPECT().QueueLeaves(gomock.Any(), req).Return(rsp, nil),
+	)
+	if got, err := m.QueueLeaves(context.Background(), req); err != nil || got != rsp {
+		t.Errorf("QueueLeaves()=%v,%v, want %v,nil", got, err, rsp)
+	}
+}
+
+func TestConnManagerCheck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	d := &fakeDialer{ctrl: ctrl}
+	timeSource := &util.FakeTimeSource{FakeTime: fakeTime}
+	m, err := NewConnManager("backend:8090", 3, d.dial, timeSource, time.Minute)
+	if err != nil {
+		t.Fatalf("NewConnManager()=_,%v, want no error", err)
+	}
+	original := append([]*fakeChannelConn(nil), d.conns...)
+
+	original[0].state = connectivity.TransientFailure
+	original[1].state = connectivity.Shutdown
+	m.Check()
+	// The shut down channel is replaced straight away, the failing one gets a grace period.
+	if original[0].closed || !original[1].closed || original[2].closed {
+		t.Errorf("after first Check() closed=%v,%v,%v, want false,true,false", original[0].closed, original[1].closed, original[2].closed)
+	}
+	if got, want := len(d.conns), 4; got != want {
+		t.Errorf("after first Check() dialed %d channels, want %d", got, want)
+	}
+	if got, want := m.Vars().Get("ready-channels").String(), "1"; got != want {
+		t.Errorf("ready-channels=%s, want %s", got, want)
+	}
+
+	timeSource.FakeTime = timeSource.FakeTime.Add(time.Minute)
+	m.Check()
+	if !original[0].closed {
+		t.Errorf("Check() didn't replace channel failing for %v", time.Minute)
+	}
+	if got, want := m.Vars().Get("redials").String(), "2"; got != want {
+		t.Errorf("redials=%s, want %s", got, want)
+	}
+	if err := m.Err(); err != nil {
+		t.Errorf("Err()=%v, want nil", err)
+	}
+
+	// A channel that can't be redialed is kept until it can be.
+	d.conns[2].state = connectivity.TransientFailure
+	d.err = errors.New("dial failed")
+	timeSource.FakeTime = timeSource.FakeTime.Add(time.Minute)
+	m.Check()
+	m.Check()
+	timeSource.FakeTime = timeSource.FakeTime.Add(time.Minute)
+	m.Check()
+	if got, want := m.Vars().Get("redial-errors").String(), "1"; got != want {
+		t.Errorf("redial-errors=%s, want %s", got, want)
+	}
+	if d.conns[2].closed {
+		t.Errorf("Check() closed channel it couldn't replace")
+	}
+}
+
+func TestConnManagerErr(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	d := &fakeDialer{ctrl: ctrl}
+	m, err := NewConnManager("backend:8090", 2, d.dial, fakeTimeSource, time.Second)
+	if err != nil {
+		t.Fatalf("NewConnManager()=_,%v, want no error", err)
+	}
+
+	var tests = []struct {
+		states    []connectivity.State
+		wantErr   bool
+		wantReady bool
+	}{
+		{states: []connectivity.State{connectivity.Ready, connectivity.Ready}, wantReady: true},
+		{states: []connectivity.State{connectivity.Idle, connectivity.TransientFailure}},
+		{states: []connectivity.State{connectivity.TransientFailure, connectivity.Ready}, wantReady: true},
+		{states: []connectivity.State{connectivity.TransientFailure, connectivity.Shutdown}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		for i, state := range test.states {
+			d.conns[i].state = state
+		}
+		if err := m.Err(); (err != nil) != test.wantErr {
+			t.Errorf("Err(%v)=%v, want error: %v", test.states, err, test.wantErr)
+		}
+		if got := m.Ready(); got != test.wantReady {
+			t.Errorf("Ready(%v)=%v, want %v", test.states, got, test.wantReady)
+		}
+	}
+
+	d.err = errors.New("dial failed")
+	if _, err := NewConnManager("backend:8090", 2, d.dial, fakeTimeSource, time.Second); err == nil {
+		t.Errorf("NewConnManager()=_,nil, want error when dialing fails")
+	}
+	if _, err := NewConnManager("backend:8090", 0, d.dial, fakeTimeSource, time.Second); err == nil {
+		t.Errorf("NewConnManager(0 channels)=_,nil, want error")
+	}
+}
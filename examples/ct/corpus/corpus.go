@@ -0,0 +1,116 @@
+// Package corpus builds and checks corpora of SCTs issued by a CT log, so that the log's
+// behavior can be validated offline by anyone holding the log's public key, without
+// access to its API.
+//
+// A corpus file holds one JSON encoded Bundle per line. Each bundle is self contained: it
+// holds a chain submitted to the log, the SCT the log issued for it, a tree head signed
+// by the log and the proof that the entry for the SCT is included in that tree. Binary
+// values are base64 encoded, and TLS structures are encoded as in RFC 6962, e.g.
+//
+//	{"chain":["MIIC...","MIID..."],"sct":"AHzF...","leaf_index":1234,
+//	 "audit_path":["Oq8F...","tdF0..."],
+//	 "sth":{"tree_size":2000,"timestamp":1466179200000,"sha256_root_hash":"ZfcF...","tree_head_signature":"BAMA..."}}
+package corpus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+)
+
+// Bundle is the evidence of the log's handling of one submitted chain.
+type Bundle struct {
+	// Chain is the chain as submitted, leaf first, with each certificate DER encoded.
+	Chain [][]byte `json:"chain"`
+	// Precert is set if the leaf is a precertificate, submitted with add-pre-chain.
+	Precert bool `json:"precert,omitempty"`
+	// SCT is the TLS encoded SignedCertificateTimestamp issued for the chain.
+	SCT []byte `json:"sct"`
+	// LeafIndex is the index of the entry for the SCT in the log.
+	LeafIndex int64 `json:"leaf_index"`
+	// AuditPath is the inclusion proof of the entry in the tree described by STH.
+	AuditPath [][]byte `json:"audit_path"`
+	// STH is the tree head the proof leads to, as served by get-sth.
+	STH ct.GetSTHResponse `json:"sth"`
+}
+
+// Writer writes bundles to a corpus file.
+type Writer struct {
+	enc *json.Encoder
+}
+
+// NewWriter returns a Writer that appends bundles to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{enc: json.NewEncoder(w)}
+}
+
+// Write appends b to the corpus, on a line of its own.
+func (w *Writer) Write(b *Bundle) error {
+	return w.enc.Encode(b)
+}
+
+// Reader reads bundles from a corpus file.
+type Reader struct {
+	dec *json.Decoder
+}
+
+// NewReader returns a Reader of the bundles in r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{dec: json.NewDecoder(r)}
+}
+
+// Read returns the next bundle in the corpus, or io.EOF once they have all been read.
+func (r *Reader) Read() (*Bundle, error) {
+	var b Bundle
+	if err := r.dec.Decode(&b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// parseChain parses the certificates of a chain, which must have an issuer for a
+// precertificate.
+func parseChain(chain [][]byte, precert bool) ([]*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("empty chain")
+	}
+	if precert && len(chain) < 2 {
+		return nil, fmt.Errorf("no issuer for precertificate")
+	}
+	certs := make([]*x509.Certificate, len(chain))
+	for i, der := range chain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			if _, ok := err.(x509.NonFatalErrors); !ok {
+				return nil, fmt.Errorf("failed to parse chain[%d]: %v", i, err)
+			}
+		}
+		certs[i] = cert
+	}
+	return certs, nil
+}
+
+// merkleLeaf returns the log entry that an SCT with the timestamp and extensions of sct
+// commits to for chain, and its Merkle leaf hash.
+func merkleLeaf(chain []*x509.Certificate, precert bool, sct ct.SignedCertificateTimestamp) (*ct.MerkleTreeLeaf, []byte, error) {
+	entryType := ct.X509LogEntryType
+	if precert {
+		entryType = ct.PrecertLogEntryType
+	}
+	leaf, err := ct.MerkleTreeLeafFromChain(chain, entryType, sct.Timestamp)
+	if err != nil {
+		return nil, nil, err
+	}
+	leaf.TimestampedEntry.Extensions = sct.Extensions
+	data, err := tls.Marshal(*leaf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to serialize leaf: %v", err)
+	}
+	return leaf, merkle.NewRFC6962TreeHasher(crypto.NewSHA256()).HashLeaf(data), nil
+}
@@ -0,0 +1,232 @@
+package corpus
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian/examples/ct/testonly"
+	"golang.org/x/net/context"
+)
+
+// fakeLog serves a testonly.FakeLog that merges the entries submitted to it at every
+// other request for its tree head.
+type fakeLog struct {
+	*testonly.FakeLog
+	now    uint64
+	queued [][]byte
+	// neverMerge stops entries being merged at all.
+	neverMerge bool
+	sthCalls   int
+}
+
+func newFakeLog(t *testing.T) *fakeLog {
+	return &fakeLog{FakeLog: testonly.NewFakeLog(t), now: 1466179200000}
+}
+
+func (l *fakeLog) add(chain []ct.ASN1Cert, entryType ct.LogEntryType) (*ct.SignedCertificateTimestamp, error) {
+	l.now++
+	leaf, err := ct.MerkleTreeLeafFromRawChain(chain, entryType, l.now)
+	if err != nil {
+		return nil, err
+	}
+	sct := ct.SignedCertificateTimestamp{SCTVersion: ct.V1, Timestamp: l.now}
+	l.SignSCT(&sct, *leaf)
+	data, err := tls.Marshal(*leaf)
+	if err != nil {
+		return nil, err
+	}
+	l.queued = append(l.queued, data)
+	return &sct, nil
+}
+
+func (l *fakeLog) AddChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+	return l.add(chain, ct.X509LogEntryType)
+}
+
+func (l *fakeLog) AddPreChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+	return l.add(chain, ct.PrecertLogEntryType)
+}
+
+func (l *fakeLog) GetSTH(ctx context.Context) (*ct.SignedTreeHead, error) {
+	l.sthCalls++
+	if !l.neverMerge && l.sthCalls%2 == 0 {
+		for _, data := range l.queued {
+			l.Add(data)
+		}
+		l.queued = nil
+	}
+	l.now++
+	sth := l.TreeHead(l.Size(), l.now)
+	l.SignTreeHead(&sth)
+	return &sth, nil
+}
+
+func (l *fakeLog) GetProofByHash(ctx context.Context, hash []byte, treeSize uint64) (*ct.GetProofByHashResponse, error) {
+	return l.ProofByHash(hash, treeSize)
+}
+
+func chainFromPEM(t *testing.T, pemCerts ...string) []ct.ASN1Cert {
+	var chain []ct.ASN1Cert
+	for _, p := range pemCerts {
+		block, _ := pem.Decode([]byte(p))
+		if block == nil {
+			t.Fatalf("Failed to decode PEM certificate")
+		}
+		chain = append(chain, ct.ASN1Cert{Data: block.Bytes})
+	}
+	return chain
+}
+
+func testChains(t *testing.T) [][]ct.ASN1Cert {
+	return [][]ct.ASN1Cert{
+		chainFromPEM(t, testonly.TestCertPEM, testonly.CACertPEM),
+		chainFromPEM(t, testonly.PrecertPEMValid, testonly.CACertPEM),
+		chainFromPEM(t, testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM, testonly.FakeCACertPEM),
+	}
+}
+
+// generate builds a corpus for chains from log, and returns its bundles.
+func generate(t *testing.T, log *fakeLog, chains [][]ct.ASN1Cert) []*Bundle {
+	var buf bytes.Buffer
+	if err := NewGenerator(log, time.Millisecond).Generate(context.Background(), chains, NewWriter(&buf)); err != nil {
+		t.Fatalf("Generate()=%v", err)
+	}
+	if got, want := bytes.Count(buf.Bytes(), []byte("\n")), len(chains); got != want {
+		t.Fatalf("Generate() wrote %d lines, want %d", got, want)
+	}
+
+	r := NewReader(&buf)
+	var bundles []*Bundle
+	for {
+		b, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read()=_,%v", err)
+		}
+		bundles = append(bundles, b)
+	}
+	return bundles
+}
+
+func newTestVerifier(t *testing.T) *Verifier {
+	v, err := NewVerifier([]byte(testonly.CTLogPublicKeyPEM))
+	if err != nil {
+		t.Fatalf("NewVerifier()=_,%v", err)
+	}
+	return v
+}
+
+func TestGenerateAndVerify(t *testing.T) {
+	log := newFakeLog(t)
+	bundles := generate(t, log, testChains(t))
+	if got, want := len(bundles), 3; got != want {
+		t.Fatalf("got %d bundles, want %d", got, want)
+	}
+
+	v := newTestVerifier(t)
+	for i, b := range bundles {
+		if got, want := b.Precert, i == 1; got != want {
+			t.Errorf("bundle %d: Precert=%v, want %v", i, got, want)
+		}
+		if got, want := b.LeafIndex, int64(i); got != want {
+			t.Errorf("bundle %d: LeafIndex=%d, want %d", i, got, want)
+		}
+		if got, want := b.STH.TreeSize, uint64(3); got != want {
+			t.Errorf("bundle %d: STH.TreeSize=%d, want %d", i, got, want)
+		}
+		if err := v.Verify(b); err != nil {
+			t.Errorf("bundle %d: Verify()=%v", i, err)
+		}
+	}
+}
+
+func TestGenerateNotMerged(t *testing.T) {
+	log := newFakeLog(t)
+	log.neverMerge = true
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var buf bytes.Buffer
+	if err := NewGenerator(log, time.Millisecond).Generate(ctx, testChains(t), NewWriter(&buf)); err == nil {
+		t.Errorf("Generate()=nil, want error")
+	}
+	if buf.Len() > 0 {
+		t.Errorf("Generate() wrote %q for unmerged entries", buf.String())
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	log := newFakeLog(t)
+	bundles := generate(t, log, testChains(t))
+	other := chainFromPEM(t, testonly.FakeCACertPEM)[0].Data
+
+	var tests = []struct {
+		descr  string
+		bundle int
+		tamper func(b *Bundle)
+	}{
+		{descr: "other-leaf", tamper: func(b *Bundle) { b.Chain[0] = other }},
+		{descr: "other-issuer", bundle: 1, tamper: func(b *Bundle) { b.Chain[1] = other }},
+		{descr: "no-issuer", bundle: 1, tamper: func(b *Bundle) { b.Chain = b.Chain[:1] }},
+		{descr: "not-precert", bundle: 1, tamper: func(b *Bundle) { b.Precert = false }},
+		{descr: "precert", tamper: func(b *Bundle) { b.Precert = true }},
+		{descr: "sct-signature", tamper: func(b *Bundle) { b.SCT[len(b.SCT)-1] ^= 1 }},
+		{descr: "sct-timestamp", tamper: func(b *Bundle) { b.SCT[1+sha256.Size+7] ^= 1 }},
+		{descr: "sct-log-id", tamper: func(b *Bundle) { b.SCT[1] ^= 1 }},
+		{descr: "sct-trailing-data", tamper: func(b *Bundle) { b.SCT = append(b.SCT, 0) }},
+		{descr: "leaf-index", tamper: func(b *Bundle) { b.LeafIndex = 2 }},
+		{descr: "audit-path", tamper: func(b *Bundle) { b.AuditPath[0][0] ^= 1 }},
+		{descr: "short-audit-path", tamper: func(b *Bundle) { b.AuditPath = b.AuditPath[1:] }},
+		{descr: "root-hash", tamper: func(b *Bundle) { b.STH.SHA256RootHash[0] ^= 1 }},
+		{descr: "short-root-hash", tamper: func(b *Bundle) { b.STH.SHA256RootHash = b.STH.SHA256RootHash[1:] }},
+		{descr: "tree-size", tamper: func(b *Bundle) { b.STH.TreeSize++ }},
+		{descr: "sth-signature", tamper: func(b *Bundle) { b.STH.TreeHeadSignature[len(b.STH.TreeHeadSignature)-1] ^= 1 }},
+	}
+
+	for _, test := range tests {
+		b := copyBundle(t, bundles[test.bundle])
+		test.tamper(b)
+		if err := newTestVerifier(t).Verify(b); err == nil {
+			t.Errorf("%s: Verify()=nil, want error", test.descr)
+		}
+	}
+}
+
+func copyBundle(t *testing.T, b *Bundle) *Bundle {
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatalf("Failed to marshal bundle: %v", err)
+	}
+	var c Bundle
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("Failed to unmarshal bundle: %v", err)
+	}
+	return &c
+}
+
+func TestVerifyForkedLog(t *testing.T) {
+	chains := testChains(t)
+	// Two logs with the same key that are given different entries sign different trees
+	// of the same size.
+	first := generate(t, newFakeLog(t), chains[:1])
+	second := generate(t, newFakeLog(t), chains[1:2])
+
+	v := newTestVerifier(t)
+	if err := v.Verify(first[0]); err != nil {
+		t.Fatalf("Verify(first)=%v", err)
+	}
+	if err := v.Verify(second[0]); err == nil {
+		t.Errorf("Verify(second)=nil, want error for forked tree")
+	}
+	if err := newTestVerifier(t).Verify(second[0]); err != nil {
+		t.Errorf("Verify(second) with new verifier=%v", err)
+	}
+}
@@ -0,0 +1,87 @@
+// The gen_corpus binary submits certificate chains to a running CT log and writes a corpus
+// of the SCTs it issues, with proofs that their entries were merged into the log, for
+// offline verification by verify_corpus.
+//
+// Each argument is a PEM file holding one chain, leaf first. Chains whose leaf has the
+// CT poison extension are submitted as precertificate chains.
+package main
+
+import (
+	"encoding/pem"
+	"flag"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/jsonclient"
+	"github.com/google/trillian/examples/ct/corpus"
+	"golang.org/x/net/context"
+)
+
+var logURIFlag = flag.String("log_uri", "http://localhost:6962/logs/example", "Base URI of the CT log to submit chains to")
+var outputFlag = flag.String("output", "", "File to write the corpus to, or standard output if empty")
+var mergeTimeoutFlag = flag.Duration("merge_timeout", time.Minute*10, "How long the log has to merge the submitted entries, which should be at least its maximum merge delay")
+var pollIntervalFlag = flag.Duration("poll_interval", time.Second*10, "How often the log's tree head is fetched while waiting for entries to be merged")
+
+func readChain(path string) ([]ct.ASN1Cert, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var chain []ct.ASN1Cert
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, ct.ASN1Cert{Data: block.Bytes})
+		}
+	}
+	return chain, nil
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		glog.Exit("Usage: gen_corpus [--log_uri=uri] [--output=file] <chain.pem> ...")
+	}
+
+	chains := make([][]ct.ASN1Cert, 0, flag.NArg())
+	for _, path := range flag.Args() {
+		chain, err := readChain(path)
+		if err != nil {
+			glog.Exitf("Failed to read chain: %v", err)
+		}
+		if len(chain) == 0 {
+			glog.Exitf("No certificates in %s", path)
+		}
+		chains = append(chains, chain)
+	}
+
+	logClient, err := client.New(*logURIFlag, nil, jsonclient.Options{})
+	if err != nil {
+		glog.Exitf("Failed to create CT client: %v", err)
+	}
+
+	out := os.Stdout
+	if len(*outputFlag) > 0 {
+		if out, err = os.Create(*outputFlag); err != nil {
+			glog.Exitf("Failed to create corpus file: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *mergeTimeoutFlag)
+	defer cancel()
+	if err := corpus.NewGenerator(logClient, *pollIntervalFlag).Generate(ctx, chains, corpus.NewWriter(out)); err != nil {
+		glog.Exitf("Failed to generate corpus: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		glog.Exitf("Failed to write corpus: %v", err)
+	}
+	glog.Infof("Wrote %d bundles", len(chains))
+}
@@ -0,0 +1,163 @@
+package corpus
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	ctfe "github.com/google/trillian/examples/ct"
+	"golang.org/x/net/context"
+)
+
+// LogClient is the part of the CT client API used to build a corpus. It's implemented by
+// the client.LogClient of the CT library.
+type LogClient interface {
+	AddChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error)
+	AddPreChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error)
+	GetSTH(ctx context.Context) (*ct.SignedTreeHead, error)
+	GetProofByHash(ctx context.Context, hash []byte, treeSize uint64) (*ct.GetProofByHashResponse, error)
+}
+
+// Generator builds a corpus by submitting chains to a running log.
+type Generator struct {
+	client       LogClient
+	pollInterval time.Duration
+}
+
+// NewGenerator returns a Generator that submits chains through client, and while waiting
+// for them to be merged into the log fetches its tree head every pollInterval.
+func NewGenerator(client LogClient, pollInterval time.Duration) *Generator {
+	return &Generator{client: client, pollInterval: pollInterval}
+}
+
+// pendingBundle is a bundle whose entry may not have been merged into the log yet.
+type pendingBundle struct {
+	bundle   Bundle
+	leafHash []byte
+}
+
+// Generate submits each of chains, leaf first, to the log and waits until it has
+// published a tree head including all of their entries. It then writes a bundle for each
+// chain to w, all with proofs to that tree head. Nothing is checked beyond what's needed
+// to find the entries, as checking the log's behavior is left to the Verifier.
+//
+// The log has until ctx is done to merge the entries, which may be as long as its
+// maximum merge delay.
+func (g *Generator) Generate(ctx context.Context, chains [][]ct.ASN1Cert, w *Writer) error {
+	pending := make([]*pendingBundle, 0, len(chains))
+	for i, chain := range chains {
+		p, err := g.submit(ctx, chain)
+		if err != nil {
+			return fmt.Errorf("chain %d: %v", i, err)
+		}
+		pending = append(pending, p)
+	}
+
+	for {
+		sth, err := g.client.GetSTH(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get tree head: %v", err)
+		}
+		merged, err := g.prove(ctx, pending, sth)
+		if err != nil {
+			return err
+		}
+		if merged == len(pending) {
+			break
+		}
+		glog.V(1).Infof("%d of %d entries merged in tree of size %d", merged, len(pending), sth.TreeSize)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d of %d entries not merged: %v", len(pending)-merged, len(pending), ctx.Err())
+		case <-time.After(g.pollInterval):
+		}
+	}
+
+	for _, p := range pending {
+		if err := w.Write(&p.bundle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// submit adds chain to the log, and returns the start of its bundle.
+func (g *Generator) submit(ctx context.Context, chain []ct.ASN1Cert) (*pendingBundle, error) {
+	raw := make([][]byte, len(chain))
+	for i, cert := range chain {
+		raw[i] = cert.Data
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("empty chain")
+	}
+	certs, err := parseChain(raw, false)
+	if err != nil {
+		return nil, err
+	}
+	precert, err := ctfe.IsPrecertificate(certs[0])
+	if err != nil {
+		return nil, err
+	}
+	if precert && len(certs) < 2 {
+		return nil, fmt.Errorf("no issuer for precertificate")
+	}
+
+	var sct *ct.SignedCertificateTimestamp
+	if precert {
+		sct, err = g.client.AddPreChain(ctx, chain)
+	} else {
+		sct, err = g.client.AddChain(ctx, chain)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit chain: %v", err)
+	}
+	sctData, err := tls.Marshal(*sct)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize SCT: %v", err)
+	}
+	_, leafHash, err := merkleLeaf(certs, precert, *sct)
+	if err != nil {
+		return nil, err
+	}
+	return &pendingBundle{
+		bundle:   Bundle{Chain: raw, Precert: precert, SCT: sctData},
+		leafHash: leafHash,
+	}, nil
+}
+
+// prove fills in the proofs of pending to the tree described by sth, and returns how many
+// could be proved. Every bundle must be proved to the same tree head, so if any can't be
+// they will all be proved again to a later one.
+func (g *Generator) prove(ctx context.Context, pending []*pendingBundle, sth *ct.SignedTreeHead) (int, error) {
+	sig, err := tls.Marshal(sth.TreeHeadSignature)
+	if err != nil {
+		return 0, fmt.Errorf("failed to serialize tree head signature: %v", err)
+	}
+	head := ct.GetSTHResponse{
+		TreeSize:          sth.TreeSize,
+		Timestamp:         sth.Timestamp,
+		SHA256RootHash:    sth.SHA256RootHash[:],
+		TreeHeadSignature: sig,
+	}
+
+	merged := 0
+	for _, p := range pending {
+		if sth.TreeSize == 0 {
+			break
+		}
+		rsp, err := g.client.GetProofByHash(ctx, p.leafHash, sth.TreeSize)
+		if err != nil {
+			// Most likely the entry isn't in the tree yet.
+			glog.V(2).Infof("No proof for leaf hash %x in tree of size %d: %v", p.leafHash, sth.TreeSize, err)
+			continue
+		}
+		p.bundle.LeafIndex = rsp.LeafIndex
+		p.bundle.AuditPath = rsp.AuditPath
+		p.bundle.STH = head
+		merged++
+	}
+	return merged, nil
+}
@@ -0,0 +1,108 @@
+package corpus
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian/crypto"
+	ctfe "github.com/google/trillian/examples/ct"
+	"github.com/google/trillian/merkle"
+)
+
+// Verifier checks the bundles of a corpus against the public key of the log that issued
+// them. It remembers the tree heads it has seen, so that a log that signs two different
+// trees of the same size is caught even if each bundle is fine on its own. A Verifier
+// must not be used concurrently.
+type Verifier struct {
+	logID       ct.SHA256Hash
+	sigVerifier *ct.SignatureVerifier
+	logVerifier merkle.LogVerifier
+	roots       map[uint64][]byte
+}
+
+// NewVerifier returns a Verifier for the log with the PEM encoded public key logKeyPEM.
+func NewVerifier(logKeyPEM []byte) (*Verifier, error) {
+	pubKey, logID, _, err := ct.PublicKeyFromPEM(logKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse log public key: %v", err)
+	}
+	sigVerifier, err := ct.NewSignatureVerifier(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{
+		logID:       logID,
+		sigVerifier: sigVerifier,
+		logVerifier: merkle.NewLogVerifier(merkle.NewRFC6962TreeHasher(crypto.NewSHA256())),
+		roots:       make(map[uint64][]byte),
+	}, nil
+}
+
+// Verify checks that the SCT of b was issued by the log for the chain of b, that the tree
+// head of b was signed by the log and that the entry for the SCT is included in it.
+func (v *Verifier) Verify(b *Bundle) error {
+	certs, err := parseChain(b.Chain, b.Precert)
+	if err != nil {
+		return err
+	}
+	precert, err := ctfe.IsPrecertificate(certs[0])
+	if err != nil {
+		return err
+	}
+	if precert != b.Precert {
+		return fmt.Errorf("precertificate leaf: %v, but bundle has precert: %v", precert, b.Precert)
+	}
+
+	var sct ct.SignedCertificateTimestamp
+	if rest, err := tls.Unmarshal(b.SCT, &sct); err != nil {
+		return fmt.Errorf("failed to parse SCT: %v", err)
+	} else if len(rest) > 0 {
+		return fmt.Errorf("trailing data (%d bytes) after SCT", len(rest))
+	}
+	if sct.SCTVersion != ct.V1 {
+		return fmt.Errorf("unsupported SCT version %d", sct.SCTVersion)
+	}
+	if got, want := sct.LogID.KeyID[:], v.logID[:]; !bytes.Equal(got, want) {
+		return fmt.Errorf("SCT from log %x, want %x", got, want)
+	}
+	leaf, leafHash, err := merkleLeaf(certs, b.Precert, sct)
+	if err != nil {
+		return err
+	}
+	if err := v.sigVerifier.VerifySCTSignature(sct, ct.LogEntry{Leaf: *leaf}); err != nil {
+		return fmt.Errorf("invalid SCT signature: %v", err)
+	}
+
+	sth := ct.SignedTreeHead{
+		Version:   ct.V1,
+		TreeSize:  b.STH.TreeSize,
+		Timestamp: b.STH.Timestamp,
+	}
+	if got, want := len(b.STH.SHA256RootHash), sha256.Size; got != want {
+		return fmt.Errorf("tree head root hash has %d bytes, want %d", got, want)
+	}
+	copy(sth.SHA256RootHash[:], b.STH.SHA256RootHash)
+	if rest, err := tls.Unmarshal(b.STH.TreeHeadSignature, &sth.TreeHeadSignature); err != nil {
+		return fmt.Errorf("failed to parse tree head signature: %v", err)
+	} else if len(rest) > 0 {
+		return fmt.Errorf("trailing data (%d bytes) after tree head signature", len(rest))
+	}
+	if err := v.sigVerifier.VerifySTHSignature(sth); err != nil {
+		return fmt.Errorf("invalid tree head signature: %v", err)
+	}
+	if sth.Timestamp < sct.Timestamp {
+		return fmt.Errorf("tree head timestamp %d is before SCT timestamp %d", sth.Timestamp, sct.Timestamp)
+	}
+	if root, ok := v.roots[sth.TreeSize]; ok && !bytes.Equal(root, b.STH.SHA256RootHash) {
+		return fmt.Errorf("tree head for size %d has root %x, another has %x", sth.TreeSize, b.STH.SHA256RootHash, root)
+	}
+	v.roots[sth.TreeSize] = b.STH.SHA256RootHash
+
+	if err := v.logVerifier.VerifyInclusionProof(b.LeafIndex, int64(sth.TreeSize), b.AuditPath, b.STH.SHA256RootHash, leafHash); err != nil {
+		return fmt.Errorf("invalid inclusion proof: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// The verify_corpus binary checks corpora written by gen_corpus against the public key of
+// the log that issued them, without contacting the log. It reports every bundle that
+// fails verification, and exits with a non-zero status if there were any.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/examples/ct/corpus"
+)
+
+var logPublicKeyFlag = flag.String("log_public_key", "", "File holding the PEM encoded public key of the log")
+
+// verifyFile checks the bundles in the corpus at path, and returns how many there were
+// and how many failed.
+func verifyFile(v *corpus.Verifier, path string) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	r := corpus.NewReader(f)
+	count, failed := 0, 0
+	for {
+		b, err := r.Read()
+		if err == io.EOF {
+			return count, failed, nil
+		}
+		if err != nil {
+			return count, failed, fmt.Errorf("%s: bundle %d: %v", path, count+1, err)
+		}
+		count++
+		if err := v.Verify(b); err != nil {
+			fmt.Printf("%s: bundle %d (leaf index %d): %v\n", path, count, b.LeafIndex, err)
+			failed++
+		}
+	}
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 || len(*logPublicKeyFlag) == 0 {
+		glog.Exit("Usage: verify_corpus --log_public_key=key.pem <corpus> ...")
+	}
+	keyPEM, err := ioutil.ReadFile(*logPublicKeyFlag)
+	if err != nil {
+		glog.Exitf("Failed to read log public key: %v", err)
+	}
+	v, err := corpus.NewVerifier(keyPEM)
+	if err != nil {
+		glog.Exitf("Failed to create verifier: %v", err)
+	}
+
+	total, totalFailed := 0, 0
+	for _, path := range flag.Args() {
+		count, failed, err := verifyFile(v, path)
+		total += count
+		totalFailed += failed
+		if err != nil {
+			glog.Exitf("Failed to read corpus: %v", err)
+		}
+	}
+	fmt.Printf("%d of %d bundles verified\n", total-totalFailed, total)
+	if totalFailed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,106 @@
+package ct
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/trillian/util"
+)
+
+const (
+	originHeader              = "Origin"
+	requestMethodHeader       = "Access-Control-Request-Method"
+	allowOriginHeader         = "Access-Control-Allow-Origin"
+	allowMethodsHeader        = "Access-Control-Allow-Methods"
+	allowHeadersHeader        = "Access-Control-Allow-Headers"
+	exposeHeadersHeader       = "Access-Control-Expose-Headers"
+	maxAgeHeader              = "Access-Control-Max-Age"
+	corsAnyOrigin             = "*"
+	corsDefaultAllowedMethods = http.MethodGet
+)
+
+// CORSPolicy controls the Cross-Origin Resource Sharing headers added to responses, so
+// browser based monitors can call the log's read entrypoints.
+type CORSPolicy struct {
+	// AllowedOrigins lists the origins that may make cross-origin requests. "*" allows
+	// any origin.
+	AllowedOrigins []string
+	// AllowedMethods lists the HTTP methods that cross-origin requests may use. Only GET
+	// is allowed if it's empty, which keeps submissions same-origin.
+	AllowedMethods []string
+	// MaxAge is how long browsers may cache the response to a preflight request. The
+	// header is omitted if it's zero.
+	MaxAge time.Duration
+}
+
+// allowsMethod returns true if cross-origin requests may use method.
+func (p *CORSPolicy) allowsMethod(method string) bool {
+	if len(p.AllowedMethods) == 0 {
+		return method == corsDefaultAllowedMethods
+	}
+	for _, m := range p.AllowedMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedOrigin returns the value for the Access-Control-Allow-Origin header in the
+// response to a request from origin, or false if the origin isn't allowed.
+func (p *CORSPolicy) allowedOrigin(origin string) (string, bool) {
+	for _, o := range p.AllowedOrigins {
+		if o == corsAnyOrigin {
+			return corsAnyOrigin, true
+		}
+		if o == origin {
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+// handle adds the CORS headers for a request to an entrypoint that accepts method. It
+// returns true if the request was a preflight request, in which case the response has
+// been written and the entrypoint must not be called.
+func (p *CORSPolicy) handle(w http.ResponseWriter, r *http.Request, method string) bool {
+	preflight := r.Method == http.MethodOptions && len(r.Header.Get(requestMethodHeader)) > 0
+	origin := r.Header.Get(originHeader)
+	if len(origin) == 0 || !p.allowsMethod(method) {
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return preflight
+	}
+
+	allowOrigin, ok := p.allowedOrigin(origin)
+	if allowOrigin != corsAnyOrigin {
+		// The response depends on the origin so mustn't be served from caches to others.
+		w.Header().Add(varyHeader, originHeader)
+	}
+	if !ok {
+		// Leaving out the headers makes the browser refuse the response.
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return preflight
+	}
+
+	w.Header().Set(allowOriginHeader, allowOrigin)
+	if !preflight {
+		w.Header().Set(exposeHeadersHeader, strings.Join([]string{util.RequestIDHeader, etagHeader}, ", "))
+		return false
+	}
+
+	if r.Header.Get(requestMethodHeader) == method {
+		w.Header().Set(allowMethodsHeader, method)
+		w.Header().Set(allowHeadersHeader, util.RequestIDHeader)
+		if p.MaxAge > 0 {
+			w.Header().Set(maxAgeHeader, strconv.Itoa(int(p.MaxAge/time.Second)))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
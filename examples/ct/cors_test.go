@@ -0,0 +1,96 @@
+package ct
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORSPolicy(t *testing.T) {
+	policy := &CORSPolicy{AllowedOrigins: []string{"https://monitor.example.com"}, MaxAge: time.Hour}
+	anyOrigin := &CORSPolicy{AllowedOrigins: []string{"*"}}
+
+	var tests = []struct {
+		descr         string
+		policy        *CORSPolicy
+		method        string
+		origin        string
+		reqMethod     string
+		handlerMethod string
+		wantPreflight bool
+		wantOrigin    string
+		wantMaxAge    string
+	}{
+		{descr: "same-origin", policy: policy, method: http.MethodGet, handlerMethod: http.MethodGet},
+		{descr: "allowed", policy: policy, method: http.MethodGet, origin: "https://monitor.example.com", handlerMethod: http.MethodGet, wantOrigin: "https://monitor.example.com"},
+		{descr: "disallowed", policy: policy, method: http.MethodGet, origin: "https://evil.example.com", handlerMethod: http.MethodGet},
+		{descr: "any", policy: anyOrigin, method: http.MethodGet, origin: "https://evil.example.com", handlerMethod: http.MethodGet, wantOrigin: "*"},
+		{descr: "post-not-allowed", policy: anyOrigin, method: http.MethodPost, origin: "https://monitor.example.com", handlerMethod: http.MethodPost},
+		{descr: "preflight", policy: policy, method: http.MethodOptions, origin: "https://monitor.example.com", reqMethod: http.MethodGet, handlerMethod: http.MethodGet,
+			wantPreflight: true, wantOrigin: "https://monitor.example.com", wantMaxAge: "3600"},
+		{descr: "preflight-disallowed", policy: policy, method: http.MethodOptions, origin: "https://evil.example.com", reqMethod: http.MethodGet, handlerMethod: http.MethodGet,
+			wantPreflight: true},
+		{descr: "options-not-preflight", policy: policy, method: http.MethodOptions, origin: "https://monitor.example.com", handlerMethod: http.MethodGet,
+			wantOrigin: "https://monitor.example.com"},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, "http://example.com/ct/v1/get-sth", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if len(test.origin) > 0 {
+			req.Header.Set(originHeader, test.origin)
+		}
+		if len(test.reqMethod) > 0 {
+			req.Header.Set(requestMethodHeader, test.reqMethod)
+		}
+		w := httptest.NewRecorder()
+
+		if got := test.policy.handle(w, req, test.handlerMethod); got != test.wantPreflight {
+			t.Errorf("handle(%s)=%v, want %v", test.descr, got, test.wantPreflight)
+		}
+		if test.wantPreflight && w.Code != http.StatusNoContent {
+			t.Errorf("handle(%s) wrote status %d, want %d", test.descr, w.Code, http.StatusNoContent)
+		}
+		if got := w.Header().Get(allowOriginHeader); got != test.wantOrigin {
+			t.Errorf("handle(%s) %s=%q, want %q", test.descr, allowOriginHeader, got, test.wantOrigin)
+		}
+		if got := w.Header().Get(maxAgeHeader); got != test.wantMaxAge {
+			t.Errorf("handle(%s) %s=%q, want %q", test.descr, maxAgeHeader, got, test.wantMaxAge)
+		}
+	}
+}
+
+func TestCORSPreflightSkipsHandler(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	info.c.cors = &CORSPolicy{AllowedOrigins: []string{"*"}}
+	sink := &recordingAccessLog{}
+	info.c.accessLog = sink
+
+	// No RPCs are expected, the handler must not be called.
+	handler := appHandler{context: info.c, handler: getSTH, name: "GetSTH", method: http.MethodGet}
+	req, err := http.NewRequest(http.MethodOptions, "http://example.com/ct/v1/get-sth", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set(originHeader, "https://monitor.example.com")
+	req.Header.Set(requestMethodHeader, http.MethodGet)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got, want := w.Code, http.StatusNoContent; got != want {
+		t.Errorf("ServeHTTP(preflight)=%d, want %d", got, want)
+	}
+	if got, want := w.Header().Get(allowMethodsHeader), http.MethodGet; got != want {
+		t.Errorf("ServeHTTP(preflight) %s=%q, want %q", allowMethodsHeader, got, want)
+	}
+	if got, want := len(sink.recs), 1; got != want {
+		t.Fatalf("ServeHTTP(preflight) logged %d records, want %d", got, want)
+	}
+	if rec := sink.recs[0]; rec.Status != http.StatusNoContent || len(rec.Error) > 0 {
+		t.Errorf("ServeHTTP(preflight) logged status %d error %q, want %d and no error", rec.Status, rec.Error, http.StatusNoContent)
+	}
+}
@@ -0,0 +1,50 @@
+// The ct_log_list binary writes a fragment of a Chrome style log_list.json describing the
+// logs in a ct_server log config file, for configuring monitors and submitting the logs
+// for inclusion in log lists. Each log's public key is read from its PubKeyPEMFile.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/examples/ct"
+)
+
+var logConfigFlag = flag.String("log_config", "", "File holding the ct_server log config in JSON")
+var operatorFlag = flag.String("operator", "", "Name of the organization operating the logs")
+var baseURLFlag = flag.String("base_url", "", "URL the logs are served under, e.g. https://ct.example.com; each log's prefix is appended to it")
+var defaultMMDFlag = flag.Duration("default_mmd", 24*time.Hour, "Maximum merge delay listed for logs without a MaxMergeDelay")
+var outputFlag = flag.String("output", "", "File to write the log list to. Written to stdout if empty")
+
+func main() {
+	flag.Parse()
+	if len(*logConfigFlag) == 0 || len(*operatorFlag) == 0 || len(*baseURLFlag) == 0 {
+		glog.Exit("--log_config, --operator and --base_url are required")
+	}
+	cfgs, err := ct.LogConfigFromFile(*logConfigFlag)
+	if err != nil {
+		glog.Exitf("Failed to read log config: %v", err)
+	}
+	list, err := ct.LogListFromConfig(cfgs, *operatorFlag, *baseURLFlag, *defaultMMDFlag)
+	if err != nil {
+		glog.Exitf("Failed to build log list: %v", err)
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		glog.Exitf("Failed to marshal log list: %v", err)
+	}
+	data = append(data, '\n')
+	if len(*outputFlag) == 0 {
+		if _, err := os.Stdout.Write(data); err != nil {
+			glog.Exitf("Failed to write log list: %v", err)
+		}
+		return
+	}
+	if err := ioutil.WriteFile(*outputFlag, data, 0644); err != nil {
+		glog.Exitf("Failed to write log list: %v", err)
+	}
+}
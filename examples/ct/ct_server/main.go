@@ -1,12 +1,19 @@
 package main
 
 import (
-	_ "expvar" // For HTTP server registration
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"expvar"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"log/syslog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"time"
@@ -14,31 +21,311 @@ import (
 	"github.com/golang/glog"
 	"github.com/google/trillian"
 	"github.com/google/trillian/examples/ct"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 )
 
 // Global flags that affect all log instances.
-var serverPortFlag = flag.Int("port", 6962, "Port to serve CT log requests on")
-var rpcBackendFlag = flag.String("log_rpc_server", "localhost:8090", "Backend Log RPC server to use")
+var serverPortFlag = flag.Int("port", 6962, "Port to serve CT log requests on, on localhost, if --listen isn't set")
+var listenFlag = flag.String("listen", "", "Comma separated list of addresses to serve CT log requests on, each a host:port pair or unix:path for a unix domain socket, e.g. 0.0.0.0:6962,[::]:6962. IP addresses are listened on with only that IP version. Overrides --port")
+var rpcBackendFlag = flag.String("log_rpc_server", "localhost:8090", "Comma separated list of backend Log RPC servers to use, each a host:port address or a DNS SRV name such as _trillian._tcp.example.com. Reads are load balanced over them, and requests fail over to another when one is unavailable")
+var backendChannelsFlag = flag.Int("backend_channels", 4, "Number of gRPC channels kept open to each backend, which requests are rotated across")
+var backendRedialAfterFlag = flag.Duration("backend_redial_after", time.Second*5, "How long a channel to a backend may be failing before it's replaced with a newly dialed one")
+var backendCheckIntervalFlag = flag.Duration("backend_check_interval", time.Second, "How often the state of the channels to the backends is checked")
+var backendRetryAfterFlag = flag.Duration("backend_retry_after", time.Second*10, "How long a backend that failed as unavailable is avoided before being tried again")
+var backendReadAttemptsFlag = flag.Int("backend_read_attempts", ct.DefaultRetryPolicy.MaxAttempts, "Most times a read RPC that fails because the backend is unavailable or timed out is tried, including the first. 1 disables retries")
+var backendRetryInitialBackoffFlag = flag.Duration("backend_retry_initial_backoff", ct.DefaultRetryPolicy.InitialBackoff, "How long to wait before retrying a failed backend read for the first time; the wait doubles with each further retry")
+var backendRetryMaxBackoffFlag = flag.Duration("backend_retry_max_backoff", ct.DefaultRetryPolicy.MaxBackoff, "Longest wait between retries of a failed backend read")
+var backendBreakerErrorRateFlag = flag.Float64("backend_breaker_error_rate", ct.DefaultBreakerConfig.ErrorRate, "Fraction of an RPC method's backend requests that must fail within --backend_breaker_window for requests of that method to be failed fast with 503s for a while. 1 disables the circuit breaker")
+var backendBreakerMinRequestsFlag = flag.Int("backend_breaker_min_requests", ct.DefaultBreakerConfig.MinRequests, "Number of backend requests for an RPC method within --backend_breaker_window needed before its error rate is checked")
+var backendBreakerWindowFlag = flag.Duration("backend_breaker_window", ct.DefaultBreakerConfig.Window, "Period over which backend error rates are measured")
+var backendBreakerOpenForFlag = flag.Duration("backend_breaker_open_for", ct.DefaultBreakerConfig.OpenFor, "How long requests are failed fast once the circuit breaker trips, before one is sent to check whether the backend has recovered")
 var rpcDeadlineFlag = flag.Duration("rpc_deadline", time.Second*10, "Deadline for backend RPC requests")
 var logConfigFlag = flag.String("log_config", "", "File holding log config in JSON")
+var drainTimeoutFlag = flag.Duration("drain_timeout", time.Second*30, "How long to wait for in-flight requests to complete when shutting down")
+var disableCompressionFlag = flag.Bool("disable_compression", false, "If true, don't gzip / deflate HTTP responses even when clients accept it")
+var ntpServerFlag = flag.String("ntp_server", "", "If set, NTP server used to verify and correct the local clock when issuing SCTs")
+var maxClockSkewFlag = flag.Duration("max_clock_skew", time.Second, "Local clock offset from the NTP server above which an alarm is raised")
+var clockCheckIntervalFlag = flag.Duration("clock_check_interval", time.Minute, "How often to check the local clock against the NTP server")
+var accessLogFlag = flag.String("access_log", "", "Where to write JSON access log records: a file path, or - for stderr. If empty requests are logged with glog")
+var accessLogMaxSizeFlag = flag.Int64("access_log_max_size", 100<<20, "Size in bytes at which the access log file is rotated")
+var accessLogMaxBackupsFlag = flag.Int("access_log_max_backups", 5, "Number of rotated access log files to keep")
+var proofAuditLogFlag = flag.String("proof_audit_log", "", "If set, file to record a sample of the proofs served in, as JSON, so disputed proofs can be checked later")
+var proofAuditSampleRateFlag = flag.Float64("proof_audit_sample_rate", 0.01, "Fraction of proof responses recorded in --proof_audit_log, from 0 to 1")
+var proofAuditMaxSizeFlag = flag.Int64("proof_audit_max_size", 100<<20, "Size in bytes at which the proof audit log file is rotated")
+var proofAuditMaxBackupsFlag = flag.Int("proof_audit_max_backups", 10, "Number of rotated proof audit log files to keep")
+var proofAuditRetentionFlag = flag.Duration("proof_audit_retention", 0, "If set, rotated proof audit log files older than this are removed")
+var submissionAuditLogFlag = flag.String("submission_audit_log", "", "If set, where to record every SCT issued, with the submitted chain's fingerprints and the submitter, as JSON: a file path, or syslog. Not to be used with --submission_audit_webhook")
+var submissionAuditMaxSizeFlag = flag.Int64("submission_audit_max_size", 100<<20, "Size in bytes at which the submission audit log file is rotated")
+var submissionAuditMaxBackupsFlag = flag.Int("submission_audit_max_backups", 10, "Number of rotated submission audit log files to keep")
+var submissionAuditWebhookFlag = flag.String("submission_audit_webhook", "", "If set, URL that a JSON record of every SCT issued is posted to. Records are dropped if the webhook falls behind")
+var submissionAuditQueueSizeFlag = flag.Int("submission_audit_queue_size", 10000, "Most submission audit records held waiting to be posted to --submission_audit_webhook")
+var corsAllowedOriginsFlag = flag.String("cors_allowed_origins", "", "Comma separated list of origins allowed to make cross-origin requests, or * for any. CORS is disabled if empty")
+var corsAllowedMethodsFlag = flag.String("cors_allowed_methods", "GET", "Comma separated list of HTTP methods allowed in cross-origin requests")
+var corsMaxAgeFlag = flag.Duration("cors_max_age", time.Hour, "How long browsers may cache CORS preflight responses")
+var tlsCertFileFlag = flag.String("tls_cert_file", "", "If set, file holding the PEM encoded TLS server certificate chain; requests are then served over HTTPS")
+var tlsKeyFileFlag = flag.String("tls_key_file", "", "File holding the PEM encoded private key for --tls_cert_file")
+var adminPortFlag = flag.Int("admin_port", 0, "If set, port to serve the admin API on, for logs with request signing keys. The admin API is disabled if zero")
+var adminSigningKeysFlag = flag.String("admin_signing_keys", "", "If set, file holding a JSON list of request signing keys for the server's admin API, which adds logs while the server is running. Needs --admin_port")
+var provisionDirFlag = flag.String("provision_dir", "", "Directory that roots and keys given in admin create-log requests are written to")
+var debugPortFlag = flag.Int("debug_port", 0, "If set, port to serve pprof profiles, exported variables, request traces and the goroutine and heap dump trigger on, on localhost only. Sending the server SIGUSR1 also triggers a dump. Disabled if zero")
+var debugDumpDirFlag = flag.String("debug_dump_dir", "", "Directory that goroutine and heap dumps are written to; the system temporary directory if empty")
+var tlsReloadIntervalFlag = flag.Duration("tls_reload_interval", time.Minute, "How often to check the TLS certificate files for changes")
+var httpReadHeaderTimeoutFlag = flag.Duration("http_read_header_timeout", time.Second*10, "How long clients have to send the headers of a request, from when the connection is accepted or the previous request finished. 0 for no timeout")
+var httpReadTimeoutFlag = flag.Duration("http_read_timeout", time.Second*30, "How long clients have to send a whole request, including the body. 0 for no timeout")
+var httpWriteTimeoutFlag = flag.Duration("http_write_timeout", time.Second*60, "How long a response may take, from the end of the request headers until it's completely written. It should allow for --rpc_deadline and for throttled entry downloads. 0 for no timeout")
+var httpIdleTimeoutFlag = flag.Duration("http_idle_timeout", time.Second*120, "How long a keep-alive connection is kept open waiting for the next request. 0 to use --http_read_timeout")
+var httpMaxHeaderBytesFlag = flag.Int("http_max_header_bytes", 64<<10, "Largest size of request headers, including the request line, accepted")
+
+// newAccessLog returns the sink for access log records configured by flags, or nil to
+// use the default.
+func newAccessLog() (ct.AccessLogSink, error) {
+	switch *accessLogFlag {
+	case "":
+		return nil, nil
+	case "-":
+		return ct.NewJSONAccessLog(os.Stderr), nil
+	}
+	f, err := ct.NewRotatingFile(*accessLogFlag, *accessLogMaxSizeFlag, *accessLogMaxBackupsFlag)
+	if err != nil {
+		return nil, err
+	}
+	return ct.NewJSONAccessLog(f), nil
+}
+
+// newProofAudit returns the proof audit config set by flags, or nil if proofs aren't
+// audited. Old records are removed in the background if a retention period is set.
+func newProofAudit() (*ct.ProofAuditConfig, error) {
+	if len(*proofAuditLogFlag) == 0 {
+		return nil, nil
+	}
+	if *proofAuditSampleRateFlag < 0 || *proofAuditSampleRateFlag > 1 {
+		return nil, fmt.Errorf("--proof_audit_sample_rate must be between 0 and 1, got %v", *proofAuditSampleRateFlag)
+	}
+	f, err := ct.NewRotatingFile(*proofAuditLogFlag, *proofAuditMaxSizeFlag, *proofAuditMaxBackupsFlag)
+	if err != nil {
+		return nil, err
+	}
+	if retention := *proofAuditRetentionFlag; retention > 0 {
+		go func() {
+			for range time.Tick(time.Hour) {
+				if n, err := f.RemoveBackupsOlderThan(time.Now().Add(-retention)); err != nil {
+					glog.Warningf("Failed to remove old proof audit logs: %v", err)
+				} else if n > 0 {
+					glog.Infof("Removed %d proof audit logs older than %v", n, retention)
+				}
+			}
+		}()
+	}
+	return &ct.ProofAuditConfig{Sink: ct.NewJSONProofAudit(f), SampleRate: *proofAuditSampleRateFlag}, nil
+}
+
+// newSubmissionAudit returns the sink for submission audit records set by flags, or nil
+// if submissions aren't audited.
+func newSubmissionAudit() (ct.SubmissionAuditSink, error) {
+	switch {
+	case len(*submissionAuditLogFlag) > 0 && len(*submissionAuditWebhookFlag) > 0:
+		return nil, errors.New("only one of --submission_audit_log and --submission_audit_webhook may be set")
+	case len(*submissionAuditWebhookFlag) > 0:
+		w := ct.NewWebhookSubmissionAudit(*submissionAuditWebhookFlag, *submissionAuditQueueSizeFlag)
+		expvar.Publish("submission-audit", w.Vars())
+		return w, nil
+	case *submissionAuditLogFlag == "syslog":
+		w, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_DAEMON, "ct_server")
+		if err != nil {
+			return nil, err
+		}
+		return ct.NewJSONSubmissionAudit(w), nil
+	case len(*submissionAuditLogFlag) > 0:
+		f, err := ct.NewRotatingFile(*submissionAuditLogFlag, *submissionAuditMaxSizeFlag, *submissionAuditMaxBackupsFlag)
+		if err != nil {
+			return nil, err
+		}
+		return ct.NewJSONSubmissionAudit(f), nil
+	}
+	return nil, nil
+}
+
+// readAdminSigningKeys reads the keys for the server's admin API from a JSON file.
+func readAdminSigningKeys(filename string) ([]ct.RequestSigningKey, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var keys []ct.RequestSigningKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", filename, err)
+	}
+	return keys, nil
+}
+
+// newTimeSource returns the time source used to timestamp SCTs. If an NTP server is
+// configured this checks the local clock against it periodically.
+func newTimeSource() util.TimeSource {
+	if len(*ntpServerFlag) == 0 {
+		return util.SystemTimeSource{}
+	}
+
+	ts := util.NewTrustedTimeSource(util.SystemTimeSource{}, util.NewNTPOffsetSource(*ntpServerFlag, time.Second*5), *maxClockSkewFlag)
+	if err := ts.Refresh(); err != nil {
+		glog.Warningf("Initial clock check against %s failed: %v", *ntpServerFlag, err)
+	}
+	expvar.Publish("clock", ts.Vars())
+	go ts.Run(context.Background(), *clockCheckIntervalFlag)
+	return ts
+}
+
+// newCORSPolicy returns the CORS policy configured by flags, or nil if CORS is disabled.
+func newCORSPolicy() *ct.CORSPolicy {
+	if len(*corsAllowedOriginsFlag) == 0 {
+		return nil
+	}
+	return &ct.CORSPolicy{
+		AllowedOrigins: strings.Split(*corsAllowedOriginsFlag, ","),
+		AllowedMethods: strings.Split(*corsAllowedMethodsFlag, ","),
+		MaxAge:         *corsMaxAgeFlag,
+	}
+}
+
+// newTLSConfig returns the TLS config for the HTTP server, or nil if it should serve
+// plain HTTP. The certificate is reloaded when its files change. If requestClientCerts
+// is set clients are asked for certificates, which the logs that need them verify.
+func newTLSConfig(requestClientCerts bool) (*tls.Config, error) {
+	if len(*tlsCertFileFlag) == 0 {
+		if requestClientCerts {
+			return nil, errors.New("logs with a ClientCAFile need --tls_cert_file")
+		}
+		return nil, nil
+	}
+
+	r, err := util.NewCertReloader(*tlsCertFileFlag, *tlsKeyFileFlag)
+	if err != nil {
+		return nil, err
+	}
+	expvar.Publish("tls", r.Vars())
+	go r.Run(context.Background(), *tlsReloadIntervalFlag)
+	config := &tls.Config{GetCertificate: r.GetCertificate}
+	if requestClientCerts {
+		config.ClientAuth = tls.RequestClientCert
+	}
+	return config, nil
+}
+
+// dialChannel opens a channel to a backend. It doesn't wait for the connection, which is
+// made in the background.
+func dialChannel(addr string) (ct.BackendChannel, error) {
+	// TODO(Martin2112): Support TLS for the RPC client.
+	conn, err := grpc.Dial(addr, grpc.WithInsecure(), grpc.WithChainUnaryInterceptor(util.RequestIDClientInterceptor(), util.TraceClientInterceptor()))
+	if err != nil {
+		return ct.BackendChannel{}, err
+	}
+	conn.Connect()
+	return ct.BackendChannel{Conn: conn, Client: trillian.NewTrillianLogClient(conn)}, nil
+}
+
+// dialBackends sets up the channels to each of the backends, waiting until at least one
+// is connected so we don't start serving before we can reach a backend. The others keep
+// connecting in the background, and broken channels are replaced until ctx is done.
+func dialBackends(ctx context.Context, addrs []string) ([]*ct.ConnManager, []ct.Backend, error) {
+	var managers []*ct.ConnManager
+	var backends []ct.Backend
+	for _, addr := range addrs {
+		m, err := ct.NewConnManager(addr, *backendChannelsFlag, dialChannel, util.SystemTimeSource{}, *backendRedialAfterFlag)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to dial %s: %v", addr, err)
+		}
+		go m.Run(ctx, *backendCheckIntervalFlag)
+		managers = append(managers, m)
+		backends = append(backends, ct.Backend{Name: addr, Client: m, ConnErr: m.Err})
+	}
+
+	for {
+		for _, m := range managers {
+			if m.Ready() {
+				return managers, backends, nil
+			}
+		}
+		glog.Infof("Waiting for a connection to one of %v", addrs)
+		time.Sleep(time.Second)
+	}
+}
+
+// awaitSignal waits for a terminating signal then shuts down the server gracefully: it
+// stops accepting new connections and waits up to drainTimeout for in-flight requests
+// (and the backend RPCs they're waiting on) to complete.
+func awaitSignal(server *http.Server, drainTimeout time.Duration, done chan<- struct{}) {
+	defer close(done)
 
-func awaitSignal() {
 	// Arrange notification for the standard set of signals used to terminate a server
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
 	// Now block main and wait for a signal
 	sig := <-sigs
-	glog.Warningf("Signal received: %v", sig)
+	glog.Warningf("Signal received: %v, draining requests for up to %v", sig, drainTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		glog.Warningf("Server did not shut down cleanly: %v", err)
+	}
 	glog.Flush()
+}
 
-	// Terminate the process
-	os.Exit(1)
+// newHTTPServer creates a server with the timeouts and limits set by the flags, so slow or
+// idle clients can't hold connections open indefinitely.
+func newHTTPServer(addr string, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: *httpReadHeaderTimeoutFlag,
+		ReadTimeout:       *httpReadTimeoutFlag,
+		WriteTimeout:      *httpWriteTimeoutFlag,
+		IdleTimeout:       *httpIdleTimeoutFlag,
+		MaxHeaderBytes:    *httpMaxHeaderBytesFlag,
+	}
+}
+
+// serveAdmin serves the admin API on its own port. Failing to do so is fatal, as the
+// operator asked for it.
+func serveAdmin(mux *http.ServeMux, tlsConfig *tls.Config) {
+	server := newHTTPServer(fmt.Sprintf("localhost:%d", *adminPortFlag), mux, tlsConfig)
+	var err error
+	if tlsConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	glog.Fatalf("Admin server exited: %v", err)
+}
+
+// serveDebug serves the debug endpoints on their own port, and writes dumps whenever the
+// server receives SIGUSR1.
+func serveDebug(d *ct.DebugServer) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+	go func() {
+		for range sigs {
+			if _, err := d.Dump(); err != nil {
+				glog.Warningf("Failed to write debug dumps: %v", err)
+			}
+		}
+	}()
+
+	server := &http.Server{Addr: fmt.Sprintf("localhost:%d", *debugPortFlag), Handler: d.Mux()}
+	glog.Fatalf("Debug server exited: %v", server.ListenAndServe())
 }
 
 func main() {
 	flag.Parse()
+	if *httpReadHeaderTimeoutFlag < 0 || *httpReadTimeoutFlag < 0 || *httpWriteTimeoutFlag < 0 || *httpIdleTimeoutFlag < 0 {
+		glog.Fatal("HTTP timeouts must not be negative")
+	}
+	if *httpMaxHeaderBytesFlag <= 0 {
+		glog.Fatalf("--http_max_header_bytes must be positive, got %d", *httpMaxHeaderBytesFlag)
+	}
 	// Get log config from file before we start.
 	cfg, err := ct.LogConfigFromFile(*logConfigFlag)
 	if err != nil {
@@ -48,26 +335,158 @@ func main() {
 	glog.CopyStandardLogTo("WARNING")
 	glog.Info("**** CT HTTP Server Starting ****")
 
-	// TODO(Martin2112): Support TLS and other stuff for RPC client and http server, this is just to
-	// get started. Uses a blocking connection so we don't start serving before we're connected
-	// to backend.
-	conn, err := grpc.Dial(*rpcBackendFlag, grpc.WithInsecure(), grpc.WithBlock())
+	addrs, err := ct.ResolveBackendAddrs(*rpcBackendFlag, net.LookupSRV)
+	if err != nil {
+		glog.Fatalf("Invalid --log_rpc_server: %v", err)
+	}
+	backendCtx, stopBackends := context.WithCancel(context.Background())
+	defer stopBackends()
+	managers, backends, err := dialBackends(backendCtx, addrs)
 	if err != nil {
 		glog.Fatalf("Could not connect to rpc server: %v", err)
 	}
-	defer conn.Close()
-	client := trillian.NewTrillianLogClient(conn)
+	channelVars := new(expvar.Map).Init()
+	for _, m := range managers {
+		defer m.Close()
+		channelVars.Set(m.Addr(), m.Vars())
+	}
+	expvar.Publish("backend-channels", channelVars)
+	client, err := ct.NewBackendPool(backends, util.SystemTimeSource{}, *backendRetryAfterFlag)
+	if err != nil {
+		glog.Fatalf("Failed to set up backends: %v", err)
+	}
+	expvar.Publish("backends", client.Vars())
+	retryPolicy := ct.DefaultRetryPolicy
+	retryPolicy.MaxAttempts = *backendReadAttemptsFlag
+	retryPolicy.InitialBackoff = *backendRetryInitialBackoffFlag
+	retryPolicy.MaxBackoff = *backendRetryMaxBackoffFlag
+	retrying := ct.NewRetryingLogClient(client, retryPolicy)
+	expvar.Publish("backend-retries", retrying.Vars())
+	breaker := ct.NewCircuitBreaker(retrying, ct.BreakerConfig{
+		ErrorRate:   *backendBreakerErrorRateFlag,
+		MinRequests: *backendBreakerMinRequestsFlag,
+		Window:      *backendBreakerWindowFlag,
+		OpenFor:     *backendBreakerOpenForFlag,
+	}, util.SystemTimeSource{})
+	expvar.Publish("backend-breaker", breaker.Vars())
+
+	accessLog, err := newAccessLog()
+	if err != nil {
+		glog.Fatalf("Failed to open access log: %v", err)
+	}
+
+	proofAudit, err := newProofAudit()
+	if err != nil {
+		glog.Fatalf("Failed to set up proof auditing: %v", err)
+	}
+
+	submissionAudit, err := newSubmissionAudit()
+	if err != nil {
+		glog.Fatalf("Failed to set up submission auditing: %v", err)
+	}
+	if w, ok := submissionAudit.(*ct.WebhookSubmissionAudit); ok {
+		defer w.Close()
+	}
 
+	opts := ct.InstanceOptions{Deadline: *rpcDeadlineFlag, DisableCompression: *disableCompressionFlag, TimeSource: newTimeSource(), AccessLog: accessLog, CORS: newCORSPolicy(), ProofAudit: proofAudit, SubmissionAudit: submissionAudit}
+	if *adminPortFlag != 0 {
+		opts.AdminMux = http.NewServeMux()
+	}
+	health := ct.NewHealthChecker(client, client.Err, *rpcDeadlineFlag)
+	requestClientCerts := false
+	var instances []*ct.LogContext
 	for _, c := range cfg {
-		if err := c.SetUpInstance(client, *rpcDeadlineFlag); err != nil {
+		instance, err := c.SetUpInstance(breaker, opts)
+		if err != nil {
 			glog.Fatalf("Failed to set up log instance for %+v: %v", cfg, err)
 		}
+		instances = append(instances, instance)
+		health.AddLog(c.Prefix, c.LogID)
+		requestClientCerts = requestClientCerts || len(c.ClientCAFile) > 0
+	}
+	health.RegisterHandlers()
+
+	var provisioner *ct.Provisioner
+	if len(*adminSigningKeysFlag) > 0 {
+		if opts.AdminMux == nil {
+			glog.Fatal("--admin_signing_keys needs --admin_port")
+		}
+		keys, err := readAdminSigningKeys(*adminSigningKeysFlag)
+		if err != nil {
+			glog.Fatalf("Failed to read admin signing keys: %v", err)
+		}
+		provisioner, err = ct.NewProvisioner(*logConfigFlag, *provisionDirFlag, cfg, keys, breaker, opts, func(c ct.LogConfig) {
+			health.AddLog(c.Prefix, c.LogID)
+		})
+		if err != nil {
+			glog.Fatalf("Failed to set up log provisioning: %v", err)
+		}
+		provisioner.RegisterHandlers(opts.AdminMux)
+	}
+
+	tlsConfig, err := newTLSConfig(requestClientCerts)
+	if err != nil {
+		glog.Fatalf("Failed to set up TLS: %v", err)
+	}
+
+	if opts.AdminMux != nil {
+		go serveAdmin(opts.AdminMux, tlsConfig)
+	}
+	if *debugPortFlag != 0 {
+		go serveDebug(ct.NewDebugServer(*debugDumpDirFlag, util.SystemTimeSource{}))
 	}
 
-	// Bring up the HTTP server and serve until we get a signal not to.
-	go awaitSignal()
-	server := http.Server{Addr: fmt.Sprintf("localhost:%d", *serverPortFlag), Handler: nil}
-	err = server.ListenAndServe()
-	glog.Warningf("Server exited: %v", err)
+	listenAddrs := *listenFlag
+	if len(listenAddrs) == 0 {
+		listenAddrs = fmt.Sprintf("localhost:%d", *serverPortFlag)
+	}
+	listenOn, err := util.ParseListenAddrs(listenAddrs)
+	if err != nil {
+		glog.Fatalf("Invalid --listen: %v", err)
+	}
+	listeners, err := util.Listen(listenOn)
+	if err != nil {
+		glog.Fatalf("Failed to listen: %v", err)
+	}
+
+	// Bring up the HTTP server on every listener and serve until we get a signal not to.
+	server := newHTTPServer("", nil, tlsConfig)
+	shutdownDone := make(chan struct{})
+	go awaitSignal(server, *drainTimeoutFlag, shutdownDone)
+	serveErrs := make(chan error, len(listeners))
+	for i, l := range listeners {
+		glog.Infof("Serving CT log requests on %s", listenOn[i])
+		go func(l net.Listener) {
+			if tlsConfig != nil {
+				// The certificate comes from the config, not the arguments.
+				serveErrs <- server.ServeTLS(l, "", "")
+			} else {
+				serveErrs <- server.Serve(l)
+			}
+		}(l)
+	}
+	// Serve returns as soon as Shutdown is called, or if a listener fails.
+	if err := <-serveErrs; err != http.ErrServerClosed {
+		glog.Warningf("Server exited: %v", err)
+		glog.Flush()
+		os.Exit(1)
+	}
+
+	// Wait for the requests being drained before exiting, then stop the logs' background
+	// work, giving it as long again.
+	<-shutdownDone
+	closeCtx, cancel := context.WithTimeout(context.Background(), *drainTimeoutFlag)
+	defer cancel()
+	for _, instance := range instances {
+		if err := instance.Close(closeCtx); err != nil {
+			glog.Warningf("Log did not shut down cleanly: %v", err)
+		}
+	}
+	if provisioner != nil {
+		if err := provisioner.Close(closeCtx); err != nil {
+			glog.Warningf("Provisioned logs did not shut down cleanly: %v", err)
+		}
+	}
+	glog.Info("**** CT HTTP Server Stopped ****")
 	glog.Flush()
 }
@@ -139,6 +139,10 @@ func (m *CTMapper) oneMapperRun(ctx context.Context) (bool, error) {
 		if len(v.Inclusion) > 0 {
 			proofs++
 		}
+		// Domains not yet in the map come back with an empty value.
+		if len(v.KeyValue.Value.LeafValue) == 0 {
+			continue
+		}
 		if err := pb.Unmarshal(v.KeyValue.Value.LeafValue, &e); err != nil {
 			return false, err
 		}
@@ -0,0 +1,234 @@
+package ct
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	rtrace "runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/trace"
+)
+
+const (
+	// DebugPprofPath is the prefix of the profiling endpoints, which are compatible with
+	// "go tool pprof http://host:port/debug/pprof/heap" and the like.
+	DebugPprofPath = "/debug/pprof/"
+	// DebugVarsPath serves the exported variables as JSON.
+	DebugVarsPath = "/debug/vars"
+	// DebugDumpPath writes goroutine and heap dumps to files when POSTed to.
+	DebugDumpPath = "/debug/dump"
+	// DebugRequestsPath shows the spans of active and recent requests, as recorded by
+	// golang.org/x/net/trace.
+	DebugRequestsPath = "/debug/requests"
+	// DebugEventsPath shows the long lived event logs recorded by golang.org/x/net/trace.
+	DebugEventsPath = "/debug/events"
+
+	// defaultProfileDuration is how long CPU profiles and traces run for if the request
+	// doesn't say.
+	defaultProfileDuration = 30 * time.Second
+	// maxProfileDuration bounds the length of CPU profiles and traces, which can hold the
+	// connection open for that long.
+	maxProfileDuration = 5 * time.Minute
+)
+
+// DebugServer serves profiling and runtime debug endpoints. They can be expensive and
+// leak details of the server, so they should only be served on a private address.
+//
+// The net/http/pprof package isn't used because importing it registers its handlers on
+// http.DefaultServeMux, which also serves the public CT API.
+type DebugServer struct {
+	dumpDir    string
+	timeSource util.TimeSource
+}
+
+// NewDebugServer creates a DebugServer that writes dumps to files in dumpDir, or the
+// system's temporary directory if dumpDir is empty.
+func NewDebugServer(dumpDir string, timeSource util.TimeSource) *DebugServer {
+	if len(dumpDir) == 0 {
+		dumpDir = os.TempDir()
+	}
+	return &DebugServer{dumpDir: dumpDir, timeSource: timeSource}
+}
+
+// Mux returns a ServeMux that serves the debug endpoints.
+func (d *DebugServer) Mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc(DebugPprofPath, d.pprofIndex)
+	mux.HandleFunc(DebugPprofPath+"cmdline", d.cmdline)
+	mux.HandleFunc(DebugPprofPath+"profile", d.cpuProfile)
+	mux.HandleFunc(DebugPprofPath+"trace", d.trace)
+	mux.Handle(DebugVarsPath, expvar.Handler())
+	mux.HandleFunc(DebugDumpPath, d.dump)
+	// The x/net/trace handlers only serve clients on localhost, which is already taken
+	// care of, so the pages are rendered directly.
+	mux.HandleFunc(DebugRequestsPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentTypeHeader, "text/html; charset=utf-8")
+		trace.Render(w, r, true)
+	})
+	mux.HandleFunc(DebugEventsPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentTypeHeader, "text/html; charset=utf-8")
+		trace.RenderEvents(w, r, true)
+	})
+	return mux
+}
+
+// Dump writes the stacks of all goroutines and a heap profile to new files in the dump
+// directory, and returns their paths.
+func (d *DebugServer) Dump() ([]string, error) {
+	stamp := d.timeSource.Now().UTC().Format("20060102T150405.000000000")
+	var paths []string
+	for _, p := range []struct {
+		name  string
+		debug int
+	}{
+		{name: "goroutine", debug: 2},
+		{name: "heap", debug: 0},
+	} {
+		path := filepath.Join(d.dumpDir, fmt.Sprintf("ct_server.%s.%d.%s", p.name, os.Getpid(), stamp))
+		if err := writeProfile(path, p.name, p.debug); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	glog.Infof("Wrote debug dumps: %s", strings.Join(paths, ", "))
+	return paths, nil
+}
+
+func writeProfile(path, name string, debug int) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if name == "heap" {
+		// Make the heap profile reflect the live heap at the time of the dump.
+		runtime.GC()
+	}
+	if err := pprof.Lookup(name).WriteTo(f, debug); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s profile: %v", name, err)
+	}
+	return f.Close()
+}
+
+func (d *DebugServer) dump(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		sendHTTPError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", r.Method))
+		return
+	}
+	paths, err := d.Dump()
+	if err != nil {
+		sendHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set(contentTypeHeader, "text/plain")
+	for _, path := range paths {
+		fmt.Fprintln(w, path)
+	}
+}
+
+// pprofIndex lists the available profiles, or serves the named one, e.g.
+// /debug/pprof/goroutine?debug=1.
+func (d *DebugServer) pprofIndex(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, DebugPprofPath)
+	if len(name) > 0 {
+		p := pprof.Lookup(name)
+		if p == nil {
+			sendHTTPError(w, http.StatusNotFound, fmt.Errorf("unknown profile: %s", name))
+			return
+		}
+		debug, _ := strconv.Atoi(r.FormValue("debug"))
+		if debug > 0 {
+			w.Header().Set(contentTypeHeader, "text/plain; charset=utf-8")
+		} else {
+			w.Header().Set(contentTypeHeader, "application/octet-stream")
+		}
+		if name == "heap" && r.FormValue("gc") != "" {
+			runtime.GC()
+		}
+		p.WriteTo(w, debug)
+		return
+	}
+
+	w.Header().Set(contentTypeHeader, "text/html; charset=utf-8")
+	io.WriteString(w, "<html><head><title>/debug/pprof/</title></head><body>\n")
+	for _, p := range pprof.Profiles() {
+		fmt.Fprintf(w, "<a href=\"%s?debug=1\">%s</a> (%d)<br>\n", html.EscapeString(p.Name()), html.EscapeString(p.Name()), p.Count())
+	}
+	io.WriteString(w, "<br><a href=\"profile\">profile</a> (CPU, ?seconds=30)<br>\n")
+	io.WriteString(w, "<a href=\"trace\">trace</a> (?seconds=30)<br>\n")
+	io.WriteString(w, "</body></html>\n")
+}
+
+func (d *DebugServer) cmdline(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(contentTypeHeader, "text/plain; charset=utf-8")
+	io.WriteString(w, strings.Join(os.Args, "\x00"))
+}
+
+func (d *DebugServer) cpuProfile(w http.ResponseWriter, r *http.Request) {
+	duration, err := profileDuration(r)
+	if err != nil {
+		sendHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set(contentTypeHeader, "application/octet-stream")
+	if err := pprof.StartCPUProfile(w); err != nil {
+		// Only one CPU profile can run at a time.
+		sendHTTPError(w, http.StatusInternalServerError, fmt.Errorf("could not enable CPU profiling: %v", err))
+		return
+	}
+	sleep(r, duration)
+	pprof.StopCPUProfile()
+}
+
+func (d *DebugServer) trace(w http.ResponseWriter, r *http.Request) {
+	duration, err := profileDuration(r)
+	if err != nil {
+		sendHTTPError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set(contentTypeHeader, "application/octet-stream")
+	if err := rtrace.Start(w); err != nil {
+		sendHTTPError(w, http.StatusInternalServerError, fmt.Errorf("could not enable tracing: %v", err))
+		return
+	}
+	sleep(r, duration)
+	rtrace.Stop()
+}
+
+// profileDuration returns the duration requested by the seconds parameter of r.
+func profileDuration(r *http.Request) (time.Duration, error) {
+	param := r.FormValue("seconds")
+	if len(param) == 0 {
+		return defaultProfileDuration, nil
+	}
+	secs, err := strconv.ParseFloat(param, 64)
+	if err != nil || secs <= 0 {
+		return 0, fmt.Errorf("invalid seconds: %q", param)
+	}
+	duration := time.Duration(secs * float64(time.Second))
+	if duration > maxProfileDuration {
+		return 0, errors.New("seconds exceeds maximum profile duration")
+	}
+	return duration, nil
+}
+
+// sleep waits for duration, or until the client goes away.
+func sleep(r *http.Request, duration time.Duration) {
+	select {
+	case <-time.After(duration):
+	case <-r.Context().Done():
+	}
+}
@@ -0,0 +1,106 @@
+package ct
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/util"
+)
+
+func TestDebugEndpoints(t *testing.T) {
+	mux := NewDebugServer("", util.FakeTimeSource{FakeTime: fakeTime}).Mux()
+
+	var tests = []struct {
+		method   string
+		path     string
+		want     int
+		wantBody string
+	}{
+		{method: "GET", path: DebugPprofPath, want: http.StatusOK, wantBody: "goroutine"},
+		{method: "GET", path: DebugPprofPath + "goroutine?debug=1", want: http.StatusOK, wantBody: "TestDebugEndpoints"},
+		{method: "GET", path: DebugPprofPath + "heap", want: http.StatusOK},
+		{method: "GET", path: DebugPprofPath + "unknown", want: http.StatusNotFound},
+		{method: "GET", path: DebugPprofPath + "cmdline", want: http.StatusOK, wantBody: os.Args[0]},
+		{method: "GET", path: DebugPprofPath + "profile?seconds=0.01", want: http.StatusOK},
+		{method: "GET", path: DebugPprofPath + "profile?seconds=x", want: http.StatusBadRequest},
+		{method: "GET", path: DebugPprofPath + "trace?seconds=3600", want: http.StatusBadRequest},
+		{method: "GET", path: DebugVarsPath, want: http.StatusOK, wantBody: "memstats"},
+		{method: "GET", path: DebugDumpPath, want: http.StatusMethodNotAllowed},
+		{method: "GET", path: DebugRequestsPath, want: http.StatusOK, wantBody: "/debug/requests"},
+		{method: "GET", path: DebugEventsPath, want: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, "http://localhost"+test.path, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if got := w.Code; got != test.want {
+			t.Errorf("%s %s: status=%d, want %d", test.method, test.path, got, test.want)
+		}
+		if got := w.Body.String(); !strings.Contains(got, test.wantBody) {
+			t.Errorf("%s %s: body doesn't contain %q", test.method, test.path, test.wantBody)
+		}
+	}
+}
+
+func TestDebugDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debug_dump")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ts := &util.FakeTimeSource{FakeTime: fakeTime}
+	d := NewDebugServer(dir, ts)
+
+	req, err := http.NewRequest("POST", "http://localhost"+DebugDumpPath, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	d.Mux().ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("POST %s: status=%d, want %d", DebugDumpPath, got, want)
+	}
+	paths := strings.Fields(w.Body.String())
+	if got, want := len(paths), 2; got != want {
+		t.Fatalf("POST %s returned %d paths, want %d", DebugDumpPath, got, want)
+	}
+	for _, path := range paths {
+		if got, want := filepath.Dir(path), dir; got != want {
+			t.Errorf("dump %s written to %s, want %s", path, got, want)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("dump %s not written: %v", path, err)
+			continue
+		}
+		if info.Size() == 0 {
+			t.Errorf("dump %s is empty", path)
+		}
+	}
+	goroutines, err := ioutil.ReadFile(paths[0])
+	if err != nil {
+		t.Fatalf("Failed to read goroutine dump: %v", err)
+	}
+	if got, want := string(goroutines), "TestDebugDump"; !strings.Contains(got, want) {
+		t.Errorf("goroutine dump doesn't contain %q", want)
+	}
+
+	// Dumps never overwrite earlier ones.
+	if _, err := d.Dump(); err == nil {
+		t.Errorf("Dump() at the same time=nil, want error")
+	}
+	ts.FakeTime = ts.FakeTime.Add(time.Second)
+	if _, err := d.Dump(); err != nil {
+		t.Errorf("Dump()=_,%v", err)
+	}
+}
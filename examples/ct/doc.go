@@ -1,6 +1,15 @@
 /*
 Package ct contains a usage example by providing an implementation of an RFC6962 compatible CT
-log server using a Trillian log server as backend storage via its GRPC API.
+log server using a Trillian log server as backend storage via its GRPC API. Logs
+configured with a V2LogID also serve the RFC 6962-bis (CT v2) API from the same tree, which
+can then be built with a hash other than SHA-256 if the log only serves the v2 API, and
+logs with a TileStore also serve their tree as static tiles, which monitors can read
+through caches instead of making get-entries requests. Logs with a CheckpointKeyFile
+serve their tree head as a signed note checkpoint, for witnesses and other verifiers
+that aren't specific to CT. Logs with Gossip configured accept STHs and SCT feedback
+from clients, as in draft-ietf-trans-gossip, and exchange STHs with peer logs. Logs
+with Witnesses have their checkpoints cosigned, and serve the latest one with enough
+cosignatures so clients can require witness agreement.
 
 IMPORTANT: Only code rooted within this part of the tree should refer to the CT
 Github repository. Other parts of the system must not assume that the data they're
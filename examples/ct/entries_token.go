@@ -0,0 +1,57 @@
+package ct
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const entriesTokenVersion byte = 1
+
+// entriesTokenSize is the size of an encoded token: a version byte followed by the next
+// start index and the tree size, each as a big endian uint64.
+const entriesTokenSize = 1 + 8 + 8
+
+// entriesToken is the continuation state returned in a get-entries response that held
+// fewer entries than requested. Clients pass it back in place of the start parameter to
+// resume where the response left off. The token only holds information that's public
+// anyway, so it isn't authenticated; a modified token is no different to asking for
+// another start index.
+type entriesToken struct {
+	// nextStart is the index of the first entry not returned.
+	nextStart int64
+	// treeSize is the size of the tree when the response was built.
+	treeSize int64
+}
+
+// encode returns the token in the opaque form sent to clients.
+func (t entriesToken) encode() string {
+	b := make([]byte, entriesTokenSize)
+	b[0] = entriesTokenVersion
+	binary.BigEndian.PutUint64(b[1:], uint64(t.nextStart))
+	binary.BigEndian.PutUint64(b[9:], uint64(t.treeSize))
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeEntriesToken parses a token sent by a client.
+func decodeEntriesToken(s string) (entriesToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return entriesToken{}, fmt.Errorf("malformed token: %v", err)
+	}
+	if len(b) != entriesTokenSize {
+		return entriesToken{}, fmt.Errorf("malformed token: got %d bytes, want %d", len(b), entriesTokenSize)
+	}
+	if b[0] != entriesTokenVersion {
+		return entriesToken{}, fmt.Errorf("unsupported token version: %d", b[0])
+	}
+	t := entriesToken{
+		nextStart: int64(binary.BigEndian.Uint64(b[1:])),
+		treeSize:  int64(binary.BigEndian.Uint64(b[9:])),
+	}
+	if t.nextStart < 0 || t.treeSize < 0 {
+		return entriesToken{}, errors.New("malformed token: negative index")
+	}
+	return t, nil
+}
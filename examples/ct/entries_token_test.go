@@ -0,0 +1,144 @@
+package ct
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/trillian"
+)
+
+func TestEntriesTokenRoundTrip(t *testing.T) {
+	for _, want := range []entriesToken{{}, {nextStart: 10, treeSize: 10}, {nextStart: 1 << 40, treeSize: 1<<40 + 5}} {
+		got, err := decodeEntriesToken(want.encode())
+		if err != nil {
+			t.Errorf("decodeEntriesToken(%+v.encode())=%v", want, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("decodeEntriesToken(%+v.encode())=%+v", want, got)
+		}
+	}
+}
+
+func TestDecodeEntriesTokenErrors(t *testing.T) {
+	for _, token := range []string{
+		"not base64!",
+		"AQ",                      // too short
+		"AgAAAAAAAAAKAAAAAAAAAAo", // version 2
+		"Af__________AAAAAAAAAAo", // negative start
+	} {
+		if got, err := decodeEntriesToken(token); err == nil {
+			t.Errorf("decodeEntriesToken(%q)=%+v, want error", token, got)
+		}
+	}
+}
+
+func TestGetEntriesContinuationToken(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	handler := appHandler{context: info.c, handler: getEntries, name: "GetEntries", method: http.MethodGet}
+
+	var tests = []struct {
+		descr     string
+		req       string
+		indices   []int64
+		leaves    []*trillian.LogLeaf
+		rootErr   error
+		want      int
+		wantToken *entriesToken
+	}{
+		{
+			descr:   "full response",
+			req:     "start=1&end=2",
+			indices: []int64{1, 2},
+			leaves:  []*trillian.LogLeaf{{LeafIndex: 1}, {LeafIndex: 2}},
+			want:    http.StatusOK,
+		},
+		{
+			descr:     "short response",
+			req:       "start=1&end=3",
+			indices:   []int64{1, 2, 3},
+			leaves:    []*trillian.LogLeaf{{LeafIndex: 1}},
+			want:      http.StatusOK,
+			wantToken: &entriesToken{nextStart: 2, treeSize: 2},
+		},
+		{
+			descr:   "short response no tree size",
+			req:     "start=1&end=3",
+			indices: []int64{1, 2, 3},
+			leaves:  []*trillian.LogLeaf{{LeafIndex: 1}},
+			rootErr: errors.New("backendfailure"),
+			want:    http.StatusOK,
+		},
+		{
+			descr:   "resume from token",
+			req:     fmt.Sprintf("token=%s&end=3", entriesToken{nextStart: 2, treeSize: 2}.encode()),
+			indices: []int64{2, 3},
+			leaves:  []*trillian.LogLeaf{{LeafIndex: 2}, {LeafIndex: 3}},
+			want:    http.StatusOK,
+		},
+		{
+			descr: "token and start",
+			req:   fmt.Sprintf("start=1&token=%s&end=3", entriesToken{nextStart: 2, treeSize: 2}.encode()),
+			want:  http.StatusBadRequest,
+		},
+		{
+			descr: "bad token",
+			req:   "token=wibble&end=3",
+			want:  http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		if test.indices != nil {
+			rsp := &trillian.GetLeavesByIndexResponse{Status: okStatus, Leaves: test.leaves}
+			info.client.EXPECT().GetLeavesByIndex(deadlineMatcher(), &trillian.GetLeavesByIndexRequest{LogId: 0x42, LeafIndex: test.indices}).Return(rsp, nil)
+		}
+		if len(test.leaves) < len(test.indices) {
+			var rootRsp *trillian.GetLatestSignedLogRootResponse
+			if test.rootErr == nil {
+				rootRsp = makeGetRootResponseForTest(12345, 2, []byte("abcdabcdabcdabcdabcdabcdabcdabcd"))
+			}
+			info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), &trillian.GetLatestSignedLogRootRequest{LogId: 0x42}).Return(rootRsp, test.rootErr)
+		}
+
+		req, err := http.NewRequest("GET", fmt.Sprintf("/ct/v1/get-entries?%s", test.req), nil)
+		if err != nil {
+			t.Errorf("Failed to create request: %v", err)
+			continue
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got := w.Code; got != test.want {
+			t.Errorf("GetEntries(%s)=%d; want %d", test.descr, got, test.want)
+			continue
+		}
+		if test.want != http.StatusOK {
+			continue
+		}
+
+		var rsp getEntriesResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+			t.Errorf("GetEntries(%s) returned invalid JSON: %v", test.descr, err)
+			continue
+		}
+		if test.wantToken == nil {
+			if rsp.NextToken != "" {
+				t.Errorf("GetEntries(%s).NextToken=%q; want none", test.descr, rsp.NextToken)
+			}
+			continue
+		}
+		got, err := decodeEntriesToken(rsp.NextToken)
+		if err != nil {
+			t.Errorf("GetEntries(%s).NextToken=%q: %v", test.descr, rsp.NextToken, err)
+			continue
+		}
+		if got != *test.wantToken {
+			t.Errorf("GetEntries(%s).NextToken=%+v; want %+v", test.descr, got, *test.wantToken)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package ct
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// expiryPolicy decides whether a log accepts certificates that have already expired when
+// they're submitted. Chain validation ignores validity dates, so without it a log accepts
+// any expired certificate that chains to one of its roots.
+type expiryPolicy struct {
+	reject bool
+	// grace is how long after expiry a certificate is still accepted
+	grace time.Duration
+}
+
+// certExpiredError is returned for a submission rejected because its certificate has
+// expired.
+type certExpiredError struct {
+	notAfter time.Time
+	now      time.Time
+	grace    time.Duration
+}
+
+func (e certExpiredError) Error() string {
+	return fmt.Sprintf("certificate expired: NotAfter %v is more than %v before submission time %v", e.notAfter.UTC().Format(time.RFC3339), e.grace, e.now.UTC().Format(time.RFC3339))
+}
+
+// parseExpiryPolicy builds an expiryPolicy from a log's config. The grace period is a
+// duration string as accepted by time.ParseDuration, and may be empty for none.
+func parseExpiryPolicy(reject bool, grace string) (expiryPolicy, error) {
+	p := expiryPolicy{reject: reject}
+	if len(grace) == 0 {
+		return p, nil
+	}
+	if !reject {
+		return expiryPolicy{}, errors.New("ExpiredGracePeriod is only used with RejectExpired")
+	}
+	d, err := time.ParseDuration(grace)
+	if err != nil {
+		return expiryPolicy{}, fmt.Errorf("invalid ExpiredGracePeriod: %v", err)
+	}
+	if d < 0 {
+		return expiryPolicy{}, fmt.Errorf("ExpiredGracePeriod must not be negative, got %v", d)
+	}
+	p.grace = d
+	return p, nil
+}
+
+// check returns a certExpiredError if a certificate expiring at notAfter should be
+// rejected when submitted at now.
+func (p expiryPolicy) check(notAfter, now time.Time) error {
+	if p.reject && notAfter.Add(p.grace).Before(now) {
+		return certExpiredError{notAfter: notAfter, now: now, grace: p.grace}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package ct
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/examples/ct/testonly"
+	"github.com/google/trillian/util"
+)
+
+func TestParseExpiryPolicy(t *testing.T) {
+	var tests = []struct {
+		reject  bool
+		grace   string
+		wantErr bool
+	}{
+		{reject: false, grace: ""},
+		{reject: true, grace: ""},
+		{reject: true, grace: "24h"},
+		{reject: true, grace: "0s"},
+		{reject: false, grace: "24h", wantErr: true},
+		{reject: true, grace: "-1h", wantErr: true},
+		{reject: true, grace: "a day", wantErr: true},
+	}
+
+	for _, test := range tests {
+		if _, err := parseExpiryPolicy(test.reject, test.grace); (err != nil) != test.wantErr {
+			t.Errorf("parseExpiryPolicy(%v, %q)=%v, want error: %v", test.reject, test.grace, err, test.wantErr)
+		}
+	}
+}
+
+func TestExpiryPolicyCheck(t *testing.T) {
+	notAfter := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	accept := expiryPolicy{}
+	reject := expiryPolicy{reject: true}
+	grace := expiryPolicy{reject: true, grace: 24 * time.Hour}
+
+	var tests = []struct {
+		p       expiryPolicy
+		now     time.Time
+		wantErr bool
+	}{
+		{p: accept, now: notAfter.Add(-time.Hour)},
+		{p: accept, now: notAfter.Add(365 * 24 * time.Hour)},
+		{p: reject, now: notAfter.Add(-time.Hour)},
+		{p: reject, now: notAfter},
+		{p: reject, now: notAfter.Add(time.Second), wantErr: true},
+		{p: grace, now: notAfter.Add(time.Hour)},
+		{p: grace, now: notAfter.Add(24 * time.Hour)},
+		{p: grace, now: notAfter.Add(25 * time.Hour), wantErr: true},
+	}
+
+	for _, test := range tests {
+		if err := test.p.check(notAfter, test.now); (err != nil) != test.wantErr {
+			t.Errorf("%+v.check(%v, %v)=%v, want error: %v", test.p, notAfter, test.now, err, test.wantErr)
+		}
+	}
+}
+
+func TestAddChainExpired(t *testing.T) {
+	info := setupTest(t, []string{testonly.FakeCACertPEM})
+	defer info.mockCtrl.Finish()
+	// The leaf expires in July 2019, so it's rejected a year later without reaching the
+	// backend.
+	info.c.timeSource = &util.FakeTimeSource{FakeTime: time.Date(2020, 7, 12, 0, 0, 0, 0, time.UTC)}
+	info.c.expiry = expiryPolicy{reject: true, grace: 30 * 24 * time.Hour}
+
+	pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+	recorder := makeAddChainRequest(t, info.c, createJSONChain(t, *pool))
+	if got, want := recorder.Code, http.StatusBadRequest; got != want {
+		t.Errorf("addChain()=%d (body:%v); want %d", got, recorder.Body, want)
+	}
+	if got, want := recorder.Body.String(), "certificate expired"; !strings.Contains(got, want) {
+		t.Errorf("addChain() body=%q, want it to contain %q", got, want)
+	}
+}
@@ -0,0 +1,613 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency/go"
+	ctclient "github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/jsonclient"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+const (
+	// STHPollinationPath is where clients exchange STHs with the log, as described in
+	// draft-ietf-trans-gossip. The response holds STHs the log has collected.
+	STHPollinationPath = "/ct/v1/sth-pollination"
+	// SCTFeedbackPath is where clients report the SCTs they've seen, with the chains they
+	// were for, as described in draft-ietf-trans-gossip.
+	SCTFeedbackPath = "/ct/v1/sct-feedback"
+
+	// Default number of gossip requests accepted from a client each minute
+	defaultGossipRequestsPerMinute = 60
+	// Default number of STHs held for passing on to clients and peers
+	defaultGossipMaxSTHs = 1000
+	// Default number of SCT feedback entries held
+	defaultGossipMaxFeedback = 10000
+	// Default interval between exchanges of STHs with each peer
+	defaultGossipPeerPollInterval = 10 * time.Minute
+	// Deadline applied to each exchange with a peer
+	defaultGossipPeerDeadline = 30 * time.Second
+	// STHs older than this are neither accepted nor passed on, as in the draft
+	maxPollenAge = 14 * 24 * time.Hour
+	// Most STHs or SCT feedback entries accepted in a request, or returned in a response
+	maxGossipItemsPerRequest = 100
+	// Largest gossip request body accepted
+	maxGossipRequestBytes = 1 << 20
+	// Number of clients rate limits are tracked for before idle ones are forgotten
+	maxRateLimitedClients = 10000
+)
+
+// GossipEntrypoints is a list of the gossip entrypoint names as exposed in statistics.
+var GossipEntrypoints = []string{"STHPollination", "SCTFeedback"}
+
+// errUnknownLog is returned for STHs from logs the gossiper doesn't know the key of.
+var errUnknownLog = errors.New("STH is from an unknown log")
+
+// GossipConfig configures the gossip endpoints of a log, and the peer logs it exchanges
+// STHs with.
+type GossipConfig struct {
+	// RequestsPerMinute is the number of gossip requests each client IP address can make
+	// per minute, with bursts of up to that many. Zero means a default of 60.
+	RequestsPerMinute int
+	// MaxSTHs and MaxFeedback are the number of STHs and SCT feedback entries held, the
+	// oldest being dropped once there are more. Zero means defaults of 1000 and 10000.
+	MaxSTHs     int
+	MaxFeedback int
+	// Peers are logs whose STHs are fetched, and which are sent the STHs collected, every
+	// PeerPollInterval (a duration string, default 10m). STHs are only accepted from
+	// this log and its peers.
+	Peers            []GossipPeer
+	PeerPollInterval string
+}
+
+// GossipPeer identifies a peer log.
+type GossipPeer struct {
+	// URI is the base URI of the log, including any prefix.
+	URI string
+	// PubKeyPEMFile holds the log's public key, which its STHs must be signed with.
+	PubKeyPEMFile string
+}
+
+// STHPollination is the body of sth-pollination requests and responses.
+type STHPollination struct {
+	STHs []ct.SignedTreeHead `json:"sths"`
+}
+
+// SCTFeedback is the body of sct-feedback requests.
+type SCTFeedback struct {
+	Feedback []SCTFeedbackEntry `json:"sct_feedback"`
+}
+
+// SCTFeedbackEntry is a chain that a client saw, along with the TLS encoded SCTs that
+// came with it.
+type SCTFeedbackEntry struct {
+	X509Chain [][]byte `json:"x509_chain"`
+	SCTData   [][]byte `json:"sct_data"`
+}
+
+// gossipPeerClient is the part of a CT log client used to exchange STHs with a peer, so
+// that a client.LogClient can be used.
+type gossipPeerClient interface {
+	GetSTH(ctx context.Context) (*ct.SignedTreeHead, error)
+	PostAndParse(ctx context.Context, path string, req, rsp interface{}) (*http.Response, []byte, error)
+}
+
+type gossipPeer struct {
+	uri      string
+	logID    ct.SHA256Hash
+	verifier sthVerifier
+	client   gossipPeerClient
+}
+
+// sthKey identifies an STH for deduplication.
+type sthKey struct {
+	logID     ct.SHA256Hash
+	treeSize  uint64
+	timestamp uint64
+	root      ct.SHA256Hash
+}
+
+// treeKey identifies a tree size of a log. Two STHs with the same treeKey but different
+// roots show the log is presenting a split view.
+type treeKey struct {
+	logID    ct.SHA256Hash
+	treeSize uint64
+}
+
+// gossiper holds the STHs and SCT feedback gossiped to a log, and exchanges STHs with
+// its peers to help detect logs that show different views to different clients.
+type gossiper struct {
+	logPrefix   string
+	logID       ct.SHA256Hash
+	timeSource  util.TimeSource
+	verifiers   map[ct.SHA256Hash]sthVerifier
+	peers       []gossipPeer
+	limiter     *rateLimiter
+	maxSTHs     int
+	maxFeedback int
+	done        chan struct{}
+
+	mu       sync.Mutex
+	sths     []ct.SignedTreeHead // oldest first
+	seen     map[sthKey]bool
+	roots    map[treeKey]ct.SHA256Hash
+	feedback []SCTFeedbackEntry // oldest first
+	seenFB   map[[sha256.Size]byte]bool
+	fbKeys   [][sha256.Size]byte // parallel to feedback
+
+	exp struct {
+		vars             *expvar.Map
+		sthsReceived     *expvar.Int
+		sthsRejected     *expvar.Int
+		sthsStored       *expvar.Int
+		splitViews       *expvar.Int
+		feedbackReceived *expvar.Int
+		feedbackStored   *expvar.Int
+		rateLimited      *expvar.Int
+		peerFailures     *expvar.Int
+	}
+}
+
+// newGossiper creates a gossiper for the log c, which accepts STHs signed by c's tree head
+// key or by one of peers.
+func newGossiper(c LogContext, cfg *GossipConfig, peers []gossipPeer) (*gossiper, error) {
+	logID, err := GetCTLogID(c.logKeyManager)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logID: %v", err)
+	}
+	pubKey, err := c.sthKeyManager.GetPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := newSTHVerifier(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	rate := cfg.RequestsPerMinute
+	if rate == 0 {
+		rate = defaultGossipRequestsPerMinute
+	}
+	g := &gossiper{
+		logPrefix:   c.logPrefix,
+		logID:       logID,
+		timeSource:  c.timeSource,
+		verifiers:   map[ct.SHA256Hash]sthVerifier{ct.SHA256Hash(logID): verifier},
+		peers:       peers,
+		limiter:     newRateLimiter(float64(rate)/60, float64(rate), c.timeSource),
+		maxSTHs:     cfg.MaxSTHs,
+		maxFeedback: cfg.MaxFeedback,
+		done:        make(chan struct{}),
+		seen:        make(map[sthKey]bool),
+		roots:       make(map[treeKey]ct.SHA256Hash),
+		seenFB:      make(map[[sha256.Size]byte]bool),
+	}
+	for _, peer := range peers {
+		g.verifiers[peer.logID] = peer.verifier
+	}
+	if g.maxSTHs == 0 {
+		g.maxSTHs = defaultGossipMaxSTHs
+	}
+	if g.maxFeedback == 0 {
+		g.maxFeedback = defaultGossipMaxFeedback
+	}
+
+	g.exp.vars = new(expvar.Map).Init()
+	g.exp.sthsReceived = new(expvar.Int)
+	g.exp.vars.Set("sths-received", g.exp.sthsReceived)
+	g.exp.sthsRejected = new(expvar.Int)
+	g.exp.vars.Set("sths-rejected", g.exp.sthsRejected)
+	g.exp.sthsStored = new(expvar.Int)
+	g.exp.vars.Set("sths-stored", g.exp.sthsStored)
+	g.exp.splitViews = new(expvar.Int)
+	g.exp.vars.Set("split-views", g.exp.splitViews)
+	g.exp.feedbackReceived = new(expvar.Int)
+	g.exp.vars.Set("feedback-received", g.exp.feedbackReceived)
+	g.exp.feedbackStored = new(expvar.Int)
+	g.exp.vars.Set("feedback-stored", g.exp.feedbackStored)
+	g.exp.rateLimited = new(expvar.Int)
+	g.exp.vars.Set("rate-limited", g.exp.rateLimited)
+	g.exp.peerFailures = new(expvar.Int)
+	g.exp.vars.Set("peer-failures", g.exp.peerFailures)
+
+	return g, nil
+}
+
+// loadGossipPeers creates clients for the peers in cfg.
+func loadGossipPeers(cfg *GossipConfig) ([]gossipPeer, error) {
+	var peers []gossipPeer
+	for _, p := range cfg.Peers {
+		if len(p.URI) == 0 || len(p.PubKeyPEMFile) == 0 {
+			return nil, errors.New("gossip peers need a URI and PubKeyPEMFile")
+		}
+		pemData, err := ioutil.ReadFile(p.PubKeyPEMFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load gossip peer public key file: %v", err)
+		}
+		pubKey, logID, _, err := ct.PublicKeyFromPEM(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse gossip peer public key: %v", err)
+		}
+		verifier, err := newSTHVerifier(pubKey)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported gossip peer public key: %v", err)
+		}
+		client, err := ctclient.New(p.URI, nil, jsonclient.Options{PublicKey: string(pemData)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gossip peer client: %v", err)
+		}
+		peers = append(peers, gossipPeer{uri: p.URI, logID: logID, verifier: verifier, client: client})
+	}
+	return peers, nil
+}
+
+// Vars returns the statistics exported by this gossiper.
+func (g *gossiper) Vars() *expvar.Map {
+	return g.exp.vars
+}
+
+// addSTH checks an STH is recent and properly signed by a known log, and stores it if it
+// hasn't been seen before. An STH for a tree size that the log has already signed a
+// different root for is a critical error, as it shows the log is presenting a split view,
+// but it's kept so it's passed on to others.
+func (g *gossiper) addSTH(sth ct.SignedTreeHead, source string) error {
+	g.exp.sthsReceived.Add(1)
+	if err := g.checkSTH(sth); err != nil {
+		g.exp.sthsRejected.Add(1)
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := sthKey{logID: sth.LogID, treeSize: sth.TreeSize, timestamp: sth.Timestamp, root: sth.SHA256RootHash}
+	if g.seen[key] {
+		return nil
+	}
+	tk := treeKey{logID: sth.LogID, treeSize: sth.TreeSize}
+	if root, ok := g.roots[tk]; !ok {
+		g.roots[tk] = sth.SHA256RootHash
+	} else if root != sth.SHA256RootHash {
+		g.exp.splitViews.Add(1)
+		glog.Errorf("%s: CRITICAL: gossip: log %x has signed roots %x and %x for tree size %d, the latter from %s", g.logPrefix, sth.LogID, root, sth.SHA256RootHash, sth.TreeSize, source)
+	}
+
+	g.seen[key] = true
+	g.sths = append(g.sths, sth)
+	g.exp.sthsStored.Add(1)
+	for len(g.sths) > g.maxSTHs {
+		g.dropOldestSTH()
+	}
+	return nil
+}
+
+func (g *gossiper) checkSTH(sth ct.SignedTreeHead) error {
+	verifier, ok := g.verifiers[sth.LogID]
+	if !ok {
+		return errUnknownLog
+	}
+	ts := time.Unix(0, int64(sth.Timestamp)*int64(time.Millisecond))
+	now := g.timeSource.Now()
+	if now.Sub(ts) > maxPollenAge {
+		return fmt.Errorf("STH is too old: %v", ts)
+	}
+	if ts.Sub(now) > time.Minute {
+		return fmt.Errorf("STH is from the future: %v", ts)
+	}
+	if sth.Version != ct.V1 {
+		return fmt.Errorf("unsupported STH version %v", sth.Version)
+	}
+	if err := verifier.VerifySTHSignature(sth); err != nil {
+		return fmt.Errorf("STH signature doesn't verify: %v", err)
+	}
+	return nil
+}
+
+// dropOldestSTH forgets the oldest STH held. It must be called with g.mu held.
+func (g *gossiper) dropOldestSTH() {
+	sth := g.sths[0]
+	g.sths = g.sths[1:]
+	delete(g.seen, sthKey{logID: sth.LogID, treeSize: sth.TreeSize, timestamp: sth.Timestamp, root: sth.SHA256RootHash})
+	tk := treeKey{logID: sth.LogID, treeSize: sth.TreeSize}
+	if g.roots[tk] == sth.SHA256RootHash {
+		delete(g.roots, tk)
+	}
+}
+
+// pollen returns up to max of the most recently stored STHs that are still fresh enough
+// to pass on, newest first.
+func (g *gossiper) pollen(max int) []ct.SignedTreeHead {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.timeSource.Now()
+	sths := []ct.SignedTreeHead{}
+	for i := len(g.sths) - 1; i >= 0 && len(sths) < max; i-- {
+		ts := time.Unix(0, int64(g.sths[i].Timestamp)*int64(time.Millisecond))
+		if now.Sub(ts) <= maxPollenAge {
+			sths = append(sths, g.sths[i])
+		}
+	}
+	return sths
+}
+
+// addFeedback stores an SCT feedback entry if it hasn't been seen before.
+func (g *gossiper) addFeedback(entry SCTFeedbackEntry) error {
+	g.exp.feedbackReceived.Add(1)
+	if len(entry.X509Chain) == 0 || len(entry.SCTData) == 0 {
+		return errors.New("SCT feedback needs a chain and SCTs")
+	}
+	for _, data := range entry.SCTData {
+		var sct ct.SignedCertificateTimestamp
+		if rest, err := tls.Unmarshal(data, &sct); err != nil || len(rest) > 0 {
+			return errors.New("malformed SCT in feedback")
+		}
+	}
+
+	h := sha256.New()
+	for _, b := range append(entry.X509Chain, entry.SCTData...) {
+		fmt.Fprintf(h, "%d:", len(b))
+		h.Write(b)
+	}
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.seenFB[key] {
+		return nil
+	}
+	g.seenFB[key] = true
+	g.feedback = append(g.feedback, entry)
+	g.fbKeys = append(g.fbKeys, key)
+	g.exp.feedbackStored.Add(1)
+	for len(g.feedback) > g.maxFeedback {
+		delete(g.seenFB, g.fbKeys[0])
+		g.feedback, g.fbKeys = g.feedback[1:], g.fbKeys[1:]
+	}
+	return nil
+}
+
+// Start starts a goroutine that exchanges STHs with the peers straight away, and then
+// every interval until Stop is called. The log's own latest STH is added first, so it's
+// passed on to the peers. It does nothing if there are no peers.
+func (g *gossiper) Start(c LogContext, interval time.Duration) {
+	if len(g.peers) == 0 {
+		return
+	}
+	go func() {
+		g.pollPeers(c)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-g.done:
+				return
+			case <-ticker.C:
+				g.pollPeers(c)
+			}
+		}
+	}()
+}
+
+// Stop stops exchanging STHs with the peers.
+func (g *gossiper) Stop() {
+	close(g.done)
+}
+
+// pollPeers adds the log's latest STH, then exchanges STHs with each peer in turn.
+func (g *gossiper) pollPeers(c LogContext) {
+	ctx, cancel := context.WithDeadline(context.Background(), getRPCDeadlineTime(c, "Gossip"))
+	sth, err := g.ownSTH(ctx, c)
+	cancel()
+	if err != nil {
+		glog.Warningf("%s: gossip: failed to get own STH: %v", g.logPrefix, err)
+	} else if err := g.addSTH(*sth, "self"); err != nil {
+		glog.Warningf("%s: gossip: own STH rejected: %v", g.logPrefix, err)
+	}
+
+	for _, peer := range g.peers {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultGossipPeerDeadline)
+		err := g.pollPeer(ctx, peer)
+		cancel()
+		if err != nil {
+			g.exp.peerFailures.Add(1)
+			glog.Warningf("%s: gossip: exchange with %s failed: %v", g.logPrefix, peer.uri, err)
+		}
+	}
+}
+
+func (g *gossiper) ownSTH(ctx context.Context, c LogContext) (*ct.SignedTreeHead, error) {
+	slr, err := getLatestLogRoot(ctx, c, "Gossip")
+	if err != nil {
+		return nil, err
+	}
+	sth, err := signTreeHeadForRoot(c.sthKeyManager, *slr)
+	if err != nil {
+		return nil, err
+	}
+	sth.LogID = g.logID
+	return &sth, nil
+}
+
+// pollPeer fetches a peer's latest STH, then sends it the STHs collected and stores the
+// ones it sends back.
+func (g *gossiper) pollPeer(ctx context.Context, peer gossipPeer) error {
+	sth, err := peer.client.GetSTH(ctx)
+	if err != nil {
+		return fmt.Errorf("get-sth failed: %v", err)
+	}
+	sth.Version = ct.V1
+	sth.LogID = peer.logID
+	if err := g.addSTH(*sth, peer.uri); err != nil {
+		return fmt.Errorf("STH rejected: %v", err)
+	}
+
+	var rsp STHPollination
+	if _, _, err := peer.client.PostAndParse(ctx, STHPollinationPath, STHPollination{STHs: g.pollen(maxGossipItemsPerRequest)}, &rsp); err != nil {
+		return fmt.Errorf("sth-pollination failed: %v", err)
+	}
+	for _, sth := range rsp.STHs {
+		// Peers may know logs this one doesn't; that's fine.
+		if err := g.addSTH(sth, peer.uri); err != nil && err != errUnknownLog {
+			glog.V(1).Infof("%s: gossip: STH from %s rejected: %v", g.logPrefix, peer.uri, err)
+		}
+	}
+	return nil
+}
+
+// checkGossipRequest applies the client's rate limit and parses the JSON body of a
+// gossip request into req.
+func checkGossipRequest(c LogContext, r *http.Request, req interface{}) (int, error) {
+	if !c.gossip.limiter.allow(clientIP(r)) {
+		c.gossip.exp.rateLimited.Add(1)
+		return http.StatusTooManyRequests, errors.New("too many gossip requests, try again later")
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxGossipRequestBytes+1))
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to read request body: %v", err)
+	}
+	if len(body) > maxGossipRequestBytes {
+		return http.StatusRequestEntityTooLarge, errors.New("request body too large")
+	}
+	if err := json.Unmarshal(body, req); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to parse request body: %v", err)
+	}
+	return http.StatusOK, nil
+}
+
+func sthPollination(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	var req STHPollination
+	if status, err := checkGossipRequest(c, r, &req); err != nil {
+		return status, err
+	}
+	if len(req.STHs) > maxGossipItemsPerRequest {
+		return http.StatusBadRequest, fmt.Errorf("too many STHs: %d, limit is %d", len(req.STHs), maxGossipItemsPerRequest)
+	}
+	// Bad STHs don't fail the request, the client may not be able to tell.
+	for _, sth := range req.STHs {
+		if err := c.gossip.addSTH(sth, clientIP(r)); err != nil {
+			glog.V(1).Infof("%s: gossip: STH from %s rejected: %v", c.logPrefix, clientIP(r), err)
+		}
+	}
+
+	jsonData, err := json.Marshal(STHPollination{STHs: c.gossip.pollen(maxGossipItemsPerRequest)})
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to marshal sth-pollination response: %v", err)
+	}
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	if _, err := w.Write(jsonData); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to write sth-pollination response: %v", err)
+	}
+	return http.StatusOK, nil
+}
+
+func sctFeedback(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	var req SCTFeedback
+	if status, err := checkGossipRequest(c, r, &req); err != nil {
+		return status, err
+	}
+	if len(req.Feedback) > maxGossipItemsPerRequest {
+		return http.StatusBadRequest, fmt.Errorf("too many feedback entries: %d, limit is %d", len(req.Feedback), maxGossipItemsPerRequest)
+	}
+	for _, entry := range req.Feedback {
+		if err := c.gossip.addFeedback(entry); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// registerGossipHandlers registers the gossip entrypoints under prefix.
+func (c LogContext) registerGossipHandlers(prefix string) {
+	http.Handle(prefix+STHPollinationPath, appHandler{context: c, handler: sthPollination, name: "STHPollination", method: http.MethodPost})
+	http.Handle(prefix+SCTFeedbackPath, appHandler{context: c, handler: sctFeedback, name: "SCTFeedback", method: http.MethodPost})
+}
+
+// rateLimiter limits how often each client can make requests, with a token bucket per
+// client that fills at rate tokens per second up to burst.
+type rateLimiter struct {
+	rate       float64
+	burst      float64
+	timeSource util.TimeSource
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate, burst float64, timeSource util.TimeSource) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, timeSource: timeSource, buckets: make(map[string]*tokenBucket)}
+}
+
+// allow returns true if the client can make a request now, and uses up a token if so.
+func (l *rateLimiter) allow(client string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(client)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// reserve takes n tokens from the client's bucket, even if that leaves it in debt, and
+// returns how long the client must wait before the bucket is out of debt again.
+func (l *rateLimiter) reserve(client string, n float64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(client)
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / l.rate * float64(time.Second))
+}
+
+// bucket returns the client's bucket, filled up to now. It must be called with l.mu held.
+func (l *rateLimiter) bucket(client string) *tokenBucket {
+	now := l.timeSource.Now()
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitedClients {
+			l.forgetIdle(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	return b
+}
+
+// forgetIdle drops the clients whose buckets have filled up again, as they'd get a full
+// bucket anyway. It must be called with l.mu held.
+func (l *rateLimiter) forgetIdle(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package ct
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/mockclient"
+	trilliantestonly "github.com/google/trillian/testonly"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+// fakeGossipPeer is a peer log that returns a fixed STH, and answers sth-pollination
+// requests with fixed STHs.
+type fakeGossipPeer struct {
+	sth    *ct.SignedTreeHead
+	pollen []ct.SignedTreeHead
+	err    error
+	// sent holds the STHs the peer was sent
+	sent []ct.SignedTreeHead
+}
+
+func (f *fakeGossipPeer) GetSTH(ctx context.Context) (*ct.SignedTreeHead, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	sth := *f.sth
+	return &sth, nil
+}
+
+func (f *fakeGossipPeer) PostAndParse(ctx context.Context, path string, req, rsp interface{}) (*http.Response, []byte, error) {
+	if path != STHPollinationPath {
+		return nil, nil, errors.New("unexpected path " + path)
+	}
+	f.sent = req.(STHPollination).STHs
+	rsp.(*STHPollination).STHs = f.pollen
+	return &http.Response{StatusCode: http.StatusOK}, nil, nil
+}
+
+type gossipTestInfo struct {
+	c      LogContext
+	g      *gossiper
+	km     crypto.KeyManager
+	peerKM crypto.KeyManager
+	peer   *fakeGossipPeer
+	time   *util.FakeTimeSource
+}
+
+// setupGossipTest creates a gossiper for a log using the CT test key, with one peer using
+// the Trillian demo key.
+func setupGossipTest(t *testing.T, client *mockclient.MockTrillianLogClient, cfg GossipConfig) gossipTestInfo {
+	info := gossipTestInfo{km: loadTestKeyManager(t), peer: &fakeGossipPeer{}, time: &util.FakeTimeSource{FakeTime: fakeTime}}
+	peerKM := crypto.NewPEMKeyManager()
+	if err := peerKM.LoadPrivateKey(trilliantestonly.DemoPrivateKey, trilliantestonly.DemoPrivateKeyPass); err != nil {
+		t.Fatalf("Failed to load peer private key: %v", err)
+	}
+	if err := peerKM.LoadPublicKey(trilliantestonly.DemoPublicKey); err != nil {
+		t.Fatalf("Failed to load peer public key: %v", err)
+	}
+	info.peerKM = peerKM
+	peerID, err := GetCTLogID(peerKM)
+	if err != nil {
+		t.Fatalf("Failed to get peer log ID: %v", err)
+	}
+	pubKey, err := peerKM.GetPublicKey()
+	if err != nil {
+		t.Fatalf("Failed to get peer public key: %v", err)
+	}
+	verifier, err := ct.NewSignatureVerifier(pubKey)
+	if err != nil {
+		t.Fatalf("Failed to create peer verifier: %v", err)
+	}
+
+	info.c = *NewLogContext(0x42, "test", NewPEMCertPool(), client, info.km, time.Millisecond*500, info.time)
+	peers := []gossipPeer{{uri: "https://peer.example.com", logID: peerID, verifier: verifier, client: info.peer}}
+	info.g, err = newGossiper(info.c, &cfg, peers)
+	if err != nil {
+		t.Fatalf("newGossiper()=_,%v, want no error", err)
+	}
+	info.c.gossip = info.g
+	return info
+}
+
+// signSTH returns an STH signed by km for a tree of the given size, age and root.
+func signSTH(t *testing.T, km crypto.KeyManager, treeSize int64, age time.Duration, root byte) ct.SignedTreeHead {
+	slr := makeGetRootResponseForTest(fakeTime.Add(-age).UnixNano(), treeSize, bytes.Repeat([]byte{root}, 32)).SignedLogRoot
+	sth, err := signTreeHeadForRoot(km, *slr)
+	if err != nil {
+		t.Fatalf("signTreeHeadForRoot()=_,%v, want no error", err)
+	}
+	if sth.LogID, err = GetCTLogID(km); err != nil {
+		t.Fatalf("GetCTLogID()=_,%v, want no error", err)
+	}
+	return sth
+}
+
+func TestGossiperAddSTH(t *testing.T) {
+	info := setupGossipTest(t, nil, GossipConfig{})
+
+	unknown := signSTH(t, info.km, 10, time.Hour, 1)
+	unknown.LogID[0] ^= 0xff
+	badSig := signSTH(t, info.km, 10, time.Hour, 1)
+	badSig.SHA256RootHash[0] ^= 0xff
+	badVersion := signSTH(t, info.km, 10, time.Hour, 1)
+	badVersion.Version = ct.V1 + 1
+
+	var tests = []struct {
+		descr     string
+		sth       ct.SignedTreeHead
+		wantErr   bool
+		wantSTHs  int
+		wantSplit int64
+	}{
+		{descr: "own", sth: signSTH(t, info.km, 10, time.Hour, 1), wantSTHs: 1},
+		{descr: "duplicate", sth: signSTH(t, info.km, 10, time.Hour, 1), wantSTHs: 1},
+		{descr: "peer", sth: signSTH(t, info.peerKM, 10, time.Hour, 2), wantSTHs: 2},
+		{descr: "later", sth: signSTH(t, info.km, 10, time.Minute, 1), wantSTHs: 3},
+		{descr: "unknown log", sth: unknown, wantErr: true, wantSTHs: 3},
+		{descr: "too old", sth: signSTH(t, info.km, 9, maxPollenAge+time.Hour, 1), wantErr: true, wantSTHs: 3},
+		{descr: "future", sth: signSTH(t, info.km, 11, -time.Hour, 1), wantErr: true, wantSTHs: 3},
+		{descr: "bad signature", sth: badSig, wantErr: true, wantSTHs: 3},
+		{descr: "bad version", sth: badVersion, wantErr: true, wantSTHs: 3},
+		{descr: "split view", sth: signSTH(t, info.km, 10, time.Second, 3), wantSTHs: 4, wantSplit: 1},
+	}
+
+	for _, test := range tests {
+		err := info.g.addSTH(test.sth, "test")
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: addSTH()=%v, want error: %v", test.descr, err, test.wantErr)
+		}
+		if got := len(info.g.pollen(100)); got != test.wantSTHs {
+			t.Errorf("%s: len(pollen())=%d, want %d", test.descr, got, test.wantSTHs)
+		}
+		if got := info.g.exp.splitViews.Value(); got != test.wantSplit {
+			t.Errorf("%s: split-views=%d, want %d", test.descr, got, test.wantSplit)
+		}
+	}
+	if got, want := info.g.exp.sthsRejected.Value(), int64(5); got != want {
+		t.Errorf("sths-rejected=%d, want %d", got, want)
+	}
+}
+
+func TestGossiperPollen(t *testing.T) {
+	info := setupGossipTest(t, nil, GossipConfig{MaxSTHs: 3})
+	for i := int64(1); i <= 4; i++ {
+		if err := info.g.addSTH(signSTH(t, info.km, i, maxPollenAge-time.Duration(i)*time.Hour, byte(i)), "test"); err != nil {
+			t.Fatalf("addSTH(%d)=%v, want no error", i, err)
+		}
+	}
+
+	// The oldest STH was dropped, and the rest come back newest first.
+	var got []uint64
+	for _, sth := range info.g.pollen(100) {
+		got = append(got, sth.TreeSize)
+	}
+	if want := []uint64{4, 3, 2}; !uint64sEqual(got, want) {
+		t.Errorf("pollen() tree sizes=%v, want %v", got, want)
+	}
+	if got := len(info.g.pollen(2)); got != 2 {
+		t.Errorf("len(pollen(2))=%d, want 2", got)
+	}
+
+	// STHs that have become too old aren't passed on.
+	info.time.FakeTime = fakeTime.Add(150 * time.Minute)
+	got = nil
+	for _, sth := range info.g.pollen(100) {
+		got = append(got, sth.TreeSize)
+	}
+	if want := []uint64{4, 3}; !uint64sEqual(got, want) {
+		t.Errorf("pollen() tree sizes later=%v, want %v", got, want)
+	}
+}
+
+func uint64sEqual(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGossiperAddFeedback(t *testing.T) {
+	info := setupGossipTest(t, nil, GossipConfig{MaxFeedback: 2})
+	sctData, err := tls.Marshal(ct.SignedCertificateTimestamp{
+		SCTVersion: ct.V1,
+		Timestamp:  1234,
+		Signature: ct.DigitallySigned{
+			Algorithm: tls.SignatureAndHashAlgorithm{Hash: tls.SHA256, Signature: tls.ECDSA},
+			Signature: []byte("signed"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal SCT: %v", err)
+	}
+
+	var tests = []struct {
+		descr      string
+		entry      SCTFeedbackEntry
+		wantErr    bool
+		wantStored int
+	}{
+		{descr: "valid", entry: SCTFeedbackEntry{X509Chain: [][]byte{[]byte("cert1")}, SCTData: [][]byte{sctData}}, wantStored: 1},
+		{descr: "duplicate", entry: SCTFeedbackEntry{X509Chain: [][]byte{[]byte("cert1")}, SCTData: [][]byte{sctData}}, wantStored: 1},
+		{descr: "no chain", entry: SCTFeedbackEntry{SCTData: [][]byte{sctData}}, wantErr: true, wantStored: 1},
+		{descr: "no SCTs", entry: SCTFeedbackEntry{X509Chain: [][]byte{[]byte("cert1")}}, wantErr: true, wantStored: 1},
+		{descr: "malformed SCT", entry: SCTFeedbackEntry{X509Chain: [][]byte{[]byte("cert1")}, SCTData: [][]byte{[]byte("sct")}}, wantErr: true, wantStored: 1},
+		{descr: "second", entry: SCTFeedbackEntry{X509Chain: [][]byte{[]byte("cert2")}, SCTData: [][]byte{sctData}}, wantStored: 2},
+		// Moving bytes between certificates in the chain makes a different entry.
+		{descr: "split chain", entry: SCTFeedbackEntry{X509Chain: [][]byte{[]byte("cert"), []byte("2")}, SCTData: [][]byte{sctData}}, wantStored: 2},
+		{descr: "first again", entry: SCTFeedbackEntry{X509Chain: [][]byte{[]byte("cert1")}, SCTData: [][]byte{sctData}}, wantStored: 2},
+	}
+
+	for _, test := range tests {
+		err := info.g.addFeedback(test.entry)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: addFeedback()=%v, want error: %v", test.descr, err, test.wantErr)
+		}
+		if got := len(info.g.feedback); got != test.wantStored {
+			t.Errorf("%s: len(feedback)=%d, want %d", test.descr, got, test.wantStored)
+		}
+	}
+	// The first entry was dropped to make room, so was stored again.
+	if got, want := info.g.exp.feedbackStored.Value(), int64(4); got != want {
+		t.Errorf("feedback-stored=%d, want %d", got, want)
+	}
+}
+
+func TestSTHPollination(t *testing.T) {
+	info := setupGossipTest(t, nil, GossipConfig{RequestsPerMinute: 2})
+	handler := appHandler{context: info.c, handler: sthPollination, name: "STHPollination", method: http.MethodPost}
+	own := signSTH(t, info.km, 10, time.Hour, 1)
+	bad := signSTH(t, info.km, 11, time.Hour, 1)
+	bad.SHA256RootHash[0] ^= 0xff
+
+	var tests = []struct {
+		descr      string
+		body       string
+		remoteAddr string
+		wantStatus int
+		wantSTHs   []ct.SignedTreeHead
+	}{
+		{descr: "bad STHs ignored", body: mustMarshalJSON(t, STHPollination{STHs: []ct.SignedTreeHead{own, bad}}), remoteAddr: "192.0.2.1:1234", wantStatus: http.StatusOK, wantSTHs: []ct.SignedTreeHead{own}},
+		{descr: "malformed", body: "{", remoteAddr: "192.0.2.1:1234", wantStatus: http.StatusBadRequest},
+		{descr: "rate limited", body: "{}", remoteAddr: "192.0.2.1:1234", wantStatus: http.StatusTooManyRequests},
+		{descr: "other client", body: "{}", remoteAddr: "192.0.2.2:1234", wantStatus: http.StatusOK, wantSTHs: []ct.SignedTreeHead{own}},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(http.MethodPost, "http://example.com/ct/v1/sth-pollination", bytes.NewReader([]byte(test.body)))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.RemoteAddr = test.remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got, want := w.Code, test.wantStatus; got != want {
+			t.Errorf("%s: sthPollination()=%d, want %d", test.descr, got, want)
+			continue
+		}
+		if test.wantStatus != http.StatusOK {
+			continue
+		}
+		var rsp STHPollination
+		if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+			t.Errorf("%s: failed to unmarshal response %q: %v", test.descr, w.Body.Bytes(), err)
+			continue
+		}
+		if got, want := mustMarshalJSON(t, rsp), mustMarshalJSON(t, STHPollination{STHs: test.wantSTHs}); got != want {
+			t.Errorf("%s: sthPollination()=%s, want %s", test.descr, got, want)
+		}
+	}
+}
+
+func mustMarshalJSON(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Failed to marshal %v: %v", v, err)
+	}
+	return string(data)
+}
+
+func TestSCTFeedback(t *testing.T) {
+	info := setupGossipTest(t, nil, GossipConfig{})
+	handler := appHandler{context: info.c, handler: sctFeedback, name: "SCTFeedback", method: http.MethodPost}
+	sctData, err := tls.Marshal(ct.SignedCertificateTimestamp{SCTVersion: ct.V1, Timestamp: 1234})
+	if err != nil {
+		t.Fatalf("Failed to marshal SCT: %v", err)
+	}
+
+	var tests = []struct {
+		descr      string
+		body       string
+		wantStatus int
+		wantStored int
+	}{
+		{descr: "valid", body: mustMarshalJSON(t, SCTFeedback{Feedback: []SCTFeedbackEntry{{X509Chain: [][]byte{[]byte("cert")}, SCTData: [][]byte{sctData}}}}), wantStatus: http.StatusOK, wantStored: 1},
+		{descr: "malformed SCT", body: mustMarshalJSON(t, SCTFeedback{Feedback: []SCTFeedbackEntry{{X509Chain: [][]byte{[]byte("cert")}, SCTData: [][]byte{[]byte("sct")}}}}), wantStatus: http.StatusBadRequest, wantStored: 1},
+		{descr: "malformed", body: "[]", wantStatus: http.StatusBadRequest, wantStored: 1},
+		{descr: "too large", body: string(make([]byte, maxGossipRequestBytes+1)), wantStatus: http.StatusRequestEntityTooLarge, wantStored: 1},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(http.MethodPost, "http://example.com/ct/v1/sct-feedback", bytes.NewReader([]byte(test.body)))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got, want := w.Code, test.wantStatus; got != want {
+			t.Errorf("%s: sctFeedback()=%d, want %d", test.descr, got, want)
+		}
+		if got := len(info.g.feedback); got != test.wantStored {
+			t.Errorf("%s: len(feedback)=%d, want %d", test.descr, got, test.wantStored)
+		}
+	}
+}
+
+func TestGossiperPollPeers(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	client := mockclient.NewMockTrillianLogClient(mockCtrl)
+	info := setupGossipTest(t, client, GossipConfig{})
+
+	client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), gomock.Any()).Return(makeGetRootResponseForTest(fakeTime.Add(-time.Minute).UnixNano(), 10, bytes.Repeat([]byte{1}, 32)), nil)
+	peerSTH := signSTH(t, info.peerKM, 20, time.Minute, 2)
+	info.peer.sth = &peerSTH
+	// The peer passes on a conflicting STH for its own tree, and one from a log that's
+	// unknown here.
+	conflicting := signSTH(t, info.peerKM, 20, time.Second, 3)
+	unknown := signSTH(t, info.peerKM, 5, time.Second, 3)
+	unknown.LogID[0] ^= 0xff
+	info.peer.pollen = []ct.SignedTreeHead{conflicting, unknown}
+
+	info.g.pollPeers(info.c)
+
+	if got, want := len(info.peer.sent), 2; got != want {
+		t.Fatalf("len(sent)=%d, want %d", got, want)
+	}
+	if got, want := info.peer.sent[0].TreeSize, uint64(20); got != want {
+		t.Errorf("sent[0].TreeSize=%d, want %d", got, want)
+	}
+	if got, want := info.peer.sent[1].LogID, info.g.logID; got != want {
+		t.Errorf("sent[1].LogID=%x, want own log ID %x", got, want)
+	}
+	if got, want := len(info.g.pollen(100)), 3; got != want {
+		t.Errorf("len(pollen())=%d, want %d", got, want)
+	}
+	if got, want := info.g.exp.splitViews.Value(), int64(1); got != want {
+		t.Errorf("split-views=%d, want %d", got, want)
+	}
+	if got, want := info.g.exp.peerFailures.Value(), int64(0); got != want {
+		t.Errorf("peer-failures=%d, want %d", got, want)
+	}
+
+	// A peer that can't be reached is counted as a failure.
+	client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), gomock.Any()).Return(makeGetRootResponseForTest(fakeTime.Add(-time.Minute).UnixNano(), 10, bytes.Repeat([]byte{1}, 32)), nil)
+	info.peer.err = errors.New("peer down")
+	info.g.pollPeers(info.c)
+	if got, want := info.g.exp.peerFailures.Value(), int64(1); got != want {
+		t.Errorf("peer-failures=%d, want %d", got, want)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	ts := &util.FakeTimeSource{FakeTime: fakeTime}
+	l := newRateLimiter(1, 2, ts)
+
+	var tests = []struct {
+		advance time.Duration
+		client  string
+		want    bool
+	}{
+		{client: "a", want: true},
+		{client: "a", want: true},
+		{client: "a", want: false},
+		{client: "b", want: true},
+		{advance: 500 * time.Millisecond, client: "a", want: false},
+		{advance: 500 * time.Millisecond, client: "a", want: true},
+		{client: "a", want: false},
+		// The bucket only fills up to the burst size.
+		{advance: time.Hour, client: "a", want: true},
+		{client: "a", want: true},
+		{client: "a", want: false},
+	}
+
+	for i, test := range tests {
+		ts.FakeTime = ts.FakeTime.Add(test.advance)
+		if got := l.allow(test.client); got != test.want {
+			t.Errorf("%d: allow(%s)=%v, want %v", i, test.client, got, test.want)
+		}
+	}
+
+	// Idle clients are forgotten.
+	l.forgetIdle(ts.FakeTime.Add(time.Hour))
+	if got := len(l.buckets); got != 0 {
+		t.Errorf("len(buckets)=%d after forgetIdle(), want 0", got)
+	}
+}
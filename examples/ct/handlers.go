@@ -1,6 +1,8 @@
 package ct
 
 import (
+	"bytes"
+	gocrypto "crypto"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
@@ -13,6 +15,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -21,6 +24,7 @@ import (
 	"github.com/google/certificate-transparency/go/x509"
 	"github.com/google/trillian"
 	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/monitoring"
 	"github.com/google/trillian/util"
 	"golang.org/x/net/context"
 )
@@ -28,8 +32,16 @@ import (
 const (
 	// HTTP content type header
 	contentTypeHeader string = "Content-Type"
+	// Non-standard status recorded for requests abandoned by the client, as used by nginx
+	statusClientClosedRequest = 499
 	// MIME content type for JSON
 	contentTypeJSON string = "application/json"
+	// HTTP entity tag header, used for conditional get-sth and get-roots requests
+	etagHeader string = "ETag"
+	// HTTP response header telling clients how many seconds to wait before retrying
+	retryAfterHeader string = "Retry-After"
+	// HTTP conditional request header checked against the entity tag
+	ifNoneMatchHeader string = "If-None-Match"
 	// The name of the JSON response map key in get-roots responses
 	jsonMapKeyCertificates string = "certificates"
 	// Max number of entries we allow in a get-entries request
@@ -38,6 +50,8 @@ const (
 	getEntriesParamStart = "start"
 	// The name of the get-entries end parameter
 	getEntriesParamEnd = "end"
+	// The name of the get-entries continuation token parameter, used instead of start
+	getEntriesParamToken = "token"
 	// The name of the get-proof-by-hash parameter
 	getProofParamHash = "hash"
 	// The name of the get-proof-by-hash tree size parameter
@@ -56,56 +70,99 @@ const (
 // an implementation of the http.Handler interface.
 type appHandler struct {
 	context LogContext
-	handler func(context.Context, LogContext, http.ResponseWriter, *http.Request) (int, error)
+	handler EndpointHandler
 	name    string
 	method  string
+	// privileged handlers only accept signed requests, whatever the log's config says
+	privileged bool
 }
 
-// ServeHTTP for an appHandler invokes the underlying handler function but
-// does additional common error processing.
+// ServeHTTP for an appHandler invokes the underlying handler function through the
+// endpoint's middleware chain, and sends the client any error it returns.
 func (a appHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	a.context.exp.vars.Add("http-all-reqs", 1)
-	a.context.exp.reqs.Add(a.name, 1)
-	glog.V(2).Infof("%s: request %v %q => %s", a.context.logPrefix, r.Method, r.URL, a.name)
-	if r.Method != a.method {
-		glog.Warningf("%s: %s wrong HTTP method: %v", a.context.logPrefix, a.name, r.Method)
-		sendHTTPError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", r.Method))
-		return
-	}
-
-	// For GET requests all params come as form encoded so we might as well parse them now.
-	// POSTs will decode the raw request body as JSON later.
-	if r.Method == http.MethodGet {
-		if err := r.ParseForm(); err != nil {
-			sendHTTPError(w, http.StatusBadRequest, fmt.Errorf("failed to parse form data: %v", err))
-			return
+	// Use the client's request ID if it sent a usable one, it's returned in the response
+	// and passed on to the backend so failures can be traced through both.
+	requestID := r.Header.Get(util.RequestIDHeader)
+	if !util.ValidRequestID(requestID) {
+		requestID = util.NewRequestID()
+	}
+	w.Header().Set(util.RequestIDHeader, requestID)
+
+	// Each request is timed in a span, which joins the client's trace if it sent a
+	// traceparent header, and is the parent of the spans for the work done for it here
+	// and in the backend.
+	ctx := util.NewRequestIDContext(r.Context(), requestID)
+	if sc, ok := util.ParseTraceParent(r.Header.Get(util.TraceParentHeader)); ok {
+		ctx = util.NewRemoteSpanContext(ctx, sc)
+	}
+	ctx, span := util.StartSpan(ctx, "ct."+a.name, a.context.logPrefix)
+
+	// Every request produces one access log record, which is filled in as it's handled.
+	s := &requestState{
+		id: requestID,
+		rec: &AccessLogRecord{
+			Time:      a.context.timeSource.Now(),
+			RequestID: requestID,
+			TraceID:   span.TraceID,
+			LogID:     a.context.logID,
+			LogPrefix: a.context.logPrefix,
+			Endpoint:  a.name,
+			Method:    r.Method,
+			ClientIP:  clientIP(r),
+		},
+		rw: &responseRecorder{ResponseWriter: w},
+	}
+	defer func() {
+		s.rec.Status = s.rw.status
+		if s.rec.Status == 0 {
+			s.rec.Status = http.StatusOK
 		}
-	}
-
-	// Many/most of the handlers forward the request on to the Log RPC server; impose a deadline
-	// on this onward request.
-	ctx, cancel := context.WithDeadline(r.Context(), getRPCDeadlineTime(a.context))
-	defer cancel()
+		s.rec.BytesWritten = s.rw.bytes
+		s.rec.LatencyMicros = int64(a.context.timeSource.Now().Sub(s.rec.Time) / time.Microsecond)
+		for i := len(s.done) - 1; i >= 0; i-- {
+			s.done[i]()
+		}
+		span.Printf("status=%d bytes=%d", s.rec.Status, s.rec.BytesWritten)
+		var err error
+		if len(s.rec.Error) > 0 {
+			err = errors.New(s.rec.Error)
+		}
+		span.Finish(err)
+	}()
 
-	status, err := a.handler(ctx, a.context, w, r)
-	glog.V(2).Infof("%s: %s <= status=%d", a.context.logPrefix, a.name, status)
-	a.context.exp.allRsps.Add(strconv.Itoa(status), 1)
-	e := a.context.exp.rsps.Get(a.name)
-	if e, ok := e.(*expvar.Map); ok {
-		e.Add(strconv.Itoa(status), 1)
-	}
+	ctx = context.WithValue(ctx, requestStateKey{}, s)
+	ep := Endpoint{Name: a.name, Method: a.method, Privileged: a.privileged}
+	status, err := a.context.handlerFor(ep, a.handler)(ctx, a.context, s.rw, r)
 	if err != nil {
-		glog.Warningf("%s: %s handler error: %v", a.context.logPrefix, a.name, err)
-		sendHTTPError(w, status, err)
+		a.fail(s, status, err)
 		return
 	}
 
-	// Additional check, for consistency the handler must return an error for non-200 status
-	if status != http.StatusOK {
-		glog.Warningf("%s: %s handler non 200 without error: %d %v", a.context.logPrefix, a.name, status, err)
-		sendHTTPError(w, http.StatusInternalServerError, fmt.Errorf("http handler misbehaved, status: %d", status))
+	// Additional check, for consistency the handler must return an error for non-200 status.
+	// The exceptions are 304 for conditional requests and 204 for CORS preflights, both of
+	// which have already been written.
+	if status != http.StatusOK && status != http.StatusNotModified && status != http.StatusNoContent {
+		a.fail(s, http.StatusInternalServerError, fmt.Errorf("http handler misbehaved, status: %d", status))
+	}
+}
+
+// fail sends err to the client as the response to a failed request, unless the response
+// has already been started. The response is written straight to the recorder as any
+// compressing writer has already been closed.
+func (a appHandler) fail(s *requestState, status int, err error) {
+	s.rec.Error = err.Error()
+	if s.rw.status != 0 {
+		// Too late to change the response, the client sees it cut short.
 		return
 	}
+	switch err := err.(type) {
+	case handlerPanic:
+		sendHTTPError(s.rw, status, fmt.Errorf("internal error\nrequest id: %s", s.id))
+	case jsonError:
+		sendJSONError(s.rw, status, err)
+	default:
+		sendHTTPError(s.rw, status, fmt.Errorf("%v\nrequest id: %s", err, s.id))
+	}
 }
 
 // LogContext holds information for a specific log instance.
@@ -116,16 +173,108 @@ type LogContext struct {
 	urlPrefix string
 	// logPrefix is a pre-formatted string identifying the log for diagnostics
 	logPrefix string
-	// trustedRoots is a pool of certificates that defines the roots the CT log will accept
-	trustedRoots *PEMCertPool
+	// description is the log's human readable description served by get-log-info
+	description string
+	// trustedRoots holds the pool of certificates that defines the roots the CT log will accept
+	trustedRoots *TrustedRoots
 	// rpcClient is the client used to communicate with the trillian backend
 	rpcClient trillian.TrillianLogClient
-	// logKeyManager holds the keys this log needs to sign objects
+	// logKeyManager holds the key this log signs SCTs with, whose hash is the log's ID
 	logKeyManager crypto.KeyManager
-	// rpcDeadline is the deadline that will be set on all backend RPC requests
+	// sthKeyManager holds the key this log signs tree heads with, which is logKeyManager
+	// unless the log has a separate key for them
+	sthKeyManager crypto.KeyManager
+	// rpcDeadline is the deadline that will be set on backend RPC requests
 	rpcDeadline time.Duration
+	// endpointDeadlines overrides rpcDeadline for particular entrypoints
+	endpointDeadlines map[string]time.Duration
 	// timeSource is a util.TimeSource that can be injected for testing
 	timeSource util.TimeSource
+	// compressResponses enables gzip / deflate response encoding for clients that accept it
+	compressResponses bool
+	// mirror, if set, forwards accepted submissions to a secondary log
+	mirror *Mirror
+	// state says whether the log accepts submissions
+	state *logState
+	// mergeDelay, if set, is the log's maximum merge delay, which sets the deadline
+	// submissions are queued with
+	mergeDelay time.Duration
+	// sizeLimit, if set, makes the log reject submissions once the tree reaches a maximum size
+	sizeLimit *treeSizeLimit
+	// accessLog receives a record for every request handled
+	accessLog AccessLogSink
+	// requestDump logs a sample of requests while the admin API has turned it on
+	requestDump *requestDumper
+	// proofAudit, if set, records a sample of the proofs served
+	proofAudit *proofAuditor
+	// submissionAudit, if set, records every SCT issued
+	submissionAudit SubmissionAuditSink
+	// cors, if set, allows browsers to make cross-origin requests to the log
+	cors *CORSPolicy
+	// signedEntrypoints are the endpoints that only accept requests signed with one of
+	// the keys known to requestVerifier
+	signedEntrypoints map[string]bool
+	requestVerifier   *requestVerifier
+	// apiKeys, if set, identifies submitters by API key and applies their quotas
+	apiKeys *apiKeys
+	// concurrency, if set, limits the requests each endpoint handles at once
+	concurrency *concurrencyLimiter
+	// clientCerts, if set, makes POST endpoints require a verified TLS client certificate
+	clientCerts *clientCertVerifier
+	// rootsEditor, if set, lets the admin API change the roots the log accepts
+	rootsEditor *rootsEditor
+	// notAfter restricts the expiry dates of the certificates the log accepts
+	notAfter notAfterWindow
+	// expiry controls whether the log accepts certificates that have already expired
+	expiry expiryPolicy
+	// validity rejects future-dated certificates and ones with overly long validity periods
+	validity validityPolicy
+	// policies are applied, in order, to verified submissions
+	policies []Policy
+	// aia, if set, fetches intermediates missing from submitted chains
+	aia *aiaFetcher
+	// maxChainLength is the most certificates accepted in a submitted chain
+	maxChainLength int
+	// blocklist, if set, holds certificates the log refuses to accept
+	blocklist *blocklist
+	// final, if set, is the final tree head of a log that has been shut down
+	final *FinalTreeHead
+	// replica, if set, makes the log a read-only replica of another log, copying its
+	// entries and serving its tree heads
+	replica *replicator
+	// v2LogID, if set, is the log's RFC 6962-bis LogID, and the log also serves the v2 API
+	v2LogID []byte
+	// treeHash is the hash algorithm the backend builds the log's tree with, which sets
+	// the size of its root hashes
+	treeHash gocrypto.Hash
+	// backendRoot, if set, saves the backend's latest root so that after a restart the log
+	// can check the backend hasn't regressed or forked
+	backendRoot *backendRootTracker
+	// tiles, if set, writes the tree into a tile store that's served by the static read API
+	tiles *tileWriter
+	// checkpointSigner, if set, signs the checkpoints served at CheckpointPath
+	checkpointSigner *noteSigner
+	// gossip, if set, accepts STHs and SCT feedback from clients and exchanges STHs with
+	// peer logs
+	gossip *gossiper
+	// cosigner, if set, gets the log's checkpoints cosigned by witnesses, and the latest
+	// cosigned one is served at CosignedCheckpointPath
+	cosigner *cosigner
+	// slo, if set, measures the log's endpoints against their SLOs
+	slo *sloMonitor
+	// mergeTracker, if set, tracks how long submissions take to be merged into the log
+	mergeTracker *mergeDelayTracker
+	// entriesThrottle, if set, limits the bandwidth each client uses downloading entries
+	entriesThrottle *bandwidthThrottle
+	// streamEntriesMax, if more than maxGetEntriesAllowed, is the most entries served by
+	// a get-entries request, which are streamed to the client in batches
+	streamEntriesMax int64
+	// entriesParallelism is the most batches of a streamed get-entries request that are
+	// fetched from the backend at once
+	entriesParallelism int
+	// middleware overrides DefaultMiddleware for endpoints, keyed by endpoint name, or
+	// allEndpoints for those without a chain of their own
+	middleware map[string][]Middleware
 	// Various per-log statistics
 	exp struct {
 		vars             *expvar.Map // varname => expvar.Var, includes all below
@@ -136,23 +285,38 @@ type LogContext struct {
 		reqs    *expvar.Map // entrypoint => expvar.Int  (as "http-reqs")
 		allRsps *expvar.Map // http.rc => expvar.Int  (as "http-all-rsps")
 		rsps    *expvar.Map // entrypoint => expvar.Map[http.rc => expvar.Int]  (as "http-rsps")
+		panics  *expvar.Map // entrypoint => expvar.Int  (as "http-panics")
+		latency *expvar.Map // entrypoint => monitoring.Histogram  (as "http-latency-ms")
+		// Chains accepted and queued with the backend, including duplicates
+		submissions *expvar.Map // entrypoint => expvar.Int  (as "submissions")
+		// Submissions rejected by certificate policy checks
+		policyRejections *expvar.Map // rejection code => expvar.Int  (as "policy-rejections")
+		// Submissions of chains that were already in the log
+		duplicateSubmissions *expvar.Int
 	}
 }
 
 // Entrypoints is a list of entrypoint names as exposed in statistics.
-var Entrypoints = []string{"AddChain", "AddPreChain", "GetSTH", "GetSTHConsistency", "GetProofByHash", "GetEntries", "GetRoots", "GetEntryAndProof"}
+var Entrypoints = []string{"AddChain", "AddPreChain", "GetSTH", "GetSTHConsistency", "GetProofByHash", "GetEntries", "GetRoots", "GetEntryAndProof", "GetProofsByHash", "GetFinalSTH", "GetCheckpoint", "GetCosignedCheckpoint", "GetSTHByTimestamp", "GetSTHByTreeSize", "GetLogInfo"}
 
 // NewLogContext creates a new instance of LogContext.
 func NewLogContext(logID int64, prefix string, trustedRoots *PEMCertPool, rpcClient trillian.TrillianLogClient, km crypto.KeyManager, rpcDeadline time.Duration, timeSource util.TimeSource) *LogContext {
 	ctx := &LogContext{
-		logID:         logID,
-		urlPrefix:     prefix,
-		logPrefix:     fmt.Sprintf("%s{%d}", prefix, logID),
-		trustedRoots:  trustedRoots,
-		rpcClient:     rpcClient,
-		logKeyManager: km,
-		rpcDeadline:   rpcDeadline,
-		timeSource:    timeSource,
+		logID:             logID,
+		urlPrefix:         prefix,
+		logPrefix:         fmt.Sprintf("%s{%d}", prefix, logID),
+		trustedRoots:      NewTrustedRoots(trustedRoots),
+		rpcClient:         rpcClient,
+		logKeyManager:     km,
+		sthKeyManager:     km,
+		rpcDeadline:       rpcDeadline,
+		timeSource:        timeSource,
+		compressResponses: true,
+		accessLog:         glogAccessLog{},
+		maxChainLength:    DefaultMaxChainLength,
+		state:             newLogState(),
+		requestDump:       newRequestDumper(),
+		treeHash:          gocrypto.SHA256,
 	}
 
 	// Initialize all the exported variables.
@@ -161,6 +325,10 @@ func NewLogContext(logID int64, prefix string, trustedRoots *PEMCertPool, rpcCli
 	e := new(expvar.Int)
 	e.Set(logID)
 	ctx.exp.vars.Set("log-id", e)
+	// The prefix labels the log's stats when they're collected from the whole tree.
+	p := new(expvar.String)
+	p.Set(prefix)
+	ctx.exp.vars.Set("log-prefix", p)
 	ctx.exp.lastSCTTimestamp = new(expvar.Int)
 	ctx.exp.vars.Set("last-sct-timestamp", ctx.exp.lastSCTTimestamp)
 	ctx.exp.lastSTHTimestamp = new(expvar.Int)
@@ -174,10 +342,23 @@ func NewLogContext(logID int64, prefix string, trustedRoots *PEMCertPool, rpcCli
 	ctx.exp.allRsps = new(expvar.Map).Init()
 	ctx.exp.vars.Set("http-all-rsps", ctx.exp.allRsps)
 	ctx.exp.rsps = new(expvar.Map).Init()
-	for _, ep := range Entrypoints {
+	ctx.exp.latency = new(expvar.Map).Init()
+	for _, ep := range append(append(append(append(Entrypoints, V2Entrypoints...), TileEntrypoints...), GossipEntrypoints...), AdminEntrypoints...) {
 		ctx.exp.rsps.Set(ep, new(expvar.Map).Init())
+		ctx.exp.latency.Set(ep, monitoring.NewHistogram(monitoring.DefaultLatencyBucketsMillis))
 	}
 	ctx.exp.vars.Set("http-rsps", ctx.exp.rsps)
+	ctx.exp.vars.Set("http-latency-ms", ctx.exp.latency)
+	ctx.exp.panics = new(expvar.Map).Init()
+	ctx.exp.vars.Set("http-panics", ctx.exp.panics)
+	ctx.exp.vars.Set("frozen", ctx.state.frozen)
+	ctx.exp.vars.Set("request-dumps", ctx.requestDump.dumps)
+	ctx.exp.policyRejections = new(expvar.Map).Init()
+	ctx.exp.vars.Set("policy-rejections", ctx.exp.policyRejections)
+	ctx.exp.submissions = new(expvar.Map).Init()
+	ctx.exp.vars.Set("submissions", ctx.exp.submissions)
+	ctx.exp.duplicateSubmissions = new(expvar.Int)
+	ctx.exp.vars.Set("duplicate-submissions", ctx.exp.duplicateSubmissions)
 
 	return ctx
 }
@@ -185,38 +366,36 @@ func NewLogContext(logID int64, prefix string, trustedRoots *PEMCertPool, rpcCli
 func parseBodyAsJSONChain(c LogContext, r *http.Request) (ct.AddChainRequest, error) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		glog.V(1).Infof("%s: Failed to read request body: %v", c.logPrefix, err)
-		return ct.AddChainRequest{}, err
+		return ct.AddChainRequest{}, fmt.Errorf("failed to read request body: %v", err)
 	}
 
 	var req ct.AddChainRequest
 	if err := json.Unmarshal(body, &req); err != nil {
-		glog.V(1).Infof("%s: Failed to parse request body: %v", c.logPrefix, err)
-		return ct.AddChainRequest{}, err
+		return ct.AddChainRequest{}, fmt.Errorf("failed to parse request body: %v", err)
 	}
 
 	// The cert chain is not allowed to be empty. We'll defer other validation for later
+	// but reject very long chains now, so they don't use up CPU in path building.
 	if len(req.Chain) == 0 {
-		glog.V(1).Infof("%s: Request chain is empty: %s", c.logPrefix, body)
 		return ct.AddChainRequest{}, errors.New("cert chain was empty")
 	}
+	if err := checkChainLength(req.Chain, c.maxChainLength); err != nil {
+		return ct.AddChainRequest{}, err
+	}
 
 	return req, nil
 }
 
 // addChainInternal is called by add-chain and add-pre-chain as the logic involved in
 // processing these requests is almost identical
-// TODO(Martin2112): Doesn't properly handle duplicate submissions yet but the backend
-// needs this to be implemented before we can do it here
 func addChainInternal(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request, isPrecert bool) (int, error) {
-	var signerFn func(crypto.KeyManager, *x509.Certificate, *x509.Certificate, time.Time) (ct.MerkleTreeLeaf, ct.SignedCertificateTimestamp, error)
-	var method string
+	method := "AddChain"
 	if isPrecert {
 		method = "AddPreChain"
-		signerFn = signV1SCTForPrecertificate
-	} else {
-		method = "AddChain"
-		signerFn = signV1SCTForCertificate
+	}
+
+	if status, err := checkAcceptingSubmissions(ctx, c); err != nil {
+		return status, err
 	}
 
 	// Check the contents of the request and convert to slice of certificates.
@@ -224,51 +403,189 @@ func addChainInternal(ctx context.Context, c LogContext, w http.ResponseWriter,
 	if err != nil {
 		return http.StatusBadRequest, fmt.Errorf("failed to parse add-chain body: %v", err)
 	}
-	chain, err := verifyAddChain(c, addChainReq, w, isPrecert)
+	sub, status, err := queueChain(ctx, c, method, addChainReq, w, isPrecert)
+	if err != nil {
+		return status, err
+	}
+
+	// As the Log server has successfully queued up the Merkle tree leaf, we can
+	// respond with an SCT.
+	err = marshalAndWriteAddChainResponse(sub.sct, c.logKeyManager, w)
+	if err != nil {
+		// reason is logged and http status is already set
+		// TODO(Martin2112): Record failure for monitoring when it's implemented
+		return http.StatusInternalServerError, fmt.Errorf("failed to write response: %v", err)
+	}
+	glog.V(3).Infof("%s: %s <= SCT", c.logPrefix, method)
+	c.exp.lastSCTTimestamp.Set(int64(sub.sct.Timestamp))
+	auditSubmission(ctx, c, sub, isPrecert)
+
+	// Now the submitter has their SCT, pass the submission on to any secondary log.
+	mirrorSubmission(c, method, addChainReq.Chain, isPrecert)
+
+	return http.StatusOK, nil
+}
+
+// checkAcceptingSubmissions returns an error if the log isn't currently accepting
+// submissions, along with the HTTP status to report it with.
+func checkAcceptingSubmissions(ctx context.Context, c LogContext) (int, error) {
+	// A frozen log doesn't take submissions.
+	if c.state.isFrozen() {
+		return http.StatusForbidden, errLogFrozen
+	}
+	// Neither does one that's been shut down.
+	if c.final != nil {
+		return http.StatusForbidden, errLogShutDown(c.final)
+	}
+	// Nor does a replica of another log.
+	if c.replica != nil {
+		return http.StatusForbidden, errLogReplica
+	}
+	// A full log doesn't accept any more submissions, so don't bother checking them.
+	return checkTreeSizeLimit(ctx, c)
+}
+
+// submission is a chain that has been accepted by the log and queued with the backend.
+type submission struct {
+	// chain is the verified chain, starting with the submitted certificate
+	chain []*x509.Certificate
+	// merkleLeaf is the RFC 6962 leaf queued for the chain, and sct is the RFC 6962 SCT
+	// for it
+	merkleLeaf ct.MerkleTreeLeaf
+	sct        ct.SignedCertificateTimestamp
+	// duplicate is set if the certificate was already in the log, so sct is the one
+	// originally issued for it
+	duplicate bool
+}
+
+// sctSigner builds the MerkleTreeLeaf for a certificate or precertificate and signs an
+// SCT for it.
+type sctSigner func(km crypto.KeyManager, cert, issuer *x509.Certificate, t time.Time) (ct.MerkleTreeLeaf, ct.SignedCertificateTimestamp, error)
+
+// queueChain verifies a submitted chain and queues a leaf for it with the backend. The
+// leaf is an RFC 6962 MerkleTreeLeaf whichever version of the API the chain was
+// submitted with, so that all the versions serve the same tree. If the chain's
+// certificate is already in the log the backend doesn't queue it again, and the SCT
+// returned is the one for the existing leaf.
+func queueChain(ctx context.Context, c LogContext, method string, req ct.AddChainRequest, w http.ResponseWriter, isPrecert bool) (submission, int, error) {
+	vctx, span := util.StartSpan(ctx, "ct.VerifyChain", c.logPrefix)
+	chain, err := verifyAddChain(vctx, c, req, w, isPrecert)
+	span.Finish(err)
 	if err != nil {
-		return http.StatusBadRequest, fmt.Errorf("failed to verify add-chain contents: %v", err)
+		return submission{}, http.StatusBadRequest, fmt.Errorf("failed to verify add-chain contents: %v", err)
+	}
+
+	var signerFn sctSigner = signV1SCTForCertificate
+	if isPrecert {
+		signerFn = signV1SCTForPrecertificate
+		if len(chain) > 1 && IsPrecertSigningCert(chain[1]) {
+			signerFn = signV1SCTForPrecertSigningCert
+		}
 	}
 
 	// Build up the SCT and MerkleTreeLeaf. The SCT will be returned to the client and
 	// the leaf will become part of the data sent to the backend.
-	var issuer *x509.Certificate
-	if len(chain) > 1 {
-		issuer = chain[1]
+	issuer, err := finalIssuer(chain, c.trustedRoots.Pool())
+	if err != nil {
+		return submission{}, http.StatusBadRequest, err
 	}
+	_, span = util.StartSpan(ctx, "ct.SignSCT", c.logPrefix)
 	merkleLeaf, sct, err := signerFn(c.logKeyManager, chain[0], issuer, c.timeSource.Now())
+	span.Finish(err)
 	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("failed to build SCT and Merkle leaf: %v %v", sct, err)
+		return submission{}, http.StatusInternalServerError, fmt.Errorf("failed to build SCT and Merkle leaf: %v %v", sct, err)
 	}
 
 	// Send the Merkle tree leaf on to the Log server.
 	leaf, err := buildLogLeafForAddChain(c, merkleLeaf, chain)
 	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("failed to build LogLeaf: %v", err)
+		return submission{}, http.StatusInternalServerError, fmt.Errorf("failed to build LogLeaf: %v", err)
+	}
+	if c.mergeDelay > 0 {
+		// SCT timestamps are in milliseconds.
+		leaf.MergeDeadlineNanos = int64(sct.Timestamp)*int64(time.Millisecond) + int64(c.mergeDelay)
 	}
-	req := trillian.QueueLeavesRequest{LogId: c.logID, Leaves: []*trillian.LogLeaf{&leaf}}
+	queueReq := trillian.QueueLeavesRequest{LogId: c.logID, Leaves: []*trillian.LogLeaf{&leaf}}
 
+	// The submission is tracked before it's queued, so it can't be merged unnoticed.
+	if c.mergeTracker != nil {
+		c.mergeTracker.track(leaf.LeafValueHash, time.Unix(0, int64(sct.Timestamp)*millisPerNano))
+	}
 	glog.V(2).Infof("%s: %s => grpc.QueueLeaves", c.logPrefix, method)
-	rsp, err := c.rpcClient.QueueLeaves(ctx, &req)
+	rsp, err := c.rpcClient.QueueLeaves(ctx, &queueReq)
 	glog.V(2).Infof("%s: %s <= grpc.QueueLeaves status=%v", c.logPrefix, method, rsp.GetStatus())
 	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("backend QueueLeaves request failed: %v", err)
+		err = fmt.Errorf("backend QueueLeaves request failed: %v", err)
+	} else if !rpcStatusOK(rsp.GetStatus()) {
+		err = fmt.Errorf("backend QueueLeaves request failed, status=%v", rsp.GetStatus())
 	}
-	if !rpcStatusOK(rsp.GetStatus()) {
-		return http.StatusInternalServerError, fmt.Errorf("backend QueueLeaves request failed, status=%v", rsp.GetStatus())
+	queued := rsp.GetQueuedLeaves()
+	duplicate := len(queued) == 1 && queued[0].Duplicate
+	if c.mergeTracker != nil && (err != nil || duplicate) {
+		c.mergeTracker.untrack(leaf.LeafValueHash)
+	}
+	if err != nil {
+		return submission{}, http.StatusInternalServerError, err
+	}
+	c.exp.submissions.Add(method, 1)
+	if duplicate {
+		merkleLeaf, sct, err = originalSCT(c, signerFn, chain[0], issuer, queued[0].GetLeaf())
+		if err != nil {
+			return submission{}, http.StatusInternalServerError, fmt.Errorf("failed to rebuild SCT for duplicate submission: %v", err)
+		}
+		glog.V(2).Infof("%s: %s duplicate submission, returning SCT with timestamp %d", c.logPrefix, method, sct.Timestamp)
+		c.exp.duplicateSubmissions.Add(1)
 	}
 
-	// As the Log server has successfully queued up the Merkle tree leaf, we can
-	// respond with an SCT.
-	err = marshalAndWriteAddChainResponse(sct, c.logKeyManager, w)
+	return submission{chain: chain, merkleLeaf: merkleLeaf, sct: sct, duplicate: duplicate}, http.StatusOK, nil
+}
+
+// originalSCT rebuilds the SCT issued when a certificate was first submitted, from the
+// leaf the backend already has for it. The SCT is signed again with the leaf's
+// timestamp, so it's valid for the leaf in the log. This doesn't depend on any state in
+// the frontend, so resubmissions get the original SCT across restarts and from any of
+// a log's frontends.
+func originalSCT(c LogContext, signerFn sctSigner, cert, issuer *x509.Certificate, leaf *trillian.LogLeaf) (ct.MerkleTreeLeaf, ct.SignedCertificateTimestamp, error) {
+	var existing ct.MerkleTreeLeaf
+	if rest, err := tls.Unmarshal(leaf.GetLeafValue(), &existing); err != nil {
+		return ct.MerkleTreeLeaf{}, ct.SignedCertificateTimestamp{}, fmt.Errorf("failed to deserialize existing leaf: %v", err)
+	} else if len(rest) > 0 {
+		return ct.MerkleTreeLeaf{}, ct.SignedCertificateTimestamp{}, errors.New("trailing data after existing leaf")
+	}
+	if existing.TimestampedEntry == nil {
+		return ct.MerkleTreeLeaf{}, ct.SignedCertificateTimestamp{}, errors.New("existing leaf has no timestamped entry")
+	}
+
+	t := time.Unix(0, int64(existing.TimestampedEntry.Timestamp)*millisPerNano)
+	merkleLeaf, sct, err := signerFn(c.logKeyManager, cert, issuer, t)
 	if err != nil {
-		// reason is logged and http status is already set
-		// TODO(Martin2112): Record failure for monitoring when it's implemented
-		return http.StatusInternalServerError, fmt.Errorf("failed to write response: %v", err)
+		return ct.MerkleTreeLeaf{}, ct.SignedCertificateTimestamp{}, err
 	}
-	glog.V(3).Infof("%s: %s <= SCT", c.logPrefix, method)
-	c.exp.lastSCTTimestamp.Set(int64(sct.Timestamp))
 
-	return http.StatusOK, nil
+	// The identity hash only covers the certificate, so check the leaf really is the one
+	// for this submission: a precertificate could have been logged with another issuer.
+	leafData, err := tls.Marshal(merkleLeaf)
+	if err != nil {
+		return ct.MerkleTreeLeaf{}, ct.SignedCertificateTimestamp{}, err
+	}
+	if !bytes.Equal(leafData, leaf.GetLeafValue()) {
+		return ct.MerkleTreeLeaf{}, ct.SignedCertificateTimestamp{}, errors.New("existing leaf doesn't match the submission")
+	}
+	return merkleLeaf, sct, nil
+}
+
+// mirrorSubmission passes an accepted submission on to the secondary log, if there is one.
+func mirrorSubmission(c LogContext, method string, rawChain [][]byte, isPrecert bool) {
+	if c.mirror == nil {
+		return
+	}
+	mirrorChain := make([]ct.ASN1Cert, 0, len(rawChain))
+	for _, der := range rawChain {
+		mirrorChain = append(mirrorChain, ct.ASN1Cert{Data: der})
+	}
+	if err := c.mirror.Submit(mirrorChain, isPrecert); err != nil {
+		glog.Warningf("%s: %s failed to mirror submission: %v", c.logPrefix, method, err)
+	}
 }
 
 func addChain(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
@@ -280,70 +597,124 @@ func addPreChain(ctx context.Context, c LogContext, w http.ResponseWriter, r *ht
 }
 
 func getSTH(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	// A shut down log only ever serves its final tree head.
+	if c.final != nil {
+		return writeFinalSTH(c, w, r)
+	}
+	// A replica serves the latest tree head of its source that it matches.
+	if c.replica != nil {
+		return writeReplicaSTH(c, w, r)
+	}
+
+	slr, err := getLatestLogRoot(ctx, c, "GetSTH")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// If the client already has an STH for this tree head there's no need to sign a new one.
+	etag := sthETag(uint64(slr.TreeSize), uint64(slr.TimestampNanos/millisPerNano), slr.RootHash)
+	if checkNotModified(w, r, etag) {
+		return http.StatusNotModified, nil
+	}
+
+	// Build the CT STH object, including a signature over its contents.
+	sth, err := signTreeHeadForRoot(c.sthKeyManager, *slr)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := setLogKeyID(w, c.sthKeyManager); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// Now build the final result object that will be marshalled to JSON
+	jsonRsp, err := sthResponse(sth)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	jsonData, err := json.Marshal(&jsonRsp)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to marshal response: %v %v", jsonRsp, err)
+	}
+
+	_, err = w.Write(jsonData)
+	if err != nil {
+		// Probably too late for this as headers might have been written but we don't know for sure
+		return http.StatusInternalServerError, fmt.Errorf("failed to write response data: %v", err)
+	}
+	c.exp.lastSTHTimestamp.Set(int64(sth.Timestamp))
+	c.exp.lastSTHTreeSize.Set(int64(sth.TreeSize))
+	if c.sizeLimit != nil {
+		c.sizeLimit.update(slr.TreeSize, c.timeSource.Now())
+	}
+
+	return http.StatusOK, nil
+}
+
+// getLatestLogRoot fetches the latest log root from the backend and checks it's one the
+// log can serve.
+func getLatestLogRoot(ctx context.Context, c LogContext, method string) (*trillian.SignedLogRoot, error) {
 	// Forward on to the Log server.
 	req := trillian.GetLatestSignedLogRootRequest{LogId: c.logID}
-	glog.V(2).Infof("%s: GetSTH => grpc.GetLatestSignedLogRoot %+v", c.logPrefix, req)
+	glog.V(2).Infof("%s: %s => grpc.GetLatestSignedLogRoot %+v", c.logPrefix, method, req)
 	rsp, err := c.rpcClient.GetLatestSignedLogRoot(ctx, &req)
-	glog.V(2).Infof("%s: GetSTH <= grpc.GetLatestSignedLogRoot status=%v", c.logPrefix, rsp.GetStatus())
+	glog.V(2).Infof("%s: %s <= grpc.GetLatestSignedLogRoot status=%v", c.logPrefix, method, rsp.GetStatus())
 	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("backend GetLatestSignedLogRoot request failed: %v", err)
+		return nil, fmt.Errorf("backend GetLatestSignedLogRoot request failed: %v", err)
 	}
 	if !rpcStatusOK(rsp.GetStatus()) {
-		return http.StatusInternalServerError, fmt.Errorf("backend GetLatestSignedLogRoot request failed, status=%v", rsp.GetStatus())
+		return nil, fmt.Errorf("backend GetLatestSignedLogRoot request failed, status=%v", rsp.GetStatus())
 	}
 
 	// Check over the response.
 	slr := rsp.GetSignedLogRoot()
 	if slr == nil {
-		return http.StatusInternalServerError, fmt.Errorf("no log root returned")
+		return nil, fmt.Errorf("no log root returned")
 	}
-	glog.V(3).Infof("%s: GetSTH <= slr=%+v", c.logPrefix, slr)
+	glog.V(3).Infof("%s: %s <= slr=%+v", c.logPrefix, method, slr)
 	if treeSize := slr.TreeSize; treeSize < 0 {
-		return http.StatusInternalServerError, fmt.Errorf("bad tree size from backend: %d", treeSize)
+		return nil, fmt.Errorf("bad tree size from backend: %d", treeSize)
 	}
 
-	if hashSize := len(slr.RootHash); hashSize != sha256.Size {
-		return http.StatusInternalServerError, fmt.Errorf("bad hash size from backend expecting: %d got %d", sha256.Size, hashSize)
+	if err := c.checkRootHash(slr.RootHash); err != nil {
+		return nil, err
 	}
+	return slr, nil
+}
 
-	// Build the CT STH object, including a signature over its contents.
+// signTreeHeadForRoot builds and signs the CT STH for a log root from the backend. The
+// root must be of a SHA-256 tree, as that's the only kind an RFC 6962 STH can describe.
+func signTreeHeadForRoot(km crypto.KeyManager, slr trillian.SignedLogRoot) (ct.SignedTreeHead, error) {
+	if hashSize := len(slr.RootHash); hashSize != sha256.Size {
+		return ct.SignedTreeHead{}, fmt.Errorf("bad hash size from backend expecting: %d got %d", sha256.Size, hashSize)
+	}
 	sth := ct.SignedTreeHead{
 		Version:   ct.V1,
 		TreeSize:  uint64(slr.TreeSize),
 		Timestamp: uint64(slr.TimestampNanos / 1000 / 1000),
 	}
 	copy(sth.SHA256RootHash[:], slr.RootHash) // Checked size above.
-	err = signV1TreeHead(c.logKeyManager, &sth)
+	err := signV1TreeHead(km, &sth)
 	if err != nil || len(sth.TreeHeadSignature.Signature) == 0 {
-		return http.StatusInternalServerError, fmt.Errorf("failed to sign tree head: %v", err)
+		return ct.SignedTreeHead{}, fmt.Errorf("failed to sign tree head: %v", err)
 	}
+	return sth, nil
+}
 
-	// Now build the final result object that will be marshalled to JSON
+// sthResponse converts a signed tree head to its get-sth JSON form.
+func sthResponse(sth ct.SignedTreeHead) (ct.GetSTHResponse, error) {
 	jsonRsp := ct.GetSTHResponse{
 		TreeSize:       sth.TreeSize,
 		SHA256RootHash: sth.SHA256RootHash[:],
 		Timestamp:      sth.Timestamp,
 	}
+	var err error
 	jsonRsp.TreeHeadSignature, err = tls.Marshal(sth.TreeHeadSignature)
 	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("failed to tls.Marshal signature: %v", err)
-	}
-
-	w.Header().Set(contentTypeHeader, contentTypeJSON)
-	jsonData, err := json.Marshal(&jsonRsp)
-	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("failed to marshal response: %v %v", jsonRsp, err)
+		return ct.GetSTHResponse{}, fmt.Errorf("failed to tls.Marshal signature: %v", err)
 	}
-
-	_, err = w.Write(jsonData)
-	if err != nil {
-		// Probably too late for this as headers might have been written but we don't know for sure
-		return http.StatusInternalServerError, fmt.Errorf("failed to write response data: %v", err)
-	}
-	c.exp.lastSTHTimestamp.Set(int64(sth.Timestamp))
-	c.exp.lastSTHTreeSize.Set(int64(sth.TreeSize))
-
-	return http.StatusOK, nil
+	return jsonRsp, nil
 }
 
 func getSTHConsistency(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
@@ -351,7 +722,11 @@ func getSTHConsistency(ctx context.Context, c LogContext, w http.ResponseWriter,
 	if err != nil {
 		return http.StatusBadRequest, fmt.Errorf("failed to parse consistency range: %v", err)
 	}
-	req := trillian.GetConsistencyProofRequest{LogId: c.logID, FirstTreeSize: first, SecondTreeSize: second}
+	formatName, format, err := parseProofFormat(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	req := trillian.GetConsistencyProofRequest{LogId: c.logID, FirstTreeSize: first, SecondTreeSize: second, ProofFormat: format}
 
 	glog.V(2).Infof("%s: GetSTHConsistency(%d, %d) => grpc.GetConsistencyProof %+v", c.logPrefix, first, second, req)
 	rsp, err := c.rpcClient.GetConsistencyProof(ctx, &req)
@@ -367,6 +742,9 @@ func getSTHConsistency(ctx context.Context, c LogContext, w http.ResponseWriter,
 	if !checkAuditPath(rsp.Proof.ProofNode) {
 		return http.StatusInternalServerError, fmt.Errorf("backend returned invalid proof: %v", rsp.Proof)
 	}
+	if format != trillian.ProofFormat_PROOF_NODES {
+		return writeEncodedProof(w, formatName, nil, rsp.Proof)
+	}
 
 	// We got a valid response from the server. Marshal it as JSON and return it to the client
 	jsonRsp := ct.GetSTHConsistencyResponse{Consistency: auditPathFromProto(rsp.Proof.ProofNode)}
@@ -387,23 +765,13 @@ func getSTHConsistency(ctx context.Context, c LogContext, w http.ResponseWriter,
 }
 
 func getProofByHash(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
-	// Accept any non empty hash that decodes from base64 and let the backend validate it further
-	escapedHash := r.FormValue(getProofParamHash)
-	if len(escapedHash) == 0 {
-		return http.StatusBadRequest, errors.New("get-proof-by-hash: missing / empty hash param for get-proof-by-hash")
-	}
-	hash, err := url.QueryUnescape(escapedHash)
+	leafHash, treeSize, err := parseGetProofByHashParams(r)
 	if err != nil {
-		return http.StatusBadRequest, fmt.Errorf("get-proof-by-hash: invalid url-encoded hash: %v", err)
+		return http.StatusBadRequest, err
 	}
-	leafHash, err := base64.StdEncoding.DecodeString(hash)
+	formatName, format, err := parseProofFormat(r)
 	if err != nil {
-		return http.StatusBadRequest, fmt.Errorf("get-proof-by-hash: invalid base64 hash: %v", err)
-	}
-
-	treeSize, err := strconv.ParseInt(r.FormValue(getProofParamTreeSize), 10, 64)
-	if err != nil || treeSize < 1 {
-		return http.StatusBadRequest, fmt.Errorf("get-proof-by-hash: missing or invalid tree_size: %v", r.FormValue(getProofParamTreeSize))
+		return http.StatusBadRequest, err
 	}
 
 	// Per RFC 6962 section 4.5 the API returns a single proof. This should be the lowest leaf index
@@ -414,6 +782,7 @@ func getProofByHash(ctx context.Context, c LogContext, w http.ResponseWriter, r
 		LeafHash:        leafHash,
 		TreeSize:        treeSize,
 		OrderBySequence: true,
+		ProofFormat:     format,
 	}
 	rsp, err := c.rpcClient.GetInclusionProofByHash(ctx, &req)
 	if err != nil {
@@ -427,6 +796,9 @@ func getProofByHash(ctx context.Context, c LogContext, w http.ResponseWriter, r
 	if !checkAuditPath(rsp.Proof[0].ProofNode) {
 		return http.StatusInternalServerError, fmt.Errorf("get-proof-by-hash: backend returned invalid proof: %v", rsp.Proof[0])
 	}
+	if format != trillian.ProofFormat_PROOF_NODES {
+		return writeEncodedProof(w, formatName, &rsp.Proof[0].LeafIndex, rsp.Proof[0])
+	}
 
 	// All checks complete, marshal and return the response
 	proofRsp := ct.GetProofByHashResponse{LeafIndex: rsp.Proof[0].LeafIndex, AuditPath: auditPathFromProto(rsp.Proof[0].ProofNode)}
@@ -451,11 +823,48 @@ func getEntries(ctx context.Context, c LogContext, w http.ResponseWriter, r *htt
 	// The first job is to parse the params and make sure they're sensible. We just make
 	// sure the range is valid. We don't do an extra roundtrip to get the current tree
 	// size and prefer to let the backend handle this case
-	start, end, err := parseGetEntriesRange(r, maxGetEntriesAllowed)
+	maxRange := maxGetEntriesAllowed
+	if c.streamEntriesMax > maxRange {
+		maxRange = c.streamEntriesMax
+	}
+	start, end, err := parseGetEntriesRange(r, maxRange)
 	if err != nil {
 		return http.StatusBadRequest, fmt.Errorf("bad range on get-entries request: %v", err)
 	}
+	if end-start+1 > maxGetEntriesAllowed {
+		return streamEntries(ctx, c, w, start, end)
+	}
+
+	entries, err := fetchEntries(ctx, c, start, end)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	jsonRsp := getEntriesResponse{GetEntriesResponse: entries}
+
+	// If the backend returned fewer entries than requested, usually because the range
+	// extends past the end of the tree, tell the client where to carry on from.
+	if got := int64(len(entries.Entries)); got < end-start+1 {
+		jsonRsp.NextToken = nextEntriesToken(ctx, c, start+got)
+	}
+
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	jsonData, err := json.Marshal(&jsonRsp)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to marshal get-entries resp: %v because: %v", jsonRsp, err)
+	}
+
+	_, err = w.Write(jsonData)
+	if err != nil {
+		// Probably too late for this as headers might have been written but we don't know for sure
+		return http.StatusInternalServerError, fmt.Errorf("failed to write get-entries resp: %v because: %v", jsonRsp, err)
+	}
 
+	return http.StatusOK, nil
+}
+
+// fetchEntries gets the entries [start, end] from the backend, which may return fewer if
+// the range extends past the end of the tree.
+func fetchEntries(ctx context.Context, c LogContext, start, end int64) (ct.GetEntriesResponse, error) {
 	// Now make a request to the backend to get the relevant leaves
 	req := trillian.GetLeavesByIndexRequest{
 		LogId:     c.logID,
@@ -463,10 +872,10 @@ func getEntries(ctx context.Context, c LogContext, w http.ResponseWriter, r *htt
 	}
 	rsp, err := c.rpcClient.GetLeavesByIndex(ctx, &req)
 	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("backend GetLeavesByIndex request failed: %v", err)
+		return ct.GetEntriesResponse{}, fmt.Errorf("backend GetLeavesByIndex request failed: %v", err)
 	}
 	if !rpcStatusOK(rsp.GetStatus()) {
-		return http.StatusInternalServerError, fmt.Errorf("backend GetLeavesByIndex request failed, status=%v", rsp.GetStatus())
+		return ct.GetEntriesResponse{}, fmt.Errorf("backend GetLeavesByIndex request failed, status=%v", rsp.GetStatus())
 	}
 
 	// Trillian doesn't guarantee the returned leaves are in order (they don't need to be
@@ -474,37 +883,145 @@ func getEntries(ctx context.Context, c LogContext, w http.ResponseWriter, r *htt
 	// needs to return leaves in order.  Therefore, sort the results (and check for missing
 	// or duplicate indices along the way).
 	if err := sortLeafRange(rsp, start, end); err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("backend get-entries range invalid: %v", err)
+		return ct.GetEntriesResponse{}, fmt.Errorf("backend get-entries range invalid: %v", err)
 	}
 
 	// Now we've checked the RPC response and it seems to be valid we need
 	// to serialize the leaves in JSON format for the HTTP response. Doing a
 	// round trip via the leaf deserializer gives us another chance to
 	// prevent bad / corrupt data from reaching the client.
-	jsonRsp, err := marshalGetEntriesResponse(c, rsp)
+	entries, err := marshalGetEntriesResponse(c, rsp)
 	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("failed to process leaves returned from backend: %v", err)
+		return ct.GetEntriesResponse{}, fmt.Errorf("failed to process leaves returned from backend: %v", err)
 	}
+	return entries, nil
+}
 
-	w.Header().Set(contentTypeHeader, contentTypeJSON)
-	jsonData, err := json.Marshal(&jsonRsp)
-	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("failed to marshal get-entries resp: %v because: %v", jsonRsp, err)
+// entriesBatch is the result of fetching one batch of a streamed get-entries request.
+type entriesBatch struct {
+	start, end int64
+	entries    ct.GetEntriesResponse
+	err        error
+}
+
+// fetchEntriesBatches fetches up to parallelism consecutive batches of entries from the
+// backend at once, starting at start and ending no later than end, and returns them in
+// order.
+func fetchEntriesBatches(ctx context.Context, c LogContext, start, end int64, parallelism int) []entriesBatch {
+	var batches []entriesBatch
+	for next := start; next <= end && len(batches) < parallelism; next += maxGetEntriesAllowed {
+		batchEnd := next + maxGetEntriesAllowed - 1
+		if batchEnd > end {
+			batchEnd = end
+		}
+		batches = append(batches, entriesBatch{start: next, end: batchEnd})
+	}
+	if len(batches) == 1 {
+		batches[0].entries, batches[0].err = fetchEntries(ctx, c, start, batches[0].end)
+		return batches
 	}
 
-	_, err = w.Write(jsonData)
-	if err != nil {
-		// Probably too late for this as headers might have been written but we don't know for sure
-		return http.StatusInternalServerError, fmt.Errorf("failed to write get-entries resp: %v because: %v", jsonRsp, err)
+	var wg sync.WaitGroup
+	for i := range batches {
+		wg.Add(1)
+		go func(b *entriesBatch) {
+			defer wg.Done()
+			b.entries, b.err = fetchEntries(ctx, c, b.start, b.end)
+		}(&batches[i])
+	}
+	wg.Wait()
+	return batches
+}
+
+// streamEntries serves a get-entries request for more entries than are fetched from the
+// backend at once. The entries are fetched in batches, up to c.entriesParallelism of
+// them at once, and the batches are written and flushed to the client in order as they
+// arrive, so the response is never held in memory and the client gets the first entries
+// sooner. If a batch after the first fails the response is cut short like one for a
+// range past the end of the tree, with a continuation token if possible, as it's too
+// late to change its status.
+func streamEntries(ctx context.Context, c LogContext, w http.ResponseWriter, start, end int64) (int, error) {
+	parallelism := c.entriesParallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	next := start
+	started := false
+	var batches []entriesBatch
+	for next <= end {
+		if len(batches) == 0 {
+			batches = fetchEntriesBatches(ctx, c, next, end, parallelism)
+		}
+		batch := batches[0]
+		batches = batches[1:]
+		if batch.err != nil && !started {
+			return http.StatusInternalServerError, batch.err
+		} else if batch.err != nil {
+			glog.Warningf("%s: get-entries [%d, %d] cut short at %d: %v", c.logPrefix, start, end, next, batch.err)
+			break
+		}
+
+		var buf bytes.Buffer
+		if !started {
+			w.Header().Set(contentTypeHeader, contentTypeJSON)
+			buf.WriteString(`{"entries":[`)
+		}
+		for i, entry := range batch.entries.Entries {
+			if started || i > 0 {
+				buf.WriteByte(',')
+			}
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return http.StatusInternalServerError, fmt.Errorf("failed to marshal get-entries entry %d: %v", next+int64(i), err)
+			}
+			buf.Write(data)
+		}
+		started = true
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("failed to write get-entries resp: %v", err)
+		}
+		flushResponse(w)
+
+		next += int64(len(batch.entries.Entries))
+		if next <= batch.end {
+			// The backend returned fewer entries than asked for, the tree ends here.
+			break
+		}
 	}
 
+	var buf bytes.Buffer
+	buf.WriteString("]")
+	if next <= end {
+		if token := nextEntriesToken(ctx, c, next); len(token) > 0 {
+			data, _ := json.Marshal(token)
+			buf.WriteString(`,"next_token":`)
+			buf.Write(data)
+		}
+	}
+	buf.WriteString("}")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to write get-entries resp: %v", err)
+	}
 	return http.StatusOK, nil
 }
 
+// flushResponse sends what's been written of the response to the client, if w supports it.
+func flushResponse(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func getRoots(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	roots := c.trustedRoots.Pool()
+	etag := fmt.Sprintf("\"%x\"", roots.Fingerprint())
+	if checkNotModified(w, r, etag) {
+		return http.StatusNotModified, nil
+	}
+
 	// Pull out the raw certificates from the parsed versions
-	rawCerts := make([][]byte, 0, len(c.trustedRoots.RawCertificates()))
-	for _, cert := range c.trustedRoots.RawCertificates() {
+	rawCerts := make([][]byte, 0, len(roots.RawCertificates()))
+	for _, cert := range roots.RawCertificates() {
 		rawCerts = append(rawCerts, cert.Raw)
 	}
 
@@ -566,6 +1083,16 @@ func getEntryAndProof(ctx context.Context, c LogContext, w http.ResponseWriter,
 	return http.StatusOK, nil
 }
 
+// Close stops the log's background work, once the server has stopped passing it
+// requests. Submissions already queued for the mirror are forwarded first, until ctx
+// is done.
+func (c *LogContext) Close(ctx context.Context) error {
+	if c.mirror != nil {
+		return c.mirror.Close(ctx)
+	}
+	return nil
+}
+
 // RegisterHandlers registers a HandleFunc for all of the RFC6962 defined methods.
 // TODO(Martin2112): This registers on default ServeMux, might need more flexibility?
 func (c LogContext) RegisterHandlers(prefix string) {
@@ -575,14 +1102,42 @@ func (c LogContext) RegisterHandlers(prefix string) {
 	prefix = strings.TrimRight(prefix, "/")
 
 	// Bind the LogContext instance to give an appHandler instance for each entrypoint.
-	http.Handle(prefix+ct.AddChainPath, appHandler{context: c, handler: addChain, name: "AddChain", method: http.MethodPost})
-	http.Handle(prefix+ct.AddPreChainPath, appHandler{context: c, handler: addPreChain, name: "AddPreChain", method: http.MethodPost})
-	http.Handle(prefix+ct.GetSTHPath, appHandler{context: c, handler: getSTH, name: "GetSTH", method: http.MethodGet})
-	http.Handle(prefix+ct.GetSTHConsistencyPath, appHandler{context: c, handler: getSTHConsistency, name: "GetSTHConsistency", method: http.MethodGet})
-	http.Handle(prefix+ct.GetProofByHashPath, appHandler{context: c, handler: getProofByHash, name: "GetProofByHash", method: http.MethodGet})
-	http.Handle(prefix+ct.GetEntriesPath, appHandler{context: c, handler: getEntries, name: "GetEntries", method: http.MethodGet})
-	http.Handle(prefix+ct.GetRootsPath, appHandler{context: c, handler: getRoots, name: "GetRoots", method: http.MethodGet})
-	http.Handle(prefix+ct.GetEntryAndProofPath, appHandler{context: c, handler: getEntryAndProof, name: "GetEntryAndProof", method: http.MethodGet})
+	// RFC 6962 only has SHA-256 trees, so logs with other trees only serve the v2 API.
+	if c.servesV1() {
+		http.Handle(prefix+ct.AddChainPath, appHandler{context: c, handler: addChain, name: "AddChain", method: http.MethodPost})
+		http.Handle(prefix+ct.AddPreChainPath, appHandler{context: c, handler: addPreChain, name: "AddPreChain", method: http.MethodPost})
+		http.Handle(prefix+ct.GetSTHPath, appHandler{context: c, handler: getSTH, name: "GetSTH", method: http.MethodGet})
+		http.Handle(prefix+ct.GetSTHConsistencyPath, appHandler{context: c, handler: getSTHConsistency, name: "GetSTHConsistency", method: http.MethodGet})
+		http.Handle(prefix+ct.GetProofByHashPath, appHandler{context: c, handler: getProofByHash, name: "GetProofByHash", method: http.MethodGet})
+		http.Handle(prefix+ct.GetEntriesPath, appHandler{context: c, handler: getEntries, name: "GetEntries", method: http.MethodGet})
+		http.Handle(prefix+ct.GetRootsPath, appHandler{context: c, handler: getRoots, name: "GetRoots", method: http.MethodGet})
+		http.Handle(prefix+ct.GetEntryAndProofPath, appHandler{context: c, handler: getEntryAndProof, name: "GetEntryAndProof", method: http.MethodGet})
+		http.Handle(prefix+GetProofsByHashPath, appHandler{context: c, handler: getProofsByHash, name: "GetProofsByHash", method: http.MethodPost})
+		http.Handle(prefix+GetFinalSTHPath, appHandler{context: c, handler: getFinalSTH, name: "GetFinalSTH", method: http.MethodGet})
+		// A replica only has its source's latest tree head, not its history, and doesn't
+		// issue SCTs, so has none of the metadata get-log-info describes.
+		if c.replica == nil {
+			http.Handle(prefix+GetSTHByTimestampPath, appHandler{context: c, handler: getSTHByTimestamp, name: "GetSTHByTimestamp", method: http.MethodGet})
+			http.Handle(prefix+GetSTHByTreeSizePath, appHandler{context: c, handler: getSTHByTreeSize, name: "GetSTHByTreeSize", method: http.MethodGet})
+			http.Handle(prefix+GetLogInfoPath, appHandler{context: c, handler: getLogInfo, name: "GetLogInfo", method: http.MethodGet})
+		}
+	}
+
+	if c.checkpointSigner != nil {
+		http.Handle(prefix+CheckpointPath, appHandler{context: c, handler: getCheckpoint, name: "GetCheckpoint", method: http.MethodGet})
+	}
+	if c.cosigner != nil {
+		http.Handle(prefix+CosignedCheckpointPath, appHandler{context: c, handler: getCosignedCheckpoint, name: "GetCosignedCheckpoint", method: http.MethodGet})
+	}
+	if len(c.v2LogID) > 0 {
+		c.registerV2Handlers(prefix)
+	}
+	if c.tiles != nil {
+		c.registerTileHandlers(prefix)
+	}
+	if c.gossip != nil {
+		c.registerGossipHandlers(prefix)
+	}
 }
 
 // Generates a custom error page to give more information on why something didn't work
@@ -591,9 +1146,48 @@ func sendHTTPError(w http.ResponseWriter, statusCode int, err error) {
 	http.Error(w, fmt.Sprintf("%s\n%v", http.StatusText(statusCode), err), statusCode)
 }
 
-// getRPCDeadlineTime calculates the future time an RPC should expire based on our config
-func getRPCDeadlineTime(c LogContext) time.Time {
-	return c.timeSource.Now().Add(c.rpcDeadline)
+// sthETag is the ETag of an STH. Tree heads with the same root can still differ in their
+// timestamp, so it covers all the fields the STH signature is over.
+func sthETag(treeSize, timestampMillis uint64, rootHash []byte) string {
+	return fmt.Sprintf("\"%d-%d-%x\"", treeSize, timestampMillis, rootHash)
+}
+
+// checkNotModified sets the ETag header on the response and checks it against any
+// If-None-Match header in the request. If they match it writes a 304 Not Modified
+// response and returns true, in which case the handler must not write a body.
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set(etagHeader, etag)
+	if !etagMatches(r.Header.Get(ifNoneMatchHeader), etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches returns true if the If-None-Match header value matches etag. Weak
+// comparison is used, as per RFC 7232 section 3.2.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// rpcDeadlineFor returns how long RPCs made by the named entrypoint may take.
+func (c LogContext) rpcDeadlineFor(entrypoint string) time.Duration {
+	if d, ok := c.endpointDeadlines[entrypoint]; ok {
+		return d
+	}
+	return c.rpcDeadline
+}
+
+// getRPCDeadlineTime calculates the future time an RPC made by the named entrypoint should
+// expire based on our config
+func getRPCDeadlineTime(c LogContext, entrypoint string) time.Time {
+	return c.timeSource.Now().Add(c.rpcDeadlineFor(entrypoint))
 }
 
 func rpcStatusOK(status *trillian.TrillianApiStatus) bool {
@@ -604,9 +1198,19 @@ func rpcStatusOK(status *trillian.TrillianApiStatus) bool {
 // cert is of the correct type and chains to a trusted root.
 // TODO(Martin2112): This may not implement all the RFC requirements. Check what is provided
 // by fixchain (called by this code) plus the ones here to make sure that it is compliant.
-func verifyAddChain(c LogContext, req ct.AddChainRequest, w http.ResponseWriter, expectingPrecert bool) ([]*x509.Certificate, error) {
+func verifyAddChain(ctx context.Context, c LogContext, req ct.AddChainRequest, w http.ResponseWriter, expectingPrecert bool) ([]*x509.Certificate, error) {
 	// We already checked that the chain is not empty so can move on to verification
-	validPath, err := ValidateChain(req.Chain, *c.trustedRoots)
+	roots := c.trustedRoots.Pool()
+	validPath, err := ValidateChain(req.Chain, *roots)
+	if err != nil && c.aia != nil {
+		// The submitter may have left out intermediates, try fetching them.
+		var aiaErr error
+		if validPath, aiaErr = c.aia.completeChain(ctx, req.Chain, *roots, c.maxChainLength); aiaErr == nil {
+			err = nil
+		} else {
+			err = fmt.Errorf("%v (and completing chain failed: %v)", err, aiaErr)
+		}
+	}
 	if err != nil {
 		// We rejected it because the cert failed checks or we could not find a path to a root etc.
 		// Lots of possible causes for errors
@@ -621,16 +1225,58 @@ func verifyAddChain(c LogContext, req ct.AddChainRequest, w http.ResponseWriter,
 	// The type of the leaf must match the one the handler expects
 	if isPrecert != expectingPrecert {
 		if expectingPrecert {
-			glog.Warningf("%s: Cert (or precert with invalid CT ext) submitted as precert chain: %v", c.logPrefix, req)
-		} else {
-			glog.Warningf("%s: Precert (or cert with invalid CT ext) submitted as cert chain: %v", c.logPrefix, req)
+			return nil, errors.New("cert / precert mismatch: cert (or precert with invalid CT ext) submitted as precert chain")
+		}
+		return nil, errors.New("cert / precert mismatch: precert (or cert with invalid CT ext) submitted as cert chain")
+	}
+
+	// A Precertificate Signing Certificate must be certified by the final issuer, and can't
+	// issue certificates.
+	if _, err := finalIssuer(validPath, roots); err != nil {
+		return nil, err
+	}
+
+	if c.blocklist != nil {
+		if err := c.blocklist.check(validPath); err != nil {
+			c.policyRejected(err)
+			return nil, err
+		}
+	}
+
+	// Temporally sharded logs only accept certificates that expire in their window
+	if err := c.notAfter.check(validPath[0].NotAfter); err != nil {
+		return nil, err
+	}
+	if err := c.expiry.check(validPath[0].NotAfter, c.timeSource.Now()); err != nil {
+		return nil, err
+	}
+	if err := c.validity.check(validPath[0].NotBefore, validPath[0].NotAfter, c.timeSource.Now()); err != nil {
+		c.policyRejected(err)
+		return nil, err
+	}
+	entryType := ct.X509LogEntryType
+	if isPrecert {
+		entryType = ct.PrecertLogEntryType
+	}
+	for _, p := range c.policies {
+		if err := p.Check(validPath, entryType); err != nil {
+			c.policyRejected(err)
+			return nil, err
 		}
-		return nil, fmt.Errorf("cert / precert mismatch: %v", expectingPrecert)
 	}
 
 	return validPath, nil
 }
 
+// policyRejected counts a submission rejected by a certificate policy.
+func (c LogContext) policyRejected(err error) {
+	code := rejectOtherPolicy
+	if perr, ok := err.(PolicyError); ok {
+		code = perr.Code
+	}
+	c.exp.policyRejections.Add(code, 1)
+}
+
 // buildLogLeafForAddChain is also used by add-pre-chain and does the hashing to build a
 // LogLeaf that will be sent to the backend
 func buildLogLeafForAddChain(c LogContext, merkleLeaf ct.MerkleTreeLeaf, chain []*x509.Certificate) (trillian.LogLeaf, error) {
@@ -655,14 +1301,51 @@ func buildLogLeafForAddChain(c LogContext, merkleLeaf ct.MerkleTreeLeaf, chain [
 	// leafHash is a crosscheck on the data we're sending in the leaf buffer. The backend
 	// does the tree hashing.
 	leafHash := sha256.Sum256(leafData)
+	// The identity hash covers the submitted certificate but not the leaf's timestamp, so
+	// the backend recognizes resubmissions of it.
+	identityHash := sha256.Sum256(chain[0].Raw)
 
 	return trillian.LogLeaf{
-		LeafValueHash: leafHash[:],
-		LeafValue:     leafData,
-		ExtraData:     extraData,
+		LeafValueHash:    leafHash[:],
+		LeafValue:        leafData,
+		ExtraData:        extraData,
+		LeafIdentityHash: identityHash[:],
 	}, nil
 }
 
+// LeafIdentityHash computes the identity hash buildLogLeafForAddChain gives a leaf, the
+// hash of the submitted certificate or precertificate, from the leaf's value and extra
+// data. It has the signature of mysql.IdentityHashFunc, for migrating leaves queued before
+// they had identity hashes.
+func LeafIdentityHash(leafValue, extraData []byte) ([]byte, error) {
+	var merkleLeaf ct.MerkleTreeLeaf
+	if rest, err := tls.Unmarshal(leafValue, &merkleLeaf); err != nil {
+		return nil, fmt.Errorf("failed to deserialize Merkle leaf: %v", err)
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("trailing data after Merkle leaf")
+	}
+	if merkleLeaf.TimestampedEntry == nil {
+		return nil, fmt.Errorf("leaf has no timestamped entry")
+	}
+
+	var cert []byte
+	switch merkleLeaf.TimestampedEntry.EntryType {
+	case ct.X509LogEntryType:
+		cert = merkleLeaf.TimestampedEntry.X509Entry.Data
+	case ct.PrecertLogEntryType:
+		// The leaf only holds the TBSCertificate, the precertificate is in the extra data.
+		var precertChain ct.PrecertChainEntry
+		if rest, err := tls.Unmarshal(extraData, &precertChain); err != nil || len(rest) > 0 {
+			return nil, fmt.Errorf("failed to deserialize precertificate chain: %v", err)
+		}
+		cert = precertChain.PreCertificate.Data
+	default:
+		return nil, fmt.Errorf("unknown entry type: %v", merkleLeaf.TimestampedEntry.EntryType)
+	}
+	identityHash := sha256.Sum256(cert)
+	return identityHash[:], nil
+}
+
 // extraDataForChain creates the extra data associated with a log entry as described in
 // RFC6962 section 4.6.
 func extraDataForChain(chain []*x509.Certificate, isPrecert bool) ([]byte, error) {
@@ -706,6 +1389,9 @@ func marshalAndWriteAddChainResponse(sct ct.SignedCertificateTimestamp, km crypt
 	if err != nil {
 		return fmt.Errorf("failed to marshal logID: %v", err)
 	}
+	if err := setLogKeyID(w, km); err != nil {
+		return err
+	}
 	sig, err := tls.Marshal(sct.Signature)
 	if err != nil {
 		return fmt.Errorf("failed to marshal signature: %v", err)
@@ -734,9 +1420,21 @@ func marshalAndWriteAddChainResponse(sct ct.SignedCertificateTimestamp, km crypt
 }
 
 func parseGetEntriesRange(r *http.Request, maxRange int64) (int64, int64, error) {
-	start, err := strconv.ParseInt(r.FormValue(getEntriesParamStart), 10, 64)
-	if err != nil {
-		return 0, 0, err
+	var start int64
+	if token := r.FormValue(getEntriesParamToken); len(token) > 0 {
+		if len(r.FormValue(getEntriesParamStart)) > 0 {
+			return 0, 0, errors.New("start and token parameters are mutually exclusive")
+		}
+		t, err := decodeEntriesToken(token)
+		if err != nil {
+			return 0, 0, err
+		}
+		start = t.nextStart
+	} else {
+		var err error
+		if start, err = strconv.ParseInt(r.FormValue(getEntriesParamStart), 10, 64); err != nil {
+			return 0, 0, err
+		}
 	}
 
 	end, err := strconv.ParseInt(r.FormValue(getEntriesParamEnd), 10, 64)
@@ -783,6 +1481,29 @@ func parseGetEntryAndProofParams(r *http.Request) (int64, int64, error) {
 	return leafIndex, treeSize, nil
 }
 
+func parseGetProofByHashParams(r *http.Request) ([]byte, int64, error) {
+	// Accept any non empty hash that decodes from base64 and let the backend validate it further
+	escapedHash := r.FormValue(getProofParamHash)
+	if len(escapedHash) == 0 {
+		return nil, 0, errors.New("get-proof-by-hash: missing / empty hash param for get-proof-by-hash")
+	}
+	hash, err := url.QueryUnescape(escapedHash)
+	if err != nil {
+		return nil, 0, fmt.Errorf("get-proof-by-hash: invalid url-encoded hash: %v", err)
+	}
+	leafHash, err := base64.StdEncoding.DecodeString(hash)
+	if err != nil {
+		return nil, 0, fmt.Errorf("get-proof-by-hash: invalid base64 hash: %v", err)
+	}
+
+	treeSize, err := strconv.ParseInt(r.FormValue(getProofParamTreeSize), 10, 64)
+	if err != nil || treeSize < 1 {
+		return nil, 0, fmt.Errorf("get-proof-by-hash: missing or invalid tree_size: %v", r.FormValue(getProofParamTreeSize))
+	}
+
+	return leafHash, treeSize, nil
+}
+
 func parseGetSTHConsistencyRange(r *http.Request) (int64, int64, error) {
 	first, err := strconv.ParseInt(r.FormValue(getSTHConsistencyParamFirst), 10, 64)
 	if err != nil {
@@ -844,6 +1565,26 @@ func sortLeafRange(rsp *trillian.GetLeavesByIndexResponse, start, end int64) err
 	return nil
 }
 
+// getEntriesResponse extends the RFC 6962 get-entries response with a continuation token.
+type getEntriesResponse struct {
+	ct.GetEntriesResponse
+	// NextToken is set if fewer entries than requested were returned, it can be passed
+	// in the token parameter of the next request to resume from the first entry missing.
+	NextToken string `json:"next_token,omitempty"`
+}
+
+// nextEntriesToken builds the continuation token for a get-entries response that stopped
+// short of the requested range at nextStart. The token is omitted if the tree size can't
+// be fetched, clients can still carry on from the number of entries they received.
+func nextEntriesToken(ctx context.Context, c LogContext, nextStart int64) string {
+	rsp, err := c.rpcClient.GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: c.logID})
+	if err != nil || !rpcStatusOK(rsp.GetStatus()) || rsp.GetSignedLogRoot() == nil {
+		glog.Warningf("%s: failed to get tree size for get-entries token: %v %v", c.logPrefix, err, rsp.GetStatus())
+		return ""
+	}
+	return entriesToken{nextStart: nextStart, treeSize: rsp.GetSignedLogRoot().TreeSize}.encode()
+}
+
 // marshalGetEntriesResponse does the conversion from the backend response to the one we need for
 // an RFC compliant JSON response to the client.
 func marshalGetEntriesResponse(c LogContext, rsp *trillian.GetLeavesByIndexResponse) (ct.GetEntriesResponse, error) {
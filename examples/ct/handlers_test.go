@@ -3,6 +3,7 @@ package ct
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -12,7 +13,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -27,6 +30,7 @@ import (
 	"github.com/google/trillian/mockclient"
 	"github.com/google/trillian/util"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
 )
 
 // Arbitrary time for use in tests
@@ -107,6 +111,14 @@ func (info handlerTestInfo) expectSign(toSign string) {
 	info.km.EXPECT().Signer().AnyTimes().Return(mockSigner, nil)
 }
 
+// expectSignAny makes the key manager sign any data, for tests where the signature
+// input isn't fixed.
+func (info handlerTestInfo) expectSignAny() {
+	mockSigner := crypto.NewMockSigner(info.mockCtrl)
+	mockSigner.EXPECT().Sign(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().Return([]byte("signed"), nil)
+	info.km.EXPECT().Signer().AnyTimes().Return(mockSigner, nil)
+}
+
 func (info handlerTestInfo) getHandlers() map[string]appHandler {
 	return map[string]appHandler{
 		"get-sth":             appHandler{context: info.c, handler: getSTH, name: "GetSTH", method: http.MethodGet},
@@ -230,6 +242,71 @@ func TestGetRoots(t *testing.T) {
 	if got, want := certs[1], strings.Replace(intermediateCertB64, "\n", "", -1); got != want {
 		t.Errorf("certs[1]=%s; want %s", got, want)
 	}
+	if got, want := w.Header().Get(etagHeader), fmt.Sprintf("\"%x\"", info.roots.Fingerprint()); got != want {
+		t.Errorf("get-roots ETag=%s; want %s", got, want)
+	}
+}
+
+func TestGetRootsNotModified(t *testing.T) {
+	info := setupTest(t, []string{caAndIntermediateCertsPEM})
+	defer info.mockCtrl.Finish()
+	handler := appHandler{context: info.c, handler: getRoots, name: "GetRoots", method: http.MethodGet}
+	etag := fmt.Sprintf("\"%x\"", info.roots.Fingerprint())
+
+	var tests = []struct {
+		ifNoneMatch string
+		want        int
+	}{
+		{"", http.StatusOK},
+		{etag, http.StatusNotModified},
+		{"W/" + etag, http.StatusNotModified},
+		{"\"other\", " + etag, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{"\"other\"", http.StatusOK},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "http://example.com/ct/v1/get-roots", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if test.ifNoneMatch != "" {
+			req.Header.Set(ifNoneMatchHeader, test.ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got := w.Code; got != test.want {
+			t.Errorf("GetRoots(If-None-Match: %s).Code=%d; want %d", test.ifNoneMatch, got, test.want)
+		}
+		if got := w.Header().Get(etagHeader); got != etag {
+			t.Errorf("GetRoots(If-None-Match: %s) ETag=%s; want %s", test.ifNoneMatch, got, etag)
+		}
+		if test.want == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("GetRoots(If-None-Match: %s)=%q; want empty body", test.ifNoneMatch, w.Body.Bytes())
+		}
+	}
+}
+
+func TestAddChainTooLong(t *testing.T) {
+	info := setupTest(t, []string{testonly.FakeCACertPEM})
+	defer info.mockCtrl.Finish()
+	info.c.maxChainLength = 3
+
+	// Rejected on length alone, the certificates aren't even looked at
+	var req ct.AddChainRequest
+	for i := 0; i < 4; i++ {
+		req.Chain = append(req.Chain, []byte(fmt.Sprintf("cert%d", i)))
+	}
+	body, err := json.Marshal(&req)
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	recorder := makeAddChainRequest(t, info.c, bytes.NewReader(body))
+	if got, want := recorder.Code, http.StatusBadRequest; got != want {
+		t.Errorf("addChain()=%d (body:%v); want %d", got, recorder.Body, want)
+	}
+	if got, want := recorder.Body.String(), "more than the maximum of 3"; !strings.Contains(got, want) {
+		t.Errorf("addChain() body=%q, want it to contain %q", got, want)
+	}
 }
 
 func TestAddChain(t *testing.T) {
@@ -309,6 +386,86 @@ func TestAddChain(t *testing.T) {
 	}
 }
 
+func TestAddChainMergeDeadline(t *testing.T) {
+	info := setupTest(t, []string{testonly.FakeCACertPEM})
+	defer info.mockCtrl.Finish()
+	info.c.mergeDelay = 24 * time.Hour
+
+	pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+	info.expectSign("1337d72a403b6539f58896decba416d5d4b3603bfa03e1f94bb9b4e898af897d")
+	merkleLeaf, _, err := signV1SCTForCertificate(info.km, pool.RawCertificates()[0], nil, fakeTime)
+	if err != nil {
+		t.Fatalf("Unexpected error signing SCT: %v", err)
+	}
+	leaves := logLeavesForCert(t, info.km, pool.RawCertificates(), merkleLeaf, false)
+	leaves[0].MergeDeadlineNanos = fakeTime.Add(24 * time.Hour).UnixNano()
+	info.client.EXPECT().QueueLeaves(deadlineMatcher(), &trillian.QueueLeavesRequest{LogId: 0x42, Leaves: leaves}).Return(&trillian.QueueLeavesResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK}}, nil)
+
+	recorder := makeAddChainRequest(t, info.c, createJSONChain(t, *pool))
+	if got, want := recorder.Code, http.StatusOK; got != want {
+		t.Errorf("addChain()=%d (body:%v), want %d", got, recorder.Body, want)
+	}
+}
+
+func TestAddChainDuplicate(t *testing.T) {
+	pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+	certs := pool.RawCertificates()
+	firstSubmitted := fakeTime.Add(-time.Hour)
+	other := loadCertsIntoPoolOrDie(t, []string{testonly.FakeIntermediateCertPEM}).RawCertificates()
+
+	var tests = []struct {
+		descr    string
+		cert     *x509.Certificate
+		want     int
+		wantTime time.Time
+	}{
+		{descr: "same certificate", cert: certs[0], want: http.StatusOK, wantTime: firstSubmitted},
+		{descr: "different leaf", cert: other[0], want: http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		info := setupTest(t, []string{testonly.FakeCACertPEM})
+		info.expectSignAny()
+
+		merkleLeaf, _, err := signV1SCTForCertificate(info.km, certs[0], nil, fakeTime)
+		if err != nil {
+			t.Fatalf("Unexpected error signing SCT: %v", err)
+		}
+		leaves := logLeavesForCert(t, info.km, certs, merkleLeaf, false)
+		existingLeaf, _, err := signV1SCTForCertificate(info.km, test.cert, nil, firstSubmitted)
+		if err != nil {
+			t.Fatalf("Unexpected error signing SCT: %v", err)
+		}
+		existing := logLeavesForCert(t, info.km, certs, existingLeaf, false)[0]
+		rsp := &trillian.QueueLeavesResponse{Status: okStatus, QueuedLeaves: []*trillian.QueuedLogLeaf{{Leaf: existing, Duplicate: true}}}
+		info.client.EXPECT().QueueLeaves(deadlineMatcher(), &trillian.QueueLeavesRequest{LogId: 0x42, Leaves: leaves}).Return(rsp, nil)
+
+		recorder := makeAddChainRequest(t, info.c, createJSONChain(t, *pool))
+		info.mockCtrl.Finish()
+		if got := recorder.Code; got != test.want {
+			t.Errorf("addChain(%s)=%d (body:%v), want %d", test.descr, got, recorder.Body, test.want)
+			continue
+		}
+		if test.want != http.StatusOK {
+			continue
+		}
+
+		var resp ct.AddChainResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&resp); err != nil {
+			t.Fatalf("json.Decode(%s)=%v; want nil", recorder.Body.Bytes(), err)
+		}
+		if got, want := resp.Timestamp, uint64(test.wantTime.UnixNano()/millisPerNano); got != want {
+			t.Errorf("addChain(%s): resp.Timestamp=%d; want %d", test.descr, got, want)
+		}
+		if got, want := info.c.exp.duplicateSubmissions.Value(), int64(1); got != want {
+			t.Errorf("addChain(%s): duplicate-submissions=%d; want %d", test.descr, got, want)
+		}
+		if got, want := info.c.exp.submissions.Get("AddChain").String(), "1"; got != want {
+			t.Errorf("addChain(%s): submissions[AddChain]=%s; want %s", test.descr, got, want)
+		}
+	}
+}
+
 func TestAddPrechain(t *testing.T) {
 	var tests = []struct {
 		descr     string
@@ -386,6 +543,43 @@ func TestAddPrechain(t *testing.T) {
 	}
 }
 
+func TestLeafIdentityHash(t *testing.T) {
+	var tests = []struct {
+		descr     string
+		chain     []string
+		entryType ct.LogEntryType
+	}{
+		{descr: "cert", chain: []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM}, entryType: ct.X509LogEntryType},
+		{descr: "precert", chain: []string{testonly.PrecertPEMValid, testonly.CACertPEM}, entryType: ct.PrecertLogEntryType},
+	}
+
+	for _, test := range tests {
+		pool := loadCertsIntoPoolOrDie(t, test.chain)
+		var rawChain []ct.ASN1Cert
+		for _, cert := range pool.RawCertificates() {
+			rawChain = append(rawChain, ct.ASN1Cert{Data: cert.Raw})
+		}
+		merkleLeaf, err := ct.MerkleTreeLeafFromRawChain(rawChain, test.entryType, 1469185273000)
+		if err != nil {
+			t.Fatalf("%s: MerkleTreeLeafFromRawChain()=_,%v", test.descr, err)
+		}
+		leaf := logLeavesForCert(t, nil, pool.RawCertificates(), *merkleLeaf, test.entryType == ct.PrecertLogEntryType)[0]
+
+		got, err := LeafIdentityHash(leaf.LeafValue, leaf.ExtraData)
+		if err != nil {
+			t.Errorf("%s: LeafIdentityHash()=_,%v; want no error", test.descr, err)
+			continue
+		}
+		if !bytes.Equal(got, leaf.LeafIdentityHash) {
+			t.Errorf("%s: LeafIdentityHash()=%x; want %x", test.descr, got, leaf.LeafIdentityHash)
+		}
+	}
+
+	if _, err := LeafIdentityHash([]byte("not a leaf"), nil); err == nil {
+		t.Error("LeafIdentityHash(garbage)=_,nil; want error")
+	}
+}
+
 func TestGetSTH(t *testing.T) {
 	var tests = []struct {
 		descr      string
@@ -479,6 +673,75 @@ func TestGetSTH(t *testing.T) {
 		if got, want := hex.EncodeToString(rsp.TreeHeadSignature), "040300067369676e6564"; got != want {
 			t.Errorf("GetSTH(%s).TreeHeadSignature=%s; want %s", test.descr, got, want)
 		}
+		if got, want := w.Header().Get(etagHeader), "\"25-12345-6162636461626364616263646162636461626364616263646162636461626364\""; got != want {
+			t.Errorf("GetSTH(%s) ETag=%s; want %s", test.descr, got, want)
+		}
+		// The mock key manager's raw public key is "key".
+		if got, want := w.Header().Get(LogKeyIDHeader), "LHDhK3oGRvkiefQnx7OOczTY5Tic/xZ6HcMOc/gmtoM="; got != want {
+			t.Errorf("GetSTH(%s) %s=%s; want %s", test.descr, LogKeyIDHeader, got, want)
+		}
+	}
+}
+
+func TestGetSTHNotModified(t *testing.T) {
+	info := setupTest(t, []string{testonly.CACertPEM})
+	defer info.mockCtrl.Finish()
+	handler := appHandler{context: info.c, handler: getSTH, name: "GetSTH", method: http.MethodGet}
+	etag := "\"25-12345-6162636461626364616263646162636461626364616263646162636461626364\""
+
+	// No signing is expected as the client already has an STH for this tree head.
+	info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), &trillian.GetLatestSignedLogRootRequest{LogId: 0x42}).Return(
+		makeGetRootResponseForTest(12345000000, 25, []byte("abcdabcdabcdabcdabcdabcdabcdabcd")), nil)
+	req, err := http.NewRequest("GET", "http://example.com/ct/v1/get-sth", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set(ifNoneMatchHeader, etag)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusNotModified; got != want {
+		t.Errorf("GetSTH(If-None-Match).Code=%d; want %d", got, want)
+	}
+	if got := w.Header().Get(etagHeader); got != etag {
+		t.Errorf("GetSTH(If-None-Match) ETag=%s; want %s", got, etag)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("GetSTH(If-None-Match)=%q; want empty body", w.Body.Bytes())
+	}
+
+	// A stale tag gets a fresh STH.
+	info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), &trillian.GetLatestSignedLogRootRequest{LogId: 0x42}).Return(
+		makeGetRootResponseForTest(12345000000, 25, []byte("abcdabcdabcdabcdabcdabcdabcdabcd")), nil)
+	info.expectSign("1e88546f5157bfaf77ca2454690b602631fedae925bbe7cf708ea275975bfe74")
+	req.Header.Set(ifNoneMatchHeader, "\"stale\"")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("GetSTH(stale If-None-Match).Code=%d; want %d", got, want)
+	}
+}
+
+func TestGetSTHNotModifiedOtherTimestamp(t *testing.T) {
+	info := setupTest(t, []string{testonly.CACertPEM})
+	defer info.mockCtrl.Finish()
+	handler := appHandler{context: info.c, handler: getSTH, name: "GetSTH", method: http.MethodGet}
+
+	// The client has an STH with the same root, but the log has signed a newer one.
+	info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), &trillian.GetLatestSignedLogRootRequest{LogId: 0x42}).Return(
+		makeGetRootResponseForTest(12346000000, 25, []byte("abcdabcdabcdabcdabcdabcdabcdabcd")), nil)
+	info.expectSign("a6f4ee2e847d4693ccde01d895cc5d3de97cebd055cd4008173088f435b0e059")
+	req, err := http.NewRequest("GET", "http://example.com/ct/v1/get-sth", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set(ifNoneMatchHeader, "\"25-12345-6162636461626364616263646162636461626364616263646162636461626364\"")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("GetSTH(If-None-Match for older STH).Code=%d; want %d", got, want)
+	}
+	if got, want := w.Header().Get(etagHeader), "\"25-12346-6162636461626364616263646162636461626364616263646162636461626364\""; got != want {
+		t.Errorf("GetSTH() ETag=%s; want %s", got, want)
 	}
 }
 
@@ -708,6 +971,271 @@ func TestGetEntriesRanges(t *testing.T) {
 	}
 }
 
+// fakeEntriesBackend serves the leaves of a tree of size leaves, failing requests for
+// leaves from failAt on, if it's set.
+type fakeEntriesBackend struct {
+	trillian.TrillianLogClient
+	size   int64
+	failAt int64
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *fakeEntriesBackend) GetLeavesByIndex(ctx context.Context, req *trillian.GetLeavesByIndexRequest, opts ...grpc.CallOption) (*trillian.GetLeavesByIndexResponse, error) {
+	f.mu.Lock()
+	f.calls++
+	f.mu.Unlock()
+	rsp := &trillian.GetLeavesByIndexResponse{Status: okStatus}
+	for _, index := range req.LeafIndex {
+		if f.failAt > 0 && index >= f.failAt {
+			return nil, errors.New("backend down")
+		}
+		if index < f.size {
+			rsp.Leaves = append(rsp.Leaves, &trillian.LogLeaf{LeafIndex: index, LeafValue: []byte(fmt.Sprintf("leaf %d", index)), ExtraData: []byte("extra")})
+		}
+	}
+	return rsp, nil
+}
+
+func (f *fakeEntriesBackend) GetLatestSignedLogRoot(ctx context.Context, req *trillian.GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*trillian.GetLatestSignedLogRootResponse, error) {
+	return makeGetRootResponseForTest(12345000000, f.size, []byte("root")), nil
+}
+
+func TestGetEntriesStreamed(t *testing.T) {
+	var tests = []struct {
+		descr       string
+		streamMax   int64
+		parallelism int
+		size        int64
+		failAt      int64
+		start       int64
+		end         int64
+		gzip        bool
+		want        int
+		wantCount   int64
+		wantCalls   int
+		wantNext    int64 // start of the continuation token, if any
+	}{
+		{descr: "not-streamed", streamMax: 500, size: 1000, start: 10, end: 59, want: http.StatusOK, wantCount: 50, wantCalls: 1},
+		{descr: "streamed", streamMax: 500, size: 1000, start: 10, end: 129, want: http.StatusOK, wantCount: 120, wantCalls: 3},
+		{descr: "compressed", streamMax: 500, size: 1000, start: 0, end: 499, gzip: true, want: http.StatusOK, wantCount: 500, wantCalls: 10},
+		{descr: "past-end", streamMax: 500, size: 70, start: 0, end: 199, want: http.StatusOK, wantCount: 70, wantCalls: 2, wantNext: 70},
+		{descr: "ends-on-batch", streamMax: 500, size: 100, start: 0, end: 199, want: http.StatusOK, wantCount: 100, wantCalls: 3, wantNext: 100},
+		{descr: "fails-later", streamMax: 500, size: 1000, failAt: 50, start: 0, end: 199, want: http.StatusOK, wantCount: 50, wantCalls: 2, wantNext: 50},
+		{descr: "fails-first", streamMax: 500, size: 1000, failAt: 10, start: 0, end: 199, want: http.StatusInternalServerError, wantCalls: 1},
+		{descr: "parallel", streamMax: 500, parallelism: 4, size: 1000, start: 0, end: 499, want: http.StatusOK, wantCount: 500, wantCalls: 10},
+		{descr: "parallel-past-end", streamMax: 500, parallelism: 4, size: 70, start: 0, end: 199, want: http.StatusOK, wantCount: 70, wantCalls: 4, wantNext: 70},
+		{descr: "parallel-fails-later", streamMax: 500, parallelism: 3, size: 1000, failAt: 100, start: 0, end: 199, want: http.StatusOK, wantCount: 100, wantCalls: 3, wantNext: 100},
+		{descr: "too-many", streamMax: 500, size: 1000, start: 0, end: 500, want: http.StatusBadRequest},
+		{descr: "not-enabled", size: 1000, start: 0, end: 50, want: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		info := setupTest(t, nil)
+		backend := &fakeEntriesBackend{size: test.size, failAt: test.failAt}
+		info.c.rpcClient = backend
+		info.c.streamEntriesMax = test.streamMax
+		info.c.entriesParallelism = test.parallelism
+		handler := appHandler{context: info.c, handler: getEntries, name: "GetEntries", method: http.MethodGet}
+
+		req, err := http.NewRequest("GET", fmt.Sprintf("/ct/v1/get-entries?start=%d&end=%d", test.start, test.end), nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if test.gzip {
+			req.Header.Set(acceptEncodingHeader, encodingGzip)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		info.mockCtrl.Finish()
+
+		if got := w.Code; got != test.want {
+			t.Errorf("%s: GetEntries(%d, %d)=%d (body:%v), want %d", test.descr, test.start, test.end, got, w.Body, test.want)
+			continue
+		}
+		if got, want := backend.calls, test.wantCalls; got != want {
+			t.Errorf("%s: made %d backend requests, want %d", test.descr, got, want)
+		}
+		if test.want != http.StatusOK {
+			continue
+		}
+		if got, want := w.Flushed, test.end-test.start+1 > maxGetEntriesAllowed; got != want {
+			t.Errorf("%s: response flushed: %v, want %v", test.descr, got, want)
+		}
+
+		var body io.Reader = w.Body
+		if test.gzip {
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("%s: gzip.NewReader()=_,%v, want no error", test.descr, err)
+			}
+			body = zr
+		}
+		var rsp getEntriesResponse
+		if err := json.NewDecoder(body).Decode(&rsp); err != nil {
+			t.Errorf("%s: failed to decode response: %v", test.descr, err)
+			continue
+		}
+		if got, want := int64(len(rsp.Entries)), test.wantCount; got != want {
+			t.Errorf("%s: got %d entries, want %d", test.descr, got, want)
+		}
+		for i, entry := range rsp.Entries {
+			if got, want := string(entry.LeafInput), fmt.Sprintf("leaf %d", test.start+int64(i)); got != want {
+				t.Errorf("%s: entry %d LeafInput=%q, want %q", test.descr, i, got, want)
+				break
+			}
+		}
+		if test.wantNext == 0 {
+			if len(rsp.NextToken) > 0 {
+				t.Errorf("%s: NextToken=%q, want none", test.descr, rsp.NextToken)
+			}
+			continue
+		}
+		token, err := decodeEntriesToken(rsp.NextToken)
+		if err != nil {
+			t.Errorf("%s: decodeEntriesToken(%q)=_,%v, want no error", test.descr, rsp.NextToken, err)
+			continue
+		}
+		if got, want := token.nextStart, test.wantNext; got != want {
+			t.Errorf("%s: NextToken starts at %d, want %d", test.descr, got, want)
+		}
+	}
+}
+
+func TestGetEntriesClientCancelled(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	handler := appHandler{context: info.c, handler: getEntries, name: "GetEntries", method: http.MethodGet}
+
+	// The backend request should see the cancellation straight away rather than running
+	// until its deadline.
+	info.client.EXPECT().GetLeavesByIndex(deadlineMatcher(), &trillian.GetLeavesByIndexRequest{LogId: 0x42, LeafIndex: []int64{1, 2}}).Do(
+		func(ctx context.Context, req *trillian.GetLeavesByIndexRequest, opts ...grpc.CallOption) {
+			if got, want := ctx.Err(), context.Canceled; got != want {
+				t.Errorf("GetLeavesByIndex() ctx.Err()=%v; want %v", got, want)
+			}
+		}).Return(nil, context.Canceled)
+
+	req, err := http.NewRequest("GET", "/ct/v1/get-entries?start=1&end=2", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req.WithContext(ctx))
+
+	if got, want := w.Code, statusClientClosedRequest; got != want {
+		t.Errorf("GetEntries()=%d; want %d", got, want)
+	}
+	if got := info.c.exp.allRsps.Get(strconv.Itoa(http.StatusInternalServerError)); got != nil {
+		t.Errorf("http-all-rsps[500]=%v; want unset", got)
+	}
+}
+
+func TestHandlerPanics(t *testing.T) {
+	var tests = []struct {
+		descr      string
+		handler    func(context.Context, LogContext, http.ResponseWriter, *http.Request) (int, error)
+		want       int
+		wantPanics string
+	}{
+		{
+			descr: "panic",
+			handler: func(context.Context, LogContext, http.ResponseWriter, *http.Request) (int, error) {
+				panic("secret details")
+			},
+			want:       http.StatusInternalServerError,
+			wantPanics: "1",
+		},
+		{
+			descr: "panic-after-write",
+			handler: func(_ context.Context, _ LogContext, w http.ResponseWriter, _ *http.Request) (int, error) {
+				w.Write([]byte("{"))
+				panic("half done")
+			},
+			want:       http.StatusOK,
+			wantPanics: "1",
+		},
+		{
+			descr: "no-panic",
+			handler: func(context.Context, LogContext, http.ResponseWriter, *http.Request) (int, error) {
+				return http.StatusOK, nil
+			},
+			want: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		info := setupTest(t, nil)
+		handler := appHandler{context: info.c, handler: test.handler, name: "GetSTH", method: http.MethodGet}
+		req, err := http.NewRequest("GET", "/ct/v1/get-sth", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if got := w.Code; got != test.want {
+			t.Errorf("%s: ServeHTTP()=%d; want %d", test.descr, got, test.want)
+		}
+		if body := w.Body.String(); strings.Contains(body, "secret") {
+			t.Errorf("%s: ServeHTTP() body=%q; want panic value hidden", test.descr, body)
+		}
+		var gotPanics string
+		if v := info.c.exp.panics.Get("GetSTH"); v != nil {
+			gotPanics = v.String()
+		}
+		if gotPanics != test.wantPanics {
+			t.Errorf("%s: http-panics[GetSTH]=%q; want %q", test.descr, gotPanics, test.wantPanics)
+		}
+		info.mockCtrl.Finish()
+	}
+}
+
+func TestHandlerAbortPanicPropagates(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	handler := appHandler{context: info.c, name: "GetSTH", method: http.MethodGet,
+		handler: func(context.Context, LogContext, http.ResponseWriter, *http.Request) (int, error) {
+			panic(http.ErrAbortHandler)
+		}}
+	req, err := http.NewRequest("GET", "/ct/v1/get-sth", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	defer func() {
+		if got := recover(); got != http.ErrAbortHandler {
+			t.Errorf("ServeHTTP() panicked with %v; want %v", got, http.ErrAbortHandler)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestGetEntriesTimedOut(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	// Time moves past the 500ms deadline while the backend request is in progress. Now()
+	// is called for the access log, to set the deadline, to check it and for the latency.
+	info.c.timeSource = &util.IncrementingFakeTimeSource{BaseTime: fakeTime, Increments: []time.Duration{0, 0, time.Second, time.Second}}
+	handler := appHandler{context: info.c, handler: getEntries, name: "GetEntries", method: http.MethodGet}
+
+	info.client.EXPECT().GetLeavesByIndex(deadlineMatcher(), &trillian.GetLeavesByIndexRequest{LogId: 0x42, LeafIndex: []int64{1, 2}}).Return(nil, context.DeadlineExceeded)
+
+	req, err := http.NewRequest("GET", "/ct/v1/get-entries?start=1&end=2", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got, want := w.Code, http.StatusGatewayTimeout; got != want {
+		t.Errorf("GetEntries()=%d; want %d", got, want)
+	}
+}
+
 func TestSortLeafRange(t *testing.T) {
 	var tests = []struct {
 		start   int64
@@ -1196,7 +1724,9 @@ func logLeavesForCert(t *testing.T, km crypto.KeyManager, certs []*x509.Certific
 		t.Fatalf("failed to serialize extra data: %v", err)
 	}
 
-	return []*trillian.LogLeaf{{LeafValueHash: leafHash[:], LeafValue: leafData, ExtraData: extraData}}
+	identityHash := sha256.Sum256(certs[0].Raw)
+
+	return []*trillian.LogLeaf{{LeafValueHash: leafHash[:], LeafValue: leafData, ExtraData: extraData, LeafIdentityHash: identityHash[:]}}
 }
 
 type dlMatcher struct {
@@ -0,0 +1,117 @@
+package ct
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+)
+
+const (
+	// HealthzPath is the liveness check path, it succeeds as long as the server is
+	// serving HTTP.
+	HealthzPath = "/healthz"
+	// ReadyzPath is the readiness check path, it only succeeds if all the configured
+	// logs can be reached through the backend.
+	ReadyzPath = "/readyz"
+)
+
+// HealthChecker serves liveness and readiness checks for a CT server, so that load
+// balancers and orchestrators only route traffic to instances that can serve it.
+type HealthChecker struct {
+	client trillian.TrillianLogClient
+	// connErr reports a problem with the backend connection, if there is one. Can be nil.
+	connErr func() error
+	// deadline is the deadline set on the RPCs made for each readiness check.
+	deadline time.Duration
+
+	mu   sync.Mutex
+	logs []healthCheckLog
+}
+
+type healthCheckLog struct {
+	prefix string
+	logID  int64
+}
+
+// NewHealthChecker creates a HealthChecker for logs served through client. If connErr is
+// not nil it is called first in each readiness check and should return an error if the
+// backend connection is known to be down.
+func NewHealthChecker(client trillian.TrillianLogClient, connErr func() error, deadline time.Duration) *HealthChecker {
+	return &HealthChecker{client: client, connErr: connErr, deadline: deadline}
+}
+
+// AddLog adds a log to the set that must be reachable for the server to be ready.
+func (h *HealthChecker) AddLog(prefix string, logID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.logs = append(h.logs, healthCheckLog{prefix: prefix, logID: logID})
+}
+
+// RegisterHandlers registers the liveness and readiness handlers.
+func (h *HealthChecker) RegisterHandlers() {
+	http.HandleFunc(HealthzPath, h.healthz)
+	http.HandleFunc(ReadyzPath, h.readyz)
+}
+
+func (h *HealthChecker) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(contentTypeHeader, "text/plain")
+	fmt.Fprintln(w, "ok")
+}
+
+func (h *HealthChecker) readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(contentTypeHeader, "text/plain")
+	if err := h.Ready(r.Context()); err != nil {
+		sendHTTPError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// Ready returns nil if the backend connection is up and the latest signed root can be
+// fetched for every configured log.
+func (h *HealthChecker) Ready(ctx context.Context) error {
+	if h.connErr != nil {
+		if err := h.connErr(); err != nil {
+			return fmt.Errorf("backend connection not ready: %v", err)
+		}
+	}
+
+	h.mu.Lock()
+	logs := append([]healthCheckLog(nil), h.logs...)
+	h.mu.Unlock()
+
+	// Check the logs in parallel so that one slow log doesn't hold up the rest.
+	errs := make(chan error, len(logs))
+	for _, l := range logs {
+		go func(l healthCheckLog) {
+			errs <- h.checkLog(ctx, l)
+		}(l)
+	}
+
+	var firstErr error
+	for range logs {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (h *HealthChecker) checkLog(ctx context.Context, l healthCheckLog) error {
+	ctx, cancel := context.WithTimeout(ctx, h.deadline)
+	defer cancel()
+
+	rsp, err := h.client.GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: l.logID})
+	if err != nil {
+		return fmt.Errorf("%s: backend request failed: %v", l.prefix, err)
+	}
+	if !rpcStatusOK(rsp.GetStatus()) {
+		return fmt.Errorf("%s: backend returned status: %v", l.prefix, rsp.GetStatus())
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package ct
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/mockclient"
+)
+
+func TestHealthz(t *testing.T) {
+	h := NewHealthChecker(nil, func() error { return errors.New("backend down") }, time.Second)
+
+	w := httptest.NewRecorder()
+	h.healthz(w, httptest.NewRequest(http.MethodGet, HealthzPath, nil))
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("healthz().Code=%d; want %d", got, want)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	okRsp := makeGetRootResponseForTest(12345, 25, []byte("abcdabcdabcdabcdabcdabcdabcdabcd"))
+	badRsp := &trillian.GetLatestSignedLogRootResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_ERROR}}
+
+	var tests = []struct {
+		descr   string
+		connErr error
+		rsp1    *trillian.GetLatestSignedLogRootResponse
+		rsp2    *trillian.GetLatestSignedLogRootResponse
+		rpcErr  error
+		noRPC   bool
+		want    int
+	}{
+		{descr: "ok", rsp1: okRsp, rsp2: okRsp, want: http.StatusOK},
+		{descr: "conn-down", connErr: errors.New("conn down"), noRPC: true, want: http.StatusServiceUnavailable},
+		{descr: "rpc-error", rsp1: okRsp, rpcErr: errors.New("backendfailure"), want: http.StatusServiceUnavailable},
+		{descr: "bad-status", rsp1: okRsp, rsp2: badRsp, want: http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+		client := mockclient.NewMockTrillianLogClient(ctrl)
+		if !test.noRPC {
+			client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), &trillian.GetLatestSignedLogRootRequest{LogId: 1}).Return(test.rsp1, nil)
+			client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), &trillian.GetLatestSignedLogRootRequest{LogId: 2}).Return(test.rsp2, test.rpcErr)
+		}
+
+		h := NewHealthChecker(client, func() error { return test.connErr }, time.Second)
+		h.AddLog("log1", 1)
+		h.AddLog("log2", 2)
+
+		w := httptest.NewRecorder()
+		h.readyz(w, httptest.NewRequest(http.MethodGet, ReadyzPath, nil))
+		if got := w.Code; got != test.want {
+			t.Errorf("readyz(%s).Code=%d; want %d", test.descr, got, test.want)
+		}
+		ctrl.Finish()
+	}
+}
@@ -0,0 +1,76 @@
+// The ct_check_inclusion binary checks that a CT log has incorporated the entry it issued
+// an SCT for. It takes the SCT, in the JSON form returned by add-chain, and the PEM
+// encoded certificate or precertificate it was issued for followed by its issuer, and
+// waits for the log to prove the entry is included in a tree head, until the log's
+// maximum merge delay has passed since the SCT was issued. It exits with a nonzero status
+// if the entry isn't incorporated in time or anything fails to verify, so it can be run
+// as a step of a CA's issuance pipeline.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/jsonclient"
+	"github.com/google/trillian/examples/ct/inclusion"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+var logURIFlag = flag.String("log_uri", "http://localhost:6962/logs/example", "Base URI of the CT log that issued the SCT")
+var logPublicKeyFlag = flag.String("log_public_key", "", "File holding the PEM encoded public key of the log")
+var sctFlag = flag.String("sct", "", "File holding the SCT as the JSON add-chain or add-pre-chain response")
+var chainFlag = flag.String("chain", "", "File holding the PEM encoded certificate or precertificate the SCT is for, followed by its issuer")
+var mmdFlag = flag.Duration("mmd", 24*time.Hour, "Maximum merge delay of the log, measured from the SCT's timestamp")
+var pollIntervalFlag = flag.Duration("poll_interval", time.Minute, "How often the log is asked for a proof while the entry isn't included")
+
+func main() {
+	flag.Parse()
+	if len(*logPublicKeyFlag) == 0 || len(*sctFlag) == 0 || len(*chainFlag) == 0 {
+		glog.Exit("--log_public_key, --sct and --chain are required")
+	}
+	pubKey, err := ioutil.ReadFile(*logPublicKeyFlag)
+	if err != nil {
+		glog.Exitf("Failed to read log public key: %v", err)
+	}
+	sctData, err := ioutil.ReadFile(*sctFlag)
+	if err != nil {
+		glog.Exitf("Failed to read SCT: %v", err)
+	}
+	var rsp ct.AddChainResponse
+	if err := json.Unmarshal(sctData, &rsp); err != nil {
+		glog.Exitf("Failed to parse SCT: %v", err)
+	}
+	sct, err := inclusion.SCTFromAddChainResponse(&rsp)
+	if err != nil {
+		glog.Exitf("Failed to decode SCT: %v", err)
+	}
+	chainData, err := ioutil.ReadFile(*chainFlag)
+	if err != nil {
+		glog.Exitf("Failed to read chain: %v", err)
+	}
+	chain, err := inclusion.ParseChain(chainData)
+	if err != nil {
+		glog.Exitf("Failed to parse chain: %v", err)
+	}
+
+	logClient, err := client.New(*logURIFlag, nil, jsonclient.Options{})
+	if err != nil {
+		glog.Exitf("Failed to create CT client: %v", err)
+	}
+	c, err := inclusion.New(logClient, pubKey, *mmdFlag, *pollIntervalFlag, util.SystemTimeSource{})
+	if err != nil {
+		glog.Exitf("Failed to create checker: %v", err)
+	}
+	res, err := c.Check(context.Background(), sct, chain)
+	if err != nil {
+		glog.Exitf("Inclusion check failed: %v", err)
+	}
+	fmt.Printf("Leaf %x is entry %d of the tree of size %d with root %x\n", res.LeafHash, res.LeafIndex, res.STH.TreeSize, res.STH.SHA256RootHash)
+}
@@ -0,0 +1,225 @@
+// Package inclusion checks that a CT log has kept the promise made by an SCT: that the
+// certificate or precertificate it was issued for is incorporated into the log's tree
+// within the log's maximum merge delay (MMD). It's meant for use by CAs after issuance,
+// to catch SCTs that would make the certificates they're embedded in fail CT policy.
+package inclusion
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/trillian/crypto"
+	ctfe "github.com/google/trillian/examples/ct"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+// LogClient is the part of the CT client API used to check inclusion. It's implemented
+// by the client.LogClient of the CT library.
+type LogClient interface {
+	GetSTH(ctx context.Context) (*ct.SignedTreeHead, error)
+	GetProofByHash(ctx context.Context, hash []byte, treeSize uint64) (*ct.GetProofByHashResponse, error)
+}
+
+// ErrMMDElapsed is returned when the log still hasn't incorporated the entry once its
+// MMD has passed since the SCT was issued.
+var ErrMMDElapsed = errors.New("entry not incorporated within the maximum merge delay")
+
+// Result describes where an entry was found in the log.
+type Result struct {
+	// LeafHash is the Merkle leaf hash of the entry
+	LeafHash []byte
+	// LeafIndex is the entry's position in the log
+	LeafIndex int64
+	// STH is the tree head the entry was proved to be included in
+	STH ct.SignedTreeHead
+}
+
+// Checker checks that SCTs issued by a log are honored.
+type Checker struct {
+	client       LogClient
+	logID        ct.SHA256Hash
+	sigVerifier  *ct.SignatureVerifier
+	logVerifier  merkle.LogVerifier
+	hasher       merkle.TreeHasher
+	mmd          time.Duration
+	pollInterval time.Duration
+	timeSource   util.TimeSource
+}
+
+// New creates a Checker for the log with the PEM encoded public key logKeyPEM, which it
+// queries through client every pollInterval until an entry is found, or the log's mmd
+// has passed since the entry's SCT was issued.
+func New(client LogClient, logKeyPEM []byte, mmd, pollInterval time.Duration, timeSource util.TimeSource) (*Checker, error) {
+	if mmd <= 0 || pollInterval <= 0 {
+		return nil, fmt.Errorf("MMD %v and poll interval %v must be positive", mmd, pollInterval)
+	}
+	pubKey, logID, _, err := ct.PublicKeyFromPEM(logKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse log public key: %v", err)
+	}
+	sigVerifier, err := ct.NewSignatureVerifier(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	hasher := merkle.NewRFC6962TreeHasher(crypto.NewSHA256())
+	return &Checker{
+		client:       client,
+		logID:        logID,
+		sigVerifier:  sigVerifier,
+		logVerifier:  merkle.NewLogVerifier(hasher),
+		hasher:       hasher,
+		mmd:          mmd,
+		pollInterval: pollInterval,
+		timeSource:   timeSource,
+	}, nil
+}
+
+// LeafForSCT builds the Merkle tree leaf the log promised to incorporate when it issued
+// sct for chain. The first certificate of chain is the one submitted, and its issuer must
+// follow it if it's a precertificate, along with the final issuer if the precertificate
+// was issued by a precertificate signing certificate.
+func LeafForSCT(sct *ct.SignedCertificateTimestamp, chain []*x509.Certificate) (*ct.MerkleTreeLeaf, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate given")
+	}
+	etype := ct.X509LogEntryType
+	if IsPrecert(chain[0]) {
+		etype = ct.PrecertLogEntryType
+	}
+	leaf, err := ct.MerkleTreeLeafFromChain(chain, etype, sct.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	leaf.TimestampedEntry.Extensions = sct.Extensions
+	return leaf, nil
+}
+
+// IsPrecert returns true if cert has the CT poison extension.
+func IsPrecert(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(x509.OIDExtensionCTPoison) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check verifies that sct was issued by the log for chain, then waits for the entry to be
+// incorporated into the log. Once a tree head issued after the SCT is served, the entry's
+// inclusion proof against it is fetched and checked. Until then, and while the log can't
+// produce a proof, it's polled again until the MMD has passed, when ErrMMDElapsed is
+// returned. A *ctfe.VerificationError is returned if the SCT or the log's responses don't
+// verify.
+func (c *Checker) Check(ctx context.Context, sct *ct.SignedCertificateTimestamp, chain []*x509.Certificate) (*Result, error) {
+	leaf, err := LeafForSCT(sct, chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build leaf: %v", err)
+	}
+	if !bytes.Equal(sct.LogID.KeyID[:], c.logID[:]) {
+		return nil, &ctfe.VerificationError{Check: "sct", Err: fmt.Errorf("SCT is from log %x, not %x", sct.LogID.KeyID, c.logID)}
+	}
+	if err := c.sigVerifier.VerifySCTSignature(*sct, ct.LogEntry{Leaf: *leaf}); err != nil {
+		return nil, &ctfe.VerificationError{Check: "sct", Err: err}
+	}
+	leafData, err := tls.Marshal(*leaf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal leaf: %v", err)
+	}
+	leafHash := c.hasher.HashLeaf(leafData)
+
+	deadline := time.Unix(0, int64(sct.Timestamp)*int64(time.Millisecond)).Add(c.mmd)
+	for {
+		res, err := c.check(ctx, sct, leafHash)
+		if res != nil || err != nil {
+			return res, err
+		}
+		if c.timeSource.Now().After(deadline) {
+			return nil, ErrMMDElapsed
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.pollInterval):
+		}
+	}
+}
+
+// check looks for the entry with leafHash in the log's latest tree head. It returns nil
+// for both the result and the error if it's worth trying again later.
+func (c *Checker) check(ctx context.Context, sct *ct.SignedCertificateTimestamp, leafHash []byte) (*Result, error) {
+	sth, err := c.client.GetSTH(ctx)
+	if err != nil {
+		glog.Warningf("get-sth failed: %v", err)
+		return nil, nil
+	}
+	if err := c.sigVerifier.VerifySTHSignature(*sth); err != nil {
+		return nil, &ctfe.VerificationError{Check: "signature", Err: err}
+	}
+	if sth.Timestamp < sct.Timestamp || sth.TreeSize == 0 {
+		glog.V(1).Infof("tree head of size %d at %d predates the SCT", sth.TreeSize, sth.Timestamp)
+		return nil, nil
+	}
+	rsp, err := c.client.GetProofByHash(ctx, leafHash, sth.TreeSize)
+	if err != nil {
+		glog.V(1).Infof("get-proof-by-hash at tree size %d failed: %v", sth.TreeSize, err)
+		return nil, nil
+	}
+	if err := c.logVerifier.VerifyInclusionProof(rsp.LeafIndex, int64(sth.TreeSize), rsp.AuditPath, sth.SHA256RootHash[:], leafHash); err != nil {
+		return nil, &ctfe.VerificationError{Check: "inclusion", Err: fmt.Errorf("leaf %d at tree size %d: %v", rsp.LeafIndex, sth.TreeSize, err)}
+	}
+	return &Result{LeafHash: leafHash, LeafIndex: rsp.LeafIndex, STH: *sth}, nil
+}
+
+// SCTFromAddChainResponse decodes an SCT from the form it's returned in by add-chain.
+func SCTFromAddChainResponse(rsp *ct.AddChainResponse) (*ct.SignedCertificateTimestamp, error) {
+	sct := &ct.SignedCertificateTimestamp{SCTVersion: rsp.SCTVersion, Timestamp: rsp.Timestamp}
+	if len(rsp.ID) != len(sct.LogID.KeyID) {
+		return nil, fmt.Errorf("log ID is %d bytes, want %d", len(rsp.ID), len(sct.LogID.KeyID))
+	}
+	copy(sct.LogID.KeyID[:], rsp.ID)
+	exts, err := base64.StdEncoding.DecodeString(rsp.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode extensions: %v", err)
+	}
+	sct.Extensions = exts
+	if rest, err := tls.Unmarshal(rsp.Signature, &sct.Signature); err != nil {
+		return nil, fmt.Errorf("failed to parse signature: %v", err)
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("%d trailing bytes after signature", len(rest))
+	}
+	return sct, nil
+}
+
+// ParseChain parses the PEM encoded certificates in data.
+func ParseChain(data []byte) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %d: %v", len(chain), err)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return chain, nil
+}
@@ -0,0 +1,208 @@
+package inclusion
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/certificate-transparency/go/x509"
+	ctfe "github.com/google/trillian/examples/ct"
+	"github.com/google/trillian/examples/ct/testonly"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+var issued = time.Unix(1466179200, 0)
+
+// fakeLog serves a testonly.FakeLog that incorporates a pending entry after a number of
+// tree heads have been fetched. Each fetch moves its clock on by an hour.
+type fakeLog struct {
+	*testonly.FakeLog
+	t     *testing.T
+	clock *util.ManualTimeSource
+	// pending is added to the tree when integrateAfter reaches zero.
+	pending        []byte
+	integrateAfter int
+	// badSignature and badProof make the log misbehave.
+	badSignature bool
+	badProof     bool
+}
+
+func newFakeLog(t *testing.T) *fakeLog {
+	l := &fakeLog{
+		FakeLog: testonly.NewFakeLog(t),
+		t:       t,
+		clock:   util.NewManualTimeSource(issued.Add(-time.Hour)),
+	}
+	for i := 0; i < 5; i++ {
+		l.Add([]byte(fmt.Sprintf("leaf %d", i)))
+	}
+	return l
+}
+
+// issue signs an SCT for the chain, to be incorporated once integrateAfter more tree
+// heads have been fetched, or never if it's negative.
+func (l *fakeLog) issue(chain []*x509.Certificate, integrateAfter int) *ct.SignedCertificateTimestamp {
+	sct := &ct.SignedCertificateTimestamp{
+		SCTVersion: ct.V1,
+		Timestamp:  uint64(issued.UnixNano() / int64(time.Millisecond)),
+		Extensions: ct.CTExtensions{},
+	}
+	leaf, err := LeafForSCT(sct, chain)
+	if err != nil {
+		l.t.Fatalf("LeafForSCT()=_,%v", err)
+	}
+	l.SignSCT(sct, *leaf)
+	if l.pending, err = tls.Marshal(*leaf); err != nil {
+		l.t.Fatalf("Failed to marshal leaf: %v", err)
+	}
+	l.integrateAfter = integrateAfter
+	return sct
+}
+
+func (l *fakeLog) GetSTH(ctx context.Context) (*ct.SignedTreeHead, error) {
+	now := l.clock.Advance(time.Hour)
+	if l.integrateAfter == 0 {
+		l.Add(l.pending)
+		l.Add([]byte("leaf after"))
+	}
+	l.integrateAfter--
+	sth := l.TreeHead(l.Size(), uint64(now.UnixNano()/int64(time.Millisecond)))
+	l.SignTreeHead(&sth)
+	if l.badSignature {
+		sth.TreeHeadSignature.Signature[len(sth.TreeHeadSignature.Signature)-1] ^= 1
+	}
+	return &sth, nil
+}
+
+func (l *fakeLog) GetProofByHash(ctx context.Context, hash []byte, treeSize uint64) (*ct.GetProofByHashResponse, error) {
+	rsp, err := l.ProofByHash(hash, treeSize)
+	if err == nil && l.badProof {
+		rsp.AuditPath[0][0] ^= 1
+	}
+	return rsp, err
+}
+
+func TestCheck(t *testing.T) {
+	b := testonly.NewChainBuilder(t)
+	root := b.Root(testonly.CertSpec{CommonName: "Root"})
+	leaf := b.Leaf(root, testonly.CertSpec{CommonName: "Leaf"})
+	precert := b.Precert(root, testonly.CertSpec{CommonName: "Precert"})
+	signing := b.PrecertSigningCert(root, testonly.CertSpec{CommonName: "Precert Signing"})
+	signedPrecert := b.Precert(signing, testonly.CertSpec{CommonName: "Signed Precert"})
+
+	var tests = []struct {
+		descr          string
+		chain          []*x509.Certificate
+		integrateAfter int
+		tamperSCT      bool
+		badSignature   bool
+		badProof       bool
+		wantErr        error
+		wantCheck      string
+	}{
+		{descr: "cert", chain: []*x509.Certificate{leaf.Certificate, root.Certificate}, integrateAfter: 3},
+		{descr: "precert", chain: []*x509.Certificate{precert.Certificate, root.Certificate}, integrateAfter: 3},
+		{descr: "precert-signing-cert", chain: []*x509.Certificate{signedPrecert.Certificate, signing.Certificate, root.Certificate}, integrateAfter: 3},
+		{descr: "just-in-time", chain: []*x509.Certificate{leaf.Certificate}, integrateAfter: 24},
+		{descr: "mmd-elapsed", chain: []*x509.Certificate{leaf.Certificate}, integrateAfter: 30, wantErr: ErrMMDElapsed},
+		{descr: "never", chain: []*x509.Certificate{leaf.Certificate}, integrateAfter: -1, wantErr: ErrMMDElapsed},
+		{descr: "bad-sct", chain: []*x509.Certificate{leaf.Certificate}, tamperSCT: true, wantCheck: "sct"},
+		{descr: "bad-sth-signature", chain: []*x509.Certificate{leaf.Certificate}, badSignature: true, wantCheck: "signature"},
+		{descr: "bad-proof", chain: []*x509.Certificate{leaf.Certificate}, integrateAfter: 3, badProof: true, wantCheck: "inclusion"},
+	}
+	for _, test := range tests {
+		log := newFakeLog(t)
+		log.badSignature, log.badProof = test.badSignature, test.badProof
+		sct := log.issue(test.chain, test.integrateAfter)
+		if test.tamperSCT {
+			sct.Timestamp++
+		}
+		c, err := New(log, []byte(testonly.CTLogPublicKeyPEM), 24*time.Hour, time.Millisecond, log.clock)
+		if err != nil {
+			t.Fatalf("New()=_,%v", err)
+		}
+
+		res, err := c.Check(context.Background(), sct, test.chain)
+		if len(test.wantCheck) > 0 {
+			if verr, ok := err.(*ctfe.VerificationError); !ok || verr.Check != test.wantCheck {
+				t.Errorf("%s: Check()=_,%v, want %s check to fail", test.descr, err, test.wantCheck)
+			}
+			continue
+		}
+		if err != test.wantErr {
+			t.Errorf("%s: Check()=_,%v, want %v", test.descr, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got, want := res.LeafIndex, int64(5); got != want {
+			t.Errorf("%s: Check() leaf index=%d, want %d", test.descr, got, want)
+		}
+		if got, want := res.STH.TreeSize, uint64(7); got != want {
+			t.Errorf("%s: Check() tree size=%d, want %d", test.descr, got, want)
+		}
+	}
+}
+
+func TestCheckWrongLog(t *testing.T) {
+	b := testonly.NewChainBuilder(t)
+	chain := []*x509.Certificate{b.Leaf(nil, testonly.CertSpec{CommonName: "Leaf"}).Certificate}
+	log := newFakeLog(t)
+	sct := log.issue(chain, 0)
+	sct.LogID.KeyID[0] ^= 1
+	c, err := New(log, []byte(testonly.CTLogPublicKeyPEM), time.Hour, time.Millisecond, log.clock)
+	if err != nil {
+		t.Fatalf("New()=_,%v", err)
+	}
+	if _, err := c.Check(context.Background(), sct, chain); err == nil {
+		t.Errorf("Check()=_,nil for an SCT from another log, want error")
+	}
+}
+
+func TestSCTFromAddChainResponse(t *testing.T) {
+	sig := ct.DigitallySigned{
+		Algorithm: tls.SignatureAndHashAlgorithm{Hash: tls.SHA256, Signature: tls.ECDSA},
+		Signature: []byte("signature"),
+	}
+	sigData, err := tls.Marshal(sig)
+	if err != nil {
+		t.Fatalf("Failed to marshal signature: %v", err)
+	}
+	id := make([]byte, 32)
+	id[0] = 7
+
+	var tests = []struct {
+		descr   string
+		rsp     ct.AddChainResponse
+		wantErr bool
+	}{
+		{descr: "ok", rsp: ct.AddChainResponse{ID: id, Timestamp: 1234, Extensions: "AQI=", Signature: sigData}},
+		{descr: "short-id", rsp: ct.AddChainResponse{ID: id[:31], Signature: sigData}, wantErr: true},
+		{descr: "bad-extensions", rsp: ct.AddChainResponse{ID: id, Extensions: "!", Signature: sigData}, wantErr: true},
+		{descr: "bad-signature", rsp: ct.AddChainResponse{ID: id, Signature: sigData[:4]}, wantErr: true},
+		{descr: "trailing-data", rsp: ct.AddChainResponse{ID: id, Signature: append(sigData, 0)}, wantErr: true},
+	}
+	for _, test := range tests {
+		sct, err := SCTFromAddChainResponse(&test.rsp)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: SCTFromAddChainResponse()=_,%v, want error: %v", test.descr, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got, want := sct.LogID.KeyID[0], byte(7); got != want {
+			t.Errorf("%s: SCT log ID[0]=%d, want %d", test.descr, got, want)
+		}
+		if got, want := string(sct.Extensions), "\x01\x02"; got != want {
+			t.Errorf("%s: SCT extensions=%x, want %x", test.descr, got, want)
+		}
+		if got, want := string(sct.Signature.Signature), "signature"; got != want {
+			t.Errorf("%s: SCT signature=%q, want %q", test.descr, got, want)
+		}
+	}
+}
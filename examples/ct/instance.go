@@ -1,16 +1,22 @@
 package ct
 
 import (
+	gocrypto "crypto"
 	"encoding/json"
 	"errors"
 	"expvar"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"time"
 
+	"github.com/golang/glog"
+	ctclient "github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/jsonclient"
 	"github.com/google/trillian"
 	"github.com/google/trillian/crypto"
 	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
 )
 
 // LogConfig describes the configuration options for a log instance.
@@ -21,6 +27,272 @@ type LogConfig struct {
 	PubKeyPEMFile   string
 	PrivKeyPEMFile  string
 	PrivKeyPassword string
+	// Description is the log's human readable description, served by get-log-info and
+	// used in log lists.
+	Description string
+	// MirrorURI is the base URI of a secondary CT log that accepted submissions are
+	// forwarded to. Mirroring is disabled if it's empty.
+	MirrorURI string
+	// MirrorPubKeyPEMFile optionally holds the secondary log's public key, used to
+	// verify the SCTs it returns.
+	MirrorPubKeyPEMFile string
+	// ReplicaSourceURI, if set, makes the log a read-only replica of the CT log at this
+	// base URI, its source. The source's tree heads are checked with the public key in
+	// ReplicaSourcePubKeyPEMFile, and its entries are copied into the log's tree in the
+	// same order, so the tree must not be used for anything else and must allow
+	// duplicate leaves. The source is polled every ReplicaPollInterval (a duration
+	// string, default 1m), fetching ReplicaBatchSize (default 256) entries at a time.
+	// The log doesn't accept submissions, serves the source's roots, and serves the
+	// latest of the source's tree heads that its tree has been checked against from
+	// get-sth, so clients verify them with the source's key. It can't be used with
+	// options that sign the log's own tree heads or take its roots from elsewhere.
+	ReplicaSourceURI           string
+	ReplicaSourcePubKeyPEMFile string
+	ReplicaPollInterval        string
+	ReplicaBatchSize           int64
+	// MaxTreeSize is the maximum number of entries the log will hold. Once the tree
+	// reaches this size new submissions are rejected. Zero means no limit.
+	MaxTreeSize int64
+	// MaxMergeDelay is the log's maximum merge delay, a duration string, e.g. "24h". If
+	// set, each submission is queued with a deadline of its SCT timestamp plus this, so
+	// that when there's a backlog the sequencer integrates the most urgent entries first.
+	MaxMergeDelay string
+	// MergeDelayCheckInterval, a duration string, turns on tracking of how long the log's
+	// submissions take to be merged, which needs MaxMergeDelay. The entries added to the
+	// log are looked at this often for those submitted through this frontend, and the
+	// current and largest merge delays are exported in the log's statistics under
+	// "merge-delay". Submissions that have waited more than MergeDelayAlertFraction
+	// (default 0.75) of the MMD are logged as warnings, and those over it as errors.
+	MergeDelayCheckInterval string
+	MergeDelayAlertFraction float64
+	// FinalTreeHeadFile, if set, shuts the log down: it stops accepting submissions
+	// and serves the final tree head held in this file from get-sth and get-final-sth.
+	// If the file doesn't exist it's created from the latest tree head, so the sequencer
+	// should have integrated all queued entries before the log is restarted with it.
+	FinalTreeHeadFile string
+	// State is the state the log starts in: LogStateActive, the default, or
+	// LogStateFrozen. It can be changed with the admin API while the log is running, but
+	// that isn't saved here.
+	State string
+	// RPCDeadline overrides the server wide deadline for backend RPCs made for this log.
+	// It's a duration string as accepted by time.ParseDuration, e.g. "5s".
+	RPCDeadline string
+	// EndpointRPCDeadlines overrides the deadline for backend RPCs made by particular
+	// entrypoints, keyed by the names in Entrypoints or V2Entrypoints. This lets
+	// expensive read paths such as GetEntries have a longer budget than SCT issuance.
+	EndpointRPCDeadlines map[string]string
+	// NotAfterStart and NotAfterLimit restrict the log to accepting certificates that
+	// expire in [NotAfterStart, NotAfterLimit), so logs can be sharded by expiry date.
+	// They're RFC 3339 timestamps, e.g. "2018-01-01T00:00:00Z". Either can be empty to
+	// leave that end of the window open.
+	NotAfterStart string
+	NotAfterLimit string
+	// RejectExpired makes the log reject submissions whose certificate has already
+	// expired, allowing for ExpiredGracePeriod (a duration string, e.g. "24h") after
+	// expiry to cope with clock skew and submission delays.
+	RejectExpired      bool
+	ExpiredGracePeriod string
+	// MaxNotBeforeSkew rejects certificates whose NotBefore is more than this far after
+	// the submission time, and MaxValidityPeriod rejects certificates valid for longer
+	// than this. Both are duration strings, e.g. "48h" and "9528h", and may be empty for
+	// no limit.
+	MaxNotBeforeSkew  string
+	MaxValidityPeriod string
+	// Policies are applied, in order, to submissions whose chain has verified, e.g. to
+	// require minimum key sizes. The first one to reject a submission decides the error.
+	Policies []PolicyConfig
+	// BlocklistFile optionally names a file listing certificates the log refuses to
+	// accept, by SPKI hash or by issuer and serial number; see parseBlocklist for the
+	// format. It's reloaded when it changes, checking every BlocklistReloadInterval (a
+	// duration string, default 1m).
+	BlocklistFile           string
+	BlocklistReloadInterval string
+	// FetchMissingIntermediates makes the log try to complete chains that don't verify
+	// by fetching issuers from the caIssuers URLs in the certificates. Each fetch is
+	// limited to AIAFetchTimeout (a duration string, default 5s).
+	FetchMissingIntermediates bool
+	AIAFetchTimeout           string
+	// MaxChainLength is the most certificates accepted in a submitted chain, including
+	// any fetched intermediates. Zero means DefaultMaxChainLength.
+	MaxChainLength int
+	// RootsSources are remote lists of roots the log accepts, in addition to any in
+	// RootsPEMFile. They're fetched at startup and then every RootsRefreshInterval (a
+	// duration string, default 24h).
+	RootsSources         []RootsSource
+	RootsRefreshInterval string
+	// RootsCacheFile optionally names a file the roots are saved to after each
+	// successful fetch, which is used if the sources can't be fetched at startup.
+	RootsCacheFile string
+	// RootsDir optionally names a directory of root files, each holding PEM certificates
+	// or a single DER one, accepted in addition to any other roots. Only files ending in
+	// .pem, .crt, .cer or .der are read. The directory is checked for changes every
+	// RootsDirPollInterval (a duration string, default 1m), so roots can be added or
+	// removed without restarting the log.
+	RootsDir             string
+	RootsDirPollInterval string
+	// SignedEntrypoints lists endpoints, by the names in Entrypoints or V2Entrypoints,
+	// that only accept requests signed with one of RequestSigningKeys, e.g. to keep
+	// expensive read APIs for known clients. Signatures more than MaxRequestSignatureAge
+	// (a duration string, default 5m) from the log's clock are rejected.
+	SignedEntrypoints      []string
+	RequestSigningKeys     []RequestSigningKey
+	MaxRequestSignatureAge string
+	// V2LogID, if set, is the log's OID in dotted form, e.g. "1.3.101.8192", which is its
+	// LogID in RFC 6962-bis. Setting it makes the log serve the v2 API under /ct/v2/ as
+	// well as the v1 one, from the same tree.
+	V2LogID string
+	// TreeHashAlgorithm is the hash algorithm the backend builds the log's tree with:
+	// "SHA256" (the default), "SHA384" or "SHA512_256". The root hashes from the backend
+	// are checked to be the right size for it. RFC 6962 only allows SHA-256 trees, so a
+	// log with any other kind needs a V2LogID and only serves the v2 API, and can't have
+	// a TileStore or Gossip, which need SHA-256 trees too.
+	TreeHashAlgorithm string
+	// TileStore, if set, is where the log's tree is written as tiles for the static
+	// read API: a local directory, or a URL whose scheme is in
+	// InstanceOptions.TileStoreFactories. The tiles are brought up to date with the tree
+	// every TileUpdateInterval (a duration string, default 1m), and served under the
+	// log's prefix at /tile/ and /issuer/. It needs a CheckpointKeyFile, and then the
+	// checkpoint served is that of the tiles.
+	TileStore          string
+	TileUpdateInterval string
+	// CheckpointKeyFile, if set, names a file holding an unencrypted PKCS#8 PEM Ed25519
+	// private key that the log signs checkpoints with, and makes it serve its latest tree
+	// head as a checkpoint at /checkpoint. CheckpointOrigin is the log's origin, the
+	// first line of its checkpoints and the name of the key, e.g. "example.com/ct/log".
+	CheckpointKeyFile string
+	CheckpointOrigin  string
+	// Gossip, if set, makes the log accept STHs and SCT feedback from clients at
+	// /ct/v1/sth-pollination and /ct/v1/sct-feedback, and exchange STHs with peer logs,
+	// to help detect logs presenting split views.
+	Gossip *GossipConfig
+	// Witnesses, if set, are sent each new checkpoint of the log, which needs a
+	// CheckpointKeyFile, to cosign. The tree head is checked every WitnessInterval (a
+	// duration string, default 1m), and the latest checkpoint cosigned by at least
+	// WitnessQuorum of them (zero meaning all) is served at /cosigned-checkpoint, so
+	// clients can require agreement from k of the n witnesses.
+	Witnesses       []WitnessConfig
+	WitnessQuorum   int
+	WitnessInterval string
+	// SLOs are error rate and latency objectives for the log's endpoints. Whether each
+	// is breached is exported in the log's statistics under "slo", and if SLOWebhook is
+	// set an SLOAlert is posted to it as JSON whenever one is breached or recovers.
+	SLOs       []SLOConfig
+	SLOWebhook string
+	// Middleware replaces DefaultMiddleware for endpoints, keyed by the names in
+	// Entrypoints or V2Entrypoints, or "*" for all endpoints without a chain of their
+	// own. Each chain lists middleware by name, outermost first, and can use the
+	// built-in ones and those in InstanceOptions.Middleware, e.g. to add rate limiting
+	// to GetEntries only. Leaving out a built-in one, such as "metrics", turns that
+	// behavior off for the endpoint.
+	Middleware map[string][]string
+	// EntriesBytesPerSecond, if set, limits the rate at which each client, by IP address,
+	// can download entries from GetEntries and V2GetEntries, so that one aggressive
+	// monitor can't use up the server's egress. Responses are slowed down rather than
+	// rejected. A client that has been idle can download EntriesBurstBytes (default one
+	// second's worth) at full speed. It needs the "throttle" middleware in the endpoints'
+	// chains, as it is by default.
+	EntriesBytesPerSecond int64
+	EntriesBurstBytes     int64
+	// MaxConcurrentRequests, if set, limits the number of requests each endpoint, keyed
+	// by the names in Entrypoints or V2Entrypoints, handles at once, so that a burst of
+	// expensive requests, e.g. to GetEntries, can't use up the backend connections that
+	// other endpoints, e.g. AddChain, need. Requests beyond the limit get a 503 straight
+	// away. It needs the "concurrency" middleware in the endpoints' chains, as it is by
+	// default.
+	MaxConcurrentRequests map[string]int
+	// StreamEntriesMax, if more than 50, is the most entries a get-entries request can
+	// ask for. Ranges of more than 50 entries are fetched from the backend 50 at a time,
+	// and each batch is streamed to the client as it arrives, so a monitor can download
+	// the log with fewer requests without the server holding large responses in memory.
+	// The whole request has to finish within the GetEntries deadline.
+	StreamEntriesMax int64
+	// GetEntriesParallelism, if more than 1, is how many of the 50 entry batches of a
+	// streamed get-entries request are fetched from the backend at once, to speed up
+	// monitors catching up with the log. The batches are still sent to the client in
+	// order.
+	GetEntriesParallelism int
+	// APIKeys, if set, are the keys submitters can identify themselves with, sent in the
+	// X-API-Key header of add-chain, add-pre-chain and v2 submit-entry requests. Each key
+	// has its own quota of submissions, and submissions over it get a 429 response.
+	// Submissions with an unknown key are rejected, as are those without a key if
+	// RequireAPIKey is set. It needs the "api_key" middleware in the endpoints' chains,
+	// as it is by default.
+	APIKeys       []APIKeyConfig
+	RequireAPIKey bool
+	// ClientCAFile, if set, names a PEM file of CA certificates, and makes the log's POST
+	// endpoints, such as add-chain, only accept requests made with a TLS client
+	// certificate issued by one of them, e.g. for a private log. The client is identified
+	// by its certificate's common name in the access log, and can be given a quota with
+	// APIKeyConfig.ClientCertName. The server must serve HTTPS and request client
+	// certificates, which ct_server does when any log sets this. It needs the
+	// "client_cert" middleware in the endpoints' chains, as it is by default.
+	ClientCAFile string
+	// STHPrivKeyPEMFile, STHPubKeyPEMFile and STHPrivKeyPassword, if set, give a separate
+	// key that the log signs its tree heads with, leaving the key in PrivKeyPEMFile, which
+	// identifies the log, to sign SCTs. The two can then be held under different policies,
+	// e.g. a fast software key for SCTs and an HSM for tree heads. Responses say which key
+	// signed them in the X-CT-Log-Key-Id header.
+	STHPrivKeyPEMFile  string
+	STHPubKeyPEMFile   string
+	STHPrivKeyPassword string
+	// SCTKeyManager and STHKeyManager, if set, name key managers in
+	// InstanceOptions.KeyManagers, e.g. ones backed by an HSM, that sign SCTs and tree
+	// heads in place of the keys in PrivKeyPEMFile and STHPrivKeyPEMFile.
+	SCTKeyManager string
+	STHKeyManager string
+	// BackendRootFile, if set, names a file the log keeps the latest root of its backend
+	// in, checking every BackendRootInterval (a duration string, default 1m) that the new
+	// root is consistent with it before saving it. At startup the log refuses to serve if
+	// the backend's root isn't consistent with the saved one, as the backend has
+	// regressed, e.g. by being restored from an old backup, or forked, and serving its
+	// tree heads would contradict those served before. AllowBackendMismatch makes it
+	// log the mismatch and serve anyway, e.g. once the cause is understood.
+	BackendRootFile      string
+	BackendRootInterval  string
+	AllowBackendMismatch bool
+	// SignatureCacheSize, if set, is the number of recent signatures the log remembers for
+	// each of its SCT and tree head keys, so that signing the same thing again, e.g. the
+	// tree head for an unchanged root or the SCT for a retried or duplicate submission,
+	// doesn't use the key. This helps when signing is slow or rate limited, e.g. with an
+	// HSM. The cached signatures are dropped if a key manager's key changes.
+	SignatureCacheSize int
+}
+
+// InstanceOptions describes the options for a log instance that are common to all
+// the logs served by a CT server.
+type InstanceOptions struct {
+	// Deadline is the deadline that will be set on backend RPC requests, unless the log
+	// config overrides it.
+	Deadline time.Duration
+	// DisableCompression turns off gzip / deflate encoding of responses.
+	DisableCompression bool
+	// TimeSource provides the timestamps used in SCTs. The system clock is used if
+	// it's nil.
+	TimeSource util.TimeSource
+	// AccessLog receives a structured record for every request. Requests are logged
+	// with glog if it's nil.
+	AccessLog AccessLogSink
+	// CORS, if set, adds headers allowing cross-origin requests from browsers.
+	CORS *CORSPolicy
+	// PolicyFactories adds custom policies that logs can name in LogConfig.Policies.
+	PolicyFactories map[string]PolicyFactory
+	// ProofAudit, if set, records a sample of the proofs served by every log.
+	ProofAudit *ProofAuditConfig
+	// SubmissionAudit, if set, receives a record of every SCT issued by every log.
+	SubmissionAudit SubmissionAuditSink
+	// TileStoreFactories adds tile stores, e.g. object stores, that logs can use in
+	// LogConfig.TileStore, keyed by URL scheme.
+	TileStoreFactories map[string]TileStoreFactory
+	// Middleware adds custom middleware, e.g. for request logging or rate limiting, that
+	// logs can name in LogConfig.Middleware.
+	Middleware map[string]Middleware
+	// AdminMux, if set, is where the admin API is registered for logs that have
+	// RequestSigningKeys. It should be served on a separate port from the public API.
+	// Roots can only be changed for logs with a RootsPEMFile.
+	AdminMux *http.ServeMux
+	// KeyManagers adds key managers, e.g. for keys held in an HSM, that logs can name in
+	// LogConfig.SCTKeyManager and LogConfig.STHKeyManager.
+	KeyManagers map[string]crypto.KeyManager
 }
 
 var (
@@ -29,14 +301,18 @@ var (
 
 // LogStats matches the schema of the exported JSON stats for a particular log instance.
 type LogStats struct {
-	LogID            int                       `json:"log-id"`
-	LastSCTTimestamp int                       `json:"last-sct-timestamp"`
-	LastSTHTimestamp int                       `json:"last-sth-timestamp"`
-	LastSTHTreesize  int                       `json:"last-sth-treesize"`
-	HTTPAllReqs      int                       `json:"http-all-reqs"`
-	HTTPAllRsps      map[string]int            `json:"http-all-rsps"` // status => count
-	HTTPReq          map[string]int            `json:"http-reqs"`     // entrypoint => count
-	HTTPRsps         map[string]map[string]int `json:"http-rsps"`     // entrypoint => status => count
+	LogID                int                       `json:"log-id"`
+	LastSCTTimestamp     int                       `json:"last-sct-timestamp"`
+	LastSTHTimestamp     int                       `json:"last-sth-timestamp"`
+	LastSTHTreesize      int                       `json:"last-sth-treesize"`
+	HTTPAllReqs          int                       `json:"http-all-reqs"`
+	HTTPAllRsps          map[string]int            `json:"http-all-rsps"` // status => count
+	HTTPReq              map[string]int            `json:"http-reqs"`     // entrypoint => count
+	HTTPRsps             map[string]map[string]int `json:"http-rsps"`     // entrypoint => status => count
+	HTTPPanics           map[string]int            `json:"http-panics"`   // entrypoint => count
+	LogPrefix            string                    `json:"log-prefix"`
+	Submissions          map[string]int            `json:"submissions"` // entrypoint => count
+	DuplicateSubmissions int                       `json:"duplicate-submissions"`
 }
 
 // AllStats matches the schema of the entire exported JSON stats.
@@ -64,50 +340,651 @@ func LogConfigFromFile(filename string) ([]LogConfig, error) {
 	return cfg, nil
 }
 
+// signedEntrypoints returns the set of entrypoints that only accept signed requests.
+func (cfg LogConfig) signedEntrypoints() (map[string]bool, error) {
+	if len(cfg.SignedEntrypoints) == 0 {
+		return nil, nil
+	}
+	if len(cfg.RequestSigningKeys) == 0 {
+		return nil, errors.New("SignedEntrypoints needs RequestSigningKeys")
+	}
+	valid := make(map[string]bool)
+	for _, ep := range append(Entrypoints, V2Entrypoints...) {
+		valid[ep] = true
+	}
+	signed := make(map[string]bool)
+	for _, ep := range cfg.SignedEntrypoints {
+		if !valid[ep] {
+			return nil, fmt.Errorf("unknown entrypoint in SignedEntrypoints: %s", ep)
+		}
+		signed[ep] = true
+	}
+	return signed, nil
+}
+
+// rpcDeadlines returns the deadline for backend RPCs made for the log, and any overrides
+// for particular entrypoints.
+func (cfg LogConfig) rpcDeadlines(defaultDeadline time.Duration) (time.Duration, map[string]time.Duration, error) {
+	deadline := defaultDeadline
+	if len(cfg.RPCDeadline) > 0 {
+		d, err := time.ParseDuration(cfg.RPCDeadline)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid RPCDeadline: %v", err)
+		}
+		if d <= 0 {
+			return 0, nil, fmt.Errorf("RPCDeadline must be positive, got %v", d)
+		}
+		deadline = d
+	}
+
+	if len(cfg.EndpointRPCDeadlines) == 0 {
+		return deadline, nil, nil
+	}
+	valid := make(map[string]bool)
+	for _, ep := range append(Entrypoints, V2Entrypoints...) {
+		valid[ep] = true
+	}
+	endpointDeadlines := make(map[string]time.Duration)
+	for ep, s := range cfg.EndpointRPCDeadlines {
+		if !valid[ep] {
+			return 0, nil, fmt.Errorf("unknown entrypoint in EndpointRPCDeadlines: %s", ep)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid EndpointRPCDeadlines for %s: %v", ep, err)
+		}
+		if d <= 0 {
+			return 0, nil, fmt.Errorf("EndpointRPCDeadlines for %s must be positive, got %v", ep, d)
+		}
+		endpointDeadlines[ep] = d
+	}
+	return deadline, endpointDeadlines, nil
+}
+
+// checkReplica checks the options for a replica of another log, returning an error if
+// any conflict with it.
+func (cfg LogConfig) checkReplica() error {
+	if len(cfg.ReplicaSourceURI) == 0 {
+		if len(cfg.ReplicaSourcePubKeyPEMFile) > 0 || len(cfg.ReplicaPollInterval) > 0 || cfg.ReplicaBatchSize != 0 {
+			return errors.New("ReplicaSourcePubKeyPEMFile, ReplicaPollInterval and ReplicaBatchSize need ReplicaSourceURI")
+		}
+		return nil
+	}
+	if len(cfg.ReplicaSourcePubKeyPEMFile) == 0 {
+		return errors.New("ReplicaSourceURI needs ReplicaSourcePubKeyPEMFile")
+	}
+	if cfg.ReplicaBatchSize < 0 {
+		return errors.New("ReplicaBatchSize must not be negative")
+	}
+	for _, opt := range []struct {
+		name string
+		set  bool
+	}{
+		{"RootsPEMFile", len(cfg.RootsPEMFile) > 0},
+		{"RootsDir", len(cfg.RootsDir) > 0},
+		{"RootsSources", len(cfg.RootsSources) > 0},
+		{"MirrorURI", len(cfg.MirrorURI) > 0},
+		{"MaxTreeSize", cfg.MaxTreeSize > 0},
+		{"MaxMergeDelay", len(cfg.MaxMergeDelay) > 0},
+		{"FinalTreeHeadFile", len(cfg.FinalTreeHeadFile) > 0},
+		{"V2LogID", len(cfg.V2LogID) > 0},
+		{"TileStore", len(cfg.TileStore) > 0},
+		{"CheckpointKeyFile", len(cfg.CheckpointKeyFile) > 0},
+		{"Gossip", cfg.Gossip != nil},
+		{"Witnesses", len(cfg.Witnesses) > 0},
+	} {
+		if opt.set {
+			return fmt.Errorf("%s can't be used with ReplicaSourceURI", opt.name)
+		}
+	}
+	return nil
+}
+
 // SetUpInstance sets up a log instance that uses the specified client to communicate
-// with the Trillian RPC back end.
-func (cfg LogConfig) SetUpInstance(client trillian.TrillianLogClient, deadline time.Duration) error {
-	// Check config validity.
-	if len(cfg.RootsPEMFile) == 0 {
-		return errors.New("need to specify RootsPEMFile")
+// with the Trillian RPC back end. The caller should Close the returned LogContext once
+// the server has stopped serving it.
+func (cfg LogConfig) SetUpInstance(client trillian.TrillianLogClient, opts InstanceOptions) (*LogContext, error) {
+	// Check config validity. A replica gets its roots from its source.
+	if err := cfg.checkReplica(); err != nil {
+		return nil, err
+	}
+	if len(cfg.ReplicaSourceURI) == 0 && len(cfg.RootsPEMFile) == 0 && len(cfg.RootsDir) == 0 && len(cfg.RootsSources) == 0 {
+		return nil, errors.New("need to specify RootsPEMFile, RootsDir or RootsSources")
+	}
+	if len(cfg.SCTKeyManager) == 0 && len(cfg.PubKeyPEMFile) == 0 {
+		return nil, errors.New("need to specify PubKeyPEMFile")
+	}
+	if len(cfg.SCTKeyManager) == 0 && len(cfg.PrivKeyPEMFile) == 0 {
+		return nil, errors.New("need to specify PrivKeyPEMFile")
+	}
+	if cfg.MaxTreeSize < 0 {
+		return nil, errors.New("MaxTreeSize must not be negative")
+	}
+	if cfg.MaxChainLength < 0 {
+		return nil, errors.New("MaxChainLength must not be negative")
+	}
+	if cfg.SignatureCacheSize < 0 {
+		return nil, errors.New("SignatureCacheSize must not be negative")
+	}
+	if cfg.EntriesBytesPerSecond < 0 || cfg.EntriesBurstBytes < 0 {
+		return nil, errors.New("EntriesBytesPerSecond and EntriesBurstBytes must not be negative")
 	}
-	if len(cfg.PubKeyPEMFile) == 0 {
-		return errors.New("need to specify PubKeyPEMFile")
+	if cfg.EntriesBurstBytes > 0 && cfg.EntriesBytesPerSecond == 0 {
+		return nil, errors.New("EntriesBurstBytes needs EntriesBytesPerSecond")
 	}
-	if len(cfg.PrivKeyPEMFile) == 0 {
-		return errors.New("need to specify PrivKeyPEMFile")
+	if cfg.StreamEntriesMax < 0 {
+		return nil, errors.New("StreamEntriesMax must not be negative")
+	}
+	if cfg.GetEntriesParallelism < 0 {
+		return nil, errors.New("GetEntriesParallelism must not be negative")
+	}
+
+	state, err := parseLogState(cfg.State)
+	if err != nil {
+		return nil, err
+	}
+	deadline, endpointDeadlines, err := cfg.rpcDeadlines(opts.Deadline)
+	if err != nil {
+		return nil, err
+	}
+	notAfter, err := parseNotAfterWindow(cfg.NotAfterStart, cfg.NotAfterLimit)
+	if err != nil {
+		return nil, err
+	}
+	expiry, err := parseExpiryPolicy(cfg.RejectExpired, cfg.ExpiredGracePeriod)
+	if err != nil {
+		return nil, err
+	}
+	validity, err := parseValidityPolicy(cfg.MaxNotBeforeSkew, cfg.MaxValidityPeriod)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := buildPolicies(cfg.Policies, opts.PolicyFactories)
+	if err != nil {
+		return nil, err
+	}
+	signedEntrypoints, err := cfg.signedEntrypoints()
+	if err != nil {
+		return nil, err
+	}
+	middleware, err := buildMiddleware(cfg.Middleware, opts.Middleware)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.RequireAPIKey && len(cfg.APIKeys) == 0 {
+		return nil, errors.New("RequireAPIKey needs APIKeys")
+	}
+	var v2LogID []byte
+	if len(cfg.V2LogID) > 0 {
+		if v2LogID, err = parseV2LogID(cfg.V2LogID); err != nil {
+			return nil, fmt.Errorf("invalid V2LogID: %v", err)
+		}
+	}
+	treeHash, err := parseTreeHashAlgorithm(cfg.TreeHashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	if treeHash != gocrypto.SHA256 {
+		if len(v2LogID) == 0 {
+			return nil, fmt.Errorf("TreeHashAlgorithm %s needs V2LogID", cfg.TreeHashAlgorithm)
+		}
+		if len(cfg.TileStore) > 0 || cfg.Gossip != nil {
+			return nil, fmt.Errorf("TileStore and Gossip need a SHA256 tree, not %s", cfg.TreeHashAlgorithm)
+		}
+	}
+	var mergeDelay time.Duration
+	if len(cfg.MaxMergeDelay) > 0 {
+		if mergeDelay, err = time.ParseDuration(cfg.MaxMergeDelay); err != nil {
+			return nil, fmt.Errorf("invalid MaxMergeDelay: %v", err)
+		}
+		if mergeDelay <= 0 {
+			return nil, fmt.Errorf("MaxMergeDelay must be positive, got %v", mergeDelay)
+		}
+	}
+	var mergeCheckInterval time.Duration
+	mergeAlertFraction := defaultMergeDelayAlertFraction
+	if len(cfg.MergeDelayCheckInterval) > 0 {
+		if mergeDelay == 0 {
+			return nil, errors.New("MergeDelayCheckInterval needs MaxMergeDelay")
+		}
+		if mergeCheckInterval, err = time.ParseDuration(cfg.MergeDelayCheckInterval); err != nil {
+			return nil, fmt.Errorf("invalid MergeDelayCheckInterval: %v", err)
+		}
+		if mergeCheckInterval <= 0 {
+			return nil, fmt.Errorf("MergeDelayCheckInterval must be positive, got %v", mergeCheckInterval)
+		}
+	}
+	if cfg.MergeDelayAlertFraction != 0 {
+		if len(cfg.MergeDelayCheckInterval) == 0 {
+			return nil, errors.New("MergeDelayAlertFraction needs MergeDelayCheckInterval")
+		}
+		if cfg.MergeDelayAlertFraction < 0 || cfg.MergeDelayAlertFraction > 1 {
+			return nil, fmt.Errorf("MergeDelayAlertFraction must be between 0 and 1, got %v", cfg.MergeDelayAlertFraction)
+		}
+		mergeAlertFraction = cfg.MergeDelayAlertFraction
+	}
+	signatureAge := defaultMaxRequestSignatureAge
+	if len(cfg.MaxRequestSignatureAge) > 0 {
+		if signatureAge, err = time.ParseDuration(cfg.MaxRequestSignatureAge); err != nil {
+			return nil, fmt.Errorf("invalid MaxRequestSignatureAge: %v", err)
+		}
+		if signatureAge <= 0 {
+			return nil, fmt.Errorf("MaxRequestSignatureAge must be positive, got %v", signatureAge)
+		}
+	}
+	var checkpointSigner *noteSigner
+	if len(cfg.CheckpointKeyFile) > 0 {
+		if len(cfg.CheckpointOrigin) == 0 {
+			return nil, errors.New("CheckpointKeyFile needs CheckpointOrigin")
+		}
+		if checkpointSigner, err = loadNoteSigner(cfg.CheckpointOrigin, cfg.CheckpointKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	var tileStore TileStore
+	tileInterval := defaultTileUpdateInterval
+	if len(cfg.TileStore) > 0 {
+		if checkpointSigner == nil {
+			return nil, errors.New("TileStore needs CheckpointKeyFile")
+		}
+		if len(cfg.TileUpdateInterval) > 0 {
+			if tileInterval, err = time.ParseDuration(cfg.TileUpdateInterval); err != nil {
+				return nil, fmt.Errorf("invalid TileUpdateInterval: %v", err)
+			}
+			if tileInterval <= 0 {
+				return nil, fmt.Errorf("TileUpdateInterval must be positive, got %v", tileInterval)
+			}
+		}
+		if tileStore, err = newTileStore(cfg.TileStore, opts.TileStoreFactories); err != nil {
+			return nil, err
+		}
+	}
+	var gossipPeers []gossipPeer
+	gossipInterval := defaultGossipPeerPollInterval
+	if cfg.Gossip != nil {
+		if cfg.Gossip.RequestsPerMinute < 0 || cfg.Gossip.MaxSTHs < 0 || cfg.Gossip.MaxFeedback < 0 {
+			return nil, errors.New("Gossip limits must not be negative")
+		}
+		if len(cfg.Gossip.PeerPollInterval) > 0 {
+			if gossipInterval, err = time.ParseDuration(cfg.Gossip.PeerPollInterval); err != nil {
+				return nil, fmt.Errorf("invalid Gossip.PeerPollInterval: %v", err)
+			}
+			if gossipInterval <= 0 {
+				return nil, fmt.Errorf("Gossip.PeerPollInterval must be positive, got %v", gossipInterval)
+			}
+		}
+		if gossipPeers, err = loadGossipPeers(cfg.Gossip); err != nil {
+			return nil, err
+		}
+	}
+	var witnesses []*witness
+	witnessInterval := defaultWitnessInterval
+	if len(cfg.Witnesses) > 0 {
+		if checkpointSigner == nil {
+			return nil, errors.New("Witnesses need CheckpointKeyFile")
+		}
+		if cfg.WitnessQuorum < 0 || cfg.WitnessQuorum > len(cfg.Witnesses) {
+			return nil, fmt.Errorf("WitnessQuorum must be between 0 and %d, got %d", len(cfg.Witnesses), cfg.WitnessQuorum)
+		}
+		if len(cfg.WitnessInterval) > 0 {
+			if witnessInterval, err = time.ParseDuration(cfg.WitnessInterval); err != nil {
+				return nil, fmt.Errorf("invalid WitnessInterval: %v", err)
+			}
+			if witnessInterval <= 0 {
+				return nil, fmt.Errorf("WitnessInterval must be positive, got %v", witnessInterval)
+			}
+		}
+		for _, wc := range cfg.Witnesses {
+			w, err := parseWitness(wc)
+			if err != nil {
+				return nil, err
+			}
+			witnesses = append(witnesses, w)
+		}
+	}
+	slos, err := parseSLOs(cfg.SLOs)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.SLOWebhook) > 0 && len(slos) == 0 {
+		return nil, errors.New("SLOWebhook needs SLOs")
+	}
+	var bl *blocklist
+	blocklistInterval := defaultBlocklistReloadInterval
+	if len(cfg.BlocklistFile) > 0 {
+		if len(cfg.BlocklistReloadInterval) > 0 {
+			if blocklistInterval, err = time.ParseDuration(cfg.BlocklistReloadInterval); err != nil {
+				return nil, fmt.Errorf("invalid BlocklistReloadInterval: %v", err)
+			}
+			if blocklistInterval <= 0 {
+				return nil, fmt.Errorf("BlocklistReloadInterval must be positive, got %v", blocklistInterval)
+			}
+		}
+		if bl, err = newBlocklist(fmt.Sprintf("%s{%d}", cfg.Prefix, cfg.LogID), cfg.BlocklistFile); err != nil {
+			return nil, fmt.Errorf("failed to load blocklist: %v", err)
+		}
+	}
+	backendRootInterval := defaultBackendRootInterval
+	if len(cfg.BackendRootInterval) > 0 {
+		if len(cfg.BackendRootFile) == 0 {
+			return nil, errors.New("BackendRootInterval needs BackendRootFile")
+		}
+		if backendRootInterval, err = time.ParseDuration(cfg.BackendRootInterval); err != nil {
+			return nil, fmt.Errorf("invalid BackendRootInterval: %v", err)
+		}
+		if backendRootInterval <= 0 {
+			return nil, fmt.Errorf("BackendRootInterval must be positive, got %v", backendRootInterval)
+		}
+	}
+	replicaInterval := defaultReplicaPollInterval
+	if len(cfg.ReplicaPollInterval) > 0 {
+		if replicaInterval, err = time.ParseDuration(cfg.ReplicaPollInterval); err != nil {
+			return nil, fmt.Errorf("invalid ReplicaPollInterval: %v", err)
+		}
+		if replicaInterval <= 0 {
+			return nil, fmt.Errorf("ReplicaPollInterval must be positive, got %v", replicaInterval)
+		}
+	}
+	var aiaTimeout time.Duration
+	if len(cfg.AIAFetchTimeout) > 0 {
+		if aiaTimeout, err = time.ParseDuration(cfg.AIAFetchTimeout); err != nil {
+			return nil, fmt.Errorf("invalid AIAFetchTimeout: %v", err)
+		}
+		if aiaTimeout <= 0 {
+			return nil, fmt.Errorf("AIAFetchTimeout must be positive, got %v", aiaTimeout)
+		}
 	}
 
 	// Load the trusted roots
-	roots := NewPEMCertPool()
-	if err := roots.AppendCertsFromPEMFile(cfg.RootsPEMFile); err != nil {
-		return fmt.Errorf("failed to read trusted roots: %v", err)
+	var roots *PEMCertPool
+	var fetcher *rootsFetcher
+	refreshInterval := defaultRootsRefreshInterval
+	dirPollInterval := defaultRootsDirPollInterval
+	if len(cfg.ReplicaSourceURI) > 0 {
+		roots = NewPEMCertPool()
+	} else if len(cfg.RootsSources) == 0 && len(cfg.RootsDir) == 0 {
+		roots = NewPEMCertPool()
+		if err := roots.AppendCertsFromPEMFile(cfg.RootsPEMFile); err != nil {
+			return nil, fmt.Errorf("failed to read trusted roots: %v", err)
+		}
+	} else {
+		if len(cfg.RootsRefreshInterval) > 0 {
+			if refreshInterval, err = time.ParseDuration(cfg.RootsRefreshInterval); err != nil {
+				return nil, fmt.Errorf("invalid RootsRefreshInterval: %v", err)
+			}
+			if refreshInterval <= 0 {
+				return nil, fmt.Errorf("RootsRefreshInterval must be positive, got %v", refreshInterval)
+			}
+		}
+		if len(cfg.RootsDirPollInterval) > 0 {
+			if dirPollInterval, err = time.ParseDuration(cfg.RootsDirPollInterval); err != nil {
+				return nil, fmt.Errorf("invalid RootsDirPollInterval: %v", err)
+			}
+			if dirPollInterval <= 0 {
+				return nil, fmt.Errorf("RootsDirPollInterval must be positive, got %v", dirPollInterval)
+			}
+		}
+		fetcher, err = newRootsFetcher(fmt.Sprintf("%s{%d}", cfg.Prefix, cfg.LogID), cfg.RootsPEMFile, cfg.RootsDir, cfg.RootsSources, cfg.RootsCacheFile, nil)
+		if err != nil {
+			return nil, err
+		}
+		if roots, err = fetcher.initialRoots(); err != nil {
+			return nil, fmt.Errorf("failed to fetch trusted roots: %v", err)
+		}
 	}
 
-	// Set up a key manager instance for this log.
-	km := crypto.NewPEMKeyManager()
-	privData, err := ioutil.ReadFile(cfg.PrivKeyPEMFile)
+	// Set up the key managers for this log's SCTs and, if it has a separate key for them,
+	// its tree heads.
+	km, err := keyManagerFor(cfg.SCTKeyManager, cfg.PrivKeyPEMFile, cfg.PubKeyPEMFile, cfg.PrivKeyPassword, opts.KeyManagers)
+	if err != nil {
+		return nil, err
+	}
+	sthKM := km
+	if len(cfg.STHKeyManager) > 0 || len(cfg.STHPrivKeyPEMFile) > 0 || len(cfg.STHPubKeyPEMFile) > 0 {
+		if sthKM, err = keyManagerFor(cfg.STHKeyManager, cfg.STHPrivKeyPEMFile, cfg.STHPubKeyPEMFile, cfg.STHPrivKeyPassword, opts.KeyManagers); err != nil {
+			return nil, fmt.Errorf("invalid STH key: %v", err)
+		}
+	}
+	sctKeyID, err := logKeyID(km)
+	if err != nil {
+		return nil, err
+	}
+	sthKeyID, err := logKeyID(sthKM)
 	if err != nil {
-		return fmt.Errorf("failed to load private key file: %v", err)
+		return nil, err
 	}
 
-	if err := km.LoadPrivateKey(string(privData), cfg.PrivKeyPassword); err != nil {
-		return fmt.Errorf("failed to parse private key: %v", err)
+	var sigCaches map[string]*signatureCache
+	if cfg.SignatureCacheSize > 0 {
+		sctCache := newSignatureCache(fmt.Sprintf("%s{%d}: SCT", cfg.Prefix, cfg.LogID), km, cfg.SignatureCacheSize)
+		sthCache := newSignatureCache(fmt.Sprintf("%s{%d}: STH", cfg.Prefix, cfg.LogID), sthKM, cfg.SignatureCacheSize)
+		km, sthKM = sctCache, sthCache
+		sigCaches = map[string]*signatureCache{"sct": sctCache, "sth": sthCache}
 	}
 
-	pubData, err := ioutil.ReadFile(cfg.PubKeyPEMFile)
-	if err != nil {
-		return fmt.Errorf("failed to load public key file: %v", err)
+	timeSource := opts.TimeSource
+	if timeSource == nil {
+		timeSource = new(util.SystemTimeSource)
+	}
+
+	// Create and register the handlers using the RPC client we just set up, counting
+	// this log's RPCs separately from those of other logs sharing the client.
+	backendStats := newBackendStatsClient(client, timeSource)
+	ctx := NewLogContext(cfg.LogID, cfg.Prefix, roots, backendStats, km, deadline, timeSource)
+	ctx.exp.vars.Set("backend", backendStats.Vars())
+	ctx.sthKeyManager = sthKM
+	for name, id := range map[string]string{"sct-key-id": sctKeyID, "sth-key-id": sthKeyID} {
+		v := new(expvar.String)
+		v.Set(id)
+		ctx.exp.vars.Set(name, v)
+	}
+	if len(sigCaches) > 0 {
+		cacheVars := new(expvar.Map).Init()
+		for name, sc := range sigCaches {
+			cacheVars.Set(name, sc.Vars())
+		}
+		ctx.exp.vars.Set("signature-cache", cacheVars)
+	}
+	if sthKeyID != sctKeyID {
+		glog.Infof("%s: signing SCTs with key %s and tree heads with key %s", ctx.logPrefix, sctKeyID, sthKeyID)
+	}
+	ctx.endpointDeadlines = endpointDeadlines
+	ctx.description = cfg.Description
+	ctx.notAfter = notAfter
+	ctx.expiry = expiry
+	ctx.validity = validity
+	ctx.mergeDelay = mergeDelay
+	ctx.v2LogID = v2LogID
+	ctx.treeHash = treeHash
+	ctx.policies = policies
+	ctx.middleware = middleware
+	if checkpointSigner != nil {
+		ctx.checkpointSigner = checkpointSigner
+		verifierKey := new(expvar.String)
+		verifierKey.Set(checkpointSigner.VerifierKey())
+		ctx.exp.vars.Set("checkpoint-verifier-key", verifierKey)
+		glog.Infof("%s: signing checkpoints with verifier key %s", ctx.logPrefix, checkpointSigner.VerifierKey())
+	}
+	if cfg.MaxChainLength > 0 {
+		ctx.maxChainLength = cfg.MaxChainLength
+	}
+	ctx.streamEntriesMax = cfg.StreamEntriesMax
+	ctx.entriesParallelism = cfg.GetEntriesParallelism
+	if cfg.FetchMissingIntermediates {
+		ctx.aia = newAIAFetcher(ctx.logPrefix, nil, aiaTimeout, timeSource)
+		ctx.exp.vars.Set("aia", ctx.aia.Vars())
+	}
+	if cfg.EntriesBytesPerSecond > 0 {
+		burst := cfg.EntriesBurstBytes
+		if burst == 0 {
+			burst = cfg.EntriesBytesPerSecond
+		}
+		ctx.entriesThrottle = newBandwidthThrottle(cfg.EntriesBytesPerSecond, burst, timeSource)
+		ctx.exp.vars.Set("entries-throttle", ctx.entriesThrottle.Vars())
+	}
+	if len(cfg.MaxConcurrentRequests) > 0 {
+		if ctx.concurrency, err = newConcurrencyLimiter(cfg.MaxConcurrentRequests); err != nil {
+			return nil, err
+		}
+		ctx.exp.vars.Set("concurrency", ctx.concurrency.Vars())
+	}
+	if len(cfg.ClientCAFile) > 0 {
+		if ctx.clientCerts, err = newClientCertVerifier(cfg.ClientCAFile, timeSource); err != nil {
+			return nil, err
+		}
+		ctx.exp.vars.Set("client-certs", ctx.clientCerts.Vars())
+	}
+	if len(cfg.APIKeys) > 0 {
+		if ctx.apiKeys, err = newAPIKeys(cfg.APIKeys, cfg.RequireAPIKey, timeSource); err != nil {
+			return nil, err
+		}
+		ctx.exp.vars.Set("api-keys", ctx.apiKeys.Vars())
+	}
+	ctx.compressResponses = !opts.DisableCompression
+	if opts.AccessLog != nil {
+		ctx.accessLog = opts.AccessLog
+	}
+	if ctx.state.set(state); state != LogStateActive {
+		glog.Infof("%s: log starting in state %s", ctx.logPrefix, state)
+	}
+	ctx.cors = opts.CORS
+	if opts.ProofAudit != nil && opts.ProofAudit.Sink != nil {
+		ctx.proofAudit = newProofAuditor(opts.ProofAudit)
+	}
+	ctx.submissionAudit = opts.SubmissionAudit
+	if len(cfg.RequestSigningKeys) > 0 {
+		if ctx.requestVerifier, err = newRequestVerifier(cfg.RequestSigningKeys, signatureAge, timeSource); err != nil {
+			return nil, err
+		}
+		ctx.signedEntrypoints = signedEntrypoints
+	}
+
+	if bl != nil {
+		ctx.blocklist = bl
+		bl.Start(blocklistInterval)
+		ctx.exp.vars.Set("blocklist", bl.Vars())
+	}
+
+	if fetcher != nil {
+		fetcher.Start(ctx.trustedRoots, refreshInterval, dirPollInterval)
+		ctx.exp.vars.Set("roots", fetcher.Vars())
+	}
+
+	if len(cfg.MirrorURI) > 0 {
+		mirrorOpts := jsonclient.Options{}
+		if len(cfg.MirrorPubKeyPEMFile) > 0 {
+			mirrorKey, err := ioutil.ReadFile(cfg.MirrorPubKeyPEMFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load mirror public key file: %v", err)
+			}
+			mirrorOpts.PublicKey = string(mirrorKey)
+		}
+		mirrorClient, err := ctclient.New(cfg.MirrorURI, nil, mirrorOpts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create mirror log client: %v", err)
+		}
+		ctx.mirror = NewMirror(ctx.logPrefix, mirrorClient)
+		ctx.mirror.Start()
+		ctx.exp.vars.Set("mirror", ctx.mirror.Vars())
+	}
+
+	if len(cfg.ReplicaSourceURI) > 0 {
+		sourceKey, err := ioutil.ReadFile(cfg.ReplicaSourcePubKeyPEMFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load replica source public key file: %v", err)
+		}
+		sourceClient, err := ctclient.New(cfg.ReplicaSourceURI, nil, jsonclient.Options{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create replica source log client: %v", err)
+		}
+		batchSize := int64(defaultReplicaBatchSize)
+		if cfg.ReplicaBatchSize > 0 {
+			batchSize = cfg.ReplicaBatchSize
+		}
+		if ctx.replica, err = newReplicator(*ctx, sourceClient, sourceKey, batchSize); err != nil {
+			return nil, err
+		}
+		ctx.replica.Start(replicaInterval)
+		ctx.exp.vars.Set("replica", ctx.replica.Vars())
+	}
+
+	if cfg.MaxTreeSize > 0 {
+		ctx.sizeLimit = newTreeSizeLimit(cfg.MaxTreeSize)
+		maxSize := new(expvar.Int)
+		maxSize.Set(cfg.MaxTreeSize)
+		ctx.exp.vars.Set("max-tree-size", maxSize)
+		ctx.exp.vars.Set("log-full", ctx.sizeLimit.full)
+	}
+
+	if len(cfg.FinalTreeHeadFile) > 0 {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), deadline)
+		err := shutDown(shutdownCtx, ctx, cfg.FinalTreeHeadFile)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to shut down log: %v", err)
+		}
+	}
+
+	if len(cfg.BackendRootFile) > 0 {
+		checkCtx, cancel := context.WithTimeout(context.Background(), deadline)
+		ctx.backendRoot, err = newBackendRootTracker(checkCtx, *ctx, cfg.BackendRootFile, cfg.AllowBackendMismatch)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		ctx.backendRoot.Start(backendRootInterval)
+		ctx.exp.vars.Set("backend-root", ctx.backendRoot.Vars())
+	}
+
+	if tileStore != nil {
+		if ctx.tiles, err = newTileWriter(*ctx, tileStore); err != nil {
+			return nil, fmt.Errorf("failed to set up tiles: %v", err)
+		}
+		ctx.tiles.Start(tileInterval)
+		ctx.exp.vars.Set("tiles", ctx.tiles.Vars())
+	}
+
+	if cfg.Gossip != nil {
+		if ctx.gossip, err = newGossiper(*ctx, cfg.Gossip, gossipPeers); err != nil {
+			return nil, fmt.Errorf("failed to set up gossip: %v", err)
+		}
+		ctx.gossip.Start(*ctx, gossipInterval)
+		ctx.exp.vars.Set("gossip", ctx.gossip.Vars())
 	}
 
-	if err := km.LoadPublicKey(string(pubData)); err != nil {
-		return fmt.Errorf("failed to parse public key: %v", err)
+	if len(slos) > 0 {
+		ctx.slo = newSLOMonitor(ctx.logPrefix, slos, cfg.SLOWebhook, ctx.timeSource)
+		ctx.slo.Start()
+		ctx.exp.vars.Set("slo", ctx.slo.Vars())
+	}
+
+	if mergeCheckInterval > 0 {
+		ctx.mergeTracker = newMergeDelayTracker(*ctx, mergeDelay, mergeAlertFraction)
+		ctx.mergeTracker.Start(mergeCheckInterval)
+		ctx.exp.vars.Set("merge-delay", ctx.mergeTracker.Vars())
+	}
+
+	if len(witnesses) > 0 {
+		if ctx.cosigner, err = newCosigner(*ctx, witnesses, cfg.WitnessQuorum); err != nil {
+			return nil, fmt.Errorf("failed to set up witnesses: %v", err)
+		}
+		ctx.cosigner.Start(witnessInterval)
+		ctx.exp.vars.Set("witnesses", ctx.cosigner.Vars())
+	}
+
+	if opts.AdminMux != nil {
+		if len(cfg.RequestSigningKeys) > 0 {
+			if len(cfg.RootsPEMFile) > 0 {
+				ctx.rootsEditor = &rootsEditor{pemFile: cfg.RootsPEMFile, reload: rootsReloader(cfg.RootsPEMFile, ctx.trustedRoots, fetcher)}
+			}
+			ctx.RegisterAdminHandlers(opts.AdminMux, cfg.Prefix)
+		} else {
+			glog.Infof("%s: admin API needs RequestSigningKeys, not serving it", ctx.logPrefix)
+		}
 	}
 
-	// Create and register the handlers using the RPC client we just set up
-	ctx := NewLogContext(cfg.LogID, cfg.Prefix, roots, client, km, deadline, new(util.SystemTimeSource))
 	ctx.RegisterHandlers(cfg.Prefix)
 	logVars.Set(cfg.Prefix, ctx.exp.vars)
 
-	return nil
+	return ctx, nil
 }
@@ -0,0 +1,88 @@
+package ct
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRPCDeadlines(t *testing.T) {
+	var tests = []struct {
+		cfg     LogConfig
+		wantErr bool
+		want    time.Duration
+		wantEps map[string]time.Duration
+	}{
+		{cfg: LogConfig{}, want: 10 * time.Second},
+		{cfg: LogConfig{RPCDeadline: "2s"}, want: 2 * time.Second},
+		{cfg: LogConfig{RPCDeadline: "1m", EndpointRPCDeadlines: map[string]string{"GetEntries": "90s", "AddChain": "500ms"}},
+			want: time.Minute, wantEps: map[string]time.Duration{"GetEntries": 90 * time.Second, "AddChain": 500 * time.Millisecond}},
+		{cfg: LogConfig{RPCDeadline: "soon"}, wantErr: true},
+		{cfg: LogConfig{RPCDeadline: "-1s"}, wantErr: true},
+		{cfg: LogConfig{EndpointRPCDeadlines: map[string]string{"GetEverything": "1s"}}, wantErr: true},
+		{cfg: LogConfig{EndpointRPCDeadlines: map[string]string{"GetEntries": "0s"}}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, gotEps, err := test.cfg.rpcDeadlines(10 * time.Second)
+		if (err != nil) != test.wantErr {
+			t.Errorf("rpcDeadlines(%+v)=%v, want error: %v", test.cfg, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got != test.want {
+			t.Errorf("rpcDeadlines(%+v)=%v, want %v", test.cfg, got, test.want)
+		}
+		if len(gotEps) != len(test.wantEps) {
+			t.Errorf("rpcDeadlines(%+v)=%v, want %v", test.cfg, gotEps, test.wantEps)
+		}
+		for ep, want := range test.wantEps {
+			if gotEps[ep] != want {
+				t.Errorf("rpcDeadlines(%+v)[%s]=%v, want %v", test.cfg, ep, gotEps[ep], want)
+			}
+		}
+	}
+}
+
+func TestGetRPCDeadlineTime(t *testing.T) {
+	c := LogContext{timeSource: fakeTimeSource, rpcDeadline: time.Second, endpointDeadlines: map[string]time.Duration{"GetEntries": time.Minute}}
+
+	for _, test := range []struct {
+		entrypoint string
+		want       time.Time
+	}{
+		{"AddChain", fakeTime.Add(time.Second)},
+		{"GetEntries", fakeTime.Add(time.Minute)},
+	} {
+		if got := getRPCDeadlineTime(c, test.entrypoint); !got.Equal(test.want) {
+			t.Errorf("getRPCDeadlineTime(%s)=%v, want %v", test.entrypoint, got, test.want)
+		}
+	}
+}
+
+func TestSignedEntrypointsConfig(t *testing.T) {
+	keys := []RequestSigningKey{{ID: "a", Algorithm: SigningAlgorithmHMACSHA256, Key: "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}}
+	var tests = []struct {
+		cfg     LogConfig
+		want    int
+		wantErr bool
+	}{
+		{cfg: LogConfig{}},
+		{cfg: LogConfig{RequestSigningKeys: keys}},
+		{cfg: LogConfig{RequestSigningKeys: keys, SignedEntrypoints: []string{"GetEntries", "GetSTHConsistency"}}, want: 2},
+		{cfg: LogConfig{SignedEntrypoints: []string{"GetEntries"}}, wantErr: true},
+		{cfg: LogConfig{RequestSigningKeys: keys, SignedEntrypoints: []string{"GetEverything"}}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := test.cfg.signedEntrypoints()
+		if (err != nil) != test.wantErr {
+			t.Errorf("signedEntrypoints(%+v)=%v, want error: %v", test.cfg, err, test.wantErr)
+			continue
+		}
+		if len(got) != test.want {
+			t.Errorf("signedEntrypoints(%+v)=%v, want %d entrypoints", test.cfg, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package ct
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/trillian/crypto"
+	"golang.org/x/net/context"
+)
+
+// GetLogInfoPath is the path of the endpoint describing the log, relative to the log's
+// prefix. It isn't part of RFC 6962.
+const GetLogInfoPath = "/ct/v1/get-log-info"
+
+// LogInfo is the response to get-log-info. It has what a monitor or a log list needs to
+// know about the log that the RFC 6962 API doesn't say.
+type LogInfo struct {
+	Description string `json:"description,omitempty"`
+	// LogID is the SHA-256 hash of Key, as it appears in SCTs
+	LogID []byte `json:"log_id"`
+	// Key is the DER encoded public key the log signs SCTs with
+	Key []byte `json:"key"`
+	// STHKey is the DER encoded public key the log signs tree heads with, if the log has
+	// a separate key for them
+	STHKey []byte `json:"sth_key,omitempty"`
+	// MaximumMergeDelay is in seconds, and is omitted if the log isn't configured with one
+	MaximumMergeDelay int64 `json:"maximum_merge_delay,omitempty"`
+	// RootsFingerprint is the hex encoded fingerprint of the roots the log accepts, which
+	// changes whenever they do; it's also get-roots' ETag
+	RootsFingerprint string `json:"roots_fingerprint"`
+	// NotAfterStart and NotAfterLimit are the RFC 3339 bounds of the expiry dates of the
+	// certificates the log accepts, if it's a temporal shard
+	NotAfterStart string `json:"not_after_start,omitempty"`
+	NotAfterLimit string `json:"not_after_limit,omitempty"`
+}
+
+// getLogInfo serves the log's LogInfo.
+func getLogInfo(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	key, err := c.logKeyManager.GetRawPublicKey()
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("get-log-info: failed to get public key: %v", err)
+	}
+	logID, err := GetCTLogID(c.logKeyManager)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("get-log-info: failed to get log ID: %v", err)
+	}
+	info := LogInfo{
+		Description:       c.description,
+		LogID:             logID[:],
+		Key:               key,
+		MaximumMergeDelay: int64(c.mergeDelay / time.Second),
+		RootsFingerprint:  fmt.Sprintf("%x", c.trustedRoots.Pool().Fingerprint()),
+	}
+	if c.sthKeyManager != nil && c.sthKeyManager != c.logKeyManager {
+		if info.STHKey, err = c.sthKeyManager.GetRawPublicKey(); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("get-log-info: failed to get tree head key: %v", err)
+		}
+		if bytes.Equal(info.STHKey, key) {
+			info.STHKey = nil
+		}
+	}
+	if c.notAfter.start != nil {
+		info.NotAfterStart = c.notAfter.start.Format(time.RFC3339)
+	}
+	if c.notAfter.limit != nil {
+		info.NotAfterLimit = c.notAfter.limit.Format(time.RFC3339)
+	}
+	return writeJSON(w, info)
+}
+
+// LogList is a log list in the format of Chrome's log_list.json, holding the logs run by
+// one operator.
+type LogList struct {
+	Operators []LogListOperator `json:"operators"`
+	Logs      []LogListEntry    `json:"logs"`
+}
+
+// LogListOperator is an operator in a LogList.
+type LogListOperator struct {
+	Name string `json:"name"`
+	ID   int    `json:"id"`
+}
+
+// LogListEntry is a log in a LogList.
+type LogListEntry struct {
+	Description string `json:"description"`
+	// Key is the DER encoded public key of the log
+	Key []byte `json:"key"`
+	// URL is the log's base URL without the scheme, e.g. ct.example.com/logs/example/
+	URL string `json:"url"`
+	// MaximumMergeDelay is in seconds
+	MaximumMergeDelay int64 `json:"maximum_merge_delay"`
+	// OperatedBy holds the IDs of the log's operators
+	OperatedBy []int `json:"operated_by"`
+	// TemporalInterval is set for logs that only accept certificates expiring in a window
+	TemporalInterval *TemporalInterval `json:"temporal_interval,omitempty"`
+}
+
+// TemporalInterval is the window of expiry dates a log accepts, as RFC 3339 timestamps.
+// Either end may be omitted if it's open.
+type TemporalInterval struct {
+	StartInclusive string `json:"start_inclusive,omitempty"`
+	EndExclusive   string `json:"end_exclusive,omitempty"`
+}
+
+// LogListFromConfig builds a LogList for the logs in cfgs, run by operator and served
+// under baseURL, e.g. https://ct.example.com. Each log's public key is read from its
+// PubKeyPEMFile, and logs without a MaxMergeDelay are listed with defaultMMD. Replicas
+// aren't listed, as they serve another log's tree heads.
+func LogListFromConfig(cfgs []LogConfig, operator, baseURL string, defaultMMD time.Duration) (*LogList, error) {
+	if len(operator) == 0 {
+		return nil, errors.New("no operator given")
+	}
+	host := baseURL
+	for _, scheme := range []string{"https://", "http://"} {
+		host = strings.TrimPrefix(host, scheme)
+	}
+	host = strings.TrimRight(host, "/")
+	if len(host) == 0 {
+		return nil, errors.New("no base URL given")
+	}
+
+	list := &LogList{Operators: []LogListOperator{{Name: operator, ID: 0}}, Logs: []LogListEntry{}}
+	for _, cfg := range cfgs {
+		if len(cfg.ReplicaSourceURI) > 0 {
+			continue
+		}
+		entry, err := cfg.logListEntry(operator, host, defaultMMD)
+		if err != nil {
+			return nil, fmt.Errorf("log %s{%d}: %v", cfg.Prefix, cfg.LogID, err)
+		}
+		list.Logs = append(list.Logs, *entry)
+	}
+	return list, nil
+}
+
+func (cfg LogConfig) logListEntry(operator, host string, defaultMMD time.Duration) (*LogListEntry, error) {
+	if len(cfg.PubKeyPEMFile) == 0 {
+		return nil, errors.New("need PubKeyPEMFile")
+	}
+	pubData, err := ioutil.ReadFile(cfg.PubKeyPEMFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load public key file: %v", err)
+	}
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPublicKey(string(pubData)); err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	key, err := km.GetRawPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	mmd := defaultMMD
+	if len(cfg.MaxMergeDelay) > 0 {
+		if mmd, err = time.ParseDuration(cfg.MaxMergeDelay); err != nil {
+			return nil, fmt.Errorf("invalid MaxMergeDelay: %v", err)
+		}
+	}
+	if mmd <= 0 {
+		return nil, fmt.Errorf("MMD must be positive, got %v", mmd)
+	}
+	window, err := parseNotAfterWindow(cfg.NotAfterStart, cfg.NotAfterLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.Trim(cfg.Prefix, "/")
+	entry := &LogListEntry{
+		Description:       cfg.Description,
+		Key:               key,
+		URL:               host + "/",
+		MaximumMergeDelay: int64(mmd / time.Second),
+		OperatedBy:        []int{0},
+	}
+	if len(prefix) > 0 {
+		entry.URL += prefix + "/"
+	}
+	if len(entry.Description) == 0 {
+		entry.Description = fmt.Sprintf("%s '%s' log", operator, prefix)
+	}
+	if window.start != nil || window.limit != nil {
+		entry.TemporalInterval = &TemporalInterval{StartInclusive: cfg.NotAfterStart, EndExclusive: cfg.NotAfterLimit}
+	}
+	return entry, nil
+}
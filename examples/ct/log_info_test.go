@@ -0,0 +1,136 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/examples/ct/testonly"
+)
+
+func TestGetLogInfo(t *testing.T) {
+	info := setupTest(t, []string{testonly.FakeCACertPEM})
+	defer info.mockCtrl.Finish()
+	window, err := parseNotAfterWindow("2017-01-01T00:00:00Z", "")
+	if err != nil {
+		t.Fatalf("parseNotAfterWindow()=_,%v", err)
+	}
+	info.c.description = "Test log"
+	info.c.mergeDelay = 24 * time.Hour
+	info.c.notAfter = window
+
+	handler := appHandler{context: info.c, handler: getLogInfo, name: "GetLogInfo", method: http.MethodGet}
+	req, err := http.NewRequest("GET", "http://example.com/ct/v1/get-log-info", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("GetLogInfo()=%d (body:%v), want %d", got, w.Body, want)
+	}
+	var got LogInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to unmarshal json response: %s", w.Body.Bytes())
+	}
+	logID := sha256.Sum256([]byte("key"))
+	want := LogInfo{
+		Description:       "Test log",
+		LogID:             logID[:],
+		Key:               []byte("key"),
+		MaximumMergeDelay: 86400,
+		RootsFingerprint:  fmt.Sprintf("%x", info.roots.Fingerprint()),
+		NotAfterStart:     "2017-01-01T00:00:00Z",
+	}
+	if gotJSON, wantJSON := fmt.Sprintf("%+v", got), fmt.Sprintf("%+v", want); gotJSON != wantJSON {
+		t.Errorf("GetLogInfo()=%s, want %s", gotJSON, wantJSON)
+	}
+}
+
+func TestLogListFromConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_list")
+	if err != nil {
+		t.Fatalf("TempDir()=%v", err)
+	}
+	defer os.RemoveAll(dir)
+	pubKeyFile := filepath.Join(dir, "pubkey.pem")
+	if err := ioutil.WriteFile(pubKeyFile, []byte(testonly.CTLogPublicKeyPEM), 0644); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPublicKey(testonly.CTLogPublicKeyPEM); err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	key, err := km.GetRawPublicKey()
+	if err != nil {
+		t.Fatalf("GetRawPublicKey()=_,%v", err)
+	}
+
+	var tests = []struct {
+		descr   string
+		cfgs    []LogConfig
+		baseURL string
+		want    []LogListEntry
+		wantErr bool
+	}{
+		{
+			descr:   "defaults",
+			cfgs:    []LogConfig{{Prefix: "logs/test", PubKeyPEMFile: pubKeyFile}},
+			baseURL: "https://ct.example.com/",
+			want:    []LogListEntry{{Description: "Example 'logs/test' log", Key: key, URL: "ct.example.com/logs/test/", MaximumMergeDelay: 86400, OperatedBy: []int{0}}},
+		},
+		{
+			descr: "configured",
+			cfgs: []LogConfig{
+				{Prefix: "shard2017", PubKeyPEMFile: pubKeyFile, Description: "Shard 2017", MaxMergeDelay: "1h", NotAfterStart: "2017-01-01T00:00:00Z", NotAfterLimit: "2018-01-01T00:00:00Z"},
+				{Prefix: "replica", ReplicaSourceURI: "https://ct.example.com/shard2017"},
+			},
+			baseURL: "ct.example.com",
+			want: []LogListEntry{{
+				Description:       "Shard 2017",
+				Key:               key,
+				URL:               "ct.example.com/shard2017/",
+				MaximumMergeDelay: 3600,
+				OperatedBy:        []int{0},
+				TemporalInterval:  &TemporalInterval{StartInclusive: "2017-01-01T00:00:00Z", EndExclusive: "2018-01-01T00:00:00Z"},
+			}},
+		},
+		{descr: "no-base-url", cfgs: []LogConfig{{Prefix: "test", PubKeyPEMFile: pubKeyFile}}, baseURL: "https://", wantErr: true},
+		{descr: "no-key", cfgs: []LogConfig{{Prefix: "test"}}, baseURL: "ct.example.com", wantErr: true},
+		{descr: "missing-key", cfgs: []LogConfig{{Prefix: "test", PubKeyPEMFile: filepath.Join(dir, "missing.pem")}}, baseURL: "ct.example.com", wantErr: true},
+		{descr: "bad-mmd", cfgs: []LogConfig{{Prefix: "test", PubKeyPEMFile: pubKeyFile, MaxMergeDelay: "1 day"}}, baseURL: "ct.example.com", wantErr: true},
+		{descr: "bad-window", cfgs: []LogConfig{{Prefix: "test", PubKeyPEMFile: pubKeyFile, NotAfterStart: "2017"}}, baseURL: "ct.example.com", wantErr: true},
+	}
+	for _, test := range tests {
+		list, err := LogListFromConfig(test.cfgs, "Example", test.baseURL, 24*time.Hour)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: LogListFromConfig()=_,%v, want error: %v", test.descr, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		gotJSON, err := json.Marshal(list.Logs)
+		if err != nil {
+			t.Fatalf("%s: failed to marshal logs: %v", test.descr, err)
+		}
+		wantJSON, err := json.Marshal(test.want)
+		if err != nil {
+			t.Fatalf("%s: failed to marshal logs: %v", test.descr, err)
+		}
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s: LogListFromConfig() logs=%s, want %s", test.descr, gotJSON, wantJSON)
+		}
+		if got, want := len(list.Operators), 1; got != want || list.Operators[0].Name != "Example" {
+			t.Errorf("%s: LogListFromConfig() operators=%+v, want just Example", test.descr, list.Operators)
+		}
+	}
+}
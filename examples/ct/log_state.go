@@ -0,0 +1,133 @@
+package ct
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// The states a log can be in, as named in LogConfig.State and the admin API.
+const (
+	// LogStateActive logs accept submissions.
+	LogStateActive = "ACTIVE"
+	// LogStateFrozen logs are read-only: they keep serving tree heads, entries and
+	// proofs, but reject submissions. This lets a log be retired gradually.
+	LogStateFrozen = "FROZEN"
+)
+
+// ErrorResponse is the JSON body of errors that clients are expected to handle, rather
+// than just report.
+type ErrorResponse struct {
+	// Error is a short, fixed, name for the error.
+	Error string `json:"error"`
+	// Message describes the error for people.
+	Message string `json:"message"`
+}
+
+// jsonError is an error that's returned to clients as an ErrorResponse.
+type jsonError struct {
+	rsp ErrorResponse
+}
+
+func (e jsonError) Error() string {
+	return fmt.Sprintf("%s: %s", e.rsp.Error, e.rsp.Message)
+}
+
+// errLogFrozen is returned to submitters while the log is frozen.
+var errLogFrozen = jsonError{ErrorResponse{Error: "log_frozen", Message: "log is frozen and no longer accepts submissions"}}
+
+// sendJSONError writes err to w as an ErrorResponse.
+func sendJSONError(w http.ResponseWriter, statusCode int, err jsonError) {
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(err.rsp); err != nil {
+		glog.Warningf("Failed to write error response: %v", err)
+	}
+}
+
+// parseLogState returns the canonical name of a log state, which is LogStateActive if
+// s is empty.
+func parseLogState(s string) (string, error) {
+	switch state := strings.ToUpper(s); state {
+	case "":
+		return LogStateActive, nil
+	case LogStateActive, LogStateFrozen:
+		return state, nil
+	}
+	return "", fmt.Errorf("unknown log state %q, want %s or %s", s, LogStateActive, LogStateFrozen)
+}
+
+// logState holds the state of a log, which can be changed while it's running.
+type logState struct {
+	// frozen is exported as a statistic so that monitoring knows not to alert on the
+	// log's lack of submissions
+	frozen *expvar.Int
+
+	mu    sync.Mutex
+	state string
+}
+
+func newLogState() *logState {
+	return &logState{frozen: new(expvar.Int), state: LogStateActive}
+}
+
+// get returns the current state.
+func (s *logState) get() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// set changes the state, which must be one returned by parseLogState. It returns the
+// previous state.
+func (s *logState) set(state string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.state
+	s.state = state
+	if state == LogStateFrozen {
+		s.frozen.Set(1)
+	} else {
+		s.frozen.Set(0)
+	}
+	return prev
+}
+
+// isFrozen returns true if the log isn't accepting submissions.
+func (s *logState) isFrozen() bool {
+	return s.get() == LogStateFrozen
+}
+
+// AdminLogState is the body of admin get-state responses and set-state requests.
+type AdminLogState struct {
+	// State is LogStateActive or LogStateFrozen.
+	State string `json:"state"`
+}
+
+func adminGetState(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	return writeJSON(w, AdminLogState{State: c.state.get()})
+}
+
+func adminSetState(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	var req AdminLogState
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to parse request: %v", err)
+	}
+	if len(req.State) == 0 {
+		return http.StatusBadRequest, fmt.Errorf("missing state")
+	}
+	state, err := parseLogState(req.State)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if prev := c.state.set(state); prev != state {
+		glog.Warningf("%s: admin changed log state from %s to %s", c.logPrefix, prev, state)
+	}
+	return writeJSON(w, AdminLogState{State: state})
+}
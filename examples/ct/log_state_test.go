@@ -0,0 +1,115 @@
+package ct
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/examples/ct/testonly"
+)
+
+func TestParseLogState(t *testing.T) {
+	var tests = []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "", want: LogStateActive},
+		{in: "ACTIVE", want: LogStateActive},
+		{in: "frozen", want: LogStateFrozen},
+		{in: "RETIRED", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseLogState(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseLogState(%q)=%q, want error", test.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseLogState(%q)=_,%v, want no error", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseLogState(%q)=%q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestFrozenLogRejectsSubmissions(t *testing.T) {
+	info := setupTest(t, []string{testonly.FakeCACertPEM})
+	defer info.mockCtrl.Finish()
+	info.c.state.set(LogStateFrozen)
+
+	pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+	for _, makeRequest := range []func() *httptest.ResponseRecorder{
+		func() *httptest.ResponseRecorder { return makeAddChainRequest(t, info.c, createJSONChain(t, *pool)) },
+		func() *httptest.ResponseRecorder { return makeAddPrechainRequest(t, info.c, createJSONChain(t, *pool)) },
+	} {
+		recorder := makeRequest()
+		if got, want := recorder.Code, http.StatusForbidden; got != want {
+			t.Errorf("add-chain to frozen log=%d (body:%v), want %d", got, recorder.Body, want)
+			continue
+		}
+		if got, want := recorder.Header().Get(contentTypeHeader), contentTypeJSON; got != want {
+			t.Errorf("add-chain to frozen log Content-Type=%q, want %q", got, want)
+		}
+		var rsp ErrorResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&rsp); err != nil {
+			t.Fatalf("json.Decode()=%v, want nil", err)
+		}
+		if got, want := rsp.Error, "log_frozen"; got != want {
+			t.Errorf("add-chain to frozen log error=%q, want %q", got, want)
+		}
+	}
+	if got, want := info.c.state.frozen.Value(), int64(1); got != want {
+		t.Errorf("frozen=%d, want %d", got, want)
+	}
+}
+
+func TestAdminSetState(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	v, err := newRequestVerifier([]RequestSigningKey{{ID: "hmac", Algorithm: SigningAlgorithmHMACSHA256, Key: base64.StdEncoding.EncodeToString(testHMACSecret)}}, time.Minute, fakeTimeSource)
+	if err != nil {
+		t.Fatalf("newRequestVerifier()=_,%v, want no error", err)
+	}
+	info.c.requestVerifier = v
+	mux := http.NewServeMux()
+	info.c.RegisterAdminHandlers(mux, "/log")
+
+	var tests = []struct {
+		body       string
+		wantStatus int
+		wantState  string
+	}{
+		{body: `{"state":"FROZEN"}`, wantStatus: http.StatusOK, wantState: LogStateFrozen},
+		{body: `{"state":"RETIRED"}`, wantStatus: http.StatusBadRequest, wantState: LogStateFrozen},
+		{body: `{}`, wantStatus: http.StatusBadRequest, wantState: LogStateFrozen},
+		{body: `{"state":"active"}`, wantStatus: http.StatusOK, wantState: LogStateActive},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", "http://example.com/log"+AdminSetStatePath, bytes.NewReader([]byte(test.body)))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if err := SignRequestHMAC(req, "hmac", testHMACSecret, fakeTime); err != nil {
+			t.Fatalf("SignRequestHMAC()=%v, want no error", err)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if got, want := w.Code, test.wantStatus; got != want {
+			t.Errorf("AdminSetState(%s)=%d (body:%v), want %d", test.body, got, w.Body, want)
+		}
+		if got, want := info.c.state.get(), test.wantState; got != want {
+			t.Errorf("AdminSetState(%s) left state %s, want %s", test.body, got, want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+const (
+	// The fraction of the MMD a submission can wait to be merged before it's alerted on,
+	// if the config doesn't say
+	defaultMergeDelayAlertFraction = 0.75
+	// The most submissions a frontend tracks at once. Submissions beyond this aren't
+	// tracked, but are counted.
+	maxTrackedSubmissions = 100000
+	// The most new entries scanned in each check, so that a check after a large backlog
+	// has been merged doesn't take too long. The rest are scanned by later checks.
+	maxMergeDelayScan = 100 * maxGetEntriesAllowed
+)
+
+// pendingSubmission is a submission that hasn't been seen in the log yet.
+type pendingSubmission struct {
+	sctTime time.Time
+	alerted bool
+	missed  bool
+}
+
+// mergeDelayTracker checks that the submissions a frontend has issued SCTs for are merged
+// into the log within its maximum merge delay. Each submission is tracked from its SCT
+// timestamp until its entry first appears in get-entries, which is looked for in the
+// background. The merge delay of an entry is measured to the timestamp of the tree head
+// it was first seen under, so it's an upper bound. The current merge delay, which is how
+// long the oldest tracked submission has been waiting, and the largest merge delay seen
+// are exported, and submissions waiting longer than a fraction of the MMD are logged.
+//
+// Only the submissions made through this frontend are tracked, and they're forgotten
+// when it restarts.
+type mergeDelayTracker struct {
+	c          LogContext
+	mmd        time.Duration
+	alertAfter time.Duration
+	done       chan struct{}
+
+	// mu guards pending and checked, the tree size that's been scanned for submissions,
+	// which is -1 until the first check.
+	mu      sync.Mutex
+	pending map[[sha256.Size]byte]*pendingSubmission
+	checked int64
+
+	exp struct {
+		vars           *expvar.Map
+		pending        *expvar.Int
+		merged         *expvar.Int
+		untracked      *expvar.Int
+		currentDelayMs *expvar.Int
+		maxDelayMs     *expvar.Int
+		alerts         *expvar.Int
+		mmdMissed      *expvar.Int
+		failures       *expvar.Int
+	}
+}
+
+// newMergeDelayTracker creates a mergeDelayTracker for the log c, whose maximum merge
+// delay is mmd. Submissions waiting for more than alertFraction of it are alerted on.
+func newMergeDelayTracker(c LogContext, mmd time.Duration, alertFraction float64) *mergeDelayTracker {
+	m := &mergeDelayTracker{
+		c:          c,
+		mmd:        mmd,
+		alertAfter: time.Duration(float64(mmd) * alertFraction),
+		done:       make(chan struct{}),
+		pending:    make(map[[sha256.Size]byte]*pendingSubmission),
+		checked:    -1,
+	}
+	m.exp.vars = new(expvar.Map).Init()
+	m.exp.pending = new(expvar.Int)
+	m.exp.vars.Set("pending", m.exp.pending)
+	m.exp.merged = new(expvar.Int)
+	m.exp.vars.Set("merged", m.exp.merged)
+	m.exp.untracked = new(expvar.Int)
+	m.exp.vars.Set("untracked", m.exp.untracked)
+	m.exp.currentDelayMs = new(expvar.Int)
+	m.exp.vars.Set("current-merge-delay-ms", m.exp.currentDelayMs)
+	m.exp.maxDelayMs = new(expvar.Int)
+	m.exp.vars.Set("max-merge-delay-ms", m.exp.maxDelayMs)
+	m.exp.alerts = new(expvar.Int)
+	m.exp.vars.Set("alerts", m.exp.alerts)
+	m.exp.mmdMissed = new(expvar.Int)
+	m.exp.vars.Set("mmd-missed", m.exp.mmdMissed)
+	m.exp.failures = new(expvar.Int)
+	m.exp.vars.Set("check-failures", m.exp.failures)
+	mmdMs := new(expvar.Int)
+	mmdMs.Set(int64(mmd / time.Millisecond))
+	m.exp.vars.Set("mmd-ms", mmdMs)
+	return m
+}
+
+// Start starts a goroutine that looks for merged submissions straight away, and then
+// every interval until Stop is called. Submissions aren't tracked until the first look
+// has found the log's size.
+func (m *mergeDelayTracker) Start(interval time.Duration) {
+	go func() {
+		m.checkAndLog()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+				m.checkAndLog()
+			}
+		}
+	}()
+}
+
+func (m *mergeDelayTracker) checkAndLog() {
+	if err := m.check(); err != nil {
+		m.exp.failures.Add(1)
+		glog.Warningf("%s: failed to check merge delay: %v", m.c.logPrefix, err)
+	}
+}
+
+// Stop stops looking for merged submissions.
+func (m *mergeDelayTracker) Stop() {
+	close(m.done)
+}
+
+// Vars returns the statistics exported by this mergeDelayTracker.
+func (m *mergeDelayTracker) Vars() *expvar.Map {
+	return m.exp.vars
+}
+
+// track starts tracking the submission whose leaf data hashes to leafHash. It must be
+// called before the leaf is queued, so that a check can't miss the entry being merged.
+func (m *mergeDelayTracker) track(leafHash []byte, sctTime time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.checked < 0 || len(m.pending) >= maxTrackedSubmissions {
+		m.exp.untracked.Add(1)
+		return
+	}
+	var key [sha256.Size]byte
+	copy(key[:], leafHash)
+	m.pending[key] = &pendingSubmission{sctTime: sctTime}
+	m.exp.pending.Set(int64(len(m.pending)))
+}
+
+// untrack stops tracking a submission that wasn't queued after all, or was a duplicate.
+func (m *mergeDelayTracker) untrack(leafHash []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var key [sha256.Size]byte
+	copy(key[:], leafHash)
+	delete(m.pending, key)
+	m.exp.pending.Set(int64(len(m.pending)))
+}
+
+// check looks for tracked submissions in the entries added to the log since the last
+// check, and alerts on those that have been waiting too long. The lock isn't held while
+// the backend is asked for entries, so submissions aren't held up. Only one check may
+// run at once.
+func (m *mergeDelayTracker) check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.c.rpcDeadline)
+	defer cancel()
+	slr, err := getLatestLogRoot(ctx, m.c, "MergeDelay")
+	if err != nil {
+		return err
+	}
+	sthTime := time.Unix(0, slr.TimestampNanos)
+
+	// Submissions tracked from now on are queued after this tree head, so if there are
+	// none yet its entries needn't be scanned.
+	m.mu.Lock()
+	if len(m.pending) == 0 || m.checked < 0 {
+		m.checked = slr.TreeSize
+	}
+	next := m.checked
+	m.mu.Unlock()
+
+	end := slr.TreeSize
+	if end > next+maxMergeDelayScan {
+		end = next + maxMergeDelayScan
+	}
+	for next < end {
+		last := next + maxGetEntriesAllowed - 1
+		if last >= end {
+			last = end - 1
+		}
+		entries, err := fetchEntries(ctx, m.c, next, last)
+		if err != nil {
+			return err
+		}
+
+		m.mu.Lock()
+		for _, entry := range entries.Entries {
+			key := sha256.Sum256(entry.LeafInput)
+			if p, ok := m.pending[key]; ok {
+				m.recordMerged(p, sthTime)
+				delete(m.pending, key)
+			}
+		}
+		next = last + 1
+		m.checked = next
+		remaining := len(m.pending)
+		m.mu.Unlock()
+		if remaining == 0 {
+			break
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.pending) == 0 {
+		m.checked = slr.TreeSize
+	}
+	m.exp.pending.Set(int64(len(m.pending)))
+	m.alertPending(m.c.timeSource.Now())
+	return nil
+}
+
+// recordMerged records the merge delay of a submission seen under a tree head issued at
+// sthTime.
+func (m *mergeDelayTracker) recordMerged(p *pendingSubmission, sthTime time.Time) {
+	m.exp.merged.Add(1)
+	delay := sthTime.Sub(p.sctTime)
+	if ms := int64(delay / time.Millisecond); ms > m.exp.maxDelayMs.Value() {
+		m.exp.maxDelayMs.Set(ms)
+	}
+	if delay > m.mmd && !p.missed {
+		m.exp.mmdMissed.Add(1)
+		glog.Errorf("%s: submission with SCT timestamp %v merged after %v, over the MMD of %v", m.c.logPrefix, p.sctTime, delay, m.mmd)
+	}
+}
+
+// alertPending updates the current merge delay, and logs the submissions that have
+// waited too long to be merged since the last check.
+func (m *mergeDelayTracker) alertPending(now time.Time) {
+	var oldest time.Time
+	alerts, missed := 0, 0
+	for _, p := range m.pending {
+		if oldest.IsZero() || p.sctTime.Before(oldest) {
+			oldest = p.sctTime
+		}
+		waited := now.Sub(p.sctTime)
+		if waited >= m.alertAfter && !p.alerted {
+			p.alerted = true
+			alerts++
+		}
+		if waited > m.mmd && !p.missed {
+			p.missed = true
+			missed++
+		}
+	}
+
+	var current time.Duration
+	if !oldest.IsZero() {
+		current = now.Sub(oldest)
+	}
+	m.exp.currentDelayMs.Set(int64(current / time.Millisecond))
+	if alerts > 0 {
+		m.exp.alerts.Add(int64(alerts))
+		glog.Warningf("%s: %d more submissions not merged after %v, the oldest has waited %v of the MMD of %v", m.c.logPrefix, alerts, m.alertAfter, current, m.mmd)
+	}
+	if missed > 0 {
+		m.exp.mmdMissed.Add(int64(missed))
+		glog.Errorf("%s: %d more submissions not merged within the MMD of %v, the oldest has waited %v", m.c.logPrefix, missed, m.mmd, current)
+	}
+}
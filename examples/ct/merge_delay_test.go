@@ -0,0 +1,187 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/examples/ct/testonly"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// fakeMergeBackend serves a tree of size leaves, each with the value "leaf <index>",
+// under a tree head issued at sthTime.
+type fakeMergeBackend struct {
+	trillian.TrillianLogClient
+	size    int64
+	sthTime time.Time
+	fail    bool
+}
+
+func (f *fakeMergeBackend) GetLatestSignedLogRoot(ctx context.Context, req *trillian.GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*trillian.GetLatestSignedLogRootResponse, error) {
+	return makeGetRootResponseForTest(f.sthTime.UnixNano(), f.size, make([]byte, sha256.Size)), nil
+}
+
+func (f *fakeMergeBackend) GetLeavesByIndex(ctx context.Context, req *trillian.GetLeavesByIndexRequest, opts ...grpc.CallOption) (*trillian.GetLeavesByIndexResponse, error) {
+	if f.fail {
+		return nil, errors.New("backend down")
+	}
+	rsp := &trillian.GetLeavesByIndexResponse{Status: okStatus}
+	for _, index := range req.LeafIndex {
+		if index < f.size {
+			rsp.Leaves = append(rsp.Leaves, &trillian.LogLeaf{LeafIndex: index, LeafValue: mergeTestLeaf(index), ExtraData: []byte("extra")})
+		}
+	}
+	return rsp, nil
+}
+
+func mergeTestLeaf(index int64) []byte {
+	return []byte(fmt.Sprintf("leaf %d", index))
+}
+
+func mergeTestLeafHash(index int64) []byte {
+	hash := sha256.Sum256(mergeTestLeaf(index))
+	return hash[:]
+}
+
+func TestMergeDelayTracker(t *testing.T) {
+	start := time.Date(2016, 6, 28, 13, 40, 12, 0, time.UTC)
+	clock := util.NewManualTimeSource(start)
+	backend := &fakeMergeBackend{size: 10, sthTime: start}
+	c := NewLogContext(0x42, "test", NewPEMCertPool(), backend, nil, time.Second, clock)
+	m := newMergeDelayTracker(*c, time.Hour, 0.5)
+
+	// Nothing is tracked until the log's size is known.
+	m.track(mergeTestLeafHash(9), start)
+	if err := m.check(); err != nil {
+		t.Fatalf("check()=%v, want no error", err)
+	}
+
+	m.track(mergeTestLeafHash(10), start)
+	m.track(mergeTestLeafHash(11), start)
+	m.track(mergeTestLeafHash(12), start)
+	m.untrack(mergeTestLeafHash(12))
+
+	var steps = []struct {
+		desc        string
+		now         time.Duration
+		size        int64
+		sthTime     time.Duration
+		wantPending int64
+		wantMerged  int64
+		wantCurrent time.Duration
+		wantMax     time.Duration
+		wantAlerts  int64
+		wantMissed  int64
+	}{
+		{desc: "first merged", now: 10 * time.Minute, size: 11, sthTime: 10 * time.Minute, wantPending: 1, wantMerged: 1, wantCurrent: 10 * time.Minute, wantMax: 10 * time.Minute},
+		{desc: "nothing merged", now: 20 * time.Minute, size: 11, sthTime: 20 * time.Minute, wantPending: 1, wantMerged: 1, wantCurrent: 20 * time.Minute, wantMax: 10 * time.Minute},
+		{desc: "approaching MMD", now: 40 * time.Minute, size: 11, sthTime: 40 * time.Minute, wantPending: 1, wantMerged: 1, wantCurrent: 40 * time.Minute, wantMax: 10 * time.Minute, wantAlerts: 1},
+		{desc: "still approaching MMD", now: 50 * time.Minute, size: 11, sthTime: 50 * time.Minute, wantPending: 1, wantMerged: 1, wantCurrent: 50 * time.Minute, wantMax: 10 * time.Minute, wantAlerts: 1},
+		{desc: "MMD missed", now: 70 * time.Minute, size: 11, sthTime: 70 * time.Minute, wantPending: 1, wantMerged: 1, wantCurrent: 70 * time.Minute, wantMax: 10 * time.Minute, wantAlerts: 1, wantMissed: 1},
+		{desc: "merged late", now: 80 * time.Minute, size: 13, sthTime: 75 * time.Minute, wantPending: 0, wantMerged: 2, wantCurrent: 0, wantMax: 75 * time.Minute, wantAlerts: 1, wantMissed: 1},
+	}
+	for _, step := range steps {
+		clock.Set(start.Add(step.now))
+		backend.size = step.size
+		backend.sthTime = start.Add(step.sthTime)
+		if err := m.check(); err != nil {
+			t.Fatalf("%s: check()=%v, want no error", step.desc, err)
+		}
+		for _, v := range []struct {
+			name string
+			got  int64
+			want int64
+		}{
+			{"pending", m.exp.pending.Value(), step.wantPending},
+			{"merged", m.exp.merged.Value(), step.wantMerged},
+			{"current-merge-delay-ms", m.exp.currentDelayMs.Value(), int64(step.wantCurrent / time.Millisecond)},
+			{"max-merge-delay-ms", m.exp.maxDelayMs.Value(), int64(step.wantMax / time.Millisecond)},
+			{"alerts", m.exp.alerts.Value(), step.wantAlerts},
+			{"mmd-missed", m.exp.mmdMissed.Value(), step.wantMissed},
+			{"untracked", m.exp.untracked.Value(), 1},
+		} {
+			if v.got != v.want {
+				t.Errorf("%s: %s=%d, want %d", step.desc, v.name, v.got, v.want)
+			}
+		}
+	}
+
+	// A submission merged in a tree head that's only seen after a failed check is still
+	// found, as the entries are scanned again.
+	m.track(mergeTestLeafHash(13), start.Add(80*time.Minute))
+	backend.size = 14
+	backend.fail = true
+	if err := m.check(); err == nil {
+		t.Errorf("check()=nil with backend failing, want error")
+	}
+	backend.fail = false
+	if err := m.check(); err != nil {
+		t.Fatalf("check()=%v, want no error", err)
+	}
+	if got, want := m.exp.merged.Value(), int64(3); got != want {
+		t.Errorf("merged=%d after retry, want %d", got, want)
+	}
+}
+
+func TestAddChainTracksMergeDelay(t *testing.T) {
+	pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+	certs := pool.RawCertificates()
+
+	var tests = []struct {
+		desc        string
+		rsp         *trillian.QueueLeavesResponse
+		err         error
+		duplicate   bool
+		wantPending int64
+	}{
+		{desc: "queued", rsp: &trillian.QueueLeavesResponse{Status: okStatus}, wantPending: 1},
+		{desc: "duplicate", duplicate: true, wantPending: 0},
+		{desc: "backend error", err: errors.New("backend down"), wantPending: 0},
+		{desc: "bad status", rsp: &trillian.QueueLeavesResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_ERROR}}, wantPending: 0},
+	}
+
+	for _, test := range tests {
+		info := setupTest(t, []string{testonly.FakeCACertPEM})
+		info.expectSignAny()
+		info.c.mergeTracker = newMergeDelayTracker(info.c, time.Hour, 0.5)
+		info.c.mergeTracker.checked = 0
+
+		merkleLeaf, _, err := signV1SCTForCertificate(info.km, certs[0], nil, fakeTime)
+		if err != nil {
+			t.Fatalf("Unexpected error signing SCT: %v", err)
+		}
+		leaves := logLeavesForCert(t, info.km, certs, merkleLeaf, false)
+		rsp := test.rsp
+		if test.duplicate {
+			existingLeaf, _, err := signV1SCTForCertificate(info.km, certs[0], nil, fakeTime.Add(-time.Hour))
+			if err != nil {
+				t.Fatalf("Unexpected error signing SCT: %v", err)
+			}
+			existing := logLeavesForCert(t, info.km, certs, existingLeaf, false)[0]
+			rsp = &trillian.QueueLeavesResponse{Status: okStatus, QueuedLeaves: []*trillian.QueuedLogLeaf{{Leaf: existing, Duplicate: true}}}
+		}
+		info.client.EXPECT().QueueLeaves(deadlineMatcher(), &trillian.QueueLeavesRequest{LogId: 0x42, Leaves: leaves}).Return(rsp, test.err)
+
+		makeAddChainRequest(t, info.c, createJSONChain(t, *pool))
+		info.mockCtrl.Finish()
+		if got, want := info.c.mergeTracker.exp.pending.Value(), test.wantPending; got != want {
+			t.Errorf("addChain(%s): pending=%d, want %d", test.desc, got, want)
+		}
+		if test.wantPending > 0 {
+			var key [sha256.Size]byte
+			copy(key[:], leaves[0].LeafValueHash)
+			p, ok := info.c.mergeTracker.pending[key]
+			if !ok {
+				t.Errorf("addChain(%s): submission not tracked by its leaf hash", test.desc)
+			} else if got, want := p.sctTime, fakeTime.Truncate(time.Millisecond); !got.Equal(want) {
+				t.Errorf("addChain(%s): tracked SCT time %v, want %v", test.desc, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package ct
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/monitoring"
+	"golang.org/x/net/context"
+)
+
+// EndpointHandler handles a request to one of a log's endpoints. It returns the HTTP
+// status of the response and, if the request failed, an error that's sent to the client
+// instead of a response.
+type EndpointHandler func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error)
+
+// Endpoint describes the endpoint a Middleware is applied to.
+type Endpoint struct {
+	// Name is the name of the endpoint in statistics, e.g. "GetSTH".
+	Name string
+	// Method is the HTTP method the endpoint accepts.
+	Method string
+	// Privileged endpoints, such as the admin API, only accept signed requests.
+	Privileged bool
+}
+
+// Middleware adds cross-cutting behavior, such as logging, metrics or rate limiting, to
+// the requests for an endpoint by wrapping the endpoint's handler. It can act before and
+// after calling next, pass next a different context, response writer or request, or fail
+// the request by returning an error without calling next.
+type Middleware func(ep Endpoint, next EndpointHandler) EndpointHandler
+
+// Names of the built-in middleware, as used in LogConfig.Middleware.
+const (
+	// AccessLogMiddleware sends a record of each request to the log's AccessLogSink.
+	AccessLogMiddleware = "access_log"
+	// MetricsMiddleware counts requests and responses in the log's statistics, and
+	// measures them against the log's SLOs.
+	MetricsMiddleware = "metrics"
+	// RecoveryMiddleware turns a panic in the rest of the chain into a 500 response.
+	RecoveryMiddleware = "recovery"
+	// RequestDumpMiddleware logs summaries of a sample of requests and their responses,
+	// while the admin API has turned it on.
+	RequestDumpMiddleware = "request_dump"
+	// CORSMiddleware adds CORS headers to responses, and answers preflight requests.
+	CORSMiddleware = "cors"
+	// MethodMiddleware rejects requests that use the wrong HTTP method.
+	MethodMiddleware = "method"
+	// ConcurrencyMiddleware fails requests with a 503 when their endpoint is already
+	// handling as many as the log's MaxConcurrentRequests allows.
+	ConcurrencyMiddleware = "concurrency"
+	// AuthMiddleware checks the signatures of requests to signed endpoints.
+	AuthMiddleware = "auth"
+	// ClientCertMiddleware checks the TLS client certificates of requests to POST
+	// endpoints, if the log has a ClientCAFile.
+	ClientCertMiddleware = "client_cert"
+	// APIKeyMiddleware checks the API keys of submissions and applies their quotas, if
+	// the log has APIKeys.
+	APIKeyMiddleware = "api_key"
+	// FormMiddleware parses the parameters of GET requests.
+	FormMiddleware = "form"
+	// ThrottleMiddleware limits the bandwidth each client uses downloading entries, if the
+	// log has an EntriesBytesPerSecond.
+	ThrottleMiddleware = "throttle"
+	// CompressionMiddleware compresses responses for clients that accept it.
+	CompressionMiddleware = "compression"
+	// ProofAuditMiddleware records a sample of the proofs served.
+	ProofAuditMiddleware = "proof_audit"
+	// DeadlineMiddleware sets the deadline for backend RPCs, and sets the status of
+	// requests that fail by running out of time or being abandoned.
+	DeadlineMiddleware = "deadline"
+)
+
+// allEndpoints is the key in LogConfig.Middleware for endpoints without a chain of their
+// own.
+const allEndpoints = "*"
+
+var builtinMiddleware = map[string]Middleware{
+	AccessLogMiddleware:   accessLogMiddleware,
+	MetricsMiddleware:     metricsMiddleware,
+	RequestDumpMiddleware: requestDumpMiddleware,
+	RecoveryMiddleware:    recoveryMiddleware,
+	CORSMiddleware:        corsMiddleware,
+	MethodMiddleware:      methodMiddleware,
+	ConcurrencyMiddleware: concurrencyMiddleware,
+	AuthMiddleware:        authMiddleware,
+	ClientCertMiddleware:  clientCertMiddleware,
+	APIKeyMiddleware:      apiKeyMiddleware,
+	FormMiddleware:        formMiddleware,
+	ThrottleMiddleware:    throttleMiddleware,
+	CompressionMiddleware: compressionMiddleware,
+	ProofAuditMiddleware:  proofAuditMiddleware,
+	DeadlineMiddleware:    deadlineMiddleware,
+}
+
+// DefaultMiddleware is the middleware chain applied to requests, outermost first, unless
+// a log configures another. Privileged endpoints always use it.
+var DefaultMiddleware = []string{
+	AccessLogMiddleware,
+	MetricsMiddleware,
+	RequestDumpMiddleware,
+	RecoveryMiddleware,
+	CORSMiddleware,
+	MethodMiddleware,
+	ConcurrencyMiddleware,
+	AuthMiddleware,
+	ClientCertMiddleware,
+	APIKeyMiddleware,
+	FormMiddleware,
+	ThrottleMiddleware,
+	CompressionMiddleware,
+	ProofAuditMiddleware,
+	DeadlineMiddleware,
+}
+
+var defaultChain = mustChain(DefaultMiddleware)
+
+func mustChain(names []string) []Middleware {
+	chain, err := middlewareChain(names, nil)
+	if err != nil {
+		panic(err)
+	}
+	return chain
+}
+
+// middlewareChain looks up the middleware named in names, which may be custom ones.
+func middlewareChain(names []string, custom map[string]Middleware) ([]Middleware, error) {
+	seen := make(map[string]bool)
+	chain := make([]Middleware, 0, len(names))
+	for _, name := range names {
+		if seen[name] {
+			return nil, fmt.Errorf("middleware %s used twice", name)
+		}
+		seen[name] = true
+		m, ok := builtinMiddleware[name]
+		if !ok {
+			if m, ok = custom[name]; !ok {
+				return nil, fmt.Errorf("unknown middleware: %s", name)
+			}
+		}
+		chain = append(chain, m)
+	}
+	return chain, nil
+}
+
+// buildMiddleware returns the middleware chains configured for a log's endpoints, keyed
+// by endpoint name, from the names of the middleware in each chain.
+func buildMiddleware(cfg map[string][]string, custom map[string]Middleware) (map[string][]Middleware, error) {
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+	for name := range custom {
+		if _, ok := builtinMiddleware[name]; ok {
+			return nil, fmt.Errorf("custom middleware %s has the name of a built-in one", name)
+		}
+	}
+	valid := map[string]bool{allEndpoints: true}
+	for _, ep := range append(Entrypoints, V2Entrypoints...) {
+		valid[ep] = true
+	}
+	chains := make(map[string][]Middleware)
+	for ep, names := range cfg {
+		if !valid[ep] {
+			return nil, fmt.Errorf("unknown entrypoint in Middleware: %s", ep)
+		}
+		chain, err := middlewareChain(names, custom)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Middleware for %s: %v", ep, err)
+		}
+		chains[ep] = chain
+	}
+	return chains, nil
+}
+
+// handlerFor returns handler wrapped in the middleware chain for ep.
+func (c LogContext) handlerFor(ep Endpoint, handler EndpointHandler) EndpointHandler {
+	chain := defaultChain
+	if !ep.Privileged {
+		if m, ok := c.middleware[ep.Name]; ok {
+			chain = m
+		} else if m, ok := c.middleware[allEndpoints]; ok {
+			chain = m
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](ep, handler)
+	}
+	return handler
+}
+
+// requestState is the state of a request shared by appHandler and the middleware.
+type requestState struct {
+	id  string
+	rec *AccessLogRecord
+	rw  *responseRecorder
+	// done are called once the response is complete, most recently added first.
+	done []func()
+}
+
+type requestStateKey struct{}
+
+func requestStateFrom(ctx context.Context) *requestState {
+	return ctx.Value(requestStateKey{}).(*requestState)
+}
+
+// onDone arranges for f to be called once the response has been written.
+func (s *requestState) onDone(f func()) {
+	s.done = append(s.done, f)
+}
+
+// handlerPanic is returned for requests whose handler panicked. The client isn't shown
+// the panic.
+type handlerPanic struct {
+	p interface{}
+}
+
+func (e handlerPanic) Error() string {
+	return fmt.Sprintf("handler panicked: %v", e.p)
+}
+
+func accessLogMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		s := requestStateFrom(ctx)
+		s.onDone(func() { c.accessLog.LogRequest(s.rec) })
+		return next(ctx, c, w, r)
+	}
+}
+
+func metricsMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		c.exp.vars.Add("http-all-reqs", 1)
+		c.exp.reqs.Add(ep.Name, 1)
+		s := requestStateFrom(ctx)
+		if h, ok := c.exp.latency.Get(ep.Name).(*monitoring.Histogram); ok {
+			s.onDone(func() { h.Observe(int64(time.Duration(s.rec.LatencyMicros) * time.Microsecond / time.Millisecond)) })
+		}
+		if c.slo != nil {
+			s.onDone(func() { c.slo.observe(ep.Name, s.rec.Status, time.Duration(s.rec.LatencyMicros)*time.Microsecond) })
+		}
+
+		status, err := next(ctx, c, w, r)
+		c.exp.allRsps.Add(strconv.Itoa(status), 1)
+		if e, ok := c.exp.rsps.Get(ep.Name).(*expvar.Map); ok {
+			e.Add(strconv.Itoa(status), 1)
+		}
+		return status, err
+	}
+}
+
+// recoveryMiddleware fails a request whose handler panics, rather than the whole server.
+func recoveryMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (status int, err error) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				// The handler deliberately aborted the response.
+				panic(p)
+			}
+			glog.Errorf("%s: %s handler panicked: %v\n%s", c.logPrefix, ep.Name, p, debug.Stack())
+			c.exp.panics.Add(ep.Name, 1)
+			status, err = http.StatusInternalServerError, handlerPanic{p}
+			if written := requestStateFrom(ctx).rw.status; written != 0 {
+				status = written
+			}
+		}()
+		return next(ctx, c, w, r)
+	}
+}
+
+func corsMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		if !ep.Privileged && c.cors != nil && c.cors.handle(w, r, ep.Method) {
+			// Preflight requests are answered without calling the handler.
+			return http.StatusNoContent, nil
+		}
+		return next(ctx, c, w, r)
+	}
+}
+
+func methodMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		if r.Method != ep.Method {
+			return http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", r.Method)
+		}
+		return next(ctx, c, w, r)
+	}
+}
+
+func authMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		if ep.Privileged || c.signedEntrypoints[ep.Name] {
+			if c.requestVerifier == nil {
+				return http.StatusUnauthorized, errors.New("request signature check failed: log has no request signing keys")
+			}
+			keyID, err := c.requestVerifier.verify(r)
+			if err != nil {
+				return http.StatusUnauthorized, fmt.Errorf("request signature check failed: %v", err)
+			}
+			requestStateFrom(ctx).rec.SigningKeyID = keyID
+		}
+		return next(ctx, c, w, r)
+	}
+}
+
+func formMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		// For GET requests all params come as form encoded so we might as well parse them
+		// now. POSTs will decode the raw request body as JSON later.
+		if r.Method == http.MethodGet {
+			if err := r.ParseForm(); err != nil {
+				return http.StatusBadRequest, fmt.Errorf("failed to parse form data: %v", err)
+			}
+		}
+		return next(ctx, c, w, r)
+	}
+}
+
+// concurrencyMiddleware holds one of the endpoint's concurrency slots while the rest of
+// the chain handles the request, if the log limits concurrency. When the endpoint has no
+// slot free, the request fails straight away with a 503 and a Retry-After header rather
+// than waiting. It comes before the middleware that does any work for the request, so
+// rejected requests are cheap.
+func concurrencyMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		if c.concurrency == nil {
+			return next(ctx, c, w, r)
+		}
+		if !c.concurrency.acquire(ep.Name) {
+			w.Header().Set(retryAfterHeader, concurrencyRetryAfter)
+			return http.StatusServiceUnavailable, fmt.Errorf("%s is handling too many requests, try again later", ep.Name)
+		}
+		defer c.concurrency.release(ep.Name)
+		return next(ctx, c, w, r)
+	}
+}
+
+// throttleMiddleware limits the bandwidth each client uses downloading entries. It comes
+// before compression in the chain, so it's the compressed bytes that are counted.
+func throttleMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		if c.entriesThrottle == nil || !throttledEntrypoints[ep.Name] {
+			return next(ctx, c, w, r)
+		}
+		tw := &throttledResponseWriter{ResponseWriter: w, ctx: ctx, t: c.entriesThrottle, client: clientIP(r)}
+		return next(ctx, c, tw, r)
+	}
+}
+
+// compressionMiddleware compresses the response if the client supports it, as some
+// responses (e.g. get-entries) are large and very compressible.
+func compressionMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		if !c.compressResponses {
+			return next(ctx, c, w, r)
+		}
+		w.Header().Add(varyHeader, acceptEncodingHeader)
+		if encoding := negotiateEncoding(r.Header.Get(acceptEncodingHeader)); encoding != "" {
+			cw := newCompressingResponseWriter(w, encoding)
+			defer cw.Close()
+			w = cw
+		}
+		return next(ctx, c, w, r)
+	}
+}
+
+// proofAuditMiddleware records sampled proofs once they've been served. The response is
+// hashed before it's compressed, so the record doesn't depend on the client's encoding.
+func proofAuditMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		if c.proofAudit == nil || !proofEntrypoints[ep.Name] {
+			return next(ctx, c, w, r)
+		}
+		audited := c.proofAudit.start(w, r)
+		if audited == nil {
+			return next(ctx, c, w, r)
+		}
+		status, err := next(ctx, c, audited, r)
+		if err == nil && status == http.StatusOK {
+			c.proofAudit.finish(c, audited, r, requestStateFrom(ctx).rec)
+		}
+		return status, err
+	}
+}
+
+// deadlineMiddleware imposes a deadline on the backend requests that many/most of the
+// handlers make. It's derived from the request context so that backend requests are
+// cancelled if the client goes away.
+func deadlineMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		deadline := getRPCDeadlineTime(c, ep.Name)
+		rpcCtx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+		rpcCtx, notice := withRetryAfterNotice(rpcCtx)
+
+		status, err := next(rpcCtx, c, w, r)
+		if err != nil && ctx.Err() == context.Canceled {
+			// The client went away, cancelling any backend requests. Don't count this as
+			// a server error; nobody will see the response.
+			status = statusClientClosedRequest
+		} else if err != nil && !c.timeSource.Now().Before(deadline) {
+			// The request used up its processing budget, so the backend work was abandoned.
+			status = http.StatusGatewayTimeout
+			err = fmt.Errorf("%s timed out after %v: %v", ep.Name, c.rpcDeadlineFor(ep.Name), err)
+		} else if retryAfter := notice.retryAfter(); err != nil && retryAfter > 0 {
+			// The backend is struggling and requests to it are being shed for a while.
+			status = http.StatusServiceUnavailable
+			w.Header().Set(retryAfterHeader, strconv.FormatInt(int64((retryAfter+time.Second-1)/time.Second), 10))
+		}
+		return status, err
+	}
+}
@@ -0,0 +1,170 @@
+package ct
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/trillian/monitoring"
+	"golang.org/x/net/context"
+)
+
+// tracingMiddleware returns a middleware that appends its name to calls before and after
+// calling the rest of the chain.
+func tracingMiddleware(name string, calls *[]string) Middleware {
+	return func(ep Endpoint, next EndpointHandler) EndpointHandler {
+		return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+			*calls = append(*calls, name+">"+ep.Name)
+			status, err := next(ctx, c, w, r)
+			*calls = append(*calls, name+"<")
+			return status, err
+		}
+	}
+}
+
+var errTooManyRequests = errors.New("too many requests")
+
+func rejectingMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusTooManyRequests, errTooManyRequests
+	}
+}
+
+func okHandler(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	w.Write([]byte("{}"))
+	return http.StatusOK, nil
+}
+
+func TestMiddlewareChains(t *testing.T) {
+	var calls []string
+	custom := map[string]Middleware{
+		"outer":  tracingMiddleware("outer", &calls),
+		"inner":  tracingMiddleware("inner", &calls),
+		"reject": rejectingMiddleware,
+	}
+	chains, err := buildMiddleware(map[string][]string{
+		"*":          {AccessLogMiddleware, "outer", MetricsMiddleware, MethodMiddleware, "inner"},
+		"GetEntries": append([]string{"reject"}, DefaultMiddleware...),
+	}, custom)
+	if err != nil {
+		t.Fatalf("buildMiddleware()=_,%v", err)
+	}
+
+	var tests = []struct {
+		descr      string
+		name       string
+		method     string
+		privileged bool
+		want       int
+		wantCalls  []string
+		wantLogged bool
+	}{
+		{descr: "all", name: "GetSTH", method: http.MethodGet, want: http.StatusOK, wantCalls: []string{"outer>GetSTH", "inner>GetSTH", "inner<", "outer<"}, wantLogged: true},
+		{descr: "method-check", name: "GetSTH", method: http.MethodPost, want: http.StatusMethodNotAllowed, wantCalls: []string{"outer>GetSTH", "outer<"}, wantLogged: true},
+		{descr: "endpoint", name: "GetEntries", method: http.MethodGet, want: http.StatusTooManyRequests},
+		{descr: "privileged", name: "AdminGetState", method: http.MethodGet, privileged: true, want: http.StatusUnauthorized, wantLogged: true},
+	}
+
+	for _, test := range tests {
+		calls = nil
+		info := setupTest(t, nil)
+		sink := &recordingAccessLog{}
+		info.c.accessLog = sink
+		info.c.middleware = chains
+		handler := appHandler{context: info.c, handler: okHandler, name: test.name, method: http.MethodGet, privileged: test.privileged}
+
+		req, err := http.NewRequest(test.method, "http://example.com/ct/v1/endpoint", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if got := w.Code; got != test.want {
+			t.Errorf("%s: ServeHTTP()=%d, want %d", test.descr, got, test.want)
+		}
+		if got := calls; !reflect.DeepEqual(got, test.wantCalls) {
+			t.Errorf("%s: middleware calls=%v, want %v", test.descr, got, test.wantCalls)
+		}
+		if got := len(sink.recs) > 0; got != test.wantLogged {
+			t.Errorf("%s: logged %d records, want logged: %v", test.descr, len(sink.recs), test.wantLogged)
+		}
+		if got, want := info.c.exp.reqs.Get(test.name) != nil, test.wantLogged; got != want {
+			t.Errorf("%s: http-reqs[%s] set: %v, want %v", test.descr, test.name, got, want)
+		}
+		if got, want := info.c.exp.latency.Get(test.name).(*monitoring.Histogram).Count() > 0, test.wantLogged; got != want {
+			t.Errorf("%s: http-latency-ms[%s] observed: %v, want %v", test.descr, test.name, got, want)
+		}
+		info.mockCtrl.Finish()
+	}
+}
+
+func TestMiddlewareCompressionOff(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	chain := []string{}
+	for _, name := range DefaultMiddleware {
+		if name != CompressionMiddleware {
+			chain = append(chain, name)
+		}
+	}
+	chains, err := buildMiddleware(map[string][]string{"GetEntries": chain}, nil)
+	if err != nil {
+		t.Fatalf("buildMiddleware()=_,%v", err)
+	}
+	info.c.middleware = chains
+	info.c.compressResponses = true
+
+	for _, test := range []struct{ name, wantEncoding string }{
+		{name: "GetEntries"},
+		{name: "GetRoots", wantEncoding: encodingGzip},
+	} {
+		handler := appHandler{context: info.c, handler: okHandler, name: test.name, method: http.MethodGet}
+		req, err := http.NewRequest("GET", "http://example.com/ct/v1/endpoint", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set(acceptEncodingHeader, encodingGzip)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got := w.Header().Get(contentEncodingHeader); got != test.wantEncoding {
+			t.Errorf("%s: Content-Encoding=%q, want %q", test.name, got, test.wantEncoding)
+		}
+	}
+}
+
+func TestBuildMiddleware(t *testing.T) {
+	custom := map[string]Middleware{"reject": rejectingMiddleware}
+	var tests = []struct {
+		descr   string
+		cfg     map[string][]string
+		custom  map[string]Middleware
+		wantErr bool
+	}{
+		{descr: "none"},
+		{descr: "builtin", cfg: map[string][]string{"*": {MetricsMiddleware, DeadlineMiddleware}}},
+		{descr: "custom", cfg: map[string][]string{"GetEntries": {"reject"}, "V2GetEntries": {}}, custom: custom},
+		{descr: "unknown-endpoint", cfg: map[string][]string{"GetEntires": {MetricsMiddleware}}, wantErr: true},
+		{descr: "unknown-middleware", cfg: map[string][]string{"*": {"reject"}}, wantErr: true},
+		{descr: "twice", cfg: map[string][]string{"*": {MetricsMiddleware, MetricsMiddleware}}, wantErr: true},
+		{descr: "shadows-builtin", cfg: map[string][]string{"*": {MetricsMiddleware}}, custom: map[string]Middleware{MetricsMiddleware: rejectingMiddleware}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		chains, err := buildMiddleware(test.cfg, test.custom)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: buildMiddleware()=_,%v, want error: %v", test.descr, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		for ep, names := range test.cfg {
+			if got, want := len(chains[ep]), len(names); got != want {
+				t.Errorf("%s: len(chains[%s])=%d, want %d", test.descr, ep, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency/go"
+	"golang.org/x/net/context"
+)
+
+const (
+	// Default number of submissions that can be waiting to be forwarded
+	defaultMirrorQueueSize = 1000
+	// Default number of submissions whose forwarding status is remembered
+	defaultMirrorMaxTracked = 10000
+	// Default number of attempts made to forward each submission
+	defaultMirrorMaxAttempts = 3
+	// Default delay before retrying a failed forwarding attempt, multiplied by the attempt number
+	defaultMirrorRetryDelay = time.Second
+	// Deadline applied to each forwarding attempt
+	defaultMirrorDeadline = 30 * time.Second
+)
+
+// ErrMirrorQueueFull is returned by Mirror.Submit when the queue of submissions waiting
+// to be forwarded is full and the submission has been dropped.
+var ErrMirrorQueueFull = errors.New("mirror queue full, submission dropped")
+
+// ErrMirrorClosed is returned by Mirror.Submit once the Mirror has been closed.
+var ErrMirrorClosed = errors.New("mirror closed, submission dropped")
+
+// ChainSubmitter is the part of a CT log client used to forward submissions, so that
+// a client.LogClient can be used as the secondary log.
+type ChainSubmitter interface {
+	AddChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error)
+	AddPreChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error)
+}
+
+// MirrorStatus records the forwarding state of a single submission.
+type MirrorStatus struct {
+	// Attempts is the number of times forwarding has been tried so far
+	Attempts int
+	// Forwarded is true once the secondary log has accepted the submission
+	Forwarded bool
+	// SCT is the SCT issued by the secondary log, if Forwarded is true
+	SCT *ct.SignedCertificateTimestamp
+	// LastError is the error from the most recent failed attempt, if any
+	LastError string
+}
+
+type mirrorEntry struct {
+	key       [sha256.Size]byte
+	chain     []ct.ASN1Cert
+	isPrecert bool
+}
+
+// Mirror asynchronously forwards accepted submissions to a secondary CT log, for operators
+// who run paired logs for redundancy. Forwarding never delays or fails the response to
+// the original submitter; the outcome for each entry is tracked and can be queried
+// with Status.
+type Mirror struct {
+	logPrefix   string
+	submitter   ChainSubmitter
+	queue       chan mirrorEntry
+	maxTracked  int
+	maxAttempts int
+	retryDelay  time.Duration
+	deadline    time.Duration
+	wg          sync.WaitGroup
+	// ctx is cancelled to abandon forwarding when Close runs out of time.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	closed bool
+	status map[[sha256.Size]byte]*MirrorStatus
+	order  [][sha256.Size]byte // in submission order, for evicting old entries
+
+	exp struct {
+		vars      *expvar.Map
+		queued    *expvar.Int
+		forwarded *expvar.Int
+		failed    *expvar.Int
+		dropped   *expvar.Int
+	}
+}
+
+// NewMirror creates a Mirror that forwards submissions using submitter. Start must be
+// called before any submissions will be forwarded.
+func NewMirror(logPrefix string, submitter ChainSubmitter) *Mirror {
+	m := &Mirror{
+		logPrefix:   logPrefix,
+		submitter:   submitter,
+		queue:       make(chan mirrorEntry, defaultMirrorQueueSize),
+		maxTracked:  defaultMirrorMaxTracked,
+		maxAttempts: defaultMirrorMaxAttempts,
+		retryDelay:  defaultMirrorRetryDelay,
+		deadline:    defaultMirrorDeadline,
+		status:      make(map[[sha256.Size]byte]*MirrorStatus),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+
+	m.exp.vars = new(expvar.Map).Init()
+	m.exp.queued = new(expvar.Int)
+	m.exp.vars.Set("queued", m.exp.queued)
+	m.exp.forwarded = new(expvar.Int)
+	m.exp.vars.Set("forwarded", m.exp.forwarded)
+	m.exp.failed = new(expvar.Int)
+	m.exp.vars.Set("failed", m.exp.failed)
+	m.exp.dropped = new(expvar.Int)
+	m.exp.vars.Set("dropped", m.exp.dropped)
+
+	return m
+}
+
+// Start starts the goroutine that forwards queued submissions.
+func (m *Mirror) Start() {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for entry := range m.queue {
+			m.forward(entry)
+		}
+	}()
+}
+
+// Close stops accepting submissions and waits for those already queued to be forwarded,
+// until ctx is done. Then forwarding is abandoned, the remaining submissions are counted as
+// failed and ctx's error is returned.
+func (m *Mirror) Close(ctx context.Context) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	close(m.queue)
+	m.mu.Unlock()
+	defer m.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		glog.Warningf("%s: mirror: abandoning queued submissions: %v", m.logPrefix, ctx.Err())
+		m.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Submit queues a chain that has been accepted by this log for forwarding to the
+// secondary log. It does not block; if the queue is full the submission is dropped
+// and ErrMirrorQueueFull is returned, and once the Mirror is closed ErrMirrorClosed is.
+func (m *Mirror) Submit(chain []ct.ASN1Cert, isPrecert bool) error {
+	if len(chain) == 0 {
+		return errors.New("mirror: empty chain")
+	}
+	entry := mirrorEntry{key: mirrorKey(chain), chain: chain, isPrecert: isPrecert}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		m.exp.dropped.Add(1)
+		return ErrMirrorClosed
+	}
+	s := m.track(entry.key)
+	select {
+	case m.queue <- entry:
+		m.exp.queued.Add(1)
+		return nil
+	default:
+		m.exp.dropped.Add(1)
+		s.LastError = ErrMirrorQueueFull.Error()
+		return ErrMirrorQueueFull
+	}
+}
+
+// Status returns the forwarding status of the submission whose first certificate is
+// cert, if it is still being tracked.
+func (m *Mirror) Status(cert ct.ASN1Cert) (MirrorStatus, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.status[sha256.Sum256(cert.Data)]
+	if !ok {
+		return MirrorStatus{}, false
+	}
+	return *s, true
+}
+
+// Vars returns the statistics exported by this Mirror.
+func (m *Mirror) Vars() *expvar.Map {
+	return m.exp.vars
+}
+
+func (m *Mirror) forward(entry mirrorEntry) {
+	for attempt := 1; attempt <= m.maxAttempts && m.ctx.Err() == nil; attempt++ {
+		ctx, cancel := context.WithTimeout(m.ctx, m.deadline)
+		var sct *ct.SignedCertificateTimestamp
+		var err error
+		if entry.isPrecert {
+			sct, err = m.submitter.AddPreChain(ctx, entry.chain)
+		} else {
+			sct, err = m.submitter.AddChain(ctx, entry.chain)
+		}
+		cancel()
+
+		m.update(entry.key, func(s *MirrorStatus) {
+			s.Attempts = attempt
+			if err != nil {
+				s.LastError = err.Error()
+				return
+			}
+			s.Forwarded = true
+			s.SCT = sct
+			s.LastError = ""
+		})
+		if err == nil {
+			glog.V(2).Infof("%s: mirror: forwarded submission %x", m.logPrefix, entry.key)
+			m.exp.forwarded.Add(1)
+			return
+		}
+
+		glog.Warningf("%s: mirror: attempt %d to forward submission %x failed: %v", m.logPrefix, attempt, entry.key, err)
+		if attempt < m.maxAttempts {
+			select {
+			case <-time.After(m.retryDelay * time.Duration(attempt)):
+			case <-m.ctx.Done():
+			}
+		}
+	}
+	if err := m.ctx.Err(); err != nil {
+		m.update(entry.key, func(s *MirrorStatus) { s.LastError = "forwarding abandoned: " + err.Error() })
+	}
+	m.exp.failed.Add(1)
+}
+
+// track starts tracking the status of the submission with the given key, evicting the
+// oldest tracked entry if necessary, and returns its status. The caller must hold m.mu.
+func (m *Mirror) track(key [sha256.Size]byte) *MirrorStatus {
+	if s, ok := m.status[key]; ok {
+		return s
+	}
+	if len(m.order) >= m.maxTracked {
+		delete(m.status, m.order[0])
+		m.order = m.order[1:]
+	}
+	s := &MirrorStatus{}
+	m.status[key] = s
+	m.order = append(m.order, key)
+	return s
+}
+
+func (m *Mirror) update(key [sha256.Size]byte, fn func(*MirrorStatus)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.status[key]; ok {
+		fn(s)
+	}
+}
+
+// mirrorKey identifies a submission by the hash of its first certificate.
+func mirrorKey(chain []ct.ASN1Cert) [sha256.Size]byte {
+	return sha256.Sum256(chain[0].Data)
+}
@@ -0,0 +1,221 @@
+package ct
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency/go"
+	"golang.org/x/net/context"
+)
+
+// fakeSubmitter fails the first failures calls then accepts everything.
+type fakeSubmitter struct {
+	mu       sync.Mutex
+	failures int
+	chains   [][]ct.ASN1Cert
+	precerts []bool
+}
+
+func (f *fakeSubmitter) add(chain []ct.ASN1Cert, isPrecert bool) (*ct.SignedCertificateTimestamp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("secondary log unavailable")
+	}
+	f.chains = append(f.chains, chain)
+	f.precerts = append(f.precerts, isPrecert)
+	return &ct.SignedCertificateTimestamp{Timestamp: uint64(len(f.chains))}, nil
+}
+
+func (f *fakeSubmitter) AddChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+	return f.add(chain, false)
+}
+
+func (f *fakeSubmitter) AddPreChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+	return f.add(chain, true)
+}
+
+func testChain(name string) []ct.ASN1Cert {
+	return []ct.ASN1Cert{{Data: []byte(name)}, {Data: []byte("issuer")}}
+}
+
+func TestMirrorForwards(t *testing.T) {
+	f := &fakeSubmitter{}
+	m := NewMirror("test", f)
+	m.Start()
+
+	if err := m.Submit(testChain("cert"), false); err != nil {
+		t.Fatalf("Submit(cert)=%v; want nil", err)
+	}
+	if err := m.Submit(testChain("precert"), true); err != nil {
+		t.Fatalf("Submit(precert)=%v; want nil", err)
+	}
+	m.Close(context.Background())
+
+	if got, want := len(f.chains), 2; got != want {
+		t.Fatalf("forwarded %d chains; want %d", got, want)
+	}
+	if f.precerts[0] || !f.precerts[1] {
+		t.Errorf("forwarded precerts=%v; want [false true]", f.precerts)
+	}
+	for _, name := range []string{"cert", "precert"} {
+		status, ok := m.Status(ct.ASN1Cert{Data: []byte(name)})
+		if !ok {
+			t.Errorf("Status(%s) not tracked", name)
+			continue
+		}
+		if !status.Forwarded || status.Attempts != 1 || status.SCT == nil || status.LastError != "" {
+			t.Errorf("Status(%s)=%+v; want forwarded at first attempt", name, status)
+		}
+	}
+	if got, want := m.exp.forwarded.String(), "2"; got != want {
+		t.Errorf("forwarded=%s; want %s", got, want)
+	}
+}
+
+func TestLogContextCloseFlushesMirror(t *testing.T) {
+	f := &fakeSubmitter{}
+	c := &LogContext{mirror: NewMirror("test", f)}
+	c.mirror.Start()
+
+	if err := c.mirror.Submit(testChain("cert"), false); err != nil {
+		t.Fatalf("Submit(cert)=%v; want nil", err)
+	}
+	c.Close(context.Background())
+
+	if got, want := len(f.chains), 1; got != want {
+		t.Errorf("forwarded %d chains after Close(); want %d", got, want)
+	}
+}
+
+func TestMirrorRetries(t *testing.T) {
+	var tests = []struct {
+		failures      int
+		wantForwarded bool
+		wantAttempts  int
+	}{
+		{failures: 1, wantForwarded: true, wantAttempts: 2},
+		{failures: 2, wantForwarded: true, wantAttempts: 3},
+		{failures: 3, wantForwarded: false, wantAttempts: 3},
+	}
+	for _, test := range tests {
+		f := &fakeSubmitter{failures: test.failures}
+		m := NewMirror("test", f)
+		m.retryDelay = 0
+		m.Start()
+		if err := m.Submit(testChain("cert"), false); err != nil {
+			t.Fatalf("Submit()=%v; want nil", err)
+		}
+		m.Close(context.Background())
+
+		status, ok := m.Status(ct.ASN1Cert{Data: []byte("cert")})
+		if !ok {
+			t.Errorf("Status(failures=%d) not tracked", test.failures)
+			continue
+		}
+		if got := status.Forwarded; got != test.wantForwarded {
+			t.Errorf("Status(failures=%d).Forwarded=%v; want %v", test.failures, got, test.wantForwarded)
+		}
+		if got := status.Attempts; got != test.wantAttempts {
+			t.Errorf("Status(failures=%d).Attempts=%d; want %d", test.failures, got, test.wantAttempts)
+		}
+		if got, want := status.LastError != "", !test.wantForwarded; got != want {
+			t.Errorf("Status(failures=%d).LastError=%q; want error: %v", test.failures, status.LastError, want)
+		}
+	}
+}
+
+func TestMirrorQueueFull(t *testing.T) {
+	f := &fakeSubmitter{}
+	m := NewMirror("test", f)
+	m.queue = make(chan mirrorEntry, 1)
+
+	// Not started, so the second submission finds the queue full.
+	if err := m.Submit(testChain("cert1"), false); err != nil {
+		t.Fatalf("Submit(cert1)=%v; want nil", err)
+	}
+	if err := m.Submit(testChain("cert2"), false); err != ErrMirrorQueueFull {
+		t.Fatalf("Submit(cert2)=%v; want %v", err, ErrMirrorQueueFull)
+	}
+	if status, ok := m.Status(ct.ASN1Cert{Data: []byte("cert2")}); !ok || status.LastError == "" {
+		t.Errorf("Status(cert2)=%+v,%v; want dropped error", status, ok)
+	}
+	if got, want := m.exp.dropped.String(), "1"; got != want {
+		t.Errorf("dropped=%s; want %s", got, want)
+	}
+
+	m.Start()
+	m.Close(context.Background())
+	if got, want := len(f.chains), 1; got != want {
+		t.Errorf("forwarded %d chains; want %d", got, want)
+	}
+}
+
+// blockingSubmitter never accepts a chain, it waits until the request is abandoned.
+type blockingSubmitter struct{}
+
+func (blockingSubmitter) AddChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingSubmitter) AddPreChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestMirrorCloseDeadline(t *testing.T) {
+	m := NewMirror("test", blockingSubmitter{})
+	m.Start()
+	for _, name := range []string{"cert1", "cert2"} {
+		if err := m.Submit(testChain(name), false); err != nil {
+			t.Fatalf("Submit(%s)=%v; want nil", name, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Close()=%v; want %v", err, context.DeadlineExceeded)
+	}
+	for _, name := range []string{"cert1", "cert2"} {
+		if status, ok := m.Status(ct.ASN1Cert{Data: []byte(name)}); !ok || status.Forwarded {
+			t.Errorf("Status(%s)=%+v,%v; want not forwarded", name, status, ok)
+		}
+	}
+	if got, want := m.exp.failed.String(), "2"; got != want {
+		t.Errorf("failed=%s; want %s", got, want)
+	}
+
+	// Handlers still running after the server stopped waiting for them can't submit.
+	if err := m.Submit(testChain("late"), false); err != ErrMirrorClosed {
+		t.Errorf("Submit(late)=%v; want %v", err, ErrMirrorClosed)
+	}
+	if err := m.Close(context.Background()); err != nil {
+		t.Errorf("Close() again=%v; want nil", err)
+	}
+}
+
+func TestMirrorTrackingBounded(t *testing.T) {
+	m := NewMirror("test", &fakeSubmitter{})
+	m.maxTracked = 2
+	for _, name := range []string{"cert1", "cert2", "cert3"} {
+		if err := m.Submit(testChain(name), false); err != nil {
+			t.Fatalf("Submit(%s)=%v; want nil", name, err)
+		}
+	}
+	if _, ok := m.Status(ct.ASN1Cert{Data: []byte("cert1")}); ok {
+		t.Error("Status(cert1) still tracked; want evicted")
+	}
+	for _, name := range []string{"cert2", "cert3"} {
+		if _, ok := m.Status(ct.ASN1Cert{Data: []byte(name)}); !ok {
+			t.Errorf("Status(%s) not tracked", name)
+		}
+	}
+	if err := m.Submit(nil, false); err == nil {
+		t.Error("Submit(nil)=nil; want error")
+	}
+}
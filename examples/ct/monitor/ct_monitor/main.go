@@ -0,0 +1,68 @@
+// The ct_monitor binary follows a CT log, checking that each tree head it publishes is
+// signed by it, consistent with those before it and matches the entries it serves. Its
+// position in the log is kept in a state file, and its statistics, including counts of
+// failed checks to alert on, are exported at /debug/vars on --metrics_addr.
+package main
+
+import (
+	"expvar"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/jsonclient"
+	"github.com/google/trillian/examples/ct/monitor"
+	"golang.org/x/net/context"
+)
+
+var logURIFlag = flag.String("log_uri", "http://localhost:6962/logs/example", "Base URI of the CT log to follow")
+var logPublicKeyFlag = flag.String("log_public_key", "", "File holding the PEM encoded public key of the log")
+var stateFileFlag = flag.String("state_file", "ct_monitor.state", "File the monitor's position in the log is kept in")
+var pollIntervalFlag = flag.Duration("poll_interval", time.Minute, "How often the log's tree head is fetched")
+var batchSizeFlag = flag.Int64("batch_size", 256, "Most entries asked for in each get-entries request")
+var maxEntriesFlag = flag.Int64("max_entries_per_pass", 100000, "Most entries fetched in each pass, so that catching up with a large log is done a piece at a time")
+var metricsAddrFlag = flag.String("metrics_addr", "localhost:6965", "Address to export statistics on, at /debug/vars. Disabled if empty")
+
+func main() {
+	flag.Parse()
+	if len(*logPublicKeyFlag) == 0 {
+		glog.Exit("--log_public_key is required")
+	}
+	pubKey, err := ioutil.ReadFile(*logPublicKeyFlag)
+	if err != nil {
+		glog.Exitf("Failed to read log public key: %v", err)
+	}
+	logClient, err := client.New(*logURIFlag, nil, jsonclient.Options{})
+	if err != nil {
+		glog.Exitf("Failed to create CT client: %v", err)
+	}
+	m, err := monitor.New(logClient, pubKey, *stateFileFlag, *batchSizeFlag, *maxEntriesFlag)
+	if err != nil {
+		glog.Exitf("Failed to create monitor: %v", err)
+	}
+	expvar.Publish("monitor", m.Vars())
+	glog.Infof("Following %s from verified tree size %d", *logURIFlag, m.State().TreeSize)
+
+	if len(*metricsAddrFlag) > 0 {
+		go func() {
+			glog.Exitf("Metrics server exited: %v", http.ListenAndServe(*metricsAddrFlag, nil))
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		glog.Infof("Got signal %v, stopping", sig)
+		cancel()
+	}()
+	m.Run(ctx, *pollIntervalFlag)
+	glog.Flush()
+}
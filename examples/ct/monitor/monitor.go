@@ -0,0 +1,333 @@
+// Package monitor follows a CT log and checks that it behaves as an append-only log: each
+// tree head it publishes must be signed by the log, be consistent with the tree heads
+// before it, and have a root that matches the entries the log serves.
+//
+// Entries are checked without fetching a proof for each: they're hashed into a compact
+// Merkle tree as they're fetched, and once the monitor has every entry up to the size of
+// a tree head the root of that tree must be the tree head's root. This proves every
+// entry fetched is included in the tree head, and that the log served nothing else.
+package monitor
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian/crypto"
+	ctfe "github.com/google/trillian/examples/ct"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+)
+
+// LogClient is the part of the CT client API used to follow a log. It's implemented by
+// the client.LogClient of the CT library.
+type LogClient interface {
+	GetSTH(ctx context.Context) (*ct.SignedTreeHead, error)
+	GetSTHConsistency(ctx context.Context, first, second uint64) ([][]byte, error)
+	GetRawEntries(ctx context.Context, start, end int64) (*ct.GetEntriesResponse, error)
+}
+
+// Monitor follows a log, checking each new tree head and the entries added under it. Its
+// position is kept in a state file, so it carries on from where it left off after a
+// restart. A Monitor must not be used concurrently.
+type Monitor struct {
+	client      LogClient
+	sigVerifier *ct.SignatureVerifier
+	logVerifier merkle.LogVerifier
+	hasher      merkle.TreeHasher
+	stateFile   string
+	// batchSize is the most entries asked for in one get-entries request, and
+	// maxEntries the most fetched in one pass, so passes don't take too long while
+	// catching up with a large log.
+	batchSize  int64
+	maxEntries int64
+
+	state State
+	// pending is the compact tree of all the entries fetched, which may be more than
+	// the verified tree head has
+	pending *merkle.CompactMerkleTree
+
+	exp struct {
+		vars                *expvar.Map
+		passes              *expvar.Int
+		fetchFailures       *expvar.Int
+		signatureFailures   *expvar.Int
+		consistencyFailures *expvar.Int
+		inclusionFailures   *expvar.Int
+		sthTreeSize         *expvar.Int
+		verifiedTreeSize    *expvar.Int
+		verifiedTimestamp   *expvar.Int
+		entriesFetched      *expvar.Int
+		lastVerified        *expvar.Int
+	}
+}
+
+// New creates a Monitor for the log with the PEM encoded public key logKeyPEM, which it
+// follows through client. Its position is read from stateFile if it exists, and is saved
+// there after each pass. Entries are fetched batchSize at a time, and at most maxEntries
+// of them in each pass.
+func New(client LogClient, logKeyPEM []byte, stateFile string, batchSize, maxEntries int64) (*Monitor, error) {
+	if batchSize <= 0 || maxEntries <= 0 {
+		return nil, fmt.Errorf("batch size %d and max entries %d must be positive", batchSize, maxEntries)
+	}
+	pubKey, _, _, err := ct.PublicKeyFromPEM(logKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse log public key: %v", err)
+	}
+	sigVerifier, err := ct.NewSignatureVerifier(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	hasher := merkle.NewRFC6962TreeHasher(crypto.NewSHA256())
+	m := &Monitor{
+		client:      client,
+		sigVerifier: sigVerifier,
+		logVerifier: merkle.NewLogVerifier(hasher),
+		hasher:      hasher,
+		stateFile:   stateFile,
+		batchSize:   batchSize,
+		maxEntries:  maxEntries,
+	}
+	m.exp.vars = new(expvar.Map).Init()
+	for _, v := range []struct {
+		name string
+		v    **expvar.Int
+	}{
+		{"passes", &m.exp.passes},
+		{"fetch-failures", &m.exp.fetchFailures},
+		{"signature-failures", &m.exp.signatureFailures},
+		{"consistency-failures", &m.exp.consistencyFailures},
+		{"inclusion-failures", &m.exp.inclusionFailures},
+		{"sth-tree-size", &m.exp.sthTreeSize},
+		{"verified-tree-size", &m.exp.verifiedTreeSize},
+		{"verified-sth-timestamp", &m.exp.verifiedTimestamp},
+		{"entries-fetched", &m.exp.entriesFetched},
+		{"last-verified-unix", &m.exp.lastVerified},
+	} {
+		*v.v = new(expvar.Int)
+		m.exp.vars.Set(v.name, *v.v)
+	}
+
+	state, err := loadState(stateFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.restore(state); err != nil {
+		return nil, fmt.Errorf("invalid state in %s: %v", stateFile, err)
+	}
+	return m, nil
+}
+
+// Vars returns the statistics exported by this Monitor. The failure counts are the ones
+// to alert on, along with last-verified-unix falling behind.
+func (m *Monitor) Vars() *expvar.Map {
+	return m.exp.vars
+}
+
+// State returns the monitor's position in the log.
+func (m *Monitor) State() State {
+	return m.state
+}
+
+// restore sets the monitor's position from state, checking that its compact trees have
+// the roots it says they do.
+func (m *Monitor) restore(state State) error {
+	verified, err := compactTree(m.hasher, int64(state.TreeSize), state.Nodes, state.RootHash)
+	if err != nil {
+		return fmt.Errorf("verified tree: %v", err)
+	}
+	pending := verified
+	if state.PendingSize > state.TreeSize {
+		if pending, err = compactTree(m.hasher, int64(state.PendingSize), state.PendingNodes, state.PendingRoot); err != nil {
+			return fmt.Errorf("pending tree: %v", err)
+		}
+	} else {
+		state.PendingSize, state.PendingNodes, state.PendingRoot = 0, nil, nil
+	}
+	m.state, m.pending = state, pending
+	m.exp.verifiedTreeSize.Set(int64(state.TreeSize))
+	m.exp.verifiedTimestamp.Set(int64(state.Timestamp))
+	return nil
+}
+
+// Run makes a pass over the log straight away, and then every interval until ctx is
+// done. Failed checks are logged as errors, and counted in the monitor's statistics.
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.Pass(ctx); err != nil {
+			if _, ok := err.(*ctfe.VerificationError); ok {
+				glog.Errorf("Log failed verification: %v", err)
+			} else {
+				glog.Warningf("Monitor pass failed: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Pass fetches the log's latest tree head and checks it against the last one verified,
+// then fetches the entries added since, up to the monitor's limit, and checks them once
+// it has all the entries under the tree head. The monitor's position is saved if it
+// changes. A *ctfe.VerificationError is returned if the log has misbehaved.
+func (m *Monitor) Pass(ctx context.Context) error {
+	m.exp.passes.Add(1)
+	err := m.pass(ctx)
+	if verr, ok := err.(*ctfe.VerificationError); ok {
+		switch verr.Check {
+		case "signature":
+			m.exp.signatureFailures.Add(1)
+		case "consistency":
+			m.exp.consistencyFailures.Add(1)
+		case "inclusion":
+			m.exp.inclusionFailures.Add(1)
+		}
+	} else if err != nil {
+		m.exp.fetchFailures.Add(1)
+	}
+	return err
+}
+
+func (m *Monitor) pass(ctx context.Context) error {
+	sth, err := m.client.GetSTH(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get tree head: %v", err)
+	}
+	if err := m.sigVerifier.VerifySTHSignature(*sth); err != nil {
+		return &ctfe.VerificationError{Check: "signature", Err: fmt.Errorf("tree head for size %d: %v", sth.TreeSize, err)}
+	}
+	m.exp.sthTreeSize.Set(int64(sth.TreeSize))
+	if err := m.checkConsistency(ctx, sth); err != nil {
+		return err
+	}
+	if sth.TreeSize <= m.state.TreeSize {
+		// Nothing new, or a frontend is serving an older tree head.
+		return nil
+	}
+
+	before := m.pending.Size()
+	fetchErr := m.fetchEntries(ctx, sth.TreeSize)
+	if m.pending.Size() == int64(sth.TreeSize) {
+		if root := m.pending.CurrentRoot(); !bytes.Equal(root, sth.SHA256RootHash[:]) {
+			// The entries can't be trusted, so fetch them again next time.
+			m.state.PendingSize, m.state.PendingNodes, m.state.PendingRoot = 0, nil, nil
+			if err := m.restore(m.state); err != nil {
+				glog.Warningf("Failed to go back to the verified tree: %v", err)
+			} else if err := saveState(m.stateFile, m.state); err != nil {
+				glog.Warningf("Failed to save state: %v", err)
+			}
+			return &ctfe.VerificationError{Check: "inclusion", Err: fmt.Errorf("entries up to %d have root %x, but the tree head has %x", sth.TreeSize, root, sth.SHA256RootHash)}
+		}
+		if err := m.setVerified(sth); err != nil {
+			return err
+		}
+		glog.Infof("Verified tree head for size %d", sth.TreeSize)
+	} else if m.pending.Size() > before {
+		m.setPending()
+	} else {
+		return fetchErr
+	}
+	if err := saveState(m.stateFile, m.state); err != nil {
+		return fmt.Errorf("failed to save state: %v", err)
+	}
+	return fetchErr
+}
+
+// checkConsistency checks that sth is consistent with the last verified tree head,
+// whichever is the larger.
+func (m *Monitor) checkConsistency(ctx context.Context, sth *ct.SignedTreeHead) error {
+	if m.state.TreeSize == 0 {
+		return nil
+	}
+	if sth.TreeSize == 0 {
+		return &ctfe.VerificationError{Check: "consistency", Err: fmt.Errorf("empty tree head after one for size %d", m.state.TreeSize)}
+	}
+	if sth.TreeSize == m.state.TreeSize {
+		if !bytes.Equal(sth.SHA256RootHash[:], m.state.RootHash) {
+			return &ctfe.VerificationError{Check: "consistency", Err: fmt.Errorf("tree heads for size %d have roots %x and %x", sth.TreeSize, sth.SHA256RootHash, m.state.RootHash)}
+		}
+		return nil
+	}
+
+	first, second := m.state.TreeSize, sth.TreeSize
+	firstRoot, secondRoot := m.state.RootHash, sth.SHA256RootHash[:]
+	if first > second {
+		first, second = second, first
+		firstRoot, secondRoot = secondRoot, firstRoot
+	}
+	proof, err := m.client.GetSTHConsistency(ctx, first, second)
+	if err != nil {
+		return fmt.Errorf("failed to get consistency proof from %d to %d: %v", first, second, err)
+	}
+	if err := m.logVerifier.VerifyConsistencyProof(int64(first), int64(second), firstRoot, secondRoot, proof); err != nil {
+		return &ctfe.VerificationError{Check: "consistency", Err: fmt.Errorf("tree heads for sizes %d and %d: %v", first, second, err)}
+	}
+	return nil
+}
+
+// fetchEntries adds entries to the pending tree, up to treeSize or the monitor's limit
+// for a pass. The entries added before an error are kept.
+func (m *Monitor) fetchEntries(ctx context.Context, treeSize uint64) error {
+	end := int64(treeSize)
+	if limit := m.pending.Size() + m.maxEntries; end > limit {
+		end = limit
+	}
+	for m.pending.Size() < end {
+		start := m.pending.Size()
+		last := start + m.batchSize - 1
+		if last >= end {
+			last = end - 1
+		}
+		rsp, err := m.client.GetRawEntries(ctx, start, last)
+		if err != nil {
+			return fmt.Errorf("failed to get entries %d to %d: %v", start, last, err)
+		}
+		if len(rsp.Entries) == 0 {
+			return fmt.Errorf("no entries returned for %d to %d", start, last)
+		}
+		if got, want := int64(len(rsp.Entries)), last-start+1; got > want {
+			return fmt.Errorf("%d entries returned for %d to %d, want at most %d", got, start, last, want)
+		}
+		for _, entry := range rsp.Entries {
+			m.pending.AddLeaf(entry.LeafInput, func(int, int64, []byte) {})
+		}
+		m.exp.entriesFetched.Add(int64(len(rsp.Entries)))
+	}
+	return nil
+}
+
+// setVerified makes sth, whose entries are all in the pending tree, the verified tree
+// head.
+func (m *Monitor) setVerified(sth *ct.SignedTreeHead) error {
+	sig, err := tls.Marshal(sth.TreeHeadSignature)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tree head signature: %v", err)
+	}
+	m.state = State{
+		TreeSize:  sth.TreeSize,
+		Timestamp: sth.Timestamp,
+		RootHash:  append([]byte(nil), sth.SHA256RootHash[:]...),
+		Signature: sig,
+		Nodes:     m.pending.Hashes(),
+	}
+	m.exp.verifiedTreeSize.Set(int64(sth.TreeSize))
+	m.exp.verifiedTimestamp.Set(int64(sth.Timestamp))
+	m.exp.lastVerified.Set(time.Now().Unix())
+	return nil
+}
+
+// setPending records the entries fetched so far towards the next tree head.
+func (m *Monitor) setPending() {
+	m.state.PendingSize = uint64(m.pending.Size())
+	m.state.PendingNodes = m.pending.Hashes()
+	m.state.PendingRoot = m.pending.CurrentRoot()
+}
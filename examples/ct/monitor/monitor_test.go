@@ -0,0 +1,190 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ct "github.com/google/certificate-transparency/go"
+	ctfe "github.com/google/trillian/examples/ct"
+	"github.com/google/trillian/examples/ct/testonly"
+	"golang.org/x/net/context"
+)
+
+// fakeLog serves a testonly.FakeLog whose tree head and entries can be tampered with.
+type fakeLog struct {
+	*testonly.FakeLog
+	now uint64
+	// size is the size of the tree head served.
+	size int
+	// badSignature, forkRoot and tamperEntry make the log misbehave.
+	badSignature bool
+	forkRoot     bool
+	tamperEntry  int
+	fail         bool
+}
+
+func newFakeLog(t *testing.T) *fakeLog {
+	return &fakeLog{FakeLog: testonly.NewFakeLog(t), now: 1466179200000, tamperEntry: -1}
+}
+
+// grow adds n leaves to the log, and serves the tree head for them.
+func (l *fakeLog) grow(n int) {
+	for i := 0; i < n; i++ {
+		l.Add([]byte(fmt.Sprintf("leaf %d", l.Size())))
+	}
+	l.size = l.Size()
+}
+
+func (l *fakeLog) GetSTH(ctx context.Context) (*ct.SignedTreeHead, error) {
+	if l.fail {
+		return nil, errors.New("log down")
+	}
+	l.now++
+	sth := l.TreeHead(l.size, l.now)
+	if l.forkRoot {
+		sth.SHA256RootHash[0] ^= 1
+	}
+	l.SignTreeHead(&sth)
+	if l.badSignature {
+		sth.TreeHeadSignature.Signature[len(sth.TreeHeadSignature.Signature)-1] ^= 1
+	}
+	return &sth, nil
+}
+
+func (l *fakeLog) GetSTHConsistency(ctx context.Context, first, second uint64) ([][]byte, error) {
+	return l.Consistency(first, second), nil
+}
+
+func (l *fakeLog) GetRawEntries(ctx context.Context, start, end int64) (*ct.GetEntriesResponse, error) {
+	if l.fail {
+		return nil, errors.New("log down")
+	}
+	rsp := l.Entries(start, end)
+	if i := int64(l.tamperEntry) - start; l.tamperEntry >= 0 && i >= 0 && i < int64(len(rsp.Entries)) {
+		rsp.Entries[i].LeafInput = []byte("tampered")
+	}
+	return rsp, nil
+}
+
+func newTestMonitor(t *testing.T, log *fakeLog, stateFile string, maxEntries int64) *Monitor {
+	m, err := New(log, []byte(testonly.CTLogPublicKeyPEM), stateFile, 3, maxEntries)
+	if err != nil {
+		t.Fatalf("New()=_,%v", err)
+	}
+	return m
+}
+
+func TestMonitor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monitor")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state")
+	log := newFakeLog(t)
+	m := newTestMonitor(t, log, stateFile, 10)
+
+	var steps = []struct {
+		descr        string
+		grow         int
+		size         int // if set, the size of the tree head served instead
+		badSignature bool
+		forkRoot     bool
+		tamperEntry  int
+		fail         bool
+		restart      bool
+		wantCheck    string
+		wantErr      bool
+		wantVerified uint64
+		wantPending  uint64
+	}{
+		{descr: "empty"},
+		{descr: "grown", grow: 7, wantVerified: 7},
+		{descr: "unchanged", wantVerified: 7},
+		// Only 10 entries are fetched in a pass, so it takes two to verify 24.
+		{descr: "catching-up", grow: 17, wantVerified: 7, wantPending: 17},
+		{descr: "caught-up", wantVerified: 24},
+		{descr: "restarted", grow: 8, restart: true, wantVerified: 32},
+		{descr: "stale-tree-head", size: 20, wantVerified: 32},
+		{descr: "log-down", grow: 1, fail: true, wantErr: true, wantVerified: 32},
+		{descr: "bad-signature", badSignature: true, wantCheck: "signature", wantVerified: 32},
+		{descr: "forked-same-size", forkRoot: true, wantCheck: "consistency", wantVerified: 32},
+		{descr: "forked", grow: 3, forkRoot: true, wantCheck: "consistency", wantVerified: 32},
+		{descr: "tampered-entry", tamperEntry: 33, wantCheck: "inclusion", wantVerified: 32},
+		{descr: "recovered", wantVerified: 36},
+		{descr: "shrunk-to-empty", size: -1, wantCheck: "consistency", wantVerified: 36},
+	}
+	for _, step := range steps {
+		log.grow(step.grow)
+		if step.size > 0 {
+			log.size = step.size
+		} else if step.size < 0 {
+			log.size = 0
+		}
+		log.badSignature, log.forkRoot, log.tamperEntry, log.fail = step.badSignature, step.forkRoot, step.tamperEntry, step.fail
+		if step.tamperEntry == 0 {
+			log.tamperEntry = -1
+		}
+		if step.restart {
+			m = newTestMonitor(t, log, stateFile, 10)
+		}
+
+		err := m.Pass(context.Background())
+		if len(step.wantCheck) > 0 {
+			verr, ok := err.(*ctfe.VerificationError)
+			if !ok || verr.Check != step.wantCheck {
+				t.Errorf("%s: Pass()=%v, want %s check failure", step.descr, err, step.wantCheck)
+			}
+		} else if got, want := err != nil, step.wantErr; got != want {
+			t.Errorf("%s: Pass()=%v, want error: %v", step.descr, err, want)
+		}
+		if got, want := m.State().TreeSize, step.wantVerified; got != want {
+			t.Errorf("%s: verified tree size %d, want %d", step.descr, got, want)
+		}
+		if got, want := m.State().PendingSize, step.wantPending; got != want {
+			t.Errorf("%s: pending size %d, want %d", step.descr, got, want)
+		}
+	}
+
+	for _, v := range []struct {
+		name string
+		want string
+	}{
+		{"signature-failures", "1"},
+		{"consistency-failures", "3"},
+		{"inclusion-failures", "1"},
+		{"fetch-failures", "1"},
+	} {
+		if got := m.Vars().Get(v.name).String(); got != v.want {
+			t.Errorf("%s=%s, want %s", v.name, got, v.want)
+		}
+	}
+}
+
+func TestMonitorCorruptState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monitor")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state")
+	log := newFakeLog(t)
+	log.grow(5)
+	m := newTestMonitor(t, log, stateFile, 10)
+	if err := m.Pass(context.Background()); err != nil {
+		t.Fatalf("Pass()=%v", err)
+	}
+
+	state := m.State()
+	state.Nodes[0] = []byte("wrong")
+	if err := saveState(stateFile, state); err != nil {
+		t.Fatalf("saveState()=%v", err)
+	}
+	if _, err := New(log, []byte(testonly.CTLogPublicKeyPEM), stateFile, 3, 10); err == nil {
+		t.Errorf("New() with corrupt state=_,nil, want error")
+	}
+}
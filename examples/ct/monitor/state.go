@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/google/trillian/merkle"
+)
+
+// State is a monitor's position in a log. Binary values are base64 encoded in its JSON
+// form.
+type State struct {
+	// TreeSize, Timestamp, RootHash and Signature are those of the latest tree head
+	// verified: it was consistent with the ones verified before it, and its root
+	// matched the entries up to its size. Signature is the TLS encoded signature, kept
+	// as evidence should the log later contradict the tree head.
+	TreeSize  uint64 `json:"tree_size"`
+	Timestamp uint64 `json:"timestamp"`
+	RootHash  []byte `json:"root_hash,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
+	// Nodes are the hashes of the compact Merkle tree of the entries up to TreeSize.
+	Nodes [][]byte `json:"nodes,omitempty"`
+	// PendingSize, PendingNodes and PendingRoot describe the compact Merkle tree of the
+	// entries fetched beyond TreeSize, towards a tree head that hasn't been verified yet.
+	PendingSize  uint64   `json:"pending_size,omitempty"`
+	PendingNodes [][]byte `json:"pending_nodes,omitempty"`
+	PendingRoot  []byte   `json:"pending_root,omitempty"`
+}
+
+// loadState reads the state saved in path, or returns an empty state if there's none
+// yet.
+func loadState(path string) (State, error) {
+	var state State
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to parse state in %s: %v", path, err)
+	}
+	return state, nil
+}
+
+// saveState replaces the state saved in path, so that it's never left half written.
+func saveState(path string, state State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// compactTree rebuilds the compact Merkle tree of size entries from its nodes, checking
+// that it has the given root.
+func compactTree(hasher merkle.TreeHasher, size int64, nodes [][]byte, root []byte) (*merkle.CompactMerkleTree, error) {
+	if size == 0 {
+		return merkle.NewCompactMerkleTree(hasher), nil
+	}
+	return merkle.NewCompactMerkleTreeWithState(hasher, size, func(depth int, index int64) ([]byte, error) {
+		if depth >= len(nodes) || nodes[depth] == nil {
+			return nil, fmt.Errorf("no node at depth %d for tree size %d", depth, size)
+		}
+		return nodes[depth], nil
+	}, root)
+}
@@ -0,0 +1,50 @@
+package ct
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// notAfterWindow restricts the certificates a log accepts to those that expire in
+// [start, limit), so a set of logs can be run as temporal shards, each one holding
+// the certificates that expire in a particular period. Either end may be left open.
+type notAfterWindow struct {
+	start *time.Time
+	limit *time.Time
+}
+
+// parseNotAfterWindow builds a notAfterWindow from the RFC 3339 timestamps in a log's
+// config. Empty strings leave that end of the window open.
+func parseNotAfterWindow(start, limit string) (notAfterWindow, error) {
+	var w notAfterWindow
+	if len(start) > 0 {
+		t, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			return notAfterWindow{}, fmt.Errorf("invalid NotAfterStart: %v", err)
+		}
+		w.start = &t
+	}
+	if len(limit) > 0 {
+		t, err := time.Parse(time.RFC3339, limit)
+		if err != nil {
+			return notAfterWindow{}, fmt.Errorf("invalid NotAfterLimit: %v", err)
+		}
+		w.limit = &t
+	}
+	if w.start != nil && w.limit != nil && !w.start.Before(*w.limit) {
+		return notAfterWindow{}, errors.New("NotAfterStart must be before NotAfterLimit")
+	}
+	return w, nil
+}
+
+// check returns an error if a certificate expiring at notAfter falls outside the window.
+func (w notAfterWindow) check(notAfter time.Time) error {
+	if w.start != nil && notAfter.Before(*w.start) {
+		return fmt.Errorf("certificate NotAfter %v is before this log's window starting %v", notAfter, *w.start)
+	}
+	if w.limit != nil && !notAfter.Before(*w.limit) {
+		return fmt.Errorf("certificate NotAfter %v is not before this log's window limit %v", notAfter, *w.limit)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package ct
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/examples/ct/testonly"
+)
+
+func TestParseNotAfterWindow(t *testing.T) {
+	var tests = []struct {
+		start, limit string
+		wantErr      bool
+	}{
+		{start: "", limit: ""},
+		{start: "2017-01-01T00:00:00Z", limit: ""},
+		{start: "", limit: "2018-01-01T00:00:00Z"},
+		{start: "2017-01-01T00:00:00Z", limit: "2018-01-01T00:00:00Z"},
+		{start: "2018-01-01T00:00:00Z", limit: "2018-01-01T00:00:00Z", wantErr: true},
+		{start: "2018-01-01T00:00:00Z", limit: "2017-01-01T00:00:00Z", wantErr: true},
+		{start: "2017-01-01", wantErr: true},
+		{limit: "next year", wantErr: true},
+	}
+
+	for _, test := range tests {
+		if _, err := parseNotAfterWindow(test.start, test.limit); (err != nil) != test.wantErr {
+			t.Errorf("parseNotAfterWindow(%q, %q)=%v, want error: %v", test.start, test.limit, err, test.wantErr)
+		}
+	}
+}
+
+func TestNotAfterWindowCheck(t *testing.T) {
+	w, err := parseNotAfterWindow("2017-01-01T00:00:00Z", "2018-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("parseNotAfterWindow()=%v", err)
+	}
+	open, err := parseNotAfterWindow("", "")
+	if err != nil {
+		t.Fatalf("parseNotAfterWindow()=%v", err)
+	}
+
+	var tests = []struct {
+		w        notAfterWindow
+		notAfter time.Time
+		wantErr  bool
+	}{
+		{w: w, notAfter: time.Date(2016, 12, 31, 23, 59, 59, 0, time.UTC), wantErr: true},
+		{w: w, notAfter: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{w: w, notAfter: time.Date(2017, 12, 31, 23, 59, 59, 0, time.UTC)},
+		{w: w, notAfter: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC), wantErr: true},
+		{w: open, notAfter: time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{w: open, notAfter: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		if err := test.w.check(test.notAfter); (err != nil) != test.wantErr {
+			t.Errorf("check(%v)=%v, want error: %v", test.notAfter, err, test.wantErr)
+		}
+	}
+}
+
+func TestAddChainOutsideNotAfterWindow(t *testing.T) {
+	info := setupTest(t, []string{testonly.FakeCACertPEM})
+	defer info.mockCtrl.Finish()
+	// No certificates expire before 1971, so nothing is accepted and nothing is sent to
+	// the backend.
+	w, err := parseNotAfterWindow("", "1971-01-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("parseNotAfterWindow()=%v", err)
+	}
+	info.c.notAfter = w
+
+	pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+	recorder := makeAddChainRequest(t, info.c, createJSONChain(t, *pool))
+	if got, want := recorder.Code, http.StatusBadRequest; got != want {
+		t.Errorf("addChain()=%d (body:%v); want %d", got, recorder.Body, want)
+	}
+}
@@ -92,6 +92,19 @@ func (p *PEMCertPool) CertPool() *x509.CertPool {
 	return p.certPool
 }
 
+// Fingerprint returns a SHA-256 hash over the fingerprints of all the certificates in
+// the pool, in the order they were added. It changes whenever the pool contents change.
+func (p *PEMCertPool) Fingerprint() [sha256.Size]byte {
+	h := sha256.New()
+	for _, cert := range p.rawCerts {
+		fingerprint := sha256.Sum256(cert.Raw)
+		h.Write(fingerprint[:])
+	}
+	var result [sha256.Size]byte
+	copy(result[:], h.Sum(nil))
+	return result
+}
+
 // RawCertificates returns a list of the raw bytes of certificates that are in this pool
 func (p *PEMCertPool) RawCertificates() []*x509.Certificate {
 	return p.rawCerts
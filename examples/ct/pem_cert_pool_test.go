@@ -45,3 +45,22 @@ func TestLoadMultipleCertsFromPEM(t *testing.T) {
 		t.Fatalf("Got %d certs in pool, expected %d", got, want)
 	}
 }
+
+func TestFingerprint(t *testing.T) {
+	pool := NewPEMCertPool()
+	empty := pool.Fingerprint()
+
+	if !pool.AppendCertsFromPEM([]byte(testonly.CACertPEM)) {
+		t.Fatal("Rejected valid cert")
+	}
+	one := pool.Fingerprint()
+	if one == empty {
+		t.Error("Fingerprint() unchanged after adding cert")
+	}
+
+	// Adding a duplicate doesn't change the pool.
+	pool.AppendCertsFromPEM([]byte(testonly.CACertPEM))
+	if got := pool.Fingerprint(); got != one {
+		t.Errorf("Fingerprint()=%x after adding duplicate; want %x", got, one)
+	}
+}
@@ -0,0 +1,369 @@
+package ct
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+// Policy decides whether a log accepts a submission. Policies are applied by add-chain and
+// add-pre-chain once the chain has been verified, so they only see chains that lead to
+// one of the log's roots.
+type Policy interface {
+	// Check returns an error saying why a submission is rejected, or nil to accept it.
+	// The chain starts with the submitted certificate and ends with the root. Returning a
+	// PolicyError lets the rejection be identified by its code.
+	Check(chain []*x509.Certificate, entryType ct.LogEntryType) error
+}
+
+// PolicyError is a submission rejected by a certificate policy. Code is a short name for
+// the reason, which prefixes the error returned to the submitter and keys the log's
+// "policy-rejections" statistics.
+type PolicyError struct {
+	Code   string
+	Reason string
+}
+
+func (e PolicyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Reason)
+}
+
+// PolicyConfig selects and configures one of the policies applied by a log. Each built-in
+// policy uses some of the fields, and policies from InstanceOptions.PolicyFactories can
+// use Params for their own settings.
+type PolicyConfig struct {
+	// Name is the policy to apply: PolicyMinKeySize, PolicySignatureAlgorithms,
+	// PolicyRequiredEKU, PolicyDNSNames or one from InstanceOptions.PolicyFactories.
+	Name string
+	// MinRSABits and MinECDSABits are the smallest keys PolicyMinKeySize accepts, zero
+	// meaning no limit.
+	MinRSABits   int
+	MinECDSABits int
+	// SignatureAlgorithms are the names of the signature algorithms accepted by
+	// PolicySignatureAlgorithms, e.g. "SHA256-RSA" or "ECDSA-SHA256".
+	SignatureAlgorithms []string
+	// ExtKeyUsages lists the extended key usages PolicyRequiredEKU accepts, by the names
+	// used in RFC 5280, e.g. "serverAuth". The submitted certificate must have one of
+	// them, or no EKU extension at all.
+	ExtKeyUsages []string
+	// DNSNames are the patterns PolicyDNSNames accepts names in the submitted certificate
+	// against. A pattern is either a DNS name, which only matches itself, or "*." followed
+	// by a DNS name, which matches any name below it, e.g. "*.example.com" matches
+	// "www.example.com" and "*.dev.example.com" but not "example.com".
+	DNSNames []string
+	// Params holds settings for custom policies.
+	Params map[string]string
+}
+
+// PolicyFactory creates a Policy from its config.
+type PolicyFactory func(cfg PolicyConfig) (Policy, error)
+
+// Names of the built-in policies.
+const (
+	PolicyMinKeySize          = "min-key-size"
+	PolicySignatureAlgorithms = "signature-algorithms"
+	PolicyRequiredEKU         = "required-eku"
+	PolicyDNSNames            = "dns-names"
+)
+
+// Codes identifying why a submission was rejected by a built-in policy.
+const (
+	rejectKeyTooSmall          = "key-too-small"
+	rejectSignatureAlgorithm   = "signature-algorithm-not-allowed"
+	rejectExtKeyUsage          = "ext-key-usage-not-allowed"
+	rejectUnsupportedPublicKey = "unsupported-public-key"
+	rejectDNSName              = "dns-name-not-allowed"
+	// Used for rejections by custom policies that don't return a PolicyError
+	rejectOtherPolicy = "other"
+)
+
+var builtinPolicies = map[string]PolicyFactory{
+	PolicyMinKeySize:          newMinKeySizePolicy,
+	PolicySignatureAlgorithms: newSignatureAlgorithmPolicy,
+	PolicyRequiredEKU:         newRequiredEKUPolicy,
+	PolicyDNSNames:            newDNSNamePolicy,
+}
+
+// buildPolicies creates the policies configured for a log, in order. Factories in custom
+// take precedence over the built-in policies with the same name.
+func buildPolicies(cfgs []PolicyConfig, custom map[string]PolicyFactory) ([]Policy, error) {
+	var policies []Policy
+	for i, cfg := range cfgs {
+		factory, ok := custom[cfg.Name]
+		if !ok {
+			factory, ok = builtinPolicies[cfg.Name]
+		}
+		if !ok {
+			return nil, fmt.Errorf("Policies[%d]: unknown policy %q", i, cfg.Name)
+		}
+		p, err := factory(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("Policies[%d]: invalid %s policy: %v", i, cfg.Name, err)
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// nonRoots returns the certificates in a verified chain other than the root, which the log
+// trusts whatever its properties. A chain holding just a root is returned as it is.
+func nonRoots(chain []*x509.Certificate) []*x509.Certificate {
+	if len(chain) <= 1 {
+		return chain
+	}
+	return chain[:len(chain)-1]
+}
+
+// minKeySizePolicy rejects chains where the submitted certificate or an intermediate has a
+// public key that's too small. Keys other than RSA and ECDSA are rejected.
+type minKeySizePolicy struct {
+	minRSABits   int
+	minECDSABits int
+}
+
+func newMinKeySizePolicy(cfg PolicyConfig) (Policy, error) {
+	if cfg.MinRSABits < 0 || cfg.MinECDSABits < 0 {
+		return nil, errors.New("minimum key sizes must not be negative")
+	}
+	if cfg.MinRSABits == 0 && cfg.MinECDSABits == 0 {
+		return nil, errors.New("need MinRSABits or MinECDSABits")
+	}
+	return minKeySizePolicy{minRSABits: cfg.MinRSABits, minECDSABits: cfg.MinECDSABits}, nil
+}
+
+func (p minKeySizePolicy) Check(chain []*x509.Certificate, entryType ct.LogEntryType) error {
+	for i, cert := range nonRoots(chain) {
+		var bits, min int
+		var alg string
+		switch key := cert.PublicKey.(type) {
+		case *rsa.PublicKey:
+			bits, min, alg = key.N.BitLen(), p.minRSABits, "RSA"
+		case *ecdsa.PublicKey:
+			bits, min, alg = key.Curve.Params().BitSize, p.minECDSABits, "ECDSA"
+		default:
+			return PolicyError{Code: rejectUnsupportedPublicKey, Reason: fmt.Sprintf("certificate %d has an unsupported public key type %T", i, cert.PublicKey)}
+		}
+		if bits < min {
+			return PolicyError{Code: rejectKeyTooSmall, Reason: fmt.Sprintf("certificate %d has a %d bit %s key, less than the minimum of %d", i, bits, alg, min)}
+		}
+	}
+	return nil
+}
+
+// signatureAlgorithmNames maps the names used in config to signature algorithms.
+var signatureAlgorithmNames = map[string]x509.SignatureAlgorithm{
+	"MD2-RSA":      x509.MD2WithRSA,
+	"MD5-RSA":      x509.MD5WithRSA,
+	"SHA1-RSA":     x509.SHA1WithRSA,
+	"SHA256-RSA":   x509.SHA256WithRSA,
+	"SHA384-RSA":   x509.SHA384WithRSA,
+	"SHA512-RSA":   x509.SHA512WithRSA,
+	"DSA-SHA1":     x509.DSAWithSHA1,
+	"DSA-SHA256":   x509.DSAWithSHA256,
+	"ECDSA-SHA1":   x509.ECDSAWithSHA1,
+	"ECDSA-SHA256": x509.ECDSAWithSHA256,
+	"ECDSA-SHA384": x509.ECDSAWithSHA384,
+	"ECDSA-SHA512": x509.ECDSAWithSHA512,
+}
+
+// signatureAlgorithmPolicy rejects chains where the submitted certificate or an
+// intermediate is signed with an algorithm that isn't allowed. The root's self-signature
+// isn't checked.
+type signatureAlgorithmPolicy struct {
+	allowed map[x509.SignatureAlgorithm]string
+}
+
+func newSignatureAlgorithmPolicy(cfg PolicyConfig) (Policy, error) {
+	if len(cfg.SignatureAlgorithms) == 0 {
+		return nil, errors.New("need SignatureAlgorithms")
+	}
+	p := signatureAlgorithmPolicy{allowed: make(map[x509.SignatureAlgorithm]string)}
+	for _, name := range cfg.SignatureAlgorithms {
+		alg, ok := signatureAlgorithmNames[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown signature algorithm %q", name)
+		}
+		p.allowed[alg] = name
+	}
+	return p, nil
+}
+
+func (p signatureAlgorithmPolicy) Check(chain []*x509.Certificate, entryType ct.LogEntryType) error {
+	for i, cert := range nonRoots(chain) {
+		if _, ok := p.allowed[cert.SignatureAlgorithm]; !ok {
+			return PolicyError{Code: rejectSignatureAlgorithm, Reason: fmt.Sprintf("certificate %d is signed with %s, allowed: %s", i, signatureAlgorithmName(cert.SignatureAlgorithm), p.allowedNames())}
+		}
+	}
+	return nil
+}
+
+func (p signatureAlgorithmPolicy) allowedNames() string {
+	var names []string
+	for _, name := range p.allowed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func signatureAlgorithmName(alg x509.SignatureAlgorithm) string {
+	for name, a := range signatureAlgorithmNames {
+		if a == alg {
+			return name
+		}
+	}
+	return fmt.Sprintf("unknown algorithm %d", alg)
+}
+
+// extKeyUsageNames maps the names used in config to extended key usages.
+var extKeyUsageNames = map[string]x509.ExtKeyUsage{
+	"any":             x509.ExtKeyUsageAny,
+	"serverAuth":      x509.ExtKeyUsageServerAuth,
+	"clientAuth":      x509.ExtKeyUsageClientAuth,
+	"codeSigning":     x509.ExtKeyUsageCodeSigning,
+	"emailProtection": x509.ExtKeyUsageEmailProtection,
+	"timeStamping":    x509.ExtKeyUsageTimeStamping,
+	"OCSPSigning":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// requiredEKUPolicy rejects submitted certificates whose extended key usages don't include
+// one of those allowed. Certificates without the extension can be used for anything so
+// are accepted, as are ones with the anyExtendedKeyUsage usage.
+type requiredEKUPolicy struct {
+	allowed map[x509.ExtKeyUsage]bool
+	names   []string
+}
+
+func newRequiredEKUPolicy(cfg PolicyConfig) (Policy, error) {
+	if len(cfg.ExtKeyUsages) == 0 {
+		return nil, errors.New("need ExtKeyUsages")
+	}
+	p := requiredEKUPolicy{allowed: make(map[x509.ExtKeyUsage]bool)}
+	for _, name := range cfg.ExtKeyUsages {
+		eku, ok := extKeyUsageNames[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown extended key usage %q", name)
+		}
+		p.allowed[eku] = true
+		p.names = append(p.names, name)
+	}
+	return p, nil
+}
+
+func (p requiredEKUPolicy) Check(chain []*x509.Certificate, entryType ct.LogEntryType) error {
+	if len(chain) == 0 {
+		return nil
+	}
+	cert := chain[0]
+	if len(cert.ExtKeyUsage) == 0 && len(cert.UnknownExtKeyUsage) == 0 {
+		return nil
+	}
+	for _, eku := range cert.ExtKeyUsage {
+		if eku == x509.ExtKeyUsageAny || p.allowed[eku] {
+			return nil
+		}
+	}
+	return PolicyError{Code: rejectExtKeyUsage, Reason: fmt.Sprintf("certificate doesn't have any of the extended key usages %s", strings.Join(p.names, ", "))}
+}
+
+// dnsNamePolicy restricts a log to certificates for names it's responsible for, e.g. a
+// private log for an organization's own domains. Every DNS name in the submitted
+// certificate's SANs must match one of the policy's patterns; certificates without SANs
+// are checked on their subject common name. Certificates naming IP addresses or nothing
+// at all are rejected.
+type dnsNamePolicy struct {
+	// exact holds the names matched exactly, and suffixes the ".example.com" parts of
+	// wildcard patterns.
+	exact    map[string]bool
+	suffixes []string
+	patterns []string
+}
+
+func newDNSNamePolicy(cfg PolicyConfig) (Policy, error) {
+	if len(cfg.DNSNames) == 0 {
+		return nil, errors.New("need DNSNames")
+	}
+	p := dnsNamePolicy{exact: make(map[string]bool)}
+	for _, pattern := range cfg.DNSNames {
+		name := normalizeDNSName(pattern)
+		wildcard := strings.HasPrefix(name, "*.")
+		if wildcard {
+			name = name[2:]
+		}
+		if !validDNSName(name) {
+			return nil, fmt.Errorf("invalid DNS name pattern %q", pattern)
+		}
+		if wildcard {
+			p.suffixes = append(p.suffixes, "."+name)
+		} else {
+			p.exact[name] = true
+		}
+		p.patterns = append(p.patterns, pattern)
+	}
+	return p, nil
+}
+
+func (p dnsNamePolicy) Check(chain []*x509.Certificate, entryType ct.LogEntryType) error {
+	if len(chain) == 0 {
+		return nil
+	}
+	cert := chain[0]
+	if len(cert.IPAddresses) > 0 {
+		return PolicyError{Code: rejectDNSName, Reason: fmt.Sprintf("certificate names IP address %v, only DNS names matching %s are accepted", cert.IPAddresses[0], strings.Join(p.patterns, ", "))}
+	}
+	names := cert.DNSNames
+	if len(names) == 0 && len(cert.Subject.CommonName) > 0 {
+		names = []string{cert.Subject.CommonName}
+	}
+	if len(names) == 0 {
+		return PolicyError{Code: rejectDNSName, Reason: "certificate has no DNS names"}
+	}
+	for _, name := range names {
+		if !p.matches(normalizeDNSName(name)) {
+			return PolicyError{Code: rejectDNSName, Reason: fmt.Sprintf("certificate name %q doesn't match any of %s", name, strings.Join(p.patterns, ", "))}
+		}
+	}
+	return nil
+}
+
+func (p dnsNamePolicy) matches(name string) bool {
+	if p.exact[name] {
+		return true
+	}
+	for _, suffix := range p.suffixes {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDNSName lower cases a DNS name and removes any trailing dot.
+func normalizeDNSName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+// validDNSName returns true if name is a plausible, normalized DNS name: non-empty labels
+// of letters, digits, hyphens and underscores.
+func validDNSName(name string) bool {
+	if len(name) == 0 || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,210 @@
+package ct
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/trillian/examples/ct/testonly"
+)
+
+type testPolicy struct {
+	err error
+}
+
+func (p testPolicy) Check(chain []*x509.Certificate, entryType ct.LogEntryType) error {
+	return p.err
+}
+
+func TestBuildPolicies(t *testing.T) {
+	custom := map[string]PolicyFactory{
+		"custom": func(cfg PolicyConfig) (Policy, error) {
+			if len(cfg.Params["reject"]) > 0 {
+				return testPolicy{err: errors.New(cfg.Params["reject"])}, nil
+			}
+			return testPolicy{}, nil
+		},
+	}
+
+	var tests = []struct {
+		cfgs    []PolicyConfig
+		wantLen int
+		wantErr bool
+	}{
+		{cfgs: nil},
+		{cfgs: []PolicyConfig{{Name: PolicyMinKeySize, MinRSABits: 2048}}, wantLen: 1},
+		{cfgs: []PolicyConfig{{Name: PolicyMinKeySize}}, wantErr: true},
+		{cfgs: []PolicyConfig{{Name: PolicyMinKeySize, MinECDSABits: -1}}, wantErr: true},
+		{cfgs: []PolicyConfig{{Name: PolicySignatureAlgorithms, SignatureAlgorithms: []string{"SHA256-RSA", "ecdsa-sha256"}}}, wantLen: 1},
+		{cfgs: []PolicyConfig{{Name: PolicySignatureAlgorithms}}, wantErr: true},
+		{cfgs: []PolicyConfig{{Name: PolicySignatureAlgorithms, SignatureAlgorithms: []string{"SHA3-RSA"}}}, wantErr: true},
+		{cfgs: []PolicyConfig{{Name: PolicyRequiredEKU, ExtKeyUsages: []string{"serverAuth"}}}, wantLen: 1},
+		{cfgs: []PolicyConfig{{Name: PolicyRequiredEKU, ExtKeyUsages: []string{"webAuth"}}}, wantErr: true},
+		{cfgs: []PolicyConfig{{Name: PolicyDNSNames, DNSNames: []string{"example.com", "*.Example.org."}}}, wantLen: 1},
+		{cfgs: []PolicyConfig{{Name: PolicyDNSNames}}, wantErr: true},
+		{cfgs: []PolicyConfig{{Name: PolicyDNSNames, DNSNames: []string{"*"}}}, wantErr: true},
+		{cfgs: []PolicyConfig{{Name: PolicyDNSNames, DNSNames: []string{"www.*.example.com"}}}, wantErr: true},
+		{cfgs: []PolicyConfig{{Name: "custom", Params: map[string]string{"reject": "no"}}, {Name: PolicyMinKeySize, MinRSABits: 2048}}, wantLen: 2},
+		{cfgs: []PolicyConfig{{Name: "unknown"}}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		policies, err := buildPolicies(test.cfgs, custom)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("buildPolicies(%+v)=%v, want error", test.cfgs, policies)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("buildPolicies(%+v)=_,%v, want no error", test.cfgs, err)
+			continue
+		}
+		if got := len(policies); got != test.wantLen {
+			t.Errorf("buildPolicies(%+v)=%d policies, want %d", test.cfgs, got, test.wantLen)
+		}
+	}
+}
+
+func TestBuiltinPolicies(t *testing.T) {
+	b := testonly.NewChainBuilder(t)
+	root := b.Root(testonly.CertSpec{CommonName: "root"})
+	intermediate := b.Intermediate(root, testonly.CertSpec{CommonName: "intermediate"})
+	ecLeaf := b.Leaf(intermediate, testonly.CertSpec{CommonName: "leaf"}).Certificate
+	rsaLeaf := b.Leaf(intermediate, testonly.CertSpec{CommonName: "rsa", KeyType: testonly.KeyRSA1024}).Certificate
+	serverLeaf := b.Leaf(intermediate, testonly.CertSpec{CommonName: "server", ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}).Certificate
+	clientLeaf := b.Leaf(intermediate, testonly.CertSpec{CommonName: "client", ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}).Certificate
+	rsaRoot := b.Root(testonly.CertSpec{CommonName: "rsa root", KeyType: testonly.KeyRSA2048, SignatureAlgorithm: x509.SHA256WithRSA})
+	sha1Leaf := b.Leaf(rsaRoot, testonly.CertSpec{CommonName: "sha1", SignatureAlgorithm: x509.SHA1WithRSA}).Certificate
+	sha256Leaf := b.Leaf(rsaRoot, testonly.CertSpec{CommonName: "sha256", SignatureAlgorithm: x509.SHA256WithRSA}).Certificate
+
+	ecChain := []*x509.Certificate{ecLeaf, intermediate.Certificate, root.Certificate}
+	var tests = []struct {
+		cfg      PolicyConfig
+		chain    []*x509.Certificate
+		wantCode string
+	}{
+		{cfg: PolicyConfig{Name: PolicyMinKeySize, MinECDSABits: 256}, chain: ecChain},
+		{cfg: PolicyConfig{Name: PolicyMinKeySize, MinECDSABits: 384}, chain: ecChain, wantCode: rejectKeyTooSmall},
+		{cfg: PolicyConfig{Name: PolicyMinKeySize, MinECDSABits: 384}, chain: []*x509.Certificate{root.Certificate}, wantCode: rejectKeyTooSmall},
+		{cfg: PolicyConfig{Name: PolicyMinKeySize, MinRSABits: 1024}, chain: []*x509.Certificate{rsaLeaf, intermediate.Certificate, root.Certificate}},
+		{cfg: PolicyConfig{Name: PolicyMinKeySize, MinRSABits: 2048}, chain: []*x509.Certificate{rsaLeaf, intermediate.Certificate, root.Certificate}, wantCode: rejectKeyTooSmall},
+		{cfg: PolicyConfig{Name: PolicySignatureAlgorithms, SignatureAlgorithms: []string{"ECDSA-SHA256"}}, chain: ecChain},
+		{cfg: PolicyConfig{Name: PolicySignatureAlgorithms, SignatureAlgorithms: []string{"SHA256-RSA"}}, chain: ecChain, wantCode: rejectSignatureAlgorithm},
+		{cfg: PolicyConfig{Name: PolicySignatureAlgorithms, SignatureAlgorithms: []string{"SHA256-RSA"}}, chain: []*x509.Certificate{sha256Leaf, rsaRoot.Certificate}},
+		{cfg: PolicyConfig{Name: PolicySignatureAlgorithms, SignatureAlgorithms: []string{"SHA256-RSA"}}, chain: []*x509.Certificate{sha1Leaf, rsaRoot.Certificate}, wantCode: rejectSignatureAlgorithm},
+		{cfg: PolicyConfig{Name: PolicyMinKeySize, MinRSABits: 2048}, chain: []*x509.Certificate{sha1Leaf, rsaRoot.Certificate}},
+		{cfg: PolicyConfig{Name: PolicyRequiredEKU, ExtKeyUsages: []string{"serverAuth"}}, chain: ecChain},
+		{cfg: PolicyConfig{Name: PolicyRequiredEKU, ExtKeyUsages: []string{"serverAuth"}}, chain: []*x509.Certificate{serverLeaf, intermediate.Certificate, root.Certificate}},
+		{cfg: PolicyConfig{Name: PolicyRequiredEKU, ExtKeyUsages: []string{"serverAuth"}}, chain: []*x509.Certificate{clientLeaf, intermediate.Certificate, root.Certificate}, wantCode: rejectExtKeyUsage},
+		{cfg: PolicyConfig{Name: PolicyRequiredEKU, ExtKeyUsages: []string{"serverAuth", "clientAuth"}}, chain: []*x509.Certificate{clientLeaf, intermediate.Certificate, root.Certificate}},
+	}
+
+	for i, test := range tests {
+		policies, err := buildPolicies([]PolicyConfig{test.cfg}, nil)
+		if err != nil {
+			t.Fatalf("%d: buildPolicies()=_,%v, want no error", i, err)
+		}
+		err = policies[0].Check(test.chain, ct.X509LogEntryType)
+		if len(test.wantCode) == 0 {
+			if err != nil {
+				t.Errorf("%d: %s.Check()=%v, want no error", i, test.cfg.Name, err)
+			}
+			continue
+		}
+		perr, ok := err.(PolicyError)
+		if !ok {
+			t.Errorf("%d: %s.Check()=%v, want PolicyError", i, test.cfg.Name, err)
+			continue
+		}
+		if got, want := perr.Code, test.wantCode; got != want {
+			t.Errorf("%d: %s.Check()=%q, want code %q", i, test.cfg.Name, got, want)
+		}
+	}
+}
+
+func TestDNSNamePolicy(t *testing.T) {
+	policies, err := buildPolicies([]PolicyConfig{{Name: PolicyDNSNames, DNSNames: []string{"example.com", "*.corp.example.org"}}}, nil)
+	if err != nil {
+		t.Fatalf("buildPolicies()=_,%v, want no error", err)
+	}
+	p := policies[0]
+	root, rootKey := createTestCert(t, "root", true, "", nil, nil)
+
+	var tests = []struct {
+		cn          string
+		dnsNames    []string
+		ip          string
+		wantBlocked bool
+	}{
+		{dnsNames: []string{"example.com"}},
+		{dnsNames: []string{"EXAMPLE.com."}},
+		{dnsNames: []string{"www.example.com"}, wantBlocked: true},
+		{dnsNames: []string{"www.corp.example.org", "*.dev.corp.example.org"}},
+		{dnsNames: []string{"corp.example.org"}, wantBlocked: true},
+		{dnsNames: []string{"www.corp.example.org", "www.example.net"}, wantBlocked: true},
+		{dnsNames: []string{"notcorp.example.org"}, wantBlocked: true},
+		{cn: "www.corp.example.org"},
+		{cn: "www.example.net", wantBlocked: true},
+		// SANs take precedence over the common name.
+		{cn: "www.example.net", dnsNames: []string{"example.com"}},
+		{cn: "example.com", ip: "192.0.2.1", wantBlocked: true},
+		{wantBlocked: true},
+	}
+
+	for _, test := range tests {
+		leaf, _ := createTestCert(t, "leaf", false, "", root, rootKey)
+		leaf.Subject.CommonName = test.cn
+		leaf.DNSNames = test.dnsNames
+		if len(test.ip) > 0 {
+			leaf.IPAddresses = []net.IP{net.ParseIP(test.ip)}
+		}
+		err := p.Check([]*x509.Certificate{leaf, root}, ct.X509LogEntryType)
+		if !test.wantBlocked {
+			if err != nil {
+				t.Errorf("Check(cn=%q, dns=%v, ip=%q)=%v, want no error", test.cn, test.dnsNames, test.ip, err)
+			}
+			continue
+		}
+		perr, ok := err.(PolicyError)
+		if !ok {
+			t.Errorf("Check(cn=%q, dns=%v, ip=%q)=%v, want PolicyError", test.cn, test.dnsNames, test.ip, err)
+			continue
+		}
+		if got, want := perr.Code, rejectDNSName; got != want {
+			t.Errorf("Check(cn=%q, dns=%v, ip=%q)=%q, want code %q", test.cn, test.dnsNames, test.ip, got, want)
+		}
+	}
+}
+
+func TestAddChainPolicies(t *testing.T) {
+	var tests = []struct {
+		policies []Policy
+		wantCode string
+	}{
+		{policies: []Policy{testPolicy{}, testPolicy{err: PolicyError{Code: "custom-code", Reason: "rejected"}}}, wantCode: "custom-code"},
+		{policies: []Policy{testPolicy{err: errors.New("rejected")}}, wantCode: rejectOtherPolicy},
+	}
+
+	for _, test := range tests {
+		info := setupTest(t, []string{testonly.FakeCACertPEM})
+		info.c.policies = test.policies
+
+		pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+		recorder := makeAddChainRequest(t, info.c, createJSONChain(t, *pool))
+		if got, want := recorder.Code, http.StatusBadRequest; got != want {
+			t.Errorf("addChain()=%d (body:%v); want %d", got, recorder.Body, want)
+		}
+		if got, want := recorder.Body.String(), "rejected"; !strings.Contains(got, want) {
+			t.Errorf("addChain() body=%q, want it to contain %q", got, want)
+		}
+		if got, want := info.c.exp.policyRejections.Get(test.wantCode).String(), "1"; got != want {
+			t.Errorf("policy-rejections[%s]=%s, want %s", test.wantCode, got, want)
+		}
+		info.mockCtrl.Finish()
+	}
+}
@@ -0,0 +1,145 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// proofEntrypoints are the entrypoints whose responses are proofs, and so may be audited.
+var proofEntrypoints = map[string]bool{
+	"GetSTHConsistency":   true,
+	"GetProofByHash":      true,
+	"GetEntryAndProof":    true,
+	"GetProofsByHash":     true,
+	"V2GetSTHConsistency": true,
+	"V2GetProofByHash":    true,
+}
+
+// ProofAuditRecord records a proof served to a client, so that if the client later
+// disputes it the operator can show exactly what was served. The response itself isn't
+// kept, but it can be recomputed from the log and checked against ResponseHash.
+type ProofAuditRecord struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	LogID     int64     `json:"log_id"`
+	LogPrefix string    `json:"log_prefix"`
+	Endpoint  string    `json:"endpoint"`
+	ClientIP  string    `json:"client_ip"`
+	// Query is the raw query of the request, which holds the parameters of GET requests.
+	Query string `json:"query,omitempty"`
+	// RequestHash is the hex encoded SHA-256 hash of the body of POST requests.
+	RequestHash string `json:"request_sha256,omitempty"`
+	// ResponseHash is the hex encoded SHA-256 hash of the uncompressed response body.
+	ResponseHash string `json:"response_sha256"`
+	// STHTreeSize and STHTimestamp identify the latest tree head the log had served
+	// when the proof was served.
+	STHTreeSize  int64 `json:"sth_tree_size"`
+	STHTimestamp int64 `json:"sth_timestamp"`
+}
+
+// ProofAuditSink receives the records of audited proofs. Implementations must be safe
+// for concurrent use, and should only ever append to the store they write to.
+type ProofAuditSink interface {
+	RecordProof(rec *ProofAuditRecord)
+}
+
+// ProofAuditConfig says which proofs are audited and where the records go.
+type ProofAuditConfig struct {
+	Sink ProofAuditSink
+	// SampleRate is the fraction of proof responses that are recorded, from 0 to 1.
+	SampleRate float64
+}
+
+// JSONProofAudit is a ProofAuditSink that writes each record to an io.Writer as a line
+// of JSON.
+type JSONProofAudit struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONProofAudit creates a JSONProofAudit that writes records to w, e.g. a
+// RotatingFile.
+func NewJSONProofAudit(w io.Writer) *JSONProofAudit {
+	return &JSONProofAudit{enc: json.NewEncoder(w)}
+}
+
+// RecordProof writes a single record.
+func (j *JSONProofAudit) RecordProof(rec *ProofAuditRecord) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.enc.Encode(rec); err != nil {
+		glog.Warningf("Failed to write proof audit record: %v", err)
+	}
+}
+
+// proofAuditor samples the proofs a log serves and records them.
+type proofAuditor struct {
+	sink ProofAuditSink
+	rate float64
+	// sample returns a random number in [0, 1), it can be replaced for testing
+	sample func() float64
+}
+
+func newProofAuditor(cfg *ProofAuditConfig) *proofAuditor {
+	return &proofAuditor{sink: cfg.Sink, rate: cfg.SampleRate, sample: rand.Float64}
+}
+
+// auditedResponse wraps an http.ResponseWriter to hash the response body.
+type auditedResponse struct {
+	http.ResponseWriter
+	h           hash.Hash
+	requestHash string
+}
+
+func (a *auditedResponse) Write(b []byte) (int, error) {
+	a.h.Write(b)
+	return a.ResponseWriter.Write(b)
+}
+
+// start decides whether the response to r is audited. If it is, it returns a writer
+// that should be used for the response, otherwise it returns nil. The body of r is left
+// in place for the handler.
+func (p *proofAuditor) start(w http.ResponseWriter, r *http.Request) *auditedResponse {
+	if p.rate <= 0 || (p.rate < 1 && p.sample() >= p.rate) {
+		return nil
+	}
+	a := &auditedResponse{ResponseWriter: w, h: sha256.New()}
+	if r.Method == http.MethodPost {
+		body, err := readRequestBody(r)
+		if err != nil {
+			glog.Warningf("Not auditing proof request: failed to read body: %v", err)
+			return nil
+		}
+		hash := sha256.Sum256(body)
+		a.requestHash = hex.EncodeToString(hash[:])
+	}
+	return a
+}
+
+// finish records a proof that was successfully served through a.
+func (p *proofAuditor) finish(c LogContext, a *auditedResponse, r *http.Request, rec *AccessLogRecord) {
+	c.exp.vars.Add("proofs-audited", 1)
+	p.sink.RecordProof(&ProofAuditRecord{
+		Time:         rec.Time,
+		RequestID:    rec.RequestID,
+		LogID:        rec.LogID,
+		LogPrefix:    rec.LogPrefix,
+		Endpoint:     rec.Endpoint,
+		ClientIP:     rec.ClientIP,
+		Query:        r.URL.RawQuery,
+		RequestHash:  a.requestHash,
+		ResponseHash: hex.EncodeToString(a.h.Sum(nil)),
+		STHTreeSize:  c.exp.lastSTHTreeSize.Value(),
+		STHTimestamp: c.exp.lastSTHTimestamp.Value(),
+	})
+}
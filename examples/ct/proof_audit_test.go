@@ -0,0 +1,135 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+// recordingProofAudit keeps the records it's given so tests can check them.
+type recordingProofAudit struct {
+	mu   sync.Mutex
+	recs []ProofAuditRecord
+}
+
+func (r *recordingProofAudit) RecordProof(rec *ProofAuditRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recs = append(r.recs, *rec)
+}
+
+func sha256Hex(data string) string {
+	hash := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestProofAudit(t *testing.T) {
+	const proof = `{"leaf_index":1,"audit_path":[]}`
+	var tests = []struct {
+		descr       string
+		name        string
+		method      string
+		url         string
+		body        string
+		rate        float64
+		sample      float64
+		err         error
+		wantRecord  bool
+		wantQuery   string
+		wantReqHash string
+	}{
+		{descr: "get", name: "GetProofByHash", method: "GET", url: "http://example.com/ct/v1/get-proof-by-hash?hash=AAAA&tree_size=3", rate: 1, wantRecord: true, wantQuery: "hash=AAAA&tree_size=3"},
+		{descr: "post", name: "GetProofsByHash", method: "POST", url: "http://example.com/ct/v1/get-proofs-by-hash", body: `{"tree_size":3}`, rate: 1, wantRecord: true, wantReqHash: sha256Hex(`{"tree_size":3}`)},
+		{descr: "sampled", name: "GetSTHConsistency", method: "GET", url: "http://example.com/ct/v1/get-sth-consistency?first=1&second=3", rate: 0.1, sample: 0.05, wantRecord: true, wantQuery: "first=1&second=3"},
+		{descr: "not-sampled", name: "GetSTHConsistency", method: "GET", url: "http://example.com/ct/v1/get-sth-consistency?first=1&second=3", rate: 0.1, sample: 0.5},
+		{descr: "disabled", name: "GetEntryAndProof", method: "GET", url: "http://example.com/ct/v1/get-entry-and-proof?leaf_index=1&tree_size=3", rate: 0},
+		{descr: "not-proof", name: "GetSTH", method: "GET", url: "http://example.com/ct/v1/get-sth", rate: 1},
+		{descr: "failed", name: "GetProofByHash", method: "GET", url: "http://example.com/ct/v1/get-proof-by-hash?hash=AAAA&tree_size=3", rate: 1, err: errors.New("backend down")},
+	}
+
+	for _, test := range tests {
+		info := setupTest(t, nil)
+		sink := &recordingProofAudit{}
+		info.c.proofAudit = newProofAuditor(&ProofAuditConfig{Sink: sink, SampleRate: test.rate})
+		info.c.proofAudit.sample = func() float64 { return test.sample }
+		info.c.exp.lastSTHTreeSize.Set(3)
+		info.c.compressResponses = true
+
+		handler := appHandler{context: info.c, name: test.name, method: test.method,
+			handler: func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+				if test.err != nil {
+					return http.StatusInternalServerError, test.err
+				}
+				// The handler must still be able to read the request.
+				if body, err := ioutil.ReadAll(r.Body); err != nil || string(body) != test.body {
+					t.Errorf("%s: handler read body %q,%v, want %q", test.descr, body, err, test.body)
+				}
+				w.Write([]byte(proof))
+				return http.StatusOK, nil
+			}}
+
+		req, err := http.NewRequest(test.method, test.url, bytes.NewReader([]byte(test.body)))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		// The record is of the uncompressed response.
+		req.Header.Set(acceptEncodingHeader, "gzip")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if got, want := len(sink.recs) == 1, test.wantRecord; got != want {
+			t.Errorf("%s: recorded %d proofs, want recorded: %v", test.descr, len(sink.recs), want)
+			continue
+		}
+		if !test.wantRecord {
+			continue
+		}
+		rec := sink.recs[0]
+		if got, want := rec.Endpoint, test.name; got != want {
+			t.Errorf("%s: Endpoint=%s, want %s", test.descr, got, want)
+		}
+		if got, want := rec.Query, test.wantQuery; got != want {
+			t.Errorf("%s: Query=%q, want %q", test.descr, got, want)
+		}
+		if got, want := rec.RequestHash, test.wantReqHash; got != want {
+			t.Errorf("%s: RequestHash=%s, want %s", test.descr, got, want)
+		}
+		if got, want := rec.ResponseHash, sha256Hex(proof); got != want {
+			t.Errorf("%s: ResponseHash=%s, want %s", test.descr, got, want)
+		}
+		if got, want := rec.STHTreeSize, int64(3); got != want {
+			t.Errorf("%s: STHTreeSize=%d, want %d", test.descr, got, want)
+		}
+		if got, want := rec.RequestID, w.Header().Get(util.RequestIDHeader); got != want {
+			t.Errorf("%s: RequestID=%s, want %s", test.descr, got, want)
+		}
+	}
+}
+
+func TestJSONProofAudit(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONProofAudit(&buf)
+	sink.RecordProof(&ProofAuditRecord{Endpoint: "GetProofByHash", ResponseHash: "abcd"})
+	sink.RecordProof(&ProofAuditRecord{Endpoint: "GetSTHConsistency", ResponseHash: "ef01"})
+
+	dec := json.NewDecoder(&buf)
+	for _, want := range []string{"GetProofByHash", "GetSTHConsistency"} {
+		var rec ProofAuditRecord
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("Decode()=%v", err)
+		}
+		if got := rec.Endpoint; got != want {
+			t.Errorf("Decode().Endpoint=%s, want %s", got, want)
+		}
+	}
+}
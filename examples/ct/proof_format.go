@@ -0,0 +1,63 @@
+package ct
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/trillian"
+)
+
+// The name of the optional parameter of get-proof-by-hash and get-sth-consistency that
+// selects how the proof is encoded, for clients written against other transparency
+// stacks. It isn't part of RFC 6962.
+const getProofParamFormat = "proof_format"
+
+// proofFormats maps the values of getProofParamFormat to the backend's proof formats.
+// The default, rfc6962, is the usual JSON response with a list of hashes.
+var proofFormats = map[string]trillian.ProofFormat{
+	"rfc6962":   trillian.ProofFormat_PROOF_NODES,
+	"rfc9162":   trillian.ProofFormat_RFC9162,
+	"hash_list": trillian.ProofFormat_HASH_LIST,
+}
+
+// encodedProofResponse is returned instead of the RFC 6962 response when a proof is
+// requested in another format.
+type encodedProofResponse struct {
+	// LeafIndex is only set for inclusion proofs.
+	LeafIndex *int64 `json:"leaf_index,omitempty"`
+	Format    string `json:"proof_format"`
+	Proof     []byte `json:"proof"`
+}
+
+// parseProofFormat returns the format and its name requested by r, which is rfc6962 if
+// it doesn't ask for one.
+func parseProofFormat(r *http.Request) (string, trillian.ProofFormat, error) {
+	name := r.FormValue(getProofParamFormat)
+	if len(name) == 0 {
+		return "rfc6962", trillian.ProofFormat_PROOF_NODES, nil
+	}
+	format, ok := proofFormats[name]
+	if !ok {
+		return "", 0, fmt.Errorf("unknown %s: %q", getProofParamFormat, name)
+	}
+	return name, format, nil
+}
+
+// writeEncodedProof writes the response for a proof encoded by the backend in a format
+// other than rfc6962.
+func writeEncodedProof(w http.ResponseWriter, name string, leafIndex *int64, proof *trillian.Proof) (int, error) {
+	if len(proof.GetEncodedPath()) == 0 && len(proof.GetProofNode()) > 0 {
+		return http.StatusInternalServerError, fmt.Errorf("backend didn't encode proof as %s", name)
+	}
+	rsp := encodedProofResponse{LeafIndex: leafIndex, Format: name, Proof: proof.GetEncodedPath()}
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	jsonData, err := json.Marshal(&rsp)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to marshal encoded proof: %v", err)
+	}
+	if _, err := w.Write(jsonData); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to write encoded proof: %v", err)
+	}
+	return http.StatusOK, nil
+}
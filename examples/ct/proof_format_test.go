@@ -0,0 +1,108 @@
+package ct
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian"
+)
+
+func TestGetProofByHashFormats(t *testing.T) {
+	proof := &trillian.Proof{
+		LeafIndex:   2,
+		ProofNode:   []*trillian.Node{{NodeHash: []byte("abcdef")}},
+		EncodedPath: []byte("encoded"),
+	}
+	leafIndex := int64(2)
+
+	var tests = []struct {
+		format     string
+		wantFormat trillian.ProofFormat // the format requested from the backend, if it's called
+		rpcProof   *trillian.Proof
+		want       int
+		wantRsp    encodedProofResponse
+		errStr     string
+	}{
+		{format: "rfc9162", wantFormat: trillian.ProofFormat_RFC9162, rpcProof: proof, want: http.StatusOK, wantRsp: encodedProofResponse{LeafIndex: &leafIndex, Format: "rfc9162", Proof: []byte("encoded")}},
+		{format: "hash_list", wantFormat: trillian.ProofFormat_HASH_LIST, rpcProof: proof, want: http.StatusOK, wantRsp: encodedProofResponse{LeafIndex: &leafIndex, Format: "hash_list", Proof: []byte("encoded")}},
+		{
+			format:     "rfc9162",
+			wantFormat: trillian.ProofFormat_RFC9162,
+			rpcProof:   &trillian.Proof{LeafIndex: 2, ProofNode: proof.ProofNode},
+			want:       http.StatusInternalServerError,
+			errStr:     "didn't encode proof",
+		},
+		{format: "rfc4180", want: http.StatusBadRequest, errStr: "unknown proof_format"},
+	}
+
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	handler := appHandler{context: info.c, handler: getProofByHash, name: "GetProofByHash", method: http.MethodGet}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/ct/v1/proof-by-hash?tree_size=7&hash=YWhhc2g=&proof_format=%s", test.format), nil)
+		if err != nil {
+			t.Errorf("Failed to create request: %v", err)
+			continue
+		}
+		if test.rpcProof != nil {
+			rpcReq := &trillian.GetInclusionProofByHashRequest{LogId: 0x42, LeafHash: []byte("ahash"), TreeSize: 7, OrderBySequence: true, ProofFormat: test.wantFormat}
+			rpcRsp := &trillian.GetInclusionProofByHashResponse{Status: okStatus, Proof: []*trillian.Proof{test.rpcProof}}
+			info.client.EXPECT().GetInclusionProofByHash(deadlineMatcher(), rpcReq).Return(rpcRsp, nil)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got := w.Code; got != test.want {
+			t.Errorf("proofByHash(%s)=%d; want %d", test.format, got, test.want)
+		}
+		if test.errStr != "" {
+			if body := w.Body.String(); !strings.Contains(body, test.errStr) {
+				t.Errorf("proofByHash(%s)=%q; want to find %q", test.format, body, test.errStr)
+			}
+			continue
+		}
+		var rsp encodedProofResponse
+		if err := json.NewDecoder(w.Body).Decode(&rsp); err != nil {
+			t.Errorf("Failed to unmarshal json response %s: %v", w.Body.Bytes(), err)
+			continue
+		}
+		if !reflect.DeepEqual(rsp, test.wantRsp) {
+			t.Errorf("proofByHash(%s)=%+v; want %+v", test.format, rsp, test.wantRsp)
+		}
+	}
+}
+
+func TestGetSTHConsistencyFormat(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	handler := appHandler{context: info.c, handler: getSTHConsistency, name: "GetSTHConsistency", method: http.MethodGet}
+
+	rpcReq := &trillian.GetConsistencyProofRequest{LogId: 0x42, FirstTreeSize: 10, SecondTreeSize: 20, ProofFormat: trillian.ProofFormat_HASH_LIST}
+	rpcRsp := &trillian.GetConsistencyProofResponse{
+		Status: okStatus,
+		Proof:  &trillian.Proof{ProofNode: []*trillian.Node{{NodeHash: []byte("abcdef")}, {NodeHash: []byte("ghijkl")}}, EncodedPath: []byte("abcdefghijkl")},
+	}
+	info.client.EXPECT().GetConsistencyProof(deadlineMatcher(), rpcReq).Return(rpcRsp, nil)
+
+	req, err := http.NewRequest("GET", "/ct/v1/get-sth-consistency?first=10&second=20&proof_format=hash_list", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("getSTHConsistency()=%d (body:%v); want %d", got, w.Body, want)
+	}
+	var rsp encodedProofResponse
+	if err := json.NewDecoder(w.Body).Decode(&rsp); err != nil {
+		t.Fatalf("Failed to unmarshal json response: %v", err)
+	}
+	if want := (encodedProofResponse{Format: "hash_list", Proof: []byte("abcdefghijkl")}); !reflect.DeepEqual(rsp, want) {
+		t.Errorf("getSTHConsistency()=%+v; want %+v", rsp, want)
+	}
+}
@@ -0,0 +1,134 @@
+package ct
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+)
+
+const (
+	// GetProofsByHashPath is the path of the batch version of get-proof-by-hash, relative
+	// to the log's prefix. It isn't part of RFC 6962.
+	GetProofsByHashPath = "/ct/v1/get-proofs-by-hash"
+	// Max number of leaf hashes we allow in a get-proofs-by-hash request
+	maxGetProofsByHashAllowed = 100
+	// Max number of backend requests made in parallel for a get-proofs-by-hash request
+	getProofsByHashParallelism = 8
+)
+
+// GetProofsByHashRequest is the body of a get-proofs-by-hash request: a list of leaf
+// hashes, which are base64 encoded in the JSON, and the tree size to prove inclusion in.
+type GetProofsByHashRequest struct {
+	LeafHashes [][]byte `json:"leaf_hashes"`
+	TreeSize   int64    `json:"tree_size"`
+}
+
+// ProofByHash is the result for one leaf hash in a get-proofs-by-hash response. If the
+// proof couldn't be fetched Error says why and the other fields are unset.
+type ProofByHash struct {
+	LeafHash  []byte   `json:"leaf_hash"`
+	LeafIndex int64    `json:"leaf_index"`
+	AuditPath [][]byte `json:"audit_path,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// GetProofsByHashResponse holds the results of a get-proofs-by-hash request, in the same
+// order as the hashes in the request.
+type GetProofsByHashResponse struct {
+	Proofs []ProofByHash `json:"proofs"`
+}
+
+// getProofsByHash returns inclusion proofs for many leaves at once, so auditors checking
+// lots of SCTs don't have to make a round trip per certificate. The backend has no batch
+// proof RPC so the proofs are fetched with a bounded number of parallel requests. A proof
+// that can't be fetched doesn't fail the whole request, its entry in the response holds
+// the error instead.
+func getProofsByHash(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	var req GetProofsByHashRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("get-proofs-by-hash: failed to parse request body: %v", err)
+	}
+	if len(req.LeafHashes) == 0 || len(req.LeafHashes) > maxGetProofsByHashAllowed {
+		return http.StatusBadRequest, fmt.Errorf("get-proofs-by-hash: need between 1 and %d leaf hashes, got %d", maxGetProofsByHashAllowed, len(req.LeafHashes))
+	}
+	for i, hash := range req.LeafHashes {
+		if len(hash) == 0 {
+			return http.StatusBadRequest, fmt.Errorf("get-proofs-by-hash: empty leaf hash at position %d", i)
+		}
+	}
+	if req.TreeSize < 1 {
+		return http.StatusBadRequest, fmt.Errorf("get-proofs-by-hash: invalid tree_size: %d", req.TreeSize)
+	}
+
+	rsp := GetProofsByHashResponse{Proofs: make([]ProofByHash, len(req.LeafHashes))}
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < getProofsByHashParallelism && i < len(req.LeafHashes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indices {
+				rsp.Proofs[idx] = proofByHash(ctx, c, req.LeafHashes[idx], req.TreeSize)
+			}
+		}()
+	}
+	for i := range req.LeafHashes {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	// Running out of time fails whatever requests were left, so the results can't be
+	// trusted to say anything about the hashes.
+	if deadline, ok := ctx.Deadline(); ok && !c.timeSource.Now().Before(deadline) {
+		return http.StatusInternalServerError, errors.New("get-proofs-by-hash: deadline passed before all proofs were fetched")
+	}
+
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	jsonData, err := json.Marshal(&rsp)
+	if err != nil {
+		glog.Warningf("%s: Failed to marshal get-proofs-by-hash resp: %v", c.logPrefix, rsp)
+		return http.StatusInternalServerError, fmt.Errorf("failed to marshal get-proofs-by-hash resp: %v, error: %v", rsp, err)
+	}
+
+	_, err = w.Write(jsonData)
+	if err != nil {
+		// Probably too late for this as headers might have been written but we don't know for sure
+		return http.StatusInternalServerError, fmt.Errorf("failed to write get-proofs-by-hash resp: %v", rsp)
+	}
+
+	return http.StatusOK, nil
+}
+
+// proofByHash fetches the inclusion proof for a single leaf hash. As for get-proof-by-hash
+// the proof for the lowest index is returned if the hash is present more than once.
+func proofByHash(ctx context.Context, c LogContext, leafHash []byte, treeSize int64) ProofByHash {
+	result := ProofByHash{LeafHash: leafHash}
+	req := trillian.GetInclusionProofByHashRequest{
+		LogId:           c.logID,
+		LeafHash:        leafHash,
+		TreeSize:        treeSize,
+		OrderBySequence: true,
+	}
+	rsp, err := c.rpcClient.GetInclusionProofByHash(ctx, &req)
+	switch {
+	case err != nil:
+		result.Error = fmt.Sprintf("backend GetInclusionProofByHash request failed: %v", err)
+	case !rpcStatusOK(rsp.GetStatus()):
+		result.Error = fmt.Sprintf("backend GetInclusionProofByHash request failed, status=%v", rsp.GetStatus())
+	case len(rsp.Proof) == 0:
+		result.Error = "leaf hash not found"
+	case !checkAuditPath(rsp.Proof[0].ProofNode):
+		result.Error = "backend returned invalid proof"
+	default:
+		result.LeafIndex = rsp.Proof[0].LeafIndex
+		result.AuditPath = auditPathFromProto(rsp.Proof[0].ProofNode)
+	}
+	return result
+}
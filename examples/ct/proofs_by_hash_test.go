@@ -0,0 +1,110 @@
+package ct
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian"
+)
+
+func TestGetProofsByHashBadRequests(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	handler := appHandler{context: info.c, handler: getProofsByHash, name: "GetProofsByHash", method: http.MethodPost}
+
+	tooMany := GetProofsByHashRequest{TreeSize: 10}
+	for i := 0; i <= maxGetProofsByHashAllowed; i++ {
+		tooMany.LeafHashes = append(tooMany.LeafHashes, []byte("hash"))
+	}
+	tooManyBody, err := json.Marshal(tooMany)
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+
+	for _, body := range []string{
+		"",
+		"not json",
+		`{"leaf_hashes": [], "tree_size": 10}`,
+		`{"leaf_hashes": ["aGFzaA=="], "tree_size": 0}`,
+		`{"leaf_hashes": ["aGFzaA==", ""], "tree_size": 10}`,
+		string(tooManyBody),
+	} {
+		req, err := http.NewRequest(http.MethodPost, "/ct/v1/get-proofs-by-hash", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got, want := w.Code, http.StatusBadRequest; got != want {
+			t.Errorf("GetProofsByHash(%.40q)=%d, want %d", body, got, want)
+		}
+	}
+}
+
+func TestGetProofsByHash(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	handler := appHandler{context: info.c, handler: getProofsByHash, name: "GetProofsByHash", method: http.MethodPost}
+
+	proofRsp := func(index int64, nodes ...string) *trillian.GetInclusionProofByHashResponse {
+		proof := &trillian.Proof{LeafIndex: index}
+		for _, n := range nodes {
+			proof.ProofNode = append(proof.ProofNode, &trillian.Node{NodeHash: []byte(n)})
+		}
+		return &trillian.GetInclusionProofByHashResponse{Status: okStatus, Proof: []*trillian.Proof{proof}}
+	}
+
+	var tests = []struct {
+		hash   string
+		rpcRsp *trillian.GetInclusionProofByHashResponse
+		rpcErr error
+		want   ProofByHash
+	}{
+		{hash: "one", rpcRsp: proofRsp(1, "abcdef", "ghijkl"), want: ProofByHash{LeafIndex: 1, AuditPath: [][]byte{[]byte("abcdef"), []byte("ghijkl")}}},
+		{hash: "two", rpcRsp: proofRsp(0, "mnopqr"), want: ProofByHash{LeafIndex: 0, AuditPath: [][]byte{[]byte("mnopqr")}}},
+		{hash: "missing", rpcRsp: &trillian.GetInclusionProofByHashResponse{Status: okStatus}, want: ProofByHash{Error: "leaf hash not found"}},
+		{hash: "failed", rpcErr: errors.New("backendfailure"), want: ProofByHash{Error: "backend GetInclusionProofByHash request failed: backendfailure"}},
+		{hash: "invalid", rpcRsp: proofRsp(3, ""), want: ProofByHash{Error: "backend returned invalid proof"}},
+	}
+
+	body := GetProofsByHashRequest{TreeSize: 7}
+	for _, test := range tests {
+		body.LeafHashes = append(body.LeafHashes, []byte(test.hash))
+		req := &trillian.GetInclusionProofByHashRequest{LogId: 0x42, LeafHash: []byte(test.hash), TreeSize: 7, OrderBySequence: true}
+		info.client.EXPECT().GetInclusionProofByHash(deadlineMatcher(), req).Return(test.rpcRsp, test.rpcErr)
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "/ct/v1/get-proofs-by-hash", bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("GetProofsByHash()=%d, want %d; body: %s", got, want, w.Body)
+	}
+
+	var rsp GetProofsByHashResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+		t.Fatalf("GetProofsByHash() returned invalid JSON: %v", err)
+	}
+	if got, want := len(rsp.Proofs), len(tests); got != want {
+		t.Fatalf("GetProofsByHash() returned %d proofs, want %d", got, want)
+	}
+	for i, test := range tests {
+		test.want.LeafHash = []byte(test.hash)
+		if got := rsp.Proofs[i]; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("GetProofsByHash().Proofs[%d]=%+v, want %+v", i, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package ct
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+// Paths of the server's admin API for provisioning logs. Unlike the admin API of each
+// log they aren't under a log's prefix, and they only accept requests signed with one of
+// the server's admin keys.
+const (
+	AdminCreateLogPath = "/admin/v1/create-log"
+	AdminListLogsPath  = "/admin/v1/list-logs"
+)
+
+// AdminCreateLogRequest asks for a new log to be served.
+type AdminCreateLogRequest struct {
+	// Config is the new log's config, as it would appear in the config file. The files
+	// it names must already be on the server, apart from those given below.
+	Config LogConfig `json:"config"`
+	// RootsPEM, PrivKeyPEM and PubKeyPEM, if set, are written to new files in the
+	// server's provisioning directory, which are used as the log's RootsPEMFile,
+	// PrivKeyPEMFile and PubKeyPEMFile.
+	RootsPEM   string `json:"roots_pem,omitempty"`
+	PrivKeyPEM string `json:"priv_key_pem,omitempty"`
+	PubKeyPEM  string `json:"pub_key_pem,omitempty"`
+}
+
+// AdminLog describes a log served by the server.
+type AdminLog struct {
+	Prefix string `json:"prefix"`
+	LogID  int64  `json:"log_id"`
+}
+
+// AdminListLogsResponse is the response to an admin list-logs request.
+type AdminListLogsResponse struct {
+	Logs []AdminLog `json:"logs"`
+}
+
+// Provisioner serves the admin API for bringing up new logs while the server is running,
+// e.g. a new shard. A new log is set up and served straight away, and then added to the
+// server's config file so it's still served after a restart.
+type Provisioner struct {
+	configFile string
+	// dir is where the files given inline in requests are written
+	dir      string
+	verifier *requestVerifier
+	// setUp sets up and starts serving a log, it can be replaced for testing
+	setUp func(cfg LogConfig) (*LogContext, error)
+	// added, if set, is called for each log once it's being served
+	added func(cfg LogConfig)
+
+	// mu serializes changes to logs, instances and configFile
+	mu   sync.Mutex
+	logs []AdminLog
+	// instances are the logs set up by the provisioner, which it closes
+	instances []*LogContext
+}
+
+// NewProvisioner creates a Provisioner for a server whose logs, cfgs, were read from
+// configFile. New logs are set up with client and opts, and files given inline are
+// written to dir. Requests must be signed with one of keys. added, if not nil, is
+// called for each new log once it's being served.
+func NewProvisioner(configFile, dir string, cfgs []LogConfig, keys []RequestSigningKey, client trillian.TrillianLogClient, opts InstanceOptions, added func(cfg LogConfig)) (*Provisioner, error) {
+	if len(configFile) == 0 {
+		return nil, errors.New("provisioning logs needs a config file")
+	}
+	timeSource := opts.TimeSource
+	if timeSource == nil {
+		timeSource = util.SystemTimeSource{}
+	}
+	verifier, err := newRequestVerifier(keys, defaultMaxRequestSignatureAge, timeSource)
+	if err != nil {
+		return nil, err
+	}
+	p := &Provisioner{
+		configFile: configFile,
+		dir:        dir,
+		verifier:   verifier,
+		setUp: func(cfg LogConfig) (*LogContext, error) {
+			return cfg.SetUpInstance(client, opts)
+		},
+		added: added,
+	}
+	for _, cfg := range cfgs {
+		p.logs = append(p.logs, AdminLog{Prefix: normalizePrefix(cfg.Prefix), LogID: cfg.LogID})
+	}
+	return p, nil
+}
+
+// Close closes the logs created through the provisioner, once the server has stopped
+// serving them, giving up on their background work when ctx is done.
+func (p *Provisioner) Close(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var firstErr error
+	for _, instance := range p.instances {
+		if err := instance.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	p.instances = nil
+	return firstErr
+}
+
+// RegisterHandlers registers the provisioning API handlers on mux.
+func (p *Provisioner) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc(AdminCreateLogPath, p.handle(http.MethodPost, p.createLog))
+	mux.HandleFunc(AdminListLogsPath, p.handle(http.MethodGet, p.listLogs))
+}
+
+// handle checks the method and signature of requests before passing them to handler.
+func (p *Provisioner) handle(method string, handler func(w http.ResponseWriter, r *http.Request) (int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var status int
+		var err error
+		if r.Method != method {
+			status, err = http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", r.Method)
+		} else if _, verr := p.verifier.verify(r); verr != nil {
+			status, err = http.StatusUnauthorized, fmt.Errorf("request signature check failed: %v", verr)
+		} else {
+			status, err = handler(w, r)
+		}
+		if err != nil {
+			glog.Warningf("Admin %s failed: %v", r.URL.Path, err)
+			sendHTTPError(w, status, err)
+		}
+	}
+}
+
+func (p *Provisioner) listLogs(w http.ResponseWriter, r *http.Request) (int, error) {
+	p.mu.Lock()
+	rsp := AdminListLogsResponse{Logs: append([]AdminLog{}, p.logs...)}
+	p.mu.Unlock()
+	return writeJSON(w, rsp)
+}
+
+func (p *Provisioner) createLog(w http.ResponseWriter, r *http.Request) (int, error) {
+	var req AdminCreateLogRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to parse request: %v", err)
+	}
+	cfg := req.Config
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if status, err := p.checkNewLog(cfg); err != nil {
+		return status, err
+	}
+	written, err := p.writeInlineFiles(&cfg, req)
+	if err != nil {
+		removeFiles(written)
+		return http.StatusInternalServerError, err
+	}
+	instance, err := p.setUp(cfg)
+	if err != nil {
+		removeFiles(written)
+		return http.StatusBadRequest, fmt.Errorf("failed to set up log: %v", err)
+	}
+	p.instances = append(p.instances, instance)
+	log := AdminLog{Prefix: normalizePrefix(cfg.Prefix), LogID: cfg.LogID}
+	p.logs = append(p.logs, log)
+	if p.added != nil {
+		p.added(cfg)
+	}
+	glog.Infof("%s: admin created log %d", log.Prefix, log.LogID)
+
+	// The log can't be taken down again, so if it can't be saved the operator has to add
+	// it to the config file by hand.
+	if err := p.save(cfg); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("log %s is being served, but failed to add it to the config file: %v", log.Prefix, err)
+	}
+	return writeJSON(w, log)
+}
+
+// checkNewLog checks that cfg can be served alongside the existing logs. The rest of it
+// is checked when it's set up.
+func (p *Provisioner) checkNewLog(cfg LogConfig) (int, error) {
+	prefix := normalizePrefix(cfg.Prefix)
+	if prefix == "/" {
+		return http.StatusBadRequest, errors.New("new log needs a prefix")
+	}
+	for _, log := range p.logs {
+		if log.Prefix == prefix {
+			return http.StatusConflict, fmt.Errorf("prefix %s is already in use", prefix)
+		}
+		if log.LogID == cfg.LogID {
+			return http.StatusConflict, fmt.Errorf("log ID %d is already served at %s", cfg.LogID, log.Prefix)
+		}
+	}
+	// Whether the server asks for client certificates is fixed when it starts.
+	if len(cfg.ClientCAFile) > 0 {
+		return http.StatusBadRequest, errors.New("logs with a ClientCAFile can't be added while the server is running")
+	}
+	return http.StatusOK, nil
+}
+
+// writeInlineFiles writes the files given in req to the provisioning directory, and
+// points cfg at them. It returns the files it wrote, even if it fails.
+func (p *Provisioner) writeInlineFiles(cfg *LogConfig, req AdminCreateLogRequest) ([]string, error) {
+	var written []string
+	name := strings.Replace(strings.Trim(cfg.Prefix, "/"), "/", "_", -1)
+	for _, f := range []struct {
+		data   string
+		suffix string
+		perm   os.FileMode
+		field  *string
+	}{
+		{req.RootsPEM, "roots.pem", 0644, &cfg.RootsPEMFile},
+		{req.PrivKeyPEM, "key.pem", 0600, &cfg.PrivKeyPEMFile},
+		{req.PubKeyPEM, "pubkey.pem", 0644, &cfg.PubKeyPEMFile},
+	} {
+		if len(f.data) == 0 {
+			continue
+		}
+		if len(p.dir) == 0 {
+			return written, errors.New("server has no provisioning directory for files given in requests")
+		}
+		path := filepath.Join(p.dir, fmt.Sprintf("%s-%s", name, f.suffix))
+		if err := writeNewFile(path, []byte(f.data), f.perm); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+		*f.field = path
+	}
+	return written, nil
+}
+
+// writeNewFile writes data to a file that mustn't already exist.
+func writeNewFile(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			glog.Warningf("Failed to remove %s: %v", path, err)
+		}
+	}
+}
+
+// save adds cfg to the config file. The existing entries are kept as they are, rather
+// than being read into LogConfigs and written out again.
+func (p *Provisioner) save(cfg LogConfig) error {
+	data, err := ioutil.ReadFile(p.configFile)
+	if err != nil {
+		return err
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+	entry, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	data, err = json.MarshalIndent(append(entries, entry), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p.configFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.configFile)
+}
+
+// normalizePrefix returns prefix as it's registered: with a leading slash, and without a
+// trailing one.
+func normalizePrefix(prefix string) string {
+	return "/" + strings.Trim(prefix, "/")
+}
@@ -0,0 +1,163 @@
+package ct
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/trillian/examples/ct/testonly"
+	"github.com/google/trillian/util"
+)
+
+var provisionerSecret = bytes.Repeat([]byte("k"), 32)
+
+func newTestProvisioner(t *testing.T, dir string) (*Provisioner, string, *[]LogConfig) {
+	configFile := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(configFile, []byte(`[{"LogID": 1, "Prefix": "existing", "Extra": "kept"}]`), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	keys := []RequestSigningKey{{ID: "admin", Algorithm: SigningAlgorithmHMACSHA256, Key: base64.StdEncoding.EncodeToString(provisionerSecret)}}
+	var added []LogConfig
+	p, err := NewProvisioner(configFile, dir, []LogConfig{{LogID: 1, Prefix: "existing"}}, keys, nil, InstanceOptions{TimeSource: &util.FakeTimeSource{FakeTime: fakeTime}}, func(cfg LogConfig) {
+		added = append(added, cfg)
+	})
+	if err != nil {
+		t.Fatalf("NewProvisioner()=_,%v", err)
+	}
+	return p, configFile, &added
+}
+
+func provisionerRequest(t *testing.T, p *Provisioner, method, path string, body interface{}, sign bool) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatalf("Failed to marshal request: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, "http://example.com"+path, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if sign {
+		if err := SignRequestHMAC(req, "admin", provisionerSecret, fakeTime); err != nil {
+			t.Fatalf("SignRequestHMAC()=%v", err)
+		}
+	}
+	mux := http.NewServeMux()
+	p.RegisterHandlers(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestProvisionerCreateLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "provisioner")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	p, configFile, added := newTestProvisioner(t, dir)
+	var setUp []LogConfig
+	var setUpErr error
+	p.setUp = func(cfg LogConfig) (*LogContext, error) {
+		if setUpErr != nil {
+			return nil, setUpErr
+		}
+		setUp = append(setUp, cfg)
+		return &LogContext{}, nil
+	}
+
+	var tests = []struct {
+		descr      string
+		req        AdminCreateLogRequest
+		unsigned   bool
+		setUpErr   error
+		want       int
+		wantServed bool
+	}{
+		{descr: "unsigned", req: AdminCreateLogRequest{Config: LogConfig{LogID: 2, Prefix: "shard2"}}, unsigned: true, want: http.StatusUnauthorized},
+		{descr: "no-prefix", req: AdminCreateLogRequest{Config: LogConfig{LogID: 2}}, want: http.StatusBadRequest},
+		{descr: "prefix-in-use", req: AdminCreateLogRequest{Config: LogConfig{LogID: 2, Prefix: "/existing/"}}, want: http.StatusConflict},
+		{descr: "log-id-in-use", req: AdminCreateLogRequest{Config: LogConfig{LogID: 1, Prefix: "shard2"}}, want: http.StatusConflict},
+		{descr: "client-ca", req: AdminCreateLogRequest{Config: LogConfig{LogID: 2, Prefix: "shard2", ClientCAFile: "ca.pem"}}, want: http.StatusBadRequest},
+		{descr: "set-up-fails", req: AdminCreateLogRequest{Config: LogConfig{LogID: 2, Prefix: "shard2"}, RootsPEM: testonly.FakeCACertPEM}, setUpErr: errors.New("bad key"), want: http.StatusBadRequest},
+		{descr: "created", req: AdminCreateLogRequest{Config: LogConfig{LogID: 2, Prefix: "shard2"}, RootsPEM: testonly.FakeCACertPEM}, want: http.StatusOK, wantServed: true},
+		{descr: "created-again", req: AdminCreateLogRequest{Config: LogConfig{LogID: 3, Prefix: "shard2"}}, want: http.StatusConflict},
+	}
+
+	for _, test := range tests {
+		setUpErr = test.setUpErr
+		before := len(setUp)
+		w := provisionerRequest(t, p, http.MethodPost, AdminCreateLogPath, test.req, !test.unsigned)
+		if got, want := w.Code, test.want; got != want {
+			t.Errorf("%s: create-log=%d (%s), want %d", test.descr, got, w.Body, want)
+			continue
+		}
+		if got, want := len(setUp) > before, test.wantServed; got != want {
+			t.Errorf("%s: log set up: %v, want %v", test.descr, got, want)
+		}
+	}
+
+	// The roots file is written once the log is set up, and not left behind if it fails.
+	rootsFile := filepath.Join(dir, "shard2-roots.pem")
+	if len(setUp) != 1 {
+		t.Fatalf("set up %d logs, want 1", len(setUp))
+	}
+	if got, want := setUp[0].RootsPEMFile, rootsFile; got != want {
+		t.Errorf("RootsPEMFile=%s, want %s", got, want)
+	}
+	if data, err := ioutil.ReadFile(rootsFile); err != nil || string(data) != testonly.FakeCACertPEM {
+		t.Errorf("ReadFile(%s)=%q,%v, want the roots", rootsFile, data, err)
+	}
+	if got, want := len(*added), 1; got != want {
+		t.Errorf("added %d logs, want %d", got, want)
+	}
+
+	// The new log is added to the config file, and the existing entries are kept as
+	// they were.
+	cfgs, err := LogConfigFromFile(configFile)
+	if err != nil {
+		t.Fatalf("LogConfigFromFile()=_,%v", err)
+	}
+	if got, want := len(cfgs), 2; got != want {
+		t.Fatalf("config file has %d logs, want %d", got, want)
+	}
+	if got, want := cfgs[1].LogID, int64(2); got != want {
+		t.Errorf("config file log ID=%d, want %d", got, want)
+	}
+	if got, want := cfgs[1].RootsPEMFile, rootsFile; got != want {
+		t.Errorf("config file RootsPEMFile=%s, want %s", got, want)
+	}
+	var entries []map[string]interface{}
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		t.Fatalf("ReadFile()=_,%v", err)
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("Unmarshal()=%v", err)
+	}
+	if got, want := entries[0]["Extra"], "kept"; got != want {
+		t.Errorf("existing entry Extra=%v, want %v", got, want)
+	}
+
+	w := provisionerRequest(t, p, http.MethodGet, AdminListLogsPath, nil, true)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list-logs=%d (%s), want %d", w.Code, w.Body, http.StatusOK)
+	}
+	var rsp AdminListLogsResponse
+	if err := json.NewDecoder(w.Body).Decode(&rsp); err != nil {
+		t.Fatalf("Decode()=%v", err)
+	}
+	want := []AdminLog{{Prefix: "/existing", LogID: 1}, {Prefix: "/shard2", LogID: 2}}
+	if len(rsp.Logs) != len(want) || rsp.Logs[0] != want[0] || rsp.Logs[1] != want[1] {
+		t.Errorf("list-logs=%v, want %v", rsp.Logs, want)
+	}
+}
@@ -0,0 +1,58 @@
+// The ct_proxy binary accepts add-chain and add-pre-chain requests and submits them to
+// every log in its config file, returning the SCTs issued once they meet the configured
+// policy. Statistics are exported at /debug/vars.
+package main
+
+import (
+	"expvar"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/certificate-transparency/go/client"
+	"github.com/google/certificate-transparency/go/jsonclient"
+	"github.com/google/trillian/examples/ct/proxy"
+)
+
+var configFlag = flag.String("config", "", "File holding the JSON encoded logs to submit to and the policy their SCTs must meet")
+var listenAddrFlag = flag.String("listen_addr", "localhost:6966", "Address to serve submissions and statistics on")
+var deadlineFlag = flag.Duration("deadline", 30*time.Second, "How long each submission waits for the logs to meet the policy")
+
+func main() {
+	flag.Parse()
+	if len(*configFlag) == 0 {
+		glog.Exit("--config is required")
+	}
+	cfg, err := proxy.ConfigFromFile(*configFlag)
+	if err != nil {
+		glog.Exitf("Failed to read config: %v", err)
+	}
+
+	logs := make([]proxy.Log, 0, len(cfg.Logs))
+	for _, l := range cfg.Logs {
+		var opts jsonclient.Options
+		if len(l.PublicKeyFile) > 0 {
+			pubKey, err := ioutil.ReadFile(l.PublicKeyFile)
+			if err != nil {
+				glog.Exitf("Failed to read public key of log %s: %v", l.Name, err)
+			}
+			opts.PublicKey = string(pubKey)
+		}
+		logClient, err := client.New(l.URI, nil, opts)
+		if err != nil {
+			glog.Exitf("Failed to create client for log %s: %v", l.Name, err)
+		}
+		logs = append(logs, proxy.Log{Name: l.Name, Operator: l.Operator, Client: logClient})
+	}
+	p, err := proxy.New(logs, cfg.Policy, *deadlineFlag)
+	if err != nil {
+		glog.Exitf("Failed to create proxy: %v", err)
+	}
+	expvar.Publish("proxy", p.Vars())
+	p.RegisterHandlers(http.DefaultServeMux)
+
+	glog.Infof("Submitting to %d logs with policy %v, serving on %s", len(logs), cfg.Policy, *listenAddrFlag)
+	glog.Exitf("Server exited: %v", http.ListenAndServe(*listenAddrFlag, nil))
+}
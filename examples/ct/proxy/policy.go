@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Requirement asks for Count SCTs from logs of the operators it matches. A log matches if
+// its operator is Operator, when that's set, and isn't NotOperator, when that's set. A
+// requirement with neither set matches every log.
+type Requirement struct {
+	Operator    string
+	NotOperator string
+	Count       int
+}
+
+func (r Requirement) matches(operator string) bool {
+	if len(r.Operator) > 0 && operator != r.Operator {
+		return false
+	}
+	if len(r.NotOperator) > 0 && operator == r.NotOperator {
+		return false
+	}
+	return true
+}
+
+func (r Requirement) String() string {
+	switch {
+	case len(r.Operator) > 0:
+		return fmt.Sprintf("%d %s", r.Count, r.Operator)
+	case len(r.NotOperator) > 0:
+		return fmt.Sprintf("%d non-%s", r.Count, r.NotOperator)
+	}
+	return fmt.Sprintf("%d any", r.Count)
+}
+
+// Policy is a set of requirements that must all be met by a bundle of SCTs, each SCT
+// counting towards at most one of them. For example 2 SCTs from Google logs and 1 from a
+// log not run by Google is:
+//
+//	[{"Operator": "Google", "Count": 2}, {"NotOperator": "Google", "Count": 1}]
+type Policy []Requirement
+
+// Validate checks that the policy asks for at least one SCT, and that its counts make
+// sense.
+func (p Policy) Validate() error {
+	if len(p) == 0 {
+		return errors.New("policy has no requirements")
+	}
+	for _, r := range p {
+		if r.Count <= 0 {
+			return fmt.Errorf("requirement %+v must have a positive count", r)
+		}
+		if len(r.Operator) > 0 && r.Operator == r.NotOperator {
+			return fmt.Errorf("requirement %+v can never be met", r)
+		}
+	}
+	return nil
+}
+
+// Satisfied returns true if SCTs from logs run by the given operators, one entry per
+// SCT, meet every requirement of the policy.
+func (p Policy) Satisfied(operators []string) bool {
+	// Each requirement is expanded into Count slots, and the SCTs matched to them: the
+	// policy is met if every slot can be filled by a different SCT. Requirements may
+	// overlap, so a simple greedy assignment isn't enough.
+	var slots []Requirement
+	for _, r := range p {
+		for i := 0; i < r.Count; i++ {
+			slots = append(slots, r)
+		}
+	}
+	if len(slots) > len(operators) {
+		return false
+	}
+	// filledBy[i] is the index of the SCT filling slot i, or -1.
+	filledBy := make([]int, len(slots))
+	for i := range filledBy {
+		filledBy[i] = -1
+	}
+	var fill func(sct int, seen []bool) bool
+	fill = func(sct int, seen []bool) bool {
+		for i, slot := range slots {
+			if seen[i] || !slot.matches(operators[sct]) {
+				continue
+			}
+			seen[i] = true
+			if filledBy[i] < 0 || fill(filledBy[i], seen) {
+				filledBy[i] = sct
+				return true
+			}
+		}
+		return false
+	}
+	filled := 0
+	for sct := range operators {
+		if fill(sct, make([]bool, len(slots))) {
+			filled++
+		}
+	}
+	return filled == len(slots)
+}
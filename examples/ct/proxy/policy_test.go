@@ -0,0 +1,48 @@
+package proxy
+
+import "testing"
+
+func TestPolicySatisfied(t *testing.T) {
+	googlePlusOne := Policy{{Operator: "Google", Count: 2}, {NotOperator: "Google", Count: 1}}
+	var tests = []struct {
+		policy    Policy
+		operators []string
+		want      bool
+	}{
+		{googlePlusOne, nil, false},
+		{googlePlusOne, []string{"Google", "Google"}, false},
+		{googlePlusOne, []string{"Google", "DigiCert"}, false},
+		{googlePlusOne, []string{"Google", "DigiCert", "Google"}, true},
+		{googlePlusOne, []string{"Google", "Google", "Google"}, false},
+		{googlePlusOne, []string{"DigiCert", "Trillian", "Google", "Google"}, true},
+		{Policy{{Count: 2}}, []string{"Google", "DigiCert"}, true},
+		{Policy{{Count: 3}}, []string{"Google", "DigiCert"}, false},
+		// The first SCT could count towards either requirement, but has to be
+		// counted towards the second for both to be met.
+		{Policy{{Count: 1}, {Operator: "Google", Count: 1}}, []string{"Google", "DigiCert"}, true},
+		{Policy{{NotOperator: "DigiCert", Count: 1}, {Operator: "Google", Count: 1}}, []string{"Google", "Trillian"}, true},
+	}
+	for _, test := range tests {
+		if got, want := test.policy.Satisfied(test.operators), test.want; got != want {
+			t.Errorf("Policy(%v).Satisfied(%v)=%v, want %v", test.policy, test.operators, got, want)
+		}
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	var tests = []struct {
+		policy  Policy
+		wantErr bool
+	}{
+		{Policy{{Operator: "Google", Count: 2}, {NotOperator: "Google", Count: 1}}, false},
+		{Policy{{Count: 1}}, false},
+		{nil, true},
+		{Policy{{Operator: "Google"}}, true},
+		{Policy{{Operator: "Google", NotOperator: "Google", Count: 1}}, true},
+	}
+	for _, test := range tests {
+		if err := test.policy.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("Policy(%v).Validate()=%v, want error: %v", test.policy, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Package proxy submits chains to a set of CT logs at once, on behalf of a CA. A chain
+// sent to the proxy's add-chain or add-pre-chain endpoint is forwarded to every log it's
+// configured with, and SCTs are collected until there are enough to meet a policy, such as
+// 2 from Google logs and 1 from another operator. It's meant for testing CA integrations
+// against a set of logs that can include a Trillian CT log.
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"golang.org/x/net/context"
+)
+
+// Submitter is the part of a CT log client used to submit chains. It's implemented by
+// the client.LogClient of the CT library.
+type Submitter interface {
+	AddChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error)
+	AddPreChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error)
+}
+
+// LogConfig describes one of the logs chains are submitted to.
+type LogConfig struct {
+	// Name identifies the log in responses and statistics
+	Name string
+	// URI is the base URI of the log, e.g. https://ct.googleapis.com/pilot
+	URI string
+	// PublicKeyFile holds the log's PEM encoded public key. If set, the signature of
+	// each SCT from the log is checked, and SCTs that don't verify aren't used.
+	PublicKeyFile string
+	// Operator is the organization running the log, as named in the policy
+	Operator string
+}
+
+// Config is the contents of a proxy config file.
+type Config struct {
+	Logs   []LogConfig
+	Policy Policy
+}
+
+// ConfigFromFile reads and checks a JSON encoded Config.
+func ConfigFromFile(filename string) (Config, error) {
+	var cfg Config
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse %s: %v", filename, err)
+	}
+	for _, l := range cfg.Logs {
+		if len(l.URI) == 0 {
+			return cfg, fmt.Errorf("log %q has no URI", l.Name)
+		}
+	}
+	return cfg, nil
+}
+
+// Log is a log chains are submitted to.
+type Log struct {
+	Name     string
+	Operator string
+	Client   Submitter
+}
+
+// LogSCT is an SCT issued by one of the logs, in the form it's returned by add-chain.
+type LogSCT struct {
+	Log      string              `json:"log"`
+	Operator string              `json:"operator"`
+	SCT      ct.AddChainResponse `json:"sct"`
+}
+
+// SCTBundle is the response to a submission to the proxy.
+type SCTBundle struct {
+	SCTs []LogSCT `json:"scts"`
+}
+
+// PolicyError is returned when the logs didn't issue enough SCTs to meet the policy.
+type PolicyError struct {
+	// Bundle holds the SCTs that were issued
+	Bundle *SCTBundle
+	// Failures maps the name of each log that didn't issue an SCT to the reason why
+	Failures map[string]string
+}
+
+func (e *PolicyError) Error() string {
+	names := make([]string, 0, len(e.Failures))
+	for name := range e.Failures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	failures := make([]string, 0, len(names))
+	for _, name := range names {
+		failures = append(failures, fmt.Sprintf("%s: %s", name, e.Failures[name]))
+	}
+	return fmt.Sprintf("policy not met with %d SCTs (%s)", len(e.Bundle.SCTs), strings.Join(failures, "; "))
+}
+
+// Proxy fans submissions out to its logs.
+type Proxy struct {
+	logs     []Log
+	policy   Policy
+	deadline time.Duration
+
+	exp struct {
+		vars        *expvar.Map
+		submissions *expvar.Int
+		policyMet   *expvar.Int
+		policyUnmet *expvar.Int
+		// scts and failures are keyed by log name
+		scts     *expvar.Map
+		failures *expvar.Map
+	}
+}
+
+// New creates a Proxy that submits to logs until their SCTs meet policy, waiting at
+// most deadline for each submission.
+func New(logs []Log, policy Policy, deadline time.Duration) (*Proxy, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	if deadline <= 0 {
+		return nil, fmt.Errorf("deadline %v must be positive", deadline)
+	}
+	names := make(map[string]bool)
+	operators := make([]string, 0, len(logs))
+	for _, l := range logs {
+		if len(l.Name) == 0 {
+			return nil, errors.New("log has no name")
+		}
+		if names[l.Name] {
+			return nil, fmt.Errorf("log %s is configured more than once", l.Name)
+		}
+		names[l.Name] = true
+		operators = append(operators, l.Operator)
+	}
+	if !policy.Satisfied(operators) {
+		return nil, fmt.Errorf("policy %v can't be met by the %d logs configured", policy, len(logs))
+	}
+
+	p := &Proxy{logs: logs, policy: policy, deadline: deadline}
+	p.exp.vars = new(expvar.Map).Init()
+	p.exp.submissions = new(expvar.Int)
+	p.exp.policyMet = new(expvar.Int)
+	p.exp.policyUnmet = new(expvar.Int)
+	p.exp.scts = new(expvar.Map).Init()
+	p.exp.failures = new(expvar.Map).Init()
+	p.exp.vars.Set("submissions", p.exp.submissions)
+	p.exp.vars.Set("policy-met", p.exp.policyMet)
+	p.exp.vars.Set("policy-unmet", p.exp.policyUnmet)
+	p.exp.vars.Set("scts", p.exp.scts)
+	p.exp.vars.Set("failures", p.exp.failures)
+	return p, nil
+}
+
+// Vars returns the statistics kept by the proxy.
+func (p *Proxy) Vars() *expvar.Map {
+	return p.exp.vars
+}
+
+type logResult struct {
+	log *Log
+	sct *ct.SignedCertificateTimestamp
+	err error
+}
+
+// Submit sends chain to every log at once, and returns the SCTs issued as soon as they
+// meet the policy. Logs that haven't replied by then are abandoned. If every log replies,
+// or the deadline passes, without the policy being met the error is a *PolicyError.
+func (p *Proxy) Submit(ctx context.Context, chain []ct.ASN1Cert, isPrecert bool) (*SCTBundle, error) {
+	p.exp.submissions.Add(1)
+	ctx, cancel := context.WithTimeout(ctx, p.deadline)
+	defer cancel()
+
+	// The channel is big enough for every log, so abandoned submissions don't block.
+	results := make(chan logResult, len(p.logs))
+	for i := range p.logs {
+		go func(l *Log) {
+			var sct *ct.SignedCertificateTimestamp
+			var err error
+			if isPrecert {
+				sct, err = l.Client.AddPreChain(ctx, chain)
+			} else {
+				sct, err = l.Client.AddChain(ctx, chain)
+			}
+			results <- logResult{log: l, sct: sct, err: err}
+		}(&p.logs[i])
+	}
+
+	bundle := &SCTBundle{}
+	var operators []string
+	failures := make(map[string]string)
+	pending := make(map[string]bool)
+	for _, l := range p.logs {
+		pending[l.Name] = true
+	}
+	for len(pending) > 0 {
+		var res logResult
+		select {
+		case res = <-results:
+		case <-ctx.Done():
+			for name := range pending {
+				failures[name] = ctx.Err().Error()
+				p.exp.failures.Add(name, 1)
+			}
+			pending = nil
+			continue
+		}
+		delete(pending, res.log.Name)
+		if res.err == nil {
+			var rsp ct.AddChainResponse
+			if rsp, res.err = addChainResponse(res.sct); res.err == nil {
+				p.exp.scts.Add(res.log.Name, 1)
+				bundle.SCTs = append(bundle.SCTs, LogSCT{Log: res.log.Name, Operator: res.log.Operator, SCT: rsp})
+				operators = append(operators, res.log.Operator)
+				if p.policy.Satisfied(operators) {
+					p.exp.policyMet.Add(1)
+					return bundle, nil
+				}
+				continue
+			}
+		}
+		glog.V(1).Infof("submission to %s failed: %v", res.log.Name, res.err)
+		failures[res.log.Name] = res.err.Error()
+		p.exp.failures.Add(res.log.Name, 1)
+	}
+	p.exp.policyUnmet.Add(1)
+	return nil, &PolicyError{Bundle: bundle, Failures: failures}
+}
+
+// addChainResponse converts an SCT back to the form the log returned it in.
+func addChainResponse(sct *ct.SignedCertificateTimestamp) (ct.AddChainResponse, error) {
+	sig, err := tls.Marshal(sct.Signature)
+	if err != nil {
+		return ct.AddChainResponse{}, fmt.Errorf("failed to marshal signature: %v", err)
+	}
+	return ct.AddChainResponse{
+		SCTVersion: sct.SCTVersion,
+		ID:         sct.LogID.KeyID[:],
+		Timestamp:  sct.Timestamp,
+		Extensions: base64.StdEncoding.EncodeToString(sct.Extensions),
+		Signature:  sig,
+	}, nil
+}
+
+// RegisterHandlers registers the proxy's add-chain and add-pre-chain endpoints with mux.
+// They take the same requests as those of a log, and return an SCTBundle.
+func (p *Proxy) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc(ct.AddChainPath, func(w http.ResponseWriter, r *http.Request) {
+		p.serveSubmission(w, r, false)
+	})
+	mux.HandleFunc(ct.AddPreChainPath, func(w http.ResponseWriter, r *http.Request) {
+		p.serveSubmission(w, r, true)
+	})
+}
+
+func (p *Proxy) serveSubmission(w http.ResponseWriter, r *http.Request, isPrecert bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	var req ct.AddChainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Chain) == 0 {
+		http.Error(w, "cert chain was empty", http.StatusBadRequest)
+		return
+	}
+	chain := make([]ct.ASN1Cert, 0, len(req.Chain))
+	for _, der := range req.Chain {
+		chain = append(chain, ct.ASN1Cert{Data: der})
+	}
+
+	bundle, err := p.Submit(context.Background(), chain, isPrecert)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(bundle); err != nil {
+		glog.Warningf("failed to write SCT bundle: %v", err)
+	}
+}
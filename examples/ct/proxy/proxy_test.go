@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"golang.org/x/net/context"
+)
+
+// fakeSubmitter issues an SCT, or fails, after a delay. It blocks until the submission is
+// abandoned if hang is set.
+type fakeSubmitter struct {
+	id        byte
+	delay     time.Duration
+	err       error
+	hang      bool
+	precerts  chan bool
+	abandoned chan bool
+}
+
+func (f *fakeSubmitter) submit(ctx context.Context, isPrecert bool) (*ct.SignedCertificateTimestamp, error) {
+	if f.precerts != nil {
+		f.precerts <- isPrecert
+	}
+	if f.hang {
+		<-ctx.Done()
+		if f.abandoned != nil {
+			f.abandoned <- true
+		}
+		return nil, ctx.Err()
+	}
+	time.Sleep(f.delay)
+	if f.err != nil {
+		return nil, f.err
+	}
+	sct := &ct.SignedCertificateTimestamp{
+		SCTVersion: ct.V1,
+		Timestamp:  1000 + uint64(f.id),
+		Signature: ct.DigitallySigned{
+			Algorithm: tls.SignatureAndHashAlgorithm{Hash: tls.SHA256, Signature: tls.ECDSA},
+			Signature: []byte{f.id},
+		},
+	}
+	sct.LogID.KeyID[0] = f.id
+	return sct, nil
+}
+
+func (f *fakeSubmitter) AddChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+	return f.submit(ctx, false)
+}
+
+func (f *fakeSubmitter) AddPreChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+	return f.submit(ctx, true)
+}
+
+var googlePlusOne = Policy{{Operator: "Google", Count: 2}, {NotOperator: "Google", Count: 1}}
+
+func TestNew(t *testing.T) {
+	var tests = []struct {
+		descr    string
+		logs     []Log
+		policy   Policy
+		deadline time.Duration
+		wantErr  bool
+	}{
+		{descr: "ok", logs: []Log{{Name: "a", Operator: "Google"}, {Name: "b", Operator: "Google"}, {Name: "c"}}, policy: googlePlusOne, deadline: time.Second},
+		{descr: "not-enough-logs", logs: []Log{{Name: "a", Operator: "Google"}, {Name: "b"}}, policy: googlePlusOne, deadline: time.Second, wantErr: true},
+		{descr: "duplicate-name", logs: []Log{{Name: "a"}, {Name: "a"}}, policy: Policy{{Count: 1}}, deadline: time.Second, wantErr: true},
+		{descr: "no-name", logs: []Log{{}}, policy: Policy{{Count: 1}}, deadline: time.Second, wantErr: true},
+		{descr: "no-deadline", logs: []Log{{Name: "a"}}, policy: Policy{{Count: 1}}, wantErr: true},
+		{descr: "no-policy", logs: []Log{{Name: "a"}}, deadline: time.Second, wantErr: true},
+	}
+	for _, test := range tests {
+		if _, err := New(test.logs, test.policy, test.deadline); (err != nil) != test.wantErr {
+			t.Errorf("%s: New()=_,%v, want error: %v", test.descr, err, test.wantErr)
+		}
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	abandoned := make(chan bool, 1)
+	logs := []Log{
+		{Name: "google1", Operator: "Google", Client: &fakeSubmitter{id: 1}},
+		{Name: "google2", Operator: "Google", Client: &fakeSubmitter{id: 2, delay: 10 * time.Millisecond}},
+		{Name: "google3", Operator: "Google", Client: &fakeSubmitter{hang: true, abandoned: abandoned}},
+		{Name: "other1", Operator: "DigiCert", Client: &fakeSubmitter{err: errors.New("chain rejected")}},
+		{Name: "other2", Operator: "Trillian", Client: &fakeSubmitter{id: 3, delay: 20 * time.Millisecond}},
+	}
+	p, err := New(logs, googlePlusOne, time.Minute)
+	if err != nil {
+		t.Fatalf("New()=_,%v", err)
+	}
+	bundle, err := p.Submit(context.Background(), []ct.ASN1Cert{{Data: []byte("cert")}}, false)
+	if err != nil {
+		t.Fatalf("Submit()=_,%v", err)
+	}
+	var got []string
+	for _, sct := range bundle.SCTs {
+		got = append(got, sct.Log)
+	}
+	if want := []string{"google1", "google2", "other2"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("Submit() SCTs from %v, want %v", got, want)
+	}
+	if got, want := bundle.SCTs[2].SCT.ID[0], byte(3); got != want {
+		t.Errorf("Submit() SCT log ID[0]=%d, want %d", got, want)
+	}
+	// The log that never replies is abandoned once the policy is met.
+	select {
+	case <-abandoned:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Submit() didn't abandon the hanging log")
+	}
+
+	for _, v := range []struct {
+		name string
+		want string
+	}{
+		{"submissions", "1"},
+		{"policy-met", "1"},
+		{"policy-unmet", "0"},
+	} {
+		if got := p.Vars().Get(v.name).String(); got != v.want {
+			t.Errorf("%s=%s, want %s", v.name, got, v.want)
+		}
+	}
+}
+
+func TestSubmitPolicyUnmet(t *testing.T) {
+	logs := []Log{
+		{Name: "google1", Operator: "Google", Client: &fakeSubmitter{id: 1}},
+		{Name: "google2", Operator: "Google", Client: &fakeSubmitter{hang: true}},
+		{Name: "other1", Operator: "DigiCert", Client: &fakeSubmitter{err: errors.New("chain rejected")}},
+		{Name: "other2", Operator: "Trillian", Client: &fakeSubmitter{id: 3}},
+	}
+	p, err := New(logs, googlePlusOne, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("New()=_,%v", err)
+	}
+	_, err = p.Submit(context.Background(), []ct.ASN1Cert{{Data: []byte("cert")}}, false)
+	perr, ok := err.(*PolicyError)
+	if !ok {
+		t.Fatalf("Submit()=_,%v, want a PolicyError", err)
+	}
+	if got, want := len(perr.Bundle.SCTs), 2; got != want {
+		t.Errorf("PolicyError has %d SCTs, want %d", got, want)
+	}
+	if got, want := len(perr.Failures), 2; got != want {
+		t.Errorf("PolicyError has %d failures (%v), want %d", got, perr.Failures, want)
+	}
+	if got, want := perr.Failures["other1"], "chain rejected"; got != want {
+		t.Errorf("failure of other1=%q, want %q", got, want)
+	}
+	if got, want := p.Vars().Get("failures").(*expvar.Map).Get("google2").String(), "1"; got != want {
+		t.Errorf("failures of google2=%s, want %s", got, want)
+	}
+}
+
+func TestServeSubmission(t *testing.T) {
+	precerts := make(chan bool, 1)
+	logs := []Log{{Name: "log", Client: &fakeSubmitter{id: 1, precerts: precerts}}}
+	p, err := New(logs, Policy{{Count: 1}}, time.Minute)
+	if err != nil {
+		t.Fatalf("New()=_,%v", err)
+	}
+	mux := http.NewServeMux()
+	p.RegisterHandlers(mux)
+
+	var tests = []struct {
+		descr       string
+		method      string
+		path        string
+		body        string
+		want        int
+		wantPrecert bool
+	}{
+		{descr: "get", method: http.MethodGet, path: ct.AddChainPath, want: http.StatusMethodNotAllowed},
+		{descr: "bad-json", method: http.MethodPost, path: ct.AddChainPath, body: "{", want: http.StatusBadRequest},
+		{descr: "empty-chain", method: http.MethodPost, path: ct.AddChainPath, body: `{"chain": []}`, want: http.StatusBadRequest},
+		{descr: "add-chain", method: http.MethodPost, path: ct.AddChainPath, body: `{"chain": ["Y2VydA=="]}`, want: http.StatusOK},
+		{descr: "add-pre-chain", method: http.MethodPost, path: ct.AddPreChainPath, body: `{"chain": ["Y2VydA=="]}`, want: http.StatusOK, wantPrecert: true},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, "http://example.com"+test.path, bytes.NewReader([]byte(test.body)))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if got, want := w.Code, test.want; got != want {
+			t.Errorf("%s: %s=%d (%s), want %d", test.descr, test.path, got, w.Body, want)
+			continue
+		}
+		if test.want != http.StatusOK {
+			continue
+		}
+		if got, want := <-precerts, test.wantPrecert; got != want {
+			t.Errorf("%s: submitted as precert: %v, want %v", test.descr, got, want)
+		}
+		var bundle SCTBundle
+		if err := json.NewDecoder(w.Body).Decode(&bundle); err != nil {
+			t.Errorf("%s: failed to decode SCT bundle: %v", test.descr, err)
+			continue
+		}
+		if got, want := len(bundle.SCTs), 1; got != want {
+			t.Errorf("%s: bundle has %d SCTs, want %d", test.descr, got, want)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"expvar"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+)
+
+const (
+	// Default interval between polls of a replica's source log
+	defaultReplicaPollInterval = time.Minute
+	// Default number of entries asked for in each get-entries request to the source log
+	defaultReplicaBatchSize = 256
+	// The merge deadline of a replicated leaf is this plus its index in the source log.
+	// The deadlines only set the order the sequencer integrates the leaves in, and are far
+	// enough in the future (in 2116) that the backend doesn't think they're overdue.
+	replicaDeadlineBase = math.MaxInt64 / 2
+	// How long a pass waits for a queued batch to be integrated before giving up
+	defaultReplicaIntegrationWait = 10 * time.Minute
+	// How often the backend's tree size is checked while waiting for a batch
+	defaultReplicaIntegrationPoll = time.Second
+)
+
+// errLogReplica is returned to submitters of a log that's a replica of another.
+var errLogReplica = jsonError{ErrorResponse{Error: "log_replica", Message: "log is a read-only replica of another log and doesn't accept submissions"}}
+
+// replicaSource is the part of a CT log client used to replicate a log. It's implemented
+// by the client.LogClient of the CT library.
+type replicaSource interface {
+	GetSTH(ctx context.Context) (*ct.SignedTreeHead, error)
+	GetSTHConsistency(ctx context.Context, first, second uint64) ([][]byte, error)
+	GetRawEntries(ctx context.Context, start, end int64) (*ct.GetEntriesResponse, error)
+	GetAcceptedRoots(ctx context.Context) ([]ct.ASN1Cert, error)
+}
+
+// replicator makes a log a read-only replica of another CT log, its source. Each pass
+// fetches the source's latest STH, checks its signature and its consistency with the last
+// one verified, and copies the entries the log doesn't have yet into the backend's tree,
+// in the source's order. Leaves are queued a batch at a time with merge deadlines that
+// increase with their index in the source, so the sequencer integrates them in order, and
+// each batch is integrated before the next is queued. Once the tree has as many entries as the STH its root must
+// match the STH's, which proves the tree holds exactly the source's entries, and the STH
+// is served from get-sth. The tree must not be written to by anything else, and must allow
+// duplicate leaves, as a CT log can hold the same entry twice.
+//
+// Each leaf is queued with an identity hash made from its index in the source log, so if
+// a pass is interrupted, e.g. by a restart, the entries it queued aren't added again.
+type replicator struct {
+	prefix          string
+	logID           int64
+	backend         trillian.TrillianLogClient
+	deadline        time.Duration
+	source          replicaSource
+	sigVerifier     sthVerifier
+	logVerifier     merkle.LogVerifier
+	roots           *TrustedRoots
+	batchSize       int64
+	integrationWait time.Duration
+	integrationPoll time.Duration
+	done            chan struct{}
+
+	// mu guards verified, the latest source STH the tree has been checked against
+	mu       sync.RWMutex
+	verified *ct.SignedTreeHead
+
+	exp struct {
+		vars                *expvar.Map
+		passes              *expvar.Int
+		failures            *expvar.Int
+		sourceTreeSize      *expvar.Int
+		verifiedTreeSize    *expvar.Int
+		entriesReplicated   *expvar.Int
+		signatureFailures   *expvar.Int
+		consistencyFailures *expvar.Int
+		rootMismatches      *expvar.Int
+	}
+}
+
+// newReplicator creates a replicator for the log c, copying entries from source, whose tree
+// heads are signed by the PEM encoded public key sourceKeyPEM, batchSize at a time. The
+// roots the log serves are replaced by the source's.
+func newReplicator(c LogContext, source replicaSource, sourceKeyPEM []byte, batchSize int64) (*replicator, error) {
+	pubKey, _, _, err := ct.PublicKeyFromPEM(sourceKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse source log public key: %v", err)
+	}
+	sigVerifier, err := newSTHVerifier(pubKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source log public key: %v", err)
+	}
+	r := &replicator{
+		prefix:          c.logPrefix,
+		logID:           c.logID,
+		backend:         c.rpcClient,
+		deadline:        c.rpcDeadline,
+		source:          source,
+		sigVerifier:     sigVerifier,
+		logVerifier:     merkle.NewLogVerifier(merkle.NewRFC6962TreeHasher(crypto.NewSHA256())),
+		roots:           c.trustedRoots,
+		batchSize:       batchSize,
+		integrationWait: defaultReplicaIntegrationWait,
+		integrationPoll: defaultReplicaIntegrationPoll,
+		done:            make(chan struct{}),
+	}
+	r.exp.vars = new(expvar.Map).Init()
+	for _, v := range []struct {
+		name string
+		v    **expvar.Int
+	}{
+		{"passes", &r.exp.passes},
+		{"pass-failures", &r.exp.failures},
+		{"source-tree-size", &r.exp.sourceTreeSize},
+		{"verified-tree-size", &r.exp.verifiedTreeSize},
+		{"entries-replicated", &r.exp.entriesReplicated},
+		{"signature-failures", &r.exp.signatureFailures},
+		{"consistency-failures", &r.exp.consistencyFailures},
+		{"root-mismatches", &r.exp.rootMismatches},
+	} {
+		*v.v = new(expvar.Int)
+		r.exp.vars.Set(v.name, *v.v)
+	}
+	return r, nil
+}
+
+// Start starts a goroutine that replicates the source log straight away, and then every
+// interval until Stop is called.
+func (r *replicator) Start(interval time.Duration) {
+	go func() {
+		r.passAndLog()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+				r.passAndLog()
+			}
+		}
+	}()
+}
+
+// Stop stops replicating the source log.
+func (r *replicator) Stop() {
+	close(r.done)
+}
+
+// Vars returns the statistics exported by this replicator.
+func (r *replicator) Vars() *expvar.Map {
+	return r.exp.vars
+}
+
+// latest returns the latest source STH the tree has been verified against, or nil if
+// there's none yet.
+func (r *replicator) latest() *ct.SignedTreeHead {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.verified
+}
+
+func (r *replicator) passAndLog() {
+	if err := r.pass(context.Background()); err != nil {
+		r.exp.failures.Add(1)
+		glog.Warningf("%s: failed to replicate source log: %v", r.prefix, err)
+	}
+}
+
+// pass brings the tree up to date with the source's latest STH.
+func (r *replicator) pass(ctx context.Context) error {
+	r.exp.passes.Add(1)
+	if err := r.updateRoots(ctx); err != nil {
+		// The log can carry on with the roots it has.
+		glog.Warningf("%s: failed to fetch source log roots: %v", r.prefix, err)
+	}
+
+	sth, err := r.fetchSTH(ctx)
+	if err != nil {
+		return err
+	}
+	r.exp.sourceTreeSize.Set(int64(sth.TreeSize))
+	if err := r.checkConsistency(ctx, sth); err != nil {
+		return err
+	}
+	if latest := r.latest(); latest != nil && sth.TreeSize <= latest.TreeSize {
+		// Nothing new, or a stale tree head from one of the source's frontends.
+		return nil
+	}
+
+	size, _, err := r.backendRoot(ctx)
+	if err != nil {
+		return err
+	}
+	if size > int64(sth.TreeSize) {
+		// The tree is ahead of this STH, so it can't be checked against it. A later STH
+		// will catch up with it.
+		glog.V(1).Infof("%s: tree size %d is ahead of source tree size %d", r.prefix, size, sth.TreeSize)
+		return nil
+	}
+	for size < int64(sth.TreeSize) {
+		if size, err = r.copyBatch(ctx, size, int64(sth.TreeSize)); err != nil {
+			return err
+		}
+	}
+
+	size, root, err := r.backendRoot(ctx)
+	if err != nil {
+		return err
+	}
+	if size != int64(sth.TreeSize) {
+		return fmt.Errorf("tree size %d after replicating, want %d", size, sth.TreeSize)
+	}
+	// The backend's root of an empty tree needn't be the RFC 6962 one, and there's
+	// nothing to check.
+	if size > 0 && !bytes.Equal(root, sth.SHA256RootHash[:]) {
+		r.exp.rootMismatches.Add(1)
+		return fmt.Errorf("tree root %x at size %d doesn't match the source log's %x", root, size, sth.SHA256RootHash)
+	}
+	r.mu.Lock()
+	r.verified = sth
+	r.mu.Unlock()
+	r.exp.verifiedTreeSize.Set(int64(sth.TreeSize))
+	glog.V(1).Infof("%s: verified replica against source tree size %d", r.prefix, sth.TreeSize)
+	return nil
+}
+
+// updateRoots replaces the roots the log serves with the source's.
+func (r *replicator) updateRoots(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.deadline)
+	defer cancel()
+	certs, err := r.source.GetAcceptedRoots(ctx)
+	if err != nil {
+		return err
+	}
+	pool := NewPEMCertPool()
+	for _, cert := range certs {
+		parsed, err := x509.ParseCertificate(cert.Data)
+		if err != nil {
+			return fmt.Errorf("failed to parse root: %v", err)
+		}
+		pool.AddCert(parsed)
+	}
+	r.roots.Update(pool)
+	return nil
+}
+
+// fetchSTH fetches the source's latest STH and checks its signature.
+func (r *replicator) fetchSTH(ctx context.Context) (*ct.SignedTreeHead, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.deadline)
+	defer cancel()
+	sth, err := r.source.GetSTH(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch source STH: %v", err)
+	}
+	if err := r.sigVerifier.VerifySTHSignature(*sth); err != nil {
+		r.exp.signatureFailures.Add(1)
+		return nil, fmt.Errorf("source STH signature doesn't verify: %v", err)
+	}
+	return sth, nil
+}
+
+// checkConsistency checks that sth is consistent with the latest STH verified.
+func (r *replicator) checkConsistency(ctx context.Context, sth *ct.SignedTreeHead) error {
+	latest := r.latest()
+	if latest == nil || latest.TreeSize == 0 {
+		return nil
+	}
+	if sth.TreeSize == 0 {
+		r.exp.consistencyFailures.Add(1)
+		return fmt.Errorf("source STH is empty, but verified tree size is %d", latest.TreeSize)
+	}
+	if sth.TreeSize == latest.TreeSize {
+		if sth.SHA256RootHash != latest.SHA256RootHash {
+			r.exp.consistencyFailures.Add(1)
+			return fmt.Errorf("source STH root %x at size %d differs from verified root %x", sth.SHA256RootHash, sth.TreeSize, latest.SHA256RootHash)
+		}
+		return nil
+	}
+	first, second := latest, sth
+	if sth.TreeSize < latest.TreeSize {
+		first, second = sth, latest
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.deadline)
+	defer cancel()
+	proof, err := r.source.GetSTHConsistency(ctx, first.TreeSize, second.TreeSize)
+	if err != nil {
+		return fmt.Errorf("failed to fetch source consistency proof: %v", err)
+	}
+	if err := r.logVerifier.VerifyConsistencyProof(int64(first.TreeSize), int64(second.TreeSize), first.SHA256RootHash[:], second.SHA256RootHash[:], proof); err != nil {
+		r.exp.consistencyFailures.Add(1)
+		return fmt.Errorf("source STHs at sizes %d and %d aren't consistent: %v", first.TreeSize, second.TreeSize, err)
+	}
+	return nil
+}
+
+// backendRoot returns the size and root hash of the backend's latest tree.
+func (r *replicator) backendRoot(ctx context.Context) (int64, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.deadline)
+	defer cancel()
+	rsp, err := r.backend.GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: r.logID})
+	if err != nil {
+		return 0, nil, fmt.Errorf("backend GetLatestSignedLogRoot request failed: %v", err)
+	}
+	if !rpcStatusOK(rsp.GetStatus()) {
+		return 0, nil, fmt.Errorf("backend GetLatestSignedLogRoot request failed, status=%v", rsp.GetStatus())
+	}
+	slr := rsp.GetSignedLogRoot()
+	if slr == nil {
+		return 0, nil, errors.New("no log root returned")
+	}
+	return slr.TreeSize, slr.RootHash, nil
+}
+
+// copyBatch copies up to batchSize of the source's entries from index start, but not
+// beyond end, into the tree, and waits for them to be integrated. It returns the tree's
+// new size.
+func (r *replicator) copyBatch(ctx context.Context, start, end int64) (int64, error) {
+	last := start + r.batchSize - 1
+	if last >= end {
+		last = end - 1
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, r.deadline)
+	rsp, err := r.source.GetRawEntries(fetchCtx, start, last)
+	cancel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch source entries [%d, %d]: %v", start, last, err)
+	}
+	if len(rsp.Entries) == 0 {
+		return 0, fmt.Errorf("source returned no entries from %d", start)
+	}
+	if int64(len(rsp.Entries)) > last-start+1 {
+		return 0, fmt.Errorf("source returned %d entries for [%d, %d]", len(rsp.Entries), start, last)
+	}
+
+	leaves := make([]*trillian.LogLeaf, 0, len(rsp.Entries))
+	for i, entry := range rsp.Entries {
+		leaves = append(leaves, replicaLeaf(start+int64(i), entry))
+	}
+	queueCtx, cancel := context.WithTimeout(ctx, r.deadline)
+	queueRsp, err := r.backend.QueueLeaves(queueCtx, &trillian.QueueLeavesRequest{LogId: r.logID, Leaves: leaves})
+	cancel()
+	if err != nil {
+		return 0, fmt.Errorf("backend QueueLeaves request failed: %v", err)
+	}
+	if !rpcStatusOK(queueRsp.GetStatus()) {
+		return 0, fmt.Errorf("backend QueueLeaves request failed, status=%v", queueRsp.GetStatus())
+	}
+
+	// Wait for the batch to be integrated, so the next one isn't queued alongside it.
+	want := start + int64(len(leaves))
+	waitUntil := time.Now().Add(r.integrationWait)
+	for {
+		size, _, err := r.backendRoot(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if size >= want {
+			r.exp.entriesReplicated.Add(int64(len(leaves)))
+			return size, nil
+		}
+		if time.Now().After(waitUntil) {
+			return 0, fmt.Errorf("tree size %d after waiting %v for entries up to %d to be integrated", size, r.integrationWait, want)
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(r.integrationPoll):
+		}
+	}
+}
+
+// replicaLeaf builds the leaf queued for the source's entry at index. Its identity hash
+// covers the index as well as the entry, so queueing the same entry again has no effect,
+// but a duplicate entry elsewhere in the source is still added. The sequencer takes the
+// leaves with the earliest deadlines first, so its deadline makes it integrate the leaves
+// in the source's order, whenever they were queued.
+func replicaLeaf(index int64, entry ct.LeafEntry) *trillian.LogLeaf {
+	leafHash := sha256.Sum256(entry.LeafInput)
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, index)
+	buf.Write(leafHash[:])
+	identityHash := sha256.Sum256(buf.Bytes())
+	return &trillian.LogLeaf{
+		LeafValueHash:      leafHash[:],
+		LeafValue:          entry.LeafInput,
+		ExtraData:          entry.ExtraData,
+		LeafIdentityHash:   identityHash[:],
+		MergeDeadlineNanos: replicaDeadlineBase + index,
+	}
+}
+
+// writeReplicaSTH serves the latest source STH the replica has been verified against.
+func writeReplicaSTH(c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	sth := c.replica.latest()
+	if sth == nil {
+		return http.StatusServiceUnavailable, errors.New("replica hasn't caught up with its source log yet")
+	}
+	etag := sthETag(sth.TreeSize, sth.Timestamp, sth.SHA256RootHash[:])
+	if checkNotModified(w, r, etag) {
+		return http.StatusNotModified, nil
+	}
+	jsonRsp, err := sthResponse(*sth)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return writeJSON(w, jsonRsp)
+}
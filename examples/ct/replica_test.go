@@ -0,0 +1,291 @@
+package ct
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/examples/ct/testonly"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+func newReplicaTestTree() *merkle.InMemoryMerkleTree {
+	return merkle.NewInMemoryMerkleTree(merkle.NewRFC6962TreeHasher(crypto.NewSHA256()))
+}
+
+// fakeReplicaSource is a CT log whose tree heads and entries can be tampered with.
+type fakeReplicaSource struct {
+	t      *testing.T
+	km     crypto.KeyManager
+	tree   *merkle.InMemoryMerkleTree
+	leaves [][]byte
+	// badSignature, forkRoot and tamperEntry make the log misbehave.
+	badSignature bool
+	forkRoot     bool
+	tamperEntry  int
+}
+
+func newFakeReplicaSource(t *testing.T) *fakeReplicaSource {
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPrivateKey(testonly.CTLogPrivateKeyPEM, testonly.CTLogKeyPassword); err != nil {
+		t.Fatalf("Failed to load log key: %v", err)
+	}
+	return &fakeReplicaSource{t: t, km: km, tree: newReplicaTestTree(), tamperEntry: -1}
+}
+
+func (f *fakeReplicaSource) grow(n int) {
+	for i := 0; i < n; i++ {
+		leaf := []byte(fmt.Sprintf("leaf %d", len(f.leaves)))
+		f.leaves = append(f.leaves, leaf)
+		f.tree.AddLeaf(leaf)
+	}
+}
+
+func (f *fakeReplicaSource) GetSTH(ctx context.Context) (*ct.SignedTreeHead, error) {
+	sth := &ct.SignedTreeHead{Version: ct.V1, TreeSize: uint64(len(f.leaves)), Timestamp: 1000 + uint64(len(f.leaves))}
+	if len(f.leaves) > 0 {
+		copy(sth.SHA256RootHash[:], f.tree.RootAtSnapshot(len(f.leaves)).Hash())
+	}
+	if f.forkRoot {
+		sth.SHA256RootHash[0] ^= 1
+	}
+	if err := signV1TreeHead(f.km, sth); err != nil {
+		f.t.Fatalf("Failed to sign STH: %v", err)
+	}
+	if f.badSignature {
+		sth.TreeHeadSignature.Signature[len(sth.TreeHeadSignature.Signature)-1] ^= 1
+	}
+	return sth, nil
+}
+
+func (f *fakeReplicaSource) GetSTHConsistency(ctx context.Context, first, second uint64) ([][]byte, error) {
+	var proof [][]byte
+	for _, node := range f.tree.SnapshotConsistency(int(first), int(second)) {
+		proof = append(proof, node.Value.Hash())
+	}
+	return proof, nil
+}
+
+func (f *fakeReplicaSource) GetRawEntries(ctx context.Context, start, end int64) (*ct.GetEntriesResponse, error) {
+	rsp := &ct.GetEntriesResponse{}
+	for i := start; i <= end && i < int64(len(f.leaves)); i++ {
+		leaf := f.leaves[i]
+		if int(i) == f.tamperEntry {
+			leaf = []byte("tampered")
+		}
+		rsp.Entries = append(rsp.Entries, ct.LeafEntry{LeafInput: leaf, ExtraData: []byte("extra")})
+	}
+	return rsp, nil
+}
+
+func (f *fakeReplicaSource) GetAcceptedRoots(ctx context.Context) ([]ct.ASN1Cert, error) {
+	block, _ := pem.Decode([]byte(testonly.FakeCACertPEM))
+	return []ct.ASN1Cert{{Data: block.Bytes}}, nil
+}
+
+// fakeReplicaBackend queues leaves and integrates up to perRoot of them, in merge deadline
+// order, each time its root is fetched. Leaves whose identity hash has been seen before
+// aren't queued.
+type fakeReplicaBackend struct {
+	trillian.TrillianLogClient
+	tree       *merkle.InMemoryMerkleTree
+	values     [][]byte
+	size       int64
+	queued     []*trillian.LogLeaf
+	identities map[string]bool
+	perRoot    int
+}
+
+func newFakeReplicaBackend() *fakeReplicaBackend {
+	return &fakeReplicaBackend{tree: newReplicaTestTree(), identities: make(map[string]bool), perRoot: 2}
+}
+
+func (f *fakeReplicaBackend) QueueLeaves(ctx context.Context, req *trillian.QueueLeavesRequest, opts ...grpc.CallOption) (*trillian.QueueLeavesResponse, error) {
+	for _, leaf := range req.Leaves {
+		if f.identities[string(leaf.LeafIdentityHash)] {
+			continue
+		}
+		f.identities[string(leaf.LeafIdentityHash)] = true
+		f.queued = append(f.queued, leaf)
+	}
+	return &trillian.QueueLeavesResponse{Status: okStatus}, nil
+}
+
+func (f *fakeReplicaBackend) GetLatestSignedLogRoot(ctx context.Context, req *trillian.GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*trillian.GetLatestSignedLogRootResponse, error) {
+	sort.Sort(byDeadline(f.queued))
+	for i := 0; i < f.perRoot && len(f.queued) > 0; i++ {
+		f.tree.AddLeaf(f.queued[0].LeafValue)
+		f.values = append(f.values, f.queued[0].LeafValue)
+		f.queued = f.queued[1:]
+		f.size++
+	}
+	var root []byte
+	if f.size > 0 {
+		root = f.tree.RootAtSnapshot(int(f.size)).Hash()
+	}
+	return makeGetRootResponseForTest(12345000000, f.size, root), nil
+}
+
+type byDeadline []*trillian.LogLeaf
+
+func (l byDeadline) Len() int           { return len(l) }
+func (l byDeadline) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l byDeadline) Less(i, j int) bool { return l[i].MergeDeadlineNanos < l[j].MergeDeadlineNanos }
+
+func newTestReplicator(t *testing.T, source *fakeReplicaSource, backend *fakeReplicaBackend) (*replicator, LogContext) {
+	c := NewLogContext(0x42, "test", NewPEMCertPool(), backend, nil, time.Second, fakeTimeSource)
+	r, err := newReplicator(*c, source, []byte(testonly.CTLogPublicKeyPEM), 3)
+	if err != nil {
+		t.Fatalf("newReplicator()=_,%v", err)
+	}
+	r.integrationPoll = time.Millisecond
+	r.integrationWait = 50 * time.Millisecond
+	c.replica = r
+	return r, *c
+}
+
+func TestReplicator(t *testing.T) {
+	source := newFakeReplicaSource(t)
+	backend := newFakeReplicaBackend()
+	r, c := newTestReplicator(t, source, backend)
+
+	// Nothing is served until the replica has been checked against a tree head.
+	w := httptest.NewRecorder()
+	if status, _ := writeReplicaSTH(c, w, httptest.NewRequest(http.MethodGet, "/ct/v1/get-sth", nil)); status != http.StatusServiceUnavailable {
+		t.Errorf("writeReplicaSTH() before replicating=%d, want %d", status, http.StatusServiceUnavailable)
+	}
+
+	var steps = []struct {
+		descr        string
+		grow         int
+		badSignature bool
+		forkRoot     bool
+		tamperEntry  int
+		stall        bool
+		restart      bool
+		errStr       string
+		wantSize     int64
+		wantVerified uint64
+	}{
+		{descr: "empty"},
+		{descr: "grown", grow: 7, wantSize: 7, wantVerified: 7},
+		{descr: "unchanged", wantSize: 7, wantVerified: 7},
+		// The backend doesn't integrate anything, so the pass gives up, leaving a batch
+		// queued. After a restart it's not queued again.
+		{descr: "stalled", grow: 5, stall: true, errStr: "integrated", wantSize: 7, wantVerified: 7},
+		{descr: "restarted", restart: true, wantSize: 12, wantVerified: 12},
+		{descr: "bad-signature", badSignature: true, errStr: "signature", wantSize: 12, wantVerified: 12},
+		{descr: "forked-same-size", forkRoot: true, errStr: "differs", wantSize: 12, wantVerified: 12},
+		{descr: "forked", grow: 2, forkRoot: true, errStr: "consistent", wantSize: 12, wantVerified: 12},
+		{descr: "tampered", tamperEntry: 13, errStr: "doesn't match", wantSize: 14, wantVerified: 12},
+	}
+	for _, step := range steps {
+		source.grow(step.grow)
+		source.badSignature, source.forkRoot = step.badSignature, step.forkRoot
+		source.tamperEntry = -1
+		if step.tamperEntry > 0 {
+			source.tamperEntry = step.tamperEntry
+		}
+		backend.perRoot = 2
+		if step.stall {
+			backend.perRoot = 0
+		}
+		if step.restart {
+			verified := r.latest()
+			r, c = newTestReplicator(t, source, backend)
+			r.verified = verified
+		}
+
+		err := r.pass(context.Background())
+		if len(step.errStr) > 0 {
+			if err == nil || !strings.Contains(err.Error(), step.errStr) {
+				t.Errorf("%s: pass()=%v, want error containing %q", step.descr, err, step.errStr)
+			}
+		} else if err != nil {
+			t.Errorf("%s: pass()=%v, want no error", step.descr, err)
+		}
+		if got, want := backend.size, step.wantSize; got != want {
+			t.Errorf("%s: backend tree size %d, want %d", step.descr, got, want)
+		}
+		var gotVerified uint64
+		if sth := r.latest(); sth != nil {
+			gotVerified = sth.TreeSize
+		}
+		if got, want := gotVerified, step.wantVerified; got != want {
+			t.Errorf("%s: verified tree size %d, want %d", step.descr, got, want)
+		}
+	}
+
+	// The tree holds the source's entries, in order.
+	for i := 0; i < 12; i++ {
+		if got, want := string(backend.values[i]), string(source.leaves[i]); got != want {
+			t.Errorf("leaf %d of backend=%q, want %q", i, got, want)
+		}
+	}
+
+	// The source's roots are served.
+	if got, want := len(c.trustedRoots.Pool().RawCertificates()), 1; got != want {
+		t.Errorf("replica has %d roots, want %d", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	if status, err := writeReplicaSTH(c, w, httptest.NewRequest(http.MethodGet, "/ct/v1/get-sth", nil)); status != http.StatusOK {
+		t.Fatalf("writeReplicaSTH()=%d,%v, want %d", status, err, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), `"tree_size":12`) {
+		t.Errorf("writeReplicaSTH() served %s, want tree size 12", w.Body)
+	}
+
+	if status, err := checkAcceptingSubmissions(context.Background(), c); status != http.StatusForbidden || err != errLogReplica {
+		t.Errorf("checkAcceptingSubmissions()=%d,%v, want %d,%v", status, err, http.StatusForbidden, errLogReplica)
+	}
+}
+
+func TestCheckReplica(t *testing.T) {
+	var tests = []struct {
+		cfg     LogConfig
+		wantErr bool
+	}{
+		{cfg: LogConfig{}},
+		{cfg: LogConfig{ReplicaSourceURI: "https://ct.example.com/log", ReplicaSourcePubKeyPEMFile: "source.pem"}},
+		{cfg: LogConfig{ReplicaSourceURI: "https://ct.example.com/log"}, wantErr: true},
+		{cfg: LogConfig{ReplicaSourcePubKeyPEMFile: "source.pem"}, wantErr: true},
+		{cfg: LogConfig{ReplicaBatchSize: 10}, wantErr: true},
+		{cfg: LogConfig{ReplicaSourceURI: "https://ct.example.com/log", ReplicaSourcePubKeyPEMFile: "source.pem", ReplicaBatchSize: -1}, wantErr: true},
+		{cfg: LogConfig{ReplicaSourceURI: "https://ct.example.com/log", ReplicaSourcePubKeyPEMFile: "source.pem", RootsPEMFile: "roots.pem"}, wantErr: true},
+		{cfg: LogConfig{ReplicaSourceURI: "https://ct.example.com/log", ReplicaSourcePubKeyPEMFile: "source.pem", CheckpointKeyFile: "key.pem"}, wantErr: true},
+		{cfg: LogConfig{ReplicaSourceURI: "https://ct.example.com/log", ReplicaSourcePubKeyPEMFile: "source.pem", MaxMergeDelay: "24h"}, wantErr: true},
+	}
+	for _, test := range tests {
+		if err := test.cfg.checkReplica(); (err != nil) != test.wantErr {
+			t.Errorf("checkReplica(%+v)=%v, want error: %v", test.cfg, err, test.wantErr)
+		}
+	}
+}
+
+func TestReplicaLeafIdentity(t *testing.T) {
+	entry := ct.LeafEntry{LeafInput: []byte("leaf")}
+	a, b, again := replicaLeaf(1, entry), replicaLeaf(2, entry), replicaLeaf(1, entry)
+	if string(a.LeafIdentityHash) == string(b.LeafIdentityHash) {
+		t.Errorf("replicaLeaf() gave the same entry at different indices the same identity hash")
+	}
+	if string(a.LeafIdentityHash) != string(again.LeafIdentityHash) {
+		t.Errorf("replicaLeaf() gave the same entry at the same index different identity hashes")
+	}
+	if string(a.LeafValueHash) != string(b.LeafValueHash) {
+		t.Errorf("replicaLeaf() gave the same entry different value hashes")
+	}
+	if a.MergeDeadlineNanos >= b.MergeDeadlineNanos {
+		t.Errorf("replicaLeaf() deadlines %d, %d, want them in index order", a.MergeDeadlineNanos, b.MergeDeadlineNanos)
+	}
+}
@@ -0,0 +1,310 @@
+package ct
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+const (
+	// defaultRequestDumpDuration is how long request dumping stays on if the admin
+	// request doesn't say, and maxRequestDumpDuration the longest it can be turned on for,
+	// so it isn't left on by mistake.
+	defaultRequestDumpDuration = 15 * time.Minute
+	maxRequestDumpDuration     = 24 * time.Hour
+	// maxDumpedBodySize is the most of a request body that's read to summarize it. Larger
+	// bodies are only summarized by their size.
+	maxDumpedBodySize = 64 * 1024
+	// maxDumpedValueLength is the longest parameter value that's dumped in full.
+	maxDumpedValueLength = 64
+	// allDumpEndpoints turns dumping on for every endpoint that can be dumped.
+	allDumpEndpoints = "*"
+	redacted         = "REDACTED"
+)
+
+// redactedHeaders are the request headers whose values are never dumped.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	APIKeyHeader:          true,
+	SignatureHeader:       true,
+}
+
+// isSecretName returns true if a parameter called name might hold a secret, so its value
+// isn't dumped.
+func isSecretName(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"key", "secret", "token", "password", "signature", "auth"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminRequestDump is the body of admin get-dump responses and set-dump requests, which
+// turn on logging summaries of the requests to some of a log's endpoints, and the
+// responses to them, to debug problems with particular clients.
+type AdminRequestDump struct {
+	// Endpoints are the names of the endpoints whose requests are dumped, as in the log's
+	// statistics, or "*" for all of them. Requests to the admin API are never dumped. An
+	// empty list turns dumping off.
+	Endpoints []string `json:"endpoints"`
+	// SampleRate is the fraction of requests to the endpoints that are dumped, from 0 to 1.
+	SampleRate float64 `json:"sample_rate"`
+	// DurationSeconds is how long dumping stays on for in set-dump requests. It's 15
+	// minutes if unset, and at most a day.
+	DurationSeconds int64 `json:"duration_seconds,omitempty"`
+	// Expires is when dumping turns itself off, in get-dump and set-dump responses.
+	Expires string `json:"expires,omitempty"`
+}
+
+// requestDumper logs summaries of a sample of the requests to some of a log's endpoints,
+// with any secrets redacted, while it's turned on through the admin API. The summaries
+// are logged at the default verbosity, so the server doesn't have to be restarted to see
+// them.
+type requestDumper struct {
+	// log writes a dump, it can be replaced for testing
+	log func(format string, args ...interface{})
+	// sample returns a random number in [0, 1), it can be replaced for testing
+	sample func() float64
+	// dumps counts the requests dumped, by endpoint
+	dumps *expvar.Map
+
+	mu        sync.Mutex
+	endpoints map[string]bool
+	rate      float64
+	until     time.Time
+}
+
+func newRequestDumper() *requestDumper {
+	return &requestDumper{log: glog.Infof, sample: rand.Float64, dumps: new(expvar.Map).Init()}
+}
+
+// set turns on dumping the requests to endpoints, until the given time. An empty list of
+// endpoints turns it off.
+func (d *requestDumper) set(endpoints []string, rate float64, until time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.endpoints = make(map[string]bool)
+	for _, ep := range endpoints {
+		d.endpoints[ep] = true
+	}
+	d.rate = rate
+	d.until = until
+}
+
+// get returns the current settings, which are empty if dumping is off at time now.
+func (d *requestDumper) get(now time.Time) AdminRequestDump {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rsp := AdminRequestDump{Endpoints: []string{}}
+	if len(d.endpoints) == 0 || !now.Before(d.until) {
+		return rsp
+	}
+	for ep := range d.endpoints {
+		rsp.Endpoints = append(rsp.Endpoints, ep)
+	}
+	sort.Strings(rsp.Endpoints)
+	rsp.SampleRate = d.rate
+	rsp.Expires = d.until.UTC().Format(time.RFC3339)
+	return rsp
+}
+
+// sampled returns true if the request to the endpoint ep should be dumped. The time is
+// only read if dumping is on for ep.
+func (d *requestDumper) sampled(ep string, timeSource util.TimeSource) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.endpoints[ep] && !d.endpoints[allDumpEndpoints] {
+		return false
+	}
+	if !timeSource.Now().Before(d.until) || d.rate <= 0 {
+		return false
+	}
+	return d.rate >= 1 || d.sample() < d.rate
+}
+
+// dumpableEndpoints returns the names of the endpoints whose requests can be dumped.
+func dumpableEndpoints() map[string]bool {
+	names := make(map[string]bool)
+	for _, eps := range [][]string{Entrypoints, V2Entrypoints, TileEntrypoints, GossipEntrypoints} {
+		for _, ep := range eps {
+			names[ep] = true
+		}
+	}
+	return names
+}
+
+// summarizeRequest describes r with any secrets redacted. The body of r is left in
+// place for the handler.
+func summarizeRequest(r *http.Request) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "method=%s path=%s", r.Method, r.URL.Path)
+	if query := r.URL.Query(); len(query) > 0 {
+		fmt.Fprintf(&b, " query=%s", summarizeValues(query))
+	}
+	fmt.Fprintf(&b, " headers=%s", summarizeValues(url.Values(r.Header)))
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		fmt.Fprintf(&b, " client_cert=%q", r.TLS.PeerCertificates[0].Subject.CommonName)
+	}
+	if r.Method == http.MethodPost {
+		fmt.Fprintf(&b, " body=%s", summarizeBody(r))
+	}
+	return b.String()
+}
+
+// summarizeValues describes the query parameters or headers in values, in order of name,
+// redacting those that might be secret and truncating long ones.
+func summarizeValues(values url.Values) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		for _, value := range values[name] {
+			if redactedHeaders[http.CanonicalHeaderKey(name)] || isSecretName(name) {
+				value = redacted
+			}
+			parts = append(parts, fmt.Sprintf("%s=%q", name, truncateValue(value)))
+		}
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+func truncateValue(value string) string {
+	if len(value) <= maxDumpedValueLength {
+		return value
+	}
+	return fmt.Sprintf("%s...(%d bytes)", value[:maxDumpedValueLength], len(value))
+}
+
+// summarizeBody describes the JSON body of a POST request by its fields: short strings
+// and numbers are shown, and arrays and objects only by their size, so certificates
+// aren't dumped in full.
+func summarizeBody(r *http.Request) string {
+	if r.Body == nil {
+		return "{}"
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxDumpedBodySize+1))
+	// The handler still reads the whole body, starting with the part read here.
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return fmt.Sprintf("(unreadable: %v)", err)
+	}
+	if len(body) > maxDumpedBodySize {
+		return fmt.Sprintf("(more than %d bytes)", maxDumpedBodySize)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return fmt.Sprintf("(%d bytes, not a JSON object)", len(body))
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%s", name, summarizeJSON(name, fields[name])))
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+func summarizeJSON(name string, raw json.RawMessage) string {
+	if isSecretName(name) {
+		return redacted
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "(invalid)"
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		return fmt.Sprintf("[%d items]", len(v))
+	case map[string]interface{}:
+		return fmt.Sprintf("{%d fields}", len(v))
+	case string:
+		return fmt.Sprintf("%q", truncateValue(v))
+	}
+	return string(raw)
+}
+
+// requestDumpMiddleware dumps sampled requests to the endpoints the admin has asked for,
+// and once they've been handled the responses to them. The request is summarized before
+// any other middleware sees it, so requests that are rejected are dumped too.
+func requestDumpMiddleware(ep Endpoint, next EndpointHandler) EndpointHandler {
+	return func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		if ep.Privileged || c.requestDump == nil || !c.requestDump.sampled(ep.Name, c.timeSource) {
+			return next(ctx, c, w, r)
+		}
+		c.requestDump.dumps.Add(ep.Name, 1)
+		request := summarizeRequest(r)
+		s := requestStateFrom(ctx)
+		s.onDone(func() {
+			rec := s.rec
+			response := fmt.Sprintf("status=%d bytes=%d latency=%dus content_type=%q", rec.Status, rec.BytesWritten, rec.LatencyMicros, w.Header().Get(contentTypeHeader))
+			if len(rec.Error) > 0 {
+				response += fmt.Sprintf(" error=%q", truncateValue(rec.Error))
+			}
+			c.requestDump.log("%s[%s]: %s dump: client=%s request: %s response: %s", c.logPrefix, s.id, ep.Name, rec.ClientIP, request, response)
+		})
+		return next(ctx, c, w, r)
+	}
+}
+
+func adminGetDump(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	return writeJSON(w, c.requestDump.get(c.timeSource.Now()))
+}
+
+func adminSetDump(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	var req AdminRequestDump
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to parse request: %v", err)
+	}
+	if req.SampleRate < 0 || req.SampleRate > 1 {
+		return http.StatusBadRequest, fmt.Errorf("invalid sample rate %v, want 0 to 1", req.SampleRate)
+	}
+	known := dumpableEndpoints()
+	for _, ep := range req.Endpoints {
+		if ep != allDumpEndpoints && !known[ep] {
+			return http.StatusBadRequest, fmt.Errorf("can't dump requests to unknown endpoint %q", ep)
+		}
+	}
+	duration := time.Duration(req.DurationSeconds) * time.Second
+	if req.DurationSeconds == 0 {
+		duration = defaultRequestDumpDuration
+	}
+	if duration < 0 || duration > maxRequestDumpDuration {
+		return http.StatusBadRequest, fmt.Errorf("invalid duration %v, want at most %v", duration, maxRequestDumpDuration)
+	}
+
+	now := c.timeSource.Now()
+	c.requestDump.set(req.Endpoints, req.SampleRate, now.Add(duration))
+	if len(req.Endpoints) == 0 {
+		glog.Infof("%s: admin turned request dumping off", c.logPrefix)
+	} else {
+		glog.Warningf("%s: admin turned on dumping %v of requests to %v for %v", c.logPrefix, req.SampleRate, req.Endpoints, duration)
+	}
+	return writeJSON(w, c.requestDump.get(now))
+}
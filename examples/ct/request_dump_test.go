@@ -0,0 +1,177 @@
+package ct
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRequestDump(t *testing.T) {
+	const body = `{"chain":["AAAA","BBBB"],"api_key":"s3cret","comment":"hello"}`
+	var tests = []struct {
+		descr     string
+		name      string
+		method    string
+		url       string
+		body      string
+		header    map[string]string
+		endpoints []string
+		rate      float64
+		sample    float64
+		until     time.Duration // from now
+		err       error
+		want      []string // in the dump
+		wantNot   []string // not in the dump
+		wantDump  bool
+	}{
+		{
+			descr: "get", name: "GetEntries", method: "GET", url: "http://example.com/ct/v1/get-entries?start=1&end=2&token=t0ken",
+			header:    map[string]string{APIKeyHeader: "k3y", "Authorization": "Bearer b3arer", "User-Agent": "test-client/1.0"},
+			endpoints: []string{"GetEntries"}, rate: 1, until: time.Minute, wantDump: true,
+			want:    []string{"GetEntries dump", `start="1"`, `end="2"`, `token="REDACTED"`, `X-Api-Key="REDACTED"`, `Authorization="REDACTED"`, `User-Agent="test-client/1.0"`, "status=200"},
+			wantNot: []string{"t0ken", "k3y", "b3arer"},
+		},
+		{
+			descr: "post", name: "AddChain", method: "POST", url: "http://example.com/ct/v1/add-chain", body: body,
+			endpoints: []string{allDumpEndpoints}, rate: 1, until: time.Minute, wantDump: true,
+			want:    []string{"method=POST", "chain=[2 items]", "api_key=REDACTED", `comment="hello"`},
+			wantNot: []string{"s3cret", "AAAA"},
+		},
+		{
+			descr: "failed", name: "GetSTH", method: "GET", url: "http://example.com/ct/v1/get-sth",
+			endpoints: []string{"GetSTH"}, rate: 1, until: time.Minute, err: errors.New("backend down"), wantDump: true,
+			want: []string{"status=500", `error="backend down"`},
+		},
+		{descr: "sampled", name: "GetSTH", method: "GET", url: "http://example.com/ct/v1/get-sth", endpoints: []string{"GetSTH"}, rate: 0.1, sample: 0.05, until: time.Minute, wantDump: true},
+		{descr: "not-sampled", name: "GetSTH", method: "GET", url: "http://example.com/ct/v1/get-sth", endpoints: []string{"GetSTH"}, rate: 0.1, sample: 0.5, until: time.Minute},
+		{descr: "other-endpoint", name: "GetRoots", method: "GET", url: "http://example.com/ct/v1/get-roots", endpoints: []string{"GetSTH"}, rate: 1, until: time.Minute},
+		{descr: "expired", name: "GetSTH", method: "GET", url: "http://example.com/ct/v1/get-sth", endpoints: []string{"GetSTH"}, rate: 1, until: -time.Second},
+		{descr: "off", name: "GetSTH", method: "GET", url: "http://example.com/ct/v1/get-sth", rate: 1, until: time.Minute},
+	}
+
+	for _, test := range tests {
+		info := setupTest(t, nil)
+		var dumps []string
+		info.c.requestDump.log = func(format string, args ...interface{}) {
+			dumps = append(dumps, fmt.Sprintf(format, args...))
+		}
+		info.c.requestDump.sample = func() float64 { return test.sample }
+		info.c.requestDump.set(test.endpoints, test.rate, fakeTime.Add(test.until))
+
+		handler := appHandler{context: info.c, name: test.name, method: test.method,
+			handler: func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+				if test.err != nil {
+					return http.StatusInternalServerError, test.err
+				}
+				// The handler must still be able to read the request.
+				if got, err := ioutil.ReadAll(r.Body); err != nil || string(got) != test.body {
+					t.Errorf("%s: handler read body %q,%v, want %q", test.descr, got, err, test.body)
+				}
+				return writeJSON(w, struct{}{})
+			}}
+
+		req, err := http.NewRequest(test.method, test.url, bytes.NewReader([]byte(test.body)))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		for k, v := range test.header {
+			req.Header.Set(k, v)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got, want := len(dumps) == 1, test.wantDump; got != want {
+			t.Errorf("%s: made %d dumps, want dumped: %v", test.descr, len(dumps), want)
+			continue
+		}
+		if !test.wantDump {
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(dumps[0], want) {
+				t.Errorf("%s: dump %q doesn't contain %q", test.descr, dumps[0], want)
+			}
+		}
+		for _, secret := range test.wantNot {
+			if strings.Contains(dumps[0], secret) {
+				t.Errorf("%s: dump %q contains %q", test.descr, dumps[0], secret)
+			}
+		}
+		if got, want := info.c.requestDump.dumps.Get(test.name).String(), "1"; got != want {
+			t.Errorf("%s: request-dumps[%s]=%s, want %s", test.descr, test.name, got, want)
+		}
+	}
+}
+
+func TestAdminSetDump(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	v, err := newRequestVerifier([]RequestSigningKey{{ID: "hmac", Algorithm: SigningAlgorithmHMACSHA256, Key: base64.StdEncoding.EncodeToString(testHMACSecret)}}, time.Minute, fakeTimeSource)
+	if err != nil {
+		t.Fatalf("newRequestVerifier()=_,%v, want no error", err)
+	}
+	info.c.requestVerifier = v
+	mux := http.NewServeMux()
+	info.c.RegisterAdminHandlers(mux, "/log")
+
+	var tests = []struct {
+		body          string
+		wantStatus    int
+		wantEndpoints []string
+		wantExpires   string
+	}{
+		{body: `{"endpoints":["AddChain","GetSTH"],"sample_rate":0.5}`, wantStatus: http.StatusOK, wantEndpoints: []string{"AddChain", "GetSTH"}, wantExpires: "2016-07-22T11:16:13Z"},
+		{body: `{"endpoints":["*"],"sample_rate":1,"duration_seconds":60}`, wantStatus: http.StatusOK, wantEndpoints: []string{"*"}, wantExpires: "2016-07-22T11:02:13Z"},
+		{body: `{"endpoints":["AdminSetState"],"sample_rate":1}`, wantStatus: http.StatusBadRequest, wantEndpoints: []string{"*"}, wantExpires: "2016-07-22T11:02:13Z"},
+		{body: `{"endpoints":["GetSTH"],"sample_rate":2}`, wantStatus: http.StatusBadRequest, wantEndpoints: []string{"*"}, wantExpires: "2016-07-22T11:02:13Z"},
+		{body: `{"endpoints":["GetSTH"],"sample_rate":1,"duration_seconds":172800}`, wantStatus: http.StatusBadRequest, wantEndpoints: []string{"*"}, wantExpires: "2016-07-22T11:02:13Z"},
+		{body: `{"endpoints":[]}`, wantStatus: http.StatusOK, wantEndpoints: []string{}},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("POST", "http://example.com/log"+AdminSetDumpPath, bytes.NewReader([]byte(test.body)))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if err := SignRequestHMAC(req, "hmac", testHMACSecret, fakeTime); err != nil {
+			t.Fatalf("SignRequestHMAC()=%v, want no error", err)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if got, want := w.Code, test.wantStatus; got != want {
+			t.Errorf("AdminSetDump(%s)=%d (body:%v), want %d", test.body, got, w.Body, want)
+		}
+
+		req, err = http.NewRequest("GET", "http://example.com/log"+AdminGetDumpPath, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if err := SignRequestHMAC(req, "hmac", testHMACSecret, fakeTime); err != nil {
+			t.Fatalf("SignRequestHMAC()=%v, want no error", err)
+		}
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("AdminGetDump()=%d (body:%v), want %d", got, w.Body, want)
+		}
+		var rsp AdminRequestDump
+		if err := json.NewDecoder(w.Body).Decode(&rsp); err != nil {
+			t.Fatalf("json.Decode()=%v, want nil", err)
+		}
+		if got, want := strings.Join(rsp.Endpoints, ","), strings.Join(test.wantEndpoints, ","); got != want {
+			t.Errorf("AdminSetDump(%s) left endpoints %s, want %s", test.body, got, want)
+		}
+		if got, want := rsp.Expires, test.wantExpires; got != want {
+			t.Errorf("AdminSetDump(%s) left expiry %q, want %q", test.body, got, want)
+		}
+	}
+}
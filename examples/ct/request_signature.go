@@ -0,0 +1,198 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/trillian/util"
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	// SignatureKeyIDHeader is the HTTP header naming the key a request is signed with.
+	SignatureKeyIDHeader = "X-CT-Signature-Key-Id"
+	// SignatureTimestampHeader is the HTTP header holding the time a request was signed,
+	// in seconds since the epoch.
+	SignatureTimestampHeader = "X-CT-Signature-Timestamp"
+	// SignatureHeader is the HTTP header holding a request's base64 encoded signature.
+	SignatureHeader = "X-CT-Signature"
+
+	// SigningAlgorithmHMACSHA256 signs requests with HMAC-SHA256 using a shared secret.
+	SigningAlgorithmHMACSHA256 = "hmac-sha256"
+	// SigningAlgorithmEd25519 signs requests with an Ed25519 private key.
+	SigningAlgorithmEd25519 = "ed25519"
+
+	// How old a signed request may be if the config doesn't say
+	defaultMaxRequestSignatureAge = 5 * time.Minute
+	// Max size of a signed request's body
+	maxSignedRequestBodySize = 1 << 20
+)
+
+// RequestSigningKey is a key that clients can sign requests to a log with, so endpoints
+// can be restricted to known clients without mutual TLS. A signed request carries the key
+// ID, the time it was signed and a signature over the output of CanonicalRequest.
+type RequestSigningKey struct {
+	// ID identifies the key in the SignatureKeyIDHeader of requests.
+	ID string
+	// Algorithm is SigningAlgorithmHMACSHA256 or SigningAlgorithmEd25519.
+	Algorithm string
+	// Key is the base64 encoded HMAC secret or Ed25519 public key.
+	Key string
+}
+
+// CanonicalRequest returns the data signed for a request: the method, path, raw query,
+// signing timestamp and hex encoded SHA-256 hash of the body, each followed by a newline.
+func CanonicalRequest(method, path, rawQuery, timestamp string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	var buf bytes.Buffer
+	for _, s := range []string{method, path, rawQuery, timestamp, hex.EncodeToString(bodyHash[:])} {
+		buf.WriteString(s)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// SignRequestHMAC signs r as of now with an HMAC-SHA256 secret.
+func SignRequestHMAC(r *http.Request, keyID string, secret []byte, now time.Time) error {
+	return signRequest(r, keyID, now, func(data []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(data)
+		return mac.Sum(nil)
+	})
+}
+
+// SignRequestEd25519 signs r as of now with an Ed25519 private key.
+func SignRequestEd25519(r *http.Request, keyID string, key ed25519.PrivateKey, now time.Time) error {
+	return signRequest(r, keyID, now, func(data []byte) []byte {
+		return ed25519.Sign(key, data)
+	})
+}
+
+func signRequest(r *http.Request, keyID string, now time.Time, sign func([]byte) []byte) error {
+	body, err := readRequestBody(r)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := sign(CanonicalRequest(r.Method, r.URL.Path, r.URL.RawQuery, timestamp, body))
+	r.Header.Set(SignatureKeyIDHeader, keyID)
+	r.Header.Set(SignatureTimestampHeader, timestamp)
+	r.Header.Set(SignatureHeader, base64.StdEncoding.EncodeToString(signature))
+	return nil
+}
+
+// readRequestBody reads the body of r, leaving it in place to be read again.
+func readRequestBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxSignedRequestBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxSignedRequestBodySize {
+		return nil, fmt.Errorf("request body larger than %d bytes", maxSignedRequestBodySize)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// requestVerifier checks the signatures on requests to a log's signed endpoints.
+type requestVerifier struct {
+	// verifiers maps key IDs to functions checking signatures made with the keys
+	verifiers  map[string]func(data, signature []byte) bool
+	maxAge     time.Duration
+	timeSource util.TimeSource
+}
+
+// newRequestVerifier creates a requestVerifier accepting requests signed with keys that
+// are no more than maxAge old, or the same amount in the future to allow for clock skew.
+func newRequestVerifier(keys []RequestSigningKey, maxAge time.Duration, timeSource util.TimeSource) (*requestVerifier, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no request signing keys")
+	}
+	v := &requestVerifier{
+		verifiers:  make(map[string]func(data, signature []byte) bool),
+		maxAge:     maxAge,
+		timeSource: timeSource,
+	}
+	for _, k := range keys {
+		if len(k.ID) == 0 {
+			return nil, errors.New("request signing key has no ID")
+		}
+		if _, ok := v.verifiers[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate request signing key ID %q", k.ID)
+		}
+		key, err := base64.StdEncoding.DecodeString(k.Key)
+		if err != nil || len(key) == 0 {
+			return nil, fmt.Errorf("request signing key %q: invalid base64 key", k.ID)
+		}
+		switch k.Algorithm {
+		case SigningAlgorithmHMACSHA256:
+			if len(key) < sha256.Size {
+				return nil, fmt.Errorf("request signing key %q: HMAC secret must be at least %d bytes", k.ID, sha256.Size)
+			}
+			v.verifiers[k.ID] = func(data, signature []byte) bool {
+				mac := hmac.New(sha256.New, key)
+				mac.Write(data)
+				return hmac.Equal(mac.Sum(nil), signature)
+			}
+		case SigningAlgorithmEd25519:
+			if len(key) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("request signing key %q: Ed25519 public key must be %d bytes", k.ID, ed25519.PublicKeySize)
+			}
+			v.verifiers[k.ID] = func(data, signature []byte) bool {
+				return ed25519.Verify(ed25519.PublicKey(key), data, signature)
+			}
+		default:
+			return nil, fmt.Errorf("request signing key %q: unknown algorithm %q", k.ID, k.Algorithm)
+		}
+	}
+	return v, nil
+}
+
+// verify checks the signature on r, returning the ID of the key it was signed with. The
+// request body is left in place for the handler.
+func (v *requestVerifier) verify(r *http.Request) (string, error) {
+	keyID := r.Header.Get(SignatureKeyIDHeader)
+	timestamp := r.Header.Get(SignatureTimestampHeader)
+	sigHeader := r.Header.Get(SignatureHeader)
+	if len(keyID) == 0 || len(timestamp) == 0 || len(sigHeader) == 0 {
+		return "", errors.New("request is not signed")
+	}
+	verifier, ok := v.verifiers[keyID]
+	if !ok {
+		return "", fmt.Errorf("unknown signing key %q", keyID)
+	}
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid signature timestamp %q", timestamp)
+	}
+	age := v.timeSource.Now().Sub(time.Unix(secs, 0))
+	if age > v.maxAge || age < -v.maxAge {
+		return "", fmt.Errorf("signature timestamp %q is more than %v from the current time", timestamp, v.maxAge)
+	}
+	signature, err := base64.StdEncoding.DecodeString(sigHeader)
+	if err != nil {
+		return "", errors.New("invalid base64 signature")
+	}
+	body, err := readRequestBody(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read request body: %v", err)
+	}
+	if !verifier(CanonicalRequest(r.Method, r.URL.Path, r.URL.RawQuery, timestamp, body), signature) {
+		return "", errors.New("signature doesn't verify")
+	}
+	return keyID, nil
+}
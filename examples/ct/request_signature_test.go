@@ -0,0 +1,231 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/examples/ct/testonly"
+	"github.com/google/trillian/util"
+	"golang.org/x/crypto/ed25519"
+)
+
+var testHMACSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestNewRequestVerifier(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	hmacKey := base64.StdEncoding.EncodeToString(testHMACSecret)
+	edKey := base64.StdEncoding.EncodeToString(pub)
+
+	var tests = []struct {
+		keys    []RequestSigningKey
+		wantErr bool
+	}{
+		{keys: []RequestSigningKey{{ID: "a", Algorithm: SigningAlgorithmHMACSHA256, Key: hmacKey}, {ID: "b", Algorithm: SigningAlgorithmEd25519, Key: edKey}}},
+		{keys: nil, wantErr: true},
+		{keys: []RequestSigningKey{{Algorithm: SigningAlgorithmHMACSHA256, Key: hmacKey}}, wantErr: true},
+		{keys: []RequestSigningKey{{ID: "a", Algorithm: SigningAlgorithmHMACSHA256, Key: hmacKey}, {ID: "a", Algorithm: SigningAlgorithmEd25519, Key: edKey}}, wantErr: true},
+		{keys: []RequestSigningKey{{ID: "a", Algorithm: SigningAlgorithmHMACSHA256, Key: "not base64!"}}, wantErr: true},
+		{keys: []RequestSigningKey{{ID: "a", Algorithm: SigningAlgorithmHMACSHA256, Key: base64.StdEncoding.EncodeToString([]byte("short"))}}, wantErr: true},
+		{keys: []RequestSigningKey{{ID: "a", Algorithm: SigningAlgorithmEd25519, Key: hmacKey[:8]}}, wantErr: true},
+		{keys: []RequestSigningKey{{ID: "a", Algorithm: "rsa", Key: hmacKey}}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		if _, err := newRequestVerifier(test.keys, time.Minute, util.SystemTimeSource{}); (err != nil) != test.wantErr {
+			t.Errorf("newRequestVerifier(%+v)=%v, want error: %v", test.keys, err, test.wantErr)
+		}
+	}
+}
+
+func TestRequestVerifier(t *testing.T) {
+	now := time.Date(2016, 7, 22, 11, 1, 13, 0, time.UTC)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	v, err := newRequestVerifier([]RequestSigningKey{
+		{ID: "hmac", Algorithm: SigningAlgorithmHMACSHA256, Key: base64.StdEncoding.EncodeToString(testHMACSecret)},
+		{ID: "ed", Algorithm: SigningAlgorithmEd25519, Key: base64.StdEncoding.EncodeToString(pub)},
+	}, 5*time.Minute, util.FakeTimeSource{FakeTime: now})
+	if err != nil {
+		t.Fatalf("newRequestVerifier()=_,%v, want no error", err)
+	}
+
+	newRequest := func(method, url, body string) *http.Request {
+		var r *http.Request
+		if len(body) > 0 {
+			r, err = http.NewRequest(method, url, bytes.NewReader([]byte(body)))
+		} else {
+			r, err = http.NewRequest(method, url, nil)
+		}
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		return r
+	}
+	signHMAC := func(r *http.Request, at time.Time) {
+		if err := SignRequestHMAC(r, "hmac", testHMACSecret, at); err != nil {
+			t.Fatalf("SignRequestHMAC()=%v, want no error", err)
+		}
+	}
+	signEd := func(r *http.Request, at time.Time) {
+		if err := SignRequestEd25519(r, "ed", priv, at); err != nil {
+			t.Fatalf("SignRequestEd25519()=%v, want no error", err)
+		}
+	}
+
+	var tests = []struct {
+		descr   string
+		req     func() *http.Request
+		wantKey string
+		wantErr bool
+	}{
+		{
+			descr: "hmac-get",
+			req: func() *http.Request {
+				r := newRequest("GET", "http://example.com/ct/v1/get-entries?start=0&end=9", "")
+				signHMAC(r, now)
+				return r
+			},
+			wantKey: "hmac",
+		},
+		{
+			descr: "ed25519-post",
+			req: func() *http.Request {
+				r := newRequest("POST", "http://example.com/ct/v1/add-chain", `{"chain":[]}`)
+				signEd(r, now.Add(-time.Minute))
+				return r
+			},
+			wantKey: "ed",
+		},
+		{
+			descr:   "unsigned",
+			req:     func() *http.Request { return newRequest("GET", "http://example.com/ct/v1/get-roots", "") },
+			wantErr: true,
+		},
+		{
+			descr: "unknown-key",
+			req: func() *http.Request {
+				r := newRequest("GET", "http://example.com/ct/v1/get-roots", "")
+				if err := SignRequestHMAC(r, "other", testHMACSecret, now); err != nil {
+					t.Fatalf("SignRequestHMAC()=%v, want no error", err)
+				}
+				return r
+			},
+			wantErr: true,
+		},
+		{
+			descr: "too-old",
+			req: func() *http.Request {
+				r := newRequest("GET", "http://example.com/ct/v1/get-roots", "")
+				signHMAC(r, now.Add(-10*time.Minute))
+				return r
+			},
+			wantErr: true,
+		},
+		{
+			descr: "in-future",
+			req: func() *http.Request {
+				r := newRequest("GET", "http://example.com/ct/v1/get-roots", "")
+				signEd(r, now.Add(10*time.Minute))
+				return r
+			},
+			wantErr: true,
+		},
+		{
+			descr: "query-changed",
+			req: func() *http.Request {
+				r := newRequest("GET", "http://example.com/ct/v1/get-entries?start=0&end=9", "")
+				signHMAC(r, now)
+				r.URL.RawQuery = "start=0&end=999"
+				return r
+			},
+			wantErr: true,
+		},
+		{
+			descr: "body-changed",
+			req: func() *http.Request {
+				r := newRequest("POST", "http://example.com/ct/v1/add-chain", `{"chain":[]}`)
+				signEd(r, now)
+				r.Body = ioutil.NopCloser(bytes.NewReader([]byte(`{"chain":["AAAA"]}`)))
+				return r
+			},
+			wantErr: true,
+		},
+		{
+			descr: "timestamp-changed",
+			req: func() *http.Request {
+				r := newRequest("GET", "http://example.com/ct/v1/get-roots", "")
+				signHMAC(r, now)
+				r.Header.Set(SignatureTimestampHeader, "1469185274")
+				return r
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		r := test.req()
+		keyID, err := v.verify(r)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: verify()=%q, want error", test.descr, keyID)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: verify()=_,%v, want no error", test.descr, err)
+			continue
+		}
+		if keyID != test.wantKey {
+			t.Errorf("%s: verify()=%q, want %q", test.descr, keyID, test.wantKey)
+		}
+		// The handler must still be able to read the body.
+		if r.Body != nil {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil || len(body) == 0 {
+				t.Errorf("%s: body after verify()=%q,%v, want the original body", test.descr, body, err)
+			}
+		}
+	}
+}
+
+func TestSignedEntrypoints(t *testing.T) {
+	info := setupTest(t, []string{testonly.FakeCACertPEM})
+	defer info.mockCtrl.Finish()
+	v, err := newRequestVerifier([]RequestSigningKey{{ID: "hmac", Algorithm: SigningAlgorithmHMACSHA256, Key: base64.StdEncoding.EncodeToString(testHMACSecret)}}, time.Minute, fakeTimeSource)
+	if err != nil {
+		t.Fatalf("newRequestVerifier()=_,%v, want no error", err)
+	}
+	info.c.requestVerifier = v
+	info.c.signedEntrypoints = map[string]bool{"GetRoots": true}
+	handler := appHandler{context: info.c, handler: getRoots, name: "GetRoots", method: http.MethodGet}
+
+	req, err := http.NewRequest("GET", "http://example.com/ct/v1/get-roots", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusUnauthorized; got != want {
+		t.Errorf("GetRoots(unsigned)=%d, want %d", got, want)
+	}
+
+	if err := SignRequestHMAC(req, "hmac", testHMACSecret, fakeTime); err != nil {
+		t.Fatalf("SignRequestHMAC()=%v, want no error", err)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("GetRoots(signed)=%d (body:%v), want %d", got, w.Body, want)
+	}
+}
@@ -0,0 +1,107 @@
+package ct
+
+import (
+	"expvar"
+	"math/rand"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/client"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultRetryPolicy is the policy used for retrying backend reads unless configured
+// otherwise.
+var DefaultRetryPolicy = client.RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+}
+
+// retryableRead returns true if a read RPC that failed with err may succeed if it's
+// made again: the backend was unavailable, or ran out of time on its side.
+func retryableRead(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// RetryingLogClient is a TrillianLogClient that retries read RPCs which fail with a
+// transient error, waiting with exponential backoff and jitter between attempts, so that
+// brief backend problems aren't seen by clients. Reads are idempotent so they're safe to
+// repeat; QueueLeaves is never retried. Nothing is retried once the request's context is
+// done, so retries stay within the handler's deadline.
+type RetryingLogClient struct {
+	routedLogClient
+
+	client trillian.TrillianLogClient
+	policy client.RetryPolicy
+	// random returns a number in [0, 1) used to jitter the backoff.
+	random func() float64
+
+	vars      *expvar.Map
+	retries   *expvar.Map
+	exhausted *expvar.Int
+}
+
+// NewRetryingLogClient wraps lc so that its reads are retried according to policy.
+func NewRetryingLogClient(lc trillian.TrillianLogClient, policy client.RetryPolicy) *RetryingLogClient {
+	r := &RetryingLogClient{
+		client:    lc,
+		policy:    policy,
+		random:    rand.Float64,
+		vars:      new(expvar.Map).Init(),
+		retries:   new(expvar.Map).Init(),
+		exhausted: new(expvar.Int),
+	}
+	r.routedLogClient = routedLogClient{route: r.call}
+	r.vars.Set("retries", r.retries)
+	r.vars.Set("exhausted", r.exhausted)
+	return r
+}
+
+// Vars returns the stats of the client: the number of retries of each RPC method, and the
+// number of RPCs that still failed after every attempt.
+func (r *RetryingLogClient) Vars() *expvar.Map {
+	return r.vars
+}
+
+// wait returns how long to wait before the given retry: a random time between half and
+// all of the policy's backoff, so that requests that failed together don't all retry at
+// the same moment.
+func (r *RetryingLogClient) wait(retry int) time.Duration {
+	d := r.policy.Backoff(retry)
+	return d/2 + time.Duration(r.random()*float64(d/2))
+}
+
+func (r *RetryingLogClient) call(ctx context.Context, method string, read bool, rpc func(trillian.TrillianLogClient) error) error {
+	for attempt := 1; ; attempt++ {
+		err := rpc(r.client)
+		if err == nil || !read || !retryableRead(err) || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= r.policy.MaxAttempts {
+			if r.policy.MaxAttempts > 1 {
+				r.exhausted.Add(1)
+			}
+			return err
+		}
+
+		wait := r.wait(attempt)
+		glog.V(1).Infof("%s: retrying in %v after attempt %d failed: %v", method, wait, attempt, err)
+		r.retries.Add(method, 1)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
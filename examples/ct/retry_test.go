@@ -0,0 +1,154 @@
+package ct
+
+import (
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/client"
+	"github.com/google/trillian/mockclient"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errBadRequest = status.Error(codes.InvalidArgument, "bad request")
+
+var fastRetry = client.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, Multiplier: 2}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	var tests = []struct {
+		p     client.RetryPolicy
+		retry int
+		want  time.Duration
+	}{
+		{p: DefaultRetryPolicy, retry: 1, want: 50 * time.Millisecond},
+		{p: DefaultRetryPolicy, retry: 3, want: 200 * time.Millisecond},
+		{p: DefaultRetryPolicy, retry: 10, want: time.Second},
+		{p: client.RetryPolicy{InitialBackoff: time.Second}, retry: 5, want: time.Second},
+		{p: client.RetryPolicy{InitialBackoff: time.Second, Multiplier: 3}, retry: 3, want: 9 * time.Second},
+	}
+
+	for _, test := range tests {
+		if got := test.p.Backoff(test.retry); got != test.want {
+			t.Errorf("%+v.Backoff(%d)=%v, want %v", test.p, test.retry, got, test.want)
+		}
+	}
+}
+
+func TestRetryingLogClientWait(t *testing.T) {
+	r := NewRetryingLogClient(nil, DefaultRetryPolicy)
+	var tests = []struct {
+		random float64
+		want   time.Duration
+	}{
+		{random: 0, want: 25 * time.Millisecond},
+		{random: 0.5, want: 37500 * time.Microsecond},
+		{random: 1, want: 50 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		r.random = func() float64 { return test.random }
+		if got := r.wait(1); got != test.want {
+			t.Errorf("wait(1) with random %v=%v, want %v", test.random, got, test.want)
+		}
+	}
+}
+
+func TestRetryingLogClientRetriesReads(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mockclient.NewMockTrillianLogClient(ctrl)
+	r := NewRetryingLogClient(client, fastRetry)
+
+	req := &trillian.GetLatestSignedLogRootRequest{LogId: 1}
+	rsp := &trillian.GetLatestSignedLogRootResponse{}
+	gomock.InOrder(
+		client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Return(nil, errUnavailable),
+		client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Return(nil, status.Error(codes.DeadlineExceeded, "storage timed out")),
+		client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Return(rsp, nil),
+	)
+	if got, err := r.GetLatestSignedLogRoot(context.Background(), req); err != nil || got != rsp {
+		t.Fatalf("GetLatestSignedLogRoot()=%v,%v, want %v,nil", got, err, rsp)
+	}
+	if got, want := r.Vars().Get("retries").(*expvar.Map).Get("GetLatestSignedLogRoot").String(), "2"; got != want {
+		t.Errorf("retries[GetLatestSignedLogRoot]=%s, want %s", got, want)
+	}
+}
+
+func TestRetryingLogClientGivesUp(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mockclient.NewMockTrillianLogClient(ctrl)
+	r := NewRetryingLogClient(client, fastRetry)
+
+	req := &trillian.GetLeavesByIndexRequest{LogId: 1}
+	client.EXPECT().GetLeavesByIndex(gomock.Any(), req).Times(3).Return(nil, errUnavailable)
+	if _, err := r.GetLeavesByIndex(context.Background(), req); err != errUnavailable {
+		t.Errorf("GetLeavesByIndex()=_,%v, want %v", err, errUnavailable)
+	}
+	if got, want := r.Vars().Get("exhausted").String(), "1"; got != want {
+		t.Errorf("exhausted=%s, want %s", got, want)
+	}
+}
+
+func TestRetryingLogClientDoesNotRetry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mockclient.NewMockTrillianLogClient(ctrl)
+	r := NewRetryingLogClient(client, fastRetry)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var tests = []struct {
+		descr string
+		ctx   context.Context
+		call  func(ctx context.Context) error
+		err   error
+	}{
+		{
+			descr: "write",
+			ctx:   context.Background(),
+			call: func(ctx context.Context) error {
+				req := &trillian.QueueLeavesRequest{LogId: 1}
+				client.EXPECT().QueueLeaves(gomock.Any(), req).Return(nil, errUnavailable)
+				_, err := r.QueueLeaves(ctx, req)
+				return err
+			},
+			err: errUnavailable,
+		},
+		{
+			descr: "permanent-error",
+			ctx:   context.Background(),
+			call: func(ctx context.Context) error {
+				req := &trillian.GetConsistencyProofRequest{LogId: 1}
+				client.EXPECT().GetConsistencyProof(gomock.Any(), req).Return(nil, errBadRequest)
+				_, err := r.GetConsistencyProof(ctx, req)
+				return err
+			},
+			err: errBadRequest,
+		},
+		{
+			descr: "context-done",
+			ctx:   cancelled,
+			call: func(ctx context.Context) error {
+				req := &trillian.GetInclusionProofRequest{LogId: 1}
+				client.EXPECT().GetInclusionProof(gomock.Any(), req).Return(nil, errUnavailable)
+				_, err := r.GetInclusionProof(ctx, req)
+				return err
+			},
+			err: errUnavailable,
+		},
+	}
+
+	for _, test := range tests {
+		if err := test.call(test.ctx); err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.descr, err, test.err)
+		}
+	}
+	if got, want := r.Vars().Get("exhausted").String(), "0"; got != want {
+		t.Errorf("exhausted=%s, want %s", got, want)
+	}
+}
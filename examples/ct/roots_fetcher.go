@@ -0,0 +1,506 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/certificate-transparency/go/x509"
+)
+
+const (
+	// RootsFormatPEM is the format of a roots source holding concatenated PEM certificates.
+	RootsFormatPEM = "pem"
+	// RootsFormatCCADB is the format of a CCADB certificate report in CSV format, which
+	// holds a PEM encoded certificate in its "PEM Info" column.
+	RootsFormatCCADB = "ccadb-csv"
+	// How often roots are fetched from remote sources if the config doesn't say
+	defaultRootsRefreshInterval = 24 * time.Hour
+	// How often a roots directory is checked for changes if the config doesn't say
+	defaultRootsDirPollInterval = time.Minute
+	// Max size of a document fetched from a roots source
+	maxRootsDocumentSize = 32 << 20
+)
+
+// RootsSource describes a remote list of roots for a log to accept, which is fetched
+// periodically so the log's roots follow the policy the list is published for.
+type RootsSource struct {
+	// URL is where the list is fetched from.
+	URL string
+	// Format is RootsFormatPEM (the default) or RootsFormatCCADB.
+	Format string
+	// SHA256 optionally pins the hex encoded SHA-256 hash of the document at URL. A
+	// document that doesn't match is rejected, so the list only changes once the pin
+	// is updated.
+	SHA256 string
+}
+
+// rootsFetcher builds a log's pool of roots from its roots file, roots directory and
+// remote sources, and refreshes it periodically. Fetched roots are only used once they've
+// all been fetched and validated; until then, and whenever a refresh fails, the log
+// carries on with the roots it already has. The last good pool can be cached in a file,
+// so a log can start up even if its sources are unavailable. The roots directory is
+// polled more often than the sources are fetched, so roots added to it are picked up
+// quickly.
+type rootsFetcher struct {
+	logPrefix string
+	pemFile   string
+	dir       string
+	sources   []RootsSource
+	cacheFile string
+	client    *http.Client
+	done      chan struct{}
+
+	// mu guards remote, which holds the roots last fetched from the sources, and
+	// dirState, which describes the roots directory as it was last read. It's held
+	// while the roots are rebuilt so that concurrent updates apply in order.
+	mu       sync.Mutex
+	remote   []*x509.Certificate
+	dirState string
+
+	exp struct {
+		vars      *expvar.Map
+		refreshes *expvar.Int
+		failures  *expvar.Int
+		roots     *expvar.Int
+	}
+}
+
+func newRootsFetcher(logPrefix, pemFile, dir string, sources []RootsSource, cacheFile string, client *http.Client) (*rootsFetcher, error) {
+	for _, s := range sources {
+		if len(s.URL) == 0 {
+			return nil, errors.New("roots source has no URL")
+		}
+		switch s.Format {
+		case "", RootsFormatPEM, RootsFormatCCADB:
+		default:
+			return nil, fmt.Errorf("unknown format for roots source %s: %s", s.URL, s.Format)
+		}
+		if len(s.SHA256) > 0 {
+			if pin, err := hex.DecodeString(s.SHA256); err != nil || len(pin) != sha256.Size {
+				return nil, fmt.Errorf("invalid SHA256 pin for roots source %s", s.URL)
+			}
+		}
+	}
+	if client == nil {
+		client = &http.Client{Timeout: time.Minute}
+	}
+
+	f := &rootsFetcher{
+		logPrefix: logPrefix,
+		pemFile:   pemFile,
+		dir:       dir,
+		sources:   sources,
+		cacheFile: cacheFile,
+		client:    client,
+		done:      make(chan struct{}),
+	}
+	f.exp.vars = new(expvar.Map).Init()
+	f.exp.refreshes = new(expvar.Int)
+	f.exp.vars.Set("refreshes", f.exp.refreshes)
+	f.exp.failures = new(expvar.Int)
+	f.exp.vars.Set("refresh-failures", f.exp.failures)
+	f.exp.roots = new(expvar.Int)
+	f.exp.vars.Set("roots", f.exp.roots)
+	return f, nil
+}
+
+// load builds a new pool from the roots file, the roots directory and all the sources.
+func (f *rootsFetcher) load() (*PEMCertPool, error) {
+	remote, err := f.fetchSources()
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pool, err := f.loadLocal(remote)
+	if err != nil {
+		return nil, err
+	}
+	f.remote = remote
+	return pool, nil
+}
+
+// fetchSources fetches the roots from all the sources.
+func (f *rootsFetcher) fetchSources() ([]*x509.Certificate, error) {
+	var remote []*x509.Certificate
+	for _, s := range f.sources {
+		certs, err := f.fetch(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch roots from %s: %v", s.URL, err)
+		}
+		remote = append(remote, certs...)
+	}
+	return remote, nil
+}
+
+// loadLocal builds a new pool from the roots file, the roots directory and the given
+// roots fetched from the sources. f.mu must be held.
+func (f *rootsFetcher) loadLocal(remote []*x509.Certificate) (*PEMCertPool, error) {
+	pool := NewPEMCertPool()
+	if len(f.pemFile) > 0 {
+		if err := pool.AppendCertsFromPEMFile(f.pemFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(f.dir) > 0 {
+		state, err := rootsDirState(f.dir)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := loadRootsDir(f.dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range certs {
+			pool.AddCert(cert)
+		}
+		f.dirState = state
+	}
+	for _, cert := range remote {
+		pool.AddCert(cert)
+	}
+	if len(pool.RawCertificates()) == 0 {
+		return nil, errors.New("no roots found")
+	}
+	return pool, nil
+}
+
+// initialRoots returns the pool a log should start with: freshly fetched if possible,
+// otherwise the cached pool.
+func (f *rootsFetcher) initialRoots() (*PEMCertPool, error) {
+	pool, err := f.load()
+	if err == nil {
+		f.fetched(pool)
+		return pool, nil
+	}
+	if len(f.cacheFile) == 0 {
+		return nil, err
+	}
+
+	glog.Warningf("%s: %v, using cached roots from %s", f.logPrefix, err, f.cacheFile)
+	f.exp.failures.Add(1)
+	pool = NewPEMCertPool()
+	if cacheErr := pool.AppendCertsFromPEMFile(f.cacheFile); cacheErr != nil {
+		return nil, fmt.Errorf("%v, and no usable cached roots: %v", err, cacheErr)
+	}
+	f.exp.roots.Set(int64(len(pool.RawCertificates())))
+	return pool, nil
+}
+
+// refresh fetches the roots again and updates roots if they've changed.
+func (f *rootsFetcher) refresh(roots *TrustedRoots) error {
+	remote, err := f.fetchSources()
+	if err != nil {
+		f.exp.failures.Add(1)
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rebuild(roots, remote, "roots updated")
+}
+
+// reloadDir rebuilds the roots if the roots directory has changed since it was last
+// read, keeping the roots last fetched from the sources.
+func (f *rootsFetcher) reloadDir(roots *TrustedRoots) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	state, err := rootsDirState(f.dir)
+	if err != nil {
+		f.exp.failures.Add(1)
+		return err
+	}
+	if state == f.dirState {
+		return nil
+	}
+	return f.rebuild(roots, f.remote, "roots directory changed")
+}
+
+// reloadLocal rebuilds the roots after the roots file or directory has been changed,
+// keeping the roots last fetched from the sources.
+func (f *rootsFetcher) reloadLocal(roots *TrustedRoots) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rebuild(roots, f.remote, "local roots changed")
+}
+
+// rebuild builds a new pool from the local roots and remote, and updates roots if it's
+// changed. f.mu must be held.
+func (f *rootsFetcher) rebuild(roots *TrustedRoots, remote []*x509.Certificate, reason string) error {
+	pool, err := f.loadLocal(remote)
+	if err != nil {
+		f.exp.failures.Add(1)
+		return err
+	}
+	f.remote = remote
+	if pool.Fingerprint() != roots.Pool().Fingerprint() {
+		glog.Infof("%s: %s, now accepting %d roots", f.logPrefix, reason, len(pool.RawCertificates()))
+		roots.Update(pool)
+	}
+	f.fetched(pool)
+	return nil
+}
+
+// fetched records a successfully fetched pool.
+func (f *rootsFetcher) fetched(pool *PEMCertPool) {
+	f.exp.refreshes.Add(1)
+	f.exp.roots.Set(int64(len(pool.RawCertificates())))
+	if len(f.cacheFile) == 0 {
+		return
+	}
+	if err := writeRootsCache(f.cacheFile, pool); err != nil {
+		glog.Warningf("%s: failed to cache roots: %v", f.logPrefix, err)
+	}
+}
+
+// Start starts a goroutine that refreshes roots every interval, and checks the roots
+// directory for changes every dirInterval, until Stop is called.
+func (f *rootsFetcher) Start(roots *TrustedRoots, interval, dirInterval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var dirTicks <-chan time.Time
+		if len(f.dir) > 0 {
+			dirTicker := time.NewTicker(dirInterval)
+			defer dirTicker.Stop()
+			dirTicks = dirTicker.C
+		}
+
+		for {
+			select {
+			case <-f.done:
+				return
+			case <-ticker.C:
+				if err := f.refresh(roots); err != nil {
+					glog.Warningf("%s: failed to refresh roots, keeping the current ones: %v", f.logPrefix, err)
+				}
+			case <-dirTicks:
+				if err := f.reloadDir(roots); err != nil {
+					glog.Warningf("%s: failed to reload roots directory, keeping the current roots: %v", f.logPrefix, err)
+				}
+			}
+		}
+	}()
+}
+
+// Vars returns the statistics exported by this rootsFetcher.
+func (f *rootsFetcher) Vars() *expvar.Map {
+	return f.exp.vars
+}
+
+// Stop stops refreshing roots.
+func (f *rootsFetcher) Stop() {
+	close(f.done)
+}
+
+// fetch fetches and validates the roots from a single source.
+func (f *rootsFetcher) fetch(s RootsSource) ([]*x509.Certificate, error) {
+	rsp, err := f.client.Get(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got HTTP status %s", rsp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(rsp.Body, maxRootsDocumentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxRootsDocumentSize {
+		return nil, fmt.Errorf("document larger than %d bytes", maxRootsDocumentSize)
+	}
+
+	if len(s.SHA256) > 0 {
+		got := sha256.Sum256(body)
+		if want := strings.ToLower(s.SHA256); hex.EncodeToString(got[:]) != want {
+			return nil, fmt.Errorf("document hash %x does not match pinned hash %s", got, want)
+		}
+	}
+
+	var certs []*x509.Certificate
+	if s.Format == RootsFormatCCADB {
+		certs, err = parseCCADBRoots(body)
+	} else {
+		certs, err = parsePEMRoots(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		// Never let a broken source empty the log's roots.
+		return nil, errors.New("no certificates found")
+	}
+	for _, cert := range certs {
+		if err := checkRoot(cert); err != nil {
+			return nil, err
+		}
+	}
+	return certs, nil
+}
+
+// checkRoot returns an error if cert isn't a self-signed CA certificate.
+func checkRoot(cert *x509.Certificate) error {
+	if !cert.IsCA {
+		return fmt.Errorf("certificate for %v is not a CA", cert.Subject)
+	}
+	if err := cert.CheckSignatureFrom(cert); err != nil {
+		return fmt.Errorf("certificate for %v is not self-signed: %v", cert.Subject, err)
+	}
+	return nil
+}
+
+// parsePEMRoots parses concatenated PEM certificates. Non certificate blocks are skipped.
+func parsePEMRoots(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for len(data) > 0 {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != pemCertificateBlockType {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// parseCCADBRoots parses a CCADB report in CSV format, taking the certificates from
+// the "PEM Info" column. CCADB wraps the PEM data in single quotes.
+func parseCCADBRoots(data []byte) ([]*x509.Certificate, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty CSV")
+	}
+	col := -1
+	for i, name := range records[0] {
+		if strings.TrimSpace(name) == "PEM Info" {
+			col = i
+		}
+	}
+	if col < 0 {
+		return nil, errors.New("no PEM Info column in CSV")
+	}
+
+	var certs []*x509.Certificate
+	for _, record := range records[1:] {
+		if col >= len(record) {
+			return nil, fmt.Errorf("CSV record has %d fields, want at least %d", len(record), col+1)
+		}
+		pemData := strings.Trim(strings.TrimSpace(record[col]), "'")
+		recordCerts, err := parsePEMRoots([]byte(pemData))
+		if err != nil {
+			return nil, err
+		}
+		if len(recordCerts) != 1 {
+			return nil, fmt.Errorf("CSV record has %d certificates, want 1", len(recordCerts))
+		}
+		certs = append(certs, recordCerts[0])
+	}
+	return certs, nil
+}
+
+// rootsDirState returns a description of the root files in dir that changes whenever
+// any of them is added, removed or modified.
+func rootsDirState(dir string) (string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var state bytes.Buffer
+	for _, file := range files {
+		if isRootFile(file) {
+			fmt.Fprintf(&state, "%s:%d:%d\n", file.Name(), file.Size(), file.ModTime().UnixNano())
+		}
+	}
+	return state.String(), nil
+}
+
+// isRootFile returns true for the files in a roots directory that hold roots: regular
+// files with a .pem, .crt, .cer or .der extension, other than hidden ones.
+func isRootFile(file os.FileInfo) bool {
+	if !file.Mode().IsRegular() || strings.HasPrefix(file.Name(), ".") {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(file.Name())) {
+	case ".pem", ".crt", ".cer", ".der":
+		return true
+	}
+	return false
+}
+
+// loadRootsDir reads the roots held in dir. Each root file holds either PEM certificates
+// or a single DER encoded one.
+func loadRootsDir(dir string) ([]*x509.Certificate, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for _, file := range files {
+		if !isRootFile(file) {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var fileCerts []*x509.Certificate
+		if bytes.Contains(data, []byte("-----BEGIN")) {
+			fileCerts, err = parsePEMRoots(data)
+		} else {
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(data); err == nil {
+				fileCerts = []*x509.Certificate{cert}
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		if len(fileCerts) == 0 {
+			return nil, fmt.Errorf("no certificates found in %s", path)
+		}
+		certs = append(certs, fileCerts...)
+	}
+	return certs, nil
+}
+
+// writeRootsCache writes pool to path as concatenated PEM certificates. The file is
+// replaced atomically so a failed write doesn't leave a truncated cache behind.
+func writeRootsCache(path string, pool *PEMCertPool) error {
+	var buf bytes.Buffer
+	for _, cert := range pool.RawCertificates() {
+		if err := pem.Encode(&buf, &pem.Block{Type: pemCertificateBlockType, Bytes: cert.Raw}); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
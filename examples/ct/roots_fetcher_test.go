@@ -0,0 +1,275 @@
+package ct
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian/examples/ct/testonly"
+)
+
+// ccadbCSV builds a CCADB style CSV report holding the given PEM certificates.
+func ccadbCSV(pems ...string) string {
+	csv := "\"Owner\",\"Certificate Name\",\"PEM Info\"\n"
+	for i, p := range pems {
+		csv += fmt.Sprintf("\"Owner %d\",\"Cert %d\",\"'%s'\"\n", i, i, strings.TrimSpace(p))
+	}
+	return csv
+}
+
+func hashHex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func TestRootsFetcherFetch(t *testing.T) {
+	docs := map[string]string{
+		"/roots.pem":        testonly.FakeCACertPEM,
+		"/roots.csv":        ccadbCSV(testonly.FakeCACertPEM),
+		"/intermediate.pem": testonly.FakeIntermediateCertPEM,
+		"/empty.pem":        "",
+		"/garbage.csv":      "\"Owner\",\"PEM Info\"\n\"Owner\",\"'not a cert'\"\n",
+		"/nopem.csv":        "\"Owner\",\"Certificate Name\"\n\"Owner\",\"Cert\"\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(doc))
+	}))
+	defer server.Close()
+
+	var tests = []struct {
+		source RootsSource
+		want   int
+	}{
+		{source: RootsSource{URL: "/roots.pem"}, want: 1},
+		{source: RootsSource{URL: "/roots.pem", Format: RootsFormatPEM, SHA256: hashHex(docs["/roots.pem"])}, want: 1},
+		{source: RootsSource{URL: "/roots.pem", SHA256: strings.ToUpper(hashHex(docs["/roots.pem"]))}, want: 1},
+		{source: RootsSource{URL: "/roots.csv", Format: RootsFormatCCADB}, want: 1},
+		// Pinned hash doesn't match
+		{source: RootsSource{URL: "/roots.pem", SHA256: hashHex("something else")}},
+		// Not self-signed
+		{source: RootsSource{URL: "/intermediate.pem"}},
+		{source: RootsSource{URL: "/empty.pem"}},
+		{source: RootsSource{URL: "/roots.pem", Format: RootsFormatCCADB}},
+		{source: RootsSource{URL: "/garbage.csv", Format: RootsFormatCCADB}},
+		{source: RootsSource{URL: "/nopem.csv", Format: RootsFormatCCADB}},
+		{source: RootsSource{URL: "/missing.pem"}},
+	}
+
+	for _, test := range tests {
+		test.source.URL = server.URL + test.source.URL
+		f, err := newRootsFetcher("test", "", "", []RootsSource{test.source}, "", nil)
+		if err != nil {
+			t.Fatalf("newRootsFetcher(%+v)=_,%v, want no error", test.source, err)
+		}
+		certs, err := f.fetch(test.source)
+		if test.want == 0 {
+			if err == nil {
+				t.Errorf("fetch(%+v)=%d certs, want error", test.source, len(certs))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("fetch(%+v)=_,%v, want no error", test.source, err)
+			continue
+		}
+		if got := len(certs); got != test.want {
+			t.Errorf("fetch(%+v)=%d certs, want %d", test.source, got, test.want)
+		}
+	}
+}
+
+func TestNewRootsFetcherInvalidSources(t *testing.T) {
+	for _, source := range []RootsSource{
+		{},
+		{URL: "http://example.com/roots", Format: "der"},
+		{URL: "http://example.com/roots", SHA256: "not hex"},
+		{URL: "http://example.com/roots", SHA256: "abcd"},
+	} {
+		if _, err := newRootsFetcher("test", "", "", []RootsSource{source}, "", nil); err == nil {
+			t.Errorf("newRootsFetcher(%+v)=_,nil, want error", source)
+		}
+	}
+}
+
+func TestRootsFetcherRefresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roots")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cacheFile := filepath.Join(dir, "roots-cache.pem")
+	pemFile := filepath.Join(dir, "roots.pem")
+	if err := ioutil.WriteFile(pemFile, []byte(testonly.CACertPEM), 0644); err != nil {
+		t.Fatalf("Failed to write roots file: %v", err)
+	}
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(testonly.FakeCACertPEM))
+	}))
+	defer server.Close()
+
+	sources := []RootsSource{{URL: server.URL}}
+	f, err := newRootsFetcher("test", pemFile, "", sources, cacheFile, nil)
+	if err != nil {
+		t.Fatalf("newRootsFetcher()=_,%v, want no error", err)
+	}
+	pool, err := f.initialRoots()
+	if err != nil {
+		t.Fatalf("initialRoots()=_,%v, want no error", err)
+	}
+	if got, want := len(pool.RawCertificates()), 2; got != want {
+		t.Fatalf("initialRoots() returned %d roots, want %d", got, want)
+	}
+	roots := NewTrustedRoots(pool)
+
+	// A failed refresh keeps the roots we already have.
+	status = http.StatusInternalServerError
+	if err := f.refresh(roots); err == nil {
+		t.Error("refresh()=nil with server failing, want error")
+	}
+	if got, want := roots.Pool(), pool; got != want {
+		t.Error("refresh() changed roots with server failing")
+	}
+
+	// A refresh with the same roots doesn't replace the pool.
+	status = http.StatusOK
+	if err := f.refresh(roots); err != nil {
+		t.Fatalf("refresh()=%v, want no error", err)
+	}
+	if got, want := roots.Pool(), pool; got != want {
+		t.Error("refresh() replaced roots when they hadn't changed")
+	}
+
+	// A refresh with new roots does.
+	if err := ioutil.WriteFile(pemFile, []byte(testonly.CACertMultiplePEM), 0644); err != nil {
+		t.Fatalf("Failed to write roots file: %v", err)
+	}
+	if err := f.refresh(roots); err != nil {
+		t.Fatalf("refresh()=%v, want no error", err)
+	}
+	if got, want := len(roots.Pool().RawCertificates()), 3; got != want {
+		t.Errorf("refresh() left %d roots, want %d", got, want)
+	}
+	if got, want := f.exp.failures.String(), "1"; got != want {
+		t.Errorf("refresh-failures=%s, want %s", got, want)
+	}
+
+	// Starting up with the source unavailable uses the cached roots.
+	status = http.StatusNotFound
+	f, err = newRootsFetcher("test", pemFile, "", sources, cacheFile, nil)
+	if err != nil {
+		t.Fatalf("newRootsFetcher()=_,%v, want no error", err)
+	}
+	pool, err = f.initialRoots()
+	if err != nil {
+		t.Fatalf("initialRoots()=_,%v with cache, want no error", err)
+	}
+	if got, want := pool.Fingerprint(), roots.Pool().Fingerprint(); got != want {
+		t.Error("initialRoots() didn't return the cached roots")
+	}
+
+	// But without a cache it fails.
+	f, err = newRootsFetcher("test", pemFile, "", sources, "", nil)
+	if err != nil {
+		t.Fatalf("newRootsFetcher()=_,%v, want no error", err)
+	}
+	if _, err := f.initialRoots(); err == nil {
+		t.Error("initialRoots()=_,nil with no source or cache, want error")
+	}
+}
+
+func TestRootsFetcherDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roots")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	writeFile("fake-ca.pem", testonly.FakeCACertPEM)
+	// Files without a root extension are ignored, as are hidden ones.
+	writeFile("README", "not a cert")
+	writeFile(".new.pem", "not a cert either")
+
+	f, err := newRootsFetcher("test", "", dir, nil, "", nil)
+	if err != nil {
+		t.Fatalf("newRootsFetcher()=_,%v, want no error", err)
+	}
+	pool, err := f.initialRoots()
+	if err != nil {
+		t.Fatalf("initialRoots()=_,%v, want no error", err)
+	}
+	if got, want := len(pool.RawCertificates()), 1; got != want {
+		t.Fatalf("initialRoots() returned %d roots, want %d", got, want)
+	}
+	roots := NewTrustedRoots(pool)
+
+	if err := f.reloadDir(roots); err != nil {
+		t.Fatalf("reloadDir()=%v, want no error", err)
+	}
+	if got, want := roots.Pool(), pool; got != want {
+		t.Error("reloadDir() replaced roots when the directory hadn't changed")
+	}
+
+	// Adding a DER root is picked up.
+	block, _ := pem.Decode([]byte(testonly.CACertPEM))
+	writeFile("ca.der", string(block.Bytes))
+	if err := f.reloadDir(roots); err != nil {
+		t.Fatalf("reloadDir()=%v, want no error", err)
+	}
+	if got, want := len(roots.Pool().RawCertificates()), 2; got != want {
+		t.Errorf("reloadDir() left %d roots, want %d", got, want)
+	}
+
+	// A broken root file keeps the roots we already have.
+	writeFile("broken.crt", "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n")
+	if err := f.reloadDir(roots); err == nil {
+		t.Error("reloadDir()=nil with a broken file, want error")
+	}
+	if got, want := len(roots.Pool().RawCertificates()), 2; got != want {
+		t.Errorf("reloadDir() left %d roots with a broken file, want %d", got, want)
+	}
+	if got, want := f.exp.failures.String(), "1"; got != want {
+		t.Errorf("refresh-failures=%s, want %s", got, want)
+	}
+
+	// As does removing all of them.
+	for _, name := range []string{"fake-ca.pem", "ca.der", "broken.crt"} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("Failed to remove %s: %v", name, err)
+		}
+	}
+	if err := f.reloadDir(roots); err == nil {
+		t.Error("reloadDir()=nil with no roots, want error")
+	}
+	if got, want := len(roots.Pool().RawCertificates()), 2; got != want {
+		t.Errorf("reloadDir() left %d roots with no roots, want %d", got, want)
+	}
+
+	// Removing a root stops it being accepted.
+	writeFile("ca.der", string(block.Bytes))
+	if err := f.reloadDir(roots); err != nil {
+		t.Fatalf("reloadDir()=%v, want no error", err)
+	}
+	if got, want := len(roots.Pool().RawCertificates()), 1; got != want {
+		t.Errorf("reloadDir() left %d roots, want %d", got, want)
+	}
+}
@@ -7,15 +7,18 @@ import (
 	"time"
 
 	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/asn1"
 	"github.com/google/certificate-transparency/go/tls"
 	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+	"github.com/google/trillian"
 	"github.com/google/trillian/crypto"
 )
 
 // signV1TreeHead signs a tree head for CT. The input STH should have been built from a
 // backend response and already checked for validity.
 func signV1TreeHead(km crypto.KeyManager, sth *ct.SignedTreeHead) error {
-	signer, err := km.Signer()
+	trillianSigner, sigAlg, err := logSigner(km)
 	if err != nil {
 		return err
 	}
@@ -25,19 +28,13 @@ func signV1TreeHead(km crypto.KeyManager, sth *ct.SignedTreeHead) error {
 		return err
 	}
 
-	trillianSigner := crypto.NewSigner(crypto.NewSHA256(), km.SignatureAlgorithm(), signer)
-
 	signature, err := trillianSigner.Sign(sthBytes)
 	if err != nil {
 		return err
 	}
 
 	sth.TreeHeadSignature = ct.DigitallySigned{
-		Algorithm: tls.SignatureAndHashAlgorithm{
-			Hash: tls.SHA256,
-			// This relies on the protobuf enum values matching the TLS-defined values.
-			Signature: tls.SignatureAlgorithm(km.SignatureAlgorithm()),
-		},
+		Algorithm: sigAlg,
 		Signature: signature.Signature,
 	}
 
@@ -67,6 +64,17 @@ func signV1SCTForCertificate(km crypto.KeyManager, cert, issuer *x509.Certificat
 // signV1SCTForPrecertificate builds and signs a V1 CT SCT for a pre-certificate using the key
 // held by a key manager.
 func signV1SCTForPrecertificate(km crypto.KeyManager, cert, issuer *x509.Certificate, t time.Time) (ct.MerkleTreeLeaf, ct.SignedCertificateTimestamp, error) {
+	return signV1SCTForPrecert(km, cert, issuer, t, false)
+}
+
+// signV1SCTForPrecertSigningCert builds and signs a V1 CT SCT for a pre-certificate signed
+// by a Precertificate Signing Certificate on behalf of issuer, the CA that will issue the
+// final certificate.
+func signV1SCTForPrecertSigningCert(km crypto.KeyManager, cert, issuer *x509.Certificate, t time.Time) (ct.MerkleTreeLeaf, ct.SignedCertificateTimestamp, error) {
+	return signV1SCTForPrecert(km, cert, issuer, t, true)
+}
+
+func signV1SCTForPrecert(km crypto.KeyManager, cert, issuer *x509.Certificate, t time.Time, viaSigningCert bool) (ct.MerkleTreeLeaf, ct.SignedCertificateTimestamp, error) {
 	if issuer == nil {
 		// Need issuer for the IssuerKeyHash
 		return ct.MerkleTreeLeaf{}, ct.SignedCertificateTimestamp{}, errors.New("no issuer available for pre-certificate")
@@ -83,6 +91,13 @@ func signV1SCTForPrecertificate(km crypto.KeyManager, cert, issuer *x509.Certifi
 	if err != nil {
 		return ct.MerkleTreeLeaf{}, ct.SignedCertificateTimestamp{}, fmt.Errorf("failed to remove poison extension: %v", err)
 	}
+	if viaSigningCert {
+		// The precert wasn't signed by issuer, the final certificate's CA, so the
+		// TBSCertificate is changed to be that of the final certificate (RFC 6962 section 3.2).
+		if defangedTBS, err = setTBSIssuer(defangedTBS, issuer); err != nil {
+			return ct.MerkleTreeLeaf{}, ct.SignedCertificateTimestamp{}, fmt.Errorf("failed to set final issuer: %v", err)
+		}
+	}
 	precert := ct.PreCert{
 		IssuerKeyHash:  keyHash,
 		TBSCertificate: defangedTBS,
@@ -102,6 +117,59 @@ func signV1SCTForPrecertificate(km crypto.KeyManager, cert, issuer *x509.Certifi
 	return serializeAndSignSCT(km, leaf, sctInput, t)
 }
 
+// tbsCertificate is the ASN.1 structure of a TBSCertificate, leaving encoded the parts that
+// setTBSIssuer doesn't change.
+type tbsCertificate struct {
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       asn1.RawValue
+	SignatureAlgorithm asn1.RawValue
+	Issuer             asn1.RawValue
+	Validity           asn1.RawValue
+	Subject            asn1.RawValue
+	PublicKey          asn1.RawValue
+	UniqueID           asn1.BitString   `asn1:"optional,tag:1"`
+	SubjectUniqueID    asn1.BitString   `asn1:"optional,tag:2"`
+	Extensions         []pkix.Extension `asn1:"optional,explicit,tag:3"`
+}
+
+// authKeyID is the value of an authority key identifier extension.
+type authKeyID struct {
+	ID []byte `asn1:"optional,tag:0"`
+}
+
+// OID of the X.509 authority key identifier extension
+var authorityKeyIDOID = asn1.ObjectIdentifier{2, 5, 29, 35}
+
+// setTBSIssuer changes the issuer of a DER encoded TBSCertificate to issuer, and its
+// authority key identifier, if it has one, to identify issuer's key. The identifier is
+// removed if issuer doesn't have a subject key identifier.
+func setTBSIssuer(tbsData []byte, issuer *x509.Certificate) ([]byte, error) {
+	var tbs tbsCertificate
+	if rest, err := asn1.Unmarshal(tbsData, &tbs); err != nil {
+		return nil, fmt.Errorf("failed to parse TBSCertificate: %v", err)
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after TBSCertificate")
+	}
+
+	tbs.Issuer = asn1.RawValue{FullBytes: issuer.RawSubject}
+	exts := tbs.Extensions[:0]
+	for _, ext := range tbs.Extensions {
+		if authorityKeyIDOID.Equal(ext.Id) {
+			if len(issuer.SubjectKeyId) == 0 {
+				continue
+			}
+			value, err := asn1.Marshal(authKeyID{ID: issuer.SubjectKeyId})
+			if err != nil {
+				return nil, fmt.Errorf("failed to build authority key identifier: %v", err)
+			}
+			ext.Value = value
+		}
+		exts = append(exts, ext)
+	}
+	tbs.Extensions = exts
+	return asn1.Marshal(tbs)
+}
+
 func serializeAndSignSCT(km crypto.KeyManager, leaf ct.MerkleTreeLeaf, sctInput ct.SignedCertificateTimestamp, t time.Time) (ct.MerkleTreeLeaf, ct.SignedCertificateTimestamp, error) {
 	// Serialize SCT signature input to get the bytes that need to be signed
 	res, err := ct.SerializeSCTSignatureInput(sctInput, ct.LogEntry{Leaf: leaf})
@@ -119,24 +187,18 @@ func serializeAndSignSCT(km crypto.KeyManager, leaf ct.MerkleTreeLeaf, sctInput
 }
 
 func signSCT(km crypto.KeyManager, t time.Time, sctData []byte) (ct.SignedCertificateTimestamp, error) {
-	signer, err := km.Signer()
+	trillianSigner, sigAlg, err := logSigner(km)
 	if err != nil {
-		return ct.SignedCertificateTimestamp{}, fmt.Errorf("failed to retrieve signer: %v", err)
+		return ct.SignedCertificateTimestamp{}, err
 	}
 
-	trillianSigner := crypto.NewSigner(crypto.NewSHA256(), km.SignatureAlgorithm(), signer)
-
 	signature, err := trillianSigner.Sign(sctData)
 	if err != nil {
 		return ct.SignedCertificateTimestamp{}, fmt.Errorf("failed to sign data: %v", err)
 	}
 
 	digitallySigned := ct.DigitallySigned{
-		Algorithm: tls.SignatureAndHashAlgorithm{
-			Hash: tls.SHA256,
-			// This relies on the protobuf enum values matching the TLS-defined values.
-			Signature: tls.SignatureAlgorithm(km.SignatureAlgorithm()),
-		},
+		Algorithm: sigAlg,
 		Signature: signature.Signature,
 	}
 
@@ -154,6 +216,43 @@ func signSCT(km crypto.KeyManager, t time.Time, sctData []byte) (ct.SignedCertif
 	}, nil
 }
 
+// TLS identifiers for Ed25519 signatures, which sign the data itself rather than a hash
+// of it. The tls package doesn't define them.
+const (
+	tlsIntrinsic tls.HashAlgorithm      = 8
+	tlsEd25519   tls.SignatureAlgorithm = 7
+)
+
+// logSigner returns a signer that signs with the key held by km, and the TLS identifiers
+// of its signature and hash algorithms. The signature algorithm is the key manager's or,
+// if it doesn't know, the one for the type of the signer's key: ECDSA, RSA with PKCS#1
+// v1.5 signatures, which RFC 6962 also allows, or Ed25519. All but Ed25519 sign a SHA-256
+// hash of the data.
+func logSigner(km crypto.KeyManager) (*crypto.Signer, tls.SignatureAndHashAlgorithm, error) {
+	signer, err := km.Signer()
+	if err != nil {
+		return nil, tls.SignatureAndHashAlgorithm{}, fmt.Errorf("failed to retrieve signer: %v", err)
+	}
+	alg := km.SignatureAlgorithm()
+	if alg == trillian.SignatureAlgorithm_ANONYMOUS {
+		if alg, err = crypto.SignatureAlgorithmForKey(signer.Public()); err != nil {
+			return nil, tls.SignatureAndHashAlgorithm{}, err
+		}
+	}
+	sigAlg := tls.SignatureAndHashAlgorithm{Hash: tls.SHA256}
+	switch alg {
+	case trillian.SignatureAlgorithm_ECDSA:
+		sigAlg.Signature = tls.ECDSA
+	case trillian.SignatureAlgorithm_RSA:
+		sigAlg.Signature = tls.RSA
+	case trillian.SignatureAlgorithm_ED25519:
+		sigAlg = tls.SignatureAndHashAlgorithm{Hash: tlsIntrinsic, Signature: tlsEd25519}
+	default:
+		return nil, tls.SignatureAndHashAlgorithm{}, fmt.Errorf("unsupported signature algorithm: %v", alg)
+	}
+	return crypto.NewSigner(crypto.NewSHA256(), alg, signer), sigAlg, nil
+}
+
 func getSCTForSignatureInput(t time.Time) ct.SignedCertificateTimestamp {
 	return ct.SignedCertificateTimestamp{
 		SCTVersion: ct.V1,
@@ -12,7 +12,10 @@ import (
 	"github.com/google/certificate-transparency/go/fixchain"
 	"github.com/google/certificate-transparency/go/tls"
 	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
 	"github.com/google/trillian/examples/ct/testonly"
+	trilliantestonly "github.com/google/trillian/testonly"
 )
 
 func TestSignV1SCTForCertificate(t *testing.T) {
@@ -141,3 +144,128 @@ func TestSignV1SCTForPrecertificate(t *testing.T) {
 		t.Fatalf("TBS cert mismatch, got %v, expected %v", got, want)
 	}
 }
+
+func TestSignV1SCTForPrecertSigningCert(t *testing.T) {
+	chain := createPrecertSigningChain(t)
+	km := loadTestKeyManager(t)
+
+	leaf, _, err := signV1SCTForPrecertSigningCert(km, chain.precert, chain.ca, fixedTime)
+	if err != nil {
+		t.Fatalf("signV1SCTForPrecertSigningCert()=_,_,%v, want no error", err)
+	}
+	// The leaf has the TBSCertificate of the final certificate, without SCTs, and the key
+	// hash of its CA rather than the Precertificate Signing Certificate.
+	entry := leaf.TimestampedEntry.PrecertEntry
+	if got, want := entry.TBSCertificate, chain.final.RawTBSCertificate; !bytes.Equal(got, want) {
+		t.Errorf("TBSCertificate=%x, want %x", got, want)
+	}
+	if got, want := entry.IssuerKeyHash, sha256.Sum256(chain.ca.RawSubjectPublicKeyInfo); got != want {
+		t.Errorf("IssuerKeyHash=%x, want %x", got, want)
+	}
+
+	// Without the signing certificate's changes, the TBSCertificate is the precert's.
+	leaf, _, err = signV1SCTForPrecertificate(km, chain.precert, chain.ca, fixedTime)
+	if err != nil {
+		t.Fatalf("signV1SCTForPrecertificate()=_,_,%v, want no error", err)
+	}
+	if got, notWant := leaf.TimestampedEntry.PrecertEntry.TBSCertificate, chain.final.RawTBSCertificate; bytes.Equal(got, notWant) {
+		t.Errorf("signV1SCTForPrecertificate() TBSCertificate is the final certificate's")
+	}
+}
+
+func loadTestRSAKeyManager(t *testing.T) *crypto.PEMKeyManager {
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPrivateKey(testonly.CTLogRSAPrivateKeyPEM, testonly.CTLogKeyPassword); err != nil {
+		t.Fatalf("Failed to load private key: %v", err)
+	}
+	if err := km.LoadPublicKey(testonly.CTLogRSAPublicKeyPEM); err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	return km
+}
+
+// unknownAlgorithmKeyManager is a key manager that doesn't know its signature algorithm.
+type unknownAlgorithmKeyManager struct {
+	crypto.KeyManager
+}
+
+func (unknownAlgorithmKeyManager) SignatureAlgorithm() trillian.SignatureAlgorithm {
+	return trillian.SignatureAlgorithm_ANONYMOUS
+}
+
+func loadTestEd25519KeyManager(t *testing.T) *crypto.PEMKeyManager {
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPrivateKey(trilliantestonly.DemoEd25519PrivateKey, trilliantestonly.DemoPrivateKeyPass); err != nil {
+		t.Fatalf("Failed to load private key: %v", err)
+	}
+	if err := km.LoadPublicKey(trilliantestonly.DemoEd25519PublicKey); err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	return km
+}
+
+func TestSignWithKeyTypes(t *testing.T) {
+	cert, _ := createTestCert(t, "leaf.example.com", false, "", nil, nil)
+	root := trillian.SignedLogRoot{TreeSize: 25, TimestampNanos: 12345000000, RootHash: make([]byte, 32)}
+	sha256ECDSA := tls.SignatureAndHashAlgorithm{Hash: tls.SHA256, Signature: tls.ECDSA}
+	sha256RSA := tls.SignatureAndHashAlgorithm{Hash: tls.SHA256, Signature: tls.RSA}
+	intrinsicEd25519 := tls.SignatureAndHashAlgorithm{Hash: tlsIntrinsic, Signature: tlsEd25519}
+
+	var tests = []struct {
+		descr string
+		km    crypto.KeyManager
+		want  tls.SignatureAndHashAlgorithm
+	}{
+		{descr: "ecdsa", km: loadTestKeyManager(t), want: sha256ECDSA},
+		{descr: "rsa", km: loadTestRSAKeyManager(t), want: sha256RSA},
+		{descr: "ed25519", km: loadTestEd25519KeyManager(t), want: intrinsicEd25519},
+		{descr: "ecdsa-from-key", km: unknownAlgorithmKeyManager{loadTestKeyManager(t)}, want: sha256ECDSA},
+		{descr: "rsa-from-key", km: unknownAlgorithmKeyManager{loadTestRSAKeyManager(t)}, want: sha256RSA},
+		{descr: "ed25519-from-key", km: unknownAlgorithmKeyManager{loadTestEd25519KeyManager(t)}, want: intrinsicEd25519},
+	}
+
+	for _, test := range tests {
+		pubKey, err := test.km.GetPublicKey()
+		if err != nil {
+			t.Fatalf("%s: GetPublicKey()=_,%v, want no error", test.descr, err)
+		}
+		sthVerifier, err := newSTHVerifier(pubKey)
+		if err != nil {
+			t.Fatalf("%s: newSTHVerifier()=_,%v, want no error", test.descr, err)
+		}
+		sctVerifier, ok := sthVerifier.(interface {
+			VerifySCTSignature(ct.SignedCertificateTimestamp, ct.LogEntry) error
+		})
+		if !ok {
+			t.Fatalf("%s: newSTHVerifier() can't verify SCTs", test.descr)
+		}
+
+		leaf, sct, err := signV1SCTForCertificate(test.km, cert, nil, fixedTime)
+		if err != nil {
+			t.Errorf("%s: signV1SCTForCertificate()=_,_,%v, want no error", test.descr, err)
+			continue
+		}
+		if got := sct.Signature.Algorithm; got != test.want {
+			t.Errorf("%s: SCT signature algorithm=%v, want %v", test.descr, got, test.want)
+		}
+		if err := sctVerifier.VerifySCTSignature(sct, ct.LogEntry{Leaf: leaf}); err != nil {
+			t.Errorf("%s: VerifySCTSignature()=%v, want no error", test.descr, err)
+		}
+
+		sth, err := signTreeHeadForRoot(test.km, root)
+		if err != nil {
+			t.Errorf("%s: signTreeHeadForRoot()=_,%v, want no error", test.descr, err)
+			continue
+		}
+		if got := sth.TreeHeadSignature.Algorithm; got != test.want {
+			t.Errorf("%s: STH signature algorithm=%v, want %v", test.descr, got, test.want)
+		}
+		if err := sthVerifier.VerifySTHSignature(sth); err != nil {
+			t.Errorf("%s: VerifySTHSignature()=%v, want no error", test.descr, err)
+		}
+		sth.TreeSize++
+		if err := sthVerifier.VerifySTHSignature(sth); err == nil {
+			t.Errorf("%s: VerifySTHSignature(modified)=nil, want error", test.descr)
+		}
+	}
+}
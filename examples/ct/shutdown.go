@@ -0,0 +1,250 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"golang.org/x/net/context"
+)
+
+const (
+	// GetFinalSTHPath is the path of the endpoint serving a shut down log's final tree
+	// head, relative to the log's prefix. It isn't part of RFC 6962.
+	GetFinalSTHPath = "/ct/v1/get-final-sth"
+	// finalTreeHeadContext prefixes the data signed by a shutdown attestation, so the
+	// signature can't be mistaken for one over an STH or SCT.
+	finalTreeHeadContext = "CT log shutdown attestation v1\x00"
+)
+
+// FinalTreeHead is the last tree head of a log that has been shut down, together with the
+// log's signed attestation that no entries will be added after it. It's what a retired
+// log serves from get-final-sth, and is kept in the file named by the log's
+// FinalTreeHeadFile config.
+type FinalTreeHead struct {
+	// STH is the final signed tree head, as served by get-sth.
+	STH ct.GetSTHResponse `json:"sth"`
+	// LogID is the SHA-256 hash of the log's public key.
+	LogID []byte `json:"log_id"`
+	// ShutdownTimestamp is when the log was shut down, in milliseconds since the epoch.
+	ShutdownTimestamp uint64 `json:"shutdown_timestamp"`
+	// AttestationSignature is a TLS encoded DigitallySigned over the output of
+	// FinalTreeHeadSignatureInput.
+	AttestationSignature []byte `json:"attestation_signature"`
+}
+
+// FinalTreeHeadSignatureInput returns the data signed by a shutdown attestation: a
+// context string followed by the log ID, the shutdown timestamp and the final tree size,
+// timestamp and root hash.
+func FinalTreeHeadSignatureInput(fth FinalTreeHead) ([]byte, error) {
+	if len(fth.LogID) != sha256.Size {
+		return nil, fmt.Errorf("invalid log ID length %d", len(fth.LogID))
+	}
+	if len(fth.STH.SHA256RootHash) != sha256.Size {
+		return nil, fmt.Errorf("invalid root hash length %d", len(fth.STH.SHA256RootHash))
+	}
+	var buf bytes.Buffer
+	buf.WriteString(finalTreeHeadContext)
+	buf.Write(fth.LogID)
+	binary.Write(&buf, binary.BigEndian, fth.ShutdownTimestamp)
+	binary.Write(&buf, binary.BigEndian, fth.STH.TreeSize)
+	binary.Write(&buf, binary.BigEndian, fth.STH.Timestamp)
+	buf.Write(fth.STH.SHA256RootHash)
+	return buf.Bytes(), nil
+}
+
+// createFinalTreeHead signs the latest tree head from the backend as the log's final one.
+// The log must not be accepting submissions, and the sequencer should have integrated
+// everything already queued, or later entries won't be covered.
+func createFinalTreeHead(ctx context.Context, c LogContext) (*FinalTreeHead, error) {
+	if !c.servesV1() {
+		return nil, errors.New("final tree heads can only be made for SHA-256 trees")
+	}
+	rsp, err := c.rpcClient.GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: c.logID})
+	if err != nil {
+		return nil, fmt.Errorf("backend GetLatestSignedLogRoot request failed: %v", err)
+	}
+	if !rpcStatusOK(rsp.GetStatus()) {
+		return nil, fmt.Errorf("backend GetLatestSignedLogRoot request failed, status=%v", rsp.GetStatus())
+	}
+	slr := rsp.GetSignedLogRoot()
+	if slr == nil {
+		return nil, fmt.Errorf("no log root returned")
+	}
+	sth, err := signTreeHeadForRoot(c.sthKeyManager, *slr)
+	if err != nil {
+		return nil, err
+	}
+	sthRsp, err := sthResponse(sth)
+	if err != nil {
+		return nil, err
+	}
+	logID, err := GetCTLogID(c.logKeyManager)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logID: %v", err)
+	}
+
+	fth := &FinalTreeHead{
+		STH:               sthRsp,
+		LogID:             logID[:],
+		ShutdownTimestamp: uint64(c.timeSource.Now().UnixNano() / millisPerNano),
+	}
+	input, err := FinalTreeHeadSignatureInput(*fth)
+	if err != nil {
+		return nil, err
+	}
+	signer, sigAlg, err := logSigner(c.logKeyManager)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.Sign(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign attestation: %v", err)
+	}
+	fth.AttestationSignature, err = tls.Marshal(ct.DigitallySigned{
+		Algorithm: sigAlg,
+		Signature: signature.Signature,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to tls.Marshal signature: %v", err)
+	}
+	return fth, nil
+}
+
+// loadFinalTreeHead reads a final tree head written by writeFinalTreeHead, and checks that
+// it belongs to the log whose key is held by km, and is signed by its tree head key sthKM.
+// It returns nil if the file doesn't exist.
+func loadFinalTreeHead(path string, km, sthKM crypto.KeyManager) (*FinalTreeHead, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var fth FinalTreeHead
+	if err := json.Unmarshal(data, &fth); err != nil {
+		return nil, fmt.Errorf("failed to parse final tree head: %v", err)
+	}
+
+	logID, err := GetCTLogID(km)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logID: %v", err)
+	}
+	if !bytes.Equal(fth.LogID, logID[:]) {
+		return nil, fmt.Errorf("final tree head is for log ID %x, not %x", fth.LogID, logID)
+	}
+	if len(fth.STH.SHA256RootHash) != sha256.Size {
+		return nil, fmt.Errorf("invalid root hash length %d", len(fth.STH.SHA256RootHash))
+	}
+	sth := ct.SignedTreeHead{
+		Version:   ct.V1,
+		TreeSize:  fth.STH.TreeSize,
+		Timestamp: fth.STH.Timestamp,
+	}
+	copy(sth.SHA256RootHash[:], fth.STH.SHA256RootHash)
+	if _, err := tls.Unmarshal(fth.STH.TreeHeadSignature, &sth.TreeHeadSignature); err != nil {
+		return nil, fmt.Errorf("failed to parse tree head signature: %v", err)
+	}
+	pubKey, err := sthKM.GetPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := newSTHVerifier(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifier.VerifySTHSignature(sth); err != nil {
+		return nil, fmt.Errorf("final tree head signature doesn't verify: %v", err)
+	}
+	return &fth, nil
+}
+
+// writeFinalTreeHead saves a final tree head to a file.
+func writeFinalTreeHead(path string, fth *FinalTreeHead) error {
+	data, err := json.MarshalIndent(fth, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// shutDown puts a log into its shut down state, using the final tree head saved at path
+// or creating one from the latest tree head if there isn't one yet. From then on the log
+// rejects submissions, and get-sth always returns the final tree head.
+func shutDown(ctx context.Context, c *LogContext, path string) error {
+	fth, err := loadFinalTreeHead(path, c.logKeyManager, c.sthKeyManager)
+	if err != nil {
+		return fmt.Errorf("failed to load final tree head: %v", err)
+	}
+	if fth == nil {
+		if fth, err = createFinalTreeHead(ctx, *c); err != nil {
+			return fmt.Errorf("failed to create final tree head: %v", err)
+		}
+		if err := writeFinalTreeHead(path, fth); err != nil {
+			return fmt.Errorf("failed to save final tree head: %v", err)
+		}
+		glog.Infof("%s: log shut down with final tree size %d, saved in %s", c.logPrefix, fth.STH.TreeSize, path)
+	}
+	c.final = fth
+	c.exp.lastSTHTimestamp.Set(int64(fth.STH.Timestamp))
+	c.exp.lastSTHTreeSize.Set(int64(fth.STH.TreeSize))
+	shutdownTimestamp := new(expvar.Int)
+	shutdownTimestamp.Set(int64(fth.ShutdownTimestamp))
+	c.exp.vars.Set("shutdown-timestamp", shutdownTimestamp)
+	return nil
+}
+
+// errLogShutDown is returned to submitters once the log has been shut down.
+func errLogShutDown(fth *FinalTreeHead) error {
+	return fmt.Errorf("log shut down at %v with final tree size %d, see %s", time.Unix(0, int64(fth.ShutdownTimestamp)*millisPerNano).UTC().Format(time.RFC3339), fth.STH.TreeSize, GetFinalSTHPath)
+}
+
+// writeFinalSTH serves the final tree head of a shut down log in place of the latest one.
+func writeFinalSTH(c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	etag := sthETag(c.final.STH.TreeSize, c.final.STH.Timestamp, c.final.STH.SHA256RootHash)
+	if checkNotModified(w, r, etag) {
+		return http.StatusNotModified, nil
+	}
+	if err := setLogKeyID(w, c.sthKeyManager); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return writeJSON(w, c.final.STH)
+}
+
+// getFinalSTH returns the final tree head and shutdown attestation of a log that has been
+// shut down.
+func getFinalSTH(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	if c.final == nil {
+		return http.StatusNotFound, fmt.Errorf("log has not been shut down")
+	}
+	return writeJSON(w, c.final)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) (int, error) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to marshal response: %v %v", v, err)
+	}
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	if _, err := w.Write(jsonData); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to write response data: %v", err)
+	}
+	return http.StatusOK, nil
+}
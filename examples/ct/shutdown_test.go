@@ -0,0 +1,183 @@
+package ct
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/examples/ct/testonly"
+	"github.com/google/trillian/mockclient"
+	"golang.org/x/net/context"
+)
+
+func loadTestKeyManager(t *testing.T) *crypto.PEMKeyManager {
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPrivateKey(testonly.CTLogPrivateKeyPEM, testonly.CTLogKeyPassword); err != nil {
+		t.Fatalf("Failed to load private key: %v", err)
+	}
+	if err := km.LoadPublicKey(testonly.CTLogPublicKeyPEM); err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	return km
+}
+
+func TestShutDown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shutdown")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "final.json")
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	client := mockclient.NewMockTrillianLogClient(mockCtrl)
+	km := loadTestKeyManager(t)
+	c := NewLogContext(0x42, "test", NewPEMCertPool(), client, km, time.Millisecond*500, fakeTimeSource)
+
+	// Only the first shutdown should need the backend, later ones use the saved file.
+	client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), &trillian.GetLatestSignedLogRootRequest{LogId: 0x42}).Return(
+		makeGetRootResponseForTest(12345000000, 25, []byte("abcdabcdabcdabcdabcdabcdabcdabcd")), nil)
+	if err := shutDown(context.Background(), c, path); err != nil {
+		t.Fatalf("shutDown()=%v, want no error", err)
+	}
+	if c.final == nil {
+		t.Fatal("shutDown() didn't set the final tree head")
+	}
+	if got, want := c.final.STH.TreeSize, uint64(25); got != want {
+		t.Errorf("final STH TreeSize=%d, want %d", got, want)
+	}
+	if got, want := c.final.STH.Timestamp, uint64(12345); got != want {
+		t.Errorf("final STH Timestamp=%d, want %d", got, want)
+	}
+	if got, want := c.final.ShutdownTimestamp, uint64(fakeTime.UnixNano()/millisPerNano); got != want {
+		t.Errorf("ShutdownTimestamp=%d, want %d", got, want)
+	}
+
+	// The attestation must verify with the log's public key.
+	input, err := FinalTreeHeadSignatureInput(*c.final)
+	if err != nil {
+		t.Fatalf("FinalTreeHeadSignatureInput()=%v, want no error", err)
+	}
+	var sig ct.DigitallySigned
+	if _, err := tls.Unmarshal(c.final.AttestationSignature, &sig); err != nil {
+		t.Fatalf("Failed to parse attestation signature: %v", err)
+	}
+	pubKey, err := km.GetPublicKey()
+	if err != nil {
+		t.Fatalf("Failed to get public key: %v", err)
+	}
+	digest := sha256.Sum256(input)
+	if !ecdsa.VerifyASN1(pubKey.(*ecdsa.PublicKey), digest[:], sig.Signature) {
+		t.Error("attestation signature doesn't verify")
+	}
+
+	restarted := NewLogContext(0x42, "test", NewPEMCertPool(), client, km, time.Millisecond*500, fakeTimeSource)
+	if err := shutDown(context.Background(), restarted, path); err != nil {
+		t.Fatalf("shutDown(restarted)=%v, want no error", err)
+	}
+	got, _ := json.Marshal(restarted.final)
+	want, _ := json.Marshal(c.final)
+	if string(got) != string(want) {
+		t.Errorf("shutDown(restarted) final tree head=%s, want %s", got, want)
+	}
+
+	// A different log's key mustn't accept the file.
+	otherKM := crypto.NewPEMKeyManager()
+	if err := otherKM.LoadPublicKey(ctTesttubePublicKey); err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	if fth, err := loadFinalTreeHead(path, otherKM, otherKM); err == nil {
+		t.Errorf("loadFinalTreeHead(other key)=%+v, want error", fth)
+	}
+}
+
+func TestShutDownLogHandlers(t *testing.T) {
+	info := setupTest(t, []string{testonly.FakeCACertPEM})
+	defer info.mockCtrl.Finish()
+	fth := &FinalTreeHead{
+		STH: ct.GetSTHResponse{
+			TreeSize:          25,
+			SHA256RootHash:    []byte("abcdabcdabcdabcdabcdabcdabcdabcd"),
+			Timestamp:         12345,
+			TreeHeadSignature: []byte("signature"),
+		},
+		LogID:                []byte("logidlogidlogidlogidlogidlogidlo"),
+		ShutdownTimestamp:    23456,
+		AttestationSignature: []byte("attestation"),
+	}
+
+	// Before the log is shut down there's no final tree head.
+	finalHandler := appHandler{context: info.c, handler: getFinalSTH, name: "GetFinalSTH", method: http.MethodGet}
+	req, err := http.NewRequest("GET", "http://example.com/ct/v1/get-final-sth", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	finalHandler.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusNotFound; got != want {
+		t.Errorf("GetFinalSTH()=%d, want %d", got, want)
+	}
+
+	// No backend calls are expected once it is.
+	info.c.final = fth
+	finalHandler = appHandler{context: info.c, handler: getFinalSTH, name: "GetFinalSTH", method: http.MethodGet}
+	w = httptest.NewRecorder()
+	finalHandler.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("GetFinalSTH()=%d (body:%v), want %d", got, w.Body, want)
+	}
+	var gotFinal FinalTreeHead
+	if err := json.Unmarshal(w.Body.Bytes(), &gotFinal); err != nil {
+		t.Fatalf("Failed to unmarshal json response: %s", w.Body.Bytes())
+	}
+	if got, want := gotFinal.ShutdownTimestamp, fth.ShutdownTimestamp; got != want {
+		t.Errorf("GetFinalSTH().ShutdownTimestamp=%d, want %d", got, want)
+	}
+	if got, want := string(gotFinal.AttestationSignature), string(fth.AttestationSignature); got != want {
+		t.Errorf("GetFinalSTH().AttestationSignature=%q, want %q", got, want)
+	}
+
+	sthHandler := appHandler{context: info.c, handler: getSTH, name: "GetSTH", method: http.MethodGet}
+	req, err = http.NewRequest("GET", "http://example.com/ct/v1/get-sth", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w = httptest.NewRecorder()
+	sthHandler.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("GetSTH()=%d (body:%v), want %d", got, w.Body, want)
+	}
+	var gotSTH ct.GetSTHResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &gotSTH); err != nil {
+		t.Fatalf("Failed to unmarshal json response: %s", w.Body.Bytes())
+	}
+	if got, want := gotSTH.TreeSize, fth.STH.TreeSize; got != want {
+		t.Errorf("GetSTH().TreeSize=%d, want %d", got, want)
+	}
+	if got, want := string(gotSTH.TreeHeadSignature), string(fth.STH.TreeHeadSignature); got != want {
+		t.Errorf("GetSTH().TreeHeadSignature=%q, want %q", got, want)
+	}
+
+	pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+	recorder := makeAddChainRequest(t, info.c, createJSONChain(t, *pool))
+	if got, want := recorder.Code, http.StatusForbidden; got != want {
+		t.Errorf("addChain()=%d (body:%v); want %d", got, recorder.Body, want)
+	}
+	if got, want := recorder.Body.String(), GetFinalSTHPath; !strings.Contains(got, want) {
+		t.Errorf("addChain() body=%q, want it to contain %q", got, want)
+	}
+}
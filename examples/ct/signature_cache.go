@@ -0,0 +1,171 @@
+package ct
+
+import (
+	"bytes"
+	"container/list"
+	gocrypto "crypto"
+	"expvar"
+	"io"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/crypto"
+)
+
+// signatureKey identifies a signature by what was signed: the digest of the signed data,
+// e.g. an STH's root hash, size and timestamp or an SCT's leaf and timestamp, and the
+// hash function that made it.
+type signatureKey struct {
+	hash   gocrypto.Hash
+	digest string
+}
+
+type cachedSignature struct {
+	key       signatureKey
+	signature []byte
+}
+
+// signatureCache is a crypto.KeyManager that remembers the most recent signatures made
+// with another's key, so that signing the same data again, e.g. the tree head for an
+// unchanged root or the SCT for a retried or duplicate submission, doesn't use the
+// signer, which may be slow or rate limited, e.g. an HSM. If the key manager's key
+// changes the cached signatures are thrown away.
+type signatureCache struct {
+	crypto.KeyManager
+	prefix  string
+	maxSize int
+
+	// mu guards the cache: rawKey is the public key the signatures in it were made with,
+	// and lru holds them, most recently used first, indexed by entries.
+	mu      sync.Mutex
+	rawKey  []byte
+	entries map[signatureKey]*list.Element
+	lru     *list.List
+
+	exp struct {
+		vars          *expvar.Map
+		hits          *expvar.Int
+		misses        *expvar.Int
+		evictions     *expvar.Int
+		invalidations *expvar.Int
+	}
+}
+
+// newSignatureCache wraps km with a cache of up to maxSize signatures. prefix identifies
+// the cache in diagnostics.
+func newSignatureCache(prefix string, km crypto.KeyManager, maxSize int) *signatureCache {
+	sc := &signatureCache{
+		KeyManager: km,
+		prefix:     prefix,
+		maxSize:    maxSize,
+		entries:    make(map[signatureKey]*list.Element),
+		lru:        list.New(),
+	}
+	sc.exp.vars = new(expvar.Map).Init()
+	sc.exp.hits = new(expvar.Int)
+	sc.exp.vars.Set("hits", sc.exp.hits)
+	sc.exp.misses = new(expvar.Int)
+	sc.exp.vars.Set("misses", sc.exp.misses)
+	sc.exp.evictions = new(expvar.Int)
+	sc.exp.vars.Set("evictions", sc.exp.evictions)
+	sc.exp.invalidations = new(expvar.Int)
+	sc.exp.vars.Set("invalidations", sc.exp.invalidations)
+	sc.exp.vars.Set("size", expvar.Func(func() interface{} {
+		sc.mu.Lock()
+		defer sc.mu.Unlock()
+		return sc.lru.Len()
+	}))
+	sc.exp.vars.Set("hit-rate", expvar.Func(func() interface{} {
+		hits, misses := sc.exp.hits.Value(), sc.exp.misses.Value()
+		if hits+misses == 0 {
+			return 0.0
+		}
+		return float64(hits) / float64(hits+misses)
+	}))
+	return sc
+}
+
+// Vars returns the statistics exported by this signatureCache: its hits and misses, and
+// the signatures evicted to keep it under its size, or invalidated by a change of key.
+func (sc *signatureCache) Vars() *expvar.Map {
+	return sc.exp.vars
+}
+
+// Signer returns a crypto.Signer that signs with the key manager's signer, unless the
+// signature is in the cache.
+func (sc *signatureCache) Signer() (gocrypto.Signer, error) {
+	signer, err := sc.KeyManager.Signer()
+	if err != nil {
+		return nil, err
+	}
+	rawKey, err := sc.KeyManager.GetRawPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if !bytes.Equal(rawKey, sc.rawKey) {
+		if sc.rawKey != nil {
+			glog.Infof("%s: signing key changed, dropping %d cached signatures", sc.prefix, sc.lru.Len())
+			sc.exp.invalidations.Add(int64(sc.lru.Len()))
+		}
+		sc.rawKey = rawKey
+		sc.entries = make(map[signatureKey]*list.Element)
+		sc.lru.Init()
+	}
+	return cachingSigner{Signer: signer, cache: sc, rawKey: rawKey}, nil
+}
+
+// get returns the cached signature for key, if it was made with rawKey.
+func (sc *signatureCache) get(key signatureKey, rawKey []byte) ([]byte, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if e, ok := sc.entries[key]; ok && bytes.Equal(rawKey, sc.rawKey) {
+		sc.lru.MoveToFront(e)
+		sc.exp.hits.Add(1)
+		return e.Value.(*cachedSignature).signature, true
+	}
+	sc.exp.misses.Add(1)
+	return nil, false
+}
+
+// put adds a signature made with rawKey to the cache, unless the key has changed since.
+func (sc *signatureCache) put(key signatureKey, signature []byte, rawKey []byte) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if !bytes.Equal(rawKey, sc.rawKey) {
+		return
+	}
+	if e, ok := sc.entries[key]; ok {
+		sc.lru.MoveToFront(e)
+		return
+	}
+	sc.entries[key] = sc.lru.PushFront(&cachedSignature{key: key, signature: signature})
+	for sc.lru.Len() > sc.maxSize {
+		oldest := sc.lru.Back()
+		sc.lru.Remove(oldest)
+		delete(sc.entries, oldest.Value.(*cachedSignature).key)
+		sc.exp.evictions.Add(1)
+	}
+}
+
+// cachingSigner is the crypto.Signer returned by signatureCache.Signer.
+type cachingSigner struct {
+	gocrypto.Signer
+	cache  *signatureCache
+	rawKey []byte
+}
+
+func (s cachingSigner) Sign(rand io.Reader, digest []byte, opts gocrypto.SignerOpts) ([]byte, error) {
+	key := signatureKey{hash: opts.HashFunc(), digest: string(digest)}
+	if signature, ok := s.cache.get(key, s.rawKey); ok {
+		return signature, nil
+	}
+	signature, err := s.Signer.Sign(rand, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(key, signature, s.rawKey)
+	return signature, nil
+}
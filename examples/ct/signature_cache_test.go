@@ -0,0 +1,170 @@
+package ct
+
+import (
+	gocrypto "crypto"
+	"io"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+)
+
+// countingKeyManager counts the signatures made with the key of the KeyManager it
+// wraps, which can be swapped to simulate a key rotation.
+type countingKeyManager struct {
+	crypto.KeyManager
+	signatures int
+}
+
+func (km *countingKeyManager) Signer() (gocrypto.Signer, error) {
+	signer, err := km.KeyManager.Signer()
+	if err != nil {
+		return nil, err
+	}
+	return countingSigner{signer, km}, nil
+}
+
+type countingSigner struct {
+	gocrypto.Signer
+	km *countingKeyManager
+}
+
+func (s countingSigner) Sign(rand io.Reader, digest []byte, opts gocrypto.SignerOpts) ([]byte, error) {
+	s.km.signatures++
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func TestSignatureCache(t *testing.T) {
+	km := &countingKeyManager{KeyManager: loadTestKeyManager(t)}
+	sc := newSignatureCache("test", km, 2)
+	roots := make([]trillian.SignedLogRoot, 3)
+	for i := range roots {
+		roots[i] = trillian.SignedLogRoot{TreeSize: int64(i), TimestampNanos: 12345000000, RootHash: make([]byte, 32)}
+		roots[i].RootHash[0] = byte(i)
+	}
+
+	var tests = []struct {
+		descr          string
+		root           int
+		wantSignatures int // made with the key so far
+		wantHit        bool
+	}{
+		{descr: "first", root: 0, wantSignatures: 1},
+		{descr: "same-root", root: 0, wantSignatures: 1, wantHit: true},
+		{descr: "new-root", root: 1, wantSignatures: 2},
+		{descr: "evicts-first", root: 2, wantSignatures: 3},
+		{descr: "recent", root: 1, wantSignatures: 3, wantHit: true},
+		{descr: "evicted", root: 0, wantSignatures: 4},
+	}
+
+	pubKey, err := km.GetPublicKey()
+	if err != nil {
+		t.Fatalf("GetPublicKey()=_,%v, want no error", err)
+	}
+	verifier, err := ct.NewSignatureVerifier(pubKey)
+	if err != nil {
+		t.Fatalf("NewSignatureVerifier()=_,%v, want no error", err)
+	}
+	signatures := make(map[int]ct.DigitallySigned)
+	for _, test := range tests {
+		sth, err := signTreeHeadForRoot(sc, roots[test.root])
+		if err != nil {
+			t.Fatalf("%s: signTreeHeadForRoot()=_,%v, want no error", test.descr, err)
+		}
+		if err := verifier.VerifySTHSignature(sth); err != nil {
+			t.Errorf("%s: VerifySTHSignature()=%v, want no error", test.descr, err)
+		}
+		if got, want := km.signatures, test.wantSignatures; got != want {
+			t.Errorf("%s: %d signatures made, want %d", test.descr, got, want)
+		}
+		// ECDSA signatures differ each time, so a cache hit gives the same one as before.
+		if prev, ok := signatures[test.root]; ok {
+			if got := string(sth.TreeHeadSignature.Signature) == string(prev.Signature); got != test.wantHit {
+				t.Errorf("%s: got same signature as before: %v, want %v", test.descr, got, test.wantHit)
+			}
+		}
+		signatures[test.root] = sth.TreeHeadSignature
+	}
+
+	for _, want := range []struct {
+		name, value string
+	}{
+		{"hits", "2"},
+		{"misses", "4"},
+		{"evictions", "2"},
+		{"size", "2"},
+		{"hit-rate", "0.3333333333333333"},
+	} {
+		if got := sc.Vars().Get(want.name).String(); got != want.value {
+			t.Errorf("%s=%s, want %s", want.name, got, want.value)
+		}
+	}
+}
+
+func TestSignatureCacheSCTs(t *testing.T) {
+	km := &countingKeyManager{KeyManager: loadTestKeyManager(t)}
+	sc := newSignatureCache("test", km, 10)
+
+	cert, _ := createTestCert(t, "leaf.example.com", false, "", nil, nil)
+	other, _ := createTestCert(t, "other.example.com", false, "", nil, nil)
+
+	// A retried submission is signed with a new timestamp, but a duplicate one gets an
+	// SCT signed again with the original timestamp.
+	for _, test := range []struct {
+		descr          string
+		cert           *x509.Certificate
+		timestamp      time.Time
+		wantSignatures int
+	}{
+		{descr: "first", cert: cert, timestamp: fakeTime, wantSignatures: 1},
+		{descr: "retry", cert: cert, timestamp: fakeTime.Add(time.Second), wantSignatures: 2},
+		{descr: "duplicate", cert: cert, timestamp: fakeTime, wantSignatures: 2},
+		{descr: "other-cert", cert: other, timestamp: fakeTime, wantSignatures: 3},
+	} {
+		_, sct, err := signV1SCTForCertificate(sc, test.cert, nil, test.timestamp)
+		if err != nil {
+			t.Fatalf("%s: signV1SCTForCertificate()=_,_,%v, want no error", test.descr, err)
+		}
+		if len(sct.Signature.Signature) == 0 {
+			t.Errorf("%s: signV1SCTForCertificate() SCT has no signature", test.descr)
+		}
+		if got, want := km.signatures, test.wantSignatures; got != want {
+			t.Errorf("%s: %d signatures made, want %d", test.descr, got, want)
+		}
+	}
+}
+
+func TestSignatureCacheKeyRotation(t *testing.T) {
+	km := &countingKeyManager{KeyManager: loadTestKeyManager(t)}
+	sc := newSignatureCache("test", km, 10)
+	root := trillian.SignedLogRoot{TreeSize: 25, TimestampNanos: 12345000000, RootHash: make([]byte, 32)}
+
+	if _, err := signTreeHeadForRoot(sc, root); err != nil {
+		t.Fatalf("signTreeHeadForRoot()=_,%v, want no error", err)
+	}
+	km.KeyManager = loadTestSTHKeyManager(t)
+	sth, err := signTreeHeadForRoot(sc, root)
+	if err != nil {
+		t.Fatalf("signTreeHeadForRoot()=_,%v, want no error", err)
+	}
+	if got, want := km.signatures, 2; got != want {
+		t.Errorf("%d signatures made, want %d", got, want)
+	}
+	pubKey, err := km.GetPublicKey()
+	if err != nil {
+		t.Fatalf("GetPublicKey()=_,%v, want no error", err)
+	}
+	verifier, err := ct.NewSignatureVerifier(pubKey)
+	if err != nil {
+		t.Fatalf("NewSignatureVerifier()=_,%v, want no error", err)
+	}
+	if err := verifier.VerifySTHSignature(sth); err != nil {
+		t.Errorf("VerifySTHSignature(new key)=%v, want no error", err)
+	}
+	if got, want := sc.Vars().Get("invalidations").String(), "1"; got != want {
+		t.Errorf("invalidations=%s, want %s", got, want)
+	}
+}
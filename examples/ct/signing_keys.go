@@ -0,0 +1,129 @@
+package ct
+
+import (
+	gocrypto "crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian/crypto"
+	"golang.org/x/crypto/ed25519"
+)
+
+// LogKeyIDHeader is the HTTP header of responses carrying an SCT or tree head signed by
+// the log, giving the base64 encoded SHA-256 hash of the public key that signed it. A log
+// can sign its tree heads with a different key from its SCTs.
+const LogKeyIDHeader = "X-CT-Log-Key-Id"
+
+// keyManagerFor returns the key manager named name in named, or if name is empty one
+// holding the key in the PEM files privFile and pubFile.
+func keyManagerFor(name, privFile, pubFile, password string, named map[string]crypto.KeyManager) (crypto.KeyManager, error) {
+	if len(name) > 0 {
+		if len(privFile) > 0 || len(pubFile) > 0 {
+			return nil, fmt.Errorf("key manager %s can't be combined with key files", name)
+		}
+		km, ok := named[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown key manager %s", name)
+		}
+		return km, nil
+	}
+	if len(privFile) == 0 || len(pubFile) == 0 {
+		return nil, errors.New("need both private and public key files")
+	}
+	return loadPEMKeyManager(privFile, pubFile, password)
+}
+
+// loadPEMKeyManager creates a key manager for the password protected private key in the
+// PEM file privFile, and its public key in pubFile.
+func loadPEMKeyManager(privFile, pubFile, password string) (crypto.KeyManager, error) {
+	km := crypto.NewPEMKeyManager()
+	privData, err := ioutil.ReadFile(privFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key file: %v", err)
+	}
+	if err := km.LoadPrivateKey(string(privData), password); err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+
+	pubData, err := ioutil.ReadFile(pubFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load public key file: %v", err)
+	}
+	if err := km.LoadPublicKey(string(pubData)); err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	return km, nil
+}
+
+// logKeyID returns the ID of the key held by km as it appears in LogKeyIDHeader.
+func logKeyID(km crypto.KeyManager) (string, error) {
+	id, err := GetCTLogID(km)
+	if err != nil {
+		return "", fmt.Errorf("failed to get key ID: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(id[:]), nil
+}
+
+// setLogKeyID sets LogKeyIDHeader on a response carrying a signature made with km's key.
+func setLogKeyID(w http.ResponseWriter, km crypto.KeyManager) error {
+	id, err := logKeyID(km)
+	if err != nil {
+		return err
+	}
+	w.Header().Set(LogKeyIDHeader, id)
+	return nil
+}
+
+// sthVerifier checks the signatures of tree heads signed by a log.
+type sthVerifier interface {
+	VerifySTHSignature(sth ct.SignedTreeHead) error
+}
+
+// newSTHVerifier returns an sthVerifier for tree heads signed with the private key for
+// pub. The ct package checks ECDSA and RSA signatures, but not Ed25519 ones.
+func newSTHVerifier(pub gocrypto.PublicKey) (sthVerifier, error) {
+	if key, ok := pub.(ed25519.PublicKey); ok {
+		return ed25519Verifier(key), nil
+	}
+	verifier, err := ct.NewSignatureVerifier(pub)
+	if err != nil {
+		return nil, err
+	}
+	return verifier, nil
+}
+
+// ed25519Verifier checks signatures made with an Ed25519 key.
+type ed25519Verifier ed25519.PublicKey
+
+// VerifySTHSignature checks the signature of sth.
+func (v ed25519Verifier) VerifySTHSignature(sth ct.SignedTreeHead) error {
+	data, err := ct.SerializeSTHSignatureInput(sth)
+	if err != nil {
+		return err
+	}
+	return v.verifySignature(data, sth.TreeHeadSignature)
+}
+
+// VerifySCTSignature checks the signature of sct, issued for entry.
+func (v ed25519Verifier) VerifySCTSignature(sct ct.SignedCertificateTimestamp, entry ct.LogEntry) error {
+	data, err := ct.SerializeSCTSignatureInput(sct, entry)
+	if err != nil {
+		return err
+	}
+	return v.verifySignature(data, sct.Signature)
+}
+
+func (v ed25519Verifier) verifySignature(data []byte, sig ct.DigitallySigned) error {
+	if got, want := sig.Algorithm, (tls.SignatureAndHashAlgorithm{Hash: tlsIntrinsic, Signature: tlsEd25519}); got != want {
+		return fmt.Errorf("signature has algorithm %v, want %v", got, want)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(v), data, sig.Signature) {
+		return errors.New("signature doesn't verify")
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package ct
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/examples/ct/testonly"
+	"github.com/google/trillian/mockclient"
+	trilliantestonly "github.com/google/trillian/testonly"
+)
+
+func loadTestSTHKeyManager(t *testing.T) *crypto.PEMKeyManager {
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPrivateKey(trilliantestonly.DemoPrivateKey, trilliantestonly.DemoPrivateKeyPass); err != nil {
+		t.Fatalf("Failed to load private key: %v", err)
+	}
+	if err := km.LoadPublicKey(trilliantestonly.DemoPublicKey); err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	return km
+}
+
+func TestKeyManagerFor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signing_keys")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	privFile := filepath.Join(dir, "priv.pem")
+	pubFile := filepath.Join(dir, "pub.pem")
+	if err := ioutil.WriteFile(privFile, []byte(testonly.CTLogPrivateKeyPEM), 0600); err != nil {
+		t.Fatalf("Failed to write private key: %v", err)
+	}
+	if err := ioutil.WriteFile(pubFile, []byte(testonly.CTLogPublicKeyPEM), 0600); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	hsm := loadTestSTHKeyManager(t)
+	named := map[string]crypto.KeyManager{"hsm": hsm}
+
+	var tests = []struct {
+		descr             string
+		name              string
+		priv, pub, passwd string
+		want              crypto.KeyManager // nil to check the key loaded from the files
+		errStr            string
+	}{
+		{descr: "named", name: "hsm", want: hsm},
+		{descr: "files", priv: privFile, pub: pubFile, passwd: testonly.CTLogKeyPassword},
+		{descr: "unknown", name: "tpm", errStr: "unknown key manager"},
+		{descr: "named-and-files", name: "hsm", priv: privFile, pub: pubFile, errStr: "can't be combined"},
+		{descr: "no-pub", priv: privFile, passwd: testonly.CTLogKeyPassword, errStr: "need both"},
+		{descr: "missing", priv: filepath.Join(dir, "missing.pem"), pub: pubFile, errStr: "failed to load private key"},
+		{descr: "wrong-password", priv: privFile, pub: pubFile, passwd: "towel", errStr: "failed to parse private key"},
+	}
+
+	for _, test := range tests {
+		km, err := keyManagerFor(test.name, test.priv, test.pub, test.passwd, named)
+		if len(test.errStr) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.errStr) {
+				t.Errorf("%s: keyManagerFor()=_,%v, want error containing %q", test.descr, err, test.errStr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: keyManagerFor()=_,%v, want no error", test.descr, err)
+			continue
+		}
+		if test.want != nil {
+			if km != test.want {
+				t.Errorf("%s: keyManagerFor()=%v, want %v", test.descr, km, test.want)
+			}
+			continue
+		}
+		got, err := logKeyID(km)
+		if err != nil {
+			t.Errorf("%s: logKeyID()=_,%v, want no error", test.descr, err)
+			continue
+		}
+		if want, _ := logKeyID(loadTestKeyManager(t)); got != want {
+			t.Errorf("%s: loaded key ID %s, want %s", test.descr, got, want)
+		}
+	}
+}
+
+func TestSeparateSTHKey(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	client := mockclient.NewMockTrillianLogClient(mockCtrl)
+	sctKM := loadTestKeyManager(t)
+	sthKM := loadTestSTHKeyManager(t)
+	c := NewLogContext(0x42, "test", NewPEMCertPool(), client, sctKM, time.Millisecond*500, fakeTimeSource)
+	c.sthKeyManager = sthKM
+	sctKeyID, err := logKeyID(sctKM)
+	if err != nil {
+		t.Fatalf("logKeyID(SCT key)=_,%v, want no error", err)
+	}
+	sthKeyID, err := logKeyID(sthKM)
+	if err != nil {
+		t.Fatalf("logKeyID(STH key)=_,%v, want no error", err)
+	}
+	if sctKeyID == sthKeyID {
+		t.Fatalf("SCT and STH keys both have ID %s", sctKeyID)
+	}
+
+	// Tree heads are signed with the STH key, and say so.
+	client.EXPECT().GetLatestSignedLogRoot(gomock.Any(), &trillian.GetLatestSignedLogRootRequest{LogId: 0x42}).Return(
+		makeGetRootResponseForTest(12345000000, 25, []byte("abcdabcdabcdabcdabcdabcdabcdabcd")), nil)
+	handler := appHandler{context: *c, handler: getSTH, name: "GetSTH", method: http.MethodGet}
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/ct/v1/get-sth", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("GetSTH()=%d (body:%v), want %d", got, w.Body, want)
+	}
+	if got, want := w.Header().Get(LogKeyIDHeader), sthKeyID; got != want {
+		t.Errorf("GetSTH() %s=%s, want %s", LogKeyIDHeader, got, want)
+	}
+	var rsp ct.GetSTHResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+		t.Fatalf("Failed to unmarshal json response: %s", w.Body.Bytes())
+	}
+	sth := ct.SignedTreeHead{Version: ct.V1, TreeSize: rsp.TreeSize, Timestamp: rsp.Timestamp}
+	copy(sth.SHA256RootHash[:], rsp.SHA256RootHash)
+	if _, err := tls.Unmarshal(rsp.TreeHeadSignature, &sth.TreeHeadSignature); err != nil {
+		t.Fatalf("Failed to parse tree head signature: %v", err)
+	}
+	for _, test := range []struct {
+		descr    string
+		km       crypto.KeyManager
+		verifies bool
+	}{
+		{descr: "STH key", km: sthKM, verifies: true},
+		{descr: "SCT key", km: sctKM, verifies: false},
+	} {
+		pubKey, err := test.km.GetPublicKey()
+		if err != nil {
+			t.Fatalf("GetPublicKey()=_,%v, want no error", err)
+		}
+		verifier, err := ct.NewSignatureVerifier(pubKey)
+		if err != nil {
+			t.Fatalf("NewSignatureVerifier()=_,%v, want no error", err)
+		}
+		if err := verifier.VerifySTHSignature(sth); (err == nil) != test.verifies {
+			t.Errorf("VerifySTHSignature(%s)=%v, want verified: %v", test.descr, err, test.verifies)
+		}
+	}
+
+	// SCTs are signed with the log's own key, whose hash is still the log ID.
+	sct, err := signSCT(c.logKeyManager, fakeTime, []byte("data"))
+	if err != nil {
+		t.Fatalf("signSCT()=_,%v, want no error", err)
+	}
+	w = httptest.NewRecorder()
+	if err := marshalAndWriteAddChainResponse(sct, c.logKeyManager, w); err != nil {
+		t.Fatalf("marshalAndWriteAddChainResponse()=%v, want no error", err)
+	}
+	if got, want := w.Header().Get(LogKeyIDHeader), sctKeyID; got != want {
+		t.Errorf("add-chain %s=%s, want %s", LogKeyIDHeader, got, want)
+	}
+	var addRsp ct.AddChainResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &addRsp); err != nil {
+		t.Fatalf("Failed to unmarshal json response: %s", w.Body.Bytes())
+	}
+	logID, err := GetCTLogID(sctKM)
+	if err != nil {
+		t.Fatalf("GetCTLogID()=_,%v, want no error", err)
+	}
+	if got, want := addRsp.ID, logID[:]; string(got) != string(want) {
+		t.Errorf("add-chain ID=%x, want %x", got, want)
+	}
+}
@@ -0,0 +1,348 @@
+package ct
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/util"
+)
+
+const (
+	// Default window that SLOs are measured over
+	defaultSLOWindow = 5 * time.Minute
+	// Default number of requests needed in the window before an SLO can be breached
+	defaultSLOMinRequests = 10
+	// Number of buckets each SLO window is split into; the window slides a bucket at a time
+	sloBuckets = 10
+	// Deadline for delivering an alert to the webhook
+	sloWebhookTimeout = 10 * time.Second
+)
+
+// SLOConfig is an objective for the error rate and latency of one of a log's endpoints.
+// An SLO is breached when, over the last Window, more than MaxErrorRate of the
+// endpoint's responses were server errors (5xx statuses), or more than MaxSlowRate of
+// them took longer than LatencyThreshold. Rates are fractions between 0 and 1.
+type SLOConfig struct {
+	// Entrypoint is the endpoint's name in Entrypoints, V2Entrypoints or
+	// GossipEntrypoints.
+	Entrypoint string
+	// Window is a duration string, default 5m.
+	Window string
+	// MinRequests is the number of requests needed in the window for the SLO to be
+	// breached, so a few failures on a quiet endpoint don't raise an alert. Zero means
+	// a default of 10.
+	MinRequests int
+	// MaxErrorRate of zero means the error rate isn't checked.
+	MaxErrorRate float64
+	// LatencyThreshold is a duration string; if empty latency isn't checked.
+	LatencyThreshold string
+	MaxSlowRate      float64
+}
+
+// SLOAlert is the JSON body posted to a log's SLO webhook when an SLO is breached, and
+// again when it recovers.
+type SLOAlert struct {
+	Log        string    `json:"log"`
+	Entrypoint string    `json:"entrypoint"`
+	Breached   bool      `json:"breached"`
+	Requests   int64     `json:"requests"`
+	ErrorRate  float64   `json:"error_rate"`
+	SlowRate   float64   `json:"slow_rate"`
+	Window     string    `json:"window"`
+	Time       time.Time `json:"time"`
+}
+
+// slo is the state of an SLO. It's guarded by the sloMonitor's mutex.
+type slo struct {
+	entrypoint   string
+	window       time.Duration
+	minRequests  int64
+	maxErrorRate float64
+	latency      time.Duration
+	maxSlowRate  float64
+
+	buckets  [sloBuckets]sloBucket
+	breached bool
+
+	vars      *expvar.Map
+	breachVar *expvar.Int
+	requests  *expvar.Int
+	errorRate *expvar.Float
+	slowRate  *expvar.Float
+}
+
+// sloBucket counts the responses in one slice of an SLO's window.
+type sloBucket struct {
+	start    time.Time
+	requests int64
+	errors   int64
+	slow     int64
+}
+
+// parseSLOs checks the SLOs in a log's config.
+func parseSLOs(cfgs []SLOConfig) ([]*slo, error) {
+	valid := make(map[string]bool)
+	for _, ep := range append(append(Entrypoints, V2Entrypoints...), GossipEntrypoints...) {
+		valid[ep] = true
+	}
+	var slos []*slo
+	for _, cfg := range cfgs {
+		if !valid[cfg.Entrypoint] {
+			return nil, fmt.Errorf("unknown entrypoint in SLOs: %s", cfg.Entrypoint)
+		}
+		s := &slo{entrypoint: cfg.Entrypoint, window: defaultSLOWindow, minRequests: defaultSLOMinRequests, maxErrorRate: cfg.MaxErrorRate, maxSlowRate: cfg.MaxSlowRate}
+		if len(cfg.Window) > 0 {
+			d, err := time.ParseDuration(cfg.Window)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SLO Window for %s: %v", cfg.Entrypoint, err)
+			}
+			if d < time.Second {
+				return nil, fmt.Errorf("SLO Window for %s must be at least 1s, got %v", cfg.Entrypoint, d)
+			}
+			s.window = d
+		}
+		if cfg.MinRequests < 0 {
+			return nil, fmt.Errorf("SLO MinRequests for %s must not be negative", cfg.Entrypoint)
+		} else if cfg.MinRequests > 0 {
+			s.minRequests = int64(cfg.MinRequests)
+		}
+		if cfg.MaxErrorRate < 0 || cfg.MaxErrorRate > 1 || cfg.MaxSlowRate < 0 || cfg.MaxSlowRate > 1 {
+			return nil, fmt.Errorf("SLO rates for %s must be between 0 and 1", cfg.Entrypoint)
+		}
+		if len(cfg.LatencyThreshold) > 0 {
+			d, err := time.ParseDuration(cfg.LatencyThreshold)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SLO LatencyThreshold for %s: %v", cfg.Entrypoint, err)
+			}
+			if d <= 0 {
+				return nil, fmt.Errorf("SLO LatencyThreshold for %s must be positive, got %v", cfg.Entrypoint, d)
+			}
+			s.latency = d
+		}
+		if s.maxErrorRate == 0 && s.latency == 0 {
+			return nil, fmt.Errorf("SLO for %s needs MaxErrorRate or LatencyThreshold", cfg.Entrypoint)
+		}
+		slos = append(slos, s)
+	}
+	return slos, nil
+}
+
+// observe counts a response in the SLO's current bucket.
+func (s *slo) observe(now time.Time, status int, latency time.Duration) {
+	width := s.window / sloBuckets
+	b := &s.buckets[(now.UnixNano()/int64(width))%sloBuckets]
+	if start := now.Truncate(width); !b.start.Equal(start) {
+		*b = sloBucket{start: start}
+	}
+	b.requests++
+	if status >= 500 {
+		b.errors++
+	}
+	if s.latency > 0 && latency > s.latency {
+		b.slow++
+	}
+}
+
+// counts returns the number of responses in the window before now, and how many of them
+// were errors or slow.
+func (s *slo) counts(now time.Time) (requests, errors, slow int64) {
+	for _, b := range s.buckets {
+		if now.Sub(b.start) < s.window {
+			requests += b.requests
+			errors += b.errors
+			slow += b.slow
+		}
+	}
+	return requests, errors, slow
+}
+
+// sloMonitor measures a log's endpoints against their SLOs. The breached flag of each
+// SLO is exported, along with the number of SLOs currently breached, for monitoring to
+// alert on. Logs without external monitoring can also have alerts posted to a webhook.
+type sloMonitor struct {
+	logPrefix    string
+	timeSource   util.TimeSource
+	webhook      string
+	client       *http.Client
+	byEntrypoint map[string][]*slo
+	slos         []*slo
+	interval     time.Duration
+	done         chan struct{}
+
+	mu sync.Mutex
+
+	exp struct {
+		vars            *expvar.Map
+		breached        *expvar.Int
+		webhookFailures *expvar.Int
+		objectives      *expvar.Map
+	}
+}
+
+// newSLOMonitor creates an sloMonitor for the SLOs of the log with prefix logPrefix. If
+// webhook isn't empty alerts are posted to it.
+func newSLOMonitor(logPrefix string, slos []*slo, webhook string, timeSource util.TimeSource) *sloMonitor {
+	m := &sloMonitor{
+		logPrefix:    logPrefix,
+		timeSource:   timeSource,
+		webhook:      webhook,
+		client:       &http.Client{Timeout: sloWebhookTimeout},
+		byEntrypoint: make(map[string][]*slo),
+		slos:         slos,
+		done:         make(chan struct{}),
+	}
+	m.exp.vars = new(expvar.Map).Init()
+	m.exp.breached = new(expvar.Int)
+	m.exp.vars.Set("breached", m.exp.breached)
+	m.exp.webhookFailures = new(expvar.Int)
+	m.exp.vars.Set("webhook-failures", m.exp.webhookFailures)
+	m.exp.objectives = new(expvar.Map).Init()
+	m.exp.vars.Set("objectives", m.exp.objectives)
+
+	// SLOs are checked as often as the shortest window slides.
+	for i, s := range slos {
+		m.byEntrypoint[s.entrypoint] = append(m.byEntrypoint[s.entrypoint], s)
+		if width := s.window / sloBuckets; m.interval == 0 || width < m.interval {
+			m.interval = width
+		}
+		s.vars = new(expvar.Map).Init()
+		s.breachVar = new(expvar.Int)
+		s.vars.Set("breached", s.breachVar)
+		s.requests = new(expvar.Int)
+		s.vars.Set("requests", s.requests)
+		s.errorRate = new(expvar.Float)
+		s.vars.Set("error-rate", s.errorRate)
+		s.slowRate = new(expvar.Float)
+		s.vars.Set("slow-rate", s.slowRate)
+		m.exp.objectives.Set(fmt.Sprintf("%s-%d", s.entrypoint, i), s.vars)
+	}
+	return m
+}
+
+// Vars returns the statistics exported by this sloMonitor.
+func (m *sloMonitor) Vars() *expvar.Map {
+	return m.exp.vars
+}
+
+// observe counts a response from an endpoint against its SLOs.
+func (m *sloMonitor) observe(entrypoint string, status int, latency time.Duration) {
+	slos := m.byEntrypoint[entrypoint]
+	if len(slos) == 0 {
+		return
+	}
+	now := m.timeSource.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range slos {
+		s.observe(now, status, latency)
+	}
+}
+
+// Start starts a goroutine that checks the SLOs periodically until Stop is called.
+func (m *sloMonitor) Start() {
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+				for _, alert := range m.evaluate() {
+					m.alert(alert)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops checking the SLOs.
+func (m *sloMonitor) Stop() {
+	close(m.done)
+}
+
+// evaluate updates the exported state of each SLO, and returns alerts for those that
+// have been breached or have recovered since the last evaluation.
+func (m *sloMonitor) evaluate() []SLOAlert {
+	now := m.timeSource.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var alerts []SLOAlert
+	for _, s := range m.slos {
+		requests, errors, slow := s.counts(now)
+		var errorRate, slowRate float64
+		if requests > 0 {
+			errorRate = float64(errors) / float64(requests)
+			slowRate = float64(slow) / float64(requests)
+		}
+		s.requests.Set(requests)
+		s.errorRate.Set(errorRate)
+		s.slowRate.Set(slowRate)
+
+		breached := requests >= s.minRequests && ((s.maxErrorRate > 0 && errorRate > s.maxErrorRate) || (s.latency > 0 && slowRate > s.maxSlowRate))
+		if breached == s.breached {
+			continue
+		}
+		s.breached = breached
+		if breached {
+			s.breachVar.Set(1)
+			m.exp.breached.Add(1)
+		} else {
+			s.breachVar.Set(0)
+			m.exp.breached.Add(-1)
+		}
+		alerts = append(alerts, SLOAlert{
+			Log:        m.logPrefix,
+			Entrypoint: s.entrypoint,
+			Breached:   breached,
+			Requests:   requests,
+			ErrorRate:  errorRate,
+			SlowRate:   slowRate,
+			Window:     s.window.String(),
+			Time:       now,
+		})
+	}
+	return alerts
+}
+
+// alert logs an SLO alert and posts it to the webhook, if there is one.
+func (m *sloMonitor) alert(alert SLOAlert) {
+	if alert.Breached {
+		glog.Errorf("%s: SLO for %s breached: %d requests in %s, error rate %.3f, slow rate %.3f", m.logPrefix, alert.Entrypoint, alert.Requests, alert.Window, alert.ErrorRate, alert.SlowRate)
+	} else {
+		glog.Infof("%s: SLO for %s recovered", m.logPrefix, alert.Entrypoint)
+	}
+	if len(m.webhook) == 0 {
+		return
+	}
+	if err := m.postAlert(alert); err != nil {
+		m.exp.webhookFailures.Add(1)
+		glog.Warningf("%s: failed to post SLO alert to webhook: %v", m.logPrefix, err)
+	}
+}
+
+func (m *sloMonitor) postAlert(alert SLOAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	rsp, err := m.client.Post(m.webhook, contentTypeJSON, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode/100 != 2 {
+		return errors.New(rsp.Status)
+	}
+	return nil
+}
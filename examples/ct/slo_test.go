@@ -0,0 +1,183 @@
+package ct
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+func TestParseSLOs(t *testing.T) {
+	var tests = []struct {
+		descr   string
+		cfg     SLOConfig
+		wantErr bool
+	}{
+		{descr: "error rate", cfg: SLOConfig{Entrypoint: "AddChain", MaxErrorRate: 0.01}},
+		{descr: "latency", cfg: SLOConfig{Entrypoint: "GetEntries", LatencyThreshold: "500ms", MaxSlowRate: 0.05}},
+		{descr: "v2", cfg: SLOConfig{Entrypoint: "V2GetSTH", MaxErrorRate: 0.01, Window: "1m", MinRequests: 100}},
+		{descr: "unknown entrypoint", cfg: SLOConfig{Entrypoint: "GetEverything", MaxErrorRate: 0.01}, wantErr: true},
+		{descr: "no objective", cfg: SLOConfig{Entrypoint: "AddChain"}, wantErr: true},
+		{descr: "bad window", cfg: SLOConfig{Entrypoint: "AddChain", MaxErrorRate: 0.01, Window: "soon"}, wantErr: true},
+		{descr: "short window", cfg: SLOConfig{Entrypoint: "AddChain", MaxErrorRate: 0.01, Window: "1ns"}, wantErr: true},
+		{descr: "bad latency", cfg: SLOConfig{Entrypoint: "AddChain", LatencyThreshold: "-1s"}, wantErr: true},
+		{descr: "rate too high", cfg: SLOConfig{Entrypoint: "AddChain", MaxErrorRate: 1.5}, wantErr: true},
+		{descr: "negative rate", cfg: SLOConfig{Entrypoint: "AddChain", LatencyThreshold: "1s", MaxSlowRate: -0.1}, wantErr: true},
+		{descr: "negative min requests", cfg: SLOConfig{Entrypoint: "AddChain", MaxErrorRate: 0.01, MinRequests: -1}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		_, err := parseSLOs([]SLOConfig{test.cfg})
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("parseSLOs(%s)=_,%v, want error: %v", test.descr, err, test.wantErr)
+		}
+	}
+}
+
+func TestSLOMonitor(t *testing.T) {
+	slos, err := parseSLOs([]SLOConfig{
+		{Entrypoint: "AddChain", Window: "10s", MinRequests: 4, MaxErrorRate: 0.25},
+		{Entrypoint: "GetEntries", Window: "10s", MinRequests: 4, LatencyThreshold: "1s", MaxSlowRate: 0.5},
+	})
+	if err != nil {
+		t.Fatalf("parseSLOs()=_,%v, want no error", err)
+	}
+	ts := &util.FakeTimeSource{FakeTime: fakeTime}
+	m := newSLOMonitor("test{1}", slos, "", ts)
+	if got, want := m.interval, time.Second; got != want {
+		t.Errorf("interval=%v, want %v", got, want)
+	}
+
+	type response struct {
+		entrypoint string
+		status     int
+		latency    time.Duration
+	}
+	var tests = []struct {
+		descr     string
+		advance   time.Duration
+		responses []response
+		want      []SLOAlert
+	}{
+		{
+			descr:     "too few requests",
+			responses: []response{{"AddChain", 500, 0}, {"AddChain", 500, 0}, {"AddChain", 200, 0}},
+		},
+		{
+			descr:     "error rate breached",
+			advance:   time.Second,
+			responses: []response{{"AddChain", 200, 0}, {"AddChain", 400, 0}, {"GetEntries", 200, 2 * time.Second}},
+			want:      []SLOAlert{{Entrypoint: "AddChain", Breached: true, Requests: 5, ErrorRate: 0.4}},
+		},
+		{
+			descr:     "still breached",
+			advance:   time.Second,
+			responses: []response{{"AddChain", 200, 0}},
+		},
+		{
+			descr:     "latency breached",
+			advance:   time.Second,
+			responses: []response{{"GetEntries", 200, 3 * time.Second}, {"GetEntries", 200, 0}, {"GetEntries", 200, 2 * time.Second}},
+			want:      []SLOAlert{{Entrypoint: "GetEntries", Breached: true, Requests: 4, SlowRate: 0.75}},
+		},
+		{
+			// The errors have left the window, but the slow responses haven't.
+			descr:   "error rate recovered",
+			advance: 7 * time.Second,
+			want:    []SLOAlert{{Entrypoint: "AddChain", Requests: 3}},
+		},
+		{
+			descr:   "latency recovered",
+			advance: 3 * time.Second,
+			want:    []SLOAlert{{Entrypoint: "GetEntries"}},
+		},
+	}
+
+	for _, test := range tests {
+		ts.FakeTime = ts.FakeTime.Add(test.advance)
+		for _, r := range test.responses {
+			m.observe(r.entrypoint, r.status, r.latency)
+		}
+		got := m.evaluate()
+		for i := range test.want {
+			test.want[i].Log = "test{1}"
+			test.want[i].Window = "10s"
+			test.want[i].Time = ts.FakeTime
+		}
+		if got, want := mustMarshalJSON(t, got), mustMarshalJSON(t, test.want); got != want {
+			t.Errorf("%s: evaluate()=%s, want %s", test.descr, got, want)
+		}
+		breached := int64(0)
+		for _, s := range slos {
+			if s.breached {
+				breached++
+			}
+		}
+		if got := m.exp.breached.Value(); got != breached {
+			t.Errorf("%s: breached=%d, want %d", test.descr, got, breached)
+		}
+	}
+}
+
+func TestSLOMonitorWebhook(t *testing.T) {
+	var got []SLOAlert
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert SLOAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("Failed to decode alert: %v", err)
+		}
+		got = append(got, alert)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	m := newSLOMonitor("test{1}", nil, server.URL, fakeTimeSource)
+	alert := SLOAlert{Log: "test{1}", Entrypoint: "AddChain", Breached: true, Requests: 10, ErrorRate: 0.5, Window: "5m0s", Time: fakeTime}
+	m.alert(alert)
+	status = http.StatusServiceUnavailable
+	m.alert(alert)
+
+	if len(got) != 2 || mustMarshalJSON(t, got[0]) != mustMarshalJSON(t, alert) {
+		t.Errorf("webhook got %v, want %v twice", got, alert)
+	}
+	if got, want := m.exp.webhookFailures.Value(), int64(1); got != want {
+		t.Errorf("webhook-failures=%d, want %d", got, want)
+	}
+}
+
+func TestAppHandlerObservesSLOs(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	slos, err := parseSLOs([]SLOConfig{{Entrypoint: "GetSTH", MaxErrorRate: 0.1}})
+	if err != nil {
+		t.Fatalf("parseSLOs()=_,%v, want no error", err)
+	}
+	info.c.slo = newSLOMonitor(info.c.logPrefix, slos, "", fakeTimeSource)
+
+	for _, status := range []int{http.StatusOK, http.StatusInternalServerError, http.StatusBadRequest} {
+		status := status
+		handler := appHandler{context: info.c, name: "GetSTH", method: http.MethodGet,
+			handler: func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+				if status != http.StatusOK {
+					return status, errors.New("failed")
+				}
+				return status, nil
+			}}
+		req, err := http.NewRequest(http.MethodGet, "http://example.com/ct/v1/get-sth", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	requests, errors, _ := slos[0].counts(fakeTime)
+	if requests != 3 || errors != 1 {
+		t.Errorf("counts()=%d,%d, want 3,1", requests, errors)
+	}
+}
@@ -0,0 +1,54 @@
+package ct
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// GetSTHByTreeSizePath is the path of the endpoint serving the STH the log issued for a
+	// given tree size, relative to the log's prefix. It isn't part of RFC 6962.
+	GetSTHByTreeSizePath = "/ct/v1/get-sth-by-tree-size"
+	// The name of the get-sth-by-tree-size parameter
+	getSTHByTreeSizeParamTreeSize = "tree_size"
+)
+
+// getSTHByTreeSize serves the earliest tree head the log issued for a tree size, in the
+// same form as get-sth, so auditors can get the exact STH a proof for that size was built
+// against rather than only the latest one. It's a 404 if the log never issued a tree head
+// for that size.
+func getSTHByTreeSize(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	treeSize, err := strconv.ParseInt(r.FormValue(getSTHByTreeSizeParamTreeSize), 10, 64)
+	if err != nil || treeSize < 0 {
+		return http.StatusBadRequest, fmt.Errorf("get-sth-by-tree-size: invalid %s: %q", getSTHByTreeSizeParamTreeSize, r.FormValue(getSTHByTreeSizeParamTreeSize))
+	}
+
+	req := trillian.GetTreeHeadBySizeRequest{LogId: c.logID, TreeSize: treeSize}
+	glog.V(2).Infof("%s: GetSTHByTreeSize => grpc.GetTreeHeadBySize %+v", c.logPrefix, req)
+	rsp, err := c.rpcClient.GetTreeHeadBySize(ctx, &req)
+	glog.V(2).Infof("%s: GetSTHByTreeSize <= grpc.GetTreeHeadBySize status=%v", c.logPrefix, rsp.GetStatus())
+	if status.Code(err) == codes.NotFound {
+		return http.StatusNotFound, fmt.Errorf("get-sth-by-tree-size: no tree head for tree size %d", treeSize)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("backend GetTreeHeadBySize request failed: %v", err)
+	}
+	if !rpcStatusOK(rsp.GetStatus()) {
+		return http.StatusInternalServerError, fmt.Errorf("backend GetTreeHeadBySize request failed, status=%v", rsp.GetStatus())
+	}
+	slr := rsp.GetSignedLogRoot()
+	if slr == nil {
+		return http.StatusInternalServerError, fmt.Errorf("no log root returned")
+	}
+	if slr.TreeSize != treeSize {
+		return http.StatusInternalServerError, fmt.Errorf("backend returned root for tree size %d, want %d", slr.TreeSize, treeSize)
+	}
+	return writeHistoricalSTH(c, w, r, *slr)
+}
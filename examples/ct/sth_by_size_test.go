@@ -0,0 +1,85 @@
+package ct
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/trillian"
+	"github.com/google/trillian/examples/ct/testonly"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetSTHByTreeSize(t *testing.T) {
+	root := &trillian.SignedLogRoot{
+		TimestampNanos: 12345000000,
+		TreeSize:       25,
+		RootHash:       []byte("abcdabcdabcdabcdabcdabcdabcdabcd"),
+	}
+
+	var tests = []struct {
+		descr    string
+		treeSize string
+		wantSize int64 // the tree size passed to the backend, if it's called
+		rpcRsp   *trillian.GetTreeHeadBySizeResponse
+		rpcErr   error
+		want     int
+		errStr   string
+	}{
+		{descr: "missing", want: http.StatusBadRequest, errStr: "invalid tree_size"},
+		{descr: "not-a-number", treeSize: "big", want: http.StatusBadRequest, errStr: "invalid tree_size"},
+		{descr: "negative", treeSize: "-1", want: http.StatusBadRequest, errStr: "invalid tree_size"},
+		{descr: "backend-failure", treeSize: "25", wantSize: 25, rpcErr: errors.New("backendfailure"), want: http.StatusInternalServerError, errStr: "request failed"},
+		{descr: "not-found", treeSize: "26", wantSize: 26, rpcErr: status.Errorf(codes.NotFound, "no tree head"), want: http.StatusNotFound, errStr: "no tree head for tree size 26"},
+		{descr: "no-root", treeSize: "25", wantSize: 25, rpcRsp: &trillian.GetTreeHeadBySizeResponse{Status: okStatus}, want: http.StatusInternalServerError, errStr: "no log root returned"},
+		{descr: "wrong-size", treeSize: "24", wantSize: 24, rpcRsp: &trillian.GetTreeHeadBySizeResponse{Status: okStatus, SignedLogRoot: root}, want: http.StatusInternalServerError, errStr: "tree size 25, want 24"},
+		{descr: "ok", treeSize: "25", wantSize: 25, rpcRsp: &trillian.GetTreeHeadBySizeResponse{Status: okStatus, SignedLogRoot: root}, want: http.StatusOK},
+	}
+
+	info := setupTest(t, []string{testonly.CACertPEM})
+	defer info.mockCtrl.Finish()
+	info.expectSignAny()
+
+	for _, test := range tests {
+		if test.wantSize != 0 {
+			info.client.EXPECT().GetTreeHeadBySize(deadlineMatcher(), &trillian.GetTreeHeadBySizeRequest{LogId: 0x42, TreeSize: test.wantSize}).Return(test.rpcRsp, test.rpcErr)
+		}
+		req, err := http.NewRequest("GET", "http://example.com"+GetSTHByTreeSizePath+"?tree_size="+test.treeSize, nil)
+		if err != nil {
+			t.Errorf("Failed to create request: %v", err)
+			continue
+		}
+		handler := appHandler{context: info.c, handler: getSTHByTreeSize, name: "GetSTHByTreeSize", method: http.MethodGet}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got := w.Code; got != test.want {
+			t.Errorf("GetSTHByTreeSize(%s).Code=%d; want %d", test.descr, got, test.want)
+		}
+		if test.errStr != "" {
+			if body := w.Body.String(); !strings.Contains(body, test.errStr) {
+				t.Errorf("GetSTHByTreeSize(%s)=%q; want to find %q", test.descr, body, test.errStr)
+			}
+			continue
+		}
+
+		var rsp ct.GetSTHResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+			t.Errorf("Failed to unmarshal json response: %s", w.Body.Bytes())
+			continue
+		}
+		if got, want := rsp.TreeSize, uint64(25); got != want {
+			t.Errorf("GetSTHByTreeSize(%s).TreeSize=%d; want %d", test.descr, got, want)
+		}
+		if got, want := rsp.Timestamp, uint64(12345); got != want {
+			t.Errorf("GetSTHByTreeSize(%s).Timestamp=%d; want %d", test.descr, got, want)
+		}
+		if got, want := string(rsp.SHA256RootHash), string(root.RootHash); got != want {
+			t.Errorf("GetSTHByTreeSize(%s).SHA256RootHash=%q; want %q", test.descr, got, want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package ct
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// GetSTHByTimestampPath is the path of the endpoint serving the earliest STH the log
+	// issued at or after a given time, relative to the log's prefix. It isn't part of
+	// RFC 6962.
+	GetSTHByTimestampPath = "/ct/v1/get-sth-by-timestamp"
+	// The name of the get-sth-by-timestamp parameter, in milliseconds since the epoch as
+	// for STH timestamps
+	getSTHByTimestampParamTimestamp = "timestamp"
+)
+
+// getSTHByTimestamp serves the earliest tree head the log issued at or after a timestamp,
+// in the same form as get-sth, so auditors can check what the log claimed at a specific
+// moment. It's a 404 if the log hasn't issued a tree head since then.
+func getSTHByTimestamp(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	timestamp, err := strconv.ParseInt(r.FormValue(getSTHByTimestampParamTimestamp), 10, 64)
+	if err != nil || timestamp < 0 {
+		return http.StatusBadRequest, fmt.Errorf("get-sth-by-timestamp: invalid %s: %q", getSTHByTimestampParamTimestamp, r.FormValue(getSTHByTimestampParamTimestamp))
+	}
+	if timestamp > (1<<63-1)/int64(time.Millisecond) {
+		return http.StatusBadRequest, fmt.Errorf("get-sth-by-timestamp: %s out of range: %d", getSTHByTimestampParamTimestamp, timestamp)
+	}
+
+	req := trillian.GetTreeHeadByTimestampRequest{LogId: c.logID, TimestampNanos: timestamp * int64(time.Millisecond)}
+	glog.V(2).Infof("%s: GetSTHByTimestamp => grpc.GetTreeHeadByTimestamp %+v", c.logPrefix, req)
+	rsp, err := c.rpcClient.GetTreeHeadByTimestamp(ctx, &req)
+	glog.V(2).Infof("%s: GetSTHByTimestamp <= grpc.GetTreeHeadByTimestamp status=%v", c.logPrefix, rsp.GetStatus())
+	if status.Code(err) == codes.NotFound {
+		return http.StatusNotFound, fmt.Errorf("get-sth-by-timestamp: no tree head at or after %d", timestamp)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("backend GetTreeHeadByTimestamp request failed: %v", err)
+	}
+	if !rpcStatusOK(rsp.GetStatus()) {
+		return http.StatusInternalServerError, fmt.Errorf("backend GetTreeHeadByTimestamp request failed, status=%v", rsp.GetStatus())
+	}
+	slr := rsp.GetSignedLogRoot()
+	if slr == nil {
+		return http.StatusInternalServerError, fmt.Errorf("no log root returned")
+	}
+	return writeHistoricalSTH(c, w, r, *slr)
+}
+
+// writeHistoricalSTH serves a past log root from the backend as an STH, in the same form
+// as get-sth.
+func writeHistoricalSTH(c LogContext, w http.ResponseWriter, r *http.Request, slr trillian.SignedLogRoot) (int, error) {
+	if err := c.checkRootHash(slr.RootHash); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	// If the client already has this tree head there's no need to sign it again.
+	etag := sthETag(uint64(slr.TreeSize), uint64(slr.TimestampNanos/millisPerNano), slr.RootHash)
+	if checkNotModified(w, r, etag) {
+		return http.StatusNotModified, nil
+	}
+
+	sth, err := signTreeHeadForRoot(c.sthKeyManager, slr)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := setLogKeyID(w, c.sthKeyManager); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	jsonRsp, err := sthResponse(sth)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set(contentTypeHeader, contentTypeJSON)
+	jsonData, err := json.Marshal(&jsonRsp)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to marshal response: %v %v", jsonRsp, err)
+	}
+	if _, err := w.Write(jsonData); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to write response data: %v", err)
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,133 @@
+package ct
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/trillian"
+	"github.com/google/trillian/examples/ct/testonly"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetSTHByTimestamp(t *testing.T) {
+	root := &trillian.SignedLogRoot{
+		TimestampNanos: 12345000000,
+		TreeSize:       25,
+		RootHash:       []byte("abcdabcdabcdabcdabcdabcdabcdabcd"),
+	}
+	okRsp := &trillian.GetTreeHeadByTimestampResponse{
+		Status:        &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK},
+		SignedLogRoot: root,
+	}
+
+	var tests = []struct {
+		descr     string
+		timestamp string
+		wantNanos int64 // the timestamp passed to the backend, if it's called
+		rpcRsp    *trillian.GetTreeHeadByTimestampResponse
+		rpcErr    error
+		want      int
+		errStr    string
+	}{
+		{descr: "missing", want: http.StatusBadRequest, errStr: "invalid timestamp"},
+		{descr: "not-a-number", timestamp: "yesterday", want: http.StatusBadRequest, errStr: "invalid timestamp"},
+		{descr: "negative", timestamp: "-1", want: http.StatusBadRequest, errStr: "invalid timestamp"},
+		{descr: "out-of-range", timestamp: "9223372036854775", want: http.StatusBadRequest, errStr: "out of range"},
+		{
+			descr:     "backend-failure",
+			timestamp: "12000",
+			wantNanos: 12000000000,
+			rpcErr:    errors.New("backendfailure"),
+			want:      http.StatusInternalServerError,
+			errStr:    "request failed",
+		},
+		{
+			descr:     "not-found",
+			timestamp: "13000",
+			wantNanos: 13000000000,
+			rpcErr:    status.Errorf(codes.NotFound, "no tree head"),
+			want:      http.StatusNotFound,
+			errStr:    "no tree head at or after 13000",
+		},
+		{
+			descr:     "no-root",
+			timestamp: "12000",
+			wantNanos: 12000000000,
+			rpcRsp:    &trillian.GetTreeHeadByTimestampResponse{Status: okRsp.Status},
+			want:      http.StatusInternalServerError,
+			errStr:    "no log root returned",
+		},
+		{descr: "ok", timestamp: "12000", wantNanos: 12000000000, rpcRsp: okRsp, want: http.StatusOK},
+	}
+
+	info := setupTest(t, []string{testonly.CACertPEM})
+	defer info.mockCtrl.Finish()
+	info.expectSignAny()
+
+	for _, test := range tests {
+		if test.wantNanos != 0 {
+			info.client.EXPECT().GetTreeHeadByTimestamp(deadlineMatcher(), &trillian.GetTreeHeadByTimestampRequest{LogId: 0x42, TimestampNanos: test.wantNanos}).Return(test.rpcRsp, test.rpcErr)
+		}
+		req, err := http.NewRequest("GET", "http://example.com"+GetSTHByTimestampPath+"?timestamp="+test.timestamp, nil)
+		if err != nil {
+			t.Errorf("Failed to create request: %v", err)
+			continue
+		}
+		handler := appHandler{context: info.c, handler: getSTHByTimestamp, name: "GetSTHByTimestamp", method: http.MethodGet}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got := w.Code; got != test.want {
+			t.Errorf("GetSTHByTimestamp(%s).Code=%d; want %d", test.descr, got, test.want)
+		}
+		if test.errStr != "" {
+			if body := w.Body.String(); !strings.Contains(body, test.errStr) {
+				t.Errorf("GetSTHByTimestamp(%s)=%q; want to find %q", test.descr, body, test.errStr)
+			}
+			continue
+		}
+
+		var rsp ct.GetSTHResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+			t.Errorf("Failed to unmarshal json response: %s", w.Body.Bytes())
+			continue
+		}
+		if got, want := rsp.TreeSize, uint64(25); got != want {
+			t.Errorf("GetSTHByTimestamp(%s).TreeSize=%d; want %d", test.descr, got, want)
+		}
+		if got, want := rsp.Timestamp, uint64(12345); got != want {
+			t.Errorf("GetSTHByTimestamp(%s).Timestamp=%d; want %d", test.descr, got, want)
+		}
+		if got, want := string(rsp.SHA256RootHash), string(root.RootHash); got != want {
+			t.Errorf("GetSTHByTimestamp(%s).SHA256RootHash=%q; want %q", test.descr, got, want)
+		}
+	}
+}
+
+func TestGetSTHByTimestampNotModified(t *testing.T) {
+	info := setupTest(t, []string{testonly.CACertPEM})
+	defer info.mockCtrl.Finish()
+	rsp := &trillian.GetTreeHeadByTimestampResponse{
+		Status:        &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK},
+		SignedLogRoot: &trillian.SignedLogRoot{TimestampNanos: 12345000000, TreeSize: 25, RootHash: []byte("abcdabcdabcdabcdabcdabcdabcdabcd")},
+	}
+	info.client.EXPECT().GetTreeHeadByTimestamp(deadlineMatcher(), gomock.Any()).Return(rsp, nil)
+
+	req, err := http.NewRequest("GET", "http://example.com"+GetSTHByTimestampPath+"?timestamp=12000", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("If-None-Match", "\"25-12345-6162636461626364616263646162636461626364616263646162636461626364\"")
+	handler := appHandler{context: info.c, handler: getSTHByTimestamp, name: "GetSTHByTimestamp", method: http.MethodGet}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusNotModified; got != want {
+		t.Errorf("GetSTHByTimestamp().Code=%d; want %d", got, want)
+	}
+}
@@ -0,0 +1,211 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+)
+
+const (
+	// Deadline for posting a submission audit record to a webhook
+	submissionAuditWebhookTimeout = 10 * time.Second
+	// The number of records a webhook sink holds while they wait to be posted, if not
+	// set. Records beyond this are dropped.
+	defaultSubmissionAuditQueueSize = 10000
+)
+
+// SubmissionAuditRecord records an SCT issued by a log, along with who submitted the
+// chain it was issued for. It gives the operator a record of submissions that doesn't
+// depend on the log itself, e.g. for investigating abuse.
+type SubmissionAuditRecord struct {
+	// Time is when the request was received.
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	LogID     int64     `json:"log_id"`
+	LogPrefix string    `json:"log_prefix"`
+	Endpoint  string    `json:"endpoint"`
+	ClientIP  string    `json:"client_ip"`
+	// APIKey and ClientCert identify the submitter, if it authenticated.
+	APIKey     string `json:"api_key,omitempty"`
+	ClientCert string `json:"client_cert,omitempty"`
+	// SCTTimestamp is the timestamp of the SCT issued, in milliseconds since the epoch.
+	SCTTimestamp uint64 `json:"sct_timestamp"`
+	Precert      bool   `json:"precert"`
+	// Duplicate is set if the chain's certificate was already in the log, in which case
+	// the SCT is the one originally issued for it.
+	Duplicate bool `json:"duplicate"`
+	// LeafHash is the hex encoded RFC 6962 Merkle leaf hash of the entry, which can be
+	// used to find it with get-proof-by-hash.
+	LeafHash string `json:"leaf_hash"`
+	// ChainFingerprints are the hex encoded SHA-256 fingerprints of the certificates in
+	// the verified chain, starting with the submitted one.
+	ChainFingerprints []string `json:"chain_sha256"`
+}
+
+// SubmissionAuditSink receives a record for every SCT a log issues. Implementations must
+// be safe for concurrent use, and should only ever append to the store they write to.
+type SubmissionAuditSink interface {
+	RecordSubmission(rec *SubmissionAuditRecord)
+}
+
+// JSONSubmissionAudit is a SubmissionAuditSink that writes each record to an io.Writer
+// as a line of JSON.
+type JSONSubmissionAudit struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONSubmissionAudit creates a JSONSubmissionAudit that writes records to w, e.g. a
+// RotatingFile or a syslog writer.
+func NewJSONSubmissionAudit(w io.Writer) *JSONSubmissionAudit {
+	return &JSONSubmissionAudit{enc: json.NewEncoder(w)}
+}
+
+// RecordSubmission writes a single record.
+func (j *JSONSubmissionAudit) RecordSubmission(rec *SubmissionAuditRecord) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.enc.Encode(rec); err != nil {
+		glog.Warningf("Failed to write submission audit record: %v", err)
+	}
+}
+
+// WebhookSubmissionAudit is a SubmissionAuditSink that posts each record as JSON to a
+// URL. Records are posted in the background so submissions aren't held up; if the
+// webhook falls too far behind records are dropped, and counted, rather than queued
+// without limit.
+type WebhookSubmissionAudit struct {
+	url    string
+	client *http.Client
+	queue  chan *SubmissionAuditRecord
+	done   chan struct{}
+
+	exp struct {
+		vars     *expvar.Map
+		posted   *expvar.Int
+		failures *expvar.Int
+		dropped  *expvar.Int
+	}
+}
+
+// NewWebhookSubmissionAudit creates a WebhookSubmissionAudit that posts records to url,
+// holding up to queueSize of them while they wait. It posts records until Close is
+// called.
+func NewWebhookSubmissionAudit(url string, queueSize int) *WebhookSubmissionAudit {
+	if queueSize <= 0 {
+		queueSize = defaultSubmissionAuditQueueSize
+	}
+	w := &WebhookSubmissionAudit{
+		url:    url,
+		client: &http.Client{Timeout: submissionAuditWebhookTimeout},
+		queue:  make(chan *SubmissionAuditRecord, queueSize),
+		done:   make(chan struct{}),
+	}
+	w.exp.vars = new(expvar.Map).Init()
+	w.exp.posted = new(expvar.Int)
+	w.exp.vars.Set("posted", w.exp.posted)
+	w.exp.failures = new(expvar.Int)
+	w.exp.vars.Set("webhook-failures", w.exp.failures)
+	w.exp.dropped = new(expvar.Int)
+	w.exp.vars.Set("dropped", w.exp.dropped)
+	go w.run()
+	return w
+}
+
+// RecordSubmission queues a record to be posted.
+func (w *WebhookSubmissionAudit) RecordSubmission(rec *SubmissionAuditRecord) {
+	select {
+	case w.queue <- rec:
+	default:
+		w.exp.dropped.Add(1)
+		glog.Warningf("Dropped submission audit record for %s SCT %d: webhook queue full", rec.LogPrefix, rec.SCTTimestamp)
+	}
+}
+
+// Close stops accepting records and waits for those already queued to be posted.
+func (w *WebhookSubmissionAudit) Close() {
+	close(w.queue)
+	<-w.done
+}
+
+// Vars returns the statistics exported by this WebhookSubmissionAudit.
+func (w *WebhookSubmissionAudit) Vars() *expvar.Map {
+	return w.exp.vars
+}
+
+func (w *WebhookSubmissionAudit) run() {
+	defer close(w.done)
+	for rec := range w.queue {
+		if err := w.post(rec); err != nil {
+			w.exp.failures.Add(1)
+			glog.Warningf("Failed to post submission audit record for %s SCT %d to webhook: %v", rec.LogPrefix, rec.SCTTimestamp, err)
+			continue
+		}
+		w.exp.posted.Add(1)
+	}
+}
+
+func (w *WebhookSubmissionAudit) post(rec *SubmissionAuditRecord) error {
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	rsp, err := w.client.Post(w.url, contentTypeJSON, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode/100 != 2 {
+		return errors.New(rsp.Status)
+	}
+	return nil
+}
+
+// auditSubmission records an SCT that has been returned to the submitter, if the log
+// has a submission audit sink.
+func auditSubmission(ctx context.Context, c LogContext, sub submission, isPrecert bool) {
+	if c.submissionAudit == nil {
+		return
+	}
+	leafData, err := tls.Marshal(sub.merkleLeaf)
+	if err != nil {
+		glog.Warningf("%s: not auditing submission: failed to marshal leaf: %v", c.logPrefix, err)
+		return
+	}
+	fingerprints := make([]string, 0, len(sub.chain))
+	for _, cert := range sub.chain {
+		hash := sha256.Sum256(cert.Raw)
+		fingerprints = append(fingerprints, hex.EncodeToString(hash[:]))
+	}
+
+	rec := requestStateFrom(ctx).rec
+	c.submissionAudit.RecordSubmission(&SubmissionAuditRecord{
+		Time:              rec.Time,
+		RequestID:         rec.RequestID,
+		LogID:             rec.LogID,
+		LogPrefix:         rec.LogPrefix,
+		Endpoint:          rec.Endpoint,
+		ClientIP:          rec.ClientIP,
+		APIKey:            rec.APIKey,
+		ClientCert:        rec.ClientCert,
+		SCTTimestamp:      sub.sct.Timestamp,
+		Precert:           isPrecert,
+		Duplicate:         sub.duplicate,
+		LeafHash:          hex.EncodeToString(merkle.NewRFC6962TreeHasher(crypto.NewSHA256()).HashLeaf(leafData)),
+		ChainFingerprints: fingerprints,
+	})
+}
@@ -0,0 +1,175 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/examples/ct/testonly"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/util"
+)
+
+// recordingSubmissionAudit keeps the records it's given so tests can check them.
+type recordingSubmissionAudit struct {
+	mu   sync.Mutex
+	recs []SubmissionAuditRecord
+}
+
+func (r *recordingSubmissionAudit) RecordSubmission(rec *SubmissionAuditRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recs = append(r.recs, *rec)
+}
+
+func TestAddChainAuditsSubmission(t *testing.T) {
+	pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+	certs := pool.RawCertificates()
+	var wantFingerprints []string
+	for _, cert := range certs {
+		hash := sha256.Sum256(cert.Raw)
+		wantFingerprints = append(wantFingerprints, hex.EncodeToString(hash[:]))
+	}
+
+	var tests = []struct {
+		desc       string
+		rsp        *trillian.QueueLeavesResponse
+		err        error
+		duplicate  bool
+		wantRecord bool
+	}{
+		{desc: "queued", rsp: &trillian.QueueLeavesResponse{Status: okStatus}, wantRecord: true},
+		{desc: "duplicate", duplicate: true, wantRecord: true},
+		{desc: "backend error", err: errors.New("backend down")},
+		{desc: "bad status", rsp: &trillian.QueueLeavesResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_ERROR}}},
+	}
+
+	for _, test := range tests {
+		info := setupTest(t, []string{testonly.FakeCACertPEM})
+		info.expectSignAny()
+		sink := &recordingSubmissionAudit{}
+		info.c.submissionAudit = sink
+
+		sctTime := fakeTime
+		merkleLeaf, _, err := signV1SCTForCertificate(info.km, certs[0], nil, fakeTime)
+		if err != nil {
+			t.Fatalf("Unexpected error signing SCT: %v", err)
+		}
+		leaves := logLeavesForCert(t, info.km, certs, merkleLeaf, false)
+		rsp := test.rsp
+		if test.duplicate {
+			sctTime = fakeTime.Add(-time.Hour)
+			merkleLeaf, _, err = signV1SCTForCertificate(info.km, certs[0], nil, sctTime)
+			if err != nil {
+				t.Fatalf("Unexpected error signing SCT: %v", err)
+			}
+			existing := logLeavesForCert(t, info.km, certs, merkleLeaf, false)[0]
+			rsp = &trillian.QueueLeavesResponse{Status: okStatus, QueuedLeaves: []*trillian.QueuedLogLeaf{{Leaf: existing, Duplicate: true}}}
+		}
+		info.client.EXPECT().QueueLeaves(deadlineMatcher(), &trillian.QueueLeavesRequest{LogId: 0x42, Leaves: leaves}).Return(rsp, test.err)
+
+		w := makeAddChainRequest(t, info.c, createJSONChain(t, *pool))
+		info.mockCtrl.Finish()
+		if got, want := len(sink.recs) == 1, test.wantRecord; got != want {
+			t.Errorf("addChain(%s): recorded %d submissions, want recorded: %v", test.desc, len(sink.recs), want)
+			continue
+		}
+		if !test.wantRecord {
+			continue
+		}
+
+		leafData, err := tls.Marshal(merkleLeaf)
+		if err != nil {
+			t.Fatalf("Failed to marshal leaf: %v", err)
+		}
+		rec := sink.recs[0]
+		for _, v := range []struct {
+			name string
+			got  interface{}
+			want interface{}
+		}{
+			{"Endpoint", rec.Endpoint, "AddChain"},
+			{"RequestID", rec.RequestID, w.Header().Get(util.RequestIDHeader)},
+			{"LogID", rec.LogID, int64(0x42)},
+			{"SCTTimestamp", rec.SCTTimestamp, uint64(sctTime.UnixNano() / millisPerNano)},
+			{"Precert", rec.Precert, false},
+			{"Duplicate", rec.Duplicate, test.duplicate},
+			{"LeafHash", rec.LeafHash, hex.EncodeToString(merkle.NewRFC6962TreeHasher(crypto.NewSHA256()).HashLeaf(leafData))},
+			{"ChainFingerprints", len(rec.ChainFingerprints), len(wantFingerprints)},
+		} {
+			if v.got != v.want {
+				t.Errorf("addChain(%s): %s=%v, want %v", test.desc, v.name, v.got, v.want)
+			}
+		}
+		for i := range rec.ChainFingerprints {
+			if i < len(wantFingerprints) && rec.ChainFingerprints[i] != wantFingerprints[i] {
+				t.Errorf("addChain(%s): ChainFingerprints[%d]=%s, want %s", test.desc, i, rec.ChainFingerprints[i], wantFingerprints[i])
+			}
+		}
+	}
+}
+
+func TestJSONSubmissionAudit(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONSubmissionAudit(&buf)
+	sink.RecordSubmission(&SubmissionAuditRecord{Endpoint: "AddChain", SCTTimestamp: 1})
+	sink.RecordSubmission(&SubmissionAuditRecord{Endpoint: "AddPreChain", SCTTimestamp: 2, Precert: true})
+
+	dec := json.NewDecoder(&buf)
+	for _, want := range []string{"AddChain", "AddPreChain"} {
+		var rec SubmissionAuditRecord
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("Decode()=%v", err)
+		}
+		if got := rec.Endpoint; got != want {
+			t.Errorf("Decode().Endpoint=%s, want %s", got, want)
+		}
+	}
+}
+
+func TestWebhookSubmissionAudit(t *testing.T) {
+	var mu sync.Mutex
+	var got []uint64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rec SubmissionAuditRecord
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			t.Errorf("Failed to decode posted record: %v", err)
+		}
+		if rec.SCTTimestamp == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, rec.SCTTimestamp)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSubmissionAudit(server.URL, 10)
+	for i := uint64(1); i <= 3; i++ {
+		sink.RecordSubmission(&SubmissionAuditRecord{Endpoint: "AddChain", SCTTimestamp: i})
+	}
+	sink.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []uint64{1, 3}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("webhook received records %v, want %v", got, want)
+	}
+	if got, want := sink.exp.posted.Value(), int64(2); got != want {
+		t.Errorf("posted=%d, want %d", got, want)
+	}
+	if got, want := sink.exp.failures.Value(), int64(1); got != want {
+		t.Errorf("webhook-failures=%d, want %d", got, want)
+	}
+}
@@ -0,0 +1,201 @@
+package testonly
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/certificate-transparency/go/asn1"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/certificate-transparency/go/x509/pkix"
+)
+
+// KeyType is a type of key a ChainBuilder can generate for a certificate.
+type KeyType int
+
+// Key types for CertSpec.KeyType.
+const (
+	KeyECDSAP256 KeyType = iota
+	KeyECDSAP384
+	KeyRSA1024
+	KeyRSA2048
+)
+
+// PoisonExtensionOID is the OID of the critical extension marking a precertificate.
+var PoisonExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+
+// PrecertSigningEKUOID is the OID of the extended key usage of a Precertificate Signing
+// Certificate.
+var PrecertSigningEKUOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 4}
+
+// CertSpec describes a certificate for a ChainBuilder to generate. Fields left as their
+// zero value get defaults: a new ECDSA P-256 key, the next serial number, and validity
+// from 2016 to 2036.
+type CertSpec struct {
+	CommonName string
+	DNSNames   []string
+	// Key is the certificate's private key. If nil, a new key of KeyType is generated.
+	Key     crypto.Signer
+	KeyType KeyType
+	// SignatureAlgorithm is the algorithm the issuer signs with, or the default for the
+	// issuer's key if unset.
+	SignatureAlgorithm x509.SignatureAlgorithm
+	SerialNumber       int64
+	NotBefore          time.Time
+	NotAfter           time.Time
+	ExtKeyUsage        []x509.ExtKeyUsage
+	UnknownExtKeyUsage []asn1.ObjectIdentifier
+	// IssuingCertificateURL is the certificate's authority information access URL.
+	IssuingCertificateURL []string
+	// SubjectKeyID is set by default for CA certificates.
+	SubjectKeyID    []byte
+	ExtraExtensions []pkix.Extension
+}
+
+// Cert is a certificate generated by a ChainBuilder.
+type Cert struct {
+	*x509.Certificate
+	// Key is the certificate's private key.
+	Key crypto.Signer
+	// Spec is the spec the certificate was generated from, with the defaults filled in.
+	// Issuing a leaf from it again gives a certificate for the same key and serial number,
+	// e.g. the final certificate for a precertificate.
+	Spec CertSpec
+}
+
+// PEM returns the PEM encoding of the certificate.
+func (c *Cert) PEM() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}))
+}
+
+// Chain returns the DER encodings of certs, e.g. for the chain of an add-chain request.
+func Chain(certs ...*Cert) [][]byte {
+	chain := make([][]byte, 0, len(certs))
+	for _, cert := range certs {
+		chain = append(chain, cert.Raw)
+	}
+	return chain
+}
+
+// ChainBuilder generates certificates for tests that need chains with particular
+// properties, failing the test if it can't.
+type ChainBuilder struct {
+	t      testing.TB
+	serial int64
+}
+
+// NewChainBuilder creates a ChainBuilder for the test t.
+func NewChainBuilder(t testing.TB) *ChainBuilder {
+	return &ChainBuilder{t: t}
+}
+
+// Root generates a self-signed CA certificate.
+func (b *ChainBuilder) Root(spec CertSpec) *Cert {
+	return b.issue(nil, spec, true)
+}
+
+// Intermediate generates a CA certificate issued by issuer.
+func (b *ChainBuilder) Intermediate(issuer *Cert, spec CertSpec) *Cert {
+	return b.issue(issuer, spec, true)
+}
+
+// Leaf generates an end-entity certificate issued by issuer. If issuer is nil the
+// certificate is self-signed.
+func (b *ChainBuilder) Leaf(issuer *Cert, spec CertSpec) *Cert {
+	return b.issue(issuer, spec, false)
+}
+
+// Precert generates a precertificate issued by issuer, which may be a CA or one of its
+// Precertificate Signing Certificates. The final certificate for it is made by issuing
+// a leaf from the CA with the returned certificate's Spec.
+func (b *ChainBuilder) Precert(issuer *Cert, spec CertSpec) *Cert {
+	poisoned := spec
+	poisoned.ExtraExtensions = append([]pkix.Extension{{Id: PoisonExtensionOID, Critical: true, Value: []byte{0x05, 0x00}}}, spec.ExtraExtensions...)
+	precert := b.issue(issuer, poisoned, false)
+	precert.Spec.ExtraExtensions = spec.ExtraExtensions
+	return precert
+}
+
+// PrecertSigningCert generates a Precertificate Signing Certificate for issuer.
+func (b *ChainBuilder) PrecertSigningCert(issuer *Cert, spec CertSpec) *Cert {
+	spec.UnknownExtKeyUsage = append([]asn1.ObjectIdentifier{PrecertSigningEKUOID}, spec.UnknownExtKeyUsage...)
+	return b.issue(issuer, spec, true)
+}
+
+func (b *ChainBuilder) issue(issuer *Cert, spec CertSpec, isCA bool) *Cert {
+	b.serial++
+	if spec.SerialNumber == 0 {
+		spec.SerialNumber = b.serial
+	}
+	if spec.NotBefore.IsZero() {
+		spec.NotBefore = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if spec.NotAfter.IsZero() {
+		spec.NotAfter = time.Date(2036, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if spec.Key == nil {
+		spec.Key = b.newKey(spec.KeyType)
+	}
+	if isCA && len(spec.SubjectKeyID) == 0 {
+		spec.SubjectKeyID = big.NewInt(spec.SerialNumber).Bytes()
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(spec.SerialNumber),
+		Subject:               pkix.Name{CommonName: spec.CommonName},
+		DNSNames:              spec.DNSNames,
+		NotBefore:             spec.NotBefore,
+		NotAfter:              spec.NotAfter,
+		SignatureAlgorithm:    spec.SignatureAlgorithm,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		ExtKeyUsage:           spec.ExtKeyUsage,
+		UnknownExtKeyUsage:    spec.UnknownExtKeyUsage,
+		IssuingCertificateURL: spec.IssuingCertificateURL,
+		SubjectKeyId:          spec.SubjectKeyID,
+		ExtraExtensions:       spec.ExtraExtensions,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+	parent, parentKey := template, spec.Key
+	if issuer != nil {
+		parent, parentKey = issuer.Certificate, issuer.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, spec.Key.Public(), parentKey)
+	if err != nil {
+		b.t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if _, ok := err.(x509.NonFatalErrors); err != nil && !ok {
+		b.t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return &Cert{Certificate: cert, Key: spec.Key, Spec: spec}
+}
+
+func (b *ChainBuilder) newKey(keyType KeyType) crypto.Signer {
+	var key crypto.Signer
+	var err error
+	switch keyType {
+	case KeyECDSAP256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyECDSAP384:
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyRSA1024:
+		key, err = rsa.GenerateKey(rand.Reader, 1024)
+	case KeyRSA2048:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		b.t.Fatalf("Unknown key type %d", keyType)
+	}
+	if err != nil {
+		b.t.Fatalf("Failed to generate key: %v", err)
+	}
+	return key
+}
@@ -0,0 +1,139 @@
+package testonly
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+)
+
+// FakeLog is an in memory CT log signing with CTLogPrivateKeyPEM, for testing tools that
+// talk to logs. It provides the contents of the responses; the tests wrap it to serve
+// them through the client interface they use, misbehaving as they need to.
+type FakeLog struct {
+	t      testing.TB
+	signer *crypto.Signer
+	tree   *merkle.InMemoryMerkleTree
+	// LogID is the ID of the log's key.
+	LogID ct.SHA256Hash
+	// Leaves holds the leaf inputs of the entries in the log, in order.
+	Leaves [][]byte
+	// hashes holds the Merkle leaf hashes of Leaves.
+	hashes [][]byte
+}
+
+// NewFakeLog creates an empty FakeLog.
+func NewFakeLog(t testing.TB) *FakeLog {
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPrivateKey(CTLogPrivateKeyPEM, CTLogKeyPassword); err != nil {
+		t.Fatalf("Failed to load log key: %v", err)
+	}
+	signer, err := km.Signer()
+	if err != nil {
+		t.Fatalf("Failed to get signer: %v", err)
+	}
+	l := &FakeLog{
+		t:      t,
+		signer: crypto.NewSigner(crypto.NewSHA256(), km.SignatureAlgorithm(), signer),
+		tree:   merkle.NewInMemoryMerkleTree(merkle.NewRFC6962TreeHasher(crypto.NewSHA256())),
+	}
+	if err := l.LogID.FromBase64String(CTLogIDBase64); err != nil {
+		t.Fatalf("Failed to parse log ID: %v", err)
+	}
+	return l
+}
+
+// Size returns the number of entries in the log.
+func (l *FakeLog) Size() int {
+	return len(l.Leaves)
+}
+
+// Add appends an entry with the given leaf input to the log, and returns its Merkle leaf
+// hash.
+func (l *FakeLog) Add(leaf []byte) []byte {
+	_, hash := l.tree.AddLeaf(leaf)
+	l.Leaves = append(l.Leaves, leaf)
+	l.hashes = append(l.hashes, hash.Hash())
+	return hash.Hash()
+}
+
+// Sign signs data with the log's key.
+func (l *FakeLog) Sign(data []byte) ct.DigitallySigned {
+	sig, err := l.signer.Sign(data)
+	if err != nil {
+		l.t.Fatalf("Failed to sign: %v", err)
+	}
+	return ct.DigitallySigned{
+		Algorithm: tls.SignatureAndHashAlgorithm{Hash: tls.SHA256, Signature: tls.ECDSA},
+		Signature: sig.Signature,
+	}
+}
+
+// SignSCT sets the log ID and signature of an SCT for leaf.
+func (l *FakeLog) SignSCT(sct *ct.SignedCertificateTimestamp, leaf ct.MerkleTreeLeaf) {
+	sct.LogID = ct.LogID{KeyID: l.LogID}
+	input, err := ct.SerializeSCTSignatureInput(*sct, ct.LogEntry{Leaf: leaf})
+	if err != nil {
+		l.t.Fatalf("Failed to serialize SCT: %v", err)
+	}
+	sct.Signature = l.Sign(input)
+}
+
+// TreeHead returns an unsigned tree head for the first size entries of the log.
+func (l *FakeLog) TreeHead(size int, timestamp uint64) ct.SignedTreeHead {
+	sth := ct.SignedTreeHead{Version: ct.V1, TreeSize: uint64(size), Timestamp: timestamp}
+	if size > 0 {
+		copy(sth.SHA256RootHash[:], l.tree.RootAtSnapshot(size).Hash())
+	} else {
+		copy(sth.SHA256RootHash[:], crypto.NewSHA256().Digest(nil))
+	}
+	return sth
+}
+
+// SignTreeHead sets the signature of a tree head.
+func (l *FakeLog) SignTreeHead(sth *ct.SignedTreeHead) {
+	input, err := ct.SerializeSTHSignatureInput(*sth)
+	if err != nil {
+		l.t.Fatalf("Failed to serialize tree head: %v", err)
+	}
+	sth.TreeHeadSignature = l.Sign(input)
+}
+
+// ProofByHash returns the get-proof-by-hash response for the entry with the given Merkle
+// leaf hash, if it's within the first treeSize entries.
+func (l *FakeLog) ProofByHash(hash []byte, treeSize uint64) (*ct.GetProofByHashResponse, error) {
+	for i, h := range l.hashes {
+		if !bytes.Equal(h, hash) || uint64(i) >= treeSize {
+			continue
+		}
+		rsp := &ct.GetProofByHashResponse{LeafIndex: int64(i)}
+		for _, node := range l.tree.PathToRootAtSnapshot(i+1, int(treeSize)) {
+			rsp.AuditPath = append(rsp.AuditPath, node.Value.Hash())
+		}
+		return rsp, nil
+	}
+	return nil, errors.New("hash not found")
+}
+
+// Consistency returns the consistency proof between two tree sizes.
+func (l *FakeLog) Consistency(first, second uint64) [][]byte {
+	var proof [][]byte
+	for _, node := range l.tree.SnapshotConsistency(int(first), int(second)) {
+		proof = append(proof, node.Value.Hash())
+	}
+	return proof
+}
+
+// Entries returns the get-entries response for entries start to end inclusive, cut short
+// at the end of the log.
+func (l *FakeLog) Entries(start, end int64) *ct.GetEntriesResponse {
+	rsp := &ct.GetEntriesResponse{}
+	for i := start; i <= end && i < int64(len(l.Leaves)); i++ {
+		rsp.Entries = append(rsp.Entries, ct.LeafEntry{LeafInput: l.Leaves[i]})
+	}
+	return rsp
+}
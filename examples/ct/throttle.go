@@ -0,0 +1,115 @@
+package ct
+
+import (
+	"expvar"
+	"net/http"
+	"time"
+
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+// throttleChunkBytes is the most bytes of a response written at once by a throttled
+// client, so large responses are sent at a steady rate rather than in one late burst.
+const throttleChunkBytes = 16 * 1024
+
+// throttledEntrypoints are the entry download endpoints whose responses are subject to
+// LogConfig.EntriesBytesPerSecond.
+var throttledEntrypoints = map[string]bool{"GetEntries": true, "V2GetEntries": true}
+
+// bandwidthThrottle limits the rate at which each client, identified by IP address, can
+// download entries, so that one monitor fetching the whole log can't use up the server's
+// egress and starve other clients' interactive requests. Clients can send bursts at full
+// speed after being idle.
+type bandwidthThrottle struct {
+	limiter *rateLimiter
+	// sleep waits for d, or until ctx is done.
+	sleep func(ctx context.Context, d time.Duration) error
+	exp   struct {
+		vars          *expvar.Map
+		bytes         *expvar.Int
+		delayedWrites *expvar.Int
+		delayMillis   *expvar.Int
+	}
+}
+
+// newBandwidthThrottle creates a bandwidthThrottle that lets each client download
+// bytesPerSecond, in bursts of up to burstBytes.
+func newBandwidthThrottle(bytesPerSecond, burstBytes int64, timeSource util.TimeSource) *bandwidthThrottle {
+	t := &bandwidthThrottle{
+		limiter: newRateLimiter(float64(bytesPerSecond), float64(burstBytes), timeSource),
+		sleep:   sleepContext,
+	}
+	t.exp.vars = new(expvar.Map).Init()
+	t.exp.bytes = new(expvar.Int)
+	t.exp.vars.Set("bytes", t.exp.bytes)
+	t.exp.delayedWrites = new(expvar.Int)
+	t.exp.vars.Set("delayed-writes", t.exp.delayedWrites)
+	t.exp.delayMillis = new(expvar.Int)
+	t.exp.vars.Set("delay-ms", t.exp.delayMillis)
+	return t
+}
+
+// Vars returns the statistics exported by this bandwidthThrottle.
+func (t *bandwidthThrottle) Vars() *expvar.Map {
+	return t.exp.vars
+}
+
+// wait charges n bytes to the client, and waits until it's within its limit again.
+func (t *bandwidthThrottle) wait(ctx context.Context, client string, n int) error {
+	t.exp.bytes.Add(int64(n))
+	d := t.limiter.reserve(client, float64(n))
+	if d <= 0 {
+		return nil
+	}
+	t.exp.delayedWrites.Add(1)
+	t.exp.delayMillis.Add(int64(d / time.Millisecond))
+	return t.sleep(ctx, d)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// throttledResponseWriter is an http.ResponseWriter that writes the response body no
+// faster than the client's bandwidth limit.
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	ctx    context.Context
+	t      *bandwidthThrottle
+	client string
+}
+
+// Write writes b in chunks, waiting before each one until the client is within its limit.
+// It gives up if the request is cancelled.
+func (w *throttledResponseWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > throttleChunkBytes {
+			chunk = chunk[:throttleChunkBytes]
+		}
+		if err := w.t.wait(w.ctx, w.client, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+// Flush sends any buffered response data to the client.
+func (w *throttledResponseWriter) Flush() {
+	flushResponse(w.ResponseWriter)
+}
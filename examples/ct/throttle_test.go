@@ -0,0 +1,115 @@
+package ct
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	ts := &util.FakeTimeSource{FakeTime: fakeTime}
+	l := newRateLimiter(100, 200, ts)
+
+	var tests = []struct {
+		advance time.Duration
+		client  string
+		n       float64
+		want    time.Duration
+	}{
+		{client: "a", n: 150},
+		{client: "a", n: 50},
+		{client: "a", n: 50, want: 500 * time.Millisecond},
+		{client: "b", n: 200},
+		{advance: 500 * time.Millisecond, client: "a", n: 100, want: time.Second},
+		// The bucket only fills up to the burst size.
+		{advance: time.Hour, client: "a", n: 300, want: time.Second},
+	}
+
+	for i, test := range tests {
+		ts.FakeTime = ts.FakeTime.Add(test.advance)
+		if got := l.reserve(test.client, test.n); got != test.want {
+			t.Errorf("%d: reserve(%s, %v)=%v, want %v", i, test.client, test.n, got, test.want)
+		}
+	}
+}
+
+func TestThrottleMiddleware(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 3*throttleChunkBytes)
+	writeBody := func(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+		if _, err := w.Write(body); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return http.StatusOK, nil
+	}
+
+	var tests = []struct {
+		descr      string
+		name       string
+		remoteAddr string
+		want       []time.Duration
+	}{
+		// The first chunk is within the burst, the rest must wait.
+		{descr: "throttled", name: "GetEntries", remoteAddr: "192.0.2.1:1234", want: []time.Duration{time.Second, time.Second}},
+		// The client has used up its burst.
+		{descr: "same-client", name: "V2GetEntries", remoteAddr: "192.0.2.1:4321", want: []time.Duration{time.Second, time.Second, time.Second}},
+		{descr: "other-client", name: "GetEntries", remoteAddr: "192.0.2.2:1234", want: []time.Duration{time.Second, time.Second}},
+		{descr: "not-entries", name: "GetRoots", remoteAddr: "192.0.2.1:1234"},
+	}
+
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	info.c.compressResponses = false
+	ts := &util.FakeTimeSource{FakeTime: fakeTime}
+	info.c.entriesThrottle = newBandwidthThrottle(throttleChunkBytes, throttleChunkBytes, ts)
+	var sleeps []time.Duration
+	info.c.entriesThrottle.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		ts.FakeTime = ts.FakeTime.Add(d)
+		return nil
+	}
+
+	for _, test := range tests {
+		sleeps = nil
+		handler := appHandler{context: info.c, handler: writeBody, name: test.name, method: http.MethodGet}
+		req, err := http.NewRequest("GET", "http://example.com/ct/v1/endpoint", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.RemoteAddr = test.remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Errorf("%s: ServeHTTP()=%d, want %d", test.descr, got, want)
+		}
+		if got, want := w.Body.Len(), len(body); got != want {
+			t.Errorf("%s: wrote %d bytes, want %d", test.descr, got, want)
+		}
+		if got := sleeps; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: slept for %v, want %v", test.descr, got, test.want)
+		}
+	}
+	if got, want := info.c.entriesThrottle.exp.delayedWrites.Value(), int64(7); got != want {
+		t.Errorf("delayed-writes=%d, want %d", got, want)
+	}
+}
+
+func TestThrottledResponseWriterCancelled(t *testing.T) {
+	th := newBandwidthThrottle(10, 10, &util.FakeTimeSource{FakeTime: fakeTime})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	w := &throttledResponseWriter{ResponseWriter: rec, ctx: ctx, t: th, client: "192.0.2.1"}
+	n, err := w.Write(bytes.Repeat([]byte("x"), 20))
+	if err != context.Canceled {
+		t.Errorf("Write()=_,%v, want %v", err, context.Canceled)
+	}
+	if n != 0 || rec.Body.Len() != 0 {
+		t.Errorf("Write()=%d, wrote %d bytes, want 0", n, rec.Body.Len())
+	}
+}
@@ -0,0 +1,419 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+)
+
+const (
+	// How often the tiles are brought up to date with the tree if the config doesn't say
+	defaultTileUpdateInterval = time.Minute
+	// Path of the checkpoint in the tile store, which holds the signed checkpoint for
+	// the tree size the tiles were last written for
+	checkpointPath = "checkpoint"
+	// Most entries written in one pass of an update, so a log catching up on a large
+	// tree doesn't hold it all in memory
+	maxTileBatchSize = 64 << defaultTileHeight
+)
+
+// tileLevel holds hashes at one level of the tree, starting from the first node of the
+// tile that was partial before an update.
+type tileLevel struct {
+	first  int64
+	hashes [][]byte
+}
+
+// tileChain is the list of fingerprints of a logged certificate's chain, which follows
+// the entry in an entry bundle. The certificates themselves are stored as issuers.
+type tileChain struct {
+	Fingerprints [][sha256.Size]byte `tls:"minlen:0,maxlen:65535"`
+}
+
+// tileWriter materializes a log's tree into a TileStore for the static read API. It
+// periodically fetches the entries added to the tree since the last update, writes the
+// entry bundles and hash tiles covering them, and once the root hash calculated from
+// the tiles matches the latest tree head writes that as the new checkpoint. Readers
+// only rely on tiles up to the checkpoint, so those written for a tree that then fails
+// to verify are rewritten by the next update.
+type tileWriter struct {
+	c         LogContext
+	store     TileStore
+	height    uint
+	batchSize int64
+	hasher    merkle.TreeHasher
+	done      chan struct{}
+
+	// mu guards the update state: size is the tree size the tiles have been written
+	// for, published that of the checkpoint, and issuers the fingerprints of issuer
+	// certificates known to be in the store.
+	mu        sync.Mutex
+	size      int64
+	published int64
+	issuers   map[[sha256.Size]byte]bool
+
+	exp struct {
+		vars     *expvar.Map
+		treeSize *expvar.Int
+		updates  *expvar.Int
+		failures *expvar.Int
+	}
+}
+
+// newTileWriter creates a tileWriter for the log c, carrying on from any checkpoint
+// already in store. The log must have a checkpoint key.
+func newTileWriter(c LogContext, store TileStore) (*tileWriter, error) {
+	if c.checkpointSigner == nil {
+		return nil, errors.New("tiles need a checkpoint key")
+	}
+	tw := &tileWriter{
+		c:         c,
+		store:     store,
+		height:    defaultTileHeight,
+		batchSize: maxTileBatchSize,
+		hasher:    merkle.NewRFC6962TreeHasher(crypto.NewSHA256()),
+		done:      make(chan struct{}),
+		issuers:   make(map[[sha256.Size]byte]bool),
+	}
+	tw.exp.vars = new(expvar.Map).Init()
+	tw.exp.treeSize = new(expvar.Int)
+	tw.exp.vars.Set("tree-size", tw.exp.treeSize)
+	tw.exp.updates = new(expvar.Int)
+	tw.exp.vars.Set("updates", tw.exp.updates)
+	tw.exp.failures = new(expvar.Int)
+	tw.exp.vars.Set("update-failures", tw.exp.failures)
+
+	data, err := store.Get(checkpointPath)
+	if os.IsNotExist(err) {
+		return tw, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %v", err)
+	}
+	if tw.size, _, err = parseCheckpoint(c.checkpointSigner.name, tw.hasher.Size(), data); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %v", err)
+	}
+	tw.published = tw.size
+	tw.exp.treeSize.Set(tw.size)
+	return tw, nil
+}
+
+// Start starts a goroutine that updates the tiles straight away, and then every interval
+// until Stop is called.
+func (tw *tileWriter) Start(interval time.Duration) {
+	go func() {
+		if err := tw.update(); err != nil {
+			glog.Warningf("%s: failed to update tiles: %v", tw.c.logPrefix, err)
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-tw.done:
+				return
+			case <-ticker.C:
+				if err := tw.update(); err != nil {
+					glog.Warningf("%s: failed to update tiles: %v", tw.c.logPrefix, err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops updating the tiles.
+func (tw *tileWriter) Stop() {
+	close(tw.done)
+}
+
+// Vars returns the statistics exported by this tileWriter.
+func (tw *tileWriter) Vars() *expvar.Map {
+	return tw.exp.vars
+}
+
+// update brings the tiles up to date with the latest tree head, and publishes it as the
+// checkpoint.
+func (tw *tileWriter) update() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.exp.updates.Add(1)
+
+	err := tw.updateLocked()
+	if err != nil {
+		tw.exp.failures.Add(1)
+		// The tiles beyond the checkpoint may be bad, so start again from there.
+		tw.size = tw.published
+	}
+	return err
+}
+
+func (tw *tileWriter) updateLocked() error {
+	ctx, cancel := context.WithTimeout(context.Background(), tw.c.rpcDeadline)
+	slr, err := getLatestLogRoot(ctx, tw.c, "TileWriter")
+	cancel()
+	if err != nil {
+		return err
+	}
+	if slr.TreeSize < tw.size {
+		return fmt.Errorf("tree size %d from backend is smaller than the tiled size %d", slr.TreeSize, tw.size)
+	}
+
+	// Even if the tree hasn't grown the checkpoint is rewritten, as the tree head is
+	// fresher.
+	var levels []tileLevel
+	for {
+		end := tw.size + tw.batchSize
+		if end > slr.TreeSize {
+			end = slr.TreeSize
+		}
+		if levels, err = tw.writeTiles(tw.size, end); err != nil {
+			return err
+		}
+		tw.size = end
+		if end == slr.TreeSize {
+			break
+		}
+	}
+
+	if root := tw.rootHash(levels, slr.TreeSize); !bytes.Equal(root, slr.RootHash) {
+		return fmt.Errorf("root hash from tiles for tree size %d is %x, tree head has %x", slr.TreeSize, root, slr.RootHash)
+	}
+	data, err := signCheckpoint(tw.c, *slr)
+	if err != nil {
+		return err
+	}
+	if err := tw.store.Put(checkpointPath, data); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	tw.published = slr.TreeSize
+	tw.exp.treeSize.Set(tw.published)
+	return nil
+}
+
+// writeTiles writes the entry bundles and hash tiles for the entries in [start, end),
+// and returns the hashes at each level of the tree from the tile that held start.
+func (tw *tileWriter) writeTiles(start, end int64) ([]tileLevel, error) {
+	width := int64(1) << tw.height
+
+	// The partial entry bundle is extended with the new entries.
+	var bundle []byte
+	if partial := start % width; partial > 0 {
+		var err error
+		if bundle, err = tw.store.Get(tilePath(-1, start/width, int(partial))); err != nil {
+			return nil, fmt.Errorf("failed to read partial entry bundle: %v", err)
+		}
+	}
+	var hashes [][]byte
+	for first := start; first < end; first += width - first%width {
+		last := first + width - first%width - 1
+		if last >= end {
+			last = end - 1
+		}
+		leaves, err := tw.getLeaves(first, last)
+		if err != nil {
+			return nil, err
+		}
+		for _, leaf := range leaves {
+			entry, err := tw.tileLeaf(leaf)
+			if err != nil {
+				return nil, fmt.Errorf("failed to build entry for leaf %d: %v", leaf.LeafIndex, err)
+			}
+			bundle = append(bundle, entry...)
+			hashes = append(hashes, tw.hasher.HashLeaf(leaf.LeafValue))
+		}
+		if err := tw.store.Put(tilePath(-1, first/width, int((last+1)%width)), bundle); err != nil {
+			return nil, fmt.Errorf("failed to write entry bundle: %v", err)
+		}
+		bundle = nil
+	}
+
+	// At each level the hashes of the new nodes are appended to the partial tile, and
+	// each tile filled gives a new node on the level above.
+	var levels []tileLevel
+	for level := 0; end>>(uint(level)*tw.height) > 0; level++ {
+		shift := uint(level) * tw.height
+		next := start >> shift
+		tile := next / width
+		l := tileLevel{first: tile * width}
+		if partial := next % width; partial > 0 {
+			data, err := tw.store.Get(tilePath(level, tile, int(partial)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read partial tile at level %d: %v", level, err)
+			}
+			if int64(len(data)) != partial*sha256.Size {
+				return nil, fmt.Errorf("partial tile at level %d has %d bytes, want %d", level, len(data), partial*sha256.Size)
+			}
+			for i := 0; i < len(data); i += sha256.Size {
+				l.hashes = append(l.hashes, data[i:i+sha256.Size])
+			}
+		}
+		l.hashes = append(l.hashes, hashes...)
+		if got, want := l.first+int64(len(l.hashes)), end>>shift; got != want {
+			return nil, fmt.Errorf("level %d has %d nodes, want %d", level, got, want)
+		}
+
+		hashes = nil
+		for i := int64(0); i < int64(len(l.hashes)); i += width {
+			tileHashes := l.hashes[i:]
+			if int64(len(tileHashes)) >= width {
+				tileHashes = tileHashes[:width]
+				hashes = append(hashes, rootFromSubtrees(tw.hasher, tileHashes, 1))
+			}
+			// Only the first tile can have been written already, if it has no new nodes.
+			if i == 0 && int64(len(tileHashes)) == next%width {
+				continue
+			}
+			if err := tw.store.Put(tilePath(level, tile+i/width, len(tileHashes)%int(width)), bytes.Join(tileHashes, nil)); err != nil {
+				return nil, fmt.Errorf("failed to write tile at level %d: %v", level, err)
+			}
+		}
+		levels = append(levels, l)
+	}
+	return levels, nil
+}
+
+// getLeaves fetches the leaves in [start, end] from the backend, in order.
+func (tw *tileWriter) getLeaves(start, end int64) ([]*trillian.LogLeaf, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tw.c.rpcDeadline)
+	defer cancel()
+	req := trillian.GetLeavesByIndexRequest{LogId: tw.c.logID, LeafIndex: buildIndicesForRange(start, end)}
+	rsp, err := tw.c.rpcClient.GetLeavesByIndex(ctx, &req)
+	if err != nil {
+		return nil, fmt.Errorf("backend GetLeavesByIndex request failed: %v", err)
+	}
+	if !rpcStatusOK(rsp.GetStatus()) {
+		return nil, fmt.Errorf("backend GetLeavesByIndex request failed, status=%v", rsp.GetStatus())
+	}
+	if err := sortLeafRange(rsp, start, end); err != nil {
+		return nil, fmt.Errorf("backend leaf range invalid: %v", err)
+	}
+	if got, want := int64(len(rsp.Leaves)), end-start+1; got != want {
+		return nil, fmt.Errorf("backend returned %d leaves for [%d,%d], want %d", got, start, end, want)
+	}
+	return rsp.Leaves, nil
+}
+
+// tileLeaf builds the entry bundle entry for a leaf: its TimestampedEntry, then for a
+// precertificate the precertificate itself, and then the fingerprints of the chain. Any
+// issuers not already in the store are written to it.
+func (tw *tileWriter) tileLeaf(leaf *trillian.LogLeaf) ([]byte, error) {
+	var merkleLeaf ct.MerkleTreeLeaf
+	if rest, err := tls.Unmarshal(leaf.LeafValue, &merkleLeaf); err != nil {
+		return nil, fmt.Errorf("failed to deserialize Merkle leaf: %v", err)
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("trailing data after Merkle leaf")
+	}
+	if merkleLeaf.TimestampedEntry == nil {
+		return nil, fmt.Errorf("leaf has no timestamped entry")
+	}
+	entry, err := tls.Marshal(*merkleLeaf.TimestampedEntry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize timestamped entry: %v", err)
+	}
+
+	var chain []ct.ASN1Cert
+	switch merkleLeaf.TimestampedEntry.EntryType {
+	case ct.X509LogEntryType:
+		var certChain ct.CertificateChain
+		if rest, err := tls.Unmarshal(leaf.ExtraData, &certChain); err != nil || len(rest) > 0 {
+			return nil, fmt.Errorf("failed to deserialize certificate chain: %v", err)
+		}
+		chain = certChain.Entries
+	case ct.PrecertLogEntryType:
+		var precertChain ct.PrecertChainEntry
+		if rest, err := tls.Unmarshal(leaf.ExtraData, &precertChain); err != nil || len(rest) > 0 {
+			return nil, fmt.Errorf("failed to deserialize precertificate chain: %v", err)
+		}
+		precert, err := tls.Marshal(precertChain.PreCertificate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize precertificate: %v", err)
+		}
+		entry = append(entry, precert...)
+		chain = precertChain.CertificateChain
+	default:
+		return nil, fmt.Errorf("unknown entry type: %v", merkleLeaf.TimestampedEntry.EntryType)
+	}
+
+	var fingerprints tileChain
+	for _, cert := range chain {
+		fingerprint := sha256.Sum256(cert.Data)
+		if !tw.issuers[fingerprint] {
+			if err := tw.store.Put(issuerPath(fingerprint), cert.Data); err != nil {
+				return nil, fmt.Errorf("failed to write issuer: %v", err)
+			}
+			tw.issuers[fingerprint] = true
+		}
+		fingerprints.Fingerprints = append(fingerprints.Fingerprints, fingerprint)
+	}
+	data, err := tls.Marshal(fingerprints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize chain fingerprints: %v", err)
+	}
+	return append(entry, data...), nil
+}
+
+// rootHash calculates the root hash of the tree of size from the hashes returned by
+// writeTiles. Each level supplies the nodes to the right of those covered by the level
+// above.
+func (tw *tileWriter) rootHash(levels []tileLevel, size int64) []byte {
+	if size == 0 {
+		return tw.hasher.HashEmpty()
+	}
+	var hashes [][]byte
+	var sizes []int64
+	for level := len(levels) - 1; level >= 0; level-- {
+		shift := uint(level) * tw.height
+		l := levels[level]
+		for i := (size >> (shift + tw.height)) << tw.height; i < size>>shift; i++ {
+			hashes = append(hashes, l.hashes[i-l.first])
+			sizes = append(sizes, int64(1)<<shift)
+		}
+	}
+	return rootFromSubtreesOfSizes(tw.hasher, hashes, sizes)
+}
+
+// rootFromSubtrees returns the root hash of a tree made of the perfect subtrees with the
+// given hashes, each holding size leaves.
+func rootFromSubtrees(hasher merkle.TreeHasher, hashes [][]byte, size int64) []byte {
+	sizes := make([]int64, len(hashes))
+	for i := range sizes {
+		sizes[i] = size
+	}
+	return rootFromSubtreesOfSizes(hasher, hashes, sizes)
+}
+
+// rootFromSubtreesOfSizes returns the root hash of a tree made of perfect subtrees,
+// whose sizes are powers of two in non-increasing order. As each size divides the
+// previous ones, the RFC 6962 split point always falls between subtrees.
+func rootFromSubtreesOfSizes(hasher merkle.TreeHasher, hashes [][]byte, sizes []int64) []byte {
+	if len(hashes) == 1 {
+		return hashes[0]
+	}
+	var total int64
+	for _, s := range sizes {
+		total += s
+	}
+	split := int64(1)
+	for split<<1 < total {
+		split <<= 1
+	}
+	var left int64
+	i := 0
+	for left < split {
+		left += sizes[i]
+		i++
+	}
+	return hasher.HashChildren(rootFromSubtreesOfSizes(hasher, hashes[:i], sizes[:i]), rootFromSubtreesOfSizes(hasher, hashes[i:], sizes[i:]))
+}
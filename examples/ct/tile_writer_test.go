@@ -0,0 +1,291 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"sync"
+	"testing"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/examples/ct/testonly"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// memTileStore is a TileStore that keeps the files in memory.
+type memTileStore struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func newMemTileStore() *memTileStore {
+	return &memTileStore{files: make(map[string][]byte)}
+}
+
+func (s *memTileStore) Get(path string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
+func (s *memTileStore) Put(path string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[path] = append([]byte(nil), data...)
+	return nil
+}
+
+// fakeTreeClient serves the first size of a list of leaves from the backend, and a tree
+// head with root.
+type fakeTreeClient struct {
+	trillian.TrillianLogClient
+	leaves []*trillian.LogLeaf
+	size   int64
+	root   []byte
+}
+
+func (f *fakeTreeClient) GetLatestSignedLogRoot(ctx context.Context, req *trillian.GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*trillian.GetLatestSignedLogRootResponse, error) {
+	return makeGetRootResponseForTest(12345000000, f.size, f.root), nil
+}
+
+func (f *fakeTreeClient) GetLeavesByIndex(ctx context.Context, req *trillian.GetLeavesByIndexRequest, opts ...grpc.CallOption) (*trillian.GetLeavesByIndexResponse, error) {
+	rsp := &trillian.GetLeavesByIndexResponse{Status: okStatus}
+	for _, index := range req.LeafIndex {
+		if index < f.size && index < int64(len(f.leaves)) {
+			rsp.Leaves = append(rsp.Leaves, f.leaves[index])
+		}
+	}
+	return rsp, nil
+}
+
+// setSize makes the tree hold the first size leaves, with the correct root hash.
+func (f *fakeTreeClient) setSize(size int64) {
+	tree := merkle.NewInMemoryMerkleTree(merkle.NewRFC6962TreeHasher(crypto.NewSHA256()))
+	for _, leaf := range f.leaves[:size] {
+		tree.AddLeaf(leaf.LeafValue)
+	}
+	f.size = size
+	f.root = tree.CurrentRoot().Hash()
+}
+
+// makeTileTestLeaves returns n distinct certificate leaves, alternately with and without
+// an intermediate in the chain.
+func makeTileTestLeaves(t *testing.T, n int) []*trillian.LogLeaf {
+	pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+	chain := pool.RawCertificates()
+	var leaves []*trillian.LogLeaf
+	for i := 0; i < n; i++ {
+		merkleLeaf := ct.MerkleTreeLeaf{
+			Version:  ct.V1,
+			LeafType: ct.TimestampedEntryLeafType,
+			TimestampedEntry: &ct.TimestampedEntry{
+				Timestamp: uint64(1000 + i),
+				EntryType: ct.X509LogEntryType,
+				X509Entry: &ct.ASN1Cert{Data: chain[0].Raw},
+			},
+		}
+		leafData, err := tls.Marshal(merkleLeaf)
+		if err != nil {
+			t.Fatalf("failed to marshal leaf: %v", err)
+		}
+		extraData, err := extraDataForChain(chain[:1+i%2], false)
+		if err != nil {
+			t.Fatalf("failed to marshal chain: %v", err)
+		}
+		leaves = append(leaves, &trillian.LogLeaf{LeafIndex: int64(i), LeafValue: leafData, ExtraData: extraData})
+	}
+	return leaves
+}
+
+// checkTiles checks the tiles in store for the first size leaves.
+func checkTiles(t *testing.T, store *memTileStore, height uint, leaves []*trillian.LogLeaf, size int64) {
+	hasher := merkle.NewRFC6962TreeHasher(crypto.NewSHA256())
+	width := int64(1) << height
+
+	data, err := store.Get(checkpointPath)
+	if err != nil {
+		t.Fatalf("size %d: failed to read checkpoint: %v", size, err)
+	}
+	checkpointSize, _, err := parseCheckpoint(testCheckpointOrigin, sha256.Size, data)
+	if err != nil {
+		t.Fatalf("size %d: failed to parse checkpoint: %v", size, err)
+	}
+	if checkpointSize != size {
+		t.Errorf("checkpoint tree size=%d, want %d", checkpointSize, size)
+	}
+
+	// Each entry bundle holds the entries in order, and the hashes of the leaves are
+	// in the level 0 tiles. The hashes in each level above are those of the full tiles
+	// below.
+	var hashes [][]byte
+	for i := int64(0); i < size; i += width {
+		n := size - i
+		if n > width {
+			n = width
+		}
+		bundle, err := store.Get(tilePath(-1, i/width, int(n%width)))
+		if err != nil {
+			t.Fatalf("size %d: failed to read entry bundle %d: %v", size, i/width, err)
+		}
+		for j := i; j < i+n; j++ {
+			var entry ct.TimestampedEntry
+			rest, err := tls.Unmarshal(bundle, &entry)
+			if err != nil {
+				t.Fatalf("size %d: failed to parse entry %d: %v", size, j, err)
+			}
+			if got, want := entry.Timestamp, uint64(1000+j); got != want {
+				t.Errorf("size %d: entry %d has timestamp %d, want %d", size, j, got, want)
+			}
+			var chain tileChain
+			if bundle, err = tls.Unmarshal(rest, &chain); err != nil {
+				t.Fatalf("size %d: failed to parse chain of entry %d: %v", size, j, err)
+			}
+			if got, want := len(chain.Fingerprints), int(j%2); got != want {
+				t.Errorf("size %d: entry %d has %d issuers, want %d", size, j, got, want)
+			}
+			for _, fingerprint := range chain.Fingerprints {
+				issuer, err := store.Get(issuerPath(fingerprint))
+				if err != nil || sha256.Sum256(issuer) != fingerprint {
+					t.Errorf("size %d: issuer %x missing or wrong: %v", size, fingerprint, err)
+				}
+			}
+			hashes = append(hashes, hasher.HashLeaf(leaves[j].LeafValue))
+		}
+		if len(bundle) > 0 {
+			t.Errorf("size %d: entry bundle %d has %d trailing bytes", size, i/width, len(bundle))
+		}
+	}
+	for level := 0; len(hashes) > 0; level++ {
+		var next [][]byte
+		for i := 0; i < len(hashes); i += int(width) {
+			tileHashes := hashes[i:]
+			if len(tileHashes) >= int(width) {
+				tileHashes = tileHashes[:width]
+				next = append(next, rootFromSubtrees(hasher, tileHashes, 1))
+			}
+			got, err := store.Get(tilePath(level, int64(i)/width, len(tileHashes)%int(width)))
+			if err != nil {
+				t.Fatalf("size %d: failed to read tile %d at level %d: %v", size, int64(i)/width, level, err)
+			}
+			if want := bytes.Join(tileHashes, nil); !bytes.Equal(got, want) {
+				t.Errorf("size %d: tile %d at level %d=%x, want %x", size, int64(i)/width, level, got, want)
+			}
+		}
+		hashes = next
+	}
+}
+
+func TestTileWriter(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	info.c.checkpointSigner = testNoteSigner(t)
+
+	leaves := makeTileTestLeaves(t, 90)
+	client := &fakeTreeClient{leaves: leaves}
+	info.c.rpcClient = client
+	store := newMemTileStore()
+	tw, err := newTileWriter(info.c, store)
+	if err != nil {
+		t.Fatalf("newTileWriter()=_,%v, want no error", err)
+	}
+	// Small tiles and batches, so a small tree has several levels.
+	tw.height = 2
+	tw.batchSize = 7
+
+	for _, size := range []int64{0, 1, 3, 3, 4, 17, 64, 65, 90} {
+		client.setSize(size)
+		if err := tw.update(); err != nil {
+			t.Fatalf("update() at size %d=%v, want no error", size, err)
+		}
+		checkTiles(t, store, tw.height, leaves, size)
+	}
+
+	// A new writer carries on from the checkpoint.
+	tw, err = newTileWriter(info.c, store)
+	if err != nil {
+		t.Fatalf("newTileWriter()=_,%v, want no error", err)
+	}
+	if got, want := tw.size, int64(90); got != want {
+		t.Errorf("newTileWriter().size=%d, want %d", got, want)
+	}
+}
+
+func TestTileWriterRootMismatch(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	info.c.checkpointSigner = testNoteSigner(t)
+
+	leaves := makeTileTestLeaves(t, 20)
+	client := &fakeTreeClient{leaves: leaves}
+	info.c.rpcClient = client
+	store := newMemTileStore()
+	tw, err := newTileWriter(info.c, store)
+	if err != nil {
+		t.Fatalf("newTileWriter()=_,%v, want no error", err)
+	}
+	tw.height = 2
+
+	client.setSize(5)
+	if err := tw.update(); err != nil {
+		t.Fatalf("update()=%v, want no error", err)
+	}
+
+	// A tree head that doesn't match the leaves isn't published, and the tiles for it
+	// are written again next time.
+	client.setSize(12)
+	client.root = bytes.Repeat([]byte{0xff}, sha256.Size)
+	if err := tw.update(); err == nil {
+		t.Error("update() with bad root=nil, want error")
+	}
+	if got, want := tw.size, int64(5); got != want {
+		t.Errorf("tileWriter.size after failure=%d, want %d", got, want)
+	}
+	checkTiles(t, store, tw.height, leaves, 5)
+
+	client.setSize(12)
+	if err := tw.update(); err != nil {
+		t.Fatalf("update()=%v, want no error", err)
+	}
+	checkTiles(t, store, tw.height, leaves, 12)
+}
+
+func TestTileWriterBackendErrors(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	info.c.checkpointSigner = testNoteSigner(t)
+
+	leaves := makeTileTestLeaves(t, 10)
+	client := &fakeTreeClient{leaves: leaves}
+	info.c.rpcClient = client
+	store := newMemTileStore()
+	tw, err := newTileWriter(info.c, store)
+	if err != nil {
+		t.Fatalf("newTileWriter()=_,%v, want no error", err)
+	}
+
+	// The backend claims leaves it doesn't return.
+	client.setSize(10)
+	client.size = 11
+	if err := tw.update(); err == nil {
+		t.Error("update() with missing leaves=nil, want error")
+	}
+	if _, err := store.Get(checkpointPath); !os.IsNotExist(err) {
+		t.Errorf("checkpoint written after failed update: %v", err)
+	}
+
+	// The tree can't shrink.
+	tw.size, tw.published = 10, 10
+	client.setSize(5)
+	if err := tw.update(); err == nil {
+		t.Error("update() with smaller tree=nil, want error")
+	}
+}
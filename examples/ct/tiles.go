@@ -0,0 +1,254 @@
+package ct
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// The static read API serves a log's Merkle tree as tiles, in the layout of the static
+// CT API: hash tiles under tile/<level>/, entry bundles under tile/data/, the issuers
+// of logged certificates under issuer/, and the signed checkpoint the tiles were last
+// written for in checkpoint, which is served at CheckpointPath. All the files except
+// the checkpoint and partial tiles are immutable, so monitors can fetch them through
+// caches rather than making get-entries and proof requests to the log.
+
+const (
+	// TilePathPrefix is the prefix of hash tiles and entry bundles, relative to a log's prefix.
+	TilePathPrefix = "/tile/"
+	// TileIssuerPathPrefix is the prefix of the issuer certificates, relative to a log's prefix.
+	TileIssuerPathPrefix = "/issuer/"
+	// Number of levels of the tree held in a tile, and so of hashes in a full tile is 2^8
+	defaultTileHeight = 8
+	// Cache-Control for files that never change once written
+	immutableCacheControl = "public, max-age=31536000, immutable"
+	// Cache-Control for the checkpoint and partial tiles, which are replaced as the tree grows
+	mutableCacheControl = "no-cache"
+	// HTTP cache control header
+	cacheControlHeader = "Cache-Control"
+)
+
+// TileEntrypoints is a list of the static read API entrypoint names as exposed in statistics.
+var TileEntrypoints = []string{"GetTile", "GetIssuer"}
+
+// TileStore holds the files of a log's static read API. It can be a local directory, or
+// an object store from InstanceOptions.TileStoreFactories.
+type TileStore interface {
+	// Get returns the contents of the file at path, a slash separated relative path, or
+	// an error satisfying os.IsNotExist if there's no such file.
+	Get(path string) ([]byte, error)
+	// Put creates or replaces the file at path. Readers must see either the old or the
+	// new contents, never a partially written file.
+	Put(path string, data []byte) error
+}
+
+// TileStoreFactory creates a TileStore from the location in LogConfig.TileStore.
+type TileStoreFactory func(location *url.URL) (TileStore, error)
+
+// newTileStore creates the store at location, which is either a local directory or a
+// URL whose scheme is a key in custom. file:// URLs are also local directories.
+func newTileStore(location string, custom map[string]TileStoreFactory) (TileStore, error) {
+	if !strings.Contains(location, "://") {
+		return NewDirTileStore(location), nil
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tile store location: %v", err)
+	}
+	if factory, ok := custom[u.Scheme]; ok {
+		return factory(u)
+	}
+	if u.Scheme == "file" {
+		return NewDirTileStore(u.Path), nil
+	}
+	return nil, fmt.Errorf("unknown tile store scheme %q", u.Scheme)
+}
+
+// DirTileStore is a TileStore that keeps the files in a local directory.
+type DirTileStore struct {
+	dir string
+}
+
+// NewDirTileStore returns a TileStore that keeps the files under dir.
+func NewDirTileStore(dir string) *DirTileStore {
+	return &DirTileStore{dir: dir}
+}
+
+// Get returns the contents of the file at path.
+func (s *DirTileStore) Get(path string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(s.dir, filepath.FromSlash(path)))
+}
+
+// Put writes the file at path via a temporary file, which is renamed into place so that
+// it's replaced atomically.
+func (s *DirTileStore) Put(path string, data []byte) error {
+	name := filepath.Join(s.dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(name), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// tilePath returns the path of a tile, relative to the store. level is a tree level, or
+// -1 for an entry bundle. width is the number of entries in a partial tile, or zero for
+// a full one. The index is split into groups of three digits, all but the last of which
+// are prefixed with x, so that no directory holds more than a thousand entries.
+func tilePath(level int, index int64, width int) string {
+	levelName := "data"
+	if level >= 0 {
+		levelName = strconv.Itoa(level)
+	}
+	n := fmt.Sprintf("%03d", index%1000)
+	for index >= 1000 {
+		index /= 1000
+		n = fmt.Sprintf("x%03d/%s", index%1000, n)
+	}
+	p := fmt.Sprintf("tile/%s/%s", levelName, n)
+	if width > 0 {
+		p += fmt.Sprintf(".p/%d", width)
+	}
+	return p
+}
+
+// tilePathRE matches the paths made by tilePath.
+var tilePathRE = regexp.MustCompile(`^tile/(data|[0-9]+)/((?:x[0-9]{3}/)*[0-9]{3})(?:\.p/([0-9]+))?$`)
+
+// parseTilePath checks that p is a tile path as made by tilePath, with a tile width of
+// at most maxWidth, and returns whether it's a partial tile.
+func parseTilePath(p string, maxWidth int) (bool, error) {
+	m := tilePathRE.FindStringSubmatch(p)
+	if m == nil {
+		return false, fmt.Errorf("malformed tile path %q", p)
+	}
+	level := -1
+	if m[1] != "data" {
+		var err error
+		if level, err = strconv.Atoi(m[1]); err != nil || level > 63 {
+			return false, fmt.Errorf("bad tile level in %q", p)
+		}
+	}
+	var index int64
+	for _, group := range strings.Split(m[2], "/") {
+		n, err := strconv.ParseInt(strings.TrimPrefix(group, "x"), 10, 64)
+		if err != nil || index > (1<<62)/1000 {
+			return false, fmt.Errorf("bad tile index in %q", p)
+		}
+		index = index*1000 + n
+	}
+	width := 0
+	if len(m[3]) > 0 {
+		var err error
+		if width, err = strconv.Atoi(m[3]); err != nil || width <= 0 || width >= maxWidth {
+			return false, fmt.Errorf("bad partial tile width in %q", p)
+		}
+	}
+	// Only canonical paths are accepted, so each tile has a single name.
+	if tilePath(level, index, width) != p {
+		return false, fmt.Errorf("non-canonical tile path %q", p)
+	}
+	return width > 0, nil
+}
+
+// issuerPath returns the path of an issuer certificate, named by the hex encoded SHA-256
+// hash of its DER encoding.
+func issuerPath(fingerprint [32]byte) string {
+	return "issuer/" + hex.EncodeToString(fingerprint[:])
+}
+
+// registerTileHandlers registers a HandleFunc for each of the static read API paths.
+func (c LogContext) registerTileHandlers(prefix string) {
+	http.Handle(prefix+TilePathPrefix, appHandler{context: c, handler: getTile, name: "GetTile", method: http.MethodGet})
+	http.Handle(prefix+TileIssuerPathPrefix, appHandler{context: c, handler: getIssuer, name: "GetIssuer", method: http.MethodGet})
+}
+
+func getTile(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	if c.tiles == nil {
+		return http.StatusNotFound, errors.New("log has no tiles")
+	}
+	p, err := tileRequestPath(c, r, TilePathPrefix)
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	partial, err := parseTilePath(p, 1<<uint(c.tiles.height))
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	cacheControl := immutableCacheControl
+	if partial {
+		cacheControl = mutableCacheControl
+	}
+	return serveTileFile(c, w, p, "application/octet-stream", cacheControl)
+}
+
+func getIssuer(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	p, err := tileRequestPath(c, r, TileIssuerPathPrefix)
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	name := strings.TrimPrefix(p, "issuer/")
+	if fingerprint, err := hex.DecodeString(name); err != nil || len(fingerprint) != 32 || hex.EncodeToString(fingerprint) != name {
+		return http.StatusNotFound, fmt.Errorf("malformed issuer path %q", p)
+	}
+	return serveTileFile(c, w, p, "application/pkix-cert", immutableCacheControl)
+}
+
+// tileRequestPath returns the path of the file requested in r relative to the log's tile
+// store, e.g. tile/0/001 for a request to <log prefix>/tile/0/001.
+func tileRequestPath(c LogContext, r *http.Request, pathPrefix string) (string, error) {
+	logPrefix := "/" + strings.Trim(c.urlPrefix, "/")
+	if logPrefix == "/" {
+		logPrefix = ""
+	}
+	p := strings.TrimPrefix(r.URL.Path, logPrefix)
+	if !strings.HasPrefix(p, pathPrefix) || path.Clean(p) != p {
+		return "", fmt.Errorf("malformed path %q", r.URL.Path)
+	}
+	return strings.TrimPrefix(p, "/"), nil
+}
+
+// serveTileFile writes the file at p in the log's tile store to w.
+func serveTileFile(c LogContext, w http.ResponseWriter, p, contentType, cacheControl string) (int, error) {
+	if c.tiles == nil {
+		return http.StatusNotFound, errors.New("log has no tiles")
+	}
+	data, err := c.tiles.store.Get(p)
+	if os.IsNotExist(err) {
+		return http.StatusNotFound, fmt.Errorf("no such file %s", p)
+	} else if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to read %s: %v", p, err)
+	}
+	w.Header().Set(contentTypeHeader, contentType)
+	w.Header().Set(cacheControlHeader, cacheControl)
+	if _, err := w.Write(data); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to write response data: %v", err)
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,222 @@
+package ct
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTilePath(t *testing.T) {
+	var tests = []struct {
+		level int
+		index int64
+		width int
+		want  string
+	}{
+		{level: 0, index: 0, want: "tile/0/000"},
+		{level: 0, index: 5, width: 17, want: "tile/0/005.p/17"},
+		{level: 2, index: 999, want: "tile/2/999"},
+		{level: 1, index: 1000, want: "tile/1/x001/000"},
+		{level: -1, index: 1234067, want: "tile/data/x001/x234/067"},
+		{level: -1, index: 1234067, width: 255, want: "tile/data/x001/x234/067.p/255"},
+	}
+	for _, test := range tests {
+		if got := tilePath(test.level, test.index, test.width); got != test.want {
+			t.Errorf("tilePath(%d, %d, %d)=%q, want %q", test.level, test.index, test.width, got, test.want)
+		}
+	}
+}
+
+func TestParseTilePath(t *testing.T) {
+	var tests = []struct {
+		path        string
+		wantPartial bool
+		wantErr     bool
+	}{
+		{path: "tile/0/000"},
+		{path: "tile/3/x001/x234/067"},
+		{path: "tile/data/x001/x234/067"},
+		{path: "tile/data/012.p/255", wantPartial: true},
+		{path: "tile/0/012.p/1", wantPartial: true},
+		{path: "tile/0/012.p/0", wantErr: true},
+		{path: "tile/0/012.p/256", wantErr: true},
+		{path: "tile/0/012.p/01", wantErr: true},
+		{path: "tile/0/12", wantErr: true},
+		{path: "tile/0/x000/012", wantErr: true},
+		{path: "tile/01/000", wantErr: true},
+		{path: "tile/64/000", wantErr: true},
+		{path: "tile/data/../000", wantErr: true},
+		{path: "tile/entries/000", wantErr: true},
+		{path: "tile/0/000/", wantErr: true},
+		{path: "checkpoint", wantErr: true},
+	}
+	for _, test := range tests {
+		partial, err := parseTilePath(test.path, 256)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("parseTilePath(%q)=_,%v, want error: %v", test.path, err, test.wantErr)
+			continue
+		}
+		if partial != test.wantPartial {
+			t.Errorf("parseTilePath(%q)=%v, want %v", test.path, partial, test.wantPartial)
+		}
+	}
+}
+
+func TestDirTileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tiles")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewDirTileStore(dir)
+	if _, err := store.Get("tile/0/000"); !os.IsNotExist(err) {
+		t.Errorf("Get(missing)=_,%v, want not exist error", err)
+	}
+	for _, data := range []string{"first", "second"} {
+		if err := store.Put("tile/0/000", []byte(data)); err != nil {
+			t.Fatalf("Put()=%v, want no error", err)
+		}
+		got, err := store.Get("tile/0/000")
+		if err != nil {
+			t.Fatalf("Get()=_,%v, want no error", err)
+		}
+		if string(got) != data {
+			t.Errorf("Get()=%q, want %q", got, data)
+		}
+	}
+	// Only the file itself is left, the temporary one has been renamed.
+	files, err := ioutil.ReadDir(filepath.Join(dir, "tile", "0"))
+	if err != nil {
+		t.Fatalf("failed to read tile dir: %v", err)
+	}
+	if got, want := len(files), 1; got != want {
+		t.Errorf("tile dir has %d files, want %d", got, want)
+	}
+}
+
+func TestNewTileStore(t *testing.T) {
+	custom := newMemTileStore()
+	factories := map[string]TileStoreFactory{
+		"mem": func(u *url.URL) (TileStore, error) { return custom, nil },
+	}
+	var tests = []struct {
+		location string
+		wantDir  string
+		wantErr  bool
+	}{
+		{location: "/var/ct/tiles", wantDir: "/var/ct/tiles"},
+		{location: "tiles", wantDir: "tiles"},
+		{location: "file:///var/ct/tiles", wantDir: "/var/ct/tiles"},
+		{location: "mem://bucket/prefix"},
+		{location: "gs://bucket/prefix", wantErr: true},
+	}
+	for _, test := range tests {
+		store, err := newTileStore(test.location, factories)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("newTileStore(%q)=_,%v, want error: %v", test.location, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(test.wantDir) == 0 {
+			if store != custom {
+				t.Errorf("newTileStore(%q)=%v, want the custom store", test.location, store)
+			}
+			continue
+		}
+		if dirStore, ok := store.(*DirTileStore); !ok || dirStore.dir != test.wantDir {
+			t.Errorf("newTileStore(%q)=%+v, want a DirTileStore for %s", test.location, store, test.wantDir)
+		}
+	}
+}
+
+func TestTileHandlers(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	store := newMemTileStore()
+	store.Put("tile/0/000.p/3", []byte("partial"))
+	store.Put("tile/data/x001/000", []byte("full"))
+	store.Put("issuer/"+fakeFingerprint, []byte("cert"))
+	info.c.tiles = &tileWriter{store: store, height: defaultTileHeight}
+
+	var tests = []struct {
+		name             string
+		handler          appHandler
+		path             string
+		want             int
+		wantBody         string
+		wantCacheControl string
+	}{
+		{
+			name:             "partial-tile",
+			handler:          appHandler{context: info.c, handler: getTile, name: "GetTile", method: http.MethodGet},
+			path:             "/test/tile/0/000.p/3",
+			want:             http.StatusOK,
+			wantBody:         "partial",
+			wantCacheControl: mutableCacheControl,
+		},
+		{
+			name:             "full-bundle",
+			handler:          appHandler{context: info.c, handler: getTile, name: "GetTile", method: http.MethodGet},
+			path:             "/test/tile/data/x001/000",
+			want:             http.StatusOK,
+			wantBody:         "full",
+			wantCacheControl: immutableCacheControl,
+		},
+		{
+			name:    "missing-tile",
+			handler: appHandler{context: info.c, handler: getTile, name: "GetTile", method: http.MethodGet},
+			path:    "/test/tile/0/001",
+			want:    http.StatusNotFound,
+		},
+		{
+			name:    "bad-tile-path",
+			handler: appHandler{context: info.c, handler: getTile, name: "GetTile", method: http.MethodGet},
+			path:    "/test/tile/0/../../checkpoint",
+			want:    http.StatusNotFound,
+		},
+		{
+			name:             "issuer",
+			handler:          appHandler{context: info.c, handler: getIssuer, name: "GetIssuer", method: http.MethodGet},
+			path:             "/test/issuer/" + fakeFingerprint,
+			want:             http.StatusOK,
+			wantBody:         "cert",
+			wantCacheControl: immutableCacheControl,
+		},
+		{
+			name:    "bad-issuer",
+			handler: appHandler{context: info.c, handler: getIssuer, name: "GetIssuer", method: http.MethodGet},
+			path:    "/test/issuer/1234",
+			want:    http.StatusNotFound,
+		},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest(http.MethodGet, "http://example.com"+test.path, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		test.handler.ServeHTTP(w, req)
+		if got := w.Code; got != test.want {
+			t.Errorf("%s: GET %s=%d, want %d", test.name, test.path, got, test.want)
+			continue
+		}
+		if test.want != http.StatusOK {
+			continue
+		}
+		if got := w.Body.String(); got != test.wantBody {
+			t.Errorf("%s: GET %s body=%q, want %q", test.name, test.path, got, test.wantBody)
+		}
+		if got := w.Header().Get(cacheControlHeader); got != test.wantCacheControl {
+			t.Errorf("%s: GET %s Cache-Control=%q, want %q", test.name, test.path, got, test.wantCacheControl)
+		}
+	}
+}
+
+const fakeFingerprint = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
@@ -0,0 +1,56 @@
+package ct
+
+import (
+	gocrypto "crypto"
+	_ "crypto/sha256" // Register the SHA-256 algorithm
+	_ "crypto/sha512" // Register the SHA-384 and SHA-512/256 algorithms
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultTreeHashAlgorithm is the hash algorithm of a log's tree if its config doesn't
+// say. It's the only one RFC 6962 allows.
+const defaultTreeHashAlgorithm = "SHA256"
+
+// treeHashAlgorithms are the hash algorithms the backend can build a log's tree with, by
+// their names in LogConfig.TreeHashAlgorithm.
+var treeHashAlgorithms = map[string]gocrypto.Hash{
+	"SHA256":     gocrypto.SHA256,
+	"SHA384":     gocrypto.SHA384,
+	"SHA512_256": gocrypto.SHA512_256,
+}
+
+// parseTreeHashAlgorithm returns the hash algorithm called name, or SHA-256 if name is
+// empty.
+func parseTreeHashAlgorithm(name string) (gocrypto.Hash, error) {
+	if len(name) == 0 {
+		name = defaultTreeHashAlgorithm
+	}
+	hash, ok := treeHashAlgorithms[name]
+	if !ok {
+		names := make([]string, 0, len(treeHashAlgorithms))
+		for n := range treeHashAlgorithms {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return 0, fmt.Errorf("unknown tree hash algorithm %q, want one of %s", name, strings.Join(names, ", "))
+	}
+	return hash, nil
+}
+
+// servesV1 returns true if the log's tree heads can be served through the RFC 6962 API,
+// whose tree heads only hold SHA-256 root hashes. Logs with other trees are only served
+// through the v2 API.
+func (c LogContext) servesV1() bool {
+	return c.treeHash == gocrypto.SHA256
+}
+
+// checkRootHash returns an error unless rootHash, from the backend, is the size of a root
+// hash of the log's tree.
+func (c LogContext) checkRootHash(rootHash []byte) error {
+	if got, want := len(rootHash), c.treeHash.Size(); got != want {
+		return fmt.Errorf("bad hash size from backend expecting: %d got %d", want, got)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package ct
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/trillian"
+)
+
+func TestParseTreeHashAlgorithm(t *testing.T) {
+	var tests = []struct {
+		name    string
+		want    gocrypto.Hash
+		wantErr bool
+	}{
+		{name: "", want: gocrypto.SHA256},
+		{name: "SHA256", want: gocrypto.SHA256},
+		{name: "SHA384", want: gocrypto.SHA384},
+		{name: "SHA512_256", want: gocrypto.SHA512_256},
+		{name: "SHA512", wantErr: true},
+		{name: "sha256", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseTreeHashAlgorithm(test.name)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("parseTreeHashAlgorithm(%q)=_,%v, want error: %v", test.name, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseTreeHashAlgorithm(%q)=%v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestV2GetSTHTreeHash(t *testing.T) {
+	var tests = []struct {
+		treeHash   gocrypto.Hash
+		rootSize   int
+		wantStatus int
+	}{
+		{treeHash: gocrypto.SHA256, rootSize: 32, wantStatus: http.StatusOK},
+		{treeHash: gocrypto.SHA256, rootSize: 48, wantStatus: http.StatusInternalServerError},
+		{treeHash: gocrypto.SHA384, rootSize: 48, wantStatus: http.StatusOK},
+		{treeHash: gocrypto.SHA384, rootSize: 32, wantStatus: http.StatusInternalServerError},
+		{treeHash: gocrypto.SHA512_256, rootSize: 32, wantStatus: http.StatusOK},
+		{treeHash: gocrypto.SHA512_256, rootSize: 31, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		info := setupTest(t, nil)
+		info.c.v2LogID = testV2LogID
+		info.c.treeHash = test.treeHash
+		info.expectSignAny()
+		rootHash := bytes.Repeat([]byte("a"), test.rootSize)
+		info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), &trillian.GetLatestSignedLogRootRequest{LogId: 0x42}).Return(makeGetRootResponseForTest(12345000000, 25, rootHash), nil)
+
+		w := makeV2Request(t, info.c, "V2GetSTH", v2GetSTH, http.MethodGet, "get-sth", nil)
+		if got, want := w.Code, test.wantStatus; got != want {
+			t.Errorf("V2GetSTH(%v, %d byte root)=%d (body:%v), want %d", test.treeHash, test.rootSize, got, w.Body, want)
+		}
+		if w.Code == http.StatusOK {
+			var rsp GetSTHV2Response
+			if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+				t.Fatalf("Failed to unmarshal json response: %s", w.Body.Bytes())
+			}
+			sth := unmarshalTransItem(t, rsp.STH, SignedTreeHeadV2).SignedTreeHeadV2
+			if got := sth.TreeHead.RootHash.Value; !bytes.Equal(got, rootHash) {
+				t.Errorf("V2GetSTH(%v).RootHash=%x, want %x", test.treeHash, got, rootHash)
+			}
+		}
+		info.mockCtrl.Finish()
+	}
+}
+
+func TestV1OnlyForSHA256Trees(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	if !info.c.servesV1() {
+		t.Errorf("servesV1()=false for a SHA256 tree, want true")
+	}
+	info.c.treeHash = gocrypto.SHA384
+	if info.c.servesV1() {
+		t.Errorf("servesV1()=true for a SHA384 tree, want false")
+	}
+	if _, err := createFinalTreeHead(nil, info.c); err == nil {
+		t.Errorf("createFinalTreeHead(SHA384 tree)=_,nil, want error")
+	}
+}
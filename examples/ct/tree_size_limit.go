@@ -0,0 +1,86 @@
+package ct
+
+import (
+	"errors"
+	"expvar"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+)
+
+// How long a tree size fetched from the backend is used before checking it again
+const defaultTreeSizeRefreshInterval = 10 * time.Second
+
+// errLogFull is returned to submitters once the log has reached its maximum size.
+var errLogFull = errors.New("log full, use next shard")
+
+// treeSizeLimit tracks the size of a log that has a maximum size configured. Once the
+// maximum is reached the log stops accepting submissions, so that a full shard can be
+// frozen and submitters directed to the next one.
+type treeSizeLimit struct {
+	maxTreeSize     int64
+	refreshInterval time.Duration
+	full            *expvar.Int
+
+	mu          sync.Mutex
+	treeSize    int64
+	lastRefresh time.Time
+}
+
+func newTreeSizeLimit(maxTreeSize int64) *treeSizeLimit {
+	return &treeSizeLimit{maxTreeSize: maxTreeSize, refreshInterval: defaultTreeSizeRefreshInterval, full: new(expvar.Int)}
+}
+
+// update records the tree size of an STH observed at time now.
+func (l *treeSizeLimit) update(treeSize int64, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if treeSize > l.treeSize {
+		l.treeSize = treeSize
+	}
+	l.lastRefresh = now
+	if l.treeSize >= l.maxTreeSize {
+		l.full.Set(1)
+	}
+}
+
+// current returns the latest known tree size and whether it was observed recently
+// enough to rely on.
+func (l *treeSizeLimit) current(now time.Time) (int64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.treeSize, !l.lastRefresh.IsZero() && now.Sub(l.lastRefresh) < l.refreshInterval
+}
+
+// checkTreeSizeLimit returns an error if the log has a maximum size configured and the
+// tree has reached it. The tree size is refreshed from the backend if it is stale.
+func checkTreeSizeLimit(ctx context.Context, c LogContext) (int, error) {
+	if c.sizeLimit == nil {
+		return http.StatusOK, nil
+	}
+
+	now := c.timeSource.Now()
+	treeSize, fresh := c.sizeLimit.current(now)
+	if treeSize < c.sizeLimit.maxTreeSize && !fresh {
+		rsp, err := c.rpcClient.GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: c.logID})
+		if err != nil || !rpcStatusOK(rsp.GetStatus()) || rsp.GetSignedLogRoot() == nil {
+			// Carry on with the last known size, if the backend is unavailable the
+			// submission will fail anyway.
+			glog.Warningf("%s: failed to refresh tree size: %v %v", c.logPrefix, err, rsp.GetStatus())
+		} else {
+			c.sizeLimit.update(rsp.GetSignedLogRoot().TreeSize, now)
+			treeSize, _ = c.sizeLimit.current(now)
+		}
+	}
+
+	if treeSize >= c.sizeLimit.maxTreeSize {
+		return http.StatusForbidden, errLogFull
+	}
+	return http.StatusOK, nil
+}
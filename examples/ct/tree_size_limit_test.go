@@ -0,0 +1,89 @@
+package ct
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/examples/ct/testonly"
+)
+
+func TestTreeSizeLimitRejectsWhenFull(t *testing.T) {
+	var tests = []struct {
+		descr    string
+		treeSize int64
+		rpcErr   error
+		want     int
+	}{
+		// Not full, so the empty body is rejected as usual.
+		{descr: "not-full", treeSize: 99, want: http.StatusBadRequest},
+		{descr: "backend-down", rpcErr: errors.New("backendfailure"), want: http.StatusBadRequest},
+		{descr: "full", treeSize: 100, want: http.StatusForbidden},
+		{descr: "over-full", treeSize: 101, want: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		info := setupTest(t, []string{testonly.FakeCACertPEM})
+		info.c.sizeLimit = newTreeSizeLimit(100)
+
+		var rsp *trillian.GetLatestSignedLogRootResponse
+		if test.rpcErr == nil {
+			rsp = makeGetRootResponseForTest(12345, test.treeSize, []byte("abcdabcdabcdabcdabcdabcdabcdabcd"))
+		}
+		info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), &trillian.GetLatestSignedLogRootRequest{LogId: 0x42}).Return(rsp, test.rpcErr)
+
+		w := makeAddChainRequest(t, info.c, strings.NewReader(""))
+		if got := w.Code; got != test.want {
+			t.Errorf("AddChain(%s).Code=%d; want %d", test.descr, got, test.want)
+		}
+		if test.want == http.StatusForbidden {
+			if body := w.Body.String(); !strings.Contains(body, errLogFull.Error()) {
+				t.Errorf("AddChain(%s)=%q; want to find %q", test.descr, body, errLogFull.Error())
+			}
+			if got, want := info.c.sizeLimit.full.String(), "1"; got != want {
+				t.Errorf("AddChain(%s) log-full=%s; want %s", test.descr, got, want)
+			}
+		}
+
+		// The tree size is now fresh so a second request shouldn't query the backend,
+		// unless it failed last time.
+		if test.rpcErr != nil {
+			info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), &trillian.GetLatestSignedLogRootRequest{LogId: 0x42}).Return(nil, test.rpcErr)
+		}
+		w = makeAddChainRequest(t, info.c, strings.NewReader(""))
+		if got := w.Code; got != test.want {
+			t.Errorf("AddChain(%s) again.Code=%d; want %d", test.descr, got, test.want)
+		}
+		info.mockCtrl.Finish()
+	}
+}
+
+func TestTreeSizeLimitUpdate(t *testing.T) {
+	l := newTreeSizeLimit(10)
+	if _, fresh := l.current(fakeTime); fresh {
+		t.Error("current() fresh before any update")
+	}
+
+	l.update(5, fakeTime)
+	if size, fresh := l.current(fakeTime.Add(l.refreshInterval / 2)); size != 5 || !fresh {
+		t.Errorf("current()=%d,%v; want 5,true", size, fresh)
+	}
+	if _, fresh := l.current(fakeTime.Add(l.refreshInterval)); fresh {
+		t.Error("current() fresh after refresh interval")
+	}
+
+	// An STH for a smaller tree, e.g. from a lagging backend replica, can't shrink the tree.
+	l.update(3, fakeTime)
+	if size, _ := l.current(fakeTime); size != 5 {
+		t.Errorf("current()=%d after smaller update; want 5", size)
+	}
+	if got, want := l.full.String(), "0"; got != want {
+		t.Errorf("full=%s; want %s", got, want)
+	}
+	l.update(10, fakeTime)
+	if got, want := l.full.String(), "1"; got != want {
+		t.Errorf("full=%s; want %s", got, want)
+	}
+}
@@ -0,0 +1,34 @@
+package ct
+
+import (
+	"sync"
+)
+
+// TrustedRoots holds the pool of roots a log accepts chains to. The pool can be replaced
+// while the log is serving, e.g. when the root list is refreshed from its sources;
+// requests already in progress carry on using the pool they started with.
+type TrustedRoots struct {
+	mu   sync.RWMutex
+	pool *PEMCertPool
+}
+
+// NewTrustedRoots creates a TrustedRoots that initially holds pool.
+func NewTrustedRoots(pool *PEMCertPool) *TrustedRoots {
+	return &TrustedRoots{pool: pool}
+}
+
+// Pool returns the current pool of roots. It must not be modified.
+func (t *TrustedRoots) Pool() *PEMCertPool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.pool
+}
+
+// Update replaces the pool of roots.
+func (t *TrustedRoots) Update(pool *PEMCertPool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pool = pool
+}
@@ -0,0 +1,259 @@
+package ct
+
+// Data structures from RFC 6962-bis (CT version 2), and code to build and sign them. All
+// the structures are TLS encoded, a v2 client sees each one wrapped in a TransItem.
+
+import (
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+)
+
+// VersionedTransType identifies the type of the data in a TransItem.
+type VersionedTransType tls.Enum // tls:"maxval:65535"
+
+// VersionedTransType values, see RFC 6962-bis section 10.2.
+const (
+	X509EntryV2        VersionedTransType = 0x0101
+	PrecertEntryV2     VersionedTransType = 0x0102
+	X509SCTV2          VersionedTransType = 0x0103
+	PrecertSCTV2       VersionedTransType = 0x0104
+	SignedTreeHeadV2   VersionedTransType = 0x0105
+	ConsistencyProofV2 VersionedTransType = 0x0106
+	InclusionProofV2   VersionedTransType = 0x0107
+)
+
+// TransItem is the container for all the v2 structures a log produces. Exactly one of
+// the data fields is set, as selected by VersionedType.
+type TransItem struct {
+	VersionedType      VersionedTransType                 `tls:"maxval:65535"`
+	X509EntryV2        *TimestampedCertificateEntryDataV2 `tls:"selector:VersionedType,val:257"`
+	PrecertEntryV2     *TimestampedCertificateEntryDataV2 `tls:"selector:VersionedType,val:258"`
+	X509SCTV2          *SignedCertificateTimestampDataV2  `tls:"selector:VersionedType,val:259"`
+	PrecertSCTV2       *SignedCertificateTimestampDataV2  `tls:"selector:VersionedType,val:260"`
+	SignedTreeHeadV2   *SignedTreeHeadDataV2              `tls:"selector:VersionedType,val:261"`
+	ConsistencyProofV2 *ConsistencyProofDataV2            `tls:"selector:VersionedType,val:262"`
+	InclusionProofV2   *InclusionProofDataV2              `tls:"selector:VersionedType,val:263"`
+}
+
+// ExtensionV2 is an SCT or STH extension. No extension types are defined yet, but the
+// encoding leaves room for them.
+type ExtensionV2 struct {
+	ExtensionType tls.Enum `tls:"maxval:65535"`
+	ExtensionData []byte   `tls:"minlen:0,maxlen:65535"`
+}
+
+// The sizes of hash a NodeHash can hold.
+const (
+	minNodeHashSize = 32
+	maxNodeHashSize = 255
+)
+
+// NodeHash is a hash of a node in the Merkle tree.
+type NodeHash struct {
+	Value []byte `tls:"minlen:32,maxlen:255"`
+}
+
+// TimestampedCertificateEntryDataV2 describes a certificate or precertificate entry, and
+// is what a v2 SCT signs.
+type TimestampedCertificateEntryDataV2 struct {
+	Timestamp      uint64
+	IssuerKeyHash  []byte        `tls:"minlen:32,maxlen:255"`
+	TBSCertificate []byte        `tls:"minlen:1,maxlen:16777215"`
+	SCTExtensions  []ExtensionV2 `tls:"minlen:0,maxlen:65535"`
+}
+
+// SignedCertificateTimestampDataV2 is a v2 SCT. The signature is over the TransItem
+// holding the entry's TimestampedCertificateEntryDataV2.
+type SignedCertificateTimestampDataV2 struct {
+	LogID         []byte `tls:"minlen:2,maxlen:127"`
+	Timestamp     uint64
+	SCTExtensions []ExtensionV2 `tls:"minlen:0,maxlen:65535"`
+	Signature     []byte        `tls:"minlen:0,maxlen:65535"`
+}
+
+// TreeHeadDataV2 is the part of a v2 tree head that the log signs.
+type TreeHeadDataV2 struct {
+	Timestamp     uint64
+	TreeSize      uint64
+	RootHash      NodeHash
+	STHExtensions []ExtensionV2 `tls:"minlen:0,maxlen:65535"`
+}
+
+// SignedTreeHeadDataV2 is a v2 signed tree head.
+type SignedTreeHeadDataV2 struct {
+	LogID     []byte `tls:"minlen:2,maxlen:127"`
+	TreeHead  TreeHeadDataV2
+	Signature []byte `tls:"minlen:0,maxlen:65535"`
+}
+
+// ConsistencyProofDataV2 is a v2 consistency proof between two tree sizes.
+type ConsistencyProofDataV2 struct {
+	LogID           []byte `tls:"minlen:2,maxlen:127"`
+	TreeSize1       uint64
+	TreeSize2       uint64
+	ConsistencyPath []NodeHash `tls:"minlen:0,maxlen:65535"`
+}
+
+// InclusionProofDataV2 is a v2 inclusion proof for a leaf.
+type InclusionProofDataV2 struct {
+	LogID         []byte `tls:"minlen:2,maxlen:127"`
+	TreeSize      uint64
+	LeafIndex     uint64
+	InclusionPath []NodeHash `tls:"minlen:0,maxlen:65535"`
+}
+
+// parseV2LogID converts a log's OID, in dotted form e.g. "1.3.101.8192", to the v2 LogID:
+// the contents of the OID's DER encoding, without the tag and length.
+func parseV2LogID(oid string) ([]byte, error) {
+	var id asn1.ObjectIdentifier
+	for _, arc := range strings.Split(oid, ".") {
+		n, err := strconv.Atoi(arc)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid log OID %q", oid)
+		}
+		id = append(id, n)
+	}
+	der, err := asn1.Marshal(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log OID %q: %v", oid, err)
+	}
+	// The contents are no more than 127 bytes, so the length takes a single byte.
+	if len(der) < 4 || len(der) > 129 {
+		return nil, fmt.Errorf("log OID %q has a bad length", oid)
+	}
+	return der[2:], nil
+}
+
+// signV2 signs the TLS encoding of a v2 structure with the log's key.
+func signV2(km crypto.KeyManager, data interface{}) ([]byte, error) {
+	signer, _, err := logSigner(km)
+	if err != nil {
+		return nil, err
+	}
+	toSign, err := tls.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize signature input: %v", err)
+	}
+	signature, err := signer.Sign(toSign)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign data: %v", err)
+	}
+	return signature.Signature, nil
+}
+
+// v2EntryForLeaf builds the v2 entry for an RFC 6962 leaf. The entry has the same
+// timestamp and certificate as the leaf, so v1 and v2 SCTs for a submission describe the
+// same log entry. issuer is only used for certificate entries, as precertificate leaves
+// already include the issuer's key hash; it's nil for a self-signed certificate.
+func v2EntryForLeaf(leaf ct.MerkleTreeLeaf, issuer *x509.Certificate) (TransItem, error) {
+	entry := leaf.TimestampedEntry
+	if entry == nil {
+		return TransItem{}, errors.New("leaf has no timestamped entry")
+	}
+	switch entry.EntryType {
+	case ct.X509LogEntryType:
+		if entry.X509Entry == nil {
+			return TransItem{}, errors.New("certificate leaf has no certificate")
+		}
+		cert, err := x509.ParseCertificate(entry.X509Entry.Data)
+		if err != nil {
+			return TransItem{}, fmt.Errorf("failed to parse certificate: %v", err)
+		}
+		if issuer == nil {
+			issuer = cert
+		}
+		keyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+		return TransItem{
+			VersionedType: X509EntryV2,
+			X509EntryV2: &TimestampedCertificateEntryDataV2{
+				Timestamp:      entry.Timestamp,
+				IssuerKeyHash:  keyHash[:],
+				TBSCertificate: cert.RawTBSCertificate,
+				SCTExtensions:  []ExtensionV2{},
+			},
+		}, nil
+	case ct.PrecertLogEntryType:
+		if entry.PrecertEntry == nil {
+			return TransItem{}, errors.New("precertificate leaf has no precertificate")
+		}
+		return TransItem{
+			VersionedType: PrecertEntryV2,
+			PrecertEntryV2: &TimestampedCertificateEntryDataV2{
+				Timestamp:      entry.Timestamp,
+				IssuerKeyHash:  entry.PrecertEntry.IssuerKeyHash[:],
+				TBSCertificate: entry.PrecertEntry.TBSCertificate,
+				SCTExtensions:  []ExtensionV2{},
+			},
+		}, nil
+	}
+	return TransItem{}, fmt.Errorf("unknown entry type: %v", entry.EntryType)
+}
+
+// signV2SCT builds and signs the v2 SCT for an entry built by v2EntryForLeaf.
+func signV2SCT(km crypto.KeyManager, logID []byte, entry TransItem) (TransItem, error) {
+	sctType := X509SCTV2
+	data := entry.X509EntryV2
+	if entry.VersionedType == PrecertEntryV2 {
+		sctType = PrecertSCTV2
+		data = entry.PrecertEntryV2
+	}
+	if data == nil {
+		return TransItem{}, fmt.Errorf("can't issue an SCT for a TransItem of type %v", entry.VersionedType)
+	}
+	signature, err := signV2(km, entry)
+	if err != nil {
+		return TransItem{}, err
+	}
+	sct := &SignedCertificateTimestampDataV2{
+		LogID:         logID,
+		Timestamp:     data.Timestamp,
+		SCTExtensions: []ExtensionV2{},
+		Signature:     signature,
+	}
+	if sctType == PrecertSCTV2 {
+		return TransItem{VersionedType: PrecertSCTV2, PrecertSCTV2: sct}, nil
+	}
+	return TransItem{VersionedType: X509SCTV2, X509SCTV2: sct}, nil
+}
+
+// signV2TreeHead builds and signs the v2 tree head for a log root from the backend.
+func signV2TreeHead(km crypto.KeyManager, logID []byte, slr trillian.SignedLogRoot) (TransItem, error) {
+	// The root hash can be of any size a NodeHash can hold, so trees built with hashes
+	// other than SHA-256 can be served.
+	if hashSize := len(slr.RootHash); hashSize < minNodeHashSize || hashSize > maxNodeHashSize {
+		return TransItem{}, fmt.Errorf("bad hash size from backend expecting: %d to %d got %d", minNodeHashSize, maxNodeHashSize, hashSize)
+	}
+	head := TreeHeadDataV2{
+		Timestamp:     uint64(slr.TimestampNanos / millisPerNano),
+		TreeSize:      uint64(slr.TreeSize),
+		RootHash:      NodeHash{Value: slr.RootHash},
+		STHExtensions: []ExtensionV2{},
+	}
+	signature, err := signV2(km, head)
+	if err != nil {
+		return TransItem{}, fmt.Errorf("failed to sign tree head: %v", err)
+	}
+	return TransItem{
+		VersionedType:    SignedTreeHeadV2,
+		SignedTreeHeadV2: &SignedTreeHeadDataV2{LogID: logID, TreeHead: head, Signature: signature},
+	}, nil
+}
+
+// nodeHashesFromProto converts the path from a proof proto to v2 node hashes.
+func nodeHashesFromProto(path []*trillian.Node) []NodeHash {
+	result := make([]NodeHash, 0, len(path))
+	for _, node := range path {
+		result = append(result, NodeHash{Value: node.NodeHash})
+	}
+	return result
+}
@@ -0,0 +1,389 @@
+package ct
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/trillian"
+	"golang.org/x/net/context"
+)
+
+// Paths of the RFC 6962-bis entrypoints, relative to the log's prefix.
+const (
+	V2SubmitEntryPath       = "/ct/v2/submit-entry"
+	V2GetSTHPath            = "/ct/v2/get-sth"
+	V2GetSTHConsistencyPath = "/ct/v2/get-sth-consistency"
+	V2GetProofByHashPath    = "/ct/v2/get-proof-by-hash"
+	V2GetEntriesPath        = "/ct/v2/get-entries"
+	V2GetAnchorsPath        = "/ct/v2/get-anchors"
+)
+
+// Values of the type field of a submit-entry request.
+const (
+	v2SubmissionCertificate    = 1
+	v2SubmissionPrecertificate = 2
+)
+
+// V2Entrypoints is a list of the RFC 6962-bis entrypoint names as exposed in statistics.
+var V2Entrypoints = []string{"V2SubmitEntry", "V2GetSTH", "V2GetSTHConsistency", "V2GetProofByHash", "V2GetEntries", "V2GetAnchors"}
+
+// In the v2 API responses all the TLS encoded structures are TransItems, which are base64
+// encoded in the JSON.
+
+// SubmitEntryRequest is the body of a v2 submit-entry request. Until the log supports
+// CMS precertificates, a precertificate is submitted as it would be to add-pre-chain,
+// i.e. as a certificate with the poison extension.
+type SubmitEntryRequest struct {
+	Submission []byte   `json:"submission"`
+	Type       int      `json:"type"`
+	Chain      [][]byte `json:"chain"`
+}
+
+// SubmitEntryResponse holds the v2 SCT for a submission.
+type SubmitEntryResponse struct {
+	SCT []byte `json:"sct"`
+}
+
+// GetSTHV2Response holds the log's latest v2 tree head.
+type GetSTHV2Response struct {
+	STH []byte `json:"sth"`
+}
+
+// GetSTHConsistencyV2Response holds a v2 consistency proof, and the log's latest tree head.
+type GetSTHConsistencyV2Response struct {
+	Consistency []byte `json:"consistency"`
+	STH         []byte `json:"sth"`
+}
+
+// GetProofByHashV2Response holds a v2 inclusion proof, and the log's latest tree head.
+type GetProofByHashV2Response struct {
+	Inclusion []byte `json:"inclusion"`
+	STH       []byte `json:"sth"`
+}
+
+// SubmittedEntryV2 is a submission as the log received it.
+type SubmittedEntryV2 struct {
+	Submission []byte   `json:"submission"`
+	Chain      [][]byte `json:"chain"`
+}
+
+// LogEntryV2 is an entry in a v2 get-entries response. The log's tree holds the RFC 6962
+// leaf for each entry, which is in LeafInput, and leaf hashes and inclusion proofs are
+// for that leaf rather than for LogEntry.
+type LogEntryV2 struct {
+	LogEntry       []byte           `json:"log_entry"`
+	SubmittedEntry SubmittedEntryV2 `json:"submitted_entry"`
+	SCT            []byte           `json:"sct"`
+	LeafInput      []byte           `json:"leaf_input"`
+}
+
+// GetEntriesV2Response holds a range of log entries, and the log's latest tree head.
+type GetEntriesV2Response struct {
+	Entries []LogEntryV2 `json:"entries"`
+	STH     []byte       `json:"sth"`
+}
+
+// GetAnchorsResponse lists the roots the log accepts.
+type GetAnchorsResponse struct {
+	Certificates   [][]byte `json:"certificates"`
+	MaxChainLength int      `json:"max_chain_length"`
+}
+
+// registerV2Handlers registers a HandleFunc for each of the RFC 6962-bis methods. The
+// handlers share the log's tree with the v1 ones.
+func (c LogContext) registerV2Handlers(prefix string) {
+	http.Handle(prefix+V2SubmitEntryPath, appHandler{context: c, handler: v2SubmitEntry, name: "V2SubmitEntry", method: http.MethodPost})
+	http.Handle(prefix+V2GetSTHPath, appHandler{context: c, handler: v2GetSTH, name: "V2GetSTH", method: http.MethodGet})
+	http.Handle(prefix+V2GetSTHConsistencyPath, appHandler{context: c, handler: v2GetSTHConsistency, name: "V2GetSTHConsistency", method: http.MethodGet})
+	http.Handle(prefix+V2GetProofByHashPath, appHandler{context: c, handler: v2GetProofByHash, name: "V2GetProofByHash", method: http.MethodGet})
+	http.Handle(prefix+V2GetEntriesPath, appHandler{context: c, handler: v2GetEntries, name: "V2GetEntries", method: http.MethodGet})
+	http.Handle(prefix+V2GetAnchorsPath, appHandler{context: c, handler: v2GetAnchors, name: "V2GetAnchors", method: http.MethodGet})
+}
+
+func v2SubmitEntry(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	if status, err := checkAcceptingSubmissions(ctx, c); err != nil {
+		return status, err
+	}
+
+	var req SubmitEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("submit-entry: failed to parse request body: %v", err)
+	}
+	if len(req.Submission) == 0 {
+		return http.StatusBadRequest, errors.New("submit-entry: submission was empty")
+	}
+	var isPrecert bool
+	switch req.Type {
+	case v2SubmissionCertificate:
+	case v2SubmissionPrecertificate:
+		isPrecert = true
+	default:
+		return http.StatusBadRequest, fmt.Errorf("submit-entry: unknown submission type %d", req.Type)
+	}
+	rawChain := append([][]byte{req.Submission}, req.Chain...)
+	if err := checkChainLength(rawChain, c.maxChainLength); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("submit-entry: %v", err)
+	}
+
+	sub, status, err := queueChain(ctx, c, "V2SubmitEntry", ct.AddChainRequest{Chain: rawChain}, w, isPrecert)
+	if err != nil {
+		return status, err
+	}
+
+	var issuer *x509.Certificate
+	if len(sub.chain) > 1 {
+		issuer = sub.chain[1]
+	}
+	entry, err := v2EntryForLeaf(sub.merkleLeaf, issuer)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("submit-entry: failed to build v2 entry: %v", err)
+	}
+	sct, err := signV2SCT(c.logKeyManager, c.v2LogID, entry)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("submit-entry: failed to build v2 SCT: %v", err)
+	}
+	sctData, err := tls.Marshal(sct)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("submit-entry: failed to marshal v2 SCT: %v", err)
+	}
+	if err := setLogKeyID(w, c.logKeyManager); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if status, err := writeJSON(w, SubmitEntryResponse{SCT: sctData}); err != nil {
+		return status, err
+	}
+	glog.V(3).Infof("%s: V2SubmitEntry <= SCT", c.logPrefix)
+	c.exp.lastSCTTimestamp.Set(int64(sub.sct.Timestamp))
+	auditSubmission(ctx, c, sub, isPrecert)
+
+	mirrorSubmission(c, "V2SubmitEntry", rawChain, isPrecert)
+
+	return http.StatusOK, nil
+}
+
+// v2TreeHead returns the TLS encoded v2 tree head for the log's latest root, or its final
+// one if it has been shut down.
+func v2TreeHead(ctx context.Context, c LogContext, method string) ([]byte, error) {
+	var slr *trillian.SignedLogRoot
+	if c.final != nil {
+		slr = &trillian.SignedLogRoot{
+			TimestampNanos: int64(c.final.STH.Timestamp) * millisPerNano,
+			TreeSize:       int64(c.final.STH.TreeSize),
+			RootHash:       c.final.STH.SHA256RootHash,
+		}
+	} else {
+		var err error
+		if slr, err = getLatestLogRoot(ctx, c, method); err != nil {
+			return nil, err
+		}
+	}
+	sth, err := signV2TreeHead(c.sthKeyManager, c.v2LogID, *slr)
+	if err != nil {
+		return nil, err
+	}
+	return tls.Marshal(sth)
+}
+
+func v2GetSTH(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	sth, err := v2TreeHead(ctx, c, "V2GetSTH")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := setLogKeyID(w, c.sthKeyManager); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return writeJSON(w, GetSTHV2Response{STH: sth})
+}
+
+func v2GetSTHConsistency(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	first, second, err := parseGetSTHConsistencyRange(r)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to parse consistency range: %v", err)
+	}
+	req := trillian.GetConsistencyProofRequest{LogId: c.logID, FirstTreeSize: first, SecondTreeSize: second}
+	rsp, err := c.rpcClient.GetConsistencyProof(ctx, &req)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("backend GetConsistencyProof request failed: %v", err)
+	}
+	if !rpcStatusOK(rsp.GetStatus()) {
+		return http.StatusInternalServerError, fmt.Errorf("backend GetConsistencyProof request failed, status=%v", rsp.GetStatus())
+	}
+	if rsp.Proof == nil || !checkAuditPath(rsp.Proof.ProofNode) {
+		return http.StatusInternalServerError, fmt.Errorf("backend returned invalid proof: %v", rsp.Proof)
+	}
+
+	proof, err := tls.Marshal(TransItem{
+		VersionedType: ConsistencyProofV2,
+		ConsistencyProofV2: &ConsistencyProofDataV2{
+			LogID:           c.v2LogID,
+			TreeSize1:       uint64(first),
+			TreeSize2:       uint64(second),
+			ConsistencyPath: nodeHashesFromProto(rsp.Proof.ProofNode),
+		},
+	})
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to marshal consistency proof: %v", err)
+	}
+	sth, err := v2TreeHead(ctx, c, "V2GetSTHConsistency")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return writeJSON(w, GetSTHConsistencyV2Response{Consistency: proof, STH: sth})
+}
+
+func v2GetProofByHash(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	leafHash, treeSize, err := parseGetProofByHashParams(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	req := trillian.GetInclusionProofByHashRequest{
+		LogId:           c.logID,
+		LeafHash:        leafHash,
+		TreeSize:        treeSize,
+		OrderBySequence: true,
+	}
+	rsp, err := c.rpcClient.GetInclusionProofByHash(ctx, &req)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("backend GetInclusionProofByHash request failed: %v", err)
+	}
+	if !rpcStatusOK(rsp.GetStatus()) {
+		return http.StatusInternalServerError, fmt.Errorf("backend GetInclusionProofByHash request failed, status=%v", rsp.GetStatus())
+	}
+	if len(rsp.Proof) == 0 || !checkAuditPath(rsp.Proof[0].ProofNode) {
+		return http.StatusInternalServerError, fmt.Errorf("get-proof-by-hash: backend returned invalid proof: %v", rsp.Proof)
+	}
+
+	proof, err := tls.Marshal(TransItem{
+		VersionedType: InclusionProofV2,
+		InclusionProofV2: &InclusionProofDataV2{
+			LogID:         c.v2LogID,
+			TreeSize:      uint64(treeSize),
+			LeafIndex:     uint64(rsp.Proof[0].LeafIndex),
+			InclusionPath: nodeHashesFromProto(rsp.Proof[0].ProofNode),
+		},
+	})
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to marshal inclusion proof: %v", err)
+	}
+	sth, err := v2TreeHead(ctx, c, "V2GetProofByHash")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return writeJSON(w, GetProofByHashV2Response{Inclusion: proof, STH: sth})
+}
+
+func v2GetEntries(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	start, end, err := parseGetEntriesRange(r, maxGetEntriesAllowed)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("bad range on get-entries request: %v", err)
+	}
+	req := trillian.GetLeavesByIndexRequest{
+		LogId:     c.logID,
+		LeafIndex: buildIndicesForRange(start, end),
+	}
+	rsp, err := c.rpcClient.GetLeavesByIndex(ctx, &req)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("backend GetLeavesByIndex request failed: %v", err)
+	}
+	if !rpcStatusOK(rsp.GetStatus()) {
+		return http.StatusInternalServerError, fmt.Errorf("backend GetLeavesByIndex request failed, status=%v", rsp.GetStatus())
+	}
+	if err := sortLeafRange(rsp, start, end); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("backend get-entries range invalid: %v", err)
+	}
+
+	// Unlike get-entries in RFC 6962 a leaf that can't be parsed fails the request, as
+	// the v2 entry can't be built without it.
+	jsonRsp := GetEntriesV2Response{Entries: make([]LogEntryV2, 0, len(rsp.Leaves))}
+	for _, leaf := range rsp.Leaves {
+		entry, err := v2LogEntry(c, leaf)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("failed to process leaf %d from backend: %v", leaf.LeafIndex, err)
+		}
+		jsonRsp.Entries = append(jsonRsp.Entries, entry)
+	}
+	if jsonRsp.STH, err = v2TreeHead(ctx, c, "V2GetEntries"); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return writeJSON(w, jsonRsp)
+}
+
+// v2LogEntry converts a leaf from the backend into a v2 get-entries entry. The SCT is
+// signed afresh, but it's for the same entry and timestamp as the one the submitter got.
+func v2LogEntry(c LogContext, leaf *trillian.LogLeaf) (LogEntryV2, error) {
+	var merkleLeaf ct.MerkleTreeLeaf
+	if rest, err := tls.Unmarshal(leaf.LeafValue, &merkleLeaf); err != nil {
+		return LogEntryV2{}, fmt.Errorf("failed to deserialize Merkle leaf: %v", err)
+	} else if len(rest) > 0 {
+		return LogEntryV2{}, errors.New("trailing data after Merkle leaf")
+	}
+	if merkleLeaf.TimestampedEntry == nil {
+		return LogEntryV2{}, errors.New("leaf has no timestamped entry")
+	}
+
+	var submitted SubmittedEntryV2
+	switch merkleLeaf.TimestampedEntry.EntryType {
+	case ct.X509LogEntryType:
+		var chain ct.CertificateChain
+		if _, err := tls.Unmarshal(leaf.ExtraData, &chain); err != nil {
+			return LogEntryV2{}, fmt.Errorf("failed to deserialize certificate chain: %v", err)
+		}
+		if merkleLeaf.TimestampedEntry.X509Entry != nil {
+			submitted.Submission = merkleLeaf.TimestampedEntry.X509Entry.Data
+		}
+		for _, cert := range chain.Entries {
+			submitted.Chain = append(submitted.Chain, cert.Data)
+		}
+	case ct.PrecertLogEntryType:
+		var chain ct.PrecertChainEntry
+		if _, err := tls.Unmarshal(leaf.ExtraData, &chain); err != nil {
+			return LogEntryV2{}, fmt.Errorf("failed to deserialize precertificate chain: %v", err)
+		}
+		submitted.Submission = chain.PreCertificate.Data
+		for _, cert := range chain.CertificateChain {
+			submitted.Chain = append(submitted.Chain, cert.Data)
+		}
+	}
+
+	// Certificate entries need the issuer's key, which is the first certificate in the
+	// chain. Precertificate leaves already include it.
+	var issuer *x509.Certificate
+	if merkleLeaf.TimestampedEntry.EntryType == ct.X509LogEntryType && len(submitted.Chain) > 0 {
+		var err error
+		if issuer, err = x509.ParseCertificate(submitted.Chain[0]); err != nil {
+			return LogEntryV2{}, fmt.Errorf("failed to parse issuer: %v", err)
+		}
+	}
+	entry, err := v2EntryForLeaf(merkleLeaf, issuer)
+	if err != nil {
+		return LogEntryV2{}, err
+	}
+	sct, err := signV2SCT(c.logKeyManager, c.v2LogID, entry)
+	if err != nil {
+		return LogEntryV2{}, err
+	}
+
+	ret := LogEntryV2{SubmittedEntry: submitted, LeafInput: leaf.LeafValue}
+	if ret.LogEntry, err = tls.Marshal(entry); err != nil {
+		return LogEntryV2{}, err
+	}
+	if ret.SCT, err = tls.Marshal(sct); err != nil {
+		return LogEntryV2{}, err
+	}
+	return ret, nil
+}
+
+func v2GetAnchors(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	roots := c.trustedRoots.Pool().RawCertificates()
+	rsp := GetAnchorsResponse{Certificates: make([][]byte, 0, len(roots)), MaxChainLength: c.maxChainLength}
+	for _, cert := range roots {
+		rsp.Certificates = append(rsp.Certificates, cert.Raw)
+	}
+	return writeJSON(w, rsp)
+}
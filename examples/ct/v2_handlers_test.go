@@ -0,0 +1,268 @@
+package ct
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/trillian"
+	"github.com/google/trillian/examples/ct/testonly"
+	"golang.org/x/net/context"
+)
+
+var testV2LogID = []byte{0x2b, 0x65, 0xc0, 0x00}
+
+func makeV2Request(t *testing.T, c LogContext, name string, handler func(context.Context, LogContext, http.ResponseWriter, *http.Request) (int, error), method, target string, body []byte) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, "http://example.com/ct/v2/"+target, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	appHandler{context: c, handler: handler, name: name, method: method}.ServeHTTP(w, req)
+	return w
+}
+
+// unmarshalTransItem decodes a TransItem and checks its type.
+func unmarshalTransItem(t *testing.T, data []byte, want VersionedTransType) TransItem {
+	var item TransItem
+	if rest, err := tls.Unmarshal(data, &item); err != nil || len(rest) > 0 {
+		t.Fatalf("failed to unmarshal TransItem: %v (%d bytes left)", err, len(rest))
+	}
+	if item.VersionedType != want {
+		t.Fatalf("TransItem.VersionedType=%v, want %v", item.VersionedType, want)
+	}
+	return item
+}
+
+func TestV2SubmitEntry(t *testing.T) {
+	pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+	certs := pool.RawCertificates()
+
+	var tests = []struct {
+		descr string
+		req   SubmitEntryRequest
+		want  int
+	}{
+		{
+			descr: "empty-submission",
+			req:   SubmitEntryRequest{Type: v2SubmissionCertificate},
+			want:  http.StatusBadRequest,
+		},
+		{
+			descr: "unknown-type",
+			req:   SubmitEntryRequest{Submission: certs[0].Raw, Type: 3, Chain: [][]byte{certs[1].Raw}},
+			want:  http.StatusBadRequest,
+		},
+		{
+			descr: "wrong-type",
+			req:   SubmitEntryRequest{Submission: certs[0].Raw, Type: v2SubmissionPrecertificate, Chain: [][]byte{certs[1].Raw}},
+			want:  http.StatusBadRequest,
+		},
+		{
+			descr: "success",
+			req:   SubmitEntryRequest{Submission: certs[0].Raw, Type: v2SubmissionCertificate, Chain: [][]byte{certs[1].Raw}},
+			want:  http.StatusOK,
+		},
+	}
+	info := setupTest(t, []string{testonly.FakeCACertPEM})
+	defer info.mockCtrl.Finish()
+	info.c.v2LogID = testV2LogID
+	info.expectSignAny()
+
+	for _, test := range tests {
+		if test.want == http.StatusOK {
+			// The backend gets the same leaf that add-chain would have queued.
+			merkleLeaf, _, err := signV1SCTForCertificate(info.km, certs[0], nil, fakeTime)
+			if err != nil {
+				t.Fatalf("Unexpected error signing SCT: %v", err)
+			}
+			leaves := logLeavesForCert(t, info.km, certs, merkleLeaf, false)
+			info.client.EXPECT().QueueLeaves(deadlineMatcher(), &trillian.QueueLeavesRequest{LogId: 0x42, Leaves: leaves}).Return(&trillian.QueueLeavesResponse{Status: okStatus}, nil)
+		}
+		body, err := json.Marshal(test.req)
+		if err != nil {
+			t.Fatalf("Failed to marshal request: %v", err)
+		}
+
+		w := makeV2Request(t, info.c, "V2SubmitEntry", v2SubmitEntry, http.MethodPost, "submit-entry", body)
+		if got := w.Code; got != test.want {
+			t.Errorf("V2SubmitEntry(%s)=%d (body:%v), want %d", test.descr, got, w.Body, test.want)
+		}
+		if test.want != http.StatusOK {
+			continue
+		}
+
+		var rsp SubmitEntryResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+			t.Fatalf("Failed to unmarshal json response: %s", w.Body.Bytes())
+		}
+		sct := unmarshalTransItem(t, rsp.SCT, X509SCTV2).X509SCTV2
+		if !bytes.Equal(sct.LogID, testV2LogID) {
+			t.Errorf("V2SubmitEntry(%s).LogID=%x, want %x", test.descr, sct.LogID, testV2LogID)
+		}
+		if got, want := sct.Timestamp, uint64(fakeTime.UnixNano()/millisPerNano); got != want {
+			t.Errorf("V2SubmitEntry(%s).Timestamp=%d, want %d", test.descr, got, want)
+		}
+		if got, want := string(sct.Signature), "signed"; got != want {
+			t.Errorf("V2SubmitEntry(%s).Signature=%q, want %q", test.descr, got, want)
+		}
+	}
+}
+
+func TestV2SubmitEntryFrozen(t *testing.T) {
+	info := setupTest(t, []string{testonly.FakeCACertPEM})
+	defer info.mockCtrl.Finish()
+	info.c.v2LogID = testV2LogID
+	info.c.state.set(LogStateFrozen)
+
+	w := makeV2Request(t, info.c, "V2SubmitEntry", v2SubmitEntry, http.MethodPost, "submit-entry", []byte("{}"))
+	if got, want := w.Code, http.StatusForbidden; got != want {
+		t.Errorf("V2SubmitEntry(frozen)=%d, want %d", got, want)
+	}
+}
+
+func TestV2GetSTH(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	info.c.v2LogID = testV2LogID
+	info.expectSignAny()
+	rootHash := []byte("abcdabcdabcdabcdabcdabcdabcdabcd")
+	info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), &trillian.GetLatestSignedLogRootRequest{LogId: 0x42}).Return(makeGetRootResponseForTest(12345000000, 25, rootHash), nil)
+
+	w := makeV2Request(t, info.c, "V2GetSTH", v2GetSTH, http.MethodGet, "get-sth", nil)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("V2GetSTH()=%d (body:%v), want %d", got, w.Body, want)
+	}
+	var rsp GetSTHV2Response
+	if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+		t.Fatalf("Failed to unmarshal json response: %s", w.Body.Bytes())
+	}
+	sth := unmarshalTransItem(t, rsp.STH, SignedTreeHeadV2).SignedTreeHeadV2
+	want := TreeHeadDataV2{Timestamp: 12345, TreeSize: 25, RootHash: NodeHash{Value: rootHash}, STHExtensions: []ExtensionV2{}}
+	if !reflect.DeepEqual(sth.TreeHead, want) {
+		t.Errorf("V2GetSTH().TreeHead=%+v, want %+v", sth.TreeHead, want)
+	}
+}
+
+func TestV2GetProofByHash(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	info.c.v2LogID = testV2LogID
+	info.expectSignAny()
+
+	w := makeV2Request(t, info.c, "V2GetProofByHash", v2GetProofByHash, http.MethodGet, "get-proof-by-hash?hash=notbase64data&tree_size=1", nil)
+	if got, want := w.Code, http.StatusBadRequest; got != want {
+		t.Errorf("V2GetProofByHash(bad hash)=%d, want %d", got, want)
+	}
+
+	path := []*trillian.Node{{NodeHash: bytes.Repeat([]byte("a"), 32)}, {NodeHash: bytes.Repeat([]byte("b"), 32)}}
+	info.client.EXPECT().GetInclusionProofByHash(deadlineMatcher(), gomock.Any()).Return(&trillian.GetInclusionProofByHashResponse{
+		Status: okStatus,
+		Proof:  []*trillian.Proof{{LeafIndex: 2, ProofNode: path}},
+	}, nil)
+	info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), gomock.Any()).Return(makeGetRootResponseForTest(12345000000, 7, []byte("abcdabcdabcdabcdabcdabcdabcdabcd")), nil)
+
+	w = makeV2Request(t, info.c, "V2GetProofByHash", v2GetProofByHash, http.MethodGet, "get-proof-by-hash?hash=aGkK&tree_size=7", nil)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("V2GetProofByHash()=%d (body:%v), want %d", got, w.Body, want)
+	}
+	var rsp GetProofByHashV2Response
+	if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+		t.Fatalf("Failed to unmarshal json response: %s", w.Body.Bytes())
+	}
+	got := unmarshalTransItem(t, rsp.Inclusion, InclusionProofV2).InclusionProofV2
+	want := &InclusionProofDataV2{LogID: testV2LogID, TreeSize: 7, LeafIndex: 2, InclusionPath: nodeHashesFromProto(path)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("V2GetProofByHash().Inclusion=%+v, want %+v", got, want)
+	}
+	unmarshalTransItem(t, rsp.STH, SignedTreeHeadV2)
+}
+
+func TestV2GetEntries(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	info.c.v2LogID = testV2LogID
+	info.expectSignAny()
+
+	pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+	certs := pool.RawCertificates()
+	merkleLeaf, _, err := signV1SCTForCertificate(info.km, certs[0], certs[1], fakeTime)
+	if err != nil {
+		t.Fatalf("Unexpected error signing SCT: %v", err)
+	}
+	leaf := logLeavesForCert(t, info.km, certs, merkleLeaf, false)[0]
+	leaf.LeafIndex = 1
+	info.client.EXPECT().GetLeavesByIndex(deadlineMatcher(), &trillian.GetLeavesByIndexRequest{LogId: 0x42, LeafIndex: []int64{1}}).Return(&trillian.GetLeavesByIndexResponse{Status: okStatus, Leaves: []*trillian.LogLeaf{leaf}}, nil)
+	info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), gomock.Any()).Return(makeGetRootResponseForTest(12345000000, 2, []byte("abcdabcdabcdabcdabcdabcdabcdabcd")), nil)
+
+	w := makeV2Request(t, info.c, "V2GetEntries", v2GetEntries, http.MethodGet, "get-entries?start=1&end=1", nil)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("V2GetEntries()=%d (body:%v), want %d", got, w.Body, want)
+	}
+	var rsp GetEntriesV2Response
+	if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+		t.Fatalf("Failed to unmarshal json response: %s", w.Body.Bytes())
+	}
+	if got, want := len(rsp.Entries), 1; got != want {
+		t.Fatalf("V2GetEntries() returned %d entries, want %d", got, want)
+	}
+	entry := rsp.Entries[0]
+	wantEntry, err := v2EntryForLeaf(merkleLeaf, certs[1])
+	if err != nil {
+		t.Fatalf("v2EntryForLeaf()=_,%v, want no error", err)
+	}
+	wantData, err := tls.Marshal(wantEntry)
+	if err != nil {
+		t.Fatalf("failed to marshal entry: %v", err)
+	}
+	if !bytes.Equal(entry.LogEntry, wantData) {
+		t.Errorf("V2GetEntries().LogEntry=%x, want %x", entry.LogEntry, wantData)
+	}
+	if !bytes.Equal(entry.LeafInput, leaf.LeafValue) {
+		t.Errorf("V2GetEntries().LeafInput=%x, want %x", entry.LeafInput, leaf.LeafValue)
+	}
+	wantSubmitted := SubmittedEntryV2{Submission: certs[0].Raw, Chain: [][]byte{certs[1].Raw}}
+	if !reflect.DeepEqual(entry.SubmittedEntry, wantSubmitted) {
+		t.Errorf("V2GetEntries().SubmittedEntry=%+v, want %+v", entry.SubmittedEntry, wantSubmitted)
+	}
+	if got := unmarshalTransItem(t, entry.SCT, X509SCTV2).X509SCTV2.Timestamp; got != merkleLeaf.TimestampedEntry.Timestamp {
+		t.Errorf("V2GetEntries().SCT.Timestamp=%d, want %d", got, merkleLeaf.TimestampedEntry.Timestamp)
+	}
+}
+
+func TestV2GetAnchors(t *testing.T) {
+	info := setupTest(t, []string{testonly.CACertPEM})
+	defer info.mockCtrl.Finish()
+
+	w := makeV2Request(t, info.c, "V2GetAnchors", v2GetAnchors, http.MethodGet, "get-anchors", nil)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("V2GetAnchors()=%d, want %d", got, want)
+	}
+	var rsp GetAnchorsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+		t.Fatalf("Failed to unmarshal json response: %s", w.Body.Bytes())
+	}
+	want := GetAnchorsResponse{Certificates: [][]byte{info.roots.RawCertificates()[0].Raw}, MaxChainLength: DefaultMaxChainLength}
+	if !reflect.DeepEqual(rsp, want) {
+		t.Errorf("V2GetAnchors()=%+v, want %+v", rsp, want)
+	}
+}
+
+func TestV2EntrypointPaths(t *testing.T) {
+	// Every v2 entrypoint has its own path.
+	paths := map[string]bool{}
+	for _, p := range []string{V2SubmitEntryPath, V2GetSTHPath, V2GetSTHConsistencyPath, V2GetProofByHashPath, V2GetEntriesPath, V2GetAnchorsPath} {
+		if paths[p] {
+			t.Errorf("path %s used twice", p)
+		}
+		paths[p] = true
+	}
+	if got, want := len(paths), len(V2Entrypoints); got != want {
+		t.Errorf("%d v2 paths, want %d", got, want)
+	}
+}
@@ -0,0 +1,175 @@
+package ct
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/google/certificate-transparency/go/tls"
+	"github.com/google/certificate-transparency/go/x509"
+	"github.com/google/trillian"
+	"github.com/google/trillian/examples/ct/testonly"
+)
+
+func TestParseV2LogID(t *testing.T) {
+	var tests = []struct {
+		oid     string
+		want    string // hex-encoded
+		wantErr bool
+	}{
+		{oid: "1.3.101.8192", want: "2b65c000"},
+		{oid: "1.3.6.1.4.1.11129.2.5.1", want: "2b06010401d679020501"},
+		{oid: "", wantErr: true},
+		{oid: "1", wantErr: true},
+		{oid: "1.x", wantErr: true},
+		{oid: "1.-2", wantErr: true},
+		{oid: "1..2", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseV2LogID(test.oid)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("parseV2LogID(%q)=_,%v, want error: %v", test.oid, err, test.wantErr)
+			continue
+		}
+		if got := hex.EncodeToString(got); got != test.want {
+			t.Errorf("parseV2LogID(%q)=%s, want %s", test.oid, got, test.want)
+		}
+	}
+}
+
+func TestV2EntryForLeaf(t *testing.T) {
+	pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+	cert, issuer := pool.RawCertificates()[0], pool.RawCertificates()[1]
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	certKeyHash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	certLeaf := ct.MerkleTreeLeaf{
+		Version:  ct.V1,
+		LeafType: ct.TimestampedEntryLeafType,
+		TimestampedEntry: &ct.TimestampedEntry{
+			Timestamp: 1234,
+			EntryType: ct.X509LogEntryType,
+			X509Entry: &ct.ASN1Cert{Data: cert.Raw},
+		},
+	}
+	precertLeaf := ct.MerkleTreeLeaf{
+		Version:  ct.V1,
+		LeafType: ct.TimestampedEntryLeafType,
+		TimestampedEntry: &ct.TimestampedEntry{
+			Timestamp:    5678,
+			EntryType:    ct.PrecertLogEntryType,
+			PrecertEntry: &ct.PreCert{IssuerKeyHash: issuerKeyHash, TBSCertificate: []byte("tbs")},
+		},
+	}
+
+	var tests = []struct {
+		descr   string
+		leaf    ct.MerkleTreeLeaf
+		issuer  *x509.Certificate
+		want    TransItem
+		wantErr bool
+	}{
+		{
+			descr:  "certificate",
+			leaf:   certLeaf,
+			issuer: issuer,
+			want: TransItem{VersionedType: X509EntryV2, X509EntryV2: &TimestampedCertificateEntryDataV2{
+				Timestamp: 1234, IssuerKeyHash: issuerKeyHash[:], TBSCertificate: cert.RawTBSCertificate, SCTExtensions: []ExtensionV2{},
+			}},
+		},
+		{
+			descr: "self-signed",
+			leaf:  certLeaf,
+			want: TransItem{VersionedType: X509EntryV2, X509EntryV2: &TimestampedCertificateEntryDataV2{
+				Timestamp: 1234, IssuerKeyHash: certKeyHash[:], TBSCertificate: cert.RawTBSCertificate, SCTExtensions: []ExtensionV2{},
+			}},
+		},
+		{
+			descr: "precertificate",
+			leaf:  precertLeaf,
+			want: TransItem{VersionedType: PrecertEntryV2, PrecertEntryV2: &TimestampedCertificateEntryDataV2{
+				Timestamp: 5678, IssuerKeyHash: issuerKeyHash[:], TBSCertificate: []byte("tbs"), SCTExtensions: []ExtensionV2{},
+			}},
+		},
+		{
+			descr:   "no-entry",
+			leaf:    ct.MerkleTreeLeaf{Version: ct.V1, LeafType: ct.TimestampedEntryLeafType},
+			wantErr: true,
+		},
+		{
+			descr: "bad-certificate",
+			leaf: ct.MerkleTreeLeaf{Version: ct.V1, LeafType: ct.TimestampedEntryLeafType, TimestampedEntry: &ct.TimestampedEntry{
+				EntryType: ct.X509LogEntryType, X509Entry: &ct.ASN1Cert{Data: []byte("notacert")},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		got, err := v2EntryForLeaf(test.leaf, test.issuer)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("v2EntryForLeaf(%s)=_,%v, want error: %v", test.descr, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		gotData, err := tls.Marshal(got)
+		if err != nil {
+			t.Errorf("v2EntryForLeaf(%s): failed to marshal result: %v", test.descr, err)
+			continue
+		}
+		wantData, err := tls.Marshal(test.want)
+		if err != nil {
+			t.Fatalf("%s: failed to marshal expected result: %v", test.descr, err)
+		}
+		if !bytes.Equal(gotData, wantData) {
+			t.Errorf("v2EntryForLeaf(%s)=%x, want %x", test.descr, gotData, wantData)
+		}
+	}
+}
+
+func TestSignV2TreeHead(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	info.expectSignAny()
+	logID := []byte{0x2b, 0x65, 0xc0, 0x00}
+
+	root := trillian.SignedLogRoot{TimestampNanos: 12345000000, TreeSize: 25, RootHash: []byte("abcdabcdabcdabcdabcdabcdabcdabcd")}
+	sth, err := signV2TreeHead(info.km, logID, root)
+	if err != nil {
+		t.Fatalf("signV2TreeHead()=_,%v, want no error", err)
+	}
+	data, err := tls.Marshal(sth)
+	if err != nil {
+		t.Fatalf("failed to marshal tree head: %v", err)
+	}
+	var got TransItem
+	if rest, err := tls.Unmarshal(data, &got); err != nil || len(rest) > 0 {
+		t.Fatalf("failed to unmarshal tree head: %v (%d bytes left)", err, len(rest))
+	}
+	if got.VersionedType != SignedTreeHeadV2 || got.SignedTreeHeadV2 == nil {
+		t.Fatalf("signV2TreeHead()=%+v, want a signed_tree_head_v2", got)
+	}
+	head := got.SignedTreeHeadV2
+	if !bytes.Equal(head.LogID, logID) {
+		t.Errorf("signV2TreeHead().LogID=%x, want %x", head.LogID, logID)
+	}
+	if got, want := head.TreeHead.Timestamp, uint64(12345); got != want {
+		t.Errorf("signV2TreeHead().Timestamp=%d, want %d", got, want)
+	}
+	if got, want := head.TreeHead.TreeSize, uint64(25); got != want {
+		t.Errorf("signV2TreeHead().TreeSize=%d, want %d", got, want)
+	}
+	if got, want := head.TreeHead.RootHash.Value, root.RootHash; !bytes.Equal(got, want) {
+		t.Errorf("signV2TreeHead().RootHash=%x, want %x", got, want)
+	}
+	if got, want := string(head.Signature), "signed"; got != want {
+		t.Errorf("signV2TreeHead().Signature=%q, want %q", got, want)
+	}
+
+	root.RootHash = []byte("short")
+	if _, err := signV2TreeHead(info.km, logID, root); err == nil {
+		t.Error("signV2TreeHead(short hash)=_,nil, want error")
+	}
+}
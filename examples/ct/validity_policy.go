@@ -0,0 +1,68 @@
+package ct
+
+import (
+	"fmt"
+	"time"
+)
+
+// Codes identifying why a submission was rejected by a validityPolicy.
+const (
+	rejectNotBeforeInFuture = "not-before-in-future"
+	rejectValidityTooLong   = "validity-too-long"
+)
+
+// validityPolicy rejects certificates whose validity dates are typical of misissuance or
+// abuse: ones that don't become valid until well after they're submitted, and ones that
+// are valid for longer than the log allows.
+type validityPolicy struct {
+	// maxNotBeforeSkew is how far after the submission time NotBefore may be, or zero
+	// for no limit
+	maxNotBeforeSkew time.Duration
+	// maxValidity is the longest validity period accepted, or zero for no limit
+	maxValidity time.Duration
+}
+
+// parseValidityPolicy builds a validityPolicy from a log's config. Both limits are duration
+// strings as accepted by time.ParseDuration, and may be empty for no limit.
+func parseValidityPolicy(maxSkew, maxValidity string) (validityPolicy, error) {
+	var p validityPolicy
+	if len(maxSkew) > 0 {
+		d, err := time.ParseDuration(maxSkew)
+		if err != nil {
+			return validityPolicy{}, fmt.Errorf("invalid MaxNotBeforeSkew: %v", err)
+		}
+		if d <= 0 {
+			return validityPolicy{}, fmt.Errorf("MaxNotBeforeSkew must be positive, got %v", d)
+		}
+		p.maxNotBeforeSkew = d
+	}
+	if len(maxValidity) > 0 {
+		d, err := time.ParseDuration(maxValidity)
+		if err != nil {
+			return validityPolicy{}, fmt.Errorf("invalid MaxValidityPeriod: %v", err)
+		}
+		if d <= 0 {
+			return validityPolicy{}, fmt.Errorf("MaxValidityPeriod must be positive, got %v", d)
+		}
+		p.maxValidity = d
+	}
+	return p, nil
+}
+
+// check returns a PolicyError if a certificate valid from notBefore to notAfter should
+// be rejected when submitted at now.
+func (p validityPolicy) check(notBefore, notAfter, now time.Time) error {
+	if p.maxNotBeforeSkew > 0 && notBefore.After(now.Add(p.maxNotBeforeSkew)) {
+		return PolicyError{
+			Code:   rejectNotBeforeInFuture,
+			Reason: fmt.Sprintf("certificate NotBefore %v is more than %v after submission time %v", notBefore.UTC().Format(time.RFC3339), p.maxNotBeforeSkew, now.UTC().Format(time.RFC3339)),
+		}
+	}
+	if p.maxValidity > 0 && notAfter.Sub(notBefore) > p.maxValidity {
+		return PolicyError{
+			Code:   rejectValidityTooLong,
+			Reason: fmt.Sprintf("certificate validity period from %v to %v is longer than the maximum %v", notBefore.UTC().Format(time.RFC3339), notAfter.UTC().Format(time.RFC3339), p.maxValidity),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package ct
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/trillian/examples/ct/testonly"
+	"github.com/google/trillian/util"
+)
+
+func TestParseValidityPolicy(t *testing.T) {
+	var tests = []struct {
+		maxSkew, maxValidity string
+		wantErr              bool
+	}{
+		{maxSkew: "", maxValidity: ""},
+		{maxSkew: "48h", maxValidity: ""},
+		{maxSkew: "", maxValidity: "19800h"},
+		{maxSkew: "48h", maxValidity: "19800h"},
+		{maxSkew: "0s", maxValidity: "", wantErr: true},
+		{maxSkew: "", maxValidity: "-1h", wantErr: true},
+		{maxSkew: "two days", maxValidity: "", wantErr: true},
+		{maxSkew: "", maxValidity: "825d", wantErr: true},
+	}
+
+	for _, test := range tests {
+		if _, err := parseValidityPolicy(test.maxSkew, test.maxValidity); (err != nil) != test.wantErr {
+			t.Errorf("parseValidityPolicy(%q, %q)=%v, want error: %v", test.maxSkew, test.maxValidity, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidityPolicyCheck(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	p := validityPolicy{maxNotBeforeSkew: 2 * day, maxValidity: 825 * day}
+
+	var tests = []struct {
+		p                   validityPolicy
+		notBefore, notAfter time.Time
+		wantCode            string
+	}{
+		{p: validityPolicy{}, notBefore: now.Add(365 * day), notAfter: now.Add(3650 * day)},
+		{p: p, notBefore: now.Add(-day), notAfter: now.Add(90 * day)},
+		{p: p, notBefore: now.Add(2 * day), notAfter: now.Add(90 * day)},
+		{p: p, notBefore: now.Add(3 * day), notAfter: now.Add(90 * day), wantCode: rejectNotBeforeInFuture},
+		{p: p, notBefore: now, notAfter: now.Add(825 * day)},
+		{p: p, notBefore: now, notAfter: now.Add(826 * day), wantCode: rejectValidityTooLong},
+		{p: p, notBefore: now.Add(30 * day), notAfter: now.Add(3650 * day), wantCode: rejectNotBeforeInFuture},
+	}
+
+	for _, test := range tests {
+		err := test.p.check(test.notBefore, test.notAfter, now)
+		if len(test.wantCode) == 0 {
+			if err != nil {
+				t.Errorf("%+v.check(%v, %v, %v)=%v, want no error", test.p, test.notBefore, test.notAfter, now, err)
+			}
+			continue
+		}
+		perr, ok := err.(PolicyError)
+		if !ok {
+			t.Errorf("%+v.check(%v, %v, %v)=%v, want PolicyError", test.p, test.notBefore, test.notAfter, now, err)
+			continue
+		}
+		if got, want := perr.Code, test.wantCode; got != want {
+			t.Errorf("%+v.check(%v, %v, %v)=%q, want code %q", test.p, test.notBefore, test.notAfter, now, got, want)
+		}
+	}
+}
+
+func TestAddChainValidityPolicy(t *testing.T) {
+	// The leaf is valid from May 2016 to July 2019.
+	var tests = []struct {
+		now      time.Time
+		policy   validityPolicy
+		wantCode string
+	}{
+		{now: time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC), policy: validityPolicy{maxNotBeforeSkew: 48 * time.Hour}, wantCode: rejectNotBeforeInFuture},
+		{now: time.Date(2016, 7, 22, 0, 0, 0, 0, time.UTC), policy: validityPolicy{maxValidity: 825 * 24 * time.Hour}, wantCode: rejectValidityTooLong},
+	}
+
+	for _, test := range tests {
+		info := setupTest(t, []string{testonly.FakeCACertPEM})
+		info.c.timeSource = &util.FakeTimeSource{FakeTime: test.now}
+		info.c.validity = test.policy
+
+		pool := loadCertsIntoPoolOrDie(t, []string{testonly.LeafSignedByFakeIntermediateCertPEM, testonly.FakeIntermediateCertPEM})
+		recorder := makeAddChainRequest(t, info.c, createJSONChain(t, *pool))
+		if got, want := recorder.Code, http.StatusBadRequest; got != want {
+			t.Errorf("addChain()=%d (body:%v); want %d", got, recorder.Body, want)
+		}
+		if got, want := recorder.Body.String(), test.wantCode; !strings.Contains(got, want) {
+			t.Errorf("addChain() body=%q, want it to contain %q", got, want)
+		}
+		if got, want := info.c.exp.policyRejections.Get(test.wantCode).String(), "1"; got != want {
+			t.Errorf("policy-rejections[%s]=%s, want %s", test.wantCode, got, want)
+		}
+		info.mockCtrl.Finish()
+	}
+}
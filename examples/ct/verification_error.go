@@ -0,0 +1,15 @@
+package ct
+
+import "fmt"
+
+// VerificationError is returned by the tools that check a CT log when the log has been
+// caught misbehaving, as opposed to being unreachable or returning malformed responses.
+type VerificationError struct {
+	// Check is the check that failed: "sct", "signature", "consistency" or "inclusion".
+	Check string
+	Err   error
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("%s check failed: %v", e.Check, e.Err)
+}
@@ -0,0 +1,385 @@
+package ct
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/net/context"
+)
+
+// Witnesses check that a log only ever grows its tree, by verifying a consistency proof
+// from the last checkpoint they saw before cosigning a new one. Clients that require
+// cosignatures from k of a log's n witnesses can't be shown a split view unless k
+// witnesses are also compromised. Logs submit checkpoints to witnesses using the
+// tlog-witness protocol from https://c2sp.org/tlog-witness: a POST to add-checkpoint
+// whose body has the size of the witness's last checkpoint for the log, the proof and
+// the new checkpoint:
+//
+//	old 4020
+//	JD7L2... (one base64 hash of the consistency proof per line)
+//
+//	example.com/ct/log
+//	4027
+//	...
+//
+// The witness replies with its cosignature lines, or a 409 giving the size it has seen
+// if that isn't the size sent. Cosignatures use the cosignature/v1 format, where the
+// witness signs the time and the checkpoint text.
+
+const (
+	// CosignedCheckpointPath is the path of the latest checkpoint cosigned by enough
+	// witnesses, relative to the log's prefix.
+	CosignedCheckpointPath = "/cosigned-checkpoint"
+	// Path that checkpoints are sent to, relative to a witness's URL
+	witnessAddCheckpointPath = "/add-checkpoint"
+	// Content type of a witness's conflict response, which holds the size it has seen
+	contentTypeTlogSize = "text/x.tlog.size"
+	// Signature algorithm byte that identifies cosignature/v1 note keys
+	noteAlgCosignatureV1 = 4
+	// Default interval between checks for a new tree head to have cosigned
+	defaultWitnessInterval = time.Minute
+	// Deadline applied to each submission to a witness
+	defaultWitnessDeadline = 30 * time.Second
+	// Largest witness response read
+	maxWitnessResponseBytes = 64 * 1024
+)
+
+// WitnessConfig identifies a witness that cosigns a log's checkpoints.
+type WitnessConfig struct {
+	// URL is the base URL of the witness, which checkpoints are posted to at
+	// /add-checkpoint.
+	URL string
+	// VerifierKey is the witness's cosignature key in note verifier key form:
+	// <name>+<hex key hash>+<base64 of 0x04 and the Ed25519 public key>.
+	VerifierKey string
+}
+
+// witness is a witness that a log submits its checkpoints to.
+type witness struct {
+	url     string
+	name    string
+	keyHash []byte
+	key     ed25519.PublicKey
+	// size is the tree size of the last checkpoint the witness is known to have, which
+	// the next submission proves consistency from.
+	size int64
+}
+
+// parseWitness checks the config for a witness.
+func parseWitness(cfg WitnessConfig) (*witness, error) {
+	if len(cfg.URL) == 0 {
+		return nil, errors.New("witnesses need a URL")
+	}
+	parts := strings.Split(cfg.VerifierKey, "+")
+	if len(parts) != 3 || !isValidNoteName(parts[0]) {
+		return nil, fmt.Errorf("malformed witness verifier key %q", cfg.VerifierKey)
+	}
+	keyHash, err := hex.DecodeString(parts[1])
+	if err != nil || len(keyHash) != 4 {
+		return nil, fmt.Errorf("malformed key hash in witness verifier key %q", cfg.VerifierKey)
+	}
+	key, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil || len(key) != 1+ed25519.PublicKeySize {
+		return nil, fmt.Errorf("malformed key in witness verifier key %q", cfg.VerifierKey)
+	}
+	if key[0] != noteAlgCosignatureV1 {
+		return nil, fmt.Errorf("witness verifier key %q isn't a cosignature/v1 key", cfg.VerifierKey)
+	}
+	w := &witness{url: strings.TrimSuffix(cfg.URL, "/"), name: parts[0], keyHash: keyHash, key: ed25519.PublicKey(key[1:])}
+	if !bytes.Equal(noteKeyHash(w.name, noteAlgCosignatureV1, w.key), keyHash) {
+		return nil, fmt.Errorf("key hash doesn't match key in witness verifier key %q", cfg.VerifierKey)
+	}
+	return w, nil
+}
+
+// cosignatureMessage returns the message a witness signs to cosign a checkpoint at
+// timestamp, in seconds since the epoch.
+func cosignatureMessage(text string, timestamp uint64) []byte {
+	return []byte(fmt.Sprintf("cosignature/v1\ntime %d\n%s", timestamp, text))
+}
+
+// verifyCosignature checks that a note signature line from a witness is its cosignature
+// of the checkpoint text.
+func (w *witness) verifyCosignature(text, line string) error {
+	prefix := "— " + w.name + " "
+	if !strings.HasPrefix(line, prefix) {
+		return fmt.Errorf("signature line isn't from witness %s", w.name)
+	}
+	sig, err := base64.StdEncoding.DecodeString(line[len(prefix):])
+	if err != nil || len(sig) != len(w.keyHash)+8+ed25519.SignatureSize {
+		return errors.New("malformed cosignature")
+	}
+	if !bytes.Equal(sig[:len(w.keyHash)], w.keyHash) {
+		return errors.New("cosignature is from a different key")
+	}
+	timestamp := binary.BigEndian.Uint64(sig[len(w.keyHash):])
+	if !ed25519.Verify(w.key, cosignatureMessage(text, timestamp), sig[len(w.keyHash)+8:]) {
+		return errors.New("cosignature doesn't verify")
+	}
+	return nil
+}
+
+// cosigner submits each new checkpoint of a log to its witnesses, and keeps the latest
+// one that at least quorum of them cosigned.
+type cosigner struct {
+	c         LogContext
+	witnesses []*witness
+	quorum    int
+	client    *http.Client
+	done      chan struct{}
+
+	// mu guards the update state: cosigned is the latest checkpoint with enough
+	// cosignatures, if any, and size and rootHash are its tree head.
+	mu       sync.Mutex
+	size     int64
+	rootHash []byte
+	cosigned []byte
+
+	exp struct {
+		vars        *expvar.Map
+		treeSize    *expvar.Int
+		submissions *expvar.Int
+		failures    *expvar.Int
+		noQuorum    *expvar.Int
+	}
+}
+
+// newCosigner creates a cosigner for the log c, which must have a checkpoint key. A
+// quorum of zero means all the witnesses.
+func newCosigner(c LogContext, witnesses []*witness, quorum int) (*cosigner, error) {
+	if c.checkpointSigner == nil {
+		return nil, errors.New("witnesses need a checkpoint key")
+	}
+	if quorum < 0 || quorum > len(witnesses) {
+		return nil, fmt.Errorf("witness quorum %d is out of range for %d witnesses", quorum, len(witnesses))
+	}
+	if quorum == 0 {
+		quorum = len(witnesses)
+	}
+	cs := &cosigner{
+		c:         c,
+		witnesses: witnesses,
+		quorum:    quorum,
+		client:    &http.Client{Timeout: defaultWitnessDeadline},
+		done:      make(chan struct{}),
+	}
+	cs.exp.vars = new(expvar.Map).Init()
+	cs.exp.treeSize = new(expvar.Int)
+	cs.exp.vars.Set("cosigned-tree-size", cs.exp.treeSize)
+	cs.exp.submissions = new(expvar.Int)
+	cs.exp.vars.Set("submissions", cs.exp.submissions)
+	cs.exp.failures = new(expvar.Int)
+	cs.exp.vars.Set("submission-failures", cs.exp.failures)
+	cs.exp.noQuorum = new(expvar.Int)
+	cs.exp.vars.Set("no-quorum", cs.exp.noQuorum)
+	return cs, nil
+}
+
+// Start starts a goroutine that submits the latest checkpoint straight away, and then
+// checks for a new one every interval until Stop is called.
+func (cs *cosigner) Start(interval time.Duration) {
+	go func() {
+		if err := cs.update(); err != nil {
+			glog.Warningf("%s: failed to get checkpoint cosigned: %v", cs.c.logPrefix, err)
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-cs.done:
+				return
+			case <-ticker.C:
+				if err := cs.update(); err != nil {
+					glog.Warningf("%s: failed to get checkpoint cosigned: %v", cs.c.logPrefix, err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops submitting checkpoints.
+func (cs *cosigner) Stop() {
+	close(cs.done)
+}
+
+// Vars returns the statistics exported by this cosigner.
+func (cs *cosigner) Vars() *expvar.Map {
+	return cs.exp.vars
+}
+
+// latest returns the latest checkpoint with at least quorum cosignatures, or nil if
+// there isn't one yet.
+func (cs *cosigner) latest() []byte {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.cosigned
+}
+
+// update submits the latest tree head's checkpoint to the witnesses, unless it already
+// has enough cosignatures, and keeps it if enough of them cosign it. Witnesses that fail
+// are tried again on the next update.
+func (cs *cosigner) update() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	ctx, cancel := context.WithDeadline(context.Background(), getRPCDeadlineTime(cs.c, "Witness"))
+	slr, err := getLatestLogRoot(ctx, cs.c, "Witness")
+	cancel()
+	if err != nil {
+		return err
+	}
+	if cs.cosigned != nil && slr.TreeSize == cs.size && bytes.Equal(slr.RootHash, cs.rootHash) {
+		return nil
+	}
+	note, err := signCheckpoint(cs.c, *slr)
+	if err != nil {
+		return err
+	}
+	text := checkpointText(cs.c.checkpointSigner.name, slr.TreeSize, slr.RootHash)
+
+	// Each witness is only used by this goroutine, so they can be updated concurrently.
+	lines := make([]string, len(cs.witnesses))
+	var wg sync.WaitGroup
+	for i, w := range cs.witnesses {
+		wg.Add(1)
+		go func(i int, w *witness) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), defaultWitnessDeadline)
+			defer cancel()
+			cs.exp.submissions.Add(1)
+			line, err := cs.submit(ctx, w, note, text, slr.TreeSize)
+			if err != nil {
+				cs.exp.failures.Add(1)
+				glog.Warningf("%s: witness %s didn't cosign tree size %d: %v", cs.c.logPrefix, w.name, slr.TreeSize, err)
+				return
+			}
+			lines[i] = line
+		}(i, w)
+	}
+	wg.Wait()
+
+	cosigned := note
+	count := 0
+	for _, line := range lines {
+		if len(line) > 0 {
+			cosigned = append(cosigned, line+"\n"...)
+			count++
+		}
+	}
+	if count < cs.quorum {
+		cs.exp.noQuorum.Add(1)
+		return fmt.Errorf("tree size %d has %d cosignatures, want %d", slr.TreeSize, count, cs.quorum)
+	}
+	// Witnesses that missed this checkpoint get the next one.
+	cs.size, cs.rootHash, cs.cosigned = slr.TreeSize, slr.RootHash, cosigned
+	cs.exp.treeSize.Set(slr.TreeSize)
+	return nil
+}
+
+// submit sends a checkpoint to a witness, proving it consistent with the last checkpoint
+// the witness has, and returns its verified cosignature line. If the witness has a
+// different size than expected, as it will after a restart, the checkpoint is sent
+// again with a proof from that size.
+func (cs *cosigner) submit(ctx context.Context, w *witness, note []byte, text string, treeSize int64) (string, error) {
+	for attempt := 0; ; attempt++ {
+		if w.size > treeSize {
+			return "", fmt.Errorf("witness has tree size %d, larger than %d", w.size, treeSize)
+		}
+		proof, err := cs.consistencyProof(ctx, w.size, treeSize)
+		if err != nil {
+			return "", err
+		}
+		body := fmt.Sprintf("old %d\n", w.size)
+		for _, hash := range proof {
+			body += base64.StdEncoding.EncodeToString(hash) + "\n"
+		}
+		body += "\n" + string(note)
+
+		req, err := http.NewRequest(http.MethodPost, w.url+witnessAddCheckpointPath, strings.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		rsp, err := cs.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return "", err
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(rsp.Body, maxWitnessResponseBytes))
+		rsp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to read witness response: %v", err)
+		}
+
+		switch {
+		case rsp.StatusCode == http.StatusConflict && rsp.Header.Get(contentTypeHeader) == contentTypeTlogSize && attempt == 0:
+			size, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+			if err != nil || size < 0 {
+				return "", fmt.Errorf("malformed witness tree size %q", data)
+			}
+			w.size = size
+			continue
+		case rsp.StatusCode != http.StatusOK:
+			return "", fmt.Errorf("witness returned status %d: %q", rsp.StatusCode, data)
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			if err := w.verifyCosignature(text, line); err == nil {
+				w.size = treeSize
+				return line, nil
+			}
+		}
+		return "", fmt.Errorf("no valid cosignature in witness response %q", data)
+	}
+}
+
+// consistencyProof returns the proof that the tree of size second is an extension of
+// that of size first, which is empty if first is zero or the same as second.
+func (cs *cosigner) consistencyProof(ctx context.Context, first, second int64) ([][]byte, error) {
+	if first == 0 || first == second {
+		return nil, nil
+	}
+	req := trillian.GetConsistencyProofRequest{LogId: cs.c.logID, FirstTreeSize: first, SecondTreeSize: second}
+	rsp, err := cs.c.rpcClient.GetConsistencyProof(ctx, &req)
+	if err != nil {
+		return nil, fmt.Errorf("backend GetConsistencyProof request failed: %v", err)
+	}
+	if !rpcStatusOK(rsp.GetStatus()) {
+		return nil, fmt.Errorf("backend GetConsistencyProof request failed, status=%v", rsp.GetStatus())
+	}
+	if !checkAuditPath(rsp.Proof.ProofNode) {
+		return nil, fmt.Errorf("backend returned invalid proof: %v", rsp.Proof)
+	}
+	return auditPathFromProto(rsp.Proof.ProofNode), nil
+}
+
+// getCosignedCheckpoint returns the log's latest checkpoint with enough cosignatures.
+func getCosignedCheckpoint(ctx context.Context, c LogContext, w http.ResponseWriter, r *http.Request) (int, error) {
+	if c.cosigner == nil {
+		return http.StatusNotFound, errors.New("log has no witnesses")
+	}
+	note := c.cosigner.latest()
+	if note == nil {
+		return http.StatusNotFound, errors.New("no checkpoint has been cosigned yet")
+	}
+	w.Header().Set(contentTypeHeader, contentTypeNote)
+	w.Header().Set(cacheControlHeader, mutableCacheControl)
+	if _, err := w.Write(note); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to write response data: %v", err)
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,331 @@
+package ct
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"golang.org/x/crypto/ed25519"
+)
+
+// fakeWitness is a witness that cosigns any checkpoint sent with the size it last saw,
+// without checking the proof.
+type fakeWitness struct {
+	name string
+	key  ed25519.PrivateKey
+
+	mu   sync.Mutex
+	size int64
+	// status, if set, is returned instead of cosigning
+	status int
+	// proofs holds the number of proof hashes sent with each checkpoint cosigned
+	proofs []int
+}
+
+func newFakeWitness(name string, seed byte, size int64) *fakeWitness {
+	return &fakeWitness{name: name, key: ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize)), size: size}
+}
+
+func (f *fakeWitness) verifierKey() string {
+	pub := f.key.Public().(ed25519.PublicKey)
+	return fmt.Sprintf("%s+%s+%s", f.name, hex.EncodeToString(noteKeyHash(f.name, noteAlgCosignatureV1, pub)), base64.StdEncoding.EncodeToString(append([]byte{noteAlgCosignatureV1}, pub...)))
+}
+
+// cosign returns the witness's cosignature line for checkpoint text.
+func (f *fakeWitness) cosign(text string, timestamp uint64) string {
+	sig := noteKeyHash(f.name, noteAlgCosignatureV1, f.key.Public().(ed25519.PublicKey))
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], timestamp)
+	sig = append(append(sig, ts[:]...), ed25519.Sign(f.key, cosignatureMessage(text, timestamp))...)
+	return fmt.Sprintf("— %s %s", f.name, base64.StdEncoding.EncodeToString(sig))
+}
+
+func (f *fakeWitness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method != http.MethodPost || r.URL.Path != witnessAddCheckpointPath {
+		http.NotFound(w, r)
+		return
+	}
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	parts := strings.SplitN(string(body), "\n\n", 3)
+	if len(parts) != 3 {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return
+	}
+	lines := strings.Split(parts[0], "\n")
+	old, err := strconv.ParseInt(strings.TrimPrefix(lines[0], "old "), 10, 64)
+	if err != nil {
+		http.Error(w, "malformed old size", http.StatusBadRequest)
+		return
+	}
+	if old != f.size {
+		w.Header().Set(contentTypeHeader, contentTypeTlogSize)
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, "%d\n", f.size)
+		return
+	}
+	text := parts[1] + "\n"
+	size, err := strconv.ParseInt(strings.Split(text, "\n")[1], 10, 64)
+	if err != nil {
+		http.Error(w, "malformed checkpoint", http.StatusBadRequest)
+		return
+	}
+	f.size = size
+	f.proofs = append(f.proofs, len(lines)-1)
+	fmt.Fprintln(w, f.cosign(text, 1234))
+}
+
+func TestParseWitness(t *testing.T) {
+	fw := newFakeWitness("witness.example.com/w1", 1, 0)
+	other := newFakeWitness("witness.example.com/w2", 2, 0)
+	otherParts := strings.Split(other.verifierKey(), "+")
+	parts := strings.Split(fw.verifierKey(), "+")
+
+	var tests = []struct {
+		descr   string
+		cfg     WitnessConfig
+		wantErr bool
+	}{
+		{descr: "valid", cfg: WitnessConfig{URL: "https://witness.example.com/", VerifierKey: fw.verifierKey()}},
+		{descr: "no URL", cfg: WitnessConfig{VerifierKey: fw.verifierKey()}, wantErr: true},
+		{descr: "no key", cfg: WitnessConfig{URL: "https://witness.example.com"}, wantErr: true},
+		{descr: "bad hash", cfg: WitnessConfig{URL: "https://witness.example.com", VerifierKey: parts[0] + "+zzzzzzzz+" + parts[2]}, wantErr: true},
+		{descr: "wrong hash", cfg: WitnessConfig{URL: "https://witness.example.com", VerifierKey: parts[0] + "+" + otherParts[1] + "+" + parts[2]}, wantErr: true},
+		{descr: "wrong name", cfg: WitnessConfig{URL: "https://witness.example.com", VerifierKey: otherParts[0] + "+" + parts[1] + "+" + parts[2]}, wantErr: true},
+		{descr: "bad key", cfg: WitnessConfig{URL: "https://witness.example.com", VerifierKey: parts[0] + "+" + parts[1] + "+AAAA"}, wantErr: true},
+		{descr: "checkpoint key", cfg: WitnessConfig{URL: "https://witness.example.com", VerifierKey: testNoteSigner(t).VerifierKey()}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		w, err := parseWitness(test.cfg)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("parseWitness(%s)=_,%v, want error: %v", test.descr, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got, want := w.url, "https://witness.example.com"; got != want {
+			t.Errorf("parseWitness(%s).url=%q, want %q", test.descr, got, want)
+		}
+		if got, want := w.name, fw.name; got != want {
+			t.Errorf("parseWitness(%s).name=%q, want %q", test.descr, got, want)
+		}
+	}
+}
+
+func TestVerifyCosignature(t *testing.T) {
+	fw := newFakeWitness("witness.example.com/w1", 1, 0)
+	w, err := parseWitness(WitnessConfig{URL: "https://witness.example.com", VerifierKey: fw.verifierKey()})
+	if err != nil {
+		t.Fatalf("parseWitness()=_,%v, want no error", err)
+	}
+	text := checkpointText(testCheckpointOrigin, 10, bytes.Repeat([]byte{1}, 32))
+	sameName := newFakeWitness(fw.name, 2, 0)
+
+	var tests = []struct {
+		descr   string
+		text    string
+		line    string
+		wantErr bool
+	}{
+		{descr: "valid", text: text, line: fw.cosign(text, 1234)},
+		{descr: "other checkpoint", text: checkpointText(testCheckpointOrigin, 11, bytes.Repeat([]byte{1}, 32)), line: fw.cosign(text, 1234), wantErr: true},
+		{descr: "other witness", text: text, line: newFakeWitness("witness.example.com/w2", 1, 0).cosign(text, 1234), wantErr: true},
+		{descr: "other key", text: text, line: sameName.cosign(text, 1234), wantErr: true},
+		{descr: "log signature", text: text, line: "— " + fw.name + " " + base64.StdEncoding.EncodeToString(make([]byte, 68)), wantErr: true},
+		{descr: "malformed", text: text, line: "— " + fw.name + " !!!", wantErr: true},
+	}
+
+	for _, test := range tests {
+		if err := w.verifyCosignature(test.text, test.line); (err != nil) != test.wantErr {
+			t.Errorf("verifyCosignature(%s)=%v, want error: %v", test.descr, err, test.wantErr)
+		}
+	}
+}
+
+func TestCosignerUpdate(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	info.c.checkpointSigner = testNoteSigner(t)
+
+	// The second witness has seen an earlier checkpoint, and the third is down.
+	fakes := []*fakeWitness{
+		newFakeWitness("witness.example.com/w1", 1, 0),
+		newFakeWitness("witness.example.com/w2", 2, 5),
+		newFakeWitness("witness.example.com/w3", 3, 0),
+	}
+	fakes[2].status = http.StatusServiceUnavailable
+	var witnesses []*witness
+	for _, fw := range fakes {
+		server := httptest.NewServer(fw)
+		defer server.Close()
+		w, err := parseWitness(WitnessConfig{URL: server.URL, VerifierKey: fw.verifierKey()})
+		if err != nil {
+			t.Fatalf("parseWitness()=_,%v, want no error", err)
+		}
+		witnesses = append(witnesses, w)
+	}
+	cs, err := newCosigner(info.c, witnesses, 2)
+	if err != nil {
+		t.Fatalf("newCosigner()=_,%v, want no error", err)
+	}
+
+	root10 := bytes.Repeat([]byte{10}, 32)
+	proof := &trillian.GetConsistencyProofResponse{
+		Status: okStatus,
+		Proof:  &trillian.Proof{ProofNode: []*trillian.Node{{NodeHash: []byte("abcdef")}, {NodeHash: []byte("ghijkl")}}},
+	}
+	info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), gomock.Any()).Return(makeGetRootResponseForTest(12345, 10, root10), nil)
+	info.client.EXPECT().GetConsistencyProof(gomock.Any(), &trillian.GetConsistencyProofRequest{LogId: 0x42, FirstTreeSize: 5, SecondTreeSize: 10}).Return(proof, nil)
+	if err := cs.update(); err != nil {
+		t.Fatalf("update()=%v, want no error", err)
+	}
+
+	text := checkpointText(testCheckpointOrigin, 10, root10)
+	got := string(cs.latest())
+	if !strings.HasPrefix(got, text+"\n— "+testCheckpointOrigin+" ") {
+		t.Fatalf("latest()=%q, want checkpoint signed by the log", got)
+	}
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if len(lines) != 7 {
+		t.Fatalf("latest()=%q, want log signature and 2 cosignatures", got)
+	}
+	for i, line := range lines[5:] {
+		if err := witnesses[i].verifyCosignature(text, line); err != nil {
+			t.Errorf("latest() cosignature %d: %v", i, err)
+		}
+	}
+	if got, want := fmt.Sprint(fakes[0].proofs, fakes[1].proofs), "[0] [2]"; got != want {
+		t.Errorf("proof lengths sent=%s, want %s", got, want)
+	}
+	if got, want := cs.exp.failures.Value(), int64(1); got != want {
+		t.Errorf("submission-failures=%d, want %d", got, want)
+	}
+	if got, want := cs.exp.treeSize.Value(), int64(10); got != want {
+		t.Errorf("cosigned-tree-size=%d, want %d", got, want)
+	}
+
+	// The same tree head isn't submitted again.
+	info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), gomock.Any()).Return(makeGetRootResponseForTest(12345, 10, root10), nil)
+	if err := cs.update(); err != nil {
+		t.Fatalf("update()=%v, want no error", err)
+	}
+	if got, want := cs.exp.submissions.Value(), int64(3); got != want {
+		t.Errorf("submissions=%d, want %d", got, want)
+	}
+
+	// Without a quorum the previous checkpoint is kept.
+	fakes[1].status = http.StatusInternalServerError
+	info.client.EXPECT().GetLatestSignedLogRoot(deadlineMatcher(), gomock.Any()).Return(makeGetRootResponseForTest(23456, 12, bytes.Repeat([]byte{12}, 32)), nil)
+	info.client.EXPECT().GetConsistencyProof(gomock.Any(), &trillian.GetConsistencyProofRequest{LogId: 0x42, FirstTreeSize: 10, SecondTreeSize: 12}).Times(2).Return(proof, nil)
+	if err := cs.update(); err == nil {
+		t.Errorf("update()=nil, want error without a quorum")
+	}
+	if got := string(cs.latest()); !strings.HasPrefix(got, text) {
+		t.Errorf("latest()=%q, want the checkpoint for tree size 10", got)
+	}
+	if got, want := cs.exp.noQuorum.Value(), int64(1); got != want {
+		t.Errorf("no-quorum=%d, want %d", got, want)
+	}
+}
+
+func TestNewCosigner(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	witnesses := []*witness{{name: "w1"}, {name: "w2"}}
+
+	if _, err := newCosigner(info.c, witnesses, 0); err == nil {
+		t.Errorf("newCosigner() without checkpoint key=_,nil, want error")
+	}
+	info.c.checkpointSigner = testNoteSigner(t)
+	var tests = []struct {
+		quorum     int
+		wantQuorum int
+		wantErr    bool
+	}{
+		{quorum: 0, wantQuorum: 2},
+		{quorum: 1, wantQuorum: 1},
+		{quorum: 2, wantQuorum: 2},
+		{quorum: 3, wantErr: true},
+		{quorum: -1, wantErr: true},
+	}
+	for _, test := range tests {
+		cs, err := newCosigner(info.c, witnesses, test.quorum)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("newCosigner(%d)=_,%v, want error: %v", test.quorum, err, test.wantErr)
+			continue
+		}
+		if err == nil && cs.quorum != test.wantQuorum {
+			t.Errorf("newCosigner(%d).quorum=%d, want %d", test.quorum, cs.quorum, test.wantQuorum)
+		}
+	}
+}
+
+func TestGetCosignedCheckpoint(t *testing.T) {
+	info := setupTest(t, nil)
+	defer info.mockCtrl.Finish()
+	info.c.checkpointSigner = testNoteSigner(t)
+	cs, err := newCosigner(info.c, []*witness{{name: "w1"}}, 0)
+	if err != nil {
+		t.Fatalf("newCosigner()=_,%v, want no error", err)
+	}
+
+	var tests = []struct {
+		descr    string
+		cosigner *cosigner
+		cosigned string
+		want     int
+	}{
+		{descr: "no witnesses", want: http.StatusNotFound},
+		{descr: "not cosigned yet", cosigner: cs, want: http.StatusNotFound},
+		{descr: "cosigned", cosigner: cs, cosigned: "cosigned checkpoint", want: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		info.c.cosigner = test.cosigner
+		if len(test.cosigned) > 0 {
+			cs.cosigned = []byte(test.cosigned)
+		}
+		handler := appHandler{context: info.c, handler: getCosignedCheckpoint, name: "GetCosignedCheckpoint", method: http.MethodGet}
+		req, err := http.NewRequest("GET", "http://example.com/test/cosigned-checkpoint", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got := w.Code; got != test.want {
+			t.Errorf("GetCosignedCheckpoint(%s).Code=%d, want %d", test.descr, got, test.want)
+			continue
+		}
+		if test.want != http.StatusOK {
+			continue
+		}
+		if got := w.Body.String(); got != test.cosigned {
+			t.Errorf("GetCosignedCheckpoint(%s)=%q, want %q", test.descr, got, test.cosigned)
+		}
+		if got, want := w.Header().Get(contentTypeHeader), contentTypeNote; got != want {
+			t.Errorf("GetCosignedCheckpoint(%s) Content-Type=%q, want %q", test.descr, got, want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// The map_http_server binary serves the HTTP API of package mapapi for a map held by a
+// Trillian map server, signing the map heads it returns with its own key.
+package main
+
+import (
+	"expvar"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/examples/vmap/mapapi"
+	"google.golang.org/grpc"
+)
+
+var serverPortFlag = flag.Int("port", 6965, "Port to serve map HTTP requests on")
+var mapServerFlag = flag.String("map_rpc_server", "localhost:8090", "Backend map RPC server to use")
+var mapIDFlag = flag.Int64("map_id", 1, "ID of the map to serve")
+var prefixFlag = flag.String("prefix", "", "Path prefix the map API is served under")
+var rpcDeadlineFlag = flag.Duration("rpc_deadline", time.Second*10, "Deadline for backend RPC requests")
+var privateKeyFileFlag = flag.String("private_key_file", "", "File containing the PEM encoded private key map heads are signed with")
+var privateKeyPasswordFlag = flag.String("private_key_password", "", "Password for the private key")
+
+func main() {
+	flag.Parse()
+
+	km, err := crypto.LoadPasswordProtectedPrivateKey(*privateKeyFileFlag, *privateKeyPasswordFlag)
+	if err != nil {
+		glog.Fatalf("Failed to load private key: %v", err)
+	}
+
+	conn, err := grpc.Dial(*mapServerFlag, grpc.WithInsecure())
+	if err != nil {
+		glog.Fatalf("Could not connect to map RPC server: %v", err)
+	}
+	defer conn.Close()
+
+	server := mapapi.NewServer(*mapIDFlag, trillian.NewTrillianMapClient(conn), km, *rpcDeadlineFlag)
+	server.RegisterHandlers(http.DefaultServeMux, *prefixFlag)
+	expvar.Publish("map-http-rsps", server.Vars())
+
+	glog.Infof("Serving map %d on port %d", *mapIDFlag, *serverPortFlag)
+	err = http.ListenAndServe(fmt.Sprintf("localhost:%d", *serverPortFlag), nil)
+	glog.Warningf("Server exited: %v", err)
+	glog.Flush()
+}
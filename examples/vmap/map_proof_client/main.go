@@ -0,0 +1,61 @@
+// The map_proof_client binary looks up keys in a map served by map_http_server, and
+// checks the proofs that each key has the value returned, or isn't in the map.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/examples/vmap/mapapi"
+	"golang.org/x/net/context"
+)
+
+var mapURIFlag = flag.String("map_uri", "http://localhost:6965", "URI of the map HTTP API, including any prefix")
+var mapIDFlag = flag.Int64("map_id", 1, "ID of the map")
+var pubKeyFileFlag = flag.String("pub_key_file", "", "File containing the PEM encoded public key the map heads are signed with")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: map_proof_client [flags] <key> ...")
+		os.Exit(2)
+	}
+
+	pubData, err := ioutil.ReadFile(*pubKeyFileFlag)
+	if err != nil {
+		glog.Fatalf("Failed to read public key file: %v", err)
+	}
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPublicKey(string(pubData)); err != nil {
+		glog.Fatalf("Failed to parse public key: %v", err)
+	}
+	pubKey, err := km.GetPublicKey()
+	if err != nil {
+		glog.Fatal(err)
+	}
+	client, err := mapapi.NewClient(*mapURIFlag, *mapIDFlag, pubKey, nil)
+	if err != nil {
+		glog.Fatal(err)
+	}
+
+	var keys [][]byte
+	for _, arg := range flag.Args() {
+		keys = append(keys, []byte(arg))
+	}
+	rsp, err := client.GetProofs(context.Background(), keys)
+	if err != nil {
+		glog.Fatalf("Failed to look up keys: %v", err)
+	}
+	fmt.Printf("Map %d revision %d, root %x (verified)\n", rsp.MapHead.MapID, rsp.MapHead.Revision, rsp.MapHead.RootHash)
+	for _, proof := range rsp.Proofs {
+		if len(proof.Value) == 0 {
+			fmt.Printf("%s: not in map (verified)\n", proof.Key)
+			continue
+		}
+		fmt.Printf("%s: %q (verified)\n", proof.Key, proof.Value)
+	}
+}
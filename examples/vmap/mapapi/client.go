@@ -0,0 +1,157 @@
+package mapapi
+
+import (
+	"bytes"
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Client looks up keys in a map served by a Server, and checks the proofs and map head
+// signatures it returns.
+type Client struct {
+	uri        string
+	mapID      int64
+	publicKey  gocrypto.PublicKey
+	httpClient *http.Client
+	hasher     merkle.MapHasher
+}
+
+// NewClient creates a Client for the map mapID served at uri, whose map heads are signed
+// with the ECDSA or RSA key publicKey. If httpClient is nil http.DefaultClient is used.
+func NewClient(uri string, mapID int64, publicKey gocrypto.PublicKey, httpClient *http.Client) (*Client, error) {
+	switch publicKey.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		uri:        strings.TrimRight(uri, "/"),
+		mapID:      mapID,
+		publicKey:  publicKey,
+		httpClient: httpClient,
+		hasher:     merkle.NewMapHasher(merkle.NewRFC6962TreeHasher(crypto.NewSHA256())),
+	}, nil
+}
+
+// GetMapHead returns the latest map head, once its signature has been checked.
+func (c *Client) GetMapHead(ctx context.Context) (*SignedMapHead, error) {
+	var head SignedMapHead
+	if err := c.get(ctx, GetMapHeadPath, nil, &head); err != nil {
+		return nil, err
+	}
+	if err := c.VerifyMapHead(head); err != nil {
+		return nil, err
+	}
+	return &head, nil
+}
+
+// GetProofs looks up keys, which must be non-empty, in the latest revision of the map.
+// It checks that the response has a valid proof for each of them, in the order they
+// were given, and that the map head the proofs are for has a valid signature. Keys that
+// aren't in the map have no value.
+func (c *Client) GetProofs(ctx context.Context, keys [][]byte) (*GetProofsResponse, error) {
+	if len(keys) == 0 || len(keys) > MaxKeysPerRequest {
+		return nil, fmt.Errorf("can look up between 1 and %d keys at once, got %d", MaxKeysPerRequest, len(keys))
+	}
+	params := url.Values{}
+	for _, key := range keys {
+		if len(key) == 0 {
+			return nil, errors.New("can't look up an empty key")
+		}
+		params.Add("key", base64.StdEncoding.EncodeToString(key))
+	}
+	var rsp GetProofsResponse
+	if err := c.get(ctx, GetProofsPath, params, &rsp); err != nil {
+		return nil, err
+	}
+
+	if err := c.VerifyMapHead(rsp.MapHead); err != nil {
+		return nil, err
+	}
+	if got, want := len(rsp.Proofs), len(keys); got != want {
+		return nil, fmt.Errorf("got %d proofs, want %d", got, want)
+	}
+	for i, proof := range rsp.Proofs {
+		if !bytes.Equal(proof.Key, keys[i]) {
+			return nil, fmt.Errorf("proof %d is for key %x, want %x", i, proof.Key, keys[i])
+		}
+		if err := VerifyMapProof(c.hasher, proof, rsp.MapHead.RootHash); err != nil {
+			return nil, fmt.Errorf("proof for key %x doesn't verify: %v", proof.Key, err)
+		}
+	}
+	return &rsp, nil
+}
+
+// VerifyMapHead checks that head is for the client's map and is signed with its key.
+func (c *Client) VerifyMapHead(head SignedMapHead) error {
+	if head.MapID != c.mapID {
+		return fmt.Errorf("map head is for map %d, want %d", head.MapID, c.mapID)
+	}
+	input, err := MapHeadSignatureInput(head)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(input)
+
+	switch key := c.publicKey.(type) {
+	case *ecdsa.PublicKey:
+		var sig struct {
+			R, S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(head.Signature, &sig); err != nil || len(rest) > 0 {
+			return errors.New("malformed ECDSA map head signature")
+		}
+		if sig.R.Sign() <= 0 || sig.S.Sign() <= 0 || !ecdsa.Verify(key, digest[:], sig.R, sig.S) {
+			return errors.New("map head signature doesn't verify")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, gocrypto.SHA256, digest[:], head.Signature); err != nil {
+			return fmt.Errorf("map head signature doesn't verify: %v", err)
+		}
+	}
+	return nil
+}
+
+// get makes a GET request to the map for path, and parses the JSON response into rsp.
+func (c *Client) get(ctx context.Context, path string, params url.Values, rsp interface{}) error {
+	uri := c.uri + path
+	if len(params) > 0 {
+		uri += "?" + params.Encode()
+	}
+	httpRsp, err := ctxhttp.Get(ctx, c.httpClient, uri)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %v", path, err)
+	}
+	defer httpRsp.Body.Close()
+	body, err := ioutil.ReadAll(httpRsp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response from %s: %v", path, err)
+	}
+	if httpRsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request to %s failed with status %d: %s", path, httpRsp.StatusCode, bytes.TrimSpace(body))
+	}
+	if err := json.Unmarshal(body, rsp); err != nil {
+		return fmt.Errorf("failed to parse response from %s: %v", path, err)
+	}
+	return nil
+}
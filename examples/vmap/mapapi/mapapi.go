@@ -0,0 +1,85 @@
+// Package mapapi is an example map personality: an HTTP API in front of a Trillian map
+// server that returns values together with proofs that they're in the map, or proofs
+// that keys aren't in it, and signs the map roots the proofs are for. It also has a
+// client that checks the proofs and signatures before handing back any values.
+package mapapi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/google/trillian/merkle"
+)
+
+const (
+	// GetMapHeadPath is the path of the entrypoint returning the latest signed map head.
+	GetMapHeadPath = "/map/v1/get-head"
+	// GetProofsPath is the path of the entrypoint returning values and proofs for keys,
+	// given as base64 encoded key parameters.
+	GetProofsPath = "/map/v1/get-proofs"
+	// MaxKeysPerRequest is the most keys that can be looked up in a get-proofs request.
+	MaxKeysPerRequest = 100
+
+	// Prefix of the signed data of a map head, so its signatures can't be mistaken for
+	// those over other structures
+	mapHeadSignaturePrefix = "TrillianMapHead\x00"
+)
+
+// SignedMapHead is the map root that a set of proofs are for, with the personality's
+// signature over it.
+type SignedMapHead struct {
+	MapID          int64  `json:"map_id"`
+	Revision       int64  `json:"revision"`
+	TimestampNanos int64  `json:"timestamp_nanos"`
+	RootHash       []byte `json:"root_hash"`
+	// Signature is over the output of MapHeadSignatureInput, with the hash algorithm
+	// SHA-256: an ASN.1 ECDSA signature, or an RSA PKCS #1 v1.5 one.
+	Signature []byte `json:"signature"`
+}
+
+// MapProof is the value of a key, and a proof of it. If the key isn't in the map Value
+// is empty and the proof shows that the key's leaf is empty.
+type MapProof struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value,omitempty"`
+	// Inclusion holds the sibling hashes on the path from the key's leaf to the root,
+	// starting from the leaf. Empty entries are the hashes of empty subtrees.
+	Inclusion [][]byte `json:"inclusion"`
+}
+
+// GetProofsResponse is the response to a get-proofs request, with a proof for each of
+// the keys requested, in the same order.
+type GetProofsResponse struct {
+	MapHead SignedMapHead `json:"map_head"`
+	Proofs  []MapProof    `json:"proofs"`
+}
+
+// MapHeadSignatureInput returns the data signed for a map head: mapHeadSignaturePrefix,
+// then the map ID, revision and timestamp as big endian 64 bit integers, then the root
+// hash.
+func MapHeadSignatureInput(head SignedMapHead) ([]byte, error) {
+	if len(head.RootHash) != sha256.Size {
+		return nil, fmt.Errorf("bad root hash size %d, want %d", len(head.RootHash), sha256.Size)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(mapHeadSignaturePrefix)
+	for _, v := range []int64{head.MapID, head.Revision, head.TimestampNanos} {
+		binary.Write(&buf, binary.BigEndian, v)
+	}
+	buf.Write(head.RootHash)
+	return buf.Bytes(), nil
+}
+
+// VerifyMapProof checks that proof shows its key has its value, or is absent if it has
+// no value, in the map with root hash rootHash.
+func VerifyMapProof(h merkle.MapHasher, proof MapProof, rootHash []byte) error {
+	if len(proof.Key) == 0 {
+		return errors.New("proof has no key")
+	}
+	// The leaves of keys that aren't in the map have the hash of an empty value.
+	leafHash := h.HashLeaf(proof.Value)
+	return merkle.VerifyMapInclusionProof(h.HashKey(proof.Key), leafHash, rootHash, proof.Inclusion, h)
+}
@@ -0,0 +1,307 @@
+package mapapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/mockclient"
+	"github.com/google/trillian/testonly"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+const testMapID = 7
+
+// fakeMapClient serves a map held in memory, working out its root and proofs in the
+// same way as the map server does.
+type fakeMapClient struct {
+	hasher merkle.MapHasher
+	root   trillian.SignedMapRoot
+	// Values and key hashes (as big endian integers) by key
+	values map[string][]byte
+	hashes map[string]*big.Int
+}
+
+func newFakeMapClient(values map[string]string) *fakeMapClient {
+	c := &fakeMapClient{
+		hasher: merkle.NewMapHasher(merkle.NewRFC6962TreeHasher(crypto.NewSHA256())),
+		values: make(map[string][]byte),
+		hashes: make(map[string]*big.Int),
+	}
+	for k, v := range values {
+		c.values[k] = []byte(v)
+		c.hashes[k] = new(big.Int).SetBytes(c.hasher.HashKey([]byte(k)))
+	}
+	c.root = trillian.SignedMapRoot{
+		MapId:          testMapID,
+		MapRevision:    1,
+		TimestampNanos: 1234,
+		RootHash:       c.subtreeHash(c.hasher.Size()*8, c.keys()),
+	}
+	return c
+}
+
+func (c *fakeMapClient) keys() []string {
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// subtreeHash returns the hash of the subtree of the given height holding just keys,
+// which must all be under it.
+func (c *fakeMapClient) subtreeHash(height int, keys []string) []byte {
+	if len(keys) == 0 {
+		h := c.hasher.HashLeaf([]byte{})
+		for i := 0; i < height; i++ {
+			h = c.hasher.HashChildren(h, h)
+		}
+		return h
+	}
+	if height == 0 {
+		return c.hasher.HashLeaf(c.values[keys[0]])
+	}
+	var left, right []string
+	for _, k := range keys {
+		if c.hashes[k].Bit(height-1) == 0 {
+			left = append(left, k)
+		} else {
+			right = append(right, k)
+		}
+	}
+	return c.hasher.HashChildren(c.subtreeHash(height-1, left), c.subtreeHash(height-1, right))
+}
+
+// inclusionProof returns the hashes of the siblings of the path from the leaf of
+// keyHash to the root, leaving empty the hashes of empty subtrees.
+func (c *fakeMapClient) inclusionProof(keyHash []byte) [][]byte {
+	index := new(big.Int).SetBytes(keyHash)
+	proof := make([][]byte, c.hasher.Size()*8)
+	for height := range proof {
+		sibling := new(big.Int).Rsh(index, uint(height))
+		sibling.Xor(sibling, big.NewInt(1))
+		var keys []string
+		for k, h := range c.hashes {
+			if new(big.Int).Rsh(h, uint(height)).Cmp(sibling) == 0 {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) > 0 {
+			proof[height] = c.subtreeHash(height, keys)
+		}
+	}
+	return proof
+}
+
+func (c *fakeMapClient) GetLeaves(ctx context.Context, req *trillian.GetMapLeavesRequest, opts ...grpc.CallOption) (*trillian.GetMapLeavesResponse, error) {
+	if req.MapId != testMapID || req.Revision != -1 {
+		return nil, fmt.Errorf("unexpected request %v", req)
+	}
+	root := c.root
+	rsp := &trillian.GetMapLeavesResponse{MapRoot: &root}
+	for _, key := range req.Key {
+		keyHash := c.hasher.HashKey(key)
+		rsp.KeyValue = append(rsp.KeyValue, &trillian.KeyValueInclusion{
+			KeyValue:  &trillian.KeyValue{Key: key, Value: &trillian.MapLeaf{KeyHash: keyHash, LeafValue: c.values[string(key)]}},
+			Inclusion: c.inclusionProof(keyHash),
+		})
+	}
+	return rsp, nil
+}
+
+func (c *fakeMapClient) SetLeaves(ctx context.Context, req *trillian.SetMapLeavesRequest, opts ...grpc.CallOption) (*trillian.SetMapLeavesResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeMapClient) GetSignedMapRoot(ctx context.Context, req *trillian.GetSignedMapRootRequest, opts ...grpc.CallOption) (*trillian.GetSignedMapRootResponse, error) {
+	root := c.root
+	return &trillian.GetSignedMapRootResponse{MapRoot: &root}, nil
+}
+
+func newTestKeyManager(t *testing.T) *crypto.PEMKeyManager {
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPrivateKey(testonly.DemoPrivateKey, testonly.DemoPrivateKeyPass); err != nil {
+		t.Fatalf("Failed to load private key: %v", err)
+	}
+	if err := km.LoadPublicKey(testonly.DemoPublicKey); err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	return km
+}
+
+// setUpMap serves a map holding values over HTTP, and returns a client for it.
+func setUpMap(t *testing.T, values map[string]string) (*httptest.Server, *Client) {
+	mapClient := newFakeMapClient(values)
+
+	km := newTestKeyManager(t)
+	mux := http.NewServeMux()
+	NewServer(testMapID, mapClient, km, 5*time.Second).RegisterHandlers(mux, "/test")
+	ts := httptest.NewServer(mux)
+
+	pubKey, err := km.GetPublicKey()
+	if err != nil {
+		t.Fatalf("GetPublicKey()=_,%v, want no error", err)
+	}
+	client, err := NewClient(ts.URL+"/test", testMapID, pubKey, nil)
+	if err != nil {
+		t.Fatalf("NewClient()=_,%v, want no error", err)
+	}
+	return ts, client
+}
+
+func TestGetProofs(t *testing.T) {
+	values := map[string]string{"alpha": "one", "beta": "two", "gamma": "three"}
+	ts, client := setUpMap(t, values)
+	defer ts.Close()
+
+	head, err := client.GetMapHead(context.Background())
+	if err != nil {
+		t.Fatalf("GetMapHead()=_,%v, want no error", err)
+	}
+	if got, want := head.Revision, int64(1); got != want {
+		t.Errorf("GetMapHead().Revision=%d, want %d", got, want)
+	}
+
+	keys := [][]byte{[]byte("gamma"), []byte("missing"), []byte("alpha"), []byte("also-missing")}
+	rsp, err := client.GetProofs(context.Background(), keys)
+	if err != nil {
+		t.Fatalf("GetProofs()=_,%v, want no error", err)
+	}
+	if !bytes.Equal(rsp.MapHead.RootHash, head.RootHash) {
+		t.Errorf("GetProofs() map root=%x, want %x", rsp.MapHead.RootHash, head.RootHash)
+	}
+	for i, proof := range rsp.Proofs {
+		if got, want := string(proof.Value), values[string(keys[i])]; got != want {
+			t.Errorf("GetProofs() value of %s=%q, want %q", keys[i], got, want)
+		}
+	}
+
+	// The proofs and signature don't verify for anything else.
+	present, absent := rsp.Proofs[0], rsp.Proofs[1]
+	present.Value = []byte("four")
+	absent.Value = []byte("one")
+	for _, proof := range []MapProof{present, absent} {
+		if err := VerifyMapProof(client.hasher, proof, rsp.MapHead.RootHash); err == nil {
+			t.Errorf("VerifyMapProof(%s=%s)=nil, want error", proof.Key, proof.Value)
+		}
+	}
+	absent = rsp.Proofs[1]
+	absent.Key = []byte("alpha")
+	if err := VerifyMapProof(client.hasher, absent, rsp.MapHead.RootHash); err == nil {
+		t.Error("VerifyMapProof(exclusion for present key)=nil, want error")
+	}
+	badHead := rsp.MapHead
+	badHead.Revision++
+	if err := client.VerifyMapHead(badHead); err == nil {
+		t.Error("VerifyMapHead(changed head)=nil, want error")
+	}
+	badHead = rsp.MapHead
+	badHead.MapID++
+	if err := client.VerifyMapHead(badHead); err == nil {
+		t.Error("VerifyMapHead(other map)=nil, want error")
+	}
+}
+
+func TestGetProofsBadRequests(t *testing.T) {
+	ts, client := setUpMap(t, map[string]string{"alpha": "one"})
+	defer ts.Close()
+
+	var tests = []struct {
+		query string
+		want  int
+	}{
+		{query: "", want: http.StatusBadRequest},
+		{query: "?key=not-base64!", want: http.StatusBadRequest},
+		{query: "?key=", want: http.StatusBadRequest},
+		{query: "?key=YWxwaGE=" + strings.Repeat("&key=YWxwaGE=", MaxKeysPerRequest), want: http.StatusBadRequest},
+		{query: "?key=YWxwaGE=", want: http.StatusOK},
+	}
+	for _, test := range tests {
+		rsp, err := http.Get(ts.URL + "/test" + GetProofsPath + test.query)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", test.query, err)
+		}
+		rsp.Body.Close()
+		if got := rsp.StatusCode; got != test.want {
+			t.Errorf("GET %s=%d, want %d", test.query, got, test.want)
+		}
+	}
+
+	for _, keys := range [][][]byte{nil, {[]byte("")}, make([][]byte, MaxKeysPerRequest+1)} {
+		if _, err := client.GetProofs(context.Background(), keys); err == nil {
+			t.Errorf("GetProofs(%d keys)=_,nil, want error", len(keys))
+		}
+	}
+}
+
+func TestGetProofsBackendErrors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	client := mockclient.NewMockTrillianMapClient(mockCtrl)
+	mux := http.NewServeMux()
+	NewServer(testMapID, client, newTestKeyManager(t), 5*time.Second).RegisterHandlers(mux, "")
+
+	root := &trillian.SignedMapRoot{MapRevision: 3, RootHash: bytes.Repeat([]byte{1}, 32)}
+	proof := make([][]byte, 256)
+	var tests = []struct {
+		descr  string
+		rsp    *trillian.GetMapLeavesResponse
+		err    error
+		errStr string
+	}{
+		{
+			descr:  "backend-failure",
+			err:    errors.New("backendfailure"),
+			errStr: "request failed",
+		},
+		{
+			descr:  "error-status",
+			rsp:    &trillian.GetMapLeavesResponse{Status: &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_ERROR}},
+			errStr: "request failed",
+		},
+		{
+			descr:  "no-root",
+			rsp:    &trillian.GetMapLeavesResponse{},
+			errStr: "no map root",
+		},
+		{
+			descr:  "missing-key",
+			rsp:    &trillian.GetMapLeavesResponse{MapRoot: root},
+			errStr: "no proof for key",
+		},
+		{
+			descr: "short-proof",
+			rsp: &trillian.GetMapLeavesResponse{MapRoot: root, KeyValue: []*trillian.KeyValueInclusion{
+				{KeyValue: &trillian.KeyValue{Key: []byte("alpha")}, Inclusion: proof[:255]},
+			}},
+			errStr: "proof of length 255",
+		},
+	}
+	for _, test := range tests {
+		client.EXPECT().GetLeaves(gomock.Any(), &trillian.GetMapLeavesRequest{MapId: testMapID, Key: [][]byte{[]byte("alpha")}, Revision: -1}).Return(test.rsp, test.err)
+		req, err := http.NewRequest("GET", "http://example.com"+GetProofsPath+"?key=YWxwaGE=", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if got, want := w.Code, http.StatusInternalServerError; got != want {
+			t.Errorf("%s: GetProofs=%d, want %d", test.descr, got, want)
+		}
+		if !strings.Contains(w.Body.String(), test.errStr) {
+			t.Errorf("%s: GetProofs=%q, want error with %q", test.descr, w.Body.String(), test.errStr)
+		}
+	}
+}
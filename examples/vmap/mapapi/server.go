@@ -0,0 +1,218 @@
+package mapapi
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+)
+
+// Entrypoints is a list of entrypoint names as exposed in statistics.
+var Entrypoints = []string{"GetMapHead", "GetProofs"}
+
+// Server serves the HTTP API for a map.
+type Server struct {
+	mapID    int64
+	client   trillian.TrillianMapClient
+	km       crypto.KeyManager
+	deadline time.Duration
+	hasher   merkle.MapHasher
+
+	// Responses by entrypoint and HTTP status
+	rsps *expvar.Map
+}
+
+// NewServer creates a Server for the map mapID, which gets the map's contents from
+// client and signs the map heads it serves with km. Each request to the backend has
+// the given deadline.
+func NewServer(mapID int64, client trillian.TrillianMapClient, km crypto.KeyManager, deadline time.Duration) *Server {
+	s := &Server{
+		mapID:    mapID,
+		client:   client,
+		km:       km,
+		deadline: deadline,
+		hasher:   merkle.NewMapHasher(merkle.NewRFC6962TreeHasher(crypto.NewSHA256())),
+		rsps:     new(expvar.Map).Init(),
+	}
+	for _, ep := range Entrypoints {
+		s.rsps.Set(ep, new(expvar.Map).Init())
+	}
+	return s
+}
+
+// Vars returns the statistics exported by this Server.
+func (s *Server) Vars() *expvar.Map {
+	return s.rsps
+}
+
+// RegisterHandlers registers the map's entrypoints on mux under prefix.
+func (s *Server) RegisterHandlers(mux *http.ServeMux, prefix string) {
+	prefix = strings.TrimRight(prefix, "/")
+	if len(prefix) > 0 && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	mux.Handle(prefix+GetMapHeadPath, handler{server: s, name: "GetMapHead", handle: getMapHead})
+	mux.Handle(prefix+GetProofsPath, handler{server: s, name: "GetProofs", handle: getProofs})
+}
+
+// handler binds a Server to one of its entrypoints. The entrypoint returns the HTTP
+// status, and an error if the request failed.
+type handler struct {
+	server *Server
+	name   string
+	handle func(ctx context.Context, s *Server, w http.ResponseWriter, r *http.Request) (int, error)
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status, err := h.serve(w, r)
+	if e, ok := h.server.rsps.Get(h.name).(*expvar.Map); ok {
+		e.Add(strconv.Itoa(status), 1)
+	}
+	if err != nil {
+		glog.V(1).Infof("map{%d}: %s failed: %v", h.server.mapID, h.name, err)
+		http.Error(w, fmt.Sprintf("%s\n%v", http.StatusText(status), err), status)
+	}
+}
+
+func (h handler) serve(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodGet {
+		return http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", r.Method)
+	}
+	if err := r.ParseForm(); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to parse form data: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), h.server.deadline)
+	defer cancel()
+	return h.handle(ctx, h.server, w, r)
+}
+
+func getMapHead(ctx context.Context, s *Server, w http.ResponseWriter, r *http.Request) (int, error) {
+	rsp, err := s.client.GetSignedMapRoot(ctx, &trillian.GetSignedMapRootRequest{MapId: s.mapID})
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("backend GetSignedMapRoot request failed: %v", err)
+	}
+	if !statusOK(rsp.GetStatus()) {
+		return http.StatusInternalServerError, fmt.Errorf("backend GetSignedMapRoot request failed, status=%v", rsp.GetStatus())
+	}
+	head, err := s.signMapHead(rsp.GetMapRoot())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return writeJSON(w, head)
+}
+
+func getProofs(ctx context.Context, s *Server, w http.ResponseWriter, r *http.Request) (int, error) {
+	params := r.Form["key"]
+	if len(params) == 0 {
+		return http.StatusBadRequest, errors.New("no keys in request")
+	}
+	if len(params) > MaxKeysPerRequest {
+		return http.StatusBadRequest, fmt.Errorf("too many keys in request: %d, limit is %d", len(params), MaxKeysPerRequest)
+	}
+	keys := make([][]byte, 0, len(params))
+	for _, param := range params {
+		key, err := base64.StdEncoding.DecodeString(param)
+		if err != nil || len(key) == 0 {
+			return http.StatusBadRequest, fmt.Errorf("malformed key %q", param)
+		}
+		keys = append(keys, key)
+	}
+
+	rsp, err := s.client.GetLeaves(ctx, &trillian.GetMapLeavesRequest{MapId: s.mapID, Key: keys, Revision: -1})
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("backend GetLeaves request failed: %v", err)
+	}
+	if !statusOK(rsp.GetStatus()) {
+		return http.StatusInternalServerError, fmt.Errorf("backend GetLeaves request failed, status=%v", rsp.GetStatus())
+	}
+	head, err := s.signMapHead(rsp.GetMapRoot())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// Return the proofs in the order the keys were requested, and check there's one for
+	// each key, so clients aren't left unable to tell whether a key is present.
+	inclusions := make(map[string]*trillian.KeyValueInclusion)
+	for _, kvi := range rsp.KeyValue {
+		if kvi.GetKeyValue() == nil {
+			return http.StatusInternalServerError, errors.New("backend returned a proof with no key")
+		}
+		inclusions[string(kvi.KeyValue.Key)] = kvi
+	}
+	jsonRsp := GetProofsResponse{MapHead: *head, Proofs: make([]MapProof, 0, len(keys))}
+	for _, key := range keys {
+		kvi, ok := inclusions[string(key)]
+		if !ok {
+			return http.StatusInternalServerError, fmt.Errorf("backend returned no proof for key %x", key)
+		}
+		if got, want := len(kvi.Inclusion), s.hasher.Size()*8; got != want {
+			return http.StatusInternalServerError, fmt.Errorf("backend returned proof of length %d for key %x, want %d", got, key, want)
+		}
+		proof := MapProof{Key: key, Inclusion: kvi.Inclusion}
+		if value := kvi.KeyValue.GetValue(); value != nil {
+			proof.Value = value.LeafValue
+		}
+		jsonRsp.Proofs = append(jsonRsp.Proofs, proof)
+	}
+	return writeJSON(w, jsonRsp)
+}
+
+// signMapHead signs the map head for a root from the backend.
+func (s *Server) signMapHead(root *trillian.SignedMapRoot) (*SignedMapHead, error) {
+	if root == nil {
+		return nil, errors.New("no map root returned")
+	}
+	if hashSize := len(root.RootHash); hashSize != sha256.Size {
+		return nil, fmt.Errorf("bad hash size from backend expecting: %d got %d", sha256.Size, hashSize)
+	}
+	head := SignedMapHead{
+		MapID:          s.mapID,
+		Revision:       root.MapRevision,
+		TimestampNanos: root.TimestampNanos,
+		RootHash:       root.RootHash,
+	}
+	input, err := MapHeadSignatureInput(head)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := s.km.Signer()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signer: %v", err)
+	}
+	sig, err := crypto.NewSigner(crypto.NewSHA256(), s.km.SignatureAlgorithm(), signer).Sign(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign map head: %v", err)
+	}
+	head.Signature = sig.Signature
+	return &head, nil
+}
+
+// statusOK returns true if the backend didn't report an error. The map server doesn't
+// always fill in the status, so a missing one is OK.
+func statusOK(status *trillian.TrillianApiStatus) bool {
+	return status == nil || status.StatusCode == trillian.TrillianApiStatusCode_OK
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) (int, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to marshal response: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to write response data: %v", err)
+	}
+	return http.StatusOK, nil
+}
@@ -1,31 +1,130 @@
 package builtin
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io/ioutil"
 
 	_ "github.com/go-sql-driver/mysql" // Load MySQL driver
 
 	"github.com/google/trillian/extension"
 	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/memory"
 	"github.com/google/trillian/storage/mysql"
 )
 
+var storageTypeFlag = flag.String("storage_type", "mysql", "Which type of storage to use: mysql, or memory for a process-local store")
 var mysqlURIFlag = flag.String("mysql_uri", "test:zaphod@tcp(127.0.0.1:3306)/test", "uri to use with mysql storage")
+var storageRoutesFileFlag = flag.String("storage_routes_file", "", "If set, JSON file listing trees to keep in storage other than that set by --storage_type and --mysql_uri, which is used for the rest")
 
 // Default implementation of extension.Registry.
-type defaultRegistry struct{}
+type defaultRegistry struct {
+	mysqlURI string
+}
 
 func (r defaultRegistry) GetLogStorage(treeID int64) (storage.LogStorage, error) {
-	return mysql.NewLogStorage(treeID, *mysqlURIFlag)
+	return mysql.NewLogStorage(treeID, r.mysqlURI)
 }
 
 func (r defaultRegistry) GetMapStorage(treeID int64) (storage.MapStorage, error) {
-	return mysql.NewMapStorage(treeID, *mysqlURIFlag)
+	return mysql.NewMapStorage(treeID, r.mysqlURI)
+}
+
+// StorageRoute is the config of a route in --storage_routes_file, which puts a set of trees
+// in their own storage, e.g. so a large log can have a database to itself.
+type StorageRoute struct {
+	// Label names the route in errors.
+	Label string
+	// TreeIDs lists trees on the route, and MinTreeID and MaxTreeID, if MaxTreeID isn't
+	// zero, add the range of trees [MinTreeID, MaxTreeID].
+	TreeIDs   []int64
+	MinTreeID int64
+	MaxTreeID int64
+	// StorageType and MySQLURI configure the route's storage as --storage_type and
+	// --mysql_uri do. StorageType defaults to mysql.
+	StorageType string
+	MySQLURI    string
 }
 
 // NewDefaultExtensionRegistry returns the default extension.Registry implementation, which is
 // backed by a MySQL database and configured via flags.
 // The returned registry is wraped in a cached registry.
+// If --storage_type=memory the registry is instead backed by an in-memory store, which is
+// lost when the process exits and can't be shared with other processes.
+// If --storage_routes_file is set the trees listed in it use the storage given there.
 func NewDefaultExtensionRegistry() (extension.Registry, error) {
-	return extension.NewCachedRegistry(defaultRegistry{}), nil
+	registries := make(map[string]extension.Registry)
+	registry, err := newStorageRegistry(*storageTypeFlag, *mysqlURIFlag, registries)
+	if err != nil {
+		return nil, err
+	}
+	if len(*storageRoutesFileFlag) == 0 {
+		return registry, nil
+	}
+
+	routes, err := loadStorageRoutes(*storageRoutesFileFlag, registries)
+	if err != nil {
+		return nil, err
+	}
+	return extension.NewRoutingRegistry(routes, registry)
+}
+
+// newStorageRegistry returns a registry for a storage type and MySQL URI. Registries are
+// shared through registries, so routes to the same storage use the same connections.
+func newStorageRegistry(storageType, mysqlURI string, registries map[string]extension.Registry) (extension.Registry, error) {
+	key := storageType
+	if storageType == "mysql" {
+		key += ":" + mysqlURI
+	}
+	if registry, ok := registries[key]; ok {
+		return registry, nil
+	}
+
+	var registry extension.Registry
+	switch storageType {
+	case "mysql":
+		registry = extension.NewCachedRegistry(defaultRegistry{mysqlURI: mysqlURI})
+	case "memory":
+		registry = memory.NewStorage()
+	default:
+		return nil, fmt.Errorf("unknown storage type: %s", storageType)
+	}
+	registries[key] = registry
+	return registry, nil
+}
+
+// loadStorageRoutes reads the routes in a --storage_routes_file.
+func loadStorageRoutes(filename string, registries map[string]extension.Registry) ([]extension.Route, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage routes: %v", err)
+	}
+	var cfg []StorageRoute
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse storage routes: %v", err)
+	}
+
+	var routes []extension.Route
+	for i, c := range cfg {
+		storageType := c.StorageType
+		if len(storageType) == 0 {
+			storageType = "mysql"
+		}
+		if storageType == "mysql" && len(c.MySQLURI) == 0 {
+			return nil, fmt.Errorf("storage route %d (%s) needs a MySQLURI", i, c.Label)
+		}
+		registry, err := newStorageRegistry(storageType, c.MySQLURI, registries)
+		if err != nil {
+			return nil, fmt.Errorf("storage route %d (%s): %v", i, c.Label, err)
+		}
+		routes = append(routes, extension.Route{
+			Label:     c.Label,
+			TreeIDs:   c.TreeIDs,
+			MinTreeID: c.MinTreeID,
+			MaxTreeID: c.MaxTreeID,
+			Registry:  registry,
+		})
+	}
+	return routes, nil
 }
@@ -0,0 +1,179 @@
+package extension
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/trillian/storage"
+)
+
+// Route sends the storage for a set of trees to a registry of its own, e.g. one backed by
+// a separate database, so that trees can be scaled independently.
+type Route struct {
+	// Label names the route in errors, e.g. "public-ct-log".
+	Label string
+	// TreeIDs lists trees whose storage comes from Registry.
+	TreeIDs []int64
+	// MinTreeID and MaxTreeID, if MaxTreeID isn't zero, also send the trees with IDs in
+	// [MinTreeID, MaxTreeID] to Registry.
+	MinTreeID int64
+	MaxTreeID int64
+	// Registry provides the storage for the trees on this route.
+	Registry Registry
+}
+
+// matches returns true if treeID is on the route.
+func (r Route) matches(treeID int64) bool {
+	for _, id := range r.TreeIDs {
+		if id == treeID {
+			return true
+		}
+	}
+	return r.MaxTreeID != 0 && treeID >= r.MinTreeID && treeID <= r.MaxTreeID
+}
+
+// routingRegistry picks the registry for each tree from a list of routes. Trees that
+// aren't on any route use the fallback registry.
+type routingRegistry struct {
+	routes   []Route
+	fallback Registry
+}
+
+// NewRoutingRegistry returns a Registry that gets the storage for each tree from the first
+// of routes that the tree is on, or from fallback if it's on none of them. This is
+// transparent to the servers: a tree ID of zero, which they use for operations that
+// aren't specific to a tree such as listing the active logs, gets storage from fallback
+// that lists the logs in all the routes' storage.
+func NewRoutingRegistry(routes []Route, fallback Registry) (Registry, error) {
+	if fallback == nil {
+		return nil, errors.New("routing registry needs a fallback registry")
+	}
+	for i, route := range routes {
+		if route.Registry == nil {
+			return nil, fmt.Errorf("route %d (%s) has no registry", i, route.Label)
+		}
+		if len(route.TreeIDs) == 0 && route.MaxTreeID == 0 {
+			return nil, fmt.Errorf("route %d (%s) has no trees", i, route.Label)
+		}
+		if route.MaxTreeID != 0 && route.MinTreeID > route.MaxTreeID {
+			return nil, fmt.Errorf("route %d (%s) has MinTreeID %d greater than MaxTreeID %d", i, route.Label, route.MinTreeID, route.MaxTreeID)
+		}
+		if route.matches(0) {
+			return nil, fmt.Errorf("route %d (%s) includes tree ID 0, which is reserved", i, route.Label)
+		}
+	}
+	return &routingRegistry{routes: routes, fallback: fallback}, nil
+}
+
+// routeFor returns the index of the route treeID is on, or -1 if it's on none.
+func (r *routingRegistry) routeFor(treeID int64) int {
+	for i, route := range r.routes {
+		if route.matches(treeID) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *routingRegistry) registryFor(treeID int64) Registry {
+	if i := r.routeFor(treeID); i >= 0 {
+		return r.routes[i].Registry
+	}
+	return r.fallback
+}
+
+func (r *routingRegistry) GetLogStorage(treeID int64) (storage.LogStorage, error) {
+	if treeID == 0 {
+		s, err := r.fallback.GetLogStorage(0)
+		if err != nil {
+			return nil, err
+		}
+		return &routingLogStorage{LogStorage: s, registry: r}, nil
+	}
+	return r.registryFor(treeID).GetLogStorage(treeID)
+}
+
+func (r *routingRegistry) GetMapStorage(treeID int64) (storage.MapStorage, error) {
+	return r.registryFor(treeID).GetMapStorage(treeID)
+}
+
+// routingLogStorage is the fallback's storage for tree ID zero, with transactions that
+// list the active logs from all the routes.
+type routingLogStorage struct {
+	storage.LogStorage
+	registry *routingRegistry
+}
+
+func (s *routingLogStorage) Begin() (storage.LogTX, error) {
+	tx, err := s.LogStorage.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &routingLogTX{LogTX: tx, registry: s.registry}, nil
+}
+
+// routingLogTX lists the active logs in the fallback's storage and in each route's. Only
+// the logs a storage would be used for are taken from it, so a stale entry for a tree
+// that has been moved to another route isn't reported twice.
+type routingLogTX struct {
+	storage.LogTX
+	registry *routingRegistry
+}
+
+// GetActiveLogIDs returns a list of the IDs of all the logs in all the routes.
+func (t *routingLogTX) GetActiveLogIDs() ([]int64, error) {
+	return t.listLogs(storage.LogTX.GetActiveLogIDs)
+}
+
+// GetActiveLogIDsWithPendingWork returns a list of the IDs of the logs in all the routes
+// that have queued leaves.
+func (t *routingLogTX) GetActiveLogIDsWithPendingWork() ([]int64, error) {
+	return t.listLogs(storage.LogTX.GetActiveLogIDsWithPendingWork)
+}
+
+func (t *routingLogTX) listLogs(list func(storage.LogTX) ([]int64, error)) ([]int64, error) {
+	ids, err := list(t.LogTX)
+	if err != nil {
+		return nil, err
+	}
+	var result []int64
+	for _, id := range ids {
+		if t.registry.routeFor(id) < 0 {
+			result = append(result, id)
+		}
+	}
+
+	for i, route := range t.registry.routes {
+		ids, err := listRouteLogs(route, list)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list logs for route %s: %v", route.Label, err)
+		}
+		for _, id := range ids {
+			if t.registry.routeFor(id) == i {
+				result = append(result, id)
+			}
+		}
+	}
+	return result, nil
+}
+
+// listRouteLogs lists logs in a route's storage in a transaction of its own.
+func listRouteLogs(route Route, list func(storage.LogTX) ([]int64, error)) ([]int64, error) {
+	s, err := route.Registry.GetLogStorage(0)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.Begin()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := list(tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
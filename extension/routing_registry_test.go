@@ -0,0 +1,162 @@
+package extension
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian/storage"
+)
+
+func TestNewRoutingRegistry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	registry := NewMockRegistry(ctrl)
+
+	var tests = []struct {
+		routes   []Route
+		fallback Registry
+		wantErr  bool
+	}{
+		{routes: nil, fallback: registry},
+		{routes: []Route{{TreeIDs: []int64{1}, Registry: registry}}, fallback: registry},
+		{routes: []Route{{MinTreeID: 10, MaxTreeID: 20, Registry: registry}}, fallback: registry},
+		{routes: nil, fallback: nil, wantErr: true},
+		{routes: []Route{{TreeIDs: []int64{1}}}, fallback: registry, wantErr: true},
+		{routes: []Route{{Registry: registry}}, fallback: registry, wantErr: true},
+		{routes: []Route{{MinTreeID: 20, MaxTreeID: 10, Registry: registry}}, fallback: registry, wantErr: true},
+		{routes: []Route{{TreeIDs: []int64{0}, Registry: registry}}, fallback: registry, wantErr: true},
+		{routes: []Route{{MinTreeID: -5, MaxTreeID: 5, Registry: registry}}, fallback: registry, wantErr: true},
+	}
+	for _, test := range tests {
+		_, err := NewRoutingRegistry(test.routes, test.fallback)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("NewRoutingRegistry(%+v)=_,%v, want error: %v", test.routes, err, test.wantErr)
+		}
+	}
+}
+
+func TestRoutingRegistryGetStorage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fallback := NewMockRegistry(ctrl)
+	big := NewMockRegistry(ctrl)
+	small := NewMockRegistry(ctrl)
+	routingRegistry, err := NewRoutingRegistry([]Route{
+		{Label: "big", TreeIDs: []int64{7}, Registry: big},
+		{Label: "small", TreeIDs: []int64{7, 8}, MinTreeID: 100, MaxTreeID: 199, Registry: small},
+	}, fallback)
+	if err != nil {
+		t.Fatalf("NewRoutingRegistry()=_,%v, want no error", err)
+	}
+
+	var tests = []struct {
+		treeID int64
+		want   *MockRegistry
+	}{
+		{1, fallback},
+		{7, big}, // The first matching route is used.
+		{8, small},
+		{100, small},
+		{150, small},
+		{199, small},
+		{200, fallback},
+		{99, fallback},
+	}
+	for _, test := range tests {
+		ls := storage.NewMockLogStorage(ctrl)
+		test.want.EXPECT().GetLogStorage(test.treeID).Return(ls, nil)
+		if got, err := routingRegistry.GetLogStorage(test.treeID); err != nil || got != ls {
+			t.Errorf("GetLogStorage(%v) = (%v, %v), want (%v, nil)", test.treeID, got, err, ls)
+		}
+
+		ms := storage.NewMockMapStorage(ctrl)
+		test.want.EXPECT().GetMapStorage(test.treeID).Return(ms, nil)
+		if got, err := routingRegistry.GetMapStorage(test.treeID); err != nil || got != ms {
+			t.Errorf("GetMapStorage(%v) = (%v, %v), want (%v, nil)", test.treeID, got, err, ms)
+		}
+	}
+}
+
+// expectActiveLogs sets up registry to list ids as the active logs for tree ID zero.
+func expectActiveLogs(ctrl *gomock.Controller, registry *MockRegistry, ids []int64, err error) *storage.MockLogTX {
+	ls := storage.NewMockLogStorage(ctrl)
+	tx := storage.NewMockLogTX(ctrl)
+	registry.EXPECT().GetLogStorage(int64(0)).Return(ls, nil)
+	ls.EXPECT().Begin().Return(tx, nil)
+	tx.EXPECT().GetActiveLogIDs().Return(ids, err)
+	return tx
+}
+
+func TestRoutingRegistryGetActiveLogIDs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fallback := NewMockRegistry(ctrl)
+	big := NewMockRegistry(ctrl)
+	small := NewMockRegistry(ctrl)
+	routingRegistry, err := NewRoutingRegistry([]Route{
+		{Label: "big", TreeIDs: []int64{7}, Registry: big},
+		{Label: "small", MinTreeID: 100, MaxTreeID: 199, Registry: small},
+	}, fallback)
+	if err != nil {
+		t.Fatalf("NewRoutingRegistry()=_,%v, want no error", err)
+	}
+
+	// Logs are only taken from the storage they're routed to, so the stale copies of 7
+	// and 150 in the fallback, and of 8 in the small route, are ignored.
+	fallbackTX := expectActiveLogs(ctrl, fallback, []int64{1, 7, 2, 150}, nil)
+	expectActiveLogs(ctrl, big, []int64{7}, nil).EXPECT().Commit().Return(nil)
+	expectActiveLogs(ctrl, small, []int64{150, 8, 100}, nil).EXPECT().Commit().Return(nil)
+
+	ls, err := routingRegistry.GetLogStorage(0)
+	if err != nil {
+		t.Fatalf("GetLogStorage(0) = (_, %v)", err)
+	}
+	tx, err := ls.Begin()
+	if err != nil {
+		t.Fatalf("Begin() = (_, %v)", err)
+	}
+	got, err := tx.GetActiveLogIDs()
+	if err != nil {
+		t.Fatalf("GetActiveLogIDs() = (_, %v)", err)
+	}
+	if want := []int64{1, 2, 7, 150, 100}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetActiveLogIDs() = (%v, nil), want %v", got, want)
+	}
+
+	// Other methods go to the fallback's transaction.
+	fallbackTX.EXPECT().Commit().Return(nil)
+	if err := tx.Commit(); err != nil {
+		t.Errorf("Commit() = %v", err)
+	}
+}
+
+func TestRoutingRegistryGetActiveLogIDsError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fallback := NewMockRegistry(ctrl)
+	big := NewMockRegistry(ctrl)
+	routingRegistry, err := NewRoutingRegistry([]Route{{Label: "big", TreeIDs: []int64{7}, Registry: big}}, fallback)
+	if err != nil {
+		t.Fatalf("NewRoutingRegistry()=_,%v, want no error", err)
+	}
+
+	expectActiveLogs(ctrl, fallback, []int64{1}, nil)
+	expectActiveLogs(ctrl, big, nil, errors.New("database down")).EXPECT().Rollback().Return(nil)
+
+	ls, err := routingRegistry.GetLogStorage(0)
+	if err != nil {
+		t.Fatalf("GetLogStorage(0) = (_, %v)", err)
+	}
+	tx, err := ls.Begin()
+	if err != nil {
+		t.Fatalf("Begin() = (_, %v)", err)
+	}
+	if got, err := tx.GetActiveLogIDs(); err == nil {
+		t.Errorf("GetActiveLogIDs() = (%v, nil), want error", got)
+	}
+}
@@ -13,7 +13,7 @@ ${SCRIPTS_DIR}/createlog.sh ${TEST_TREE_ID}
 echo "Starting Log RPC server on port ${RPC_PORT}"
 pushd ${TRILLIAN_ROOT} > /dev/null
 go build ${GOFLAGS} ./server/trillian_log_server/
-./trillian_log_server --private_key_password=towel --private_key_file=${TESTDATA}/log-rpc-server.privkey.pem --port ${RPC_PORT} --signer_interval="1s" --sequencer_sleep_between_runs="1s" --batch_size=100 &
+./trillian_log_server --private_key_password=towel --private_key_file=${TESTDATA}/log-rpc-server.privkey.pem --port ${RPC_PORT} --config=${TESTDATA}/log_server_config.json &
 RPC_SERVER_PID=$!
 popd > /dev/null
 
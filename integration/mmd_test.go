@@ -0,0 +1,237 @@
+package integration
+
+// Unlike the other tests here this one has no build tag. It runs the log server and
+// sequencer in-process on memory storage, so it needs no servers or database and is run
+// by a plain go test.
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/server"
+	"github.com/google/trillian/storage/memory"
+	"github.com/google/trillian/testonly"
+	"github.com/google/trillian/util"
+)
+
+const (
+	mmdLogID = int64(1)
+	// mmd is the maximum merge delay of the simulated log: every leaf queued at T must be
+	// in a tree head with a timestamp no later than T+mmd.
+	mmd = 30 * time.Second
+	// sequencerInterval is how often the sequencer runs, if storage lets it keep up.
+	sequencerInterval = time.Second
+)
+
+var mmdStartTime = time.Date(2016, 6, 28, 13, 40, 12, 0, time.UTC)
+
+// mmdScenario describes a simulated run of the log. Leaves arrive at a steady rate and
+// are queued at the start of each round, which then runs a sequencer pass.
+type mmdScenario struct {
+	name           string
+	leavesPerSec   int
+	rounds         int
+	batchSize      int
+	guardWindow    time.Duration
+	storageLatency time.Duration
+	// Storage takes spikeLatency instead during rounds [spikeFrom, spikeTo).
+	spikeFrom, spikeTo int
+	spikeLatency       time.Duration
+	wantMissed         bool
+}
+
+// mmdSimulation is the state of a simulated run.
+type mmdSimulation struct {
+	scenario  mmdScenario
+	clock     *util.ManualTimeSource
+	latency   *testonly.StorageLatency
+	logServer *server.TrillianLogRPCServer
+	manager   *server.LogOperationManager
+
+	// queued holds the time each leaf not yet seen in the tree was queued, by its value.
+	queued    map[string]time.Time
+	submitted int
+	treeSize  int64
+	// missed describes the leaves that weren't merged within the MMD.
+	missed []string
+}
+
+func newMMDSimulation(km crypto.KeyManager, scenario mmdScenario) (*mmdSimulation, error) {
+	clock := util.NewManualTimeSource(mmdStartTime)
+	latency := testonly.NewStorageLatency(clock, scenario.storageLatency)
+	s := memory.NewStorage()
+	if err := s.CreateLog(mmdLogID, memory.TreeOptions{}); err != nil {
+		return nil, err
+	}
+	registry := testonly.NewRegistryWithLogProvider(latency.LogProvider(s.GetLogStorage))
+
+	sm := server.NewSequencerManager(km, registry, scenario.guardWindow)
+	manager := server.NewLogOperationManager(context.Background(), registry, scenario.batchSize, sequencerInterval, sequencerInterval, clock, sm)
+	return &mmdSimulation{
+		scenario:  scenario,
+		clock:     clock,
+		latency:   latency,
+		logServer: server.NewTrillianLogRPCServer(registry, clock),
+		manager:   manager,
+		queued:    make(map[string]time.Time),
+	}, nil
+}
+
+// run simulates the scenario, followed by enough rounds without new leaves for the MMD
+// of the last ones to expire.
+func (m *mmdSimulation) run(ctx context.Context) error {
+	// The first pass creates the log's initial tree head.
+	if m.manager.RunOnce() {
+		return fmt.Errorf("RunOnce()=true, want false")
+	}
+	lastQueued := m.clock.Now()
+	for round := 0; round < m.scenario.rounds || (len(m.queued) > 0 && !m.clock.Now().After(lastQueued.Add(mmd))); round++ {
+		start := m.clock.Now()
+		if round >= m.scenario.spikeFrom && round < m.scenario.spikeTo {
+			m.latency.SetLatency(m.scenario.spikeLatency)
+		} else {
+			m.latency.SetLatency(m.scenario.storageLatency)
+		}
+
+		if round < m.scenario.rounds {
+			if err := m.queueArrivals(ctx, start); err != nil {
+				return err
+			}
+			lastQueued = start
+		}
+		if m.manager.RunOnce() {
+			return fmt.Errorf("RunOnce()=true in round %d, want false", round)
+		}
+		if err := m.checkMerged(ctx); err != nil {
+			return err
+		}
+
+		// The next pass is due an interval after this one started, or straight away if
+		// this one overran.
+		if next := start.Add(sequencerInterval); m.clock.Now().Before(next) {
+			m.clock.Set(next)
+		}
+	}
+
+	for value, queuedAt := range m.queued {
+		m.missed = append(m.missed, fmt.Sprintf("%s queued at %v was never merged", value, queuedAt))
+	}
+	return nil
+}
+
+// queueArrivals queues the leaves that have arrived since the previous round.
+func (m *mmdSimulation) queueArrivals(ctx context.Context, now time.Time) error {
+	arrived := int(now.Sub(mmdStartTime).Seconds() * float64(m.scenario.leavesPerSec))
+	if arrived <= m.submitted {
+		return nil
+	}
+
+	leaves := make([]*trillian.LogLeaf, 0, arrived-m.submitted)
+	for i := m.submitted; i < arrived; i++ {
+		value := []byte(fmt.Sprintf("leaf-%d", i))
+		leaves = append(leaves, &trillian.LogLeaf{LeafValue: value, LeafValueHash: crypto.NewSHA256().Digest(value)})
+	}
+	rsp, err := m.logServer.QueueLeaves(ctx, &trillian.QueueLeavesRequest{LogId: mmdLogID, Leaves: leaves})
+	if err != nil {
+		return fmt.Errorf("QueueLeaves()=_,%v, want no error", err)
+	}
+	if got, want := rsp.Status.StatusCode, trillian.TrillianApiStatusCode_OK; got != want {
+		return fmt.Errorf("QueueLeaves()=%v, want %v", got, want)
+	}
+	for _, leaf := range leaves {
+		m.queued[string(leaf.LeafValue)] = now
+	}
+	m.submitted = arrived
+	return nil
+}
+
+// checkMerged finds the leaves merged into the latest tree head, and notes those that
+// took longer than the MMD.
+func (m *mmdSimulation) checkMerged(ctx context.Context) error {
+	rsp, err := m.logServer.GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: mmdLogID})
+	if err != nil {
+		return fmt.Errorf("GetLatestSignedLogRoot()=_,%v, want no error", err)
+	}
+	root := rsp.SignedLogRoot
+	if root.TreeSize <= m.treeSize {
+		return nil
+	}
+	if got, now := time.Unix(0, root.TimestampNanos), m.clock.Now(); got.After(now) {
+		return fmt.Errorf("tree head timestamp %v is after the current time %v", got, now)
+	}
+
+	indices := make([]int64, 0, root.TreeSize-m.treeSize)
+	for i := m.treeSize; i < root.TreeSize; i++ {
+		indices = append(indices, i)
+	}
+	leavesRsp, err := m.logServer.GetLeavesByIndex(ctx, &trillian.GetLeavesByIndexRequest{LogId: mmdLogID, LeafIndex: indices})
+	if err != nil {
+		return fmt.Errorf("GetLeavesByIndex()=_,%v, want no error", err)
+	}
+	if got, want := len(leavesRsp.Leaves), len(indices); got != want {
+		return fmt.Errorf("GetLeavesByIndex() returned %d leaves, want %d", got, want)
+	}
+
+	merged := time.Unix(0, root.TimestampNanos)
+	for _, leaf := range leavesRsp.Leaves {
+		value := string(leaf.LeafValue)
+		queuedAt, ok := m.queued[value]
+		if !ok {
+			return fmt.Errorf("leaf %d (%s) merged but not queued, or merged twice", leaf.LeafIndex, value)
+		}
+		delete(m.queued, value)
+		if delay := merged.Sub(queuedAt); delay > mmd {
+			m.missed = append(m.missed, fmt.Sprintf("%s queued at %v was merged after %v", value, queuedAt, delay))
+		}
+	}
+	m.treeSize = root.TreeSize
+	return nil
+}
+
+func TestMaximumMergeDelay(t *testing.T) {
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPrivateKey(testonly.DemoPrivateKey, testonly.DemoPrivateKeyPass); err != nil {
+		t.Fatalf("LoadPrivateKey()=%v, want no error", err)
+	}
+
+	var tests = []mmdScenario{
+		{name: "nominal", leavesPerSec: 50, rounds: 120, batchSize: 100},
+		{name: "guard-window", leavesPerSec: 50, rounds: 120, batchSize: 100, guardWindow: 5 * time.Second},
+		// Each pass takes longer than the sequencer interval, so more leaves are queued
+		// for each pass.
+		{name: "slow-storage", leavesPerSec: 50, rounds: 120, batchSize: 500, storageLatency: 300 * time.Millisecond},
+		{name: "latency-spike", leavesPerSec: 50, rounds: 120, batchSize: 1000, storageLatency: 10 * time.Millisecond, spikeFrom: 40, spikeTo: 50, spikeLatency: 2 * time.Second},
+		// The rest show the test notices leaves missing the MMD: the batches are too small
+		// for the sequencer to keep up.
+		{name: "latency-spike-small-batches", leavesPerSec: 50, rounds: 120, batchSize: 100, storageLatency: 10 * time.Millisecond, spikeFrom: 40, spikeTo: 50, spikeLatency: 2 * time.Second, wantMissed: true},
+		{name: "overloaded", leavesPerSec: 200, rounds: 120, batchSize: 100, wantMissed: true},
+	}
+
+	for _, test := range tests {
+		sim, err := newMMDSimulation(km, test)
+		if err != nil {
+			t.Errorf("%s: newMMDSimulation()=_,%v, want no error", test.name, err)
+			continue
+		}
+		if err := sim.run(context.Background()); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if sim.submitted == 0 {
+			t.Errorf("%s: no leaves were queued", test.name)
+			continue
+		}
+		if got, want := len(sim.missed) > 0, test.wantMissed; got != want {
+			first := ""
+			if len(sim.missed) > 0 {
+				first = sim.missed[0]
+			}
+			t.Errorf("%s: %d of %d leaves missed the MMD (%s), want missed: %v", test.name, len(sim.missed), sim.submitted, first, want)
+		}
+	}
+}
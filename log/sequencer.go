@@ -32,6 +32,37 @@ type Sequencer struct {
 	// sequencerGuardWindow is used to ensure entries newer than the guard window will not be
 	// sequenced until they fall outside it. By default there is no guard window.
 	sequencerGuardWindow time.Duration
+
+	// observer, if set, is told what happened to the leaves in each batch
+	observer LeafObserver
+	// hooks, if set, are called around the commit of each batch
+	hooks SequencingHooks
+}
+
+// LeafObserver is told about the progress of leaves through the sequencer, so that
+// individual submissions can be tracked from queueing to integration.
+type LeafObserver interface {
+	// LeavesIntegrated is called once a batch of leaves has been committed to the tree.
+	// The leaves have their LeafIndex set.
+	LeavesIntegrated(ctx context.Context, leaves []trillian.LogLeaf)
+	// SequencingFailed is called when a batch of dequeued leaves could not be integrated.
+	// They remain queued and will be retried in a later batch.
+	SequencingFailed(ctx context.Context, leaves []trillian.LogLeaf)
+}
+
+// SequencingHooks are called as each batch of leaves is committed to a log, so that a
+// personality can keep data derived from the log, such as an index of its entries, in step
+// with it. A batch is committed only if PreCommit accepts it, and then exactly one of
+// PostCommit or Aborted follows.
+type SequencingHooks interface {
+	// PreCommit is called with the sequenced leaves of a batch and the signed root they
+	// produce, before the batch is committed. Returning an error vetoes the batch: nothing
+	// is written and the leaves stay queued for a later batch.
+	PreCommit(ctx context.Context, leaves []trillian.LogLeaf, root trillian.SignedLogRoot) error
+	// PostCommit is called once a batch accepted by PreCommit has been committed.
+	PostCommit(ctx context.Context, leaves []trillian.LogLeaf, root trillian.SignedLogRoot)
+	// Aborted is called if a batch accepted by PreCommit then failed to commit.
+	Aborted(ctx context.Context, leaves []trillian.LogLeaf)
 }
 
 // maxTreeDepth sets an upper limit on the size of Log trees.
@@ -51,6 +82,45 @@ func (s *Sequencer) SetGuardWindow(sequencerGuardWindow time.Duration) {
 	s.sequencerGuardWindow = sequencerGuardWindow
 }
 
+// SetLeafObserver sets an observer that's told which leaves are integrated, or fail to be,
+// by each batch.
+func (s *Sequencer) SetLeafObserver(observer LeafObserver) {
+	s.observer = observer
+}
+
+// SetSequencingHooks sets the hooks called around the commit of each batch.
+func (s *Sequencer) SetSequencingHooks(hooks SequencingHooks) {
+	s.hooks = hooks
+}
+
+// preCommit calls the PreCommit hook for a batch about to be committed in tx, rolling tx
+// back if the batch is vetoed.
+func (s Sequencer) preCommit(ctx context.Context, tx storage.LogTX, leaves []trillian.LogLeaf, root trillian.SignedLogRoot) error {
+	if s.hooks == nil {
+		return nil
+	}
+	if err := s.hooks.PreCommit(ctx, leaves, root); err != nil {
+		glog.Warningf("%s: sequencing hook rejected batch of %d leaves: %v", util.LogIDPrefix(ctx), len(leaves), err)
+		tx.Rollback()
+		return fmt.Errorf("%s: batch vetoed by sequencing hook: %v", util.LogIDPrefix(ctx), err)
+	}
+	return nil
+}
+
+// commitBatch commits the transaction holding a batch and tells the hooks how it went.
+func (s Sequencer) commitBatch(ctx context.Context, tx storage.LogTX, leaves []trillian.LogLeaf, root trillian.SignedLogRoot) error {
+	if err := tx.Commit(); err != nil {
+		if s.hooks != nil {
+			s.hooks.Aborted(ctx, leaves)
+		}
+		return err
+	}
+	if s.hooks != nil {
+		s.hooks.PostCommit(ctx, leaves, root)
+	}
+	return nil
+}
+
 // TODO: This currently doesn't use the batch api for fetching the required nodes. This
 // would be more efficient but requires refactoring.
 func (s Sequencer) buildMerkleTreeFromStorageAtRoot(ctx context.Context, root trillian.SignedLogRoot, tx storage.TreeTX) (*merkle.CompactMerkleTree, error) {
@@ -119,11 +189,46 @@ func (s Sequencer) sequenceLeaves(mt *merkle.CompactMerkleTree, leaves []trillia
 	return nodeMap, leaves, nil
 }
 
+// buildMerkleTreeFromCompactRange resumes the compact tree for root from the compact range
+// stored with it by the batch that created it, so that a restarted sequencer doesn't need
+// to read back the tree's nodes. It returns nil if there's no usable stored range.
+func (s Sequencer) buildMerkleTreeFromCompactRange(ctx context.Context, root trillian.SignedLogRoot, tx storage.LogTX) (*merkle.CompactMerkleTree, error) {
+	hashes, err := tx.GetCompactRange(root.TreeSize)
+	if err != nil {
+		glog.Warningf("%s: Failed to get compact range: %v", util.LogIDPrefix(ctx), err)
+		return nil, err
+	}
+	if hashes == nil {
+		return nil, nil
+	}
+	mt, err := merkle.NewCompactMerkleTreeWithState(s.hasher, root.TreeSize, func(depth int, index int64) ([]byte, error) {
+		if depth >= len(hashes) || hashes[depth] == nil {
+			return nil, fmt.Errorf("compact range for size %d has no hash at level %d", root.TreeSize, depth)
+		}
+		return hashes[depth], nil
+	}, root.RootHash)
+	if err != nil {
+		// The nodes are the authoritative state of the tree, so fall back to them.
+		glog.Warningf("%s: Ignoring stored compact range for size %d: %v", util.LogIDPrefix(ctx), root.TreeSize, err)
+		return nil, nil
+	}
+	return mt, nil
+}
+
 func (s Sequencer) initMerkleTreeFromStorage(ctx context.Context, currentRoot trillian.SignedLogRoot, tx storage.LogTX) (*merkle.CompactMerkleTree, error) {
 	if currentRoot.TreeSize == 0 {
 		return merkle.NewCompactMerkleTree(s.hasher), nil
 	}
 
+	// Perfect trees are resumed from their root hash, anything else from the compact range
+	// stored with the root if there is one.
+	if currentRoot.TreeSize&(currentRoot.TreeSize-1) != 0 {
+		mt, err := s.buildMerkleTreeFromCompactRange(ctx, currentRoot, tx)
+		if err != nil || mt != nil {
+			return mt, err
+		}
+	}
+
 	// Initialize the compact tree state to match the latest root in the database
 	return s.buildMerkleTreeFromStorageAtRoot(ctx, currentRoot, tx)
 }
@@ -169,6 +274,16 @@ func (s Sequencer) SequenceBatch(ctx context.Context, limit int) (int, error) {
 		return 0, err
 	}
 
+	// Let the observer know if the batch doesn't make it into the tree
+	integrated := false
+	if s.observer != nil && len(leaves) > 0 {
+		defer func() {
+			if !integrated {
+				s.observer.SequencingFailed(ctx, leaves)
+			}
+		}()
+	}
+
 	// Get the latest known root from storage
 	currentRoot, err := tx.LatestSignedLogRoot()
 
@@ -182,6 +297,9 @@ func (s Sequencer) SequenceBatch(ctx context.Context, limit int) (int, error) {
 	// TODO(mhs): Might be better to create empty root in provisioning API when it exists
 	if currentRoot.RootHash == nil {
 		glog.Warningf("%s: Fresh log - no previous TreeHeads exist.", util.LogIDPrefix(ctx))
+		// SignRoot needs its own transaction, and the dequeued leaves stay queued for the
+		// next batch.
+		tx.Rollback()
 		return 0, s.SignRoot(ctx)
 	}
 
@@ -199,6 +317,15 @@ func (s Sequencer) SequenceBatch(ctx context.Context, limit int) (int, error) {
 		return 0, err
 	}
 
+	// This is the last point where the batch is abandoned if we're shutting down. Once the
+	// writes start the batch is committed whatever happens to ctx, so that a shutdown either
+	// integrates all of the batch or leaves all of it queued.
+	if err := ctx.Err(); err != nil {
+		glog.Infof("%s: Not sequencing batch of %d leaves: %v", util.LogIDPrefix(ctx), len(leaves), err)
+		tx.Rollback()
+		return 0, err
+	}
+
 	// We've done all the reads, can now do the updates.
 	// TODO: This relies on us being the only process updating the map, which isn't enforced yet
 	// though the schema should now prevent multiple STHs being inserted with the same revision
@@ -280,10 +407,24 @@ func (s Sequencer) SequenceBatch(ctx context.Context, limit int) (int, error) {
 		return 0, err
 	}
 
+	if err := tx.StoreCompactRange(newLogRoot.TreeSize, merkleTree.Hashes()); err != nil {
+		glog.Warningf("%s: failed to write compact range: %s", util.LogIDPrefix(ctx), err)
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := s.preCommit(ctx, tx, sequencedLeaves, newLogRoot); err != nil {
+		return 0, err
+	}
+
 	// The batch is now fully sequenced and we're done
-	if err := tx.Commit(); err != nil {
+	if err := s.commitBatch(ctx, tx, sequencedLeaves, newLogRoot); err != nil {
 		return 0, err
 	}
+	integrated = true
+	if s.observer != nil {
+		s.observer.LeavesIntegrated(ctx, sequencedLeaves)
+	}
 
 	glog.Infof("%s: sequenced %d leaves, size %d, tree-revision %d", util.LogIDPrefix(ctx), len(leaves), newLogRoot.TreeSize, newLogRoot.TreeRevision)
 	return len(leaves), nil
@@ -342,6 +483,14 @@ func (s Sequencer) SignRoot(ctx context.Context) error {
 		tx.Rollback()
 		return err
 	}
+	// Logs sequenced before compact ranges were stored get one for their current size here.
+	if newLogRoot.TreeSize > 0 {
+		if err := tx.StoreCompactRange(newLogRoot.TreeSize, merkleTree.Hashes()); err != nil {
+			glog.Warningf("%s: signer failed to write compact range: %v", util.LogIDPrefix(ctx), err)
+			tx.Rollback()
+			return err
+		}
+	}
 	glog.V(2).Infof("%s: new signed root, size %d, tree-revision %d", util.LogIDPrefix(ctx), newLogRoot.TreeSize, newLogRoot.TreeRevision)
 
 	return tx.Commit()
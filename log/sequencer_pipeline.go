@@ -0,0 +1,260 @@
+package log
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+// preparedBatch is a batch of leaves that has been sequenced in memory, and had its new
+// root signed, but not yet been written to storage.
+type preparedBatch struct {
+	// queued holds the queue entries the batch's leaves were read from.
+	queued    []storage.QueuedLeaf
+	leaves    []trillian.LogLeaf
+	sequenced []trillian.LogLeaf
+	nodeMap   map[string]storage.Node
+	root      trillian.SignedLogRoot
+	// compactRange is the compact range of the tree at root.
+	compactRange [][]byte
+}
+
+// SequenceBatches integrates up to maxBatches batches of up to limit leaves each. Each batch
+// is read from the queue, sequenced and signed while the previous one is being committed, which keeps
+// the sequencer busy when storage commits are slow. At most one batch is prepared ahead of
+// the one being committed. The result is the same as calling SequenceBatch repeatedly:
+// each batch is committed in its own transaction at the next tree revision, and nothing
+// after a batch that fails to commit is written. It relies on this being the only sequencer
+// for the log. It returns the number of leaves integrated.
+//
+// If ctx is cancelled, no more batches are started but a batch already being committed is
+// allowed to finish, so that shutting down never leaves a batch partly written.
+func (s Sequencer) SequenceBatches(ctx context.Context, limit, maxBatches int) (int, error) {
+	if maxBatches <= 1 {
+		return s.SequenceBatch(ctx, limit)
+	}
+
+	tree, root, err := s.loadTree(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if root.RootHash == nil {
+		// A fresh log needs its first root, which SequenceBatch creates.
+		return s.SequenceBatch(ctx, limit)
+	}
+
+	total := 0
+	var committing *preparedBatch
+	var commitDone chan error
+	for i := 0; i < maxBatches && ctx.Err() == nil; i++ {
+		// Leaves being committed are still in the queue until the commit finishes.
+		var exclude []storage.QueuedLeaf
+		if committing != nil {
+			exclude = committing.queued
+		}
+		batch, prepareErr := s.prepareBatch(ctx, limit, tree, root, exclude)
+
+		if commitDone != nil {
+			if err := <-commitDone; err != nil {
+				return total, err
+			}
+			total += len(committing.leaves)
+			committing, commitDone = nil, nil
+		}
+		if prepareErr != nil {
+			return total, prepareErr
+		}
+		if len(batch.leaves) == 0 {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			// Nothing of this batch has been written, so its leaves stay queued.
+			glog.Infof("%s: Not sequencing batch of %d leaves: %v", util.LogIDPrefix(ctx), len(batch.leaves), err)
+			break
+		}
+
+		committing = batch
+		commitDone = make(chan error, 1)
+		go func(b *preparedBatch, done chan<- error) {
+			done <- s.writeBatch(ctx, b)
+		}(batch, commitDone)
+		root = batch.root
+		if len(batch.leaves) < limit {
+			// The queue has been drained
+			break
+		}
+	}
+
+	if commitDone != nil {
+		if err := <-commitDone; err != nil {
+			return total, err
+		}
+		total += len(committing.leaves)
+	}
+	return total, nil
+}
+
+// loadTree returns the latest root and the compact Merkle tree for it.
+func (s Sequencer) loadTree(ctx context.Context) (*merkle.CompactMerkleTree, trillian.SignedLogRoot, error) {
+	tx, err := s.logStorage.Begin()
+	if err != nil {
+		glog.Warningf("%s: Sequencer failed to start tx: %s", util.LogIDPrefix(ctx), err)
+		return nil, trillian.SignedLogRoot{}, err
+	}
+	defer tx.Rollback()
+
+	root, err := tx.LatestSignedLogRoot()
+	if err != nil {
+		glog.Warningf("%s: Sequencer failed to get latest root: %s", util.LogIDPrefix(ctx), err)
+		return nil, trillian.SignedLogRoot{}, err
+	}
+	if root.RootHash == nil {
+		return nil, root, nil
+	}
+	tree, err := s.initMerkleTreeFromStorage(ctx, root, tx)
+	if err != nil {
+		return nil, trillian.SignedLogRoot{}, err
+	}
+	return tree, root, nil
+}
+
+// prepareBatch reads the next batch of leaves from the queue, skipping any in exclude, adds
+// them to tree and signs the resulting root, which follows prevRoot. The queue is read
+// from a snapshot, so this doesn't wait for a commit in progress; the leaves are taken off
+// the queue when the batch is written.
+func (s Sequencer) prepareBatch(ctx context.Context, limit int, tree *merkle.CompactMerkleTree, prevRoot trillian.SignedLogRoot, exclude []storage.QueuedLeaf) (*preparedBatch, error) {
+	tx, err := s.logStorage.Snapshot()
+	if err != nil {
+		glog.Warningf("%s: Sequencer failed to start snapshot: %s", util.LogIDPrefix(ctx), err)
+		return nil, err
+	}
+	guardCutoffTime := s.timeSource.Now().Add(-s.sequencerGuardWindow)
+	queued, err := tx.PeekLeaves(limit+len(exclude), guardCutoffTime)
+	if err != nil {
+		glog.Warningf("%s: Sequencer failed to read queued leaves: %s", util.LogIDPrefix(ctx), err)
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	skip := make(map[string]bool)
+	for _, leaf := range exclude {
+		skip[queueKey(leaf)] = true
+	}
+	batch := &preparedBatch{}
+	var leaves []trillian.LogLeaf
+	for _, leaf := range queued {
+		if !skip[queueKey(leaf)] && len(leaves) < limit {
+			batch.queued = append(batch.queued, leaf)
+			leaves = append(leaves, leaf.LogLeaf)
+		}
+	}
+	if len(leaves) == 0 {
+		return batch, nil
+	}
+
+	// Keep a copy of the leaves as dequeued for the observer, sequenceLeaves updates them.
+	batch.leaves = append([]trillian.LogLeaf(nil), leaves...)
+	batch.nodeMap, batch.sequenced, err = s.sequenceLeaves(tree, leaves)
+	if err != nil {
+		return nil, err
+	}
+
+	batch.compactRange = tree.Hashes()
+	batch.root = trillian.SignedLogRoot{
+		RootHash:       tree.CurrentRoot(),
+		TimestampNanos: s.timeSource.Now().UnixNano(),
+		TreeSize:       tree.Size(),
+		LogId:          prevRoot.LogId,
+		TreeRevision:   prevRoot.TreeRevision + 1,
+	}
+	signature, err := s.createRootSignature(ctx, batch.root)
+	if err != nil {
+		glog.Warningf("%s: signer failed to sign root: %v", util.LogIDPrefix(ctx), err)
+		return nil, err
+	}
+	batch.root.Signature = &signature
+	return batch, nil
+}
+
+// writeBatch writes a prepared batch to storage in a single transaction.
+func (s Sequencer) writeBatch(ctx context.Context, batch *preparedBatch) error {
+	integrated := false
+	if s.observer != nil {
+		defer func() {
+			if integrated {
+				s.observer.LeavesIntegrated(ctx, batch.sequenced)
+			} else {
+				s.observer.SequencingFailed(ctx, batch.leaves)
+			}
+		}()
+	}
+
+	tx, err := s.logStorage.Begin()
+	if err != nil {
+		glog.Warningf("%s: Sequencer failed to start tx: %s", util.LogIDPrefix(ctx), err)
+		return err
+	}
+
+	// The batch was read from a snapshot, so take exactly those entries off the queue. This
+	// fails if any of them has gone, but not if more urgent leaves have been queued since.
+	// Dequeueing takes the tree lock, so the write revision is only checked after it.
+	if err := tx.DequeuePeekedLeaves(batch.queued); err != nil {
+		glog.Warningf("%s: Sequencer failed to dequeue prepared leaves: %s", util.LogIDPrefix(ctx), err)
+		tx.Rollback()
+		return fmt.Errorf("%s: queue changed while preparing batch: %v", util.LogIDPrefix(ctx), err)
+	}
+	if got, want := tx.WriteRevision(), batch.root.TreeRevision; got != want {
+		tx.Rollback()
+		return fmt.Errorf("%s: got writeRevision of %d, but expected %d", util.LogIDPrefix(ctx), got, want)
+	}
+
+	if err := tx.UpdateSequencedLeaves(batch.sequenced); err != nil {
+		glog.Warningf("%s: Sequencer failed to update sequenced leaves: %s", util.LogIDPrefix(ctx), err)
+		tx.Rollback()
+		return err
+	}
+	targetNodes, err := s.buildNodesFromNodeMap(batch.nodeMap, batch.root.TreeRevision)
+	if err != nil {
+		glog.Warningf("%s: Failed to build target nodes in sequencer: %s", util.LogIDPrefix(ctx), err)
+		tx.Rollback()
+		return err
+	}
+	if err := tx.SetMerkleNodes(targetNodes); err != nil {
+		glog.Warningf("%s: Sequencer failed to set Merkle nodes: %s", util.LogIDPrefix(ctx), err)
+		tx.Rollback()
+		return err
+	}
+	if err := tx.StoreSignedLogRoot(batch.root); err != nil {
+		glog.Warningf("%s: failed to write updated tree root: %s", util.LogIDPrefix(ctx), err)
+		tx.Rollback()
+		return err
+	}
+	if err := tx.StoreCompactRange(batch.root.TreeSize, batch.compactRange); err != nil {
+		glog.Warningf("%s: failed to write compact range: %s", util.LogIDPrefix(ctx), err)
+		tx.Rollback()
+		return err
+	}
+	if err := s.preCommit(ctx, tx, batch.sequenced, batch.root); err != nil {
+		return err
+	}
+	if err := s.commitBatch(ctx, tx, batch.sequenced, batch.root); err != nil {
+		return err
+	}
+	integrated = true
+
+	glog.Infof("%s: sequenced %d leaves, size %d, tree-revision %d", util.LogIDPrefix(ctx), len(batch.sequenced), batch.root.TreeSize, batch.root.TreeRevision)
+	return nil
+}
+
+// queueKey identifies a queue entry.
+func queueKey(leaf storage.QueuedLeaf) string {
+	return string(leaf.LeafValueHash) + "/" + string(leaf.QueueID)
+}
@@ -0,0 +1,728 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
+)
+
+// fakeLogStorage is just enough of an in-memory log storage to run the sequencer against.
+// Like the MySQL storage, writers are serialized but snapshots can be read at any time.
+type fakeLogStorage struct {
+	writer sync.Mutex
+
+	mu sync.Mutex
+	// queue holds the queued leaves in the order they're dequeued, with unique QueueIDs
+	queue     []storage.QueuedLeaf
+	nextID    int
+	sequenced []trillian.LogLeaf
+	nodes     map[string][]storage.Node
+	roots     []trillian.SignedLogRoot
+	// compactRanges holds the compact range stored for each tree size
+	compactRanges map[int64][][]byte
+	// commitErr, if set, is returned when committing the given tree revision
+	commitErr      error
+	commitRevision int64
+	// crashAt, if set, names the LogTX method during which the next write transaction dies,
+	// as it would if the sequencer were killed: nothing it buffered is committed. A crash
+	// at "Commit-applied" happens after the commit, before the sequencer hears about it.
+	crashAt string
+	// nodeReads counts the calls to GetMerkleNodes.
+	nodeReads int
+}
+
+var errCrashed = errors.New("crashed")
+
+func newFakeLogStorage(numLeaves int) *fakeLogStorage {
+	s := &fakeLogStorage{
+		nodes:         make(map[string][]storage.Node),
+		roots:         []trillian.SignedLogRoot{{RootHash: treeHasher.HashEmpty()}},
+		compactRanges: make(map[int64][][]byte),
+	}
+	for i := 0; i < numLeaves; i++ {
+		s.queue = append(s.queue, s.newQueuedLeaf(fmt.Sprintf("leaf %d", i)))
+	}
+	return s
+}
+
+// newQueuedLeaf returns a leaf holding value, with the next QueueID.
+func (s *fakeLogStorage) newQueuedLeaf(value string) storage.QueuedLeaf {
+	data := []byte(value)
+	s.nextID++
+	return storage.QueuedLeaf{
+		LogLeaf: trillian.LogLeaf{LeafValueHash: data, MerkleLeafHash: treeHasher.HashLeaf(data), LeafValue: data},
+		QueueID: []byte(fmt.Sprint(s.nextID)),
+	}
+}
+
+func (s *fakeLogStorage) Begin() (storage.LogTX, error) {
+	s.writer.Lock()
+	return &fakeLogTX{s: s, writer: true}, nil
+}
+
+func (s *fakeLogStorage) Snapshot() (storage.ReadOnlyLogTX, error) {
+	return &fakeLogTX{s: s}, nil
+}
+
+// fakeLogTX implements the parts of storage.LogTX the sequencer uses. Writes are buffered
+// until Commit.
+type fakeLogTX struct {
+	storage.LogTX
+	s      *fakeLogStorage
+	writer bool
+	closed bool
+	dead   bool
+
+	dequeued  []storage.QueuedLeaf
+	sequenced []trillian.LogLeaf
+	nodes     []storage.Node
+	root      *trillian.SignedLogRoot
+	// compactRanges holds the compact ranges stored by the transaction
+	compactRanges map[int64][][]byte
+}
+
+func (t *fakeLogTX) latestRoot() trillian.SignedLogRoot {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	return t.s.roots[len(t.s.roots)-1]
+}
+
+// crash kills a write transaction if the storage is set to crash at op, or it already has.
+func (t *fakeLogTX) crash(op string) error {
+	if !t.writer {
+		return nil
+	}
+	t.s.mu.Lock()
+	crash := t.s.crashAt == op
+	if crash {
+		t.s.crashAt = ""
+	}
+	t.s.mu.Unlock()
+	if crash {
+		// Like a database dropping a dead client's transaction.
+		t.dead = true
+		t.close()
+	}
+	if t.dead {
+		return errCrashed
+	}
+	return nil
+}
+
+func (t *fakeLogTX) LatestSignedLogRoot() (trillian.SignedLogRoot, error) {
+	if err := t.crash("LatestSignedLogRoot"); err != nil {
+		return trillian.SignedLogRoot{}, err
+	}
+	return t.latestRoot(), nil
+}
+
+func (t *fakeLogTX) WriteRevision() int64 {
+	return t.latestRoot().TreeRevision + 1
+}
+
+func (t *fakeLogTX) GetMerkleNodes(revision int64, ids []storage.NodeID) ([]storage.Node, error) {
+	if err := t.crash("GetMerkleNodes"); err != nil {
+		return nil, err
+	}
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	t.s.nodeReads++
+	var result []storage.Node
+	for _, id := range ids {
+		var found *storage.Node
+		for i, node := range t.s.nodes[id.String()] {
+			if node.NodeRevision <= revision {
+				found = &t.s.nodes[id.String()][i]
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("no node %s at revision %d", id.String(), revision)
+		}
+		result = append(result, *found)
+	}
+	return result, nil
+}
+
+func (t *fakeLogTX) PeekLeaves(limit int, cutoffTime time.Time) ([]storage.QueuedLeaf, error) {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	if limit > len(t.s.queue) {
+		limit = len(t.s.queue)
+	}
+	return append([]storage.QueuedLeaf(nil), t.s.queue[:limit]...), nil
+}
+
+func (t *fakeLogTX) DequeueLeaves(limit int, cutoffTime time.Time) ([]trillian.LogLeaf, error) {
+	if err := t.crash("DequeueLeaves"); err != nil {
+		return nil, err
+	}
+	queued, err := t.PeekLeaves(limit, cutoffTime)
+	t.dequeued = queued
+	var leaves []trillian.LogLeaf
+	for _, q := range queued {
+		leaves = append(leaves, q.LogLeaf)
+	}
+	return leaves, err
+}
+
+func (t *fakeLogTX) DequeuePeekedLeaves(leaves []storage.QueuedLeaf) error {
+	if err := t.crash("DequeuePeekedLeaves"); err != nil {
+		return err
+	}
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	queued := make(map[string]bool)
+	for _, q := range t.s.queue {
+		queued[queueKey(q)] = true
+	}
+	for _, leaf := range leaves {
+		if !queued[queueKey(leaf)] {
+			return fmt.Errorf("leaf %s is no longer queued", leaf.LeafValue)
+		}
+		queued[queueKey(leaf)] = false
+	}
+	t.dequeued = append(t.dequeued, leaves...)
+	return nil
+}
+
+func (t *fakeLogTX) UpdateSequencedLeaves(leaves []trillian.LogLeaf) error {
+	if err := t.crash("UpdateSequencedLeaves"); err != nil {
+		return err
+	}
+	t.sequenced = append(t.sequenced, leaves...)
+	return nil
+}
+
+func (t *fakeLogTX) SetMerkleNodes(nodes []storage.Node) error {
+	if err := t.crash("SetMerkleNodes"); err != nil {
+		return err
+	}
+	t.nodes = append(t.nodes, nodes...)
+	return nil
+}
+
+func (t *fakeLogTX) StoreSignedLogRoot(root trillian.SignedLogRoot) error {
+	if err := t.crash("StoreSignedLogRoot"); err != nil {
+		return err
+	}
+	t.root = &root
+	return nil
+}
+
+func (t *fakeLogTX) StoreCompactRange(treeSize int64, hashes [][]byte) error {
+	if err := t.crash("StoreCompactRange"); err != nil {
+		return err
+	}
+	if t.compactRanges == nil {
+		t.compactRanges = make(map[int64][][]byte)
+	}
+	t.compactRanges[treeSize] = hashes
+	return nil
+}
+
+func (t *fakeLogTX) GetCompactRange(treeSize int64) ([][]byte, error) {
+	if err := t.crash("GetCompactRange"); err != nil {
+		return nil, err
+	}
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	return t.s.compactRanges[treeSize], nil
+}
+
+func (t *fakeLogTX) Commit() error {
+	if err := t.crash("Commit"); err != nil {
+		return err
+	}
+	defer t.close()
+	if !t.writer {
+		return nil
+	}
+	if err := t.apply(); err != nil {
+		return err
+	}
+	return t.crash("Commit-applied")
+}
+
+// apply writes the transaction's buffered writes to the storage.
+func (t *fakeLogTX) apply() error {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	if t.root != nil && t.s.commitErr != nil && t.root.TreeRevision == t.s.commitRevision {
+		return t.s.commitErr
+	}
+	dequeued := make(map[string]bool)
+	for _, leaf := range t.dequeued {
+		dequeued[queueKey(leaf)] = true
+	}
+	var queue []storage.QueuedLeaf
+	for _, leaf := range t.s.queue {
+		if !dequeued[queueKey(leaf)] {
+			queue = append(queue, leaf)
+		}
+	}
+	t.s.queue = queue
+	t.s.sequenced = append(t.s.sequenced, t.sequenced...)
+	for _, node := range t.nodes {
+		t.s.nodes[node.NodeID.String()] = append(t.s.nodes[node.NodeID.String()], node)
+	}
+	if t.root != nil {
+		t.s.roots = append(t.s.roots, *t.root)
+	}
+	for size, hashes := range t.compactRanges {
+		t.s.compactRanges[size] = hashes
+	}
+	return nil
+}
+
+func (t *fakeLogTX) Rollback() error {
+	t.close()
+	return nil
+}
+
+func (t *fakeLogTX) close() {
+	if !t.closed && t.writer {
+		t.s.writer.Unlock()
+	}
+	t.closed = true
+}
+
+func newPipelineTestSequencer(ctrl *gomock.Controller, s storage.LogStorage) *Sequencer {
+	mockSigner := crypto.NewMockSigner(ctrl)
+	mockSigner.EXPECT().Sign(gomock.Any(), gomock.Any(), treeHasher.Hasher).AnyTimes().Return([]byte("signed"), nil)
+	mockKeyManager := crypto.NewMockKeyManager(ctrl)
+	mockKeyManager.EXPECT().Signer().AnyTimes().Return(mockSigner, nil)
+	mockKeyManager.EXPECT().SignatureAlgorithm().AnyTimes().Return(trillian.SignatureAlgorithm_ECDSA)
+	return NewSequencer(treeHasher, util.FakeTimeSource{FakeTime: fakeTimeForTest}, s, mockKeyManager)
+}
+
+func TestSequenceBatchesMatchesSequenceBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := util.NewLogContext(context.Background(), -1)
+
+	var tests = []struct {
+		numLeaves, limit, maxBatches int
+		wantLeaves                   int
+	}{
+		{numLeaves: 0, limit: 3, maxBatches: 4, wantLeaves: 0},
+		{numLeaves: 10, limit: 3, maxBatches: 1, wantLeaves: 3},
+		{numLeaves: 10, limit: 3, maxBatches: 2, wantLeaves: 6},
+		{numLeaves: 10, limit: 3, maxBatches: 4, wantLeaves: 10},
+		{numLeaves: 10, limit: 5, maxBatches: 4, wantLeaves: 10},
+		{numLeaves: 10, limit: 3, maxBatches: 10, wantLeaves: 10},
+	}
+
+	for _, test := range tests {
+		sequential := newFakeLogStorage(test.numLeaves)
+		seqSequencer := newPipelineTestSequencer(ctrl, sequential)
+		total := 0
+		for i := 0; i < test.maxBatches; i++ {
+			n, err := seqSequencer.SequenceBatch(ctx, test.limit)
+			if err != nil {
+				t.Fatalf("SequenceBatch()=_,%v, want no error", err)
+			}
+			total += n
+		}
+
+		pipelined := newFakeLogStorage(test.numLeaves)
+		got, err := newPipelineTestSequencer(ctrl, pipelined).SequenceBatches(ctx, test.limit, test.maxBatches)
+		if err != nil {
+			t.Errorf("SequenceBatches(%d, %d)=_,%v, want no error", test.limit, test.maxBatches, err)
+			continue
+		}
+		if got != test.wantLeaves || total != test.wantLeaves {
+			t.Errorf("SequenceBatches(%d, %d)=%d, SequenceBatch total %d, want %d", test.limit, test.maxBatches, got, total, test.wantLeaves)
+		}
+
+		gotRoot, wantRoot := pipelined.roots[len(pipelined.roots)-1], sequential.roots[len(sequential.roots)-1]
+		if !bytes.Equal(gotRoot.RootHash, wantRoot.RootHash) || gotRoot.TreeSize != wantRoot.TreeSize {
+			t.Errorf("SequenceBatches(%d, %d): root hash %x size %d, want %x size %d", test.limit, test.maxBatches, gotRoot.RootHash, gotRoot.TreeSize, wantRoot.RootHash, wantRoot.TreeSize)
+		}
+		if got, want := pipelined.compactRanges, sequential.compactRanges; !reflect.DeepEqual(got, want) {
+			t.Errorf("SequenceBatches(%d, %d): compact ranges %x, want %x", test.limit, test.maxBatches, got, want)
+		}
+		if got, want := pipelined.sequenced, sequential.sequenced; !reflect.DeepEqual(got, want) {
+			t.Errorf("SequenceBatches(%d, %d): sequenced %v, want %v", test.limit, test.maxBatches, got, want)
+		}
+		if got, want := len(pipelined.queue), test.numLeaves-test.wantLeaves; got != want {
+			t.Errorf("SequenceBatches(%d, %d): %d leaves left in queue, want %d", test.limit, test.maxBatches, got, want)
+		}
+	}
+}
+
+func TestSequenceBatchesCommitFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := util.NewLogContext(context.Background(), -1)
+
+	s := newFakeLogStorage(10)
+	s.commitErr, s.commitRevision = errors.New("commit"), 2
+	sequencer := newPipelineTestSequencer(ctrl, s)
+	observer := &recordingObserver{}
+	sequencer.SetLeafObserver(observer)
+
+	got, err := sequencer.SequenceBatches(ctx, 3, 4)
+	if err == nil {
+		t.Fatalf("SequenceBatches()=%d,nil, want error", got)
+	}
+	// Only the first batch made it in, and nothing was written after the failed one
+	if want := 3; got != want {
+		t.Errorf("SequenceBatches()=%d, want %d", got, want)
+	}
+	if got, want := len(s.roots), 2; got != want {
+		t.Errorf("%d roots stored, want %d", got, want)
+	}
+	if got, want := len(s.queue), 7; got != want {
+		t.Errorf("%d leaves left in queue, want %d", got, want)
+	}
+	if got, want := len(observer.integrated), 3; got != want {
+		t.Errorf("LeavesIntegrated got %d leaves, want %d", got, want)
+	}
+	if got, want := len(observer.failed), 3; got != want {
+		t.Errorf("SequencingFailed got %d leaves, want %d", got, want)
+	}
+}
+
+func TestSequenceBatchesQueueChanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := util.NewLogContext(context.Background(), -1)
+
+	s := newFakeLogStorage(4)
+	sequencer := newPipelineTestSequencer(ctrl, s)
+	tree, root, err := sequencer.loadTree(ctx)
+	if err != nil {
+		t.Fatalf("loadTree()=_,_,%v, want no error", err)
+	}
+	batch, err := sequencer.prepareBatch(ctx, 2, tree, root, nil)
+	if err != nil {
+		t.Fatalf("prepareBatch()=_,%v, want no error", err)
+	}
+
+	// Something else sequenced the front of the queue meanwhile
+	s.queue = s.queue[1:]
+	if err := sequencer.writeBatch(ctx, batch); err == nil {
+		t.Error("writeBatch()=nil, want error")
+	}
+	if got, want := len(s.roots), 1; got != want {
+		t.Errorf("%d roots stored, want %d", got, want)
+	}
+	if got, want := len(s.queue), 3; got != want {
+		t.Errorf("%d leaves left in queue, want %d", got, want)
+	}
+}
+
+func TestSequenceBatchesMoreUrgentLeafQueued(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := util.NewLogContext(context.Background(), -1)
+
+	s := newFakeLogStorage(4)
+	sequencer := newPipelineTestSequencer(ctrl, s)
+	tree, root, err := sequencer.loadTree(ctx)
+	if err != nil {
+		t.Fatalf("loadTree()=_,_,%v, want no error", err)
+	}
+	batch, err := sequencer.prepareBatch(ctx, 2, tree, root, nil)
+	if err != nil {
+		t.Fatalf("prepareBatch()=_,%v, want no error", err)
+	}
+
+	// A leaf with an earlier merge deadline now sorts ahead of the prepared ones, and an
+	// identical copy of a prepared leaf is queued behind them.
+	s.queue = append([]storage.QueuedLeaf{s.newQueuedLeaf("urgent")}, s.queue...)
+	s.queue = append(s.queue, s.newQueuedLeaf("leaf 0"))
+	if err := sequencer.writeBatch(ctx, batch); err != nil {
+		t.Fatalf("writeBatch()=%v, want no error", err)
+	}
+	if got, want := len(s.roots), 2; got != want {
+		t.Errorf("%d roots stored, want %d", got, want)
+	}
+	var sequenced, queued []string
+	for _, leaf := range s.sequenced {
+		sequenced = append(sequenced, string(leaf.LeafValue))
+	}
+	for _, leaf := range s.queue {
+		queued = append(queued, string(leaf.LeafValue))
+	}
+	if got, want := fmt.Sprint(sequenced), "[leaf 0 leaf 1]"; got != want {
+		t.Errorf("sequenced %s, want %s", got, want)
+	}
+	if got, want := fmt.Sprint(queued), "[urgent leaf 2 leaf 3 leaf 0]"; got != want {
+		t.Errorf("left %s in queue, want %s", got, want)
+	}
+}
+
+// recordingHooks records the calls to its SequencingHooks methods, and vetoes the batch
+// for vetoRevision if it's set.
+type recordingHooks struct {
+	vetoRevision int64
+	preCommitted []trillian.SignedLogRoot
+	committed    []trillian.LogLeaf
+	roots        []trillian.SignedLogRoot
+	aborted      []trillian.LogLeaf
+}
+
+func (h *recordingHooks) PreCommit(ctx context.Context, leaves []trillian.LogLeaf, root trillian.SignedLogRoot) error {
+	if root.TreeRevision == h.vetoRevision {
+		return errors.New("veto")
+	}
+	h.preCommitted = append(h.preCommitted, root)
+	return nil
+}
+
+func (h *recordingHooks) PostCommit(ctx context.Context, leaves []trillian.LogLeaf, root trillian.SignedLogRoot) {
+	h.committed = append(h.committed, leaves...)
+	h.roots = append(h.roots, root)
+}
+
+func (h *recordingHooks) Aborted(ctx context.Context, leaves []trillian.LogLeaf) {
+	h.aborted = append(h.aborted, leaves...)
+}
+
+func TestSequencingHooks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := util.NewLogContext(context.Background(), -1)
+
+	var tests = []struct {
+		descr          string
+		maxBatches     int
+		vetoRevision   int64
+		commitRevision int64
+		wantErr        bool
+		wantCommitted  int
+		wantAborted    int
+	}{
+		{descr: "sequential", maxBatches: 1, wantCommitted: 3},
+		{descr: "pipelined", maxBatches: 4, wantCommitted: 10},
+		{descr: "sequential-veto", maxBatches: 1, vetoRevision: 1, wantErr: true},
+		{descr: "pipelined-veto", maxBatches: 4, vetoRevision: 2, wantErr: true, wantCommitted: 3},
+		{descr: "sequential-commit-fails", maxBatches: 1, commitRevision: 1, wantErr: true, wantAborted: 3},
+		{descr: "pipelined-commit-fails", maxBatches: 4, commitRevision: 3, wantErr: true, wantCommitted: 6, wantAborted: 3},
+	}
+
+	for _, test := range tests {
+		s := newFakeLogStorage(10)
+		if test.commitRevision > 0 {
+			s.commitErr, s.commitRevision = errors.New("commit"), test.commitRevision
+		}
+		sequencer := newPipelineTestSequencer(ctrl, s)
+		hooks := &recordingHooks{vetoRevision: test.vetoRevision}
+		sequencer.SetSequencingHooks(hooks)
+
+		got, err := sequencer.SequenceBatches(ctx, 3, test.maxBatches)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: SequenceBatches()=%d,%v, want error: %v", test.descr, got, err, test.wantErr)
+		}
+		if got != test.wantCommitted {
+			t.Errorf("%s: SequenceBatches()=%d, want %d", test.descr, got, test.wantCommitted)
+		}
+		if got, want := hooks.committed, s.sequenced; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: PostCommit got leaves %v, want %v", test.descr, got, want)
+		}
+		if got, want := hooks.roots, append([]trillian.SignedLogRoot(nil), s.roots[1:]...); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: PostCommit got roots %v, want %v", test.descr, got, want)
+		}
+		if got, want := len(hooks.preCommitted), len(hooks.roots)+test.wantAborted/3; got != want {
+			t.Errorf("%s: PreCommit accepted %d batches, want %d", test.descr, got, want)
+		}
+		if got, want := len(hooks.aborted), test.wantAborted; got != want {
+			t.Errorf("%s: Aborted got %d leaves, want %d", test.descr, got, want)
+		}
+		if got, want := len(s.queue), 10-test.wantCommitted; got != want {
+			t.Errorf("%s: %d leaves left in queue, want %d", test.descr, got, want)
+		}
+	}
+}
+
+// sequenceAll runs SequenceBatch until the queue is empty, as a restarted sequencer would.
+func sequenceAll(ctx context.Context, t *testing.T, sequencer *Sequencer, limit int) {
+	for i := 0; i < 100; i++ {
+		n, err := sequencer.SequenceBatch(ctx, limit)
+		if err != nil {
+			t.Fatalf("SequenceBatch()=_,%v, want no error", err)
+		}
+		if n == 0 {
+			return
+		}
+	}
+	t.Fatal("SequenceBatch() never drained the queue")
+}
+
+func TestSequencerCrashRecovery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := util.NewLogContext(context.Background(), -1)
+
+	want := newFakeLogStorage(10)
+	sequenceAll(ctx, t, newPipelineTestSequencer(ctrl, want), 3)
+
+	var tests = []struct {
+		crashAt string
+		// wantRoots is the number of roots stored when the sequencer dies
+		wantRoots int
+	}{
+		{crashAt: "DequeueLeaves", wantRoots: 2},
+		{crashAt: "LatestSignedLogRoot", wantRoots: 2},
+		{crashAt: "GetCompactRange", wantRoots: 2},
+		{crashAt: "UpdateSequencedLeaves", wantRoots: 2},
+		{crashAt: "SetMerkleNodes", wantRoots: 2},
+		{crashAt: "StoreSignedLogRoot", wantRoots: 2},
+		{crashAt: "StoreCompactRange", wantRoots: 2},
+		{crashAt: "Commit", wantRoots: 2},
+		{crashAt: "Commit-applied", wantRoots: 3},
+	}
+
+	for _, test := range tests {
+		s := newFakeLogStorage(10)
+		// The first batch takes the tree to size 3, which isn't a perfect tree so its
+		// compact range is needed to resume it.
+		if n, err := newPipelineTestSequencer(ctrl, s).SequenceBatch(ctx, 3); err != nil || n != 3 {
+			t.Fatalf("%s: SequenceBatch()=%d,%v, want 3,nil", test.crashAt, n, err)
+		}
+
+		s.crashAt = test.crashAt
+		if _, err := newPipelineTestSequencer(ctrl, s).SequenceBatch(ctx, 3); err != errCrashed {
+			t.Errorf("%s: SequenceBatch()=_,%v, want %v", test.crashAt, err, errCrashed)
+		}
+		if len(s.crashAt) > 0 {
+			t.Errorf("%s: sequencer didn't reach the crash point", test.crashAt)
+		}
+		// The batch is either all there or not there at all.
+		if got, want := len(s.roots), test.wantRoots; got != want {
+			t.Errorf("%s: %d roots stored after crash, want %d", test.crashAt, got, want)
+		}
+		root := s.roots[len(s.roots)-1]
+		if got, want := int64(len(s.sequenced)), root.TreeSize; got != want {
+			t.Errorf("%s: %d leaves sequenced after crash, want %d", test.crashAt, got, want)
+		}
+		if got, want := len(s.queue)+len(s.sequenced), 10; got != want {
+			t.Errorf("%s: %d leaves queued or sequenced after crash, want %d", test.crashAt, got, want)
+		}
+
+		// A new sequencer picks up where the last one left off, from the stored compact
+		// ranges rather than the tree's nodes.
+		sequenceAll(ctx, t, newPipelineTestSequencer(ctrl, s), 3)
+		gotRoot, wantRoot := s.roots[len(s.roots)-1], want.roots[len(want.roots)-1]
+		if !bytes.Equal(gotRoot.RootHash, wantRoot.RootHash) || gotRoot.TreeSize != wantRoot.TreeSize {
+			t.Errorf("%s: root hash %x size %d after restart, want %x size %d", test.crashAt, gotRoot.RootHash, gotRoot.TreeSize, wantRoot.RootHash, wantRoot.TreeSize)
+		}
+		if got, want := s.sequenced, want.sequenced; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: sequenced %v after restart, want %v", test.crashAt, got, want)
+		}
+		if got, want := s.compactRanges, want.compactRanges; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: compact ranges %x after restart, want %x", test.crashAt, got, want)
+		}
+		if got := s.nodeReads; got != 0 {
+			t.Errorf("%s: %d Merkle node reads, want 0", test.crashAt, got)
+		}
+	}
+}
+
+func TestSequencerResumeWithBadCompactRange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := util.NewLogContext(context.Background(), -1)
+
+	want := newFakeLogStorage(6)
+	sequenceAll(ctx, t, newPipelineTestSequencer(ctrl, want), 3)
+
+	s := newFakeLogStorage(6)
+	if n, err := newPipelineTestSequencer(ctrl, s).SequenceBatch(ctx, 3); err != nil || n != 3 {
+		t.Fatalf("SequenceBatch()=%d,%v, want 3,nil", n, err)
+	}
+	// A compact range that doesn't match the root is ignored in favour of the nodes.
+	s.compactRanges[3] = [][]byte{treeHasher.HashLeaf([]byte("bad")), treeHasher.HashLeaf([]byte("range"))}
+	sequenceAll(ctx, t, newPipelineTestSequencer(ctrl, s), 3)
+
+	gotRoot, wantRoot := s.roots[len(s.roots)-1], want.roots[len(want.roots)-1]
+	if !bytes.Equal(gotRoot.RootHash, wantRoot.RootHash) || gotRoot.TreeSize != wantRoot.TreeSize {
+		t.Errorf("root hash %x size %d, want %x size %d", gotRoot.RootHash, gotRoot.TreeSize, wantRoot.RootHash, wantRoot.TreeSize)
+	}
+	if s.nodeReads == 0 {
+		t.Error("no Merkle nodes read, want the tree resumed from its nodes")
+	}
+}
+
+func TestSequenceBatchCancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(util.NewLogContext(context.Background(), -1))
+	cancel()
+
+	s := newFakeLogStorage(10)
+	sequencer := newPipelineTestSequencer(ctrl, s)
+	observer := &recordingObserver{}
+	sequencer.SetLeafObserver(observer)
+
+	if got, err := sequencer.SequenceBatch(ctx, 3); err != context.Canceled {
+		t.Errorf("SequenceBatch()=%d,%v, want %v", got, err, context.Canceled)
+	}
+	if got, want := len(s.roots), 1; got != want {
+		t.Errorf("%d roots stored, want %d", got, want)
+	}
+	if got, want := len(s.queue), 10; got != want {
+		t.Errorf("%d leaves left in queue, want %d", got, want)
+	}
+	if got, want := len(observer.failed), 3; got != want {
+		t.Errorf("SequencingFailed got %d leaves, want %d", got, want)
+	}
+}
+
+// cancellingHooks cancels a context when the batch for a tree revision is about to commit.
+type cancellingHooks struct {
+	revision int64
+	cancel   context.CancelFunc
+}
+
+func (h *cancellingHooks) PreCommit(ctx context.Context, leaves []trillian.LogLeaf, root trillian.SignedLogRoot) error {
+	if root.TreeRevision == h.revision {
+		h.cancel()
+	}
+	return nil
+}
+
+func (h *cancellingHooks) PostCommit(ctx context.Context, leaves []trillian.LogLeaf, root trillian.SignedLogRoot) {
+}
+
+func (h *cancellingHooks) Aborted(ctx context.Context, leaves []trillian.LogLeaf) {}
+
+func TestSequenceBatchesCancelledMidCommit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(util.NewLogContext(context.Background(), -1))
+	defer cancel()
+
+	s := newFakeLogStorage(10)
+	sequencer := newPipelineTestSequencer(ctrl, s)
+	sequencer.SetSequencingHooks(&cancellingHooks{revision: 2, cancel: cancel})
+
+	// The batch being committed when the context is cancelled is finished, and no more
+	// are started.
+	got, err := sequencer.SequenceBatches(ctx, 3, 4)
+	if err != nil {
+		t.Errorf("SequenceBatches()=_,%v, want no error", err)
+	}
+	if want := 6; got != want {
+		t.Errorf("SequenceBatches()=%d, want %d", got, want)
+	}
+	if got, want := len(s.roots), 3; got != want {
+		t.Errorf("%d roots stored, want %d", got, want)
+	}
+	if got, want := len(s.queue), 4; got != want {
+		t.Errorf("%d leaves left in queue, want %d", got, want)
+	}
+}
@@ -3,6 +3,7 @@ package log
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -198,6 +199,7 @@ func createTestContext(ctrl *gomock.Controller, params testParameters) (testCont
 			// At the moment if we're going to fail the operation we accept any root
 			mockTx.EXPECT().StoreSignedLogRoot(gomock.Any()).AnyTimes().Return(params.storeSignedRootError)
 		}
+		mockTx.EXPECT().StoreCompactRange(gomock.Any(), gomock.Any()).AnyTimes().Return(nil)
 	}
 
 	mockKeyManager := crypto.NewMockKeyManager(ctrl)
@@ -447,6 +449,56 @@ func TestSequenceBatch(t *testing.T) {
 	}
 }
 
+// recordingObserver is a LeafObserver that remembers what it's told.
+type recordingObserver struct {
+	integrated []trillian.LogLeaf
+	failed     []trillian.LogLeaf
+}
+
+func (o *recordingObserver) LeavesIntegrated(ctx context.Context, leaves []trillian.LogLeaf) {
+	o.integrated = append(o.integrated, leaves...)
+}
+
+func (o *recordingObserver) SequencingFailed(ctx context.Context, leaves []trillian.LogLeaf) {
+	o.failed = append(o.failed, leaves...)
+}
+
+func TestSequenceBatchLeafObserver(t *testing.T) {
+	for _, commitFails := range []bool{false, true} {
+		ctrl := gomock.NewController(t)
+
+		leaves := []trillian.LogLeaf{getLeaf42()}
+		updatedLeaves := []trillian.LogLeaf{testLeaf16}
+		params := testParameters{writeRevision: testRoot16.TreeRevision + 1, dequeueLimit: 1, shouldCommit: true,
+			dequeuedLeaves: leaves, latestSignedRoot: &testRoot16,
+			updatedLeaves: &updatedLeaves, merkleNodesSet: &updatedNodes,
+			storeSignedRoot: &expectedSignedRoot, setupSigner: true,
+			dataToSign:    []byte{118, 113, 60, 123, 201, 107, 151, 27, 190, 53, 148, 77, 139, 138, 128, 71, 231, 103, 131, 160, 23, 10, 65, 81, 64, 173, 1, 151, 36, 239, 22, 3},
+			signingResult: []byte("signed")}
+		if commitFails {
+			params.commitFails = true
+			params.commitError = errors.New("commit")
+			params.storeSignedRoot = nil
+		}
+		c, ctx := createTestContext(ctrl, params)
+		observer := &recordingObserver{}
+		c.sequencer.SetLeafObserver(observer)
+
+		c.sequencer.SequenceBatch(ctx, 1)
+		wantIntegrated, wantFailed := updatedLeaves, []trillian.LogLeaf(nil)
+		if commitFails {
+			wantIntegrated, wantFailed = nil, leaves
+		}
+		if got := observer.integrated; !reflect.DeepEqual(got, wantIntegrated) {
+			t.Errorf("commitFails=%v: LeavesIntegrated got %v, want %v", commitFails, got, wantIntegrated)
+		}
+		if got := observer.failed; !reflect.DeepEqual(got, wantFailed) {
+			t.Errorf("commitFails=%v: SequencingFailed got %v, want %v", commitFails, got, wantFailed)
+		}
+		ctrl.Finish()
+	}
+}
+
 func TestSignBeginTxFails(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -0,0 +1,165 @@
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// LogVerifier verifies inclusion and consistency proofs for append only logs.
+// The algorithms are those of RFC 6962 and the C++ MerkleVerifier, but leaves are
+// indexed from zero as in the rest of Trillian.
+type LogVerifier struct {
+	hasher TreeHasher
+}
+
+// NewLogVerifier returns a new LogVerifier for a tree using the supplied hasher.
+func NewLogVerifier(hasher TreeHasher) LogVerifier {
+	return LogVerifier{hasher: hasher}
+}
+
+// VerifyInclusionProof verifies that the leaf with the given Merkle leaf hash is
+// included at leafIndex in the tree of size treeSize with the given root hash.
+// Returns nil on a successful verification, and an error otherwise.
+func (v LogVerifier) VerifyInclusionProof(leafIndex, treeSize int64, proof [][]byte, root []byte, leafHash []byte) error {
+	calcRoot, err := v.RootFromInclusionProof(leafIndex, treeSize, proof, leafHash)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(calcRoot, root) {
+		return RootHashMismatchError{ExpectedHash: root, ActualHash: calcRoot}
+	}
+	return nil
+}
+
+// RootFromInclusionProof calculates the root hash that the inclusion proof implies
+// for the leaf with the given Merkle leaf hash at leafIndex in a tree of size treeSize.
+func (v LogVerifier) RootFromInclusionProof(leafIndex, treeSize int64, proof [][]byte, leafHash []byte) ([]byte, error) {
+	if leafIndex < 0 {
+		return nil, fmt.Errorf("invalid leaf index: %d", leafIndex)
+	}
+	if treeSize <= 0 {
+		return nil, fmt.Errorf("invalid tree size: %d", treeSize)
+	}
+	if leafIndex >= treeSize {
+		return nil, fmt.Errorf("leaf index %d out of range for tree of size %d", leafIndex, treeSize)
+	}
+
+	node := leafIndex
+	lastNode := treeSize - 1
+	runningHash := leafHash
+
+	for _, p := range proof {
+		if lastNode == 0 {
+			return nil, errors.New("inclusion proof too long")
+		}
+		if node%2 == 1 || node == lastNode {
+			runningHash = v.hasher.HashChildren(p, runningHash)
+			// The node is the last in its level, so skip over the levels where it
+			// has no right hand sibling.
+			for node%2 == 0 && node != 0 {
+				node >>= 1
+				lastNode >>= 1
+			}
+		} else {
+			runningHash = v.hasher.HashChildren(runningHash, p)
+		}
+		node >>= 1
+		lastNode >>= 1
+	}
+
+	if lastNode != 0 {
+		return nil, errors.New("inclusion proof too short")
+	}
+
+	return runningHash, nil
+}
+
+// VerifyConsistencyProof checks that the passed in consistency proof is valid
+// between the two tree sizes and their root hashes. snapshot1 must not be
+// larger than snapshot2. Returns nil on a successful verification, and an error
+// otherwise.
+func (v LogVerifier) VerifyConsistencyProof(snapshot1, snapshot2 int64, root1, root2 []byte, proof [][]byte) error {
+	switch {
+	case snapshot1 < 0:
+		return fmt.Errorf("invalid first tree size: %d", snapshot1)
+	case snapshot1 > snapshot2:
+		return fmt.Errorf("first tree size (%d) must be <= second tree size (%d)", snapshot1, snapshot2)
+	case snapshot1 == snapshot2:
+		if !bytes.Equal(root1, root2) {
+			return RootHashMismatchError{ExpectedHash: root1, ActualHash: root2}
+		}
+		if len(proof) > 0 {
+			return errors.New("consistency proof for identical trees must be empty")
+		}
+		return nil
+	case snapshot1 == 0:
+		// Any tree is consistent with the empty tree.
+		if len(proof) > 0 {
+			return errors.New("consistency proof from an empty tree must be empty")
+		}
+		return nil
+	case len(proof) == 0:
+		return errors.New("empty consistency proof")
+	}
+
+	node := snapshot1 - 1
+	lastNode := snapshot2 - 1
+
+	// Skip the levels where the first tree's rightmost node is a right child, the
+	// nodes to its left are identical in both trees.
+	for node%2 == 1 {
+		node >>= 1
+		lastNode >>= 1
+	}
+
+	p := 0
+	var node1Hash, node2Hash []byte
+	if node != 0 {
+		// The proof starts with the hash of the subtree the first tree ends in.
+		node1Hash, node2Hash = proof[0], proof[0]
+		p++
+	} else {
+		// The first tree is a complete subtree of the second one.
+		node1Hash, node2Hash = root1, root1
+	}
+
+	for node != 0 {
+		if p >= len(proof) {
+			return errors.New("consistency proof too short")
+		}
+		if node%2 == 1 {
+			node1Hash = v.hasher.HashChildren(proof[p], node1Hash)
+			node2Hash = v.hasher.HashChildren(proof[p], node2Hash)
+			p++
+		} else if node < lastNode {
+			node2Hash = v.hasher.HashChildren(node2Hash, proof[p])
+			p++
+		}
+		// Otherwise the sibling does not exist in the second tree either.
+		node >>= 1
+		lastNode >>= 1
+	}
+
+	if !bytes.Equal(node1Hash, root1) {
+		return RootHashMismatchError{ExpectedHash: root1, ActualHash: node1Hash}
+	}
+
+	for lastNode != 0 {
+		if p >= len(proof) {
+			return errors.New("consistency proof too short")
+		}
+		node2Hash = v.hasher.HashChildren(node2Hash, proof[p])
+		p++
+		lastNode >>= 1
+	}
+
+	if !bytes.Equal(node2Hash, root2) {
+		return RootHashMismatchError{ExpectedHash: root2, ActualHash: node2Hash}
+	}
+	if p != len(proof) {
+		return errors.New("consistency proof too long")
+	}
+
+	return nil
+}
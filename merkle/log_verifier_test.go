@@ -0,0 +1,134 @@
+package merkle
+
+import (
+	"testing"
+
+	"github.com/google/trillian/crypto"
+)
+
+func proofHashes(path []TreeEntryDescriptor) [][]byte {
+	proof := make([][]byte, 0, len(path))
+	for _, p := range path {
+		proof = append(proof, p.Value.Hash())
+	}
+	return proof
+}
+
+// corruptProof returns a copy of proof with the first byte of element i flipped.
+func corruptProof(proof [][]byte, i int) [][]byte {
+	corrupt := make([][]byte, len(proof))
+	for j := range proof {
+		corrupt[j] = append([]byte{}, proof[j]...)
+	}
+	corrupt[i][0] ^= 0xff
+	return corrupt
+}
+
+func TestVerifyInclusionProofFuzz(t *testing.T) {
+	v := NewLogVerifier(NewRFC6962TreeHasher(crypto.NewSHA256()))
+	mt := makeEmptyTree()
+	for _, data := range makeFuzzTestData()[:64] {
+		mt.AddLeaf(data)
+	}
+
+	for treeSize := 1; treeSize <= mt.LeafCount(); treeSize++ {
+		root := mt.RootAtSnapshot(treeSize).Hash()
+		for leaf := 1; leaf <= treeSize; leaf++ {
+			proof := proofHashes(mt.PathToRootAtSnapshot(leaf, treeSize))
+			leafHash := mt.leafHash(leaf)
+
+			if err := v.VerifyInclusionProof(int64(leaf-1), int64(treeSize), proof, root, leafHash); err != nil {
+				t.Fatalf("VerifyInclusionProof(%d, %d)=%v, want nil", leaf-1, treeSize, err)
+			}
+			if len(proof) == 0 {
+				continue
+			}
+			if err := v.VerifyInclusionProof(int64(leaf-1), int64(treeSize), corruptProof(proof, 0), root, leafHash); err == nil {
+				t.Errorf("VerifyInclusionProof(%d, %d, corrupt)=nil, want error", leaf-1, treeSize)
+			}
+			if err := v.VerifyInclusionProof(int64(leaf-1), int64(treeSize), proof[:len(proof)-1], root, leafHash); err == nil {
+				t.Errorf("VerifyInclusionProof(%d, %d, truncated)=nil, want error", leaf-1, treeSize)
+			}
+			if err := v.VerifyInclusionProof(int64(leaf-1), int64(treeSize), append(proof, proof[0]), root, leafHash); err == nil {
+				t.Errorf("VerifyInclusionProof(%d, %d, extended)=nil, want error", leaf-1, treeSize)
+			}
+		}
+	}
+}
+
+func TestVerifyInclusionProofBadParams(t *testing.T) {
+	v := NewLogVerifier(NewRFC6962TreeHasher(crypto.NewSHA256()))
+	var tests = []struct {
+		leafIndex, treeSize int64
+	}{
+		{-1, 1},
+		{0, 0},
+		{1, 1},
+		{5, 3},
+	}
+	for _, test := range tests {
+		if err := v.VerifyInclusionProof(test.leafIndex, test.treeSize, nil, []byte("root"), []byte("leaf")); err == nil {
+			t.Errorf("VerifyInclusionProof(%d, %d)=nil, want error", test.leafIndex, test.treeSize)
+		}
+	}
+}
+
+func TestVerifyConsistencyProofFuzz(t *testing.T) {
+	v := NewLogVerifier(NewRFC6962TreeHasher(crypto.NewSHA256()))
+	mt := makeEmptyTree()
+	for _, data := range makeFuzzTestData()[:64] {
+		mt.AddLeaf(data)
+	}
+
+	for size2 := 1; size2 <= mt.LeafCount(); size2++ {
+		root2 := mt.RootAtSnapshot(size2).Hash()
+		for size1 := 1; size1 < size2; size1++ {
+			root1 := mt.RootAtSnapshot(size1).Hash()
+			proof := proofHashes(mt.SnapshotConsistency(size1, size2))
+
+			if err := v.VerifyConsistencyProof(int64(size1), int64(size2), root1, root2, proof); err != nil {
+				t.Fatalf("VerifyConsistencyProof(%d, %d)=%v, want nil", size1, size2, err)
+			}
+			for i := range proof {
+				if err := v.VerifyConsistencyProof(int64(size1), int64(size2), root1, root2, corruptProof(proof, i)); err == nil {
+					t.Errorf("VerifyConsistencyProof(%d, %d, corrupt[%d])=nil, want error", size1, size2, i)
+				}
+			}
+			if err := v.VerifyConsistencyProof(int64(size1), int64(size2), root1, root2, proof[:len(proof)-1]); err == nil {
+				t.Errorf("VerifyConsistencyProof(%d, %d, truncated)=nil, want error", size1, size2)
+			}
+			if err := v.VerifyConsistencyProof(int64(size1), int64(size2), root2, root1, proof); err == nil {
+				t.Errorf("VerifyConsistencyProof(%d, %d, swapped roots)=nil, want error", size1, size2)
+			}
+		}
+	}
+}
+
+func TestVerifyConsistencyProofEdgeCases(t *testing.T) {
+	v := NewLogVerifier(NewRFC6962TreeHasher(crypto.NewSHA256()))
+	root1 := []byte("root1")
+	root2 := []byte("root2")
+
+	var tests = []struct {
+		size1, size2 int64
+		root1, root2 []byte
+		proof        [][]byte
+		wantErr      bool
+	}{
+		{0, 0, root1, root1, nil, false},
+		{0, 10, root1, root2, nil, false},
+		{0, 10, root1, root2, [][]byte{root1}, true},
+		{5, 5, root1, root1, nil, false},
+		{5, 5, root1, root2, nil, true},
+		{5, 5, root1, root1, [][]byte{root1}, true},
+		{6, 5, root1, root2, nil, true},
+		{-1, 5, root1, root2, nil, true},
+		{3, 5, root1, root2, nil, true},
+	}
+	for _, test := range tests {
+		err := v.VerifyConsistencyProof(test.size1, test.size2, test.root1, test.root2, test.proof)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("VerifyConsistencyProof(%d, %d, %s, %s, %v)=%v, want err: %v", test.size1, test.size2, test.root1, test.root2, test.proof, err, test.wantErr)
+		}
+	}
+}
@@ -74,6 +74,46 @@ func CalcConsistencyProofNodeAddresses(previousTreeSize, treeSize int64, maxBitL
 	return snapshotConsistency(previousTreeSize, treeSize, maxBitLen)
 }
 
+// CalcConsistencyProofCompactLevels returns, for each node of the consistency proof
+// between the two tree sizes in the order returned by CalcConsistencyProofNodeAddresses,
+// the level of the node if it is part of the compact range of the tree at
+// previousTreeSize, or -1 if it isn't. The nodes that are part of the compact range lie
+// entirely to the left of previousTreeSize, so their hashes are the same as the ones
+// held by a CompactMerkleTree of that size, indexed by level, and don't need to be read
+// from storage.
+func CalcConsistencyProofCompactLevels(previousTreeSize, treeSize int64) ([]int, error) {
+	if previousTreeSize > treeSize || previousTreeSize < 1 || treeSize < 1 {
+		return nil, fmt.Errorf("invalid params prior: %d treesize: %d", previousTreeSize, treeSize)
+	}
+
+	levels := make([]int, 0, bitLen(treeSize)+1)
+	level := 0
+	node := previousTreeSize - 1
+	for (node & 1) != 0 {
+		node >>= 1
+		level++
+	}
+	if node != 0 {
+		// The subtree ending at previousTreeSize is the lowest level of its compact range
+		levels = append(levels, level)
+	}
+
+	// Follow the same path as pathFromNodeToRootAtSnapshot. Left siblings are the
+	// higher levels of the compact range, right siblings were added after previousTreeSize.
+	for lastNode := (treeSize - 1) >> uint(level); lastNode != 0; lastNode >>= 1 {
+		sibling := node ^ 1
+		if sibling < node {
+			levels = append(levels, level)
+		} else if sibling <= lastNode {
+			levels = append(levels, -1)
+		}
+		node >>= 1
+		level++
+	}
+
+	return levels, nil
+}
+
 // snapshotConsistency does the calculation of consistency proof node addresses between
 // two snapshots. Based on the C++ code used by CT but adjusted to fit our situation.
 // In particular the code does not need to handle the case where overwritten node hashes
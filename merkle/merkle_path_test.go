@@ -1,10 +1,12 @@
 package merkle
 
 import (
+	"bytes"
 	"testing"
 
 	"fmt"
 
+	"github.com/google/trillian/crypto"
 	"github.com/google/trillian/storage"
 	"github.com/google/trillian/testonly"
 )
@@ -344,4 +346,43 @@ func TestConsistencySucceedsUpToTreeSize(t *testing.T) {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+func TestCalcConsistencyProofCompactLevels(t *testing.T) {
+	hasher := NewRFC6962TreeHasher(crypto.NewSHA256())
+	mt := NewInMemoryMerkleTree(hasher)
+	for i := 0; i < testUpToTreeSize; i++ {
+		mt.AddLeaf([]byte(fmt.Sprintf("leaf %d", i)))
+	}
+
+	cmt := NewCompactMerkleTree(hasher)
+	for s1 := 1; s1 < testUpToTreeSize; s1++ {
+		cmt.AddLeaf([]byte(fmt.Sprintf("leaf %d", s1-1)), func(int, int64, []byte) {})
+		compact := cmt.Hashes()
+		for s2 := s1 + 1; s2 < testUpToTreeSize; s2++ {
+			levels, err := CalcConsistencyProofCompactLevels(int64(s1), int64(s2))
+			if err != nil {
+				t.Fatalf("CalcConsistencyProofCompactLevels(%d, %d)=_,%v, want no error", s1, s2, err)
+			}
+			proof := mt.SnapshotConsistency(s1, s2)
+			if got, want := len(levels), len(proof); got != want {
+				t.Fatalf("CalcConsistencyProofCompactLevels(%d, %d) returned %d levels, want %d", s1, s2, got, want)
+			}
+			for i, l := range levels {
+				if l < 0 {
+					continue
+				}
+				if l >= len(compact) || !bytes.Equal(compact[l], proof[i].Value.Hash()) {
+					t.Errorf("CalcConsistencyProofCompactLevels(%d, %d)[%d]=%d, which isn't the hash of proof node %d", s1, s2, i, l, i)
+				}
+			}
+		}
+	}
+}
+
+func TestCalcConsistencyProofCompactLevelsBadInputs(t *testing.T) {
+	for _, testCase := range consistencyTestsBad {
+		if _, err := CalcConsistencyProofCompactLevels(testCase.priorTreeSize, testCase.treeSize); err == nil {
+			t.Errorf("CalcConsistencyProofCompactLevels(%d, %d)=_,nil, want error", testCase.priorTreeSize, testCase.treeSize)
+		}
+	}
+}
@@ -175,6 +175,38 @@ func (_mr *_MockTrillianLogClientRecorder) GetSequencedLeafCount(arg0, arg1 inte
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSequencedLeafCount", _s...)
 }
 
+func (_m *MockTrillianLogClient) GetTreeHeadBySize(_param0 context.Context, _param1 *trillian.GetTreeHeadBySizeRequest, _param2 ...grpc.CallOption) (*trillian.GetTreeHeadBySizeResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "GetTreeHeadBySize", _s...)
+	ret0, _ := ret[0].(*trillian.GetTreeHeadBySizeResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogClientRecorder) GetTreeHeadBySize(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTreeHeadBySize", _s...)
+}
+
+func (_m *MockTrillianLogClient) GetTreeHeadByTimestamp(_param0 context.Context, _param1 *trillian.GetTreeHeadByTimestampRequest, _param2 ...grpc.CallOption) (*trillian.GetTreeHeadByTimestampResponse, error) {
+	_s := []interface{}{_param0, _param1}
+	for _, _x := range _param2 {
+		_s = append(_s, _x)
+	}
+	ret := _m.ctrl.Call(_m, "GetTreeHeadByTimestamp", _s...)
+	ret0, _ := ret[0].(*trillian.GetTreeHeadByTimestampResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogClientRecorder) GetTreeHeadByTimestamp(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	_s := append([]interface{}{arg0, arg1}, arg2...)
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTreeHeadByTimestamp", _s...)
+}
+
 func (_m *MockTrillianLogClient) QueueLeaves(_param0 context.Context, _param1 *trillian.QueueLeavesRequest, _param2 ...grpc.CallOption) (*trillian.QueueLeavesResponse, error) {
 	_s := []interface{}{_param0, _param1}
 	for _, _x := range _param2 {
@@ -311,6 +343,28 @@ func (_mr *_MockTrillianLogServerRecorder) GetSequencedLeafCount(arg0, arg1 inte
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSequencedLeafCount", arg0, arg1)
 }
 
+func (_m *MockTrillianLogServer) GetTreeHeadBySize(_param0 context.Context, _param1 *trillian.GetTreeHeadBySizeRequest) (*trillian.GetTreeHeadBySizeResponse, error) {
+	ret := _m.ctrl.Call(_m, "GetTreeHeadBySize", _param0, _param1)
+	ret0, _ := ret[0].(*trillian.GetTreeHeadBySizeResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogServerRecorder) GetTreeHeadBySize(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTreeHeadBySize", arg0, arg1)
+}
+
+func (_m *MockTrillianLogServer) GetTreeHeadByTimestamp(_param0 context.Context, _param1 *trillian.GetTreeHeadByTimestampRequest) (*trillian.GetTreeHeadByTimestampResponse, error) {
+	ret := _m.ctrl.Call(_m, "GetTreeHeadByTimestamp", _param0, _param1)
+	ret0, _ := ret[0].(*trillian.GetTreeHeadByTimestampResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockTrillianLogServerRecorder) GetTreeHeadByTimestamp(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTreeHeadByTimestamp", arg0, arg1)
+}
+
 func (_m *MockTrillianLogServer) QueueLeaves(_param0 context.Context, _param1 *trillian.QueueLeavesRequest) (*trillian.QueueLeavesResponse, error) {
 	ret := _m.ctrl.Call(_m, "QueueLeaves", _param0, _param1)
 	ret0, _ := ret[0].(*trillian.QueueLeavesResponse)
@@ -0,0 +1,64 @@
+package monitoring
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// DefaultLatencyBucketsMillis are bucket bounds suitable for request latencies in
+// milliseconds.
+var DefaultLatencyBucketsMillis = []int64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000}
+
+// Histogram is an expvar.Var that counts observed values in buckets with fixed upper
+// bounds. It's exported as JSON holding the number of values observed, their sum, and
+// for each bound the number of values no greater than it, as Prometheus histograms are,
+// e.g. {"count": 3, "sum": 17, "le": {"1": 0, "10": 2, "+Inf": 3}}.
+type Histogram struct {
+	// count and sum come first so they're aligned for atomic access.
+	count  int64
+	sum    int64
+	bounds []int64
+	// counts[i] is the number of values in (bounds[i-1], bounds[i]]; the last one holds
+	// those above every bound.
+	counts []int64
+}
+
+// NewHistogram creates a Histogram with the given bucket upper bounds, which must be in
+// increasing order.
+func NewHistogram(bounds []int64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]int64, len(bounds)+1)}
+}
+
+// Observe adds v to the histogram.
+func (h *Histogram) Observe(v int64) {
+	i := sort.Search(len(h.bounds), func(i int) bool { return v <= h.bounds[i] })
+	atomic.AddInt64(&h.counts[i], 1)
+	atomic.AddInt64(&h.count, 1)
+	atomic.AddInt64(&h.sum, v)
+}
+
+// Count returns the number of values observed.
+func (h *Histogram) Count() int64 {
+	return atomic.LoadInt64(&h.count)
+}
+
+// Sum returns the sum of the values observed.
+func (h *Histogram) Sum() int64 {
+	return atomic.LoadInt64(&h.sum)
+}
+
+// String implements expvar.Var.
+func (h *Histogram) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `{"count": %d, "sum": %d, "le": {`, h.Count(), h.Sum())
+	var cumulative int64
+	for i, bound := range h.bounds {
+		cumulative += atomic.LoadInt64(&h.counts[i])
+		fmt.Fprintf(&b, `"%d": %d, `, bound, cumulative)
+	}
+	cumulative += atomic.LoadInt64(&h.counts[len(h.bounds)])
+	fmt.Fprintf(&b, `"+Inf": %d}}`, cumulative)
+	return b.String()
+}
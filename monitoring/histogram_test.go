@@ -0,0 +1,35 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]int64{1, 10, 100})
+	for _, v := range []int64{0, 1, 2, 10, 11, 99, 100, 101, 5000} {
+		h.Observe(v)
+	}
+	if got, want := h.Count(), int64(9); got != want {
+		t.Errorf("Count()=%d, want %d", got, want)
+	}
+	if got, want := h.Sum(), int64(5324); got != want {
+		t.Errorf("Sum()=%d, want %d", got, want)
+	}
+
+	var got struct {
+		Count int64            `json:"count"`
+		Sum   int64            `json:"sum"`
+		LE    map[string]int64 `json:"le"`
+	}
+	if err := json.Unmarshal([]byte(h.String()), &got); err != nil {
+		t.Fatalf("json.Unmarshal(%s)=%v, want no error", h.String(), err)
+	}
+	if got.Count != 9 || got.Sum != 5324 {
+		t.Errorf("String()=%s, want count 9 and sum 5324", h.String())
+	}
+	if want := map[string]int64{"1": 2, "10": 4, "100": 7, "+Inf": 9}; !reflect.DeepEqual(got.LE, want) {
+		t.Errorf("String().le=%v, want %v", got.LE, want)
+	}
+}
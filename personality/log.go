@@ -0,0 +1,195 @@
+// Package personality is an SDK for writing log personalities: the front ends, such as
+// the CT server in examples/ct, that give a Trillian log an application specific API.
+// It wraps the Trillian log RPCs in calls that build leaves the way the log server
+// expects, check response statuses and return proofs as plain hashes.
+//
+// This is one of Trillian's stable API packages (see docs/APIStability.md). Its exported
+// identifiers keep their meaning and signatures within a major version of
+// trillian.APIVersion, and it doesn't expose the merkle or storage packages.
+package personality
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/verifier"
+	"golang.org/x/net/context"
+)
+
+// ErrNoProof is returned when the log has no inclusion proof for a leaf, usually because
+// the leaf hasn't been integrated into the tree yet.
+var ErrNoProof = errors.New("personality: no inclusion proof for leaf")
+
+// Leaf is an entry in a log.
+type Leaf struct {
+	// Index is the position of the leaf in the log. It's only set for leaves that have
+	// been integrated into the tree.
+	Index int64
+	// Value is the data that's hashed into the tree.
+	Value []byte
+	// ExtraData is stored with the leaf but isn't part of the tree.
+	ExtraData []byte
+	// IdentityHash, if set, identifies duplicate submissions of the same entry. See
+	// QueueLeaf.
+	IdentityHash []byte
+	// MergeDeadline, if set, is the time by which the leaf should be integrated into the
+	// tree. Leaves with earlier deadlines are integrated first when there's a backlog.
+	MergeDeadline time.Time
+}
+
+// InclusionProof shows that a leaf is included in a tree of a particular size.
+type InclusionProof struct {
+	LeafIndex int64
+	Hashes    [][]byte
+}
+
+// Log is a personality's connection to a single Trillian log. It's safe for concurrent
+// use.
+type Log struct {
+	LogID    int64
+	client   trillian.TrillianLogClient
+	verifier *verifier.LogVerifier
+}
+
+// NewLog returns a Log that makes requests for the log with the given ID over client.
+func NewLog(logID int64, client trillian.TrillianLogClient) *Log {
+	return &Log{LogID: logID, client: client, verifier: verifier.NewLogVerifier()}
+}
+
+// LeafHash returns the Merkle leaf hash the log computes for a leaf with the given
+// value, which is how the leaf is looked up by InclusionProof.
+func (l *Log) LeafHash(value []byte) []byte {
+	return l.verifier.HashLeaf(value)
+}
+
+// QueueLeaf queues leaf for integration into the log. If the leaf has an identity hash
+// and a leaf with the same identity hash was already queued, it returns the existing
+// leaf and true instead of queueing it again.
+func (l *Log) QueueLeaf(ctx context.Context, leaf Leaf) (Leaf, bool, error) {
+	valueHash := sha256.Sum256(leaf.Value)
+	logLeaf := &trillian.LogLeaf{
+		LeafValue:        leaf.Value,
+		LeafValueHash:    valueHash[:],
+		ExtraData:        leaf.ExtraData,
+		LeafIdentityHash: leaf.IdentityHash,
+	}
+	if !leaf.MergeDeadline.IsZero() {
+		logLeaf.MergeDeadlineNanos = leaf.MergeDeadline.UnixNano()
+	}
+	rsp, err := l.client.QueueLeaves(ctx, &trillian.QueueLeavesRequest{LogId: l.LogID, Leaves: []*trillian.LogLeaf{logLeaf}})
+	if err != nil {
+		return Leaf{}, false, err
+	}
+	if err := checkStatus("QueueLeaves", rsp.GetStatus()); err != nil {
+		return Leaf{}, false, err
+	}
+	if queued := rsp.GetQueuedLeaves(); len(queued) == 1 && queued[0].Duplicate && queued[0].GetLeaf() != nil {
+		return fromLogLeaf(queued[0].GetLeaf()), true, nil
+	}
+	return leaf, false, nil
+}
+
+// LatestRoot returns the latest signed root of the log. Its signature can be checked
+// with verifier.VerifyLogRootSignature.
+func (l *Log) LatestRoot(ctx context.Context) (*trillian.SignedLogRoot, error) {
+	rsp, err := l.client.GetLatestSignedLogRoot(ctx, &trillian.GetLatestSignedLogRootRequest{LogId: l.LogID})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus("GetLatestSignedLogRoot", rsp.GetStatus()); err != nil {
+		return nil, err
+	}
+	if rsp.GetSignedLogRoot() == nil {
+		return nil, errors.New("GetLatestSignedLogRoot returned no root")
+	}
+	return rsp.GetSignedLogRoot(), nil
+}
+
+// InclusionProof returns a proof that the leaf with the given Merkle leaf hash is in the
+// tree of size treeSize. If the log holds the leaf more than once the proof is for its
+// earliest occurrence. It returns ErrNoProof if the leaf isn't in that tree.
+func (l *Log) InclusionProof(ctx context.Context, leafHash []byte, treeSize int64) (InclusionProof, error) {
+	req := &trillian.GetInclusionProofByHashRequest{LogId: l.LogID, LeafHash: leafHash, TreeSize: treeSize, OrderBySequence: true}
+	rsp, err := l.client.GetInclusionProofByHash(ctx, req)
+	if err != nil {
+		return InclusionProof{}, err
+	}
+	if err := checkStatus("GetInclusionProofByHash", rsp.GetStatus()); err != nil {
+		return InclusionProof{}, err
+	}
+	if len(rsp.GetProof()) == 0 {
+		return InclusionProof{}, ErrNoProof
+	}
+	proof := rsp.GetProof()[0]
+	return InclusionProof{LeafIndex: proof.LeafIndex, Hashes: proofHashes(proof)}, nil
+}
+
+// ConsistencyProof returns a proof that the tree of size second extends the tree of
+// size first.
+func (l *Log) ConsistencyProof(ctx context.Context, first, second int64) ([][]byte, error) {
+	req := &trillian.GetConsistencyProofRequest{LogId: l.LogID, FirstTreeSize: first, SecondTreeSize: second}
+	rsp, err := l.client.GetConsistencyProof(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus("GetConsistencyProof", rsp.GetStatus()); err != nil {
+		return nil, err
+	}
+	return proofHashes(rsp.GetProof()), nil
+}
+
+// Leaves returns the leaves at the given indices, in the same order.
+func (l *Log) Leaves(ctx context.Context, indices []int64) ([]Leaf, error) {
+	rsp, err := l.client.GetLeavesByIndex(ctx, &trillian.GetLeavesByIndexRequest{LogId: l.LogID, LeafIndex: indices})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus("GetLeavesByIndex", rsp.GetStatus()); err != nil {
+		return nil, err
+	}
+	if got, want := len(rsp.GetLeaves()), len(indices); got != want {
+		return nil, fmt.Errorf("GetLeavesByIndex returned %d leaves, want %d", got, want)
+	}
+	leaves := make([]Leaf, 0, len(indices))
+	for i, logLeaf := range rsp.GetLeaves() {
+		if got, want := logLeaf.LeafIndex, indices[i]; got != want {
+			return nil, fmt.Errorf("GetLeavesByIndex returned leaf %d at position %d, want leaf %d", got, i, want)
+		}
+		leaves = append(leaves, fromLogLeaf(logLeaf))
+	}
+	return leaves, nil
+}
+
+func fromLogLeaf(logLeaf *trillian.LogLeaf) Leaf {
+	leaf := Leaf{
+		Index:        logLeaf.LeafIndex,
+		Value:        logLeaf.LeafValue,
+		ExtraData:    logLeaf.ExtraData,
+		IdentityHash: logLeaf.LeafIdentityHash,
+	}
+	if logLeaf.MergeDeadlineNanos != 0 {
+		leaf.MergeDeadline = time.Unix(0, logLeaf.MergeDeadlineNanos)
+	}
+	return leaf
+}
+
+func checkStatus(method string, status *trillian.TrillianApiStatus) error {
+	if status == nil || status.StatusCode != trillian.TrillianApiStatusCode_OK {
+		return fmt.Errorf("%s failed, status=%v", method, status)
+	}
+	return nil
+}
+
+func proofHashes(proof *trillian.Proof) [][]byte {
+	if proof == nil {
+		return nil
+	}
+	hashes := make([][]byte, 0, len(proof.ProofNode))
+	for _, node := range proof.ProofNode {
+		hashes = append(hashes, node.NodeHash)
+	}
+	return hashes
+}
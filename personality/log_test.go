@@ -0,0 +1,155 @@
+package personality
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/mockclient"
+	"golang.org/x/net/context"
+)
+
+const logID = int64(6962)
+
+var okStatus = &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_OK}
+var errStatus = &trillian.TrillianApiStatus{StatusCode: trillian.TrillianApiStatusCode_ERROR}
+
+func TestQueueLeaf(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mc := mockclient.NewMockTrillianLogClient(ctrl)
+	log := NewLog(logID, mc)
+
+	deadline := time.Unix(1466179200, 0)
+	leaf := Leaf{Value: []byte("value"), ExtraData: []byte("extra"), IdentityHash: []byte("id"), MergeDeadline: deadline}
+	valueHash := sha256.Sum256(leaf.Value)
+	wantReq := &trillian.QueueLeavesRequest{LogId: logID, Leaves: []*trillian.LogLeaf{{
+		LeafValue:          leaf.Value,
+		LeafValueHash:      valueHash[:],
+		ExtraData:          leaf.ExtraData,
+		LeafIdentityHash:   leaf.IdentityHash,
+		MergeDeadlineNanos: deadline.UnixNano(),
+	}}}
+	existing := &trillian.LogLeaf{LeafValue: []byte("earlier value"), LeafIdentityHash: []byte("id"), LeafIndex: 3}
+
+	var tests = []struct {
+		descr   string
+		rsp     *trillian.QueueLeavesResponse
+		err     error
+		want    Leaf
+		wantDup bool
+		wantErr bool
+	}{
+		{descr: "queued", rsp: &trillian.QueueLeavesResponse{Status: okStatus}, want: leaf},
+		{descr: "duplicate", rsp: &trillian.QueueLeavesResponse{Status: okStatus, QueuedLeaves: []*trillian.QueuedLogLeaf{{Leaf: existing, Duplicate: true}}},
+			want: Leaf{Index: 3, Value: existing.LeafValue, IdentityHash: existing.LeafIdentityHash}, wantDup: true},
+		{descr: "rpc-error", err: errors.New("rpc failed"), wantErr: true},
+		{descr: "status-error", rsp: &trillian.QueueLeavesResponse{Status: errStatus}, wantErr: true},
+	}
+	for _, test := range tests {
+		mc.EXPECT().QueueLeaves(gomock.Any(), wantReq).Return(test.rsp, test.err)
+		got, dup, err := log.QueueLeaf(context.Background(), leaf)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: QueueLeaf()=_,_,%v, want error: %v", test.descr, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) || dup != test.wantDup {
+			t.Errorf("%s: QueueLeaf()=%+v,%v,nil, want %+v,%v,nil", test.descr, got, dup, test.want, test.wantDup)
+		}
+	}
+}
+
+func TestLatestRoot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mc := mockclient.NewMockTrillianLogClient(ctrl)
+	log := NewLog(logID, mc)
+	req := &trillian.GetLatestSignedLogRootRequest{LogId: logID}
+
+	root := &trillian.SignedLogRoot{TreeSize: 7, RootHash: []byte("root")}
+	mc.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Return(&trillian.GetLatestSignedLogRootResponse{Status: okStatus, SignedLogRoot: root}, nil)
+	if got, err := log.LatestRoot(context.Background()); err != nil || !reflect.DeepEqual(got, root) {
+		t.Errorf("LatestRoot()=%v,%v, want %v,nil", got, err, root)
+	}
+
+	mc.EXPECT().GetLatestSignedLogRoot(gomock.Any(), req).Return(&trillian.GetLatestSignedLogRootResponse{Status: okStatus}, nil)
+	if _, err := log.LatestRoot(context.Background()); err == nil {
+		t.Errorf("LatestRoot() with no root=_,nil, want error")
+	}
+}
+
+func TestInclusionProof(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mc := mockclient.NewMockTrillianLogClient(ctrl)
+	log := NewLog(logID, mc)
+	leafHash := log.LeafHash([]byte("value"))
+	req := &trillian.GetInclusionProofByHashRequest{LogId: logID, LeafHash: leafHash, TreeSize: 10, OrderBySequence: true}
+
+	proof := &trillian.Proof{LeafIndex: 4, ProofNode: []*trillian.Node{{NodeHash: []byte("a")}, {NodeHash: []byte("b")}}}
+	mc.EXPECT().GetInclusionProofByHash(gomock.Any(), req).Return(&trillian.GetInclusionProofByHashResponse{Status: okStatus, Proof: []*trillian.Proof{proof}}, nil)
+	got, err := log.InclusionProof(context.Background(), leafHash, 10)
+	if err != nil {
+		t.Fatalf("InclusionProof()=_,%v", err)
+	}
+	if want := (InclusionProof{LeafIndex: 4, Hashes: [][]byte{[]byte("a"), []byte("b")}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("InclusionProof()=%+v, want %+v", got, want)
+	}
+
+	mc.EXPECT().GetInclusionProofByHash(gomock.Any(), req).Return(&trillian.GetInclusionProofByHashResponse{Status: okStatus}, nil)
+	if _, err := log.InclusionProof(context.Background(), leafHash, 10); err != ErrNoProof {
+		t.Errorf("InclusionProof() with no proof=_,%v, want %v", err, ErrNoProof)
+	}
+}
+
+func TestLeaves(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mc := mockclient.NewMockTrillianLogClient(ctrl)
+	log := NewLog(logID, mc)
+	req := &trillian.GetLeavesByIndexRequest{LogId: logID, LeafIndex: []int64{5, 6}}
+	leaf5 := &trillian.LogLeaf{LeafIndex: 5, LeafValue: []byte("five")}
+	leaf6 := &trillian.LogLeaf{LeafIndex: 6, LeafValue: []byte("six"), ExtraData: []byte("extra")}
+
+	var tests = []struct {
+		descr   string
+		leaves  []*trillian.LogLeaf
+		wantErr bool
+	}{
+		{descr: "ok", leaves: []*trillian.LogLeaf{leaf5, leaf6}},
+		{descr: "missing", leaves: []*trillian.LogLeaf{leaf5}, wantErr: true},
+		{descr: "out-of-order", leaves: []*trillian.LogLeaf{leaf6, leaf5}, wantErr: true},
+	}
+	for _, test := range tests {
+		mc.EXPECT().GetLeavesByIndex(gomock.Any(), req).Return(&trillian.GetLeavesByIndexResponse{Status: okStatus, Leaves: test.leaves}, nil)
+		leaves, err := log.Leaves(context.Background(), []int64{5, 6})
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: Leaves()=_,%v, want error: %v", test.descr, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got, want := len(leaves), 2; got != want {
+			t.Fatalf("%s: Leaves() returned %d leaves, want %d", test.descr, got, want)
+		}
+		if got, want := leaves[1], (Leaf{Index: 6, Value: []byte("six"), ExtraData: []byte("extra")}); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Leaves()[1]=%+v, want %+v", test.descr, got, want)
+		}
+	}
+}
+
+func TestLeafHash(t *testing.T) {
+	want := sha256.Sum256([]byte("\x00value"))
+	if got := NewLog(logID, nil).LeafHash([]byte("value")); !bytes.Equal(got, want[:]) {
+		t.Errorf("LeafHash(value)=%x, want %x", got, want)
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/extension"
+	"github.com/google/trillian/storage"
+	"golang.org/x/net/context"
+)
+
+// TrillianAdminServer implements the TrillianAdmin RPC API defined in the proto, which
+// manages the access control lists of trees.
+type TrillianAdminServer struct {
+	registry   extension.Registry
+	authorizer *Authorizer
+}
+
+// NewTrillianAdminServer creates a new admin server backed by the storage in registry.
+func NewTrillianAdminServer(registry extension.Registry) *TrillianAdminServer {
+	return &TrillianAdminServer{registry: registry}
+}
+
+// SetAuthorizer sets the Authorizer whose cached ACLs are dropped when they're changed
+// through this server.
+func (t *TrillianAdminServer) SetAuthorizer(authorizer *Authorizer) {
+	t.authorizer = authorizer
+}
+
+// GetTreeACL returns the access control list of a tree.
+func (t *TrillianAdminServer) GetTreeACL(ctx context.Context, req *trillian.GetTreeACLRequest) (*trillian.GetTreeACLResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	acl, err := RegistryTreeACLs(t.registry)(req.TreeId)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*trillian.TreeACLEntry
+	for principal, scope := range acl {
+		entries = append(entries, &trillian.TreeACLEntry{Principal: principal, Scope: scope})
+	}
+	return &trillian.GetTreeACLResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), Entries: entries}, nil
+}
+
+// SetTreeACL replaces the access control list of a tree.
+func (t *TrillianAdminServer) SetTreeACL(ctx context.Context, req *trillian.SetTreeACLRequest) (*trillian.SetTreeACLResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	acl := make(storage.TreeACL)
+	for _, entry := range req.Entries {
+		if len(entry.Principal) == 0 {
+			return &trillian.SetTreeACLResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, "ACL entry has no principal")}, nil
+		}
+		if _, err := ParseScope(entry.Scope); err != nil {
+			return &trillian.SetTreeACLResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, err.Error())}, nil
+		}
+		if _, ok := acl[entry.Principal]; ok {
+			return &trillian.SetTreeACLResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, fmt.Sprintf("duplicate ACL entry for %q", entry.Principal))}, nil
+		}
+		acl[entry.Principal] = entry.Scope
+	}
+
+	tx, err := t.beginTreeTx(req.TreeId)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.SetTreeACL(acl); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		glog.Warningf("%d: Commit failed for SetTreeACL: %v", req.TreeId, err)
+		return nil, err
+	}
+	glog.Infof("%d: access control list set to %v", req.TreeId, acl)
+
+	if t.authorizer != nil {
+		t.authorizer.Invalidate(req.TreeId)
+	}
+	return &trillian.SetTreeACLResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK)}, nil
+}
+
+// beginTreeTx starts a transaction on a tree, which may be a log or a map.
+func (t *TrillianAdminServer) beginTreeTx(treeID int64) (storage.TreeTX, error) {
+	if ls, err := t.registry.GetLogStorage(treeID); err == nil {
+		return ls.Begin()
+	}
+	ms, err := t.registry.GetMapStorage(treeID)
+	if err != nil {
+		return nil, err
+	}
+	return ms.Begin()
+}
+
+// RegistryTreeACLs returns a TreeACLLookupFunc that reads the access control lists of
+// trees, which may be logs or maps, from the storage in registry.
+func RegistryTreeACLs(registry extension.Registry) TreeACLLookupFunc {
+	return func(treeID int64) (storage.TreeACL, error) {
+		var tx storage.ReadOnlyTreeTX
+		ls, err := registry.GetLogStorage(treeID)
+		if err == nil {
+			tx, err = ls.Snapshot()
+		} else {
+			var ms storage.MapStorage
+			if ms, err = registry.GetMapStorage(treeID); err == nil {
+				tx, err = ms.Snapshot()
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		acl, err := tx.GetTreeACL()
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		return acl, tx.Commit()
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/memory"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+func TestSetTreeACL(t *testing.T) {
+	s := memory.NewStorage()
+	if err := s.CreateMap(2, memory.TreeOptions{}); err != nil {
+		t.Fatalf("CreateMap()=%v, want no error", err)
+	}
+	admin := NewTrillianAdminServer(s)
+	ctx := context.Background()
+
+	var tests = []struct {
+		descr   string
+		treeID  int64
+		entries []*trillian.TreeACLEntry
+		wantOK  bool
+	}{
+		{descr: "log", treeID: 1, entries: []*trillian.TreeACLEntry{{Principal: "alice", Scope: "tree:write"}, {Principal: AnyPrincipal, Scope: "tree:read"}}, wantOK: true},
+		{descr: "map", treeID: 2, entries: []*trillian.TreeACLEntry{{Principal: "bob", Scope: "tree:admin"}}, wantOK: true},
+		{descr: "clear", treeID: 3, wantOK: true},
+		{descr: "bad-scope", treeID: 1, entries: []*trillian.TreeACLEntry{{Principal: "alice", Scope: "tree:all"}}},
+		{descr: "no-principal", treeID: 1, entries: []*trillian.TreeACLEntry{{Scope: "tree:read"}}},
+		{descr: "duplicate", treeID: 1, entries: []*trillian.TreeACLEntry{{Principal: "alice", Scope: "tree:read"}, {Principal: "alice", Scope: "tree:write"}}},
+	}
+
+	for _, test := range tests {
+		// Remember what was there before, as a rejected change must leave it alone.
+		before, err := admin.GetTreeACL(ctx, &trillian.GetTreeACLRequest{TreeId: test.treeID})
+		if err != nil {
+			t.Fatalf("%s: GetTreeACL()=_,%v, want no error", test.descr, err)
+		}
+
+		rsp, err := admin.SetTreeACL(ctx, &trillian.SetTreeACLRequest{TreeId: test.treeID, Entries: test.entries})
+		if err != nil {
+			t.Errorf("%s: SetTreeACL()=_,%v, want no error", test.descr, err)
+			continue
+		}
+		if got, want := rsp.Status.StatusCode == trillian.TrillianApiStatusCode_OK, test.wantOK; got != want {
+			t.Errorf("%s: SetTreeACL().Status=%v, want OK: %v", test.descr, rsp.Status, want)
+		}
+
+		want := before.Entries
+		if test.wantOK {
+			want = test.entries
+		}
+		got, err := admin.GetTreeACL(ctx, &trillian.GetTreeACLRequest{TreeId: test.treeID})
+		if err != nil {
+			t.Errorf("%s: GetTreeACL()=_,%v, want no error", test.descr, err)
+			continue
+		}
+		if !sameEntries(got.Entries, want) {
+			t.Errorf("%s: GetTreeACL()=%v, want %v", test.descr, got.Entries, want)
+		}
+	}
+}
+
+func TestSetTreeACLInvalidatesAuthorizer(t *testing.T) {
+	s := memory.NewStorage()
+	a := NewAuthorizer(RegistryTreeACLs(s), nil, time.Hour, &util.FakeTimeSource{FakeTime: time.Now()})
+	admin := NewTrillianAdminServer(s)
+	admin.SetAuthorizer(a)
+
+	if got, err := a.ScopeFor("alice", 1); err != nil || got != ScopeNone {
+		t.Fatalf("ScopeFor()=%v,%v, want %v,nil", got, err, ScopeNone)
+	}
+	entries := []*trillian.TreeACLEntry{{Principal: "alice", Scope: "tree:write"}}
+	if _, err := admin.SetTreeACL(context.Background(), &trillian.SetTreeACLRequest{TreeId: 1, Entries: entries}); err != nil {
+		t.Fatalf("SetTreeACL()=_,%v, want no error", err)
+	}
+	if got, err := a.ScopeFor("alice", 1); err != nil || got != ScopeWrite {
+		t.Errorf("ScopeFor()=%v,%v, want %v,nil", got, err, ScopeWrite)
+	}
+}
+
+func sameEntries(got, want []*trillian.TreeACLEntry) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	acl := make(storage.TreeACL)
+	for _, e := range got {
+		acl[e.Principal] = e.Scope
+	}
+	for _, e := range want {
+		if acl[e.Principal] != e.Scope {
+			return false
+		}
+	}
+	return true
+}
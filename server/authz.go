@@ -0,0 +1,277 @@
+package server
+
+import (
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Scope is a level of access to a tree. Each scope allows everything the ones below it do.
+type Scope int
+
+const (
+	// ScopeNone allows nothing.
+	ScopeNone Scope = iota
+	// ScopeRead allows reading leaves, proofs and roots.
+	ScopeRead
+	// ScopeWrite allows adding leaves as well as reading.
+	ScopeWrite
+	// ScopeAdmin allows managing the tree's access control list as well as writing.
+	ScopeAdmin
+)
+
+// AnyPrincipal is the principal that matches every caller in a tree ACL.
+const AnyPrincipal = "*"
+
+const authzMapName string = "authz"
+
+var scopeNames = map[Scope]string{
+	ScopeRead:  "tree:read",
+	ScopeWrite: "tree:write",
+	ScopeAdmin: "tree:admin",
+}
+
+func (s Scope) String() string {
+	if name, ok := scopeNames[s]; ok {
+		return name
+	}
+	return "none"
+}
+
+// ParseScope returns the scope with the given name, e.g. "tree:write".
+func ParseScope(name string) (Scope, error) {
+	for s, n := range scopeNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return ScopeNone, fmt.Errorf("unknown scope: %q", name)
+}
+
+// methodScopes holds the scope needed to call each method, keyed by full method name.
+// Methods that aren't listed can't be called at all.
+var methodScopes = map[string]Scope{
+	"/trillian.TrillianLog/QueueLeaves":              ScopeWrite,
+	"/trillian.TrillianLog/GetInclusionProof":        ScopeRead,
+	"/trillian.TrillianLog/GetInclusionProofByHash":  ScopeRead,
+	"/trillian.TrillianLog/GetConsistencyProof":      ScopeRead,
+	"/trillian.TrillianLog/GetLatestSignedLogRoot":   ScopeRead,
+	"/trillian.TrillianLog/GetTreeHeadByTimestamp":   ScopeRead,
+	"/trillian.TrillianLog/GetTreeHeadBySize":        ScopeRead,
+	"/trillian.TrillianLog/GetSequencedLeafCount":    ScopeRead,
+	"/trillian.TrillianLog/GetLeavesByIndex":         ScopeRead,
+	"/trillian.TrillianLog/GetLeavesByHash":          ScopeRead,
+	"/trillian.TrillianLog/GetLeavesByLeafValueHash": ScopeRead,
+	"/trillian.TrillianLog/GetEntryAndProof":         ScopeRead,
+	"/trillian.TrillianMap/GetLeaves":                ScopeRead,
+	"/trillian.TrillianMap/SetLeaves":                ScopeWrite,
+	"/trillian.TrillianMap/GetSignedMapRoot":         ScopeRead,
+	"/trillian.TrillianAdmin/GetTreeACL":             ScopeAdmin,
+	"/trillian.TrillianAdmin/SetTreeACL":             ScopeAdmin,
+}
+
+// treeIDOf returns the ID of the tree a request is for.
+func treeIDOf(req interface{}) (int64, bool) {
+	switch r := req.(type) {
+	case interface {
+		GetLogId() int64
+	}:
+		return r.GetLogId(), true
+	case interface {
+		GetMapId() int64
+	}:
+		return r.GetMapId(), true
+	case interface {
+		GetTreeId() int64
+	}:
+		return r.GetTreeId(), true
+	}
+	return 0, false
+}
+
+// PrincipalFromContext returns the identity of the caller of an RPC, which is the
+// common name of its verified TLS client certificate. It returns "" for callers that
+// didn't present one.
+func PrincipalFromContext(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+}
+
+// TreeACLLookupFunc returns the access control list stored with a tree.
+type TreeACLLookupFunc func(treeID int64) (storage.TreeACL, error)
+
+// cachedACL is an access control list and when it was looked up.
+type cachedACL struct {
+	acl     storage.TreeACL
+	fetched time.Time
+}
+
+// Authorizer checks that the callers of RPCs have been granted the scope each method
+// needs on the tree the request is for, according to the tree's access control list.
+type Authorizer struct {
+	lookup     TreeACLLookupFunc
+	admins     map[string]bool
+	cacheTTL   time.Duration
+	timeSource util.TimeSource
+
+	mu    sync.Mutex
+	cache map[int64]cachedACL
+
+	vars *expvar.Map
+}
+
+// NewAuthorizer creates an Authorizer that reads tree ACLs with lookup, caching them
+// for cacheTTL. The admins are granted the admin scope on every tree, so that they can
+// set up the ACLs of new trees.
+func NewAuthorizer(lookup TreeACLLookupFunc, admins []string, cacheTTL time.Duration, timeSource util.TimeSource) *Authorizer {
+	a := &Authorizer{
+		lookup:     lookup,
+		admins:     make(map[string]bool),
+		cacheTTL:   cacheTTL,
+		timeSource: timeSource,
+		cache:      make(map[int64]cachedACL),
+		vars:       new(expvar.Map).Init(),
+	}
+	for _, admin := range admins {
+		a.admins[admin] = true
+	}
+	return a
+}
+
+// Publish must be called for stats to be visible. The expvar framework will prevent
+// multiple calls to Publish from succeeding.
+func (a *Authorizer) Publish() {
+	expvar.Publish(authzMapName, a.vars)
+}
+
+// Vars returns the counts of denied requests, keyed by method.
+func (a *Authorizer) Vars() *expvar.Map {
+	return a.vars
+}
+
+// Invalidate drops the cached access control list of a tree, so that changes to it
+// apply to the next request.
+func (a *Authorizer) Invalidate(treeID int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.cache, treeID)
+}
+
+// ScopeFor returns the scope principal has been granted on a tree. A principal gets the
+// broader of the scopes granted to it and to every caller.
+func (a *Authorizer) ScopeFor(principal string, treeID int64) (Scope, error) {
+	if len(principal) > 0 && a.admins[principal] {
+		return ScopeAdmin, nil
+	}
+	acl, err := a.treeACL(treeID)
+	if err != nil {
+		return ScopeNone, err
+	}
+
+	scope := ScopeNone
+	names := []string{AnyPrincipal}
+	if len(principal) > 0 {
+		names = append(names, principal)
+	}
+	for _, name := range names {
+		granted, ok := acl[name]
+		if !ok {
+			continue
+		}
+		s, err := ParseScope(granted)
+		if err != nil {
+			glog.Warningf("%d: ignoring ACL entry for %q: %v", treeID, name, err)
+			continue
+		}
+		if s > scope {
+			scope = s
+		}
+	}
+	return scope, nil
+}
+
+func (a *Authorizer) treeACL(treeID int64) (storage.TreeACL, error) {
+	now := a.timeSource.Now()
+	a.mu.Lock()
+	cached, ok := a.cache[treeID]
+	a.mu.Unlock()
+	if ok && now.Sub(cached.fetched) < a.cacheTTL {
+		return cached.acl, nil
+	}
+
+	acl, err := a.lookup(treeID)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	a.cache[treeID] = cachedACL{acl: acl, fetched: now}
+	a.mu.Unlock()
+	return acl, nil
+}
+
+// Interceptor returns a UnaryServerInterceptor that rejects RPCs whose caller hasn't
+// been granted the scope needed for the method. Callers without a client certificate
+// get an Unauthenticated status if they're denied, and others PermissionDenied.
+func (a *Authorizer) Interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		principal := PrincipalFromContext(ctx)
+		if err := a.authorize(principal, info.FullMethod, req); err != nil {
+			glog.Warningf("%s: denied %q: %v", info.FullMethod, principal, err)
+			a.vars.Add(info.FullMethod, 1)
+			if len(principal) == 0 {
+				return nil, status.Errorf(codes.Unauthenticated, "%s: %v", info.FullMethod, err)
+			}
+			return nil, status.Errorf(codes.PermissionDenied, "%s: %v", info.FullMethod, err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (a *Authorizer) authorize(principal, fullMethod string, req interface{}) error {
+	need, ok := methodScopes[fullMethod]
+	if !ok {
+		return fmt.Errorf("method has no scope")
+	}
+	treeID, ok := treeIDOf(req)
+	if !ok {
+		return fmt.Errorf("request has no tree ID")
+	}
+	got, err := a.ScopeFor(principal, treeID)
+	if err != nil {
+		return fmt.Errorf("failed to read ACL of tree %d: %v", treeID, err)
+	}
+	if got < need {
+		return fmt.Errorf("%s needed on tree %d, caller has %s", need, treeID, got)
+	}
+	return nil
+}
+
+// ParsePrincipals splits a comma separated list of principals, ignoring empty entries.
+func ParsePrincipals(s string) []string {
+	var ret []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); len(p) > 0 {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// contextForPrincipal returns a context for an RPC made by a caller that presented a
+// client certificate with the given common name, or none if it's empty.
+func contextForPrincipal(principal string) context.Context {
+	var state tls.ConnectionState
+	if len(principal) > 0 {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: principal}}
+		state.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestParseScope(t *testing.T) {
+	var tests = []struct {
+		in      string
+		want    Scope
+		wantErr bool
+	}{
+		{in: "tree:read", want: ScopeRead},
+		{in: "tree:write", want: ScopeWrite},
+		{in: "tree:admin", want: ScopeAdmin},
+		{in: "tree:everything", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseScope(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseScope(%q)=_,%v, want error: %v", test.in, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseScope(%q)=%v, want %v", test.in, got, test.want)
+		}
+		if err == nil && got.String() != test.in {
+			t.Errorf("ParseScope(%q).String()=%q, want %q", test.in, got.String(), test.in)
+		}
+	}
+}
+
+func TestAuthorizerInterceptor(t *testing.T) {
+	acls := map[int64]storage.TreeACL{
+		1: {"alice": "tree:write", "bob": "tree:read", "eve": "tree:bogus"},
+		2: {AnyPrincipal: "tree:read", "carol": "tree:admin"},
+	}
+	lookup := func(treeID int64) (storage.TreeACL, error) {
+		if treeID == 3 {
+			return nil, errors.New("storage is down")
+		}
+		return acls[treeID], nil
+	}
+	a := NewAuthorizer(lookup, []string{"root"}, time.Minute, &util.FakeTimeSource{FakeTime: time.Now()})
+	okHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	var tests = []struct {
+		descr     string
+		principal string
+		method    string
+		req       interface{}
+		wantCode  codes.Code
+	}{
+		{descr: "writer-write", principal: "alice", method: "/trillian.TrillianLog/QueueLeaves", req: &trillian.QueueLeavesRequest{LogId: 1}, wantCode: codes.OK},
+		{descr: "writer-read", principal: "alice", method: "/trillian.TrillianLog/GetLeavesByIndex", req: &trillian.GetLeavesByIndexRequest{LogId: 1}, wantCode: codes.OK},
+		{descr: "writer-admin", principal: "alice", method: "/trillian.TrillianAdmin/SetTreeACL", req: &trillian.SetTreeACLRequest{TreeId: 1}, wantCode: codes.PermissionDenied},
+		{descr: "reader-write", principal: "bob", method: "/trillian.TrillianLog/QueueLeaves", req: &trillian.QueueLeavesRequest{LogId: 1}, wantCode: codes.PermissionDenied},
+		{descr: "reader-read-by-value", principal: "bob", method: "/trillian.TrillianLog/GetLeavesByLeafValueHash", req: &trillian.GetLeavesByHashRequest{LogId: 1}, wantCode: codes.OK},
+		{descr: "reader-read", principal: "bob", method: "/trillian.TrillianLog/GetLatestSignedLogRoot", req: &trillian.GetLatestSignedLogRootRequest{LogId: 1}, wantCode: codes.OK},
+		{descr: "reader-other-tree", principal: "bob", method: "/trillian.TrillianMap/SetLeaves", req: &trillian.SetMapLeavesRequest{MapId: 2}, wantCode: codes.PermissionDenied},
+		{descr: "bad-scope", principal: "eve", method: "/trillian.TrillianLog/GetLeavesByIndex", req: &trillian.GetLeavesByIndexRequest{LogId: 1}, wantCode: codes.PermissionDenied},
+		{descr: "anonymous", method: "/trillian.TrillianLog/GetLeavesByIndex", req: &trillian.GetLeavesByIndexRequest{LogId: 1}, wantCode: codes.Unauthenticated},
+		{descr: "anonymous-any", method: "/trillian.TrillianMap/GetLeaves", req: &trillian.GetMapLeavesRequest{MapId: 2}, wantCode: codes.OK},
+		{descr: "any-plus-own", principal: "carol", method: "/trillian.TrillianAdmin/GetTreeACL", req: &trillian.GetTreeACLRequest{TreeId: 2}, wantCode: codes.OK},
+		{descr: "admin", principal: "root", method: "/trillian.TrillianAdmin/SetTreeACL", req: &trillian.SetTreeACLRequest{TreeId: 4}, wantCode: codes.OK},
+		{descr: "unknown-method", principal: "root", method: "/trillian.TrillianLog/DropTree", req: &trillian.GetLeavesByIndexRequest{LogId: 1}, wantCode: codes.PermissionDenied},
+		{descr: "no-tree-id", principal: "alice", method: "/trillian.TrillianLog/QueueLeaves", req: "not a request", wantCode: codes.PermissionDenied},
+		{descr: "lookup-fails", principal: "alice", method: "/trillian.TrillianLog/GetLeavesByIndex", req: &trillian.GetLeavesByIndexRequest{LogId: 3}, wantCode: codes.PermissionDenied},
+	}
+
+	for _, test := range tests {
+		info := &grpc.UnaryServerInfo{FullMethod: test.method}
+		rsp, err := a.Interceptor()(contextForPrincipal(test.principal), test.req, info, okHandler)
+		if got, want := status.Code(err), test.wantCode; got != want {
+			t.Errorf("%s: Interceptor()=_,%v, want code %v", test.descr, err, want)
+			continue
+		}
+		if err == nil && rsp != "ok" {
+			t.Errorf("%s: Interceptor()=%v, want ok", test.descr, rsp)
+		}
+	}
+
+	if got, want := a.Vars().Get("/trillian.TrillianLog/QueueLeaves").String(), "2"; got != want {
+		t.Errorf("denied QueueLeaves=%s, want %s", got, want)
+	}
+}
+
+func TestAuthorizerCache(t *testing.T) {
+	lookups := 0
+	acl := storage.TreeACL{"alice": "tree:read"}
+	lookup := func(treeID int64) (storage.TreeACL, error) {
+		lookups++
+		return acl, nil
+	}
+	timeSource := &util.FakeTimeSource{FakeTime: time.Now()}
+	a := NewAuthorizer(lookup, nil, time.Minute, timeSource)
+
+	var tests = []struct {
+		descr       string
+		advance     time.Duration
+		newACL      storage.TreeACL
+		invalidate  bool
+		want        Scope
+		wantLookups int
+	}{
+		{descr: "first", want: ScopeRead, wantLookups: 1},
+		{descr: "cached", advance: 30 * time.Second, newACL: storage.TreeACL{"alice": "tree:write"}, want: ScopeRead, wantLookups: 1},
+		{descr: "expired", advance: 30 * time.Second, want: ScopeWrite, wantLookups: 2},
+		{descr: "invalidated", newACL: storage.TreeACL{}, invalidate: true, want: ScopeNone, wantLookups: 3},
+	}
+
+	for _, test := range tests {
+		timeSource.FakeTime = timeSource.FakeTime.Add(test.advance)
+		if test.newACL != nil {
+			acl = test.newACL
+		}
+		if test.invalidate {
+			a.Invalidate(1)
+		}
+		got, err := a.ScopeFor("alice", 1)
+		if err != nil {
+			t.Errorf("%s: ScopeFor()=_,%v, want no error", test.descr, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: ScopeFor()=%v, want %v", test.descr, got, test.want)
+		}
+		if lookups != test.wantLookups {
+			t.Errorf("%s: made %d lookups, want %d", test.descr, lookups, test.wantLookups)
+		}
+	}
+}
+
+func TestParsePrincipals(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want []string
+	}{
+		{in: "", want: nil},
+		{in: "alice", want: []string{"alice"}},
+		{in: "alice, bob,,", want: []string{"alice", "bob"}},
+	}
+
+	for _, test := range tests {
+		got := ParsePrincipals(test.in)
+		if len(got) != len(test.want) {
+			t.Errorf("ParsePrincipals(%q)=%v, want %v", test.in, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("ParsePrincipals(%q)=%v, want %v", test.in, got, test.want)
+				break
+			}
+		}
+	}
+}
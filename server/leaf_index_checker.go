@@ -0,0 +1,288 @@
+package server
+
+import (
+	"expvar"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/extension"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+const leafIndexCheckerMapName string = "leaf-index-checker"
+
+// LeafIndexProblemKind is the way in which a sequence number is inconsistent in storage.
+type LeafIndexProblemKind int
+
+const (
+	// MissingLeafIndex means there is no leaf stored for a sequence number in the tree.
+	MissingLeafIndex LeafIndexProblemKind = iota
+	// DuplicateLeafIndex means more than one leaf is stored for a sequence number.
+	DuplicateLeafIndex
+	// UnexpectedLeafIndex means storage returned a leaf with a sequence number that wasn't
+	// asked for.
+	UnexpectedLeafIndex
+	// UnreadableLeafIndex means the leaf for a sequence number could not be read. Storage
+	// implementations report missing and duplicate leaves as errors, so this is usually one
+	// of the two, though it may also be a storage failure.
+	UnreadableLeafIndex
+	// LeafCountMismatch means the number of sequenced leaves doesn't match the size of the
+	// latest tree.
+	LeafCountMismatch
+)
+
+func (k LeafIndexProblemKind) String() string {
+	switch k {
+	case MissingLeafIndex:
+		return "missing"
+	case DuplicateLeafIndex:
+		return "duplicate"
+	case UnexpectedLeafIndex:
+		return "unexpected"
+	case UnreadableLeafIndex:
+		return "unreadable"
+	case LeafCountMismatch:
+		return "count-mismatch"
+	}
+	return "unknown"
+}
+
+// LeafIndexProblem describes an inconsistency found in the sequenced leaves of a log.
+type LeafIndexProblem struct {
+	Kind LeafIndexProblemKind
+	// Index is the sequence number with the problem. For LeafCountMismatch it's the
+	// number of sequenced leaves in storage.
+	Index int64
+	// Detail holds the tree size for LeafCountMismatch, or the number of leaves found for
+	// DuplicateLeafIndex.
+	Detail int64
+	Err    error
+}
+
+func (p LeafIndexProblem) String() string {
+	switch p.Kind {
+	case DuplicateLeafIndex:
+		return fmt.Sprintf("found %d leaves with index %d", p.Detail, p.Index)
+	case UnreadableLeafIndex:
+		return fmt.Sprintf("failed to read leaf with index %d: %v", p.Index, p.Err)
+	case LeafCountMismatch:
+		return fmt.Sprintf("found %d sequenced leaves for tree size %d", p.Index, p.Detail)
+	}
+	return fmt.Sprintf("%s leaf index %d", p.Kind, p.Index)
+}
+
+// LeafIndexChecker is a LogOperation that scans the sequenced leaves of logs a batch at a
+// time, looking for duplicate or missing sequence numbers. Each pass checks the next batch
+// of every log, starting again from the first leaf once it reaches the end of the tree, so
+// it can be run slowly in the background. Problems are logged as critical errors and
+// counted in the exported statistics, which monitoring should alert on.
+type LeafIndexChecker struct {
+	mu   sync.Mutex
+	next map[int64]int64 // logID => next sequence number to check
+	vars *expvar.Map     // logID => expvar.Map of the stats for that log
+}
+
+// NewLeafIndexChecker creates a LeafIndexChecker that starts from the first leaf of
+// each log.
+func NewLeafIndexChecker() *LeafIndexChecker {
+	return &LeafIndexChecker{next: make(map[int64]int64), vars: new(expvar.Map).Init()}
+}
+
+// Publish must be called for stats to be visible. The expvar framework will prevent
+// multiple calls to Publish from succeeding.
+func (c *LeafIndexChecker) Publish() {
+	expvar.Publish(leafIndexCheckerMapName, c.vars)
+}
+
+// Name returns the name of the object.
+func (c *LeafIndexChecker) Name() string {
+	return "LeafIndexChecker"
+}
+
+// ExecutePass checks the next batch of sequenced leaves in each of the specified Logs.
+func (c *LeafIndexChecker) ExecutePass(logIDs []int64, logctx LogOperationManagerContext) bool {
+	for _, logID := range logIDs {
+		select {
+		case <-logctx.ctx.Done():
+			return true
+		default:
+		}
+
+		ctx := util.NewLogContext(logctx.ctx, logID)
+		if err := c.checkNextBatch(ctx, logID, logctx.registry, logctx.batchSize); err != nil {
+			glog.Warningf("%s: Failed to check leaf indices: %v", util.LogIDPrefix(ctx), err)
+		}
+	}
+	return false
+}
+
+func (c *LeafIndexChecker) checkNextBatch(ctx context.Context, logID int64, registry extension.Registry, batchSize int) error {
+	logStorage, err := registry.GetLogStorage(logID)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	start := c.next[logID]
+	c.mu.Unlock()
+
+	problems, checked, treeSize, err := checkLeafIndices(logStorage, start, int64(batchSize))
+	if err != nil {
+		return err
+	}
+
+	// The check goes back to the start if the tree has shrunk, e.g. after a restore.
+	if start >= treeSize {
+		start = 0
+	}
+	stats := c.statsForLog(logID)
+	next := start + checked
+	if next >= treeSize {
+		next = 0
+		if checked > 0 {
+			stats.Get("scans").(*expvar.Int).Add(1)
+		}
+	}
+	c.mu.Lock()
+	c.next[logID] = next
+	c.mu.Unlock()
+
+	stats.Get("leaves-checked").(*expvar.Int).Add(checked)
+	stats.Get("next-index").(*expvar.Int).Set(next)
+	stats.Get("problems").(*expvar.Int).Add(int64(len(problems)))
+	for _, p := range problems {
+		glog.Errorf("%s: CRITICAL: leaf storage is inconsistent: %v", util.LogIDPrefix(ctx), p)
+	}
+	return nil
+}
+
+func (c *LeafIndexChecker) statsForLog(logID int64) *expvar.Map {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := strconv.FormatInt(logID, 10)
+	if stats, ok := c.vars.Get(key).(*expvar.Map); ok {
+		return stats
+	}
+	stats := new(expvar.Map).Init()
+	for _, name := range []string{"leaves-checked", "next-index", "scans", "problems"} {
+		stats.Set(name, new(expvar.Int))
+	}
+	c.vars.Set(key, stats)
+	return stats
+}
+
+// CheckLeafIndices scans all the sequenced leaves of a log, batchSize at a time, and
+// returns any duplicate or missing sequence numbers it finds. It's meant for checking
+// storage offline; each batch is read in its own transaction.
+func CheckLeafIndices(logStorage storage.ReadOnlyLogStorage, batchSize int64) ([]LeafIndexProblem, error) {
+	var problems []LeafIndexProblem
+	for start := int64(0); ; {
+		p, checked, treeSize, err := checkLeafIndices(logStorage, start, batchSize)
+		if err != nil {
+			return problems, err
+		}
+		problems = append(problems, p...)
+		start += checked
+		if start >= treeSize {
+			return problems, nil
+		}
+	}
+}
+
+// checkLeafIndices checks up to count sequenced leaves from start, which is treated as
+// zero if it's beyond the end of the tree. The leaf count is checked against the tree size
+// when starting from the first leaf. It returns the problems found, the number of leaves
+// checked and the size of the tree.
+func checkLeafIndices(logStorage storage.ReadOnlyLogStorage, start, count int64) (problems []LeafIndexProblem, checked, treeSize int64, err error) {
+	tx, err := logStorage.Snapshot()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		if e := tx.Commit(); e != nil {
+			problems, checked, treeSize, err = nil, 0, 0, e
+		}
+	}()
+
+	root, err := tx.LatestSignedLogRoot()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	treeSize = root.TreeSize
+	if start >= treeSize {
+		start = 0
+	}
+
+	if start == 0 {
+		leafCount, err := tx.GetSequencedLeafCount()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if leafCount != treeSize {
+			problems = append(problems, LeafIndexProblem{Kind: LeafCountMismatch, Index: leafCount, Detail: treeSize})
+		}
+	}
+
+	if start+count > treeSize {
+		count = treeSize - start
+	}
+	if count <= 0 {
+		return problems, 0, treeSize, nil
+	}
+	indices := make([]int64, 0, count)
+	for i := start; i < start+count; i++ {
+		indices = append(indices, i)
+	}
+
+	leaves, err := tx.GetLeavesByIndex(indices)
+	if err == nil {
+		return append(problems, leafIndexProblems(indices, leaves)...), count, treeSize, nil
+	}
+
+	// Storage fails the whole read if any leaf is missing or duplicated, so read them one
+	// at a time to find which.
+	for _, index := range indices {
+		leaves, err := tx.GetLeavesByIndex([]int64{index})
+		if err != nil {
+			problems = append(problems, LeafIndexProblem{Kind: UnreadableLeafIndex, Index: index, Err: err})
+			continue
+		}
+		problems = append(problems, leafIndexProblems([]int64{index}, leaves)...)
+	}
+	return problems, count, treeSize, nil
+}
+
+// leafIndexProblems compares the leaves storage returned with the indices asked for.
+func leafIndexProblems(indices []int64, leaves []trillian.LogLeaf) []LeafIndexProblem {
+	var problems []LeafIndexProblem
+	found := make(map[int64]int64)
+	for _, index := range indices {
+		found[index] = 0
+	}
+	for _, leaf := range leaves {
+		if _, ok := found[leaf.LeafIndex]; !ok {
+			problems = append(problems, LeafIndexProblem{Kind: UnexpectedLeafIndex, Index: leaf.LeafIndex})
+			continue
+		}
+		found[leaf.LeafIndex]++
+	}
+	for _, index := range indices {
+		switch n := found[index]; {
+		case n == 0:
+			problems = append(problems, LeafIndexProblem{Kind: MissingLeafIndex, Index: index})
+		case n > 1:
+			problems = append(problems, LeafIndexProblem{Kind: DuplicateLeafIndex, Index: index, Detail: n})
+		}
+	}
+	return problems
+}
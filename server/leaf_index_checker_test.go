@@ -0,0 +1,206 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/testonly"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+// fakeLeafStorage holds the sequenced leaves of a log, which may be inconsistent. Like
+// MySQL storage, it returns every leaf stored at an index, and fails reads that don't
+// get one leaf per index.
+type fakeLeafStorage struct {
+	storage.LogStorage
+	treeSize int64
+	leaves   []trillian.LogLeaf
+	// rootErr is returned when reading the tree size if set
+	rootErr error
+}
+
+func newFakeLeafStorage(treeSize int64) *fakeLeafStorage {
+	s := &fakeLeafStorage{treeSize: treeSize}
+	for i := int64(0); i < treeSize; i++ {
+		s.leaves = append(s.leaves, trillian.LogLeaf{LeafIndex: i})
+	}
+	return s
+}
+
+func (s *fakeLeafStorage) Snapshot() (storage.ReadOnlyLogTX, error) {
+	return fakeLeafTX{s: s}, nil
+}
+
+type fakeLeafTX struct {
+	storage.ReadOnlyLogTX
+	s *fakeLeafStorage
+}
+
+func (t fakeLeafTX) LatestSignedLogRoot() (trillian.SignedLogRoot, error) {
+	if t.s.rootErr != nil {
+		return trillian.SignedLogRoot{}, t.s.rootErr
+	}
+	return trillian.SignedLogRoot{TreeSize: t.s.treeSize}, nil
+}
+
+func (t fakeLeafTX) GetSequencedLeafCount() (int64, error) {
+	return int64(len(t.s.leaves)), nil
+}
+
+func (t fakeLeafTX) GetLeavesByIndex(indices []int64) ([]trillian.LogLeaf, error) {
+	var ret []trillian.LogLeaf
+	for _, index := range indices {
+		for _, leaf := range t.s.leaves {
+			if leaf.LeafIndex == index {
+				ret = append(ret, leaf)
+			}
+		}
+	}
+	if len(ret) != len(indices) {
+		return nil, fmt.Errorf("expected %d leaves, but saw %d", len(indices), len(ret))
+	}
+	return ret, nil
+}
+
+func (t fakeLeafTX) Commit() error {
+	return nil
+}
+
+func (t fakeLeafTX) Rollback() error {
+	return nil
+}
+
+// moveLeaf changes the index of a leaf, leaving its old index missing and its new one
+// duplicated.
+func (s *fakeLeafStorage) moveLeaf(from, to int64) {
+	for i := range s.leaves {
+		if s.leaves[i].LeafIndex == from {
+			s.leaves[i].LeafIndex = to
+			return
+		}
+	}
+}
+
+func TestCheckLeafIndices(t *testing.T) {
+	var tests = []struct {
+		descr   string
+		corrupt func(s *fakeLeafStorage)
+		want    []LeafIndexProblem
+	}{
+		{
+			descr:   "consistent",
+			corrupt: func(s *fakeLeafStorage) {},
+		},
+		{
+			descr:   "duplicate",
+			corrupt: func(s *fakeLeafStorage) { s.leaves = append(s.leaves, trillian.LogLeaf{LeafIndex: 3}) },
+			want: []LeafIndexProblem{
+				{Kind: LeafCountMismatch, Index: 11, Detail: 10},
+				{Kind: UnreadableLeafIndex, Index: 3, Err: errors.New("expected 1 leaves, but saw 2")},
+			},
+		},
+		{
+			descr:   "missing",
+			corrupt: func(s *fakeLeafStorage) { s.leaves = s.leaves[:9] },
+			want: []LeafIndexProblem{
+				{Kind: LeafCountMismatch, Index: 9, Detail: 10},
+				{Kind: UnreadableLeafIndex, Index: 9, Err: errors.New("expected 1 leaves, but saw 0")},
+			},
+		},
+		{
+			descr:   "moved",
+			corrupt: func(s *fakeLeafStorage) { s.moveLeaf(5, 6) },
+			want: []LeafIndexProblem{
+				{Kind: MissingLeafIndex, Index: 5},
+				{Kind: DuplicateLeafIndex, Index: 6, Detail: 2},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s := newFakeLeafStorage(10)
+		test.corrupt(s)
+		got, err := CheckLeafIndices(s, 4)
+		if err != nil {
+			t.Errorf("%s: CheckLeafIndices()=_,%v, want no error", test.descr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: CheckLeafIndices()=%v, want %v", test.descr, got, test.want)
+		}
+	}
+}
+
+func TestCheckLeafIndicesStorageError(t *testing.T) {
+	s := newFakeLeafStorage(10)
+	s.rootErr = errors.New("storage down")
+	if got, err := CheckLeafIndices(s, 4); err == nil {
+		t.Errorf("CheckLeafIndices()=%v,nil, want error", got)
+	}
+}
+
+func TestLeafIndexProblems(t *testing.T) {
+	var tests = []struct {
+		leaves []int64
+		want   []LeafIndexProblem
+	}{
+		{leaves: []int64{1, 2, 3}},
+		{leaves: []int64{3, 1, 2}},
+		{leaves: []int64{1, 3}, want: []LeafIndexProblem{{Kind: MissingLeafIndex, Index: 2}}},
+		{leaves: []int64{1, 2, 2, 2, 3}, want: []LeafIndexProblem{{Kind: DuplicateLeafIndex, Index: 2, Detail: 3}}},
+		{leaves: []int64{1, 2, 4}, want: []LeafIndexProblem{{Kind: UnexpectedLeafIndex, Index: 4}, {Kind: MissingLeafIndex, Index: 3}}},
+	}
+
+	for _, test := range tests {
+		var leaves []trillian.LogLeaf
+		for _, index := range test.leaves {
+			leaves = append(leaves, trillian.LogLeaf{LeafIndex: index})
+		}
+		if got := leafIndexProblems([]int64{1, 2, 3}, leaves); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("leafIndexProblems(%v)=%v, want %v", test.leaves, got, test.want)
+		}
+	}
+}
+
+func TestLeafIndexCheckerExecutePass(t *testing.T) {
+	s := newFakeLeafStorage(5)
+	s.moveLeaf(4, 1)
+	c := NewLeafIndexChecker()
+	logctx := LogOperationManagerContext{
+		ctx:       util.NewLogContext(context.Background(), -1),
+		registry:  testonly.NewRegistryWithLogStorage(s),
+		batchSize: 2,
+	}
+
+	// Each pass checks the next two leaves, going back to the start after the end.
+	var tests = []struct {
+		wantNext     int64
+		wantProblems int64
+		wantScans    int64
+	}{
+		{wantNext: 2, wantProblems: 1},
+		{wantNext: 4, wantProblems: 1},
+		{wantNext: 0, wantProblems: 2, wantScans: 1},
+		{wantNext: 2, wantProblems: 3, wantScans: 1},
+	}
+	for i, test := range tests {
+		if quit := c.ExecutePass([]int64{6}, logctx); quit {
+			t.Fatalf("pass %d: ExecutePass()=true, want false", i)
+		}
+		stats := c.statsForLog(6)
+		if got := stats.Get("next-index").String(); got != fmt.Sprint(test.wantNext) {
+			t.Errorf("pass %d: next-index=%s, want %d", i, got, test.wantNext)
+		}
+		if got := stats.Get("problems").String(); got != fmt.Sprint(test.wantProblems) {
+			t.Errorf("pass %d: problems=%s, want %d", i, got, test.wantProblems)
+		}
+		if got := stats.Get("scans").String(); got != fmt.Sprint(test.wantScans) {
+			t.Errorf("pass %d: scans=%s, want %d", i, got, test.wantScans)
+		}
+	}
+}
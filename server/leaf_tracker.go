@@ -0,0 +1,404 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian"
+	"github.com/google/trillian/extension"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+// DefaultMaxTrackedLeaves is the default number of leaves a LeafTracker remembers.
+const DefaultMaxTrackedLeaves = 100000
+
+const leafTrackerMapName string = "leaf-tracker"
+
+// LeafState is how far a tracked leaf has got on its way into the tree.
+type LeafState int
+
+const (
+	// LeafQueued means the leaf has been queued and is waiting to be sequenced.
+	LeafQueued LeafState = iota
+	// LeafIntegrated means the leaf has been sequenced and is part of the tree.
+	LeafIntegrated
+	// LeafFailed means the leaf could not be queued.
+	LeafFailed
+)
+
+func (s LeafState) String() string {
+	switch s {
+	case LeafQueued:
+		return "queued"
+	case LeafIntegrated:
+		return "integrated"
+	case LeafFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// MarshalText makes LeafState values readable in JSON.
+func (s LeafState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// LeafStatus describes the progress of a single leaf.
+type LeafStatus struct {
+	LogID          int64  `json:"log_id"`
+	MerkleLeafHash []byte `json:"merkle_leaf_hash"`
+	// CorrelationID is the request ID the leaf was queued under, which ties it to the
+	// personality's logs, e.g. the CT add-chain request that submitted it.
+	CorrelationID string    `json:"correlation_id"`
+	State         LeafState `json:"state"`
+	// LeafIndex is only meaningful once the leaf is integrated.
+	LeafIndex    int64     `json:"leaf_index"`
+	QueuedAt     time.Time `json:"queued_at"`
+	IntegratedAt time.Time `json:"integrated_at"`
+	// FailedBatches counts the sequencing batches the leaf was part of that failed.
+	FailedBatches int    `json:"failed_batches"`
+	Error         string `json:"error,omitempty"`
+}
+
+type leafKey struct {
+	logID int64
+	hash  string
+}
+
+// LeafTracker follows leaves from QueueLeaves through to integration by the sequencer,
+// so the fate of a particular submission can be looked up by its correlation ID or leaf
+// hash when investigating a stuck submission. The state is held in memory and covers the
+// most recently queued leaves. If a registry is set, leaves it doesn't know about, e.g.
+// because they were queued before a restart, are looked for in the queue in storage.
+type LeafTracker struct {
+	timeSource util.TimeSource
+	maxTracked int
+	registry   extension.Registry
+
+	mu     sync.Mutex
+	leaves map[leafKey]*LeafStatus
+	byID   map[string][]leafKey
+	order  []leafKey // in queueing order, for evicting old entries
+
+	exp struct {
+		vars              *expvar.Map
+		queued            *expvar.Int
+		integrated        *expvar.Int
+		failed            *expvar.Int
+		failedBatches     *expvar.Int
+		integrationMillis *expvar.Int
+		missedDeadline    *expvar.Int
+	}
+}
+
+// NewLeafTracker creates a LeafTracker that remembers up to maxTracked leaves.
+func NewLeafTracker(timeSource util.TimeSource, maxTracked int) *LeafTracker {
+	if maxTracked <= 0 {
+		maxTracked = DefaultMaxTrackedLeaves
+	}
+	t := &LeafTracker{
+		timeSource: timeSource,
+		maxTracked: maxTracked,
+		leaves:     make(map[leafKey]*LeafStatus),
+		byID:       make(map[string][]leafKey),
+	}
+	t.exp.vars = new(expvar.Map).Init()
+	t.exp.queued = new(expvar.Int)
+	t.exp.vars.Set("queued", t.exp.queued)
+	t.exp.integrated = new(expvar.Int)
+	t.exp.vars.Set("integrated", t.exp.integrated)
+	t.exp.failed = new(expvar.Int)
+	t.exp.vars.Set("failed", t.exp.failed)
+	t.exp.failedBatches = new(expvar.Int)
+	t.exp.vars.Set("failed-batch-leaves", t.exp.failedBatches)
+	t.exp.integrationMillis = new(expvar.Int)
+	t.exp.vars.Set("queue-to-integration-total-ms", t.exp.integrationMillis)
+	t.exp.missedDeadline = new(expvar.Int)
+	t.exp.vars.Set("missed-merge-deadline", t.exp.missedDeadline)
+	return t
+}
+
+// SetRegistry sets the registry whose log storage is searched for queued leaves that
+// aren't tracked in memory.
+func (t *LeafTracker) SetRegistry(registry extension.Registry) {
+	t.registry = registry
+}
+
+// Publish must be called for stats to be visible. The expvar framework will prevent
+// multiple calls to Publish from succeeding.
+func (t *LeafTracker) Publish() {
+	expvar.Publish(leafTrackerMapName, t.exp.vars)
+}
+
+// LeavesQueued records that leaves have been queued by the request associated with ctx.
+// If queueing failed err says why.
+func (t *LeafTracker) LeavesQueued(ctx context.Context, leaves []trillian.LogLeaf, err error) {
+	logID, _ := util.LogIDFromContext(ctx)
+	id, _ := util.RequestIDFromContext(ctx)
+	now := t.timeSource.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, leaf := range leaves {
+		status := &LeafStatus{
+			LogID:          logID,
+			MerkleLeafHash: leaf.MerkleLeafHash,
+			CorrelationID:  id,
+			State:          LeafQueued,
+			QueuedAt:       now,
+		}
+		if err != nil {
+			status.State = LeafFailed
+			status.Error = err.Error()
+			t.exp.failed.Add(1)
+		} else {
+			t.exp.queued.Add(1)
+		}
+		t.add(status)
+	}
+}
+
+// LeavesIntegrated implements log.LeafObserver.
+func (t *LeafTracker) LeavesIntegrated(ctx context.Context, leaves []trillian.LogLeaf) {
+	logID, _ := util.LogIDFromContext(ctx)
+	now := t.timeSource.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, leaf := range leaves {
+		t.exp.integrated.Add(1)
+		if leaf.MergeDeadlineNanos > 0 && now.UnixNano() > leaf.MergeDeadlineNanos {
+			t.exp.missedDeadline.Add(1)
+			glog.Warningf("%s: leaf %x integrated %v after its merge deadline", util.LogIDPrefix(ctx), leaf.MerkleLeafHash, now.Sub(time.Unix(0, leaf.MergeDeadlineNanos)))
+		}
+		status, ok := t.leaves[leafKey{logID, string(leaf.MerkleLeafHash)}]
+		if !ok {
+			if len(leaf.CorrelationId) > 0 {
+				glog.V(1).Infof("%s: leaf %x [%s] integrated at index %d", util.LogIDPrefix(ctx), leaf.MerkleLeafHash, leaf.CorrelationId, leaf.LeafIndex)
+			}
+			continue
+		}
+		status.State = LeafIntegrated
+		status.LeafIndex = leaf.LeafIndex
+		status.IntegratedAt = now
+		delay := now.Sub(status.QueuedAt)
+		t.exp.integrationMillis.Add(int64(delay / time.Millisecond))
+		glog.V(1).Infof("%s: leaf %x [%s] integrated at index %d, %v after queueing", util.LogIDPrefix(ctx), leaf.MerkleLeafHash, status.CorrelationID, leaf.LeafIndex, delay)
+	}
+}
+
+// SequencingFailed implements log.LeafObserver.
+func (t *LeafTracker) SequencingFailed(ctx context.Context, leaves []trillian.LogLeaf) {
+	logID, _ := util.LogIDFromContext(ctx)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, leaf := range leaves {
+		t.exp.failedBatches.Add(1)
+		if status, ok := t.leaves[leafKey{logID, string(leaf.MerkleLeafHash)}]; ok {
+			status.FailedBatches++
+		}
+	}
+}
+
+// add starts tracking a leaf, forgetting the oldest leaf if there are too many. t.mu must
+// be held.
+func (t *LeafTracker) add(status *LeafStatus) {
+	key := leafKey{status.LogID, string(status.MerkleLeafHash)}
+	if old, ok := t.leaves[key]; ok {
+		// A duplicate submission; keep the original, which is what will be integrated.
+		if old.State != LeafFailed || status.State == LeafFailed {
+			return
+		}
+		t.removeID(old.CorrelationID, key)
+	} else {
+		t.order = append(t.order, key)
+	}
+	t.leaves[key] = status
+	if len(status.CorrelationID) > 0 {
+		t.byID[status.CorrelationID] = append(t.byID[status.CorrelationID], key)
+	}
+
+	for len(t.order) > t.maxTracked {
+		oldest := t.order[0]
+		t.order = t.order[1:]
+		if old, ok := t.leaves[oldest]; ok {
+			t.removeID(old.CorrelationID, oldest)
+			delete(t.leaves, oldest)
+		}
+	}
+}
+
+// removeID removes key from the leaves tracked under a correlation ID. t.mu must be held.
+func (t *LeafTracker) removeID(id string, key leafKey) {
+	keys := t.byID[id]
+	for i, k := range keys {
+		if k == key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(t.byID, id)
+	} else {
+		t.byID[id] = keys
+	}
+}
+
+// Lookup returns the status of the leaf with the given Merkle leaf hash in a log. A leaf
+// that isn't tracked is looked for in the log's queue, if a registry is set.
+func (t *LeafTracker) Lookup(logID int64, merkleLeafHash []byte) (LeafStatus, bool, error) {
+	t.mu.Lock()
+	var status LeafStatus
+	tracked, ok := t.leaves[leafKey{logID, string(merkleLeafHash)}]
+	if ok {
+		status = *tracked
+	}
+	t.mu.Unlock()
+
+	if ok || t.registry == nil {
+		return status, ok, nil
+	}
+	stored, err := t.lookupQueued(logID, func(tx storage.ReadOnlyLogTX) ([]storage.QueuedLeaf, error) {
+		return tx.GetQueuedLeavesByHash([][]byte{merkleLeafHash})
+	})
+	if err != nil || len(stored) == 0 {
+		return LeafStatus{}, false, err
+	}
+	return stored[0], true, nil
+}
+
+// LookupByCorrelationID returns the status of the leaves queued under a correlation ID.
+// If none are tracked the queues of the active logs are searched, if a registry is set.
+func (t *LeafTracker) LookupByCorrelationID(ctx context.Context, id string) ([]LeafStatus, error) {
+	t.mu.Lock()
+	var result []LeafStatus
+	for _, key := range t.byID[id] {
+		result = append(result, *t.leaves[key])
+	}
+	t.mu.Unlock()
+
+	if len(result) > 0 || t.registry == nil {
+		return result, nil
+	}
+	logIDs, err := t.activeLogIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, logID := range logIDs {
+		stored, err := t.lookupQueued(logID, func(tx storage.ReadOnlyLogTX) ([]storage.QueuedLeaf, error) {
+			return tx.GetQueuedLeavesByCorrelationID(id)
+		})
+		if err != nil {
+			glog.Warningf("%s: failed to look for queued leaves: %v", util.LogIDPrefix(util.NewLogContext(ctx, logID)), err)
+			continue
+		}
+		result = append(result, stored...)
+	}
+	return result, nil
+}
+
+// activeLogIDs returns the IDs of the logs in the registry's storage.
+func (t *LeafTracker) activeLogIDs() ([]int64, error) {
+	// TODO(Martin2112): Have to pass a tree ID when we just want metadata. API mismatch
+	logStorage, err := t.registry.GetLogStorage(0)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := logStorage.Begin()
+	if err != nil {
+		return nil, err
+	}
+	logIDs, err := tx.GetActiveLogIDs()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return logIDs, nil
+}
+
+// lookupQueued returns the status of the leaves queued in a log that find returns.
+func (t *LeafTracker) lookupQueued(logID int64, find func(storage.ReadOnlyLogTX) ([]storage.QueuedLeaf, error)) ([]LeafStatus, error) {
+	logStorage, err := t.registry.GetLogStorage(logID)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := logStorage.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	queued, err := find(tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	var result []LeafStatus
+	for _, leaf := range queued {
+		result = append(result, LeafStatus{
+			LogID:          logID,
+			MerkleLeafHash: leaf.MerkleLeafHash,
+			CorrelationID:  leaf.CorrelationId,
+			State:          LeafQueued,
+			QueuedAt:       leaf.QueueTimestamp,
+		})
+	}
+	return result, nil
+}
+
+// ServeHTTP answers "where is leaf X" queries, for either ?id=<correlation ID> or
+// ?log_id=<log ID>&hash=<base64 Merkle leaf hash>. The response is a JSON list of the
+// matching LeafStatus.
+func (t *LeafTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	var result []LeafStatus
+	if id := r.FormValue("id"); len(id) > 0 {
+		var err error
+		if result, err = t.LookupByCorrelationID(ctx, id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		logID, err := strconv.ParseInt(r.FormValue("log_id"), 10, 64)
+		if err != nil {
+			http.Error(w, "need id, or log_id and hash", http.StatusBadRequest)
+			return
+		}
+		hash, err := base64.StdEncoding.DecodeString(r.FormValue("hash"))
+		if err != nil || len(hash) == 0 {
+			http.Error(w, "invalid hash", http.StatusBadRequest)
+			return
+		}
+		status, ok, err := t.Lookup(logID, hash)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if ok {
+			result = append(result, status)
+		}
+	}
+
+	if len(result) == 0 {
+		http.Error(w, "leaf not tracked", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		glog.Warningf("Failed to write leaf status: %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage/memory"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+func TestLeafTrackerLifecycle(t *testing.T) {
+	queueTime := time.Date(2016, 7, 22, 11, 1, 13, 0, time.UTC)
+	timeSource := &util.FakeTimeSource{FakeTime: queueTime}
+	tracker := NewLeafTracker(timeSource, 10)
+
+	ctx := util.NewRequestIDContext(util.NewLogContext(context.Background(), 6), "req1")
+	leaves := []trillian.LogLeaf{{MerkleLeafHash: []byte("hash1")}, {MerkleLeafHash: []byte("hash2")}}
+	tracker.LeavesQueued(ctx, leaves, nil)
+	failedCtx := util.NewRequestIDContext(util.NewLogContext(context.Background(), 6), "req2")
+	tracker.LeavesQueued(failedCtx, []trillian.LogLeaf{{MerkleLeafHash: []byte("hash3")}}, errors.New("storage failed"))
+
+	seqCtx := util.NewLogContext(context.Background(), 6)
+	tracker.SequencingFailed(seqCtx, leaves[:1])
+	timeSource.FakeTime = queueTime.Add(time.Minute)
+	tracker.LeavesIntegrated(seqCtx, []trillian.LogLeaf{{MerkleLeafHash: []byte("hash1"), LeafIndex: 42, MergeDeadlineNanos: queueTime.Add(time.Hour).UnixNano()}})
+
+	var tests = []struct {
+		logID       int64
+		hash        string
+		want        LeafStatus
+		wantTracked bool
+	}{
+		{logID: 6, hash: "hash1", wantTracked: true, want: LeafStatus{CorrelationID: "req1", State: LeafIntegrated, LeafIndex: 42, IntegratedAt: queueTime.Add(time.Minute), FailedBatches: 1}},
+		{logID: 6, hash: "hash2", wantTracked: true, want: LeafStatus{CorrelationID: "req1", State: LeafQueued}},
+		{logID: 6, hash: "hash3", wantTracked: true, want: LeafStatus{CorrelationID: "req2", State: LeafFailed, Error: "storage failed"}},
+		{logID: 7, hash: "hash1"},
+		{logID: 6, hash: "hash4"},
+	}
+	for _, test := range tests {
+		got, ok, err := tracker.Lookup(test.logID, []byte(test.hash))
+		if err != nil {
+			t.Errorf("Lookup(%d, %s)=_,_,%v, want no error", test.logID, test.hash, err)
+			continue
+		}
+		if ok != test.wantTracked {
+			t.Errorf("Lookup(%d, %s)=_,%v, want %v", test.logID, test.hash, ok, test.wantTracked)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		test.want.LogID = test.logID
+		test.want.MerkleLeafHash = []byte(test.hash)
+		test.want.QueuedAt = queueTime
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Lookup(%d, %s)=%+v, want %+v", test.logID, test.hash, got, test.want)
+		}
+	}
+
+	if got, err := tracker.LookupByCorrelationID(ctx, "req1"); err != nil || len(got) != 2 {
+		t.Errorf("LookupByCorrelationID(req1)=%d leaves,%v, want 2 leaves,nil", len(got), err)
+	}
+	if got, want := tracker.exp.integrationMillis.String(), "60000"; got != want {
+		t.Errorf("queue-to-integration-total-ms=%s, want %s", got, want)
+	}
+}
+
+func TestLeafTrackerMissedDeadline(t *testing.T) {
+	now := time.Date(2016, 7, 22, 11, 1, 13, 0, time.UTC)
+	tracker := NewLeafTracker(&util.FakeTimeSource{FakeTime: now}, 10)
+	ctx := util.NewLogContext(context.Background(), 6)
+	tracker.LeavesIntegrated(ctx, []trillian.LogLeaf{
+		{MerkleLeafHash: []byte("early"), MergeDeadlineNanos: now.Add(time.Minute).UnixNano()},
+		{MerkleLeafHash: []byte("late"), MergeDeadlineNanos: now.Add(-time.Minute).UnixNano()},
+		{MerkleLeafHash: []byte("no-deadline")},
+	})
+	if got, want := tracker.exp.missedDeadline.String(), "1"; got != want {
+		t.Errorf("missed-merge-deadline=%s, want %s", got, want)
+	}
+}
+
+func TestLeafTrackerEviction(t *testing.T) {
+	tracker := NewLeafTracker(util.SystemTimeSource{}, 2)
+	for _, id := range []string{"req1", "req2", "req3"} {
+		ctx := util.NewRequestIDContext(util.NewLogContext(context.Background(), 1), id)
+		tracker.LeavesQueued(ctx, []trillian.LogLeaf{{MerkleLeafHash: []byte(id)}}, nil)
+	}
+
+	for _, test := range []struct {
+		id   string
+		want bool
+	}{{"req1", false}, {"req2", true}, {"req3", true}} {
+		if _, got, _ := tracker.Lookup(1, []byte(test.id)); got != test.want {
+			t.Errorf("Lookup(%s)=_,%v, want %v", test.id, got, test.want)
+		}
+		found, _ := tracker.LookupByCorrelationID(context.Background(), test.id)
+		if got := len(found) > 0; got != test.want {
+			t.Errorf("LookupByCorrelationID(%s) found leaves: %v, want %v", test.id, got, test.want)
+		}
+	}
+}
+
+func TestLeafTrackerFallsBackToStorage(t *testing.T) {
+	registry := memory.NewStorage()
+	logStorage, err := registry.GetLogStorage(5)
+	if err != nil {
+		t.Fatalf("GetLogStorage()=_,%v, want no error", err)
+	}
+	tx, err := logStorage.Begin()
+	if err != nil {
+		t.Fatalf("Begin()=_,%v, want no error", err)
+	}
+	queueTime := time.Date(2016, 7, 22, 11, 1, 13, 0, time.UTC)
+	leaf := trillian.LogLeaf{
+		LeafValueHash:  make([]byte, 32),
+		MerkleLeafHash: []byte("hash1"),
+		LeafValue:      []byte("value1"),
+		CorrelationId:  "req1",
+	}
+	if err := tx.QueueLeaves([]trillian.LogLeaf{leaf}, queueTime); err != nil {
+		t.Fatalf("QueueLeaves()=%v, want no error", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit()=%v, want no error", err)
+	}
+
+	// A new tracker, as after a restart, only finds the leaf if it can look in storage.
+	tracker := NewLeafTracker(util.SystemTimeSource{}, 10)
+	if _, ok, err := tracker.Lookup(5, []byte("hash1")); ok || err != nil {
+		t.Errorf("Lookup() without registry=_,%v,%v, want false,nil", ok, err)
+	}
+	tracker.SetRegistry(registry)
+
+	want := LeafStatus{LogID: 5, MerkleLeafHash: []byte("hash1"), CorrelationID: "req1", State: LeafQueued, QueuedAt: queueTime}
+	got, ok, err := tracker.Lookup(5, []byte("hash1"))
+	if err != nil || !ok {
+		t.Fatalf("Lookup()=_,%v,%v, want true,nil", ok, err)
+	}
+	if !got.QueuedAt.Equal(want.QueuedAt) {
+		t.Errorf("Lookup().QueuedAt=%v, want %v", got.QueuedAt, want.QueuedAt)
+	}
+	got.QueuedAt = want.QueuedAt
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lookup()=%+v, want %+v", got, want)
+	}
+	if _, ok, err := tracker.Lookup(5, []byte("hash2")); ok || err != nil {
+		t.Errorf("Lookup(hash2)=_,%v,%v, want false,nil", ok, err)
+	}
+
+	byID, err := tracker.LookupByCorrelationID(context.Background(), "req1")
+	if err != nil || len(byID) != 1 || byID[0].LogID != 5 || string(byID[0].MerkleLeafHash) != "hash1" {
+		t.Errorf("LookupByCorrelationID(req1)=%+v,%v, want the leaf queued in log 5", byID, err)
+	}
+	if byID, err := tracker.LookupByCorrelationID(context.Background(), "req2"); err != nil || len(byID) != 0 {
+		t.Errorf("LookupByCorrelationID(req2)=%+v,%v, want no leaves", byID, err)
+	}
+}
+
+func TestLeafTrackerServeHTTP(t *testing.T) {
+	tracker := NewLeafTracker(util.SystemTimeSource{}, 10)
+	ctx := util.NewRequestIDContext(util.NewLogContext(context.Background(), 5), "req1")
+	tracker.LeavesQueued(ctx, []trillian.LogLeaf{{MerkleLeafHash: []byte("hash1")}}, nil)
+	hash := base64.StdEncoding.EncodeToString([]byte("hash1"))
+
+	var tests = []struct {
+		params url.Values
+		want   int
+	}{
+		{params: url.Values{"id": {"req1"}}, want: http.StatusOK},
+		{params: url.Values{"log_id": {"5"}, "hash": {hash}}, want: http.StatusOK},
+		{params: url.Values{"id": {"req2"}}, want: http.StatusNotFound},
+		{params: url.Values{"log_id": {"4"}, "hash": {hash}}, want: http.StatusNotFound},
+		{params: url.Values{"log_id": {"five"}, "hash": {hash}}, want: http.StatusBadRequest},
+		{params: url.Values{"log_id": {"5"}, "hash": {"!!"}}, want: http.StatusBadRequest},
+		{params: url.Values{}, want: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/debug/leaf?"+test.params.Encode(), nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		tracker.ServeHTTP(w, req)
+		if got := w.Code; got != test.want {
+			t.Errorf("ServeHTTP(%v)=%d, want %d", test.params, got, test.want)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var statuses []map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &statuses); err != nil {
+			t.Errorf("ServeHTTP(%v) returned invalid JSON: %v", test.params, err)
+			continue
+		}
+		if len(statuses) != 1 || statuses[0]["state"] != "queued" || statuses[0]["correlation_id"] != "req1" {
+			t.Errorf("ServeHTTP(%v)=%v, want one queued leaf for req1", test.params, statuses)
+		}
+	}
+}
@@ -120,7 +120,18 @@ func (l LogOperationManager) getLogsAndExecutePass() bool {
 	return quit
 }
 
-// OperationLoop starts the manager working. It continues until told to exit.
+// RunOnce performs a single pass of the operation over the active logs straight away,
+// without the sleep OperationLoop has before each pass. It lets a test driving the
+// manager from a simulated clock decide when passes happen. It returns true if the
+// operation asked to terminate.
+func (l LogOperationManager) RunOnce() bool {
+	return l.getLogsAndExecutePass()
+}
+
+// OperationLoop starts the manager working. It continues until told to exit, or its context
+// is cancelled. A pass in progress when the context is cancelled finishes whatever it must
+// to leave the logs consistent before OperationLoop returns, so callers shutting down should
+// wait for it to return.
 // TODO(Martin2112): No mechanism for error reporting etc., this is OK for v1 but needs work
 func (l LogOperationManager) OperationLoop() {
 	glog.Infof("Log operation manager starting")
@@ -128,7 +139,12 @@ func (l LogOperationManager) OperationLoop() {
 	// Outer loop, runs until terminated
 	for {
 		// Wait for the configured time before going for another pass
-		time.Sleep(l.context.sleepBetweenRuns)
+		select {
+		case <-l.context.ctx.Done():
+			glog.Infof("Log operation manager shutting down")
+			return
+		case <-time.After(l.context.sleepBetweenRuns):
+		}
 
 		quit := l.getLogsAndExecutePass()
 
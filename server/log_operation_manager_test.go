@@ -101,3 +101,49 @@ func TestLogOperationManagerPassesIDs(t *testing.T) {
 
 	lom.OperationLoop()
 }
+
+func TestLogOperationManagerCancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Nothing is run once the context is cancelled, however long the manager would sleep.
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockLogOp := NewMockLogOperation(ctrl)
+
+	ctx, cancel := context.WithCancel(util.NewLogContext(context.Background(), -1))
+	cancel()
+	lom := NewLogOperationManager(ctx, registryForSequencer(mockStorage), 50, time.Hour, time.Second, fakeTimeSource, mockLogOp)
+
+	done := make(chan struct{})
+	go func() {
+		lom.OperationLoop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("OperationLoop() didn't return after its context was cancelled")
+	}
+}
+
+func TestLogOperationManagerRunOnce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTx := storage.NewMockLogTX(ctrl)
+	mockTx.EXPECT().GetActiveLogIDs().Return([]int64{451}, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+
+	mockLogOp := NewMockLogOperation(ctrl)
+	mockLogOp.EXPECT().ExecutePass([]int64{451}, logOpMgrContextMatcher{50}).Return(true)
+
+	// The pass is run straight away, however long the manager would sleep before it.
+	ctx := util.NewLogContext(context.Background(), -1)
+	lom := NewLogOperationManager(ctx, registryForSequencer(mockStorage), 50, time.Hour, time.Second, fakeTimeSource, mockLogOp)
+
+	if got, want := lom.RunOnce(), true; got != want {
+		t.Errorf("RunOnce()=%v, want %v", got, want)
+	}
+}
@@ -11,19 +11,20 @@ import (
 	"github.com/google/trillian/merkle"
 	"github.com/google/trillian/storage"
 	"github.com/google/trillian/util"
+	"github.com/google/trillian/verifier"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-// TODO: There is no access control in the server yet and clients could easily modify
-// any tree.
-
 // Pass this as a fixed value to proof calculations. It's used as the max depth of the tree
 const proofMaxBitLen = 64
 
 // TrillianLogRPCServer implements the RPC API defined in the proto
 type TrillianLogRPCServer struct {
-	registry   extension.Registry
-	timeSource util.TimeSource
+	registry    extension.Registry
+	timeSource  util.TimeSource
+	leafTracker *LeafTracker
 }
 
 // NewTrillianLogRPCServer creates a new RPC server backed by a LogStorageProvider.
@@ -34,6 +35,18 @@ func NewTrillianLogRPCServer(registry extension.Registry, timeSource util.TimeSo
 	}
 }
 
+// SetLeafTracker sets the LeafTracker that records the leaves queued through this server.
+func (t *TrillianLogRPCServer) SetLeafTracker(tracker *LeafTracker) {
+	t.leafTracker = tracker
+}
+
+// leavesQueued tells the LeafTracker, if there is one, about leaves we tried to queue.
+func (t *TrillianLogRPCServer) leavesQueued(ctx context.Context, leaves []trillian.LogLeaf, err error) {
+	if t.leafTracker != nil {
+		t.leafTracker.LeavesQueued(ctx, leaves, err)
+	}
+}
+
 // QueueLeaves submits a batch of leaves to the log for later integration into the underlying tree.
 func (t *TrillianLogRPCServer) QueueLeaves(ctx context.Context, req *trillian.QueueLeavesRequest) (*trillian.QueueLeavesResponse, error) {
 	ctx = util.NewLogContext(ctx, req.LogId)
@@ -43,28 +56,115 @@ func (t *TrillianLogRPCServer) QueueLeaves(ctx context.Context, req *trillian.Qu
 		return &trillian.QueueLeavesResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, "Must queue at least one leaf")}, nil
 	}
 
+	// Every tracked leaf needs a correlation ID, so make one up if the client didn't send one.
+	if _, ok := util.RequestIDFromContext(ctx); !ok && t.leafTracker != nil {
+		ctx = util.NewRequestIDContext(ctx, util.NewRequestID())
+	}
+
 	// TODO(al): TreeHasher must be selected based on log config.
 	th := merkle.NewRFC6962TreeHasher(crypto.NewSHA256())
+	requestID, _ := util.RequestIDFromContext(ctx)
 	for i := range leaves {
 		leaves[i].MerkleLeafHash = th.HashLeaf(leaves[i].LeafValue)
+		// The ID is stored with the queued leaf so it can still be found after a restart.
+		leaves[i].CorrelationId = requestID
+	}
+
+	queued, err := t.queueLeaves(ctx, req.LogId, leaves, th)
+	if err == storage.ErrDuplicateLeafIdentity {
+		// A leaf with the same identity hash was queued since we looked, so look again
+		// now that it's committed and report it as a duplicate.
+		queued, err = t.queueLeaves(ctx, req.LogId, leaves, th)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	tx, err := t.prepareStorageTx(req.LogId)
+	return &trillian.QueueLeavesResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), QueuedLeaves: queued}, nil
+}
+
+// queueLeaves queues the leaves that aren't duplicates in a single transaction and returns
+// the result for each leaf.
+func (t *TrillianLogRPCServer) queueLeaves(ctx context.Context, logID int64, leaves []trillian.LogLeaf, th merkle.TreeHasher) ([]*trillian.QueuedLogLeaf, error) {
+	tx, err := t.prepareStorageTx(ctx, logID)
 	if err != nil {
 		return nil, err
 	}
 
-	err = tx.QueueLeaves(leaves, t.timeSource.Now())
+	queued, leaves, err := dedupLeaves(tx, leaves, th)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
+	if len(leaves) > 0 {
+		err = tx.QueueLeaves(leaves, t.timeSource.Now())
+		if err == storage.ErrDuplicateLeafIdentity {
+			// Not a failure to queue the leaves, the caller tries them again.
+			tx.Rollback()
+			return nil, err
+		}
+		if err != nil {
+			tx.Rollback()
+			t.leavesQueued(ctx, leaves, err)
+			return nil, err
+		}
+	}
+
+	// If the client has gone away it won't have been told the leaves were accepted (e.g.
+	// CT won't have returned an SCT for them) so don't commit them.
+	if err := ctx.Err(); err != nil {
+		tx.Rollback()
+		t.leavesQueued(ctx, leaves, err)
+		return nil, err
+	}
+
 	if err := t.commitAndLog(ctx, tx, "QueueLeaves"); err != nil {
+		t.leavesQueued(ctx, leaves, err)
 		return nil, err
 	}
+	t.leavesQueued(ctx, leaves, nil)
+
+	return queued, nil
+}
+
+// dedupLeaves finds the leaves with an identity hash that duplicate a leaf already in the
+// log, or an earlier one in the batch. It returns the result for each leaf, and the leaves
+// that still need to be queued.
+func dedupLeaves(tx storage.LogTX, leaves []trillian.LogLeaf, th merkle.TreeHasher) ([]*trillian.QueuedLogLeaf, []trillian.LogLeaf, error) {
+	var identityHashes [][]byte
+	for _, leaf := range leaves {
+		if len(leaf.LeafIdentityHash) > 0 {
+			identityHashes = append(identityHashes, leaf.LeafIdentityHash)
+		}
+	}
+	existing := make(map[string]*trillian.LogLeaf)
+	if len(identityHashes) > 0 {
+		found, err := tx.GetLeavesByIdentityHash(identityHashes)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := range found {
+			found[i].MerkleLeafHash = th.HashLeaf(found[i].LeafValue)
+			existing[string(found[i].LeafIdentityHash)] = &found[i]
+		}
+	}
 
-	return &trillian.QueueLeavesResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK)}, nil
+	queued := make([]*trillian.QueuedLogLeaf, 0, len(leaves))
+	toQueue := make([]trillian.LogLeaf, 0, len(leaves))
+	for i := range leaves {
+		leaf := &leaves[i]
+		if len(leaf.LeafIdentityHash) > 0 {
+			if e, ok := existing[string(leaf.LeafIdentityHash)]; ok {
+				queued = append(queued, &trillian.QueuedLogLeaf{Leaf: e, Duplicate: true})
+				continue
+			}
+			existing[string(leaf.LeafIdentityHash)] = leaf
+		}
+		queued = append(queued, &trillian.QueuedLogLeaf{Leaf: leaf})
+		toQueue = append(toQueue, *leaf)
+	}
+	return queued, toQueue, nil
 }
 
 // GetInclusionProof obtains the proof of inclusion in the tree for a leaf that has been sequenced.
@@ -84,9 +184,13 @@ func (t *TrillianLogRPCServer) GetInclusionProof(ctx context.Context, req *trill
 		return nil, fmt.Errorf("%s: leaf index %d does not exist in tree of size %d", util.LogIDPrefix(ctx), req.LeafIndex, req.TreeSize)
 	}
 
+	if err := checkProofFormat(ctx, req.ProofFormat); err != nil {
+		return nil, err
+	}
+
 	// Next we need to make sure the requested tree size corresponds to an STH, so that we
 	// have a usable tree revision
-	tx, err := t.prepareReadOnlyStorageTx(req.LogId)
+	tx, err := t.prepareReadOnlyStorageTx(ctx, req.LogId)
 	if err != nil {
 		return nil, err
 	}
@@ -109,6 +213,10 @@ func (t *TrillianLogRPCServer) GetInclusionProof(ctx context.Context, req *trill
 		return nil, err
 	}
 
+	if err := encodeProof(&proof, req.ProofFormat); err != nil {
+		return nil, err
+	}
+
 	response := trillian.GetInclusionProofResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), Proof: &proof}
 	return &response, nil
 }
@@ -126,9 +234,13 @@ func (t *TrillianLogRPCServer) GetInclusionProofByHash(ctx context.Context, req
 		return nil, fmt.Errorf("%s: invalid leaf hash: %v", util.LogIDPrefix(ctx), req.LeafHash)
 	}
 
+	if err := checkProofFormat(ctx, req.ProofFormat); err != nil {
+		return nil, err
+	}
+
 	// Next we need to make sure the requested tree size corresponds to an STH, so that we
 	// have a usable tree revision
-	tx, err := t.prepareReadOnlyStorageTx(req.LogId)
+	tx, err := t.prepareReadOnlyStorageTx(ctx, req.LogId)
 	if err != nil {
 		return nil, err
 	}
@@ -155,6 +267,10 @@ func (t *TrillianLogRPCServer) GetInclusionProofByHash(ctx context.Context, req
 			tx.Rollback()
 			return nil, err
 		}
+		if err := encodeProof(&proof, req.ProofFormat); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
 		proofs = append(proofs, &proof)
 	}
 
@@ -186,19 +302,22 @@ func (t *TrillianLogRPCServer) GetConsistencyProof(ctx context.Context, req *tri
 		return nil, fmt.Errorf("%s: second tree size (%d) must be > first tree size (%d)", util.LogIDPrefix(ctx), req.SecondTreeSize, req.FirstTreeSize)
 	}
 
+	if err := checkProofFormat(ctx, req.ProofFormat); err != nil {
+		return nil, err
+	}
+
 	nodeIDs, err := merkle.CalcConsistencyProofNodeAddresses(req.FirstTreeSize, req.SecondTreeSize, proofMaxBitLen)
 	if err != nil {
 		return nil, err
 	}
 
-	tx, err := t.prepareReadOnlyStorageTx(req.LogId)
+	tx, err := t.prepareReadOnlyStorageTx(ctx, req.LogId)
 	if err != nil {
 		return nil, err
 	}
 
-	// We need to make sure that both the given sizes are actually STHs, though we don't use the
-	// first tree revision in fetches
-	_, err = tx.GetTreeRevisionAtSize(req.FirstTreeSize)
+	// We need to make sure that both the given sizes are actually STHs
+	firstTreeRevision, err := tx.GetTreeRevisionAtSize(req.FirstTreeSize)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
@@ -210,9 +329,7 @@ func (t *TrillianLogRPCServer) GetConsistencyProof(ctx context.Context, req *tri
 		return nil, err
 	}
 
-	// Do all the node fetches at the second tree revision, which is what the node ids were calculated
-	// against.
-	proof, err := fetchNodesAndBuildProof(tx, secondTreeRevision, 0, nodeIDs)
+	proof, err := buildConsistencyProof(tx, req.FirstTreeSize, req.SecondTreeSize, firstTreeRevision, secondTreeRevision, nodeIDs)
 	if err != nil {
 		tx.Rollback()
 		return nil, err
@@ -223,6 +340,10 @@ func (t *TrillianLogRPCServer) GetConsistencyProof(ctx context.Context, req *tri
 		return nil, err
 	}
 
+	if err := encodeProof(&proof, req.ProofFormat); err != nil {
+		return nil, err
+	}
+
 	// We have everything we need. Return the proof
 	return &trillian.GetConsistencyProofResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), Proof: &proof}, nil
 }
@@ -231,7 +352,7 @@ func (t *TrillianLogRPCServer) GetConsistencyProof(ctx context.Context, req *tri
 // underlies the log.
 func (t *TrillianLogRPCServer) GetLatestSignedLogRoot(ctx context.Context, req *trillian.GetLatestSignedLogRootRequest) (*trillian.GetLatestSignedLogRootResponse, error) {
 	ctx = util.NewLogContext(ctx, req.LogId)
-	tx, err := t.prepareReadOnlyStorageTx(req.LogId)
+	tx, err := t.prepareReadOnlyStorageTx(ctx, req.LogId)
 	if err != nil {
 		return nil, err
 	}
@@ -249,11 +370,69 @@ func (t *TrillianLogRPCServer) GetLatestSignedLogRoot(ctx context.Context, req *
 	return &trillian.GetLatestSignedLogRootResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), SignedLogRoot: &signedRoot}, nil
 }
 
+// GetTreeHeadByTimestamp obtains the earliest tree root published at or after a given time,
+// so auditors can check what the log claimed at that moment. It fails with a NotFound status
+// if the log hasn't published a root since then.
+func (t *TrillianLogRPCServer) GetTreeHeadByTimestamp(ctx context.Context, req *trillian.GetTreeHeadByTimestampRequest) (*trillian.GetTreeHeadByTimestampResponse, error) {
+	ctx = util.NewLogContext(ctx, req.LogId)
+	if req.TimestampNanos < 0 {
+		return nil, fmt.Errorf("%s: invalid timestamp: %d", util.LogIDPrefix(ctx), req.TimestampNanos)
+	}
+	tx, err := t.prepareReadOnlyStorageTx(ctx, req.LogId)
+	if err != nil {
+		return nil, err
+	}
+
+	signedRoot, err := tx.SignedLogRootByTimestamp(req.TimestampNanos)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := t.commitAndLog(ctx, tx, "GetTreeHeadByTimestamp"); err != nil {
+		return nil, err
+	}
+	if signedRoot.TimestampNanos == 0 {
+		return nil, status.Errorf(codes.NotFound, "%s: no tree head at or after timestamp %d", util.LogIDPrefix(ctx), req.TimestampNanos)
+	}
+
+	return &trillian.GetTreeHeadByTimestampResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), SignedLogRoot: &signedRoot}, nil
+}
+
+// GetTreeHeadBySize obtains the earliest tree root published for a given tree size, so
+// auditors can get the exact root a proof for that size was built against. It fails with a
+// NotFound status if the log hasn't published a root for that size.
+func (t *TrillianLogRPCServer) GetTreeHeadBySize(ctx context.Context, req *trillian.GetTreeHeadBySizeRequest) (*trillian.GetTreeHeadBySizeResponse, error) {
+	ctx = util.NewLogContext(ctx, req.LogId)
+	if req.TreeSize < 0 {
+		return nil, fmt.Errorf("%s: invalid tree size: %d", util.LogIDPrefix(ctx), req.TreeSize)
+	}
+	tx, err := t.prepareReadOnlyStorageTx(ctx, req.LogId)
+	if err != nil {
+		return nil, err
+	}
+
+	signedRoot, err := tx.SignedLogRootBySize(req.TreeSize)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := t.commitAndLog(ctx, tx, "GetTreeHeadBySize"); err != nil {
+		return nil, err
+	}
+	if signedRoot.TimestampNanos == 0 {
+		return nil, status.Errorf(codes.NotFound, "%s: no tree head for tree size %d", util.LogIDPrefix(ctx), req.TreeSize)
+	}
+
+	return &trillian.GetTreeHeadBySizeResponse{Status: buildStatus(trillian.TrillianApiStatusCode_OK), SignedLogRoot: &signedRoot}, nil
+}
+
 // GetSequencedLeafCount returns the number of leaves that have been integrated into the Merkle
 // Tree. This can be zero for a log containing no entries.
 func (t *TrillianLogRPCServer) GetSequencedLeafCount(ctx context.Context, req *trillian.GetSequencedLeafCountRequest) (*trillian.GetSequencedLeafCountResponse, error) {
 	ctx = util.NewLogContext(ctx, req.LogId)
-	tx, err := t.prepareReadOnlyStorageTx(req.LogId)
+	tx, err := t.prepareReadOnlyStorageTx(ctx, req.LogId)
 	if err != nil {
 		return nil, err
 	}
@@ -281,7 +460,7 @@ func (t *TrillianLogRPCServer) GetLeavesByIndex(ctx context.Context, req *trilli
 		return &trillian.GetLeavesByIndexResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, "Invalid -ve leaf index in request")}, nil
 	}
 
-	tx, err := t.prepareReadOnlyStorageTx(req.LogId)
+	tx, err := t.prepareReadOnlyStorageTx(ctx, req.LogId)
 	if err != nil {
 		return nil, err
 	}
@@ -334,9 +513,13 @@ func (t *TrillianLogRPCServer) GetEntryAndProof(ctx context.Context, req *trilli
 		return nil, fmt.Errorf("%s: invalid params for GetEntryAndProof index: %d exceeds tree size: %d", util.LogIDPrefix(ctx), req.LeafIndex, req.TreeSize)
 	}
 
+	if err := checkProofFormat(ctx, req.ProofFormat); err != nil {
+		return nil, err
+	}
+
 	// Next we need to make sure the requested tree size corresponds to an STH, so that we
 	// have a usable tree revision
-	tx, err := t.prepareReadOnlyStorageTx(req.LogId)
+	tx, err := t.prepareReadOnlyStorageTx(ctx, req.LogId)
 	if err != nil {
 		return nil, err
 	}
@@ -371,6 +554,10 @@ func (t *TrillianLogRPCServer) GetEntryAndProof(ctx context.Context, req *trilli
 		return nil, err
 	}
 
+	if err := encodeProof(&proof, req.ProofFormat); err != nil {
+		return nil, err
+	}
+
 	// Work is complete, we have everything we need for the response
 	return &trillian.GetEntryAndProofResponse{
 		Status: buildStatus(trillian.TrillianApiStatusCode_OK),
@@ -378,7 +565,13 @@ func (t *TrillianLogRPCServer) GetEntryAndProof(ctx context.Context, req *trilli
 		Leaf:   &leaves[0]}, nil
 }
 
-func (t *TrillianLogRPCServer) prepareStorageTx(treeID int64) (storage.LogTX, error) {
+// prepareStorageTx starts a transaction for treeID, unless the request has already been
+// cancelled or run out of time, in which case there's no point doing the work.
+func (t *TrillianLogRPCServer) prepareStorageTx(ctx context.Context, treeID int64) (storage.LogTX, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	s, err := t.registry.GetLogStorage(treeID)
 	if err != nil {
 		return nil, err
@@ -392,7 +585,13 @@ func (t *TrillianLogRPCServer) prepareStorageTx(treeID int64) (storage.LogTX, er
 	return tx, err
 }
 
-func (t *TrillianLogRPCServer) prepareReadOnlyStorageTx(treeID int64) (storage.ReadOnlyLogTX, error) {
+// prepareReadOnlyStorageTx starts a read only transaction for treeID, unless the request
+// has already been cancelled or run out of time.
+func (t *TrillianLogRPCServer) prepareReadOnlyStorageTx(ctx context.Context, treeID int64) (storage.ReadOnlyLogTX, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	s, err := t.registry.GetLogStorage(treeID)
 	if err != nil {
 		return nil, err
@@ -507,6 +706,89 @@ func fetchNodesAndBuildProof(tx storage.ReadOnlyLogTX, treeRevision, leafIndex i
 	return trillian.Proof{LeafIndex: leafIndex, ProofNode: proof}, nil
 }
 
+// checkProofFormat returns an error if format isn't one of the known proof formats.
+func checkProofFormat(ctx context.Context, format trillian.ProofFormat) error {
+	if _, ok := trillian.ProofFormat_name[int32(format)]; !ok {
+		return fmt.Errorf("%s: unknown proof format: %d", util.LogIDPrefix(ctx), format)
+	}
+	return nil
+}
+
+// encodeProof sets the encoded path of proof to its hashes in the requested format.
+func encodeProof(proof *trillian.Proof, format trillian.ProofFormat) error {
+	hashes := make([][]byte, 0, len(proof.ProofNode))
+	for _, node := range proof.ProofNode {
+		hashes = append(hashes, node.NodeHash)
+	}
+	encoded, err := verifier.EncodeProof(format, hashes)
+	if err != nil {
+		return fmt.Errorf("failed to encode proof as %v: %v", format, err)
+	}
+	proof.EncodedPath = encoded
+	return nil
+}
+
+// buildConsistencyProof fetches the nodes of a consistency proof. Nodes that are part of the
+// compact range stored with the first tree head are taken from it, which avoids reading
+// historical subtrees when the first tree is much smaller than the second. The rest, or all
+// of them if there's no compact range, are fetched at the second tree revision, which is what
+// the node ids were calculated against.
+func buildConsistencyProof(tx storage.ReadOnlyLogTX, firstTreeSize, secondTreeSize, firstTreeRevision, secondTreeRevision int64, nodeIDs []storage.NodeID) (trillian.Proof, error) {
+	levels, err := merkle.CalcConsistencyProofCompactLevels(firstTreeSize, secondTreeSize)
+	if err != nil {
+		return trillian.Proof{}, err
+	}
+	if len(levels) != len(nodeIDs) {
+		return trillian.Proof{}, fmt.Errorf("expected %d compact range levels in proof but got %d", len(nodeIDs), len(levels))
+	}
+	inCompactRange := false
+	for _, level := range levels {
+		if level >= 0 {
+			inCompactRange = true
+			break
+		}
+	}
+	if !inCompactRange {
+		return fetchNodesAndBuildProof(tx, secondTreeRevision, 0, nodeIDs)
+	}
+
+	compactRange, err := tx.GetCompactRange(firstTreeSize)
+	if err != nil {
+		return trillian.Proof{}, err
+	}
+	fromRange := func(i int) bool {
+		return levels[i] >= 0 && levels[i] < len(compactRange) && compactRange[levels[i]] != nil
+	}
+	fetchIDs := make([]storage.NodeID, 0, len(nodeIDs))
+	for i, nodeID := range nodeIDs {
+		if !fromRange(i) {
+			fetchIDs = append(fetchIDs, nodeID)
+		}
+	}
+	fetched, err := fetchNodesAndBuildProof(tx, secondTreeRevision, 0, fetchIDs)
+	if err != nil {
+		return trillian.Proof{}, err
+	}
+
+	// Nodes from the compact range are given the first tree revision, which is when
+	// they were last known to be current.
+	proof := make([]*trillian.Node, 0, len(nodeIDs))
+	for i, nodeID := range nodeIDs {
+		if !fromRange(i) {
+			proof = append(proof, fetched.ProofNode[0])
+			fetched.ProofNode = fetched.ProofNode[1:]
+			continue
+		}
+		idBytes, err := proto.Marshal(nodeID.AsProto())
+		if err != nil {
+			return trillian.Proof{}, err
+		}
+		proof = append(proof, &trillian.Node{NodeId: idBytes, NodeHash: compactRange[levels[i]], NodeRevision: firstTreeRevision})
+	}
+
+	return trillian.Proof{ProofNode: proof}, nil
+}
+
 // getLeavesByHashInternal does the work of fetching leaves by either their raw data or merkle
 // tree hash depending on the supplied fetch function
 func (t *TrillianLogRPCServer) getLeavesByHashInternal(ctx context.Context, desc string, req *trillian.GetLeavesByHashRequest, fetchFunc func(storage.ReadOnlyLogTX, [][]byte, bool) ([]trillian.LogLeaf, error)) (*trillian.GetLeavesByHashResponse, error) {
@@ -515,7 +797,7 @@ func (t *TrillianLogRPCServer) getLeavesByHashInternal(ctx context.Context, desc
 		return &trillian.GetLeavesByHashResponse{Status: buildStatusWithDesc(trillian.TrillianApiStatusCode_ERROR, fmt.Sprintf("%s: Must supply at least one hash and none must be empty", desc))}, nil
 	}
 
-	tx, err := t.prepareReadOnlyStorageTx(req.LogId)
+	tx, err := t.prepareReadOnlyStorageTx(ctx, req.LogId)
 	if err != nil {
 		return nil, err
 	}
@@ -1,19 +1,27 @@
 package server
 
 import (
+	"bytes"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/golang/protobuf/proto"
 	"github.com/google/trillian"
 	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/log"
 	"github.com/google/trillian/merkle"
 	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/memory"
 	"github.com/google/trillian/testonly"
+	"github.com/google/trillian/util"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var th = merkle.NewRFC6962TreeHasher(crypto.NewSHA256())
@@ -301,6 +309,168 @@ func TestQueueLeaves(t *testing.T) {
 	}
 }
 
+func TestQueueLeavesStoresCorrelationID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+
+	wantLeaf := leaf1
+	wantLeaf.CorrelationId = "req1"
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().QueueLeaves([]trillian.LogLeaf{wantLeaf}, fakeTime).Return(nil)
+	mockTx.EXPECT().Commit().Return(nil)
+	mockTx.EXPECT().IsOpen().AnyTimes().Return(false)
+
+	registry := testonly.NewRegistryWithLogProvider(mockStorageProviderFunc(mockStorage))
+	server := NewTrillianLogRPCServer(registry, fakeTimeSource)
+
+	ctx := util.NewRequestIDContext(context.Background(), "req1")
+	if _, err := server.QueueLeaves(ctx, &queueRequest0); err != nil {
+		t.Fatalf("QueueLeaves()=_,%v, want no error", err)
+	}
+}
+
+func TestQueueLeavesDuplicates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newLeaf := trillian.LogLeaf{LeafValue: []byte("new"), LeafIdentityHash: []byte("id1")}
+	dupLeaf := trillian.LogLeaf{LeafValue: []byte("dup"), LeafIdentityHash: []byte("id2")}
+	batchDupLeaf := trillian.LogLeaf{LeafValue: []byte("new again"), LeafIdentityHash: []byte("id1")}
+	plainLeaf := trillian.LogLeaf{LeafValue: []byte("plain")}
+	existing := trillian.LogLeaf{LeafValue: []byte("original"), LeafIdentityHash: []byte("id2")}
+
+	req := trillian.QueueLeavesRequest{LogId: logID1, Leaves: []*trillian.LogLeaf{&newLeaf, &dupLeaf, &batchDupLeaf, &plainLeaf}}
+	for _, leaf := range []*trillian.LogLeaf{&newLeaf, &dupLeaf, &batchDupLeaf, &plainLeaf, &existing} {
+		leaf.LeafValueHash = crypto.NewSHA256().Digest(leaf.LeafValue)
+	}
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().GetLeavesByIdentityHash([][]byte{[]byte("id1"), []byte("id2"), []byte("id1")}).Return([]trillian.LogLeaf{existing}, nil)
+	wantNew := newLeaf
+	wantNew.MerkleLeafHash = th.HashLeaf(newLeaf.LeafValue)
+	wantPlain := plainLeaf
+	wantPlain.MerkleLeafHash = th.HashLeaf(plainLeaf.LeafValue)
+	mockTx.EXPECT().QueueLeaves([]trillian.LogLeaf{wantNew, wantPlain}, fakeTime).Return(nil)
+	mockTx.EXPECT().Commit().Return(nil)
+	mockTx.EXPECT().IsOpen().AnyTimes().Return(false)
+
+	registry := testonly.NewRegistryWithLogProvider(mockStorageProviderFunc(mockStorage))
+	server := NewTrillianLogRPCServer(registry, fakeTimeSource)
+
+	resp, err := server.QueueLeaves(context.Background(), &req)
+	if err != nil {
+		t.Fatalf("QueueLeaves()=_,%v, want no error", err)
+	}
+
+	wantExisting := existing
+	wantExisting.MerkleLeafHash = th.HashLeaf(existing.LeafValue)
+	want := []*trillian.QueuedLogLeaf{
+		{Leaf: &wantNew},
+		{Leaf: &wantExisting, Duplicate: true},
+		{Leaf: &wantNew, Duplicate: true},
+		{Leaf: &wantPlain},
+	}
+	if got := resp.QueuedLeaves; len(got) != len(want) {
+		t.Fatalf("QueueLeaves() returned %d results, want %d", len(got), len(want))
+	}
+	for i, got := range resp.QueuedLeaves {
+		if !proto.Equal(got, want[i]) {
+			t.Errorf("QueuedLeaves[%d]=%v, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestQueueLeavesConcurrentDuplicate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	leaf := trillian.LogLeaf{LeafValue: []byte("new"), LeafIdentityHash: []byte("id1")}
+	existing := trillian.LogLeaf{LeafValue: []byte("original"), LeafIdentityHash: []byte("id1")}
+	for _, l := range []*trillian.LogLeaf{&leaf, &existing} {
+		l.LeafValueHash = crypto.NewSHA256().Digest(l.LeafValue)
+	}
+	req := trillian.QueueLeavesRequest{LogId: logID1, Leaves: []*trillian.LogLeaf{&leaf}}
+	wantLeaf := leaf
+	wantLeaf.MerkleLeafHash = th.HashLeaf(leaf.LeafValue)
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx1 := storage.NewMockLogTX(ctrl)
+	mockTx2 := storage.NewMockLogTX(ctrl)
+
+	// The existing leaf is queued by someone else between the first transaction looking for
+	// it and queueing the new one, so it's only found by the second transaction.
+	gomock.InOrder(
+		mockStorage.EXPECT().Begin().Return(mockTx1, nil),
+		mockStorage.EXPECT().Begin().Return(mockTx2, nil),
+	)
+	mockTx1.EXPECT().GetLeavesByIdentityHash([][]byte{[]byte("id1")}).Return(nil, nil)
+	mockTx1.EXPECT().QueueLeaves([]trillian.LogLeaf{wantLeaf}, fakeTime).Return(storage.ErrDuplicateLeafIdentity)
+	mockTx1.EXPECT().Rollback().Return(nil)
+	mockTx1.EXPECT().IsOpen().AnyTimes().Return(false)
+	mockTx2.EXPECT().GetLeavesByIdentityHash([][]byte{[]byte("id1")}).Return([]trillian.LogLeaf{existing}, nil)
+	mockTx2.EXPECT().Commit().Return(nil)
+	mockTx2.EXPECT().IsOpen().AnyTimes().Return(false)
+
+	registry := testonly.NewRegistryWithLogProvider(mockStorageProviderFunc(mockStorage))
+	server := NewTrillianLogRPCServer(registry, fakeTimeSource)
+
+	resp, err := server.QueueLeaves(context.Background(), &req)
+	if err != nil {
+		t.Fatalf("QueueLeaves()=_,%v, want no error", err)
+	}
+
+	wantExisting := existing
+	wantExisting.MerkleLeafHash = th.HashLeaf(existing.LeafValue)
+	want := &trillian.QueuedLogLeaf{Leaf: &wantExisting, Duplicate: true}
+	if got := resp.QueuedLeaves; len(got) != 1 || !proto.Equal(got[0], want) {
+		t.Errorf("QueueLeaves()=%v, want [%v]", got, want)
+	}
+}
+
+func TestQueueLeavesCancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	mockTx := storage.NewMockLogTX(ctrl)
+
+	// The client goes away while the leaves are being queued, so they must not be committed.
+	ctx, cancel := context.WithCancel(context.Background())
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().QueueLeaves([]trillian.LogLeaf{leaf1}, fakeTime).Do(func(leaves []trillian.LogLeaf, queueTime time.Time) { cancel() }).Return(nil)
+	mockTx.EXPECT().Rollback().Return(nil)
+	mockTx.EXPECT().IsOpen().AnyTimes().Return(false)
+
+	registry := testonly.NewRegistryWithLogProvider(mockStorageProviderFunc(mockStorage))
+	server := NewTrillianLogRPCServer(registry, fakeTimeSource)
+
+	if _, err := server.QueueLeaves(ctx, &queueRequest0); err != context.Canceled {
+		t.Fatalf("QueueLeaves()=%v, want %v", err, context.Canceled)
+	}
+}
+
+func TestGetLeavesByIndexCancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// No transaction should be started once the request has been cancelled.
+	mockStorage := storage.NewMockLogStorage(ctrl)
+	registry := testonly.NewRegistryWithLogProvider(mockStorageProviderFunc(mockStorage))
+	server := NewTrillianLogRPCServer(registry, fakeTimeSource)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := server.GetLeavesByIndex(ctx, &leaf0Request); err != context.Canceled {
+		t.Fatalf("GetLeavesByIndex()=%v, want %v", err, context.Canceled)
+	}
+}
+
 func TestQueueLeavesNoLeavesRejected(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -422,6 +592,98 @@ func TestGetLatestSignedLogRoot(t *testing.T) {
 	}
 }
 
+func TestGetTreeHeadByTimestamp(t *testing.T) {
+	var tests = []struct {
+		descr    string
+		req      trillian.GetTreeHeadByTimestampRequest
+		root     trillian.SignedLogRoot
+		err      error
+		noTX     bool
+		wantCode codes.Code
+		wantErr  bool
+	}{
+		{descr: "ok", req: trillian.GetTreeHeadByTimestampRequest{LogId: logID1, TimestampNanos: 5}, root: signedRoot1},
+		{descr: "none", req: trillian.GetTreeHeadByTimestampRequest{LogId: logID1, TimestampNanos: 5}, wantCode: codes.NotFound, wantErr: true},
+		{descr: "storage-error", req: trillian.GetTreeHeadByTimestampRequest{LogId: logID1, TimestampNanos: 5}, err: errors.New("STORAGE"), wantCode: codes.Unknown, wantErr: true},
+		{descr: "negative", req: trillian.GetTreeHeadByTimestampRequest{LogId: logID1, TimestampNanos: -1}, noTX: true, wantCode: codes.Unknown, wantErr: true},
+	}
+
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+		mockStorage := storage.NewMockLogStorage(ctrl)
+		if !test.noTX {
+			mockTx := storage.NewMockLogTX(ctrl)
+			mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+			mockTx.EXPECT().SignedLogRootByTimestamp(test.req.TimestampNanos).Return(test.root, test.err)
+			if test.err != nil {
+				mockTx.EXPECT().Rollback().Return(nil)
+			} else {
+				mockTx.EXPECT().Commit().Return(nil)
+			}
+		}
+		registry := testonly.NewRegistryWithLogProvider(mockStorageProviderFunc(mockStorage))
+		server := NewTrillianLogRPCServer(registry, fakeTimeSource)
+
+		resp, err := server.GetTreeHeadByTimestamp(context.Background(), &test.req)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: GetTreeHeadByTimestamp()=_,%v, want error: %v", test.descr, err, test.wantErr)
+		} else if err != nil {
+			if got := status.Code(err); got != test.wantCode {
+				t.Errorf("%s: GetTreeHeadByTimestamp()=_,%v, want code %v", test.descr, err, test.wantCode)
+			}
+		} else if !proto.Equal(&test.root, resp.SignedLogRoot) {
+			t.Errorf("%s: GetTreeHeadByTimestamp().SignedLogRoot=%v, want %v", test.descr, resp.SignedLogRoot, test.root)
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestGetTreeHeadBySize(t *testing.T) {
+	var tests = []struct {
+		descr    string
+		req      trillian.GetTreeHeadBySizeRequest
+		root     trillian.SignedLogRoot
+		err      error
+		noTX     bool
+		wantCode codes.Code
+		wantErr  bool
+	}{
+		{descr: "ok", req: trillian.GetTreeHeadBySizeRequest{LogId: logID1, TreeSize: 5}, root: signedRoot1},
+		{descr: "none", req: trillian.GetTreeHeadBySizeRequest{LogId: logID1, TreeSize: 5}, wantCode: codes.NotFound, wantErr: true},
+		{descr: "storage-error", req: trillian.GetTreeHeadBySizeRequest{LogId: logID1, TreeSize: 5}, err: errors.New("STORAGE"), wantCode: codes.Unknown, wantErr: true},
+		{descr: "negative", req: trillian.GetTreeHeadBySizeRequest{LogId: logID1, TreeSize: -1}, noTX: true, wantCode: codes.Unknown, wantErr: true},
+	}
+
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+		mockStorage := storage.NewMockLogStorage(ctrl)
+		if !test.noTX {
+			mockTx := storage.NewMockLogTX(ctrl)
+			mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+			mockTx.EXPECT().SignedLogRootBySize(test.req.TreeSize).Return(test.root, test.err)
+			if test.err != nil {
+				mockTx.EXPECT().Rollback().Return(nil)
+			} else {
+				mockTx.EXPECT().Commit().Return(nil)
+			}
+		}
+		registry := testonly.NewRegistryWithLogProvider(mockStorageProviderFunc(mockStorage))
+		server := NewTrillianLogRPCServer(registry, fakeTimeSource)
+
+		resp, err := server.GetTreeHeadBySize(context.Background(), &test.req)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: GetTreeHeadBySize()=_,%v, want error: %v", test.descr, err, test.wantErr)
+		} else if err != nil {
+			if got := status.Code(err); got != test.wantCode {
+				t.Errorf("%s: GetTreeHeadBySize()=_,%v, want code %v", test.descr, err, test.wantCode)
+			}
+		} else if !proto.Equal(&test.root, resp.SignedLogRoot) {
+			t.Errorf("%s: GetTreeHeadBySize().SignedLogRoot=%v, want %v", test.descr, resp.SignedLogRoot, test.root)
+		}
+		ctrl.Finish()
+	}
+}
+
 func TestGetLeavesByHashInvalidHash(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -1571,6 +1833,143 @@ func TestGetConsistencyProof(t *testing.T) {
 	}
 }
 
+func TestGetConsistencyProofFormats(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xab}, 32)
+	var tests = []struct {
+		format trillian.ProofFormat
+		want   []byte
+	}{
+		{format: trillian.ProofFormat_PROOF_NODES},
+		{format: trillian.ProofFormat_HASH_LIST, want: hash},
+		{format: trillian.ProofFormat_RFC6962, want: []byte(`["` + base64.StdEncoding.EncodeToString(hash) + `"]`)},
+		{format: trillian.ProofFormat_RFC9162, want: append([]byte{0x00, 0x21, 0x20}, hash...)},
+	}
+
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+		mockStorage := storage.NewMockLogStorage(ctrl)
+		mockTx := storage.NewMockLogTX(ctrl)
+		mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+		mockTx.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest7.FirstTreeSize).Return(int64(3), nil)
+		mockTx.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest7.SecondTreeSize).Return(int64(5), nil)
+		mockTx.EXPECT().GetMerkleNodes(int64(5), nodeIdsConsistencySize4ToSize7).Return([]storage.Node{{NodeID: testonly.MustCreateNodeIDForTreeCoords(2, 1, 64), NodeRevision: 3, Hash: hash}}, nil)
+		mockTx.EXPECT().Commit().Return(nil)
+
+		registry := testonly.NewRegistryWithLogProvider(mockStorageProviderFunc(mockStorage))
+		server := NewTrillianLogRPCServer(registry, fakeTimeSource)
+
+		req := getConsistencyProofRequest7
+		req.ProofFormat = test.format
+		response, err := server.GetConsistencyProof(context.Background(), &req)
+		if err != nil {
+			t.Errorf("GetConsistencyProof(%v)=_,%v, want no error", test.format, err)
+		} else if got := response.Proof.EncodedPath; !bytes.Equal(got, test.want) {
+			t.Errorf("GetConsistencyProof(%v).Proof.EncodedPath=%x, want %x", test.format, got, test.want)
+		} else if got, want := len(response.Proof.ProofNode), 1; got != want {
+			t.Errorf("GetConsistencyProof(%v) returned %d proof nodes, want %d", test.format, got, want)
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestGetConsistencyProofBadFormat(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	registry := testonly.NewRegistryWithLogProvider(mockStorageProviderFunc(storage.NewMockLogStorage(ctrl)))
+	server := NewTrillianLogRPCServer(registry, fakeTimeSource)
+
+	req := getConsistencyProofRequest7
+	req.ProofFormat = trillian.ProofFormat(99)
+	if _, err := server.GetConsistencyProof(context.Background(), &req); err == nil || !strings.Contains(err.Error(), "unknown proof format") {
+		t.Errorf("GetConsistencyProof()=_,%v, want unknown proof format error", err)
+	}
+}
+
+func TestGetConsistencyProofFromCompactRange(t *testing.T) {
+	// The proof from 10 to 25 has the nodes at levels 1 and 3 of the compact range of
+	// the tree at 10 in the first and fourth places.
+	nodeIDs, err := merkle.CalcConsistencyProofNodeAddresses(getConsistencyProofRequest25.FirstTreeSize, getConsistencyProofRequest25.SecondTreeSize, proofMaxBitLen)
+	if err != nil {
+		t.Fatalf("CalcConsistencyProofNodeAddresses()=_,%v, want no error", err)
+	}
+	storedNode := func(i int) storage.Node {
+		return storage.Node{NodeID: nodeIDs[i], NodeRevision: 4, Hash: []byte(fmt.Sprintf("stored %d", i))}
+	}
+
+	var tests = []struct {
+		descr        string
+		compactRange [][]byte
+		fetch        []int
+		want         []string
+		wantRevision []int64
+	}{
+		{
+			descr:        "compact-range",
+			compactRange: [][]byte{nil, []byte("range 1"), nil, []byte("range 3")},
+			fetch:        []int{1, 2, 4},
+			want:         []string{"range 1", "stored 1", "stored 2", "range 3", "stored 4"},
+			wantRevision: []int64{3, 4, 4, 3, 4},
+		},
+		{
+			descr:        "no-compact-range",
+			fetch:        []int{0, 1, 2, 3, 4},
+			want:         []string{"stored 0", "stored 1", "stored 2", "stored 3", "stored 4"},
+			wantRevision: []int64{4, 4, 4, 4, 4},
+		},
+	}
+
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+		mockStorage := storage.NewMockLogStorage(ctrl)
+		mockTx := storage.NewMockLogTX(ctrl)
+		mockStorage.EXPECT().Snapshot().Return(mockTx, nil)
+
+		var fetchIDs []storage.NodeID
+		var fetched []storage.Node
+		for _, i := range test.fetch {
+			fetchIDs = append(fetchIDs, nodeIDs[i])
+			fetched = append(fetched, storedNode(i))
+		}
+		mockTx.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest25.FirstTreeSize).Return(int64(3), nil)
+		mockTx.EXPECT().GetTreeRevisionAtSize(getConsistencyProofRequest25.SecondTreeSize).Return(int64(5), nil)
+		mockTx.EXPECT().GetCompactRange(getConsistencyProofRequest25.FirstTreeSize).Return(test.compactRange, nil)
+		mockTx.EXPECT().GetMerkleNodes(int64(5), fetchIDs).Return(fetched, nil)
+		mockTx.EXPECT().Commit().Return(nil)
+
+		registry := testonly.NewRegistryWithLogProvider(mockStorageProviderFunc(mockStorage))
+		server := NewTrillianLogRPCServer(registry, fakeTimeSource)
+		response, err := server.GetConsistencyProof(context.Background(), &getConsistencyProofRequest25)
+		if err != nil {
+			t.Errorf("%s: GetConsistencyProof()=_,%v, want no error", test.descr, err)
+			ctrl.Finish()
+			continue
+		}
+
+		if got, want := len(response.Proof.ProofNode), len(test.want); got != want {
+			t.Errorf("%s: GetConsistencyProof() returned %d nodes, want %d", test.descr, got, want)
+			ctrl.Finish()
+			continue
+		}
+		for i, node := range response.Proof.ProofNode {
+			wantID, err := proto.Marshal(nodeIDs[i].AsProto())
+			if err != nil {
+				t.Fatalf("failed to marshal test proto - should not happen: %v", err)
+			}
+			if got, want := string(node.NodeHash), test.want[i]; got != want {
+				t.Errorf("%s: proof node %d hash=%q, want %q", test.descr, i, got, want)
+			}
+			if got, want := node.NodeRevision, test.wantRevision[i]; got != want {
+				t.Errorf("%s: proof node %d revision=%d, want %d", test.descr, i, got, want)
+			}
+			if !bytes.Equal(node.NodeId, wantID) {
+				t.Errorf("%s: proof node %d has ID %x, want %x", test.descr, i, node.NodeId, wantID)
+			}
+		}
+		ctrl.Finish()
+	}
+}
+
 type prepareMockTXFunc func(*storage.MockLogTX)
 type makeRPCFunc func(*TrillianLogRPCServer) error
 
@@ -1673,3 +2072,137 @@ func (p *parameterizedTest) executeBeginFailsTest(t *testing.T) {
 		t.Fatalf("Returned wrong error response when begin failed: %v", err)
 	}
 }
+
+// nodeCountingLogStorage counts the Merkle nodes read through its snapshots, and can hide
+// stored compact ranges to compare proofs built with and without them.
+type nodeCountingLogStorage struct {
+	storage.LogStorage
+	hideCompactRanges bool
+	nodesRead         int
+}
+
+func (s *nodeCountingLogStorage) Snapshot() (storage.ReadOnlyLogTX, error) {
+	tx, err := s.LogStorage.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &nodeCountingLogTX{ReadOnlyLogTX: tx, s: s}, nil
+}
+
+type nodeCountingLogTX struct {
+	storage.ReadOnlyLogTX
+	s *nodeCountingLogStorage
+}
+
+func (t *nodeCountingLogTX) GetMerkleNodes(treeRevision int64, nodeIDs []storage.NodeID) ([]storage.Node, error) {
+	t.s.nodesRead += len(nodeIDs)
+	return t.ReadOnlyLogTX.GetMerkleNodes(treeRevision, nodeIDs)
+}
+
+func (t *nodeCountingLogTX) GetCompactRange(treeSize int64) ([][]byte, error) {
+	if t.s.hideCompactRanges {
+		return nil, nil
+	}
+	return t.ReadOnlyLogTX.GetCompactRange(treeSize)
+}
+
+// sequenceTestLog builds a log in memory storage with a tree head at each of the given
+// sizes, which must be increasing.
+func sequenceTestLog(b testing.TB, sizes []int64) storage.LogStorage {
+	ls, err := memory.NewStorage().GetLogStorage(logID1)
+	if err != nil {
+		b.Fatalf("GetLogStorage()=_,%v, want no error", err)
+	}
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPrivateKey(testonly.DemoPrivateKey, testonly.DemoPrivateKeyPass); err != nil {
+		b.Fatalf("LoadPrivateKey()=%v, want no error", err)
+	}
+	timeSource := &util.FakeTimeSource{FakeTime: time.Date(2016, 11, 10, 15, 16, 27, 0, time.UTC)}
+	sequencer := log.NewSequencer(th, timeSource, ls, km)
+	ctx := util.NewLogContext(context.Background(), logID1)
+	if err := sequencer.SignRoot(ctx); err != nil {
+		b.Fatalf("SignRoot()=%v, want no error", err)
+	}
+
+	next := int64(0)
+	for _, size := range sizes {
+		leaves := make([]trillian.LogLeaf, 0, size-next)
+		for ; next < size; next++ {
+			value := []byte(fmt.Sprintf("leaf %d", next))
+			leaves = append(leaves, trillian.LogLeaf{LeafValueHash: crypto.NewSHA256().Digest(value), MerkleLeafHash: th.HashLeaf(value), LeafValue: value})
+		}
+		tx, err := ls.Begin()
+		if err != nil {
+			b.Fatalf("Begin()=_,%v, want no error", err)
+		}
+		if err := tx.QueueLeaves(leaves, timeSource.Now()); err != nil {
+			b.Fatalf("QueueLeaves()=%v, want no error", err)
+		}
+		if err := tx.Commit(); err != nil {
+			b.Fatalf("Commit()=%v, want no error", err)
+		}
+		timeSource.FakeTime = timeSource.FakeTime.Add(time.Second)
+		if got, err := sequencer.SequenceBatch(ctx, len(leaves)); err != nil || got != len(leaves) {
+			b.Fatalf("SequenceBatch()=%d,%v, want %d,nil", got, err, len(leaves))
+		}
+	}
+	return ls
+}
+
+func TestGetConsistencyProofCompactRangeMatchesNodes(t *testing.T) {
+	sizes := []int64{3, 5, 8, 13, 40}
+	ls := sequenceTestLog(t, sizes)
+
+	for i, first := range sizes {
+		for _, second := range sizes[i+1:] {
+			req := &trillian.GetConsistencyProofRequest{LogId: logID1, FirstTreeSize: first, SecondTreeSize: second}
+			var proofs []*trillian.Proof
+			for _, hide := range []bool{true, false} {
+				s := &nodeCountingLogStorage{LogStorage: ls, hideCompactRanges: hide}
+				server := NewTrillianLogRPCServer(testonly.NewRegistryWithLogProvider(mockStorageProviderFunc(s)), fakeTimeSource)
+				rsp, err := server.GetConsistencyProof(context.Background(), req)
+				if err != nil {
+					t.Fatalf("GetConsistencyProof(%d, %d)=_,%v, want no error", first, second, err)
+				}
+				proofs = append(proofs, rsp.Proof)
+			}
+			if got, want := len(proofs[1].ProofNode), len(proofs[0].ProofNode); got != want {
+				t.Errorf("GetConsistencyProof(%d, %d) with compact range has %d nodes, want %d", first, second, got, want)
+				continue
+			}
+			for j := range proofs[0].ProofNode {
+				if got, want := proofs[1].ProofNode[j].NodeHash, proofs[0].ProofNode[j].NodeHash; !bytes.Equal(got, want) {
+					t.Errorf("GetConsistencyProof(%d, %d) with compact range has hash %x at %d, want %x", first, second, got, j, want)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkGetConsistencyProof compares consistency proofs between tree sizes that differ by
+// orders of magnitude built with and without the compact range of the first tree, and
+// reports the number of nodes read from storage for each.
+func BenchmarkGetConsistencyProof(b *testing.B) {
+	ls := sequenceTestLog(b, []int64{10, 1000, 100000})
+
+	for _, sizes := range [][2]int64{{10, 1000}, {10, 100000}, {1000, 100000}} {
+		for _, hide := range []bool{true, false} {
+			name := fmt.Sprintf("%d-%d/compact-range", sizes[0], sizes[1])
+			if hide {
+				name = fmt.Sprintf("%d-%d/nodes", sizes[0], sizes[1])
+			}
+			b.Run(name, func(b *testing.B) {
+				s := &nodeCountingLogStorage{LogStorage: ls, hideCompactRanges: hide}
+				server := NewTrillianLogRPCServer(testonly.NewRegistryWithLogProvider(mockStorageProviderFunc(s)), fakeTimeSource)
+				req := &trillian.GetConsistencyProofRequest{LogId: logID1, FirstTreeSize: sizes[0], SecondTreeSize: sizes[1]}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := server.GetConsistencyProof(context.Background(), req); err != nil {
+						b.Fatalf("GetConsistencyProof()=_,%v, want no error", err)
+					}
+				}
+				b.ReportMetric(float64(s.nodesRead)/float64(b.N), "nodes/op")
+			})
+		}
+	}
+}
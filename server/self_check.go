@@ -0,0 +1,216 @@
+package server
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/extension"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const selfCheckMapName string = "self-check"
+
+// DefaultSelfCheckSamples is the default number of leaves whose inclusion in the latest
+// root is checked by a self check.
+const DefaultSelfCheckSamples = 1000
+
+// SelfChecker checks at startup that the latest signed root of each log can be recomputed
+// from the Merkle nodes and leaves in storage, and refuses to serve or sequence logs that
+// fail. The root is recomputed from the stored nodes on the right hand edge of the tree,
+// then a sample of leaves is checked by building their inclusion proofs from storage, so
+// the cost is bounded however big the tree is.
+type SelfChecker struct {
+	registry   extension.Registry
+	hasher     merkle.TreeHasher
+	maxSamples int64
+
+	mu      sync.RWMutex
+	refused map[int64]error
+	vars    *expvar.Map
+}
+
+// NewSelfChecker creates a SelfChecker for logs in registry that checks up to maxSamples
+// leaves of each.
+func NewSelfChecker(registry extension.Registry, maxSamples int) *SelfChecker {
+	c := &SelfChecker{
+		registry: registry,
+		// TODO(Martin2112): Allow for different tree hashers to be used by different logs
+		hasher:     merkle.NewRFC6962TreeHasher(crypto.NewSHA256()),
+		maxSamples: int64(maxSamples),
+		refused:    make(map[int64]error),
+		vars:       new(expvar.Map).Init(),
+	}
+	for _, name := range []string{"logs-checked", "logs-refused", "leaves-checked"} {
+		c.vars.Set(name, new(expvar.Int))
+	}
+	return c
+}
+
+// Publish must be called for stats to be visible. The expvar framework will prevent
+// multiple calls to Publish from succeeding.
+func (c *SelfChecker) Publish() {
+	expvar.Publish(selfCheckMapName, c.vars)
+}
+
+// CheckAll checks every active log, and returns the IDs of those that failed. Logs that
+// fail are refused until the server restarts. An error is only returned if the active
+// logs can't be listed.
+func (c *SelfChecker) CheckAll(ctx context.Context) ([]int64, error) {
+	// TODO(Martin2112): Have to pass a tree ID when we just want metadata. API mismatch
+	logStorage, err := c.registry.GetLogStorage(0)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := logStorage.Begin()
+	if err != nil {
+		return nil, err
+	}
+	logIDs, err := tx.GetActiveLogIDs()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	var failed []int64
+	for _, logID := range logIDs {
+		logCtx := util.NewLogContext(ctx, logID)
+		if err := c.CheckLog(logID); err != nil {
+			glog.Errorf("%s: CRITICAL: self check failed, refusing to serve log: %v", util.LogIDPrefix(logCtx), err)
+			failed = append(failed, logID)
+			continue
+		}
+		glog.Infof("%s: self check passed", util.LogIDPrefix(logCtx))
+	}
+	return failed, nil
+}
+
+// CheckLog checks a single log, and refuses it if the check fails.
+func (c *SelfChecker) CheckLog(logID int64) error {
+	c.vars.Add("logs-checked", 1)
+	logStorage, err := c.registry.GetLogStorage(logID)
+	if err == nil {
+		err = c.checkLog(logStorage)
+	}
+	if err != nil {
+		c.mu.Lock()
+		c.refused[logID] = err
+		c.mu.Unlock()
+		c.vars.Add("logs-refused", 1)
+	}
+	return err
+}
+
+func (c *SelfChecker) checkLog(logStorage storage.ReadOnlyLogStorage) (err error) {
+	tx, err := logStorage.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	root, err := tx.LatestSignedLogRoot()
+	if err != nil {
+		return fmt.Errorf("failed to read latest root: %v", err)
+	}
+	if root.TreeSize == 0 {
+		return nil
+	}
+
+	// This is how the sequencer resumes from storage, so it must work for the log to grow.
+	if _, err := merkle.NewCompactMerkleTreeWithState(c.hasher, root.TreeSize, func(depth int, index int64) ([]byte, error) {
+		nodeID, err := storage.NewNodeIDForTreeCoords(int64(depth), index, proofMaxBitLen)
+		if err != nil {
+			return nil, err
+		}
+		nodes, err := tx.GetMerkleNodes(root.TreeRevision, []storage.NodeID{nodeID})
+		if err != nil {
+			return nil, err
+		}
+		if len(nodes) != 1 {
+			return nil, fmt.Errorf("got %d nodes for %s@%d, want 1", len(nodes), nodeID.String(), root.TreeRevision)
+		}
+		return nodes[0].Hash, nil
+	}, root.RootHash); err != nil {
+		return fmt.Errorf("stored nodes don't reproduce root of tree size %d at revision %d: %v", root.TreeSize, root.TreeRevision, err)
+	}
+
+	indices := c.sampleIndices(root.TreeSize)
+	leaves, err := tx.GetLeavesByIndex(indices)
+	if err != nil {
+		return fmt.Errorf("failed to read sampled leaves: %v", err)
+	}
+	if got, want := len(leaves), len(indices); got != want {
+		return fmt.Errorf("got %d sampled leaves, want %d", got, want)
+	}
+	verifier := merkle.NewLogVerifier(c.hasher)
+	for _, leaf := range leaves {
+		proof, err := getInclusionProofForLeafIndexAtRevision(tx, root.TreeRevision, root.TreeSize, leaf.LeafIndex)
+		if err != nil {
+			return fmt.Errorf("failed to build inclusion proof for leaf %d: %v", leaf.LeafIndex, err)
+		}
+		hashes := make([][]byte, 0, len(proof.ProofNode))
+		for _, node := range proof.ProofNode {
+			hashes = append(hashes, node.NodeHash)
+		}
+		if err := verifier.VerifyInclusionProof(leaf.LeafIndex, root.TreeSize, hashes, root.RootHash, c.hasher.HashLeaf(leaf.LeafValue)); err != nil {
+			return fmt.Errorf("leaf %d isn't included in root of tree size %d: %v", leaf.LeafIndex, root.TreeSize, err)
+		}
+		c.vars.Add("leaves-checked", 1)
+	}
+	return nil
+}
+
+// sampleIndices returns the indices of the leaves to check in a tree of size treeSize:
+// all of them if there are no more than the maximum number of samples, otherwise leaves
+// spread evenly across the tree, always including the last.
+func (c *SelfChecker) sampleIndices(treeSize int64) []int64 {
+	if treeSize <= c.maxSamples {
+		indices := make([]int64, 0, treeSize)
+		for i := int64(0); i < treeSize; i++ {
+			indices = append(indices, i)
+		}
+		return indices
+	}
+	indices := make([]int64, 0, c.maxSamples)
+	for i := int64(0); i < c.maxSamples-1; i++ {
+		indices = append(indices, i*(treeSize-1)/(c.maxSamples-1))
+	}
+	return append(indices, treeSize-1)
+}
+
+// Refused returns the reason logID failed its self check, or nil if it didn't.
+func (c *SelfChecker) Refused(logID int64) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.refused[logID]
+}
+
+// Interceptor returns a UnaryServerInterceptor that fails RPCs for refused logs with a
+// FailedPrecondition status.
+func (c *SelfChecker) Interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if treeID, ok := treeIDOf(req); ok {
+			if err := c.Refused(treeID); err != nil {
+				return nil, status.Errorf(codes.FailedPrecondition, "tree %d failed its self check: %v", treeID, err)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
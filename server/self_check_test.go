@@ -0,0 +1,202 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/memory"
+	"github.com/google/trillian/testonly"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// tamperedLogStorage changes the nodes and leaves read from the storage it wraps.
+type tamperedLogStorage struct {
+	storage.LogStorage
+	node func(n *storage.Node)
+	leaf func(l *trillian.LogLeaf)
+}
+
+func (s tamperedLogStorage) Snapshot() (storage.ReadOnlyLogTX, error) {
+	tx, err := s.LogStorage.Snapshot()
+	return tamperedLogTX{ReadOnlyLogTX: tx, s: s}, err
+}
+
+type tamperedLogTX struct {
+	storage.ReadOnlyLogTX
+	s tamperedLogStorage
+}
+
+func (t tamperedLogTX) GetMerkleNodes(treeRevision int64, nodeIDs []storage.NodeID) ([]storage.Node, error) {
+	nodes, err := t.ReadOnlyLogTX.GetMerkleNodes(treeRevision, nodeIDs)
+	if t.s.node != nil {
+		for i := range nodes {
+			t.s.node(&nodes[i])
+		}
+	}
+	return nodes, err
+}
+
+func (t tamperedLogTX) GetLeavesByIndex(indices []int64) ([]trillian.LogLeaf, error) {
+	leaves, err := t.ReadOnlyLogTX.GetLeavesByIndex(indices)
+	if t.s.leaf != nil {
+		for i := range leaves {
+			t.s.leaf(&leaves[i])
+		}
+	}
+	return leaves, err
+}
+
+// newSelfCheckLog returns memory storage holding a log with the given number of leaves.
+func newSelfCheckLog(t *testing.T, logID int64, leaves int) *memory.Storage {
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPrivateKey(testonly.DemoPrivateKey, testonly.DemoPrivateKeyPass); err != nil {
+		t.Fatalf("LoadPrivateKey()=%v, want no error", err)
+	}
+	s := memory.NewStorage()
+	ls, err := s.GetLogStorage(logID)
+	if err != nil {
+		t.Fatalf("GetLogStorage(%d)=_,%v, want no error", logID, err)
+	}
+	tx, err := ls.Begin()
+	if err != nil {
+		t.Fatalf("Begin()=_,%v, want no error", err)
+	}
+	var queued []trillian.LogLeaf
+	for i := 0; i < leaves; i++ {
+		value := []byte{byte(i)}
+		queued = append(queued, trillian.LogLeaf{LeafValueHash: crypto.NewSHA256().Digest(value), MerkleLeafHash: treeHasher.HashLeaf(value), LeafValue: value})
+	}
+	if err := tx.QueueLeaves(queued, fakeTime.Add(-time.Second)); err != nil {
+		t.Fatalf("QueueLeaves()=%v, want no error", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit()=%v, want no error", err)
+	}
+
+	// The first pass creates the log's initial root, the second sequences the leaves.
+	registry := testonly.NewRegistryWithLogProvider(s.GetLogStorage)
+	sm := NewSequencerManager(km, registry, zeroDuration)
+	sm.ExecutePass([]int64{logID}, createTestContext(registry))
+	logctx := createTestContext(registry)
+	logctx.timeSource = util.FakeTimeSource{FakeTime: fakeTime.Add(time.Second)}
+	sm.ExecutePass([]int64{logID}, logctx)
+	return s
+}
+
+func isNode(n *storage.Node, depth, index int64) bool {
+	id, err := storage.NewNodeIDForTreeCoords(depth, index, proofMaxBitLen)
+	return err == nil && n.NodeID.Equivalent(id)
+}
+
+func TestSelfCheck(t *testing.T) {
+	const logID = int64(6962)
+	s := newSelfCheckLog(t, logID, 13)
+	corrupt := []byte("corrupt")
+
+	var tests = []struct {
+		descr   string
+		samples int
+		node    func(n *storage.Node)
+		leaf    func(l *trillian.LogLeaf)
+		wantErr bool
+	}{
+		{descr: "ok", samples: DefaultSelfCheckSamples},
+		{descr: "sampled", samples: 3},
+		{descr: "right-edge-node", samples: 3, node: func(n *storage.Node) {
+			if isNode(n, 0, 12) {
+				n.Hash = corrupt
+			}
+		}, wantErr: true},
+		{descr: "inner-node", samples: DefaultSelfCheckSamples, node: func(n *storage.Node) {
+			if isNode(n, 1, 1) {
+				n.Hash = corrupt
+			}
+		}, wantErr: true},
+		{descr: "leaf-value", samples: DefaultSelfCheckSamples, leaf: func(l *trillian.LogLeaf) {
+			if l.LeafIndex == 4 {
+				l.LeafValue = corrupt
+			}
+		}, wantErr: true},
+		// Leaves 0, 6 and 12 are sampled, so other corrupt leaves aren't noticed.
+		{descr: "leaf-value-not-sampled", samples: 3, leaf: func(l *trillian.LogLeaf) {
+			if l.LeafIndex == 4 {
+				l.LeafValue = corrupt
+			}
+		}},
+		{descr: "sampled-leaf-value", samples: 3, leaf: func(l *trillian.LogLeaf) {
+			if l.LeafIndex == 6 {
+				l.LeafValue = corrupt
+			}
+		}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		registry := testonly.NewRegistryWithLogProvider(func(id int64) (storage.LogStorage, error) {
+			ls, err := s.GetLogStorage(id)
+			return tamperedLogStorage{LogStorage: ls, node: test.node, leaf: test.leaf}, err
+		})
+		c := NewSelfChecker(registry, test.samples)
+		err := c.CheckLog(logID)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: CheckLog()=%v, want error: %v", test.descr, err, test.wantErr)
+		}
+		if got, want := c.Refused(logID), err; got != want {
+			t.Errorf("%s: Refused()=%v, want %v", test.descr, got, want)
+		}
+	}
+}
+
+func TestSelfCheckSampleIndices(t *testing.T) {
+	var tests = []struct {
+		samples  int
+		treeSize int64
+		want     string
+	}{
+		{samples: 10, treeSize: 0, want: "[]"},
+		{samples: 10, treeSize: 4, want: "[0 1 2 3]"},
+		{samples: 4, treeSize: 4, want: "[0 1 2 3]"},
+		{samples: 4, treeSize: 10, want: "[0 3 6 9]"},
+		{samples: 1, treeSize: 10, want: "[9]"},
+	}
+	for _, test := range tests {
+		c := NewSelfChecker(nil, test.samples)
+		if got := fmt.Sprint(c.sampleIndices(test.treeSize)); got != test.want {
+			t.Errorf("sampleIndices(%d) with %d samples=%s, want %s", test.treeSize, test.samples, got, test.want)
+		}
+	}
+}
+
+func TestSelfCheckInterceptor(t *testing.T) {
+	const logID = int64(6962)
+	s := newSelfCheckLog(t, logID, 5)
+	registry := testonly.NewRegistryWithLogProvider(func(id int64) (storage.LogStorage, error) {
+		ls, err := s.GetLogStorage(id)
+		return tamperedLogStorage{LogStorage: ls, node: func(n *storage.Node) { n.Hash = []byte("corrupt") }}, err
+	})
+	c := NewSelfChecker(registry, DefaultSelfCheckSamples)
+	failed, err := c.CheckAll(context.Background())
+	if err != nil {
+		t.Fatalf("CheckAll()=_,%v", err)
+	}
+	if got, want := fmt.Sprint(failed), "[6962]"; got != want {
+		t.Errorf("CheckAll()=%s, want %s", got, want)
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+	info := &grpc.UnaryServerInfo{FullMethod: "/trillian.TrillianLog/GetLatestSignedLogRoot"}
+	_, err = c.Interceptor()(context.Background(), &trillian.GetLatestSignedLogRootRequest{LogId: logID}, info, handler)
+	if got, want := status.Code(err), codes.FailedPrecondition; got != want {
+		t.Errorf("Interceptor(refused log)=%v, want code %v", err, want)
+	}
+	if _, err := c.Interceptor()(context.Background(), &trillian.GetLatestSignedLogRootRequest{LogId: logID + 1}, info, handler); err != nil {
+		t.Errorf("Interceptor(other log)=%v, want nil", err)
+	}
+}
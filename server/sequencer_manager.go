@@ -8,7 +8,9 @@ import (
 	"github.com/google/trillian/extension"
 	"github.com/google/trillian/log"
 	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage"
 	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
 )
 
 // SequencerManager provides sequencing operations for a collection of Logs.
@@ -16,18 +18,61 @@ type SequencerManager struct {
 	keyManager  crypto.KeyManager
 	guardWindow time.Duration
 	registry    extension.Registry
+	capacity    *TreeCapacity
+	leafTracker *LeafTracker
+	selfChecker *SelfChecker
+	// pipelineBatches is the number of batches sequenced per log in each pass, with the next
+	// batch prepared while the previous one commits. One means no pipelining.
+	pipelineBatches int
+	// hooks holds the sequencing hooks registered for each log.
+	hooks map[int64]log.SequencingHooks
 }
 
 // NewSequencerManager creates a new SequencerManager instance based on the provided KeyManager instance
 // and guard window.
 func NewSequencerManager(km crypto.KeyManager, registry extension.Registry, gw time.Duration) *SequencerManager {
 	return &SequencerManager{
-		keyManager:  km,
-		guardWindow: gw,
-		registry:    registry,
+		keyManager:      km,
+		guardWindow:     gw,
+		registry:        registry,
+		pipelineBatches: 1,
+		hooks:           make(map[int64]log.SequencingHooks),
 	}
 }
 
+// SetTreeCapacity sets the TreeCapacity used to monitor the size of logs that have a
+// maximum size configured.
+func (s *SequencerManager) SetTreeCapacity(capacity *TreeCapacity) {
+	s.capacity = capacity
+}
+
+// SetLeafTracker sets the LeafTracker that's told about the leaves integrated by each pass.
+func (s *SequencerManager) SetLeafTracker(tracker *LeafTracker) {
+	s.leafTracker = tracker
+}
+
+// SetSelfChecker sets the SelfChecker whose refused logs aren't sequenced.
+func (s *SequencerManager) SetSelfChecker(checker *SelfChecker) {
+	s.selfChecker = checker
+}
+
+// SetSequencingHooks registers hooks called around the commit of each batch sequenced for
+// the log logID, replacing any registered before. It must be called before sequencing
+// starts.
+func (s *SequencerManager) SetSequencingHooks(logID int64, hooks log.SequencingHooks) {
+	s.hooks[logID] = hooks
+}
+
+// SetPipelineBatches sets how many batches are sequenced for each log in a pass. When it's
+// more than one, each batch is prepared while the previous one is committed, which helps
+// throughput when storage commits are slow.
+func (s *SequencerManager) SetPipelineBatches(batches int) {
+	if batches < 1 {
+		batches = 1
+	}
+	s.pipelineBatches = batches
+}
+
 // Name returns the name of the object.
 func (s SequencerManager) Name() string {
 	return "Sequencer"
@@ -51,6 +96,13 @@ func (s SequencerManager) ExecutePass(logIDs []int64, logctx LogOperationManager
 		storage, err := s.registry.GetLogStorage(logID)
 		ctx := util.NewLogContext(logctx.ctx, logID)
 
+		if s.selfChecker != nil {
+			if err := s.selfChecker.Refused(logID); err != nil {
+				glog.V(1).Infof("%s: Not sequencing log that failed its self check: %v", util.LogIDPrefix(ctx), err)
+				continue
+			}
+		}
+
 		// TODO(Martin2112): Honour the sequencing enabled in log parameters, needs an API change
 		// so deferring it
 		if err != nil {
@@ -61,9 +113,20 @@ func (s SequencerManager) ExecutePass(logIDs []int64, logctx LogOperationManager
 		// TODO(Martin2112): Allow for different tree hashers to be used by different logs
 		sequencer := log.NewSequencer(merkle.NewRFC6962TreeHasher(crypto.NewSHA256()), logctx.timeSource, storage, s.keyManager)
 		sequencer.SetGuardWindow(s.guardWindow)
+		if s.leafTracker != nil {
+			sequencer.SetLeafObserver(s.leafTracker)
+		}
+		if hooks, ok := s.hooks[logID]; ok {
+			sequencer.SetSequencingHooks(hooks)
+		}
 
-		leaves, err := sequencer.SequenceBatch(ctx, logctx.batchSize)
+		leaves, err := sequencer.SequenceBatches(ctx, logctx.batchSize, s.pipelineBatches)
 
+		if err != nil && logctx.ctx.Err() != nil {
+			// Nothing of a batch that fails is written, so the log is left consistent
+			glog.Infof("%s: Sequencing stopped for shutdown: %v", util.LogIDPrefix(ctx), err)
+			return true
+		}
 		if err != nil {
 			glog.Warningf("%s: Error trying to sequence batch for: %v", util.LogIDPrefix(ctx), err)
 			continue
@@ -71,9 +134,39 @@ func (s SequencerManager) ExecutePass(logIDs []int64, logctx LogOperationManager
 
 		successCount++
 		leavesAdded += leaves
+
+		if err := s.updateCapacity(ctx, logID, storage); err != nil {
+			glog.Warningf("%s: Failed to check tree capacity: %v", util.LogIDPrefix(ctx), err)
+		}
 	}
 
 	glog.V(1).Infof("Sequencing run completed %d succeeded %d failed %d leaves integrated", successCount, len(logIDs)-successCount, leavesAdded)
 
 	return false
 }
+
+// updateCapacity records the current size of a log that has a maximum size configured.
+func (s SequencerManager) updateCapacity(ctx context.Context, logID int64, logStorage storage.ReadOnlyLogStorage) error {
+	if s.capacity == nil {
+		return nil
+	}
+	if _, ok := s.capacity.Limit(logID); !ok {
+		return nil
+	}
+
+	tx, err := logStorage.Snapshot()
+	if err != nil {
+		return err
+	}
+	root, err := tx.LatestSignedLogRoot()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.capacity.Update(ctx, logID, root.TreeSize)
+	return nil
+}
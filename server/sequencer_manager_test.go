@@ -1,6 +1,7 @@
 package server
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/google/trillian/extension"
 	"github.com/google/trillian/merkle"
 	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/memory"
 	"github.com/google/trillian/testonly"
 	"github.com/google/trillian/util"
 )
@@ -126,6 +128,7 @@ func TestSequencerManagerSingleLogOneLeaf(t *testing.T) {
 	mockTx.EXPECT().UpdateSequencedLeaves([]trillian.LogLeaf{testLeaf0Updated}).Return(nil)
 	mockTx.EXPECT().SetMerkleNodes(updatedNodes0).Return(nil)
 	mockTx.EXPECT().StoreSignedLogRoot(updatedRoot).Return(nil)
+	mockTx.EXPECT().StoreCompactRange(updatedRoot.TreeSize, gomock.Any()).Return(nil)
 	mockStorage.EXPECT().Begin().Return(mockTx, nil)
 
 	mockSigner := crypto.NewMockSigner(mockCtrl)
@@ -160,6 +163,66 @@ func TestSequencerManagerGuardWindow(t *testing.T) {
 	sm.ExecutePass([]int64{logID}, createTestContext(registry))
 }
 
+// recordingHooks records the leaves committed by each batch.
+type recordingHooks struct {
+	committed []trillian.LogLeaf
+}
+
+func (h *recordingHooks) PreCommit(ctx context.Context, leaves []trillian.LogLeaf, root trillian.SignedLogRoot) error {
+	return nil
+}
+
+func (h *recordingHooks) PostCommit(ctx context.Context, leaves []trillian.LogLeaf, root trillian.SignedLogRoot) {
+	h.committed = append(h.committed, leaves...)
+}
+
+func (h *recordingHooks) Aborted(ctx context.Context, leaves []trillian.LogLeaf) {}
+
+func TestSequencerManagerSequencingHooks(t *testing.T) {
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPrivateKey(testonly.DemoPrivateKey, testonly.DemoPrivateKeyPass); err != nil {
+		t.Fatalf("LoadPrivateKey()=%v, want no error", err)
+	}
+	s := memory.NewStorage()
+	registry := testonly.NewRegistryWithLogProvider(s.GetLogStorage)
+	for _, logID := range []int64{logID1, logID2} {
+		ls, err := s.GetLogStorage(logID)
+		if err != nil {
+			t.Fatalf("GetLogStorage(%d)=_,%v, want no error", logID, err)
+		}
+		tx, err := ls.Begin()
+		if err != nil {
+			t.Fatalf("Begin()=_,%v, want no error", err)
+		}
+		value := []byte{byte(logID)}
+		leaf := trillian.LogLeaf{LeafValueHash: crypto.NewSHA256().Digest(value), MerkleLeafHash: treeHasher.HashLeaf(value), LeafValue: value}
+		if err := tx.QueueLeaves([]trillian.LogLeaf{leaf}, fakeTime.Add(-time.Second)); err != nil {
+			t.Fatalf("QueueLeaves()=%v, want no error", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit()=%v, want no error", err)
+		}
+	}
+
+	sm := NewSequencerManager(km, registry, zeroDuration)
+	hooks := &recordingHooks{}
+	sm.SetSequencingHooks(logID1, hooks)
+	logIDs := []int64{logID1, logID2}
+	// The first pass creates the logs' initial roots, the second sequences the leaves.
+	sm.ExecutePass(logIDs, createTestContext(registry))
+	logctx := createTestContext(registry)
+	logctx.timeSource = util.FakeTimeSource{FakeTime: fakeTime.Add(time.Second)}
+	sm.ExecutePass(logIDs, logctx)
+
+	// Only the leaf of the log with hooks is seen by them.
+	if got, want := len(hooks.committed), 1; got != want {
+		t.Fatalf("PostCommit got %d leaves, want %d", got, want)
+	}
+	if got, want := hooks.committed[0].LeafValue, []byte{byte(logID1)}; !bytes.Equal(got, want) {
+		t.Errorf("PostCommit got leaf %x, want %x", got, want)
+	}
+}
+
 func mockStorageProviderForSequencer(mockStorage storage.LogStorage) testonly.GetLogStorageFunc {
 	return func(id int64) (storage.LogStorage, error) {
 		if id >= 0 && id <= 1 {
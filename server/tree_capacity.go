@@ -0,0 +1,125 @@
+package server
+
+import (
+	"expvar"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+// DefaultCapacityWarnFraction is the fraction of a tree's maximum size above which
+// capacity warnings are raised.
+const DefaultCapacityWarnFraction = 0.9
+
+const treeCapacityMapName string = "tree-capacity"
+
+// TreeCapacity tracks the size of trees that have a configured maximum size and exports
+// how close each one is to its limit, so operators can be warned in good time to bring
+// up a new shard.
+type TreeCapacity struct {
+	limits       map[int64]int64
+	warnFraction float64
+
+	mu   sync.Mutex
+	vars *expvar.Map // logID => expvar.Map of the stats for that tree
+}
+
+// NewTreeCapacity creates a TreeCapacity for the given maximum tree sizes, keyed by tree
+// ID. Warnings are raised once a tree's size is at least warnFraction of its maximum.
+func NewTreeCapacity(limits map[int64]int64, warnFraction float64) *TreeCapacity {
+	return &TreeCapacity{limits: limits, warnFraction: warnFraction, vars: new(expvar.Map).Init()}
+}
+
+// Publish must be called for stats to be visible. The expvar framework will prevent
+// multiple calls to Publish from succeeding.
+func (t *TreeCapacity) Publish() {
+	expvar.Publish(treeCapacityMapName, t.vars)
+}
+
+// Limit returns the maximum size configured for a tree, if there is one.
+func (t *TreeCapacity) Limit(logID int64) (int64, bool) {
+	limit, ok := t.limits[logID]
+	return limit, ok
+}
+
+// Update records the current size of a tree, logging a warning if it is close to or
+// at its maximum size.
+func (t *TreeCapacity) Update(ctx context.Context, logID, treeSize int64) {
+	limit, ok := t.Limit(logID)
+	if !ok {
+		return
+	}
+
+	nearCapacity := float64(treeSize) >= t.warnFraction*float64(limit)
+	atCapacity := treeSize >= limit
+
+	stats := t.statsForTree(logID)
+	stats.Get("tree-size").(*expvar.Int).Set(treeSize)
+	stats.Get("max-tree-size").(*expvar.Int).Set(limit)
+	stats.Get("near-capacity").(*expvar.Int).Set(boolToInt(nearCapacity))
+	stats.Get("at-capacity").(*expvar.Int).Set(boolToInt(atCapacity))
+
+	switch {
+	case atCapacity:
+		glog.Warningf("%s: tree has reached its maximum size: %d >= %d", util.LogIDPrefix(ctx), treeSize, limit)
+	case nearCapacity:
+		glog.Warningf("%s: tree is approaching its maximum size: %d of %d", util.LogIDPrefix(ctx), treeSize, limit)
+	}
+}
+
+func (t *TreeCapacity) statsForTree(logID int64) *expvar.Map {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := strconv.FormatInt(logID, 10)
+	if stats, ok := t.vars.Get(key).(*expvar.Map); ok {
+		return stats
+	}
+	stats := new(expvar.Map).Init()
+	for _, name := range []string{"tree-size", "max-tree-size", "near-capacity", "at-capacity"} {
+		stats.Set(name, new(expvar.Int))
+	}
+	t.vars.Set(key, stats)
+	return stats
+}
+
+// ParseTreeSizeLimits parses a comma separated list of treeID:maxSize pairs, as used in
+// server flags.
+func ParseTreeSizeLimits(spec string) (map[int64]int64, error) {
+	limits := make(map[int64]int64)
+	if len(strings.TrimSpace(spec)) == 0 {
+		return limits, nil
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid tree size limit, want treeID:maxSize: %q", entry)
+		}
+		treeID, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tree ID in tree size limit %q: %v", entry, err)
+		}
+		maxSize, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || maxSize <= 0 {
+			return nil, fmt.Errorf("invalid max size in tree size limit %q", entry)
+		}
+		if _, ok := limits[treeID]; ok {
+			return nil, fmt.Errorf("duplicate tree size limit for tree %d", treeID)
+		}
+		limits[treeID] = maxSize
+	}
+	return limits, nil
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
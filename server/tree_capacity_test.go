@@ -0,0 +1,119 @@
+package server
+
+import (
+	"expvar"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/storage"
+	"golang.org/x/net/context"
+)
+
+func TestParseTreeSizeLimits(t *testing.T) {
+	var tests = []struct {
+		spec    string
+		want    map[int64]int64
+		wantErr bool
+	}{
+		{spec: "", want: map[int64]int64{}},
+		{spec: "1:100", want: map[int64]int64{1: 100}},
+		{spec: "1:100, 2:5000", want: map[int64]int64{1: 100, 2: 5000}},
+		{spec: "1", wantErr: true},
+		{spec: "1:2:3", wantErr: true},
+		{spec: "x:100", wantErr: true},
+		{spec: "1:y", wantErr: true},
+		{spec: "1:0", wantErr: true},
+		{spec: "1:-5", wantErr: true},
+		{spec: "1:100,1:200", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ParseTreeSizeLimits(test.spec)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("ParseTreeSizeLimits(%q)=%v, want err: %v", test.spec, err, test.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseTreeSizeLimits(%q)=%v, want %v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestTreeCapacityUpdate(t *testing.T) {
+	var tests = []struct {
+		treeSize               int64
+		wantNear, wantAtLimits int64
+	}{
+		{0, 0, 0},
+		{89, 0, 0},
+		{90, 1, 0},
+		{99, 1, 0},
+		{100, 1, 1},
+		{150, 1, 1},
+	}
+	tc := NewTreeCapacity(map[int64]int64{7: 100}, 0.9)
+	ctx := context.Background()
+	for _, test := range tests {
+		tc.Update(ctx, 7, test.treeSize)
+		stats := tc.vars.Get("7").(*expvar.Map)
+		if got, want := stats.Get("tree-size").String(), expvarInt(test.treeSize); got != want {
+			t.Errorf("Update(%d): tree-size=%s, want %s", test.treeSize, got, want)
+		}
+		if got, want := stats.Get("max-tree-size").String(), "100"; got != want {
+			t.Errorf("Update(%d): max-tree-size=%s, want %s", test.treeSize, got, want)
+		}
+		if got, want := stats.Get("near-capacity").String(), expvarInt(test.wantNear); got != want {
+			t.Errorf("Update(%d): near-capacity=%s, want %s", test.treeSize, got, want)
+		}
+		if got, want := stats.Get("at-capacity").String(), expvarInt(test.wantAtLimits); got != want {
+			t.Errorf("Update(%d): at-capacity=%s, want %s", test.treeSize, got, want)
+		}
+	}
+
+	// Trees without a limit aren't tracked.
+	tc.Update(ctx, 8, 1000)
+	if got := tc.vars.Get("8"); got != nil {
+		t.Errorf("Update(unlimited tree) exported %v, want nothing", got)
+	}
+}
+
+func TestSequencerManagerUpdatesCapacity(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockStorage := storage.NewMockLogStorage(mockCtrl)
+	mockTx := storage.NewMockLogTX(mockCtrl)
+	mockSnapshot := storage.NewMockReadOnlyLogTX(mockCtrl)
+	logID := int64(1)
+
+	mockStorage.EXPECT().Begin().Return(mockTx, nil)
+	mockTx.EXPECT().Commit().Return(nil)
+	mockTx.EXPECT().WriteRevision().AnyTimes().Return(writeRev)
+	mockTx.EXPECT().LatestSignedLogRoot().Return(testRoot0, nil)
+	mockTx.EXPECT().DequeueLeaves(50, fakeTime).Return([]trillian.LogLeaf{}, nil)
+	mockStorage.EXPECT().Snapshot().Return(mockSnapshot, nil)
+	mockSnapshot.EXPECT().LatestSignedLogRoot().Return(trillian.SignedLogRoot{TreeSize: 95}, nil)
+	mockSnapshot.EXPECT().Commit().Return(nil)
+	mockKeyManager := crypto.NewMockKeyManager(mockCtrl)
+	mockKeyManager.EXPECT().SignatureAlgorithm().AnyTimes().Return(trillian.SignatureAlgorithm_ECDSA)
+
+	registry := registryForSequencer(mockStorage)
+	sm := NewSequencerManager(mockKeyManager, registry, zeroDuration)
+	tc := NewTreeCapacity(map[int64]int64{logID: 100}, 0.9)
+	sm.SetTreeCapacity(tc)
+
+	sm.ExecutePass([]int64{logID}, createTestContext(registry))
+
+	stats := tc.vars.Get("1").(*expvar.Map)
+	if got, want := stats.Get("near-capacity").String(), "1"; got != want {
+		t.Errorf("near-capacity=%s, want %s", got, want)
+	}
+}
+
+func expvarInt(i int64) string {
+	v := new(expvar.Int)
+	v.Set(i)
+	return v.String()
+}
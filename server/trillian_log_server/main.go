@@ -1,12 +1,17 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"expvar"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -21,8 +26,10 @@ import (
 	"github.com/google/trillian/server"
 	"github.com/google/trillian/util"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+var configFileFlag = flag.String("config", "", "If set, JSON file holding settings for any of the other flags, keyed by flag name. Each flag may also be set by an environment variable named TRILLIAN_ and the flag name in upper case, e.g. TRILLIAN_BATCH_SIZE. Flags given on the command line take precedence over the environment, which takes precedence over the file")
 var serverPortFlag = flag.Int("port", 8090, "Port to serve log RPC requests on")
 var exportRPCMetrics = flag.Bool("exportMetrics", true, "If true starts HTTP server and exports stats")
 var httpPortFlag = flag.Int("http_port", 8091, "Port to serve HTTP metrics on")
@@ -31,6 +38,27 @@ var sequencerSleepBetweenRunsFlag = flag.Duration("sequencer_sleep_between_runs"
 var signerIntervalFlag = flag.Duration("signer_interval", time.Second*120, "Time after which a new STH is created even if no leaves added")
 var batchSizeFlag = flag.Int("batch_size", 50, "Max number of leaves to process per batch")
 var sequencerGuardWindowFlag = flag.Duration("sequencer_guard_window", 0, "If set, the time elapsed before submitted leaves are eligible for sequencing")
+var sequencerPipelineBatchesFlag = flag.Int("sequencer_pipeline_batches", 1, "Max number of batches sequenced per log in each pass, with each batch prepared while the previous one commits. One disables pipelining")
+var treeSizeLimitsFlag = flag.String("tree_size_limits", "", "Comma separated list of treeID:maxSize pairs, used to warn when trees approach their capacity")
+var ntpServerFlag = flag.String("ntp_server", "", "If set, NTP server used to verify and correct the local clock when timestamping leaves and tree heads")
+var maxClockSkewFlag = flag.Duration("max_clock_skew", time.Second, "Local clock offset from the NTP server above which an alarm is raised")
+var clockCheckIntervalFlag = flag.Duration("clock_check_interval", time.Minute, "How often to check the local clock against the NTP server")
+var rpcServerTimeoutFlag = flag.Duration("rpc_server_timeout", time.Minute, "Maximum time spent processing an RPC, whatever deadline the client set. Zero means no limit")
+var rpcMethodTimeoutsFlag = flag.String("rpc_method_timeouts", "", "Comma separated list of method:duration pairs overriding --rpc_server_timeout for particular RPCs, e.g. GetLeavesByIndex:2m")
+var tlsCertFileFlag = flag.String("tls_cert_file", "", "If set, file holding the PEM encoded TLS server certificate chain; RPCs are then served over TLS")
+var tlsKeyFileFlag = flag.String("tls_key_file", "", "File holding the PEM encoded private key for --tls_cert_file")
+var maxTrackedLeavesFlag = flag.Int("max_tracked_leaves", server.DefaultMaxTrackedLeaves, "Number of recently queued leaves whose progress is tracked and can be looked up at /debug/leaf on the HTTP port. Older leaves are found there while they're still queued. Zero disables tracking")
+var tlsReloadIntervalFlag = flag.Duration("tls_reload_interval", time.Minute, "How often to check the TLS certificate files for changes")
+var leafIndexCheckIntervalFlag = flag.Duration("leaf_index_check_interval", time.Minute, "Time to pause between checks of a batch of each log's sequenced leaves for duplicate or missing indices. Zero disables checking")
+var leafIndexCheckBatchSizeFlag = flag.Int("leaf_index_check_batch_size", 100, "Number of sequenced leaves per log checked for duplicate or missing indices each --leaf_index_check_interval")
+var tlsClientCAFileFlag = flag.String("tls_client_ca_file", "", "If set, file holding the PEM encoded CA certificates that client certificates are verified against. A verified client is identified by its certificate's common name")
+var treeACLsFlag = flag.Bool("tree_acls", false, "If true, each RPC needs the caller to have been granted the scope for the method (tree:read, tree:write or tree:admin) in the tree's access control list. The TrillianAdmin API that manages the lists is only served when this is set")
+var adminPrincipalsFlag = flag.String("admin_principals", "", "Comma separated list of principals granted tree:admin on every tree when --tree_acls is set")
+var treeACLCacheTTLFlag = flag.Duration("tree_acl_cache_ttl", 30*time.Second, "How long tree access control lists are cached for before being read from storage again")
+var selfCheckFlag = flag.Bool("self_check", false, "If true, check at startup that each log's latest signed root can be recomputed from its stored Merkle nodes and leaves, and refuse to serve or sequence logs that fail")
+var selfCheckSamplesFlag = flag.Int("self_check_samples", server.DefaultSelfCheckSamples, "Most leaves of each log whose inclusion in its latest root is checked by --self_check. Leaves are sampled evenly across bigger trees")
+var shutdownTimeoutFlag = flag.Duration("shutdown_timeout", 30*time.Second, "Maximum time to wait on shutdown for sequencing batches in progress to be committed. Batches that haven't started writing are abandoned, leaving their leaves queued")
+var treeSizeWarnFractionFlag = flag.Float64("tree_size_warn_fraction", server.DefaultCapacityWarnFraction, "Fraction of a tree's maximum size above which capacity warnings are raised")
 
 // TODO(Martin2112): Single private key doesn't really work for multi tenant and we can't use
 // an HSM interface in this way. Deferring these issues for later.
@@ -57,18 +85,92 @@ func checkDatabaseAccessible(registry extension.Registry) error {
 	return err
 }
 
-func startRPCServer(listener net.Listener, port int, registry extension.Registry) *grpc.Server {
+// newTimeSource returns the time source used to timestamp queued leaves and tree heads.
+// If an NTP server is configured this checks the local clock against it periodically
+// until ctx is done.
+func newTimeSource(ctx context.Context) util.TimeSource {
+	if len(*ntpServerFlag) == 0 {
+		return util.SystemTimeSource{}
+	}
+
+	ts := util.NewTrustedTimeSource(util.SystemTimeSource{}, util.NewNTPOffsetSource(*ntpServerFlag, time.Second*5), *maxClockSkewFlag)
+	if err := ts.Refresh(); err != nil {
+		glog.Warningf("Initial clock check against %s failed: %v", *ntpServerFlag, err)
+	}
+	expvar.Publish("clock", ts.Vars())
+	go ts.Run(ctx, *clockCheckIntervalFlag)
+	return ts
+}
+
+// serverCredentials returns the server options to serve RPCs over TLS if a certificate is
+// configured. The certificate is reloaded when its files change until ctx is done. Client
+// certificates are verified if a CA file is configured, but clients needn't send one.
+func serverCredentials(ctx context.Context) ([]grpc.ServerOption, error) {
+	if len(*tlsCertFileFlag) == 0 {
+		if len(*tlsClientCAFileFlag) > 0 {
+			return nil, fmt.Errorf("--tls_client_ca_file needs --tls_cert_file")
+		}
+		return nil, nil
+	}
+
+	r, err := util.NewCertReloader(*tlsCertFileFlag, *tlsKeyFileFlag)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{GetCertificate: r.GetCertificate}
+	if len(*tlsClientCAFileFlag) > 0 {
+		pem, err := ioutil.ReadFile(*tlsClientCAFileFlag)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", *tlsClientCAFileFlag)
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	expvar.Publish("tls", r.Vars())
+	go r.Run(ctx, *tlsReloadIntervalFlag)
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(config))}, nil
+}
+
+func startRPCServer(listener net.Listener, port int, registry extension.Registry, timeSource util.TimeSource, timeouts util.ServerTimeouts, leafTracker *server.LeafTracker, authorizer *server.Authorizer, selfChecker *server.SelfChecker, opts ...grpc.ServerOption) *grpc.Server {
 	// Create and publish the RPC stats objects
 	statsInterceptor := monitoring.NewRPCStatsInterceptor(util.SystemTimeSource{}, "ct", "example")
 	statsInterceptor.Publish()
 
-	// Create the server, using the interceptor to record stats on the requests
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(statsInterceptor.Interceptor()))
+	// Create the server, using the interceptors to record stats on the requests, pick up
+	// request IDs sent by clients, check callers are allowed to make them, reject those for
+	// logs that failed their self check and limit how long each request can run for
+	interceptors := []grpc.UnaryServerInterceptor{statsInterceptor.Interceptor(), util.RequestIDServerInterceptor(), util.TraceServerInterceptor()}
+	if authorizer != nil {
+		interceptors = append(interceptors, authorizer.Interceptor())
+	}
+	if selfChecker != nil {
+		interceptors = append(interceptors, selfChecker.Interceptor())
+	}
+	interceptors = append(interceptors, util.TimeoutServerInterceptor(timeouts, expvar.NewMap("rpc-server-timeouts")))
+	opts = append(opts, grpc.ChainUnaryInterceptor(interceptors...))
+	grpcServer := grpc.NewServer(opts...)
+	registerServers(grpcServer, registry, timeSource, leafTracker, authorizer)
+	return grpcServer
+}
 
-	logServer := server.NewTrillianLogRPCServer(registry, new(util.SystemTimeSource))
+// registerServers registers the log server with grpcServer, and the admin server if there
+// is an authorizer. Without one nothing checks who changes a tree's ACL, so anyone could
+// grant themselves access that takes effect once ACLs are turned on.
+func registerServers(grpcServer *grpc.Server, registry extension.Registry, timeSource util.TimeSource, leafTracker *server.LeafTracker, authorizer *server.Authorizer) {
+	logServer := server.NewTrillianLogRPCServer(registry, timeSource)
+	if leafTracker != nil {
+		logServer.SetLeafTracker(leafTracker)
+	}
 	trillian.RegisterTrillianLogServer(grpcServer, logServer)
 
-	return grpcServer
+	if authorizer != nil {
+		adminServer := server.NewTrillianAdminServer(registry)
+		adminServer.SetAuthorizer(authorizer)
+		trillian.RegisterTrillianAdminServer(grpcServer, adminServer)
+	}
 }
 
 func startHTTPServer(port int) error {
@@ -100,6 +202,9 @@ func awaitSignal(rpcServer *grpc.Server) {
 
 func main() {
 	flag.Parse()
+	if err := util.ApplyConfig(flag.CommandLine, "config", "TRILLIAN_", os.Getenv); err != nil {
+		glog.Fatalf("Invalid configuration: %v", err)
+	}
 	glog.CopyStandardLogTo("WARNING")
 	glog.Info("**** Log RPC Server Starting ****")
 
@@ -114,6 +219,20 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Check the stored state of every log before serving any of them
+	var selfChecker *server.SelfChecker
+	if *selfCheckFlag {
+		selfChecker = server.NewSelfChecker(registry, *selfCheckSamplesFlag)
+		selfChecker.Publish()
+		failed, err := selfChecker.CheckAll(context.Background())
+		if err != nil {
+			glog.Fatalf("Failed to run self check: %v", err)
+		}
+		if len(failed) > 0 {
+			glog.Errorf("Logs %v failed their self check and won't be served", failed)
+		}
+	}
+
 	// Load up our private key, exit if this fails to work
 	// TODO(Martin2112): This will need to be changed for multi tenant as we'll need at
 	// least one key per tenant, possibly more.
@@ -146,13 +265,66 @@ func main() {
 	// both sequencing and signing.
 	// TODO(Martin2112): Should respect read only mode and the flags in tree control etc
 	ctx, cancel := context.WithCancel(context.Background())
+	timeSource := newTimeSource(ctx)
+
+	treeSizeLimits, err := server.ParseTreeSizeLimits(*treeSizeLimitsFlag)
+	if err != nil {
+		glog.Fatalf("Invalid --tree_size_limits: %v", err)
+	}
+	treeCapacity := server.NewTreeCapacity(treeSizeLimits, *treeSizeWarnFractionFlag)
+	treeCapacity.Publish()
 
 	sequencerManager := server.NewSequencerManager(keyManager, registry, *sequencerGuardWindowFlag)
-	sequencerTask := server.NewLogOperationManager(ctx, registry, *batchSizeFlag, *sequencerSleepBetweenRunsFlag, *signerIntervalFlag, util.SystemTimeSource{}, sequencerManager)
-	go sequencerTask.OperationLoop()
+	sequencerManager.SetTreeCapacity(treeCapacity)
+	sequencerManager.SetPipelineBatches(*sequencerPipelineBatchesFlag)
+	if selfChecker != nil {
+		sequencerManager.SetSelfChecker(selfChecker)
+	}
+	var leafTracker *server.LeafTracker
+	if *maxTrackedLeavesFlag > 0 {
+		leafTracker = server.NewLeafTracker(timeSource, *maxTrackedLeavesFlag)
+		leafTracker.SetRegistry(registry)
+		leafTracker.Publish()
+		http.Handle("/debug/leaf", leafTracker)
+		sequencerManager.SetLeafTracker(leafTracker)
+	}
+	sequencerTask := server.NewLogOperationManager(ctx, registry, *batchSizeFlag, *sequencerSleepBetweenRunsFlag, *signerIntervalFlag, timeSource, sequencerManager)
+	var operations sync.WaitGroup
+	operations.Add(1)
+	go func() {
+		defer operations.Done()
+		sequencerTask.OperationLoop()
+	}()
+
+	if *leafIndexCheckIntervalFlag > 0 {
+		leafIndexChecker := server.NewLeafIndexChecker()
+		leafIndexChecker.Publish()
+		leafIndexCheckTask := server.NewLogOperationManager(ctx, registry, *leafIndexCheckBatchSizeFlag, *leafIndexCheckIntervalFlag, *signerIntervalFlag, timeSource, leafIndexChecker)
+		operations.Add(1)
+		go func() {
+			defer operations.Done()
+			leafIndexCheckTask.OperationLoop()
+		}()
+	}
 
 	// Bring up the RPC server and then block until we get a signal to stop
-	rpcServer := startRPCServer(lis, *serverPortFlag, registry)
+	timeouts, err := util.ParseServerTimeouts(*rpcServerTimeoutFlag, *rpcMethodTimeoutsFlag)
+	if err != nil {
+		glog.Fatalf("Invalid --rpc_method_timeouts: %v", err)
+	}
+	creds, err := serverCredentials(ctx)
+	if err != nil {
+		glog.Fatalf("Failed to load TLS certificate: %v", err)
+	}
+	var authorizer *server.Authorizer
+	if *treeACLsFlag {
+		if len(*tlsClientCAFileFlag) == 0 {
+			glog.Warningf("--tree_acls is set without --tls_client_ca_file, so every caller is anonymous")
+		}
+		authorizer = server.NewAuthorizer(server.RegistryTreeACLs(registry), server.ParsePrincipals(*adminPrincipalsFlag), *treeACLCacheTTLFlag, util.SystemTimeSource{})
+		authorizer.Publish()
+	}
+	rpcServer := startRPCServer(lis, *serverPortFlag, registry, timeSource, timeouts, leafTracker, authorizer, selfChecker, creds...)
 	go awaitSignal(rpcServer)
 	err = rpcServer.Serve(lis)
 
@@ -164,8 +336,28 @@ func main() {
 	// Shut down everything we previously started, rpc server is already down
 	cancel()
 
-	// Give things a few seconds to tidy up
-	glog.Infof("Stopping server, about to exit")
+	// Let any sequencing batch in progress finish committing, a batch killed part way
+	// through is rolled back by storage and sequenced again on restart.
+	glog.Infof("Stopping server, waiting up to %v for log operations to finish", *shutdownTimeoutFlag)
+	if waitGroupTimeout(&operations, *shutdownTimeoutFlag) {
+		glog.Infof("Log operations finished, about to exit")
+	} else {
+		glog.Warningf("Log operations still running after %v, exiting anyway", *shutdownTimeoutFlag)
+	}
 	glog.Flush()
-	time.Sleep(time.Second * 5)
+}
+
+// waitGroupTimeout waits for wg for up to timeout, and returns whether it finished.
+func waitGroupTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/trillian/server"
+	"github.com/google/trillian/storage/memory"
+	"github.com/google/trillian/util"
+	"google.golang.org/grpc"
+)
+
+func TestRegisterServersAdminNeedsACLs(t *testing.T) {
+	registry := memory.NewStorage()
+	var tests = []struct {
+		descr      string
+		authorizer *server.Authorizer
+		wantAdmin  bool
+	}{
+		{descr: "no-acls"},
+		{descr: "acls", authorizer: server.NewAuthorizer(server.RegistryTreeACLs(registry), nil, time.Minute, util.SystemTimeSource{}), wantAdmin: true},
+	}
+
+	for _, test := range tests {
+		grpcServer := grpc.NewServer()
+		registerServers(grpcServer, registry, util.SystemTimeSource{}, nil, test.authorizer)
+		services := grpcServer.GetServiceInfo()
+		if _, ok := services["trillian.TrillianLog"]; !ok {
+			t.Errorf("%s: TrillianLog not registered", test.descr)
+		}
+		if _, got := services["trillian.TrillianAdmin"]; got != test.wantAdmin {
+			t.Errorf("%s: TrillianAdmin registered=%v, want %v", test.descr, got, test.wantAdmin)
+		}
+	}
+}
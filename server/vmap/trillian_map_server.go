@@ -34,7 +34,9 @@ func (t *TrillianMapServer) getHasherForMap(mapID int64) (merkle.MapHasher, erro
 	return merkle.NewMapHasher(merkle.NewRFC6962TreeHasher(crypto.NewSHA256())), nil
 }
 
-// GetLeaves implements the GetLeaves RPC method.
+// GetLeaves implements the GetLeaves RPC method. Every requested key is returned with
+// a proof: keys that aren't in the map have an empty leaf value, and the proof shows
+// that.
 func (t *TrillianMapServer) GetLeaves(ctx context.Context, req *trillian.GetMapLeavesRequest) (resp *trillian.GetMapLeavesResponse, err error) {
 	ctx = util.NewMapContext(ctx, req.MapId)
 	s, err := t.registry.GetMapStorage(req.MapId)
@@ -72,8 +74,10 @@ func (t *TrillianMapServer) GetLeaves(ctx context.Context, req *trillian.GetMapL
 
 	smtReader := merkle.NewSparseMerkleTreeReader(req.Revision, kh, tx)
 
+	// The root the proofs are for is only returned for the latest revision.
 	resp = &trillian.GetMapLeavesResponse{
 		KeyValue: make([]*trillian.KeyValueInclusion, 0, len(req.Key)),
+		MapRoot:  root,
 	}
 
 	keyHashes := make([][]byte, 0, len(req.Key))
@@ -91,13 +95,23 @@ func (t *TrillianMapServer) GetLeaves(ctx context.Context, req *trillian.GetMapL
 
 	glog.Infof("%s: wanted %d leaves, found %d", util.MapIDPrefix(ctx), len(req.Key), len(leaves))
 
+	found := make(map[string]*trillian.MapLeaf)
 	for _, leaf := range leaves {
 		leaf := leaf
-		key, ok := hashToKey[string(leaf.KeyHash)]
-		if !ok {
+		if _, ok := hashToKey[string(leaf.KeyHash)]; !ok {
 			glog.Warningf("%s: Retrieved unrequested leaf with keyhash: %v, skipping", util.MapIDPrefix(ctx), leaf.KeyHash)
 			continue
 		}
+		found[string(leaf.KeyHash)] = &leaf
+	}
+
+	// Keys that aren't in the map are returned with an empty leaf, and their proof is
+	// one of non-inclusion: it shows the empty leaf is at the key's position.
+	for i, key := range req.Key {
+		leaf, ok := found[string(keyHashes[i])]
+		if !ok {
+			leaf = &trillian.MapLeaf{KeyHash: keyHashes[i]}
+		}
 		proof, err := smtReader.InclusionProof(req.Revision, key)
 		if err != nil {
 			return nil, err
@@ -105,7 +119,7 @@ func (t *TrillianMapServer) GetLeaves(ctx context.Context, req *trillian.GetMapL
 		kvi := trillian.KeyValueInclusion{
 			KeyValue: &trillian.KeyValue{
 				Key:   key,
-				Value: &leaf,
+				Value: leaf,
 			},
 			Inclusion: make([][]byte, 0, len(proof)),
 		}
@@ -19,9 +19,11 @@ import (
 	"github.com/google/trillian/extension"
 	"github.com/google/trillian/extension/builtin"
 	"github.com/google/trillian/server/vmap"
+	"github.com/google/trillian/util"
 	"google.golang.org/grpc"
 )
 
+var configFileFlag = flag.String("config", "", "If set, JSON file holding settings for any of the other flags, keyed by flag name. Each flag may also be set by an environment variable named TRILLIAN_ and the flag name in upper case, e.g. TRILLIAN_MYSQL_URI. Flags given on the command line take precedence over the environment, which takes precedence over the file")
 var serverPortFlag = flag.Int("port", 8090, "Port to serve log RPC requests on")
 var exportRPCMetrics = flag.Bool("exportMetrics", true, "If true starts HTTP server and exports stats")
 var httpPortFlag = flag.Int("http_port", 8091, "Port to serve HTTP metrics on")
@@ -89,6 +91,9 @@ func awaitSignal(rpcServer *grpc.Server) {
 
 func main() {
 	flag.Parse()
+	if err := util.ApplyConfig(flag.CommandLine, "config", "TRILLIAN_", os.Getenv); err != nil {
+		glog.Fatalf("Invalid configuration: %v", err)
+	}
 	glog.CopyStandardLogTo("WARNING")
 	glog.Info("**** Map RPC Server Starting ****")
 
@@ -11,6 +11,8 @@ type ReadOnlyLogTX interface {
 	ReadOnlyTreeTX
 	LeafReader
 	LogRootReader
+	CompactRangeReader
+	LeafQueueReader
 }
 
 // LogTX is the transactional interface for reading/updating a Log.
@@ -21,8 +23,11 @@ type LogTX interface {
 	TreeTX
 	LogRootReader
 	LogRootWriter
+	CompactRangeReader
+	CompactRangeWriter
 	LeafReader
 	LeafQueuer
+	LeafQueueReader
 	LeafDequeuer
 	LogMetadata
 }
@@ -50,6 +55,8 @@ type LogStorage interface {
 // LeafQueuer provides a write-only interface for the queueing (but not necesarily integration) of leaves.
 type LeafQueuer interface {
 	// QueueLeaves enqueues leaves for later integration into the tree.
+	// It returns ErrDuplicateLeafIdentity if a leaf's identity hash belongs to a different
+	// leaf already in the log.
 	QueueLeaves(leaves []trillian.LogLeaf, queueTimestamp time.Time) error
 }
 
@@ -59,10 +66,41 @@ type LeafDequeuer interface {
 	// Leaves which have been dequeued within a Rolled-back Tx will become available for dequeing again.
 	// Leaves queued more recently than the cutoff time will not be returned. This allows for
 	// guard intervals to be configured.
+	// Leaves are returned in order of their merge deadline, so that when there's a backlog
+	// the leaves that are most overdue are integrated first. Leaves queued without a deadline
+	// are treated as due when they were queued. The returned leaves have their deadline set.
 	DequeueLeaves(limit int, cutoffTime time.Time) ([]trillian.LogLeaf, error)
+	// DequeuePeekedLeaves removes exactly the given leaves, as returned by PeekLeaves, from
+	// the queue, whatever else has been queued since. It fails if any of them is no longer
+	// queued. As with DequeueLeaves, they stay queued if the transaction is rolled back.
+	DequeuePeekedLeaves(leaves []QueuedLeaf) error
 	UpdateSequencedLeaves([]trillian.LogLeaf) error
 }
 
+// QueuedLeaf is a leaf waiting in the queue to be integrated.
+type QueuedLeaf struct {
+	trillian.LogLeaf
+	// QueueID tells the entry apart from others queued with the same leaf value, when the
+	// log allows duplicates. Its contents are up to the storage implementation.
+	QueueID []byte
+	// QueueTimestamp is when the leaf was queued.
+	QueueTimestamp time.Time
+}
+
+// LeafQueueReader provides a read only view of the leaves waiting to be integrated.
+type LeafQueueReader interface {
+	// PeekLeaves returns between [0, limit] leaves from the queue, the same ones that
+	// DequeueLeaves would return, but leaves them in the queue. Leaves queued more recently
+	// than the cutoff time will not be returned.
+	PeekLeaves(limit int, cutoffTime time.Time) ([]QueuedLeaf, error)
+	// GetQueuedLeavesByHash returns the leaves waiting in the queue that have one of the
+	// given Merkle leaf hashes, whatever their queue time.
+	GetQueuedLeavesByHash(merkleLeafHashes [][]byte) ([]QueuedLeaf, error)
+	// GetQueuedLeavesByCorrelationID returns the leaves waiting in the queue that were
+	// queued under correlationID.
+	GetQueuedLeavesByCorrelationID(correlationID string) ([]QueuedLeaf, error)
+}
+
 // LeafReader provides a read only interface to stored tree leaves
 type LeafReader interface {
 	// GetSequencedLeafCount returns the total number of leaves that have been integrated into the
@@ -80,12 +118,22 @@ type LeafReader interface {
 	// same hash but different sequence numbers. If orderBySequence is true then the returned data
 	// will be in ascending sequence number order.
 	GetLeavesByLeafValueHash(leafHashes [][]byte, orderBySequence bool) ([]trillian.LogLeaf, error)
+	// GetLeavesByIdentityHash looks up queued or sequenced leaves by the identity hash they
+	// were queued with. The returned leaves have their value, extra data and value and
+	// identity hashes set, but not their Merkle leaf hash or index.
+	GetLeavesByIdentityHash(identityHashes [][]byte) ([]trillian.LogLeaf, error)
 }
 
 // LogRootReader provides an interface for reading SignedLogRoots.
 type LogRootReader interface {
 	// LatestSignedLogRoot returns the most recent SignedLogRoot, if any.
 	LatestSignedLogRoot() (trillian.SignedLogRoot, error)
+	// SignedLogRootByTimestamp returns the earliest SignedLogRoot whose timestamp is at or
+	// after timestampNanos, or an empty one if the log hasn't signed a root since then.
+	SignedLogRootByTimestamp(timestampNanos int64) (trillian.SignedLogRoot, error)
+	// SignedLogRootBySize returns the earliest SignedLogRoot for a tree of treeSize leaves,
+	// or an empty one if the log hasn't signed a root for that size.
+	SignedLogRootBySize(treeSize int64) (trillian.SignedLogRoot, error)
 }
 
 // LogRootWriter provides an interface for storing new SignedLogRoots.
@@ -94,6 +142,21 @@ type LogRootWriter interface {
 	StoreSignedLogRoot(root trillian.SignedLogRoot) error
 }
 
+// CompactRangeReader provides access to the compact ranges stored alongside tree heads.
+type CompactRangeReader interface {
+	// GetCompactRange returns the hashes of the compact range of the tree at treeSize, indexed
+	// by level as for merkle.CompactMerkleTree.Hashes, or nil if none was stored for that size.
+	GetCompactRange(treeSize int64) ([][]byte, error)
+}
+
+// CompactRangeWriter provides an interface for storing the compact range of a tree head,
+// so that proofs involving it don't need to read the historical nodes it summarizes.
+type CompactRangeWriter interface {
+	// StoreCompactRange stores the compact range of the tree at treeSize. The range only
+	// depends on the leaves, so storing one for a size that already has one isn't an error.
+	StoreCompactRange(treeSize int64, hashes [][]byte) error
+}
+
 // LogMetadata provides access to information about the logs in storage
 type LogMetadata interface {
 	// GetActiveLogs returns a list of the IDs of all the logs that are configured in storage
@@ -0,0 +1,805 @@
+package memory
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/storage"
+)
+
+type logRoot struct {
+	version int64
+	root    trillian.SignedLogRoot
+}
+
+// compactRange is the compact range of the tree at a size, as committed at a version.
+type compactRange struct {
+	version int64
+	hashes  [][]byte
+}
+
+// leafData is the data of a leaf, keyed by its leaf value hash. If the log allows
+// duplicates all the copies share it.
+type leafData struct {
+	version      int64
+	value        []byte
+	extraData    []byte
+	identityHash []byte
+}
+
+type sequencedLeaf struct {
+	version        int64
+	leafValueHash  []byte
+	merkleLeafHash []byte
+}
+
+// sequencedCount is the number of sequenced leaves there were at a version.
+type sequencedCount struct {
+	version int64
+	count   int64
+}
+
+type queuedLeaf struct {
+	version int64
+	id      int64
+	// leaf holds the hashes, value, merge deadline and correlation ID of the queued leaf.
+	leaf                trillian.LogLeaf
+	queueTimestampNanos int64
+}
+
+type logStorage struct {
+	s *Storage
+	t *tree
+}
+
+// GetLogStorage returns the storage for a log, creating the log if it doesn't exist. It
+// fails if the tree is a map.
+func (s *Storage) GetLogStorage(treeID int64) (storage.LogStorage, error) {
+	t, err := s.getTree(treeID, false)
+	if err != nil {
+		return nil, err
+	}
+	return &logStorage{s: s, t: t}, nil
+}
+
+func (m *logStorage) Begin() (storage.LogTX, error) {
+	// Reject attempts to start a writable transaction in read only mode. Anything that
+	// doesn't write is a part of Snapshot so is still available via that API.
+	if m.t.opts.ReadOnly {
+		return nil, storage.ErrReadOnly
+	}
+	return m.begin(true), nil
+}
+
+func (m *logStorage) Snapshot() (storage.ReadOnlyLogTX, error) {
+	return m.begin(false), nil
+}
+
+func (m *logStorage) begin(write bool) *logTX {
+	tx := &logTX{
+		treeTX:        newTreeTX(m.t, write),
+		ls:            m,
+		compactRanges: make(map[int64][][]byte),
+		leafData:      make(map[string]leafData),
+		dequeued:      make(map[int64]bool),
+	}
+	if write {
+		root, _ := tx.LatestSignedLogRoot()
+		tx.writeRevision = root.TreeRevision + 1
+	}
+	return tx
+}
+
+// logTX is a log transaction. Reads see the tree as it was when the transaction started
+// together with the transaction's own writes.
+type logTX struct {
+	treeTX
+	ls *logStorage
+
+	// These are written to the tree when the transaction commits.
+	roots         []trillian.SignedLogRoot
+	compactRanges map[int64][][]byte
+	leafData      map[string]leafData
+	queued        []queuedLeaf
+	dequeued      map[int64]bool
+	sequenced     []trillian.LogLeaf
+}
+
+func (t *logTX) checkWrite() error {
+	if t.closed {
+		return errTXClosed
+	}
+	if !t.write {
+		return storage.ErrReadOnly
+	}
+	return nil
+}
+
+// allRoots returns all the tree heads visible to the transaction. t.t.mu must be held.
+func (t *logTX) allRoots() []trillian.SignedLogRoot {
+	var roots []trillian.SignedLogRoot
+	for _, r := range t.t.logRoots {
+		if r.version <= t.version {
+			roots = append(roots, r.root)
+		}
+	}
+	return append(roots, t.roots...)
+}
+
+func (t *logTX) LatestSignedLogRoot() (trillian.SignedLogRoot, error) {
+	if t.closed {
+		return trillian.SignedLogRoot{}, errTXClosed
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	// It's possible there are no roots for this tree yet
+	var latest trillian.SignedLogRoot
+	found := false
+	for _, r := range t.allRoots() {
+		if !found || r.TimestampNanos > latest.TimestampNanos {
+			latest = r
+			found = true
+		}
+	}
+	if found {
+		latest.LogId = t.t.id
+	}
+	return latest, nil
+}
+
+func (t *logTX) SignedLogRootByTimestamp(timestampNanos int64) (trillian.SignedLogRoot, error) {
+	if t.closed {
+		return trillian.SignedLogRoot{}, errTXClosed
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	var earliest trillian.SignedLogRoot
+	found := false
+	for _, r := range t.allRoots() {
+		if r.TimestampNanos >= timestampNanos && (!found || r.TimestampNanos < earliest.TimestampNanos) {
+			earliest = r
+			found = true
+		}
+	}
+	if found {
+		earliest.LogId = t.t.id
+	}
+	return earliest, nil
+}
+
+func (t *logTX) SignedLogRootBySize(treeSize int64) (trillian.SignedLogRoot, error) {
+	if t.closed {
+		return trillian.SignedLogRoot{}, errTXClosed
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	var earliest trillian.SignedLogRoot
+	found := false
+	for _, r := range t.allRoots() {
+		if r.TreeSize == treeSize && (!found || r.TimestampNanos < earliest.TimestampNanos) {
+			earliest = r
+			found = true
+		}
+	}
+	if found {
+		earliest.LogId = t.t.id
+	}
+	return earliest, nil
+}
+
+func (t *logTX) StoreSignedLogRoot(root trillian.SignedLogRoot) error {
+	if err := t.checkWrite(); err != nil {
+		return err
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	for _, r := range t.allRoots() {
+		if r.TimestampNanos == root.TimestampNanos {
+			return fmt.Errorf("tree head with timestamp %d already exists", root.TimestampNanos)
+		}
+		if r.TreeRevision == root.TreeRevision {
+			return fmt.Errorf("tree head with revision %d already exists", root.TreeRevision)
+		}
+	}
+	t.roots = append(t.roots, root)
+	return nil
+}
+
+func (t *logTX) GetCompactRange(treeSize int64) ([][]byte, error) {
+	if t.closed {
+		return nil, errTXClosed
+	}
+	if hashes, ok := t.compactRanges[treeSize]; ok {
+		return copyHashes(hashes), nil
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+	if r, ok := t.t.compactRanges[treeSize]; ok && r.version <= t.version {
+		return copyHashes(r.hashes), nil
+	}
+	return nil, nil
+}
+
+func (t *logTX) StoreCompactRange(treeSize int64, hashes [][]byte) error {
+	if err := t.checkWrite(); err != nil {
+		return err
+	}
+	if treeSize <= 0 {
+		return fmt.Errorf("invalid tree size: %d", treeSize)
+	}
+	t.compactRanges[treeSize] = copyHashes(hashes)
+	return nil
+}
+
+func copyHashes(hashes [][]byte) [][]byte {
+	if hashes == nil {
+		return nil
+	}
+	ret := make([][]byte, len(hashes))
+	for i, h := range hashes {
+		ret[i] = copyBytes(h)
+	}
+	return ret
+}
+
+// GetTreeRevisionAtSize returns the max node version for a tree at a particular size.
+// It is an error to request tree sizes larger than the currently published tree size.
+// As for the MySQL storage, this only works for sizes where there is a stored tree head.
+func (t *logTX) GetTreeRevisionAtSize(treeSize int64) (int64, error) {
+	// Negative size is not sensible and a zero sized tree has no nodes so no revisions
+	if treeSize <= 0 {
+		return 0, fmt.Errorf("Invalid tree size: %d", treeSize)
+	}
+	if t.closed {
+		return 0, errTXClosed
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	revision := int64(-1)
+	for _, r := range t.allRoots() {
+		if r.TreeSize == treeSize && r.TreeRevision > revision {
+			revision = r.TreeRevision
+		}
+	}
+	if revision < 0 {
+		return 0, fmt.Errorf("no tree head for tree size %d", treeSize)
+	}
+	return revision, nil
+}
+
+func (t *logTX) QueueLeaves(leaves []trillian.LogLeaf, queueTimestamp time.Time) error {
+	if err := t.checkWrite(); err != nil {
+		return err
+	}
+
+	// Don't accept batches if any of the leaves are invalid.
+	for _, leaf := range leaves {
+		if len(leaf.LeafValueHash) != t.t.hashSizeBytes {
+			return fmt.Errorf("queued leaf must have a hash of length %d", t.t.hashSizeBytes)
+		}
+
+		// Validate the hash as a consistency check that the data was received OK. Note: at
+		// this stage it is not a Merkle tree hash for the leaf.
+		if got, want := crypto.NewSHA256().Digest(leaf.LeafValue), leaf.LeafValueHash; !bytes.Equal(got, want) {
+			return fmt.Errorf("leaf value / data hash mismatch got: %v, want: %v", got, want)
+		}
+	}
+
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	// The batch is added to the transaction only if all of it can be, so a failed call
+	// leaves nothing behind.
+	data := make(map[string]leafData)
+	queued := make([]queuedLeaf, 0, len(leaves))
+	for i, leaf := range leaves {
+		key := string(leaf.LeafValueHash)
+		_, committed := t.t.leafData[key]
+		_, pending := t.leafData[key]
+		_, inBatch := data[key]
+		exists := committed || pending || inBatch
+
+		// If the log does not allow duplicates we prevent the queueing of such a leaf from
+		// succeeding. If duplicates are allowed multiple sequenced leaves share the data
+		// of the first copy.
+		if exists && !t.t.opts.AllowDuplicates {
+			return fmt.Errorf("LeafData: %d, duplicate leaf value hash %x", i, leaf.LeafValueHash)
+		}
+		if len(leaf.LeafIdentityHash) > 0 && t.identityHashTaken(leaf.LeafIdentityHash, key, data) {
+			return storage.ErrDuplicateLeafIdentity
+		}
+		if !exists {
+			data[key] = leafData{value: copyBytes(leaf.LeafValue), extraData: copyBytes(leaf.ExtraData), identityHash: copyBytes(leaf.LeafIdentityHash)}
+		}
+
+		// Leaves without a deadline are due as soon as they're queued.
+		mergeDeadline := leaf.MergeDeadlineNanos
+		if mergeDeadline == 0 {
+			mergeDeadline = queueTimestamp.UnixNano()
+		}
+		queued = append(queued, queuedLeaf{
+			leaf: trillian.LogLeaf{
+				LeafValueHash:      copyBytes(leaf.LeafValueHash),
+				MerkleLeafHash:     copyBytes(leaf.MerkleLeafHash),
+				LeafValue:          copyBytes(leaf.LeafValue),
+				MergeDeadlineNanos: mergeDeadline,
+				CorrelationId:      leaf.CorrelationId,
+			},
+			queueTimestampNanos: queueTimestamp.UnixNano(),
+		})
+	}
+
+	for k, v := range data {
+		t.leafData[k] = v
+	}
+	t.queued = append(t.queued, queued...)
+	return nil
+}
+
+// byMergeDeadline orders queued leaves the way they're dequeued.
+type byMergeDeadline []queuedLeaf
+
+func (q byMergeDeadline) Len() int      { return len(q) }
+func (q byMergeDeadline) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q byMergeDeadline) Less(i, j int) bool {
+	if q[i].leaf.MergeDeadlineNanos != q[j].leaf.MergeDeadlineNanos {
+		return q[i].leaf.MergeDeadlineNanos < q[j].leaf.MergeDeadlineNanos
+	}
+	if q[i].queueTimestampNanos != q[j].queueTimestampNanos {
+		return q[i].queueTimestampNanos < q[j].queueTimestampNanos
+	}
+	return bytes.Compare(q[i].leaf.LeafValueHash, q[j].leaf.LeafValueHash) < 0
+}
+
+// peek returns up to limit queued leaves, in the order they're dequeued. Leaves queued
+// by this transaction have an id of -1 and their index in t.queued as their version.
+func (t *logTX) peek(limit int, cutoffTime time.Time) ([]queuedLeaf, error) {
+	if t.closed {
+		return nil, errTXClosed
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	cutoff := cutoffTime.UnixNano()
+	var candidates []queuedLeaf
+	for id, q := range t.t.queue {
+		if q.version <= t.version && !t.dequeued[id] && q.queueTimestampNanos <= cutoff {
+			candidates = append(candidates, q)
+		}
+	}
+	for i, q := range t.queued {
+		if q.queueTimestampNanos <= cutoff {
+			q.id, q.version = -1, int64(i)
+			candidates = append(candidates, q)
+		}
+	}
+	sort.Sort(byMergeDeadline(candidates))
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates, nil
+}
+
+// PeekLeaves returns the queued leaves with their queue id, as 8 big-endian bytes, as their
+// QueueID. Leaves queued by this transaction don't have an id yet, so have no QueueID.
+func (t *logTX) PeekLeaves(limit int, cutoffTime time.Time) ([]storage.QueuedLeaf, error) {
+	queued, err := t.peek(limit, cutoffTime)
+	if err != nil {
+		return nil, err
+	}
+	leaves, err := t.queuedLeaves(queued)
+	if err != nil {
+		return nil, err
+	}
+	return toQueuedLeaves(queued, leaves), nil
+}
+
+// toQueuedLeaves returns leaves, the leaves of queued, with their queue IDs and times.
+func toQueuedLeaves(queued []queuedLeaf, leaves []trillian.LogLeaf) []storage.QueuedLeaf {
+	ret := make([]storage.QueuedLeaf, 0, len(leaves))
+	for i, leaf := range leaves {
+		q := storage.QueuedLeaf{LogLeaf: leaf, QueueTimestamp: time.Unix(0, queued[i].queueTimestampNanos)}
+		if id := queued[i].id; id >= 0 {
+			q.QueueID = make([]byte, 8)
+			binary.BigEndian.PutUint64(q.QueueID, uint64(id))
+		}
+		ret = append(ret, q)
+	}
+	return ret
+}
+
+// GetQueuedLeavesByHash returns the queued leaves with any of the Merkle leaf hashes.
+func (t *logTX) GetQueuedLeavesByHash(merkleLeafHashes [][]byte) ([]storage.QueuedLeaf, error) {
+	hashes := make(map[string]bool)
+	for _, hash := range merkleLeafHashes {
+		hashes[string(hash)] = true
+	}
+	return t.findQueued(func(leaf trillian.LogLeaf) bool {
+		return hashes[string(leaf.MerkleLeafHash)]
+	})
+}
+
+// GetQueuedLeavesByCorrelationID returns the queued leaves with the correlation ID.
+func (t *logTX) GetQueuedLeavesByCorrelationID(correlationID string) ([]storage.QueuedLeaf, error) {
+	return t.findQueued(func(leaf trillian.LogLeaf) bool {
+		return leaf.CorrelationId == correlationID
+	})
+}
+
+// findQueued returns the queued leaves that match, in the order they're dequeued, whatever
+// their queue time.
+func (t *logTX) findQueued(match func(trillian.LogLeaf) bool) ([]storage.QueuedLeaf, error) {
+	if t.closed {
+		return nil, errTXClosed
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	var found []queuedLeaf
+	for id, q := range t.t.queue {
+		if q.version <= t.version && !t.dequeued[id] && match(q.leaf) {
+			found = append(found, q)
+		}
+	}
+	for i, q := range t.queued {
+		if match(q.leaf) {
+			q.id, q.version = -1, int64(i)
+			found = append(found, q)
+		}
+	}
+	sort.Sort(byMergeDeadline(found))
+	leaves, err := t.queuedLeaves(found)
+	if err != nil {
+		return nil, err
+	}
+	return toQueuedLeaves(found, leaves), nil
+}
+
+func (t *logTX) DequeuePeekedLeaves(leaves []storage.QueuedLeaf) error {
+	if err := t.checkWrite(); err != nil {
+		return err
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	ids := make(map[int64]bool)
+	for _, leaf := range leaves {
+		if len(leaf.QueueID) != 8 {
+			return fmt.Errorf("leaf %x has no queue ID", leaf.LeafValueHash)
+		}
+		id := int64(binary.BigEndian.Uint64(leaf.QueueID))
+		q, ok := t.t.queue[id]
+		if !ok || q.version > t.version || t.dequeued[id] || ids[id] || !bytes.Equal(q.leaf.LeafValueHash, leaf.LeafValueHash) {
+			return fmt.Errorf("leaf %x is no longer queued", leaf.LeafValueHash)
+		}
+		ids[id] = true
+	}
+	for id := range ids {
+		t.dequeued[id] = true
+	}
+	return nil
+}
+
+// queuedLeaves returns the leaves that were queued.
+func (t *logTX) queuedLeaves(queued []queuedLeaf) ([]trillian.LogLeaf, error) {
+	leaves := make([]trillian.LogLeaf, 0, len(queued))
+	for _, q := range queued {
+		if len(q.leaf.LeafValueHash) != t.t.hashSizeBytes {
+			return nil, errors.New("Dequeued a leaf with incorrect hash size")
+		}
+		// Note: the ExtraData being nil here is OK as the sequencer only writes the
+		// sequenced leaf and the client supplied value is already held in the leaf data.
+		leaves = append(leaves, q.leaf)
+	}
+	return leaves, nil
+}
+
+func (t *logTX) DequeueLeaves(limit int, cutoffTime time.Time) ([]trillian.LogLeaf, error) {
+	if err := t.checkWrite(); err != nil {
+		return nil, err
+	}
+	queued, err := t.peek(limit, cutoffTime)
+	if err != nil {
+		return nil, err
+	}
+	leaves, err := t.queuedLeaves(queued)
+	if err != nil {
+		return nil, err
+	}
+
+	// The convention is that if leaf processing succeeds (by committing this tx)
+	// then the unsequenced entries for them are removed
+	var remove []int
+	for _, q := range queued {
+		if q.id < 0 {
+			remove = append(remove, int(q.version))
+		} else {
+			t.dequeued[q.id] = true
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(remove)))
+	for _, i := range remove {
+		t.queued = append(t.queued[:i], t.queued[i+1:]...)
+	}
+	return leaves, nil
+}
+
+func (t *logTX) UpdateSequencedLeaves(leaves []trillian.LogLeaf) error {
+	if err := t.checkWrite(); err != nil {
+		return err
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	pending := make(map[int64]bool)
+	for _, leaf := range t.sequenced {
+		pending[leaf.LeafIndex] = true
+	}
+	for _, leaf := range leaves {
+		// This should fail on insert but catch it early
+		if len(leaf.LeafValueHash) != t.t.hashSizeBytes {
+			return errors.New("Sequenced leaf has incorrect hash size")
+		}
+		if _, ok := t.t.sequenced[leaf.LeafIndex]; ok || pending[leaf.LeafIndex] {
+			return fmt.Errorf("leaf %d has already been sequenced", leaf.LeafIndex)
+		}
+		if _, ok := t.getLeafData(leaf.LeafValueHash); !ok {
+			return fmt.Errorf("no data for sequenced leaf %x", leaf.LeafValueHash)
+		}
+		pending[leaf.LeafIndex] = true
+	}
+
+	for _, leaf := range leaves {
+		t.sequenced = append(t.sequenced, trillian.LogLeaf{
+			LeafValueHash:  copyBytes(leaf.LeafValueHash),
+			MerkleLeafHash: copyBytes(leaf.MerkleLeafHash),
+			LeafIndex:      leaf.LeafIndex,
+		})
+	}
+	return nil
+}
+
+// getLeafData returns the data of a leaf visible to the transaction. t.t.mu must be held.
+func (t *logTX) getLeafData(leafValueHash []byte) (leafData, bool) {
+	if d, ok := t.leafData[string(leafValueHash)]; ok {
+		return d, true
+	}
+	d, ok := t.t.leafData[string(leafValueHash)]
+	if !ok || d.version > t.version {
+		return leafData{}, false
+	}
+	return d, true
+}
+
+// getSequenced returns the sequenced leaf at index, if it's visible to the transaction.
+// t.t.mu must be held.
+func (t *logTX) getSequenced(index int64) (trillian.LogLeaf, bool) {
+	s, ok := t.t.sequenced[index]
+	if ok && s.version <= t.version {
+		return t.withData(trillian.LogLeaf{LeafValueHash: s.leafValueHash, MerkleLeafHash: s.merkleLeafHash, LeafIndex: index})
+	}
+	for _, leaf := range t.sequenced {
+		if leaf.LeafIndex == index {
+			return t.withData(leaf)
+		}
+	}
+	return trillian.LogLeaf{}, false
+}
+
+// withData fills in the leaf's value and extra data. t.t.mu must be held.
+func (t *logTX) withData(leaf trillian.LogLeaf) (trillian.LogLeaf, bool) {
+	d, ok := t.getLeafData(leaf.LeafValueHash)
+	if !ok {
+		return trillian.LogLeaf{}, false
+	}
+	leaf.LeafValue = d.value
+	leaf.ExtraData = d.extraData
+	return leaf, true
+}
+
+func (t *logTX) GetSequencedLeafCount() (int64, error) {
+	if t.closed {
+		return 0, errTXClosed
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	counts := t.t.sequencedCounts
+	i := sort.Search(len(counts), func(i int) bool { return counts[i].version > t.version })
+	var count int64
+	if i > 0 {
+		count = counts[i-1].count
+	}
+	return count + int64(len(t.sequenced)), nil
+}
+
+func (t *logTX) GetLeavesByIndex(leaves []int64) ([]trillian.LogLeaf, error) {
+	if t.closed {
+		return nil, errTXClosed
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	ret := make([]trillian.LogLeaf, 0, len(leaves))
+	for _, index := range leaves {
+		if leaf, ok := t.getSequenced(index); ok {
+			ret = append(ret, leaf)
+		}
+	}
+	if len(ret) != len(leaves) {
+		return nil, fmt.Errorf("expected %d leaves, but saw %d", len(leaves), len(ret))
+	}
+	return ret, nil
+}
+
+func (t *logTX) GetLeavesByHash(leafHashes [][]byte, orderBySequence bool) ([]trillian.LogLeaf, error) {
+	return t.getLeavesByHash(leafHashes, orderBySequence, t.t.byMerkle, func(l trillian.LogLeaf) []byte { return l.MerkleLeafHash })
+}
+
+func (t *logTX) GetLeavesByLeafValueHash(leafHashes [][]byte, orderBySequence bool) ([]trillian.LogLeaf, error) {
+	return t.getLeavesByHash(leafHashes, orderBySequence, t.t.byValue, func(l trillian.LogLeaf) []byte { return l.LeafValueHash })
+}
+
+// identityHashTaken returns whether identityHash belongs to a leaf other than the one with
+// valueHash, either in the log, queued by this transaction or in batch. The caller must hold
+// t.t.mu.
+func (t *logTX) identityHashTaken(identityHash []byte, valueHash string, batch map[string]leafData) bool {
+	if k, ok := t.t.byIdentity[string(identityHash)]; ok {
+		return k != valueHash
+	}
+	for _, m := range []map[string]leafData{t.leafData, batch} {
+		for k, d := range m {
+			if bytes.Equal(d.identityHash, identityHash) && k != valueHash {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (t *logTX) GetLeavesByIdentityHash(identityHashes [][]byte) ([]trillian.LogLeaf, error) {
+	if t.closed {
+		return nil, errTXClosed
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	var ret []trillian.LogLeaf
+	for _, h := range identityHashes {
+		valueHash, ok := t.t.byIdentity[string(h)]
+		if !ok {
+			// The leaf might have been queued by this transaction.
+			for k, d := range t.leafData {
+				if bytes.Equal(d.identityHash, h) {
+					valueHash, ok = k, true
+					break
+				}
+			}
+		}
+		if !ok {
+			continue
+		}
+		if d, ok := t.getLeafData([]byte(valueHash)); ok {
+			ret = append(ret, trillian.LogLeaf{LeafValueHash: []byte(valueHash), LeafValue: d.value, ExtraData: d.extraData, LeafIdentityHash: d.identityHash})
+		}
+	}
+	return ret, nil
+}
+
+// byLeafIndex orders leaves by sequence number.
+type byLeafIndex []trillian.LogLeaf
+
+func (l byLeafIndex) Len() int           { return len(l) }
+func (l byLeafIndex) Less(i, j int) bool { return l[i].LeafIndex < l[j].LeafIndex }
+func (l byLeafIndex) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// getLeavesByHash looks up sequenced leaves with index, which maps hashes to sequence
+// numbers, and hash, which returns the same hash from the leaves sequenced by the
+// transaction.
+func (t *logTX) getLeavesByHash(leafHashes [][]byte, orderBySequence bool, index map[string][]int64, hash func(trillian.LogLeaf) []byte) ([]trillian.LogLeaf, error) {
+	if t.closed {
+		return nil, errTXClosed
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	// The tree could include duplicates so we don't know how many results will be returned
+	var ret []trillian.LogLeaf
+	for _, h := range leafHashes {
+		for _, seq := range index[string(h)] {
+			if leaf, ok := t.getSequenced(seq); ok {
+				ret = append(ret, leaf)
+			}
+		}
+		for _, leaf := range t.sequenced {
+			if !bytes.Equal(hash(leaf), h) {
+				continue
+			}
+			if leaf, ok := t.withData(leaf); ok {
+				ret = append(ret, leaf)
+			}
+		}
+	}
+	if orderBySequence {
+		sort.Sort(byLeafIndex(ret))
+	}
+	return ret, nil
+}
+
+// GetActiveLogIDs returns a list of the IDs of all configured logs
+func (t *logTX) GetActiveLogIDs() ([]int64, error) {
+	if t.closed {
+		return nil, errTXClosed
+	}
+	return t.ls.s.logIDs(func(*tree) bool { return true }), nil
+}
+
+// GetActiveLogIDsWithPendingWork returns a list of the IDs of all configured logs
+// that have queued unsequenced leaves that need to be integrated
+func (t *logTX) GetActiveLogIDsWithPendingWork() ([]int64, error) {
+	if t.closed {
+		return nil, errTXClosed
+	}
+	return t.ls.s.logIDs(func(log *tree) bool {
+		log.mu.RLock()
+		defer log.mu.RUnlock()
+		return len(log.queue) > 0
+	}), nil
+}
+
+func (t *logTX) Commit() error {
+	return t.commit(func(version int64) {
+		tr := t.t
+		for _, root := range t.roots {
+			tr.logRoots = append(tr.logRoots, logRoot{version: version, root: root})
+		}
+		for size, hashes := range t.compactRanges {
+			// The range for a size never changes, so keep the version it was first seen at.
+			if _, ok := tr.compactRanges[size]; !ok {
+				tr.compactRanges[size] = compactRange{version: version, hashes: hashes}
+			}
+		}
+		for k, d := range t.leafData {
+			d.version = version
+			tr.leafData[k] = d
+			if _, ok := tr.byIdentity[string(d.identityHash)]; len(d.identityHash) > 0 && !ok {
+				tr.byIdentity[string(d.identityHash)] = k
+			}
+		}
+		for id := range t.dequeued {
+			delete(tr.queue, id)
+		}
+		for _, q := range t.queued {
+			q.version = version
+			q.id = tr.nextQueued
+			tr.nextQueued++
+			tr.queue[q.id] = q
+		}
+		if len(t.sequenced) > 0 {
+			for _, leaf := range t.sequenced {
+				tr.sequenced[leaf.LeafIndex] = sequencedLeaf{version: version, leafValueHash: leaf.LeafValueHash, merkleLeafHash: leaf.MerkleLeafHash}
+				tr.byMerkle[string(leaf.MerkleLeafHash)] = append(tr.byMerkle[string(leaf.MerkleLeafHash)], leaf.LeafIndex)
+				tr.byValue[string(leaf.LeafValueHash)] = append(tr.byValue[string(leaf.LeafValueHash)], leaf.LeafIndex)
+			}
+			tr.sequencedCounts = append(tr.sequencedCounts, sequencedCount{version: version, count: int64(len(tr.sequenced))})
+		}
+	})
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,820 @@
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/log"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/testonly"
+	"github.com/google/trillian/util"
+	"golang.org/x/net/context"
+)
+
+var fakeQueueTime = time.Date(2016, 11, 10, 15, 16, 27, 0, time.UTC)
+
+func createTestLeaves(n, startSeq int64) []trillian.LogLeaf {
+	var leaves []trillian.LogLeaf
+	hasher := merkle.NewRFC6962TreeHasher(crypto.NewSHA256())
+
+	for l := int64(0); l < n; l++ {
+		lv := fmt.Sprintf("Leaf %d", l+startSeq)
+		leaf := trillian.LogLeaf{
+			LeafValueHash:  crypto.NewSHA256().Digest([]byte(lv)),
+			MerkleLeafHash: hasher.HashLeaf([]byte(lv)),
+			LeafValue:      []byte(lv),
+			ExtraData:      []byte(fmt.Sprintf("Extra %d", l)),
+			LeafIndex:      int64(startSeq + l),
+		}
+		leaves = append(leaves, leaf)
+	}
+
+	return leaves
+}
+
+func getLogStorage(t *testing.T, s *Storage, treeID int64) storage.LogStorage {
+	ls, err := s.GetLogStorage(treeID)
+	if err != nil {
+		t.Fatalf("GetLogStorage(%d)=_,%v, want no error", treeID, err)
+	}
+	return ls
+}
+
+func beginLogTx(t *testing.T, ls storage.LogStorage) storage.LogTX {
+	tx, err := ls.Begin()
+	if err != nil {
+		t.Fatalf("Begin()=_,%v, want no error", err)
+	}
+	return tx
+}
+
+func commit(t *testing.T, tx storage.ReadOnlyTreeTX) {
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit()=%v, want no error", err)
+	}
+}
+
+func queueLeaves(t *testing.T, ls storage.LogStorage, leaves []trillian.LogLeaf, queueTime time.Time) {
+	tx := beginLogTx(t, ls)
+	if err := tx.QueueLeaves(leaves, queueTime); err != nil {
+		t.Fatalf("QueueLeaves()=%v, want no error", err)
+	}
+	commit(t, tx)
+}
+
+func leafValues(leaves []trillian.LogLeaf) []string {
+	var values []string
+	for _, leaf := range leaves {
+		values = append(values, string(leaf.LeafValue))
+	}
+	return values
+}
+
+func TestDequeueLeavesOrdering(t *testing.T) {
+	ls := getLogStorage(t, NewStorage(), 1)
+
+	// Leaf 0 is queued first, but leaf 1 has an earlier deadline, and leaf 2 is too
+	// recent to be dequeued.
+	leaves := createTestLeaves(3, 0)
+	leaves[1].MergeDeadlineNanos = fakeQueueTime.Add(-time.Hour).UnixNano()
+	queueLeaves(t, ls, leaves[:2], fakeQueueTime)
+	queueLeaves(t, ls, leaves[2:], fakeQueueTime.Add(time.Minute))
+
+	tx := beginLogTx(t, ls)
+	dequeued, err := tx.DequeueLeaves(10, fakeQueueTime)
+	if err != nil {
+		t.Fatalf("DequeueLeaves()=_,%v, want no error", err)
+	}
+	if got, want := fmt.Sprint(leafValues(dequeued)), "[Leaf 1 Leaf 0]"; got != want {
+		t.Errorf("DequeueLeaves()=%s, want %s", got, want)
+	}
+	if got, want := dequeued[1].MergeDeadlineNanos, fakeQueueTime.UnixNano(); got != want {
+		t.Errorf("DequeueLeaves()[1].MergeDeadlineNanos=%d, want %d", got, want)
+	}
+	// The transaction doesn't see leaves again once it has dequeued them.
+	if again, err := tx.DequeueLeaves(10, fakeQueueTime); err != nil || len(again) != 0 {
+		t.Errorf("DequeueLeaves(again)=%v,%v, want [],nil", leafValues(again), err)
+	}
+	commit(t, tx)
+
+	tx = beginLogTx(t, ls)
+	defer tx.Rollback()
+	dequeued, err = tx.DequeueLeaves(10, fakeQueueTime.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("DequeueLeaves()=_,%v, want no error", err)
+	}
+	if got, want := fmt.Sprint(leafValues(dequeued)), "[Leaf 2]"; got != want {
+		t.Errorf("DequeueLeaves(after commit)=%s, want %s", got, want)
+	}
+}
+
+func TestDequeueLeavesRollback(t *testing.T) {
+	ls := getLogStorage(t, NewStorage(), 1)
+	queueLeaves(t, ls, createTestLeaves(2, 0), fakeQueueTime)
+
+	for _, want := range []int{2, 2} {
+		tx := beginLogTx(t, ls)
+		dequeued, err := tx.DequeueLeaves(10, fakeQueueTime)
+		if err != nil {
+			t.Fatalf("DequeueLeaves()=_,%v, want no error", err)
+		}
+		if got := len(dequeued); got != want {
+			t.Errorf("DequeueLeaves() returned %d leaves, want %d", got, want)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatalf("Rollback()=%v, want no error", err)
+		}
+	}
+}
+
+func TestDequeuePeekedLeaves(t *testing.T) {
+	s := NewStorage()
+	if err := s.CreateLog(1, TreeOptions{AllowDuplicates: true}); err != nil {
+		t.Fatalf("CreateLog()=%v, want no error", err)
+	}
+	ls := getLogStorage(t, s, 1)
+	leaves := createTestLeaves(2, 0)
+	queueLeaves(t, ls, leaves, fakeQueueTime)
+	queueLeaves(t, ls, leaves[1:], fakeQueueTime.Add(time.Second))
+
+	snap, err := ls.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot()=_,%v, want no error", err)
+	}
+	peeked, err := snap.PeekLeaves(2, fakeQueueTime.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("PeekLeaves()=_,%v, want no error", err)
+	}
+	commit(t, snap)
+	if got, want := len(peeked), 2; got != want {
+		t.Fatalf("PeekLeaves() returned %d leaves, want %d", got, want)
+	}
+
+	// A more urgent leaf queued after the peek doesn't get in the way.
+	urgent := createTestLeaves(1, 2)
+	urgent[0].MergeDeadlineNanos = fakeQueueTime.Add(-time.Hour).UnixNano()
+	queueLeaves(t, ls, urgent, fakeQueueTime)
+
+	tx := beginLogTx(t, ls)
+	if err := tx.DequeuePeekedLeaves(peeked); err != nil {
+		t.Fatalf("DequeuePeekedLeaves()=%v, want no error", err)
+	}
+	commit(t, tx)
+
+	// Only the peeked entries are gone, the duplicate of leaf 1 is still queued.
+	tx = beginLogTx(t, ls)
+	defer tx.Rollback()
+	dequeued, err := tx.DequeueLeaves(10, fakeQueueTime.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("DequeueLeaves()=_,%v, want no error", err)
+	}
+	if got, want := fmt.Sprint(leafValues(dequeued)), "[Leaf 2 Leaf 1]"; got != want {
+		t.Errorf("DequeueLeaves()=%s, want %s", got, want)
+	}
+	if err := tx.DequeuePeekedLeaves(peeked); err == nil {
+		t.Error("DequeuePeekedLeaves(already dequeued)=nil, want error")
+	}
+}
+
+func TestQueueLeavesDuplicates(t *testing.T) {
+	var tests = []struct {
+		allowDuplicates bool
+		wantErr         bool
+	}{
+		{allowDuplicates: false, wantErr: true},
+		{allowDuplicates: true},
+	}
+
+	for _, test := range tests {
+		s := NewStorage()
+		if err := s.CreateLog(1, TreeOptions{AllowDuplicates: test.allowDuplicates}); err != nil {
+			t.Fatalf("CreateLog()=%v, want no error", err)
+		}
+		ls := getLogStorage(t, s, 1)
+		leaves := createTestLeaves(1, 0)
+		queueLeaves(t, ls, leaves, fakeQueueTime)
+
+		tx := beginLogTx(t, ls)
+		err := tx.QueueLeaves(leaves, fakeQueueTime)
+		tx.Rollback()
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("QueueLeaves(duplicate, allowDuplicates=%v)=%v, want error: %v", test.allowDuplicates, err, test.wantErr)
+		}
+	}
+}
+
+func TestGetLeavesByIdentityHash(t *testing.T) {
+	ls := getLogStorage(t, NewStorage(), 1)
+	leaves := createTestLeaves(3, 0)
+	leaves[0].LeafIdentityHash = []byte("id0")
+	leaves[1].LeafIdentityHash = []byte("id1")
+	queueLeaves(t, ls, leaves[:2], fakeQueueTime)
+
+	// The transaction sees both committed leaves and those it has queued itself, but
+	// nothing for leaves queued without an identity hash.
+	tx := beginLogTx(t, ls)
+	defer tx.Rollback()
+	leaves[2].LeafIdentityHash = []byte("id2")
+	if err := tx.QueueLeaves(leaves[2:], fakeQueueTime); err != nil {
+		t.Fatalf("QueueLeaves()=%v, want no error", err)
+	}
+
+	var tests = []struct {
+		id   string
+		want []trillian.LogLeaf
+	}{
+		{id: "id0", want: leaves[:1]},
+		{id: "id2", want: leaves[2:]},
+		{id: "id3"},
+		{id: ""},
+	}
+	for _, test := range tests {
+		got, err := tx.GetLeavesByIdentityHash([][]byte{[]byte(test.id)})
+		if err != nil {
+			t.Fatalf("GetLeavesByIdentityHash(%q)=_,%v, want no error", test.id, err)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("GetLeavesByIdentityHash(%q)=%v, want %v", test.id, got, test.want)
+			continue
+		}
+		for i := range got {
+			want := test.want[i]
+			if !bytes.Equal(got[i].LeafValueHash, want.LeafValueHash) || !bytes.Equal(got[i].LeafValue, want.LeafValue) ||
+				!bytes.Equal(got[i].ExtraData, want.ExtraData) || !bytes.Equal(got[i].LeafIdentityHash, want.LeafIdentityHash) {
+				t.Errorf("GetLeavesByIdentityHash(%q)=%v, want %v", test.id, got[i], want)
+			}
+		}
+	}
+}
+
+func TestGetQueuedLeaves(t *testing.T) {
+	ls := getLogStorage(t, NewStorage(), 1)
+	leaves := createTestLeaves(4, 0)
+	leaves[0].CorrelationId = "req1"
+	leaves[1].CorrelationId = "req1"
+	leaves[2].CorrelationId = "req2"
+	for i := range leaves {
+		leaves[i].MergeDeadlineNanos = fakeQueueTime.Add(time.Duration(i) * time.Second).UnixNano()
+	}
+	queueLeaves(t, ls, leaves[:3], fakeQueueTime)
+	dequeueTime := fakeQueueTime.Add(time.Minute)
+	tx := beginLogTx(t, ls)
+	if _, err := tx.DequeueLeaves(1, dequeueTime); err != nil {
+		t.Fatalf("DequeueLeaves()=_,%v, want no error", err)
+	}
+	commit(t, tx)
+
+	// Leaves that have been dequeued aren't found, but those queued by the transaction
+	// are, however recently they were queued.
+	tx = beginLogTx(t, ls)
+	defer tx.Rollback()
+	leaves[3].CorrelationId = "req3"
+	if err := tx.QueueLeaves(leaves[3:], dequeueTime); err != nil {
+		t.Fatalf("QueueLeaves()=%v, want no error", err)
+	}
+
+	var tests = []struct {
+		id   string
+		want []trillian.LogLeaf
+	}{
+		{id: "req1", want: leaves[1:2]},
+		{id: "req2", want: leaves[2:3]},
+		{id: "req3", want: leaves[3:]},
+		{id: "req4"},
+	}
+	for _, test := range tests {
+		got, err := tx.GetQueuedLeavesByCorrelationID(test.id)
+		if err != nil {
+			t.Fatalf("GetQueuedLeavesByCorrelationID(%q)=_,%v, want no error", test.id, err)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("GetQueuedLeavesByCorrelationID(%q)=%v, want %v", test.id, got, test.want)
+			continue
+		}
+		for i := range got {
+			want := test.want[i]
+			if !bytes.Equal(got[i].MerkleLeafHash, want.MerkleLeafHash) || got[i].CorrelationId != want.CorrelationId {
+				t.Errorf("GetQueuedLeavesByCorrelationID(%q)=%v, want %v", test.id, got[i], want)
+			}
+		}
+	}
+
+	got, err := tx.GetQueuedLeavesByHash([][]byte{leaves[0].MerkleLeafHash, leaves[2].MerkleLeafHash})
+	if err != nil {
+		t.Fatalf("GetQueuedLeavesByHash()=_,%v, want no error", err)
+	}
+	if len(got) != 1 || !bytes.Equal(got[0].MerkleLeafHash, leaves[2].MerkleLeafHash) || !got[0].QueueTimestamp.Equal(fakeQueueTime) || len(got[0].QueueID) == 0 {
+		t.Errorf("GetQueuedLeavesByHash()=%v, want leaf 2 queued at %v", got, fakeQueueTime)
+	}
+}
+
+func TestQueueLeavesDuplicateIdentityHash(t *testing.T) {
+	ls := getLogStorage(t, NewStorage(), 1)
+	leaves := createTestLeaves(3, 0)
+	for i := range leaves {
+		leaves[i].LeafIdentityHash = []byte("id")
+	}
+	queueLeaves(t, ls, leaves[:1], fakeQueueTime)
+
+	tx := beginLogTx(t, ls)
+	defer tx.Rollback()
+	if err := tx.QueueLeaves(leaves[1:2], fakeQueueTime); err != storage.ErrDuplicateLeafIdentity {
+		t.Errorf("QueueLeaves(committed identity)=%v, want %v", err, storage.ErrDuplicateLeafIdentity)
+	}
+
+	ls = getLogStorage(t, NewStorage(), 1)
+	tx = beginLogTx(t, ls)
+	defer tx.Rollback()
+	if err := tx.QueueLeaves(leaves[1:], fakeQueueTime); err != storage.ErrDuplicateLeafIdentity {
+		t.Errorf("QueueLeaves(identity in batch)=%v, want %v", err, storage.ErrDuplicateLeafIdentity)
+	}
+}
+
+func TestQueueLeavesBadHash(t *testing.T) {
+	ls := getLogStorage(t, NewStorage(), 1)
+	leaves := createTestLeaves(1, 0)
+	leaves[0].LeafValue = []byte("not the leaf that was hashed")
+
+	tx := beginLogTx(t, ls)
+	defer tx.Rollback()
+	if err := tx.QueueLeaves(leaves, fakeQueueTime); err == nil {
+		t.Errorf("QueueLeaves(bad hash)=nil, want error")
+	}
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	ls := getLogStorage(t, NewStorage(), 1)
+	leaves := createTestLeaves(1, 0)
+	queueLeaves(t, ls, leaves, fakeQueueTime)
+
+	before, err := ls.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot()=_,%v, want no error", err)
+	}
+	defer before.Commit()
+
+	tx := beginLogTx(t, ls)
+	if _, err := tx.DequeueLeaves(1, fakeQueueTime); err != nil {
+		t.Fatalf("DequeueLeaves()=_,%v, want no error", err)
+	}
+	if err := tx.UpdateSequencedLeaves(leaves); err != nil {
+		t.Fatalf("UpdateSequencedLeaves()=%v, want no error", err)
+	}
+	root := trillian.SignedLogRoot{TimestampNanos: fakeQueueTime.UnixNano(), TreeSize: 1, TreeRevision: 1, RootHash: []byte("root")}
+	if err := tx.StoreSignedLogRoot(root); err != nil {
+		t.Fatalf("StoreSignedLogRoot()=%v, want no error", err)
+	}
+	// The transaction sees its own writes.
+	if got, err := tx.GetSequencedLeafCount(); err != nil || got != 1 {
+		t.Errorf("GetSequencedLeafCount(in tx)=%d,%v, want 1,nil", got, err)
+	}
+	commit(t, tx)
+
+	after, err := ls.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot()=_,%v, want no error", err)
+	}
+	defer after.Commit()
+
+	var tests = []struct {
+		descr     string
+		tx        storage.ReadOnlyLogTX
+		wantCount int64
+		wantRoot  []byte
+	}{
+		{descr: "before", tx: before, wantCount: 0},
+		{descr: "after", tx: after, wantCount: 1, wantRoot: []byte("root")},
+	}
+	for _, test := range tests {
+		if got, err := test.tx.GetSequencedLeafCount(); err != nil || got != test.wantCount {
+			t.Errorf("%s: GetSequencedLeafCount()=%d,%v, want %d,nil", test.descr, got, err, test.wantCount)
+		}
+		latest, err := test.tx.LatestSignedLogRoot()
+		if err != nil {
+			t.Errorf("%s: LatestSignedLogRoot()=_,%v, want no error", test.descr, err)
+		}
+		if got, want := latest.RootHash, test.wantRoot; !bytes.Equal(got, want) {
+			t.Errorf("%s: LatestSignedLogRoot().RootHash=%s, want %s", test.descr, got, want)
+		}
+		got, err := test.tx.GetLeavesByHash([][]byte{leaves[0].MerkleLeafHash}, false)
+		if err != nil {
+			t.Errorf("%s: GetLeavesByHash()=_,%v, want no error", test.descr, err)
+		}
+		if int64(len(got)) != test.wantCount {
+			t.Errorf("%s: GetLeavesByHash() returned %d leaves, want %d", test.descr, len(got), test.wantCount)
+		}
+	}
+
+	got, err := after.GetLeavesByIndex([]int64{0})
+	if err != nil {
+		t.Fatalf("GetLeavesByIndex(0)=_,%v, want no error", err)
+	}
+	if got, want := string(got[0].ExtraData), string(leaves[0].ExtraData); got != want {
+		t.Errorf("GetLeavesByIndex(0).ExtraData=%s, want %s", got, want)
+	}
+	if _, err := after.GetLeavesByIndex([]int64{0, 1}); err == nil {
+		t.Errorf("GetLeavesByIndex(0, 1)=_,nil, want error")
+	}
+	if rev, err := after.GetTreeRevisionAtSize(1); err != nil || rev != 1 {
+		t.Errorf("GetTreeRevisionAtSize(1)=%d,%v, want 1,nil", rev, err)
+	}
+}
+
+func TestTreeACL(t *testing.T) {
+	ls := getLogStorage(t, NewStorage(), 1)
+
+	before, err := ls.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot()=_,%v, want no error", err)
+	}
+	defer before.Commit()
+
+	acl := storage.TreeACL{"alice": "tree:admin", "*": "tree:read"}
+	tx := beginLogTx(t, ls)
+	if err := tx.SetTreeACL(acl); err != nil {
+		t.Fatalf("SetTreeACL()=%v, want no error", err)
+	}
+	// Changes to the caller's map don't leak into the transaction.
+	acl["bob"] = "tree:write"
+	if got, err := tx.GetTreeACL(); err != nil || len(got) != 2 {
+		t.Errorf("GetTreeACL(in tx)=%v,%v, want 2 entries", got, err)
+	}
+	commit(t, tx)
+
+	after, err := ls.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot()=_,%v, want no error", err)
+	}
+	defer after.Commit()
+
+	var tests = []struct {
+		descr string
+		tx    storage.ReadOnlyLogTX
+		want  storage.TreeACL
+	}{
+		{descr: "before", tx: before, want: storage.TreeACL{}},
+		{descr: "after", tx: after, want: storage.TreeACL{"alice": "tree:admin", "*": "tree:read"}},
+	}
+	for _, test := range tests {
+		got, err := test.tx.GetTreeACL()
+		if err != nil {
+			t.Errorf("%s: GetTreeACL()=_,%v, want no error", test.descr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: GetTreeACL()=%v, want %v", test.descr, got, test.want)
+		}
+	}
+
+	rolledBack := beginLogTx(t, ls)
+	if err := rolledBack.SetTreeACL(storage.TreeACL{}); err != nil {
+		t.Fatalf("SetTreeACL()=%v, want no error", err)
+	}
+	if err := rolledBack.Rollback(); err != nil {
+		t.Fatalf("Rollback()=%v, want no error", err)
+	}
+	latest, err := ls.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot()=_,%v, want no error", err)
+	}
+	defer latest.Commit()
+	if got, err := latest.GetTreeACL(); err != nil || len(got) != 2 {
+		t.Errorf("GetTreeACL(after rollback)=%v,%v, want 2 entries", got, err)
+	}
+}
+
+func TestCompactRange(t *testing.T) {
+	ls := getLogStorage(t, NewStorage(), 1)
+
+	before, err := ls.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot()=_,%v, want no error", err)
+	}
+	defer before.Commit()
+
+	hashes := [][]byte{[]byte("level 0"), nil, []byte("level 2")}
+	tx := beginLogTx(t, ls)
+	if err := tx.StoreCompactRange(5, hashes); err != nil {
+		t.Fatalf("StoreCompactRange()=%v, want no error", err)
+	}
+	if err := tx.StoreCompactRange(0, nil); err == nil {
+		t.Errorf("StoreCompactRange(0)=nil, want error")
+	}
+	// Changes to the caller's hashes don't leak into the transaction.
+	hashes[0][0] = 'L'
+	if got, err := tx.GetCompactRange(5); err != nil || !bytes.Equal(got[0], []byte("level 0")) {
+		t.Errorf("GetCompactRange(in tx)=%q,%v, want level 0 first", got, err)
+	}
+	commit(t, tx)
+
+	after, err := ls.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot()=_,%v, want no error", err)
+	}
+	defer after.Commit()
+	if err := after.(storage.LogTX).StoreCompactRange(6, hashes); err != storage.ErrReadOnly {
+		t.Errorf("StoreCompactRange(snapshot)=%v, want %v", err, storage.ErrReadOnly)
+	}
+
+	var tests = []struct {
+		descr    string
+		tx       storage.ReadOnlyLogTX
+		treeSize int64
+		want     [][]byte
+	}{
+		{descr: "before", tx: before, treeSize: 5},
+		{descr: "after", tx: after, treeSize: 5, want: [][]byte{[]byte("level 0"), nil, []byte("level 2")}},
+		{descr: "other-size", tx: after, treeSize: 6},
+	}
+	for _, test := range tests {
+		got, err := test.tx.GetCompactRange(test.treeSize)
+		if err != nil {
+			t.Errorf("%s: GetCompactRange(%d)=_,%v, want no error", test.descr, test.treeSize, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: GetCompactRange(%d)=%q, want %q", test.descr, test.treeSize, got, test.want)
+		}
+	}
+}
+
+func TestSignedLogRootByTimestamp(t *testing.T) {
+	ls := getLogStorage(t, NewStorage(), 1)
+	tx := beginLogTx(t, ls)
+	for i, ts := range []int64{300, 100, 200} {
+		if err := tx.StoreSignedLogRoot(trillian.SignedLogRoot{TimestampNanos: ts, TreeSize: ts / 100, TreeRevision: int64(i)}); err != nil {
+			t.Fatalf("StoreSignedLogRoot(%d)=%v, want no error", ts, err)
+		}
+	}
+	commit(t, tx)
+
+	snapshot, err := ls.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot()=_,%v, want no error", err)
+	}
+	defer snapshot.Commit()
+	var tests = []struct {
+		timestamp int64
+		want      int64
+	}{
+		{timestamp: 0, want: 100},
+		{timestamp: 100, want: 100},
+		{timestamp: 101, want: 200},
+		{timestamp: 300, want: 300},
+		{timestamp: 301, want: 0},
+	}
+	for _, test := range tests {
+		root, err := snapshot.SignedLogRootByTimestamp(test.timestamp)
+		if err != nil {
+			t.Errorf("SignedLogRootByTimestamp(%d)=_,%v, want no error", test.timestamp, err)
+			continue
+		}
+		if got := root.TimestampNanos; got != test.want {
+			t.Errorf("SignedLogRootByTimestamp(%d).TimestampNanos=%d, want %d", test.timestamp, got, test.want)
+		}
+	}
+}
+
+func TestSignedLogRootBySize(t *testing.T) {
+	ls := getLogStorage(t, NewStorage(), 1)
+	tx := beginLogTx(t, ls)
+	// The log signs the tree at size 2 twice, when it's first seen and again later.
+	for i, root := range []trillian.SignedLogRoot{{TimestampNanos: 100, TreeSize: 1}, {TimestampNanos: 300, TreeSize: 2}, {TimestampNanos: 200, TreeSize: 2}} {
+		root.TreeRevision = int64(i)
+		if err := tx.StoreSignedLogRoot(root); err != nil {
+			t.Fatalf("StoreSignedLogRoot(%d)=%v, want no error", root.TimestampNanos, err)
+		}
+	}
+	commit(t, tx)
+
+	snapshot, err := ls.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot()=_,%v, want no error", err)
+	}
+	defer snapshot.Commit()
+	var tests = []struct {
+		treeSize int64
+		want     int64
+	}{
+		{treeSize: 0, want: 0},
+		{treeSize: 1, want: 100},
+		{treeSize: 2, want: 200},
+		{treeSize: 3, want: 0},
+	}
+	for _, test := range tests {
+		root, err := snapshot.SignedLogRootBySize(test.treeSize)
+		if err != nil {
+			t.Errorf("SignedLogRootBySize(%d)=_,%v, want no error", test.treeSize, err)
+			continue
+		}
+		if got := root.TimestampNanos; got != test.want {
+			t.Errorf("SignedLogRootBySize(%d).TimestampNanos=%d, want %d", test.treeSize, got, test.want)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	s := NewStorage()
+	if err := s.CreateLog(1, TreeOptions{ReadOnly: true}); err != nil {
+		t.Fatalf("CreateLog()=%v, want no error", err)
+	}
+	ls := getLogStorage(t, s, 1)
+	if _, err := ls.Begin(); err != storage.ErrReadOnly {
+		t.Errorf("Begin()=_,%v, want %v", err, storage.ErrReadOnly)
+	}
+
+	tx, err := ls.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot()=_,%v, want no error", err)
+	}
+	commit(t, tx)
+	if err := tx.Commit(); err != errTXClosed {
+		t.Errorf("Commit(again)=%v, want %v", err, errTXClosed)
+	}
+}
+
+func TestGetActiveLogIDs(t *testing.T) {
+	s := NewStorage()
+	for _, id := range []int64{3, 1, 2} {
+		getLogStorage(t, s, id)
+	}
+	if _, err := s.GetMapStorage(4); err != nil {
+		t.Fatalf("GetMapStorage(4)=_,%v, want no error", err)
+	}
+	if _, err := s.GetLogStorage(4); err == nil {
+		t.Errorf("GetLogStorage(map)=_,nil, want error")
+	}
+	queueLeaves(t, getLogStorage(t, s, 2), createTestLeaves(1, 0), fakeQueueTime)
+
+	tx, err := getLogStorage(t, s, 1).Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot()=_,%v, want no error", err)
+	}
+	defer tx.Commit()
+	ltx := tx.(storage.LogTX)
+
+	if ids, err := ltx.GetActiveLogIDs(); err != nil || fmt.Sprint(ids) != "[1 2 3]" {
+		t.Errorf("GetActiveLogIDs()=%v,%v, want [1 2 3],nil", ids, err)
+	}
+	if ids, err := ltx.GetActiveLogIDsWithPendingWork(); err != nil || fmt.Sprint(ids) != "[2]" {
+		t.Errorf("GetActiveLogIDsWithPendingWork()=%v,%v, want [2],nil", ids, err)
+	}
+}
+
+func newTestSequencer(t *testing.T, ls storage.LogStorage, timeSource util.TimeSource) *log.Sequencer {
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPrivateKey(testonly.DemoPrivateKey, testonly.DemoPrivateKeyPass); err != nil {
+		t.Fatalf("LoadPrivateKey()=%v, want no error", err)
+	}
+	return log.NewSequencer(merkle.NewRFC6962TreeHasher(crypto.NewSHA256()), timeSource, ls, km)
+}
+
+// TestSequencer checks that the tree the sequencer builds in memory storage has the
+// expected root, which needs nodes to be read back at the right revisions.
+func TestSequencer(t *testing.T) {
+	ls := getLogStorage(t, NewStorage(), 1)
+	timeSource := &util.FakeTimeSource{FakeTime: fakeQueueTime}
+	sequencer := newTestSequencer(t, ls, timeSource)
+	leaves := createTestLeaves(21, 0)
+	want := merkle.NewInMemoryMerkleTree(merkle.NewRFC6962TreeHasher(crypto.NewSHA256()))
+
+	ctx := util.NewLogContext(context.Background(), 1)
+	if err := sequencer.SignRoot(ctx); err != nil {
+		t.Fatalf("SignRoot()=%v, want no error", err)
+	}
+	for start := 0; start < len(leaves); start += 5 {
+		end := start + 5
+		if end > len(leaves) {
+			end = len(leaves)
+		}
+		queueLeaves(t, ls, leaves[start:end], timeSource.Now())
+		timeSource.FakeTime = timeSource.FakeTime.Add(time.Second)
+		if got, err := sequencer.SequenceBatch(ctx, 10); err != nil || got != end-start {
+			t.Fatalf("SequenceBatch()=%d,%v, want %d,nil", got, err, end-start)
+		}
+
+		tx, err := ls.Snapshot()
+		if err != nil {
+			t.Fatalf("Snapshot()=_,%v, want no error", err)
+		}
+		// Leaves queued together are sequenced in leaf hash order, so the expected tree
+		// is built from the leaves in the order they were given indices.
+		indices := make([]int64, 0, end-start)
+		for i := start; i < end; i++ {
+			indices = append(indices, int64(i))
+		}
+		sequenced, err := tx.GetLeavesByIndex(indices)
+		if err != nil {
+			t.Fatalf("GetLeavesByIndex()=_,%v, want no error", err)
+		}
+		for _, leaf := range sequenced {
+			want.AddLeaf(leaf.LeafValue)
+		}
+		root, err := tx.LatestSignedLogRoot()
+		commit(t, tx)
+		if err != nil {
+			t.Fatalf("LatestSignedLogRoot()=_,%v, want no error", err)
+		}
+		if got, want := root.TreeSize, int64(end); got != want {
+			t.Errorf("TreeSize=%d, want %d", got, want)
+		}
+		if got, want := root.RootHash, want.CurrentRoot().Hash(); !bytes.Equal(got, want) {
+			t.Errorf("RootHash(size %d)=%x, want %x", end, got, want)
+		}
+	}
+}
+
+// TestConcurrentQueueAndSequence queues leaves from several goroutines while the
+// sequencer runs, and checks that every leaf ends up in the tree exactly once.
+func TestConcurrentQueueAndSequence(t *testing.T) {
+	const writers, perWriter = 4, 25
+	s := NewStorage()
+	ls := getLogStorage(t, s, 1)
+	sequencer := newTestSequencer(t, ls, util.SystemTimeSource{})
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for _, leaf := range createTestLeaves(perWriter, int64(w*perWriter)) {
+				tx, err := ls.Begin()
+				if err != nil {
+					t.Errorf("Begin()=_,%v, want no error", err)
+					return
+				}
+				if err := tx.QueueLeaves([]trillian.LogLeaf{leaf}, time.Now()); err != nil {
+					tx.Rollback()
+					t.Errorf("QueueLeaves()=%v, want no error", err)
+					return
+				}
+				if err := tx.Commit(); err != nil {
+					t.Errorf("Commit()=%v, want no error", err)
+					return
+				}
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ctx := util.NewLogContext(context.Background(), 1)
+	if err := sequencer.SignRoot(ctx); err != nil {
+		t.Fatalf("SignRoot()=%v, want no error", err)
+	}
+	sequenced := 0
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		n, err := sequencer.SequenceBatch(ctx, 7)
+		if err != nil {
+			t.Fatalf("SequenceBatch()=_,%v, want no error", err)
+		}
+		sequenced += n
+		// Tree heads need distinct timestamps.
+		time.Sleep(time.Millisecond)
+	}
+	for {
+		n, err := sequencer.SequenceBatch(ctx, 7)
+		if err != nil {
+			t.Fatalf("SequenceBatch()=_,%v, want no error", err)
+		}
+		if n == 0 {
+			break
+		}
+		sequenced += n
+		time.Sleep(time.Millisecond)
+	}
+
+	if got, want := sequenced, writers*perWriter; got != want {
+		t.Errorf("sequenced %d leaves, want %d", got, want)
+	}
+	tx, err := ls.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot()=_,%v, want no error", err)
+	}
+	defer tx.Commit()
+	if got, err := tx.GetSequencedLeafCount(); err != nil || got != writers*perWriter {
+		t.Errorf("GetSequencedLeafCount()=%d,%v, want %d,nil", got, err, writers*perWriter)
+	}
+	for i := 0; i < writers*perWriter; i++ {
+		leaf := createTestLeaves(1, int64(i))[0]
+		got, err := tx.GetLeavesByLeafValueHash([][]byte{leaf.LeafValueHash}, false)
+		if err != nil || len(got) != 1 {
+			t.Errorf("GetLeavesByLeafValueHash(%s)=%d leaves,%v, want 1,nil", leaf.LeafValue, len(got), err)
+		}
+	}
+}
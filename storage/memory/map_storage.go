@@ -0,0 +1,202 @@
+package memory
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+)
+
+type mapRoot struct {
+	version int64
+	root    trillian.SignedMapRoot
+}
+
+// mapLeafRevision is the value of a key as it was set at a revision. The value is kept
+// serialized, and an empty one means the key has no value.
+type mapLeafRevision struct {
+	version  int64
+	revision int64
+	data     []byte
+}
+
+type mapStorage struct {
+	t *tree
+}
+
+// GetMapStorage returns the storage for a map, creating the map if it doesn't exist. It
+// fails if the tree is a log.
+func (s *Storage) GetMapStorage(treeID int64) (storage.MapStorage, error) {
+	t, err := s.getTree(treeID, true)
+	if err != nil {
+		return nil, err
+	}
+	return &mapStorage{t: t}, nil
+}
+
+func (m *mapStorage) MapID() int64 {
+	return m.t.id
+}
+
+func (m *mapStorage) Begin() (storage.MapTX, error) {
+	if m.t.opts.ReadOnly {
+		return nil, storage.ErrReadOnly
+	}
+	return m.begin(true), nil
+}
+
+func (m *mapStorage) Snapshot() (storage.ReadOnlyMapTX, error) {
+	return m.begin(false), nil
+}
+
+func (m *mapStorage) begin(write bool) *mapTX {
+	tx := &mapTX{
+		treeTX: newTreeTX(m.t, write),
+		leaves: make(map[string][]byte),
+	}
+	if write {
+		root, _ := tx.LatestSignedMapRoot()
+		tx.writeRevision = root.MapRevision + 1
+	}
+	return tx
+}
+
+// mapTX is a map transaction. Reads see the tree as it was when the transaction started
+// together with the transaction's own writes.
+type mapTX struct {
+	treeTX
+
+	// These are written to the tree when the transaction commits.
+	roots  []trillian.SignedMapRoot
+	leaves map[string][]byte
+}
+
+// allRoots returns all the map heads visible to the transaction. t.t.mu must be held.
+func (m *mapTX) allRoots() []trillian.SignedMapRoot {
+	var roots []trillian.SignedMapRoot
+	for _, r := range m.t.mapRoots {
+		if r.version <= m.version {
+			roots = append(roots, r.root)
+		}
+	}
+	return append(roots, m.roots...)
+}
+
+func (m *mapTX) Set(keyHash []byte, value trillian.MapLeaf) error {
+	if m.closed {
+		return errTXClosed
+	}
+	if !m.write {
+		return storage.ErrReadOnly
+	}
+	flatValue, err := proto.Marshal(&value)
+	if err != nil {
+		return err
+	}
+	m.leaves[string(keyHash)] = flatValue
+	return nil
+}
+
+// Get returns the values of the keys at revision, or at the transaction's write
+// revision if revision is -1.
+func (m *mapTX) Get(revision int64, keyHashes [][]byte) ([]trillian.MapLeaf, error) {
+	if m.closed {
+		return nil, errTXClosed
+	}
+	m.t.mu.RLock()
+	defer m.t.mu.RUnlock()
+
+	latest := revision < 0
+	ret := make([]trillian.MapLeaf, 0, len(keyHashes))
+	for _, k := range keyHashes {
+		flatData, ok := m.leaves[string(k)]
+		if !ok || (!latest && revision < m.writeRevision) {
+			flatData = m.getCommitted(k, revision, latest)
+		}
+		// It's possible there are no values for any of these keys yet
+		if len(flatData) == 0 {
+			continue
+		}
+		var mapLeaf trillian.MapLeaf
+		if err := proto.Unmarshal(flatData, &mapLeaf); err != nil {
+			return nil, err
+		}
+		mapLeaf.KeyHash = k
+		ret = append(ret, mapLeaf)
+	}
+	return ret, nil
+}
+
+// getCommitted returns the most recent value of a key at or before revision, or at any
+// revision if latest is set. m.t.mu must be held.
+func (m *mapTX) getCommitted(keyHash []byte, revision int64, latest bool) []byte {
+	revs := m.t.mapLeaves[string(keyHash)]
+	for i := len(revs) - 1; i >= 0; i-- {
+		if revs[i].version <= m.version && (latest || revs[i].revision <= revision) {
+			return revs[i].data
+		}
+	}
+	return nil
+}
+
+func (m *mapTX) LatestSignedMapRoot() (trillian.SignedMapRoot, error) {
+	if m.closed {
+		return trillian.SignedMapRoot{}, errTXClosed
+	}
+	m.t.mu.RLock()
+	defer m.t.mu.RUnlock()
+
+	// It's possible there are no roots for this tree yet
+	var latest trillian.SignedMapRoot
+	found := false
+	for _, r := range m.allRoots() {
+		if !found || r.TimestampNanos > latest.TimestampNanos {
+			latest = r
+			found = true
+		}
+	}
+	if found {
+		latest.MapId = m.t.id
+	}
+	return latest, nil
+}
+
+func (m *mapTX) StoreSignedMapRoot(root trillian.SignedMapRoot) error {
+	if m.closed {
+		return errTXClosed
+	}
+	if !m.write {
+		return storage.ErrReadOnly
+	}
+	m.t.mu.RLock()
+	defer m.t.mu.RUnlock()
+
+	for _, r := range m.allRoots() {
+		if r.TimestampNanos == root.TimestampNanos {
+			return fmt.Errorf("map head with timestamp %d already exists", root.TimestampNanos)
+		}
+		if r.MapRevision == root.MapRevision {
+			return fmt.Errorf("map head with revision %d already exists", root.MapRevision)
+		}
+	}
+	m.roots = append(m.roots, root)
+	return nil
+}
+
+// GetTreeRevisionAtSize isn't meaningful for maps, which don't have a size.
+func (m *mapTX) GetTreeRevisionAtSize(treeSize int64) (int64, error) {
+	return 0, fmt.Errorf("no tree head for tree size %d: tree %d is a map", treeSize, m.t.id)
+}
+
+func (m *mapTX) Commit() error {
+	return m.commit(func(version int64) {
+		tr := m.t
+		for _, root := range m.roots {
+			tr.mapRoots = append(tr.mapRoots, mapRoot{version: version, root: root})
+		}
+		for k, data := range m.leaves {
+			tr.mapLeaves[k] = append(tr.mapLeaves[k], mapLeafRevision{version: version, revision: m.writeRevision, data: data})
+		}
+	})
+}
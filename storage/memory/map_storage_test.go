@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/storage"
+)
+
+func setMapValue(t *testing.T, ms storage.MapStorage, key, value string, timestamp int64) {
+	tx, err := ms.Begin()
+	if err != nil {
+		t.Fatalf("Begin()=_,%v, want no error", err)
+	}
+	if err := tx.Set([]byte(key), trillian.MapLeaf{LeafValue: []byte(value)}); err != nil {
+		t.Fatalf("Set()=%v, want no error", err)
+	}
+	root := trillian.SignedMapRoot{TimestampNanos: timestamp, MapRevision: tx.WriteRevision(), RootHash: []byte(value)}
+	if err := tx.StoreSignedMapRoot(root); err != nil {
+		t.Fatalf("StoreSignedMapRoot()=%v, want no error", err)
+	}
+	commit(t, tx)
+}
+
+func TestMapRevisions(t *testing.T) {
+	ms, err := NewStorage().GetMapStorage(5)
+	if err != nil {
+		t.Fatalf("GetMapStorage()=_,%v, want no error", err)
+	}
+	if got, want := ms.MapID(), int64(5); got != want {
+		t.Errorf("MapID()=%d, want %d", got, want)
+	}
+	setMapValue(t, ms, "key", "one", 100)
+
+	tx, err := ms.Begin()
+	if err != nil {
+		t.Fatalf("Begin()=_,%v, want no error", err)
+	}
+	if got, want := tx.WriteRevision(), int64(2); got != want {
+		t.Errorf("WriteRevision()=%d, want %d", got, want)
+	}
+	if err := tx.Set([]byte("key"), trillian.MapLeaf{LeafValue: []byte("two")}); err != nil {
+		t.Fatalf("Set()=%v, want no error", err)
+	}
+	snapshot, err := ms.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot()=_,%v, want no error", err)
+	}
+	defer snapshot.Commit()
+
+	var tests = []struct {
+		descr    string
+		tx       storage.ReadOnlyMapTX
+		revision int64
+		want     string
+	}{
+		{descr: "tx", tx: tx, revision: 1, want: "one"},
+		{descr: "tx", tx: tx, revision: 2, want: "two"},
+		{descr: "tx", tx: tx, revision: -1, want: "two"},
+		{descr: "snapshot", tx: snapshot, revision: 1, want: "one"},
+		{descr: "snapshot", tx: snapshot, revision: -1, want: "one"},
+		{descr: "snapshot", tx: snapshot, revision: 0, want: ""},
+	}
+	for _, test := range tests {
+		leaves, err := test.tx.Get(test.revision, [][]byte{[]byte("key"), []byte("unknown")})
+		if err != nil {
+			t.Errorf("%s: Get(%d)=_,%v, want no error", test.descr, test.revision, err)
+			continue
+		}
+		got := ""
+		if len(leaves) > 0 {
+			got = string(leaves[0].LeafValue)
+		}
+		if len(leaves) > 1 || got != test.want {
+			t.Errorf("%s: Get(%d)=%v, want %q", test.descr, test.revision, leaves, test.want)
+		}
+	}
+	commit(t, tx)
+
+	root, err := snapshot.LatestSignedMapRoot()
+	if err != nil {
+		t.Fatalf("LatestSignedMapRoot()=_,%v, want no error", err)
+	}
+	if got, want := root.MapRevision, int64(1); got != want {
+		t.Errorf("LatestSignedMapRoot().MapRevision=%d, want %d", got, want)
+	}
+	if err := snapshot.(storage.MapTX).Set([]byte("key"), trillian.MapLeaf{}); err != storage.ErrReadOnly {
+		t.Errorf("Set(in snapshot)=%v, want %v", err, storage.ErrReadOnly)
+	}
+}
@@ -0,0 +1,459 @@
+// Package memory provides storage for logs and maps that's held in memory. It implements
+// the same contract as the MySQL storage, including snapshots, tree revisions and the
+// leaf queue, and is safe for concurrent use. The data doesn't survive a restart, so
+// it's intended for tests and for running a server in a single process.
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/storage/cache"
+	"github.com/google/trillian/storage/storagepb"
+)
+
+// These match the strata used by the MySQL storage.
+var defaultLogStrata = []int{8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8}
+var defaultMapStrata = []int{8, 8, 8, 8, 8, 8, 8, 8, 8, 8, 176}
+
+var errTXClosed = errors.New("transaction is closed")
+
+// TreeOptions are the settings of a tree, which are fixed when it's created.
+type TreeOptions struct {
+	// AllowDuplicates lets a log hold several copies of the same leaf value.
+	AllowDuplicates bool
+	// ReadOnly makes Begin fail with storage.ErrReadOnly, snapshots can still be read.
+	ReadOnly bool
+}
+
+// Storage holds any number of logs and maps. Trees are created with default options
+// the first time storage for them is requested, unless they've already been created
+// with CreateLog or CreateMap.
+type Storage struct {
+	mu    sync.Mutex
+	trees map[int64]*tree
+}
+
+// NewStorage creates an empty Storage.
+func NewStorage() *Storage {
+	return &Storage{trees: make(map[int64]*tree)}
+}
+
+// CreateLog adds a log with the given options. It fails if the tree already exists.
+func (s *Storage) CreateLog(treeID int64, opts TreeOptions) error {
+	_, err := s.createTree(treeID, false, opts)
+	return err
+}
+
+// CreateMap adds a map with the given options. It fails if the tree already exists.
+func (s *Storage) CreateMap(treeID int64, opts TreeOptions) error {
+	_, err := s.createTree(treeID, true, opts)
+	return err
+}
+
+func (s *Storage) createTree(treeID int64, isMap bool, opts TreeOptions) (*tree, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.trees[treeID]; ok {
+		return nil, fmt.Errorf("tree %d already exists", treeID)
+	}
+	t := newTree(treeID, isMap, opts)
+	s.trees[treeID] = t
+	return t, nil
+}
+
+// getTree returns the tree with the given ID, creating it if necessary.
+func (s *Storage) getTree(treeID int64, isMap bool) (*tree, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.trees[treeID]
+	if !ok {
+		t = newTree(treeID, isMap, TreeOptions{})
+		s.trees[treeID] = t
+	}
+	if t.isMap != isMap {
+		return nil, fmt.Errorf("tree %d is not a %s", treeID, treeType(isMap))
+	}
+	return t, nil
+}
+
+// logIDs returns the IDs of the logs for which pick returns true, in ascending order.
+func (s *Storage) logIDs(pick func(*tree) bool) []int64 {
+	s.mu.Lock()
+	var logs []*tree
+	for _, t := range s.trees {
+		if !t.isMap {
+			logs = append(logs, t)
+		}
+	}
+	s.mu.Unlock()
+
+	ids := make([]int64, 0, len(logs))
+	for _, t := range logs {
+		if pick(t) {
+			ids = append(ids, t.id)
+		}
+	}
+	sort.Sort(int64Slice(ids))
+	return ids
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func treeType(isMap bool) string {
+	if isMap {
+		return "map"
+	}
+	return "log"
+}
+
+// subtreeRevision is a subtree as it was written at a revision. The subtree is kept
+// serialized, without its internal nodes, as the subtree cache modifies the ones it
+// reads.
+type subtreeRevision struct {
+	revision int64
+	data     []byte
+}
+
+// aclRevision is an access control list as it was set at a tree version.
+type aclRevision struct {
+	version int64
+	acl     storage.TreeACL
+}
+
+// storedSubtree is a subtree written by a transaction that's being committed.
+type storedSubtree struct {
+	key  string
+	data []byte
+}
+
+// tree holds the data for a single log or map. Only the fields for its type are used.
+type tree struct {
+	id    int64
+	isMap bool
+	opts  TreeOptions
+
+	hashSizeBytes   int
+	strataDepths    []int
+	populateSubtree storage.PopulateSubtreeFunc
+
+	// writer is held by a tree's open write transaction, so writers are serialized like
+	// they are by the MySQL tree lock. Readers don't take it.
+	writer sync.Mutex
+
+	// mu guards the committed data below.
+	mu sync.RWMutex
+	// version counts the commits that have changed the tree. Data is stored with the
+	// version it was committed at, so that transactions only see what had been committed
+	// when they started.
+	version int64
+	// subtrees holds every revision of each subtree, keyed by prefix, in ascending
+	// revision order.
+	subtrees map[string][]subtreeRevision
+	// acls holds every access control list set on the tree, in ascending version order.
+	acls []aclRevision
+
+	// Log data.
+	logRoots  []logRoot
+	leafData  map[string]leafData
+	sequenced map[int64]sequencedLeaf
+	byMerkle  map[string][]int64
+	byValue   map[string][]int64
+	// compactRanges holds the compact range stored for each tree size.
+	compactRanges map[int64]compactRange
+	// byIdentity maps the identity hashes of leaves queued with one to their leaf value
+	// hashes.
+	byIdentity map[string]string
+	// sequencedCounts records the number of sequenced leaves after each commit that
+	// sequenced some, in ascending version order.
+	sequencedCounts []sequencedCount
+	queue           map[int64]queuedLeaf
+	nextQueued      int64
+
+	// Map data.
+	mapRoots  []mapRoot
+	mapLeaves map[string][]mapLeafRevision
+}
+
+func newTree(treeID int64, isMap bool, opts TreeOptions) *tree {
+	// TODO(al): pass this through/configure from the tree, as for the MySQL storage.
+	th := merkle.NewRFC6962TreeHasher(crypto.NewSHA256())
+	t := &tree{
+		id:            treeID,
+		isMap:         isMap,
+		opts:          opts,
+		hashSizeBytes: th.Size(),
+		subtrees:      make(map[string][]subtreeRevision),
+	}
+	if isMap {
+		t.strataDepths = defaultMapStrata
+		t.populateSubtree = cache.PopulateMapSubtreeNodes(th)
+		t.mapLeaves = make(map[string][]mapLeafRevision)
+	} else {
+		t.strataDepths = defaultLogStrata
+		t.populateSubtree = cache.PopulateLogSubtreeNodes(th)
+		t.leafData = make(map[string]leafData)
+		t.sequenced = make(map[int64]sequencedLeaf)
+		t.compactRanges = make(map[int64]compactRange)
+		t.byMerkle = make(map[string][]int64)
+		t.byValue = make(map[string][]int64)
+		t.byIdentity = make(map[string]string)
+		t.queue = make(map[int64]queuedLeaf)
+	}
+	return t
+}
+
+// treeTX holds what's common to log and map transactions. Writes are kept in the
+// transaction until it's committed, when they're applied to the tree all at once.
+type treeTX struct {
+	t *tree
+	// write is true if the transaction holds t.writer.
+	write bool
+	// version is the version of the tree the transaction reads.
+	version       int64
+	closed        bool
+	subtreeCache  cache.SubtreeCache
+	writeRevision int64
+	subtrees      []*storagepb.SubtreeProto
+	// acl is the access control list set by the transaction, if any.
+	acl storage.TreeACL
+}
+
+func newTreeTX(t *tree, write bool) treeTX {
+	if write {
+		t.writer.Lock()
+	}
+	t.mu.RLock()
+	version := t.version
+	t.mu.RUnlock()
+	return treeTX{
+		t:             t,
+		write:         write,
+		version:       version,
+		subtreeCache:  cache.NewSubtreeCache(t.strataDepths, t.populateSubtree),
+		writeRevision: -1,
+	}
+}
+
+// getSubtrees returns the latest revisions at or before treeRevision of the subtrees
+// with the given IDs. Subtrees that don't exist are left out.
+func (t *treeTX) getSubtrees(treeRevision int64, nodeIDs []storage.NodeID) ([]*storagepb.SubtreeProto, error) {
+	if t.closed {
+		return nil, errTXClosed
+	}
+	t.t.mu.RLock()
+	defer t.t.mu.RUnlock()
+
+	ret := make([]*storagepb.SubtreeProto, 0, len(nodeIDs))
+	for _, nodeID := range nodeIDs {
+		if nodeID.PrefixLenBits%8 != 0 {
+			return nil, fmt.Errorf("invalid subtree ID - not multiple of 8: %d", nodeID.PrefixLenBits)
+		}
+		revs := t.t.subtrees[string(nodeID.Path[:nodeID.PrefixLenBits/8])]
+		i := sort.Search(len(revs), func(i int) bool { return revs[i].revision > treeRevision })
+		if i == 0 {
+			continue
+		}
+		var subtree storagepb.SubtreeProto
+		if err := proto.Unmarshal(revs[i-1].data, &subtree); err != nil {
+			glog.Warningf("Failed to unmarshal SubtreeProto: %s", err)
+			return nil, err
+		}
+		if subtree.Prefix == nil {
+			subtree.Prefix = []byte{}
+		}
+		ret = append(ret, &subtree)
+	}
+
+	// The InternalNodes cache is nil here, but the SubtreeCache (which called
+	// this method) will re-populate it.
+	return ret, nil
+}
+
+func (t *treeTX) getSubtree(treeRevision int64, nodeID storage.NodeID) (*storagepb.SubtreeProto, error) {
+	s, err := t.getSubtrees(treeRevision, []storage.NodeID{nodeID})
+	if err != nil {
+		return nil, err
+	}
+	switch len(s) {
+	case 0:
+		return nil, nil
+	case 1:
+		return s[0], nil
+	default:
+		return nil, fmt.Errorf("got %d subtrees, but expected 1", len(s))
+	}
+}
+
+// storeSubtrees keeps subtrees flushed from the cache until the transaction commits.
+func (t *treeTX) storeSubtrees(subtrees []*storagepb.SubtreeProto) error {
+	for _, s := range subtrees {
+		if s.Prefix == nil {
+			return fmt.Errorf("nil prefix on %v", s)
+		}
+	}
+	t.subtrees = append(t.subtrees, subtrees...)
+	return nil
+}
+
+// marshalSubtrees serializes the subtrees written by the transaction.
+func (t *treeTX) marshalSubtrees() ([]storedSubtree, error) {
+	ret := make([]storedSubtree, 0, len(t.subtrees))
+	for _, s := range t.subtrees {
+		// Ensure we're not storing the internal nodes, since we'll just recalculate
+		// them when we read this subtree back.
+		s.InternalNodes = nil
+		data, err := proto.Marshal(s)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, storedSubtree{key: string(s.Prefix), data: data})
+	}
+	return ret, nil
+}
+
+// applySubtrees adds subtrees written at the transaction's revision to the tree,
+// replacing any already written at that revision. t.t.mu must be held.
+func (t *treeTX) applySubtrees(subtrees []storedSubtree) {
+	for _, s := range subtrees {
+		revs := t.t.subtrees[s.key]
+		i := sort.Search(len(revs), func(i int) bool { return revs[i].revision >= t.writeRevision })
+		if i < len(revs) && revs[i].revision == t.writeRevision {
+			revs[i].data = s.data
+			continue
+		}
+		revs = append(revs, subtreeRevision{})
+		copy(revs[i+1:], revs[i:])
+		revs[i] = subtreeRevision{revision: t.writeRevision, data: s.data}
+		t.t.subtrees[s.key] = revs
+	}
+}
+
+// GetMerkleNodes returns the requests nodes at (or below) the passed in treeRevision.
+func (t *treeTX) GetMerkleNodes(treeRevision int64, nodeIDs []storage.NodeID) ([]storage.Node, error) {
+	return t.subtreeCache.GetNodes(nodeIDs, func(ids []storage.NodeID) ([]*storagepb.SubtreeProto, error) {
+		return t.getSubtrees(treeRevision, ids)
+	})
+}
+
+func (t *treeTX) SetMerkleNodes(nodes []storage.Node) error {
+	if !t.write {
+		return storage.ErrReadOnly
+	}
+	for _, n := range nodes {
+		err := t.subtreeCache.SetNodeHash(n.NodeID, n.Hash,
+			func(nID storage.NodeID) (*storagepb.SubtreeProto, error) {
+				return t.getSubtree(t.writeRevision, nID)
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit applies the transaction's writes to the tree, with apply adding those that
+// are specific to the type of tree at the given version. apply must not fail, so anything
+// that could go wrong has to be checked before the transaction commits. t.t.mu is held
+// while apply runs.
+func (t *treeTX) commit(apply func(version int64)) error {
+	if t.closed {
+		return errTXClosed
+	}
+	defer t.close()
+	if !t.write {
+		return nil
+	}
+
+	if err := t.subtreeCache.Flush(t.storeSubtrees); err != nil {
+		glog.Warningf("TX commit error: %s", err)
+		return err
+	}
+	subtrees, err := t.marshalSubtrees()
+	if err != nil {
+		glog.Warningf("TX commit error: %s", err)
+		return err
+	}
+
+	t.t.mu.Lock()
+	defer t.t.mu.Unlock()
+	t.t.version++
+	t.applySubtrees(subtrees)
+	if t.acl != nil {
+		t.t.acls = append(t.t.acls, aclRevision{version: t.t.version, acl: t.acl})
+	}
+	apply(t.t.version)
+	return nil
+}
+
+func (t *treeTX) GetTreeACL() (storage.TreeACL, error) {
+	if t.closed {
+		return nil, errTXClosed
+	}
+	acl := t.acl
+	if acl == nil {
+		t.t.mu.RLock()
+		revs := t.t.acls
+		i := sort.Search(len(revs), func(i int) bool { return revs[i].version > t.version })
+		if i > 0 {
+			acl = revs[i-1].acl
+		}
+		t.t.mu.RUnlock()
+	}
+	return copyACL(acl), nil
+}
+
+func (t *treeTX) SetTreeACL(acl storage.TreeACL) error {
+	if t.closed {
+		return errTXClosed
+	}
+	if !t.write {
+		return storage.ErrReadOnly
+	}
+	t.acl = copyACL(acl)
+	return nil
+}
+
+func copyACL(acl storage.TreeACL) storage.TreeACL {
+	ret := make(storage.TreeACL, len(acl))
+	for principal, scope := range acl {
+		ret[principal] = scope
+	}
+	return ret
+}
+
+func (t *treeTX) Rollback() error {
+	if t.closed {
+		return errTXClosed
+	}
+	t.close()
+	return nil
+}
+
+func (t *treeTX) close() {
+	t.closed = true
+	if t.write {
+		t.t.writer.Unlock()
+	}
+}
+
+func (t *treeTX) IsOpen() bool {
+	return !t.closed
+}
+
+func (t *treeTX) WriteRevision() int64 {
+	return t.writeRevision
+}
@@ -51,6 +51,16 @@ func (_mr *_MockLogTXRecorder) DequeueLeaves(arg0, arg1 interface{}) *gomock.Cal
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "DequeueLeaves", arg0, arg1)
 }
 
+func (_m *MockLogTX) DequeuePeekedLeaves(_param0 []QueuedLeaf) error {
+	ret := _m.ctrl.Call(_m, "DequeuePeekedLeaves", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockLogTXRecorder) DequeuePeekedLeaves(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "DequeuePeekedLeaves", arg0)
+}
+
 func (_m *MockLogTX) GetActiveLogIDs() ([]int64, error) {
 	ret := _m.ctrl.Call(_m, "GetActiveLogIDs")
 	ret0, _ := ret[0].([]int64)
@@ -73,6 +83,17 @@ func (_mr *_MockLogTXRecorder) GetActiveLogIDsWithPendingWork() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetActiveLogIDsWithPendingWork")
 }
 
+func (_m *MockLogTX) GetCompactRange(_param0 int64) ([][]byte, error) {
+	ret := _m.ctrl.Call(_m, "GetCompactRange", _param0)
+	ret0, _ := ret[0].([][]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockLogTXRecorder) GetCompactRange(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetCompactRange", arg0)
+}
+
 func (_m *MockLogTX) GetLeavesByHash(_param0 [][]byte, _param1 bool) ([]trillian.LogLeaf, error) {
 	ret := _m.ctrl.Call(_m, "GetLeavesByHash", _param0, _param1)
 	ret0, _ := ret[0].([]trillian.LogLeaf)
@@ -84,6 +105,17 @@ func (_mr *_MockLogTXRecorder) GetLeavesByHash(arg0, arg1 interface{}) *gomock.C
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeavesByHash", arg0, arg1)
 }
 
+func (_m *MockLogTX) GetLeavesByIdentityHash(_param0 [][]byte) ([]trillian.LogLeaf, error) {
+	ret := _m.ctrl.Call(_m, "GetLeavesByIdentityHash", _param0)
+	ret0, _ := ret[0].([]trillian.LogLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockLogTXRecorder) GetLeavesByIdentityHash(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeavesByIdentityHash", arg0)
+}
+
 func (_m *MockLogTX) GetLeavesByIndex(_param0 []int64) ([]trillian.LogLeaf, error) {
 	ret := _m.ctrl.Call(_m, "GetLeavesByIndex", _param0)
 	ret0, _ := ret[0].([]trillian.LogLeaf)
@@ -117,6 +149,28 @@ func (_mr *_MockLogTXRecorder) GetMerkleNodes(arg0, arg1 interface{}) *gomock.Ca
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMerkleNodes", arg0, arg1)
 }
 
+func (_m *MockLogTX) GetQueuedLeavesByCorrelationID(_param0 string) ([]QueuedLeaf, error) {
+	ret := _m.ctrl.Call(_m, "GetQueuedLeavesByCorrelationID", _param0)
+	ret0, _ := ret[0].([]QueuedLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockLogTXRecorder) GetQueuedLeavesByCorrelationID(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetQueuedLeavesByCorrelationID", arg0)
+}
+
+func (_m *MockLogTX) GetQueuedLeavesByHash(_param0 [][]byte) ([]QueuedLeaf, error) {
+	ret := _m.ctrl.Call(_m, "GetQueuedLeavesByHash", _param0)
+	ret0, _ := ret[0].([]QueuedLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockLogTXRecorder) GetQueuedLeavesByHash(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetQueuedLeavesByHash", arg0)
+}
+
 func (_m *MockLogTX) GetSequencedLeafCount() (int64, error) {
 	ret := _m.ctrl.Call(_m, "GetSequencedLeafCount")
 	ret0, _ := ret[0].(int64)
@@ -128,6 +182,17 @@ func (_mr *_MockLogTXRecorder) GetSequencedLeafCount() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSequencedLeafCount")
 }
 
+func (_m *MockLogTX) GetTreeACL() (TreeACL, error) {
+	ret := _m.ctrl.Call(_m, "GetTreeACL")
+	ret0, _ := ret[0].(TreeACL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockLogTXRecorder) GetTreeACL() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTreeACL")
+}
+
 func (_m *MockLogTX) GetTreeRevisionAtSize(_param0 int64) (int64, error) {
 	ret := _m.ctrl.Call(_m, "GetTreeRevisionAtSize", _param0)
 	ret0, _ := ret[0].(int64)
@@ -160,6 +225,17 @@ func (_mr *_MockLogTXRecorder) LatestSignedLogRoot() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "LatestSignedLogRoot")
 }
 
+func (_m *MockLogTX) PeekLeaves(_param0 int, _param1 time.Time) ([]QueuedLeaf, error) {
+	ret := _m.ctrl.Call(_m, "PeekLeaves", _param0, _param1)
+	ret0, _ := ret[0].([]QueuedLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockLogTXRecorder) PeekLeaves(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "PeekLeaves", arg0, arg1)
+}
+
 func (_m *MockLogTX) QueueLeaves(_param0 []trillian.LogLeaf, _param1 time.Time) error {
 	ret := _m.ctrl.Call(_m, "QueueLeaves", _param0, _param1)
 	ret0, _ := ret[0].(error)
@@ -190,6 +266,48 @@ func (_mr *_MockLogTXRecorder) SetMerkleNodes(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetMerkleNodes", arg0)
 }
 
+func (_m *MockLogTX) SetTreeACL(_param0 TreeACL) error {
+	ret := _m.ctrl.Call(_m, "SetTreeACL", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockLogTXRecorder) SetTreeACL(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetTreeACL", arg0)
+}
+
+func (_m *MockLogTX) SignedLogRootBySize(_param0 int64) (trillian.SignedLogRoot, error) {
+	ret := _m.ctrl.Call(_m, "SignedLogRootBySize", _param0)
+	ret0, _ := ret[0].(trillian.SignedLogRoot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockLogTXRecorder) SignedLogRootBySize(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SignedLogRootBySize", arg0)
+}
+
+func (_m *MockLogTX) SignedLogRootByTimestamp(_param0 int64) (trillian.SignedLogRoot, error) {
+	ret := _m.ctrl.Call(_m, "SignedLogRootByTimestamp", _param0)
+	ret0, _ := ret[0].(trillian.SignedLogRoot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockLogTXRecorder) SignedLogRootByTimestamp(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SignedLogRootByTimestamp", arg0)
+}
+
+func (_m *MockLogTX) StoreCompactRange(_param0 int64, _param1 [][]byte) error {
+	ret := _m.ctrl.Call(_m, "StoreCompactRange", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockLogTXRecorder) StoreCompactRange(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "StoreCompactRange", arg0, arg1)
+}
+
 func (_m *MockLogTX) StoreSignedLogRoot(_param0 trillian.SignedLogRoot) error {
 	ret := _m.ctrl.Call(_m, "StoreSignedLogRoot", _param0)
 	ret0, _ := ret[0].(error)
@@ -273,6 +391,17 @@ func (_mr *_MockMapTXRecorder) GetMerkleNodes(arg0, arg1 interface{}) *gomock.Ca
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMerkleNodes", arg0, arg1)
 }
 
+func (_m *MockMapTX) GetTreeACL() (TreeACL, error) {
+	ret := _m.ctrl.Call(_m, "GetTreeACL")
+	ret0, _ := ret[0].(TreeACL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockMapTXRecorder) GetTreeACL() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTreeACL")
+}
+
 func (_m *MockMapTX) GetTreeRevisionAtSize(_param0 int64) (int64, error) {
 	ret := _m.ctrl.Call(_m, "GetTreeRevisionAtSize", _param0)
 	ret0, _ := ret[0].(int64)
@@ -335,6 +464,16 @@ func (_mr *_MockMapTXRecorder) SetMerkleNodes(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetMerkleNodes", arg0)
 }
 
+func (_m *MockMapTX) SetTreeACL(_param0 TreeACL) error {
+	ret := _m.ctrl.Call(_m, "SetTreeACL", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+func (_mr *_MockMapTXRecorder) SetTreeACL(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SetTreeACL", arg0)
+}
+
 func (_m *MockMapTX) StoreSignedMapRoot(_param0 trillian.SignedMapRoot) error {
 	ret := _m.ctrl.Call(_m, "StoreSignedMapRoot", _param0)
 	ret0, _ := ret[0].(error)
@@ -386,6 +525,17 @@ func (_mr *_MockReadOnlyLogTXRecorder) Commit() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Commit")
 }
 
+func (_m *MockReadOnlyLogTX) GetCompactRange(_param0 int64) ([][]byte, error) {
+	ret := _m.ctrl.Call(_m, "GetCompactRange", _param0)
+	ret0, _ := ret[0].([][]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyLogTXRecorder) GetCompactRange(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetCompactRange", arg0)
+}
+
 func (_m *MockReadOnlyLogTX) GetLeavesByHash(_param0 [][]byte, _param1 bool) ([]trillian.LogLeaf, error) {
 	ret := _m.ctrl.Call(_m, "GetLeavesByHash", _param0, _param1)
 	ret0, _ := ret[0].([]trillian.LogLeaf)
@@ -397,6 +547,17 @@ func (_mr *_MockReadOnlyLogTXRecorder) GetLeavesByHash(arg0, arg1 interface{}) *
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeavesByHash", arg0, arg1)
 }
 
+func (_m *MockReadOnlyLogTX) GetLeavesByIdentityHash(_param0 [][]byte) ([]trillian.LogLeaf, error) {
+	ret := _m.ctrl.Call(_m, "GetLeavesByIdentityHash", _param0)
+	ret0, _ := ret[0].([]trillian.LogLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyLogTXRecorder) GetLeavesByIdentityHash(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetLeavesByIdentityHash", arg0)
+}
+
 func (_m *MockReadOnlyLogTX) GetLeavesByIndex(_param0 []int64) ([]trillian.LogLeaf, error) {
 	ret := _m.ctrl.Call(_m, "GetLeavesByIndex", _param0)
 	ret0, _ := ret[0].([]trillian.LogLeaf)
@@ -430,6 +591,28 @@ func (_mr *_MockReadOnlyLogTXRecorder) GetMerkleNodes(arg0, arg1 interface{}) *g
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMerkleNodes", arg0, arg1)
 }
 
+func (_m *MockReadOnlyLogTX) GetQueuedLeavesByCorrelationID(_param0 string) ([]QueuedLeaf, error) {
+	ret := _m.ctrl.Call(_m, "GetQueuedLeavesByCorrelationID", _param0)
+	ret0, _ := ret[0].([]QueuedLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyLogTXRecorder) GetQueuedLeavesByCorrelationID(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetQueuedLeavesByCorrelationID", arg0)
+}
+
+func (_m *MockReadOnlyLogTX) GetQueuedLeavesByHash(_param0 [][]byte) ([]QueuedLeaf, error) {
+	ret := _m.ctrl.Call(_m, "GetQueuedLeavesByHash", _param0)
+	ret0, _ := ret[0].([]QueuedLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyLogTXRecorder) GetQueuedLeavesByHash(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetQueuedLeavesByHash", arg0)
+}
+
 func (_m *MockReadOnlyLogTX) GetSequencedLeafCount() (int64, error) {
 	ret := _m.ctrl.Call(_m, "GetSequencedLeafCount")
 	ret0, _ := ret[0].(int64)
@@ -441,6 +624,17 @@ func (_mr *_MockReadOnlyLogTXRecorder) GetSequencedLeafCount() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetSequencedLeafCount")
 }
 
+func (_m *MockReadOnlyLogTX) GetTreeACL() (TreeACL, error) {
+	ret := _m.ctrl.Call(_m, "GetTreeACL")
+	ret0, _ := ret[0].(TreeACL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyLogTXRecorder) GetTreeACL() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTreeACL")
+}
+
 func (_m *MockReadOnlyLogTX) GetTreeRevisionAtSize(_param0 int64) (int64, error) {
 	ret := _m.ctrl.Call(_m, "GetTreeRevisionAtSize", _param0)
 	ret0, _ := ret[0].(int64)
@@ -463,6 +657,17 @@ func (_mr *_MockReadOnlyLogTXRecorder) LatestSignedLogRoot() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "LatestSignedLogRoot")
 }
 
+func (_m *MockReadOnlyLogTX) PeekLeaves(_param0 int, _param1 time.Time) ([]QueuedLeaf, error) {
+	ret := _m.ctrl.Call(_m, "PeekLeaves", _param0, _param1)
+	ret0, _ := ret[0].([]QueuedLeaf)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyLogTXRecorder) PeekLeaves(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "PeekLeaves", arg0, arg1)
+}
+
 func (_m *MockReadOnlyLogTX) Rollback() error {
 	ret := _m.ctrl.Call(_m, "Rollback")
 	ret0, _ := ret[0].(error)
@@ -473,6 +678,28 @@ func (_mr *_MockReadOnlyLogTXRecorder) Rollback() *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Rollback")
 }
 
+func (_m *MockReadOnlyLogTX) SignedLogRootBySize(_param0 int64) (trillian.SignedLogRoot, error) {
+	ret := _m.ctrl.Call(_m, "SignedLogRootBySize", _param0)
+	ret0, _ := ret[0].(trillian.SignedLogRoot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyLogTXRecorder) SignedLogRootBySize(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SignedLogRootBySize", arg0)
+}
+
+func (_m *MockReadOnlyLogTX) SignedLogRootByTimestamp(_param0 int64) (trillian.SignedLogRoot, error) {
+	ret := _m.ctrl.Call(_m, "SignedLogRootByTimestamp", _param0)
+	ret0, _ := ret[0].(trillian.SignedLogRoot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyLogTXRecorder) SignedLogRootByTimestamp(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "SignedLogRootByTimestamp", arg0)
+}
+
 // Mock of ReadOnlyMapTX interface
 type MockReadOnlyMapTX struct {
 	ctrl     *gomock.Controller
@@ -526,6 +753,17 @@ func (_mr *_MockReadOnlyMapTXRecorder) GetMerkleNodes(arg0, arg1 interface{}) *g
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetMerkleNodes", arg0, arg1)
 }
 
+func (_m *MockReadOnlyMapTX) GetTreeACL() (TreeACL, error) {
+	ret := _m.ctrl.Call(_m, "GetTreeACL")
+	ret0, _ := ret[0].(TreeACL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockReadOnlyMapTXRecorder) GetTreeACL() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetTreeACL")
+}
+
 func (_m *MockReadOnlyMapTX) GetTreeRevisionAtSize(_param0 int64) (int64, error) {
 	ret := _m.ctrl.Call(_m, "GetTreeRevisionAtSize", _param0)
 	ret0, _ := ret[0].(int64)
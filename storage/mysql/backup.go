@@ -0,0 +1,444 @@
+package mysql
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/merkle"
+)
+
+const selectLatestTreeHeadForBackupSQL string = `SELECT TreeSize,RootHash,TreeRevision
+		 FROM TreeHead WHERE TreeId=?
+		 ORDER BY TreeRevision DESC LIMIT 1`
+const selectTreeForBackupSQL string = `SELECT KeyId,TreeType,LeafHasherType,TreeHasherType,AllowsDuplicateLeaves
+		 FROM Trees WHERE TreeId=?`
+const selectTreeHeadsForBackupSQL string = `SELECT TreeHeadTimestamp,TreeSize,RootHash,RootSignature,TreeRevision
+		 FROM TreeHead WHERE TreeId=? AND TreeRevision>? AND TreeRevision<=?
+		 ORDER BY TreeRevision`
+const selectSubtreesForBackupSQL string = `SELECT SubtreeId,Nodes,SubtreeRevision
+		 FROM Subtree WHERE TreeId=? AND SubtreeRevision>? AND SubtreeRevision<=?
+		 ORDER BY SubtreeRevision,SubtreeId`
+const selectLeavesForBackupSQL string = `SELECT s.SequenceNumber,s.LeafValueHash,s.MerkleLeafHash,l.LeafValue,l.ExtraData,l.LeafIdentityHash
+		 FROM SequencedLeafData s INNER JOIN LeafData l
+		 ON s.TreeId=l.TreeId AND s.LeafValueHash=l.LeafValueHash
+		 WHERE s.TreeId=? AND s.SequenceNumber>=? AND s.SequenceNumber<?
+		 ORDER BY s.SequenceNumber`
+
+const insertTreeForRestoreSQL string = `INSERT INTO Trees(TreeId,KeyId,TreeType,LeafHasherType,TreeHasherType,AllowsDuplicateLeaves)
+		 VALUES(?,?,?,?,?,?)`
+const insertSubtreeForRestoreSQL string = `INSERT INTO Subtree(TreeId,SubtreeId,Nodes,SubtreeRevision)
+		 VALUES(?,?,?,?)`
+const insertLeafDataForRestoreSQL string = `INSERT INTO LeafData(TreeId,LeafValueHash,LeafValue,ExtraData,LeafIdentityHash)
+		 VALUES(?,?,?,?,?) ON DUPLICATE KEY UPDATE LeafValueHash=LeafValueHash`
+const selectLatestTreeRevisionForRestoreSQL string = "SELECT COALESCE(MAX(TreeRevision), -1) FROM TreeHead WHERE TreeId=?"
+
+// BackupManifest describes the contents of one backup of a log tree. A full backup holds
+// everything up to ToRevision; an incremental backup holds only what was written after
+// the backup named by PreviousManifestHash, so a tree is restored by applying a full
+// backup followed by each incremental backup in the chain, in order.
+type BackupManifest struct {
+	// TreeID is the tree that was backed up.
+	TreeID int64
+	// FromRevision is the tree revision of the previous backup in the chain, or -1 for a
+	// full backup. Data at or before this revision is not included.
+	FromRevision int64
+	// ToRevision is the latest tree revision included in the backup.
+	ToRevision int64
+	// FromTreeSize is the tree size at FromRevision, and so the index of the first leaf in
+	// the backup.
+	FromTreeSize int64
+	// ToTreeSize is the tree size at ToRevision.
+	ToTreeSize int64
+	// RootHash is the root hash of the tree at ToRevision. Restores recompute it from the
+	// leaves they've written and refuse to commit if it doesn't match.
+	RootHash []byte
+	// PreviousManifestHash is the Hash of the manifest of the previous backup in the chain,
+	// or nil for a full backup.
+	PreviousManifestHash []byte
+	// DataHash is the SHA-256 hash of the backup data stream.
+	DataHash []byte
+	// The number of records of each type in the data stream.
+	TreeHeads int64
+	Subtrees  int64
+	Leaves    int64
+}
+
+// Full returns true if the manifest describes a full, rather than incremental, backup.
+func (m *BackupManifest) Full() bool {
+	return m.PreviousManifestHash == nil
+}
+
+// Hash returns the SHA-256 hash of the JSON encoding of the manifest. The next backup in
+// the chain records it to link back to this one.
+func (m *BackupManifest) Hash() ([]byte, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(b)
+	return h[:], nil
+}
+
+// Follows returns an error if m can't be applied directly after prev.
+func (m *BackupManifest) Follows(prev *BackupManifest) error {
+	if prev == nil {
+		if !m.Full() {
+			return errors.New("incremental backup has no previous backup")
+		}
+		return nil
+	}
+	prevHash, err := prev.Hash()
+	if err != nil {
+		return err
+	}
+	switch {
+	case m.Full():
+		return errors.New("full backup can't follow another backup")
+	case !bytes.Equal(m.PreviousManifestHash, prevHash):
+		return fmt.Errorf("backup of revision %d does not chain to backup of revision %d", m.ToRevision, prev.ToRevision)
+	case m.TreeID != prev.TreeID:
+		return fmt.Errorf("backup is of tree %d, previous backup is of tree %d", m.TreeID, prev.TreeID)
+	case m.FromRevision != prev.ToRevision || m.FromTreeSize != prev.ToTreeSize:
+		return fmt.Errorf("backup starts at revision %d size %d, previous backup ends at revision %d size %d",
+			m.FromRevision, m.FromTreeSize, prev.ToRevision, prev.ToTreeSize)
+	}
+	return nil
+}
+
+// backupRecord is the unit of the backup data stream. Exactly one field is set.
+type backupRecord struct {
+	Tree     *backupTree
+	TreeHead *backupTreeHead
+	Subtree  *backupSubtree
+	Leaf     *backupLeaf
+}
+
+type backupTree struct {
+	KeyID                 []byte
+	TreeType              string
+	LeafHasherType        string
+	TreeHasherType        string
+	AllowsDuplicateLeaves bool
+}
+
+type backupTreeHead struct {
+	Timestamp     int64
+	TreeSize      int64
+	RootHash      []byte
+	RootSignature []byte
+	TreeRevision  int64
+}
+
+type backupSubtree struct {
+	SubtreeID []byte
+	Nodes     []byte
+	Revision  int64
+}
+
+type backupLeaf struct {
+	SequenceNumber int64
+	LeafValueHash  []byte
+	MerkleLeafHash []byte
+	LeafValue      []byte
+	ExtraData      []byte
+	// LeafIdentityHash is nil for leaves without one, including all those in backups
+	// made before it was added.
+	LeafIdentityHash []byte
+}
+
+// hashingWriter passes writes through to w while hashing them.
+type hashingWriter struct {
+	w io.Writer
+	h hash.Hash
+}
+
+func (hw hashingWriter) Write(p []byte) (int, error) {
+	hw.h.Write(p)
+	return hw.w.Write(p)
+}
+
+// ExportLogBackup writes a backup of the log tree treeID to w and returns its manifest. If
+// prev is nil a full backup is written, otherwise only the tree heads, subtrees and leaves
+// written since prev are included. The export reads from a single transaction so it's a
+// consistent snapshot of the tree, and it doesn't block the sequencer. Tree control
+// settings are not included.
+func ExportLogBackup(db *sql.DB, treeID int64, prev *BackupManifest, w io.Writer) (*BackupManifest, error) {
+	m := &BackupManifest{TreeID: treeID, FromRevision: -1}
+	if prev != nil {
+		if prev.TreeID != treeID {
+			return nil, fmt.Errorf("previous backup is of tree %d, not %d", prev.TreeID, treeID)
+		}
+		prevHash, err := prev.Hash()
+		if err != nil {
+			return nil, err
+		}
+		m.FromRevision = prev.ToRevision
+		m.FromTreeSize = prev.ToTreeSize
+		m.PreviousManifestHash = prevHash
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// The transaction is only ever read from.
+	defer tx.Rollback()
+
+	if err := tx.QueryRow(selectLatestTreeHeadForBackupSQL, treeID).Scan(&m.ToTreeSize, &m.RootHash, &m.ToRevision); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("tree %d has no tree head to back up", treeID)
+		}
+		return nil, err
+	}
+	if m.ToRevision < m.FromRevision || m.ToTreeSize < m.FromTreeSize {
+		return nil, fmt.Errorf("tree %d is at revision %d size %d, behind previous backup at revision %d size %d",
+			treeID, m.ToRevision, m.ToTreeSize, m.FromRevision, m.FromTreeSize)
+	}
+
+	hw := hashingWriter{w: w, h: sha256.New()}
+	enc := gob.NewEncoder(hw)
+
+	if m.Full() {
+		var t backupTree
+		if err := tx.QueryRow(selectTreeForBackupSQL, treeID).Scan(&t.KeyID, &t.TreeType, &t.LeafHasherType, &t.TreeHasherType, &t.AllowsDuplicateLeaves); err != nil {
+			return nil, fmt.Errorf("failed to read tree %d: %v", treeID, err)
+		}
+		if err := enc.Encode(backupRecord{Tree: &t}); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := tx.Query(selectTreeHeadsForBackupSQL, treeID, m.FromRevision, m.ToRevision)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var th backupTreeHead
+		if err := rows.Scan(&th.Timestamp, &th.TreeSize, &th.RootHash, &th.RootSignature, &th.TreeRevision); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := enc.Encode(backupRecord{TreeHead: &th}); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		m.TreeHeads++
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(selectSubtreesForBackupSQL, treeID, m.FromRevision, m.ToRevision)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var st backupSubtree
+		if err := rows.Scan(&st.SubtreeID, &st.Nodes, &st.Revision); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := enc.Encode(backupRecord{Subtree: &st}); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		m.Subtrees++
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(selectLeavesForBackupSQL, treeID, m.FromTreeSize, m.ToTreeSize)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var l backupLeaf
+		if err := rows.Scan(&l.SequenceNumber, &l.LeafValueHash, &l.MerkleLeafHash, &l.LeafValue, &l.ExtraData, &l.LeafIdentityHash); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := enc.Encode(backupRecord{Leaf: &l}); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		m.Leaves++
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, err
+	}
+
+	if got, want := m.Leaves, m.ToTreeSize-m.FromTreeSize; got != want {
+		return nil, fmt.Errorf("tree %d has %d sequenced leaves in [%d, %d), want %d", treeID, got, m.FromTreeSize, m.ToTreeSize, want)
+	}
+
+	m.DataHash = hw.h.Sum(nil)
+	glog.Infof("Exported backup of tree %d revisions (%d, %d]: %d tree heads, %d subtrees, %d leaves",
+		treeID, m.FromRevision, m.ToRevision, m.TreeHeads, m.Subtrees, m.Leaves)
+	return m, nil
+}
+
+// closeRows closes rows and returns any error encountered while iterating over them.
+func closeRows(rows *sql.Rows) error {
+	err := rows.Err()
+	rows.Close()
+	return err
+}
+
+// BackupRestorer rebuilds a log tree from a chain of backups. The first backup applied
+// must be a full backup, and the tree being restored into must not already exist.
+type BackupRestorer struct {
+	db     *sql.DB
+	treeID int64
+	hasher merkle.TreeHasher
+	// tree holds the compact Merkle tree over all the leaves restored so far, so each
+	// backup's root can be checked without reading back from storage.
+	tree *merkle.CompactMerkleTree
+	last *BackupManifest
+}
+
+// NewBackupRestorer creates a BackupRestorer that writes into treeID, which need not be the
+// ID of the tree that was backed up.
+func NewBackupRestorer(db *sql.DB, treeID int64, hasher merkle.TreeHasher) *BackupRestorer {
+	return &BackupRestorer{
+		db:     db,
+		treeID: treeID,
+		hasher: hasher,
+		tree:   merkle.NewCompactMerkleTree(hasher),
+	}
+}
+
+// Apply restores the backup described by m from data. The backup must follow the last one
+// applied. Everything is written in a single transaction, which is only committed if the
+// data matches the manifest and the root hash computed over the restored leaves matches
+// the backed up tree head. If Apply fails nothing is written and the restorer should be
+// discarded.
+func (r *BackupRestorer) Apply(m *BackupManifest, data io.Reader) error {
+	if err := m.Follows(r.last); err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := r.applyInTx(tx, m, data); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	glog.Infof("Restored backup of tree %d revisions (%d, %d] into tree %d, size %d", m.TreeID, m.FromRevision, m.ToRevision, r.treeID, m.ToTreeSize)
+	r.last = m
+	return nil
+}
+
+func (r *BackupRestorer) applyInTx(tx *sql.Tx, m *BackupManifest, data io.Reader) error {
+	if m.Full() {
+		var rev int64
+		if err := tx.QueryRow(selectLatestTreeRevisionForRestoreSQL, r.treeID).Scan(&rev); err != nil {
+			return err
+		}
+		if rev >= 0 {
+			return fmt.Errorf("tree %d already has data at revision %d", r.treeID, rev)
+		}
+	}
+
+	h := sha256.New()
+	dec := gob.NewDecoder(io.TeeReader(data, h))
+	var counts BackupManifest
+	var lastHead *backupTreeHead
+	setNode := func(depth int, index int64, hash []byte) {}
+
+	for {
+		var rec backupRecord
+		if err := dec.Decode(&rec); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("failed to read backup data: %v", err)
+		}
+
+		switch {
+		case rec.Tree != nil:
+			if !m.Full() {
+				return errors.New("incremental backup contains tree parameters")
+			}
+			t := rec.Tree
+			if _, err := tx.Exec(insertTreeForRestoreSQL, r.treeID, t.KeyID, t.TreeType, t.LeafHasherType, t.TreeHasherType, t.AllowsDuplicateLeaves); err != nil {
+				return fmt.Errorf("failed to create tree %d: %v", r.treeID, err)
+			}
+
+		case rec.TreeHead != nil:
+			th := rec.TreeHead
+			if th.TreeRevision <= m.FromRevision || th.TreeRevision > m.ToRevision {
+				return fmt.Errorf("tree head at revision %d outside backup range (%d, %d]", th.TreeRevision, m.FromRevision, m.ToRevision)
+			}
+			if _, err := tx.Exec(insertTreeHeadSQL, r.treeID, th.Timestamp, th.TreeSize, th.RootHash, th.TreeRevision, th.RootSignature); err != nil {
+				return fmt.Errorf("failed to write tree head at revision %d: %v", th.TreeRevision, err)
+			}
+			lastHead = th
+			counts.TreeHeads++
+
+		case rec.Subtree != nil:
+			st := rec.Subtree
+			if st.Revision <= m.FromRevision || st.Revision > m.ToRevision {
+				return fmt.Errorf("subtree at revision %d outside backup range (%d, %d]", st.Revision, m.FromRevision, m.ToRevision)
+			}
+			if _, err := tx.Exec(insertSubtreeForRestoreSQL, r.treeID, st.SubtreeID, st.Nodes, st.Revision); err != nil {
+				return fmt.Errorf("failed to write subtree at revision %d: %v", st.Revision, err)
+			}
+			counts.Subtrees++
+
+		case rec.Leaf != nil:
+			l := rec.Leaf
+			if got, want := l.SequenceNumber, r.tree.Size(); got != want {
+				return fmt.Errorf("got leaf %d, want leaf %d", got, want)
+			}
+			var identityHash interface{}
+			if len(l.LeafIdentityHash) > 0 {
+				identityHash = l.LeafIdentityHash
+			}
+			if _, err := tx.Exec(insertLeafDataForRestoreSQL, r.treeID, l.LeafValueHash, l.LeafValue, l.ExtraData, identityHash); err != nil {
+				return fmt.Errorf("failed to write leaf data %d: %v", l.SequenceNumber, err)
+			}
+			if _, err := tx.Exec(insertSequencedLeafSQL, r.treeID, l.LeafValueHash, l.MerkleLeafHash, l.SequenceNumber); err != nil {
+				return fmt.Errorf("failed to write sequenced leaf %d: %v", l.SequenceNumber, err)
+			}
+			r.tree.AddLeafHash(l.MerkleLeafHash, setNode)
+			counts.Leaves++
+
+		default:
+			return errors.New("empty backup record")
+		}
+	}
+
+	if got, want := h.Sum(nil), m.DataHash; !bytes.Equal(got, want) {
+		return fmt.Errorf("backup data hash %x does not match manifest %x", got, want)
+	}
+	if counts.TreeHeads != m.TreeHeads || counts.Subtrees != m.Subtrees || counts.Leaves != m.Leaves {
+		return fmt.Errorf("backup has %d tree heads, %d subtrees, %d leaves, manifest says %d, %d, %d",
+			counts.TreeHeads, counts.Subtrees, counts.Leaves, m.TreeHeads, m.Subtrees, m.Leaves)
+	}
+	if got, want := r.tree.Size(), m.ToTreeSize; got != want {
+		return fmt.Errorf("restored tree size %d, want %d", got, want)
+	}
+	if got, want := r.tree.CurrentRoot(), m.RootHash; !bytes.Equal(got, want) {
+		return fmt.Errorf("restored root hash %x does not match backup %x", got, want)
+	}
+	if lastHead != nil && (lastHead.TreeRevision != m.ToRevision || !bytes.Equal(lastHead.RootHash, m.RootHash)) {
+		return fmt.Errorf("latest tree head in backup is revision %d root %x, manifest says revision %d root %x",
+			lastHead.TreeRevision, lastHead.RootHash, m.ToRevision, m.RootHash)
+	}
+	return nil
+}
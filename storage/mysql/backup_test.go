@@ -0,0 +1,141 @@
+package mysql
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+)
+
+func TestBackupManifestFollows(t *testing.T) {
+	full := &BackupManifest{TreeID: 5, FromRevision: -1, ToRevision: 3, ToTreeSize: 10, DataHash: []byte("full")}
+	fullHash, err := full.Hash()
+	if err != nil {
+		t.Fatalf("Hash()=%v", err)
+	}
+	next := func(f func(m *BackupManifest)) *BackupManifest {
+		m := &BackupManifest{TreeID: 5, FromRevision: 3, ToRevision: 6, FromTreeSize: 10, ToTreeSize: 12, PreviousManifestHash: fullHash}
+		if f != nil {
+			f(m)
+		}
+		return m
+	}
+
+	var tests = []struct {
+		descr   string
+		m, prev *BackupManifest
+		wantErr bool
+	}{
+		{descr: "full first", m: full},
+		{descr: "incremental first", m: next(nil), wantErr: true},
+		{descr: "incremental", m: next(nil), prev: full},
+		{descr: "full second", m: full, prev: full, wantErr: true},
+		{descr: "wrong hash", m: next(func(m *BackupManifest) { m.PreviousManifestHash = []byte("wrong") }), prev: full, wantErr: true},
+		{descr: "wrong tree", m: next(func(m *BackupManifest) { m.TreeID = 6 }), prev: full, wantErr: true},
+		{descr: "gap", m: next(func(m *BackupManifest) { m.FromRevision = 4 }), prev: full, wantErr: true},
+		{descr: "wrong size", m: next(func(m *BackupManifest) { m.FromTreeSize = 9 }), prev: full, wantErr: true},
+	}
+
+	for _, test := range tests {
+		if err := test.m.Follows(test.prev); (err != nil) != test.wantErr {
+			t.Errorf("Follows(%s)=%v, want error: %v", test.descr, err, test.wantErr)
+		}
+	}
+}
+
+// addBackupTestLeaves creates leaves [start, end) in the tree, adding them to mt, and
+// stores a tree head and subtree at revision. Even numbered leaves have an identity hash.
+func addBackupTestLeaves(t *testing.T, treeID int64, mt *merkle.CompactMerkleTree, start, end, revision int64) {
+	db := openTestDBOrDie()
+	defer db.Close()
+	for seq := start; seq < end; seq++ {
+		data := []byte(fmt.Sprintf("leaf %d", seq))
+		rawHash := crypto.NewSHA256().Digest(data)
+		_, hash := mt.AddLeaf(data, func(int, int64, []byte) {})
+		createFakeLeaf(db, treeID, rawHash, hash, data, nil, seq, t)
+		if seq%2 == 0 {
+			if _, err := db.Exec("UPDATE LeafData SET LeafIdentityHash=? WHERE TreeId=? AND LeafValueHash=?",
+				[]byte(fmt.Sprintf("id %d", seq)), treeID, rawHash); err != nil {
+				t.Fatalf("Failed to set identity hash: %v", err)
+			}
+		}
+	}
+	if _, err := db.Exec(insertTreeHeadSQL, treeID, 1000+revision, end, mt.CurrentRoot(), revision, []byte("sig")); err != nil {
+		t.Fatalf("Failed to write tree head: %v", err)
+	}
+	if _, err := db.Exec(insertSubtreeForRestoreSQL, treeID, []byte("subtree"), []byte(fmt.Sprintf("nodes %d", revision)), revision); err != nil {
+		t.Fatalf("Failed to write subtree: %v", err)
+	}
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	src := createLogID("TestBackupRoundTrip")
+	dst := createLogID("TestBackupRoundTripRestored")
+	db := prepareTestLogDB(src, t)
+	defer db.Close()
+	prepareTestTreeDB(dst.logID, t).Close()
+
+	hasher := merkle.NewRFC6962TreeHasher(crypto.NewSHA256())
+	mt := merkle.NewCompactMerkleTree(hasher)
+	addBackupTestLeaves(t, src.logID, mt, 0, 5, 1)
+
+	var fullData bytes.Buffer
+	full, err := ExportLogBackup(db, src.logID, nil, &fullData)
+	if err != nil {
+		t.Fatalf("ExportLogBackup(full)=%v", err)
+	}
+	if full.Leaves != 5 || full.TreeHeads != 1 || full.Subtrees != 1 {
+		t.Errorf("ExportLogBackup(full)=%+v, want 5 leaves, 1 tree head, 1 subtree", full)
+	}
+
+	addBackupTestLeaves(t, src.logID, mt, 5, 8, 2)
+
+	var incData bytes.Buffer
+	inc, err := ExportLogBackup(db, src.logID, full, &incData)
+	if err != nil {
+		t.Fatalf("ExportLogBackup(incremental)=%v", err)
+	}
+	if inc.Leaves != 3 || inc.TreeHeads != 1 || inc.Subtrees != 1 {
+		t.Errorf("ExportLogBackup(incremental)=%+v, want 3 leaves, 1 tree head, 1 subtree", inc)
+	}
+
+	// Restoring out of order or with modified data must fail without writing anything.
+	r := NewBackupRestorer(db, dst.logID, hasher)
+	if err := r.Apply(inc, bytes.NewReader(incData.Bytes())); err == nil {
+		t.Error("Apply(incremental) with no full backup=nil, want error")
+	}
+	corrupt := append([]byte(nil), fullData.Bytes()...)
+	corrupt[len(corrupt)-1] ^= 1
+	if err := r.Apply(full, bytes.NewReader(corrupt)); err == nil {
+		t.Error("Apply(corrupt full backup)=nil, want error")
+	}
+
+	r = NewBackupRestorer(db, dst.logID, hasher)
+	if err := r.Apply(full, &fullData); err != nil {
+		t.Fatalf("Apply(full)=%v", err)
+	}
+	if err := r.Apply(inc, &incData); err != nil {
+		t.Fatalf("Apply(incremental)=%v", err)
+	}
+
+	s := prepareTestLogStorage(dst, t)
+	tx := beginLogTx(s, t)
+	defer tx.Commit()
+	root, err := tx.LatestSignedLogRoot()
+	if err != nil {
+		t.Fatalf("LatestSignedLogRoot()=%v", err)
+	}
+	if got, want := root.RootHash, mt.CurrentRoot(); root.TreeSize != 8 || !bytes.Equal(got, want) {
+		t.Errorf("LatestSignedLogRoot()=size %d root %x, want size 8 root %x", root.TreeSize, got, want)
+	}
+	leaves, err := tx.GetLeavesByIndex([]int64{0, 7})
+	if err != nil || len(leaves) != 2 {
+		t.Fatalf("GetLeavesByIndex()=%v, %v, want 2 leaves", leaves, err)
+	}
+	leaves, err = tx.GetLeavesByIdentityHash([][]byte{[]byte("id 6"), []byte("id 7")})
+	if err != nil || len(leaves) != 1 || string(leaves[0].LeafValue) != "leaf 6" {
+		t.Errorf("GetLeavesByIdentityHash()=%v, %v, want leaf 6", leaves, err)
+	}
+}
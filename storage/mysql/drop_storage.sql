@@ -4,10 +4,13 @@ DROP TABLE IF EXISTS Unsequenced;
 DROP TABLE IF EXISTS Subtree;
 DROP TABLE IF EXISTS SequencedLeafData;
 DROP TABLE IF EXISTS TreeHead;
+DROP TABLE IF EXISTS CompactRange;
+DROP TABLE IF EXISTS MigrationProgress;
 DROP TABLE IF EXISTS LeafData;
 DROP TABLE IF EXISTS MapLeaf;
 DROP TABLE IF EXISTS MapHead;
 DROP TABLE IF EXISTS TreeControl;
+DROP TABLE IF EXISTS TreeACL;
 DROP TABLE IF EXISTS MapHead;
 DROP TABLE IF EXISTS MapLeaf;
 DROP TABLE IF EXISTS Trees;
@@ -21,17 +21,25 @@ import (
 
 const getTreePropertiesSQL string = "SELECT AllowsDuplicateLeaves FROM Trees WHERE TreeId=?"
 const getTreeParametersSQL string = "SELECT ReadOnlyRequests From TreeControl WHERE TreeID=?"
-const selectQueuedLeavesSQL string = `SELECT LeafValueHash,MerkleLeafHash,Payload
+const selectQueuedLeavesSQL string = `SELECT LeafValueHash,MerkleLeafHash,Payload,MergeDeadlineNanos,MessageId,QueueTimestampNanos,CorrelationId
 		 FROM Unsequenced
 		 WHERE TreeID=?
 		 AND QueueTimestampNanos<=?
-		 ORDER BY QueueTimestampNanos,LeafValueHash ASC LIMIT ?`
-const insertUnsequencedLeafSQL string = `INSERT INTO LeafData(TreeId,LeafValueHash,LeafValue,ExtraData)
-		 VALUES(?,?,?,?) ON DUPLICATE KEY UPDATE LeafValueHash=LeafValueHash`
-const insertUnsequencedLeafSQLNoDuplicates string = `INSERT INTO LeafData(TreeId,LeafValueHash,LeafValue,ExtraData)
-		 VALUES(?,?,?,?)`
-const insertUnsequencedEntrySQL string = `INSERT INTO Unsequenced(TreeId,LeafValueHash,MerkleLeafHash,MessageId,Payload,QueueTimestampNanos)
-     VALUES(?,?,?,?,?,?)`
+		 ORDER BY MergeDeadlineNanos,QueueTimestampNanos,LeafValueHash ASC LIMIT ?`
+const selectQueuedLeavesByMerkleHashSQL string = `SELECT LeafValueHash,MerkleLeafHash,Payload,MergeDeadlineNanos,MessageId,QueueTimestampNanos,CorrelationId
+		 FROM Unsequenced
+		 WHERE MerkleLeafHash IN (` + placeholderSQL + `) AND TreeId = ?
+		 ORDER BY MergeDeadlineNanos,QueueTimestampNanos,LeafValueHash ASC`
+const selectQueuedLeavesByCorrelationIDSQL string = `SELECT LeafValueHash,MerkleLeafHash,Payload,MergeDeadlineNanos,MessageId,QueueTimestampNanos,CorrelationId
+		 FROM Unsequenced
+		 WHERE TreeId=? AND CorrelationId=?
+		 ORDER BY MergeDeadlineNanos,QueueTimestampNanos,LeafValueHash ASC`
+const insertUnsequencedLeafSQL string = `INSERT INTO LeafData(TreeId,LeafValueHash,LeafValue,ExtraData,LeafIdentityHash)
+		 VALUES(?,?,?,?,?) ON DUPLICATE KEY UPDATE LeafValueHash=LeafValueHash`
+const insertUnsequencedLeafSQLNoDuplicates string = `INSERT INTO LeafData(TreeId,LeafValueHash,LeafValue,ExtraData,LeafIdentityHash)
+		 VALUES(?,?,?,?,?)`
+const insertUnsequencedEntrySQL string = `INSERT INTO Unsequenced(TreeId,LeafValueHash,MerkleLeafHash,MessageId,Payload,QueueTimestampNanos,MergeDeadlineNanos,CorrelationId)
+     VALUES(?,?,?,?,?,?,?,?)`
 const insertSequencedLeafSQL string = `INSERT INTO SequencedLeafData(TreeId,LeafValueHash,MerkleLeafHash,SequenceNumber)
 		 VALUES(?,?,?,?)`
 const selectSequencedLeafCountSQL string = "SELECT COUNT(*) FROM SequencedLeafData WHERE TreeId=?"
@@ -39,9 +47,23 @@ const selectLatestSignedLogRootSQL string = `SELECT TreeHeadTimestamp,TreeSize,R
 		 FROM TreeHead WHERE TreeId=?
 		 ORDER BY TreeHeadTimestamp DESC LIMIT 1`
 
+// selectLatestSignedLogRootForUpdateSQL is only used while holding the tree lock, so the
+// shared locks it takes don't hold up other writers of the tree head.
+const selectLatestSignedLogRootForUpdateSQL string = selectLatestSignedLogRootSQL + " LOCK IN SHARE MODE"
+const selectSignedLogRootByTimestampSQL string = `SELECT TreeHeadTimestamp,TreeSize,RootHash,TreeRevision,RootSignature
+		 FROM TreeHead WHERE TreeId=? AND TreeHeadTimestamp>=?
+		 ORDER BY TreeHeadTimestamp ASC LIMIT 1`
+const selectSignedLogRootBySizeSQL string = `SELECT TreeHeadTimestamp,TreeSize,RootHash,TreeRevision,RootSignature
+		 FROM TreeHead WHERE TreeId=? AND TreeSize=?
+		 ORDER BY TreeHeadTimestamp ASC LIMIT 1`
+const selectCompactRangeSQL string = "SELECT Hashes FROM CompactRange WHERE TreeId=? AND TreeSize=?"
+const insertCompactRangeSQL string = `INSERT INTO CompactRange(TreeId,TreeSize,Hashes)
+		 VALUES(?,?,?) ON DUPLICATE KEY UPDATE Hashes=Hashes`
+
 // These statements need to be expanded to provide the correct number of parameter placeholders
 // for a particular case
 const deleteUnsequencedSQL string = "DELETE FROM Unsequenced WHERE LeafValueHash IN (<placeholder>) AND TreeId = ?"
+const deleteQueuedLeavesSQL string = "DELETE FROM Unsequenced WHERE TreeId = ? AND (LeafValueHash,MessageId) IN (<placeholder>)"
 const selectLeavesByIndexSQL string = `SELECT s.MerkleLeafHash,l.LeafValueHash,l.LeafValue,s.SequenceNumber,l.ExtraData
 		     FROM LeafData l,SequencedLeafData s
 		     WHERE l.LeafValueHash = s.LeafValueHash
@@ -50,6 +72,14 @@ const selectLeavesByMerkleHashSQL string = `SELECT s.MerkleLeafHash,l.LeafValueH
 		     FROM LeafData l,SequencedLeafData s
 		     WHERE l.LeafValueHash = s.LeafValueHash
 		     AND s.MerkleLeafHash IN (` + placeholderSQL + `) AND l.TreeId = ? AND s.TreeId = l.TreeId`
+const selectLeavesByIdentityHashSQL string = `SELECT LeafIdentityHash,LeafValueHash,LeafValue,ExtraData
+		     FROM LeafData
+		     WHERE LeafIdentityHash IN (` + placeholderSQL + `) AND TreeId = ?`
+
+// selectLeafValueHashByIdentityHashSQL is a locking read so that it sees leaves committed
+// since the transaction started.
+const selectLeafValueHashByIdentityHashSQL string = `SELECT LeafValueHash FROM LeafData
+		     WHERE TreeId = ? AND LeafIdentityHash = ? LOCK IN SHARE MODE`
 const selectLeavesByValueHashSQL string = `SELECT s.MerkleLeafHash,l.LeafValueHash,l.LeafValue,s.SequenceNumber,l.ExtraData
 		     FROM LeafData l,SequencedLeafData s
 		     WHERE l.LeafValueHash = s.LeafValueHash
@@ -128,12 +158,24 @@ func (m *mySQLLogStorage) getLeavesByValueHashStmt(num int, orderBySequence bool
 	return m.getStmt(selectLeavesByValueHashSQL, num, "?", "?")
 }
 
+func (m *mySQLLogStorage) getLeavesByIdentityHashStmt(num int) (*sql.Stmt, error) {
+	return m.getStmt(selectLeavesByIdentityHashSQL, num, "?", "?")
+}
+
+func (m *mySQLLogStorage) getQueuedLeavesByMerkleHashStmt(num int) (*sql.Stmt, error) {
+	return m.getStmt(selectQueuedLeavesByMerkleHashSQL, num, "?", "?")
+}
+
 func (m *mySQLLogStorage) getDeleteUnsequencedStmt(num int) (*sql.Stmt, error) {
 	return m.getStmt(deleteUnsequencedSQL, num, "?", "?")
 }
 
+func (m *mySQLLogStorage) getDeleteQueuedLeavesStmt(num int) (*sql.Stmt, error) {
+	return m.getStmt(deleteQueuedLeavesSQL, num, "(?,?)", "(?,?)")
+}
+
 func (m *mySQLLogStorage) LatestSVignedLogRoot() (trillian.SignedLogRoot, error) {
-	t, err := m.Begin()
+	t, err := m.Snapshot()
 
 	if err != nil {
 		return trillian.SignedLogRoot{}, err
@@ -144,7 +186,7 @@ func (m *mySQLLogStorage) LatestSVignedLogRoot() (trillian.SignedLogRoot, error)
 }
 
 func (m *mySQLLogStorage) GetSequencedLeafCount() (int64, error) {
-	t, err := m.Begin()
+	t, err := m.Snapshot()
 
 	if err != nil {
 		return 0, err
@@ -155,7 +197,7 @@ func (m *mySQLLogStorage) GetSequencedLeafCount() (int64, error) {
 }
 
 func (m *mySQLLogStorage) GetLeavesByIndex(leaves []int64) ([]trillian.LogLeaf, error) {
-	t, err := m.Begin()
+	t, err := m.Snapshot()
 
 	if err != nil {
 		return []trillian.LogLeaf{}, err
@@ -165,7 +207,7 @@ func (m *mySQLLogStorage) GetLeavesByIndex(leaves []int64) ([]trillian.LogLeaf,
 }
 
 func (m *mySQLLogStorage) GetLeavesByHash(leafHashes [][]byte, orderBySequence bool) ([]trillian.LogLeaf, error) {
-	t, err := m.Begin()
+	t, err := m.Snapshot()
 
 	if err != nil {
 		return []trillian.LogLeaf{}, err
@@ -174,17 +216,25 @@ func (m *mySQLLogStorage) GetLeavesByHash(leafHashes [][]byte, orderBySequence b
 	return t.GetLeavesByHash(leafHashes, orderBySequence)
 }
 
-func (m *mySQLLogStorage) beginInternal() (storage.LogTX, error) {
+func (m *mySQLLogStorage) beginInternal(writable bool) (storage.LogTX, error) {
 	ttx, err := m.beginTreeTx()
 	if err != nil {
 		return nil, err
 	}
 	ret := &logTX{
-		treeTX: ttx,
-		ls:     m,
+		treeTX:   ttx,
+		ls:       m,
+		writable: writable,
+	}
+
+	// A writer doesn't read anything until it holds the tree lock. With REPEATABLE READ
+	// its first plain read fixes the snapshot it sees, and that snapshot has to include
+	// whatever the last holder of the lock committed. See lockForWrite.
+	if writable {
+		return ret, nil
 	}
 
-	root, err := ret.LatestSignedLogRoot()
+	root, err := ret.signedLogRoot(selectLatestSignedLogRootSQL, m.logID)
 	if err != nil {
 		ttx.Rollback()
 		return nil, err
@@ -202,11 +252,11 @@ func (m *mySQLLogStorage) Begin() (storage.LogTX, error) {
 		return nil, storage.ErrReadOnly
 	}
 
-	return m.beginInternal()
+	return m.beginInternal(true)
 }
 
 func (m *mySQLLogStorage) Snapshot() (storage.ReadOnlyLogTX, error) {
-	tx, err := m.beginInternal()
+	tx, err := m.beginInternal(false)
 	if err != nil {
 		return nil, err
 	}
@@ -216,6 +266,42 @@ func (m *mySQLLogStorage) Snapshot() (storage.ReadOnlyLogTX, error) {
 type logTX struct {
 	treeTX
 	ls *mySQLLogStorage
+	// writable is set for transactions from Begin, which take the tree lock in
+	// lockForWrite. locked is set once they hold it.
+	writable bool
+	locked   bool
+}
+
+// lockForWrite takes the tree lock, if this is a writable transaction that doesn't hold
+// it yet, and reads the latest root to set the revision the transaction writes at.
+// It's called by the operations that sequence leaves, read or write the tree head or
+// write Merkle nodes, so sequencing and signing serialize per tree. Other writers, such
+// as QueueLeaves, don't take the lock and so don't wait behind the sequencer.
+// The root is read with a locking read, which sees the latest committed root even if the
+// transaction's snapshot was already fixed by an earlier read.
+func (t *logTX) lockForWrite() error {
+	if !t.writable || t.locked {
+		return nil
+	}
+	if err := t.lockTree(); err != nil {
+		return err
+	}
+	t.locked = true
+	root, err := t.signedLogRoot(selectLatestSignedLogRootForUpdateSQL, t.ls.logID)
+	if err != nil {
+		return err
+	}
+	t.treeTX.writeRevision = root.TreeRevision + 1
+	return nil
+}
+
+// SetMerkleNodes takes the tree lock first, so the nodes are written at the revision
+// after the latest root.
+func (t *logTX) SetMerkleNodes(nodes []storage.Node) error {
+	if err := t.lockForWrite(); err != nil {
+		return err
+	}
+	return t.treeTX.SetMerkleNodes(nodes)
 }
 
 func (t *logTX) WriteRevision() int64 {
@@ -223,6 +309,61 @@ func (t *logTX) WriteRevision() int64 {
 }
 
 func (t *logTX) DequeueLeaves(limit int, cutoffTime time.Time) ([]trillian.LogLeaf, error) {
+	if err := t.lockForWrite(); err != nil {
+		return nil, err
+	}
+	queued, err := t.PeekLeaves(limit, cutoffTime)
+	if err != nil {
+		return nil, err
+	}
+	leaves := make([]trillian.LogLeaf, 0, len(queued))
+	for _, q := range queued {
+		leaves = append(leaves, q.LogLeaf)
+	}
+
+	// The convention is that if leaf processing succeeds (by committing this tx)
+	// then the unsequenced entries for them are removed
+	if len(leaves) > 0 {
+		err = t.removeSequencedLeaves(leaves)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return leaves, nil
+}
+
+// DequeuePeekedLeaves removes the queue entries for leaves, which are identified by their
+// leaf value hash and message ID.
+func (t *logTX) DequeuePeekedLeaves(leaves []storage.QueuedLeaf) error {
+	if err := t.lockForWrite(); err != nil {
+		return err
+	}
+	if len(leaves) == 0 {
+		return nil
+	}
+	tmpl, err := t.ls.getDeleteQueuedLeavesStmt(len(leaves))
+	if err != nil {
+		glog.Warningf("Failed to get delete statement for queued leaves: %s", err)
+		return err
+	}
+	args := []interface{}{t.ls.logID}
+	for _, leaf := range leaves {
+		args = append(args, leaf.LeafValueHash, leaf.QueueID)
+	}
+	result, err := t.tx.Stmt(tmpl).Exec(args...)
+	if err != nil {
+		// Error is handled by checkResultOkAndRowCountIs() below
+		glog.Warningf("Failed to delete queued leaves: %s", err)
+	}
+	return checkResultOkAndRowCountIs(result, err, int64(len(leaves)))
+}
+
+func (t *logTX) PeekLeaves(limit int, cutoffTime time.Time) ([]storage.QueuedLeaf, error) {
+	if err := t.lockForWrite(); err != nil {
+		return nil, err
+	}
 	stx, err := t.tx.Prepare(selectQueuedLeavesSQL)
 
 	if err != nil {
@@ -230,7 +371,6 @@ func (t *logTX) DequeueLeaves(limit int, cutoffTime time.Time) ([]trillian.LogLe
 		return nil, err
 	}
 
-	leaves := make([]trillian.LogLeaf, 0, limit)
 	rows, err := stx.Query(t.ls.logID, cutoffTime.UnixNano(), limit)
 
 	if err != nil {
@@ -238,14 +378,58 @@ func (t *logTX) DequeueLeaves(limit int, cutoffTime time.Time) ([]trillian.LogLe
 		return nil, err
 	}
 
+	return t.scanQueuedLeaves(rows)
+}
+
+// GetQueuedLeavesByHash doesn't lock the queue, as it's only for seeing what's there.
+func (t *logTX) GetQueuedLeavesByHash(merkleLeafHashes [][]byte) ([]storage.QueuedLeaf, error) {
+	if len(merkleLeafHashes) == 0 {
+		return nil, nil
+	}
+	tmpl, err := t.ls.getQueuedLeavesByMerkleHashStmt(len(merkleLeafHashes))
+	if err != nil {
+		return nil, err
+	}
+	var args []interface{}
+	for _, hash := range merkleLeafHashes {
+		args = append(args, interface{}(hash))
+	}
+	args = append(args, interface{}(t.ls.logID))
+	rows, err := t.tx.Stmt(tmpl).Query(args...)
+	if err != nil {
+		glog.Warningf("Query() queued leaves by hash = %v", err)
+		return nil, err
+	}
+	return t.scanQueuedLeaves(rows)
+}
+
+// GetQueuedLeavesByCorrelationID doesn't lock the queue, as it's only for seeing what's
+// there.
+func (t *logTX) GetQueuedLeavesByCorrelationID(correlationID string) ([]storage.QueuedLeaf, error) {
+	rows, err := t.tx.Query(selectQueuedLeavesByCorrelationIDSQL, t.ls.logID, correlationID)
+	if err != nil {
+		glog.Warningf("Query() queued leaves by correlation ID = %v", err)
+		return nil, err
+	}
+	return t.scanQueuedLeaves(rows)
+}
+
+// scanQueuedLeaves reads the queued leaves selected by one of the Unsequenced queries, and
+// closes rows.
+func (t *logTX) scanQueuedLeaves(rows *sql.Rows) ([]storage.QueuedLeaf, error) {
 	defer rows.Close()
 
+	leaves := make([]storage.QueuedLeaf, 0)
 	for rows.Next() {
 		var leafHash []byte
 		var merkleHash []byte
 		var payload []byte
+		var mergeDeadline int64
+		var messageID []byte
+		var queueTimestamp int64
+		var correlationID sql.NullString
 
-		err := rows.Scan(&leafHash, &merkleHash, &payload)
+		err := rows.Scan(&leafHash, &merkleHash, &payload, &mergeDeadline, &messageID, &queueTimestamp, &correlationID)
 
 		if err != nil {
 			glog.Warningf("Error scanning work rows: %s", err)
@@ -258,11 +442,17 @@ func (t *logTX) DequeueLeaves(limit int, cutoffTime time.Time) ([]trillian.LogLe
 
 		// Note: the ExtraData being nil here is OK as the sequencer only writes to the
 		// SequencedLeafData table and the client supplied value is already written to LeafData.
-		leaf := trillian.LogLeaf{
-			LeafValueHash:  leafHash,
-			MerkleLeafHash: merkleHash,
-			LeafValue:      payload,
-			ExtraData:      nil,
+		leaf := storage.QueuedLeaf{
+			LogLeaf: trillian.LogLeaf{
+				LeafValueHash:      leafHash,
+				MerkleLeafHash:     merkleHash,
+				LeafValue:          payload,
+				ExtraData:          nil,
+				MergeDeadlineNanos: mergeDeadline,
+				CorrelationId:      correlationID.String,
+			},
+			QueueID:        messageID,
+			QueueTimestamp: time.Unix(0, queueTimestamp),
 		}
 		leaves = append(leaves, leaf)
 	}
@@ -271,16 +461,6 @@ func (t *logTX) DequeueLeaves(limit int, cutoffTime time.Time) ([]trillian.LogLe
 		return nil, rows.Err()
 	}
 
-	// The convention is that if leaf processing succeeds (by committing this tx)
-	// then the unsequenced entries for them are removed
-	if len(leaves) > 0 {
-		err = t.removeSequencedLeaves(leaves)
-	}
-
-	if err != nil {
-		return nil, err
-	}
-
 	return leaves, nil
 }
 
@@ -314,8 +494,23 @@ func (t *logTX) QueueLeaves(leaves []trillian.LogLeaf, queueTimestamp time.Time)
 		// can suppress errors unrelated to key collisions. We don't use REPLACE because
 		// if there's ever a hash collision it will do the wrong thing and it also
 		// causes a DELETE / INSERT, which is undesirable.
-		_, err := t.tx.Exec(insertSQL, t.ls.logID, leaf.LeafValueHash, leaf.LeafValue, leaf.ExtraData)
-
+		// A leaf queued without an identity hash gets a NULL one, so it's never found by
+		// GetLeavesByIdentityHash.
+		var identityHash interface{}
+		if len(leaf.LeafIdentityHash) > 0 {
+			identityHash = leaf.LeafIdentityHash
+		}
+		res, err := t.tx.Exec(insertSQL, t.ls.logID, leaf.LeafValueHash, leaf.LeafValue, leaf.ExtraData, identityHash)
+
+		// LeafIdentityHashIdx is unique, so a leaf whose identity hash is taken fails to
+		// insert, or is skipped by the ON DUPLICATE KEY clause if duplicates are allowed.
+		if identityHash != nil && (err != nil || rowsAffected(res) == 0) {
+			if taken, terr := t.identityHashTaken(leaf.LeafIdentityHash, leaf.LeafValueHash); terr != nil {
+				return terr
+			} else if taken {
+				return storage.ErrDuplicateLeafIdentity
+			}
+		}
 		if err != nil {
 			glog.Warningf("Error inserting %d into LeafData: %s", i, err)
 			return fmt.Errorf("LeafData: %d, %v", i, err)
@@ -346,8 +541,20 @@ func (t *logTX) QueueLeaves(leaves []trillian.LogLeaf, queueTimestamp time.Time)
 		hasher.Write(leaf.LeafValueHash)
 		messageID := hasher.Sum(nil)
 
+		// Leaves without a deadline are due as soon as they're queued.
+		mergeDeadline := leaf.MergeDeadlineNanos
+		if mergeDeadline == 0 {
+			mergeDeadline = queueTimestamp.UnixNano()
+		}
+
+		// A leaf queued without a correlation ID gets a NULL one.
+		var correlationID interface{}
+		if len(leaf.CorrelationId) > 0 {
+			correlationID = leaf.CorrelationId
+		}
+
 		_, err = t.tx.Exec(insertUnsequencedEntrySQL,
-			t.ls.logID, leaf.LeafValueHash, leaf.MerkleLeafHash, messageID, leaf.LeafValue, queueTimestamp.UnixNano())
+			t.ls.logID, leaf.LeafValueHash, leaf.MerkleLeafHash, messageID, leaf.LeafValue, queueTimestamp.UnixNano(), mergeDeadline, correlationID)
 
 		if err != nil {
 			glog.Warningf("Error inserting into Unsequenced: %s", err)
@@ -358,6 +565,32 @@ func (t *logTX) QueueLeaves(leaves []trillian.LogLeaf, queueTimestamp time.Time)
 	return nil
 }
 
+// identityHashTaken returns whether identityHash belongs to a leaf in the log other than the
+// one with leafValueHash.
+func (t *logTX) identityHashTaken(identityHash, leafValueHash []byte) (bool, error) {
+	var existing []byte
+	err := t.tx.QueryRow(selectLeafValueHashByIdentityHashSQL, t.ls.logID, identityHash).Scan(&existing)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		glog.Warningf("LogID: %d Scan() leaf by identity hash = %s", t.ls.logID, err)
+		return false, err
+	}
+	return !bytes.Equal(existing, leafValueHash), nil
+}
+
+// rowsAffected returns the number of rows changed by a statement, or 0 if it failed.
+func rowsAffected(res sql.Result) int64 {
+	if res == nil {
+		return 0
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
 func (t *logTX) GetSequencedLeafCount() (int64, error) {
 	var sequencedLeafCount int64
 
@@ -387,25 +620,27 @@ func (t *logTX) GetLeavesByIndex(leaves []int64) ([]trillian.LogLeaf, error) {
 		return nil, err
 	}
 
-	ret := make([]trillian.LogLeaf, len(leaves))
-	num := 0
+	// Don't assume each index matches one row: if storage is inconsistent there may be
+	// more, and we want to report that rather than overrun.
+	ret := make([]trillian.LogLeaf, 0, len(leaves))
 
 	defer rows.Close()
 	for rows.Next() {
-		if err := rows.Scan(&ret[num].MerkleLeafHash, &ret[num].LeafValueHash, &ret[num].LeafValue, &ret[num].LeafIndex, &ret[num].ExtraData); err != nil {
+		var leaf trillian.LogLeaf
+		if err := rows.Scan(&leaf.MerkleLeafHash, &leaf.LeafValueHash, &leaf.LeafValue, &leaf.LeafIndex, &leaf.ExtraData); err != nil {
 			glog.Warningf("Failed to scan merkle leaves: %s", err)
 			return nil, err
 		}
 
-		if got, want := len(ret[num].MerkleLeafHash), t.ts.hashSizeBytes; got != want {
+		if got, want := len(leaf.MerkleLeafHash), t.ts.hashSizeBytes; got != want {
 			return nil, fmt.Errorf("scanned leaf does not have hash length %d, got %d", want, got)
 		}
 
-		num++
+		ret = append(ret, leaf)
 	}
 
-	if num != len(leaves) {
-		return nil, fmt.Errorf("expected %d leaves, but saw %d", len(leaves), num)
+	if len(ret) != len(leaves) {
+		return nil, fmt.Errorf("expected %d leaves, but saw %d", len(leaves), len(ret))
 	}
 	return ret, nil
 }
@@ -420,6 +655,41 @@ func (t *logTX) GetLeavesByLeafValueHash(leafHashes [][]byte, orderBySequence bo
 	return t.getLeavesByHashInternal(leafHashes, tmpl, "value")
 }
 
+func (t *logTX) GetLeavesByIdentityHash(identityHashes [][]byte) ([]trillian.LogLeaf, error) {
+	if len(identityHashes) == 0 {
+		return nil, nil
+	}
+	tmpl, err := t.ls.getLeavesByIdentityHashStmt(len(identityHashes))
+	if err != nil {
+		return nil, err
+	}
+	stx := t.tx.Stmt(tmpl)
+	var args []interface{}
+	for _, hash := range identityHashes {
+		args = append(args, interface{}(hash))
+	}
+	args = append(args, interface{}(t.ls.logID))
+	rows, err := stx.Query(args...)
+	if err != nil {
+		glog.Warningf("Query() identity hash = %v", err)
+		return nil, err
+	}
+
+	var ret []trillian.LogLeaf
+
+	defer rows.Close()
+	for rows.Next() {
+		leaf := trillian.LogLeaf{}
+		if err := rows.Scan(&leaf.LeafIdentityHash, &leaf.LeafValueHash, &leaf.LeafValue, &leaf.ExtraData); err != nil {
+			glog.Warningf("LogID: %d Scan() identity hash = %s", t.ls.logID, err)
+			return nil, err
+		}
+		ret = append(ret, leaf)
+	}
+
+	return ret, rows.Err()
+}
+
 func (t *logTX) GetLeavesByHash(leafHashes [][]byte, orderBySequence bool) ([]trillian.LogLeaf, error) {
 	tmpl, err := t.ls.getLeavesByMerkleHashStmt(len(leafHashes), orderBySequence)
 
@@ -431,12 +701,30 @@ func (t *logTX) GetLeavesByHash(leafHashes [][]byte, orderBySequence bool) ([]tr
 }
 
 func (t *logTX) LatestSignedLogRoot() (trillian.SignedLogRoot, error) {
+	if err := t.lockForWrite(); err != nil {
+		return trillian.SignedLogRoot{}, err
+	}
+	if t.writable {
+		return t.signedLogRoot(selectLatestSignedLogRootForUpdateSQL, t.ls.logID)
+	}
+	return t.signedLogRoot(selectLatestSignedLogRootSQL, t.ls.logID)
+}
+
+func (t *logTX) SignedLogRootByTimestamp(timestampNanos int64) (trillian.SignedLogRoot, error) {
+	return t.signedLogRoot(selectSignedLogRootByTimestampSQL, t.ls.logID, timestampNanos)
+}
+
+func (t *logTX) SignedLogRootBySize(treeSize int64) (trillian.SignedLogRoot, error) {
+	return t.signedLogRoot(selectSignedLogRootBySizeSQL, t.ls.logID, treeSize)
+}
+
+// signedLogRoot reads the tree head selected by query, or returns an empty root if there's none.
+func (t *logTX) signedLogRoot(query string, args ...interface{}) (trillian.SignedLogRoot, error) {
 	var timestamp, treeSize, treeRevision int64
 	var rootHash, rootSignatureBytes []byte
 	var rootSignature trillian.DigitallySigned
 
-	err := t.tx.QueryRow(
-		selectLatestSignedLogRootSQL, t.ls.logID).Scan(
+	err := t.tx.QueryRow(query, args...).Scan(
 		&timestamp, &treeSize, &rootHash, &treeRevision, &rootSignatureBytes)
 
 	// It's possible there are no roots for this tree yet
@@ -462,6 +750,9 @@ func (t *logTX) LatestSignedLogRoot() (trillian.SignedLogRoot, error) {
 }
 
 func (t *logTX) StoreSignedLogRoot(root trillian.SignedLogRoot) error {
+	if err := t.lockForWrite(); err != nil {
+		return err
+	}
 	signatureBytes, err := proto.Marshal(root.Signature)
 
 	if err != nil {
@@ -479,6 +770,78 @@ func (t *logTX) StoreSignedLogRoot(root trillian.SignedLogRoot) error {
 	return checkResultOkAndRowCountIs(res, err, 1)
 }
 
+func (t *logTX) GetCompactRange(treeSize int64) ([][]byte, error) {
+	var packed []byte
+	err := t.tx.QueryRow(selectCompactRangeSQL, t.ls.logID, treeSize).Scan(&packed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		glog.Warningf("Failed to get compact range: %s", err)
+		return nil, err
+	}
+	return unpackCompactRange(treeSize, packed)
+}
+
+func (t *logTX) StoreCompactRange(treeSize int64, hashes [][]byte) error {
+	packed, err := packCompactRange(treeSize, hashes)
+	if err != nil {
+		return err
+	}
+	if packed == nil {
+		// A perfect tree's compact range is just its root hash.
+		return nil
+	}
+	if _, err := t.tx.Exec(insertCompactRangeSQL, t.ls.logID, treeSize, packed); err != nil {
+		glog.Warningf("Failed to store compact range: %s", err)
+		return err
+	}
+	return nil
+}
+
+// packCompactRange concatenates the hashes of a compact range. Only the levels whose bit
+// is set in the tree size have a hash, so they don't need to be recorded. It returns nil
+// if there are no hashes, as for a perfect tree.
+func packCompactRange(treeSize int64, hashes [][]byte) ([]byte, error) {
+	var packed []byte
+	hashSize := 0
+	for level, hash := range hashes {
+		if got, want := hash != nil, treeSize&(1<<uint(level)) != 0; got != want {
+			return nil, fmt.Errorf("compact range for tree size %d has hash at level %d: %v, want %v", treeSize, level, got, want)
+		}
+		if hash == nil {
+			continue
+		}
+		if hashSize == 0 {
+			hashSize = len(hash)
+		}
+		if len(hash) != hashSize {
+			return nil, fmt.Errorf("compact range for tree size %d has hashes of %d and %d bytes", treeSize, hashSize, len(hash))
+		}
+		packed = append(packed, hash...)
+	}
+	return packed, nil
+}
+
+// unpackCompactRange splits the hashes packed by packCompactRange back out into levels.
+func unpackCompactRange(treeSize int64, packed []byte) ([][]byte, error) {
+	var levels []int
+	for level := 0; treeSize>>uint(level) != 0; level++ {
+		if treeSize&(1<<uint(level)) != 0 {
+			levels = append(levels, level)
+		}
+	}
+	if len(levels) == 0 || len(packed)%len(levels) != 0 {
+		return nil, fmt.Errorf("compact range for tree size %d has %d bytes, not a whole number of %d hashes", treeSize, len(packed), len(levels))
+	}
+	hashSize := len(packed) / len(levels)
+	hashes := make([][]byte, levels[len(levels)-1]+1)
+	for i, level := range levels {
+		hashes[level] = packed[i*hashSize : (i+1)*hashSize]
+	}
+	return hashes, nil
+}
+
 func (t *logTX) UpdateSequencedLeaves(leaves []trillian.LogLeaf) error {
 	// TODO: In theory we can do this with CASE / WHEN in one SQL statement but it's more fiddly
 	// and can be implemented later if necessary
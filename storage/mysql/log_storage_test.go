@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"database/sql"
 	"fmt"
+	"reflect"
 	"runtime/debug"
 	"strings"
 	"testing"
@@ -17,7 +18,7 @@ import (
 	"github.com/google/trillian/testonly"
 )
 
-var allTables = []string{"Unsequenced", "TreeHead", "SequencedLeafData", "LeafData", "Subtree", "TreeControl", "Trees", "MapLeaf", "MapHead"}
+var allTables = []string{"Unsequenced", "TreeHead", "CompactRange", "MigrationProgress", "SequencedLeafData", "LeafData", "Subtree", "TreeControl", "TreeACL", "Trees", "MapLeaf", "MapHead"}
 
 // Must be 32 bytes to match sha256 length if it was a real hash
 var dummyHash = []byte("hashxxxxhashxxxxhashxxxxhashxxxx")
@@ -183,6 +184,99 @@ func TestQueueLeaves(t *testing.T) {
 	}
 }
 
+func TestGetLeavesByIdentityHash(t *testing.T) {
+	logID := createLogID("TestGetLeavesByIdentityHash")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+	defer commit(tx, t)
+
+	leaves := createTestLeaves(3, 20)
+	leaves[0].LeafIdentityHash = []byte("id0")
+	leaves[1].LeafIdentityHash = []byte("id1")
+
+	if err := tx.QueueLeaves(leaves, fakeQueueTime); err != nil {
+		t.Fatalf("Failed to queue leaves: %v", err)
+	}
+
+	got, err := tx.GetLeavesByIdentityHash([][]byte{[]byte("id1"), []byte("id2")})
+	if err != nil {
+		t.Fatalf("GetLeavesByIdentityHash()=_,%v, want no error", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("GetLeavesByIdentityHash() returned %d leaves, want 1", len(got))
+	}
+	if !bytes.Equal(got[0].LeafValueHash, leaves[1].LeafValueHash) || !bytes.Equal(got[0].LeafValue, leaves[1].LeafValue) ||
+		!bytes.Equal(got[0].LeafIdentityHash, leaves[1].LeafIdentityHash) {
+		t.Errorf("GetLeavesByIdentityHash()=%v, want %v", got[0], leaves[1])
+	}
+}
+
+func TestGetQueuedLeaves(t *testing.T) {
+	logID := createLogID("TestGetQueuedLeaves")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+	defer commit(tx, t)
+
+	leaves := createTestLeaves(3, 20)
+	leaves[0].CorrelationId = "req1"
+	leaves[1].CorrelationId = "req1"
+
+	if err := tx.QueueLeaves(leaves, fakeQueueTime); err != nil {
+		t.Fatalf("Failed to queue leaves: %v", err)
+	}
+
+	byID, err := tx.GetQueuedLeavesByCorrelationID("req1")
+	if err != nil {
+		t.Fatalf("GetQueuedLeavesByCorrelationID()=_,%v, want no error", err)
+	}
+	if len(byID) != 2 {
+		t.Fatalf("GetQueuedLeavesByCorrelationID() returned %d leaves, want 2", len(byID))
+	}
+	for _, leaf := range byID {
+		if leaf.CorrelationId != "req1" || !leaf.QueueTimestamp.Equal(fakeQueueTime) {
+			t.Errorf("GetQueuedLeavesByCorrelationID()=%v, want leaf queued under req1 at %v", leaf, fakeQueueTime)
+		}
+	}
+
+	byHash, err := tx.GetQueuedLeavesByHash([][]byte{leaves[2].MerkleLeafHash, []byte("not queued")})
+	if err != nil {
+		t.Fatalf("GetQueuedLeavesByHash()=_,%v, want no error", err)
+	}
+	if len(byHash) != 1 {
+		t.Fatalf("GetQueuedLeavesByHash() returned %d leaves, want 1", len(byHash))
+	}
+	if !bytes.Equal(byHash[0].MerkleLeafHash, leaves[2].MerkleLeafHash) || len(byHash[0].CorrelationId) > 0 {
+		t.Errorf("GetQueuedLeavesByHash()=%v, want %v", byHash[0], leaves[2])
+	}
+}
+
+func TestQueueLeavesDuplicateIdentityHash(t *testing.T) {
+	logID := createLogID("TestQueueLeavesDuplicateIdentityHash")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+
+	leaves := createTestLeaves(2, 20)
+	leaves[0].LeafIdentityHash = []byte("id")
+	leaves[1].LeafIdentityHash = []byte("id")
+
+	tx := beginLogTx(s, t)
+	if err := tx.QueueLeaves(leaves[:1], fakeQueueTime); err != nil {
+		t.Fatalf("Failed to queue leaves: %v", err)
+	}
+	commit(tx, t)
+
+	tx = beginLogTx(s, t)
+	defer tx.Rollback()
+	if err := tx.QueueLeaves(leaves[1:], fakeQueueTime); err != storage.ErrDuplicateLeafIdentity {
+		t.Errorf("QueueLeaves(duplicate identity)=%v, want %v", err, storage.ErrDuplicateLeafIdentity)
+	}
+}
+
 func TestQueueLeavesBadHash(t *testing.T) {
 	logID := createLogID("TestQueueLeavesBadHash")
 	db := prepareTestLogDB(logID, t)
@@ -279,6 +373,62 @@ func TestDequeueLeaves(t *testing.T) {
 	}
 }
 
+func TestDequeuePeekedLeaves(t *testing.T) {
+	logID := createLogID("TestDequeuePeekedLeaves")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+
+	tx := beginLogTx(s, t)
+	if err := tx.QueueLeaves(createTestLeaves(3, 20), fakeQueueTime); err != nil {
+		t.Fatalf("Failed to queue leaves: %v", err)
+	}
+	commit(tx, t)
+
+	snap, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to start snapshot: %v", err)
+	}
+	peeked, err := snap.PeekLeaves(2, fakeDequeueCutoffTime)
+	if err != nil {
+		t.Fatalf("Failed to peek leaves: %v", err)
+	}
+	if err := snap.Commit(); err != nil {
+		t.Fatalf("Failed to commit snapshot: %v", err)
+	}
+	if got, want := len(peeked), 2; got != want {
+		t.Fatalf("Peeked %d leaves, want %d", got, want)
+	}
+
+	// A more urgent leaf queued after the peek doesn't get in the way.
+	tx = beginLogTx(s, t)
+	urgent := createTestLeaves(1, 30)
+	urgent[0].MergeDeadlineNanos = fakeQueueTime.Add(-time.Hour).UnixNano()
+	if err := tx.QueueLeaves(urgent, fakeQueueTime); err != nil {
+		t.Fatalf("Failed to queue urgent leaf: %v", err)
+	}
+	commit(tx, t)
+
+	tx = beginLogTx(s, t)
+	if err := tx.DequeuePeekedLeaves(peeked); err != nil {
+		t.Fatalf("DequeuePeekedLeaves()=%v, want no error", err)
+	}
+	commit(tx, t)
+
+	tx = beginLogTx(s, t)
+	defer tx.Rollback()
+	if err := tx.DequeuePeekedLeaves(peeked); err == nil {
+		t.Error("DequeuePeekedLeaves(already dequeued)=nil, want error")
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM Unsequenced WHERE TreeID=?", logID.logID).Scan(&count); err != nil {
+		t.Fatalf("Could not query row count: %v", err)
+	}
+	if got, want := count, 2; got != want {
+		t.Errorf("%d leaves left in queue, want %d", got, want)
+	}
+}
+
 func TestDequeueLeavesTwoBatches(t *testing.T) {
 	logID := createLogID("TestDequeueLeavesTwoBatches")
 	db := prepareTestLogDB(logID, t)
@@ -487,6 +637,55 @@ func TestDequeueLeavesTimeOrdering(t *testing.T) {
 	}
 }
 
+func TestDequeueLeavesMergeDeadlineOrdering(t *testing.T) {
+	// Queue a batch of leaves without a deadline, then a batch whose deadline is earlier
+	// than that. The later batch should be dequeued first.
+	logID := createLogID("TestDequeueLeavesMergeDeadlineOrdering")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+	batchSize := 2
+
+	{
+		tx := beginLogTx(s, t)
+		defer failIfTXStillOpen(t, "TestDequeueLeavesMergeDeadlineOrdering", tx)
+
+		leaves := createTestLeaves(int64(batchSize), 0)
+		leaves2 := createTestLeaves(int64(batchSize), int64(batchSize))
+		for i := range leaves2 {
+			leaves2[i].MergeDeadlineNanos = fakeQueueTime.Add(-time.Minute).UnixNano()
+		}
+
+		if err := tx.QueueLeaves(leaves, fakeQueueTime.Add(-time.Second)); err != nil {
+			t.Fatalf("QueueLeaves(1st batch) = %v", err)
+		}
+		if err := tx.QueueLeaves(leaves2, fakeQueueTime); err != nil {
+			t.Fatalf("QueueLeaves(2nd batch) = %v", err)
+		}
+
+		commit(tx, t)
+	}
+
+	tx2 := beginLogTx(s, t)
+	defer failIfTXStillOpen(t, "TestDequeueLeavesMergeDeadlineOrdering", tx2)
+	dequeued, err := tx2.DequeueLeaves(batchSize, fakeQueueTime)
+	if err != nil {
+		t.Fatalf("DequeueLeaves() = %v", err)
+	}
+	if got, want := len(dequeued), batchSize; got != want {
+		t.Fatalf("Dequeue count mismatch got: %d, want: %d", got, want)
+	}
+	for _, leaf := range dequeued {
+		if !leafInRange(leaf, batchSize, batchSize+batchSize-1) {
+			t.Errorf("Got leaf from wrong batch: %s", string(leaf.LeafValue))
+		}
+		if got, want := leaf.MergeDeadlineNanos, fakeQueueTime.Add(-time.Minute).UnixNano(); got != want {
+			t.Errorf("Dequeued leaf %s MergeDeadlineNanos=%d, want %d", string(leaf.LeafValue), got, want)
+		}
+	}
+	commit(tx2, t)
+}
+
 func TestGetLeavesByHashNotPresent(t *testing.T) {
 	logID := createLogID("TestGetLeavesByHashNotPresent")
 	s := prepareTestLogStorage(logID, t)
@@ -670,6 +869,81 @@ func TestLatestSignedLogRoot(t *testing.T) {
 	}
 }
 
+func TestCompactRangeRoundTrip(t *testing.T) {
+	logID := createLogID("TestCompactRangeRoundTrip")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+
+	hashes := [][]byte{dummyHash, nil, dummyHash2}
+	tx := beginLogTx(s, t)
+	if err := tx.StoreCompactRange(5, hashes); err != nil {
+		t.Fatalf("StoreCompactRange()=%v, want no error", err)
+	}
+	// Storing the range again, or one for a perfect tree, is fine
+	if err := tx.StoreCompactRange(5, hashes); err != nil {
+		t.Fatalf("StoreCompactRange(again)=%v, want no error", err)
+	}
+	if err := tx.StoreCompactRange(4, nil); err != nil {
+		t.Fatalf("StoreCompactRange(perfect)=%v, want no error", err)
+	}
+	commit(tx, t)
+
+	tx = beginLogTx(s, t)
+	defer commit(tx, t)
+	var tests = []struct {
+		treeSize int64
+		want     [][]byte
+	}{
+		{treeSize: 5, want: hashes},
+		{treeSize: 4, want: nil},
+		{treeSize: 6, want: nil},
+	}
+	for _, test := range tests {
+		got, err := tx.GetCompactRange(test.treeSize)
+		if err != nil {
+			t.Errorf("GetCompactRange(%d)=_,%v, want no error", test.treeSize, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("GetCompactRange(%d)=%x, want %x", test.treeSize, got, test.want)
+		}
+	}
+}
+
+func TestPackCompactRange(t *testing.T) {
+	var tests = []struct {
+		treeSize int64
+		hashes   [][]byte
+		wantErr  bool
+	}{
+		{treeSize: 1, hashes: [][]byte{[]byte("a")}},
+		{treeSize: 6, hashes: [][]byte{nil, []byte("ab"), []byte("cd")}},
+		{treeSize: 6, hashes: [][]byte{[]byte("ab"), []byte("cd"), []byte("ef")}, wantErr: true},
+		{treeSize: 6, hashes: [][]byte{nil, nil, []byte("cd")}, wantErr: true},
+		{treeSize: 6, hashes: [][]byte{nil, []byte("a"), []byte("cd")}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		packed, err := packCompactRange(test.treeSize, test.hashes)
+		if (err != nil) != test.wantErr {
+			t.Errorf("packCompactRange(%d, %x)=_,%v, want error: %v", test.treeSize, test.hashes, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		got, err := unpackCompactRange(test.treeSize, packed)
+		if err != nil || !reflect.DeepEqual(got, test.hashes) {
+			t.Errorf("unpackCompactRange(packCompactRange(%d, %x))=%x,%v, want %x,nil", test.treeSize, test.hashes, got, err, test.hashes)
+		}
+	}
+
+	if _, err := unpackCompactRange(6, []byte("abc")); err == nil {
+		t.Errorf("unpackCompactRange(6, 3 bytes)=_,nil, want error")
+	}
+}
+
 func TestGetTreeRevisionAtNonExistentSizeError(t *testing.T) {
 	// Have to set all this up though we won't actually write anything
 	logID := createLogID("TestGetTreeRevisionAtSize")
@@ -843,6 +1117,232 @@ func TestLogRootUpdate(t *testing.T) {
 	}
 }
 
+func TestDequeueLocksTree(t *testing.T) {
+	logID := createLogID("TestDequeueLocksTree")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+	if _, err := tx.DequeueLeaves(99, fakeDequeueCutoffTime); err != nil {
+		t.Fatalf("Failed to dequeue leaves: %v", err)
+	}
+
+	// A second sequencer on the same tree must wait for the first to finish.
+	done := make(chan storage.LogTX)
+	go func() {
+		tx2, err := s.Begin()
+		if err != nil {
+			t.Errorf("Failed to begin second tx: %v", err)
+			done <- nil
+			return
+		}
+		if _, err := tx2.LatestSignedLogRoot(); err != nil {
+			t.Errorf("Failed to read root in second tx: %v", err)
+		}
+		done <- tx2
+	}()
+
+	select {
+	case tx2 := <-done:
+		if tx2 != nil {
+			tx2.Rollback()
+		}
+		t.Fatal("Read the root of a locked tree for writing")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	commit(tx, t)
+
+	select {
+	case tx2 := <-done:
+		if tx2 != nil {
+			commit(tx2, t)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Second tx did not get the lock after first committed")
+	}
+}
+
+func TestConcurrentSequencersSeeLatestState(t *testing.T) {
+	logID := createLogID("TestConcurrentSequencersSeeLatestState")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+
+	{
+		tx := beginLogTx(s, t)
+		if err := tx.QueueLeaves(createTestLeaves(leavesToInsert, 20), fakeQueueTime); err != nil {
+			t.Fatalf("Failed to queue leaves: %v", err)
+		}
+		commit(tx, t)
+	}
+
+	// Both sequencers start before either has done any work.
+	tx1 := beginLogTx(s, t)
+	tx2 := beginLogTx(s, t)
+
+	leaves, err := tx2.DequeueLeaves(99, fakeDequeueCutoffTime)
+	if err != nil {
+		t.Fatalf("Failed to dequeue leaves: %v", err)
+	}
+	if got, want := len(leaves), leavesToInsert; got != want {
+		t.Fatalf("DequeueLeaves()=%d leaves, want %d", got, want)
+	}
+
+	// The first sequencer waits for the second, then must see what it committed.
+	type result struct {
+		leaves []trillian.LogLeaf
+		root   trillian.SignedLogRoot
+		err    error
+	}
+	done := make(chan result)
+	go func() {
+		var r result
+		if r.leaves, r.err = tx1.DequeueLeaves(99, fakeDequeueCutoffTime); r.err == nil {
+			r.root, r.err = tx1.LatestSignedLogRoot()
+		}
+		done <- r
+	}()
+
+	root := trillian.SignedLogRoot{LogId: logID.logID, TimestampNanos: 98765, TreeSize: leavesToInsert, TreeRevision: 1, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}}
+	if err := tx2.StoreSignedLogRoot(root); err != nil {
+		t.Fatalf("Failed to store signed root: %v", err)
+	}
+	commit(tx2, t)
+
+	select {
+	case r := <-done:
+		defer tx1.Rollback()
+		if r.err != nil {
+			t.Fatalf("Second sequencer failed: %v", r.err)
+		}
+		if got := len(r.leaves); got != 0 {
+			t.Errorf("DequeueLeaves()=%d leaves, want 0 as they were already sequenced", got)
+		}
+		if !proto.Equal(&r.root, &root) {
+			t.Errorf("LatestSignedLogRoot()=%v, want %v", r.root, root)
+		}
+		if got, want := tx1.WriteRevision(), root.TreeRevision+1; got != want {
+			t.Errorf("WriteRevision()=%d, want %d", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Second sequencer did not get the lock after first committed")
+	}
+}
+
+func TestQueueLeavesDoesNotLockTree(t *testing.T) {
+	logID := createLogID("TestQueueLeavesDoesNotLockTree")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+	defer commit(tx, t)
+	if _, err := tx.DequeueLeaves(99, fakeDequeueCutoffTime); err != nil {
+		t.Fatalf("Failed to dequeue leaves: %v", err)
+	}
+
+	// Submissions mustn't wait behind the sequencer.
+	done := make(chan error)
+	go func() {
+		tx2, err := s.Begin()
+		if err != nil {
+			done <- err
+			return
+		}
+		if err := tx2.QueueLeaves(createTestLeaves(5, 30), fakeQueueTime); err != nil {
+			tx2.Rollback()
+			done <- err
+			return
+		}
+		done <- tx2.Commit()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Failed to queue leaves on locked tree: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("QueueLeaves blocked on tree lock")
+	}
+}
+
+func TestBeginDoesNotLockOtherTrees(t *testing.T) {
+	logID1 := createLogID("TestBeginDoesNotLockOtherTrees1")
+	logID2 := createLogID("TestBeginDoesNotLockOtherTrees2")
+	db1 := prepareTestLogDB(logID1, t)
+	defer db1.Close()
+	db2 := prepareTestLogDB(logID2, t)
+	defer db2.Close()
+	s1 := prepareTestLogStorage(logID1, t)
+	s2 := prepareTestLogStorage(logID2, t)
+
+	// Sequence a batch on each tree in parallel, holding the first tx open until the
+	// second tree has been fully sequenced.
+	tx1 := beginLogTx(s1, t)
+	defer failIfTXStillOpen(t, "TestBeginDoesNotLockOtherTrees", tx1)
+	if err := tx1.StoreSignedLogRoot(trillian.SignedLogRoot{LogId: logID1.logID, TimestampNanos: 98765, TreeSize: 16, TreeRevision: 1, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}}); err != nil {
+		t.Fatalf("Failed to store signed root: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		tx2, err := s2.Begin()
+		if err != nil {
+			done <- err
+			return
+		}
+		if err := tx2.StoreSignedLogRoot(trillian.SignedLogRoot{LogId: logID2.logID, TimestampNanos: 98765, TreeSize: 16, TreeRevision: 1, RootHash: []byte(dummyHash), Signature: &trillian.DigitallySigned{Signature: []byte("notempty")}}); err != nil {
+			tx2.Rollback()
+			done <- err
+			return
+		}
+		done <- tx2.Commit()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Failed to update second tree: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Updating second tree blocked on lock held for first")
+	}
+
+	commit(tx1, t)
+}
+
+func TestSnapshotDoesNotLockTree(t *testing.T) {
+	logID := createLogID("TestSnapshotDoesNotLockTree")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+	defer commit(tx, t)
+	if _, err := tx.LatestSignedLogRoot(); err != nil {
+		t.Fatalf("Failed to read root: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		tx2, err := s.Snapshot()
+		if err != nil {
+			done <- err
+			return
+		}
+		done <- tx2.Commit()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Failed to read from locked tree: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Snapshot blocked on tree lock")
+	}
+}
+
 func TestGetActiveLogIDs(t *testing.T) {
 	// Have to wipe everything to ensure we start with zero log trees configured
 	cleanTestDB()
@@ -854,6 +1354,7 @@ func TestGetActiveLogIDs(t *testing.T) {
 
 	s := prepareTestLogStorage(logID, t)
 	tx := beginLogTx(s, t)
+	defer commit(tx, t)
 
 	logIDs, err := tx.GetActiveLogIDs()
 
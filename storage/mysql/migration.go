@@ -0,0 +1,326 @@
+package mysql
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+)
+
+const selectMigrationProgressSQL string = `SELECT NextKey,RowsScanned,RowsChanged,Done,UpdatedNanos
+		 FROM MigrationProgress WHERE TreeId=? AND Name=?`
+const replaceMigrationProgressSQL string = `REPLACE INTO MigrationProgress(TreeId,Name,NextKey,RowsScanned,RowsChanged,Done,UpdatedNanos)
+		 VALUES(?,?,?,?,?,?,?)`
+const deleteMigrationProgressSQL string = "DELETE FROM MigrationProgress WHERE TreeId=? AND Name=?"
+
+const selectSequencedLeavesForMigrationSQL string = `SELECT s.SequenceNumber,s.MerkleLeafHash,l.LeafValue
+		 FROM SequencedLeafData s INNER JOIN LeafData l
+		 ON s.TreeId=l.TreeId AND s.LeafValueHash=l.LeafValueHash
+		 WHERE s.TreeId=? AND s.SequenceNumber>=?
+		 ORDER BY s.SequenceNumber LIMIT ?`
+const updateMerkleLeafHashSQL string = "UPDATE SequencedLeafData SET MerkleLeafHash=? WHERE TreeId=? AND SequenceNumber=?"
+
+const selectLeafDataForMigrationSQL string = `SELECT LeafValueHash,LeafValue,ExtraData,LeafIdentityHash
+		 FROM LeafData WHERE TreeId=? AND LeafValueHash>?
+		 ORDER BY LeafValueHash LIMIT ?`
+const updateLeafIdentityHashSQL string = "UPDATE LeafData SET LeafIdentityHash=? WHERE TreeId=? AND LeafValueHash=?"
+
+// Migration recomputes a column derived from the leaves of a log tree, such as a hash, and
+// stores it for the leaves written before the column existed or when it was computed
+// differently. It works through the rows in order of a key, a batch at a time, so that a
+// MigrationRunner can throttle it and resume it where it left off.
+type Migration interface {
+	// Name identifies the migration, its progress is saved under this name.
+	Name() string
+	// Migrate updates the rows of treeID whose keys come after cursor, looking at no more
+	// than limit of them. It returns the cursor for the next batch, and the number of rows
+	// it looked at and changed. An empty cursor means the first row hasn't been looked at.
+	// The migration is complete when it looks at fewer than limit rows.
+	Migrate(tx *sql.Tx, treeID int64, cursor []byte, limit int) (next []byte, scanned, changed int64, err error)
+}
+
+// MigrationProgress is how far a Migration has got through a tree.
+type MigrationProgress struct {
+	// Cursor is where the next batch starts.
+	Cursor []byte
+	// RowsScanned and RowsChanged count the rows the migration has looked at and updated.
+	RowsScanned int64
+	RowsChanged int64
+	// Done is true once the migration has been through every row.
+	Done bool
+	// Updated is when the progress was last saved, the zero time if it never has been.
+	Updated time.Time
+}
+
+// MigrationRunner applies a Migration to a tree a batch at a time, saving its progress
+// in the same transaction as each batch, so a run that's interrupted resumes from the
+// last batch written. Between batches it pauses for BatchInterval, so it doesn't take
+// too much of the database from the servers using it.
+type MigrationRunner struct {
+	db     *sql.DB
+	treeID int64
+	m      Migration
+	// BatchSize is the most rows changed in one transaction.
+	BatchSize int
+	// BatchInterval is the pause between batches.
+	BatchInterval time.Duration
+}
+
+// NewMigrationRunner creates a MigrationRunner applying m to treeID in batches of 100
+// rows, 100ms apart.
+func NewMigrationRunner(db *sql.DB, treeID int64, m Migration) *MigrationRunner {
+	return &MigrationRunner{db: db, treeID: treeID, m: m, BatchSize: 100, BatchInterval: 100 * time.Millisecond}
+}
+
+// Progress returns how far the migration has got.
+func (r *MigrationRunner) Progress() (MigrationProgress, error) {
+	return readMigrationProgress(r.db, r.treeID, r.m.Name())
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func readMigrationProgress(q queryRower, treeID int64, name string) (MigrationProgress, error) {
+	var p MigrationProgress
+	var updated int64
+	err := q.QueryRow(selectMigrationProgressSQL, treeID, name).Scan(&p.Cursor, &p.RowsScanned, &p.RowsChanged, &p.Done, &updated)
+	if err == sql.ErrNoRows {
+		return MigrationProgress{}, nil
+	} else if err != nil {
+		return MigrationProgress{}, fmt.Errorf("failed to read progress of migration %s: %v", name, err)
+	}
+	p.Updated = time.Unix(0, updated)
+	return p, nil
+}
+
+// Reset forgets the migration's progress, so the next Run starts from the first row again.
+func (r *MigrationRunner) Reset() error {
+	_, err := r.db.Exec(deleteMigrationProgressSQL, r.treeID, r.m.Name())
+	return err
+}
+
+// Run applies batches of the migration until it's been through every row, returning the
+// final progress, or until ctx is done, when it returns the context's error. Rows written
+// while it runs are only migrated if they come after the cursor, so a migration of a
+// column the servers don't yet write should be run again once they do.
+func (r *MigrationRunner) Run(ctx context.Context) (MigrationProgress, error) {
+	if r.BatchSize <= 0 {
+		return MigrationProgress{}, fmt.Errorf("invalid batch size %d", r.BatchSize)
+	}
+	for {
+		p, err := r.batch()
+		if err != nil {
+			return p, err
+		}
+		if p.Done {
+			glog.Infof("Migration %s of tree %d complete: %d rows scanned, %d changed", r.m.Name(), r.treeID, p.RowsScanned, p.RowsChanged)
+			return p, nil
+		}
+		glog.V(1).Infof("Migration %s of tree %d: %d rows scanned, %d changed", r.m.Name(), r.treeID, p.RowsScanned, p.RowsChanged)
+
+		select {
+		case <-ctx.Done():
+			return p, ctx.Err()
+		case <-time.After(r.BatchInterval):
+		}
+	}
+}
+
+// batch applies one batch of the migration and saves the progress made.
+func (r *MigrationRunner) batch() (MigrationProgress, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return MigrationProgress{}, err
+	}
+	p, err := readMigrationProgress(tx, r.treeID, r.m.Name())
+	if err != nil {
+		tx.Rollback()
+		return p, err
+	}
+	if p.Done {
+		tx.Rollback()
+		return p, nil
+	}
+
+	next, scanned, changed, err := r.m.Migrate(tx, r.treeID, p.Cursor, r.BatchSize)
+	if err != nil {
+		tx.Rollback()
+		return p, fmt.Errorf("migration %s failed after %d rows: %v", r.m.Name(), p.RowsScanned, err)
+	}
+	p.Cursor = next
+	p.RowsScanned += scanned
+	p.RowsChanged += changed
+	p.Done = scanned < int64(r.BatchSize)
+	p.Updated = time.Now()
+	if _, err := tx.Exec(replaceMigrationProgressSQL, r.treeID, r.m.Name(), p.Cursor, p.RowsScanned, p.RowsChanged, p.Done, p.Updated.UnixNano()); err != nil {
+		tx.Rollback()
+		return p, fmt.Errorf("failed to save progress of migration %s: %v", r.m.Name(), err)
+	}
+	return p, tx.Commit()
+}
+
+// merkleLeafHashMigration recomputes the Merkle leaf hashes of sequenced leaves.
+type merkleLeafHashMigration struct {
+	hasher merkle.TreeHasher
+}
+
+// NewMerkleLeafHashMigration returns a Migration that sets the MerkleLeafHash of each
+// sequenced leaf written without one to the hash of its value with hasher, which should be
+// the tree's hasher. A stored hash that differs from the computed one isn't rewritten, as
+// the tree's nodes were built from it; it's logged as a mismatch to be investigated.
+func NewMerkleLeafHashMigration(hasher merkle.TreeHasher) Migration {
+	return merkleLeafHashMigration{hasher: hasher}
+}
+
+func (m merkleLeafHashMigration) Name() string {
+	return "merkle-leaf-hash"
+}
+
+func (m merkleLeafHashMigration) Migrate(tx *sql.Tx, treeID int64, cursor []byte, limit int) ([]byte, int64, int64, error) {
+	// The cursor is the next sequence number to look at.
+	var from int64
+	if len(cursor) > 0 {
+		if len(cursor) != 8 {
+			return nil, 0, 0, fmt.Errorf("invalid cursor %x", cursor)
+		}
+		from = int64(binary.BigEndian.Uint64(cursor))
+	}
+
+	rows, err := tx.Query(selectSequencedLeavesForMigrationSQL, treeID, from, limit)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	type fix struct {
+		seq  int64
+		hash []byte
+	}
+	var fixes []fix
+	var scanned int64
+	next := from
+	for rows.Next() {
+		var seq int64
+		var stored, value []byte
+		if err := rows.Scan(&seq, &stored, &value); err != nil {
+			rows.Close()
+			return nil, 0, 0, err
+		}
+		if hash := m.hasher.HashLeaf(value); len(stored) == 0 {
+			fixes = append(fixes, fix{seq: seq, hash: hash})
+		} else if !bytes.Equal(hash, stored) {
+			glog.Warningf("Migration %s of tree %d: leaf %d has MerkleLeafHash %x, but its value hashes to %x", m.Name(), treeID, seq, stored, hash)
+		}
+		scanned++
+		next = seq + 1
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, 0, 0, err
+	}
+
+	for _, f := range fixes {
+		if _, err := tx.Exec(updateMerkleLeafHashSQL, f.hash, treeID, f.seq); err != nil {
+			return nil, 0, 0, fmt.Errorf("failed to update leaf %d: %v", f.seq, err)
+		}
+	}
+	cursor = make([]byte, 8)
+	binary.BigEndian.PutUint64(cursor, uint64(next))
+	return cursor, scanned, int64(len(fixes)), nil
+}
+
+// IdentityHashFunc computes the identity hash of a leaf from its value and extra data, as
+// the application queuing the leaves does.
+type IdentityHashFunc func(leafValue, extraData []byte) ([]byte, error)
+
+// identityHashMigration sets the identity hashes of leaves from their data.
+type identityHashMigration struct {
+	identity IdentityHashFunc
+}
+
+// NewIdentityHashMigration returns a Migration that sets the LeafIdentityHash of each
+// leaf without one to the hash computed by identity. Leaves queued before the application
+// supplied identity hashes have none, so aren't found as duplicates of later submissions.
+// identity can return nil to leave a leaf without one. An identity hash is unique within a
+// tree, so when the log already holds several leaves with the same identity only the first
+// one migrated gets it; the others are logged and left without one.
+func NewIdentityHashMigration(identity IdentityHashFunc) Migration {
+	return identityHashMigration{identity: identity}
+}
+
+func (m identityHashMigration) Name() string {
+	return "leaf-identity-hash"
+}
+
+func (m identityHashMigration) Migrate(tx *sql.Tx, treeID int64, cursor []byte, limit int) ([]byte, int64, int64, error) {
+	// The cursor is the last LeafValueHash looked at, the empty one sorts before any hash.
+	if cursor == nil {
+		cursor = []byte{}
+	}
+	rows, err := tx.Query(selectLeafDataForMigrationSQL, treeID, cursor, limit)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	type fix struct {
+		valueHash, identityHash []byte
+	}
+	var fixes []fix
+	var scanned int64
+	next := cursor
+	for rows.Next() {
+		var valueHash, value, extraData, stored []byte
+		if err := rows.Scan(&valueHash, &value, &extraData, &stored); err != nil {
+			rows.Close()
+			return nil, 0, 0, err
+		}
+		identityHash, err := m.identity(value, extraData)
+		if err != nil {
+			rows.Close()
+			return nil, 0, 0, fmt.Errorf("failed to compute identity hash of leaf %x: %v", valueHash, err)
+		}
+		if len(identityHash) > 0 && len(stored) == 0 {
+			fixes = append(fixes, fix{valueHash: valueHash, identityHash: identityHash})
+		}
+		scanned++
+		next = valueHash
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, 0, 0, err
+	}
+
+	var changed int64
+	for _, f := range fixes {
+		var existing []byte
+		err := tx.QueryRow(selectLeafValueHashByIdentityHashSQL, treeID, f.identityHash).Scan(&existing)
+		if err == nil {
+			glog.Warningf("Migration %s of tree %d: leaf %x has the same identity as leaf %x, leaving it without one", m.Name(), treeID, f.valueHash, existing)
+			continue
+		} else if err != sql.ErrNoRows {
+			return nil, 0, 0, fmt.Errorf("failed to look up identity hash of leaf %x: %v", f.valueHash, err)
+		}
+		if _, err := tx.Exec(updateLeafIdentityHashSQL, f.identityHash, treeID, f.valueHash); err != nil {
+			return nil, 0, 0, fmt.Errorf("failed to update leaf %x: %v", f.valueHash, err)
+		}
+		changed++
+	}
+	return next, scanned, changed, nil
+}
+
+// MigrationByName returns the built in migration called name for a tree using hasher,
+// whose application computes identity hashes with identity. The identity hash migration
+// can't be run without one.
+func MigrationByName(name string, hasher merkle.TreeHasher, identity IdentityHashFunc) (Migration, error) {
+	switch name {
+	case "merkle-leaf-hash":
+		return NewMerkleLeafHashMigration(hasher), nil
+	case "leaf-identity-hash":
+		if identity == nil {
+			return nil, fmt.Errorf("migration %q needs an identity hash function", name)
+		}
+		return NewIdentityHashMigration(identity), nil
+	}
+	return nil, fmt.Errorf("unknown migration %q", name)
+}
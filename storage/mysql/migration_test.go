@@ -0,0 +1,158 @@
+package mysql
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"golang.org/x/net/context"
+)
+
+func TestMerkleLeafHashMigration(t *testing.T) {
+	logID := createLogID("TestMerkleLeafHashMigration")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+
+	// Leaves 2 and 5 were written with the wrong hash, and leaf 3 without one.
+	wrong := make(map[int64][]byte)
+	hasher := merkle.NewRFC6962TreeHasher(crypto.NewSHA256())
+	for seq := int64(0); seq < 7; seq++ {
+		data := []byte(fmt.Sprintf("leaf %d", seq))
+		hash := hasher.HashLeaf(data)
+		switch seq {
+		case 2, 5:
+			hash = crypto.NewSHA256().Digest(data)
+			wrong[seq] = hash
+		case 3:
+			hash = []byte{}
+		}
+		createFakeLeaf(db, logID.logID, crypto.NewSHA256().Digest(data), hash, data, nil, seq, t)
+	}
+
+	r := NewMigrationRunner(db, logID.logID, NewMerkleLeafHashMigration(hasher))
+	r.BatchSize = 3
+	r.BatchInterval = 0
+
+	// A run that's stopped after the first batch resumes from where it got to.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if p, err := r.Run(ctx); err != context.Canceled || p.RowsScanned != 3 || p.RowsChanged != 0 {
+		t.Fatalf("Run(cancelled)=%+v,%v, want 3 rows scanned, 0 changed, %v", p, err, context.Canceled)
+	}
+	p, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run()=_,%v, want no error", err)
+	}
+	if !p.Done || p.RowsScanned != 7 || p.RowsChanged != 1 {
+		t.Errorf("Run()=%+v, want done, 7 rows scanned, 1 changed", p)
+	}
+
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+	leaves, err := tx.GetLeavesByIndex([]int64{0, 1, 2, 3, 4, 5, 6})
+	if err != nil {
+		t.Fatalf("GetLeavesByIndex()=_,%v, want no error", err)
+	}
+	tx.Commit()
+	// Only the missing hash is filled in, the wrong ones are left for the tree to be checked.
+	for _, leaf := range leaves {
+		want := hasher.HashLeaf(leaf.LeafValue)
+		if hash, ok := wrong[leaf.LeafIndex]; ok {
+			want = hash
+		}
+		if got := leaf.MerkleLeafHash; !bytes.Equal(got, want) {
+			t.Errorf("leaf %d MerkleLeafHash=%x, want %x", leaf.LeafIndex, got, want)
+		}
+	}
+
+	// Running it again does nothing until it's reset.
+	if p, err := r.Run(context.Background()); err != nil || p.RowsScanned != 7 {
+		t.Errorf("Run(done)=%+v,%v, want 7 rows scanned, no error", p, err)
+	}
+	if err := r.Reset(); err != nil {
+		t.Fatalf("Reset()=%v, want no error", err)
+	}
+	if p, err := r.Run(context.Background()); err != nil || p.RowsScanned != 7 || p.RowsChanged != 0 {
+		t.Errorf("Run(reset)=%+v,%v, want 7 rows scanned, 0 changed", p, err)
+	}
+}
+
+func TestIdentityHashMigration(t *testing.T) {
+	logID := createLogID("TestIdentityHashMigration")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+
+	// Leaf 5 is a second copy of the certificate in leaf 1.
+	certs := []string{"cert 0", "cert 1", "cert 2", "cert 3", "cert 4", "cert 1"}
+	for seq, cert := range certs {
+		data := []byte(fmt.Sprintf("leaf %d", seq))
+		createFakeLeaf(db, logID.logID, crypto.NewSHA256().Digest(data), []byte("hash"), data, []byte(cert), int64(seq), t)
+	}
+	// Leaf 0 was queued with an identity hash the migration doesn't compute.
+	if _, err := db.Exec("UPDATE LeafData SET LeafIdentityHash=? WHERE TreeId=? AND LeafValue=?", []byte("queued"), logID.logID, []byte("leaf 0")); err != nil {
+		t.Fatalf("Failed to set identity hash of leaf 0: %v", err)
+	}
+	// The identity of a leaf is the hash of its extra data, except for leaf 4, which
+	// doesn't have one.
+	identity := func(value, extraData []byte) ([]byte, error) {
+		if string(value) == "leaf 4" {
+			return nil, nil
+		}
+		return crypto.NewSHA256().Digest(extraData), nil
+	}
+
+	r := NewMigrationRunner(db, logID.logID, NewIdentityHashMigration(identity))
+	r.BatchSize = 2
+	r.BatchInterval = 0
+	p, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run()=_,%v, want no error", err)
+	}
+	if !p.Done || p.RowsScanned != 6 || p.RowsChanged != 3 {
+		t.Errorf("Run()=%+v, want done, 6 rows scanned, 3 changed", p)
+	}
+
+	s := prepareTestLogStorage(logID, t)
+	tx := beginLogTx(s, t)
+	defer tx.Commit()
+	for _, test := range []struct {
+		identity string
+		want     int
+	}{
+		{identity: "cert 0", want: 0},
+		{identity: "cert 1", want: 1},
+		{identity: "cert 2", want: 1},
+		{identity: "cert 3", want: 1},
+		{identity: "cert 4", want: 0},
+	} {
+		leaves, err := tx.GetLeavesByIdentityHash([][]byte{crypto.NewSHA256().Digest([]byte(test.identity))})
+		if err != nil {
+			t.Fatalf("GetLeavesByIdentityHash(%s)=_,%v, want no error", test.identity, err)
+		}
+		if got := len(leaves); got != test.want {
+			t.Errorf("GetLeavesByIdentityHash(%s)=%d leaves, want %d", test.identity, got, test.want)
+		}
+	}
+	if leaves, err := tx.GetLeavesByIdentityHash([][]byte{[]byte("queued")}); err != nil || len(leaves) != 1 {
+		t.Errorf("GetLeavesByIdentityHash(queued)=%d leaves,%v, want 1 leaf", len(leaves), err)
+	}
+}
+
+func TestMigrationByName(t *testing.T) {
+	hasher := merkle.NewRFC6962TreeHasher(crypto.NewSHA256())
+	identity := func(value, extraData []byte) ([]byte, error) { return nil, nil }
+	if m, err := MigrationByName("merkle-leaf-hash", hasher, nil); err != nil || m.Name() != "merkle-leaf-hash" {
+		t.Errorf("MigrationByName(merkle-leaf-hash)=%v,%v, want merkle-leaf-hash migration", m, err)
+	}
+	if m, err := MigrationByName("leaf-identity-hash", hasher, identity); err != nil || m.Name() != "leaf-identity-hash" {
+		t.Errorf("MigrationByName(leaf-identity-hash)=%v,%v, want leaf-identity-hash migration", m, err)
+	}
+	if m, err := MigrationByName("leaf-identity-hash", hasher, nil); err == nil {
+		t.Errorf("MigrationByName(leaf-identity-hash, no identity)=%v,nil, want error", m)
+	}
+	if m, err := MigrationByName("unknown", hasher, identity); err == nil {
+		t.Errorf("MigrationByName(unknown)=%v,nil, want error", m)
+	}
+}
@@ -30,6 +30,17 @@ CREATE TABLE IF NOT EXISTS TreeControl(
   FOREIGN KEY(TreeId) REFERENCES Trees(TreeId)
 );
 
+-- The access control list of a tree. Scope is the name of the scope granted to the
+-- principal, who is allowed everything the scope allows. The principal '*' matches
+-- every caller.
+CREATE TABLE IF NOT EXISTS TreeACL(
+  TreeId                  INTEGER NOT NULL,
+  Principal               VARCHAR(255) NOT NULL,
+  Scope                   VARCHAR(32) NOT NULL,
+  PRIMARY KEY(TreeId, Principal),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
 CREATE TABLE IF NOT EXISTS Subtree(
   TreeId               INTEGER NOT NULL,
   SubtreeId            VARBINARY(255) NOT NULL,
@@ -50,9 +61,36 @@ CREATE TABLE IF NOT EXISTS TreeHead(
   TreeRevision         BIGINT,
   PRIMARY KEY(TreeId, TreeHeadTimestamp),
   UNIQUE INDEX TreeRevisionIdx(TreeId, TreeRevision),
+  INDEX TreeSizeIdx(TreeId, TreeSize),
   FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
 );
 
+-- The compact range of the tree at each size that has a tree head, so that
+-- consistency proofs from old sizes don't need to read the nodes it covers.
+-- Hashes holds the range's hashes concatenated from the leaves up, one for
+-- each bit set in TreeSize.
+CREATE TABLE IF NOT EXISTS CompactRange(
+  TreeId               INTEGER NOT NULL,
+  TreeSize             BIGINT NOT NULL,
+  Hashes               VARBINARY(4096) NOT NULL,
+  PRIMARY KEY(TreeId, TreeSize),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
+
+-- How far each migration of a tree's data has got, so that a migration that's
+-- interrupted can carry on where it left off. NextKey is where the next batch of
+-- rows starts, in the migration's own encoding.
+CREATE TABLE IF NOT EXISTS MigrationProgress(
+  TreeId               INTEGER NOT NULL,
+  Name                 VARCHAR(64) NOT NULL,
+  NextKey              VARBINARY(255) NOT NULL,
+  RowsScanned          BIGINT NOT NULL,
+  RowsChanged          BIGINT NOT NULL,
+  Done                 BOOLEAN NOT NULL,
+  UpdatedNanos         BIGINT NOT NULL,
+  PRIMARY KEY(TreeId, Name),
+  FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
+);
 
 -- ---------------------------------------------
 -- Log specific stuff here
@@ -75,8 +113,14 @@ CREATE TABLE IF NOT EXISTS LeafData(
   -- This is extra data that the application can associate with the leaf should it wish to.
   -- This data is not included in signing and hashing.
   ExtraData            BLOB,
+  -- Leaves with the same identity hash are the same entry even if their values differ,
+  -- for example in CT two submissions of a certificate, which have different timestamps.
+  -- It's NULL for leaves queued without one. The index on it is unique so that concurrent
+  -- submissions of the same entry can't both be queued.
+  LeafIdentityHash     VARBINARY(255),
   PRIMARY KEY(TreeId, LeafValueHash),
   INDEX LeafHashIdx(LeafValueHash),
+  UNIQUE INDEX LeafIdentityHashIdx(TreeId, LeafIdentityHash),
   FOREIGN KEY(TreeId) REFERENCES Trees(TreeId) ON DELETE CASCADE
 );
 
@@ -114,7 +158,15 @@ CREATE TABLE IF NOT EXISTS Unsequenced(
   MessageId            BINARY(32) NOT NULL,
   Payload              BLOB NOT NULL,
   QueueTimestampNanos  BIGINT NOT NULL,
-  PRIMARY KEY (TreeId, LeafValueHash, MessageId)
+  -- The time the leaf should be integrated by, leaves are dequeued in this order. It's
+  -- the queue time for leaves queued without a deadline.
+  MergeDeadlineNanos   BIGINT NOT NULL,
+  -- The request ID the leaf was queued under, so a leaf that's stuck in the queue can
+  -- be found from the personality's logs. It's NULL for leaves queued without one.
+  CorrelationId        VARCHAR(255),
+  PRIMARY KEY (TreeId, LeafValueHash, MessageId),
+  INDEX QueueOrderIdx(TreeId, MergeDeadlineNanos, QueueTimestampNanos),
+  INDEX CorrelationIdx(TreeId, CorrelationId)
 );
 
 
@@ -6,6 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"reflect"
 	"sync"
 	"testing"
 
@@ -106,6 +107,45 @@ func TestNodeRoundTrip(t *testing.T) {
 	}
 }
 
+func TestTreeACLRoundTrip(t *testing.T) {
+	logID := createLogID("TestTreeACLRoundTrip")
+	db := prepareTestLogDB(logID, t)
+	defer db.Close()
+	s := prepareTestLogStorage(logID, t)
+
+	for _, acl := range []storage.TreeACL{
+		{"alice": "tree:admin", "*": "tree:read"},
+		{"bob": "tree:write"},
+		{},
+	} {
+		tx, err := s.Begin()
+		if err != nil {
+			t.Fatalf("Failed to Begin: %s", err)
+		}
+		if err := tx.SetTreeACL(acl); err != nil {
+			t.Fatalf("SetTreeACL(%v)=%v, want no error", acl, err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit ACL: %s", err)
+		}
+
+		snapshot, err := s.Snapshot()
+		if err != nil {
+			t.Fatalf("Failed to Snapshot: %s", err)
+		}
+		got, err := snapshot.GetTreeACL()
+		if err != nil {
+			t.Fatalf("GetTreeACL()=_,%v, want no error", err)
+		}
+		if !reflect.DeepEqual(got, acl) {
+			t.Errorf("GetTreeACL()=%v, want %v", got, acl)
+		}
+		if err := snapshot.Commit(); err != nil {
+			t.Fatalf("Failed to commit read: %s", err)
+		}
+	}
+}
+
 func forceWriteRevision(rev int64, tx storage.TreeTX) {
 	mtx, ok := tx.(*logTX)
 	if !ok {
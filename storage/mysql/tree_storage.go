@@ -19,6 +19,10 @@ const insertSubtreeMultiSQL string = `INSERT INTO Subtree(TreeId, SubtreeId, Nod
 const insertTreeHeadSQL string = `INSERT INTO TreeHead(TreeId,TreeHeadTimestamp,TreeSize,RootHash,TreeRevision,RootSignature)
 		 VALUES(?,?,?,?,?,?)`
 const selectTreeRevisionAtSizeSQL string = "SELECT TreeRevision FROM TreeHead WHERE TreeId=? AND TreeSize=? ORDER BY TreeRevision DESC LIMIT 1"
+const lockTreeSQL string = "SELECT TreeId FROM Trees WHERE TreeId=? FOR UPDATE"
+const selectTreeACLSQL string = "SELECT Principal, Scope FROM TreeACL WHERE TreeId=?"
+const deleteTreeACLSQL string = "DELETE FROM TreeACL WHERE TreeId=?"
+const insertTreeACLSQL string = "INSERT INTO TreeACL(TreeId, Principal, Scope) VALUES(?, ?, ?)"
 const selectActiveLogsSQL string = "select TreeId, KeyId from Trees where TreeType='LOG'"
 const selectActiveLogsWithUnsequencedSQL string = "SELECT DISTINCT t.TreeId, t.KeyId from Trees t INNER JOIN Unsequenced u WHERE TreeType='LOG' AND t.TreeId=u.TreeId"
 
@@ -199,6 +203,20 @@ func (m *mySQLTreeStorage) beginTreeTx() (treeTX, error) {
 	}, nil
 }
 
+// lockTree takes a row lock on the tree's entry in the Trees table, which is held until
+// the transaction commits or rolls back. Transactions that sequence or sign the same tree
+// serialize on this lock, while transactions for different trees lock different rows so
+// don't contend.
+// Trees with no entry (e.g. ID zero, used for metadata operations) are not locked.
+func (t *treeTX) lockTree() error {
+	var treeID int64
+	if err := t.tx.QueryRow(lockTreeSQL, t.ts.treeID).Scan(&treeID); err != nil && err != sql.ErrNoRows {
+		glog.Warningf("Failed to lock tree %d: %s", t.ts.treeID, err)
+		return err
+	}
+	return nil
+}
+
 type treeTX struct {
 	closed        bool
 	tx            *sql.Tx
@@ -395,6 +413,40 @@ func (t *treeTX) SetMerkleNodes(nodes []storage.Node) error {
 	return nil
 }
 
+func (t *treeTX) GetTreeACL() (storage.TreeACL, error) {
+	rows, err := t.tx.Query(selectTreeACLSQL, t.ts.treeID)
+	if err != nil {
+		glog.Warningf("Failed to read ACL of tree %d: %s", t.ts.treeID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	acl := make(storage.TreeACL)
+	for rows.Next() {
+		var principal, scope string
+		if err := rows.Scan(&principal, &scope); err != nil {
+			glog.Warningf("Failed to scan ACL entry: %s", err)
+			return nil, err
+		}
+		acl[principal] = scope
+	}
+	return acl, rows.Err()
+}
+
+func (t *treeTX) SetTreeACL(acl storage.TreeACL) error {
+	if _, err := t.tx.Exec(deleteTreeACLSQL, t.ts.treeID); err != nil {
+		glog.Warningf("Failed to clear ACL of tree %d: %s", t.ts.treeID, err)
+		return err
+	}
+	for principal, scope := range acl {
+		if _, err := t.tx.Exec(insertTreeACLSQL, t.ts.treeID, principal, scope); err != nil {
+			glog.Warningf("Failed to store ACL entry for %q on tree %d: %s", principal, t.ts.treeID, err)
+			return err
+		}
+	}
+	return nil
+}
+
 func (t *treeTX) Commit() error {
 	if t.writeRevision > -1 {
 		t.subtreeCache.Flush(t.storeSubtrees)
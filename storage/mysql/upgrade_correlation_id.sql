@@ -0,0 +1,9 @@
+-- Upgrades a database created before Unsequenced had a CorrelationId column, which
+-- storage.sql doesn't do as its tables are only created if they don't exist. Stop the
+-- log servers and sequencers before running it, and start the new versions afterwards.
+--
+-- Leaves that were already queued get a NULL correlation ID, so they can only be found
+-- by their Merkle leaf hash.
+
+ALTER TABLE Unsequenced ADD COLUMN CorrelationId VARCHAR(255);
+ALTER TABLE Unsequenced ADD INDEX CorrelationIdx(TreeId, CorrelationId);
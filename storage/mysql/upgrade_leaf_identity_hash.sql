@@ -0,0 +1,10 @@
+-- Upgrades a database created before LeafData had a LeafIdentityHash column, which
+-- storage.sql doesn't do as its tables are only created if they don't exist. Stop the
+-- log servers before running it, and start the new versions afterwards.
+--
+-- Leaves that are already in the log get a NULL identity hash, so they aren't found as
+-- duplicates until it's filled in by the identity hash migration, see
+-- storage/tools/migrate_leaves.
+
+ALTER TABLE LeafData ADD COLUMN LeafIdentityHash VARBINARY(255);
+ALTER TABLE LeafData ADD UNIQUE INDEX LeafIdentityHashIdx(TreeId, LeafIdentityHash);
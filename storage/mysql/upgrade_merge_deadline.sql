@@ -0,0 +1,11 @@
+-- Upgrades a database created before Unsequenced had a MergeDeadlineNanos column, which
+-- storage.sql doesn't do as its tables are only created if they don't exist. Stop the
+-- log servers and sequencers before running it, and start the new versions afterwards.
+--
+-- Leaves that were already queued get their queue time as their deadline, which is what
+-- leaves queued without a deadline get.
+
+ALTER TABLE Unsequenced ADD COLUMN MergeDeadlineNanos BIGINT NOT NULL DEFAULT 0;
+UPDATE Unsequenced SET MergeDeadlineNanos=QueueTimestampNanos;
+ALTER TABLE Unsequenced ALTER COLUMN MergeDeadlineNanos DROP DEFAULT;
+ALTER TABLE Unsequenced ADD INDEX QueueOrderIdx(TreeId, MergeDeadlineNanos, QueueTimestampNanos);
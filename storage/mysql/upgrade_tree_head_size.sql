@@ -0,0 +1,6 @@
+-- Upgrades a database created before TreeHead had an index on TreeSize, which
+-- storage.sql doesn't do as its tables are only created if they don't exist. Without it
+-- looking up the tree head for a size, as GetTreeHeadBySize does, scans every tree head
+-- of the tree.
+
+ALTER TABLE TreeHead ADD INDEX TreeSizeIdx(TreeId, TreeSize);
@@ -0,0 +1,158 @@
+// The backup_log binary takes incremental backups of a log tree held in MySQL storage,
+// and restores them. Each run of export writes a manifest and a data file to backup_dir
+// holding everything written to the tree since the previous backup in the directory, or
+// a full backup if there isn't one. Restore applies every backup in backup_dir in order,
+// checking the chain and the root hash of the rebuilt tree as it goes. A backup_dir should
+// only hold backups of one tree.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/golang/glog"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage/mysql"
+	"github.com/google/trillian/storage/tools"
+)
+
+var modeFlag = flag.String("mode", "export", "Either export or restore")
+var treeIDFlag = flag.Int64("treeid", 3, "The tree id to export, or to restore into")
+var backupDirFlag = flag.String("backup_dir", "", "The directory holding the backup chain")
+
+const manifestSuffix = ".manifest.json"
+const dataSuffix = ".data"
+
+// backupName returns the file name prefix for the backup of a tree up to revision.
+func backupName(treeID, revision int64) string {
+	return fmt.Sprintf("backup-%d-%020d", treeID, revision)
+}
+
+// readManifests returns the manifests in dir ordered by revision, along with the path
+// prefix of each.
+func readManifests(dir string) ([]*mysql.BackupManifest, []string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "backup-*"+manifestSuffix))
+	if err != nil {
+		return nil, nil, err
+	}
+	// The zero padded revision in the names means this is revision order.
+	sort.Strings(files)
+
+	var manifests []*mysql.BackupManifest
+	var prefixes []string
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		var m mysql.BackupManifest
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %v", f, err)
+		}
+		manifests = append(manifests, &m)
+		prefixes = append(prefixes, strings.TrimSuffix(f, manifestSuffix))
+	}
+	return manifests, prefixes, nil
+}
+
+func export() error {
+	manifests, _, err := readManifests(*backupDirFlag)
+	if err != nil {
+		return err
+	}
+	var prev *mysql.BackupManifest
+	for _, m := range manifests {
+		if m.TreeID == *treeIDFlag {
+			prev = m
+		}
+	}
+
+	// Write the data under a temporary name so an interrupted export doesn't leave a
+	// backup that looks complete.
+	tmp, err := ioutil.TempFile(*backupDirFlag, "partial-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	db := tools.GetMySQLDBFromFlagsOrDie()
+	defer db.Close()
+	m, err := mysql.ExportLogBackup(db, *treeIDFlag, prev, tmp)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if prev != nil && m.ToRevision == prev.ToRevision {
+		glog.Infof("Tree %d unchanged since backup of revision %d", *treeIDFlag, m.ToRevision)
+		return nil
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	prefix := filepath.Join(*backupDirFlag, backupName(m.TreeID, m.ToRevision))
+	if err := os.Rename(tmp.Name(), prefix+dataSuffix); err != nil {
+		return err
+	}
+	// The manifest is written last, it's what marks the backup as present.
+	return ioutil.WriteFile(prefix+manifestSuffix, b, 0644)
+}
+
+func restore() error {
+	manifests, prefixes, err := readManifests(*backupDirFlag)
+	if err != nil {
+		return err
+	}
+	if len(manifests) == 0 {
+		return fmt.Errorf("no backups found in %s", *backupDirFlag)
+	}
+
+	db := tools.GetMySQLDBFromFlagsOrDie()
+	defer db.Close()
+	r := mysql.NewBackupRestorer(db, *treeIDFlag, merkle.NewRFC6962TreeHasher(crypto.NewSHA256()))
+	for i, m := range manifests {
+		f, err := os.Open(prefixes[i] + dataSuffix)
+		if err != nil {
+			return err
+		}
+		err = r.Apply(m, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %v", prefixes[i], err)
+		}
+	}
+	return nil
+}
+
+func main() {
+	flag.Parse()
+
+	if len(*backupDirFlag) == 0 {
+		glog.Fatal("--backup_dir must be set")
+	}
+
+	var err error
+	switch *modeFlag {
+	case "export":
+		err = export()
+	case "restore":
+		err = restore()
+	default:
+		glog.Fatalf("Unknown mode: %s", *modeFlag)
+	}
+	if err != nil {
+		glog.Fatalf("Failed to %s tree %d: %v", *modeFlag, *treeIDFlag, err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	log "github.com/golang/glog"
+	"github.com/google/trillian/server"
+	"github.com/google/trillian/storage/tools"
+)
+
+var treeIDFlag = flag.Int64("treeid", 3, "The tree id to check")
+var batchSizeFlag = flag.Int64("batch_size", 1000, "Number of leaves read in each transaction")
+
+// Checks all the sequenced leaves of a log for duplicate or missing indices, e.g. after
+// restoring a backup. Exits with status 1 if any are found, and 2 if the check fails.
+func main() {
+	flag.Parse()
+	if *batchSizeFlag <= 0 {
+		panic("Invalid value for batch_size")
+	}
+
+	storage := tools.GetStorageFromFlagsOrDie(*treeIDFlag)
+
+	problems, err := server.CheckLeafIndices(storage, *batchSizeFlag)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if err != nil {
+		log.Errorf("Check of tree %d failed: %v", *treeIDFlag, err)
+		log.Flush()
+		os.Exit(2)
+	}
+	if len(problems) > 0 {
+		log.Errorf("Found %d problems with the leaf indices of tree %d", len(problems), *treeIDFlag)
+		log.Flush()
+		os.Exit(1)
+	}
+	log.Infof("Leaf indices of tree %d are consistent", *treeIDFlag)
+}
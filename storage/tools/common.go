@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"database/sql"
 	"flag"
 	"fmt"
 
@@ -60,3 +61,19 @@ func GetMapStorageFromFlags(treeID int64) (storage.MapStorage, error) {
 func GetLogServerPort() int {
 	return *serverPortFlag
 }
+
+// GetMySQLDBFromFlagsOrDie returns a database handle for the MySQL instance configured by
+// our flag settings, for tools that work below the storage API. Errors are fatal.
+func GetMySQLDBFromFlagsOrDie() *sql.DB {
+	if *storageTypeFlag != "mysql" {
+		panic(fmt.Errorf("Storage type %s is not mysql", *storageTypeFlag))
+	}
+
+	db, err := sql.Open("mysql", *mysqlURIFlag)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return db
+}
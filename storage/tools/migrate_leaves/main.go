@@ -0,0 +1,83 @@
+// The migrate_leaves binary recomputes a column derived from the leaves of a log tree held
+// in MySQL storage, such as the Merkle leaf hashes, and stores it for existing leaves. It
+// works in small batches with a pause between them, so it can be run against a live log,
+// and saves its progress as it goes, so if it's stopped (e.g. with Ctrl-C) running it
+// again carries on where it left off. With --status it only reports the progress. The
+// leaf-identity-hash migration computes the identity hashes the application given by
+// --identity would have queued the leaves with.
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/golang/glog"
+	"github.com/google/trillian/crypto"
+	ctfe "github.com/google/trillian/examples/ct"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage/mysql"
+	"github.com/google/trillian/storage/tools"
+	"golang.org/x/net/context"
+)
+
+var treeIDFlag = flag.Int64("treeid", 3, "The tree id to migrate")
+var migrationFlag = flag.String("migration", "merkle-leaf-hash", "The migration to run: merkle-leaf-hash or leaf-identity-hash")
+var identityFlag = flag.String("identity", "ct", "The application whose identity hashes leaf-identity-hash computes")
+var batchSizeFlag = flag.Int("batch_size", 100, "The most leaves updated in one transaction")
+var batchIntervalFlag = flag.Duration("batch_interval", 100*time.Millisecond, "The pause between batches")
+var resetFlag = flag.Bool("reset", false, "Start the migration again from the first leaf")
+var statusFlag = flag.Bool("status", false, "Only report how far the migration has got")
+
+// identityFuncs are the identity hash functions of the applications that supply them.
+var identityFuncs = map[string]mysql.IdentityHashFunc{
+	"ct": ctfe.LeafIdentityHash,
+}
+
+func main() {
+	flag.Parse()
+
+	identity, ok := identityFuncs[*identityFlag]
+	if !ok {
+		glog.Fatalf("Unknown identity hash function %q", *identityFlag)
+	}
+	m, err := mysql.MigrationByName(*migrationFlag, merkle.NewRFC6962TreeHasher(crypto.NewSHA256()), identity)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	db := tools.GetMySQLDBFromFlagsOrDie()
+	defer db.Close()
+	r := mysql.NewMigrationRunner(db, *treeIDFlag, m)
+	r.BatchSize = *batchSizeFlag
+	r.BatchInterval = *batchIntervalFlag
+
+	if *statusFlag {
+		p, err := r.Progress()
+		if err != nil {
+			glog.Fatal(err)
+		}
+		glog.Infof("Migration %s of tree %d: done=%v, %d rows scanned, %d changed, last batch at %v", m.Name(), *treeIDFlag, p.Done, p.RowsScanned, p.RowsChanged, p.Updated)
+		return
+	}
+	if *resetFlag {
+		if err := r.Reset(); err != nil {
+			glog.Fatalf("Failed to reset migration %s of tree %d: %v", m.Name(), *treeIDFlag, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		glog.Info("Stopping after the current batch")
+		cancel()
+	}()
+	if p, err := r.Run(ctx); err == context.Canceled {
+		glog.Infof("Migration %s of tree %d stopped after %d rows, run again to carry on", m.Name(), *treeIDFlag, p.RowsScanned)
+	} else if err != nil {
+		glog.Fatalf("Migration %s of tree %d failed: %v", m.Name(), *treeIDFlag, err)
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage"
+)
+
+// The depth of the log tree, as used by the sequencer when storing nodes
+const maxTreeDepth = 64
+
+// Limits on how much output a single command can produce
+const (
+	maxSubtreeDepth = 6
+	maxRangeLeaves  = 1 << 16
+	maxDiffNodes    = 1 << 16
+)
+
+var errUsage = errors.New("bad arguments")
+
+type command struct {
+	usage string
+	help  string
+	run   func(c *console, args []int64) error
+}
+
+// console runs debug commands against the storage for a single log.
+type console struct {
+	storage storage.LogStorage
+	hasher  merkle.TreeHasher
+	out     io.Writer
+}
+
+var commands = map[string]command{
+	"root": {
+		usage: "root",
+		help:  "print the latest signed log root",
+		run:   (*console).root,
+	},
+	"node": {
+		usage: "node <level> <index> [tree_size]",
+		help:  "print the hash of the node at the given coordinates, at the revision for tree_size (default latest)",
+		run:   (*console).node,
+	},
+	"subtree": {
+		usage: "subtree <level> <index> [depth] [tree_size]",
+		help:  fmt.Sprintf("dump the stored nodes of the subtree under a node, down to depth levels below it (default and max %d)", maxSubtreeDepth),
+		run:   (*console).subtree,
+	},
+	"range": {
+		usage: "range <start> <end>",
+		help:  "recompute the Merkle tree hash of the sequenced leaves in [start, end) and compare it with the stored node, if there is one",
+		run:   (*console).rangeHash,
+	},
+	"diff": {
+		usage: "diff <tree_size1> <tree_size2> <level> <from> <to>",
+		help:  "print the nodes at level with index in [from, to) that differ between the revisions for two tree sizes",
+		run:   (*console).diff,
+	},
+}
+
+// run reads commands from in, one per line, until it is exhausted or a quit command
+// is read.
+func (c *console) run(in io.Reader, prompt string) {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(c.out, prompt)
+		if !scanner.Scan() {
+			return
+		}
+		if quit := c.exec(scanner.Text()); quit {
+			return
+		}
+	}
+}
+
+// exec runs a single command line and returns true if the console should exit.
+func (c *console) exec(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch name := fields[0]; name {
+	case "quit", "exit":
+		return true
+	case "help", "?":
+		c.help()
+	default:
+		cmd, ok := commands[name]
+		if !ok {
+			fmt.Fprintf(c.out, "unknown command: %s, try help\n", name)
+			return false
+		}
+		args := make([]int64, 0, len(fields)-1)
+		for _, f := range fields[1:] {
+			arg, err := strconv.ParseInt(f, 10, 64)
+			if err != nil {
+				fmt.Fprintf(c.out, "invalid argument %q, usage: %s\n", f, cmd.usage)
+				return false
+			}
+			args = append(args, arg)
+		}
+		if err := cmd.run(c, args); err == errUsage {
+			fmt.Fprintf(c.out, "usage: %s\n", cmd.usage)
+		} else if err != nil {
+			fmt.Fprintf(c.out, "error: %v\n", err)
+		}
+	}
+	return false
+}
+
+func (c *console) help() {
+	for _, name := range []string{"root", "node", "subtree", "range", "diff"} {
+		cmd := commands[name]
+		fmt.Fprintf(c.out, "  %-50s %s\n", cmd.usage, cmd.help)
+	}
+	fmt.Fprintf(c.out, "  %-50s %s\n", "quit", "exit the console")
+}
+
+// withSnapshot runs f in a read only transaction, which is committed if f succeeds.
+func (c *console) withSnapshot(f func(tx storage.ReadOnlyLogTX) error) error {
+	tx, err := c.storage.Snapshot()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// revisionForSize returns the tree revision for treeSize, or for the latest root if
+// treeSize is zero.
+func revisionForSize(tx storage.ReadOnlyLogTX, treeSize int64) (int64, error) {
+	if treeSize > 0 {
+		return tx.GetTreeRevisionAtSize(treeSize)
+	}
+	root, err := tx.LatestSignedLogRoot()
+	if err != nil {
+		return 0, err
+	}
+	return root.TreeRevision, nil
+}
+
+// getNodes fetches the nodes at level with index in [from, to) at treeRevision, keyed
+// by index. Nodes that aren't stored are absent from the result.
+func getNodes(tx storage.ReadOnlyLogTX, treeRevision, level, from, to int64) (map[int64]storage.Node, error) {
+	ids := make([]storage.NodeID, 0, to-from)
+	for index := from; index < to; index++ {
+		id, err := storage.NewNodeIDForTreeCoords(level, index, maxTreeDepth)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	nodes, err := tx.GetMerkleNodes(treeRevision, ids)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int64]storage.Node)
+	for _, node := range nodes {
+		for i, id := range ids {
+			if node.NodeID.Equivalent(id) {
+				result[from+int64(i)] = node
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (c *console) root(args []int64) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	return c.withSnapshot(func(tx storage.ReadOnlyLogTX) error {
+		root, err := tx.LatestSignedLogRoot()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "tree_size=%d revision=%d timestamp=%d root_hash=%x\n", root.TreeSize, root.TreeRevision, root.TimestampNanos, root.RootHash)
+		return nil
+	})
+}
+
+func (c *console) node(args []int64) error {
+	if len(args) < 2 || len(args) > 3 {
+		return errUsage
+	}
+	level, index := args[0], args[1]
+	var treeSize int64
+	if len(args) == 3 {
+		treeSize = args[2]
+	}
+
+	return c.withSnapshot(func(tx storage.ReadOnlyLogTX) error {
+		rev, err := revisionForSize(tx, treeSize)
+		if err != nil {
+			return err
+		}
+		nodes, err := getNodes(tx, rev, level, index, index+1)
+		if err != nil {
+			return err
+		}
+		c.printNode(level, index, nodes)
+		return nil
+	})
+}
+
+func (c *console) subtree(args []int64) error {
+	if len(args) < 2 || len(args) > 4 {
+		return errUsage
+	}
+	level, index := args[0], args[1]
+	depth := int64(maxSubtreeDepth)
+	if len(args) > 2 {
+		depth = args[2]
+	}
+	var treeSize int64
+	if len(args) > 3 {
+		treeSize = args[3]
+	}
+	if depth < 0 || depth > maxSubtreeDepth {
+		return fmt.Errorf("depth must be between 0 and %d", maxSubtreeDepth)
+	}
+	if depth > level {
+		depth = level
+	}
+
+	return c.withSnapshot(func(tx storage.ReadOnlyLogTX) error {
+		rev, err := revisionForSize(tx, treeSize)
+		if err != nil {
+			return err
+		}
+		for d := int64(0); d <= depth; d++ {
+			from := index << uint(d)
+			to := (index + 1) << uint(d)
+			nodes, err := getNodes(tx, rev, level-d, from, to)
+			if err != nil {
+				return err
+			}
+			for i := from; i < to; i++ {
+				fmt.Fprint(c.out, strings.Repeat("  ", int(d)))
+				c.printNode(level-d, i, nodes)
+			}
+		}
+		return nil
+	})
+}
+
+func (c *console) printNode(level, index int64, nodes map[int64]storage.Node) {
+	if node, ok := nodes[index]; ok {
+		fmt.Fprintf(c.out, "[d:%d, i:%d] rev=%d hash=%x\n", level, index, node.NodeRevision, node.Hash)
+	} else {
+		fmt.Fprintf(c.out, "[d:%d, i:%d] not stored\n", level, index)
+	}
+}
+
+func (c *console) rangeHash(args []int64) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	start, end := args[0], args[1]
+	if start < 0 || end <= start {
+		return fmt.Errorf("invalid range [%d, %d)", start, end)
+	}
+	if end-start > maxRangeLeaves {
+		return fmt.Errorf("range too large, max %d leaves", maxRangeLeaves)
+	}
+
+	return c.withSnapshot(func(tx storage.ReadOnlyLogTX) error {
+		indices := make([]int64, 0, end-start)
+		for i := start; i < end; i++ {
+			indices = append(indices, i)
+		}
+		leaves, err := tx.GetLeavesByIndex(indices)
+		if err != nil {
+			return err
+		}
+		if got, want := int64(len(leaves)), end-start; got != want {
+			return fmt.Errorf("got %d leaves from storage, want %d", got, want)
+		}
+		leafHashes := make([][]byte, end-start)
+		for _, leaf := range leaves {
+			if leaf.LeafIndex < start || leaf.LeafIndex >= end {
+				return fmt.Errorf("storage returned unexpected leaf index %d", leaf.LeafIndex)
+			}
+			leafHashes[leaf.LeafIndex-start] = leaf.MerkleLeafHash
+		}
+
+		hash := treeHash(c.hasher, leafHashes)
+		fmt.Fprintf(c.out, "range [%d, %d) hash=%x\n", start, end, hash)
+
+		// A range that's a complete, aligned subtree should match a stored node.
+		size := end - start
+		if size&(size-1) != 0 || start%size != 0 {
+			return nil
+		}
+		level := int64(bitLen(size) - 1)
+		root, err := tx.LatestSignedLogRoot()
+		if err != nil {
+			return err
+		}
+		nodes, err := getNodes(tx, root.TreeRevision, level, start>>uint(level), start>>uint(level)+1)
+		if err != nil {
+			return err
+		}
+		node, ok := nodes[start>>uint(level)]
+		switch {
+		case !ok:
+			fmt.Fprintf(c.out, "no stored node [d:%d, i:%d]\n", level, start>>uint(level))
+		case bytes.Equal(node.Hash, hash):
+			fmt.Fprintf(c.out, "matches stored node [d:%d, i:%d]\n", level, start>>uint(level))
+		default:
+			fmt.Fprintf(c.out, "MISMATCH with stored node [d:%d, i:%d] hash=%x\n", level, start>>uint(level), node.Hash)
+		}
+		return nil
+	})
+}
+
+func (c *console) diff(args []int64) error {
+	if len(args) != 5 {
+		return errUsage
+	}
+	size1, size2, level, from, to := args[0], args[1], args[2], args[3], args[4]
+	if from < 0 || to <= from {
+		return fmt.Errorf("invalid index range [%d, %d)", from, to)
+	}
+	if to-from > maxDiffNodes {
+		return fmt.Errorf("range too large, max %d nodes", maxDiffNodes)
+	}
+
+	return c.withSnapshot(func(tx storage.ReadOnlyLogTX) error {
+		rev1, err := revisionForSize(tx, size1)
+		if err != nil {
+			return err
+		}
+		rev2, err := revisionForSize(tx, size2)
+		if err != nil {
+			return err
+		}
+		nodes1, err := getNodes(tx, rev1, level, from, to)
+		if err != nil {
+			return err
+		}
+		nodes2, err := getNodes(tx, rev2, level, from, to)
+		if err != nil {
+			return err
+		}
+
+		diffs := 0
+		for i := from; i < to; i++ {
+			n1, ok1 := nodes1[i]
+			n2, ok2 := nodes2[i]
+			if ok1 == ok2 && bytes.Equal(n1.Hash, n2.Hash) {
+				continue
+			}
+			diffs++
+			fmt.Fprintf(c.out, "[d:%d, i:%d] rev %d: %s rev %d: %s\n", level, i, rev1, formatHash(n1, ok1), rev2, formatHash(n2, ok2))
+		}
+		fmt.Fprintf(c.out, "%d node(s) differ between revisions %d and %d\n", diffs, rev1, rev2)
+		return nil
+	})
+}
+
+func formatHash(node storage.Node, ok bool) string {
+	if !ok {
+		return "<not stored>"
+	}
+	return fmt.Sprintf("%x", node.Hash)
+}
+
+// treeHash calculates the RFC 6962 Merkle tree hash of a list of leaf hashes.
+func treeHash(hasher merkle.TreeHasher, leafHashes [][]byte) []byte {
+	switch n := len(leafHashes); n {
+	case 0:
+		return hasher.HashEmpty()
+	case 1:
+		return leafHashes[0]
+	default:
+		// Split at the largest power of two smaller than n.
+		k := 1
+		for k<<1 < n {
+			k <<= 1
+		}
+		return hasher.HashChildren(treeHash(hasher, leafHashes[:k]), treeHash(hasher, leafHashes[k:]))
+	}
+}
+
+func bitLen(x int64) int {
+	n := 0
+	for ; x > 0; x >>= 1 {
+		n++
+	}
+	return n
+}
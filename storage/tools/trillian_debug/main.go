@@ -0,0 +1,30 @@
+// The trillian_debug binary is an interactive console for inspecting the stored state
+// of a log tree, e.g. when debugging proof mismatches. It connects directly to storage
+// and never writes to it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/storage/tools"
+)
+
+var treeIDFlag = flag.Int64("treeid", 3, "The tree id to inspect")
+
+func main() {
+	flag.Parse()
+
+	c := &console{
+		storage: tools.GetStorageFromFlagsOrDie(*treeIDFlag),
+		hasher:  merkle.NewRFC6962TreeHasher(crypto.NewSHA256()),
+		out:     os.Stdout,
+	}
+
+	fmt.Printf("Inspecting tree %d, type help for a list of commands\n", *treeIDFlag)
+	c.run(os.Stdin, fmt.Sprintf("tree %d> ", *treeIDFlag))
+}
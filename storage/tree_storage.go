@@ -3,6 +3,7 @@ package storage
 // ReadOnlyTreeTX represents a read-only transaction on a TreeStorage.
 type ReadOnlyTreeTX interface {
 	NodeReader
+	TreeACLReader
 	Commit() error
 	Rollback() error
 }
@@ -14,6 +15,8 @@ type ReadOnlyTreeTX interface {
 // released any resources owned by the TreeTX.
 type TreeTX interface {
 	NodeReaderWriter
+	TreeACLReader
+	TreeACLWriter
 
 	// Commit applies the operations performed to the underlying storage, or returns an error.
 	Commit() error
@@ -46,3 +49,20 @@ type NodeReaderWriter interface {
 	// SetMerkleNodes stores the provided nodes, at the transaction's writeRevision.
 	SetMerkleNodes(nodes []Node) error
 }
+
+// TreeACL maps the principals allowed to access a tree to the name of the scope each
+// one was granted. The principal "*" matches every caller, including anonymous ones.
+type TreeACL map[string]string
+
+// TreeACLReader provides access to the access control list stored with a tree.
+type TreeACLReader interface {
+	// GetTreeACL returns the tree's access control list. A tree that never had one
+	// set has an empty list.
+	GetTreeACL() (TreeACL, error)
+}
+
+// TreeACLWriter allows the access control list stored with a tree to be replaced.
+type TreeACLWriter interface {
+	// SetTreeACL replaces the tree's access control list with acl.
+	SetTreeACL(acl TreeACL) error
+}
@@ -11,6 +11,10 @@ import (
 // ErrReadOnly is returned when storage operations are not allowed because a resource is read only
 var ErrReadOnly = errors.New("storage: Operation not allowed because resource is read only")
 
+// ErrDuplicateLeafIdentity is returned by QueueLeaves when a leaf has the same identity hash as
+// a different leaf already in the log, which was usually queued concurrently
+var ErrDuplicateLeafIdentity = errors.New("storage: Leaf identity hash is already in the log")
+
 // Node represents a single node in a Merkle tree.
 type Node struct {
 	NodeID       NodeID
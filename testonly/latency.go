@@ -0,0 +1,75 @@
+package testonly
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/trillian/storage"
+	"github.com/google/trillian/util"
+)
+
+// StorageLatency simulates slow storage for tests that run on a simulated clock. Each
+// write transaction advances the clock by the latency when it begins and again when it
+// commits, so the components under test see the time they would have spent waiting for
+// storage without the test having to sleep. The latency can be changed while the test
+// runs, e.g. to simulate a spell of degraded storage.
+type StorageLatency struct {
+	clock *util.ManualTimeSource
+
+	mu      sync.Mutex
+	latency time.Duration
+}
+
+// NewStorageLatency creates a StorageLatency that advances clock, initially by latency.
+func NewStorageLatency(clock *util.ManualTimeSource, latency time.Duration) *StorageLatency {
+	return &StorageLatency{clock: clock, latency: latency}
+}
+
+// SetLatency changes the time taken by later storage operations.
+func (s *StorageLatency) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = latency
+}
+
+func (s *StorageLatency) wait() {
+	s.mu.Lock()
+	latency := s.latency
+	s.mu.Unlock()
+	s.clock.Advance(latency)
+}
+
+// LogProvider wraps f so that the log storage it returns is slowed down by s.
+func (s *StorageLatency) LogProvider(f GetLogStorageFunc) GetLogStorageFunc {
+	return func(treeID int64) (storage.LogStorage, error) {
+		ls, err := f(treeID)
+		if err != nil {
+			return nil, err
+		}
+		return slowLogStorage{LogStorage: ls, latency: s}, nil
+	}
+}
+
+type slowLogStorage struct {
+	storage.LogStorage
+	latency *StorageLatency
+}
+
+func (s slowLogStorage) Begin() (storage.LogTX, error) {
+	s.latency.wait()
+	tx, err := s.LogStorage.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return slowLogTX{LogTX: tx, latency: s.latency}, nil
+}
+
+type slowLogTX struct {
+	storage.LogTX
+	latency *StorageLatency
+}
+
+func (t slowLogTX) Commit() error {
+	t.latency.wait()
+	return t.LogTX.Commit()
+}
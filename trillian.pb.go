@@ -44,17 +44,21 @@ const (
 	SignatureAlgorithm_ANONYMOUS SignatureAlgorithm = 0
 	SignatureAlgorithm_RSA       SignatureAlgorithm = 1
 	SignatureAlgorithm_ECDSA     SignatureAlgorithm = 3
+	// Ed25519 signs the data itself rather than a hash, so is used with INTRINSIC.
+	SignatureAlgorithm_ED25519 SignatureAlgorithm = 7
 )
 
 var SignatureAlgorithm_name = map[int32]string{
 	0: "ANONYMOUS",
 	1: "RSA",
 	3: "ECDSA",
+	7: "ED25519",
 }
 var SignatureAlgorithm_value = map[string]int32{
 	"ANONYMOUS": 0,
 	"RSA":       1,
 	"ECDSA":     3,
+	"ED25519":   7,
 }
 
 func (x SignatureAlgorithm) String() string {
@@ -70,15 +74,19 @@ type HashAlgorithm int32
 const (
 	HashAlgorithm_NONE   HashAlgorithm = 0
 	HashAlgorithm_SHA256 HashAlgorithm = 4
+	// The signature algorithm hashes the data itself, e.g. ED25519.
+	HashAlgorithm_INTRINSIC HashAlgorithm = 8
 )
 
 var HashAlgorithm_name = map[int32]string{
 	0: "NONE",
 	4: "SHA256",
+	8: "INTRINSIC",
 }
 var HashAlgorithm_value = map[string]int32{
-	"NONE":   0,
-	"SHA256": 4,
+	"NONE":      0,
+	"SHA256":    4,
+	"INTRINSIC": 8,
 }
 
 func (x HashAlgorithm) String() string {
@@ -316,42 +324,44 @@ func init() {
 func init() { proto.RegisterFile("github.com/google/trillian/trillian.proto", fileDescriptor1) }
 
 var fileDescriptor1 = []byte{
-	// 592 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x54, 0xdd, 0x4e, 0xd4, 0x40,
-	0x18, 0xa5, 0x16, 0xd6, 0xdd, 0x8f, 0xed, 0x52, 0xc7, 0xbf, 0x35, 0x90, 0x88, 0x4b, 0x88, 0xc8,
-	0x05, 0x24, 0xab, 0x42, 0x8c, 0xd1, 0xa4, 0x42, 0x11, 0x12, 0xba, 0x90, 0x29, 0x5e, 0xe8, 0x4d,
-	0x33, 0xd0, 0x71, 0x3a, 0x49, 0xdb, 0x29, 0xd3, 0x59, 0x93, 0xe5, 0x25, 0x7c, 0x1f, 0x2f, 0x7c,
-	0x1d, 0xdf, 0xc2, 0x98, 0x76, 0xdb, 0x6e, 0x77, 0x37, 0x26, 0x24, 0x7a, 0x37, 0xdf, 0x99, 0xd3,
-	0x33, 0xe7, 0xfb, 0x4e, 0x67, 0xe0, 0x05, 0xe3, 0x2a, 0x18, 0x5e, 0xee, 0x5c, 0x89, 0x68, 0x97,
-	0x09, 0xc1, 0x42, 0xba, 0xab, 0x24, 0x0f, 0x43, 0x4e, 0xe2, 0x6a, 0xb1, 0x93, 0x48, 0xa1, 0x04,
-	0x6a, 0x96, 0x75, 0xef, 0xa7, 0x06, 0x2b, 0x87, 0x9c, 0x71, 0x45, 0xc2, 0x70, 0xe4, 0x72, 0x16,
-	0x53, 0x1f, 0x39, 0x70, 0x3f, 0xe5, 0x2c, 0x26, 0x6a, 0x28, 0xa9, 0x47, 0x42, 0x26, 0x24, 0x57,
-	0x41, 0xd4, 0xd5, 0xd6, 0xb5, 0xad, 0x4e, 0x7f, 0x6d, 0xa7, 0xd2, 0x72, 0x4b, 0x92, 0x55, 0x72,
-	0x30, 0x4a, 0xe7, 0x30, 0xf4, 0x1e, 0x3a, 0x01, 0x49, 0x83, 0x9a, 0xd2, 0x9d, 0x5c, 0xe9, 0xf1,
-	0x44, 0xe9, 0x98, 0xa4, 0xc1, 0x44, 0xc4, 0x08, 0xea, 0x25, 0x5a, 0x83, 0x56, 0xa5, 0xda, 0xd5,
-	0xd7, 0xb5, 0xad, 0x36, 0x9e, 0x00, 0xbd, 0xef, 0x1a, 0x3c, 0x18, 0xfb, 0xb6, 0x63, 0x25, 0x47,
-	0x17, 0x3c, 0xa2, 0xa9, 0x22, 0x51, 0x82, 0x9e, 0xc3, 0x8a, 0x2a, 0x0b, 0x2f, 0x26, 0xb1, 0x48,
-	0xf3, 0x0e, 0x74, 0xdc, 0xa9, 0xe0, 0x41, 0x86, 0xa2, 0x87, 0xd0, 0x08, 0x05, 0xf3, 0xb8, 0x9f,
-	0xfb, 0xd2, 0xf1, 0x52, 0x28, 0xd8, 0x89, 0x8f, 0xf6, 0x67, 0x8f, 0x5d, 0xee, 0x3f, 0x99, 0x38,
-	0x9e, 0x99, 0x59, 0xdd, 0xd1, 0x2f, 0x0d, 0x8c, 0x31, 0x7a, 0x2a, 0x18, 0x16, 0x42, 0xdd, 0xde,
-	0xca, 0x2a, 0xb4, 0xa4, 0x10, 0xca, 0xcb, 0x06, 0x90, 0xbb, 0x69, 0xe3, 0x66, 0x06, 0x64, 0xf3,
-	0xc9, 0x36, 0x95, 0xa4, 0xd4, 0x4b, 0xf9, 0xcd, 0xd8, 0x90, 0x8e, 0x9b, 0x19, 0xe0, 0xf2, 0x1b,
-	0x3a, 0xed, 0x76, 0xf1, 0xf6, 0x6e, 0x6b, 0xdd, 0x2f, 0xd5, 0xbb, 0xdf, 0x00, 0x23, 0x3f, 0x4c,
-	0xd2, 0x6f, 0x3c, 0xe5, 0x22, 0xee, 0x36, 0xf2, 0xdd, 0x76, 0x06, 0xe2, 0x02, 0xeb, 0xfd, 0xd0,
-	0xa0, 0xe3, 0x90, 0x24, 0xa1, 0xd2, 0xa1, 0x8a, 0xf8, 0x44, 0x11, 0xd4, 0x03, 0x23, 0x15, 0x43,
-	0x79, 0x45, 0xbd, 0x42, 0x55, 0xcb, 0xbb, 0x58, 0x1e, 0x83, 0xa7, 0xb9, 0xf6, 0x3b, 0x58, 0x0d,
-	0x38, 0x0b, 0x68, 0xaa, 0xbc, 0xaf, 0xc3, 0x30, 0x1c, 0x79, 0x57, 0x22, 0x4a, 0x42, 0xaa, 0xa8,
-	0xef, 0xa5, 0xf4, 0xba, 0x48, 0xa1, 0x5b, 0x50, 0x8e, 0x32, 0xc6, 0x41, 0x49, 0x70, 0xe9, 0x35,
-	0xb2, 0xe1, 0x69, 0xf9, 0x79, 0x42, 0xa4, 0xe2, 0x64, 0x5e, 0x62, 0x3c, 0x9d, 0xb5, 0x82, 0x76,
-	0x5e, 0xb2, 0xea, 0x32, 0xbd, 0xdf, 0x55, 0x4c, 0x0e, 0x49, 0xfe, 0x63, 0x4c, 0xaf, 0xa0, 0x19,
-	0x15, 0xd3, 0x28, 0x7e, 0x9b, 0xee, 0x24, 0x88, 0xe9, 0x69, 0xe1, 0x8a, 0xf9, 0x4f, 0xf9, 0x45,
-	0x24, 0xa9, 0xe5, 0x17, 0x91, 0xe4, 0xc4, 0x47, 0xcf, 0xa0, 0x9d, 0xc1, 0x33, 0xf1, 0x2d, 0x47,
-	0x24, 0x29, 0xd3, 0xdb, 0xde, 0x85, 0x47, 0x17, 0x92, 0xd2, 0xcc, 0x34, 0x95, 0xe7, 0x92, 0xf2,
-	0x88, 0x30, 0x7a, 0x31, 0x4a, 0x32, 0xcd, 0x7b, 0xf8, 0xe8, 0xc0, 0xdb, 0x7b, 0xb3, 0xd7, 0xf7,
-	0xce, 0xb1, 0x7d, 0xe2, 0x58, 0x1f, 0x6d, 0x73, 0x61, 0x7b, 0x1f, 0xd0, 0xfc, 0x95, 0x47, 0x06,
-	0xb4, 0xac, 0xc1, 0xd9, 0xe0, 0xb3, 0x73, 0xf6, 0xc9, 0x35, 0x17, 0xd0, 0x5d, 0xd0, 0xb1, 0x6b,
-	0x99, 0x1a, 0x6a, 0xc1, 0x92, 0x7d, 0x70, 0xe8, 0x5a, 0xa6, 0xbe, 0xbd, 0x09, 0xc6, 0xd4, 0x0d,
-	0x47, 0x4d, 0x58, 0x1c, 0x9c, 0x0d, 0x6c, 0x73, 0x01, 0x01, 0x34, 0xdc, 0x63, 0xab, 0xff, 0x7a,
-	0xcf, 0x5c, 0xfc, 0xb0, 0xf9, 0x65, 0xe3, 0xef, 0x4f, 0xd8, 0xdb, 0x72, 0x71, 0xd9, 0xc8, 0xdf,
-	0xb0, 0x97, 0x7f, 0x02, 0x00, 0x00, 0xff, 0xff, 0x77, 0xe6, 0x6f, 0xf0, 0xf0, 0x04, 0x00, 0x00,
+	// 613 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x54, 0xdf, 0x6e, 0xd3, 0x3e,
+	0x18, 0x5d, 0x7e, 0xdd, 0xba, 0xf6, 0xeb, 0x9f, 0xe5, 0x67, 0xfe, 0x15, 0x6d, 0x12, 0xa3, 0x13,
+	0x62, 0xec, 0x62, 0x13, 0x65, 0x1b, 0x9a, 0x10, 0x48, 0xa5, 0xcd, 0x58, 0xa5, 0x35, 0x9b, 0x9c,
+	0x72, 0x01, 0x37, 0x91, 0xb7, 0x1a, 0xc7, 0x52, 0x12, 0x67, 0x8e, 0x8b, 0xd4, 0xbd, 0x04, 0xef,
+	0xc3, 0x05, 0xaf, 0xc3, 0x5b, 0x20, 0xe4, 0x34, 0x49, 0xb3, 0x55, 0x48, 0x93, 0xe0, 0xce, 0xdf,
+	0xf1, 0xc9, 0xf1, 0xf9, 0xbe, 0x13, 0x1b, 0x5e, 0x30, 0xae, 0xbc, 0xc9, 0xc5, 0xee, 0xa5, 0x08,
+	0xf6, 0x98, 0x10, 0xcc, 0xa7, 0x7b, 0x4a, 0x72, 0xdf, 0xe7, 0x24, 0xcc, 0x17, 0xbb, 0x91, 0x14,
+	0x4a, 0xa0, 0x4a, 0x56, 0xb7, 0x7f, 0x18, 0xb0, 0xd6, 0xe7, 0x8c, 0x2b, 0xe2, 0xfb, 0x53, 0x87,
+	0xb3, 0x90, 0x8e, 0xd1, 0x10, 0xee, 0xc5, 0x9c, 0x85, 0x44, 0x4d, 0x24, 0x75, 0x89, 0xcf, 0x84,
+	0xe4, 0xca, 0x0b, 0x5a, 0xc6, 0xa6, 0xb1, 0xdd, 0xec, 0x6c, 0xec, 0xe6, 0x5a, 0x4e, 0x46, 0xea,
+	0x66, 0x1c, 0x8c, 0xe2, 0x05, 0x0c, 0xbd, 0x83, 0xa6, 0x47, 0x62, 0xaf, 0xa0, 0xf4, 0x5f, 0xa2,
+	0xf4, 0x68, 0xae, 0x74, 0x42, 0x62, 0x6f, 0x2e, 0xd2, 0xf0, 0x8a, 0x25, 0xda, 0x80, 0x6a, 0xae,
+	0xda, 0x2a, 0x6d, 0x1a, 0xdb, 0x75, 0x3c, 0x07, 0xda, 0xdf, 0x0c, 0xb8, 0x3f, 0xf3, 0x6d, 0x85,
+	0x4a, 0x4e, 0x47, 0x3c, 0xa0, 0xb1, 0x22, 0x41, 0x84, 0x9e, 0xc3, 0x9a, 0xca, 0x0a, 0x37, 0x24,
+	0xa1, 0x88, 0x93, 0x0e, 0x4a, 0xb8, 0x99, 0xc3, 0xb6, 0x46, 0xd1, 0x03, 0x28, 0xfb, 0x82, 0xb9,
+	0x7c, 0x9c, 0xf8, 0x2a, 0xe1, 0x15, 0x5f, 0xb0, 0xc1, 0x18, 0xbd, 0xbe, 0x7d, 0x6c, 0xad, 0xf3,
+	0x78, 0xee, 0xf8, 0xd6, 0xcc, 0x8a, 0x8e, 0x7e, 0x1a, 0xd0, 0x98, 0xa1, 0xa7, 0x82, 0x61, 0x21,
+	0xd4, 0xdd, 0xad, 0xac, 0x43, 0x55, 0x0a, 0xa1, 0x5c, 0x3d, 0x80, 0xc4, 0x4d, 0x1d, 0x57, 0x34,
+	0xa0, 0xe7, 0xa3, 0x37, 0x95, 0xa4, 0xd4, 0x8d, 0xf9, 0xf5, 0xcc, 0x50, 0x09, 0x57, 0x34, 0xe0,
+	0xf0, 0x6b, 0x7a, 0xd3, 0xed, 0xf2, 0xdd, 0xdd, 0x16, 0xba, 0x5f, 0x29, 0x76, 0xbf, 0x05, 0x8d,
+	0xe4, 0x30, 0x49, 0xbf, 0xf2, 0x98, 0x8b, 0xb0, 0x55, 0x4e, 0x76, 0xeb, 0x1a, 0xc4, 0x29, 0xd6,
+	0xfe, 0x6e, 0x40, 0x73, 0x48, 0xa2, 0x88, 0xca, 0x21, 0x55, 0x64, 0x4c, 0x14, 0x41, 0x6d, 0x68,
+	0xc4, 0x62, 0x22, 0x2f, 0xa9, 0x9b, 0xaa, 0x1a, 0x49, 0x17, 0xb5, 0x19, 0x78, 0x9a, 0x68, 0xbf,
+	0x85, 0x75, 0x8f, 0x33, 0x8f, 0xc6, 0xca, 0xfd, 0x32, 0xf1, 0xfd, 0xa9, 0x7b, 0x29, 0x82, 0xc8,
+	0xa7, 0x8a, 0x8e, 0xdd, 0x98, 0x5e, 0xa5, 0x29, 0xb4, 0x52, 0xca, 0xb1, 0x66, 0xf4, 0x32, 0x82,
+	0x43, 0xaf, 0x90, 0x05, 0x4f, 0xb2, 0xcf, 0x23, 0x22, 0x15, 0x27, 0x8b, 0x12, 0xb3, 0xe9, 0x6c,
+	0xa4, 0xb4, 0xf3, 0x8c, 0x55, 0x94, 0x69, 0xff, 0xca, 0x63, 0x1a, 0x92, 0xe8, 0x1f, 0xc6, 0xb4,
+	0x0f, 0x95, 0x20, 0x9d, 0x46, 0xfa, 0xdb, 0xb4, 0xe6, 0x41, 0xdc, 0x9c, 0x16, 0xce, 0x99, 0x7f,
+	0x95, 0x5f, 0x40, 0xa2, 0x42, 0x7e, 0x01, 0x89, 0x06, 0x63, 0xf4, 0x14, 0xea, 0x1a, 0xbe, 0x15,
+	0x5f, 0x2d, 0x20, 0x51, 0x96, 0xde, 0xce, 0x1e, 0x3c, 0x1c, 0x49, 0x4a, 0xb5, 0x69, 0x2a, 0xcf,
+	0x25, 0xe5, 0x01, 0x61, 0x74, 0x34, 0x8d, 0xb4, 0xe6, 0xff, 0xf8, 0xb8, 0xe7, 0x1e, 0x1e, 0x1d,
+	0x76, 0xdc, 0x73, 0x6c, 0x0d, 0x86, 0xdd, 0x0f, 0x96, 0xb9, 0xb4, 0xd3, 0x07, 0xb4, 0x78, 0xe5,
+	0x51, 0x03, 0xaa, 0x5d, 0xfb, 0xcc, 0xfe, 0x34, 0x3c, 0xfb, 0xe8, 0x98, 0x4b, 0x68, 0x15, 0x4a,
+	0xd8, 0xe9, 0x9a, 0x06, 0xaa, 0xc2, 0x8a, 0xd5, 0xeb, 0x3b, 0x5d, 0xb3, 0x84, 0x6a, 0xb0, 0x6a,
+	0xf5, 0x3b, 0x07, 0x07, 0x2f, 0x8f, 0xcc, 0xd5, 0x9d, 0x7d, 0x68, 0xdc, 0xb8, 0xee, 0xa8, 0x02,
+	0xcb, 0xf6, 0x99, 0x6d, 0x99, 0x4b, 0x08, 0xa0, 0xec, 0x9c, 0x74, 0x3b, 0x07, 0x87, 0xe6, 0xb2,
+	0x96, 0x1d, 0xd8, 0x23, 0x3c, 0xb0, 0x9d, 0x41, 0xcf, 0xac, 0xbc, 0x7f, 0xf6, 0x79, 0xeb, 0xcf,
+	0xcf, 0xdb, 0x9b, 0x6c, 0x71, 0x51, 0x4e, 0xde, 0xb7, 0x57, 0xbf, 0x07, 0x00, 0x4f, 0xc8, 0x3f,
+	0xf7, 0x0c, 0x05, 0x00, 0x00,
 }
@@ -16,6 +16,7 @@ It has these top-level messages:
 	Proof
 	QueueLeavesRequest
 	QueueLeavesResponse
+	QueuedLogLeaf
 	GetInclusionProofRequest
 	GetInclusionProofResponse
 	GetInclusionProofByHashRequest
@@ -30,6 +31,10 @@ It has these top-level messages:
 	GetSequencedLeafCountResponse
 	GetLatestSignedLogRootRequest
 	GetLatestSignedLogRootResponse
+	GetTreeHeadByTimestampRequest
+	GetTreeHeadByTimestampResponse
+	GetTreeHeadBySizeRequest
+	GetTreeHeadBySizeResponse
 	GetEntryAndProofRequest
 	GetEntryAndProofResponse
 	MapLeaf
@@ -41,6 +46,11 @@ It has these top-level messages:
 	SetMapLeavesResponse
 	GetSignedMapRootRequest
 	GetSignedMapRootResponse
+	TreeACLEntry
+	GetTreeACLRequest
+	GetTreeACLResponse
+	SetTreeACLRequest
+	SetTreeACLResponse
 	DigitallySigned
 	SignedEntryTimestamp
 	SignedLogRoot
@@ -91,6 +101,42 @@ func (x TrillianApiStatusCode) String() string {
 }
 func (TrillianApiStatusCode) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
 
+// ProofFormat selects an encoding of a proof's hashes that's returned in
+// Proof.encoded_path, for clients written against other transparency stacks. The
+// hashes are in the same order as proof_node, which is always returned too.
+type ProofFormat int32
+
+const (
+	// PROOF_NODES returns only the proof nodes.
+	ProofFormat_PROOF_NODES ProofFormat = 0
+	// HASH_LIST is the hashes concatenated.
+	ProofFormat_HASH_LIST ProofFormat = 1
+	// RFC6962 is a JSON array of base64 encoded hashes, as in the audit_path and
+	// consistency fields of RFC 6962 section 4.
+	ProofFormat_RFC6962 ProofFormat = 2
+	// RFC9162 is a TLS encoded vector of NodeHash, as in the inclusion_path and
+	// consistency_path fields of RFC 9162 section 4.
+	ProofFormat_RFC9162 ProofFormat = 3
+)
+
+var ProofFormat_name = map[int32]string{
+	0: "PROOF_NODES",
+	1: "HASH_LIST",
+	2: "RFC6962",
+	3: "RFC9162",
+}
+var ProofFormat_value = map[string]int32{
+	"PROOF_NODES": 0,
+	"HASH_LIST":   1,
+	"RFC6962":     2,
+	"RFC9162":     3,
+}
+
+func (x ProofFormat) String() string {
+	return proto.EnumName(ProofFormat_name, int32(x))
+}
+func (ProofFormat) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
 // All operations return a TrillianApiStatus.
 // TODO(Martin2112): Most of the operations are not fully defined yet. They will be implemented soon
 type TrillianApiStatus struct {
@@ -126,6 +172,20 @@ type LogLeaf struct {
 	ExtraData      []byte `protobuf:"bytes,3,opt,name=extra_data,json=extraData,proto3" json:"extra_data,omitempty"`
 	LeafIndex      int64  `protobuf:"varint,4,opt,name=leaf_index,json=leafIndex" json:"leaf_index,omitempty"`
 	LeafValueHash  []byte `protobuf:"bytes,5,opt,name=leaf_value_hash,json=leafValueHash,proto3" json:"leaf_value_hash,omitempty"`
+	// The time, in nanoseconds since the epoch, by which the leaf should be integrated
+	// into the tree, e.g. an SCT timestamp plus the log's maximum merge delay. When there
+	// is a backlog the leaves with the earliest deadlines are sequenced first. Zero means
+	// no deadline, and the leaf is treated as due when it was queued.
+	MergeDeadlineNanos int64 `protobuf:"varint,6,opt,name=merge_deadline_nanos,json=mergeDeadlineNanos" json:"merge_deadline_nanos,omitempty"`
+	// Leaves with the same identity hash are the same entry, even if their values differ, e.g.
+	// two submissions of a certificate whose leaves have different timestamps. If it's set and
+	// a leaf with the same identity hash has already been queued to the log the leaf isn't
+	// queued again, and the existing leaf is returned instead.
+	LeafIdentityHash []byte `protobuf:"bytes,7,opt,name=leaf_identity_hash,json=leafIdentityHash,proto3" json:"leaf_identity_hash,omitempty"`
+	// The request ID the leaf was queued under, which ties it to the logs of the
+	// personality that queued it. It's set by the log server and stored with the queued
+	// leaf, so a submission that's stuck in the queue can be found after a restart.
+	CorrelationId string `protobuf:"bytes,8,opt,name=correlation_id,json=correlationId" json:"correlation_id,omitempty"`
 }
 
 func (m *LogLeaf) Reset()                    { *m = LogLeaf{} }
@@ -168,6 +228,27 @@ func (m *LogLeaf) GetLeafValueHash() []byte {
 	return nil
 }
 
+func (m *LogLeaf) GetMergeDeadlineNanos() int64 {
+	if m != nil {
+		return m.MergeDeadlineNanos
+	}
+	return 0
+}
+
+func (m *LogLeaf) GetLeafIdentityHash() []byte {
+	if m != nil {
+		return m.LeafIdentityHash
+	}
+	return nil
+}
+
+func (m *LogLeaf) GetCorrelationId() string {
+	if m != nil {
+		return m.CorrelationId
+	}
+	return ""
+}
+
 type Node struct {
 	NodeId       []byte `protobuf:"bytes,1,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`
 	NodeHash     []byte `protobuf:"bytes,2,opt,name=node_hash,json=nodeHash,proto3" json:"node_hash,omitempty"`
@@ -203,6 +284,8 @@ func (m *Node) GetNodeRevision() int64 {
 type Proof struct {
 	LeafIndex int64   `protobuf:"varint,1,opt,name=leaf_index,json=leafIndex" json:"leaf_index,omitempty"`
 	ProofNode []*Node `protobuf:"bytes,2,rep,name=proof_node,json=proofNode" json:"proof_node,omitempty"`
+	// The proof's hashes in the format requested, if it wasn't PROOF_NODES.
+	EncodedPath []byte `protobuf:"bytes,3,opt,name=encoded_path,json=encodedPath,proto3" json:"encoded_path,omitempty"`
 }
 
 func (m *Proof) Reset()                    { *m = Proof{} }
@@ -224,6 +307,13 @@ func (m *Proof) GetProofNode() []*Node {
 	return nil
 }
 
+func (m *Proof) GetEncodedPath() []byte {
+	if m != nil {
+		return m.EncodedPath
+	}
+	return nil
+}
+
 type QueueLeavesRequest struct {
 	LogId  int64      `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
 	Leaves []*LogLeaf `protobuf:"bytes,2,rep,name=leaves" json:"leaves,omitempty"`
@@ -248,10 +338,10 @@ func (m *QueueLeavesRequest) GetLeaves() []*LogLeaf {
 	return nil
 }
 
-// TODO(Martin2112): This will eventually contain the signed timestamps and stuff that we return for
-// the queued leaves
 type QueueLeavesResponse struct {
 	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	// The results for the queued leaves, in the same order as the request.
+	QueuedLeaves []*QueuedLogLeaf `protobuf:"bytes,2,rep,name=queued_leaves,json=queuedLeaves" json:"queued_leaves,omitempty"`
 }
 
 func (m *QueueLeavesResponse) Reset()                    { *m = QueueLeavesResponse{} }
@@ -266,16 +356,51 @@ func (m *QueueLeavesResponse) GetStatus() *TrillianApiStatus {
 	return nil
 }
 
+func (m *QueueLeavesResponse) GetQueuedLeaves() []*QueuedLogLeaf {
+	if m != nil {
+		return m.QueuedLeaves
+	}
+	return nil
+}
+
+type QueuedLogLeaf struct {
+	// The leaf that's in the log: the one that was queued or, if it duplicates an existing
+	// leaf, the existing one.
+	Leaf *LogLeaf `protobuf:"bytes,1,opt,name=leaf" json:"leaf,omitempty"`
+	// Set if the leaf wasn't queued because it has the same identity hash as an existing leaf.
+	Duplicate bool `protobuf:"varint,2,opt,name=duplicate" json:"duplicate,omitempty"`
+}
+
+func (m *QueuedLogLeaf) Reset()                    { *m = QueuedLogLeaf{} }
+func (m *QueuedLogLeaf) String() string            { return proto.CompactTextString(m) }
+func (*QueuedLogLeaf) ProtoMessage()               {}
+func (*QueuedLogLeaf) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *QueuedLogLeaf) GetLeaf() *LogLeaf {
+	if m != nil {
+		return m.Leaf
+	}
+	return nil
+}
+
+func (m *QueuedLogLeaf) GetDuplicate() bool {
+	if m != nil {
+		return m.Duplicate
+	}
+	return false
+}
+
 type GetInclusionProofRequest struct {
-	LogId     int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
-	LeafIndex int64 `protobuf:"varint,2,opt,name=leaf_index,json=leafIndex" json:"leaf_index,omitempty"`
-	TreeSize  int64 `protobuf:"varint,3,opt,name=tree_size,json=treeSize" json:"tree_size,omitempty"`
+	LogId       int64       `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+	LeafIndex   int64       `protobuf:"varint,2,opt,name=leaf_index,json=leafIndex" json:"leaf_index,omitempty"`
+	TreeSize    int64       `protobuf:"varint,3,opt,name=tree_size,json=treeSize" json:"tree_size,omitempty"`
+	ProofFormat ProofFormat `protobuf:"varint,4,opt,name=proof_format,json=proofFormat,enum=trillian.ProofFormat" json:"proof_format,omitempty"`
 }
 
 func (m *GetInclusionProofRequest) Reset()                    { *m = GetInclusionProofRequest{} }
 func (m *GetInclusionProofRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetInclusionProofRequest) ProtoMessage()               {}
-func (*GetInclusionProofRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+func (*GetInclusionProofRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
 
 func (m *GetInclusionProofRequest) GetLogId() int64 {
 	if m != nil {
@@ -298,6 +423,13 @@ func (m *GetInclusionProofRequest) GetTreeSize() int64 {
 	return 0
 }
 
+func (m *GetInclusionProofRequest) GetProofFormat() ProofFormat {
+	if m != nil {
+		return m.ProofFormat
+	}
+	return ProofFormat_PROOF_NODES
+}
+
 type GetInclusionProofResponse struct {
 	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
 	Proof  *Proof             `protobuf:"bytes,2,opt,name=proof" json:"proof,omitempty"`
@@ -306,7 +438,7 @@ type GetInclusionProofResponse struct {
 func (m *GetInclusionProofResponse) Reset()                    { *m = GetInclusionProofResponse{} }
 func (m *GetInclusionProofResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetInclusionProofResponse) ProtoMessage()               {}
-func (*GetInclusionProofResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+func (*GetInclusionProofResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
 
 func (m *GetInclusionProofResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -323,16 +455,17 @@ func (m *GetInclusionProofResponse) GetProof() *Proof {
 }
 
 type GetInclusionProofByHashRequest struct {
-	LogId           int64  `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
-	LeafHash        []byte `protobuf:"bytes,2,opt,name=leaf_hash,json=leafHash,proto3" json:"leaf_hash,omitempty"`
-	TreeSize        int64  `protobuf:"varint,3,opt,name=tree_size,json=treeSize" json:"tree_size,omitempty"`
-	OrderBySequence bool   `protobuf:"varint,4,opt,name=order_by_sequence,json=orderBySequence" json:"order_by_sequence,omitempty"`
+	LogId           int64       `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+	LeafHash        []byte      `protobuf:"bytes,2,opt,name=leaf_hash,json=leafHash,proto3" json:"leaf_hash,omitempty"`
+	TreeSize        int64       `protobuf:"varint,3,opt,name=tree_size,json=treeSize" json:"tree_size,omitempty"`
+	OrderBySequence bool        `protobuf:"varint,4,opt,name=order_by_sequence,json=orderBySequence" json:"order_by_sequence,omitempty"`
+	ProofFormat     ProofFormat `protobuf:"varint,5,opt,name=proof_format,json=proofFormat,enum=trillian.ProofFormat" json:"proof_format,omitempty"`
 }
 
 func (m *GetInclusionProofByHashRequest) Reset()                    { *m = GetInclusionProofByHashRequest{} }
 func (m *GetInclusionProofByHashRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetInclusionProofByHashRequest) ProtoMessage()               {}
-func (*GetInclusionProofByHashRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+func (*GetInclusionProofByHashRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
 
 func (m *GetInclusionProofByHashRequest) GetLogId() int64 {
 	if m != nil {
@@ -362,6 +495,13 @@ func (m *GetInclusionProofByHashRequest) GetOrderBySequence() bool {
 	return false
 }
 
+func (m *GetInclusionProofByHashRequest) GetProofFormat() ProofFormat {
+	if m != nil {
+		return m.ProofFormat
+	}
+	return ProofFormat_PROOF_NODES
+}
+
 type GetInclusionProofByHashResponse struct {
 	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
 	// Logs can potentially contain leaves with duplicate hashes so it's possible
@@ -369,10 +509,12 @@ type GetInclusionProofByHashResponse struct {
 	Proof []*Proof `protobuf:"bytes,2,rep,name=proof" json:"proof,omitempty"`
 }
 
-func (m *GetInclusionProofByHashResponse) Reset()                    { *m = GetInclusionProofByHashResponse{} }
-func (m *GetInclusionProofByHashResponse) String() string            { return proto.CompactTextString(m) }
-func (*GetInclusionProofByHashResponse) ProtoMessage()               {}
-func (*GetInclusionProofByHashResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+func (m *GetInclusionProofByHashResponse) Reset()         { *m = GetInclusionProofByHashResponse{} }
+func (m *GetInclusionProofByHashResponse) String() string { return proto.CompactTextString(m) }
+func (*GetInclusionProofByHashResponse) ProtoMessage()    {}
+func (*GetInclusionProofByHashResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor0, []int{10}
+}
 
 func (m *GetInclusionProofByHashResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -389,15 +531,16 @@ func (m *GetInclusionProofByHashResponse) GetProof() []*Proof {
 }
 
 type GetConsistencyProofRequest struct {
-	LogId          int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
-	FirstTreeSize  int64 `protobuf:"varint,2,opt,name=first_tree_size,json=firstTreeSize" json:"first_tree_size,omitempty"`
-	SecondTreeSize int64 `protobuf:"varint,3,opt,name=second_tree_size,json=secondTreeSize" json:"second_tree_size,omitempty"`
+	LogId          int64       `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+	FirstTreeSize  int64       `protobuf:"varint,2,opt,name=first_tree_size,json=firstTreeSize" json:"first_tree_size,omitempty"`
+	SecondTreeSize int64       `protobuf:"varint,3,opt,name=second_tree_size,json=secondTreeSize" json:"second_tree_size,omitempty"`
+	ProofFormat    ProofFormat `protobuf:"varint,4,opt,name=proof_format,json=proofFormat,enum=trillian.ProofFormat" json:"proof_format,omitempty"`
 }
 
 func (m *GetConsistencyProofRequest) Reset()                    { *m = GetConsistencyProofRequest{} }
 func (m *GetConsistencyProofRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetConsistencyProofRequest) ProtoMessage()               {}
-func (*GetConsistencyProofRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+func (*GetConsistencyProofRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
 
 func (m *GetConsistencyProofRequest) GetLogId() int64 {
 	if m != nil {
@@ -420,6 +563,13 @@ func (m *GetConsistencyProofRequest) GetSecondTreeSize() int64 {
 	return 0
 }
 
+func (m *GetConsistencyProofRequest) GetProofFormat() ProofFormat {
+	if m != nil {
+		return m.ProofFormat
+	}
+	return ProofFormat_PROOF_NODES
+}
+
 type GetConsistencyProofResponse struct {
 	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
 	Proof  *Proof             `protobuf:"bytes,2,opt,name=proof" json:"proof,omitempty"`
@@ -428,7 +578,7 @@ type GetConsistencyProofResponse struct {
 func (m *GetConsistencyProofResponse) Reset()                    { *m = GetConsistencyProofResponse{} }
 func (m *GetConsistencyProofResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetConsistencyProofResponse) ProtoMessage()               {}
-func (*GetConsistencyProofResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+func (*GetConsistencyProofResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
 
 func (m *GetConsistencyProofResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -453,7 +603,7 @@ type GetLeavesByHashRequest struct {
 func (m *GetLeavesByHashRequest) Reset()                    { *m = GetLeavesByHashRequest{} }
 func (m *GetLeavesByHashRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetLeavesByHashRequest) ProtoMessage()               {}
-func (*GetLeavesByHashRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+func (*GetLeavesByHashRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
 
 func (m *GetLeavesByHashRequest) GetLogId() int64 {
 	if m != nil {
@@ -484,7 +634,7 @@ type GetLeavesByHashResponse struct {
 func (m *GetLeavesByHashResponse) Reset()                    { *m = GetLeavesByHashResponse{} }
 func (m *GetLeavesByHashResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetLeavesByHashResponse) ProtoMessage()               {}
-func (*GetLeavesByHashResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+func (*GetLeavesByHashResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
 
 func (m *GetLeavesByHashResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -508,7 +658,7 @@ type GetLeavesByIndexRequest struct {
 func (m *GetLeavesByIndexRequest) Reset()                    { *m = GetLeavesByIndexRequest{} }
 func (m *GetLeavesByIndexRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetLeavesByIndexRequest) ProtoMessage()               {}
-func (*GetLeavesByIndexRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+func (*GetLeavesByIndexRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
 
 func (m *GetLeavesByIndexRequest) GetLogId() int64 {
 	if m != nil {
@@ -532,7 +682,7 @@ type GetLeavesByIndexResponse struct {
 func (m *GetLeavesByIndexResponse) Reset()                    { *m = GetLeavesByIndexResponse{} }
 func (m *GetLeavesByIndexResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetLeavesByIndexResponse) ProtoMessage()               {}
-func (*GetLeavesByIndexResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+func (*GetLeavesByIndexResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
 
 func (m *GetLeavesByIndexResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -555,7 +705,7 @@ type GetSequencedLeafCountRequest struct {
 func (m *GetSequencedLeafCountRequest) Reset()                    { *m = GetSequencedLeafCountRequest{} }
 func (m *GetSequencedLeafCountRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetSequencedLeafCountRequest) ProtoMessage()               {}
-func (*GetSequencedLeafCountRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+func (*GetSequencedLeafCountRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
 
 func (m *GetSequencedLeafCountRequest) GetLogId() int64 {
 	if m != nil {
@@ -572,7 +722,7 @@ type GetSequencedLeafCountResponse struct {
 func (m *GetSequencedLeafCountResponse) Reset()                    { *m = GetSequencedLeafCountResponse{} }
 func (m *GetSequencedLeafCountResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetSequencedLeafCountResponse) ProtoMessage()               {}
-func (*GetSequencedLeafCountResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
+func (*GetSequencedLeafCountResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{18} }
 
 func (m *GetSequencedLeafCountResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -595,7 +745,7 @@ type GetLatestSignedLogRootRequest struct {
 func (m *GetLatestSignedLogRootRequest) Reset()                    { *m = GetLatestSignedLogRootRequest{} }
 func (m *GetLatestSignedLogRootRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetLatestSignedLogRootRequest) ProtoMessage()               {}
-func (*GetLatestSignedLogRootRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{18} }
+func (*GetLatestSignedLogRootRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{19} }
 
 func (m *GetLatestSignedLogRootRequest) GetLogId() int64 {
 	if m != nil {
@@ -609,10 +759,12 @@ type GetLatestSignedLogRootResponse struct {
 	SignedLogRoot *SignedLogRoot     `protobuf:"bytes,2,opt,name=signed_log_root,json=signedLogRoot" json:"signed_log_root,omitempty"`
 }
 
-func (m *GetLatestSignedLogRootResponse) Reset()                    { *m = GetLatestSignedLogRootResponse{} }
-func (m *GetLatestSignedLogRootResponse) String() string            { return proto.CompactTextString(m) }
-func (*GetLatestSignedLogRootResponse) ProtoMessage()               {}
-func (*GetLatestSignedLogRootResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{19} }
+func (m *GetLatestSignedLogRootResponse) Reset()         { *m = GetLatestSignedLogRootResponse{} }
+func (m *GetLatestSignedLogRootResponse) String() string { return proto.CompactTextString(m) }
+func (*GetLatestSignedLogRootResponse) ProtoMessage()    {}
+func (*GetLatestSignedLogRootResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor0, []int{20}
+}
 
 func (m *GetLatestSignedLogRootResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -628,16 +780,119 @@ func (m *GetLatestSignedLogRootResponse) GetSignedLogRoot() *SignedLogRoot {
 	return nil
 }
 
+// GetTreeHeadByTimestampRequest asks for the earliest signed root of a log whose timestamp
+// is at or after timestamp_nanos.
+type GetTreeHeadByTimestampRequest struct {
+	LogId          int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+	TimestampNanos int64 `protobuf:"varint,2,opt,name=timestamp_nanos,json=timestampNanos" json:"timestamp_nanos,omitempty"`
+}
+
+func (m *GetTreeHeadByTimestampRequest) Reset()                    { *m = GetTreeHeadByTimestampRequest{} }
+func (m *GetTreeHeadByTimestampRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetTreeHeadByTimestampRequest) ProtoMessage()               {}
+func (*GetTreeHeadByTimestampRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{21} }
+
+func (m *GetTreeHeadByTimestampRequest) GetLogId() int64 {
+	if m != nil {
+		return m.LogId
+	}
+	return 0
+}
+
+func (m *GetTreeHeadByTimestampRequest) GetTimestampNanos() int64 {
+	if m != nil {
+		return m.TimestampNanos
+	}
+	return 0
+}
+
+type GetTreeHeadByTimestampResponse struct {
+	Status        *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	SignedLogRoot *SignedLogRoot     `protobuf:"bytes,2,opt,name=signed_log_root,json=signedLogRoot" json:"signed_log_root,omitempty"`
+}
+
+func (m *GetTreeHeadByTimestampResponse) Reset()         { *m = GetTreeHeadByTimestampResponse{} }
+func (m *GetTreeHeadByTimestampResponse) String() string { return proto.CompactTextString(m) }
+func (*GetTreeHeadByTimestampResponse) ProtoMessage()    {}
+func (*GetTreeHeadByTimestampResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor0, []int{22}
+}
+
+func (m *GetTreeHeadByTimestampResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *GetTreeHeadByTimestampResponse) GetSignedLogRoot() *SignedLogRoot {
+	if m != nil {
+		return m.SignedLogRoot
+	}
+	return nil
+}
+
+// GetTreeHeadBySizeRequest asks for the earliest signed root of a log for a tree of
+// tree_size leaves.
+type GetTreeHeadBySizeRequest struct {
+	LogId    int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+	TreeSize int64 `protobuf:"varint,2,opt,name=tree_size,json=treeSize" json:"tree_size,omitempty"`
+}
+
+func (m *GetTreeHeadBySizeRequest) Reset()                    { *m = GetTreeHeadBySizeRequest{} }
+func (m *GetTreeHeadBySizeRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetTreeHeadBySizeRequest) ProtoMessage()               {}
+func (*GetTreeHeadBySizeRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{23} }
+
+func (m *GetTreeHeadBySizeRequest) GetLogId() int64 {
+	if m != nil {
+		return m.LogId
+	}
+	return 0
+}
+
+func (m *GetTreeHeadBySizeRequest) GetTreeSize() int64 {
+	if m != nil {
+		return m.TreeSize
+	}
+	return 0
+}
+
+type GetTreeHeadBySizeResponse struct {
+	Status        *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	SignedLogRoot *SignedLogRoot     `protobuf:"bytes,2,opt,name=signed_log_root,json=signedLogRoot" json:"signed_log_root,omitempty"`
+}
+
+func (m *GetTreeHeadBySizeResponse) Reset()                    { *m = GetTreeHeadBySizeResponse{} }
+func (m *GetTreeHeadBySizeResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetTreeHeadBySizeResponse) ProtoMessage()               {}
+func (*GetTreeHeadBySizeResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{24} }
+
+func (m *GetTreeHeadBySizeResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *GetTreeHeadBySizeResponse) GetSignedLogRoot() *SignedLogRoot {
+	if m != nil {
+		return m.SignedLogRoot
+	}
+	return nil
+}
+
 type GetEntryAndProofRequest struct {
-	LogId     int64 `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
-	LeafIndex int64 `protobuf:"varint,2,opt,name=leaf_index,json=leafIndex" json:"leaf_index,omitempty"`
-	TreeSize  int64 `protobuf:"varint,3,opt,name=tree_size,json=treeSize" json:"tree_size,omitempty"`
+	LogId       int64       `protobuf:"varint,1,opt,name=log_id,json=logId" json:"log_id,omitempty"`
+	LeafIndex   int64       `protobuf:"varint,2,opt,name=leaf_index,json=leafIndex" json:"leaf_index,omitempty"`
+	TreeSize    int64       `protobuf:"varint,3,opt,name=tree_size,json=treeSize" json:"tree_size,omitempty"`
+	ProofFormat ProofFormat `protobuf:"varint,4,opt,name=proof_format,json=proofFormat,enum=trillian.ProofFormat" json:"proof_format,omitempty"`
 }
 
 func (m *GetEntryAndProofRequest) Reset()                    { *m = GetEntryAndProofRequest{} }
 func (m *GetEntryAndProofRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetEntryAndProofRequest) ProtoMessage()               {}
-func (*GetEntryAndProofRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{20} }
+func (*GetEntryAndProofRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{25} }
 
 func (m *GetEntryAndProofRequest) GetLogId() int64 {
 	if m != nil {
@@ -660,6 +915,13 @@ func (m *GetEntryAndProofRequest) GetTreeSize() int64 {
 	return 0
 }
 
+func (m *GetEntryAndProofRequest) GetProofFormat() ProofFormat {
+	if m != nil {
+		return m.ProofFormat
+	}
+	return ProofFormat_PROOF_NODES
+}
+
 type GetEntryAndProofResponse struct {
 	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
 	Proof  *Proof             `protobuf:"bytes,2,opt,name=proof" json:"proof,omitempty"`
@@ -669,7 +931,7 @@ type GetEntryAndProofResponse struct {
 func (m *GetEntryAndProofResponse) Reset()                    { *m = GetEntryAndProofResponse{} }
 func (m *GetEntryAndProofResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetEntryAndProofResponse) ProtoMessage()               {}
-func (*GetEntryAndProofResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{21} }
+func (*GetEntryAndProofResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{26} }
 
 func (m *GetEntryAndProofResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -707,7 +969,7 @@ type MapLeaf struct {
 func (m *MapLeaf) Reset()                    { *m = MapLeaf{} }
 func (m *MapLeaf) String() string            { return proto.CompactTextString(m) }
 func (*MapLeaf) ProtoMessage()               {}
-func (*MapLeaf) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{22} }
+func (*MapLeaf) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{27} }
 
 func (m *MapLeaf) GetKeyHash() []byte {
 	if m != nil {
@@ -745,7 +1007,7 @@ type KeyValue struct {
 func (m *KeyValue) Reset()                    { *m = KeyValue{} }
 func (m *KeyValue) String() string            { return proto.CompactTextString(m) }
 func (*KeyValue) ProtoMessage()               {}
-func (*KeyValue) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{23} }
+func (*KeyValue) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{28} }
 
 func (m *KeyValue) GetKey() []byte {
 	if m != nil {
@@ -769,7 +1031,7 @@ type KeyValueInclusion struct {
 func (m *KeyValueInclusion) Reset()                    { *m = KeyValueInclusion{} }
 func (m *KeyValueInclusion) String() string            { return proto.CompactTextString(m) }
 func (*KeyValueInclusion) ProtoMessage()               {}
-func (*KeyValueInclusion) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{24} }
+func (*KeyValueInclusion) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{29} }
 
 func (m *KeyValueInclusion) GetKeyValue() *KeyValue {
 	if m != nil {
@@ -794,7 +1056,7 @@ type GetMapLeavesRequest struct {
 func (m *GetMapLeavesRequest) Reset()                    { *m = GetMapLeavesRequest{} }
 func (m *GetMapLeavesRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetMapLeavesRequest) ProtoMessage()               {}
-func (*GetMapLeavesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{25} }
+func (*GetMapLeavesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{30} }
 
 func (m *GetMapLeavesRequest) GetMapId() int64 {
 	if m != nil {
@@ -826,7 +1088,7 @@ type GetMapLeavesResponse struct {
 func (m *GetMapLeavesResponse) Reset()                    { *m = GetMapLeavesResponse{} }
 func (m *GetMapLeavesResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetMapLeavesResponse) ProtoMessage()               {}
-func (*GetMapLeavesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{26} }
+func (*GetMapLeavesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{31} }
 
 func (m *GetMapLeavesResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -858,7 +1120,7 @@ type SetMapLeavesRequest struct {
 func (m *SetMapLeavesRequest) Reset()                    { *m = SetMapLeavesRequest{} }
 func (m *SetMapLeavesRequest) String() string            { return proto.CompactTextString(m) }
 func (*SetMapLeavesRequest) ProtoMessage()               {}
-func (*SetMapLeavesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{27} }
+func (*SetMapLeavesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{32} }
 
 func (m *SetMapLeavesRequest) GetMapId() int64 {
 	if m != nil {
@@ -889,7 +1151,7 @@ type SetMapLeavesResponse struct {
 func (m *SetMapLeavesResponse) Reset()                    { *m = SetMapLeavesResponse{} }
 func (m *SetMapLeavesResponse) String() string            { return proto.CompactTextString(m) }
 func (*SetMapLeavesResponse) ProtoMessage()               {}
-func (*SetMapLeavesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{28} }
+func (*SetMapLeavesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{33} }
 
 func (m *SetMapLeavesResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -912,7 +1174,7 @@ type GetSignedMapRootRequest struct {
 func (m *GetSignedMapRootRequest) Reset()                    { *m = GetSignedMapRootRequest{} }
 func (m *GetSignedMapRootRequest) String() string            { return proto.CompactTextString(m) }
 func (*GetSignedMapRootRequest) ProtoMessage()               {}
-func (*GetSignedMapRootRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{29} }
+func (*GetSignedMapRootRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{34} }
 
 func (m *GetSignedMapRootRequest) GetMapId() int64 {
 	if m != nil {
@@ -929,7 +1191,7 @@ type GetSignedMapRootResponse struct {
 func (m *GetSignedMapRootResponse) Reset()                    { *m = GetSignedMapRootResponse{} }
 func (m *GetSignedMapRootResponse) String() string            { return proto.CompactTextString(m) }
 func (*GetSignedMapRootResponse) ProtoMessage()               {}
-func (*GetSignedMapRootResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{30} }
+func (*GetSignedMapRootResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{35} }
 
 func (m *GetSignedMapRootResponse) GetStatus() *TrillianApiStatus {
 	if m != nil {
@@ -945,6 +1207,115 @@ func (m *GetSignedMapRootResponse) GetMapRoot() *SignedMapRoot {
 	return nil
 }
 
+// TreeACLEntry grants a principal a scope on a tree.
+type TreeACLEntry struct {
+	// principal is the common name of the caller's TLS client certificate, or
+	// "*" for every caller.
+	Principal string `protobuf:"bytes,1,opt,name=principal" json:"principal,omitempty"`
+	// scope is one of "tree:read", "tree:write" or "tree:admin". Each scope
+	// includes the ones before it.
+	Scope string `protobuf:"bytes,2,opt,name=scope" json:"scope,omitempty"`
+}
+
+func (m *TreeACLEntry) Reset()                    { *m = TreeACLEntry{} }
+func (m *TreeACLEntry) String() string            { return proto.CompactTextString(m) }
+func (*TreeACLEntry) ProtoMessage()               {}
+func (*TreeACLEntry) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{36} }
+
+func (m *TreeACLEntry) GetPrincipal() string {
+	if m != nil {
+		return m.Principal
+	}
+	return ""
+}
+
+func (m *TreeACLEntry) GetScope() string {
+	if m != nil {
+		return m.Scope
+	}
+	return ""
+}
+
+type GetTreeACLRequest struct {
+	TreeId int64 `protobuf:"varint,1,opt,name=tree_id,json=treeId" json:"tree_id,omitempty"`
+}
+
+func (m *GetTreeACLRequest) Reset()                    { *m = GetTreeACLRequest{} }
+func (m *GetTreeACLRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetTreeACLRequest) ProtoMessage()               {}
+func (*GetTreeACLRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{37} }
+
+func (m *GetTreeACLRequest) GetTreeId() int64 {
+	if m != nil {
+		return m.TreeId
+	}
+	return 0
+}
+
+type GetTreeACLResponse struct {
+	Status  *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	Entries []*TreeACLEntry    `protobuf:"bytes,2,rep,name=entries" json:"entries,omitempty"`
+}
+
+func (m *GetTreeACLResponse) Reset()                    { *m = GetTreeACLResponse{} }
+func (m *GetTreeACLResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetTreeACLResponse) ProtoMessage()               {}
+func (*GetTreeACLResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{38} }
+
+func (m *GetTreeACLResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *GetTreeACLResponse) GetEntries() []*TreeACLEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+type SetTreeACLRequest struct {
+	TreeId  int64           `protobuf:"varint,1,opt,name=tree_id,json=treeId" json:"tree_id,omitempty"`
+	Entries []*TreeACLEntry `protobuf:"bytes,2,rep,name=entries" json:"entries,omitempty"`
+}
+
+func (m *SetTreeACLRequest) Reset()                    { *m = SetTreeACLRequest{} }
+func (m *SetTreeACLRequest) String() string            { return proto.CompactTextString(m) }
+func (*SetTreeACLRequest) ProtoMessage()               {}
+func (*SetTreeACLRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{39} }
+
+func (m *SetTreeACLRequest) GetTreeId() int64 {
+	if m != nil {
+		return m.TreeId
+	}
+	return 0
+}
+
+func (m *SetTreeACLRequest) GetEntries() []*TreeACLEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+type SetTreeACLResponse struct {
+	Status *TrillianApiStatus `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+}
+
+func (m *SetTreeACLResponse) Reset()                    { *m = SetTreeACLResponse{} }
+func (m *SetTreeACLResponse) String() string            { return proto.CompactTextString(m) }
+func (*SetTreeACLResponse) ProtoMessage()               {}
+func (*SetTreeACLResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{40} }
+
+func (m *SetTreeACLResponse) GetStatus() *TrillianApiStatus {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*TrillianApiStatus)(nil), "trillian.TrillianApiStatus")
 	proto.RegisterType((*LogLeaf)(nil), "trillian.LogLeaf")
@@ -952,6 +1323,7 @@ func init() {
 	proto.RegisterType((*Proof)(nil), "trillian.Proof")
 	proto.RegisterType((*QueueLeavesRequest)(nil), "trillian.QueueLeavesRequest")
 	proto.RegisterType((*QueueLeavesResponse)(nil), "trillian.QueueLeavesResponse")
+	proto.RegisterType((*QueuedLogLeaf)(nil), "trillian.QueuedLogLeaf")
 	proto.RegisterType((*GetInclusionProofRequest)(nil), "trillian.GetInclusionProofRequest")
 	proto.RegisterType((*GetInclusionProofResponse)(nil), "trillian.GetInclusionProofResponse")
 	proto.RegisterType((*GetInclusionProofByHashRequest)(nil), "trillian.GetInclusionProofByHashRequest")
@@ -966,6 +1338,10 @@ func init() {
 	proto.RegisterType((*GetSequencedLeafCountResponse)(nil), "trillian.GetSequencedLeafCountResponse")
 	proto.RegisterType((*GetLatestSignedLogRootRequest)(nil), "trillian.GetLatestSignedLogRootRequest")
 	proto.RegisterType((*GetLatestSignedLogRootResponse)(nil), "trillian.GetLatestSignedLogRootResponse")
+	proto.RegisterType((*GetTreeHeadByTimestampRequest)(nil), "trillian.GetTreeHeadByTimestampRequest")
+	proto.RegisterType((*GetTreeHeadByTimestampResponse)(nil), "trillian.GetTreeHeadByTimestampResponse")
+	proto.RegisterType((*GetTreeHeadBySizeRequest)(nil), "trillian.GetTreeHeadBySizeRequest")
+	proto.RegisterType((*GetTreeHeadBySizeResponse)(nil), "trillian.GetTreeHeadBySizeResponse")
 	proto.RegisterType((*GetEntryAndProofRequest)(nil), "trillian.GetEntryAndProofRequest")
 	proto.RegisterType((*GetEntryAndProofResponse)(nil), "trillian.GetEntryAndProofResponse")
 	proto.RegisterType((*MapLeaf)(nil), "trillian.MapLeaf")
@@ -977,7 +1353,13 @@ func init() {
 	proto.RegisterType((*SetMapLeavesResponse)(nil), "trillian.SetMapLeavesResponse")
 	proto.RegisterType((*GetSignedMapRootRequest)(nil), "trillian.GetSignedMapRootRequest")
 	proto.RegisterType((*GetSignedMapRootResponse)(nil), "trillian.GetSignedMapRootResponse")
+	proto.RegisterType((*TreeACLEntry)(nil), "trillian.TreeACLEntry")
+	proto.RegisterType((*GetTreeACLRequest)(nil), "trillian.GetTreeACLRequest")
+	proto.RegisterType((*GetTreeACLResponse)(nil), "trillian.GetTreeACLResponse")
+	proto.RegisterType((*SetTreeACLRequest)(nil), "trillian.SetTreeACLRequest")
+	proto.RegisterType((*SetTreeACLResponse)(nil), "trillian.SetTreeACLResponse")
 	proto.RegisterEnum("trillian.TrillianApiStatusCode", TrillianApiStatusCode_name, TrillianApiStatusCode_value)
+	proto.RegisterEnum("trillian.ProofFormat", ProofFormat_name, ProofFormat_value)
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -999,6 +1381,8 @@ type TrillianLogClient interface {
 	GetConsistencyProof(ctx context.Context, in *GetConsistencyProofRequest, opts ...grpc.CallOption) (*GetConsistencyProofResponse, error)
 	// Corresponds to the LogRootReader API
 	GetLatestSignedLogRoot(ctx context.Context, in *GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*GetLatestSignedLogRootResponse, error)
+	GetTreeHeadByTimestamp(ctx context.Context, in *GetTreeHeadByTimestampRequest, opts ...grpc.CallOption) (*GetTreeHeadByTimestampResponse, error)
+	GetTreeHeadBySize(ctx context.Context, in *GetTreeHeadBySizeRequest, opts ...grpc.CallOption) (*GetTreeHeadBySizeResponse, error)
 	// Corresponds to the LeafReader API
 	GetSequencedLeafCount(ctx context.Context, in *GetSequencedLeafCountRequest, opts ...grpc.CallOption) (*GetSequencedLeafCountResponse, error)
 	GetLeavesByIndex(ctx context.Context, in *GetLeavesByIndexRequest, opts ...grpc.CallOption) (*GetLeavesByIndexResponse, error)
@@ -1060,6 +1444,24 @@ func (c *trillianLogClient) GetLatestSignedLogRoot(ctx context.Context, in *GetL
 	return out, nil
 }
 
+func (c *trillianLogClient) GetTreeHeadByTimestamp(ctx context.Context, in *GetTreeHeadByTimestampRequest, opts ...grpc.CallOption) (*GetTreeHeadByTimestampResponse, error) {
+	out := new(GetTreeHeadByTimestampResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetTreeHeadByTimestamp", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianLogClient) GetTreeHeadBySize(ctx context.Context, in *GetTreeHeadBySizeRequest, opts ...grpc.CallOption) (*GetTreeHeadBySizeResponse, error) {
+	out := new(GetTreeHeadBySizeResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetTreeHeadBySize", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *trillianLogClient) GetSequencedLeafCount(ctx context.Context, in *GetSequencedLeafCountRequest, opts ...grpc.CallOption) (*GetSequencedLeafCountResponse, error) {
 	out := new(GetSequencedLeafCountResponse)
 	err := grpc.Invoke(ctx, "/trillian.TrillianLog/GetSequencedLeafCount", in, out, c.cc, opts...)
@@ -1116,6 +1518,8 @@ type TrillianLogServer interface {
 	GetConsistencyProof(context.Context, *GetConsistencyProofRequest) (*GetConsistencyProofResponse, error)
 	// Corresponds to the LogRootReader API
 	GetLatestSignedLogRoot(context.Context, *GetLatestSignedLogRootRequest) (*GetLatestSignedLogRootResponse, error)
+	GetTreeHeadByTimestamp(context.Context, *GetTreeHeadByTimestampRequest) (*GetTreeHeadByTimestampResponse, error)
+	GetTreeHeadBySize(context.Context, *GetTreeHeadBySizeRequest) (*GetTreeHeadBySizeResponse, error)
 	// Corresponds to the LeafReader API
 	GetSequencedLeafCount(context.Context, *GetSequencedLeafCountRequest) (*GetSequencedLeafCountResponse, error)
 	GetLeavesByIndex(context.Context, *GetLeavesByIndexRequest) (*GetLeavesByIndexResponse, error)
@@ -1218,6 +1622,42 @@ func _TrillianLog_GetLatestSignedLogRoot_Handler(srv interface{}, ctx context.Co
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TrillianLog_GetTreeHeadByTimestamp_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTreeHeadByTimestampRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).GetTreeHeadByTimestamp(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/GetTreeHeadByTimestamp",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).GetTreeHeadByTimestamp(ctx, req.(*GetTreeHeadByTimestampRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianLog_GetTreeHeadBySize_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTreeHeadBySizeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianLogServer).GetTreeHeadBySize(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianLog/GetTreeHeadBySize",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianLogServer).GetTreeHeadBySize(ctx, req.(*GetTreeHeadBySizeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _TrillianLog_GetSequencedLeafCount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GetSequencedLeafCountRequest)
 	if err := dec(in); err != nil {
@@ -1332,6 +1772,14 @@ var _TrillianLog_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetLatestSignedLogRoot",
 			Handler:    _TrillianLog_GetLatestSignedLogRoot_Handler,
 		},
+		{
+			MethodName: "GetTreeHeadByTimestamp",
+			Handler:    _TrillianLog_GetTreeHeadByTimestamp_Handler,
+		},
+		{
+			MethodName: "GetTreeHeadBySize",
+			Handler:    _TrillianLog_GetTreeHeadBySize_Handler,
+		},
 		{
 			MethodName: "GetSequencedLeafCount",
 			Handler:    _TrillianLog_GetSequencedLeafCount_Handler,
@@ -1487,92 +1935,220 @@ var _TrillianMap_serviceDesc = grpc.ServiceDesc{
 	Metadata: "github.com/google/trillian/trillian_api.proto",
 }
 
+// Client API for TrillianAdmin service
+
+type TrillianAdminClient interface {
+	// GetTreeACL returns the access control list of a tree.
+	GetTreeACL(ctx context.Context, in *GetTreeACLRequest, opts ...grpc.CallOption) (*GetTreeACLResponse, error)
+	// SetTreeACL replaces the access control list of a tree.
+	SetTreeACL(ctx context.Context, in *SetTreeACLRequest, opts ...grpc.CallOption) (*SetTreeACLResponse, error)
+}
+
+type trillianAdminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewTrillianAdminClient(cc *grpc.ClientConn) TrillianAdminClient {
+	return &trillianAdminClient{cc}
+}
+
+func (c *trillianAdminClient) GetTreeACL(ctx context.Context, in *GetTreeACLRequest, opts ...grpc.CallOption) (*GetTreeACLResponse, error) {
+	out := new(GetTreeACLResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianAdmin/GetTreeACL", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trillianAdminClient) SetTreeACL(ctx context.Context, in *SetTreeACLRequest, opts ...grpc.CallOption) (*SetTreeACLResponse, error) {
+	out := new(SetTreeACLResponse)
+	err := grpc.Invoke(ctx, "/trillian.TrillianAdmin/SetTreeACL", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for TrillianAdmin service
+
+type TrillianAdminServer interface {
+	// GetTreeACL returns the access control list of a tree.
+	GetTreeACL(context.Context, *GetTreeACLRequest) (*GetTreeACLResponse, error)
+	// SetTreeACL replaces the access control list of a tree.
+	SetTreeACL(context.Context, *SetTreeACLRequest) (*SetTreeACLResponse, error)
+}
+
+func RegisterTrillianAdminServer(s *grpc.Server, srv TrillianAdminServer) {
+	s.RegisterService(&_TrillianAdmin_serviceDesc, srv)
+}
+
+func _TrillianAdmin_GetTreeACL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTreeACLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianAdminServer).GetTreeACL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianAdmin/GetTreeACL",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianAdminServer).GetTreeACL(ctx, req.(*GetTreeACLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TrillianAdmin_SetTreeACL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetTreeACLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrillianAdminServer).SetTreeACL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/trillian.TrillianAdmin/SetTreeACL",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrillianAdminServer).SetTreeACL(ctx, req.(*SetTreeACLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _TrillianAdmin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "trillian.TrillianAdmin",
+	HandlerType: (*TrillianAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetTreeACL",
+			Handler:    _TrillianAdmin_GetTreeACL_Handler,
+		},
+		{
+			MethodName: "SetTreeACL",
+			Handler:    _TrillianAdmin_SetTreeACL_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "github.com/google/trillian/trillian_api.proto",
+}
+
 func init() { proto.RegisterFile("github.com/google/trillian/trillian_api.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 1330 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xbc, 0x58, 0xef, 0x6e, 0x13, 0x47,
-	0x10, 0xcf, 0xe5, 0x92, 0xd8, 0x1e, 0x93, 0xd8, 0x59, 0xa0, 0x18, 0x9b, 0x80, 0x59, 0x0a, 0x18,
-	0x24, 0x92, 0xca, 0xa8, 0x55, 0xab, 0x7e, 0x68, 0x09, 0x45, 0x69, 0x8a, 0x53, 0xe8, 0x99, 0xa2,
-	0x8a, 0x4a, 0x3d, 0x5d, 0x7c, 0x1b, 0xe7, 0x9a, 0xf3, 0xed, 0xf5, 0x6e, 0x0d, 0x18, 0xa9, 0xe2,
-	0x43, 0xd5, 0x3e, 0x42, 0xd5, 0x2f, 0xbc, 0x47, 0xfb, 0x40, 0x7d, 0x8f, 0x6a, 0x77, 0xef, 0xbf,
-	0xcf, 0xe7, 0xd0, 0x40, 0xbe, 0xad, 0x67, 0x67, 0x7e, 0x33, 0xf3, 0xdb, 0xd9, 0xd9, 0xf1, 0xc1,
-	0x9d, 0xa1, 0xc5, 0x0e, 0xc7, 0xfb, 0x9b, 0x03, 0x3a, 0xda, 0x1a, 0x52, 0x3a, 0xb4, 0xc9, 0x16,
-	0xf3, 0x2c, 0xdb, 0xb6, 0x0c, 0x27, 0x5a, 0xe8, 0x86, 0x6b, 0x6d, 0xba, 0x1e, 0x65, 0x14, 0x95,
-	0x43, 0x59, 0xf3, 0xd6, 0x31, 0x0c, 0xa5, 0x11, 0x7e, 0x01, 0xeb, 0x4f, 0x02, 0xc9, 0x3d, 0xd7,
-	0xea, 0x33, 0x83, 0x8d, 0x7d, 0xf4, 0x25, 0x54, 0x7d, 0xb1, 0xd2, 0x07, 0xd4, 0x24, 0x0d, 0xa5,
-	0xad, 0x74, 0xd6, 0xba, 0x57, 0x36, 0x23, 0xd3, 0x29, 0x8b, 0xfb, 0xd4, 0x24, 0x1a, 0xf8, 0xd1,
-	0x1a, 0xb5, 0xa1, 0x6a, 0x12, 0x7f, 0xe0, 0x59, 0x2e, 0xb3, 0xa8, 0xd3, 0x58, 0x6c, 0x2b, 0x9d,
-	0x8a, 0x96, 0x14, 0xe1, 0xbf, 0x15, 0x28, 0xf5, 0xe8, 0xb0, 0x47, 0x8c, 0x03, 0xd4, 0x81, 0xfa,
-	0x88, 0x78, 0x47, 0x36, 0xd1, 0x6d, 0x62, 0x1c, 0xe8, 0x87, 0x86, 0x7f, 0x28, 0x9c, 0x9e, 0xd1,
-	0xd6, 0xa4, 0x9c, 0x6b, 0x7d, 0x6d, 0xf8, 0x87, 0x68, 0x03, 0x40, 0xa8, 0x3c, 0x37, 0xec, 0x31,
-	0x11, 0xb0, 0x67, 0xb4, 0x0a, 0x97, 0x3c, 0xe5, 0x02, 0xbe, 0x4d, 0x5e, 0x32, 0xcf, 0xd0, 0x4d,
-	0x83, 0x19, 0x0d, 0x55, 0x6e, 0x0b, 0xc9, 0x57, 0x06, 0x33, 0x22, 0x6b, 0xcb, 0x31, 0xc9, 0xcb,
-	0xc6, 0x52, 0x5b, 0xe9, 0xa8, 0xd2, 0x7a, 0x97, 0x0b, 0xd0, 0x0d, 0xa8, 0xc5, 0xe0, 0x32, 0x8a,
-	0x65, 0x01, 0xb1, 0x1a, 0x79, 0xe0, 0x41, 0x60, 0x03, 0x96, 0xbe, 0xe5, 0x49, 0x5e, 0x80, 0x92,
-	0x43, 0x4d, 0xa2, 0x5b, 0x66, 0x10, 0xed, 0x0a, 0xff, 0xb9, 0x6b, 0xa2, 0x16, 0x54, 0xc4, 0x86,
-	0x80, 0x90, 0x41, 0x96, 0xb9, 0x40, 0xa4, 0x70, 0x0d, 0x56, 0xc5, 0xa6, 0x47, 0x9e, 0x5b, 0x3e,
-	0x27, 0x47, 0x15, 0x71, 0x9c, 0xe1, 0x42, 0x2d, 0x90, 0xe1, 0xef, 0x61, 0xf9, 0xb1, 0x47, 0xe9,
-	0x41, 0x26, 0x64, 0x25, 0x1b, 0xf2, 0x1d, 0x00, 0x97, 0xeb, 0xe9, 0xdc, 0xba, 0xb1, 0xd8, 0x56,
-	0x3b, 0xd5, 0xee, 0x5a, 0x7c, 0x50, 0x3c, 0x4c, 0xad, 0x22, 0x34, 0xf8, 0x12, 0x3f, 0x05, 0xf4,
-	0xdd, 0x98, 0x8c, 0x39, 0x9f, 0xcf, 0x89, 0xaf, 0x91, 0x5f, 0xc6, 0xc4, 0x67, 0xe8, 0x3c, 0xac,
-	0xd8, 0x74, 0x18, 0xa6, 0xa1, 0x6a, 0xcb, 0x36, 0x1d, 0xee, 0x9a, 0xe8, 0x16, 0xac, 0xd8, 0x42,
-	0x2f, 0xc0, 0x5d, 0x8f, 0x71, 0x83, 0x83, 0xd3, 0x02, 0x05, 0xfc, 0x0d, 0x9c, 0x4d, 0xe1, 0xfa,
-	0x2e, 0x75, 0x7c, 0x82, 0xee, 0xc2, 0x8a, 0xac, 0x09, 0x01, 0x5c, 0xed, 0xb6, 0x0a, 0x4a, 0x48,
-	0x0b, 0x54, 0xf1, 0x08, 0x1a, 0x3b, 0x84, 0xed, 0x3a, 0x03, 0x7b, 0xcc, 0xa9, 0x10, 0x34, 0xcc,
-	0x89, 0x34, 0x4d, 0xd2, 0x62, 0x96, 0xa4, 0x16, 0x54, 0x98, 0x47, 0x88, 0xee, 0x5b, 0xaf, 0x48,
-	0xc0, 0x76, 0x99, 0x0b, 0xfa, 0xd6, 0x2b, 0x82, 0x5f, 0xc0, 0xc5, 0x1c, 0x77, 0x27, 0x48, 0x00,
-	0x5d, 0x87, 0x65, 0xc1, 0xb8, 0x08, 0xa4, 0xda, 0xad, 0xc5, 0x36, 0x12, 0x5c, 0xee, 0xe2, 0x37,
-	0x0a, 0x5c, 0x9e, 0xf2, 0xbc, 0x3d, 0xe1, 0x35, 0x32, 0x27, 0xdd, 0x16, 0x54, 0xe2, 0x7b, 0x12,
-	0x94, 0x97, 0x1d, 0xde, 0x90, 0xa2, 0x64, 0xd1, 0x6d, 0x58, 0xa7, 0x9e, 0x49, 0x3c, 0x7d, 0x7f,
-	0xa2, 0xfb, 0xdc, 0x89, 0x33, 0x20, 0xe2, 0x1e, 0x94, 0xb5, 0x9a, 0xd8, 0xd8, 0x9e, 0xf4, 0x03,
-	0x31, 0xfe, 0x15, 0xae, 0xcc, 0x0c, 0xef, 0x1d, 0xd1, 0xa3, 0x16, 0xd0, 0xf3, 0xbb, 0x02, 0xcd,
-	0x1d, 0xc2, 0xee, 0x53, 0xc7, 0xb7, 0x7c, 0x46, 0x9c, 0xc1, 0xe4, 0x38, 0x95, 0x70, 0x03, 0x6a,
-	0x07, 0x96, 0xe7, 0x33, 0x3d, 0xe6, 0x40, 0x96, 0xc3, 0xaa, 0x10, 0x3f, 0x09, 0x89, 0xe8, 0x40,
-	0xdd, 0x27, 0x03, 0xea, 0x98, 0x7a, 0x96, 0xac, 0x35, 0x29, 0x0f, 0x35, 0xf1, 0x04, 0x5a, 0xb9,
-	0x61, 0x9c, 0x42, 0x85, 0xbc, 0x84, 0x0f, 0x76, 0x08, 0x93, 0x77, 0xea, 0xff, 0x14, 0x86, 0x9a,
-	0x2a, 0x8c, 0xdc, 0xb3, 0x57, 0xf3, 0xcf, 0x7e, 0x02, 0x17, 0xa6, 0x3c, 0x9f, 0x24, 0xe1, 0xb7,
-	0x68, 0x25, 0x8f, 0x52, 0xae, 0xc5, 0x05, 0x7e, 0xcb, 0xdb, 0xaf, 0xa6, 0x6e, 0x3f, 0x7e, 0x25,
-	0xfa, 0x49, 0x06, 0xf0, 0x94, 0x92, 0xf9, 0x18, 0x2e, 0xed, 0x10, 0x16, 0xd2, 0x6a, 0xf2, 0xbd,
-	0xfb, 0x74, 0xec, 0xb0, 0xe2, 0x8c, 0xb0, 0x0f, 0x1b, 0x33, 0xcc, 0x4e, 0x12, 0x77, 0xc8, 0xd3,
-	0x80, 0x43, 0x25, 0xbb, 0xa4, 0xc0, 0xc6, 0x9f, 0x08, 0xa7, 0x3d, 0x83, 0x11, 0x9f, 0xf5, 0xad,
-	0xa1, 0x43, 0xcc, 0x1e, 0x1d, 0x6a, 0x94, 0xce, 0x0b, 0xf6, 0x4f, 0xd9, 0xc7, 0x72, 0x0d, 0x4f,
-	0x12, 0xee, 0x17, 0x50, 0xf3, 0x05, 0x9a, 0xce, 0xbd, 0x7a, 0x94, 0xb2, 0xe0, 0xba, 0x5c, 0x88,
-	0xad, 0xd3, 0xee, 0x56, 0xfd, 0xe4, 0x4f, 0x6c, 0x8b, 0x4a, 0x7a, 0xe0, 0x30, 0x6f, 0x72, 0xcf,
-	0x31, 0xdf, 0xf7, 0x3b, 0xf2, 0x46, 0x11, 0x75, 0x96, 0x71, 0xf7, 0xfe, 0xbb, 0x04, 0xba, 0x0e,
-	0x4b, 0x3c, 0x44, 0x11, 0x50, 0x6e, 0x31, 0x8a, 0x6d, 0xfc, 0x1a, 0x4a, 0x7b, 0x86, 0x2b, 0xc6,
-	0xad, 0x8b, 0x50, 0x3e, 0x22, 0x93, 0xe4, 0x98, 0x55, 0x3a, 0x22, 0x93, 0xf0, 0xf5, 0x98, 0xfd,
-	0xb4, 0xa4, 0x87, 0x2f, 0xb5, 0x78, 0xf8, 0x5a, 0xca, 0x0c, 0x5f, 0xf8, 0x01, 0x94, 0x1f, 0x92,
-	0x89, 0x54, 0xad, 0x83, 0x7a, 0x44, 0x26, 0x81, 0x73, 0xbe, 0x44, 0x37, 0x61, 0x39, 0x9e, 0xe9,
-	0x52, 0x69, 0x04, 0x51, 0x6b, 0x72, 0x1f, 0xef, 0xc3, 0x7a, 0x08, 0x13, 0xbd, 0x4d, 0x68, 0x0b,
-	0x2a, 0x3c, 0x23, 0x89, 0x20, 0x29, 0x46, 0x31, 0x42, 0xa8, 0xaf, 0xf1, 0xb4, 0x65, 0x00, 0x97,
-	0xa0, 0x62, 0x85, 0xd6, 0x41, 0xa7, 0x8c, 0x05, 0xf8, 0x19, 0x9c, 0xdd, 0x21, 0x4c, 0x3a, 0x4e,
-	0xcf, 0x49, 0x23, 0xc3, 0x4d, 0x54, 0xcd, 0xc8, 0x70, 0x77, 0xcd, 0x30, 0x19, 0x89, 0x22, 0x92,
-	0x69, 0x42, 0x39, 0x33, 0xdd, 0x45, 0xbf, 0xf1, 0x3f, 0x0a, 0x9c, 0x4b, 0x83, 0x9f, 0xa4, 0x46,
-	0x3e, 0x4d, 0x26, 0x2e, 0xdb, 0x51, 0x6b, 0x3a, 0xf1, 0x88, 0xa8, 0x04, 0x03, 0x5d, 0x28, 0xf3,
-	0x64, 0xc4, 0xbd, 0x52, 0xf3, 0xef, 0xd5, 0x9e, 0xe1, 0x8a, 0x7b, 0x55, 0x1a, 0xc9, 0x05, 0xfe,
-	0x4b, 0x81, 0xb3, 0xfd, 0xe3, 0x13, 0xb3, 0x35, 0x1d, 0x5c, 0xf1, 0xa9, 0x7c, 0x06, 0xd5, 0x91,
-	0xe1, 0xba, 0xc4, 0x8b, 0xe7, 0xf7, 0x6a, 0xb7, 0x91, 0x2a, 0x05, 0x97, 0x78, 0x7b, 0x84, 0x19,
-	0x7c, 0x5f, 0x03, 0xa9, 0x2c, 0xaa, 0xeb, 0x35, 0x9c, 0xeb, 0xbf, 0x33, 0x56, 0x93, 0xdc, 0x2c,
-	0x1e, 0x93, 0x9b, 0x8f, 0x44, 0xb7, 0x49, 0x6f, 0x16, 0xd2, 0x83, 0x7f, 0x93, 0x1d, 0x23, 0x63,
-	0x72, 0xca, 0x71, 0xdf, 0xbe, 0x0d, 0xe7, 0x73, 0xff, 0xce, 0xa1, 0x15, 0x58, 0x7c, 0xf4, 0xb0,
-	0xbe, 0x80, 0x2a, 0xb0, 0xfc, 0x40, 0xd3, 0x1e, 0x69, 0x75, 0xa5, 0xfb, 0x6f, 0x09, 0xaa, 0xa1,
-	0x72, 0x8f, 0x0e, 0x51, 0x0f, 0xaa, 0x89, 0xb1, 0x1f, 0x5d, 0x8a, 0x9d, 0x4d, 0xff, 0xcb, 0x68,
-	0x6e, 0xcc, 0xd8, 0x95, 0x09, 0xe3, 0x05, 0xf4, 0x13, 0xac, 0x4f, 0x0d, 0x9c, 0x08, 0xc7, 0x56,
-	0xb3, 0xfe, 0x15, 0x34, 0xaf, 0x15, 0xea, 0x44, 0xf8, 0xae, 0x38, 0xa1, 0xbc, 0x81, 0x16, 0x75,
-	0x0a, 0x10, 0x52, 0x93, 0x57, 0xf3, 0xd6, 0x31, 0x34, 0x23, 0x8f, 0xa6, 0xe8, 0x23, 0xd9, 0xd9,
-	0x11, 0x7d, 0x98, 0xc2, 0x98, 0x31, 0xe1, 0x36, 0xaf, 0xcf, 0xd1, 0x8a, 0xbc, 0x8c, 0xe4, 0x98,
-	0x38, 0xfd, 0xfe, 0xa2, 0x9b, 0x29, 0x88, 0xd9, 0x4f, 0x7b, 0xb3, 0x33, 0x5f, 0x31, 0x72, 0xf7,
-	0x33, 0x9c, 0xcf, 0x1d, 0x4e, 0xd0, 0x8d, 0x14, 0xc8, 0xcc, 0xa1, 0xa7, 0x79, 0x73, 0xae, 0x5e,
-	0xe4, 0xeb, 0x47, 0xa8, 0x67, 0x67, 0x37, 0x74, 0x35, 0x1d, 0x6b, 0xce, 0xa0, 0xd8, 0xc4, 0x45,
-	0x2a, 0x11, 0xf8, 0x0f, 0x50, 0xcb, 0x0c, 0xb9, 0xa8, 0x9d, 0x6b, 0x98, 0x3c, 0xff, 0xab, 0x05,
-	0x1a, 0x11, 0xb2, 0x91, 0x1a, 0x39, 0x7b, 0xc9, 0x8f, 0x07, 0xef, 0xca, 0x85, 0x64, 0x26, 0x35,
-	0x6d, 0x64, 0x98, 0xc9, 0x1b, 0x7c, 0x32, 0xcc, 0xe4, 0x0e, 0x2b, 0x78, 0xa1, 0xfb, 0xc7, 0x62,
-	0x7c, 0xcf, 0xf7, 0x0c, 0x17, 0xf5, 0xa0, 0x12, 0x45, 0x82, 0x36, 0x52, 0x10, 0xd9, 0xb7, 0xa0,
-	0x79, 0x79, 0xd6, 0x76, 0x14, 0x7a, 0x0f, 0x2a, 0xfd, 0x3c, 0xb4, 0x7e, 0x31, 0x5a, 0x3f, 0x1f,
-	0x4d, 0x12, 0x91, 0x6a, 0x6e, 0x19, 0x22, 0xf2, 0x7a, 0x72, 0x86, 0x88, 0xdc, 0x1e, 0x8c, 0x17,
-	0xb6, 0x9f, 0xc0, 0xc5, 0x01, 0x1d, 0x6d, 0xca, 0x6f, 0x68, 0x9b, 0xe9, 0x4f, 0x67, 0xdb, 0xf5,
-	0x44, 0xdf, 0x7c, 0xcc, 0x25, 0x8f, 0x95, 0x67, 0xd7, 0x66, 0x7f, 0x79, 0xfb, 0x3c, 0x5c, 0xec,
-	0xaf, 0x08, 0xfb, 0xbb, 0xff, 0x05, 0x00, 0x00, 0xff, 0xff, 0xdf, 0xcc, 0xcb, 0x8a, 0xe0, 0x13,
-	0x00, 0x00,
+	// 1775 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xcc, 0x59, 0xdd, 0x6f, 0xdb, 0xc8,
+	0x11, 0x0f, 0xa5, 0xe8, 0x6b, 0x64, 0x59, 0xf2, 0xe6, 0xc3, 0x0a, 0x9d, 0xdc, 0x39, 0x4c, 0x93,
+	0x28, 0xc6, 0x9d, 0x9d, 0xea, 0x50, 0xe3, 0x82, 0x16, 0x68, 0x6d, 0xc7, 0xb1, 0x85, 0x93, 0x3f,
+	0x4a, 0x1a, 0x87, 0xe2, 0x0a, 0x1c, 0xb1, 0x16, 0xd7, 0x32, 0x6b, 0x89, 0xe4, 0x91, 0xab, 0x9c,
+	0x95, 0xa2, 0xb8, 0x87, 0x02, 0x45, 0x5f, 0xfb, 0x52, 0xdc, 0x4b, 0x1f, 0xdb, 0xfe, 0x03, 0x7d,
+	0xe9, 0x53, 0xff, 0x8c, 0xfe, 0x3b, 0xc5, 0xee, 0xf2, 0x43, 0xa4, 0x28, 0xca, 0x77, 0x76, 0x73,
+	0xf7, 0x46, 0xce, 0xcc, 0xfe, 0xe6, 0x63, 0x67, 0x67, 0x67, 0x48, 0xf8, 0xb8, 0x6f, 0xd2, 0xf3,
+	0xd1, 0xe9, 0x7a, 0xcf, 0x1e, 0x6e, 0xf4, 0x6d, 0xbb, 0x3f, 0x20, 0x1b, 0xd4, 0x35, 0x07, 0x03,
+	0x13, 0x5b, 0xe1, 0x83, 0x8e, 0x1d, 0x73, 0xdd, 0x71, 0x6d, 0x6a, 0xa3, 0x72, 0x40, 0x93, 0x5f,
+	0x5c, 0x61, 0xa1, 0x58, 0xa4, 0x7c, 0x0d, 0x4b, 0x27, 0x3e, 0x65, 0xcb, 0x31, 0x35, 0x8a, 0xe9,
+	0xc8, 0x43, 0xbf, 0x82, 0xaa, 0xc7, 0x9f, 0xf4, 0x9e, 0x6d, 0x90, 0xa6, 0xb4, 0x2a, 0xb5, 0x16,
+	0xdb, 0x1f, 0xae, 0x87, 0x4b, 0xa7, 0x56, 0xec, 0xd8, 0x06, 0x51, 0xc1, 0x0b, 0x9f, 0xd1, 0x2a,
+	0x54, 0x0d, 0xe2, 0xf5, 0x5c, 0xd3, 0xa1, 0xa6, 0x6d, 0x35, 0x73, 0xab, 0x52, 0xab, 0xa2, 0x4e,
+	0x92, 0x94, 0x6f, 0x73, 0x50, 0xea, 0xda, 0xfd, 0x2e, 0xc1, 0x67, 0xa8, 0x05, 0x8d, 0x21, 0x71,
+	0x2f, 0x06, 0x44, 0x1f, 0x10, 0x7c, 0xa6, 0x9f, 0x63, 0xef, 0x9c, 0x2b, 0x5d, 0x50, 0x17, 0x05,
+	0x9d, 0x49, 0xed, 0x63, 0xef, 0x1c, 0x3d, 0x02, 0xe0, 0x22, 0x6f, 0xf1, 0x60, 0x44, 0x38, 0xec,
+	0x82, 0x5a, 0x61, 0x94, 0xcf, 0x19, 0x81, 0xb1, 0xc9, 0x25, 0x75, 0xb1, 0x6e, 0x60, 0x8a, 0x9b,
+	0x79, 0xc1, 0xe6, 0x94, 0xd7, 0x98, 0xe2, 0x70, 0xb5, 0x69, 0x19, 0xe4, 0xb2, 0x79, 0x7b, 0x55,
+	0x6a, 0xe5, 0xc5, 0xea, 0x0e, 0x23, 0xa0, 0x67, 0x50, 0x8f, 0xc0, 0x85, 0x15, 0x05, 0x0e, 0x51,
+	0x0b, 0x35, 0x70, 0x23, 0x5e, 0xc2, 0xdd, 0x21, 0x71, 0xfb, 0x44, 0x37, 0x08, 0x36, 0x06, 0xa6,
+	0x45, 0x74, 0x0b, 0x5b, 0xb6, 0xd7, 0x2c, 0x72, 0x40, 0xc4, 0x79, 0xaf, 0x7d, 0xd6, 0x21, 0xe3,
+	0xa0, 0x8f, 0x00, 0x09, 0xc5, 0x06, 0xb1, 0xa8, 0x49, 0xc7, 0x02, 0xbc, 0xc4, 0xc1, 0x1b, 0xdc,
+	0x00, 0x9f, 0xc1, 0xf0, 0x15, 0x0c, 0xb7, 0x0f, 0x59, 0x10, 0x97, 0xa1, 0x64, 0xd9, 0x06, 0xd1,
+	0x4d, 0xc3, 0x8f, 0x46, 0x91, 0xbd, 0x76, 0x0c, 0xb4, 0x02, 0x15, 0xce, 0xe0, 0x28, 0x22, 0x08,
+	0x65, 0x46, 0xe0, 0xd6, 0x3d, 0x81, 0x1a, 0x67, 0xba, 0xe4, 0xad, 0xe9, 0xb1, 0xe0, 0xe7, 0xb9,
+	0x59, 0x0b, 0x8c, 0xa8, 0xfa, 0x34, 0xe5, 0x12, 0x0a, 0xc7, 0xae, 0x6d, 0x9f, 0x25, 0x42, 0x22,
+	0x25, 0x43, 0xf2, 0x31, 0x80, 0xc3, 0xe4, 0x74, 0xb6, 0xba, 0x99, 0x5b, 0xcd, 0xb7, 0xaa, 0xed,
+	0xc5, 0x28, 0x11, 0x98, 0x99, 0x6a, 0x85, 0x4b, 0x70, 0x8b, 0x1f, 0xc3, 0x02, 0xb1, 0x58, 0xce,
+	0x18, 0xba, 0x83, 0xe9, 0xb9, 0xbf, 0x03, 0x55, 0x9f, 0x76, 0x8c, 0xe9, 0xb9, 0xf2, 0x39, 0xa0,
+	0x5f, 0x8f, 0xc8, 0x88, 0x6d, 0xe9, 0x5b, 0xe2, 0xa9, 0xe4, 0xab, 0x11, 0xf1, 0x28, 0xba, 0x07,
+	0xc5, 0x81, 0xdd, 0x0f, 0x3c, 0xcd, 0xab, 0x85, 0x81, 0xdd, 0xef, 0x18, 0xe8, 0x05, 0x14, 0x07,
+	0x5c, 0xce, 0x57, 0xbd, 0x14, 0xa9, 0xf6, 0x73, 0x47, 0xf5, 0x05, 0x94, 0x3f, 0x4b, 0x70, 0x27,
+	0x06, 0xec, 0x39, 0xb6, 0xe5, 0x11, 0xf4, 0x09, 0x14, 0x45, 0x5e, 0x72, 0xe4, 0x6a, 0x7b, 0x25,
+	0x23, 0x8d, 0x55, 0x5f, 0x14, 0xfd, 0x02, 0x6a, 0x5f, 0x31, 0x2c, 0x43, 0x8f, 0xa9, 0x5f, 0x8e,
+	0xd6, 0x72, 0x55, 0x46, 0x60, 0xc4, 0x82, 0x90, 0x16, 0xaa, 0x95, 0x13, 0xa8, 0xc5, 0xd8, 0xe8,
+	0x29, 0xdc, 0x66, 0x21, 0xf5, 0x2d, 0x48, 0x71, 0x82, 0xb3, 0xd1, 0x43, 0xa8, 0x18, 0x23, 0x67,
+	0x60, 0xf6, 0x30, 0x15, 0xb9, 0x5d, 0x56, 0x23, 0x82, 0xf2, 0x4f, 0x09, 0x9a, 0x7b, 0x84, 0x76,
+	0xac, 0xde, 0x60, 0xc4, 0xf6, 0x90, 0xef, 0xdf, 0x9c, 0xf8, 0xc5, 0x77, 0x37, 0x97, 0xdc, 0xdd,
+	0x15, 0xa8, 0x50, 0x97, 0x10, 0xdd, 0x33, 0xdf, 0x11, 0x3f, 0x4d, 0xca, 0x8c, 0xa0, 0x99, 0xef,
+	0x08, 0xfa, 0x14, 0x16, 0xc4, 0xd6, 0x9f, 0xd9, 0xee, 0x10, 0x53, 0x7e, 0x5c, 0x16, 0xdb, 0xf7,
+	0x22, 0xe3, 0xb9, 0x01, 0x6f, 0x38, 0x53, 0xad, 0x3a, 0xd1, 0x8b, 0xf2, 0x35, 0x3c, 0x48, 0x31,
+	0xf4, 0x3a, 0xfb, 0xf1, 0x14, 0x0a, 0x5c, 0x01, 0x77, 0xa1, 0xda, 0xae, 0x27, 0x8c, 0x50, 0x05,
+	0x57, 0xf9, 0xaf, 0x04, 0x1f, 0x4c, 0x69, 0xde, 0xe6, 0x87, 0x6a, 0x4e, 0xa0, 0x56, 0xa0, 0x12,
+	0x95, 0x1e, 0xff, 0x44, 0x0d, 0x82, 0xa2, 0x93, 0x19, 0xa6, 0x35, 0x58, 0xb2, 0x5d, 0x83, 0xb8,
+	0xfa, 0xe9, 0x58, 0xf7, 0x98, 0x12, 0xab, 0x47, 0x78, 0xac, 0xca, 0x6a, 0x9d, 0x33, 0xb6, 0xc7,
+	0x9a, 0x4f, 0x9e, 0x0a, 0x69, 0xe1, 0xca, 0x21, 0xfd, 0x03, 0x7c, 0x38, 0xd3, 0xb1, 0x1b, 0x0a,
+	0x6c, 0x3e, 0x23, 0xb0, 0xff, 0x91, 0x40, 0xde, 0x23, 0x74, 0xc7, 0xb6, 0x3c, 0xd3, 0xa3, 0xc4,
+	0xea, 0x8d, 0xaf, 0x92, 0x7d, 0xcf, 0xa0, 0x7e, 0x66, 0xba, 0x1e, 0xd5, 0xa3, 0xe8, 0x89, 0x14,
+	0xac, 0x71, 0xf2, 0x49, 0x10, 0xc2, 0x16, 0x34, 0x3c, 0xd2, 0xb3, 0x2d, 0x43, 0x4f, 0x86, 0x79,
+	0x51, 0xd0, 0x4f, 0xae, 0x9f, 0x93, 0x63, 0x58, 0x49, 0x75, 0xe0, 0x3d, 0x64, 0xe5, 0x25, 0xdc,
+	0xdf, 0x23, 0x54, 0xd4, 0x86, 0xef, 0x93, 0x8c, 0xf9, 0x58, 0x32, 0xa6, 0xe6, 0x5b, 0x3e, 0x35,
+	0xdf, 0x94, 0x31, 0x2c, 0x4f, 0x69, 0xbe, 0x8e, 0xc3, 0xdf, 0xa1, 0x1c, 0x1f, 0xc5, 0x54, 0xf3,
+	0x72, 0xf3, 0x1d, 0x6b, 0x55, 0x3e, 0x56, 0xab, 0x94, 0x77, 0xd0, 0x9c, 0x06, 0x7c, 0x4f, 0xce,
+	0xfc, 0x0c, 0x1e, 0xee, 0x11, 0x1a, 0x84, 0x95, 0x95, 0xf9, 0xb3, 0x1d, 0x7b, 0x64, 0xd1, 0x6c,
+	0x8f, 0x14, 0x0f, 0x1e, 0xcd, 0x58, 0x76, 0x1d, 0xbb, 0x83, 0x38, 0xf5, 0x18, 0xd4, 0x64, 0x4d,
+	0xe7, 0xd8, 0xca, 0x26, 0x57, 0xda, 0xc5, 0x94, 0x78, 0x54, 0x33, 0xfb, 0x16, 0xbf, 0x85, 0x54,
+	0xdb, 0x9e, 0x67, 0xec, 0x5f, 0x45, 0xed, 0x4c, 0x5d, 0x78, 0x1d, 0x73, 0x7f, 0x09, 0x75, 0x8f,
+	0xa3, 0xe9, 0x4c, 0xab, 0x6b, 0xdb, 0xd4, 0x3f, 0x2e, 0x13, 0x97, 0x69, 0x5c, 0x5d, 0xcd, 0x9b,
+	0x7c, 0x55, 0x74, 0xee, 0x10, 0x2b, 0x01, 0xfb, 0x04, 0x1b, 0xdb, 0xe3, 0x13, 0x73, 0x48, 0x3c,
+	0x8a, 0x87, 0xce, 0x9c, 0x7c, 0x7a, 0x0e, 0x75, 0x1a, 0x88, 0xfa, 0x0d, 0x9a, 0x08, 0xd6, 0x62,
+	0x48, 0xe6, 0xcd, 0x59, 0xe0, 0x79, 0xaa, 0x86, 0x1f, 0xd4, 0xf3, 0x43, 0x68, 0xc6, 0xec, 0x62,
+	0x25, 0x70, 0x7e, 0xe9, 0x48, 0x16, 0xdb, 0xf0, 0xaa, 0x52, 0xfe, 0x22, 0xc1, 0x83, 0x14, 0xc0,
+	0x1f, 0xd4, 0xc7, 0x7f, 0x48, 0xbc, 0x50, 0xec, 0x5a, 0xd4, 0x1d, 0x6f, 0x59, 0xc6, 0x8f, 0xb7,
+	0xa9, 0xf9, 0x9b, 0x68, 0xbf, 0x12, 0x86, 0xfe, 0xff, 0xaf, 0x8f, 0xb0, 0x79, 0xcc, 0x67, 0x36,
+	0x8f, 0xca, 0x37, 0x50, 0x3a, 0xc0, 0x0e, 0x23, 0xa0, 0x07, 0x50, 0xbe, 0x20, 0xe3, 0xc9, 0x31,
+	0xaa, 0x74, 0x41, 0xc6, 0x41, 0x2b, 0x33, 0xbb, 0xcf, 0x89, 0x0f, 0x57, 0xf9, 0xec, 0xe1, 0xea,
+	0x76, 0x62, 0xb8, 0x52, 0x76, 0xa1, 0xfc, 0x19, 0x19, 0x0b, 0xd1, 0x06, 0xe4, 0x2f, 0xc8, 0xd8,
+	0x57, 0xce, 0x1e, 0xd1, 0x73, 0x28, 0x44, 0x33, 0x5b, 0xcc, 0x0d, 0xdf, 0x6a, 0x55, 0xf0, 0x95,
+	0x53, 0x58, 0x0a, 0x60, 0xc2, 0x76, 0x07, 0x6d, 0x40, 0x85, 0x79, 0x24, 0x10, 0x44, 0x88, 0x51,
+	0x84, 0x10, 0xc8, 0xab, 0xe5, 0x0b, 0xff, 0x89, 0xb5, 0xd2, 0x66, 0xb0, 0xda, 0xbf, 0x42, 0x23,
+	0x82, 0xf2, 0x05, 0xdc, 0xd9, 0x23, 0x54, 0x28, 0x8e, 0x0f, 0x21, 0x43, 0xec, 0x4c, 0xe4, 0xdb,
+	0x10, 0x3b, 0x1d, 0x23, 0x70, 0x46, 0xa0, 0x70, 0x67, 0x64, 0x28, 0x27, 0xa6, 0xab, 0xf0, 0x5d,
+	0xf9, 0xb7, 0x04, 0x77, 0xe3, 0xe0, 0xd7, 0xc9, 0x91, 0x4f, 0x27, 0x1d, 0x17, 0xf7, 0xd4, 0xca,
+	0xb4, 0xe3, 0x61, 0xa0, 0x26, 0x22, 0xd0, 0x86, 0x32, 0x73, 0x86, 0x1f, 0xc9, 0x7c, 0xfa, 0x91,
+	0x3c, 0xc0, 0x0e, 0x3f, 0x92, 0xa5, 0xa1, 0x78, 0x50, 0xbe, 0x95, 0xe0, 0x8e, 0x76, 0xf5, 0xc0,
+	0x6c, 0x4c, 0x1b, 0x97, 0xbd, 0x2b, 0xaf, 0xa0, 0x3a, 0xc4, 0x8e, 0x43, 0xdc, 0x68, 0x3e, 0xaf,
+	0xb6, 0x9b, 0xb1, 0x54, 0x70, 0x88, 0x7b, 0x40, 0x28, 0x66, 0x7c, 0x15, 0x84, 0x30, 0xcf, 0xae,
+	0x6f, 0xe0, 0xae, 0x76, 0x63, 0x51, 0x9d, 0x8c, 0x4d, 0xee, 0x8a, 0xb1, 0x79, 0xc9, 0xeb, 0x54,
+	0x9c, 0x99, 0x19, 0x1e, 0xe5, 0x8f, 0xa2, 0x62, 0x24, 0x96, 0xbc, 0x6f, 0xbb, 0xb7, 0x61, 0x81,
+	0x15, 0xfc, 0xad, 0x9d, 0x2e, 0x2f, 0x5d, 0xec, 0x64, 0x38, 0xae, 0x69, 0xf5, 0x4c, 0x07, 0x0f,
+	0xb8, 0xee, 0x8a, 0x1a, 0x11, 0xd0, 0x5d, 0x28, 0x78, 0x3d, 0xdb, 0x21, 0xfe, 0x17, 0x1b, 0xf1,
+	0xa2, 0x7c, 0x04, 0x4b, 0xfe, 0xbd, 0xb1, 0xb5, 0xd3, 0x0d, 0xbc, 0x5e, 0x86, 0x12, 0xaf, 0xb3,
+	0xa1, 0xdb, 0x45, 0xf6, 0xda, 0x31, 0x94, 0xdf, 0x03, 0x9a, 0x94, 0xbe, 0x8e, 0xc3, 0x2f, 0xa1,
+	0x44, 0x2c, 0xea, 0x9a, 0x61, 0x93, 0x76, 0x7f, 0x72, 0x55, 0xe4, 0x95, 0x1a, 0x88, 0x29, 0x5f,
+	0xc2, 0x92, 0x76, 0x65, 0x53, 0xbf, 0x07, 0x7e, 0x07, 0x90, 0x76, 0x33, 0xce, 0xad, 0xad, 0xc1,
+	0xbd, 0xd4, 0x0f, 0x69, 0xa8, 0x08, 0xb9, 0xa3, 0xcf, 0x1a, 0xb7, 0x50, 0x05, 0x0a, 0xbb, 0xaa,
+	0x7a, 0xa4, 0x36, 0xa4, 0xb5, 0x3d, 0xa8, 0x4e, 0xdc, 0x4c, 0xa8, 0x0e, 0xd5, 0x63, 0xf5, 0xe8,
+	0xe8, 0x8d, 0x7e, 0x78, 0xf4, 0x7a, 0x57, 0x6b, 0xdc, 0x42, 0x35, 0xa8, 0xec, 0x6f, 0x69, 0xfb,
+	0x7a, 0xb7, 0xa3, 0x9d, 0x34, 0x24, 0x54, 0x85, 0x92, 0xfa, 0x66, 0x67, 0xf3, 0xd5, 0x66, 0xbb,
+	0x91, 0xf3, 0x5f, 0x5e, 0xfd, 0x74, 0xb3, 0xdd, 0xc8, 0xb7, 0xff, 0x55, 0x81, 0x6a, 0xa0, 0xb5,
+	0x6b, 0xf7, 0x51, 0x17, 0xaa, 0x13, 0x5f, 0x4d, 0xd0, 0xc3, 0xc4, 0x17, 0x8e, 0x58, 0x1d, 0x90,
+	0x1f, 0xcd, 0xe0, 0x8a, 0x28, 0x28, 0xb7, 0xd0, 0x97, 0x3c, 0x51, 0xe2, 0x63, 0x2a, 0x52, 0xa2,
+	0x55, 0xb3, 0xbe, 0x5f, 0xc8, 0x4f, 0x32, 0x65, 0x42, 0x7c, 0x07, 0x96, 0xa7, 0xd8, 0x62, 0xb0,
+	0x41, 0xad, 0x0c, 0x84, 0xd8, 0xd4, 0x25, 0xbf, 0xb8, 0x82, 0x64, 0xa8, 0xd1, 0x80, 0x3b, 0x29,
+	0x73, 0x23, 0xfa, 0x49, 0x0c, 0x63, 0xc6, 0x5c, 0x2c, 0x3f, 0x9d, 0x23, 0x15, 0x6a, 0x19, 0xc2,
+	0xfd, 0xf4, 0xde, 0x1b, 0x3d, 0x8f, 0x41, 0xcc, 0x6e, 0xeb, 0xe5, 0xd6, 0x7c, 0xc1, 0x84, 0xba,
+	0x94, 0x86, 0x37, 0xa1, 0x6e, 0x76, 0xd3, 0x2d, 0xb7, 0xe6, 0x0b, 0x26, 0xb2, 0x22, 0xde, 0x76,
+	0x26, 0xb2, 0x22, 0xb5, 0xc9, 0x95, 0x9f, 0x64, 0xca, 0x84, 0xf8, 0xbf, 0x83, 0x7b, 0xa9, 0x73,
+	0x16, 0x7a, 0x16, 0x5b, 0x3f, 0x73, 0x7e, 0x93, 0x9f, 0xcf, 0x95, 0x0b, 0x75, 0xfd, 0x16, 0x1a,
+	0xc9, 0x31, 0x14, 0x3d, 0x8e, 0x87, 0x3e, 0x65, 0xe6, 0x95, 0x95, 0x2c, 0x91, 0x10, 0xfc, 0x37,
+	0x50, 0x4f, 0xcc, 0xeb, 0x68, 0x35, 0x75, 0xe1, 0x64, 0x3a, 0x3f, 0xce, 0x90, 0x08, 0x91, 0x71,
+	0x6c, 0x7a, 0xee, 0xc6, 0x3e, 0x67, 0xdf, 0x90, 0x0a, 0x11, 0x99, 0x58, 0x7f, 0x9c, 0x88, 0x4c,
+	0x5a, 0x93, 0x2f, 0x2b, 0x59, 0x22, 0x01, 0x78, 0xfb, 0x4f, 0xb9, 0xa8, 0x6c, 0x1d, 0x60, 0x07,
+	0x75, 0xa1, 0x12, 0x5a, 0x82, 0x1e, 0xc5, 0x20, 0x92, 0xdd, 0x8b, 0xfc, 0xc1, 0x2c, 0x76, 0x68,
+	0x7a, 0x17, 0x2a, 0x5a, 0x1a, 0x9a, 0x96, 0x8d, 0xa6, 0xa5, 0xa3, 0x89, 0x40, 0xc4, 0xae, 0xe3,
+	0x44, 0x20, 0xd2, 0xba, 0x08, 0x59, 0xc9, 0x12, 0x09, 0x03, 0xf1, 0x77, 0x09, 0x6a, 0xe1, 0xad,
+	0x61, 0x0c, 0x4d, 0x0b, 0x75, 0x00, 0xa2, 0xeb, 0x16, 0xad, 0x4c, 0x1d, 0x99, 0xe8, 0x1e, 0x94,
+	0x1f, 0xa6, 0x33, 0x43, 0xcb, 0x3b, 0x00, 0x5a, 0x2a, 0x94, 0x96, 0x05, 0xa5, 0xa5, 0x40, 0x6d,
+	0x9f, 0xc0, 0x83, 0x9e, 0x3d, 0x5c, 0x17, 0x7f, 0x9f, 0xd6, 0xe3, 0x3f, 0x9d, 0xb6, 0x1b, 0x13,
+	0xf7, 0xde, 0x31, 0xa3, 0x1c, 0x4b, 0x5f, 0x3c, 0x99, 0xfd, 0xcf, 0xea, 0xe7, 0xc1, 0xc3, 0x69,
+	0x91, 0xaf, 0xff, 0xe4, 0x7f, 0x03, 0x00, 0xc2, 0x75, 0xb2, 0x23, 0x1a, 0x1b, 0x00, 0x00,
 }
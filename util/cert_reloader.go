@@ -0,0 +1,141 @@
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"expvar"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// CertReloader holds a TLS server certificate loaded from a pair of PEM files and reloads
+// it when the files change, so certificates can be rotated (e.g. by an ACME client such as
+// certbot renewing them in place) without restarting long running servers. Use its
+// GetCertificate method in a tls.Config.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+
+	vars       *expvar.Map
+	reloadVar  *expvar.Int
+	failureVar *expvar.Int
+	expiryVar  *expvar.Int
+}
+
+// NewCertReloader creates a CertReloader for the given certificate and key files. It fails
+// if the initial load fails, as a server can't usefully start without a certificate.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile:   certFile,
+		keyFile:    keyFile,
+		vars:       new(expvar.Map).Init(),
+		reloadVar:  new(expvar.Int),
+		failureVar: new(expvar.Int),
+		expiryVar:  new(expvar.Int),
+	}
+	r.vars.Set("cert-reloads", r.reloadVar)
+	r.vars.Set("cert-reload-failures", r.failureVar)
+	r.vars.Set("cert-expiry-unix", r.expiryVar)
+
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate. It has the signature required by
+// tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// Vars returns the exported stats for the reloader. They must be published by the caller
+// for them to be visible.
+func (r *CertReloader) Vars() *expvar.Map {
+	return r.vars
+}
+
+// Reload loads the certificate again if either file has been modified since it was last
+// loaded, and returns true if it was. If loading fails the current certificate continues
+// to be used, so a half written pair of files doesn't take down the server; it will be
+// tried again on the next call.
+func (r *CertReloader) Reload() (bool, error) {
+	certMod, err := modTime(r.certFile)
+	if err != nil {
+		r.failureVar.Add(1)
+		return false, err
+	}
+	keyMod, err := modTime(r.keyFile)
+	if err != nil {
+		r.failureVar.Add(1)
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		r.failureVar.Add(1)
+		return false, fmt.Errorf("failed to load TLS key pair from %s, %s: %v", r.certFile, r.keyFile, err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		r.failureVar.Add(1)
+		return false, fmt.Errorf("failed to parse TLS certificate in %s: %v", r.certFile, err)
+	}
+	cert.Leaf = leaf
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+	r.mu.Unlock()
+
+	r.reloadVar.Add(1)
+	r.expiryVar.Set(leaf.NotAfter.Unix())
+	glog.Infof("Loaded TLS certificate for %v from %s, expires %v", leaf.Subject.CommonName, r.certFile, leaf.NotAfter)
+	return true, nil
+}
+
+// Run checks for changes to the certificate files every interval until ctx is done.
+func (r *CertReloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Reload(); err != nil {
+				glog.Warningf("Failed to reload TLS certificate, still using the previous one: %v", err)
+			}
+		}
+	}
+}
+
+func modTime(path string) (time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
@@ -0,0 +1,105 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestKeyPair writes a self signed certificate for name and its key to the files,
+// setting their modification time to mod.
+func writeTestKeyPair(t *testing.T, certFile, keyFile, name string, mod time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey()=%v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate()=%v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey()=%v", err)
+	}
+	for _, f := range []struct {
+		path string
+		b    *pem.Block
+	}{{certFile, &pem.Block{Type: "CERTIFICATE", Bytes: der}}, {keyFile, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}}} {
+		if err := ioutil.WriteFile(f.path, pem.EncodeToMemory(f.b), 0600); err != nil {
+			t.Fatalf("WriteFile(%s)=%v", f.path, err)
+		}
+		if err := os.Chtimes(f.path, mod, mod); err != nil {
+			t.Fatalf("Chtimes(%s)=%v", f.path, err)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cert_reloader")
+	if err != nil {
+		t.Fatalf("TempDir()=%v", err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	if _, err := NewCertReloader(certFile, keyFile); err == nil {
+		t.Error("NewCertReloader() with missing files=nil, want error")
+	}
+
+	mod := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+	writeTestKeyPair(t, certFile, keyFile, "first", mod)
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertReloader()=%v", err)
+	}
+
+	var tests = []struct {
+		descr      string
+		update     func()
+		wantReload bool
+		wantErr    bool
+		wantName   string
+	}{
+		{descr: "unchanged", update: func() {}, wantName: "first"},
+		{descr: "rotated", update: func() { writeTestKeyPair(t, certFile, keyFile, "second", mod.Add(time.Hour)) }, wantReload: true, wantName: "second"},
+		{descr: "corrupt", update: func() {
+			ioutil.WriteFile(keyFile, []byte("not a key"), 0600)
+		}, wantErr: true, wantName: "second"},
+		{descr: "missing", update: func() { os.Remove(certFile) }, wantErr: true, wantName: "second"},
+		{descr: "fixed", update: func() { writeTestKeyPair(t, certFile, keyFile, "third", mod.Add(2*time.Hour)) }, wantReload: true, wantName: "third"},
+	}
+
+	for _, test := range tests {
+		test.update()
+		reloaded, err := r.Reload()
+		if reloaded != test.wantReload || (err != nil) != test.wantErr {
+			t.Errorf("Reload(%s)=%v, %v, want %v, err: %v", test.descr, reloaded, err, test.wantReload, test.wantErr)
+		}
+		cert, err := r.GetCertificate(nil)
+		if err != nil {
+			t.Fatalf("GetCertificate(%s)=%v", test.descr, err)
+		}
+		if got := cert.Leaf.Subject.CommonName; got != test.wantName {
+			t.Errorf("GetCertificate(%s).CommonName=%s, want %s", test.descr, got, test.wantName)
+		}
+	}
+
+	if got, want := r.Vars().Get("cert-reload-failures").String(), "2"; got != want {
+		t.Errorf("cert-reload-failures=%s, want %s", got, want)
+	}
+}
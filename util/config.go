@@ -0,0 +1,161 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// ApplyConfig sets the flags in fs that weren't given on the command line from the
+// environment and from a config file, so that a server's settings can be kept, reviewed
+// and versioned together rather than as a long command line.
+//
+// A flag named like "batch_size" is read from the environment variable envPrefix plus its
+// name in upper case with non alphanumeric characters replaced by underscores, e.g.
+// TRILLIAN_BATCH_SIZE. The config file is named by the flag configFlag, which may itself
+// be set from the environment, and holds a JSON object mapping flag names to values, e.g.
+//
+//	{
+//	  "storage": {"storage_type": "mysql", "mysql_uri": "trillian@tcp(db:3306)/trillian"},
+//	  "sequencer": {"batch_size": 500, "sequencer_sleep_between_runs": "1s"}
+//	}
+//
+// Nested objects only group settings, and their keys are flag names too. Values must have
+// the JSON type of the flag: numbers for numeric flags, true or false for bool flags and
+// strings for everything else, including durations. Unknown names are an error, so that
+// mistyped settings aren't silently ignored.
+//
+// Command line flags override the environment, which overrides the config file.
+func ApplyConfig(fs *flag.FlagSet, configFlag, envPrefix string, getenv func(string) string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] {
+			return
+		}
+		env := envName(envPrefix, f.Name)
+		v := getenv(env)
+		if len(v) == 0 {
+			return
+		}
+		if setErr := fs.Set(f.Name, v); setErr != nil {
+			err = fmt.Errorf("invalid %s: %v", env, setErr)
+			return
+		}
+		glog.V(1).Infof("Flag %s set from %s", f.Name, env)
+		set[f.Name] = true
+	})
+	if err != nil {
+		return err
+	}
+
+	cf := fs.Lookup(configFlag)
+	if cf == nil {
+		return fmt.Errorf("no config flag %q", configFlag)
+	}
+	path := cf.Value.String()
+	if len(path) == 0 {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if err := applySettings(fs, configFlag, settings, set); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// envName returns the environment variable that flag name is read from.
+func envName(prefix, name string) string {
+	return prefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// applySettings sets the flags in settings, descending into groups of settings, except
+// those already set.
+func applySettings(fs *flag.FlagSet, configFlag string, settings map[string]json.RawMessage, set map[string]bool) error {
+	for name, raw := range settings {
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+			var group map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &group); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			if err := applySettings(fs, configFlag, group, set); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f := fs.Lookup(name)
+		if f == nil || name == configFlag {
+			return fmt.Errorf("unknown setting %q", name)
+		}
+		v, err := settingValue(f, raw)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if set[name] {
+			glog.V(1).Infof("Flag %s is set, ignoring config file value", name)
+			continue
+		}
+		if err := fs.Set(name, v); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// settingValue checks raw has the JSON type for the flag f and returns it in the form
+// taken by f.Value.Set.
+func settingValue(f *flag.Flag, raw json.RawMessage) (string, error) {
+	var want interface{}
+	if g, ok := f.Value.(flag.Getter); ok {
+		want = g.Get()
+	}
+	switch want.(type) {
+	case bool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return "", fmt.Errorf("want true or false, got %s", raw)
+		}
+		return fmt.Sprint(b), nil
+	case int, int64, uint, uint64, float64:
+		var n json.Number
+		if err := json.Unmarshal(raw, &n); err != nil || bytes.HasPrefix(raw, []byte(`"`)) {
+			return "", fmt.Errorf("want a number, got %s", raw)
+		}
+		return n.String(), nil
+	case time.Duration:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", fmt.Errorf("want a duration such as \"10s\", got %s", raw)
+		}
+		return s, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", fmt.Errorf("want a string, got %s", raw)
+	}
+	return s, nil
+}
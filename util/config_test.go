@@ -0,0 +1,186 @@
+package util
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type configFlags struct {
+	fs        *flag.FlagSet
+	config    *string
+	batchSize *int
+	interval  *time.Duration
+	storage   *string
+	acls      *bool
+	fraction  *float64
+}
+
+func newConfigFlags() configFlags {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return configFlags{
+		fs:        fs,
+		config:    fs.String("config", "", ""),
+		batchSize: fs.Int("batch_size", 50, ""),
+		interval:  fs.Duration("signer_interval", time.Minute, ""),
+		storage:   fs.String("storage_type", "mysql", ""),
+		acls:      fs.Bool("tree_acls", false, ""),
+		fraction:  fs.Float64("tree_size_warn_fraction", 0.9, ""),
+	}
+}
+
+func writeConfig(t *testing.T, dir, contents string) string {
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestApplyConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var tests = []struct {
+		descr         string
+		config        string
+		args          []string
+		env           map[string]string
+		wantBatchSize int
+		wantInterval  time.Duration
+		wantStorage   string
+		wantACLs      bool
+		wantFraction  float64
+		wantErr       bool
+	}{
+		{
+			descr:         "no-config",
+			wantBatchSize: 50,
+			wantInterval:  time.Minute,
+			wantStorage:   "mysql",
+			wantFraction:  0.9,
+		},
+		{
+			descr:         "config",
+			config:        `{"batch_size": 500, "signer_interval": "10s", "storage_type": "memory", "tree_acls": true, "tree_size_warn_fraction": 0.5}`,
+			wantBatchSize: 500,
+			wantInterval:  10 * time.Second,
+			wantStorage:   "memory",
+			wantACLs:      true,
+			wantFraction:  0.5,
+		},
+		{
+			descr:         "grouped",
+			config:        `{"sequencer": {"batch_size": 500, "signer_interval": "10s"}, "storage": {"storage_type": "memory"}}`,
+			wantBatchSize: 500,
+			wantInterval:  10 * time.Second,
+			wantStorage:   "memory",
+			wantFraction:  0.9,
+		},
+		{
+			descr:         "flags-override",
+			config:        `{"batch_size": 500, "storage_type": "memory"}`,
+			args:          []string{"--batch_size=5"},
+			env:           map[string]string{"TEST_BATCH_SIZE": "7"},
+			wantBatchSize: 5,
+			wantInterval:  time.Minute,
+			wantStorage:   "memory",
+			wantFraction:  0.9,
+		},
+		{
+			descr:         "env-overrides",
+			config:        `{"batch_size": 500, "storage_type": "memory"}`,
+			env:           map[string]string{"TEST_BATCH_SIZE": "7", "TEST_SIGNER_INTERVAL": "1h"},
+			wantBatchSize: 7,
+			wantInterval:  time.Hour,
+			wantStorage:   "memory",
+			wantFraction:  0.9,
+		},
+		{descr: "unknown", config: `{"batch_sise": 500}`, wantErr: true},
+		{descr: "unknown-in-group", config: `{"sequencer": {"batch_sise": 500}}`, wantErr: true},
+		{descr: "config-in-config", config: `{"config": "other.json"}`, wantErr: true},
+		{descr: "string-for-number", config: `{"batch_size": "500"}`, wantErr: true},
+		{descr: "number-for-duration", config: `{"signer_interval": 10}`, wantErr: true},
+		{descr: "string-for-bool", config: `{"tree_acls": "true"}`, wantErr: true},
+		{descr: "number-for-string", config: `{"storage_type": 1}`, wantErr: true},
+		{descr: "bad-duration", config: `{"signer_interval": "soon"}`, wantErr: true},
+		{descr: "not-json", config: `batch_size: 500`, wantErr: true},
+		{descr: "bad-env", env: map[string]string{"TEST_BATCH_SIZE": "lots"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		f := newConfigFlags()
+		args := test.args
+		if len(test.config) > 0 {
+			args = append(args, "--config="+writeConfig(t, dir, test.config))
+		}
+		if err := f.fs.Parse(args); err != nil {
+			t.Fatalf("%s: failed to parse flags: %v", test.descr, err)
+		}
+		getenv := func(name string) string { return test.env[name] }
+
+		err := ApplyConfig(f.fs, "config", "TEST_", getenv)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: ApplyConfig()=%v, want error: %v", test.descr, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got, want := *f.batchSize, test.wantBatchSize; got != want {
+			t.Errorf("%s: batch_size=%d, want %d", test.descr, got, want)
+		}
+		if got, want := *f.interval, test.wantInterval; got != want {
+			t.Errorf("%s: signer_interval=%v, want %v", test.descr, got, want)
+		}
+		if got, want := *f.storage, test.wantStorage; got != want {
+			t.Errorf("%s: storage_type=%q, want %q", test.descr, got, want)
+		}
+		if got, want := *f.acls, test.wantACLs; got != want {
+			t.Errorf("%s: tree_acls=%v, want %v", test.descr, got, want)
+		}
+		if got, want := *f.fraction, test.wantFraction; got != want {
+			t.Errorf("%s: tree_size_warn_fraction=%v, want %v", test.descr, got, want)
+		}
+	}
+}
+
+func TestApplyConfigFromEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := newConfigFlags()
+	env := map[string]string{"TEST_CONFIG": writeConfig(t, dir, `{"batch_size": 500}`)}
+	if err := ApplyConfig(f.fs, "config", "TEST_", func(name string) string { return env[name] }); err != nil {
+		t.Fatalf("ApplyConfig()=%v", err)
+	}
+	if got, want := *f.batchSize, 500; got != want {
+		t.Errorf("batch_size=%d, want %d", got, want)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	var tests = []struct {
+		name, want string
+	}{
+		{name: "batch_size", want: "TRILLIAN_BATCH_SIZE"},
+		{name: "exportMetrics", want: "TRILLIAN_EXPORTMETRICS"},
+		{name: "log.dir", want: "TRILLIAN_LOG_DIR"},
+	}
+
+	for _, test := range tests {
+		if got := envName("TRILLIAN_", test.name); got != test.want {
+			t.Errorf("envName(%q)=%q, want %q", test.name, got, test.want)
+		}
+	}
+}
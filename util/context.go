@@ -14,6 +14,9 @@ const (
 
 	// mapIDKey is the key used when storing a MapID in a context.Context.
 	mapIDKey contextKey = iota
+
+	// requestIDKey is the key used when storing a request ID in a context.Context.
+	requestIDKey contextKey = iota
 )
 
 // NewLogContext returns a new context instance that is scoped to a particular Log.
@@ -21,27 +24,33 @@ func NewLogContext(ctx context.Context, logID int64) context.Context {
 	return context.WithValue(ctx, logIDKey, logID)
 }
 
+// LogIDFromContext returns the ID of the log associated with ctx, if any.
+func LogIDFromContext(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(logIDKey).(int64)
+	return id, ok
+}
+
 // NewMapContext returns a new context instance that is scoped to a particular Map.
 func NewMapContext(ctx context.Context, mapID int64) context.Context {
 	return context.WithValue(ctx, mapIDKey, mapID)
 }
 
 // LogIDPrefix returns an identifier for the log associated with ctx in a form
-// suitable for use as a diagnostic prefix.
+// suitable for use as a diagnostic prefix. It includes the request ID, if any.
 func LogIDPrefix(ctx context.Context) string {
 	v, ok := ctx.Value(logIDKey).(int64)
 	if !ok {
-		return "{unknown}"
+		return "{unknown}" + requestIDSuffix(ctx)
 	}
-	return fmt.Sprintf("{%d}", v)
+	return fmt.Sprintf("{%d}%s", v, requestIDSuffix(ctx))
 }
 
 // MapIDPrefix returns an identifier for the log associated with ctx in a form
-// suitable for use as a diagnostic prefix.
+// suitable for use as a diagnostic prefix. It includes the request ID, if any.
 func MapIDPrefix(ctx context.Context) string {
 	v, ok := ctx.Value(mapIDKey).(int64)
 	if !ok {
-		return "{unknown}"
+		return "{unknown}" + requestIDSuffix(ctx)
 	}
-	return fmt.Sprintf("{%d}", v)
+	return fmt.Sprintf("{%d}%s", v, requestIDSuffix(ctx))
 }
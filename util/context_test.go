@@ -41,3 +41,12 @@ func TestMapContext(t *testing.T) {
 		}
 	}
 }
+
+func TestLogIDFromContext(t *testing.T) {
+	if id, ok := LogIDFromContext(context.Background()); ok {
+		t.Errorf("LogIDFromContext(background)=%d, want none", id)
+	}
+	if got, ok := LogIDFromContext(NewLogContext(context.Background(), 3)); !ok || got != 3 {
+		t.Errorf("LogIDFromContext()=%d,%v, want 3,true", got, ok)
+	}
+}
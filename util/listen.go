@@ -0,0 +1,95 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// UnixSocketPrefix marks a listen address as the path of a unix domain socket.
+const UnixSocketPrefix = "unix:"
+
+// ListenAddr is an address for a server to listen on.
+type ListenAddr struct {
+	// Network is "tcp", "tcp4", "tcp6" or "unix".
+	Network string
+	// Address is a host:port pair, or the path of a unix domain socket.
+	Address string
+}
+
+func (a ListenAddr) String() string {
+	if a.Network == "unix" {
+		return UnixSocketPrefix + a.Address
+	}
+	return a.Address
+}
+
+// ParseListenAddrs parses a comma separated list of addresses to listen on. Each is a
+// host:port pair or, after UnixSocketPrefix, the path of a unix domain socket. Hosts that
+// are IP addresses are listened on with only that IP version, so a server can listen on
+// both 0.0.0.0:port and [::]:port.
+func ParseListenAddrs(s string) ([]ListenAddr, error) {
+	var addrs []ListenAddr
+	for _, addr := range strings.Split(s, ",") {
+		addr = strings.TrimSpace(addr)
+		if len(addr) == 0 {
+			continue
+		}
+		if strings.HasPrefix(addr, UnixSocketPrefix) {
+			path := strings.TrimPrefix(addr, UnixSocketPrefix)
+			if len(path) == 0 {
+				return nil, fmt.Errorf("invalid listen address %q: no socket path", addr)
+			}
+			addrs = append(addrs, ListenAddr{Network: "unix", Address: path})
+			continue
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen address %q: %v", addr, err)
+		}
+		network := "tcp"
+		if ip := net.ParseIP(host); ip != nil {
+			if ip.To4() != nil {
+				network = "tcp4"
+			} else {
+				network = "tcp6"
+			}
+		}
+		addrs = append(addrs, ListenAddr{Network: network, Address: addr})
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no listen addresses in %q", s)
+	}
+	return addrs, nil
+}
+
+// Listen listens on all of addrs, closing any listeners already opened if one of them
+// fails. A socket file left at the path of a unix domain socket, e.g. by a server that
+// crashed, is removed first; other kinds of file are left alone.
+func Listen(addrs []ListenAddr) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, addr := range addrs {
+		if addr.Network == "unix" {
+			if info, err := os.Lstat(addr.Address); err == nil && info.Mode()&os.ModeSocket != 0 {
+				if err := os.Remove(addr.Address); err != nil {
+					closeListeners(listeners)
+					return nil, fmt.Errorf("failed to remove old socket %s: %v", addr.Address, err)
+				}
+			}
+		}
+		l, err := net.Listen(addr.Network, addr.Address)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
@@ -0,0 +1,94 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseListenAddrs(t *testing.T) {
+	var tests = []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "localhost:6962", want: "tcp/localhost:6962 "},
+		{in: "0.0.0.0:6962,[::]:6962", want: "tcp4/0.0.0.0:6962 tcp6/[::]:6962 "},
+		{in: " 127.0.0.1:80 , ,unix:/run/ct.sock", want: "tcp4/127.0.0.1:80 unix/unix:/run/ct.sock "},
+		{in: ":6962", want: "tcp/:6962 "},
+		{in: "", wantErr: true},
+		{in: ",", wantErr: true},
+		{in: "localhost", wantErr: true},
+		{in: "[::1]", wantErr: true},
+		{in: "unix:", wantErr: true},
+	}
+
+	for _, test := range tests {
+		addrs, err := ParseListenAddrs(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseListenAddrs(%q)=%v, want error: %v", test.in, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var got string
+		for _, addr := range addrs {
+			got += fmt.Sprintf("%s/%s ", addr.Network, addr)
+		}
+		if got != test.want {
+			t.Errorf("ParseListenAddrs(%q)=%q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listen")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "ct.sock")
+
+	// Leave a socket file behind, as a server that crashed would.
+	old, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", socket, err)
+	}
+	old.(*net.UnixListener).SetUnlinkOnClose(false)
+	old.Close()
+
+	addrs := []ListenAddr{{Network: "tcp4", Address: "127.0.0.1:0"}, {Network: "unix", Address: socket}}
+	listeners, err := Listen(addrs)
+	if err != nil {
+		t.Fatalf("Listen(%v)=_,%v, want no error", addrs, err)
+	}
+	defer closeListeners(listeners)
+	if got, want := len(listeners), len(addrs); got != want {
+		t.Fatalf("Listen(%v) returned %d listeners, want %d", addrs, got, want)
+	}
+	for _, l := range listeners {
+		c, err := net.Dial(l.Addr().Network(), l.Addr().String())
+		if err != nil {
+			t.Errorf("Dial(%v)=_,%v, want no error", l.Addr(), err)
+			continue
+		}
+		c.Close()
+	}
+
+	// Files that aren't sockets aren't removed, and no listeners are left open on failure.
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", file, err)
+	}
+	addrs = []ListenAddr{{Network: "tcp4", Address: "127.0.0.1:0"}, {Network: "unix", Address: file}}
+	if _, err := Listen(addrs); err == nil {
+		t.Errorf("Listen(%v)=_,nil, want error", addrs)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("Stat(%s)=_,%v, want no error", file, err)
+	}
+}
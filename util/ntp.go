@@ -0,0 +1,106 @@
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ClockOffsetSource measures the error of the local clock against a trusted reference,
+// e.g. an NTP or Roughtime server.
+type ClockOffsetSource interface {
+	// ClockOffset returns how far the local clock is behind the reference time, i.e.
+	// the value that should be added to the local time to correct it.
+	ClockOffset() (time.Duration, error)
+}
+
+const (
+	ntpPacketSize = 48
+	// Seconds between the NTP epoch (1900) and the Unix epoch (1970)
+	ntpEpochOffset = 2208988800
+	// LI = 0 (no warning), VN = 4, Mode = 3 (client)
+	ntpClientHeader = 0<<6 | 4<<3 | 3
+	ntpModeServer   = 4
+)
+
+var errNTPKissOfDeath = errors.New("ntp server sent kiss of death")
+
+// NTPOffsetSource measures the local clock offset by querying an NTP server using the
+// SNTP protocol (RFC 4330).
+type NTPOffsetSource struct {
+	// Server is the host:port of the NTP server to query.
+	Server string
+	// Timeout bounds each query.
+	Timeout time.Duration
+}
+
+// NewNTPOffsetSource creates an NTPOffsetSource for server, which can be a host name or
+// host:port. The standard NTP port is used if none is given.
+func NewNTPOffsetSource(server string, timeout time.Duration) *NTPOffsetSource {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	return &NTPOffsetSource{Server: server, Timeout: timeout}
+}
+
+// ClockOffset queries the NTP server and returns the offset of the local clock.
+func (n *NTPOffsetSource) ClockOffset() (time.Duration, error) {
+	conn, err := net.Dial("udp", n.Server)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(n.Timeout)); err != nil {
+		return 0, err
+	}
+
+	req := make([]byte, ntpPacketSize)
+	req[0] = ntpClientHeader
+	sent := time.Now()
+	// The server copies our transmit timestamp into its originate timestamp, which lets
+	// us match the response to this request.
+	putNTPTime(req[40:], sent)
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+
+	rsp := make([]byte, ntpPacketSize)
+	count, err := conn.Read(rsp)
+	received := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	if count < ntpPacketSize {
+		return 0, fmt.Errorf("short ntp response: %d bytes", count)
+	}
+	if mode := rsp[0] & 0x7; mode != ntpModeServer {
+		return 0, fmt.Errorf("unexpected ntp response mode: %d", mode)
+	}
+	if stratum := rsp[1]; stratum == 0 {
+		return 0, errNTPKissOfDeath
+	}
+	if binary.BigEndian.Uint64(rsp[24:]) != binary.BigEndian.Uint64(req[40:]) {
+		return 0, errors.New("ntp response does not match request")
+	}
+
+	serverReceived := getNTPTime(rsp[32:])
+	serverSent := getNTPTime(rsp[40:])
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+// putNTPTime writes t into b as a 64 bit NTP timestamp.
+func putNTPTime(b []byte, t time.Time) {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	binary.BigEndian.PutUint64(b, secs<<32|frac)
+}
+
+// getNTPTime reads a 64 bit NTP timestamp from b.
+func getNTPTime(b []byte) time.Time {
+	ts := binary.BigEndian.Uint64(b)
+	secs := int64(ts>>32) - ntpEpochOffset
+	nanos := int64((ts & 0xffffffff) * uint64(time.Second) >> 32)
+	return time.Unix(secs, nanos)
+}
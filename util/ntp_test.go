@@ -0,0 +1,80 @@
+package util
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// serveNTP answers a single SNTP request with a clock that is offset from the local one.
+func serveNTP(t *testing.T, conn net.PacketConn, offset time.Duration, stratum byte) {
+	req := make([]byte, ntpPacketSize)
+	_, addr, err := conn.ReadFrom(req)
+	if err != nil {
+		t.Errorf("ReadFrom()=%v", err)
+		return
+	}
+
+	rsp := make([]byte, ntpPacketSize)
+	rsp[0] = 4<<3 | ntpModeServer
+	rsp[1] = stratum
+	copy(rsp[24:32], req[40:48])
+	putNTPTime(rsp[32:], time.Now().Add(offset))
+	putNTPTime(rsp[40:], time.Now().Add(offset))
+	if _, err := conn.WriteTo(rsp, addr); err != nil {
+		t.Errorf("WriteTo()=%v", err)
+	}
+}
+
+func TestNTPClockOffset(t *testing.T) {
+	var tests = []struct {
+		offset  time.Duration
+		stratum byte
+		wantErr bool
+	}{
+		{offset: 0, stratum: 1},
+		{offset: time.Hour, stratum: 2},
+		{offset: -time.Minute * 5, stratum: 2},
+		{offset: 0, stratum: 0, wantErr: true},
+	}
+
+	for _, test := range tests {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("ListenPacket()=%v", err)
+		}
+		go serveNTP(t, conn, test.offset, test.stratum)
+
+		source := NewNTPOffsetSource(conn.LocalAddr().String(), time.Second*5)
+		got, err := source.ClockOffset()
+		conn.Close()
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ClockOffset(stratum=%d)=%v, want error", test.stratum, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ClockOffset(%v)=%v", test.offset, err)
+			continue
+		}
+		if diff := got - test.offset; diff > time.Millisecond*100 || diff < -time.Millisecond*100 {
+			t.Errorf("ClockOffset()=%v, want %v", got, test.offset)
+		}
+	}
+}
+
+func TestNTPTimeRoundTrip(t *testing.T) {
+	want := time.Date(2016, 10, 1, 12, 34, 56, 789000000, time.UTC)
+	b := make([]byte, 8)
+	putNTPTime(b, want)
+	if got := getNTPTime(b); got.Sub(want) > time.Microsecond || want.Sub(got) > time.Microsecond {
+		t.Errorf("getNTPTime(putNTPTime(%v))=%v", want, got)
+	}
+}
+
+func TestNewNTPOffsetSourceDefaultPort(t *testing.T) {
+	if got, want := NewNTPOffsetSource("pool.ntp.org", time.Second).Server, "pool.ntp.org:123"; got != want {
+		t.Errorf("NewNTPOffsetSource().Server=%s, want %s", got, want)
+	}
+}
@@ -0,0 +1,107 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// RequestIDHeader is the HTTP header used to pass in and return request IDs.
+	RequestIDHeader = "X-Request-ID"
+	// requestIDMetadataKey is the gRPC metadata key that request IDs are sent under.
+	requestIDMetadataKey = "x-request-id"
+	// maxRequestIDLen bounds the size of request IDs accepted from clients.
+	maxRequestIDLen = 128
+)
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		glog.Warningf("Failed to generate random request ID: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ValidRequestID returns true if id can be used as a request ID. IDs supplied by clients
+// end up in logs and headers, so only short strings of printable ASCII are allowed.
+func ValidRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewRequestIDContext returns a new context instance that carries a request ID. The ID is
+// included in the diagnostic prefixes for the context and sent to the backend by RPCs
+// made through a RequestIDClientInterceptor.
+func NewRequestIDContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the request ID associated with ctx, if any.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey).(string)
+	return id, ok
+}
+
+// requestIDSuffix returns a diagnostic suffix for the request ID associated with ctx, if
+// there is one.
+func requestIDSuffix(ctx context.Context) string {
+	if id, ok := RequestIDFromContext(ctx); ok {
+		return "[" + id + "]"
+	}
+	return ""
+}
+
+// RequestIDClientInterceptor returns a UnaryClientInterceptor that sends the request ID
+// held in the context of each RPC to the server as metadata.
+func RequestIDClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if id, ok := RequestIDFromContext(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, requestIDMetadataKey, id)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// RequestIDServerInterceptor returns a UnaryServerInterceptor that adds the request ID
+// sent by the client, if any, to the context of each RPC. Failed RPCs are logged with
+// their request ID so they can be matched with the client's logs.
+func RequestIDServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		id, ok := requestIDFromMetadata(ctx)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		ctx = NewRequestIDContext(ctx, id)
+		rsp, err := handler(ctx, req)
+		if err != nil {
+			glog.Warningf("[%s]: %s failed: %v", id, info.FullMethod, err)
+		}
+		return rsp, err
+	}
+}
+
+func requestIDFromMetadata(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	ids := md[requestIDMetadataKey]
+	if len(ids) == 0 || !ValidRequestID(ids[0]) {
+		return "", false
+	}
+	return ids[0], true
+}
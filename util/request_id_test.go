@@ -0,0 +1,99 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestValidRequestID(t *testing.T) {
+	var tests = []struct {
+		id   string
+		want bool
+	}{
+		{"", false},
+		{"abc-123", true},
+		{NewRequestID(), true},
+		{"has space", false},
+		{"new\nline", false},
+		{"caf\xc3\xa9", false},
+		{strings.Repeat("a", maxRequestIDLen), true},
+		{strings.Repeat("a", maxRequestIDLen+1), false},
+	}
+	for _, test := range tests {
+		if got := ValidRequestID(test.id); got != test.want {
+			t.Errorf("ValidRequestID(%q)=%v; want %v", test.id, got, test.want)
+		}
+	}
+}
+
+func TestRequestIDPrefix(t *testing.T) {
+	ctx := NewRequestIDContext(NewLogContext(context.Background(), 3), "req1")
+	if got, want := LogIDPrefix(ctx), "{3}[req1]"; got != want {
+		t.Errorf("LogIDPrefix(ctx)=%q; want %q", got, want)
+	}
+	if got, want := MapIDPrefix(ctx), "{unknown}[req1]"; got != want {
+		t.Errorf("MapIDPrefix(ctx)=%q; want %q", got, want)
+	}
+}
+
+func TestRequestIDClientInterceptor(t *testing.T) {
+	var tests = []struct {
+		id     string
+		wantMD []string
+	}{
+		{id: "", wantMD: nil},
+		{id: "req1", wantMD: []string{"req1"}},
+	}
+
+	for _, test := range tests {
+		ctx := context.Background()
+		if len(test.id) > 0 {
+			ctx = NewRequestIDContext(ctx, test.id)
+		}
+		var gotMD []string
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			gotMD = md[requestIDMetadataKey]
+			return nil
+		}
+		if err := RequestIDClientInterceptor()(ctx, "/method", nil, nil, nil, invoker); err != nil {
+			t.Errorf("interceptor(%q)=%v", test.id, err)
+		}
+		if len(gotMD) != len(test.wantMD) || (len(gotMD) > 0 && gotMD[0] != test.wantMD[0]) {
+			t.Errorf("interceptor(%q) sent metadata %v; want %v", test.id, gotMD, test.wantMD)
+		}
+	}
+}
+
+func TestRequestIDServerInterceptor(t *testing.T) {
+	var tests = []struct {
+		md     metadata.MD
+		wantID string
+	}{
+		{md: nil},
+		{md: metadata.Pairs(requestIDMetadataKey, "req1"), wantID: "req1"},
+		{md: metadata.Pairs(requestIDMetadataKey, "bad id"), wantID: ""},
+	}
+
+	for _, test := range tests {
+		ctx := context.Background()
+		if test.md != nil {
+			ctx = metadata.NewIncomingContext(ctx, test.md)
+		}
+		var gotID string
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			gotID, _ = RequestIDFromContext(ctx)
+			return nil, nil
+		}
+		if _, err := RequestIDServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/method"}, handler); err != nil {
+			t.Errorf("interceptor(%v)=%v", test.md, err)
+		}
+		if gotID != test.wantID {
+			t.Errorf("interceptor(%v) set request ID %q; want %q", test.md, gotID, test.wantID)
+		}
+	}
+}
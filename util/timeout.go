@@ -0,0 +1,84 @@
+package util
+
+import (
+	"expvar"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ServerTimeouts holds the maximum time the server will spend processing each RPC, which
+// applies whatever deadline the client set, including none at all.
+type ServerTimeouts struct {
+	// Default applies to methods not listed in Methods. Zero means no limit.
+	Default time.Duration
+	// Methods holds limits for particular methods, keyed by the method name without the
+	// service, e.g. "GetLeavesByIndex".
+	Methods map[string]time.Duration
+}
+
+// ParseServerTimeouts parses a comma separated list of method:duration pairs, e.g.
+// "GetLeavesByIndex:30s,QueueLeaves:5s", into a ServerTimeouts with default timeout def.
+func ParseServerTimeouts(def time.Duration, s string) (ServerTimeouts, error) {
+	t := ServerTimeouts{Default: def, Methods: make(map[string]time.Duration)}
+	if len(s) == 0 {
+		return t, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return ServerTimeouts{}, fmt.Errorf("invalid method timeout: %q", pair)
+		}
+		d, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return ServerTimeouts{}, fmt.Errorf("invalid timeout for %s: %v", parts[0], err)
+		}
+		if d <= 0 {
+			return ServerTimeouts{}, fmt.Errorf("timeout for %s must be positive, got %v", parts[0], d)
+		}
+		t.Methods[parts[0]] = d
+	}
+	return t, nil
+}
+
+// timeoutFor returns the limit for fullMethod, which is of the form "/service/method".
+func (t ServerTimeouts) timeoutFor(fullMethod string) time.Duration {
+	if d, ok := t.Methods[fullMethod[strings.LastIndex(fullMethod, "/")+1:]]; ok {
+		return d
+	}
+	return t.Default
+}
+
+// TimeoutServerInterceptor returns a UnaryServerInterceptor that cancels the work done for
+// each RPC once it exceeds its limit in timeouts. RPCs cut short this way fail with a
+// DeadlineExceeded status, and are counted in timeoutVar (keyed by method) if it's not nil.
+func TimeoutServerInterceptor(timeouts ServerTimeouts, timeoutVar *expvar.Map) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		timeout := timeouts.timeoutFor(info.FullMethod)
+		if timeout <= 0 {
+			return handler(ctx, req)
+		}
+
+		// The client's own deadline still applies if it's earlier.
+		parent := ctx
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		rsp, err := handler(ctx, req)
+		if err != nil && ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+			// The work failed because our limit expired rather than the client's deadline.
+			glog.Warningf("%s%s: exceeded server timeout of %v", info.FullMethod, requestIDSuffix(ctx), timeout)
+			if timeoutVar != nil {
+				timeoutVar.Add(info.FullMethod, 1)
+			}
+			return nil, status.Errorf(codes.DeadlineExceeded, "%s exceeded server timeout of %v", info.FullMethod, timeout)
+		}
+		return rsp, err
+	}
+}
@@ -0,0 +1,99 @@
+package util
+
+import (
+	"errors"
+	"expvar"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseServerTimeouts(t *testing.T) {
+	var tests = []struct {
+		in      string
+		want    map[string]time.Duration
+		wantErr bool
+	}{
+		{in: "", want: map[string]time.Duration{}},
+		{in: "GetLeavesByIndex:30s", want: map[string]time.Duration{"GetLeavesByIndex": 30 * time.Second}},
+		{in: "GetLeavesByIndex:30s,QueueLeaves:500ms", want: map[string]time.Duration{"GetLeavesByIndex": 30 * time.Second, "QueueLeaves": 500 * time.Millisecond}},
+		{in: "GetLeavesByIndex", wantErr: true},
+		{in: ":1s", wantErr: true},
+		{in: "QueueLeaves:soon", wantErr: true},
+		{in: "QueueLeaves:-1s", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseServerTimeouts(time.Second, test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseServerTimeouts(%q)=%v, want error: %v", test.in, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got.Default != time.Second || len(got.Methods) != len(test.want) {
+			t.Errorf("ParseServerTimeouts(%q)=%+v, want %v", test.in, got, test.want)
+		}
+		for m, d := range test.want {
+			if got.Methods[m] != d {
+				t.Errorf("ParseServerTimeouts(%q)[%s]=%v, want %v", test.in, m, got.Methods[m], d)
+			}
+		}
+	}
+}
+
+func TestTimeoutServerInterceptor(t *testing.T) {
+	timeouts := ServerTimeouts{Default: time.Hour, Methods: map[string]time.Duration{"Slow": time.Millisecond}}
+
+	// waitHandler blocks until its context is done.
+	waitHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	okHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			return nil, errors.New("no deadline")
+		}
+		return "ok", nil
+	}
+
+	var tests = []struct {
+		descr    string
+		method   string
+		handler  grpc.UnaryHandler
+		clientTO time.Duration
+		wantCode codes.Code
+		wantRsp  interface{}
+	}{
+		{descr: "fast", method: "/trillian.TrillianLog/Fast", handler: okHandler, wantCode: codes.OK, wantRsp: "ok"},
+		{descr: "server-timeout", method: "/trillian.TrillianLog/Slow", handler: waitHandler, wantCode: codes.DeadlineExceeded},
+		// The client's deadline expiring first is the client's problem, not a server timeout.
+		{descr: "client-timeout", method: "/trillian.TrillianLog/Fast", handler: waitHandler, clientTO: time.Millisecond, wantCode: codes.Unknown},
+	}
+
+	for _, test := range tests {
+		vars := new(expvar.Map).Init()
+		ctx := context.Background()
+		if test.clientTO > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, test.clientTO)
+			defer cancel()
+		}
+		rsp, err := TimeoutServerInterceptor(timeouts, vars)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: test.method}, test.handler)
+		if got := status.Code(err); got != test.wantCode {
+			t.Errorf("interceptor(%s)=%v, want code %v", test.descr, err, test.wantCode)
+		}
+		if rsp != test.wantRsp {
+			t.Errorf("interceptor(%s)=%v, want %v", test.descr, rsp, test.wantRsp)
+		}
+		wantCount := test.wantCode == codes.DeadlineExceeded
+		if got := vars.Get(test.method) != nil; got != wantCount {
+			t.Errorf("interceptor(%s) counted timeout: %v, want %v", test.descr, got, wantCount)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"sync"
 	"time"
 )
 
@@ -50,3 +51,38 @@ func (a *IncrementingFakeTimeSource) Now() time.Time {
 
 	return adjustedTime
 }
+
+// ManualTimeSource is a fake time source whose time only moves when it's set or advanced,
+// so that a test can drive several components from one simulated clock. It's safe for
+// concurrent use. It should not be used in production code.
+type ManualTimeSource struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManualTimeSource creates a ManualTimeSource that starts at now.
+func NewManualTimeSource(now time.Time) *ManualTimeSource {
+	return &ManualTimeSource{now: now}
+}
+
+// Now returns the current simulated time.
+func (m *ManualTimeSource) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+// Set moves the simulated time to now, which may be in its past.
+func (m *ManualTimeSource) Set(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+// Advance moves the simulated time on by d and returns the new time.
+func (m *ManualTimeSource) Advance(d time.Duration) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = m.now.Add(d)
+	return m.now
+}
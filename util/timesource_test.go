@@ -0,0 +1,28 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualTimeSource(t *testing.T) {
+	start := time.Date(2016, 6, 28, 13, 40, 12, 0, time.UTC)
+	ts := NewManualTimeSource(start)
+	if got, want := ts.Now(), start; !got.Equal(want) {
+		t.Errorf("Now()=%v, want %v", got, want)
+	}
+	// Time doesn't pass on its own.
+	if got, want := ts.Now(), start; !got.Equal(want) {
+		t.Errorf("Now()=%v, want %v", got, want)
+	}
+	if got, want := ts.Advance(time.Minute), start.Add(time.Minute); !got.Equal(want) {
+		t.Errorf("Advance(1m)=%v, want %v", got, want)
+	}
+	if got, want := ts.Now(), start.Add(time.Minute); !got.Equal(want) {
+		t.Errorf("Now()=%v, want %v", got, want)
+	}
+	ts.Set(start)
+	if got, want := ts.Now(), start; !got.Equal(want) {
+		t.Errorf("Now() after Set()=%v, want %v", got, want)
+	}
+}
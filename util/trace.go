@@ -0,0 +1,216 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"golang.org/x/net/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// TraceParentHeader is the W3C Trace Context HTTP header that carries the trace ID and
+	// parent span of a request, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+	TraceParentHeader = "traceparent"
+	// traceParentMetadataKey is the gRPC metadata key that the header is sent under.
+	traceParentMetadataKey = "traceparent"
+
+	traceIDLen = 16
+	spanIDLen  = 8
+)
+
+type spanKeyType int
+
+const spanKey spanKeyType = 0
+
+// SpanContext identifies a span, and the trace it's part of, across processes.
+type SpanContext struct {
+	// TraceID is the 32 hex digit ID shared by all the spans of a trace.
+	TraceID string
+	// SpanID is the 16 hex digit ID of the span.
+	SpanID string
+}
+
+// ParseTraceParent parses the value of a TraceParentHeader. Only version 00 is accepted,
+// and the IDs mustn't be all zeros.
+func ParseTraceParent(h string) (SpanContext, bool) {
+	parts := strings.Split(h, "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	sc := SpanContext{TraceID: parts[1], SpanID: parts[2]}
+	if !validTraceID(sc.TraceID, traceIDLen) || !validTraceID(sc.SpanID, spanIDLen) {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// TraceParent returns sc formatted as the value of a TraceParentHeader.
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-01", sc.TraceID, sc.SpanID)
+}
+
+// validTraceID returns true if id is n bytes of lower case hex that aren't all zero.
+func validTraceID(id string, n int) bool {
+	b, err := hex.DecodeString(id)
+	if err != nil || len(b) != n || id != strings.ToLower(id) {
+		return false
+	}
+	for _, c := range b {
+		if c != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func newTraceID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		glog.Warningf("Failed to generate random trace ID: %v", err)
+		b[0] = 1
+	}
+	return hex.EncodeToString(b)
+}
+
+// Span times a unit of work done for a traced request. Spans are recorded with
+// golang.org/x/net/trace, so active and recent ones can be browsed at /debug/requests,
+// where their titles hold the trace and span IDs that link them across processes. The
+// duration of each child span is also logged in its root span, which shows where the
+// time handling a request went in one place.
+type Span struct {
+	SpanContext
+	root  *Span
+	title string
+	start time.Time
+	tr    trace.Trace
+
+	// mu guards against events being logged by child spans once the span has finished,
+	// which x/net/trace doesn't allow.
+	mu       sync.Mutex
+	finished bool
+}
+
+// NewRemoteSpanContext returns a context whose spans are children of the span sc from
+// another process, e.g. one read from a TraceParentHeader.
+func NewRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey, &Span{SpanContext: sc})
+}
+
+// SpanFromContext returns the span in progress for ctx, if any.
+func SpanFromContext(ctx context.Context) (*Span, bool) {
+	s, ok := ctx.Value(spanKey).(*Span)
+	if !ok || s.tr == nil {
+		// Spans from other processes can't be logged to.
+		return nil, false
+	}
+	return s, true
+}
+
+// StartSpan starts a span named title in family, e.g. the handler or RPC method, which
+// is a child of the span held by ctx. A new trace is started if ctx doesn't hold a span.
+// The returned context holds the new span, which must be finished with Finish.
+func StartSpan(ctx context.Context, family, title string) (context.Context, *Span) {
+	s := &Span{SpanContext: SpanContext{SpanID: newTraceID(spanIDLen)}, title: title, start: time.Now()}
+	parentID := ""
+	if parent, ok := ctx.Value(spanKey).(*Span); ok {
+		s.TraceID = parent.TraceID
+		parentID = parent.SpanID
+		s.root = parent.root
+		if s.root == nil && parent.tr != nil {
+			s.root = parent
+		}
+	} else {
+		s.TraceID = newTraceID(traceIDLen)
+	}
+	s.tr = trace.New(family, fmt.Sprintf("%s trace=%s span=%s", title, s.TraceID, s.SpanID))
+	if len(parentID) > 0 {
+		s.tr.LazyPrintf("parent span=%s", parentID)
+	}
+	if id, ok := RequestIDFromContext(ctx); ok {
+		s.tr.LazyPrintf("request id=%s", id)
+	}
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+// Printf adds an event to the span.
+func (s *Span) Printf(format string, args ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.finished {
+		s.tr.LazyPrintf(format, args...)
+	}
+}
+
+// Finish ends the span, marking it as failed if err isn't nil.
+func (s *Span) Finish(err error) {
+	elapsed := time.Since(s.start)
+	if s.root != nil {
+		if err != nil {
+			s.root.Printf("%s span=%s failed after %v: %v", s.title, s.SpanID, elapsed, err)
+		} else {
+			s.root.Printf("%s span=%s took %v", s.title, s.SpanID, elapsed)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return
+	}
+	if err != nil {
+		s.tr.LazyPrintf("error: %v", err)
+		s.tr.SetError()
+	}
+	s.finished = true
+	s.tr.Finish()
+}
+
+// TraceClientInterceptor returns a UnaryClientInterceptor that times each RPC in a child
+// of the span held by its context, if any, and sends the span to the server as metadata
+// so the server's spans join the same trace.
+func TraceClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := SpanFromContext(ctx); !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		ctx, span := StartSpan(ctx, "grpc.client", method)
+		ctx = metadata.AppendToOutgoingContext(ctx, traceParentMetadataKey, span.TraceParent())
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		span.Finish(err)
+		return err
+	}
+}
+
+// TraceServerInterceptor returns a UnaryServerInterceptor that times each RPC in a span,
+// which is a child of the client's span if it sent one.
+func TraceServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if sc, ok := spanContextFromMetadata(ctx); ok {
+			ctx = NewRemoteSpanContext(ctx, sc)
+		}
+		ctx, span := StartSpan(ctx, "grpc.server", info.FullMethod)
+		rsp, err := handler(ctx, req)
+		span.Finish(err)
+		return rsp, err
+	}
+}
+
+func spanContextFromMetadata(ctx context.Context) (SpanContext, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return SpanContext{}, false
+	}
+	values := md[traceParentMetadataKey]
+	if len(values) == 0 {
+		return SpanContext{}, false
+	}
+	return ParseTraceParent(values[0])
+}
@@ -0,0 +1,131 @@
+package util
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	var tests = []struct {
+		h    string
+		want SpanContext
+		ok   bool
+	}{
+		{h: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", want: SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}, ok: true},
+		{h: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", want: SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}, ok: true},
+		{h: ""},
+		{h: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{h: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{h: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{h: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{h: "00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01"},
+		{h: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"},
+		{h: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bx-01"},
+	}
+	for _, test := range tests {
+		got, ok := ParseTraceParent(test.h)
+		if ok != test.ok || got != test.want {
+			t.Errorf("ParseTraceParent(%q)=%+v,%v; want %+v,%v", test.h, got, ok, test.want, test.ok)
+		}
+		if ok {
+			if rt, _ := ParseTraceParent(got.TraceParent()); rt != got {
+				t.Errorf("ParseTraceParent(%q)=%+v; want %+v", got.TraceParent(), rt, got)
+			}
+		}
+	}
+}
+
+func TestStartSpan(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := SpanFromContext(ctx); ok {
+		t.Errorf("SpanFromContext(background)=_,true; want false")
+	}
+
+	ctx, root := StartSpan(ctx, "test", "root")
+	if !validTraceID(root.TraceID, traceIDLen) || !validTraceID(root.SpanID, spanIDLen) {
+		t.Errorf("StartSpan() created span %+v; want random IDs", root.SpanContext)
+	}
+	if got, ok := SpanFromContext(ctx); !ok || got != root {
+		t.Errorf("SpanFromContext()=%v,%v; want root span", got, ok)
+	}
+
+	_, child := StartSpan(ctx, "test", "child")
+	if got, want := child.TraceID, root.TraceID; got != want {
+		t.Errorf("child.TraceID=%s; want %s", got, want)
+	}
+	if child.SpanID == root.SpanID {
+		t.Errorf("child.SpanID=%s; want new span ID", child.SpanID)
+	}
+	if child.root != root {
+		t.Errorf("child.root=%v; want root span", child.root)
+	}
+	child.Finish(errors.New("failed"))
+	root.Finish(nil)
+	// Finishing twice, or a child finishing after its root, is harmless.
+	root.Finish(nil)
+	root.Printf("too late")
+
+	remote := SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	ctx = NewRemoteSpanContext(context.Background(), remote)
+	if _, ok := SpanFromContext(ctx); ok {
+		t.Errorf("SpanFromContext(remote)=_,true; want false")
+	}
+	_, span := StartSpan(ctx, "test", "server")
+	defer span.Finish(nil)
+	if got, want := span.TraceID, remote.TraceID; got != want {
+		t.Errorf("span.TraceID=%s; want %s", got, want)
+	}
+	if span.root != nil {
+		t.Errorf("span.root=%v; want nil for a remote parent", span.root)
+	}
+}
+
+func TestTraceInterceptors(t *testing.T) {
+	ctx, root := StartSpan(context.Background(), "test", "root")
+	defer root.Finish(nil)
+
+	// The client sends the span it starts for the RPC, which the server's span is a child of.
+	var sent SpanContext
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		var ok bool
+		if sent, ok = ParseTraceParent(md[traceParentMetadataKey][0]); !ok {
+			t.Errorf("client sent traceparent %v; want valid", md[traceParentMetadataKey])
+		}
+
+		var got *Span
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			got, _ = SpanFromContext(ctx)
+			return nil, nil
+		}
+		sctx := metadata.NewIncomingContext(context.Background(), md)
+		if _, err := TraceServerInterceptor()(sctx, nil, &grpc.UnaryServerInfo{FullMethod: "/method"}, handler); err != nil {
+			t.Errorf("server interceptor=%v", err)
+		}
+		if got == nil || got.TraceID != root.TraceID {
+			t.Errorf("server span=%v; want one in trace %s", got, root.TraceID)
+		}
+		return nil
+	}
+	if err := TraceClientInterceptor()(ctx, "/method", nil, nil, nil, invoker); err != nil {
+		t.Errorf("client interceptor=%v", err)
+	}
+	if sent.TraceID != root.TraceID || sent.SpanID == root.SpanID {
+		t.Errorf("client sent span %+v; want child of %+v", sent, root.SpanContext)
+	}
+
+	// Nothing is sent for RPCs that aren't traced.
+	invoker = func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if md, _ := metadata.FromOutgoingContext(ctx); len(md[traceParentMetadataKey]) > 0 {
+			t.Errorf("client sent traceparent %v for untraced RPC", md[traceParentMetadataKey])
+		}
+		return nil
+	}
+	if err := TraceClientInterceptor()(context.Background(), "/method", nil, nil, nil, invoker); err != nil {
+		t.Errorf("client interceptor=%v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package util
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+// TrustedTimeSource is a TimeSource that corrects the local clock using the offset
+// measured by a ClockOffsetSource, and raises an alarm if the local clock drifts too
+// far from it. Timestamps issued by a log (e.g. in SCTs and on queued leaves) have
+// compliance requirements and VM clocks can drift badly, so servers should use one of
+// these rather than trusting the system clock.
+type TrustedTimeSource struct {
+	local   TimeSource
+	source  ClockOffsetSource
+	maxSkew time.Duration
+
+	mu        sync.RWMutex
+	offset    time.Duration
+	lastCheck time.Time
+
+	vars       *expvar.Map
+	offsetVar  *expvar.Int
+	alarmVar   *expvar.Int
+	failureVar *expvar.Int
+}
+
+// NewTrustedTimeSource creates a TrustedTimeSource that corrects the time from local
+// using the offsets reported by source. An alarm is raised whenever the measured offset
+// is more than maxSkew.
+func NewTrustedTimeSource(local TimeSource, source ClockOffsetSource, maxSkew time.Duration) *TrustedTimeSource {
+	t := &TrustedTimeSource{
+		local:      local,
+		source:     source,
+		maxSkew:    maxSkew,
+		vars:       new(expvar.Map).Init(),
+		offsetVar:  new(expvar.Int),
+		alarmVar:   new(expvar.Int),
+		failureVar: new(expvar.Int),
+	}
+	t.vars.Set("clock-offset-micros", t.offsetVar)
+	t.vars.Set("clock-skew-alarm", t.alarmVar)
+	t.vars.Set("clock-check-failures", t.failureVar)
+	return t
+}
+
+// Now returns the local time corrected by the last measured offset.
+func (t *TrustedTimeSource) Now() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.local.Now().Add(t.offset)
+}
+
+// Offset returns the last measured offset of the local clock and when it was measured.
+// The time is zero if no measurement has succeeded yet.
+func (t *TrustedTimeSource) Offset() (time.Duration, time.Time) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.offset, t.lastCheck
+}
+
+// Skewed returns true if the last measured offset exceeded the maximum skew.
+func (t *TrustedTimeSource) Skewed() bool {
+	return t.alarmVar.Value() != 0
+}
+
+// Vars returns the exported stats for the time source. They must be published by the
+// caller for them to be visible.
+func (t *TrustedTimeSource) Vars() *expvar.Map {
+	return t.vars
+}
+
+// Refresh measures the local clock offset and updates the correction applied by Now.
+// If the measurement fails the previous correction continues to be used.
+func (t *TrustedTimeSource) Refresh() error {
+	offset, err := t.source.ClockOffset()
+	if err != nil {
+		t.failureVar.Add(1)
+		return err
+	}
+
+	t.mu.Lock()
+	t.offset = offset
+	t.lastCheck = t.local.Now()
+	t.mu.Unlock()
+
+	t.offsetVar.Set(int64(offset / time.Microsecond))
+	if offset > t.maxSkew || offset < -t.maxSkew {
+		if t.alarmVar.Value() == 0 {
+			glog.Errorf("Local clock is skewed by %v, more than the allowed %v", offset, t.maxSkew)
+		}
+		t.alarmVar.Set(1)
+	} else {
+		if t.alarmVar.Value() != 0 {
+			glog.Warningf("Local clock skew back within limits: %v", offset)
+		}
+		t.alarmVar.Set(0)
+	}
+	return nil
+}
+
+// Run refreshes the clock offset every interval until ctx is done.
+func (t *TrustedTimeSource) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Refresh(); err != nil {
+				glog.Warningf("Failed to check local clock offset: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeOffsetSource struct {
+	offset time.Duration
+	err    error
+}
+
+func (f *fakeOffsetSource) ClockOffset() (time.Duration, error) {
+	return f.offset, f.err
+}
+
+func TestTrustedTimeSource(t *testing.T) {
+	local := FakeTimeSource{FakeTime: time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)}
+
+	var tests = []struct {
+		offset    time.Duration
+		err       error
+		wantNow   time.Time
+		wantAlarm bool
+	}{
+		{offset: time.Millisecond * 5, wantNow: local.FakeTime.Add(time.Millisecond * 5)},
+		{offset: -time.Second * 3, wantNow: local.FakeTime.Add(-time.Second * 3), wantAlarm: true},
+		{offset: time.Second * 3, wantNow: local.FakeTime.Add(time.Second * 3), wantAlarm: true},
+		// A failed check keeps the previous correction and alarm state.
+		{err: errors.New("no reply"), wantNow: local.FakeTime.Add(time.Second * 3), wantAlarm: true},
+		{offset: -time.Millisecond, wantNow: local.FakeTime.Add(-time.Millisecond)},
+	}
+
+	source := &fakeOffsetSource{}
+	ts := NewTrustedTimeSource(local, source, time.Second)
+	if got, want := ts.Now(), local.FakeTime; !got.Equal(want) {
+		t.Errorf("Now()=%v before first check, want %v", got, want)
+	}
+
+	for _, test := range tests {
+		source.offset, source.err = test.offset, test.err
+		if err := ts.Refresh(); (err != nil) != (test.err != nil) {
+			t.Errorf("Refresh(%v, %v)=%v, want err: %v", test.offset, test.err, err, test.err != nil)
+		}
+		if got := ts.Now(); !got.Equal(test.wantNow) {
+			t.Errorf("Now()=%v after Refresh(%v, %v), want %v", got, test.offset, test.err, test.wantNow)
+		}
+		if got := ts.Skewed(); got != test.wantAlarm {
+			t.Errorf("Skewed()=%v after Refresh(%v, %v), want %v", got, test.offset, test.err, test.wantAlarm)
+		}
+	}
+
+	if got, want := ts.Vars().Get("clock-check-failures").String(), "1"; got != want {
+		t.Errorf("clock-check-failures=%s, want %s", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package verifier
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/trillian"
+)
+
+// Limits on the RFC 9162 encoding: a NodeHash is opaque<32..2^8-1>, and a path is a
+// vector of them with a two byte length.
+const (
+	minNodeHashLen = 32
+	maxNodeHashLen = 1<<8 - 1
+	maxPathLen     = 1<<16 - 1
+)
+
+// EncodeProof encodes the hashes of an inclusion or consistency proof in format, so it
+// can be passed to clients that expect one of the standard encodings. It returns nil for
+// trillian.ProofFormat_PROOF_NODES.
+func EncodeProof(format trillian.ProofFormat, hashes [][]byte) ([]byte, error) {
+	switch format {
+	case trillian.ProofFormat_PROOF_NODES:
+		return nil, nil
+	case trillian.ProofFormat_HASH_LIST:
+		var data []byte
+		for _, h := range hashes {
+			data = append(data, h...)
+		}
+		return data, nil
+	case trillian.ProofFormat_RFC6962:
+		if hashes == nil {
+			// An empty path is an empty array, not null.
+			hashes = [][]byte{}
+		}
+		return json.Marshal(hashes)
+	case trillian.ProofFormat_RFC9162:
+		data := make([]byte, 2)
+		for _, h := range hashes {
+			if len(h) < minNodeHashLen || len(h) > maxNodeHashLen {
+				return nil, fmt.Errorf("can't encode hash of %d bytes as a NodeHash", len(h))
+			}
+			data = append(data, byte(len(h)))
+			data = append(data, h...)
+		}
+		if len(data)-2 > maxPathLen {
+			return nil, fmt.Errorf("proof of %d bytes is too long to encode", len(data)-2)
+		}
+		binary.BigEndian.PutUint16(data, uint16(len(data)-2))
+		return data, nil
+	}
+	return nil, fmt.Errorf("unknown proof format %v", format)
+}
+
+// DecodeProof decodes the hashes of a proof encoded by EncodeProof. hashSize is the size
+// of the log's hashes, which is needed to split up a trillian.ProofFormat_HASH_LIST.
+func DecodeProof(format trillian.ProofFormat, data []byte, hashSize int) ([][]byte, error) {
+	switch format {
+	case trillian.ProofFormat_HASH_LIST:
+		if hashSize <= 0 || len(data)%hashSize != 0 {
+			return nil, fmt.Errorf("hash list of %d bytes isn't a multiple of the hash size %d", len(data), hashSize)
+		}
+		var hashes [][]byte
+		for ; len(data) > 0; data = data[hashSize:] {
+			hashes = append(hashes, data[:hashSize])
+		}
+		return hashes, nil
+	case trillian.ProofFormat_RFC6962:
+		var hashes [][]byte
+		if err := json.Unmarshal(data, &hashes); err != nil {
+			return nil, fmt.Errorf("failed to parse proof: %v", err)
+		}
+		return hashes, nil
+	case trillian.ProofFormat_RFC9162:
+		if len(data) < 2 {
+			return nil, errors.New("proof too short for its length")
+		}
+		if got, want := len(data)-2, int(binary.BigEndian.Uint16(data)); got != want {
+			return nil, fmt.Errorf("proof has %d bytes, but its length is %d", got, want)
+		}
+		var hashes [][]byte
+		for data = data[2:]; len(data) > 0; {
+			n := int(data[0])
+			if n < minNodeHashLen || len(data) < 1+n {
+				return nil, fmt.Errorf("invalid NodeHash of length %d", n)
+			}
+			hashes = append(hashes, data[1:1+n])
+			data = data[1+n:]
+		}
+		return hashes, nil
+	}
+	return nil, fmt.Errorf("can't decode proof format %v", format)
+}
@@ -0,0 +1,97 @@
+package verifier
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian"
+)
+
+func TestEncodeProof(t *testing.T) {
+	h1 := bytes.Repeat([]byte{0x01}, 32)
+	h2 := bytes.Repeat([]byte{0x02}, 32)
+
+	var tests = []struct {
+		format trillian.ProofFormat
+		hashes [][]byte
+		want   string // hex, or for RFC6962 the JSON
+	}{
+		{format: trillian.ProofFormat_PROOF_NODES, hashes: [][]byte{h1}, want: ""},
+		{format: trillian.ProofFormat_HASH_LIST, hashes: [][]byte{h1, h2}, want: hex.EncodeToString(append(append([]byte{}, h1...), h2...))},
+		{format: trillian.ProofFormat_RFC6962, hashes: [][]byte{h1}, want: `["AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="]`},
+		{format: trillian.ProofFormat_RFC6962, want: `[]`},
+		{format: trillian.ProofFormat_RFC9162, hashes: [][]byte{h1, h2}, want: "0042" + "20" + hex.EncodeToString(h1) + "20" + hex.EncodeToString(h2)},
+		{format: trillian.ProofFormat_RFC9162, want: "0000"},
+	}
+
+	for _, test := range tests {
+		data, err := EncodeProof(test.format, test.hashes)
+		if err != nil {
+			t.Errorf("EncodeProof(%v)=_,%v, want no error", test.format, err)
+			continue
+		}
+		got := hex.EncodeToString(data)
+		if test.format == trillian.ProofFormat_RFC6962 {
+			got = string(data)
+		}
+		if got != test.want {
+			t.Errorf("EncodeProof(%v)=%s, want %s", test.format, got, test.want)
+		}
+		if test.format == trillian.ProofFormat_PROOF_NODES {
+			continue
+		}
+
+		hashes, err := DecodeProof(test.format, data, 32)
+		if err != nil {
+			t.Errorf("DecodeProof(%v, %x)=_,%v, want no error", test.format, data, err)
+			continue
+		}
+		if len(hashes) != 0 || len(test.hashes) != 0 {
+			if !reflect.DeepEqual(hashes, test.hashes) {
+				t.Errorf("DecodeProof(%v, %x)=%x, want %x", test.format, data, hashes, test.hashes)
+			}
+		}
+	}
+}
+
+func TestEncodeProofErrors(t *testing.T) {
+	var tests = []struct {
+		format trillian.ProofFormat
+		hashes [][]byte
+		errStr string
+	}{
+		{format: trillian.ProofFormat_RFC9162, hashes: [][]byte{[]byte("short")}, errStr: "NodeHash"},
+		{format: trillian.ProofFormat_RFC9162, hashes: [][]byte{make([]byte, 256)}, errStr: "NodeHash"},
+		{format: trillian.ProofFormat(99), errStr: "unknown proof format"},
+	}
+
+	for _, test := range tests {
+		if _, err := EncodeProof(test.format, test.hashes); err == nil || !strings.Contains(err.Error(), test.errStr) {
+			t.Errorf("EncodeProof(%v)=_,%v, want error containing %q", test.format, err, test.errStr)
+		}
+	}
+}
+
+func TestDecodeProofErrors(t *testing.T) {
+	var tests = []struct {
+		format trillian.ProofFormat
+		data   []byte
+	}{
+		{format: trillian.ProofFormat_PROOF_NODES},
+		{format: trillian.ProofFormat_HASH_LIST, data: make([]byte, 33)},
+		{format: trillian.ProofFormat_RFC6962, data: []byte(`["not base64!"]`)},
+		{format: trillian.ProofFormat_RFC9162, data: []byte{0x00}},
+		{format: trillian.ProofFormat_RFC9162, data: []byte{0x00, 0x05, 0x01, 0x02}},
+		{format: trillian.ProofFormat_RFC9162, data: []byte{0x00, 0x02, 0x01, 0x02}},
+		{format: trillian.ProofFormat_RFC9162, data: append([]byte{0x00, 0x21, 0x21}, make([]byte, 32)...)},
+	}
+
+	for _, test := range tests {
+		if got, err := DecodeProof(test.format, test.data, 32); err == nil {
+			t.Errorf("DecodeProof(%v, %x)=%x,nil, want error", test.format, test.data, got)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package verifier
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"golang.org/x/crypto/ed25519"
+)
+
+// VerifyLogRootSignature checks that root is signed by the private key for pub, which
+// must be an ECDSA, RSA or Ed25519 public key.
+func VerifyLogRootSignature(pub gocrypto.PublicKey, root trillian.SignedLogRoot) error {
+	sig := root.GetSignature()
+	if sig == nil {
+		return errors.New("log root has no signature")
+	}
+	if key, ok := pub.(ed25519.PublicKey); ok {
+		if got, want := sig.SignatureAlgorithm, trillian.SignatureAlgorithm_ED25519; got != want {
+			return fmt.Errorf("log root signature has algorithm %v, want %v", got, want)
+		}
+		if got, want := sig.HashAlgorithm, trillian.HashAlgorithm_INTRINSIC; got != want {
+			return fmt.Errorf("log root signature has hash algorithm %v, want %v", got, want)
+		}
+		if !ed25519.Verify(key, crypto.HashLogRoot(root), sig.Signature) {
+			return errors.New("log root signature doesn't verify")
+		}
+		return nil
+	}
+	if got, want := sig.HashAlgorithm, trillian.HashAlgorithm_SHA256; got != want {
+		return fmt.Errorf("log root signature has hash algorithm %v, want %v", got, want)
+	}
+	digest := sha256.Sum256(crypto.HashLogRoot(root))
+
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		if got, want := sig.SignatureAlgorithm, trillian.SignatureAlgorithm_ECDSA; got != want {
+			return fmt.Errorf("log root signature has algorithm %v, want %v", got, want)
+		}
+		var ecSig struct {
+			R, S *big.Int
+		}
+		if rest, err := asn1.Unmarshal(sig.Signature, &ecSig); err != nil || len(rest) > 0 {
+			return errors.New("malformed ECDSA log root signature")
+		}
+		if ecSig.R.Sign() <= 0 || ecSig.S.Sign() <= 0 || !ecdsa.Verify(key, digest[:], ecSig.R, ecSig.S) {
+			return errors.New("log root signature doesn't verify")
+		}
+	case *rsa.PublicKey:
+		if got, want := sig.SignatureAlgorithm, trillian.SignatureAlgorithm_RSA; got != want {
+			return fmt.Errorf("log root signature has algorithm %v, want %v", got, want)
+		}
+		if err := rsa.VerifyPKCS1v15(key, gocrypto.SHA256, digest[:], sig.Signature); err != nil {
+			return fmt.Errorf("log root signature doesn't verify: %v", err)
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return nil
+}
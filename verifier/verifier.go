@@ -0,0 +1,74 @@
+// Package verifier checks the proofs and signed roots served by Trillian logs and maps.
+//
+// This is one of Trillian's stable API packages (see docs/APIStability.md). Its exported
+// identifiers keep their meaning and signatures within a major version of
+// trillian.APIVersion, however the merkle and storage packages it is built on change.
+// Proofs and hashes are plain byte slices so that callers don't depend on those packages.
+package verifier
+
+import (
+	"fmt"
+
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+)
+
+// LogVerifier verifies inclusion and consistency proofs from a log that uses RFC 6962
+// hashing with SHA-256, which is the only hashing scheme Trillian logs support at present.
+type LogVerifier struct {
+	hasher merkle.TreeHasher
+	v      merkle.LogVerifier
+}
+
+// NewLogVerifier returns a LogVerifier for RFC 6962 SHA-256 logs.
+func NewLogVerifier() *LogVerifier {
+	hasher := merkle.NewRFC6962TreeHasher(crypto.NewSHA256())
+	return &LogVerifier{hasher: hasher, v: merkle.NewLogVerifier(hasher)}
+}
+
+// HashLeaf returns the Merkle leaf hash of a leaf with the given value.
+func (l *LogVerifier) HashLeaf(value []byte) []byte {
+	return l.hasher.HashLeaf(value)
+}
+
+// VerifyInclusion checks that proof shows that the leaf with the given Merkle leaf hash
+// is at leafIndex in the tree of size treeSize with the given root hash.
+func (l *LogVerifier) VerifyInclusion(leafHash []byte, leafIndex, treeSize int64, proof [][]byte, root []byte) error {
+	return l.v.VerifyInclusionProof(leafIndex, treeSize, proof, root, leafHash)
+}
+
+// VerifyConsistency checks that proof shows that the tree of size size2 with root hash
+// root2 extends the tree of size size1 with root hash root1.
+func (l *LogVerifier) VerifyConsistency(size1, size2 int64, root1, root2 []byte, proof [][]byte) error {
+	return l.v.VerifyConsistencyProof(size1, size2, root1, root2, proof)
+}
+
+// MapVerifier verifies inclusion proofs from a map that uses SHA-256 for its keys and
+// RFC 6962 hashing for its nodes.
+type MapVerifier struct {
+	hasher merkle.MapHasher
+}
+
+// NewMapVerifier returns a MapVerifier for SHA-256 maps.
+func NewMapVerifier() *MapVerifier {
+	return &MapVerifier{hasher: merkle.NewMapHasher(merkle.NewRFC6962TreeHasher(crypto.NewSHA256()))}
+}
+
+// HashKey returns the hash of key, which is its path in the map.
+func (m *MapVerifier) HashKey(key []byte) []byte {
+	return m.hasher.HashKey(key)
+}
+
+// HashLeaf returns the Merkle leaf hash of a map leaf with the given value.
+func (m *MapVerifier) HashLeaf(value []byte) []byte {
+	return m.hasher.HashLeaf(value)
+}
+
+// VerifyInclusion checks that proof shows that key has the given value in the map with
+// the given root hash. Empty elements of proof stand for the hashes of empty subtrees.
+func (m *MapVerifier) VerifyInclusion(key, value []byte, proof [][]byte, root []byte) error {
+	if err := merkle.VerifyMapInclusionProof(m.HashKey(key), m.HashLeaf(value), root, proof, m.hasher); err != nil {
+		return fmt.Errorf("key %x: %v", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package verifier
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/google/trillian"
+	"github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/testonly"
+)
+
+func newTestTree(leaves int) *merkle.InMemoryMerkleTree {
+	mt := merkle.NewInMemoryMerkleTree(merkle.NewRFC6962TreeHasher(crypto.NewSHA256()))
+	for i := 0; i < leaves; i++ {
+		mt.AddLeaf([]byte(fmt.Sprintf("leaf %d", i)))
+	}
+	return mt
+}
+
+func toHashes(path []merkle.TreeEntryDescriptor) [][]byte {
+	hashes := make([][]byte, 0, len(path))
+	for _, p := range path {
+		hashes = append(hashes, p.Value.Hash())
+	}
+	return hashes
+}
+
+func TestLogVerifierHashLeaf(t *testing.T) {
+	// RFC 6962 leaf hashes are the SHA-256 hash of a zero byte followed by the leaf.
+	want := sha256.Sum256([]byte("\x00leaf"))
+	if got := NewLogVerifier().HashLeaf([]byte("leaf")); !bytes.Equal(got, want[:]) {
+		t.Errorf("HashLeaf(leaf)=%x, want %x", got, want)
+	}
+}
+
+func TestLogVerifierVerifyInclusion(t *testing.T) {
+	mt := newTestTree(10)
+	v := NewLogVerifier()
+	root := mt.RootAtSnapshot(7).Hash()
+	proof := toHashes(mt.PathToRootAtSnapshot(4, 7))
+	leafHash := v.HashLeaf([]byte("leaf 3"))
+
+	var tests = []struct {
+		descr     string
+		leafHash  []byte
+		leafIndex int64
+		treeSize  int64
+		proof     [][]byte
+		wantErr   bool
+	}{
+		{descr: "ok", leafHash: leafHash, leafIndex: 3, treeSize: 7, proof: proof},
+		{descr: "other-leaf", leafHash: v.HashLeaf([]byte("leaf 4")), leafIndex: 3, treeSize: 7, proof: proof, wantErr: true},
+		{descr: "other-index", leafHash: leafHash, leafIndex: 2, treeSize: 7, proof: proof, wantErr: true},
+		{descr: "other-size", leafHash: leafHash, leafIndex: 3, treeSize: 4, proof: proof, wantErr: true},
+		{descr: "short-proof", leafHash: leafHash, leafIndex: 3, treeSize: 7, proof: proof[1:], wantErr: true},
+	}
+	for _, test := range tests {
+		err := v.VerifyInclusion(test.leafHash, test.leafIndex, test.treeSize, test.proof, root)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: VerifyInclusion()=%v, want error: %v", test.descr, err, test.wantErr)
+		}
+	}
+}
+
+func TestLogVerifierVerifyConsistency(t *testing.T) {
+	mt := newTestTree(10)
+	v := NewLogVerifier()
+	root4, root9 := mt.RootAtSnapshot(4).Hash(), mt.RootAtSnapshot(9).Hash()
+	proof := toHashes(mt.SnapshotConsistency(4, 9))
+
+	if err := v.VerifyConsistency(4, 9, root4, root9, proof); err != nil {
+		t.Errorf("VerifyConsistency(4, 9)=%v, want nil", err)
+	}
+	if err := v.VerifyConsistency(4, 9, root9, root9, proof); err == nil {
+		t.Errorf("VerifyConsistency(4, 9) with wrong first root=nil, want error")
+	}
+	if err := v.VerifyConsistency(5, 9, root4, root9, proof); err == nil {
+		t.Errorf("VerifyConsistency(5, 9)=nil, want error")
+	}
+}
+
+// emptyMapRoot returns the root hash of a SHA-256 map with no values.
+func emptyMapRoot() []byte {
+	hash := sha256.Sum256([]byte{0})
+	for i := 0; i < sha256.Size*8; i++ {
+		hash = sha256.Sum256(append(append([]byte{1}, hash[:]...), hash[:]...))
+	}
+	return hash[:]
+}
+
+func TestMapVerifierVerifyInclusion(t *testing.T) {
+	v := NewMapVerifier()
+	root := emptyMapRoot()
+	// Every element of a proof in an empty map is the hash of an empty subtree.
+	proof := make([][]byte, sha256.Size*8)
+
+	if err := v.VerifyInclusion([]byte("key"), nil, proof, root); err != nil {
+		t.Errorf("VerifyInclusion(key, nil)=%v, want nil", err)
+	}
+	if err := v.VerifyInclusion([]byte("key"), []byte("value"), proof, root); err == nil {
+		t.Errorf("VerifyInclusion(key, value)=nil, want error")
+	}
+	if err := v.VerifyInclusion([]byte("key"), nil, proof[1:], root); err == nil {
+		t.Errorf("VerifyInclusion(key, nil) with short proof=nil, want error")
+	}
+}
+
+func TestVerifyLogRootSignature(t *testing.T) {
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPrivateKey(testonly.DemoPrivateKey, testonly.DemoPrivateKeyPass); err != nil {
+		t.Fatalf("Failed to load private key: %v", err)
+	}
+	signer, err := km.Signer()
+	if err != nil {
+		t.Fatalf("Failed to get signer: %v", err)
+	}
+	if err := km.LoadPublicKey(testonly.DemoPublicKey); err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	pub, err := km.GetPublicKey()
+	if err != nil {
+		t.Fatalf("Failed to get public key: %v", err)
+	}
+
+	root := trillian.SignedLogRoot{TimestampNanos: 1466179200000000000, RootHash: newTestTree(5).CurrentRoot().Hash(), TreeSize: 5}
+	sig, err := crypto.NewSigner(crypto.NewSHA256(), km.SignatureAlgorithm(), signer).SignLogRoot(root)
+	if err != nil {
+		t.Fatalf("SignLogRoot()=_,%v", err)
+	}
+	root.Signature = &sig
+
+	if err := VerifyLogRootSignature(pub, root); err != nil {
+		t.Errorf("VerifyLogRootSignature()=%v, want nil", err)
+	}
+
+	var tests = []struct {
+		descr  string
+		pub    interface{}
+		tamper func(r *trillian.SignedLogRoot)
+	}{
+		{descr: "tree-size", tamper: func(r *trillian.SignedLogRoot) { r.TreeSize++ }},
+		{descr: "timestamp", tamper: func(r *trillian.SignedLogRoot) { r.TimestampNanos++ }},
+		{descr: "root-hash", tamper: func(r *trillian.SignedLogRoot) { r.RootHash = []byte("other") }},
+		{descr: "no-signature", tamper: func(r *trillian.SignedLogRoot) { r.Signature = nil }},
+		{descr: "signature-algorithm", tamper: func(r *trillian.SignedLogRoot) { r.Signature.SignatureAlgorithm = trillian.SignatureAlgorithm_RSA }},
+		{descr: "malformed-signature", tamper: func(r *trillian.SignedLogRoot) { r.Signature.Signature = []byte("sig") }},
+		{descr: "key-type", pub: "key", tamper: func(r *trillian.SignedLogRoot) {}},
+	}
+	for _, test := range tests {
+		r := root
+		s := sig
+		r.Signature = &s
+		test.tamper(&r)
+		key := pub
+		if test.pub != nil {
+			key = test.pub
+		}
+		if err := VerifyLogRootSignature(key, r); err == nil {
+			t.Errorf("%s: VerifyLogRootSignature()=nil, want error", test.descr)
+		}
+	}
+}
+
+func TestVerifyLogRootSignatureEd25519(t *testing.T) {
+	km := crypto.NewPEMKeyManager()
+	if err := km.LoadPrivateKey(testonly.DemoEd25519PrivateKey, testonly.DemoPrivateKeyPass); err != nil {
+		t.Fatalf("Failed to load private key: %v", err)
+	}
+	if err := km.LoadPublicKey(testonly.DemoEd25519PublicKey); err != nil {
+		t.Fatalf("Failed to load public key: %v", err)
+	}
+	signer, err := km.Signer()
+	if err != nil {
+		t.Fatalf("Failed to get signer: %v", err)
+	}
+	pub, err := km.GetPublicKey()
+	if err != nil {
+		t.Fatalf("Failed to get public key: %v", err)
+	}
+
+	root := trillian.SignedLogRoot{TimestampNanos: 1466179200000000000, RootHash: newTestTree(5).CurrentRoot().Hash(), TreeSize: 5}
+	sig, err := crypto.NewSigner(crypto.NewSHA256(), km.SignatureAlgorithm(), signer).SignLogRoot(root)
+	if err != nil {
+		t.Fatalf("SignLogRoot()=_,%v", err)
+	}
+	root.Signature = &sig
+	if err := VerifyLogRootSignature(pub, root); err != nil {
+		t.Errorf("VerifyLogRootSignature()=%v, want nil", err)
+	}
+
+	for _, test := range []struct {
+		descr  string
+		tamper func(r *trillian.SignedLogRoot)
+	}{
+		{descr: "tree-size", tamper: func(r *trillian.SignedLogRoot) { r.TreeSize++ }},
+		{descr: "signature-algorithm", tamper: func(r *trillian.SignedLogRoot) { r.Signature.SignatureAlgorithm = trillian.SignatureAlgorithm_ECDSA }},
+		{descr: "hash-algorithm", tamper: func(r *trillian.SignedLogRoot) { r.Signature.HashAlgorithm = trillian.HashAlgorithm_SHA256 }},
+		{descr: "malformed-signature", tamper: func(r *trillian.SignedLogRoot) { r.Signature.Signature = []byte("sig") }},
+	} {
+		r := root
+		s := sig
+		r.Signature = &s
+		test.tamper(&r)
+		if err := VerifyLogRootSignature(pub, r); err == nil {
+			t.Errorf("%s: VerifyLogRootSignature()=nil, want error", test.descr)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+package trillian
+
+// APIVersion is the semantic version of Trillian's stable Go API: the client, verifier
+// and personality packages. Incompatible changes to those packages increment the major
+// version, and compatible additions the minor version. See docs/APIStability.md.
+const APIVersion = "1.0.0"